@@ -0,0 +1,107 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdApply = &cobra.Command{
+	Use:   "apply",
+	Short: "apply a declarative projects config",
+	Long: `apply a declarative projects config
+
+The projects config is defined by a yaml document. The declared projects are created when not existing and updated to match the declared config. The optional fields not declared are kept at their current value. Example:
+
+projects:
+  - path: org/org01/project01
+    remote_source: gitea
+    repo_path: org01/project01
+    visibility: private
+    untrusted_runs_need_approval: true
+    required_runs:
+      - build
+    trigger_policy:
+      branches: default
+      tags: true
+      pull_requests: true
+    variables:
+      - name: deploykey
+        values:
+          - secret_name: secret01
+            secret_var: deploykey
+            when:
+              branch: master
+
+The remote_source and repo_path fields are only used to create the project.
+When variables are declared they're all the project variables: the project variables not declared are removed. The secrets aren't managed, the variable values reference them by name and they must already exist in the project or in its parent project groups.
+
+Use "agola diff" to preview the changes.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := apply(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type applyOptions struct {
+	file string
+}
+
+var applyOpts applyOptions
+
+func init() {
+	flags := cmdApply.Flags()
+
+	flags.StringVarP(&applyOpts.file, "file", "f", "", `yaml file containing the projects config (use "-" to read from stdin)`)
+
+	if err := cmdApply.MarkFlagRequired("file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAgola.AddCommand(cmdApply)
+}
+
+func apply(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	dc, err := readDeclaredConfig(applyOpts.file)
+	if err != nil {
+		return err
+	}
+
+	// compute all the changes before applying them to not leave a partially
+	// applied config on a wrong declared config
+	changes, err := planConfigChanges(context.TODO(), gwclient, dc)
+	if err != nil {
+		return err
+	}
+	printConfigChanges(changes)
+
+	for _, c := range changes {
+		log.Infof("applying: %s %s", c.Op, c.Desc)
+		if err := c.apply(context.TODO(), gwclient); err != nil {
+			return errors.Errorf("failed to apply changes: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdAuditLogList = &cobra.Command{
+	Use:   "list",
+	Short: "list the audit log events, newest first. Requires admin privileges",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := auditLogList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type auditLogListOptions struct {
+	actor    string
+	action   string
+	resource string
+	since    string
+	until    string
+	start    string
+	limit    int
+	all      bool
+	asc      bool
+	format   string
+}
+
+var auditLogListOpts auditLogListOptions
+
+func init() {
+	flags := cmdAuditLogList.Flags()
+
+	flags.StringVar(&auditLogListOpts.actor, "actor", "", "only events of the actor (user name or id)")
+	flags.StringVar(&auditLogListOpts.action, "action", "", `only events with the action (i.e. "PUT /projects/{projectref}")`)
+	flags.StringVar(&auditLogListOpts.resource, "resource", "", `only events of the resource and its sub resources (i.e. "/projects/org01/project01")`)
+	flags.StringVar(&auditLogListOpts.since, "since", "", "only events at or after this time (RFC3339)")
+	flags.StringVar(&auditLogListOpts.until, "until", "", "only events before this time (RFC3339)")
+	flags.StringVar(&auditLogListOpts.start, "start", "", "starting audit event id (excluded) to fetch")
+	flags.IntVar(&auditLogListOpts.limit, "limit", 100, "max number of audit events to show")
+	flags.BoolVar(&auditLogListOpts.all, "all", false, "fetch all the matching audit events ignoring the limit")
+	flags.BoolVar(&auditLogListOpts.asc, "asc", false, "list the oldest events first")
+	flags.StringVar(&auditLogListOpts.format, "format", "json", "output format (json or csv)")
+
+	cmdAuditLog.AddCommand(cmdAuditLogList)
+}
+
+func parseTimeFlag(name, s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, errors.Errorf("cannot parse %s: %w", name, err)
+	}
+	return &t, nil
+}
+
+func auditLogList(cmd *cobra.Command, args []string) error {
+	if auditLogListOpts.format != "json" && auditLogListOpts.format != "csv" {
+		return errors.Errorf("unknown format %q", auditLogListOpts.format)
+	}
+	since, err := parseTimeFlag("since", auditLogListOpts.since)
+	if err != nil {
+		return err
+	}
+	until, err := parseTimeFlag("until", auditLogListOpts.until)
+	if err != nil {
+		return err
+	}
+
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	auditEvents := []*gwapitypes.AuditEventResponse{}
+	start := auditLogListOpts.start
+	for {
+		limit := auditLogListOpts.limit - len(auditEvents)
+		if auditLogListOpts.all {
+			// use the max page size allowed by the server
+			limit = 0
+		}
+		res, _, err := gwclient.GetAuditEvents(context.TODO(), auditLogListOpts.actor, auditLogListOpts.action, auditLogListOpts.resource, since, until, start, limit, auditLogListOpts.asc)
+		if err != nil {
+			return errors.Errorf("failed to get audit events: %w", err)
+		}
+		auditEvents = append(auditEvents, res...)
+		if len(res) == 0 || (!auditLogListOpts.all && len(auditEvents) >= auditLogListOpts.limit) {
+			break
+		}
+		start = res[len(res)-1].ID
+	}
+
+	switch auditLogListOpts.format {
+	case "json":
+		prettyJSON, err := json.MarshalIndent(auditEvents, "", "\t")
+		if err != nil {
+			return errors.Errorf("failed to convert audit events to json: %w", err)
+		}
+		if _, err := os.Stdout.Write(append(prettyJSON, '\n')); err != nil {
+			return err
+		}
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		if err := w.Write([]string{"id", "time", "actor_type", "actor_id", "actor_name", "action", "resource", "status_code"}); err != nil {
+			return err
+		}
+		for _, e := range auditEvents {
+			record := []string{e.ID, e.Time.Format(time.RFC3339Nano), e.ActorType, e.ActorID, e.ActorName, e.Action, e.Resource, strconv.Itoa(e.StatusCode)}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
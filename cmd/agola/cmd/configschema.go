@@ -0,0 +1,83 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"agola.io/agola/internal/config"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdConfigSchema = &cobra.Command{
+	Use:   "schema",
+	Short: "print the run config json schema",
+	Long: `print the run config json schema
+
+The schema describes the run config (the output of the .agola/config.jsonnet evaluation or the yaml/json config files) and could be used by editors and linters to validate it. By default the schema of this agola version is printed, use --remote to get the one of the gateway agola version.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configSchema(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type configSchemaOptions struct {
+	remote bool
+}
+
+var configSchemaOpts configSchemaOptions
+
+func init() {
+	flags := cmdConfigSchema.Flags()
+
+	flags.BoolVar(&configSchemaOpts.remote, "remote", false, "get the schema from the gateway")
+
+	cmdConfig.AddCommand(cmdConfigSchema)
+}
+
+func configSchema(cmd *cobra.Command, args []string) error {
+	var schema []byte
+	if configSchemaOpts.remote {
+		gwclient := gwclient.NewClient(gatewayURL, token)
+
+		var err error
+		schema, _, err = gwclient.GetRunConfigSchema(context.TODO())
+		if err != nil {
+			return errors.Errorf("failed to get run config schema: %w", err)
+		}
+	} else {
+		var err error
+		schema, err = json.Marshal(config.Schema())
+		if err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, schema, "", "  "); err != nil {
+		return err
+	}
+	fmt.Println(out.String())
+
+	return nil
+}
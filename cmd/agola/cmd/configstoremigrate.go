@@ -0,0 +1,86 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	csclient "agola.io/agola/services/configstore/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdConfigstoreMigrate = &cobra.Command{
+	Use:   "migrate",
+	Short: "migrate all the configstore data to another configstore",
+	Long: `migrate all the configstore data to another configstore
+
+It's used to migrate from a configstore using the etcd storage to a configstore
+using the sql storage. The source configstore should be in maintenance mode to
+avoid losing changes made during the migration. All the data of the destination
+configstore will be replaced.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configstoreMigrate(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type configstoreMigrateOptions struct {
+	fromURL string
+	toURL   string
+}
+
+var configstoreMigrateOpts configstoreMigrateOptions
+
+func init() {
+	flags := cmdConfigstoreMigrate.Flags()
+
+	flags.StringVar(&configstoreMigrateOpts.fromURL, "from-url", "", "source configstore url")
+	flags.StringVar(&configstoreMigrateOpts.toURL, "to-url", "", "destination configstore url")
+
+	if err := cmdConfigstoreMigrate.MarkFlagRequired("from-url"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdConfigstoreMigrate.MarkFlagRequired("to-url"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdConfigstore.AddCommand(cmdConfigstoreMigrate)
+}
+
+func configstoreMigrate(cmd *cobra.Command, args []string) error {
+	ctx := context.TODO()
+
+	fromClient := csclient.NewClient(configstoreMigrateOpts.fromURL)
+	toClient := csclient.NewClient(configstoreMigrateOpts.toURL)
+
+	log.Infof("exporting data from %q", configstoreMigrateOpts.fromURL)
+	resp, err := fromClient.Export(ctx)
+	if err != nil {
+		return errors.Errorf("failed to export data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	log.Infof("importing data to %q", configstoreMigrateOpts.toURL)
+	if _, err := toClient.Import(ctx, resp.Body); err != nil {
+		return errors.Errorf("failed to import data: %w", err)
+	}
+
+	log.Infof("migration completed")
+
+	return nil
+}
@@ -0,0 +1,478 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	cstypes "agola.io/agola/services/configstore/types"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/ghodss/yaml"
+	errors "golang.org/x/xerrors"
+)
+
+// declaredConfig is the declarative representation of the projects config
+// managed by "agola apply" and "agola diff"
+type declaredConfig struct {
+	Projects []*declaredProject `json:"projects"`
+}
+
+// declaredProject is the declared config of a project. The optional fields
+// not defined aren't managed and are kept at their current value.
+type declaredProject struct {
+	// Path is the project full path (i.e. "org/org01/project01")
+	Path string `json:"path"`
+
+	// project creation fields. They're ignored for existing projects.
+	RemoteSource        string `json:"remote_source"`
+	RepoPath            string `json:"repo_path"`
+	SkipSSHHostKeyCheck bool   `json:"skip_ssh_host_key_check"`
+
+	Visibility                *string   `json:"visibility"`
+	PassVarsToForkedPR        *bool     `json:"pass_vars_to_forked_pr"`
+	NetworkPolicy             *string   `json:"network_policy"`
+	SecurityProfile           *string   `json:"security_profile"`
+	UntrustedRunsNeedApproval *bool     `json:"untrusted_runs_need_approval"`
+	ConfigFromBaseBranch      *bool     `json:"config_from_base_branch"`
+	MaxStepLogSize            *int64    `json:"max_step_log_size"`
+	WebhookRunSelectors       *[]string `json:"webhook_runs"`
+	RequiredRuns              *[]string `json:"required_runs"`
+
+	TriggerPolicy *gwapitypes.SetProjectTriggerPolicyRequest `json:"trigger_policy"`
+
+	// Variables, when defined, are all the project variables: the project
+	// variables not declared are removed. The variable values reference the
+	// secrets by name, the secrets must already exist.
+	Variables *[]*declaredVariable `json:"variables"`
+}
+
+type declaredVariable struct {
+	Name   string          `json:"name"`
+	Values []VariableValue `json:"values"`
+}
+
+func readDeclaredConfig(file string) (*declaredConfig, error) {
+	// "github.com/ghodss/yaml" doesn't provide a streaming decoder
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var dc *declaredConfig
+	if err := yaml.Unmarshal(data, &dc); err != nil {
+		return nil, errors.Errorf("failed to unmarshal config: %w", err)
+	}
+	if dc == nil {
+		dc = &declaredConfig{}
+	}
+	if err := dc.validate(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+func (dc *declaredConfig) validate() error {
+	paths := map[string]struct{}{}
+	for _, dp := range dc.Projects {
+		if dp == nil || dp.Path == "" {
+			return errors.Errorf("project with empty path")
+		}
+		if path.Dir(dp.Path) == "." {
+			return errors.Errorf("project %q: path must contain the parent project group path", dp.Path)
+		}
+		if _, ok := paths[dp.Path]; ok {
+			return errors.Errorf("duplicate project %q", dp.Path)
+		}
+		paths[dp.Path] = struct{}{}
+
+		if dp.Visibility != nil && !IsValidVisibility(*dp.Visibility) {
+			return errors.Errorf("project %q: invalid visibility %q", dp.Path, *dp.Visibility)
+		}
+		if tp := dp.TriggerPolicy; tp != nil && !cstypes.IsValidTriggerBranchesPolicy(cstypes.TriggerBranchesPolicy(tp.Branches)) {
+			return errors.Errorf("project %q: invalid trigger policy branches %q", dp.Path, tp.Branches)
+		}
+		if dp.Variables != nil {
+			names := map[string]struct{}{}
+			for _, v := range *dp.Variables {
+				if v == nil || v.Name == "" {
+					return errors.Errorf("project %q: variable with empty name", dp.Path)
+				}
+				if _, ok := names[v.Name]; ok {
+					return errors.Errorf("project %q: duplicate variable %q", dp.Path, v.Name)
+				}
+				names[v.Name] = struct{}{}
+				if len(v.Values) == 0 {
+					return errors.Errorf("project %q: empty variable %q values", dp.Path, v.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// configChange is a change needed to reconcile the live config with the
+// declared one
+type configChange struct {
+	// Op is "+" (create), "~" (update) or "-" (delete)
+	Op      string
+	Desc    string
+	Details []string
+
+	apply func(ctx context.Context, gwc *gwclient.Client) error
+}
+
+func (c *configChange) String() string {
+	s := fmt.Sprintf("%s %s\n", c.Op, c.Desc)
+	for _, d := range c.Details {
+		s += fmt.Sprintf("    %s\n", d)
+	}
+	return s
+}
+
+// planConfigChanges compares the declared config with the live one and
+// returns the changes needed to reconcile them
+func planConfigChanges(ctx context.Context, gwc *gwclient.Client, dc *declaredConfig) ([]*configChange, error) {
+	changes := []*configChange{}
+	for _, dp := range dc.Projects {
+		pchanges, err := planProjectChanges(ctx, gwc, dp)
+		if err != nil {
+			return nil, errors.Errorf("project %q: %w", dp.Path, err)
+		}
+		changes = append(changes, pchanges...)
+	}
+	return changes, nil
+}
+
+func planProjectChanges(ctx context.Context, gwc *gwclient.Client, dp *declaredProject) ([]*configChange, error) {
+	changes := []*configChange{}
+
+	project, resp, err := gwc.GetProject(ctx, dp.Path)
+	if err != nil {
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			return nil, errors.Errorf("failed to get project: %w", err)
+		}
+		project = nil
+	}
+
+	if project == nil {
+		if dp.RemoteSource == "" || dp.RepoPath == "" {
+			return nil, errors.Errorf("remote source and repo path are required to create the project")
+		}
+		changes = append(changes, &configChange{
+			Op:    "+",
+			Desc:  fmt.Sprintf("project %s", dp.Path),
+			apply: dp.create,
+		})
+	} else {
+		ureq, details := dp.updateRequest(project)
+		if len(details) > 0 {
+			changes = append(changes, &configChange{
+				Op:      "~",
+				Desc:    fmt.Sprintf("project %s", dp.Path),
+				Details: details,
+				apply: func(ctx context.Context, gwc *gwclient.Client) error {
+					if _, _, err := gwc.UpdateProject(ctx, dp.Path, ureq); err != nil {
+						return errors.Errorf("failed to update project %q: %w", dp.Path, err)
+					}
+					return nil
+				},
+			})
+		}
+	}
+
+	if tp := dp.TriggerPolicy; tp != nil {
+		var cur *gwapitypes.SetProjectTriggerPolicyRequest
+		if project != nil && project.TriggerPolicy != nil {
+			cur = &gwapitypes.SetProjectTriggerPolicyRequest{
+				Branches:     project.TriggerPolicy.Branches,
+				Tags:         project.TriggerPolicy.Tags,
+				PullRequests: project.TriggerPolicy.PullRequests,
+			}
+		} else {
+			dtp := cstypes.DefaultProjectTriggerPolicy()
+			cur = &gwapitypes.SetProjectTriggerPolicyRequest{
+				Branches:     string(dtp.Branches),
+				Tags:         dtp.Tags,
+				PullRequests: dtp.PullRequests,
+			}
+		}
+		if *tp != *cur {
+			changes = append(changes, &configChange{
+				Op:      "~",
+				Desc:    fmt.Sprintf("trigger policy of project %s", dp.Path),
+				Details: []string{fmt.Sprintf("%+v => %+v", *cur, *tp)},
+				apply: func(ctx context.Context, gwc *gwclient.Client) error {
+					if _, _, err := gwc.SetProjectTriggerPolicy(ctx, dp.Path, tp); err != nil {
+						return errors.Errorf("failed to set project %q trigger policy: %w", dp.Path, err)
+					}
+					return nil
+				},
+			})
+		}
+	}
+
+	if dp.Variables != nil {
+		vchanges, err := dp.planVariablesChanges(ctx, gwc, project != nil)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, vchanges...)
+	}
+
+	return changes, nil
+}
+
+func (dp *declaredProject) create(ctx context.Context, gwc *gwclient.Client) error {
+	req := &gwapitypes.CreateProjectRequest{
+		Name:                path.Base(dp.Path),
+		ParentRef:           path.Dir(dp.Path),
+		Visibility:          gwapitypes.VisibilityPublic,
+		RepoPath:            dp.RepoPath,
+		RemoteSourceName:    dp.RemoteSource,
+		SkipSSHHostKeyCheck: dp.SkipSSHHostKeyCheck,
+	}
+	if dp.Visibility != nil {
+		req.Visibility = gwapitypes.Visibility(*dp.Visibility)
+	}
+	if dp.PassVarsToForkedPR != nil {
+		req.PassVarsToForkedPR = *dp.PassVarsToForkedPR
+	}
+	if dp.NetworkPolicy != nil {
+		req.NetworkPolicy = *dp.NetworkPolicy
+	}
+	if dp.SecurityProfile != nil {
+		req.SecurityProfile = *dp.SecurityProfile
+	}
+	if dp.UntrustedRunsNeedApproval != nil {
+		req.UntrustedRunsNeedApproval = *dp.UntrustedRunsNeedApproval
+	}
+	if dp.ConfigFromBaseBranch != nil {
+		req.ConfigFromBaseBranch = *dp.ConfigFromBaseBranch
+	}
+	if dp.MaxStepLogSize != nil {
+		req.MaxStepLogSize = *dp.MaxStepLogSize
+	}
+	if _, _, err := gwc.CreateProject(ctx, req); err != nil {
+		return errors.Errorf("failed to create project %q: %w", dp.Path, err)
+	}
+
+	// the fields not available at creation are set with an update
+	if dp.WebhookRunSelectors != nil || dp.RequiredRuns != nil {
+		ureq := &gwapitypes.UpdateProjectRequest{
+			WebhookRunSelectors: dp.WebhookRunSelectors,
+			RequiredRuns:        dp.RequiredRuns,
+		}
+		if _, _, err := gwc.UpdateProject(ctx, dp.Path, ureq); err != nil {
+			return errors.Errorf("failed to update project %q: %w", dp.Path, err)
+		}
+	}
+	return nil
+}
+
+// updateRequest returns the request to update the project declared fields
+// that differ from the live ones and a description of the differences
+func (dp *declaredProject) updateRequest(p *gwapitypes.ProjectResponse) (*gwapitypes.UpdateProjectRequest, []string) {
+	req := &gwapitypes.UpdateProjectRequest{}
+	details := []string{}
+
+	if dp.Visibility != nil && *dp.Visibility != string(p.Visibility) {
+		visibility := gwapitypes.Visibility(*dp.Visibility)
+		req.Visibility = &visibility
+		details = append(details, fmt.Sprintf("visibility: %q => %q", p.Visibility, *dp.Visibility))
+	}
+	if dp.PassVarsToForkedPR != nil && *dp.PassVarsToForkedPR != p.PassVarsToForkedPR {
+		req.PassVarsToForkedPR = dp.PassVarsToForkedPR
+		details = append(details, fmt.Sprintf("pass_vars_to_forked_pr: %t => %t", p.PassVarsToForkedPR, *dp.PassVarsToForkedPR))
+	}
+	if dp.NetworkPolicy != nil && *dp.NetworkPolicy != p.NetworkPolicy {
+		req.NetworkPolicy = dp.NetworkPolicy
+		details = append(details, fmt.Sprintf("network_policy: %q => %q", p.NetworkPolicy, *dp.NetworkPolicy))
+	}
+	if dp.SecurityProfile != nil && *dp.SecurityProfile != p.SecurityProfile {
+		req.SecurityProfile = dp.SecurityProfile
+		details = append(details, fmt.Sprintf("security_profile: %q => %q", p.SecurityProfile, *dp.SecurityProfile))
+	}
+	if dp.UntrustedRunsNeedApproval != nil && *dp.UntrustedRunsNeedApproval != p.UntrustedRunsNeedApproval {
+		req.UntrustedRunsNeedApproval = dp.UntrustedRunsNeedApproval
+		details = append(details, fmt.Sprintf("untrusted_runs_need_approval: %t => %t", p.UntrustedRunsNeedApproval, *dp.UntrustedRunsNeedApproval))
+	}
+	if dp.ConfigFromBaseBranch != nil && *dp.ConfigFromBaseBranch != p.ConfigFromBaseBranch {
+		req.ConfigFromBaseBranch = dp.ConfigFromBaseBranch
+		details = append(details, fmt.Sprintf("config_from_base_branch: %t => %t", p.ConfigFromBaseBranch, *dp.ConfigFromBaseBranch))
+	}
+	if dp.MaxStepLogSize != nil && *dp.MaxStepLogSize != p.MaxStepLogSize {
+		req.MaxStepLogSize = dp.MaxStepLogSize
+		details = append(details, fmt.Sprintf("max_step_log_size: %d => %d", p.MaxStepLogSize, *dp.MaxStepLogSize))
+	}
+	if dp.WebhookRunSelectors != nil && !stringSlicesEqual(*dp.WebhookRunSelectors, p.WebhookRunSelectors) {
+		req.WebhookRunSelectors = dp.WebhookRunSelectors
+		details = append(details, fmt.Sprintf("webhook_runs: %q => %q", p.WebhookRunSelectors, *dp.WebhookRunSelectors))
+	}
+	if dp.RequiredRuns != nil && !stringSlicesEqual(*dp.RequiredRuns, p.RequiredRuns) {
+		req.RequiredRuns = dp.RequiredRuns
+		details = append(details, fmt.Sprintf("required_runs: %q => %q", p.RequiredRuns, *dp.RequiredRuns))
+	}
+
+	return req, details
+}
+
+func (dp *declaredProject) planVariablesChanges(ctx context.Context, gwc *gwclient.Client, projectExists bool) ([]*configChange, error) {
+	// the secrets are only referenced by name, check that they're available
+	// to the project (defined in the project or in its parent project groups)
+	var secrets []*gwapitypes.SecretResponse
+	var err error
+	if projectExists {
+		secrets, _, err = gwc.GetProjectSecrets(ctx, dp.Path, true, true)
+	} else {
+		secrets, _, err = gwc.GetProjectGroupSecrets(ctx, path.Dir(dp.Path), true, true)
+	}
+	if err != nil {
+		return nil, errors.Errorf("failed to get secrets: %w", err)
+	}
+	secretNames := map[string]struct{}{}
+	for _, s := range secrets {
+		secretNames[s.Name] = struct{}{}
+	}
+
+	curVariables := map[string]*gwapitypes.VariableResponse{}
+	if projectExists {
+		variables, _, err := gwc.GetProjectVariables(ctx, dp.Path, false, false)
+		if err != nil {
+			return nil, errors.Errorf("failed to get variables: %w", err)
+		}
+		for _, v := range variables {
+			curVariables[v.Name] = v
+		}
+	}
+
+	req := &gwapitypes.SetVariablesRequest{Prune: true}
+	details := []string{}
+	declared := map[string]struct{}{}
+	for _, v := range *dp.Variables {
+		declared[v.Name] = struct{}{}
+
+		values := []gwapitypes.VariableValueRequest{}
+		for _, value := range v.Values {
+			if _, ok := secretNames[value.SecretName]; !ok {
+				return nil, errors.Errorf("variable %q references not existing secret %q", v.Name, value.SecretName)
+			}
+			values = append(values, gwapitypes.VariableValueRequest{
+				SecretName: value.SecretName,
+				SecretVar:  value.SecretVar,
+				When:       value.When.ToWhen(),
+			})
+		}
+		req.Variables = append(req.Variables, &gwapitypes.CreateVariableRequest{Name: v.Name, Values: values})
+
+		cv, ok := curVariables[v.Name]
+		if !ok {
+			details = append(details, fmt.Sprintf("+ %s", v.Name))
+			continue
+		}
+		curValues := []gwapitypes.VariableValueRequest{}
+		for _, value := range cv.Values {
+			curValues = append(curValues, gwapitypes.VariableValueRequest{
+				SecretName: value.SecretName,
+				SecretVar:  value.SecretVar,
+				When:       value.When,
+			})
+		}
+		equal, err := jsonEqual(values, curValues)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			details = append(details, fmt.Sprintf("~ %s", v.Name))
+		}
+	}
+	removed := []string{}
+	for name := range curVariables {
+		if _, ok := declared[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		details = append(details, fmt.Sprintf("- %s", name))
+	}
+
+	if len(details) == 0 {
+		return nil, nil
+	}
+
+	return []*configChange{
+		{
+			Op:      "~",
+			Desc:    fmt.Sprintf("variables of project %s", dp.Path),
+			Details: details,
+			apply: func(ctx context.Context, gwc *gwclient.Client) error {
+				if _, _, err := gwc.SetProjectVariables(ctx, dp.Path, req); err != nil {
+					return errors.Errorf("failed to set project %q variables: %w", dp.Path, err)
+				}
+				return nil
+			},
+		},
+	}, nil
+}
+
+func stringSlicesEqual(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// jsonEqual compares the json representation of the provided values to not
+// report differences between nil and empty fields omitted by the api
+func jsonEqual(a, b interface{}) (bool, error) {
+	aj, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bj, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return string(aj) == string(bj), nil
+}
+
+func printConfigChanges(changes []*configChange) {
+	if len(changes) == 0 {
+		fmt.Printf("no changes\n")
+		return
+	}
+	var b strings.Builder
+	for _, c := range changes {
+		b.WriteString(c.String())
+	}
+	fmt.Print(b.String())
+}
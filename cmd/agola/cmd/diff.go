@@ -0,0 +1,72 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdDiff = &cobra.Command{
+	Use:   "diff",
+	Short: "show the changes needed to apply a declarative projects config",
+	Long: `show the changes needed to apply a declarative projects config
+
+The projects config file is compared with the current config and the changes that "agola apply" would do are reported. See "agola apply --help" for the config file format.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := diff(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type diffOptions struct {
+	file string
+}
+
+var diffOpts diffOptions
+
+func init() {
+	flags := cmdDiff.Flags()
+
+	flags.StringVarP(&diffOpts.file, "file", "f", "", `yaml file containing the projects config (use "-" to read from stdin)`)
+
+	if err := cmdDiff.MarkFlagRequired("file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdAgola.AddCommand(cmdDiff)
+}
+
+func diff(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	dc, err := readDeclaredConfig(diffOpts.file)
+	if err != nil {
+		return err
+	}
+
+	changes, err := planConfigChanges(context.TODO(), gwclient, dc)
+	if err != nil {
+		return err
+	}
+	printConfigChanges(changes)
+
+	return nil
+}
@@ -55,6 +55,8 @@ type directRunStartOptions struct {
 
 	vars     []string
 	varFiles []string
+
+	runTags []string
 }
 
 var directRunStartOpts directRunStartOptions
@@ -70,6 +72,7 @@ func init() {
 	flags.StringArrayVar(&directRunStartOpts.prRefRegexes, "pull-request-ref-regexes", []string{`refs/pull/(\d+)/head`, `refs/merge-requests/(\d+)/head`}, `regular expression to determine if a ref is a pull request`)
 	flags.StringArrayVar(&directRunStartOpts.vars, "var", []string{}, `list of variables (name=value). This option can be repeated multiple times`)
 	flags.StringArrayVar(&directRunStartOpts.varFiles, "var-file", []string{}, `yaml file containing the variables as a yaml/json map. This option can be repeated multiple times`)
+	flags.StringSliceVar(&directRunStartOpts.runTags, "run-tag", nil, "add the provided tag to the created runs. This option can be repeated multiple times")
 
 	cmdDirectRun.AddCommand(cmdDirectRunStart)
 }
@@ -212,6 +215,7 @@ func directRunStart(cmd *cobra.Command, args []string) error {
 		Message:               message,
 		PullRequestRefRegexes: directRunStartOpts.prRefRegexes,
 		Variables:             variables,
+		RunTags:               directRunStartOpts.runTags,
 	}
 	if _, err := gwclient.UserCreateRun(context.TODO(), req); err != nil {
 		return err
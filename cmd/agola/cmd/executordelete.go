@@ -0,0 +1,64 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdExecutorDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "deregister an executor, its not finished tasks will be marked as failed (admin only)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := executorDelete(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type executorDeleteOptions struct {
+	executorID string
+}
+
+var executorDeleteOpts executorDeleteOptions
+
+func init() {
+	flags := cmdExecutorDelete.Flags()
+
+	flags.StringVar(&executorDeleteOpts.executorID, "executorid", "", "executor id")
+
+	if err := cmdExecutorDelete.MarkFlagRequired("executorid"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdExecutor.AddCommand(cmdExecutorDelete)
+}
+
+func executorDelete(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	log.Infof("deleting executor")
+	if _, err := gwclient.DeleteExecutor(context.TODO(), executorDeleteOpts.executorID); err != nil {
+		return errors.Errorf("failed to delete executor: %w", err)
+	}
+	log.Infof("executor deleted")
+
+	return nil
+}
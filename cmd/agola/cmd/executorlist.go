@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdExecutorList = &cobra.Command{
+	Use:   "list",
+	Short: "list the registered executors (admin only)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := executorList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdExecutor.AddCommand(cmdExecutorList)
+}
+
+func executorList(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	executors, _, err := gwclient.GetExecutors(context.TODO())
+	if err != nil {
+		return errors.Errorf("failed to get executors: %w", err)
+	}
+
+	for _, e := range executors {
+		status := "alive"
+		if !e.Alive {
+			status = "not alive"
+		}
+		if e.Draining {
+			status += ", draining"
+		}
+		lastUpdate := ""
+		if e.LastStatusUpdateTime != nil {
+			lastUpdate = e.LastStatusUpdateTime.Format(time.RFC3339)
+		}
+		tasks := fmt.Sprintf("%d", e.ActiveTasks)
+		if e.ActiveTasksLimit > 0 {
+			tasks = fmt.Sprintf("%d/%d (%.0f%%)", e.ActiveTasks, e.ActiveTasksLimit, e.Utilization*100)
+		}
+		labels := []string{}
+		for k, v := range e.Labels {
+			labels = append(labels, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(labels)
+
+		fmt.Printf("%s: %s, os: %s, archs: %s, active tasks: %s, labels: %s, last status update: %s\n", e.ID, status, e.OS, strings.Join(e.Archs, ","), tasks, strings.Join(labels, ","), lastUpdate)
+	}
+
+	return nil
+}
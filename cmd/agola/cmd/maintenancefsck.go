@@ -0,0 +1,140 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"agola.io/agola/internal/services/configstore/fsck"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdMaintenanceFsck = &cobra.Command{
+	Use:   "fsck",
+	Short: "check the configstore data consistency (admin only)",
+	Long: `check the configstore data consistency (admin only)
+
+Reports the objects with dangling references (like projects referencing a
+deleted remote source) and the orphaned objects (like the secrets of a deleted
+project). It's read only by default, with --repair the problems that could be
+automatically repaired are fixed deleting the orphaned objects or removing the
+dangling references.
+
+With --export-file the check is done offline on a configstore export.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := maintenanceFsck(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type maintenanceFsckOptions struct {
+	repair     bool
+	exportFile string
+}
+
+var maintenanceFsckOpts maintenanceFsckOptions
+
+func init() {
+	flags := cmdMaintenanceFsck.Flags()
+
+	flags.BoolVar(&maintenanceFsckOpts.repair, "repair", false, "repair the problems that could be automatically repaired")
+	flags.StringVar(&maintenanceFsckOpts.exportFile, "export-file", "", "check offline the provided configstore export file")
+
+	cmdMaintenance.AddCommand(cmdMaintenanceFsck)
+}
+
+func maintenanceFsck(cmd *cobra.Command, args []string) error {
+	var problems []*gwapitypes.FsckProblem
+	if maintenanceFsckOpts.exportFile != "" {
+		if maintenanceFsckOpts.repair {
+			return errors.Errorf("repair isn't supported when checking an export file")
+		}
+
+		var err error
+		problems, err = fsckExportFile(maintenanceFsckOpts.exportFile)
+		if err != nil {
+			return err
+		}
+	} else {
+		gwclient := gwclient.NewClient(gatewayURL, token)
+
+		res, _, err := gwclient.Fsck(context.TODO(), maintenanceFsckOpts.repair)
+		if err != nil {
+			return errors.Errorf("failed to check configstore: %w", err)
+		}
+		problems = res.Problems
+	}
+
+	unrepaired := 0
+	for _, p := range problems {
+		status := "not repairable"
+		if p.Repairable {
+			status = "repairable"
+		}
+		if p.Repaired {
+			status = "repaired"
+		} else {
+			unrepaired++
+		}
+		fmt.Printf("%s %q: %s (%s)\n", p.ObjectType, p.ObjectID, p.Description, status)
+	}
+
+	if unrepaired > 0 {
+		return errors.Errorf("found %d problems", unrepaired)
+	}
+	if len(problems) > 0 {
+		log.Infof("all the problems have been repaired")
+	} else {
+		log.Infof("no problems found")
+	}
+
+	return nil
+}
+
+func fsckExportFile(exportFile string) ([]*gwapitypes.FsckProblem, error) {
+	f, err := os.Open(exportFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d, err := fsck.ReadExport(f)
+	if err != nil {
+		return nil, errors.Errorf("failed to read export file: %w", err)
+	}
+	fsckProblems, err := fsck.Check(d)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := make([]*gwapitypes.FsckProblem, len(fsckProblems))
+	for i, p := range fsckProblems {
+		problems[i] = &gwapitypes.FsckProblem{
+			ObjectType:  string(p.ObjectType),
+			ObjectID:    p.ObjectID,
+			Description: p.Description,
+			Repairable:  p.Repairable(),
+		}
+	}
+
+	return problems, nil
+}
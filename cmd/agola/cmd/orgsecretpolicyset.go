@@ -0,0 +1,87 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdOrgSecretPolicySet = &cobra.Command{
+	Use:   "set",
+	Short: "sets the policy enforced on the organization secrets",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := orgSecretPolicySet(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type orgSecretPolicySetOptions struct {
+	orgname           string
+	minLength         int
+	forbiddenPatterns []string
+	requiredPrefixes  []string
+	remove            bool
+}
+
+var orgSecretPolicySetOpts orgSecretPolicySetOptions
+
+func init() {
+	flags := cmdOrgSecretPolicySet.Flags()
+
+	flags.StringVarP(&orgSecretPolicySetOpts.orgname, "orgname", "n", "", "organization name")
+	flags.IntVar(&orgSecretPolicySetOpts.minLength, "min-length", 0, "minimum secret value length")
+	flags.StringArrayVar(&orgSecretPolicySetOpts.forbiddenPatterns, "forbidden-pattern", nil, "regular expression that secret values must not match. Can be repeated")
+	flags.StringArrayVar(&orgSecretPolicySetOpts.requiredPrefixes, "required-prefix", nil, "prefix that secret values must start with (one of the provided prefixes). Can be repeated")
+	flags.BoolVar(&orgSecretPolicySetOpts.remove, "remove", false, "remove the organization secret policy")
+
+	if err := cmdOrgSecretPolicySet.MarkFlagRequired("orgname"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdOrgSecretPolicy.AddCommand(cmdOrgSecretPolicySet)
+}
+
+func orgSecretPolicySet(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	flags := cmd.Flags()
+	if orgSecretPolicySetOpts.remove && (flags.Changed("min-length") || flags.Changed("forbidden-pattern") || flags.Changed("required-prefix")) {
+		return errors.Errorf("--remove cannot be used with other policy options")
+	}
+
+	var policy *gwapitypes.SecretPolicy
+	if !orgSecretPolicySetOpts.remove {
+		policy = &gwapitypes.SecretPolicy{
+			MinLength:         orgSecretPolicySetOpts.minLength,
+			ForbiddenPatterns: orgSecretPolicySetOpts.forbiddenPatterns,
+			RequiredPrefixes:  orgSecretPolicySetOpts.requiredPrefixes,
+		}
+	}
+
+	log.Infof("setting organization %q secret policy", orgSecretPolicySetOpts.orgname)
+	_, _, err := gwclient.SetOrgSecretPolicy(context.TODO(), orgSecretPolicySetOpts.orgname, policy)
+	if err != nil {
+		return errors.Errorf("failed to set organization secret policy: %w", err)
+	}
+
+	return nil
+}
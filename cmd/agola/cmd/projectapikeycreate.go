@@ -0,0 +1,77 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectAPIKeyCreate = &cobra.Command{
+	Use:   "create",
+	Short: "create a project api key",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectAPIKeyCreate(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectAPIKeyCreateOptions struct {
+	projectRef string
+	name       string
+}
+
+var projectAPIKeyCreateOpts projectAPIKeyCreateOptions
+
+func init() {
+	flags := cmdProjectAPIKeyCreate.Flags()
+
+	flags.StringVar(&projectAPIKeyCreateOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVarP(&projectAPIKeyCreateOpts.name, "name", "n", "", "api key name")
+
+	if err := cmdProjectAPIKeyCreate.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectAPIKeyCreate.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectAPIKey.AddCommand(cmdProjectAPIKeyCreate)
+}
+
+func projectAPIKeyCreate(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	req := &gwapitypes.CreateProjectAPIKeyRequest{
+		APIKeyName: projectAPIKeyCreateOpts.name,
+	}
+
+	log.Infof("creating api key for project %q", projectAPIKeyCreateOpts.projectRef)
+	resp, _, err := gwclient.CreateProjectAPIKey(context.TODO(), projectAPIKeyCreateOpts.projectRef, req)
+	if err != nil {
+		return errors.Errorf("failed to create project api key: %w", err)
+	}
+	log.Infof("api key %q for project %q created", projectAPIKeyCreateOpts.name, projectAPIKeyCreateOpts.projectRef)
+	fmt.Println(resp.APIKey)
+
+	return nil
+}
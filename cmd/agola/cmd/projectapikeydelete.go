@@ -0,0 +1,74 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectAPIKeyDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "delete a project api key",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectAPIKeyDelete(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectAPIKeyDeleteOptions struct {
+	projectRef string
+	name       string
+}
+
+var projectAPIKeyDeleteOpts projectAPIKeyDeleteOptions
+
+func init() {
+	flags := cmdProjectAPIKeyDelete.Flags()
+
+	flags.StringVar(&projectAPIKeyDeleteOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVarP(&projectAPIKeyDeleteOpts.name, "name", "n", "", "api key name")
+
+	if err := cmdProjectAPIKeyDelete.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectAPIKeyDelete.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectAPIKey.AddCommand(cmdProjectAPIKeyDelete)
+}
+
+func projectAPIKeyDelete(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	projectRef := projectAPIKeyDeleteOpts.projectRef
+	name := projectAPIKeyDeleteOpts.name
+
+	log.Infof("deleting api key %q for project %q", name, projectRef)
+	_, err := gwclient.DeleteProjectAPIKey(context.TODO(), projectRef, name)
+	if err != nil {
+		return errors.Errorf("failed to delete project api key: %w", err)
+	}
+
+	log.Infof("api key %q for project %q deleted", name, projectRef)
+
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectBadge = &cobra.Command{
+	Use:   "badge",
+	Short: "print the url of a project run result badge",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectBadge(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectBadgeOptions struct {
+	projectRef string
+	branch     string
+}
+
+var projectBadgeOpts projectBadgeOptions
+
+func init() {
+	flags := cmdProjectBadge.Flags()
+
+	flags.StringVar(&projectBadgeOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&projectBadgeOpts.branch, "branch", "", "branch of the reported runs (when empty the latest run of any branch is reported)")
+
+	if err := cmdProjectBadge.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectBadge)
+}
+
+func projectBadge(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	project, _, err := gwclient.GetProject(context.TODO(), projectBadgeOpts.projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project %s: %w", projectBadgeOpts.projectRef, err)
+	}
+
+	// use the project id since, unlike the project path, it doesn't change
+	// when the project is renamed or moved
+	badgeURL := fmt.Sprintf("%s/api/v1alpha/badges/%s", strings.TrimSuffix(gatewayURL, "/"), url.PathEscape(project.ID))
+	if projectBadgeOpts.branch != "" {
+		badgeURL += "?" + url.Values{"branch": []string{projectBadgeOpts.branch}}.Encode()
+	}
+
+	if project.GlobalVisibility != string(gwapitypes.VisibilityPublic) {
+		log.Warnf("project %s isn't public, its badge will be reported as unknown to not authorized users", project.Path)
+	}
+	fmt.Println(badgeURL)
+
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectConfigRepositoryRemove = &cobra.Command{
+	Use:   "remove",
+	Short: "removes the project config repository (the run config is read again from the project repository)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectConfigRepositoryRemove(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectConfigRepositoryRemoveOptions struct {
+	projectRef string
+}
+
+var projectConfigRepositoryRemoveOpts projectConfigRepositoryRemoveOptions
+
+func init() {
+	flags := cmdProjectConfigRepositoryRemove.Flags()
+
+	flags.StringVar(&projectConfigRepositoryRemoveOpts.projectRef, "project", "", "project id or full path")
+
+	if err := cmdProjectConfigRepositoryRemove.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectConfigRepository.AddCommand(cmdProjectConfigRepositoryRemove)
+}
+
+func projectConfigRepositoryRemove(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	log.Infof("removing project config repository")
+	if _, _, err := gwclient.RemoveProjectConfigRepository(context.TODO(), projectConfigRepositoryRemoveOpts.projectRef); err != nil {
+		return errors.Errorf("failed to remove project config repository: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectConfigRepositorySet = &cobra.Command{
+	Use:   "set",
+	Short: "sets the repository from where the project run config is read",
+	Long: `sets the repository from where the project run config is read
+
+The run config is read from the head of the provided config repository branch instead of the project repository, so who can change the project repository cannot change the run config. The config repository is accessed using the current user linked account of the provided remote source.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectConfigRepositorySet(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectConfigRepositorySetOptions struct {
+	projectRef       string
+	remoteSourceName string
+	repoPath         string
+	branch           string
+}
+
+var projectConfigRepositorySetOpts projectConfigRepositorySetOptions
+
+func init() {
+	flags := cmdProjectConfigRepositorySet.Flags()
+
+	flags.StringVar(&projectConfigRepositorySetOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&projectConfigRepositorySetOpts.remoteSourceName, "remote-source", "", "config repository remote source name")
+	flags.StringVar(&projectConfigRepositorySetOpts.repoPath, "repo-path", "", "config repository path (i.e agola/agola-config)")
+	flags.StringVar(&projectConfigRepositorySetOpts.branch, "branch", "", "config repository branch")
+
+	if err := cmdProjectConfigRepositorySet.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectConfigRepositorySet.MarkFlagRequired("remote-source"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectConfigRepositorySet.MarkFlagRequired("repo-path"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectConfigRepositorySet.MarkFlagRequired("branch"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectConfigRepository.AddCommand(cmdProjectConfigRepositorySet)
+}
+
+func projectConfigRepositorySet(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	req := &gwapitypes.SetProjectConfigRepositoryRequest{
+		RemoteSourceName: projectConfigRepositorySetOpts.remoteSourceName,
+		RepoPath:         projectConfigRepositorySetOpts.repoPath,
+		Branch:           projectConfigRepositorySetOpts.branch,
+	}
+
+	log.Infof("setting project config repository")
+	if _, _, err := gwclient.SetProjectConfigRepository(context.TODO(), projectConfigRepositorySetOpts.projectRef, req); err != nil {
+		return errors.Errorf("failed to set project config repository: %w", err)
+	}
+
+	return nil
+}
@@ -42,6 +42,12 @@ type projectCreateOptions struct {
 	skipSSHHostKeyCheck bool
 	visibility          string
 	passVarsToForkedPR  bool
+	networkPolicy       string
+	securityProfile     string
+
+	untrustedRunsNeedApproval bool
+	configFromBaseBranch      bool
+	maxStepLogSize            int64
 }
 
 var projectCreateOpts projectCreateOptions
@@ -56,6 +62,11 @@ func init() {
 	flags.StringVar(&projectCreateOpts.parentPath, "parent", "", `parent project group path (i.e "org/org01" for root project group in org01, "user/user01/group01/subgroub01") or project group id where the project should be created`)
 	flags.StringVar(&projectCreateOpts.visibility, "visibility", "public", `project visibility (public or private)`)
 	flags.BoolVar(&projectCreateOpts.passVarsToForkedPR, "pass-vars-to-forked-pr", false, `pass variables to run even if triggered by PR from forked repo`)
+	flags.StringVar(&projectCreateOpts.networkPolicy, "network-policy", "", `name of the executor network policy applied to the project runs`)
+	flags.StringVar(&projectCreateOpts.securityProfile, "security-profile", "", `name of the executor security profile (seccomp and apparmor profiles) applied to the project runs`)
+	flags.BoolVar(&projectCreateOpts.untrustedRunsNeedApproval, "untrusted-runs-need-approval", false, `require an approval before executing untrusted runs (triggered by PR from forked repo of not collaborators)`)
+	flags.BoolVar(&projectCreateOpts.configFromBaseBranch, "config-from-base-branch", false, `read the pull requests run config from their base branch, so pull requests cannot change the pipeline executed on them`)
+	flags.Int64Var(&projectCreateOpts.maxStepLogSize, "max-step-log-size", 0, `max log size in bytes of the project runs steps, overrides the executor default (0 to use the executor default)`)
 
 	if err := cmdProjectCreate.MarkFlagRequired("name"); err != nil {
 		log.Fatal(err)
@@ -99,6 +110,12 @@ func projectCreate(cmd *cobra.Command, args []string) error {
 		RemoteSourceName:    projectCreateOpts.remoteSourceName,
 		SkipSSHHostKeyCheck: projectCreateOpts.skipSSHHostKeyCheck,
 		PassVarsToForkedPR:  projectCreateOpts.passVarsToForkedPR,
+		NetworkPolicy:       projectCreateOpts.networkPolicy,
+		SecurityProfile:     projectCreateOpts.securityProfile,
+
+		UntrustedRunsNeedApproval: projectCreateOpts.untrustedRunsNeedApproval,
+		ConfigFromBaseBranch:      projectCreateOpts.configFromBaseBranch,
+		MaxStepLogSize:            projectCreateOpts.maxStepLogSize,
 	}
 
 	log.Infof("creating project")
@@ -0,0 +1,156 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectCreateFromTemplate = &cobra.Command{
+	Use:   "create-from-template",
+	Short: "create a project from a project template",
+	Long: `create a project from a project template
+
+The project settings and variables are copied from the project template revision (the latest if not specified). Parameters values are provided with --param name=value, the required parameters not provided are asked interactively.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectCreateFromTemplate(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectCreateFromTemplateOptions struct {
+	template         string
+	revision         int64
+	name             string
+	parentPath       string
+	repoPath         string
+	remoteSourceName string
+	params           []string
+}
+
+var projectCreateFromTemplateOpts projectCreateFromTemplateOptions
+
+func init() {
+	flags := cmdProjectCreateFromTemplate.Flags()
+
+	flags.StringVar(&projectCreateFromTemplateOpts.template, "template", "", "project template name or id")
+	flags.Int64Var(&projectCreateFromTemplateOpts.revision, "revision", 0, "project template revision (0 to use the latest revision)")
+	flags.StringVarP(&projectCreateFromTemplateOpts.name, "name", "n", "", "project name")
+	flags.StringVar(&projectCreateFromTemplateOpts.parentPath, "parent", "", `parent project group path (i.e "org/org01" for root project group in org01, "user/user01/group01/subgroub01") or project group id where the project should be created`)
+	flags.StringVar(&projectCreateFromTemplateOpts.repoPath, "repo-path", "", "repository path (i.e agola-io/agola)")
+	flags.StringVar(&projectCreateFromTemplateOpts.remoteSourceName, "remote-source", "", "remote source name (overrides the project template remote source)")
+	flags.StringArrayVar(&projectCreateFromTemplateOpts.params, "param", []string{}, "project template parameter value in the format name=value (can be repeated)")
+
+	if err := cmdProjectCreateFromTemplate.MarkFlagRequired("template"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectCreateFromTemplate.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectCreateFromTemplate.MarkFlagRequired("parent"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectCreateFromTemplate.MarkFlagRequired("repo-path"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectCreateFromTemplate)
+}
+
+// promptProjectTemplateParameters asks the values of the required parameters
+// not already provided
+func promptProjectTemplateParameters(pt *gwapitypes.ProjectTemplateResponse, revision int64, params map[string]string) error {
+	var rev *gwapitypes.ProjectTemplateRevisionResponse
+	for _, r := range pt.Revisions {
+		if revision == 0 || r.Revision == revision {
+			rev = r
+		}
+	}
+	if rev == nil {
+		return errors.Errorf("project template %q revision %d doesn't exist", pt.Name, revision)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for _, p := range rev.Spec.Parameters {
+		if _, ok := params[p.Name]; ok || p.Default != "" {
+			continue
+		}
+		if p.Description != "" {
+			fmt.Printf("%s (%s): ", p.Name, p.Description)
+		} else {
+			fmt.Printf("%s: ", p.Name)
+		}
+		v, err := reader.ReadString('\n')
+		if err != nil {
+			return errors.Errorf("failed to read parameter %q value: %w", p.Name, err)
+		}
+		params[p.Name] = strings.TrimSpace(v)
+	}
+
+	return nil
+}
+
+func projectCreateFromTemplate(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	params := map[string]string{}
+	for _, p := range projectCreateFromTemplateOpts.params {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Errorf("invalid parameter %q, must be in the format name=value", p)
+		}
+		params[parts[0]] = parts[1]
+	}
+
+	pt, _, err := gwclient.GetProjectTemplate(context.TODO(), projectCreateFromTemplateOpts.template)
+	if err != nil {
+		return errors.Errorf("failed to get project template: %w", err)
+	}
+
+	if err := promptProjectTemplateParameters(pt, projectCreateFromTemplateOpts.revision, params); err != nil {
+		return err
+	}
+
+	req := &gwapitypes.CreateProjectFromTemplateRequest{
+		Revision:         projectCreateFromTemplateOpts.revision,
+		Name:             projectCreateFromTemplateOpts.name,
+		ParentRef:        projectCreateFromTemplateOpts.parentPath,
+		RepoPath:         projectCreateFromTemplateOpts.repoPath,
+		RemoteSourceName: projectCreateFromTemplateOpts.remoteSourceName,
+		Parameters:       params,
+	}
+
+	log.Infof("creating project from template %q", pt.Name)
+
+	project, _, err := gwclient.CreateProjectFromTemplate(context.TODO(), projectCreateFromTemplateOpts.template, req)
+	if err != nil {
+		return errors.Errorf("failed to create project: %w", err)
+	}
+	log.Infof("project %s created, ID: %s", project.Name, project.ID)
+
+	return nil
+}
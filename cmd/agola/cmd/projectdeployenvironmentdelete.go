@@ -0,0 +1,73 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectDeployEnvironmentDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "delete a project deploy environment",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectDeployEnvironmentDelete(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectDeployEnvironmentDeleteOptions struct {
+	projectRef string
+	name       string
+}
+
+var projectDeployEnvironmentDeleteOpts projectDeployEnvironmentDeleteOptions
+
+func init() {
+	flags := cmdProjectDeployEnvironmentDelete.Flags()
+
+	flags.StringVar(&projectDeployEnvironmentDeleteOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVarP(&projectDeployEnvironmentDeleteOpts.name, "name", "n", "", "deploy environment name")
+
+	if err := cmdProjectDeployEnvironmentDelete.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectDeployEnvironmentDelete.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectDeployEnvironment.AddCommand(cmdProjectDeployEnvironmentDelete)
+}
+
+func projectDeployEnvironmentDelete(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	projectRef := projectDeployEnvironmentDeleteOpts.projectRef
+	name := projectDeployEnvironmentDeleteOpts.name
+
+	log.Infof("deleting deploy environment %q of project %q", name, projectRef)
+	if _, err := gwclient.DeleteProjectDeployEnvironment(context.TODO(), projectRef, name); err != nil {
+		return errors.Errorf("failed to delete project deploy environment: %w", err)
+	}
+
+	log.Infof("deploy environment %q of project %q deleted", name, projectRef)
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"time"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectDeployEnvironmentSet = &cobra.Command{
+	Use:   "set",
+	Short: "creates or replaces a project deploy environment",
+	Long: `creates or replaces a project deploy environment
+
+Run tasks target a deploy environment with the "deploy_environment" option. A task targeting a deploy environment is executed only when the environment protection rules are satisfied: the run branch must be one of the allowed branches, the task must be approved by the required number of approvers and the wait timer must be expired.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectDeployEnvironmentSet(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectDeployEnvironmentSetOptions struct {
+	projectRef        string
+	name              string
+	requiredApprovals int
+	approvers         []string
+	branches          []string
+	waitTimer         time.Duration
+}
+
+var projectDeployEnvironmentSetOpts projectDeployEnvironmentSetOptions
+
+func init() {
+	flags := cmdProjectDeployEnvironmentSet.Flags()
+
+	flags.StringVar(&projectDeployEnvironmentSetOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVarP(&projectDeployEnvironmentSetOpts.name, "name", "n", "", "deploy environment name")
+	flags.IntVar(&projectDeployEnvironmentSetOpts.requiredApprovals, "required-approvals", 0, "number of distinct users that must approve the tasks targeting the environment")
+	flags.StringSliceVar(&projectDeployEnvironmentSetOpts.approvers, "approver", nil, "id or name of a user allowed to approve the tasks. This option can be repeated multiple times (empty to allow every user that can do run actions)")
+	flags.StringSliceVar(&projectDeployEnvironmentSetOpts.branches, "branch", nil, "name, or regular expression delimited by slashes, of a branch allowed to deploy to the environment. This option can be repeated multiple times (empty to allow all the refs)")
+	flags.DurationVar(&projectDeployEnvironmentSetOpts.waitTimer, "wait-timer", 0, "time to wait before executing the tasks once they could be executed (i.e. 10m, 1h)")
+
+	if err := cmdProjectDeployEnvironmentSet.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectDeployEnvironmentSet.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectDeployEnvironment.AddCommand(cmdProjectDeployEnvironmentSet)
+}
+
+func projectDeployEnvironmentSet(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	req := &gwapitypes.SetProjectDeployEnvironmentRequest{
+		RequiredApprovals: projectDeployEnvironmentSetOpts.requiredApprovals,
+		Approvers:         projectDeployEnvironmentSetOpts.approvers,
+		Branches:          projectDeployEnvironmentSetOpts.branches,
+		WaitTimer:         projectDeployEnvironmentSetOpts.waitTimer,
+	}
+
+	log.Infof("setting project deploy environment %q", projectDeployEnvironmentSetOpts.name)
+	if _, _, err := gwclient.SetProjectDeployEnvironment(context.TODO(), projectDeployEnvironmentSetOpts.projectRef, projectDeployEnvironmentSetOpts.name, req); err != nil {
+		return errors.Errorf("failed to set project deploy environment: %w", err)
+	}
+
+	return nil
+}
@@ -41,6 +41,7 @@ func init() {
 	flags.StringVar(&secretCreateOpts.parentRef, "projectgroup", "", "project group id or full path")
 	flags.StringVarP(&secretCreateOpts.name, "name", "n", "", "secret name")
 	flags.StringVarP(&secretCreateOpts.file, "file", "f", "", `yaml file containing the secret data (use "-" to read from stdin)`)
+	flags.BoolVar(&secretCreateOpts.forkSafe, "fork-safe", false, "provide the secret also to untrusted runs (like pull requests from forked repositories)")
 
 	if err := cmdProjectGroupSecretCreate.MarkFlagRequired("projectgroup"); err != nil {
 		log.Fatal(err)
@@ -33,6 +33,7 @@ func init() {
 
 	flags.StringVar(&secretDeleteOpts.parentRef, "projectgroup", "", "project group id or full path")
 	flags.StringVarP(&secretDeleteOpts.name, "name", "n", "", "secret name")
+	flags.BoolVar(&secretDeleteOpts.failIfUsed, "fail-if-used", false, "refuse to delete the secret if it has been used by recent project runs")
 
 	if err := cmdProjectGroupSecretDelete.MarkFlagRequired("projectgroup"); err != nil {
 		log.Fatal(err)
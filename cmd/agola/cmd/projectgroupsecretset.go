@@ -0,0 +1,61 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdProjectGroupSecretSet = &cobra.Command{
+	Use:   "set",
+	Short: "create or update multiple project group secrets",
+	Long: `create or update multiple project group secrets
+
+All the secrets are applied in a single transaction. The secrets should be provided by a yaml document. Examples:
+
+- name: secret01
+  data:
+    data01: secretvalue01
+    data02: secretvalue02
+- name: secret02
+  fork_safe: true
+  data:
+    data01: secretvalue01
+
+When --prune is provided the project group secrets not defined in the file are removed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := secretSet(cmd, "projectgroup", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	flags := cmdProjectGroupSecretSet.Flags()
+
+	flags.StringVar(&secretSetOpts.parentRef, "projectgroup", "", "project group id or full path")
+	flags.StringVarP(&secretSetOpts.file, "from-file", "f", "", `yaml file containing the secrets definitions (use "-" to read from stdin)`)
+	flags.BoolVar(&secretSetOpts.prune, "prune", false, "remove the secrets not defined in the file")
+
+	if err := cmdProjectGroupSecretSet.MarkFlagRequired("projectgroup"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectGroupSecretSet.MarkFlagRequired("from-file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectGroupSecret.AddCommand(cmdProjectGroupSecretSet)
+}
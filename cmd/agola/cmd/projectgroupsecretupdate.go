@@ -42,6 +42,7 @@ func init() {
 	flags.StringVarP(&secretUpdateOpts.name, "name", "n", "", "secret name")
 	flags.StringVarP(&secretUpdateOpts.newName, "new-name", "", "", "secret new name")
 	flags.StringVarP(&secretUpdateOpts.file, "file", "f", "", `yaml file containing the secret data (use "-" to read from stdin)`)
+	flags.BoolVar(&secretUpdateOpts.forkSafe, "fork-safe", false, "provide the secret also to untrusted runs (like pull requests from forked repositories)")
 
 	if err := cmdProjectGroupSecretUpdate.MarkFlagRequired("projectgroup"); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,45 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdProjectGroupSecretUsages = &cobra.Command{
+	Use:   "usages",
+	Short: "list the projects whose runs used a secret",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := secretUsages(cmd, "projectgroup", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	flags := cmdProjectGroupSecretUsages.Flags()
+
+	flags.StringVar(&secretUsagesOpts.parentRef, "projectgroup", "", "project group id or full path")
+	flags.StringVarP(&secretUsagesOpts.name, "name", "n", "", "secret name")
+
+	if err := cmdProjectGroupSecretUsages.MarkFlagRequired("projectgroup"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectGroupSecretUsages.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectGroupSecret.AddCommand(cmdProjectGroupSecretUsages)
+}
@@ -33,6 +33,7 @@ func init() {
 
 	flags.StringVar(&variableDeleteOpts.parentRef, "projectgroup", "", "project group id or full path")
 	flags.StringVarP(&variableDeleteOpts.name, "name", "n", "", "variable name")
+	flags.BoolVar(&variableDeleteOpts.failIfUsed, "fail-if-used", false, "refuse to delete the variable if it has been used by recent project runs")
 
 	if err := cmdProjectGroupVariableDelete.MarkFlagRequired("projectgroup"); err != nil {
 		log.Fatal(err)
@@ -0,0 +1,65 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdProjectGroupVariableSet = &cobra.Command{
+	Use:   "set",
+	Short: "create or update multiple project group variables",
+	Long: `create or update multiple project group variables
+
+All the variables are applied in a single transaction. The variables should be provided by a yaml document. Examples:
+
+- name: var01
+  values:
+    - secret_name: secret01
+      secret_var: var01
+      when:
+        branch: master
+    - secret_name: secret02
+      secret_var: data02
+- name: var02
+  values:
+    - secret_name: secret01
+      secret_var: var02
+
+When --prune is provided the project group variables not defined in the file are removed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := variableSet(cmd, "projectgroup", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	flags := cmdProjectGroupVariableSet.Flags()
+
+	flags.StringVar(&variableSetOpts.parentRef, "projectgroup", "", "project group id or full path")
+	flags.StringVarP(&variableSetOpts.file, "from-file", "f", "", `yaml file containing the variables definitions (use "-" to read from stdin)`)
+	flags.BoolVar(&variableSetOpts.prune, "prune", false, "remove the variables not defined in the file")
+
+	if err := cmdProjectGroupVariableSet.MarkFlagRequired("projectgroup"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectGroupVariableSet.MarkFlagRequired("from-file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectGroupVariable.AddCommand(cmdProjectGroupVariableSet)
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdProjectPreviewEnvironmentList = &cobra.Command{
+	Use:   "list",
+	Short: "list the active pull request preview environments of a project",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectPreviewEnvironmentList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectPreviewEnvironmentListOptions struct {
+	projectRef string
+}
+
+var projectPreviewEnvironmentListOpts projectPreviewEnvironmentListOptions
+
+func init() {
+	flags := cmdProjectPreviewEnvironmentList.Flags()
+
+	flags.StringVar(&projectPreviewEnvironmentListOpts.projectRef, "project", "", "project id or full path")
+
+	if err := cmdProjectPreviewEnvironmentList.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectPreviewEnvironment.AddCommand(cmdProjectPreviewEnvironmentList)
+}
+
+func printPreviewEnvironments(envs []*gwapitypes.PreviewEnvironmentResponse) {
+	for _, env := range envs {
+		fmt.Printf("%s: Pull Request: %s, Run: %s, Updated: %s\n", env.Name, env.PullRequestID, env.RunID, env.UpdateTime.Format(time.RFC3339))
+	}
+}
+
+func projectPreviewEnvironmentList(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	envs, _, err := gwclient.GetProjectPreviewEnvironments(context.TODO(), projectPreviewEnvironmentListOpts.projectRef)
+	if err != nil {
+		return err
+	}
+
+	printPreviewEnvironments(envs)
+
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectRequiredChecks = &cobra.Command{
+	Use:   "requiredchecks",
+	Short: "show the status of the project required runs for a commit",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectRequiredChecks(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectRequiredChecksOptions struct {
+	projectRef string
+	commitSHA  string
+}
+
+var projectRequiredChecksOpts projectRequiredChecksOptions
+
+func init() {
+	flags := cmdProjectRequiredChecks.Flags()
+
+	flags.StringVar(&projectRequiredChecksOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&projectRequiredChecksOpts.commitSHA, "commit-sha", "", "commit sha")
+
+	if err := cmdProjectRequiredChecks.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectRequiredChecks.MarkFlagRequired("commit-sha"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectRequiredChecks)
+}
+
+func projectRequiredChecks(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	checks, _, err := gwclient.GetProjectRequiredChecks(context.TODO(), projectRequiredChecksOpts.projectRef, projectRequiredChecksOpts.commitSHA)
+	if err != nil {
+		return errors.Errorf("failed to get required checks: %w", err)
+	}
+
+	fmt.Printf("Commit: %s, Status: %s\n", checks.CommitSHA, checks.Status)
+	for _, check := range checks.Checks {
+		if check.RunID == "" {
+			fmt.Printf("\tRun: %s, Status: %s\n", check.RunName, check.Status)
+			continue
+		}
+		fmt.Printf("\tRun: %s, Status: %s, RunID: %s, Number: %d, Phase: %s, Result: %s\n", check.RunName, check.Status, check.RunID, check.RunCounter, check.RunPhase, check.RunResult)
+	}
+
+	return nil
+}
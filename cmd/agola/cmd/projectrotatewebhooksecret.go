@@ -0,0 +1,64 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectRotateWebhookSecret = &cobra.Command{
+	Use:   "rotate-webhook-secret",
+	Short: "rotates a project webhook secret (reinstalls the webhook with a new secret, the previous one is accepted for a few minutes)",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectRotateWebhookSecret(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectRotateWebhookSecretOptions struct {
+	projectRef string
+}
+
+var projectRotateWebhookSecretOpts projectRotateWebhookSecretOptions
+
+func init() {
+	flags := cmdProjectRotateWebhookSecret.Flags()
+
+	flags.StringVar(&projectRotateWebhookSecretOpts.projectRef, "project", "", "project id or full path")
+
+	if err := cmdProjectRotateWebhookSecret.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProject.AddCommand(cmdProjectRotateWebhookSecret)
+}
+
+func projectRotateWebhookSecret(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	log.Infof("rotating project webhook secret")
+	if _, err := gwclient.RotateProjectWebhookSecret(context.TODO(), projectRotateWebhookSecretOpts.projectRef); err != nil {
+		return errors.Errorf("failed to rotate project webhook secret: %w", err)
+	}
+	log.Infof("project webhook secret rotated")
+
+	return nil
+}
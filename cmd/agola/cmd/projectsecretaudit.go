@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectSecretAudit = &cobra.Command{
+	Use:   "audit",
+	Short: "list the metadata of all the secrets available to a project (local and inherited) without their values",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := secretAudit(cmd, "project", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type secretAuditOptions struct {
+	parentRef string
+}
+
+var secretAuditOpts secretAuditOptions
+
+func init() {
+	flags := cmdProjectSecretAudit.Flags()
+
+	flags.StringVar(&secretAuditOpts.parentRef, "project", "", "project id or full path")
+
+	if err := cmdProjectSecretAudit.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectSecret.AddCommand(cmdProjectSecretAudit)
+}
+
+func secretAudit(cmd *cobra.Command, ownertype string, args []string) error {
+	var err error
+	var secrets []*gwapitypes.SecretAuditResponse
+
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	switch ownertype {
+	case "project":
+		secrets, _, err = gwclient.GetProjectSecretsAudit(context.TODO(), secretAuditOpts.parentRef)
+	case "projectgroup":
+		secrets, _, err = gwclient.GetProjectGroupSecretsAudit(context.TODO(), secretAuditOpts.parentRef)
+	}
+	if err != nil {
+		return errors.Errorf("failed to get %s secrets audit: %w", ownertype, err)
+	}
+	prettyJSON, err := json.MarshalIndent(secrets, "", "\t")
+	if err != nil {
+		return errors.Errorf("failed to convert %s secrets audit to json: %w", ownertype, err)
+	}
+	fmt.Printf("%s\n", string(prettyJSON))
+	return nil
+}
@@ -48,6 +48,7 @@ type secretCreateOptions struct {
 	parentRef string
 	name      string
 	file      string
+	forkSafe  bool
 }
 
 var secretCreateOpts secretCreateOptions
@@ -58,6 +59,7 @@ func init() {
 	flags.StringVar(&secretCreateOpts.parentRef, "project", "", "project id or full path")
 	flags.StringVarP(&secretCreateOpts.name, "name", "n", "", "secret name")
 	flags.StringVarP(&secretCreateOpts.file, "file", "f", "", `yaml file containing the secret data (use "-" to read from stdin)`)
+	flags.BoolVar(&secretCreateOpts.forkSafe, "fork-safe", false, "provide the secret also to untrusted runs (like pull requests from forked repositories)")
 
 	if err := cmdProjectSecretCreate.MarkFlagRequired("project"); err != nil {
 		log.Fatal(err)
@@ -95,9 +97,10 @@ func secretCreate(cmd *cobra.Command, ownertype string, args []string) error {
 		log.Fatalf("failed to unmarshal secret: %v", err)
 	}
 	req := &gwapitypes.CreateSecretRequest{
-		Name: secretCreateOpts.name,
-		Type: gwapitypes.SecretTypeInternal,
-		Data: secretData,
+		Name:     secretCreateOpts.name,
+		Type:     gwapitypes.SecretTypeInternal,
+		Data:     secretData,
+		ForkSafe: secretCreateOpts.forkSafe,
 	}
 
 	switch ownertype {
@@ -17,6 +17,7 @@ package cmd
 import (
 	"context"
 
+	gwapitypes "agola.io/agola/services/gateway/api/types"
 	gwclient "agola.io/agola/services/gateway/client"
 
 	"github.com/spf13/cobra"
@@ -34,8 +35,9 @@ var cmdProjectSecretDelete = &cobra.Command{
 }
 
 type secretDeleteOptions struct {
-	parentRef string
-	name      string
+	parentRef  string
+	name       string
+	failIfUsed bool
 }
 
 var secretDeleteOpts secretDeleteOptions
@@ -45,6 +47,7 @@ func init() {
 
 	flags.StringVar(&secretDeleteOpts.parentRef, "project", "", "project id or full path")
 	flags.StringVarP(&secretDeleteOpts.name, "name", "n", "", "secret name")
+	flags.BoolVar(&secretDeleteOpts.failIfUsed, "fail-if-used", false, "refuse to delete the secret if it has been used by recent project runs")
 
 	if err := cmdProjectSecretDelete.MarkFlagRequired("project"); err != nil {
 		log.Fatal(err)
@@ -59,17 +62,34 @@ func init() {
 func secretDelete(cmd *cobra.Command, ownertype string, args []string) error {
 	gwclient := gwclient.NewClient(gatewayURL, token)
 
+	if !secretDeleteOpts.failIfUsed {
+		var usages []*gwapitypes.ConfigUsageResponse
+		var err error
+		switch ownertype {
+		case "project":
+			usages, _, err = gwclient.GetProjectSecretUsages(context.TODO(), secretDeleteOpts.parentRef, secretDeleteOpts.name)
+		case "projectgroup":
+			usages, _, err = gwclient.GetProjectGroupSecretUsages(context.TODO(), secretDeleteOpts.parentRef, secretDeleteOpts.name)
+		}
+		if err != nil {
+			return errors.Errorf("failed to get %s secret usages: %w", ownertype, err)
+		}
+		for _, u := range usages {
+			log.Warnf("secret %q has been used by project %q at %s", secretDeleteOpts.name, u.ProjectPath, u.LastUsedTime)
+		}
+	}
+
 	switch ownertype {
 	case "project":
 		log.Infof("deleting project secret")
-		_, err := gwclient.DeleteProjectSecret(context.TODO(), secretDeleteOpts.parentRef, secretDeleteOpts.name)
+		_, err := gwclient.DeleteProjectSecret(context.TODO(), secretDeleteOpts.parentRef, secretDeleteOpts.name, secretDeleteOpts.failIfUsed)
 		if err != nil {
 			return errors.Errorf("failed to delete project secret: %w", err)
 		}
 		log.Infof("project secret deleted")
 	case "projectgroup":
 		log.Infof("deleting project group secret")
-		_, err := gwclient.DeleteProjectGroupSecret(context.TODO(), secretDeleteOpts.parentRef, secretDeleteOpts.name)
+		_, err := gwclient.DeleteProjectGroupSecret(context.TODO(), secretDeleteOpts.parentRef, secretDeleteOpts.name, secretDeleteOpts.failIfUsed)
 		if err != nil {
 			return errors.Errorf("failed to delete project group secret: %w", err)
 		}
@@ -0,0 +1,143 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectSecretSet = &cobra.Command{
+	Use:   "set",
+	Short: "create or update multiple project secrets",
+	Long: `create or update multiple project secrets
+
+All the secrets are applied in a single transaction. The secrets should be provided by a yaml document. Examples:
+
+- name: secret01
+  data:
+    data01: secretvalue01
+    data02: secretvalue02
+- name: secret02
+  fork_safe: true
+  data:
+    data01: secretvalue01
+
+When --prune is provided the project secrets not defined in the file are removed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := secretSet(cmd, "project", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type secretSetOptions struct {
+	parentRef string
+	file      string
+	prune     bool
+}
+
+var secretSetOpts secretSetOptions
+
+func init() {
+	flags := cmdProjectSecretSet.Flags()
+
+	flags.StringVar(&secretSetOpts.parentRef, "project", "", "project id or full path")
+	flags.StringVarP(&secretSetOpts.file, "from-file", "f", "", `yaml file containing the secrets definitions (use "-" to read from stdin)`)
+	flags.BoolVar(&secretSetOpts.prune, "prune", false, "remove the secrets not defined in the file")
+
+	if err := cmdProjectSecretSet.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectSecretSet.MarkFlagRequired("from-file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectSecret.AddCommand(cmdProjectSecretSet)
+}
+
+type SecretDefinition struct {
+	Name     string            `json:"name"`
+	Data     map[string]string `json:"data"`
+	ForkSafe bool              `json:"fork_safe"`
+}
+
+func secretSet(cmd *cobra.Command, ownertype string, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	// "github.com/ghodss/yaml" doesn't provide a streaming decoder
+	var data []byte
+	var err error
+	if secretSetOpts.file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err = ioutil.ReadFile(secretSetOpts.file)
+		if err != nil {
+			return err
+		}
+	}
+
+	var secrets []SecretDefinition
+	if err := yaml.Unmarshal(data, &secrets); err != nil {
+		return errors.Errorf("failed to unmarshal secrets: %w", err)
+	}
+	req := &gwapitypes.SetSecretsRequest{
+		Prune: secretSetOpts.prune,
+	}
+	for _, secret := range secrets {
+		req.Secrets = append(req.Secrets, &gwapitypes.CreateSecretRequest{
+			Name:     secret.Name,
+			Type:     gwapitypes.SecretTypeInternal,
+			Data:     secret.Data,
+			ForkSafe: secret.ForkSafe,
+		})
+	}
+
+	var results []*gwapitypes.SetResultResponse
+	switch ownertype {
+	case "project":
+		log.Infof("setting project secrets")
+		results, _, err = gwclient.SetProjectSecrets(context.TODO(), secretSetOpts.parentRef, req)
+	case "projectgroup":
+		log.Infof("setting project group secrets")
+		results, _, err = gwclient.SetProjectGroupSecrets(context.TODO(), secretSetOpts.parentRef, req)
+	}
+	if err != nil {
+		return errors.Errorf("failed to set %s secrets: %w", ownertype, err)
+	}
+
+	printSetResults(results)
+
+	return nil
+}
+
+func printSetResults(results []*gwapitypes.SetResultResponse) {
+	for _, r := range results {
+		fmt.Printf("%s: %s\n", r.Name, r.Result)
+	}
+}
@@ -49,6 +49,7 @@ type secretUpdateOptions struct {
 	name      string
 	newName   string
 	file      string
+	forkSafe  bool
 }
 
 var secretUpdateOpts secretUpdateOptions
@@ -60,6 +61,7 @@ func init() {
 	flags.StringVarP(&secretUpdateOpts.name, "name", "n", "", "secret name")
 	flags.StringVarP(&secretUpdateOpts.newName, "new-name", "", "", "secret new name")
 	flags.StringVarP(&secretUpdateOpts.file, "file", "f", "", `yaml file containing the secret data (use "-" to read from stdin)`)
+	flags.BoolVar(&secretUpdateOpts.forkSafe, "fork-safe", false, "provide the secret also to untrusted runs (like pull requests from forked repositories)")
 
 	if err := cmdProjectSecretUpdate.MarkFlagRequired("project"); err != nil {
 		log.Fatal(err)
@@ -97,9 +99,10 @@ func secretUpdate(cmd *cobra.Command, ownertype string, args []string) error {
 		log.Fatalf("failed to unmarshal secret: %v", err)
 	}
 	req := &gwapitypes.UpdateSecretRequest{
-		Name: secretUpdateOpts.name,
-		Type: gwapitypes.SecretTypeInternal,
-		Data: secretData,
+		Name:     secretUpdateOpts.name,
+		Type:     gwapitypes.SecretTypeInternal,
+		Data:     secretData,
+		ForkSafe: secretUpdateOpts.forkSafe,
 	}
 
 	flags := cmd.Flags()
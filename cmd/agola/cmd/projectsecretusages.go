@@ -0,0 +1,83 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectSecretUsages = &cobra.Command{
+	Use:   "usages",
+	Short: "list the projects whose runs used a secret",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := secretUsages(cmd, "project", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type secretUsagesOptions struct {
+	parentRef string
+	name      string
+}
+
+var secretUsagesOpts secretUsagesOptions
+
+func init() {
+	flags := cmdProjectSecretUsages.Flags()
+
+	flags.StringVar(&secretUsagesOpts.parentRef, "project", "", "project id or full path")
+	flags.StringVarP(&secretUsagesOpts.name, "name", "n", "", "secret name")
+
+	if err := cmdProjectSecretUsages.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectSecretUsages.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectSecret.AddCommand(cmdProjectSecretUsages)
+}
+
+func secretUsages(cmd *cobra.Command, ownertype string, args []string) error {
+	var err error
+	var usages []*gwapitypes.ConfigUsageResponse
+
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	switch ownertype {
+	case "project":
+		usages, _, err = gwclient.GetProjectSecretUsages(context.TODO(), secretUsagesOpts.parentRef, secretUsagesOpts.name)
+	case "projectgroup":
+		usages, _, err = gwclient.GetProjectGroupSecretUsages(context.TODO(), secretUsagesOpts.parentRef, secretUsagesOpts.name)
+	}
+	if err != nil {
+		return errors.Errorf("failed to get %s secret usages: %w", ownertype, err)
+	}
+	prettyJSON, err := json.MarshalIndent(usages, "", "\t")
+	if err != nil {
+		return errors.Errorf("failed to convert %s secret usages to json: %w", ownertype, err)
+	}
+	fmt.Printf("%s\n", string(prettyJSON))
+	return nil
+}
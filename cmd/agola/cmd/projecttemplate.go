@@ -0,0 +1,131 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectTemplate = &cobra.Command{
+	Use:   "projecttemplate",
+	Short: "projecttemplate",
+}
+
+func init() {
+	cmdAgola.AddCommand(cmdProjectTemplate)
+}
+
+const projectTemplateSpecHelp = `The project template should be provided by a yaml document. Example:
+
+parameters:
+  - name: env
+    description: deploy environment
+    default: staging
+  - name: team
+visibility: private
+remote_source_name: gitea
+untrusted_runs_need_approval: true
+variables:
+  - name: deploykey
+    values:
+      - secret_name: deploy-${env}
+        secret_var: key
+  - name: teamtoken
+    values:
+      - secret_name: ${team}
+        secret_var: token
+
+Parameters without a default value must be provided when creating a project from the template. They can be referenced in the variables values as ${parametername}.
+`
+
+type ProjectTemplateSpec struct {
+	Parameters []gwapitypes.ProjectTemplateParameter `json:"parameters,omitempty"`
+
+	Visibility                string `json:"visibility,omitempty"`
+	RemoteSourceName          string `json:"remote_source_name,omitempty"`
+	SkipSSHHostKeyCheck       bool   `json:"skip_ssh_host_key_check,omitempty"`
+	PassVarsToForkedPR        bool   `json:"pass_vars_to_forked_pr,omitempty"`
+	NetworkPolicy             string `json:"network_policy,omitempty"`
+	UntrustedRunsNeedApproval bool   `json:"untrusted_runs_need_approval,omitempty"`
+	MaxStepLogSize            int64  `json:"max_step_log_size,omitempty"`
+
+	Variables []ProjectTemplateVariable `json:"variables,omitempty"`
+}
+
+type ProjectTemplateVariable struct {
+	Name   string          `json:"name,omitempty"`
+	Values []VariableValue `json:"values,omitempty"`
+}
+
+// readProjectTemplateSpec reads the project template spec from the provided
+// yaml file ("-" to read from stdin)
+func readProjectTemplateSpec(file string) (*gwapitypes.ProjectTemplateSpec, error) {
+	// "github.com/ghodss/yaml" doesn't provide a streaming decoder
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		data, err = ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var spec ProjectTemplateSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, errors.Errorf("failed to unmarshal project template: %w", err)
+	}
+	if spec.Visibility != "" && !IsValidVisibility(spec.Visibility) {
+		return nil, errors.Errorf("invalid visibility %q", spec.Visibility)
+	}
+
+	rspec := &gwapitypes.ProjectTemplateSpec{
+		Parameters:                spec.Parameters,
+		Visibility:                gwapitypes.Visibility(spec.Visibility),
+		RemoteSourceName:          spec.RemoteSourceName,
+		SkipSSHHostKeyCheck:       spec.SkipSSHHostKeyCheck,
+		PassVarsToForkedPR:        spec.PassVarsToForkedPR,
+		NetworkPolicy:             spec.NetworkPolicy,
+		UntrustedRunsNeedApproval: spec.UntrustedRunsNeedApproval,
+		MaxStepLogSize:            spec.MaxStepLogSize,
+	}
+	for _, v := range spec.Variables {
+		rvalues := []gwapitypes.VariableValueRequest{}
+		for _, value := range v.Values {
+			rvalues = append(rvalues, gwapitypes.VariableValueRequest{
+				SecretName: value.SecretName,
+				SecretVar:  value.SecretVar,
+				When:       value.When.ToWhen(),
+			})
+		}
+		rspec.Variables = append(rspec.Variables, gwapitypes.ProjectTemplateVariable{
+			Name:   v.Name,
+			Values: rvalues,
+		})
+	}
+
+	return rspec, nil
+}
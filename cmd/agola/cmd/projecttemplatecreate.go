@@ -0,0 +1,82 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectTemplateCreate = &cobra.Command{
+	Use:   "create",
+	Short: "create a project template",
+	Long:  "create a project template\n\n" + projectTemplateSpecHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectTemplateCreate(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectTemplateCreateOptions struct {
+	name string
+	file string
+}
+
+var projectTemplateCreateOpts projectTemplateCreateOptions
+
+func init() {
+	flags := cmdProjectTemplateCreate.Flags()
+
+	flags.StringVarP(&projectTemplateCreateOpts.name, "name", "n", "", "project template name")
+	flags.StringVarP(&projectTemplateCreateOpts.file, "file", "f", "", `yaml file containing the project template definition (use "-" to read from stdin)`)
+
+	if err := cmdProjectTemplateCreate.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectTemplateCreate.MarkFlagRequired("file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectTemplate.AddCommand(cmdProjectTemplateCreate)
+}
+
+func projectTemplateCreate(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	spec, err := readProjectTemplateSpec(projectTemplateCreateOpts.file)
+	if err != nil {
+		return err
+	}
+
+	req := &gwapitypes.CreateProjectTemplateRequest{
+		Name: projectTemplateCreateOpts.name,
+		Spec: *spec,
+	}
+
+	log.Infof("creating project template")
+	pt, _, err := gwclient.CreateProjectTemplate(context.TODO(), req)
+	if err != nil {
+		return errors.Errorf("failed to create project template: %w", err)
+	}
+	log.Infof("project template %s created, ID: %s", pt.Name, pt.ID)
+
+	return nil
+}
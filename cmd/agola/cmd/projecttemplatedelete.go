@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectTemplateDelete = &cobra.Command{
+	Use:   "delete",
+	Short: "delete a project template",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectTemplateDelete(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectTemplateDeleteOptions struct {
+	ref string
+}
+
+var projectTemplateDeleteOpts projectTemplateDeleteOptions
+
+func init() {
+	flags := cmdProjectTemplateDelete.Flags()
+
+	flags.StringVar(&projectTemplateDeleteOpts.ref, "ref", "", "project template name or id")
+
+	if err := cmdProjectTemplateDelete.MarkFlagRequired("ref"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectTemplate.AddCommand(cmdProjectTemplateDelete)
+}
+
+func projectTemplateDelete(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	log.Infof("deleting project template")
+	if _, err := gwclient.DeleteProjectTemplate(context.TODO(), projectTemplateDeleteOpts.ref); err != nil {
+		return errors.Errorf("failed to delete project template: %w", err)
+	}
+
+	return nil
+}
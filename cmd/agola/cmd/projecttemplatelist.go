@@ -0,0 +1,74 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdProjectTemplateList = &cobra.Command{
+	Use: "list",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectTemplateList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "list",
+}
+
+type projectTemplateListOptions struct {
+	limit int
+	start string
+}
+
+var projectTemplateListOpts projectTemplateListOptions
+
+func init() {
+	flags := cmdProjectTemplateList.Flags()
+
+	flags.IntVar(&projectTemplateListOpts.limit, "limit", 10, "max number of project templates to show")
+	flags.StringVar(&projectTemplateListOpts.start, "start", "", "starting project template name (excluded) to fetch")
+
+	cmdProjectTemplate.AddCommand(cmdProjectTemplateList)
+}
+
+func printProjectTemplates(projectTemplates []*gwapitypes.ProjectTemplateResponse) {
+	for _, pt := range projectTemplates {
+		var revision int64
+		if len(pt.Revisions) > 0 {
+			revision = pt.Revisions[len(pt.Revisions)-1].Revision
+		}
+		fmt.Printf("%s: Name: %s, Revision: %d\n", pt.ID, pt.Name, revision)
+	}
+}
+
+func projectTemplateList(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	projectTemplates, _, err := gwclient.GetProjectTemplates(context.TODO(), projectTemplateListOpts.start, projectTemplateListOpts.limit, false)
+	if err != nil {
+		return err
+	}
+
+	printProjectTemplates(projectTemplates)
+
+	return nil
+}
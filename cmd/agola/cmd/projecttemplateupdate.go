@@ -0,0 +1,83 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectTemplateUpdate = &cobra.Command{
+	Use:   "update",
+	Short: "update a project template",
+	Long: "update a project template\n\n" +
+		"Every update creates a new project template revision. Projects already created from the template aren't changed.\n\n" +
+		projectTemplateSpecHelp,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectTemplateUpdate(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectTemplateUpdateOptions struct {
+	ref  string
+	file string
+}
+
+var projectTemplateUpdateOpts projectTemplateUpdateOptions
+
+func init() {
+	flags := cmdProjectTemplateUpdate.Flags()
+
+	flags.StringVar(&projectTemplateUpdateOpts.ref, "ref", "", "current project template name or id")
+	flags.StringVarP(&projectTemplateUpdateOpts.file, "file", "f", "", `yaml file containing the project template definition (use "-" to read from stdin)`)
+
+	if err := cmdProjectTemplateUpdate.MarkFlagRequired("ref"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectTemplateUpdate.MarkFlagRequired("file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectTemplate.AddCommand(cmdProjectTemplateUpdate)
+}
+
+func projectTemplateUpdate(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	spec, err := readProjectTemplateSpec(projectTemplateUpdateOpts.file)
+	if err != nil {
+		return err
+	}
+
+	req := &gwapitypes.UpdateProjectTemplateRequest{
+		Spec: *spec,
+	}
+
+	log.Infof("updating project template")
+	pt, _, err := gwclient.UpdateProjectTemplate(context.TODO(), projectTemplateUpdateOpts.ref, req)
+	if err != nil {
+		return errors.Errorf("failed to update project template: %w", err)
+	}
+	log.Infof("project template %s updated, revision: %d", pt.Name, pt.Revisions[len(pt.Revisions)-1].Revision)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectTriggerPolicySet = &cobra.Command{
+	Use:   "set",
+	Short: "sets which webhook events create the project runs",
+	Long: `sets which webhook events create the project runs
+
+By default runs are created on push to any branch, on tags and on pull requests. Manually created runs aren't affected by the trigger policy.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectTriggerPolicySet(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectTriggerPolicySetOptions struct {
+	projectRef   string
+	branches     string
+	tags         bool
+	pullRequests bool
+}
+
+var projectTriggerPolicySetOpts projectTriggerPolicySetOptions
+
+func init() {
+	flags := cmdProjectTriggerPolicySet.Flags()
+
+	flags.StringVar(&projectTriggerPolicySetOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&projectTriggerPolicySetOpts.branches, "branches", "all", `branches whose pushes create runs: "all", "default" (only the repository default branch) or "none"`)
+	flags.BoolVar(&projectTriggerPolicySetOpts.tags, "tags", true, "create runs on tags")
+	flags.BoolVar(&projectTriggerPolicySetOpts.pullRequests, "pull-requests", true, "create runs on pull requests")
+
+	if err := cmdProjectTriggerPolicySet.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectTriggerPolicy.AddCommand(cmdProjectTriggerPolicySet)
+}
+
+func projectTriggerPolicySet(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	req := &gwapitypes.SetProjectTriggerPolicyRequest{
+		Branches:     projectTriggerPolicySetOpts.branches,
+		Tags:         projectTriggerPolicySetOpts.tags,
+		PullRequests: projectTriggerPolicySetOpts.pullRequests,
+	}
+
+	log.Infof("setting project trigger policy")
+	if _, _, err := gwclient.SetProjectTriggerPolicy(context.TODO(), projectTriggerPolicySetOpts.projectRef, req); err != nil {
+		return errors.Errorf("failed to set project trigger policy: %w", err)
+	}
+
+	return nil
+}
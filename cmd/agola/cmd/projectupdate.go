@@ -41,6 +41,14 @@ type projectUpdateOptions struct {
 	parentPath         string
 	visibility         string
 	passVarsToForkedPR bool
+	networkPolicy      string
+	securityProfile    string
+
+	untrustedRunsNeedApproval bool
+	configFromBaseBranch      bool
+	maxStepLogSize            int64
+	webhookRunSelectors       []string
+	requiredRuns              []string
 }
 
 var projectUpdateOpts projectUpdateOptions
@@ -53,6 +61,13 @@ func init() {
 	flags.StringVar(&projectUpdateOpts.parentPath, "parent", "", `parent project group path (i.e "org/org01" for root project group in org01, "user/user01/group01/subgroub01") or project group id where the project should be moved`)
 	flags.StringVar(&projectUpdateOpts.visibility, "visibility", "public", `project visibility (public or private)`)
 	flags.BoolVar(&projectUpdateOpts.passVarsToForkedPR, "pass-vars-to-forked-pr", false, `pass variables to run even if triggered by PR from forked repo`)
+	flags.StringVar(&projectUpdateOpts.networkPolicy, "network-policy", "", `name of the executor network policy applied to the project runs (empty to remove it)`)
+	flags.StringVar(&projectUpdateOpts.securityProfile, "security-profile", "", `name of the executor security profile applied to the project runs (empty to use the executor default)`)
+	flags.BoolVar(&projectUpdateOpts.untrustedRunsNeedApproval, "untrusted-runs-need-approval", false, `require an approval before executing untrusted runs (triggered by PR from forked repo of not collaborators)`)
+	flags.BoolVar(&projectUpdateOpts.configFromBaseBranch, "config-from-base-branch", false, `read the pull requests run config from their base branch, so pull requests cannot change the pipeline executed on them`)
+	flags.Int64Var(&projectUpdateOpts.maxStepLogSize, "max-step-log-size", 0, `max log size in bytes of the project runs steps, overrides the executor default (0 to use the executor default)`)
+	flags.StringSliceVar(&projectUpdateOpts.webhookRunSelectors, "webhook-runs", nil, `names or labels of the runs created by the project webhook. This option can be repeated multiple times (empty to create all the runs)`)
+	flags.StringSliceVar(&projectUpdateOpts.requiredRuns, "required-runs", nil, `names of the runs that must succeed on a commit to pass its required checks. This option can be repeated multiple times (empty to require all the commit runs)`)
 
 	if err := cmdProjectUpdate.MarkFlagRequired("ref"); err != nil {
 		log.Fatal(err)
@@ -83,6 +98,27 @@ func projectUpdate(cmd *cobra.Command, args []string) error {
 	if flags.Changed("pass-vars-to-forked-pr") {
 		req.PassVarsToForkedPR = &projectUpdateOpts.passVarsToForkedPR
 	}
+	if flags.Changed("network-policy") {
+		req.NetworkPolicy = &projectUpdateOpts.networkPolicy
+	}
+	if flags.Changed("security-profile") {
+		req.SecurityProfile = &projectUpdateOpts.securityProfile
+	}
+	if flags.Changed("untrusted-runs-need-approval") {
+		req.UntrustedRunsNeedApproval = &projectUpdateOpts.untrustedRunsNeedApproval
+	}
+	if flags.Changed("config-from-base-branch") {
+		req.ConfigFromBaseBranch = &projectUpdateOpts.configFromBaseBranch
+	}
+	if flags.Changed("max-step-log-size") {
+		req.MaxStepLogSize = &projectUpdateOpts.maxStepLogSize
+	}
+	if flags.Changed("webhook-runs") {
+		req.WebhookRunSelectors = &projectUpdateOpts.webhookRunSelectors
+	}
+	if flags.Changed("required-runs") {
+		req.RequiredRuns = &projectUpdateOpts.requiredRuns
+	}
 
 	log.Infof("updating project")
 	project, _, err := gwclient.UpdateProject(context.TODO(), projectUpdateOpts.ref, req)
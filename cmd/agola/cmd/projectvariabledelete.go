@@ -17,6 +17,7 @@ package cmd
 import (
 	"context"
 
+	gwapitypes "agola.io/agola/services/gateway/api/types"
 	gwclient "agola.io/agola/services/gateway/client"
 
 	"github.com/spf13/cobra"
@@ -34,8 +35,9 @@ var cmdProjectVariableDelete = &cobra.Command{
 }
 
 type variableDeleteOptions struct {
-	parentRef string
-	name      string
+	parentRef  string
+	name       string
+	failIfUsed bool
 }
 
 var variableDeleteOpts variableDeleteOptions
@@ -45,6 +47,7 @@ func init() {
 
 	flags.StringVar(&variableDeleteOpts.parentRef, "project", "", "project id or full path")
 	flags.StringVarP(&variableDeleteOpts.name, "name", "n", "", "variable name")
+	flags.BoolVar(&variableDeleteOpts.failIfUsed, "fail-if-used", false, "refuse to delete the variable if it has been used by recent project runs")
 
 	if err := cmdProjectVariableDelete.MarkFlagRequired("project"); err != nil {
 		log.Fatal(err)
@@ -59,17 +62,34 @@ func init() {
 func variableDelete(cmd *cobra.Command, ownertype string, args []string) error {
 	gwclient := gwclient.NewClient(gatewayURL, token)
 
+	if !variableDeleteOpts.failIfUsed {
+		var usages []*gwapitypes.ConfigUsageResponse
+		var err error
+		switch ownertype {
+		case "project":
+			usages, _, err = gwclient.GetProjectVariableUsages(context.TODO(), variableDeleteOpts.parentRef, variableDeleteOpts.name)
+		case "projectgroup":
+			usages, _, err = gwclient.GetProjectGroupVariableUsages(context.TODO(), variableDeleteOpts.parentRef, variableDeleteOpts.name)
+		}
+		if err != nil {
+			return errors.Errorf("failed to get %s variable usages: %w", ownertype, err)
+		}
+		for _, u := range usages {
+			log.Warnf("variable %q has been used by project %q at %s", variableDeleteOpts.name, u.ProjectPath, u.LastUsedTime)
+		}
+	}
+
 	switch ownertype {
 	case "project":
 		log.Infof("deleting project variable")
-		_, err := gwclient.DeleteProjectVariable(context.TODO(), variableDeleteOpts.parentRef, variableDeleteOpts.name)
+		_, err := gwclient.DeleteProjectVariable(context.TODO(), variableDeleteOpts.parentRef, variableDeleteOpts.name, variableDeleteOpts.failIfUsed)
 		if err != nil {
 			return errors.Errorf("failed to delete project variable: %w", err)
 		}
 		log.Infof("project variable deleted")
 	case "projectgroup":
 		log.Infof("deleting project group variable")
-		_, err := gwclient.DeleteProjectGroupVariable(context.TODO(), variableDeleteOpts.parentRef, variableDeleteOpts.name)
+		_, err := gwclient.DeleteProjectGroupVariable(context.TODO(), variableDeleteOpts.parentRef, variableDeleteOpts.name, variableDeleteOpts.failIfUsed)
 		if err != nil {
 			return errors.Errorf("failed to delete project group variable: %w", err)
 		}
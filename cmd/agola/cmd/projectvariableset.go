@@ -0,0 +1,145 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/ghodss/yaml"
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectVariableSet = &cobra.Command{
+	Use:   "set",
+	Short: "create or update multiple project variables",
+	Long: `create or update multiple project variables
+
+All the variables are applied in a single transaction. The variables should be provided by a yaml document. Examples:
+
+- name: var01
+  values:
+    - secret_name: secret01
+      secret_var: var01
+      when:
+        branch: master
+    - secret_name: secret02
+      secret_var: data02
+- name: var02
+  values:
+    - secret_name: secret01
+      secret_var: var02
+
+When --prune is provided the project variables not defined in the file are removed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := variableSet(cmd, "project", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type variableSetOptions struct {
+	parentRef string
+	file      string
+	prune     bool
+}
+
+var variableSetOpts variableSetOptions
+
+func init() {
+	flags := cmdProjectVariableSet.Flags()
+
+	flags.StringVar(&variableSetOpts.parentRef, "project", "", "project id or full path")
+	flags.StringVarP(&variableSetOpts.file, "from-file", "f", "", `yaml file containing the variables definitions (use "-" to read from stdin)`)
+	flags.BoolVar(&variableSetOpts.prune, "prune", false, "remove the variables not defined in the file")
+
+	if err := cmdProjectVariableSet.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectVariableSet.MarkFlagRequired("from-file"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectVariable.AddCommand(cmdProjectVariableSet)
+}
+
+type VariableDefinition struct {
+	Name   string          `json:"name"`
+	Values []VariableValue `json:"values"`
+}
+
+func variableSet(cmd *cobra.Command, ownertype string, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	// "github.com/ghodss/yaml" doesn't provide a streaming decoder
+	var data []byte
+	var err error
+	if variableSetOpts.file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+	} else {
+		data, err = ioutil.ReadFile(variableSetOpts.file)
+		if err != nil {
+			return err
+		}
+	}
+
+	var variables []VariableDefinition
+	if err := yaml.Unmarshal(data, &variables); err != nil {
+		return errors.Errorf("failed to unmarshal variables: %w", err)
+	}
+	req := &gwapitypes.SetVariablesRequest{
+		Prune: variableSetOpts.prune,
+	}
+	for _, variable := range variables {
+		rvalues := []gwapitypes.VariableValueRequest{}
+		for _, value := range variable.Values {
+			rvalues = append(rvalues, gwapitypes.VariableValueRequest{
+				SecretName: value.SecretName,
+				SecretVar:  value.SecretVar,
+				When:       value.When.ToWhen(),
+			})
+		}
+		req.Variables = append(req.Variables, &gwapitypes.CreateVariableRequest{
+			Name:   variable.Name,
+			Values: rvalues,
+		})
+	}
+
+	var results []*gwapitypes.SetResultResponse
+	switch ownertype {
+	case "project":
+		log.Infof("setting project variables")
+		results, _, err = gwclient.SetProjectVariables(context.TODO(), variableSetOpts.parentRef, req)
+	case "projectgroup":
+		log.Infof("setting project group variables")
+		results, _, err = gwclient.SetProjectGroupVariables(context.TODO(), variableSetOpts.parentRef, req)
+	}
+	if err != nil {
+		return errors.Errorf("failed to set %s variables: %w", ownertype, err)
+	}
+
+	printSetResults(results)
+
+	return nil
+}
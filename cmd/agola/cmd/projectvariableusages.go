@@ -0,0 +1,83 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectVariableUsages = &cobra.Command{
+	Use:   "usages",
+	Short: "list the projects whose runs used a variable",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := variableUsages(cmd, "project", args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type variableUsagesOptions struct {
+	parentRef string
+	name      string
+}
+
+var variableUsagesOpts variableUsagesOptions
+
+func init() {
+	flags := cmdProjectVariableUsages.Flags()
+
+	flags.StringVar(&variableUsagesOpts.parentRef, "project", "", "project id or full path")
+	flags.StringVarP(&variableUsagesOpts.name, "name", "n", "", "variable name")
+
+	if err := cmdProjectVariableUsages.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectVariableUsages.MarkFlagRequired("name"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectVariable.AddCommand(cmdProjectVariableUsages)
+}
+
+func variableUsages(cmd *cobra.Command, ownertype string, args []string) error {
+	var err error
+	var usages []*gwapitypes.ConfigUsageResponse
+
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	switch ownertype {
+	case "project":
+		usages, _, err = gwclient.GetProjectVariableUsages(context.TODO(), variableUsagesOpts.parentRef, variableUsagesOpts.name)
+	case "projectgroup":
+		usages, _, err = gwclient.GetProjectGroupVariableUsages(context.TODO(), variableUsagesOpts.parentRef, variableUsagesOpts.name)
+	}
+	if err != nil {
+		return errors.Errorf("failed to get %s variable usages: %w", ownertype, err)
+	}
+	prettyJSON, err := json.MarshalIndent(usages, "", "\t")
+	if err != nil {
+		return errors.Errorf("failed to convert %s variable usages to json: %w", ownertype, err)
+	}
+	fmt.Printf("%s\n", string(prettyJSON))
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectWebhookDeliveryList = &cobra.Command{
+	Use:   "list",
+	Short: "list the last webhook deliveries of a project",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectWebhookDeliveryList(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectWebhookDeliveryListOptions struct {
+	projectRef string
+	limit      int
+}
+
+var projectWebhookDeliveryListOpts projectWebhookDeliveryListOptions
+
+func init() {
+	flags := cmdProjectWebhookDeliveryList.Flags()
+
+	flags.StringVar(&projectWebhookDeliveryListOpts.projectRef, "project", "", "project id or full path")
+	flags.IntVar(&projectWebhookDeliveryListOpts.limit, "limit", 10, "max number of webhook deliveries to show")
+
+	if err := cmdProjectWebhookDeliveryList.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectWebhookDelivery.AddCommand(cmdProjectWebhookDeliveryList)
+}
+
+func projectWebhookDeliveryList(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	deliveries, _, err := gwclient.GetProjectWebhookDeliveries(context.TODO(), projectWebhookDeliveryListOpts.projectRef, projectWebhookDeliveryListOpts.limit)
+	if err != nil {
+		return errors.Errorf("failed to get webhook deliveries: %w", err)
+	}
+
+	for _, d := range deliveries {
+		fmt.Printf("%s: ReceivedAt: %s, Event: %s, Status: %s", d.ID, d.ReceivedAt, d.Event, d.Status)
+		if d.Error != "" {
+			fmt.Printf(", Error: %s", d.Error)
+		}
+		fmt.Printf("\n")
+	}
+
+	return nil
+}
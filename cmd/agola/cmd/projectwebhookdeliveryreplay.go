@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdProjectWebhookDeliveryReplay = &cobra.Command{
+	Use:   "replay",
+	Short: "replay a recorded webhook delivery",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := projectWebhookDeliveryReplay(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type projectWebhookDeliveryReplayOptions struct {
+	projectRef string
+	deliveryID string
+}
+
+var projectWebhookDeliveryReplayOpts projectWebhookDeliveryReplayOptions
+
+func init() {
+	flags := cmdProjectWebhookDeliveryReplay.Flags()
+
+	flags.StringVar(&projectWebhookDeliveryReplayOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&projectWebhookDeliveryReplayOpts.deliveryID, "id", "", "webhook delivery id")
+
+	if err := cmdProjectWebhookDeliveryReplay.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+	if err := cmdProjectWebhookDeliveryReplay.MarkFlagRequired("id"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdProjectWebhookDelivery.AddCommand(cmdProjectWebhookDeliveryReplay)
+}
+
+func projectWebhookDeliveryReplay(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	log.Infof("replaying webhook delivery %q", projectWebhookDeliveryReplayOpts.deliveryID)
+	if _, err := gwclient.ReplayProjectWebhookDelivery(context.TODO(), projectWebhookDeliveryReplayOpts.projectRef, projectWebhookDeliveryReplayOpts.deliveryID); err != nil {
+		return errors.Errorf("failed to replay webhook delivery: %w", err)
+	}
+	log.Infof("webhook delivery replayed")
+
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunCancel = &cobra.Command{
+	Use: "cancel",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runCancel(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "cancel a run or all the active runs of an organization or project group",
+}
+
+type runCancelOptions struct {
+	runID           string
+	all             bool
+	orgName         string
+	projectGroupRef string
+	tags            []string
+}
+
+var runCancelOpts runCancelOptions
+
+func init() {
+	flags := cmdRunCancel.Flags()
+
+	flags.StringVar(&runCancelOpts.runID, "runid", "", "Run Id")
+	flags.BoolVar(&runCancelOpts.all, "all", false, "cancel all the active runs of the projects inside the provided organization or project group")
+	flags.StringVar(&runCancelOpts.orgName, "org", "", "organization name")
+	flags.StringVar(&runCancelOpts.projectGroupRef, "projectgroup", "", "project group id or full path")
+	flags.StringSliceVar(&runCancelOpts.tags, "tag", nil, "with --all cancel only the runs having the provided tag. This option can be repeated multiple times (the runs must have all the tags)")
+
+	cmdRun.AddCommand(cmdRunCancel)
+}
+
+func runCancel(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+
+	if flags.Changed("runid") && flags.Changed("all") {
+		return errors.Errorf(`only one of "--runid" or "--all" can be provided`)
+	}
+	if !flags.Changed("runid") && !flags.Changed("all") {
+		return errors.Errorf(`one of "--runid" or "--all" must be provided`)
+	}
+
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	if flags.Changed("runid") {
+		if flags.Changed("tag") {
+			return errors.Errorf(`"--tag" can be provided only with "--all"`)
+		}
+		req := &gwapitypes.RunActionsRequest{
+			ActionType: gwapitypes.RunActionTypeCancel,
+		}
+		if _, _, err := gwclient.RunActions(context.TODO(), runCancelOpts.runID, req); err != nil {
+			return errors.Errorf("failed to cancel run: %w", err)
+		}
+		return nil
+	}
+
+	if flags.Changed("org") && flags.Changed("projectgroup") {
+		return errors.Errorf(`only one of "--org" or "--projectgroup" can be provided`)
+	}
+	if !flags.Changed("org") && !flags.Changed("projectgroup") {
+		return errors.Errorf(`one of "--org" or "--projectgroup" must be provided with "--all"`)
+	}
+
+	projectGroupRef := runCancelOpts.projectGroupRef
+	if flags.Changed("org") {
+		// the organization root project group
+		projectGroupRef = path.Join("org", runCancelOpts.orgName)
+	}
+
+	req := &gwapitypes.BulkRunActionsRequest{
+		ActionType: gwapitypes.RunActionTypeCancel,
+		Tags:       runCancelOpts.tags,
+	}
+	res, _, err := gwclient.BulkRunActions(context.TODO(), projectGroupRef, req)
+	if err != nil {
+		return errors.Errorf("failed to cancel runs: %w", err)
+	}
+
+	printBulkOperationResponse(res)
+
+	if res.Failed > 0 {
+		return errors.Errorf("failed to cancel %d runs", res.Failed)
+	}
+
+	return nil
+}
+
+func printBulkOperationResponse(res *gwapitypes.BulkOperationResponse) {
+	for _, item := range res.Items {
+		status := "ok"
+		if item.Error != "" {
+			status = fmt.Sprintf("error: %s", item.Error)
+		}
+		switch {
+		case item.RunID != "":
+			fmt.Printf("%s: run %s: %s\n", item.ProjectPath, item.RunID, status)
+		case len(item.RunIDs) > 0:
+			fmt.Printf("%s: runs %s: %s\n", item.ProjectPath, strings.Join(item.RunIDs, ", "), status)
+		default:
+			fmt.Printf("%s: %s\n", item.ProjectPath, status)
+		}
+	}
+	fmt.Printf("succeeded: %d, failed: %d\n", res.Succeeded, res.Failed)
+}
@@ -0,0 +1,123 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRunConfigSource = &cobra.Command{
+	Use:   "configsource",
+	Short: "report the config file used to create the runs at a git ref",
+	Long: `report the config file used to create the runs at a git ref
+
+The run config is read from the project repository at the run commit, so the runs of a branch use the config file of that branch. When the project defines a config repository the run config is read from the head of the config repository branch. The config file isn't evaluated, use "run preview" for that.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runConfigSource(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type runConfigSourceOptions struct {
+	projectRef string
+	branch     string
+	tag        string
+	ref        string
+	commitSHA  string
+	json       bool
+}
+
+var runConfigSourceOpts runConfigSourceOptions
+
+func init() {
+	flags := cmdRunConfigSource.Flags()
+
+	flags.StringVar(&runConfigSourceOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&runConfigSourceOpts.branch, "branch", "", "git branch")
+	flags.StringVar(&runConfigSourceOpts.tag, "tag", "", "git tag")
+	flags.StringVar(&runConfigSourceOpts.ref, "ref", "", "git ref")
+	flags.StringVar(&runConfigSourceOpts.commitSHA, "commit-sha", "", "git commit sha")
+	flags.BoolVar(&runConfigSourceOpts.json, "json", false, "print the config source as json")
+
+	if err := cmdRunConfigSource.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunConfigSource)
+}
+
+func runConfigSource(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	flags := cmd.Flags()
+	set := 0
+	if flags.Changed("branch") {
+		set++
+	}
+	if flags.Changed("tag") {
+		set++
+	}
+	if flags.Changed("ref") {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf(`one of "--branch", "--tag" or "--ref" must be provided`)
+	}
+
+	cs, _, err := gwclient.ProjectRunConfigSource(context.TODO(), runConfigSourceOpts.projectRef, runConfigSourceOpts.branch, runConfigSourceOpts.tag, runConfigSourceOpts.ref, runConfigSourceOpts.commitSHA)
+	if err != nil {
+		return err
+	}
+
+	if runConfigSourceOpts.json {
+		out, err := json.MarshalIndent(cs, "", "\t")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+		return nil
+	}
+
+	printRunConfigSource(cs)
+
+	return nil
+}
+
+func printRunConfigSource(cs *gwapitypes.RunConfigSourceResponse) {
+	fmt.Printf("repository: %s\n", cs.RepositoryPath)
+	fmt.Printf("ref: %s\n", cs.Ref)
+	fmt.Printf("commit: %s\n", cs.CommitSHA)
+	if cs.ConfigRepository {
+		fmt.Printf("config repository: %s\n", cs.ConfigRepositoryPath)
+		fmt.Printf("config ref: %s\n", cs.ConfigRef)
+		fmt.Printf("config commit: %s\n", cs.ConfigCommitSHA)
+	}
+	if cs.ConfigPath != "" {
+		fmt.Printf("config file: %s\n", cs.ConfigPath)
+	} else {
+		fmt.Printf("config file: none (looked up: %s)\n", strings.Join(cs.CandidatePaths, ", "))
+	}
+}
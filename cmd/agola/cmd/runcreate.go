@@ -17,6 +17,8 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"time"
 
 	gwapitypes "agola.io/agola/services/gateway/api/types"
 	gwclient "agola.io/agola/services/gateway/client"
@@ -27,19 +29,27 @@ import (
 var cmdRunCreate = &cobra.Command{
 	Use: "create",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := runCreate(cmd, args); err != nil {
+		exitCode, err := runCreate(cmd, args)
+		if err != nil {
 			log.Fatalf("err: %v", err)
 		}
+		os.Exit(exitCode)
 	},
 	Short: "create",
 }
 
 type runCreateOptions struct {
-	projectRef string
-	branch     string
-	tag        string
-	ref        string
-	commitSHA  string
+	projectRef      string
+	projectGroupRef string
+	branch          string
+	tag             string
+	ref             string
+	commitSHA       string
+	executorID      string
+	runSelectors    []string
+	runTags         []string
+	wait            bool
+	timeout         time.Duration
 }
 
 var runCreateOpts runCreateOptions
@@ -48,23 +58,32 @@ func init() {
 	flags := cmdRunCreate.Flags()
 
 	flags.StringVar(&runCreateOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&runCreateOpts.projectGroupRef, "projectgroup", "", "create a run on all the projects inside the provided project group id or full path")
 	flags.StringVar(&runCreateOpts.branch, "branch", "", "git branch")
 	flags.StringVar(&runCreateOpts.tag, "tag", "", "git tag")
 	flags.StringVar(&runCreateOpts.ref, "ref", "", "git ref")
 	flags.StringVar(&runCreateOpts.commitSHA, "commit-sha", "", "git commit sha")
-
-	if err := cmdRunCreate.MarkFlagRequired("project"); err != nil {
-		log.Fatal(err)
-	}
+	flags.StringVar(&runCreateOpts.executorID, "executor-id", "", "schedule all the run tasks on the executor with the provided id (admin only, for debugging)")
+	flags.StringSliceVar(&runCreateOpts.runSelectors, "run", nil, "create only the runs with the provided name or label. This option can be repeated multiple times")
+	flags.StringSliceVar(&runCreateOpts.runTags, "run-tag", nil, "add the provided tag to the created runs. This option can be repeated multiple times")
+	flags.BoolVar(&runCreateOpts.wait, "wait", false, "wait for the created runs to finish and exit with the same codes of \"run watch\". It fails if no run is created")
+	flags.DurationVar(&runCreateOpts.timeout, "timeout", 0, "max time to wait for the created runs to finish (i.e. 10m, 1h). Defaults to no timeout")
 
 	cmdRun.AddCommand(cmdRunCreate)
 }
 
-func runCreate(cmd *cobra.Command, args []string) error {
+func runCreate(cmd *cobra.Command, args []string) (int, error) {
 	gwclient := gwclient.NewClient(gatewayURL, token)
 
-	set := 0
 	flags := cmd.Flags()
+	if flags.Changed("project") && flags.Changed("projectgroup") {
+		return 0, fmt.Errorf(`only one of "--project" or "--projectgroup" can be provided`)
+	}
+	if !flags.Changed("project") && !flags.Changed("projectgroup") {
+		return 0, fmt.Errorf(`one of "--project" or "--projectgroup" must be provided`)
+	}
+
+	set := 0
 	if flags.Changed("branch") {
 		set++
 	}
@@ -75,17 +94,73 @@ func runCreate(cmd *cobra.Command, args []string) error {
 		set++
 	}
 	if set != 1 {
-		return fmt.Errorf(`one of "--branch", "--tag" or "--ref" must be provided`)
+		return 0, fmt.Errorf(`one of "--branch", "--tag" or "--ref" must be provided`)
+	}
+
+	if flags.Changed("timeout") && !runCreateOpts.wait {
+		return 0, fmt.Errorf(`"--timeout" can be provided only with "--wait"`)
+	}
+
+	if flags.Changed("projectgroup") {
+		if flags.Changed("commit-sha") {
+			return 0, fmt.Errorf(`"--commit-sha" cannot be provided with "--projectgroup"`)
+		}
+		if flags.Changed("executor-id") {
+			return 0, fmt.Errorf(`"--executor-id" cannot be provided with "--projectgroup"`)
+		}
+		if runCreateOpts.wait {
+			return 0, fmt.Errorf(`"--wait" cannot be provided with "--projectgroup"`)
+		}
+
+		req := &gwapitypes.BulkCreateRunsRequest{
+			Branch:       runCreateOpts.branch,
+			Tag:          runCreateOpts.tag,
+			Ref:          runCreateOpts.ref,
+			RunSelectors: runCreateOpts.runSelectors,
+			RunTags:      runCreateOpts.runTags,
+		}
+
+		res, _, err := gwclient.BulkCreateRuns(context.TODO(), runCreateOpts.projectGroupRef, req)
+		if err != nil {
+			return 0, err
+		}
+
+		printBulkOperationResponse(res)
+
+		if res.Failed > 0 {
+			return 0, fmt.Errorf("failed to create %d runs", res.Failed)
+		}
+
+		return 0, nil
 	}
 
 	req := &gwapitypes.ProjectCreateRunRequest{
-		Branch:    runCreateOpts.branch,
-		Tag:       runCreateOpts.tag,
-		Ref:       runCreateOpts.ref,
-		CommitSHA: runCreateOpts.commitSHA,
+		Branch:       runCreateOpts.branch,
+		Tag:          runCreateOpts.tag,
+		Ref:          runCreateOpts.ref,
+		CommitSHA:    runCreateOpts.commitSHA,
+		ExecutorID:   runCreateOpts.executorID,
+		RunSelectors: runCreateOpts.runSelectors,
+		RunTags:      runCreateOpts.runTags,
 	}
 
-	_, err := gwclient.ProjectCreateRun(context.TODO(), runCreateOpts.projectRef, req)
+	res, _, err := gwclient.ProjectCreateRun(context.TODO(), runCreateOpts.projectRef, req)
+	if err != nil {
+		return 0, err
+	}
+
+	if !runCreateOpts.wait {
+		return 0, nil
+	}
+
+	// there's nothing to wait for, fail instead of reporting a success
+	if len(res.RunIDs) == 0 {
+		return runWatchExitCodeFailed, fmt.Errorf("no run created")
+	}
+
+	for _, runID := range res.RunIDs {
+		fmt.Printf("created run %s\n", runID)
+	}
 
-	return err
+	return watchRuns(context.TODO(), gwclient, res.RunIDs, runCreateOpts.timeout)
 }
@@ -0,0 +1,74 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRunDiff = &cobra.Command{
+	Use:   "diff <runid> <otherrunid>",
+	Short: "show the run config changes between two runs",
+	Long: `show the run config changes between two runs
+
+The evaluated run configs stored with the runs are compared, so the output reports if the pipeline changed between the runs. The values that could contain secrets (like environment variables) are redacted and only reported as changed.
+`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runDiff(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdRun.AddCommand(cmdRunDiff)
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	diff, _, err := gwclient.GetRunConfigDiff(context.TODO(), args[0], args[1])
+	if err != nil {
+		return err
+	}
+
+	if diff.Diff == "" {
+		fmt.Printf("no run config changes\n")
+		return nil
+	}
+
+	if len(diff.ChangedFields) > 0 {
+		fmt.Printf("changed fields: %s\n", strings.Join(diff.ChangedFields, ", "))
+	}
+	if len(diff.AddedTasks) > 0 {
+		fmt.Printf("added tasks: %s\n", strings.Join(diff.AddedTasks, ", "))
+	}
+	if len(diff.RemovedTasks) > 0 {
+		fmt.Printf("removed tasks: %s\n", strings.Join(diff.RemovedTasks, ", "))
+	}
+	if len(diff.ChangedTasks) > 0 {
+		fmt.Printf("changed tasks: %s\n", strings.Join(diff.ChangedTasks, ", "))
+	}
+	fmt.Printf("\n--- %s\n+++ %s\n%s", diff.RunID, diff.OtherRunID, diff.Diff)
+
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunEnv = &cobra.Command{
+	Use:   "env <runref>",
+	Short: "show the environment of the run tasks",
+	Long: `show the environment of the run tasks
+
+The values of the environment variables taken from a variable (or that could contain secrets) are always redacted and reported as "[secret]". The environment variables injected by the executor (like the proxy ones) aren't reported.
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runEnv(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type runEnvOptions struct {
+	taskName string
+}
+
+var runEnvOpts runEnvOptions
+
+func init() {
+	flags := cmdRunEnv.Flags()
+
+	flags.StringVar(&runEnvOpts.taskName, "task", "", "show only the environment of the task with the provided name")
+
+	cmdRun.AddCommand(cmdRunEnv)
+}
+
+func runEnv(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	run, _, err := gwclient.GetRun(context.TODO(), args[0])
+	if err != nil {
+		return errors.Errorf("failed to get run %q: %w", args[0], err)
+	}
+
+	tasks := []*gwapitypes.RunResponseTask{}
+	for _, rt := range run.Tasks {
+		if runEnvOpts.taskName != "" && rt.Name != runEnvOpts.taskName {
+			continue
+		}
+		tasks = append(tasks, rt)
+	}
+	if runEnvOpts.taskName != "" && len(tasks) == 0 {
+		return errors.Errorf("run %q doesn't have task %q", args[0], runEnvOpts.taskName)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+
+	for _, rt := range tasks {
+		env, _, err := gwclient.GetRunTaskEnvironment(context.TODO(), run.ID, rt.ID)
+		if err != nil {
+			return errors.Errorf("failed to get task %q environment: %w", rt.Name, err)
+		}
+		fmt.Printf("TaskName: %s, TaskID: %s\n", env.TaskName, env.TaskID)
+		printEnv("\t", env.Environment)
+		for _, s := range env.Steps {
+			fmt.Printf("\tStep %d (%s):\n", s.Step, s.Name)
+			printEnv("\t\t", s.Environment)
+		}
+	}
+
+	return nil
+}
+
+func printEnv(prefix string, env map[string]string) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s%s=%s\n", prefix, name, env[name])
+	}
+}
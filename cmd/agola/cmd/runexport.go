@@ -0,0 +1,114 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	gwclient "agola.io/agola/services/gateway/client"
+	errors "golang.org/x/xerrors"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRunExport = &cobra.Command{
+	Use: "export",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runExport(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "export the finished runs of a project as newline delimited json",
+	Long: `export the finished runs of a project as newline delimited json
+
+Every record contains a watermark. Provide the watermark of the last exported
+record to continue an incremental export.`,
+}
+
+type runExportOptions struct {
+	projectRef string
+	start      string
+	end        string
+	watermark  string
+	output     string
+}
+
+var runExportOpts runExportOptions
+
+func init() {
+	flags := cmdRunExport.Flags()
+
+	flags.StringVar(&runExportOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&runExportOpts.start, "start", "", "export the runs ended at or after this time (RFC3339)")
+	flags.StringVar(&runExportOpts.end, "end", "", "export the runs ended before this time (RFC3339). Defaults to now")
+	flags.StringVar(&runExportOpts.watermark, "watermark", "", "export only the runs following this watermark")
+	flags.StringVarP(&runExportOpts.output, "output", "o", "", "write the export to this file instead of stdout")
+
+	if err := cmdRunExport.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunExport)
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	var start, end *time.Time
+	if runExportOpts.start != "" {
+		t, err := time.Parse(time.RFC3339, runExportOpts.start)
+		if err != nil {
+			return errors.Errorf("cannot parse start time: %v", err)
+		}
+		start = &t
+	}
+	if runExportOpts.end != "" {
+		t, err := time.Parse(time.RFC3339, runExportOpts.end)
+		if err != nil {
+			return errors.Errorf("cannot parse end time: %v", err)
+		}
+		end = &t
+	}
+
+	project, _, err := gwclient.GetProject(context.TODO(), runExportOpts.projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project %s: %v", runExportOpts.projectRef, err)
+	}
+
+	resp, err := gwclient.ExportRuns(context.TODO(), path.Join("/project", project.ID), start, end, runExportOpts.watermark)
+	if err != nil {
+		return errors.Errorf("failed to export runs: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	if runExportOpts.output != "" {
+		f, err := os.Create(runExportOpts.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return errors.Errorf("failed to write export: %v", err)
+	}
+
+	return nil
+}
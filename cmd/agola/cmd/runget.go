@@ -0,0 +1,54 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunGet = &cobra.Command{
+	Use:   "get <runref>",
+	Short: "get a run",
+	Long: `get a run
+
+The run can be referenced by its id or by the project id or full path followed by the project run number (i.e. org/myorg/myproject#142).
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runGet(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdRun.AddCommand(cmdRunGet)
+}
+
+func runGet(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	run, err := getRunDetails(gwclient, args[0])
+	if err != nil {
+		return errors.Errorf("failed to get run %q: %w", args[0], err)
+	}
+
+	printRuns([]*runDetails{run})
+
+	return nil
+}
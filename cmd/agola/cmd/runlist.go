@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"path"
 	"sort"
+	"strings"
+	"time"
 
 	gwapitypes "agola.io/agola/services/gateway/api/types"
 	gwclient "agola.io/agola/services/gateway/client"
@@ -40,6 +42,7 @@ var cmdRunList = &cobra.Command{
 type runListOptions struct {
 	projectRef  string
 	phaseFilter []string
+	tagFilter   []string
 	limit       int
 	start       string
 }
@@ -63,6 +66,7 @@ func init() {
 
 	flags.StringVar(&runListOpts.projectRef, "project", "", "project id or full path")
 	flags.StringSliceVarP(&runListOpts.phaseFilter, "phase", "s", nil, "filter runs matching the provided phase. This option can be repeated multiple times")
+	flags.StringSliceVar(&runListOpts.tagFilter, "tag", nil, "filter runs having the provided tag. This option can be repeated multiple times (the runs must have all the tags)")
 	flags.IntVar(&runListOpts.limit, "limit", 10, "max number of runs to show")
 	flags.StringVar(&runListOpts.start, "start", "", "starting run id (excluded) to fetch")
 
@@ -75,24 +79,77 @@ func init() {
 
 func printRuns(runs []*runDetails) {
 	for _, run := range runs {
-		fmt.Printf("%s: Phase: %s, Result: %s\n", run.runResponse.ID, run.runResponse.Phase, run.runResponse.Result)
+		fmt.Printf("%s: Number: %d, Phase: %s, Result: %s\n", run.runResponse.ID, run.runResponse.Counter, run.runResponse.Phase, run.runResponse.Result)
+		if t := run.runResponse.Trigger; t != nil && t.CommitSHA != "" {
+			fmt.Printf("\tCommit: %s\n", formatCommit(t))
+		}
+		if len(run.runResponse.Tags) > 0 {
+			fmt.Printf("\tTags: %s\n", strings.Join(run.runResponse.Tags, ", "))
+		}
+		if r := run.runResponse.NoRunsReason; r != "" {
+			fmt.Printf("\tNo runs created: %s\n", r)
+		}
+		if run.runResponse.SchedulingPaused {
+			fmt.Printf("\tScheduling paused: the run will continue when the scheduling is resumed\n")
+		}
+		if run.runResponse.QueuePosition > 0 {
+			if st := run.runResponse.QueueEstimatedStartTime; st != nil {
+				fmt.Printf("\tQueue position: %d, Estimated start time: %s\n", run.runResponse.QueuePosition, st.Format(time.RFC3339))
+			} else {
+				fmt.Printf("\tQueue position: %d\n", run.runResponse.QueuePosition)
+			}
+		}
 		for _, task := range run.tasks {
 			fmt.Printf("\tTaskName: %s, TaskID: %s, Status: %s\n", task.runTaskResponse.Name, task.runTaskResponse.ID, task.runTaskResponse.Status)
 			if task.retrieveError != nil {
 				fmt.Printf("\t\tfailed to retrieve task information: %v\n", task.retrieveError)
 			} else {
+				if e := task.runTaskResponse.FailError; e != "" {
+					fmt.Printf("\t\tFail error: %s\n", e)
+				}
+				if u := task.runTaskResponse.ResourceUsage; u != nil {
+					fmt.Printf("\t\t%s\n", formatResourceUsage(u))
+				}
+				if r := task.runTaskResponse.StopResult; r != "" {
+					fmt.Printf("\t\tStop result: %s\n", r)
+				}
+				if p := task.runTaskResponse.ImagePull; p != nil {
+					fmt.Printf("\t\t%s\n", formatImagePull(p))
+				}
 				for n, step := range task.runTaskResponse.Steps {
 					if step.Phase.IsFinished() && step.Type == "run" {
 						fmt.Printf("\t\tStep: %d, Name: %s, Type: %s, Phase: %s, ExitStatus: %d\n", n, step.Name, step.Type, step.Phase, *step.ExitStatus)
 					} else {
 						fmt.Printf("\t\tStep: %d, Name: %s, Type: %s, Phase: %s\n", n, step.Name, step.Type, step.Phase)
 					}
+					if u := step.ResourceUsage; u != nil {
+						fmt.Printf("\t\t\t%s\n", formatResourceUsage(u))
+					}
 				}
 			}
 		}
 	}
 }
 
+func formatCommit(t *gwapitypes.RunTriggerResponse) string {
+	s := t.CommitSHA
+	if t.CommitMessage != "" {
+		s += " " + t.CommitMessage
+	}
+	if t.CommitAuthorName != "" || t.CommitAuthorEmail != "" {
+		s += fmt.Sprintf(" (%s <%s>)", t.CommitAuthorName, t.CommitAuthorEmail)
+	}
+	return s
+}
+
+func formatResourceUsage(u *gwapitypes.RunTaskResponseResourceUsage) string {
+	return fmt.Sprintf("Peak CPU: %.2f cores, Peak Memory: %.1f MiB, Average CPU: %.2f cores, Average Memory: %.1f MiB", u.CPUPeak, float64(u.MemoryPeak)/(1<<20), u.CPUAverage, float64(u.MemoryAverage)/(1<<20))
+}
+
+func formatImagePull(p *gwapitypes.RunTaskResponseImagePull) string {
+	return fmt.Sprintf("Image: %s, Cache hit: %t, Pulled: %.1f MiB (%d layers, %d cached), Pull duration: %s", p.Image, p.CacheHit, float64(p.PulledBytes)/(1<<20), p.PulledLayers, p.CachedLayers, p.Duration)
+}
+
 func runList(cmd *cobra.Command, args []string) error {
 	gwclient := gwclient.NewClient(gatewayURL, token)
 
@@ -101,44 +158,54 @@ func runList(cmd *cobra.Command, args []string) error {
 		return errors.Errorf("failed to get project %s: %v", runListOpts.projectRef, err)
 	}
 	groups := []string{path.Join("/project", project.ID)}
-	runsResp, _, err := gwclient.GetRuns(context.TODO(), runListOpts.phaseFilter, nil, groups, nil, runListOpts.start, runListOpts.limit, false)
+	runsResp, _, err := gwclient.GetRuns(context.TODO(), runListOpts.phaseFilter, nil, runListOpts.tagFilter, groups, nil, runListOpts.start, runListOpts.limit, false)
 	if err != nil {
 		return err
 	}
 
 	runs := make([]*runDetails, len(runsResp))
 	for i, runResponse := range runsResp {
-		run, _, err := gwclient.GetRun(context.TODO(), runResponse.ID)
+		run, err := getRunDetails(gwclient, runResponse.ID)
 		if err != nil {
 			return err
 		}
+		runs[i] = run
+	}
 
-		tasks := []*taskDetails{}
-		for _, task := range run.Tasks {
-			runTaskResponse, _, err := gwclient.GetRunTask(context.TODO(), run.ID, task.ID)
-			t := &taskDetails{
-				name:            task.Name,
-				level:           task.Level,
-				runTaskResponse: runTaskResponse,
-				retrieveError:   err,
-			}
-			tasks = append(tasks, t)
-		}
+	printRuns(runs)
 
-		sort.Slice(tasks, func(i, j int) bool {
-			if tasks[i].level != tasks[j].level {
-				return tasks[i].level < tasks[j].level
-			}
-			return tasks[i].name < tasks[j].name
-		})
+	return nil
+}
+
+// getRunDetails fetches the run with the provided run ref and all of its
+// tasks
+func getRunDetails(gwclient *gwclient.Client, runRef string) (*runDetails, error) {
+	run, _, err := gwclient.GetRun(context.TODO(), runRef)
+	if err != nil {
+		return nil, err
+	}
 
-		runs[i] = &runDetails{
-			runResponse: run,
-			tasks:       tasks,
+	tasks := []*taskDetails{}
+	for _, task := range run.Tasks {
+		runTaskResponse, _, err := gwclient.GetRunTask(context.TODO(), run.ID, task.ID)
+		t := &taskDetails{
+			name:            task.Name,
+			level:           task.Level,
+			runTaskResponse: runTaskResponse,
+			retrieveError:   err,
 		}
+		tasks = append(tasks, t)
 	}
 
-	printRuns(runs)
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].level != tasks[j].level {
+			return tasks[i].level < tasks[j].level
+		}
+		return tasks[i].name < tasks[j].name
+	})
 
-	return nil
+	return &runDetails{
+		runResponse: run,
+		tasks:       tasks,
+	}, nil
 }
@@ -0,0 +1,180 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRunPreview = &cobra.Command{
+	Use:   "preview",
+	Short: "preview the runs that would be created at a git ref",
+	Long: `preview the runs that would be created at a git ref
+
+The project config is fetched at the provided ref (and commit) and evaluated like when creating the runs, but no run is created. The resolved runs, tasks and steps are reported with the result of their when conditions.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runPreview(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type runPreviewOptions struct {
+	projectRef string
+	branch     string
+	tag        string
+	ref        string
+	commitSHA  string
+	json       bool
+}
+
+var runPreviewOpts runPreviewOptions
+
+func init() {
+	flags := cmdRunPreview.Flags()
+
+	flags.StringVar(&runPreviewOpts.projectRef, "project", "", "project id or full path")
+	flags.StringVar(&runPreviewOpts.branch, "branch", "", "git branch")
+	flags.StringVar(&runPreviewOpts.tag, "tag", "", "git tag")
+	flags.StringVar(&runPreviewOpts.ref, "ref", "", "git ref")
+	flags.StringVar(&runPreviewOpts.commitSHA, "commit-sha", "", "git commit sha")
+	flags.BoolVar(&runPreviewOpts.json, "json", false, "print the preview as json")
+
+	if err := cmdRunPreview.MarkFlagRequired("project"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunPreview)
+}
+
+func runPreview(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	flags := cmd.Flags()
+	set := 0
+	if flags.Changed("branch") {
+		set++
+	}
+	if flags.Changed("tag") {
+		set++
+	}
+	if flags.Changed("ref") {
+		set++
+	}
+	if set != 1 {
+		return fmt.Errorf(`one of "--branch", "--tag" or "--ref" must be provided`)
+	}
+
+	preview, _, err := gwclient.ProjectPreviewRun(context.TODO(), runPreviewOpts.projectRef, runPreviewOpts.branch, runPreviewOpts.tag, runPreviewOpts.ref, runPreviewOpts.commitSHA)
+	if err != nil {
+		return err
+	}
+
+	if runPreviewOpts.json {
+		out, err := json.MarshalIndent(preview, "", "\t")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+		return nil
+	}
+
+	printRunPreview(preview)
+
+	return nil
+}
+
+func printRunPreview(preview *gwapitypes.RunPreviewResponse) {
+	fmt.Printf("commit: %s\n", preview.CommitSHA)
+
+	for _, run := range preview.Runs {
+		fmt.Printf("\nrun %q", run.Name)
+		if run.Skip {
+			fmt.Printf(" (skipped: %s)\n", run.SkipReason)
+			continue
+		}
+		fmt.Printf("\n")
+
+		for _, setupError := range run.SetupErrors {
+			fmt.Printf("  setup error: %s\n", setupError)
+		}
+
+		tasks := make([]*gwapitypes.RunPreviewTaskResponse, 0, len(run.Tasks))
+		for _, t := range run.Tasks {
+			tasks = append(tasks, t)
+		}
+		sort.Slice(tasks, func(i, j int) bool {
+			if tasks[i].Level != tasks[j].Level {
+				return tasks[i].Level < tasks[j].Level
+			}
+			return tasks[i].Name < tasks[j].Name
+		})
+
+		for _, t := range tasks {
+			attrs := []string{fmt.Sprintf("level %d", t.Level)}
+			if t.Skip {
+				attrs = append(attrs, "skipped")
+			}
+			if t.NeedsApproval {
+				attrs = append(attrs, "needs approval")
+			}
+			if t.IgnoreFailure {
+				attrs = append(attrs, "ignore failure")
+			}
+			if t.Always {
+				attrs = append(attrs, "always")
+			}
+			fmt.Printf("  task %q (%s)\n", t.Name, strings.Join(attrs, ", "))
+
+			fmt.Printf("    images: %s\n", strings.Join(t.Images, ", "))
+
+			depends := []string{}
+			for id, d := range t.Depends {
+				name := id
+				if pt, ok := run.Tasks[id]; ok {
+					name = pt.Name
+				}
+				conditions := make([]string, len(d.Conditions))
+				for i, c := range d.Conditions {
+					conditions[i] = string(c)
+				}
+				depends = append(depends, fmt.Sprintf("%s [%s]", name, strings.Join(conditions, ", ")))
+			}
+			sort.Strings(depends)
+			if len(depends) > 0 {
+				fmt.Printf("    depends: %s\n", strings.Join(depends, ", "))
+			}
+
+			for _, s := range t.Steps {
+				fmt.Printf("    step %s %q", s.Type, s.Name)
+				if s.Skip {
+					fmt.Printf(" (skipped)")
+				}
+				fmt.Printf("\n")
+			}
+		}
+	}
+}
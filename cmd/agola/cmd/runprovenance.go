@@ -0,0 +1,64 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRunProvenance = &cobra.Command{
+	Use:   "provenance <runref>",
+	Short: "get the signed SLSA provenance of a successful run",
+	Long: `get the signed SLSA provenance of a successful run
+
+The provenance is an in-toto statement, wrapped in a DSSE envelope, listing the run source commit and the task images, with the image digests when recorded by the executor. It's signed with the tasks id tokens signing key, the verification keys are published by the gateway at /.well-known/jwks.json.
+
+The provenance subjects are the artifacts built by the run. They are reported by the run tasks setting outputs starting with "provenance_subject" in the name@algorithm:digest format (i.e. provenance_subject_app=myapp.tar.gz@sha256:...).
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runProvenance(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdRun.AddCommand(cmdRunProvenance)
+}
+
+func runProvenance(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	provenance, _, err := gwclient.GetRunProvenance(context.TODO(), args[0])
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(provenance, "", "\t")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(out)
+	os.Stdout.Write([]byte("\n"))
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"strings"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunRestart = &cobra.Command{
+	Use: "restart",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runRestart(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "restart a run, optionally overriding some environment variables",
+}
+
+type runRestartOptions struct {
+	runID     string
+	fromStart bool
+	fromTask  string
+	envs      []string
+	debugHold bool
+}
+
+var runRestartOpts runRestartOptions
+
+func init() {
+	flags := cmdRunRestart.Flags()
+
+	flags.StringVar(&runRestartOpts.runID, "runid", "", "Run Id")
+	flags.BoolVar(&runRestartOpts.fromStart, "fromstart", false, "restart the run from the start instead of from the failed tasks")
+	flags.StringVar(&runRestartOpts.fromTask, "from-task", "", "restart the run from the named task, executing it and its childs again and reusing the results of the other successful tasks")
+	flags.StringArrayVar(&runRestartOpts.envs, "env", []string{}, "environment variable overridden in the restarted run in the format name=value (can be repeated)")
+	flags.BoolVar(&runRestartOpts.debugHold, "debug-hold", false, "keep the pods of the failed tasks running for a while to debug them (only admins and the run author)")
+
+	if err := cmdRunRestart.MarkFlagRequired("runid"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunRestart)
+}
+
+func runRestart(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	if runRestartOpts.fromStart && runRestartOpts.fromTask != "" {
+		return errors.Errorf("only one of --fromstart or --from-task could be provided")
+	}
+
+	env := map[string]string{}
+	for _, e := range runRestartOpts.envs {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Errorf("invalid environment variable %q, must be in the format name=value", e)
+		}
+		env[parts[0]] = parts[1]
+	}
+
+	req := &gwapitypes.RunActionsRequest{
+		ActionType:  gwapitypes.RunActionTypeRestart,
+		FromStart:   runRestartOpts.fromStart,
+		FromTask:    runRestartOpts.fromTask,
+		Environment: env,
+		DebugHold:   runRestartOpts.debugHold,
+	}
+	run, _, err := gwclient.RunActions(context.TODO(), runRestartOpts.runID, req)
+	if err != nil {
+		return errors.Errorf("failed to restart run: %w", err)
+	}
+	log.Infof("run %s restarted as run %s", runRestartOpts.runID, run.ID)
+
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdRunSetTags = &cobra.Command{
+	Use: "settags",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runSetTags(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+	Short: "replace the tags of a run",
+}
+
+type runSetTagsOptions struct {
+	runID string
+	tags  []string
+}
+
+var runSetTagsOpts runSetTagsOptions
+
+func init() {
+	flags := cmdRunSetTags.Flags()
+
+	flags.StringVar(&runSetTagsOpts.runID, "runid", "", "Run Id")
+	flags.StringSliceVar(&runSetTagsOpts.tags, "tag", nil, "run tag. This option can be repeated multiple times. When not provided the run tags are removed")
+
+	if err := cmdRunSetTags.MarkFlagRequired("runid"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunSetTags)
+}
+
+func runSetTags(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	req := &gwapitypes.RunActionsRequest{
+		ActionType: gwapitypes.RunActionTypeSetTags,
+		Tags:       runSetTagsOpts.tags,
+	}
+	if _, _, err := gwclient.RunActions(context.TODO(), runSetTagsOpts.runID, req); err != nil {
+		return errors.Errorf("failed to set run tags: %w", err)
+	}
+
+	return nil
+}
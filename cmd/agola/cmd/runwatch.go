@@ -0,0 +1,203 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	runWatchPollInterval = 2 * time.Second
+
+	// run watch exit codes
+	runWatchExitCodeSuccess   = 0
+	runWatchExitCodeFailed    = 1
+	runWatchExitCodeCancelled = 2
+	runWatchExitCodeTimeout   = 3
+)
+
+var cmdRunWatch = &cobra.Command{
+	Use:   "watch",
+	Short: "watch a run until it finishes",
+	Long: `watch a run until it finishes
+
+The command reports the run tasks status changes and exits when the run finishes with one of these exit codes:
+
+0: the run succeeded
+1: the run failed (or the command failed)
+2: the run was cancelled or stopped
+3: the timeout expired before the run finished
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		exitCode, err := runWatch(cmd, args)
+		if err != nil {
+			log.Fatalf("err: %v", err)
+		}
+		os.Exit(exitCode)
+	},
+}
+
+type runWatchOptions struct {
+	runID   string
+	timeout time.Duration
+}
+
+var runWatchOpts runWatchOptions
+
+func init() {
+	flags := cmdRunWatch.Flags()
+
+	flags.StringVar(&runWatchOpts.runID, "runid", "", "Run Id")
+	flags.DurationVar(&runWatchOpts.timeout, "timeout", 0, "max time to wait for the run to finish (i.e. 10m, 1h). Defaults to no timeout")
+
+	if err := cmdRunWatch.MarkFlagRequired("runid"); err != nil {
+		log.Fatal(err)
+	}
+
+	cmdRun.AddCommand(cmdRunWatch)
+}
+
+func runWatch(cmd *cobra.Command, args []string) (int, error) {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	return watchRuns(context.TODO(), gwclient, []string{runWatchOpts.runID}, runWatchOpts.timeout)
+}
+
+// watchRuns waits for all the provided runs to finish, printing their tasks
+// status changes, and returns the exit code matching the runs results. A
+// failed run has precedence over a cancelled or stopped run.
+func watchRuns(ctx context.Context, gwclient *gwclient.Client, runIDs []string, timeout time.Duration) (int, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// last seen tasks status by run id and task id
+	tasksStatus := map[string]map[string]rstypes.RunTaskStatus{}
+	runs := map[string]*gwapitypes.RunResponse{}
+
+	for {
+		for _, runID := range runIDs {
+			if run, ok := runs[runID]; ok && runFinished(run) {
+				continue
+			}
+
+			run, _, err := gwclient.GetRun(ctx, runID)
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return runWatchExitCodeFailed, errors.Errorf("failed to get run %q: %w", runID, err)
+			}
+			runs[runID] = run
+
+			if _, ok := tasksStatus[runID]; !ok {
+				tasksStatus[runID] = map[string]rstypes.RunTaskStatus{}
+			}
+			printRunTasksStatusChanges(run, tasksStatus[runID])
+
+			if runFinished(run) {
+				fmt.Printf("run %s (%s): %s\n", run.Name, run.ID, runStatus(run))
+			}
+		}
+
+		finished := 0
+		for _, run := range runs {
+			if runFinished(run) {
+				finished++
+			}
+		}
+		if finished == len(runIDs) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Printf("timeout waiting for %d runs to finish\n", len(runIDs)-finished)
+			return runWatchExitCodeTimeout, nil
+		case <-time.After(runWatchPollInterval):
+		}
+	}
+
+	exitCode := runWatchExitCodeSuccess
+	for _, run := range runs {
+		switch {
+		case run.Phase == rstypes.RunPhaseSetupError || run.Result == rstypes.RunResultFailed:
+			exitCode = runWatchExitCodeFailed
+		case run.Phase == rstypes.RunPhaseCancelled || run.Result == rstypes.RunResultStopped:
+			if exitCode != runWatchExitCodeFailed {
+				exitCode = runWatchExitCodeCancelled
+			}
+		}
+	}
+
+	return exitCode, nil
+}
+
+func runFinished(run *gwapitypes.RunResponse) bool {
+	if !run.Phase.IsFinished() {
+		return false
+	}
+	// wait for the run result to be set
+	return run.Phase != rstypes.RunPhaseFinished || run.Result.IsSet()
+}
+
+func runStatus(run *gwapitypes.RunResponse) string {
+	if run.Phase == rstypes.RunPhaseFinished {
+		return string(run.Result)
+	}
+	return string(run.Phase)
+}
+
+func printRunTasksStatusChanges(run *gwapitypes.RunResponse, tasksStatus map[string]rstypes.RunTaskStatus) {
+	tasks := make([]*gwapitypes.RunResponseTask, 0, len(run.Tasks))
+	for _, task := range run.Tasks {
+		tasks = append(tasks, task)
+	}
+	// report the status changes in a stable order
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Level != tasks[j].Level {
+			return tasks[i].Level < tasks[j].Level
+		}
+		return tasks[i].Name < tasks[j].Name
+	})
+
+	for _, task := range tasks {
+		status := task.Status
+		if task.WaitingApproval {
+			status = "waiting approval"
+		}
+		if status == rstypes.RunTaskStatusNotStarted && task.WaitingExecutorReason != "" {
+			status = rstypes.RunTaskStatus("waiting executor: " + task.WaitingExecutorReason)
+		}
+		if lastStatus, ok := tasksStatus[task.ID]; ok && lastStatus == status {
+			continue
+		}
+		tasksStatus[task.ID] = status
+		fmt.Printf("run %s (%s) task %s: %s\n", run.Name, run.ID, task.Name, status)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdSchedulingPause = &cobra.Command{
+	Use:   "pause",
+	Short: "pause the scheduling",
+	Long: `pause the scheduling
+
+While the scheduling is paused the new runs are queued and the running runs don't start new tasks (the already started tasks continue their execution). The scheduling restarts when resumed.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := schedulingPause(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+type schedulingPauseOptions struct {
+	reason string
+}
+
+var schedulingPauseOpts schedulingPauseOptions
+
+func init() {
+	flags := cmdSchedulingPause.Flags()
+
+	flags.StringVar(&schedulingPauseOpts.reason, "reason", "", "pause reason reported to the users")
+
+	cmdScheduling.AddCommand(cmdSchedulingPause)
+}
+
+func schedulingPause(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	req := &gwapitypes.SchedulingPauseRequest{
+		Reason: schedulingPauseOpts.reason,
+	}
+
+	log.Infof("pausing scheduling")
+	if _, err := gwclient.PauseScheduling(context.TODO(), req); err != nil {
+		return errors.Errorf("failed to pause scheduling: %w", err)
+	}
+	log.Infof("scheduling paused")
+
+	return nil
+}
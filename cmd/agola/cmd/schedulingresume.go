@@ -0,0 +1,50 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdSchedulingResume = &cobra.Command{
+	Use:   "resume",
+	Short: "resume the scheduling",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := schedulingResume(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdScheduling.AddCommand(cmdSchedulingResume)
+}
+
+func schedulingResume(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	log.Infof("resuming scheduling")
+	if _, err := gwclient.ResumeScheduling(context.TODO()); err != nil {
+		return errors.Errorf("failed to resume scheduling: %w", err)
+	}
+	log.Infof("scheduling resumed")
+
+	return nil
+}
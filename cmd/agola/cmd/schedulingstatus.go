@@ -0,0 +1,64 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	gwclient "agola.io/agola/services/gateway/client"
+
+	"github.com/spf13/cobra"
+	errors "golang.org/x/xerrors"
+)
+
+var cmdSchedulingStatus = &cobra.Command{
+	Use:   "status",
+	Short: "show the scheduling status",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := schedulingStatus(cmd, args); err != nil {
+			log.Fatalf("err: %v", err)
+		}
+	},
+}
+
+func init() {
+	cmdScheduling.AddCommand(cmdSchedulingStatus)
+}
+
+func schedulingStatus(cmd *cobra.Command, args []string) error {
+	gwclient := gwclient.NewClient(gatewayURL, token)
+
+	status, _, err := gwclient.GetSchedulingStatus(context.TODO())
+	if err != nil {
+		return errors.Errorf("failed to get scheduling status: %w", err)
+	}
+
+	if !status.Paused {
+		fmt.Printf("scheduling active\n")
+		return nil
+	}
+
+	fmt.Printf("scheduling paused\n")
+	if status.PausedAt != nil {
+		fmt.Printf("paused at: %s, reason: %s\n", status.PausedAt.Format(time.RFC3339), status.Reason)
+	}
+	if status.Window != "" {
+		fmt.Printf("active pause window: %s\n", status.Window)
+	}
+
+	return nil
+}
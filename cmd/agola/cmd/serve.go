@@ -17,6 +17,10 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"agola.io/agola/cmd"
 	"agola.io/agola/internal/services/config"
@@ -28,6 +32,7 @@ import (
 	"agola.io/agola/internal/services/notification"
 	rsscheduler "agola.io/agola/internal/services/runservice"
 	"agola.io/agola/internal/services/scheduler"
+	"agola.io/agola/internal/tracing"
 	"agola.io/agola/internal/util"
 
 	"github.com/spf13/cobra"
@@ -134,6 +139,10 @@ func serve(cmd *cobra.Command, args []string) error {
 		return errors.Errorf("config error: %w", err)
 	}
 
+	if err := tracing.Setup(ctx, logger, &c.Tracing); err != nil {
+		return errors.Errorf("failed to setup tracing: %w", err)
+	}
+
 	if serveOpts.embeddedEtcd {
 		if err := embeddedEtcd(ctx); err != nil {
 			return errors.Errorf("failed to start run service scheduler: %w", err)
@@ -196,6 +205,52 @@ func serve(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// reload the config on SIGHUP applying the changes that don't require a
+	// restart
+	sighupCh := make(chan os.Signal, 1)
+	signal.Notify(sighupCh, syscall.SIGHUP)
+	go func() {
+		for range sighupCh {
+			log.Infof("reloading config")
+			nc, err := config.Parse(serveOpts.config, serveOpts.components)
+			if err != nil {
+				log.Errorf("failed to reload config: %v", err)
+				continue
+			}
+			changes, err := config.RestartRequiredChanges(c, nc, serveOpts.components)
+			if err != nil {
+				log.Errorf("failed to reload config: %v", err)
+				continue
+			}
+			if len(changes) > 0 {
+				log.Warnf("the config changes to %s require a restart and won't be applied", strings.Join(changes, ", "))
+			}
+
+			if rs != nil {
+				rs.Reload(&nc.Runservice)
+			}
+			if ex != nil {
+				ex.Reload(&nc.Executor)
+			}
+			if cs != nil {
+				cs.Reload(&nc.Configstore)
+			}
+			if sched != nil {
+				sched.Reload(&nc.Scheduler)
+			}
+			if ns != nil {
+				ns.Reload(nc)
+			}
+			if gw != nil {
+				gw.Reload(nc)
+			}
+			if gs != nil {
+				gs.Reload(&nc.Gitserver)
+			}
+			log.Infof("config reloaded")
+		}
+	}()
+
 	errCh := make(chan error)
 
 	if rs != nil {
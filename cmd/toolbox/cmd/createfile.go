@@ -31,7 +31,8 @@ var cmdCreateFile = &cobra.Command{
 }
 
 type createFileOptions struct {
-	user string
+	user   string
+	suffix string
 }
 
 var createFileOpts createFileOptions
@@ -40,18 +41,19 @@ func init() {
 	flags := cmdCreateFile.PersistentFlags()
 
 	flags.StringVar(&createFileOpts.user, "user", "", "file owner")
+	flags.StringVar(&createFileOpts.suffix, "suffix", "", "file name suffix (i.e. an extension required to execute it)")
 
 	CmdToolbox.AddCommand(cmdCreateFile)
 }
 
-func createFile(r io.Reader) (string, error) {
+func createFile(r io.Reader, suffix string) (string, error) {
 	// create a temp dir if the image doesn't have one
 	tmpDir := os.TempDir()
 	if err := os.MkdirAll(tmpDir, 0777); err != nil {
 		return "", fmt.Errorf("failed to create tmp dir %q", tmpDir)
 	}
 
-	file, err := ioutil.TempFile("", "")
+	file, err := ioutil.TempFile("", "*"+suffix)
 	if err != nil {
 		return "", err
 	}
@@ -67,7 +69,7 @@ func createFile(r io.Reader) (string, error) {
 }
 
 func createFileRun(cmd *cobra.Command, args []string) {
-	filename, err := createFile(os.Stdin)
+	filename, err := createFile(os.Stdin, createFileOpts.suffix)
 	if err != nil {
 		log.Fatalf("failed to write file: %v", err)
 	}
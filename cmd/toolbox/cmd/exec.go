@@ -17,10 +17,12 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
-	"syscall"
+	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -40,6 +42,8 @@ var cmdExec = &cobra.Command{
 type execOptions struct {
 	env        string
 	workingDir string
+	pidFile    string
+	ulimits    []string
 }
 
 var execOpts execOptions
@@ -49,6 +53,8 @@ func init() {
 
 	flags.StringVarP(&execOpts.workingDir, "workingdir", "w", "", "working directory")
 	flags.StringVarP(&execOpts.env, "env", "e", "", "environment (as json object)")
+	flags.StringVar(&execOpts.pidFile, "pid-file", "", "file where the process pid is written. The process will also become the leader of a new process group")
+	flags.StringSliceVar(&execOpts.ulimits, "ulimit", []string{}, "process resource limit in the format name=soft:hard (can be repeated)")
 
 	CmdToolbox.AddCommand(cmdExec)
 }
@@ -75,11 +81,59 @@ func execRun(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	for _, u := range execOpts.ulimits {
+		if err := applyUlimit(u); err != nil {
+			log.Fatalf("failed to set ulimit %q: %v", u, err)
+		}
+	}
+
+	if execOpts.pidFile != "" {
+		if err := writePidFile(execOpts.pidFile); err != nil {
+			log.Fatalf("failed to write pid file: %v", err)
+		}
+	}
+
 	p, err := exec.LookPath(args[0])
 	if err != nil {
 		log.Fatalf("failed to find executable %q: %v", args[0], err)
 	}
-	if err := syscall.Exec(p, args, env); err != nil {
+	if err := execve(p, args, env); err != nil {
 		log.Fatalf("failed to exec: %v", err)
 	}
 }
+
+// applyUlimit sets the ulimit in the format name=soft:hard
+func applyUlimit(u string) error {
+	parts := strings.SplitN(u, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("wrong ulimit format")
+	}
+	values := strings.SplitN(parts[1], ":", 2)
+	if len(values) != 2 {
+		return fmt.Errorf("wrong ulimit format")
+	}
+	soft, err := strconv.ParseUint(values[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("wrong soft limit: %v", err)
+	}
+	hard, err := strconv.ParseUint(values[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("wrong hard limit: %v", err)
+	}
+	return setUlimit(parts[0], soft, hard)
+}
+
+// writePidFile makes the current process the leader of a new process group, so
+// it could be signaled with all its childs, and atomically writes its pid to
+// the provided file
+func writePidFile(pidFile string) error {
+	if err := newProcessGroup(); err != nil {
+		return err
+	}
+
+	tmpFile := pidFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, pidFile)
+}
@@ -0,0 +1,37 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"syscall"
+)
+
+// execve replaces the current process with the provided command
+func execve(p string, args, env []string) error {
+	return syscall.Exec(p, args, env)
+}
+
+// newProcessGroup makes the current process the leader of a new process group.
+// When the process is already a session leader (i.e. when executed with a tty)
+// it's already a process group leader.
+func newProcessGroup() error {
+	if err := syscall.Setpgid(0, 0); err != nil && err != syscall.EPERM {
+		return err
+	}
+	return nil
+}
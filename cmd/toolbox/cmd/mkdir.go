@@ -17,6 +17,7 @@ package cmd
 import (
 	"log"
 	"os"
+	"path/filepath"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -28,7 +29,17 @@ var cmdMkdir = &cobra.Command{
 	Short: "create the provided directories",
 }
 
+type mkdirOptions struct {
+	clean bool
+}
+
+var mkdirOpts mkdirOptions
+
 func init() {
+	flags := cmdMkdir.Flags()
+
+	flags.BoolVar(&mkdirOpts.clean, "clean", false, "remove the directories, if existing, before creating them")
+
 	CmdToolbox.AddCommand(cmdMkdir)
 }
 
@@ -43,6 +54,14 @@ func mkdirRun(cmd *cobra.Command, args []string) {
 		if err != nil {
 			log.Fatalf("failed to expand dir %q: %v", dir, err)
 		}
+		if mkdirOpts.clean {
+			if filepath.Clean(expDir) == "/" {
+				log.Fatalf("refusing to remove the root directory")
+			}
+			if err := os.RemoveAll(expDir); err != nil {
+				log.Fatalf("failed to remove directory %q: %v", expDir, err)
+			}
+		}
 		if err := os.MkdirAll(expDir, 0755); err != nil {
 			log.Fatalf("failed to create directory %q: %v", expDir, err)
 		}
@@ -0,0 +1,73 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdReadFile = &cobra.Command{
+	Use:   "readfile",
+	Run:   readFileRun,
+	Short: "writes the provided file content to stdout. A missing file is considered empty",
+}
+
+type readFileOptions struct {
+	maxSize int64
+}
+
+var readFileOpts readFileOptions
+
+func init() {
+	flags := cmdReadFile.PersistentFlags()
+
+	flags.Int64Var(&readFileOpts.maxSize, "max-size", 0, "fail if the file is bigger than the provided size in bytes (0 means no limit)")
+
+	CmdToolbox.AddCommand(cmdReadFile)
+}
+
+func readFileRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("one file name must be specified")
+	}
+	filename := args[0]
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		log.Fatalf("failed to open file %q: %v", filename, err)
+	}
+	defer f.Close()
+
+	if readFileOpts.maxSize > 0 {
+		fi, err := f.Stat()
+		if err != nil {
+			log.Fatalf("failed to stat file %q: %v", filename, err)
+		}
+		if fi.Size() > readFileOpts.maxSize {
+			log.Fatalf("file %q size %d exceeds the max size of %d bytes", filename, fi.Size(), readFileOpts.maxSize)
+		}
+	}
+
+	if _, err := io.Copy(os.Stdout, f); err != nil {
+		log.Fatalf("failed to read file %q: %v", filename, err)
+	}
+}
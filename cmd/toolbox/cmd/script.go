@@ -0,0 +1,121 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdScript = &cobra.Command{
+	Use:   "script",
+	Run:   scriptRun,
+	Short: "executes the provided script file using its shebang interpreter or the provided shell",
+}
+
+type scriptOptions struct {
+	shell string
+}
+
+var scriptOpts scriptOptions
+
+func init() {
+	flags := cmdScript.PersistentFlags()
+
+	flags.StringVar(&scriptOpts.shell, "shell", "/bin/sh -e", "shell used when the script doesn't define a shebang")
+
+	CmdToolbox.AddCommand(cmdScript)
+}
+
+func scriptRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("one script file must be provided")
+	}
+	script := args[0]
+
+	fi, err := os.Stat(script)
+	if err != nil {
+		if os.IsNotExist(err) {
+			log.Fatalf("script file %q doesn't exist", script)
+		}
+		log.Fatalf("failed to stat script file %q: %v", script, err)
+	}
+	if fi.IsDir() {
+		log.Fatalf("script file %q is a directory", script)
+	}
+
+	interpreter, err := scriptInterpreter(script)
+	if err != nil {
+		log.Fatalf("failed to read script file %q: %v", script, err)
+	}
+	if len(interpreter) == 0 {
+		interpreter = strings.Fields(scriptOpts.shell)
+	}
+	if len(interpreter) == 0 {
+		log.Fatalf("empty shell")
+	}
+
+	p, err := exec.LookPath(interpreter[0])
+	if err != nil {
+		log.Fatalf("failed to find executable %q: %v", interpreter[0], err)
+	}
+
+	// execute the interpreter with the script as argument so the script file
+	// doesn't need to be executable
+	args = append(interpreter, script)
+	if err := execve(p, args, os.Environ()); err != nil {
+		log.Fatalf("failed to exec: %v", err)
+	}
+}
+
+// scriptInterpreter returns the interpreter and its optional argument defined
+// in the script shebang or nil if the script doesn't start with a shebang.
+func scriptInterpreter(script string) ([]string, error) {
+	f, err := os.Open(script)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return nil, nil
+	}
+	line = strings.TrimSpace(strings.TrimPrefix(line, "#!"))
+	if line == "" {
+		return nil, nil
+	}
+
+	// like the linux kernel, everything after the interpreter is passed as a
+	// single argument
+	parts := strings.SplitN(line, " ", 2)
+	interpreter := []string{parts[0]}
+	if len(parts) > 1 {
+		if arg := strings.TrimSpace(parts[1]); arg != "" {
+			interpreter = append(interpreter, arg)
+		}
+	}
+
+	return interpreter, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// signalExitCodeTimeout is the exit code used when some processes are still
+// running after the grace period
+const signalExitCodeTimeout = 2
+
+var cmdSignal = &cobra.Command{
+	Use:   "signal",
+	Run:   signalRun,
+	Short: "sends a signal to all the container processes, or only to the process group of the process in the pid file, and waits for them to exit",
+}
+
+type signalOptions struct {
+	signal      string
+	gracePeriod time.Duration
+	pidFile     string
+}
+
+var signalOpts signalOptions
+
+func init() {
+	flags := cmdSignal.PersistentFlags()
+
+	flags.StringVar(&signalOpts.signal, "signal", "SIGTERM", "signal to send")
+	flags.DurationVar(&signalOpts.gracePeriod, "grace-period", 10*time.Second, "time to wait for the processes to exit")
+	flags.StringVar(&signalOpts.pidFile, "pid-file", "", "file containing the pid of the process group leader to signal")
+
+	CmdToolbox.AddCommand(cmdSignal)
+}
+
+func signalRun(cmd *cobra.Command, args []string) {
+	sig, ok := signals[signalOpts.signal]
+	if !ok {
+		log.Fatalf("unsupported signal %q", signalOpts.signal)
+	}
+
+	deadline := time.Now().Add(signalOpts.gracePeriod)
+
+	signalFn := signalProcesses
+	runningFn := processesRunning
+	if signalOpts.pidFile != "" {
+		pid, err := waitPidFile(signalOpts.pidFile, deadline)
+		if err != nil {
+			log.Printf("failed to read pid file: %v", err)
+			os.Exit(signalExitCodeTimeout)
+		}
+		signalFn = func(sig syscall.Signal) error { return signalProcessGroup(pid, sig) }
+		runningFn = func() (bool, error) { return processGroupRunning(pid) }
+	}
+
+	if err := signalFn(sig); err != nil {
+		log.Fatalf("failed to send signal %s: %v", signalOpts.signal, err)
+	}
+
+	for {
+		running, err := runningFn()
+		if err != nil {
+			log.Fatalf("failed to check running processes: %v", err)
+		}
+		if !running {
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Printf("processes still running after %s", signalOpts.gracePeriod)
+			os.Exit(signalExitCodeTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// waitPidFile waits for the pid file to be written until the deadline since
+// the process could be still starting
+func waitPidFile(pidFile string, deadline time.Time) (int, error) {
+	for {
+		data, err := ioutil.ReadFile(pidFile)
+		if err == nil {
+			return strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		if !os.IsNotExist(err) || time.Now().After(deadline) {
+			return 0, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"syscall"
+)
+
+// signals aren't supported on windows
+var signals = map[string]syscall.Signal{}
+
+func signalProcesses(sig syscall.Signal) error {
+	return errors.New("signals aren't supported on windows")
+}
+
+func processesRunning() (bool, error) {
+	return false, errors.New("signals aren't supported on windows")
+}
+
+func signalProcessGroup(pid int, sig syscall.Signal) error {
+	return errors.New("signals aren't supported on windows")
+}
+
+func processGroupRunning(pid int) (bool, error) {
+	return false, errors.New("signals aren't supported on windows")
+}
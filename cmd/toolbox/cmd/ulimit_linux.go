@@ -0,0 +1,41 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// rlimitResources maps the ulimit names to the linux rlimit resources. nproc
+// and memlock aren't defined by the syscall package.
+var rlimitResources = map[string]int{
+	"core":    syscall.RLIMIT_CORE,
+	"fsize":   syscall.RLIMIT_FSIZE,
+	"memlock": 8,
+	"nofile":  syscall.RLIMIT_NOFILE,
+	"nproc":   6,
+	"stack":   syscall.RLIMIT_STACK,
+}
+
+// setUlimit sets the provided resource limit of the current process. The
+// limit is inherited by the executed command.
+func setUlimit(name string, soft, hard uint64) error {
+	resource, ok := rlimitResources[name]
+	if !ok {
+		return fmt.Errorf("unknown ulimit %q", name)
+	}
+	return syscall.Setrlimit(resource, &syscall.Rlimit{Cur: soft, Max: hard})
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdWriteFile = &cobra.Command{
+	Use:   "writefile",
+	Run:   writeFileRun,
+	Short: "reads data from stdin and writes it to the provided file, optionally linking it at another path",
+}
+
+type writeFileOptions struct {
+	mode string
+	link string
+}
+
+var writeFileOpts writeFileOptions
+
+func init() {
+	flags := cmdWriteFile.PersistentFlags()
+
+	flags.StringVar(&writeFileOpts.mode, "mode", "600", "file permission mode (octal)")
+	flags.StringVar(&writeFileOpts.link, "link", "", "path of a symlink to the written file")
+
+	CmdToolbox.AddCommand(cmdWriteFile)
+}
+
+func writeFile(r io.Reader, filename string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	// set the mode also when the file already exists or it has been reduced
+	// by the umask
+	return os.Chmod(filename, mode)
+}
+
+func linkFile(filename, link string) error {
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		return err
+	}
+	// replace an existing file
+	if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(filename, link)
+}
+
+func writeFileRun(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		log.Fatalf("one file name must be specified")
+	}
+	filename := args[0]
+
+	mode, err := strconv.ParseUint(writeFileOpts.mode, 8, 32)
+	if err != nil {
+		log.Fatalf("invalid mode %q: %v", writeFileOpts.mode, err)
+	}
+
+	if err := writeFile(os.Stdin, filename, os.FileMode(mode)); err != nil {
+		log.Fatalf("failed to write file %q: %v", filename, err)
+	}
+
+	if writeFileOpts.link != "" {
+		if err := linkFile(filename, writeFileOpts.link); err != nil {
+			log.Fatalf("failed to link file %q to %q: %v", filename, writeFileOpts.link, err)
+		}
+	}
+}
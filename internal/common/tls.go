@@ -0,0 +1,80 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/util"
+
+	errors "golang.org/x/xerrors"
+)
+
+// NewTLSServerConfig returns the tls config of a component http server. It
+// returns nil when tls isn't enabled.
+func NewTLSServerConfig(c *config.Web) (*tls.Config, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+	tlsConfig, err := util.NewTLSServerConfig(c.TLSCertFile, c.TLSKeyFile, c.TLSClientCAFile, c.TLSRequireClientCert)
+	if err != nil {
+		return nil, errors.Errorf("failed to create tls config: %w", err)
+	}
+	return tlsConfig, nil
+}
+
+// ListenAndServe serves https when the server has a tls config, plain http
+// otherwise
+func ListenAndServe(s *http.Server) error {
+	if s.TLSConfig != nil {
+		// the certificate is provided by the tls config
+		return s.ListenAndServeTLS("", "")
+	}
+	return s.ListenAndServe()
+}
+
+// NewHTTPClient returns the http client used to connect to another agola
+// component using the provided tls config
+func NewHTTPClient(c *config.ClientTLS) (*http.Client, error) {
+	if c == nil {
+		return &http.Client{}, nil
+	}
+
+	tlsConfig, err := util.NewTLSClientConfig(c.CertFile, c.KeyFile, c.CAFile, c.SkipVerify)
+	if err != nil {
+		return nil, errors.Errorf("failed to create tls config: %w", err)
+	}
+
+	// copied from net/http until it has a clone function: https://github.com/golang/go/issues/26013
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -17,10 +17,14 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"path"
 	"regexp"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	itypes "agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/taskoutputs"
 	"agola.io/agola/internal/util"
 	"agola.io/agola/services/types"
 
@@ -83,9 +87,55 @@ type DockerRegistryAuth struct {
 }
 
 type Runtime struct {
-	Type       RuntimeType  `json:"type,omitempty"`
+	Type RuntimeType `json:"type,omitempty"`
+	// OS is the containers os. Defaults to linux
+	OS         types.OS     `json:"os,omitempty"`
 	Arch       types.Arch   `json:"arch,omitempty"`
 	Containers []*Container `json:"containers,omitempty"`
+	GPUs       *GPUs        `json:"gpus,omitempty"`
+	// InitContainers are executed sequentially, before the main container
+	// starts, sharing a volume with it. If one of them fails the task fails
+	// before executing its steps.
+	InitContainers []*Container `json:"init_containers,omitempty"`
+	// Docker, when defined, starts a docker daemon dedicated to the task. The
+	// task containers reach it using the DOCKER_HOST environment variable.
+	Docker *RuntimeDocker `json:"docker,omitempty"`
+	// Limits overrides the executor default process limits of the task
+	// containers. The executor rejects the task when raising a limit above the
+	// values it allows.
+	Limits *RuntimeLimits `json:"limits,omitempty"`
+}
+
+// RuntimeLimits defines the max number of processes (pids) and the ulimits,
+// keyed by name (i.e. nofile, nproc), of the task containers
+type RuntimeLimits struct {
+	Pids    int64              `json:"pids,omitempty"`
+	Ulimits map[string]*Ulimit `json:"ulimits,omitempty"`
+}
+
+type Ulimit struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+// RuntimeDocker defines a docker in docker daemon dedicated to a task, so the
+// images built by the task are isolated from the executor host and the other
+// tasks. Its storage is removed after the task unless Cache is true: in this
+// case the storage (images, build cache) is reused by the next tasks with the
+// same cache prefix executed on the same executor.
+type RuntimeDocker struct {
+	// Image is the docker daemon image. Defaults to the executor one
+	Image  string             `json:"image,omitempty"`
+	CPU    *resource.Quantity `json:"cpu,omitempty"`
+	Memory *resource.Quantity `json:"memory,omitempty"`
+	Cache  bool               `json:"cache,omitempty"`
+}
+
+// GPUs defines the gpus requested by a task. If Type is empty any gpu type
+// will be accepted
+type GPUs struct {
+	Count int    `json:"count,omitempty"`
+	Type  string `json:"type,omitempty"`
 }
 
 type Container struct {
@@ -94,7 +144,32 @@ type Container struct {
 	User        string           `json:"user"`
 	Privileged  bool             `json:"privileged"`
 	Entrypoint  string           `json:"entrypoint"`
-	Volumes     []Volume         `json:"volumes"`
+	// EntrypointArgs is populated when the entrypoint is defined as a list of
+	// arguments. They are passed as is to the container runtime without any
+	// splitting.
+	EntrypointArgs []string `json:"-"`
+	Volumes        []Volume `json:"volumes"`
+	// ShmSize is the size of the container /dev/shm. When not defined the
+	// container runtime default is used
+	ShmSize *resource.Quantity `json:"shm_size"`
+}
+
+func (c *Container) UnmarshalJSON(b []byte) error {
+	type container Container
+	cc := struct {
+		*container
+		Entrypoint interface{} `json:"entrypoint"`
+	}{container: (*container)(c)}
+	if err := json.Unmarshal(b, &cc); err != nil {
+		return err
+	}
+
+	var err error
+	c.Entrypoint, c.EntrypointArgs, err = parseCommand(cc.Entrypoint)
+	if err != nil {
+		return errors.Errorf("wrong entrypoint format: %w", err)
+	}
+	return nil
 }
 
 type Volume struct {
@@ -112,6 +187,58 @@ type Run struct {
 	Tasks                []*Task                        `json:"tasks"`
 	When                 *When                          `json:"when"`
 	DockerRegistriesAuth map[string]*DockerRegistryAuth `json:"docker_registries_auth"`
+
+	// Before steps are prepended to the steps of every task
+	Before Steps `json:"before"`
+	// After steps are appended to the steps of every task. They are executed
+	// also if a previous step failed.
+	After Steps `json:"after"`
+
+	// NetworkPolicy is the name of the executor network policy applied to the
+	// run tasks. It's ignored for untrusted runs.
+	NetworkPolicy string `json:"network_policy"`
+
+	// SecurityProfile is the name of the executor security profile (seccomp
+	// and apparmor profiles) applied to the run tasks. It's ignored for
+	// untrusted runs.
+	SecurityProfile string `json:"security_profile"`
+
+	// Depends are the names of the runs, defined before this one, that must
+	// successfully finish before this run is started
+	Depends []string `json:"depends"`
+
+	// Triggers are the projects whose runs are created with this run. They
+	// are started only when this run successfully finishes.
+	Triggers []*RunProjectTrigger `json:"triggers"`
+
+	// Labels are used, like the run name, to select the runs to create when
+	// a run creation (webhook or manual) requests only some of them
+	Labels []string `json:"labels"`
+
+	// Tags are added to the created runs and used to filter them (i.e.
+	// release, nightly)
+	Tags []string `json:"tags"`
+
+	// PreviewEnvironment makes the run, when created for a pull request,
+	// deploy or tear down a preview environment of the pull request
+	PreviewEnvironment *RunPreviewEnvironment `json:"preview_environment"`
+}
+
+// RunPreviewEnvironment defines the pull request preview environment managed
+// by a run. Runs deploying the environment register it when created, teardown
+// runs are created only when the pull request is closed and the environment
+// is active.
+type RunPreviewEnvironment struct {
+	Name     string `json:"name"`
+	Teardown bool   `json:"teardown"`
+}
+
+// RunProjectTrigger defines the runs of another project, at the provided
+// branch, triggered by a run
+type RunProjectTrigger struct {
+	// Project is the project ref (id or path)
+	Project string `json:"project"`
+	Branch  string `json:"branch"`
 }
 
 type Task struct {
@@ -127,6 +254,67 @@ type Task struct {
 	Approval             bool                           `json:"approval"`
 	When                 *When                          `json:"when"`
 	DockerRegistriesAuth map[string]*DockerRegistryAuth `json:"docker_registries_auth"`
+	// SkipHooks disables the run before and after steps for this task
+	SkipHooks bool `json:"skip_hooks"`
+	// Reports are the task reports (test results, coverage) parsed at the end
+	// of the task
+	Reports []*Report `json:"reports"`
+	// StopSignal is the signal sent to the task processes when the task is
+	// stopped (defaults to SIGTERM)
+	StopSignal string `json:"stop_signal"`
+	// StopGracePeriod is the time given to the task processes to exit after
+	// the stop signal before being killed
+	StopGracePeriod Duration `json:"stop_grace_period"`
+	// Files are written in the task main container before executing the
+	// steps. They're useful to provide credentials to tools that only read
+	// them from files.
+	Files []*TaskFile `json:"files"`
+	// Batch lets the task be executed in the pod of a previous batch task of
+	// the run with the same runtime instead of starting a new one. It's useful
+	// for small tasks where the pod startup dominates the task duration.
+	Batch bool `json:"batch"`
+	// Always makes the task, usually a cleanup task, be executed when all its
+	// dependencies are finished whatever their result, also when the run is
+	// stopped. Its failure doesn't change the run result.
+	Always bool `json:"always"`
+	// DeployEnvironment is the name of the project deploy environment targeted
+	// by the task. The task is executed only when the environment protection
+	// rules are satisfied.
+	DeployEnvironment string `json:"deploy_environment"`
+}
+
+// TaskFile is a file, usually with its content taken from a variable,
+// written in the task main container. The file is kept in a memory backed
+// volume and linked at the provided path.
+type TaskFile struct {
+	Path    string `json:"path"`
+	Content Value  `json:"content"`
+	// Mode is the file permission mode. Defaults to 0600.
+	Mode int `json:"mode"`
+}
+
+// stopSignals are the signals that could be used as task stop signal
+var stopSignals = map[string]struct{}{
+	"SIGTERM": {},
+	"SIGINT":  {},
+	"SIGQUIT": {},
+	"SIGHUP":  {},
+	"SIGUSR1": {},
+	"SIGUSR2": {},
+	"SIGKILL": {},
+}
+
+type ReportFormat string
+
+const (
+	ReportFormatJUnit     ReportFormat = "junit"
+	ReportFormatCobertura ReportFormat = "cobertura"
+)
+
+type Report struct {
+	Format ReportFormat `json:"format"`
+	// Path is the report file path pattern relative to the task working dir
+	Path string `json:"path"`
 }
 
 type DependCondition string
@@ -158,15 +346,53 @@ type CloneStep struct {
 	BaseStep          `json:",inline"`
 	Depth             *int `json:"depth"`
 	RecurseSubmodules bool `json:"recurse_submodules"`
+	// LFS, when defined, enables or disables the download of the git lfs
+	// files. When not defined the git defaults are used.
+	LFS *bool `json:"lfs"`
+	// FetchTags fetches all the repository tags. Useful with a shallow clone
+	// when the tags history is needed (i.e. git describe)
+	FetchTags bool `json:"fetch_tags"`
+	// SparsePaths, when defined, are the only paths checked out (using the git
+	// sparse checkout patterns)
+	SparsePaths []string `json:"sparse_paths"`
 }
 
 type RunStep struct {
-	BaseStep    `json:",inline"`
-	Command     string           `json:"command"`
+	BaseStep `json:",inline"`
+	Command  string `json:"command"`
+	// CommandArgs is populated when the command is defined as a list of
+	// arguments. The command will be executed as is (exec form) without being
+	// wrapped by a shell. Useful for images without a shell.
+	CommandArgs []string `json:"-"`
+	// Script is the path of a script file in the task working dir that will
+	// be executed in place of the command
+	Script      string           `json:"script"`
 	Environment map[string]Value `json:"environment,omitempty"`
 	WorkingDir  string           `json:"working_dir"`
 	Shell       string           `json:"shell"`
 	Tty         *bool            `json:"tty"`
+	// Background, when true, starts the command without waiting for it to
+	// exit. It will be kept running across the next steps until a
+	// wait_background step waits for or stops it or the task ends.
+	Background bool `json:"background"`
+}
+
+func (s *RunStep) UnmarshalJSON(b []byte) error {
+	type runStep RunStep
+	rs := struct {
+		*runStep
+		Command interface{} `json:"command"`
+	}{runStep: (*runStep)(s)}
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return err
+	}
+
+	var err error
+	s.Command, s.CommandArgs, err = parseCommand(rs.Command)
+	if err != nil {
+		return errors.Errorf("wrong command format: %w", err)
+	}
+	return nil
 }
 
 type SaveToWorkspaceStep struct {
@@ -191,6 +417,16 @@ type RestoreCacheStep struct {
 	DestDir  string   `json:"dest_dir"`
 }
 
+// WaitBackgroundStep waits for the background run steps to exit or, when stop
+// is true, stops them
+type WaitBackgroundStep struct {
+	BaseStep `json:",inline"`
+	// Steps are the names of the background steps. When empty all the
+	// background steps started before are used.
+	Steps []string `json:"steps"`
+	Stop  bool     `json:"stop"`
+}
+
 type SaveContent struct {
 	SourceDir string   `json:"source_dir"`
 	DestDir   string   `json:"dest_dir"`
@@ -273,6 +509,14 @@ func (s *Steps) UnmarshalJSON(b []byte) error {
 				}
 				s.Type = stepType
 				step = &s
+
+			case "wait_background":
+				var s WaitBackgroundStep
+				if err := json.Unmarshal(stepRaw, &s); err != nil {
+					return err
+				}
+				s.Type = stepType
+				step = &s
 			default:
 				return errors.Errorf("unknown step type: %s", stepType)
 			}
@@ -301,6 +545,12 @@ func (s *Steps) UnmarshalJSON(b []byte) error {
 					switch stepSpec := stepSpec.(type) {
 					case string:
 						s.Command = stepSpec
+					case []interface{}:
+						args, err := parseSliceString(stepSpec)
+						if err != nil {
+							return errors.Errorf("wrong command format: %w", err)
+						}
+						s.CommandArgs = args
 					default:
 						if err := json.Unmarshal(stepSpecRaw, &s); err != nil {
 							return err
@@ -340,6 +590,14 @@ func (s *Steps) UnmarshalJSON(b []byte) error {
 					}
 					s.Type = stepType
 					step = &s
+
+				case "wait_background":
+					var s WaitBackgroundStep
+					if err := json.Unmarshal(stepSpecRaw, &s); err != nil {
+						return err
+					}
+					s.Type = stepType
+					step = &s
 				default:
 					return errors.Errorf("unknown step type: %s", stepType)
 				}
@@ -463,6 +721,22 @@ func (val *Value) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// Duration is a duration defined as a string like "30s" or "2m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Errorf("wrong duration format: %s", b)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Errorf("wrong duration %q: %w", s, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
 type When types.When
 
 type when struct {
@@ -598,6 +872,25 @@ func parseWhenCondition(s string) (*types.WhenCondition, error) {
 	return wc, nil
 }
 
+// parseCommand parses a command defined as a string (shell form) or as a list
+// of arguments (exec form)
+func parseCommand(ci interface{}) (string, []string, error) {
+	switch c := ci.(type) {
+	case nil:
+		return "", nil, nil
+	case string:
+		return c, nil, nil
+	case []interface{}:
+		args, err := parseSliceString(c)
+		if err != nil {
+			return "", nil, err
+		}
+		return "", args, nil
+	default:
+		return "", nil, errors.Errorf("expected string or list of strings")
+	}
+}
+
 func parseStringOrSlice(si interface{}) ([]string, error) {
 	ss := []string{}
 	switch c := si.(type) {
@@ -635,6 +928,25 @@ func (c *Config) Run(runName string) *Run {
 	panic(fmt.Sprintf("run %q doesn't exists", runName))
 }
 
+// Selected reports if the run matches one of the provided selectors (run
+// names or labels). All the runs are selected when no selector is provided.
+func (r *Run) Selected(selectors []string) bool {
+	if len(selectors) == 0 {
+		return true
+	}
+	for _, s := range selectors {
+		if s == r.Name {
+			return true
+		}
+		for _, l := range r.Labels {
+			if s == l {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (r *Run) Task(taskName string) *Task {
 	for _, t := range r.Tasks {
 		if t.Name == taskName {
@@ -705,8 +1017,54 @@ func checkConfig(config *Config) error {
 		if _, ok := seenRuns[run.Name]; ok {
 			return errors.Errorf("duplicate run name: %s", run.Name)
 		}
+
+		// requiring the run dependencies to be defined before the run avoids
+		// circular dependencies
+		seenDepends := map[string]struct{}{}
+		for _, d := range run.Depends {
+			if _, ok := seenRuns[d]; !ok {
+				return errors.Errorf("run %q depends on run %q that must be defined before it", run.Name, d)
+			}
+			if _, ok := seenDepends[d]; ok {
+				return errors.Errorf("run %q: duplicate run dependency %q", run.Name, d)
+			}
+			seenDepends[d] = struct{}{}
+		}
 		seenRuns[run.Name] = struct{}{}
 
+		for i, trigger := range run.Triggers {
+			if trigger == nil {
+				return errors.Errorf("run %q: trigger %d is empty", run.Name, i)
+			}
+			if trigger.Project == "" {
+				return errors.Errorf("run %q: trigger %d project is empty", run.Name, i)
+			}
+			if trigger.Branch == "" {
+				return errors.Errorf("run %q: trigger %d branch is empty", run.Name, i)
+			}
+		}
+
+		for i, label := range run.Labels {
+			if label == "" {
+				return errors.Errorf("run %q: label %d is empty", run.Name, i)
+			}
+		}
+
+		for _, tag := range run.Tags {
+			if !util.ValidateTag(tag) {
+				return errors.Errorf("run %q: invalid tag %q", run.Name, tag)
+			}
+		}
+
+		if run.PreviewEnvironment != nil {
+			if run.PreviewEnvironment.Name == "" {
+				return errors.Errorf("run %q: preview environment name is empty", run.Name)
+			}
+			if !util.ValidateName(run.PreviewEnvironment.Name) {
+				return errors.Errorf("run %q: invalid preview environment name %q", run.Name, run.PreviewEnvironment.Name)
+			}
+		}
+
 		seenTasks := map[string]struct{}{}
 		for ti, task := range run.Tasks {
 			if task == nil {
@@ -745,12 +1103,182 @@ func checkConfig(config *Config) error {
 					return errors.Errorf("task %q runtime: invalid arch %q", task.Name, r.Arch)
 				}
 			}
+			if r.GPUs != nil {
+				if r.GPUs.Count <= 0 {
+					return errors.Errorf("task %q runtime: gpus count must be greater than 0", task.Name)
+				}
+			}
+			if r.Docker != nil {
+				if r.Docker.CPU != nil && r.Docker.CPU.Sign() <= 0 {
+					return errors.Errorf("task %q runtime: docker cpu must be greater than 0", task.Name)
+				}
+				if r.Docker.Memory != nil && r.Docker.Memory.Sign() <= 0 {
+					return errors.Errorf("task %q runtime: docker memory must be greater than 0", task.Name)
+				}
+			}
+			if r.Limits != nil {
+				if r.Limits.Pids < 0 {
+					return errors.Errorf("task %q runtime: pids limit must be greater or equal than 0", task.Name)
+				}
+				for name, ulimit := range r.Limits.Ulimits {
+					if !types.IsValidUlimit(name) {
+						return errors.Errorf("task %q runtime: unknown ulimit %q", task.Name, name)
+					}
+					if ulimit == nil || ulimit.Soft <= 0 || ulimit.Hard <= 0 {
+						return errors.Errorf("task %q runtime: ulimit %q values must be greater than 0", task.Name, name)
+					}
+					if ulimit.Soft > ulimit.Hard {
+						return errors.Errorf("task %q runtime: ulimit %q soft value must be less or equal than the hard value", task.Name, name)
+					}
+				}
+			}
+			if r.OS != "" {
+				if !types.IsValidOS(r.OS) {
+					return errors.Errorf("task %q runtime: invalid os %q", task.Name, r.OS)
+				}
+			}
+			for i, container := range r.InitContainers {
+				if container == nil {
+					return errors.Errorf("task %q runtime: init container at index %d is empty", task.Name, i)
+				}
+				if container.Image == "" {
+					return errors.Errorf("task %q runtime: init container at index %d has empty image", task.Name, i)
+				}
+			}
+			if r.OS == types.OSWindows {
+				// windows containers support neither privileged mode, tmpfs volumes nor gpus
+				if r.GPUs != nil {
+					return errors.Errorf("task %q runtime: gpus aren't supported with windows containers", task.Name)
+				}
+				if len(r.InitContainers) > 0 {
+					return errors.Errorf("task %q runtime: init containers aren't supported with windows containers", task.Name)
+				}
+				if r.Docker != nil {
+					return errors.Errorf("task %q runtime: docker daemons aren't supported with windows containers", task.Name)
+				}
+				if r.Limits != nil {
+					return errors.Errorf("task %q runtime: limits aren't supported with windows containers", task.Name)
+				}
+				for _, s := range task.Steps {
+					if rs, ok := s.(*RunStep); ok && rs.Background {
+						return errors.Errorf("task %q: background steps aren't supported with windows containers", task.Name)
+					}
+				}
+				for _, container := range r.Containers {
+					if container.Privileged {
+						return errors.Errorf("task %q runtime: privileged containers aren't supported with windows containers", task.Name)
+					}
+					if len(container.Volumes) > 0 {
+						return errors.Errorf("task %q runtime: volumes aren't supported with windows containers", task.Name)
+					}
+					if container.ShmSize != nil {
+						return errors.Errorf("task %q runtime: shm size isn't supported with windows containers", task.Name)
+					}
+				}
+			}
 
-			for _, container := range r.Containers {
+			for _, container := range append(append([]*Container{}, r.Containers...), r.InitContainers...) {
 				for _, vol := range container.Volumes {
 					if vol.TmpFS == nil {
 						return errors.Errorf("no volume config specified")
 					}
+					if vol.TmpFS.Size != nil && vol.TmpFS.Size.Sign() < 0 {
+						return errors.Errorf("task %q runtime: volume %q has a negative tmpfs size", task.Name, vol.Path)
+					}
+					if container.ShmSize != nil && path.Clean(vol.Path) == "/dev/shm" {
+						return errors.Errorf("task %q runtime: a container with a shm size cannot define a /dev/shm volume", task.Name)
+					}
+				}
+				if container.ShmSize != nil && container.ShmSize.Sign() <= 0 {
+					return errors.Errorf("task %q runtime: shm size must be greater than 0", task.Name)
+				}
+			}
+
+			if task.StopSignal != "" {
+				if _, ok := stopSignals[task.StopSignal]; !ok {
+					return errors.Errorf("task %q: invalid stop signal %q", task.Name, task.StopSignal)
+				}
+			}
+			if task.StopGracePeriod < 0 {
+				return errors.Errorf("task %q: negative stop grace period", task.Name)
+			}
+			if r.OS == types.OSWindows && (task.StopSignal != "" || task.StopGracePeriod > 0) {
+				return errors.Errorf("task %q: stop signal and grace period aren't supported with windows containers", task.Name)
+			}
+
+			if r.OS == types.OSWindows && len(task.Files) > 0 {
+				return errors.Errorf("task %q: files aren't supported with windows containers", task.Name)
+			}
+			seenFiles := map[string]struct{}{}
+			for i, file := range task.Files {
+				if file == nil {
+					return errors.Errorf("task %q: file at index %d is empty", task.Name, i)
+				}
+				if file.Path == "" {
+					return errors.Errorf("task %q: file at index %d has empty path", task.Name, i)
+				}
+				if !path.IsAbs(file.Path) {
+					return errors.Errorf("task %q: file path %q must be an absolute path", task.Name, file.Path)
+				}
+				if _, ok := seenFiles[path.Clean(file.Path)]; ok {
+					return errors.Errorf("task %q: duplicate file path %q", task.Name, file.Path)
+				}
+				seenFiles[path.Clean(file.Path)] = struct{}{}
+				if file.Mode < 0 || file.Mode > 0777 {
+					return errors.Errorf("task %q: file %q has invalid mode %#o", task.Name, file.Path, file.Mode)
+				}
+			}
+
+			if task.Batch {
+				// batch tasks share their pod so they cannot have isolation
+				// requirements
+				if len(r.Containers) > 1 {
+					return errors.Errorf("task %q: batch tasks cannot define service containers", task.Name)
+				}
+				if len(r.InitContainers) > 0 {
+					return errors.Errorf("task %q: batch tasks cannot define init containers", task.Name)
+				}
+				if r.GPUs != nil {
+					return errors.Errorf("task %q: batch tasks cannot request gpus", task.Name)
+				}
+				if r.Docker != nil {
+					return errors.Errorf("task %q: batch tasks cannot request a docker daemon", task.Name)
+				}
+				if r.Limits != nil {
+					return errors.Errorf("task %q: batch tasks cannot define limits", task.Name)
+				}
+				if len(r.Containers) > 0 && r.Containers[0].Privileged {
+					return errors.Errorf("task %q: batch tasks cannot use privileged containers", task.Name)
+				}
+				if len(task.Files) > 0 {
+					return errors.Errorf("task %q: batch tasks cannot define files", task.Name)
+				}
+			}
+
+			if task.DeployEnvironment != "" && !util.ValidateName(task.DeployEnvironment) {
+				return errors.Errorf("task %q: invalid deploy environment name %q", task.Name, task.DeployEnvironment)
+			}
+
+			if task.Always {
+				// always tasks are executed whatever their dependencies result
+				for _, dep := range task.Depends {
+					if len(dep.Conditions) > 0 {
+						return errors.Errorf("task %q: always tasks cannot define dependency conditions", task.Name)
+					}
+				}
+			}
+
+			for i, report := range task.Reports {
+				if report == nil {
+					return errors.Errorf("task %q report %d is empty", task.Name, i)
+				}
+				switch report.Format {
+				case ReportFormatJUnit, ReportFormatCobertura:
+				default:
+					return errors.Errorf("task %q report %d: invalid format %q", task.Name, i, report.Format)
+				}
+				if report.Path == "" {
+					return errors.Errorf("task %q report %d: empty path", task.Name, i)
 				}
 			}
 		}
@@ -831,31 +1359,23 @@ func checkConfig(config *Config) error {
 	}
 
 	for _, run := range config.Runs {
+		if err := checkSteps(run.Before, fmt.Sprintf("run %q before steps", run.Name)); err != nil {
+			return err
+		}
+		if err := checkSteps(run.After, fmt.Sprintf("run %q after steps", run.Name)); err != nil {
+			return err
+		}
+		for i, s := range run.After {
+			if _, ok := s.(*CloneStep); ok {
+				return errors.Errorf("clone step %d not allowed in run %q after steps", i, run.Name)
+			}
+		}
 		for _, task := range run.Tasks {
-			for i, s := range task.Steps {
-				switch step := s.(type) {
-				// TODO(sgotti) we could use the run step command as step name but when the
-				// command is very long or multi line it doesn't makes sense and will
-				// probably be quite unuseful/confusing from an UI point of view
-				case *CloneStep:
-					if step.Depth != nil && *step.Depth < 1 {
-						return errors.Errorf("depth value must be greater than 0 for clone step in task %q", task.Name)
-					}
-				case *RunStep:
-					if step.Command == "" {
-						return errors.Errorf("no command defined for step %d (run) in task %q", i, task.Name)
-					}
-
-				case *SaveCacheStep:
-					if step.Key == "" {
-						return errors.Errorf("no key defined for step %d (save_cache) in task %q", i, task.Name)
-					}
-
-				case *RestoreCacheStep:
-					if len(step.Keys) == 0 {
-						return errors.Errorf("no keys defined for step %d (restore_cache) in task %q", i, task.Name)
-					}
-				}
+			if err := checkSteps(task.Steps, fmt.Sprintf("task %q", task.Name)); err != nil {
+				return err
+			}
+			if err := checkTaskOutputsReferences(run, task); err != nil {
+				return err
 			}
 		}
 	}
@@ -894,35 +1414,162 @@ func checkConfig(config *Config) error {
 			}
 
 			// set steps defaults
-			for i, s := range task.Steps {
-				switch step := s.(type) {
-				// TODO(sgotti) we could use the run step command as step name but when the
-				// command is very long or multi line it doesn't makes sense and will
-				// probably be quite unuseful/confusing from an UI point of view
-				case *RunStep:
-					if step.Name == "" {
-						lines, err := util.CountLines(step.Command)
-						// if we failed to count the lines (shouldn't happen) or the number of lines is > 1 then a name is requred
-						if err != nil || lines > 1 {
-							return errors.Errorf("missing step name for step %d (run) in task %q, required since command is more than one line", i, task.Name)
-						}
-						len := len(step.Command)
-						if len > maxStepNameLength {
-							len = maxStepNameLength
-						}
-						step.Name = step.Command[:len]
-					}
-					// if tty is omitted its default is true
-					if step.Tty == nil {
-						step.Tty = util.BoolP(true)
-					}
-				case *SaveCacheStep:
-					for _, content := range step.Contents {
-						if len(content.Paths) == 0 {
-							// default to all files inside the sourceDir
-							content.Paths = []string{"**"}
-						}
-					}
+			if err := setStepsDefaults(task.Steps, fmt.Sprintf("task %q", task.Name)); err != nil {
+				return err
+			}
+		}
+
+		if err := setStepsDefaults(run.Before, fmt.Sprintf("run %q before steps", run.Name)); err != nil {
+			return err
+		}
+		if err := setStepsDefaults(run.After, fmt.Sprintf("run %q after steps", run.Name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkTaskOutputsReferences checks that the task environment and run steps
+// reference only the outputs of the task dependencies (direct or not) since
+// the other tasks outputs aren't available when the task is executed
+func checkTaskOutputsReferences(run *Run, task *Task) error {
+	values := []string{}
+	for _, v := range task.Environment {
+		if v.Type == ValueTypeString {
+			values = append(values, v.Value)
+		}
+	}
+	for _, s := range task.Steps {
+		rs, ok := s.(*RunStep)
+		if !ok {
+			continue
+		}
+		values = append(values, rs.Command)
+		values = append(values, rs.CommandArgs...)
+		for _, v := range rs.Environment {
+			if v.Type == ValueTypeString {
+				values = append(values, v.Value)
+			}
+		}
+	}
+
+	parents := map[string]struct{}{}
+	for _, parent := range getAllTaskParents(run, task) {
+		parents[parent.Name] = struct{}{}
+	}
+	for _, v := range values {
+		for _, ref := range taskoutputs.References(v) {
+			if _, ok := parents[ref.TaskName]; !ok {
+				return errors.Errorf("task %q references the output %q of task %q that isn't one of its dependencies", task.Name, ref.Name, ref.TaskName)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkSteps(steps Steps, where string) error {
+	// background steps started before the current step
+	backgroundSteps := map[string]struct{}{}
+	for i, s := range steps {
+		switch step := s.(type) {
+		case *CloneStep:
+			if step.Depth != nil && *step.Depth < 1 {
+				return errors.Errorf("depth value must be greater than 0 for clone step in %s", where)
+			}
+			for _, p := range step.SparsePaths {
+				if p == "" {
+					return errors.Errorf("empty sparse path for clone step in %s", where)
+				}
+			}
+		case *RunStep:
+			if step.Command == "" && len(step.CommandArgs) == 0 && step.Script == "" {
+				return errors.Errorf("no command defined for step %d (run) in %s", i, where)
+			}
+			if step.Script != "" && (step.Command != "" || len(step.CommandArgs) > 0) {
+				return errors.Errorf("only one of command or script can be defined for step %d (run) in %s", i, where)
+			}
+			if step.Background {
+				// a name is required to reference the step in the wait_background steps
+				if step.Name == "" {
+					return errors.Errorf("no name defined for background step %d (run) in %s", i, where)
+				}
+				if _, ok := backgroundSteps[step.Name]; ok {
+					return errors.Errorf("duplicate background step name %q in %s", step.Name, where)
+				}
+				backgroundSteps[step.Name] = struct{}{}
+			}
+
+		case *WaitBackgroundStep:
+			for _, name := range step.Steps {
+				if _, ok := backgroundSteps[name]; !ok {
+					return errors.Errorf("step %d (wait_background) in %s references %q that isn't a background step defined before it", i, where, name)
+				}
+			}
+
+		case *SaveCacheStep:
+			if step.Key == "" {
+				return errors.Errorf("no key defined for step %d (save_cache) in %s", i, where)
+			}
+
+		case *RestoreCacheStep:
+			if len(step.Keys) == 0 {
+				return errors.Errorf("no keys defined for step %d (restore_cache) in %s", i, where)
+			}
+		}
+	}
+
+	return nil
+}
+
+// truncateStepName truncates a generated step name to maxStepNameLength bytes
+// without splitting a multibyte character
+func truncateStepName(name string) string {
+	if len(name) <= maxStepNameLength {
+		return name
+	}
+	n := maxStepNameLength
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return name[:n]
+}
+
+func setStepsDefaults(steps Steps, where string) error {
+	for i, s := range steps {
+		switch step := s.(type) {
+		// TODO(sgotti) we could use the run step command as step name but when the
+		// command is very long or multi line it doesn't makes sense and will
+		// probably be quite unuseful/confusing from an UI point of view
+		case *RunStep:
+			if step.Name == "" && step.Script != "" {
+				step.Name = truncateStepName(step.Script)
+			}
+			if step.Name == "" && len(step.CommandArgs) > 0 {
+				step.Name = truncateStepName(strings.Join(step.CommandArgs, " "))
+			}
+			if step.Name == "" {
+				lines, err := util.CountLines(step.Command)
+				// if we failed to count the lines (shouldn't happen) or the number of lines is > 1 then a name is requred
+				if err != nil || lines > 1 {
+					return errors.Errorf("missing step name for step %d (run) in %s, required since command is more than one line", i, where)
+				}
+				step.Name = truncateStepName(step.Command)
+			}
+			// if tty is omitted its default is true
+			if step.Tty == nil {
+				step.Tty = util.BoolP(true)
+			}
+		case *WaitBackgroundStep:
+			if step.Name == "" {
+				step.Name = "wait background"
+			}
+		case *SaveCacheStep:
+			for _, content := range step.Contents {
+				if len(content.Paths) == 0 {
+					// default to all files inside the sourceDir
+					content.Paths = []string{"**"}
 				}
 			}
 		}
@@ -16,7 +16,9 @@ package config
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"agola.io/agola/internal/util"
 	"agola.io/agola/services/types"
@@ -90,6 +92,178 @@ func TestParseConfig(t *testing.T) {
                 `,
 			err: fmt.Errorf(`task "task01" runtime: invalid arch "invalidarch"`),
 		},
+		{
+			name: "test invalid runtime os",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          os: invalidos
+                          containers:
+                            - image: busybox
+                `,
+			err: fmt.Errorf(`task "task01" runtime: invalid os "invalidos"`),
+		},
+		{
+			name: "test windows runtime with privileged container",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          os: windows
+                          containers:
+                            - image: mcr.microsoft.com/windows/servercore:ltsc2019
+                              privileged: true
+                `,
+			err: fmt.Errorf(`task "task01" runtime: privileged containers aren't supported with windows containers`),
+		},
+		{
+			name: "test invalid task gpus count",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          gpus:
+                            count: 0
+                `,
+			err: fmt.Errorf(`task "task01" runtime: gpus count must be greater than 0`),
+		},
+		{
+			name: "test task output reference to a task that isn't a dependency",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: build
+                        runtime:
+                          containers:
+                            - image: busybox
+                      - name: push
+                        runtime:
+                          containers:
+                            - image: busybox
+                        steps:
+                          - run: docker push image:${tasks.build.outputs.tag}
+                `,
+			err: fmt.Errorf(`task "push" references the output "tag" of task "build" that isn't one of its dependencies`),
+		},
+		{
+			name: "test invalid task docker daemon memory",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          docker:
+                            memory: 0
+                `,
+			err: fmt.Errorf(`task "task01" runtime: docker memory must be greater than 0`),
+		},
+		{
+			name: "test docker daemon in windows task",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          os: windows
+                          containers:
+                            - image: mcr.microsoft.com/windows/servercore:ltsc2019
+                          docker:
+                            cache: true
+                `,
+			err: fmt.Errorf(`task "task01" runtime: docker daemons aren't supported with windows containers`),
+		},
+		{
+			name: "test unknown task ulimit",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          limits:
+                            pids: 100
+                            ulimits:
+                              nofiles:
+                                soft: 1024
+                                hard: 1024
+                `,
+			err: fmt.Errorf(`task "task01" runtime: unknown ulimit "nofiles"`),
+		},
+		{
+			name: "test task ulimit soft value greater than hard value",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          limits:
+                            ulimits:
+                              nofile:
+                                soft: 2048
+                                hard: 1024
+                `,
+			err: fmt.Errorf(`task "task01" runtime: ulimit "nofile" soft value must be less or equal than the hard value`),
+		},
+		{
+			name: "test shm size with a /dev/shm volume",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                              shm_size: 1Gi
+                              volumes:
+                                - path: /dev/shm
+                                  tmpfs:
+                                    size: 1Gi
+                `,
+			err: fmt.Errorf(`task "task01" runtime: a container with a shm size cannot define a /dev/shm volume`),
+		},
+		{
+			name: "test zero shm size",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                              shm_size: 0
+                `,
+			err: fmt.Errorf(`task "task01" runtime: shm size must be greater than 0`),
+		},
 		{
 			name: "test missing task dependency",
 			in: `
@@ -199,6 +373,407 @@ func TestParseConfig(t *testing.T) {
                 `,
 			err: errors.Errorf("task %q and its dependency %q have both a dependency on task %q", "task04", "task03", "task01"),
 		},
+		{
+			name: "test run before steps without command",
+			in: `
+                runs:
+                  - name: run01
+                    before:
+                      - run:
+                          name: step01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("no command defined for step 0 (run) in run %q before steps", "run01"),
+		},
+		{
+			name: "test run step with both command and script",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - type: run
+                            command: make
+                            script: ./ci/build.sh
+                `,
+			err: errors.Errorf("only one of command or script can be defined for step 0 (run) in task %q", "task01"),
+		},
+		{
+			name: "test background run step without name",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - type: run
+                            command: ./server
+                            background: true
+                `,
+			err: errors.Errorf("no name defined for background step 0 (run) in task %q", "task01"),
+		},
+		{
+			name: "test wait background step referencing a step not started before",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - wait_background:
+                              steps:
+                                - server
+                          - type: run
+                            name: server
+                            command: ./server
+                            background: true
+                `,
+			err: errors.Errorf("step 0 (wait_background) in task %q references %q that isn't a background step defined before it", "task01", "server"),
+		},
+		{
+			name: "test run after steps with clone step",
+			in: `
+                runs:
+                  - name: run01
+                    after:
+                      - clone:
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("clone step 0 not allowed in run %q after steps", "run01"),
+		},
+		{
+			name: "test task report with invalid format",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        reports:
+                          - format: xunit
+                            path: report.xml
+                `,
+			err: errors.Errorf("task %q report %d: invalid format %q", "task01", 0, "xunit"),
+		},
+		{
+			name: "test task report with empty path",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        reports:
+                          - format: junit
+                `,
+			err: errors.Errorf("task %q report %d: empty path", "task01", 0),
+		},
+		{
+			name: "test task with invalid stop signal",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        stop_signal: SIGSTOP
+                `,
+			err: errors.Errorf("task %q: invalid stop signal %q", "task01", "SIGSTOP"),
+		},
+		{
+			name: "test task with invalid deploy environment name",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        deploy_environment: prod_env
+                `,
+			err: errors.Errorf("task %q: invalid deploy environment name %q", "task01", "prod_env"),
+		},
+		{
+			name: "test task with negative stop grace period",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        stop_grace_period: -10s
+                `,
+			err: errors.Errorf("task %q: negative stop grace period", "task01"),
+		},
+		{
+			name: "test clone step with empty sparse path",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        steps:
+                          - clone:
+                              depth: 1
+                              sparse_paths: [ "" ]
+                `,
+			err: errors.Errorf("empty sparse path for clone step in task %q", "task01"),
+		},
+		{
+			name: "test run depending on a run defined after it",
+			in: `
+                runs:
+                  - name: run01
+                    depends: [ run02 ]
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                  - name: run02
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("run %q depends on run %q that must be defined before it", "run01", "run02"),
+		},
+		{
+			name: "test run depending on itself",
+			in: `
+                runs:
+                  - name: run01
+                    depends: [ run01 ]
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("run %q depends on run %q that must be defined before it", "run01", "run01"),
+		},
+		{
+			name: "test run trigger with empty branch",
+			in: `
+                runs:
+                  - name: run01
+                    triggers:
+                      - project: org/org01/project01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("run %q: trigger %d branch is empty", "run01", 0),
+		},
+		{
+			name: "test init container with empty image",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                          init_containers:
+                            - entrypoint: /bin/true
+                `,
+			err: errors.Errorf("task %q runtime: init container at index %d has empty image", "task01", 0),
+		},
+		{
+			name: "test run with empty label",
+			in: `
+                runs:
+                  - name: run01
+                    labels: [ manual, "" ]
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("run %q: label %d is empty", "run01", 1),
+		},
+		{
+			name: "test run with invalid tag",
+			in: `
+                runs:
+                  - name: run01
+                    tags: [ release, "hot fix" ]
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("run %q: invalid tag %q", "run01", "hot fix"),
+		},
+		{
+			name: "test task file with relative path",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        files:
+                          - path: .kube/config
+                            content:
+                              from_variable: kubeconfig
+                `,
+			err: errors.Errorf("task %q: file path %q must be an absolute path", "task01", ".kube/config"),
+		},
+		{
+			name: "test task file with invalid mode",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        files:
+                          - path: /root/.kube/config
+                            content:
+                              from_variable: kubeconfig
+                            mode: 01777
+                `,
+			err: errors.Errorf("task %q: file %q has invalid mode %#o", "task01", "/root/.kube/config", 01777),
+		},
+		{
+			name: "test batch task with service containers",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                            - image: postgres
+                        batch: true
+                `,
+			err: errors.Errorf("task %q: batch tasks cannot define service containers", "task01"),
+		},
+		{
+			name: "test always task with dependency conditions",
+			in: `
+                runs:
+                  - name: run01
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                      - name: cleanup
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                        always: true
+                        depends:
+                          - task01: [ on_failure ]
+                `,
+			err: errors.Errorf("task %q: always tasks cannot define dependency conditions", "cleanup"),
+		},
+		{
+			name: "test run with invalid preview environment name",
+			in: `
+                runs:
+                  - name: run01
+                    preview_environment:
+                      name: "preview env"
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+			err: errors.Errorf("run %q: invalid preview environment name %q", "run01", "preview env"),
+		},
+		{
+			name: "test runs with dependencies and triggers",
+			in: `
+                runs:
+                  - name: build
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                  - name: deploy
+                    depends: [ build ]
+                    triggers:
+                      - project: org/org01/project01
+                        branch: master
+                    tasks:
+                      - name: task01
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: busybox
+                `,
+		},
 	}
 
 	for _, tt := range tests {
@@ -289,6 +864,8 @@ func TestParseOutput(t *testing.T) {
                           - run:
                               name: name different than command
                               command: command02
+                              when:
+                                branch: master
                           - run:
                               command: command03
                               environment:
@@ -354,6 +931,18 @@ func TestParseOutput(t *testing.T) {
                             name: command with tty as false
                             command: command03
                             tty: false
+                      - name: task06
+                        runtime:
+                          type: pod
+                          containers:
+                            - image: image01
+                              entrypoint: [ "/bin/entrypoint", "--opt01" ]
+                        steps:
+                          - type: run
+                            command: [ "/bin/command01", "arg01" ]
+                          - run: [ "/bin/command02", "arg01" ]
+                          - type: run
+                            script: ./ci/build.sh
           `,
 			out: &Config{
 				Runs: []*Run{
@@ -445,6 +1034,9 @@ func TestParseOutput(t *testing.T) {
 										BaseStep: BaseStep{
 											Type: "run",
 											Name: "name different than command",
+											When: &When{
+												Branch: &types.WhenConditions{Include: []types.WhenCondition{{Match: "master", Type: types.WhenConditionTypeSimple}}},
+											},
 										},
 										Command: "command02",
 										Tty:     util.BoolP(true),
@@ -584,6 +1176,47 @@ func TestParseOutput(t *testing.T) {
 								},
 								Depends: nil,
 							},
+							&Task{
+								Name: "task06",
+								Runtime: &Runtime{
+									Type: "pod",
+									Arch: "",
+									Containers: []*Container{
+										&Container{
+											Image:          "image01",
+											EntrypointArgs: []string{"/bin/entrypoint", "--opt01"},
+										},
+									},
+								},
+								WorkingDir: defaultWorkingDir,
+								Steps: Steps{
+									&RunStep{
+										BaseStep: BaseStep{
+											Type: "run",
+											Name: "/bin/command01 arg01",
+										},
+										CommandArgs: []string{"/bin/command01", "arg01"},
+										Tty:         util.BoolP(true),
+									},
+									&RunStep{
+										BaseStep: BaseStep{
+											Type: "run",
+											Name: "/bin/command02 arg01",
+										},
+										CommandArgs: []string{"/bin/command02", "arg01"},
+										Tty:         util.BoolP(true),
+									},
+									&RunStep{
+										BaseStep: BaseStep{
+											Type: "run",
+											Name: "./ci/build.sh",
+										},
+										Script: "./ci/build.sh",
+										Tty:    util.BoolP(true),
+									},
+								},
+								Depends: nil,
+							},
 						},
 					},
 				},
@@ -612,3 +1245,83 @@ func TestParseOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestRunSelected(t *testing.T) {
+	run := &Run{Name: "run01", Labels: []string{"webhook", "deploy"}}
+
+	tests := []struct {
+		name      string
+		selectors []string
+		selected  bool
+	}{
+		{
+			name:     "test no selectors",
+			selected: true,
+		},
+		{
+			name:      "test select by name",
+			selectors: []string{"run02", "run01"},
+			selected:  true,
+		},
+		{
+			name:      "test select by label",
+			selectors: []string{"deploy"},
+			selected:  true,
+		},
+		{
+			name:      "test not selected",
+			selectors: []string{"run02", "manual"},
+			selected:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if selected := run.Selected(tt.selectors); selected != tt.selected {
+				t.Fatalf("expected selected %t, got %t", tt.selected, selected)
+			}
+		})
+	}
+}
+
+func TestTruncateStepName(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			name: "test short name",
+			in:   "make test",
+			out:  "make test",
+		},
+		{
+			name: "test ascii name",
+			in:   strings.Repeat("a", maxStepNameLength+10),
+			out:  strings.Repeat("a", maxStepNameLength),
+		},
+		{
+			// "è" is 2 bytes long and the limit falls inside the last one
+			name: "test multibyte name",
+			in:   strings.Repeat("a", maxStepNameLength-1) + "èèè",
+			out:  strings.Repeat("a", maxStepNameLength-1),
+		},
+		{
+			name: "test multibyte name at limit",
+			in:   strings.Repeat("a", maxStepNameLength-2) + "èèè",
+			out:  strings.Repeat("a", maxStepNameLength-2) + "è",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := truncateStepName(tt.in)
+			if out != tt.out {
+				t.Fatalf("expected %q, got %q", tt.out, out)
+			}
+			if !utf8.ValidString(out) {
+				t.Fatalf("invalid utf8 step name %q", out)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"agola.io/agola/services/types"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// JSONSchema is the subset of a json schema (draft-07) used to describe the
+// run config
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Const                string                 `json:"const,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	MinProperties        int                    `json:"minProperties,omitempty"`
+	MaxProperties        int                    `json:"maxProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+	AllOf                []*JSONSchema          `json:"allOf,omitempty"`
+	Definitions          map[string]*JSONSchema `json:"definitions,omitempty"`
+}
+
+// schemaStepTypes are the step types, in the order they are documented,
+// accepted by Steps.UnmarshalJSON
+var schemaStepTypes = []struct {
+	name string
+	t    reflect.Type
+}{
+	{"clone", reflect.TypeOf(CloneStep{})},
+	{"run", reflect.TypeOf(RunStep{})},
+	{"save_to_workspace", reflect.TypeOf(SaveToWorkspaceStep{})},
+	{"restore_workspace", reflect.TypeOf(RestoreWorkspaceStep{})},
+	{"save_cache", reflect.TypeOf(SaveCacheStep{})},
+	{"restore_cache", reflect.TypeOf(RestoreCacheStep{})},
+	{"wait_background", reflect.TypeOf(WaitBackgroundStep{})},
+}
+
+// Schema returns the json schema of the run config. It's generated from the
+// config types, so it's always in sync with them, handling the types with a
+// custom json unmarshalling (accepting multiple formats) by hand.
+func Schema() *JSONSchema {
+	g := &schemaGenerator{definitions: map[string]*JSONSchema{}}
+
+	// a $ref must not have sibling keywords so the root config is wrapped in
+	// an allOf
+	return &JSONSchema{
+		Schema:      "http://json-schema.org/draft-07/schema#",
+		AllOf:       []*JSONSchema{g.typeSchema(reflect.TypeOf(Config{}))},
+		Definitions: g.definitions,
+	}
+}
+
+type schemaGenerator struct {
+	definitions map[string]*JSONSchema
+}
+
+func (g *schemaGenerator) typeSchema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if s := g.customTypeSchema(t); s != nil {
+		return s
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &JSONSchema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		return g.structRef(t)
+	default:
+		// any value
+		return &JSONSchema{}
+	}
+}
+
+// structRef returns a reference to the struct definition, adding it to the
+// definitions when missing
+func (g *schemaGenerator) structRef(t reflect.Type) *JSONSchema {
+	name := t.Name()
+	if _, ok := g.definitions[name]; !ok {
+		s := &JSONSchema{Type: "object", Properties: map[string]*JSONSchema{}}
+		// add the definition before generating the properties to handle
+		// recursive types
+		g.definitions[name] = s
+		g.addProperties(s, t)
+	}
+	return &JSONSchema{Ref: "#/definitions/" + name}
+}
+
+// definitionRef returns a reference to the definition with the provided name,
+// adding it to the definitions using gen when missing
+func (g *schemaGenerator) definitionRef(name string, gen func() *JSONSchema) *JSONSchema {
+	if _, ok := g.definitions[name]; !ok {
+		g.definitions[name] = gen()
+	}
+	return &JSONSchema{Ref: "#/definitions/" + name}
+}
+
+func (g *schemaGenerator) addProperties(s *JSONSchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		// inline the embedded structs fields like encoding/json does
+		if f.Anonymous && name == "" {
+			g.addProperties(s, f.Type)
+			continue
+		}
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		if fs := customFieldSchema(t, name); fs != nil {
+			s.Properties[name] = fs
+			continue
+		}
+		s.Properties[name] = g.typeSchema(f.Type)
+	}
+}
+
+// customTypeSchema returns the schema of the types with a custom json
+// unmarshalling or a fixed set of values. It returns nil for the other types.
+func (g *schemaGenerator) customTypeSchema(t reflect.Type) *JSONSchema {
+	switch t {
+	case reflect.TypeOf(Steps{}):
+		return g.stepsSchema()
+	case reflect.TypeOf(Depends{}):
+		return g.dependsSchema()
+	case reflect.TypeOf(Value{}):
+		return g.definitionRef("Value", func() *JSONSchema {
+			return &JSONSchema{
+				OneOf: []*JSONSchema{
+					{Type: "string"},
+					{
+						Type:                 "object",
+						Properties:           map[string]*JSONSchema{"from_variable": {Type: "string"}},
+						Required:             []string{"from_variable"},
+						AdditionalProperties: false,
+					},
+				},
+			}
+		})
+	case reflect.TypeOf(When{}):
+		return g.definitionRef("When", func() *JSONSchema {
+			conditions := whenConditionsSchema()
+			return &JSONSchema{
+				Type: "object",
+				Properties: map[string]*JSONSchema{
+					"branch": conditions,
+					"tag":    conditions,
+					"ref":    conditions,
+				},
+				AdditionalProperties: false,
+			}
+		})
+	case reflect.TypeOf(Duration(0)):
+		// a go duration like "30s" or "2m"
+		return &JSONSchema{Type: "string"}
+	case reflect.TypeOf(resource.Quantity{}):
+		// a kubernetes quantity like "1Gi", "500m" or 2
+		return &JSONSchema{OneOf: []*JSONSchema{{Type: "string"}, {Type: "number"}}}
+	case reflect.TypeOf(RuntimeType("")):
+		return enumSchema(RuntimeTypePod)
+	case reflect.TypeOf(DockerRegistryAuthType("")):
+		return enumSchema(DockerRegistryAuthTypeBasic, DockerRegistryAuthTypeEncodedAuth)
+	case reflect.TypeOf(ReportFormat("")):
+		return enumSchema(ReportFormatJUnit, ReportFormatCobertura)
+	case reflect.TypeOf(DependCondition("")):
+		return enumSchema(DependConditionOnSuccess, DependConditionOnFailure, DependConditionOnSkipped)
+	case reflect.TypeOf(types.OS("")):
+		return enumSchema(types.OSLinux, types.OSWindows)
+	case reflect.TypeOf(types.Arch("")):
+		return enumSchema(types.Arch386, types.ArchAMD64, types.ArchARM, types.ArchARM64)
+	}
+	return nil
+}
+
+// customFieldSchema returns the schema of the struct fields with a custom json
+// unmarshalling or a fixed set of values. It returns nil for the other fields.
+func customFieldSchema(t reflect.Type, name string) *JSONSchema {
+	switch {
+	case t == reflect.TypeOf(Container{}) && name == "entrypoint",
+		t == reflect.TypeOf(RunStep{}) && name == "command":
+		return stringOrSliceSchema()
+	case t == reflect.TypeOf(Task{}) && name == "stop_signal":
+		signals := []string{}
+		for s := range stopSignals {
+			signals = append(signals, s)
+		}
+		sort.Strings(signals)
+		return &JSONSchema{Type: "string", Enum: signals}
+	}
+	return nil
+}
+
+// stepsSchema returns the schema of the steps defined as { type: "steptype",
+// other step fields } or as { "steptype": { step fields } }
+func (g *schemaGenerator) stepsSchema() *JSONSchema {
+	steps := []*JSONSchema{}
+	shortSteps := &JSONSchema{
+		Type:                 "object",
+		Properties:           map[string]*JSONSchema{},
+		MinProperties:        1,
+		MaxProperties:        1,
+		AdditionalProperties: false,
+	}
+	for _, st := range schemaStepTypes {
+		ref := g.typeSchema(st.t)
+		steps = append(steps, &JSONSchema{
+			AllOf: []*JSONSchema{
+				ref,
+				{
+					Properties: map[string]*JSONSchema{"type": {Const: st.name}},
+					Required:   []string{"type"},
+				},
+			},
+		})
+
+		shortSteps.Properties[st.name] = ref
+		// a run step could also be defined only by its command
+		if st.name == "run" {
+			shortSteps.Properties[st.name] = &JSONSchema{OneOf: append(stringOrSliceSchema().OneOf, ref)}
+		}
+	}
+
+	return &JSONSchema{
+		Type:  "array",
+		Items: &JSONSchema{OneOf: append(steps, shortSteps)},
+	}
+}
+
+// dependsSchema returns the schema of the task dependencies defined as
+// "taskname", { "taskname": [ conditions ] } or { task: "taskname",
+// conditions: [ conditions ] }
+func (g *schemaGenerator) dependsSchema() *JSONSchema {
+	return &JSONSchema{
+		Type: "array",
+		Items: &JSONSchema{
+			OneOf: []*JSONSchema{
+				{Type: "string"},
+				{
+					AllOf: []*JSONSchema{
+						g.typeSchema(reflect.TypeOf(Depend{})),
+						{Required: []string{"task"}},
+					},
+				},
+				{
+					Type:                 "object",
+					AdditionalProperties: g.typeSchema(reflect.TypeOf([]DependCondition{})),
+					MinProperties:        1,
+					MaxProperties:        1,
+				},
+			},
+		},
+	}
+}
+
+// whenConditionsSchema returns the schema of the when conditions defined as a
+// string, a list of strings or as { include: conditions, exclude: conditions }
+func whenConditionsSchema() *JSONSchema {
+	return &JSONSchema{
+		OneOf: append(stringOrSliceSchema().OneOf, &JSONSchema{
+			Type: "object",
+			Properties: map[string]*JSONSchema{
+				"include": stringOrSliceSchema(),
+				"exclude": stringOrSliceSchema(),
+			},
+			AdditionalProperties: false,
+		}),
+	}
+}
+
+func stringOrSliceSchema() *JSONSchema {
+	return &JSONSchema{
+		OneOf: []*JSONSchema{
+			{Type: "string"},
+			{Type: "array", Items: &JSONSchema{Type: "string"}},
+		},
+	}
+}
+
+func enumSchema(values ...interface{}) *JSONSchema {
+	s := &JSONSchema{Type: "string"}
+	for _, v := range values {
+		s.Enum = append(s.Enum, reflect.ValueOf(v).String())
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaStepTypes(t *testing.T) {
+	// every step type described by the schema must be accepted by the steps
+	// unmarshalling
+	for _, st := range schemaStepTypes {
+		t.Run(st.name, func(t *testing.T) {
+			var steps Steps
+			if err := json.Unmarshal([]byte(fmt.Sprintf(`[{"type": %q}]`, st.name)), &steps); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if typ := reflect.TypeOf(steps[0]).Elem(); typ != st.t {
+				t.Fatalf("expected step type %s, got %s", st.t, typ)
+			}
+		})
+	}
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema()
+
+	if _, err := json.Marshal(s); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(s.AllOf) != 1 || s.AllOf[0].Ref != "#/definitions/Config" {
+		t.Fatalf("expected the root schema to reference the Config definition, got %v", s.AllOf)
+	}
+
+	// all the definitions references must exist
+	var checkRefs func(path string, js *JSONSchema)
+	checkRefs = func(path string, js *JSONSchema) {
+		if js == nil {
+			return
+		}
+		if js.Ref != "" {
+			name := js.Ref[len("#/definitions/"):]
+			if _, ok := s.Definitions[name]; !ok {
+				t.Errorf("%s: missing definition %q", path, name)
+			}
+		}
+		for k, p := range js.Properties {
+			checkRefs(path+"."+k, p)
+		}
+		if ap, ok := js.AdditionalProperties.(*JSONSchema); ok {
+			checkRefs(path+".*", ap)
+		}
+		checkRefs(path+"[]", js.Items)
+		for i, o := range append(js.OneOf, js.AllOf...) {
+			checkRefs(fmt.Sprintf("%s(%d)", path, i), o)
+		}
+	}
+	for name, d := range s.Definitions {
+		checkRefs(name, d)
+	}
+
+	task, ok := s.Definitions["Task"]
+	if !ok {
+		t.Fatalf("missing Task definition")
+	}
+	for _, name := range []string{"name", "runtime", "steps", "depends", "when", "environment", "stop_grace_period"} {
+		if _, ok := task.Properties[name]; !ok {
+			t.Errorf("missing Task property %q", name)
+		}
+	}
+	if steps := task.Properties["steps"]; steps.Type != "array" || len(steps.Items.OneOf) != len(schemaStepTypes)+1 {
+		t.Errorf("wrong steps schema: %v", steps)
+	}
+	if env := task.Properties["environment"]; env.Type != "object" || env.AdditionalProperties.(*JSONSchema).Ref != "#/definitions/Value" {
+		t.Errorf("wrong environment schema: %v", env)
+	}
+
+	runStep, ok := s.Definitions["RunStep"]
+	if !ok {
+		t.Fatalf("missing RunStep definition")
+	}
+	// embedded base step fields are inlined
+	for _, name := range []string{"type", "name", "when", "command"} {
+		if _, ok := runStep.Properties[name]; !ok {
+			t.Errorf("missing RunStep property %q", name)
+		}
+	}
+	if len(runStep.Properties["command"].OneOf) != 2 {
+		t.Errorf("expected run step command to be a string or a list of strings")
+	}
+}
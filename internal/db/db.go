@@ -20,6 +20,7 @@ import (
 	"regexp"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/mattn/go-sqlite3"
 	errors "golang.org/x/xerrors"
 )
@@ -58,6 +59,8 @@ var (
 		queryReplacers: []replacer{
 			// Remove sqlite3 only statements
 			{regexp.MustCompile(`--SQLITE3\n.*`), ""},
+			// "user" is a reserved word in postgres
+			{matchLiteral("user"), `"user"`},
 		},
 	}
 
@@ -192,6 +195,23 @@ func (db *DB) Do(ctx context.Context, f func(tx *Tx) error) error {
 	}
 }
 
+// IsConcurrentUpdateError reports if the transaction failed because of a
+// concurrent update of the same rows by another transaction
+func IsConcurrentUpdateError(err error) bool {
+	var pqerr *pq.Error
+	if errors.As(err, &pqerr) {
+		switch pqerr.Code {
+		// serialization_failure
+		case "40001":
+			return true
+		// unique_violation
+		case "23505":
+			return true
+		}
+	}
+	return false
+}
+
 func (db *DB) do(ctx context.Context, f func(tx *Tx) error) error {
 	tx, err := db.NewTx(ctx)
 	if err != nil {
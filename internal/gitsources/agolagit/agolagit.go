@@ -193,6 +193,10 @@ func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error
 	return nil, nil
 }
 
+func (c *Client) IsCollaborator(repopath, user string) (bool, error) {
+	return false, nil
+}
+
 func (c *Client) BranchRef(branch string) string {
 	return branchRefPrefix + branch
 }
@@ -0,0 +1,493 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	gitsource "agola.io/agola/internal/gitsources"
+
+	"golang.org/x/oauth2"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	// bitbucket cloud oauth2 scopes are defined in the oauth consumer configuration
+	BitbucketCloudOauth2Scopes  = []string{""}
+	BitbucketServerOauth2Scopes = []string{"REPO_ADMIN"}
+
+	branchRefPrefix     = "refs/heads/"
+	tagRefPrefix        = "refs/tags/"
+	pullRequestRefRegex = regexp.MustCompile("refs/pull-requests/(.*)/from")
+	pullRequestRefFmt   = "refs/pull-requests/%s/from"
+)
+
+const (
+	BitbucketCloudAPIURL = "https://api.bitbucket.org"
+	BitbucketCloudWebURL = "https://bitbucket.org"
+
+	cloudAPIPrefix = "/2.0"
+
+	serverAPIPrefix          = "/rest/api/1.0"
+	serverKeysPrefix         = "/rest/keys/1.0"
+	serverBuildStatusPrefix  = "/rest/build-status/1.0"
+	serverAccessTokensPrefix = "/rest/access-tokens/1.0"
+)
+
+type Opts struct {
+	APIURL         string
+	Token          string
+	SkipVerify     bool
+	Oauth2ClientID string
+	Oauth2Secret   string
+}
+
+// Client is a bitbucket git source client. It talks to the Bitbucket Cloud
+// api 2.0 when the api url is the Bitbucket Cloud one and to the Bitbucket
+// Server REST api 1.0 otherwise.
+type Client struct {
+	client           *http.Client
+	oauth2HTTPClient *http.Client
+	APIURL           string
+	WebURL           string
+	cloud            bool
+	token            string
+	oauth2ClientID   string
+	oauth2Secret     string
+}
+
+type apiError struct {
+	code    int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("bitbucket api status code %d: %s", e.code, e.message)
+}
+
+func isStatusCode(err error, code int) bool {
+	var aerr *apiError
+	return errors.As(err, &aerr) && aerr.code == code
+}
+
+// fromCommitStatus converts a gitsource commit status to a bitbucket build status state
+func fromCommitStatus(status gitsource.CommitStatus) string {
+	switch status {
+	case gitsource.CommitStatusPending:
+		return "INPROGRESS"
+	case gitsource.CommitStatusSuccess:
+		return "SUCCESSFUL"
+	case gitsource.CommitStatusError:
+		return "FAILED"
+	case gitsource.CommitStatusFailed:
+		return "FAILED"
+	default:
+		panic(fmt.Errorf("unknown commit status %q", status))
+	}
+}
+
+func parseRepoPath(repopath string) (string, string, error) {
+	parts := strings.Split(repopath, "/")
+	if len(parts) != 2 {
+		return "", "", errors.Errorf("wrong bitbucket repo path: %q", repopath)
+	}
+	return parts[0], parts[1], nil
+}
+
+func New(opts Opts) (*Client, error) {
+	// copied from net/http until it has a clone function: https://github.com/golang/go/issues/26013
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			DualStack: true,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: opts.SkipVerify},
+	}
+	httpClient := &http.Client{Transport: transport}
+
+	apiURL := strings.TrimSuffix(opts.APIURL, "/")
+	isCloud := apiURL == BitbucketCloudAPIURL
+
+	webURL := apiURL
+	if isCloud {
+		webURL = BitbucketCloudWebURL
+	}
+
+	return &Client{
+		client:           httpClient,
+		oauth2HTTPClient: httpClient,
+		APIURL:           apiURL,
+		WebURL:           webURL,
+		cloud:            isCloud,
+		token:            opts.Token,
+		oauth2ClientID:   opts.Oauth2ClientID,
+		oauth2Secret:     opts.Oauth2Secret,
+	}, nil
+}
+
+func (c *Client) oauth2Config(callbackURL string) *oauth2.Config {
+	if c.cloud {
+		return &oauth2.Config{
+			ClientID:     c.oauth2ClientID,
+			ClientSecret: c.oauth2Secret,
+			Scopes:       BitbucketCloudOauth2Scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  fmt.Sprintf("%s/site/oauth2/authorize", c.WebURL),
+				TokenURL: fmt.Sprintf("%s/site/oauth2/access_token", c.WebURL),
+			},
+			RedirectURL: callbackURL,
+		}
+	}
+
+	return &oauth2.Config{
+		ClientID:     c.oauth2ClientID,
+		ClientSecret: c.oauth2Secret,
+		Scopes:       BitbucketServerOauth2Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  fmt.Sprintf("%s/rest/oauth2/latest/authorize", c.WebURL),
+			TokenURL: fmt.Sprintf("%s/rest/oauth2/latest/token", c.WebURL),
+		},
+		RedirectURL: callbackURL,
+	}
+}
+
+func (c *Client) GetOauth2AuthorizationURL(callbackURL, state string) (string, error) {
+	var config = c.oauth2Config(callbackURL)
+	return config.AuthCodeURL(state), nil
+}
+
+func (c *Client) RequestOauth2Token(callbackURL, code string) (*oauth2.Token, error) {
+	ctx := context.TODO()
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.oauth2HTTPClient)
+
+	var config = c.oauth2Config(callbackURL)
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return nil, errors.Errorf("cannot get oauth2 token: %w", err)
+	}
+	return token, nil
+}
+
+func (c *Client) RefreshOauth2Token(refreshToken string) (*oauth2.Token, error) {
+	ctx := context.TODO()
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.oauth2HTTPClient)
+
+	var config = c.oauth2Config("")
+	token := &oauth2.Token{RefreshToken: refreshToken}
+	ts := config.TokenSource(ctx, token)
+	return ts.Token()
+}
+
+func (c *Client) apiURL(p string, query url.Values) string {
+	u := c.APIURL + p
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (c *Client) doRequest(method, u string, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Authorization") == "" && c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &apiError{code: resp.StatusCode, message: strings.TrimSpace(string(data))}
+	}
+
+	return resp, nil
+}
+
+func (c *Client) getRaw(u string, header http.Header) ([]byte, error) {
+	resp, err := c.doRequest("GET", u, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (c *Client) getJSON(u string, header http.Header, obj interface{}) error {
+	resp, err := c.doRequest("GET", u, header, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(obj)
+}
+
+func (c *Client) sendJSON(method, u string, header http.Header, req, obj interface{}) error {
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+
+	resp, err := c.doRequest(method, u, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if obj == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(obj)
+}
+
+func (c *Client) LoginPassword(username, password, tokenName string) (string, error) {
+	if c.cloud {
+		return "", errors.Errorf("password login isn't supported by bitbucket cloud")
+	}
+	return c.serverLoginPassword(username, password, tokenName)
+}
+
+func (c *Client) GetUserInfo() (*gitsource.UserInfo, error) {
+	if c.cloud {
+		return c.cloudGetUserInfo()
+	}
+	return c.serverGetUserInfo()
+}
+
+func (c *Client) GetRepoInfo(repopath string) (*gitsource.RepoInfo, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+	if c.cloud {
+		return c.cloudGetRepoInfo(owner, reponame)
+	}
+	return c.serverGetRepoInfo(owner, reponame)
+}
+
+func (c *Client) GetFile(repopath, commit, file string) ([]byte, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+	if c.cloud {
+		return c.cloudGetFile(owner, reponame, commit, file)
+	}
+	return c.serverGetFile(owner, reponame, commit, file)
+}
+
+func (c *Client) CreateDeployKey(repopath, title, pubKey string, readonly bool) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	if c.cloud {
+		err = c.cloudCreateDeployKey(owner, reponame, title, pubKey, readonly)
+	} else {
+		err = c.serverCreateDeployKey(owner, reponame, title, pubKey, readonly)
+	}
+	if err != nil {
+		return errors.Errorf("error creating deploy key: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) UpdateDeployKey(repopath, title, pubKey string, readonly bool) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	if c.cloud {
+		return c.cloudUpdateDeployKey(owner, reponame, title, pubKey, readonly)
+	}
+	return c.serverUpdateDeployKey(owner, reponame, title, pubKey, readonly)
+}
+
+func (c *Client) DeleteDeployKey(repopath, title string) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	if c.cloud {
+		return c.cloudDeleteDeployKeys(owner, reponame, title, "")
+	}
+	return c.serverDeleteDeployKeys(owner, reponame, title, "")
+}
+
+func (c *Client) CreateRepoWebhook(repopath, url, secret string) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	if c.cloud {
+		err = c.cloudCreateRepoWebhook(owner, reponame, url, secret)
+	} else {
+		err = c.serverCreateRepoWebhook(owner, reponame, url, secret)
+	}
+	if err != nil {
+		return errors.Errorf("error creating repository webhook: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) DeleteRepoWebhook(repopath, u string) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	if c.cloud {
+		return c.cloudDeleteRepoWebhook(owner, reponame, u)
+	}
+	return c.serverDeleteRepoWebhook(owner, reponame, u)
+}
+
+func (c *Client) CreateCommitStatus(repopath, commitSHA string, status gitsource.CommitStatus, targetURL, description, context string) error {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return err
+	}
+	if c.cloud {
+		return c.cloudCreateCommitStatus(owner, reponame, commitSHA, status, targetURL, description, context)
+	}
+	return c.serverCreateCommitStatus(commitSHA, status, targetURL, description, context)
+}
+
+func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
+	if c.cloud {
+		return c.cloudListUserRepos()
+	}
+	return c.serverListUserRepos()
+}
+
+func (c *Client) GetRef(repopath, ref string) (*gitsource.Ref, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+	if c.cloud {
+		return c.cloudGetRef(owner, reponame, ref)
+	}
+	return c.serverGetRef(owner, reponame, ref)
+}
+
+func (c *Client) RefType(ref string) (gitsource.RefType, string, error) {
+	switch {
+	case strings.HasPrefix(ref, branchRefPrefix):
+		return gitsource.RefTypeBranch, strings.TrimPrefix(ref, branchRefPrefix), nil
+
+	case strings.HasPrefix(ref, tagRefPrefix):
+		return gitsource.RefTypeTag, strings.TrimPrefix(ref, tagRefPrefix), nil
+
+	case pullRequestRefRegex.MatchString(ref):
+		m := pullRequestRefRegex.FindStringSubmatch(ref)
+		return gitsource.RefTypePullRequest, m[1], nil
+
+	default:
+		return -1, "", errors.Errorf("unsupported ref: %s", ref)
+	}
+}
+
+func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return nil, err
+	}
+	if c.cloud {
+		return c.cloudGetCommit(owner, reponame, commitSHA)
+	}
+	return c.serverGetCommit(owner, reponame, commitSHA)
+}
+
+func (c *Client) IsCollaborator(repopath, user string) (bool, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return false, err
+	}
+	if c.cloud {
+		return c.cloudIsCollaborator(owner, reponame, user)
+	}
+	return c.serverIsCollaborator(owner, reponame, user)
+}
+
+func (c *Client) BranchRef(branch string) string {
+	return branchRefPrefix + branch
+}
+
+func (c *Client) TagRef(tag string) string {
+	return tagRefPrefix + tag
+}
+
+func (c *Client) PullRequestRef(prID string) string {
+	return fmt.Sprintf(pullRequestRefFmt, prID)
+}
+
+func (c *Client) CommitLink(repoInfo *gitsource.RepoInfo, commitSHA string) string {
+	return fmt.Sprintf("%s/commits/%s", repoInfo.HTMLURL, commitSHA)
+}
+
+func (c *Client) BranchLink(repoInfo *gitsource.RepoInfo, branch string) string {
+	if c.cloud {
+		return fmt.Sprintf("%s/branch/%s", repoInfo.HTMLURL, branch)
+	}
+	return fmt.Sprintf("%s/browse?at=%s", repoInfo.HTMLURL, url.QueryEscape(branchRefPrefix+branch))
+}
+
+func (c *Client) TagLink(repoInfo *gitsource.RepoInfo, tag string) string {
+	if c.cloud {
+		return fmt.Sprintf("%s/src/%s", repoInfo.HTMLURL, tag)
+	}
+	return fmt.Sprintf("%s/browse?at=%s", repoInfo.HTMLURL, url.QueryEscape(tagRefPrefix+tag))
+}
+
+func (c *Client) PullRequestLink(repoInfo *gitsource.RepoInfo, prID string) string {
+	return fmt.Sprintf("%s/pull-requests/%s", repoInfo.HTMLURL, prID)
+}
@@ -0,0 +1,352 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+
+	gitsource "agola.io/agola/internal/gitsources"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Bitbucket Cloud api 2.0 implementation
+
+var (
+	cloudWebhookEvents = []string{cloudHookPush, cloudHookPRCreated, cloudHookPRUpdated}
+)
+
+func cloudRepoPath(owner, reponame string) string {
+	return fmt.Sprintf("%s/repositories/%s/%s", cloudAPIPrefix, url.PathEscape(owner), url.PathEscape(reponame))
+}
+
+// cloudList calls fn for every page returned by a Bitbucket Cloud paged api
+func (c *Client) cloudList(p string, query url.Values, fn func(values json.RawMessage) error) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("pagelen", "100")
+
+	u := c.apiURL(p, query)
+	for u != "" {
+		var page cloudPage
+		if err := c.getJSON(u, nil, &page); err != nil {
+			return err
+		}
+		if err := fn(page.Values); err != nil {
+			return err
+		}
+		u = page.Next
+	}
+
+	return nil
+}
+
+func (c *Client) cloudGetUserInfo() (*gitsource.UserInfo, error) {
+	user := &cloudUser{}
+	if err := c.getJSON(c.apiURL(cloudAPIPrefix+"/user", nil), nil, user); err != nil {
+		return nil, err
+	}
+
+	var email string
+	err := c.cloudList(cloudAPIPrefix+"/user/emails", nil, func(values json.RawMessage) error {
+		var emails []*cloudEmail
+		if err := json.Unmarshal(values, &emails); err != nil {
+			return err
+		}
+		for _, e := range emails {
+			if e.IsPrimary && e.IsConfirmed {
+				email = e.Email
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	loginName := user.Username
+	if loginName == "" {
+		loginName = user.Nickname
+	}
+	return &gitsource.UserInfo{
+		ID:        user.UUID,
+		LoginName: loginName,
+		Email:     email,
+	}, nil
+}
+
+func fromCloudRepo(rr *cloudRepository) *gitsource.RepoInfo {
+	repoInfo := &gitsource.RepoInfo{
+		ID:            rr.UUID,
+		Path:          rr.FullName,
+		HTMLURL:       rr.Links.HTML.Href,
+		DefaultBranch: rr.MainBranch.Name,
+	}
+	for _, l := range rr.Links.Clone {
+		switch l.Name {
+		case "ssh":
+			repoInfo.SSHCloneURL = l.Href
+		case "https":
+			repoInfo.HTTPCloneURL = l.Href
+		}
+	}
+	return repoInfo
+}
+
+func (c *Client) cloudGetRepoInfo(owner, reponame string) (*gitsource.RepoInfo, error) {
+	rr := &cloudRepository{}
+	if err := c.getJSON(c.apiURL(cloudRepoPath(owner, reponame), nil), nil, rr); err != nil {
+		return nil, err
+	}
+	return fromCloudRepo(rr), nil
+}
+
+func (c *Client) cloudGetFile(owner, reponame, commit, file string) ([]byte, error) {
+	p := cloudRepoPath(owner, reponame) + "/src/" + url.PathEscape(commit) + "/" + strings.TrimPrefix((&url.URL{Path: file}).EscapedPath(), "/")
+	return c.getRaw(c.apiURL(p, nil), nil)
+}
+
+func (c *Client) cloudListDeployKeys(owner, reponame string) ([]*cloudDeployKey, error) {
+	keys := []*cloudDeployKey{}
+	err := c.cloudList(cloudRepoPath(owner, reponame)+"/deploy-keys", nil, func(values json.RawMessage) error {
+		var pageKeys []*cloudDeployKey
+		if err := json.Unmarshal(values, &pageKeys); err != nil {
+			return err
+		}
+		keys = append(keys, pageKeys...)
+		return nil
+	})
+	return keys, err
+}
+
+func (c *Client) cloudCreateDeployKey(owner, reponame, title, pubKey string, readonly bool) error {
+	if !readonly {
+		return errors.Errorf("bitbucket cloud supports only read only deploy keys")
+	}
+	key := &cloudDeployKey{
+		Key:   pubKey,
+		Label: title,
+	}
+	return c.sendJSON("POST", c.apiURL(cloudRepoPath(owner, reponame)+"/deploy-keys", nil), nil, key, nil)
+}
+
+func (c *Client) cloudUpdateDeployKey(owner, reponame, title, pubKey string, readonly bool) error {
+	keys, err := c.cloudListDeployKeys(owner, reponame)
+	if err != nil {
+		return errors.Errorf("error retrieving existing deploy keys: %w", err)
+	}
+	// update the key only when the public key value has changed
+	for _, key := range keys {
+		if key.Label == title && sameAuthorizedKey(key.Key, pubKey) {
+			return nil
+		}
+	}
+
+	if err := c.cloudDeleteDeployKeys(owner, reponame, title, pubKey); err != nil {
+		return err
+	}
+	if err := c.cloudCreateDeployKey(owner, reponame, title, pubKey, readonly); err != nil {
+		return errors.Errorf("error creating deploy key: %w", err)
+	}
+
+	return nil
+}
+
+// cloudDeleteDeployKeys removes the deploy keys with the provided title,
+// excluding the ones with the provided public key value
+func (c *Client) cloudDeleteDeployKeys(owner, reponame, title, keepPubKey string) error {
+	keys, err := c.cloudListDeployKeys(owner, reponame)
+	if err != nil {
+		return errors.Errorf("error retrieving existing deploy keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if key.Label != title || (keepPubKey != "" && sameAuthorizedKey(key.Key, keepPubKey)) {
+			continue
+		}
+		p := fmt.Sprintf("%s/deploy-keys/%d", cloudRepoPath(owner, reponame), key.ID)
+		if err := c.sendJSON("DELETE", c.apiURL(p, nil), nil, nil, nil); err != nil {
+			return errors.Errorf("error removing existing deploy key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// sameAuthorizedKey reports if the two authorized keys have the same type and
+// value since bitbucket cloud removes the key comment
+func sameAuthorizedKey(a, b string) bool {
+	af := strings.Fields(a)
+	bf := strings.Fields(b)
+	if len(af) < 2 || len(bf) < 2 {
+		return false
+	}
+	return af[0] == bf[0] && af[1] == bf[1]
+}
+
+func (c *Client) cloudCreateRepoWebhook(owner, reponame, u, secret string) error {
+	hook := &cloudWebhook{
+		Description: "agola",
+		URL:         u,
+		Active:      true,
+		Secret:      secret,
+		Events:      cloudWebhookEvents,
+	}
+	return c.sendJSON("POST", c.apiURL(cloudRepoPath(owner, reponame)+"/hooks", nil), nil, hook, nil)
+}
+
+func (c *Client) cloudDeleteRepoWebhook(owner, reponame, u string) error {
+	p := cloudRepoPath(owner, reponame) + "/hooks"
+	hooks := []*cloudWebhook{}
+	err := c.cloudList(p, nil, func(values json.RawMessage) error {
+		var pageHooks []*cloudWebhook
+		if err := json.Unmarshal(values, &pageHooks); err != nil {
+			return err
+		}
+		hooks = append(hooks, pageHooks...)
+		return nil
+	})
+	if err != nil {
+		return errors.Errorf("error retrieving repository webhooks: %w", err)
+	}
+
+	// match the full url so we can have multiple webhooks for different agola
+	// projects
+	for _, hook := range hooks {
+		if hook.URL == u {
+			if err := c.sendJSON("DELETE", c.apiURL(p+"/"+url.PathEscape(hook.UUID), nil), nil, nil, nil); err != nil {
+				return errors.Errorf("error deleting existing repository webhook: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) cloudCreateCommitStatus(owner, reponame, commitSHA string, status gitsource.CommitStatus, targetURL, description, context string) error {
+	bs := &cloudBuildStatus{
+		State:       fromCommitStatus(status),
+		Key:         context,
+		Name:        context,
+		URL:         targetURL,
+		Description: description,
+	}
+	p := fmt.Sprintf("%s/commit/%s/statuses/build", cloudRepoPath(owner, reponame), url.PathEscape(commitSHA))
+	return c.sendJSON("POST", c.apiURL(p, nil), nil, bs, nil)
+}
+
+func (c *Client) cloudListUserRepos() ([]*gitsource.RepoInfo, error) {
+	repos := []*gitsource.RepoInfo{}
+
+	// keep only repos with admin permissions
+	query := url.Values{"role": []string{"admin"}}
+	err := c.cloudList(cloudAPIPrefix+"/repositories", query, func(values json.RawMessage) error {
+		var remoteRepos []*cloudRepository
+		if err := json.Unmarshal(values, &remoteRepos); err != nil {
+			return err
+		}
+		for _, rr := range remoteRepos {
+			repos = append(repos, fromCloudRepo(rr))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+func (c *Client) cloudGetCommit(owner, reponame, commitSHA string) (*gitsource.Commit, error) {
+	commit := &cloudCommit{}
+	if err := c.getJSON(c.apiURL(cloudRepoPath(owner, reponame)+"/commit/"+url.PathEscape(commitSHA), nil), nil, commit); err != nil {
+		return nil, err
+	}
+	authorName, authorEmail := parseCloudCommitAuthor(commit.Author.Raw)
+	return &gitsource.Commit{
+		SHA:         commit.Hash,
+		Message:     commit.Message,
+		AuthorName:  authorName,
+		AuthorEmail: authorEmail,
+	}, nil
+}
+
+// parseCloudCommitAuthor splits the raw commit author ("Name <email>") in its
+// name and email
+func parseCloudCommitAuthor(raw string) (string, string) {
+	addr, err := mail.ParseAddress(raw)
+	if err != nil {
+		return strings.TrimSpace(raw), ""
+	}
+	return addr.Name, addr.Address
+}
+
+func (c *Client) cloudGetRef(owner, reponame, ref string) (*gitsource.Ref, error) {
+	refType, name, err := c.RefType(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var commitSHA string
+	switch refType {
+	case gitsource.RefTypeBranch, gitsource.RefTypeTag:
+		refsPath := "/refs/branches/"
+		if refType == gitsource.RefTypeTag {
+			refsPath = "/refs/tags/"
+		}
+		remoteRef := &cloudRef{}
+		if err := c.getJSON(c.apiURL(cloudRepoPath(owner, reponame)+refsPath+url.PathEscape(name), nil), nil, remoteRef); err != nil {
+			if isStatusCode(err, http.StatusNotFound) {
+				return nil, errors.Errorf("no ref %q for repository %q", ref, owner+"/"+reponame)
+			}
+			return nil, err
+		}
+		commitSHA = remoteRef.Target.Hash
+
+	case gitsource.RefTypePullRequest:
+		if _, err := strconv.ParseInt(name, 10, 64); err != nil {
+			return nil, errors.Errorf("wrong pull request id %q", name)
+		}
+		pr := &cloudPullRequest{}
+		if err := c.getJSON(c.apiURL(cloudRepoPath(owner, reponame)+"/pullrequests/"+name, nil), nil, pr); err != nil {
+			return nil, err
+		}
+		commitSHA = pr.Source.Commit.Hash
+	}
+
+	return &gitsource.Ref{
+		Ref:       ref,
+		CommitSHA: commitSHA,
+	}, nil
+}
+
+func (c *Client) cloudIsCollaborator(owner, reponame, user string) (bool, error) {
+	perm := &cloudPermission{}
+	if err := c.getJSON(c.apiURL(cloudRepoPath(owner, reponame)+"/permissions-config/users/"+url.PathEscape(user), nil), nil, perm); err != nil {
+		if isStatusCode(err, http.StatusNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return perm.Permission == "write" || perm.Permission == "admin", nil
+}
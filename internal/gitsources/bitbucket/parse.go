@@ -0,0 +1,329 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbucket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	hookEvent       = "X-Event-Key"
+	signatureHeader = "X-Hub-Signature"
+	signaturePrefix = "sha256="
+
+	// bitbucket server events
+	serverHookPing             = "diagnostics:ping"
+	serverHookPush             = "repo:refs_changed"
+	serverHookPROpened         = "pr:opened"
+	serverHookPRFromRefUpdated = "pr:from_ref_updated"
+
+	// bitbucket cloud events
+	cloudHookPush      = "repo:push"
+	cloudHookPRCreated = "pullrequest:created"
+	cloudHookPRUpdated = "pullrequest:updated"
+
+	prStateOpen = "OPEN"
+
+	serverRefChangeDelete = "DELETE"
+)
+
+func (c *Client) ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, 10*1024*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	// verify signature
+	if secret != "" {
+		signature := r.Header.Get(signatureHeader)
+		if !strings.HasPrefix(signature, signaturePrefix) {
+			return nil, errors.Errorf("wrong webhook signature")
+		}
+		ds, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+		if err != nil {
+			return nil, errors.Errorf("wrong webhook signature")
+		}
+		h := hmac.New(sha256.New, []byte(secret))
+		if _, err := h.Write(data); err != nil {
+			return nil, errors.Errorf("failed to calculate webhook signature")
+		}
+		cs := h.Sum(nil)
+		if !hmac.Equal(cs, ds) {
+			return nil, errors.Errorf("wrong webhook signature")
+		}
+	}
+
+	var whd *types.WebhookData
+	switch r.Header.Get(hookEvent) {
+	case serverHookPing:
+		return nil, nil
+	case serverHookPush:
+		whd, err = c.parseServerPushHook(data)
+	case serverHookPROpened, serverHookPRFromRefUpdated:
+		whd, err = c.parseServerPullRequestHook(data)
+	case cloudHookPush:
+		whd, err = c.parseCloudPushHook(data)
+	case cloudHookPRCreated, cloudHookPRUpdated:
+		whd, err = c.parseCloudPullRequestHook(data)
+	default:
+		return nil, errors.Errorf("unknown webhook event type: %q", r.Header.Get(hookEvent))
+	}
+	if err != nil || whd == nil {
+		return nil, err
+	}
+
+	// the webhook payloads don't report the repository ssh clone url
+	repoInfo, err := c.GetRepoInfo(whd.Repo.Path)
+	if err != nil {
+		return nil, errors.Errorf("failed to get repository info: %w", err)
+	}
+	whd.SSHURL = repoInfo.SSHCloneURL
+
+	// bitbucket server push payloads don't report the commit message and
+	// bitbucket cloud pull request payloads report an abbreviated commit sha
+	if whd.Message == "" || (whd.Event == types.WebhookEventPullRequest && c.cloud) {
+		commit, err := c.GetCommit(whd.Repo.Path, whd.CommitSHA)
+		if err != nil {
+			return nil, errors.Errorf("failed to get commit %q: %w", whd.CommitSHA, err)
+		}
+		whd.CommitSHA = commit.SHA
+		whd.CommitLink = c.CommitLink(repoInfo, commit.SHA)
+		if whd.Message == "" {
+			whd.Message = commit.Message
+		}
+		whd.CommitMessage = commit.Message
+		whd.CommitAuthorName = commit.AuthorName
+		whd.CommitAuthorEmail = commit.AuthorEmail
+	}
+
+	return whd, nil
+}
+
+func (c *Client) parseServerPushHook(data []byte) (*types.WebhookData, error) {
+	push := new(serverPushHook)
+	if err := json.Unmarshal(data, push); err != nil {
+		return nil, err
+	}
+	if len(push.Changes) == 0 {
+		return nil, errors.Errorf("no ref changes in push webhook")
+	}
+	// TODO(sgotti) handle multiple ref changes in the same push
+	change := push.Changes[0]
+	// skip deleted refs
+	if change.Type == serverRefChangeDelete {
+		return nil, nil
+	}
+
+	repoInfo := &gitsource.RepoInfo{HTMLURL: serverRepoWebURL(c.WebURL, &push.Repository)}
+
+	// common data
+	whd := &types.WebhookData{
+		CommitSHA:   change.ToHash,
+		Ref:         change.RefID,
+		CompareLink: fmt.Sprintf("%s/compare/commits?sourceBranch=%s&targetBranch=%s", repoInfo.HTMLURL, change.ToHash, change.FromHash),
+		CommitLink:  c.CommitLink(repoInfo, change.ToHash),
+		Sender:      push.Actor.Slug,
+
+		Repo: types.WebhookDataRepo{
+			Path:   path.Join(push.Repository.Project.Key, push.Repository.Slug),
+			WebURL: repoInfo.HTMLURL,
+		},
+	}
+
+	if err := c.setPushRefData(whd, repoInfo); err != nil {
+		return nil, err
+	}
+
+	return whd, nil
+}
+
+func (c *Client) parseServerPullRequestHook(data []byte) (*types.WebhookData, error) {
+	prhook := new(serverPullRequestHook)
+	if err := json.Unmarshal(data, prhook); err != nil {
+		return nil, err
+	}
+	pr := prhook.PullRequest
+
+	// skip non open pull requests
+	if pr.State != prStateOpen {
+		return nil, nil
+	}
+
+	prID := strconv.FormatInt(pr.ID, 10)
+	repoInfo := &gitsource.RepoInfo{HTMLURL: serverRepoWebURL(c.WebURL, &pr.ToRef.Repository)}
+
+	whd := &types.WebhookData{
+		Event:           types.WebhookEventPullRequest,
+		CommitSHA:       pr.FromRef.LatestCommit,
+		Ref:             c.PullRequestRef(prID),
+		CommitLink:      c.CommitLink(repoInfo, pr.FromRef.LatestCommit),
+		Message:         pr.Title,
+		Sender:          prhook.Actor.Slug,
+		PullRequestID:   prID,
+		PullRequestLink: c.PullRequestLink(repoInfo, prID),
+		PRFromSameRepo:  pr.FromRef.Repository.ID == pr.ToRef.Repository.ID,
+		PRAuthor:        pr.Author.User.Slug,
+		PRBaseBranch:    pr.ToRef.DisplayID,
+
+		Repo: types.WebhookDataRepo{
+			Path:   path.Join(pr.ToRef.Repository.Project.Key, pr.ToRef.Repository.Slug),
+			WebURL: repoInfo.HTMLURL,
+		},
+	}
+
+	return whd, nil
+}
+
+func (c *Client) parseCloudPushHook(data []byte) (*types.WebhookData, error) {
+	push := new(cloudPushHook)
+	if err := json.Unmarshal(data, push); err != nil {
+		return nil, err
+	}
+	if len(push.Push.Changes) == 0 {
+		return nil, errors.Errorf("no ref changes in push webhook")
+	}
+	// TODO(sgotti) handle multiple ref changes in the same push
+	change := push.Push.Changes[0]
+	// skip deleted refs
+	if change.New == nil {
+		return nil, nil
+	}
+
+	var ref string
+	switch change.New.Type {
+	case "branch":
+		ref = c.BranchRef(change.New.Name)
+	case "tag":
+		ref = c.TagRef(change.New.Name)
+	default:
+		// ignore received webhook since it doesn't have a ref we're interested in
+		return nil, errors.Errorf("unsupported webhook ref type %q", change.New.Type)
+	}
+
+	repoInfo := &gitsource.RepoInfo{HTMLURL: push.Repository.Links.HTML.Href}
+
+	// common data
+	whd := &types.WebhookData{
+		CommitSHA:   change.New.Target.Hash,
+		Ref:         ref,
+		CompareLink: change.Links.HTML.Href,
+		CommitLink:  c.CommitLink(repoInfo, change.New.Target.Hash),
+		Sender:      cloudUserName(&push.Actor),
+
+		Repo: types.WebhookDataRepo{
+			Path:   push.Repository.FullName,
+			WebURL: repoInfo.HTMLURL,
+		},
+	}
+
+	if err := c.setPushRefData(whd, repoInfo); err != nil {
+		return nil, err
+	}
+	if whd.Event == types.WebhookEventPush {
+		whd.Message = change.New.Target.Message
+	}
+
+	return whd, nil
+}
+
+func (c *Client) parseCloudPullRequestHook(data []byte) (*types.WebhookData, error) {
+	prhook := new(cloudPullRequestHook)
+	if err := json.Unmarshal(data, prhook); err != nil {
+		return nil, err
+	}
+	pr := prhook.PullRequest
+
+	// skip non open pull requests
+	if pr.State != prStateOpen {
+		return nil, nil
+	}
+	// bitbucket cloud doesn't provide pull request git refs so we can only
+	// fetch the source branch of pull requests from the same repository
+	if pr.Source.Repository.UUID != pr.Destination.Repository.UUID {
+		return nil, nil
+	}
+
+	prID := strconv.FormatInt(pr.ID, 10)
+	repoInfo := &gitsource.RepoInfo{HTMLURL: prhook.Repository.Links.HTML.Href}
+
+	whd := &types.WebhookData{
+		Event:           types.WebhookEventPullRequest,
+		CommitSHA:       pr.Source.Commit.Hash,
+		Ref:             c.BranchRef(pr.Source.Branch.Name),
+		CommitLink:      c.CommitLink(repoInfo, pr.Source.Commit.Hash),
+		Message:         pr.Title,
+		Sender:          cloudUserName(&prhook.Actor),
+		PullRequestID:   prID,
+		PullRequestLink: c.PullRequestLink(repoInfo, prID),
+		PRFromSameRepo:  true,
+		PRAuthor:        pr.Author.UUID,
+		PRBaseBranch:    pr.Destination.Branch.Name,
+
+		Repo: types.WebhookDataRepo{
+			Path:   prhook.Repository.FullName,
+			WebURL: repoInfo.HTMLURL,
+		},
+	}
+
+	return whd, nil
+}
+
+// setPushRefData sets the webhook event and the branch or tag data from the
+// webhook ref
+func (c *Client) setPushRefData(whd *types.WebhookData, repoInfo *gitsource.RepoInfo) error {
+	refType, name, err := c.RefType(whd.Ref)
+	if err != nil {
+		// ignore received webhook since it doesn't have a ref we're interested in
+		return errors.Errorf("unsupported webhook ref %q", whd.Ref)
+	}
+
+	switch refType {
+	case gitsource.RefTypeBranch:
+		whd.Event = types.WebhookEventPush
+		whd.Branch = name
+		whd.BranchLink = c.BranchLink(repoInfo, name)
+	case gitsource.RefTypeTag:
+		whd.Event = types.WebhookEventTag
+		whd.Tag = name
+		whd.TagLink = c.TagLink(repoInfo, name)
+		whd.Message = fmt.Sprintf("Tag %s", whd.Tag)
+	default:
+		return errors.Errorf("unsupported webhook ref %q", whd.Ref)
+	}
+
+	return nil
+}
+
+func cloudUserName(user *cloudUser) string {
+	if user.Nickname != "" {
+		return user.Nickname
+	}
+	return user.DisplayName
+}
@@ -0,0 +1,381 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbucket
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	gitsource "agola.io/agola/internal/gitsources"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Bitbucket Server REST api 1.0 implementation
+
+var (
+	serverWebhookEvents = []string{serverHookPush, serverHookPROpened, serverHookPRFromRefUpdated}
+
+	serverAccessTokenPermissions = []string{"PROJECT_READ", "REPO_ADMIN"}
+)
+
+func serverRepoPath(owner, reponame string) string {
+	return fmt.Sprintf("/projects/%s/repos/%s", url.PathEscape(owner), url.PathEscape(reponame))
+}
+
+// serverRepoWebURL returns the repository web url since the webhook payloads
+// don't report the repository links
+func serverRepoWebURL(webURL string, repo *serverRepository) string {
+	return webURL + serverRepoPath(repo.Project.Key, repo.Slug)
+}
+
+func basicAuthHeader(username, password string) http.Header {
+	header := http.Header{}
+	header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	return header
+}
+
+// serverList calls fn for every page returned by a Bitbucket Server paged api
+func (c *Client) serverList(p string, query url.Values, header http.Header, fn func(values json.RawMessage) error) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("limit", "100")
+
+	start := 0
+	for {
+		query.Set("start", strconv.Itoa(start))
+		var page serverPage
+		if err := c.getJSON(c.apiURL(p, query), header, &page); err != nil {
+			return err
+		}
+		if err := fn(page.Values); err != nil {
+			return err
+		}
+		if page.IsLastPage {
+			return nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+func (c *Client) serverLoginPassword(username, password, tokenName string) (string, error) {
+	header := basicAuthHeader(username, password)
+	p := serverAccessTokensPrefix + "/users/" + url.PathEscape(username)
+
+	// bitbucket server reports the token value only at creation time so remove
+	// an already existing agola access token and create a new one
+	tokens := []*serverAccessToken{}
+	err := c.serverList(p, nil, header, func(values json.RawMessage) error {
+		var pageTokens []*serverAccessToken
+		if err := json.Unmarshal(values, &pageTokens); err != nil {
+			return err
+		}
+		tokens = append(tokens, pageTokens...)
+		return nil
+	})
+	if err != nil {
+		if isStatusCode(err, http.StatusUnauthorized) {
+			return "", gitsource.ErrUnauthorized
+		}
+		return "", err
+	}
+	for _, token := range tokens {
+		if token.Name == tokenName {
+			if err := c.sendJSON("DELETE", c.apiURL(p+"/"+url.PathEscape(token.ID), nil), header, nil, nil); err != nil {
+				return "", errors.Errorf("error removing existing access token: %w", err)
+			}
+		}
+	}
+
+	token := &serverAccessToken{}
+	if err := c.sendJSON("PUT", c.apiURL(p, nil), header, &serverAccessToken{Name: tokenName, Permissions: serverAccessTokenPermissions}, token); err != nil {
+		return "", errors.Errorf("error creating access token: %w", err)
+	}
+
+	return token.Token, nil
+}
+
+func (c *Client) serverGetUserInfo() (*gitsource.UserInfo, error) {
+	data, err := c.getRaw(c.WebURL+"/plugins/servlet/applinks/whoami", nil)
+	if err != nil {
+		return nil, err
+	}
+	username := strings.TrimSpace(string(data))
+	if username == "" {
+		return nil, errors.Errorf("empty bitbucket user name")
+	}
+
+	user := &serverUser{}
+	if err := c.getJSON(c.apiURL(serverAPIPrefix+"/users/"+url.PathEscape(username), nil), nil, user); err != nil {
+		return nil, err
+	}
+	return &gitsource.UserInfo{
+		ID:        strconv.FormatInt(user.ID, 10),
+		LoginName: user.Slug,
+		Email:     user.EmailAddress,
+	}, nil
+}
+
+func fromServerRepo(rr *serverRepository) *gitsource.RepoInfo {
+	repoInfo := &gitsource.RepoInfo{
+		ID:   strconv.FormatInt(rr.ID, 10),
+		Path: path.Join(rr.Project.Key, rr.Slug),
+	}
+	if len(rr.Links.Self) > 0 {
+		repoInfo.HTMLURL = strings.TrimSuffix(rr.Links.Self[0].Href, "/browse")
+	}
+	for _, l := range rr.Links.Clone {
+		switch l.Name {
+		case "ssh":
+			repoInfo.SSHCloneURL = l.Href
+		case "http":
+			repoInfo.HTTPCloneURL = l.Href
+		}
+	}
+	return repoInfo
+}
+
+func (c *Client) serverGetRepoInfo(owner, reponame string) (*gitsource.RepoInfo, error) {
+	rr := &serverRepository{}
+	if err := c.getJSON(c.apiURL(serverAPIPrefix+serverRepoPath(owner, reponame), nil), nil, rr); err != nil {
+		return nil, err
+	}
+	return fromServerRepo(rr), nil
+}
+
+func (c *Client) serverGetFile(owner, reponame, commit, file string) ([]byte, error) {
+	p := serverAPIPrefix + serverRepoPath(owner, reponame) + "/raw/" + strings.TrimPrefix((&url.URL{Path: file}).EscapedPath(), "/")
+	return c.getRaw(c.apiURL(p, url.Values{"at": []string{commit}}), nil)
+}
+
+func (c *Client) serverListDeployKeys(owner, reponame string) ([]*serverAccessKey, error) {
+	keys := []*serverAccessKey{}
+	err := c.serverList(serverKeysPrefix+serverRepoPath(owner, reponame)+"/ssh", nil, nil, func(values json.RawMessage) error {
+		var pageKeys []*serverAccessKey
+		if err := json.Unmarshal(values, &pageKeys); err != nil {
+			return err
+		}
+		keys = append(keys, pageKeys...)
+		return nil
+	})
+	return keys, err
+}
+
+func (c *Client) serverCreateDeployKey(owner, reponame, title, pubKey string, readonly bool) error {
+	permission := "REPO_WRITE"
+	if readonly {
+		permission = "REPO_READ"
+	}
+	key := &serverAccessKey{
+		Key: serverKey{
+			Text:  pubKey,
+			Label: title,
+		},
+		Permission: permission,
+	}
+	return c.sendJSON("POST", c.apiURL(serverKeysPrefix+serverRepoPath(owner, reponame)+"/ssh", nil), nil, key, nil)
+}
+
+func (c *Client) serverUpdateDeployKey(owner, reponame, title, pubKey string, readonly bool) error {
+	keys, err := c.serverListDeployKeys(owner, reponame)
+	if err != nil {
+		return errors.Errorf("error retrieving existing deploy keys: %w", err)
+	}
+	// update the key only when the public key value has changed
+	for _, key := range keys {
+		if key.Key.Label == title && sameAuthorizedKey(key.Key.Text, pubKey) {
+			return nil
+		}
+	}
+
+	if err := c.serverDeleteDeployKeys(owner, reponame, title, pubKey); err != nil {
+		return err
+	}
+	if err := c.serverCreateDeployKey(owner, reponame, title, pubKey, readonly); err != nil {
+		return errors.Errorf("error creating deploy key: %w", err)
+	}
+
+	return nil
+}
+
+// serverDeleteDeployKeys removes the deploy keys with the provided title,
+// excluding the ones with the provided public key value
+func (c *Client) serverDeleteDeployKeys(owner, reponame, title, keepPubKey string) error {
+	keys, err := c.serverListDeployKeys(owner, reponame)
+	if err != nil {
+		return errors.Errorf("error retrieving existing deploy keys: %w", err)
+	}
+
+	for _, key := range keys {
+		if key.Key.Label != title || (keepPubKey != "" && sameAuthorizedKey(key.Key.Text, keepPubKey)) {
+			continue
+		}
+		p := fmt.Sprintf("%s%s/ssh/%d", serverKeysPrefix, serverRepoPath(owner, reponame), key.Key.ID)
+		if err := c.sendJSON("DELETE", c.apiURL(p, nil), nil, nil, nil); err != nil {
+			return errors.Errorf("error removing existing deploy key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) serverCreateRepoWebhook(owner, reponame, u, secret string) error {
+	hook := &serverWebhook{
+		Name:   "agola",
+		URL:    u,
+		Events: serverWebhookEvents,
+		Configuration: map[string]string{
+			"secret": secret,
+		},
+		Active: true,
+	}
+	return c.sendJSON("POST", c.apiURL(serverAPIPrefix+serverRepoPath(owner, reponame)+"/webhooks", nil), nil, hook, nil)
+}
+
+func (c *Client) serverDeleteRepoWebhook(owner, reponame, u string) error {
+	p := serverAPIPrefix + serverRepoPath(owner, reponame) + "/webhooks"
+	hooks := []*serverWebhook{}
+	err := c.serverList(p, nil, nil, func(values json.RawMessage) error {
+		var pageHooks []*serverWebhook
+		if err := json.Unmarshal(values, &pageHooks); err != nil {
+			return err
+		}
+		hooks = append(hooks, pageHooks...)
+		return nil
+	})
+	if err != nil {
+		return errors.Errorf("error retrieving repository webhooks: %w", err)
+	}
+
+	// match the full url so we can have multiple webhooks for different agola
+	// projects
+	for _, hook := range hooks {
+		if hook.URL == u {
+			if err := c.sendJSON("DELETE", c.apiURL(fmt.Sprintf("%s/%d", p, hook.ID), nil), nil, nil, nil); err != nil {
+				return errors.Errorf("error deleting existing repository webhook: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) serverCreateCommitStatus(commitSHA string, status gitsource.CommitStatus, targetURL, description, context string) error {
+	bs := &serverBuildStatus{
+		State:       fromCommitStatus(status),
+		Key:         context,
+		Name:        context,
+		URL:         targetURL,
+		Description: description,
+	}
+	return c.sendJSON("POST", c.apiURL(serverBuildStatusPrefix+"/commits/"+url.PathEscape(commitSHA), nil), nil, bs, nil)
+}
+
+func (c *Client) serverListUserRepos() ([]*gitsource.RepoInfo, error) {
+	repos := []*gitsource.RepoInfo{}
+
+	// keep only repos with admin permissions
+	query := url.Values{"permission": []string{"REPO_ADMIN"}}
+	err := c.serverList(serverAPIPrefix+"/repos", query, nil, func(values json.RawMessage) error {
+		var remoteRepos []*serverRepository
+		if err := json.Unmarshal(values, &remoteRepos); err != nil {
+			return err
+		}
+		for _, rr := range remoteRepos {
+			repos = append(repos, fromServerRepo(rr))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repos, nil
+}
+
+func (c *Client) serverGetCommit(owner, reponame, commitish string) (*gitsource.Commit, error) {
+	commit := &serverCommit{}
+	if err := c.getJSON(c.apiURL(serverAPIPrefix+serverRepoPath(owner, reponame)+"/commits/"+url.PathEscape(commitish), nil), nil, commit); err != nil {
+		return nil, err
+	}
+	return &gitsource.Commit{
+		SHA:         commit.ID,
+		Message:     commit.Message,
+		AuthorName:  commit.Author.Name,
+		AuthorEmail: commit.Author.EmailAddress,
+	}, nil
+}
+
+func (c *Client) serverGetRef(owner, reponame, ref string) (*gitsource.Ref, error) {
+	// the commits api also accepts a ref
+	commit, err := c.serverGetCommit(owner, reponame, ref)
+	if err != nil {
+		if isStatusCode(err, http.StatusNotFound) {
+			return nil, errors.Errorf("no ref %q for repository %q", ref, path.Join(owner, reponame))
+		}
+		return nil, err
+	}
+
+	return &gitsource.Ref{
+		Ref:       ref,
+		CommitSHA: commit.SHA,
+	}, nil
+}
+
+func (c *Client) serverIsCollaborator(owner, reponame, user string) (bool, error) {
+	checks := []struct {
+		p           string
+		permissions []string
+	}{
+		{p: serverAPIPrefix + serverRepoPath(owner, reponame) + "/permissions/users", permissions: []string{"REPO_WRITE", "REPO_ADMIN"}},
+		{p: serverAPIPrefix + "/projects/" + url.PathEscape(owner) + "/permissions/users", permissions: []string{"PROJECT_WRITE", "PROJECT_ADMIN"}},
+	}
+
+	for _, check := range checks {
+		found := false
+		err := c.serverList(check.p, url.Values{"filter": []string{user}}, nil, func(values json.RawMessage) error {
+			var perms []*serverPermission
+			if err := json.Unmarshal(values, &perms); err != nil {
+				return err
+			}
+			for _, perm := range perms {
+				if perm.User.Slug != user && perm.User.Name != user {
+					continue
+				}
+				for _, p := range check.permissions {
+					if perm.Permission == p {
+						found = true
+					}
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+		if found {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bitbucket
+
+import "encoding/json"
+
+// Bitbucket Server (REST API 1.0) types
+
+type serverLink struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type serverLinks struct {
+	Clone []serverLink `json:"clone"`
+	Self  []serverLink `json:"self"`
+}
+
+type serverProject struct {
+	ID   int64  `json:"id"`
+	Key  string `json:"key"`
+	Name string `json:"name"`
+}
+
+type serverRepository struct {
+	ID      int64         `json:"id"`
+	Slug    string        `json:"slug"`
+	Name    string        `json:"name"`
+	Project serverProject `json:"project"`
+	Links   serverLinks   `json:"links"`
+}
+
+type serverUser struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Slug         string `json:"slug"`
+	EmailAddress string `json:"emailAddress"`
+	DisplayName  string `json:"displayName"`
+}
+
+type serverRef struct {
+	ID           string           `json:"id"`
+	DisplayID    string           `json:"displayId"`
+	Type         string           `json:"type"`
+	LatestCommit string           `json:"latestCommit"`
+	Repository   serverRepository `json:"repository"`
+}
+
+type serverCommit struct {
+	ID      string     `json:"id"`
+	Message string     `json:"message"`
+	Author  serverUser `json:"author"`
+}
+
+type serverKey struct {
+	ID    int64  `json:"id,omitempty"`
+	Text  string `json:"text"`
+	Label string `json:"label"`
+}
+
+type serverAccessKey struct {
+	Key        serverKey `json:"key"`
+	Permission string    `json:"permission"`
+}
+
+type serverWebhook struct {
+	ID            int64             `json:"id,omitempty"`
+	Name          string            `json:"name"`
+	URL           string            `json:"url"`
+	Events        []string          `json:"events"`
+	Configuration map[string]string `json:"configuration,omitempty"`
+	Active        bool              `json:"active"`
+}
+
+type serverBuildStatus struct {
+	State       string `json:"state"`
+	Key         string `json:"key"`
+	Name        string `json:"name,omitempty"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type serverPermission struct {
+	User       serverUser `json:"user"`
+	Permission string     `json:"permission"`
+}
+
+type serverAccessToken struct {
+	ID          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Token       string   `json:"token,omitempty"`
+	Permissions []string `json:"permissions"`
+}
+
+// serverPage is a Bitbucket Server paged response
+type serverPage struct {
+	Values        json.RawMessage `json:"values"`
+	IsLastPage    bool            `json:"isLastPage"`
+	NextPageStart int             `json:"nextPageStart"`
+}
+
+// Bitbucket Cloud (API 2.0) types
+
+type cloudLink struct {
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type cloudLinks struct {
+	HTML  cloudLink   `json:"html"`
+	Clone []cloudLink `json:"clone"`
+}
+
+type cloudRepository struct {
+	UUID       string     `json:"uuid"`
+	FullName   string     `json:"full_name"`
+	Name       string     `json:"name"`
+	Links      cloudLinks `json:"links"`
+	MainBranch cloudRef   `json:"mainbranch"`
+}
+
+type cloudUser struct {
+	UUID        string `json:"uuid"`
+	AccountID   string `json:"account_id"`
+	Username    string `json:"username"`
+	Nickname    string `json:"nickname"`
+	DisplayName string `json:"display_name"`
+}
+
+type cloudEmail struct {
+	Email       string `json:"email"`
+	IsPrimary   bool   `json:"is_primary"`
+	IsConfirmed bool   `json:"is_confirmed"`
+}
+
+type cloudCommit struct {
+	Hash    string            `json:"hash"`
+	Message string            `json:"message"`
+	Author  cloudCommitAuthor `json:"author"`
+	Links   cloudLinks        `json:"links"`
+}
+
+type cloudCommitAuthor struct {
+	// Raw is the git commit author in the "Name <email>" format
+	Raw string `json:"raw"`
+}
+
+type cloudRef struct {
+	Type   string      `json:"type"`
+	Name   string      `json:"name"`
+	Target cloudCommit `json:"target"`
+}
+
+type cloudPullRequest struct {
+	ID     int64      `json:"id"`
+	Title  string     `json:"title"`
+	State  string     `json:"state"`
+	Author cloudUser  `json:"author"`
+	Links  cloudLinks `json:"links"`
+	Source struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+		Commit     cloudCommit     `json:"commit"`
+		Repository cloudRepository `json:"repository"`
+	} `json:"source"`
+	Destination struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+		Commit     cloudCommit     `json:"commit"`
+		Repository cloudRepository `json:"repository"`
+	} `json:"destination"`
+}
+
+type cloudDeployKey struct {
+	ID    int64  `json:"id,omitempty"`
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+type cloudWebhook struct {
+	UUID        string   `json:"uuid,omitempty"`
+	Description string   `json:"description"`
+	URL         string   `json:"url"`
+	Active      bool     `json:"active"`
+	Secret      string   `json:"secret,omitempty"`
+	Events      []string `json:"events"`
+}
+
+type cloudBuildStatus struct {
+	State       string `json:"state"`
+	Key         string `json:"key"`
+	Name        string `json:"name,omitempty"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type cloudPermission struct {
+	Permission string `json:"permission"`
+}
+
+// cloudPage is a Bitbucket Cloud paged response
+type cloudPage struct {
+	Values json.RawMessage `json:"values"`
+	Next   string          `json:"next"`
+}
+
+// Webhook payloads
+
+type serverPushHook struct {
+	EventKey   string           `json:"eventKey"`
+	Actor      serverUser       `json:"actor"`
+	Repository serverRepository `json:"repository"`
+	Changes    []struct {
+		Ref      serverRef `json:"ref"`
+		RefID    string    `json:"refId"`
+		FromHash string    `json:"fromHash"`
+		ToHash   string    `json:"toHash"`
+		Type     string    `json:"type"`
+	} `json:"changes"`
+}
+
+type serverPullRequestHook struct {
+	EventKey    string     `json:"eventKey"`
+	Actor       serverUser `json:"actor"`
+	PullRequest struct {
+		ID     int64  `json:"id"`
+		Title  string `json:"title"`
+		State  string `json:"state"`
+		Open   bool   `json:"open"`
+		Author struct {
+			User serverUser `json:"user"`
+		} `json:"author"`
+		FromRef serverRef   `json:"fromRef"`
+		ToRef   serverRef   `json:"toRef"`
+		Links   serverLinks `json:"links"`
+	} `json:"pullRequest"`
+}
+
+type cloudPushHook struct {
+	Actor      cloudUser       `json:"actor"`
+	Repository cloudRepository `json:"repository"`
+	Push       struct {
+		Changes []struct {
+			New     *cloudRef     `json:"new"`
+			Old     *cloudRef     `json:"old"`
+			Links   cloudLinks    `json:"links"`
+			Commits []cloudCommit `json:"commits"`
+		} `json:"changes"`
+	} `json:"push"`
+}
+
+type cloudPullRequestHook struct {
+	Actor       cloudUser        `json:"actor"`
+	Repository  cloudRepository  `json:"repository"`
+	PullRequest cloudPullRequest `json:"pullrequest"`
+}
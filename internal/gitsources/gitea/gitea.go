@@ -401,11 +401,12 @@ func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 
 func fromGiteaRepo(rr *gitea.Repository) *gitsource.RepoInfo {
 	return &gitsource.RepoInfo{
-		ID:           strconv.FormatInt(rr.ID, 10),
-		Path:         path.Join(rr.Owner.UserName, rr.Name),
-		HTMLURL:      rr.HTMLURL,
-		SSHCloneURL:  rr.SSHURL,
-		HTTPCloneURL: rr.CloneURL,
+		ID:            strconv.FormatInt(rr.ID, 10),
+		Path:          path.Join(rr.Owner.UserName, rr.Name),
+		HTMLURL:       rr.HTMLURL,
+		SSHCloneURL:   rr.SSHURL,
+		HTTPCloneURL:  rr.CloneURL,
+		DefaultBranch: rr.DefaultBranch,
 	}
 }
 
@@ -471,10 +472,28 @@ func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error
 		return nil, err
 	}
 
-	return &gitsource.Commit{
+	gcommit := &gitsource.Commit{
 		SHA:     commit.SHA,
 		Message: commit.RepoCommit.Message,
-	}, nil
+	}
+	if commit.RepoCommit.Author != nil {
+		gcommit.AuthorName = commit.RepoCommit.Author.Name
+		gcommit.AuthorEmail = commit.RepoCommit.Author.Email
+	}
+
+	return gcommit, nil
+}
+
+func (c *Client) IsCollaborator(repopath, user string) (bool, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return false, err
+	}
+	// the repo owner isn't reported as a collaborator
+	if owner == user {
+		return true, nil
+	}
+	return c.client.IsCollaborator(owner, reponame, user)
 }
 
 func (c *Client) BranchRef(branch string) string {
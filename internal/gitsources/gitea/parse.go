@@ -41,8 +41,9 @@ const (
 
 	prStateOpen = "open"
 
-	prActionOpen = "opened"
-	prActionSync = "synchronized"
+	prActionOpen  = "opened"
+	prActionSync  = "synchronized"
+	prActionClose = "closed"
 )
 
 func (c *Client) ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error) {
@@ -96,6 +97,12 @@ func parsePullRequestHook(data []byte) (*types.WebhookData, error) {
 		return nil, err
 	}
 
+	if prhook.Action == prActionClose {
+		whd := webhookDataFromPullRequest(prhook)
+		whd.Event = types.WebhookEventPullRequestClosed
+		return whd, nil
+	}
+
 	// skip non open pull requests
 	if prhook.PullRequest.State != prStateOpen {
 		return nil, nil
@@ -137,6 +144,13 @@ func webhookDataFromPush(hook *pushHook) (*types.WebhookData, error) {
 		if len(hook.Commits) > 0 {
 			whd.Message = hook.Commits[0].Message
 		}
+		for _, commit := range hook.Commits {
+			if commit.ID == hook.After {
+				whd.CommitMessage = commit.Message
+				whd.CommitAuthorName = commit.Author.Name
+				whd.CommitAuthorEmail = commit.Author.Email
+			}
+		}
 	case strings.HasPrefix(hook.Ref, "refs/tags/"):
 		whd.Event = types.WebhookEventTag
 		whd.Tag = strings.TrimPrefix(hook.Ref, "refs/tags/")
@@ -171,6 +185,8 @@ func webhookDataFromPullRequest(hook *pullRequestHook) *types.WebhookData {
 		PullRequestID:   strconv.FormatInt(hook.PullRequest.ID, 10),
 		PullRequestLink: hook.PullRequest.URL,
 		PRFromSameRepo:  prFromSameRepo,
+		PRAuthor:        hook.PullRequest.User.Username,
+		PRBaseBranch:    hook.PullRequest.Base.Ref,
 
 		Repo: types.WebhookDataRepo{
 			Path:   path.Join(hook.Repo.Owner.Username, hook.Repo.Name),
@@ -47,6 +47,10 @@ type pushHook struct {
 		ID      string `json:"id"`
 		Message string `json:"message"`
 		URL     string `json:"url"`
+		Author  struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+		} `json:"author"`
 	} `json:"commits"`
 
 	Sender struct {
@@ -418,11 +418,12 @@ func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 
 func fromGithubRepo(rr *github.Repository) *gitsource.RepoInfo {
 	return &gitsource.RepoInfo{
-		ID:           strconv.FormatInt(*rr.ID, 10),
-		Path:         path.Join(*rr.Owner.Login, *rr.Name),
-		HTMLURL:      *rr.HTMLURL,
-		SSHCloneURL:  *rr.SSHURL,
-		HTTPCloneURL: *rr.CloneURL,
+		ID:            strconv.FormatInt(*rr.ID, 10),
+		Path:          path.Join(*rr.Owner.Login, *rr.Name),
+		HTMLURL:       *rr.HTMLURL,
+		SSHCloneURL:   *rr.SSHURL,
+		HTTPCloneURL:  *rr.CloneURL,
+		DefaultBranch: rr.GetDefaultBranch(),
 	}
 }
 
@@ -483,11 +484,22 @@ func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error
 	}
 
 	return &gitsource.Commit{
-		SHA:     *commit.SHA,
-		Message: *commit.Message,
+		SHA:         *commit.SHA,
+		Message:     *commit.Message,
+		AuthorName:  commit.GetAuthor().GetName(),
+		AuthorEmail: commit.GetAuthor().GetEmail(),
 	}, nil
 }
 
+func (c *Client) IsCollaborator(repopath, user string) (bool, error) {
+	owner, reponame, err := parseRepoPath(repopath)
+	if err != nil {
+		return false, err
+	}
+	isCollaborator, _, err := c.client.Repositories.IsCollaborator(context.TODO(), owner, reponame, user)
+	return isCollaborator, err
+}
+
 func (c *Client) BranchRef(branch string) string {
 	return branchRefPrefix + branch
 }
@@ -30,8 +30,9 @@ import (
 const (
 	prStateOpen = "open"
 
-	prActionOpen = "opened"
-	prActionSync = "synchronize"
+	prActionOpen  = "opened"
+	prActionSync  = "synchronize"
+	prActionClose = "closed"
 )
 
 func (c *Client) ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error) {
@@ -81,6 +82,9 @@ func webhookDataFromPush(hook *github.PushEvent) (*types.WebhookData, error) {
 		whd.Branch = strings.TrimPrefix(*hook.Ref, "refs/heads/")
 		whd.BranchLink = fmt.Sprintf("%s/tree/%s", *hook.Repo.HTMLURL, whd.Branch)
 		whd.Message = *hook.HeadCommit.Message
+		whd.CommitMessage = *hook.HeadCommit.Message
+		whd.CommitAuthorName = hook.HeadCommit.GetAuthor().GetName()
+		whd.CommitAuthorEmail = hook.HeadCommit.GetAuthor().GetEmail()
 
 	case strings.HasPrefix(*hook.Ref, "refs/tags/"):
 		whd.Event = types.WebhookEventTag
@@ -103,13 +107,18 @@ func webhookDataFromPush(hook *github.PushEvent) (*types.WebhookData, error) {
 }
 
 func webhookDataFromPullRequest(hook *github.PullRequestEvent) (*types.WebhookData, error) {
-	// skip non open pull requests
-	if *hook.PullRequest.State != prStateOpen {
-		return nil, nil
-	}
-	// only accept actions that have new commits
-	if *hook.Action != prActionOpen && *hook.Action != prActionSync {
-		return nil, nil
+	event := types.WebhookEventPullRequest
+	if *hook.Action == prActionClose {
+		event = types.WebhookEventPullRequestClosed
+	} else {
+		// skip non open pull requests
+		if *hook.PullRequest.State != prStateOpen {
+			return nil, nil
+		}
+		// only accept actions that have new commits
+		if *hook.Action != prActionOpen && *hook.Action != prActionSync {
+			return nil, nil
+		}
 	}
 
 	sender := hook.Sender.Name
@@ -122,7 +131,7 @@ func webhookDataFromPullRequest(hook *github.PullRequestEvent) (*types.WebhookDa
 	}
 
 	whd := &types.WebhookData{
-		Event:           types.WebhookEventPullRequest,
+		Event:           event,
 		CommitSHA:       *hook.PullRequest.Head.SHA,
 		SSHURL:          *hook.Repo.SSHURL,
 		Ref:             fmt.Sprintf("refs/pull/%d/head", *hook.Number),
@@ -132,6 +141,8 @@ func webhookDataFromPullRequest(hook *github.PullRequestEvent) (*types.WebhookDa
 		PullRequestID:   strconv.Itoa(*hook.PullRequest.Number),
 		PullRequestLink: *hook.PullRequest.HTMLURL,
 		PRFromSameRepo:  prFromSameRepo,
+		PRAuthor:        hook.PullRequest.GetUser().GetLogin(),
+		PRBaseBranch:    hook.PullRequest.GetBase().GetRef(),
 
 		Repo: types.WebhookDataRepo{
 			Path:   path.Join(*hook.Repo.Owner.Login, *hook.Repo.Name),
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -295,11 +296,12 @@ func (c *Client) ListUserRepos() ([]*gitsource.RepoInfo, error) {
 
 func fromGitlabRepo(rr *gitlab.Project) *gitsource.RepoInfo {
 	return &gitsource.RepoInfo{
-		ID:           strconv.Itoa(rr.ID),
-		Path:         rr.PathWithNamespace,
-		HTMLURL:      rr.WebURL,
-		SSHCloneURL:  rr.SSHURLToRepo,
-		HTTPCloneURL: rr.HTTPURLToRepo,
+		ID:            strconv.Itoa(rr.ID),
+		Path:          rr.PathWithNamespace,
+		HTMLURL:       rr.WebURL,
+		SSHCloneURL:   rr.SSHURLToRepo,
+		HTTPCloneURL:  rr.HTTPURLToRepo,
+		DefaultBranch: rr.DefaultBranch,
 	}
 }
 
@@ -359,11 +361,36 @@ func (c *Client) GetCommit(repopath, commitSHA string) (*gitsource.Commit, error
 	}
 
 	return &gitsource.Commit{
-		SHA:     commit.ID,
-		Message: commit.Message,
+		SHA:         commit.ID,
+		Message:     commit.Message,
+		AuthorName:  commit.AuthorName,
+		AuthorEmail: commit.AuthorEmail,
 	}, nil
 }
 
+func (c *Client) IsCollaborator(repopath, user string) (bool, error) {
+	userID, err := strconv.Atoi(user)
+	if err != nil {
+		return false, errors.Errorf("wrong gitlab user id %q: %w", user, err)
+	}
+
+	// get the project member also when inherited from a parent group
+	req, err := c.client.NewRequest("GET", fmt.Sprintf("projects/%s/members/all/%d", url.PathEscape(repopath), userID), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	pm := new(gitlab.ProjectMember)
+	resp, err := c.client.Do(req, pm)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return pm.AccessLevel >= gitlab.DeveloperPermissions, nil
+}
+
 func (c *Client) BranchRef(branch string) string {
 	return branchRefPrefix + branch
 }
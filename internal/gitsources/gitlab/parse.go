@@ -35,6 +35,9 @@ const (
 	hookPush        = "Push Hook"
 	hookTagPush     = "Tag Push Hook"
 	hookPullRequest = "Merge Request Hook"
+
+	prStateClosed = "closed"
+	prStateMerged = "merged"
 )
 
 func (c *Client) ParseWebhook(r *http.Request, secret string) (*types.WebhookData, error) {
@@ -89,7 +92,12 @@ func parsePullRequestHook(data []byte) (*types.WebhookData, error) {
 	// TODO(sgotti) skip non open pull requests
 	// TODO(sgotti) only accept actions that have new commits
 
-	return webhookDataFromPullRequest(prhook), nil
+	whd := webhookDataFromPullRequest(prhook)
+	if prhook.ObjectAttributes.State == prStateClosed || prhook.ObjectAttributes.State == prStateMerged {
+		whd.Event = types.WebhookEventPullRequestClosed
+	}
+
+	return whd, nil
 }
 
 func webhookDataFromPush(hook *pushHook) (*types.WebhookData, error) {
@@ -120,6 +128,13 @@ func webhookDataFromPush(hook *pushHook) (*types.WebhookData, error) {
 		if len(hook.Commits) > 0 {
 			whd.Message = hook.Commits[0].Message
 		}
+		for _, commit := range hook.Commits {
+			if commit.ID == hook.After {
+				whd.CommitMessage = commit.Message
+				whd.CommitAuthorName = commit.Author.Name
+				whd.CommitAuthorEmail = commit.Author.Email
+			}
+		}
 	case strings.HasPrefix(hook.Ref, "refs/tags/"):
 		whd.Event = types.WebhookEventTag
 		whd.Tag = strings.TrimPrefix(hook.Ref, "refs/tags/")
@@ -156,6 +171,8 @@ func webhookDataFromPullRequest(hook *pullRequestHook) *types.WebhookData {
 		PullRequestID:   strconv.Itoa(hook.ObjectAttributes.Iid),
 		PullRequestLink: hook.ObjectAttributes.URL,
 		PRFromSameRepo:  prFromSameRepo,
+		PRAuthor:        strconv.Itoa(hook.ObjectAttributes.AuthorID),
+		PRBaseBranch:    hook.ObjectAttributes.TargetBranch,
 
 		Repo: types.WebhookDataRepo{
 			Path:   hook.Project.PathWithNamespace,
@@ -49,6 +49,9 @@ type GitSource interface {
 	// RefType returns the ref type and the related name (branch, tag, pr id)
 	RefType(ref string) (RefType, string, error)
 	GetCommit(repopath, commitSHA string) (*Commit, error)
+	// IsCollaborator reports if the user (identified by the git source user
+	// identifier reported by the webhook data) can push to the repository
+	IsCollaborator(repopath, user string) (bool, error)
 
 	BranchRef(branch string) string
 	TagRef(tag string) string
@@ -86,6 +89,8 @@ type RepoInfo struct {
 	HTMLURL      string
 	SSHCloneURL  string
 	HTTPCloneURL string
+	// DefaultBranch is empty when not reported by the git source
+	DefaultBranch string
 }
 
 type UserInfo struct {
@@ -108,6 +113,8 @@ type Ref struct {
 }
 
 type Commit struct {
-	SHA     string
-	Message string
+	SHA         string
+	Message     string
+	AuthorName  string
+	AuthorEmail string
 }
@@ -0,0 +1,189 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reports
+
+import (
+	"archive/tar"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// MaxReportFileSize is the max size of a single report file
+const MaxReportFileSize = 10 * 1024 * 1024
+
+type junitTestSuite struct {
+	TestSuites []*junitTestSuite `xml:"testsuite"`
+	TestCases  []*junitTestCase  `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Failures []struct{} `xml:"failure"`
+	Errors   []struct{} `xml:"error"`
+	Skipped  *struct{}  `xml:"skipped"`
+}
+
+type coberturaCoverage struct {
+	LineRate     *float64 `xml:"line-rate,attr"`
+	LinesCovered *int     `xml:"lines-covered,attr"`
+	LinesValid   *int     `xml:"lines-valid,attr"`
+}
+
+// ParseArchive parses the report files contained in the provided tar archive
+// and returns the report summary. The files that cannot be parsed are reported
+// in the summary error.
+func ParseArchive(report *types.Report, r io.Reader) *types.ReportSummary {
+	summary := &types.ReportSummary{
+		Format: report.Format,
+		Path:   report.Path,
+	}
+
+	p := &parser{summary: summary}
+	errs := []string{}
+	files := 0
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("failed to read archive: %v", err))
+			break
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		files++
+
+		if hdr.Size > MaxReportFileSize {
+			errs = append(errs, fmt.Sprintf("%s: file size exceeds %d bytes", hdr.Name, MaxReportFileSize))
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", hdr.Name, err))
+			continue
+		}
+		if err := p.parse(data); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", hdr.Name, err))
+		}
+	}
+
+	if files == 0 && len(errs) == 0 {
+		errs = append(errs, "no report files found")
+	}
+	p.setCoverage()
+
+	summary.Error = strings.Join(errs, "; ")
+
+	return summary
+}
+
+type parser struct {
+	summary *types.ReportSummary
+
+	// coverage data
+	linesCovered int
+	linesValid   int
+	lineRates    []float64
+}
+
+func (p *parser) parse(data []byte) error {
+	switch p.summary.Format {
+	case types.ReportFormatJUnit:
+		return p.parseJUnit(data)
+	case types.ReportFormatCobertura:
+		return p.parseCobertura(data)
+	default:
+		return errors.Errorf("unknown report format %q", p.summary.Format)
+	}
+}
+
+func (p *parser) parseJUnit(data []byte) error {
+	var ts junitTestSuite
+	if err := xml.Unmarshal(data, &ts); err != nil {
+		return errors.Errorf("failed to parse junit report: %w", err)
+	}
+	p.addJUnitTestSuite(&ts)
+	return nil
+}
+
+func (p *parser) addJUnitTestSuite(ts *junitTestSuite) {
+	for _, nts := range ts.TestSuites {
+		p.addJUnitTestSuite(nts)
+	}
+	for _, tc := range ts.TestCases {
+		p.summary.Tests++
+		switch {
+		case len(tc.Errors) > 0:
+			p.summary.Errors++
+		case len(tc.Failures) > 0:
+			p.summary.Failures++
+		case tc.Skipped != nil:
+			p.summary.Skipped++
+		}
+	}
+}
+
+func (p *parser) parseCobertura(data []byte) error {
+	var c coberturaCoverage
+	if err := xml.Unmarshal(data, &c); err != nil {
+		return errors.Errorf("failed to parse cobertura report: %w", err)
+	}
+	switch {
+	case c.LinesCovered != nil && c.LinesValid != nil:
+		p.linesCovered += *c.LinesCovered
+		p.linesValid += *c.LinesValid
+	case c.LineRate != nil:
+		p.lineRates = append(p.lineRates, *c.LineRate)
+	default:
+		return errors.Errorf("missing coverage line rate")
+	}
+	return nil
+}
+
+// setCoverage sets the summary coverage percentage. The covered lines of all
+// the reports are used when available, otherwise the average of the reports
+// line rates.
+func (p *parser) setCoverage() {
+	switch {
+	case p.linesValid > 0 && len(p.lineRates) == 0:
+		coverage := float64(p.linesCovered) / float64(p.linesValid) * 100
+		p.summary.Coverage = &coverage
+	case len(p.lineRates) > 0 && p.linesValid == 0:
+		var sum float64
+		for _, lr := range p.lineRates {
+			sum += lr
+		}
+		coverage := sum / float64(len(p.lineRates)) * 100
+		p.summary.Coverage = &coverage
+	case len(p.lineRates) > 0:
+		// mixed reports, consider every line rate report as a single file
+		var sum float64
+		for _, lr := range p.lineRates {
+			sum += lr
+		}
+		coverage := (float64(p.linesCovered)/float64(p.linesValid) + sum) / float64(len(p.lineRates)+1) * 100
+		p.summary.Coverage = &coverage
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reports
+
+import (
+	"archive/tar"
+	"bytes"
+	"testing"
+
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func createTar(t *testing.T, files map[string]string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, content := range files {
+		hdr := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	return buf
+}
+
+func floatP(f float64) *float64 {
+	return &f
+}
+
+func TestParseArchive(t *testing.T) {
+	tests := []struct {
+		name   string
+		report *types.Report
+		files  map[string]string
+		out    *types.ReportSummary
+	}{
+		{
+			name:   "junit testsuites",
+			report: &types.Report{Format: types.ReportFormatJUnit, Path: "*.xml"},
+			files: map[string]string{
+				"report.xml": `
+<testsuites>
+  <testsuite name="suite01">
+    <testcase name="test01"/>
+    <testcase name="test02"><failure message="failed"/></testcase>
+    <testsuite name="suite02">
+      <testcase name="test03"><error message="error"/></testcase>
+      <testcase name="test04"><skipped/></testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`,
+			},
+			out: &types.ReportSummary{Format: types.ReportFormatJUnit, Path: "*.xml", Tests: 4, Failures: 1, Errors: 1, Skipped: 1},
+		},
+		{
+			name:   "junit multiple testsuite files",
+			report: &types.Report{Format: types.ReportFormatJUnit, Path: "*.xml"},
+			files: map[string]string{
+				"report01.xml": `<testsuite name="suite01"><testcase name="test01"/></testsuite>`,
+				"report02.xml": `<testsuite name="suite02"><testcase name="test01"><failure/></testcase></testsuite>`,
+			},
+			out: &types.ReportSummary{Format: types.ReportFormatJUnit, Path: "*.xml", Tests: 2, Failures: 1},
+		},
+		{
+			name:   "junit invalid file",
+			report: &types.Report{Format: types.ReportFormatJUnit, Path: "report.xml"},
+			files: map[string]string{
+				"report.xml": `<testsuite`,
+			},
+			out: &types.ReportSummary{Format: types.ReportFormatJUnit, Path: "report.xml", Error: "report.xml: failed to parse junit report: XML syntax error on line 1: unexpected EOF"},
+		},
+		{
+			name:   "no report files",
+			report: &types.Report{Format: types.ReportFormatJUnit, Path: "report.xml"},
+			files:  map[string]string{},
+			out:    &types.ReportSummary{Format: types.ReportFormatJUnit, Path: "report.xml", Error: "no report files found"},
+		},
+		{
+			name:   "cobertura with lines",
+			report: &types.Report{Format: types.ReportFormatCobertura, Path: "*.xml"},
+			files: map[string]string{
+				"coverage01.xml": `<coverage line-rate="0.5" lines-covered="10" lines-valid="20"></coverage>`,
+				"coverage02.xml": `<coverage line-rate="1" lines-covered="30" lines-valid="30"></coverage>`,
+			},
+			out: &types.ReportSummary{Format: types.ReportFormatCobertura, Path: "*.xml", Coverage: floatP(80)},
+		},
+		{
+			name:   "cobertura with only line rate",
+			report: &types.Report{Format: types.ReportFormatCobertura, Path: "*.xml"},
+			files: map[string]string{
+				"coverage01.xml": `<coverage line-rate="0.5"></coverage>`,
+				"coverage02.xml": `<coverage line-rate="0.7"></coverage>`,
+			},
+			out: &types.ReportSummary{Format: types.ReportFormatCobertura, Path: "*.xml", Coverage: floatP(60)},
+		},
+		{
+			name:   "cobertura without line rate",
+			report: &types.Report{Format: types.ReportFormatCobertura, Path: "coverage.xml"},
+			files: map[string]string{
+				"coverage.xml": `<coverage></coverage>`,
+			},
+			out: &types.ReportSummary{Format: types.ReportFormatCobertura, Path: "coverage.xml", Error: "coverage.xml: missing coverage line rate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := ParseArchive(tt.report, createTar(t, tt.files))
+			if diff := cmp.Diff(tt.out, out, cmp.Comparer(func(a, b float64) bool { return a-b < 0.0001 && b-a < 0.0001 })); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -16,7 +16,10 @@ package runconfig
 
 import (
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/config"
 	itypes "agola.io/agola/internal/services/types"
@@ -29,51 +32,114 @@ import (
 
 const (
 	defaultShell = "/bin/sh -e"
+	// the step command file is executed with powershell (the file will have a
+	// .ps1 extension)
+	defaultWindowsShell = "powershell -NoLogo -NoProfile -NonInteractive -ExecutionPolicy Bypass -File"
+
+	// defaultTaskFileMode is the task files mode since they usually contain
+	// secrets
+	defaultTaskFileMode = 0600
 )
 
 func genRuntime(c *config.Config, ce *config.Runtime, variables map[string]string) *rstypes.Runtime {
 	containers := []*rstypes.Container{}
 	for _, cc := range ce.Containers {
-		env := genEnv(cc.Environment, variables)
-		container := &rstypes.Container{
-			Image:       cc.Image,
-			Environment: env,
-			User:        cc.User,
-			Privileged:  cc.Privileged,
-			Entrypoint:  cc.Entrypoint,
-			Volumes:     make([]rstypes.Volume, len(cc.Volumes)),
-		}
-
-		for i, ccVol := range cc.Volumes {
-			container.Volumes[i] = rstypes.Volume{
-				Path: ccVol.Path,
-			}
+		containers = append(containers, genContainer(cc, variables))
+	}
 
-			if ccVol.TmpFS != nil {
-				var size int64
-				if ccVol.TmpFS.Size != nil {
-					size = ccVol.TmpFS.Size.Value()
-				}
-				container.Volumes[i].TmpFS = &rstypes.VolumeTmpFS{
-					Size: size,
-				}
+	var initContainers []*rstypes.Container
+	for _, cc := range ce.InitContainers {
+		initContainers = append(initContainers, genContainer(cc, variables))
+	}
+
+	var gpus *rstypes.GPUs
+	if ce.GPUs != nil {
+		gpus = &rstypes.GPUs{
+			Count: ce.GPUs.Count,
+			Type:  ce.GPUs.Type,
+		}
+	}
+
+	var docker *rstypes.DockerDaemon
+	if ce.Docker != nil {
+		docker = &rstypes.DockerDaemon{
+			Image: ce.Docker.Image,
+			Cache: ce.Docker.Cache,
+		}
+		if ce.Docker.CPU != nil {
+			docker.CPU = float64(ce.Docker.CPU.MilliValue()) / 1000
+		}
+		if ce.Docker.Memory != nil {
+			docker.Memory = ce.Docker.Memory.Value()
+		}
+	}
+
+	var limits *rstypes.TaskLimits
+	if ce.Limits != nil {
+		limits = &rstypes.TaskLimits{
+			Pids: ce.Limits.Pids,
+		}
+		if len(ce.Limits.Ulimits) > 0 {
+			limits.Ulimits = map[string]rstypes.Ulimit{}
+			for name, ulimit := range ce.Limits.Ulimits {
+				limits.Ulimits[name] = rstypes.Ulimit{Soft: ulimit.Soft, Hard: ulimit.Hard}
 			}
 		}
-		containers = append(containers, container)
 	}
 
 	return &rstypes.Runtime{
 		Type:       rstypes.RuntimeType(ce.Type),
+		OS:         ce.OS,
 		Arch:       ce.Arch,
 		Containers: containers,
+		GPUs:       gpus,
+		Docker:     docker,
+		Limits:     limits,
+
+		InitContainers: initContainers,
 	}
 }
 
+func genContainer(cc *config.Container, variables map[string]string) *rstypes.Container {
+	env := genEnv(cc.Environment, variables)
+	container := &rstypes.Container{
+		Image:             cc.Image,
+		Environment:       env,
+		SecretEnvironment: genSecretEnv(cc.Environment),
+		User:              cc.User,
+		Privileged:        cc.Privileged,
+		Entrypoint:        cc.Entrypoint,
+		EntrypointArgs:    cc.EntrypointArgs,
+		Volumes:           make([]rstypes.Volume, len(cc.Volumes)),
+	}
+	if cc.ShmSize != nil {
+		container.ShmSize = cc.ShmSize.Value()
+	}
+
+	for i, ccVol := range cc.Volumes {
+		container.Volumes[i] = rstypes.Volume{
+			Path: ccVol.Path,
+		}
+
+		if ccVol.TmpFS != nil {
+			var size int64
+			if ccVol.TmpFS.Size != nil {
+				size = ccVol.TmpFS.Size.Value()
+			}
+			container.Volumes[i].TmpFS = &rstypes.VolumeTmpFS{
+				Size: size,
+			}
+		}
+	}
+
+	return container
+}
+
 func stepFromConfigStep(csi interface{}, variables map[string]string) interface{} {
 	switch cs := csi.(type) {
 	case *config.CloneStep:
 		// transform a "clone" step in a "run" step command
-		rs := &config.RunStep{}
+		rs := &rstypes.RunStep{}
 		rs.Type = "run"
 		rs.Name = "Clone repository and checkout code"
 		rs.Command = fmt.Sprintf(`
@@ -113,15 +179,7 @@ Host $AGOLA_GIT_HOST
 EOF
 )
 
-git clone %s $AGOLA_REPOSITORY_URL .
-git fetch origin $AGOLA_GIT_REF
-
-if [ -n "$AGOLA_GIT_COMMITSHA" ]; then
-	git checkout $AGOLA_GIT_COMMITSHA
-else
-	git checkout FETCH_HEAD
-fi
-`, genCloneOptions(cs))
+%s`, genCloneCommands(cs))
 
 		return rs
 
@@ -133,10 +191,14 @@ fi
 		rs.Type = cs.Type
 		rs.Name = cs.Name
 		rs.Command = cs.Command
+		rs.CommandArgs = cs.CommandArgs
+		rs.Script = cs.Script
 		rs.Environment = env
+		rs.SecretEnvironment = genSecretEnv(cs.Environment)
 		rs.WorkingDir = cs.WorkingDir
 		rs.Shell = cs.Shell
 		rs.Tty = cs.Tty
+		rs.Background = cs.Background
 		return rs
 
 	case *config.SaveToWorkspaceStep:
@@ -191,11 +253,77 @@ fi
 
 		return rws
 
+	case *config.WaitBackgroundStep:
+		wbs := &rstypes.WaitBackgroundStep{}
+		wbs.Name = cs.Name
+		wbs.Type = cs.Type
+		wbs.Steps = cs.Steps
+		wbs.Stop = cs.Stop
+
+		return wbs
+
 	default:
 		panic(fmt.Errorf("unknown config step type: %s", util.Dump(cs)))
 	}
 }
 
+// setStepAlwaysRun marks a step to be executed also if a previous step failed
+func setStepAlwaysRun(step interface{}) {
+	switch s := step.(type) {
+	case *rstypes.RunStep:
+		s.AlwaysRun = true
+	case *rstypes.SaveToWorkspaceStep:
+		s.AlwaysRun = true
+	case *rstypes.RestoreWorkspaceStep:
+		s.AlwaysRun = true
+	case *rstypes.SaveCacheStep:
+		s.AlwaysRun = true
+	case *rstypes.RestoreCacheStep:
+		s.AlwaysRun = true
+	case *rstypes.WaitBackgroundStep:
+		s.AlwaysRun = true
+	}
+}
+
+// setStepSkip marks a step to not be executed
+func setStepSkip(step interface{}) {
+	switch s := step.(type) {
+	case *rstypes.RunStep:
+		s.Skip = true
+	case *rstypes.SaveToWorkspaceStep:
+		s.Skip = true
+	case *rstypes.RestoreWorkspaceStep:
+		s.Skip = true
+	case *rstypes.SaveCacheStep:
+		s.Skip = true
+	case *rstypes.RestoreCacheStep:
+		s.Skip = true
+	case *rstypes.WaitBackgroundStep:
+		s.Skip = true
+	}
+}
+
+// configStepWhen returns the when conditions of a config step
+func configStepWhen(csi interface{}) *config.When {
+	switch cs := csi.(type) {
+	case *config.CloneStep:
+		return cs.When
+	case *config.RunStep:
+		return cs.When
+	case *config.SaveToWorkspaceStep:
+		return cs.When
+	case *config.RestoreWorkspaceStep:
+		return cs.When
+	case *config.SaveCacheStep:
+		return cs.When
+	case *config.RestoreCacheStep:
+		return cs.When
+	case *config.WaitBackgroundStep:
+		return cs.When
+	}
+	return nil
+}
+
 // GenRunConfigTasks generates a run config tasks from a run in the config, expanding all the references to tasks
 // this functions assumes that the config is already checked for possible errors (i.e referenced task must exits)
 func GenRunConfigTasks(uuid util.UUIDGenerator, c *config.Config, runName string, variables map[string]string, refType itypes.RunRefType, branch, tag, ref string) map[string]*rstypes.RunConfigTask {
@@ -203,33 +331,91 @@ func GenRunConfigTasks(uuid util.UUIDGenerator, c *config.Config, runName string
 
 	rcts := map[string]*rstypes.RunConfigTask{}
 
+	// genStep generates a run config step, the step when conditions are
+	// evaluated like the task ones
+	genStep := func(cs interface{}) interface{} {
+		step := stepFromConfigStep(cs, variables)
+		if !types.MatchWhen(configStepWhen(cs).ToWhen(), refType, branch, tag, ref) {
+			setStepSkip(step)
+		}
+		return step
+	}
+
 	for _, ct := range cr.Tasks {
 		include := types.MatchWhen(ct.When.ToWhen(), refType, branch, tag, ref)
 
-		steps := make(rstypes.Steps, len(ct.Steps))
-		for i, cpts := range ct.Steps {
-			steps[i] = stepFromConfigStep(cpts, variables)
+		steps := rstypes.Steps{}
+		if !ct.SkipHooks {
+			for _, cpts := range cr.Before {
+				steps = append(steps, genStep(cpts))
+			}
+		}
+		for _, cpts := range ct.Steps {
+			steps = append(steps, genStep(cpts))
+		}
+		if !ct.SkipHooks {
+			for _, cpts := range cr.After {
+				step := genStep(cpts)
+				setStepAlwaysRun(step)
+				steps = append(steps, step)
+			}
 		}
 
 		tEnv := genEnv(ct.Environment, variables)
 
 		t := &rstypes.RunConfigTask{
-			ID:                   uuid.New(ct.Name).String(),
-			Name:                 ct.Name,
-			Runtime:              genRuntime(c, ct.Runtime, variables),
-			Environment:          tEnv,
-			WorkingDir:           ct.WorkingDir,
-			Shell:                ct.Shell,
-			User:                 ct.User,
-			Steps:                steps,
-			IgnoreFailure:        ct.IgnoreFailure,
-			Skip:                 !include,
-			NeedsApproval:        ct.Approval,
-			DockerRegistriesAuth: make(map[string]rstypes.DockerRegistryAuth),
+			ID:                       uuid.New(ct.Name).String(),
+			Name:                     ct.Name,
+			Runtime:                  genRuntime(c, ct.Runtime, variables),
+			Environment:              tEnv,
+			SecretEnvironment:        genSecretEnv(ct.Environment),
+			SecretEnvironmentTracked: true,
+			WorkingDir:               ct.WorkingDir,
+			Shell:                    ct.Shell,
+			User:                     ct.User,
+			Steps:                    steps,
+			IgnoreFailure:            ct.IgnoreFailure,
+			Skip:                     !include,
+			NeedsApproval:            ct.Approval,
+			DockerRegistriesAuth:     make(map[string]rstypes.DockerRegistryAuth),
+			NetworkPolicy:            cr.NetworkPolicy,
+			SecurityProfile:          cr.SecurityProfile,
+			StopSignal:               ct.StopSignal,
+			StopGracePeriod:          time.Duration(ct.StopGracePeriod),
+			Batch:                    ct.Batch,
+			Always:                   ct.Always,
+		}
+
+		if ct.DeployEnvironment != "" {
+			// the protection rules are set at run creation from the project
+			// deploy environment
+			t.DeployEnvironment = &rstypes.RunConfigTaskDeployEnvironment{Name: ct.DeployEnvironment}
+		}
+
+		for _, report := range ct.Reports {
+			t.Reports = append(t.Reports, &rstypes.Report{
+				Format: rstypes.ReportFormat(report.Format),
+				Path:   report.Path,
+			})
+		}
+
+		for _, file := range ct.Files {
+			mode := os.FileMode(file.Mode)
+			if mode == 0 {
+				mode = defaultTaskFileMode
+			}
+			t.Files = append(t.Files, &rstypes.TaskFile{
+				Path:    file.Path,
+				Content: genValue(file.Content, variables),
+				Mode:    mode,
+			})
 		}
 
 		if t.Shell == "" {
 			t.Shell = defaultShell
+			if ct.Runtime.OS == types.OSWindows {
+				t.Shell = defaultWindowsShell
+			}
 		}
 
 		if c.DockerRegistriesAuth != nil {
@@ -452,6 +638,19 @@ func genEnv(cenv map[string]config.Value, variables map[string]string) map[strin
 	return env
 }
 
+// genSecretEnv returns the sorted names of the environment variables whose
+// value is taken from a variable
+func genSecretEnv(cenv map[string]config.Value) []string {
+	var names []string
+	for envName, envVar := range cenv {
+		if envVar.Type == config.ValueTypeFromVariable {
+			names = append(names, envName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func genValue(val config.Value, variables map[string]string) string {
 	switch val.Type {
 	case config.ValueTypeString:
@@ -471,5 +670,79 @@ func genCloneOptions(c *config.CloneStep) string {
 	if c.RecurseSubmodules {
 		cloneoptions = append(cloneoptions, "--recurse-submodules")
 	}
+	if len(c.SparsePaths) > 0 {
+		// checkout after configuring the sparse checkout
+		cloneoptions = append(cloneoptions, "--no-checkout")
+	}
 	return strings.Join(cloneoptions, " ")
 }
+
+// genCloneCommands generates the commands to clone the repository and checkout
+// the run commit. Without clone options they are the same commands used before
+// the options were introduced.
+func genCloneCommands(c *config.CloneStep) string {
+	var b strings.Builder
+
+	if c.LFS != nil && !*c.LFS {
+		b.WriteString("# Don't download git lfs files\nexport GIT_LFS_SKIP_SMUDGE=1\n\n")
+	}
+
+	fmt.Fprintf(&b, "git clone %s $AGOLA_REPOSITORY_URL .\n", genCloneOptions(c))
+
+	if len(c.SparsePaths) > 0 {
+		b.WriteString("git config core.sparseCheckout true\n")
+		for _, p := range c.SparsePaths {
+			fmt.Fprintf(&b, "echo %s >> .git/info/sparse-checkout\n", shellQuote(p))
+		}
+	}
+
+	if c.Depth != nil {
+		fmt.Fprintf(&b, "git fetch --depth %d origin $AGOLA_GIT_REF\n", *c.Depth)
+	} else {
+		b.WriteString("git fetch origin $AGOLA_GIT_REF\n")
+	}
+
+	if c.FetchTags {
+		// in a shallow repository this also fetches the history down to the
+		// tagged commits (i.e. needed by git describe)
+		b.WriteString("git fetch --tags origin\n")
+	}
+
+	b.WriteString("\n")
+	if c.Depth != nil {
+		// the commit isn't in the fetched history when it's not one of the
+		// last ref commits, fetch the full history in this case
+		b.WriteString(`if [ -n "$AGOLA_GIT_COMMITSHA" ]; then
+	if ! git checkout $AGOLA_GIT_COMMITSHA; then
+		git fetch --unshallow origin $AGOLA_GIT_REF
+		git checkout $AGOLA_GIT_COMMITSHA
+	fi
+else
+	git checkout FETCH_HEAD
+fi
+`)
+	} else {
+		b.WriteString(`if [ -n "$AGOLA_GIT_COMMITSHA" ]; then
+	git checkout $AGOLA_GIT_COMMITSHA
+else
+	git checkout FETCH_HEAD
+fi
+`)
+	}
+
+	if c.RecurseSubmodules {
+		// the submodules cloned by git clone are the ones of the default branch
+		b.WriteString("\ngit submodule update --init --recursive\n")
+	}
+
+	if c.LFS != nil && *c.LFS {
+		b.WriteString("\ngit lfs pull\n")
+	}
+
+	return b.String()
+}
+
+// shellQuote quotes a string to be used as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'"'"'`, -1) + "'"
+}
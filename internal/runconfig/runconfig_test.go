@@ -819,6 +819,7 @@ func TestGenRunConfig(t *testing.T) {
 										TmpFS: &rstypes.VolumeTmpFS{Size: 1024 * 1024 * 1024},
 									},
 								},
+								SecretEnvironment: []string{"ENVFROMVARIABLE01"},
 							},
 						},
 					},
@@ -827,10 +828,12 @@ func TestGenRunConfig(t *testing.T) {
 						"ENV01":             "ENV01",
 						"ENVFROMVARIABLE01": "VARVALUE01",
 					},
+					SecretEnvironment:        []string{"ENVFROMVARIABLE01"},
+					SecretEnvironmentTracked: true,
 					Steps: rstypes.Steps{
 						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
 						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "name different than command"}, Command: "command02", Environment: map[string]string{}},
-						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command03"}, Command: "command03", Environment: map[string]string{"ENV01": "ENV01", "ENVFROMVARIABLE01": "VARVALUE01"}},
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command03"}, Command: "command03", Environment: map[string]string{"ENV01": "ENV01", "ENVFROMVARIABLE01": "VARVALUE01"}, SecretEnvironment: []string{"ENVFROMVARIABLE01"}},
 					},
 					Skip: true,
 				},
@@ -899,8 +902,9 @@ func TestGenRunConfig(t *testing.T) {
 							},
 						},
 					},
-					Shell:       "/bin/sh -e",
-					Environment: map[string]string{},
+					Shell:                    "/bin/sh -e",
+					SecretEnvironmentTracked: true,
+					Environment:              map[string]string{},
 					Steps: rstypes.Steps{
 						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
 					},
@@ -998,14 +1002,266 @@ func TestGenRunConfig(t *testing.T) {
 							},
 						},
 					},
-					Shell:       "/bin/sh -e",
-					Environment: map[string]string{},
+					Shell:                    "/bin/sh -e",
+					SecretEnvironmentTracked: true,
+					Environment:              map[string]string{},
 					Steps: rstypes.Steps{
 						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
 					},
 				},
 			},
 		},
+		{
+			name: "test run before and after steps",
+			in: &config.Config{
+				Runs: []*config.Run{
+					&config.Run{
+						Name: "run01",
+						Before: config.Steps{
+							&config.RunStep{
+								BaseStep: config.BaseStep{
+									Type: "run",
+									Name: "before01",
+								},
+								Command: "before01",
+								Environment: map[string]config.Value{
+									"ENVFROMVARIABLE01": config.Value{Type: config.ValueTypeFromVariable, Value: "variable01"},
+								},
+							},
+						},
+						After: config.Steps{
+							&config.RunStep{
+								BaseStep: config.BaseStep{
+									Type: "run",
+									Name: "after01",
+								},
+								Command: "after01",
+							},
+						},
+						Tasks: []*config.Task{
+							&config.Task{
+								Name: "task01",
+								Runtime: &config.Runtime{
+									Type: "pod",
+									Containers: []*config.Container{
+										&config.Container{
+											Image: "image01",
+										},
+									},
+								},
+								Steps: config.Steps{
+									&config.RunStep{
+										BaseStep: config.BaseStep{
+											Type: "run",
+											Name: "command01",
+										},
+										Command: "command01",
+									},
+								},
+							},
+							&config.Task{
+								Name:      "task02",
+								SkipHooks: true,
+								Runtime: &config.Runtime{
+									Type: "pod",
+									Containers: []*config.Container{
+										&config.Container{
+											Image: "image01",
+										},
+									},
+								},
+								Steps: config.Steps{
+									&config.RunStep{
+										BaseStep: config.BaseStep{
+											Type: "run",
+											Name: "command01",
+										},
+										Command: "command01",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			variables: map[string]string{
+				"variable01": "VARVALUE01",
+			},
+			out: map[string]*rstypes.RunConfigTask{
+				uuid.New("task01").String(): &rstypes.RunConfigTask{
+					ID:                   uuid.New("task01").String(),
+					Name:                 "task01",
+					Depends:              map[string]*rstypes.RunConfigTaskDepend{},
+					DockerRegistriesAuth: map[string]rstypes.DockerRegistryAuth{},
+					Runtime: &rstypes.Runtime{Type: rstypes.RuntimeType("pod"),
+						Containers: []*rstypes.Container{
+							{
+								Image:       "image01",
+								Environment: map[string]string{},
+								Volumes:     []rstypes.Volume{},
+							},
+						},
+					},
+					Shell:                    "/bin/sh -e",
+					SecretEnvironmentTracked: true,
+					Environment:              map[string]string{},
+					Steps: rstypes.Steps{
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "before01"}, Command: "before01", Environment: map[string]string{"ENVFROMVARIABLE01": "VARVALUE01"}, SecretEnvironment: []string{"ENVFROMVARIABLE01"}},
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "after01", AlwaysRun: true}, Command: "after01", Environment: map[string]string{}},
+					},
+				},
+				uuid.New("task02").String(): &rstypes.RunConfigTask{
+					ID:                   uuid.New("task02").String(),
+					Name:                 "task02",
+					Depends:              map[string]*rstypes.RunConfigTaskDepend{},
+					DockerRegistriesAuth: map[string]rstypes.DockerRegistryAuth{},
+					Runtime: &rstypes.Runtime{Type: rstypes.RuntimeType("pod"),
+						Containers: []*rstypes.Container{
+							{
+								Image:       "image01",
+								Environment: map[string]string{},
+								Volumes:     []rstypes.Volume{},
+							},
+						},
+					},
+					Shell:                    "/bin/sh -e",
+					SecretEnvironmentTracked: true,
+					Environment:              map[string]string{},
+					Steps: rstypes.Steps{
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
+					},
+				},
+			},
+		},
+		{
+			name: "test steps when conditions",
+			in: &config.Config{
+				Runs: []*config.Run{
+					&config.Run{
+						Name: "run01",
+						Tasks: []*config.Task{
+							&config.Task{
+								Name: "task01",
+								Runtime: &config.Runtime{
+									Type: "pod",
+									Containers: []*config.Container{
+										&config.Container{
+											Image: "image01",
+										},
+									},
+								},
+								Steps: config.Steps{
+									&config.RunStep{
+										BaseStep: config.BaseStep{
+											Type: "run",
+											Name: "command01",
+										},
+										Command: "command01",
+									},
+									&config.RunStep{
+										BaseStep: config.BaseStep{
+											Type: "run",
+											Name: "command02",
+											When: &config.When{
+												Branch: &types.WhenConditions{Include: []types.WhenCondition{{Match: "master"}}},
+											},
+										},
+										Command: "command02",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			out: map[string]*rstypes.RunConfigTask{
+				uuid.New("task01").String(): &rstypes.RunConfigTask{
+					ID:                   uuid.New("task01").String(),
+					Name:                 "task01",
+					Depends:              map[string]*rstypes.RunConfigTaskDepend{},
+					DockerRegistriesAuth: map[string]rstypes.DockerRegistryAuth{},
+					Runtime: &rstypes.Runtime{Type: rstypes.RuntimeType("pod"),
+						Containers: []*rstypes.Container{
+							{
+								Image:       "image01",
+								Environment: map[string]string{},
+								Volumes:     []rstypes.Volume{},
+							},
+						},
+					},
+					Shell:                    "/bin/sh -e",
+					SecretEnvironmentTracked: true,
+					Environment:              map[string]string{},
+					Steps: rstypes.Steps{
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command01"}, Command: "command01", Environment: map[string]string{}},
+						&rstypes.RunStep{BaseStep: rstypes.BaseStep{Type: "run", Name: "command02", Skip: true}, Command: "command02", Environment: map[string]string{}},
+					},
+				},
+			},
+		},
+		{
+			name: "test task files",
+			in: &config.Config{
+				Runs: []*config.Run{
+					&config.Run{
+						Name: "run01",
+						Tasks: []*config.Task{
+							&config.Task{
+								Name: "task01",
+								Runtime: &config.Runtime{
+									Type: "pod",
+									Containers: []*config.Container{
+										&config.Container{
+											Image: "image01",
+										},
+									},
+								},
+								Files: []*config.TaskFile{
+									{
+										Path:    "/root/.kube/config",
+										Content: config.Value{Type: config.ValueTypeFromVariable, Value: "kubeconfig"},
+									},
+									{
+										Path:    "/etc/tool.conf",
+										Content: config.Value{Type: config.ValueTypeString, Value: "verbose: true"},
+										Mode:    0644,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			variables: map[string]string{
+				"kubeconfig": "KUBECONFIG01",
+			},
+			out: map[string]*rstypes.RunConfigTask{
+				uuid.New("task01").String(): &rstypes.RunConfigTask{
+					ID:                   uuid.New("task01").String(),
+					Name:                 "task01",
+					Depends:              map[string]*rstypes.RunConfigTaskDepend{},
+					DockerRegistriesAuth: map[string]rstypes.DockerRegistryAuth{},
+					Runtime: &rstypes.Runtime{Type: rstypes.RuntimeType("pod"),
+						Containers: []*rstypes.Container{
+							{
+								Image:       "image01",
+								Environment: map[string]string{},
+								Volumes:     []rstypes.Volume{},
+							},
+						},
+					},
+					Shell:                    "/bin/sh -e",
+					SecretEnvironmentTracked: true,
+					Environment:              map[string]string{},
+					Steps:                    rstypes.Steps{},
+					Files: []*rstypes.TaskFile{
+						{Path: "/root/.kube/config", Content: "KUBECONFIG01", Mode: 0600},
+						{Path: "/etc/tool.conf", Content: "verbose: true", Mode: 0644},
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1018,3 +1274,65 @@ func TestGenRunConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestGenCloneCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		in   *config.CloneStep
+		out  string
+	}{
+		{
+			name: "test clone without options",
+			in:   &config.CloneStep{},
+			out: `git clone  $AGOLA_REPOSITORY_URL .
+git fetch origin $AGOLA_GIT_REF
+
+if [ -n "$AGOLA_GIT_COMMITSHA" ]; then
+	git checkout $AGOLA_GIT_COMMITSHA
+else
+	git checkout FETCH_HEAD
+fi
+`,
+		},
+		{
+			name: "test shallow clone with tags, submodules, sparse paths and without lfs",
+			in: &config.CloneStep{
+				Depth:             util.IntP(1),
+				RecurseSubmodules: true,
+				LFS:               util.BoolP(false),
+				FetchTags:         true,
+				SparsePaths:       []string{"/docs", "it's"},
+			},
+			out: `# Don't download git lfs files
+export GIT_LFS_SKIP_SMUDGE=1
+
+git clone --depth 1 --recurse-submodules --no-checkout $AGOLA_REPOSITORY_URL .
+git config core.sparseCheckout true
+echo '/docs' >> .git/info/sparse-checkout
+echo 'it'"'"'s' >> .git/info/sparse-checkout
+git fetch --depth 1 origin $AGOLA_GIT_REF
+git fetch --tags origin
+
+if [ -n "$AGOLA_GIT_COMMITSHA" ]; then
+	if ! git checkout $AGOLA_GIT_COMMITSHA; then
+		git fetch --unshallow origin $AGOLA_GIT_REF
+		git checkout $AGOLA_GIT_COMMITSHA
+	fi
+else
+	git checkout FETCH_HEAD
+fi
+
+git submodule update --init --recursive
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := genCloneCommands(tt.in)
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -15,12 +15,16 @@
 package common
 
 import (
+	"time"
+
 	gitsource "agola.io/agola/internal/gitsources"
+	"agola.io/agola/internal/gitsources/bitbucket"
 	"agola.io/agola/internal/gitsources/gitea"
 	"agola.io/agola/internal/gitsources/github"
 	"agola.io/agola/internal/gitsources/gitlab"
 	cstypes "agola.io/agola/services/configstore/types"
 
+	"golang.org/x/oauth2"
 	errors "golang.org/x/xerrors"
 )
 
@@ -54,6 +58,16 @@ func newGithub(rs *cstypes.RemoteSource, accessToken string) (*github.Client, er
 	})
 }
 
+func newBitbucket(rs *cstypes.RemoteSource, accessToken string) (*bitbucket.Client, error) {
+	return bitbucket.New(bitbucket.Opts{
+		APIURL:         rs.APIURL,
+		SkipVerify:     rs.SkipVerify,
+		Token:          accessToken,
+		Oauth2ClientID: rs.Oauth2ClientID,
+		Oauth2Secret:   rs.Oauth2ClientSecret,
+	})
+}
+
 func GetAccessToken(rs *cstypes.RemoteSource, userAccessToken, oauth2AccessToken string) (string, error) {
 	switch rs.AuthType {
 	case cstypes.RemoteSourceAuthTypePassword:
@@ -84,6 +98,8 @@ func GetGitSource(rs *cstypes.RemoteSource, la *cstypes.LinkedAccount) (gitsourc
 		gitSource, err = newGitlab(rs, accessToken)
 	case cstypes.RemoteSourceTypeGithub:
 		gitSource, err = newGithub(rs, accessToken)
+	case cstypes.RemoteSourceTypeBitbucket:
+		gitSource, err = newBitbucket(rs, accessToken)
 	default:
 		return nil, errors.Errorf("remote source %s isn't a valid git source", rs.Name)
 	}
@@ -116,6 +132,8 @@ func GetOauth2Source(rs *cstypes.RemoteSource, accessToken string) (gitsource.Oa
 		oauth2Source, err = newGitlab(rs, accessToken)
 	case cstypes.RemoteSourceTypeGithub:
 		oauth2Source, err = newGithub(rs, accessToken)
+	case cstypes.RemoteSourceTypeBitbucket:
+		oauth2Source, err = newBitbucket(rs, accessToken)
 	default:
 		return nil, errors.Errorf("remote source %s isn't a valid oauth2 source", rs.Name)
 	}
@@ -129,9 +147,68 @@ func GetPasswordSource(rs *cstypes.RemoteSource, accessToken string) (gitsource.
 	switch rs.Type {
 	case cstypes.RemoteSourceTypeGitea:
 		passwordSource, err = newGitea(rs, accessToken)
+	case cstypes.RemoteSourceTypeBitbucket:
+		passwordSource, err = newBitbucket(rs, accessToken)
 	default:
 		return nil, errors.Errorf("remote source %s isn't a valid oauth2 source", rs.Name)
 	}
 
 	return passwordSource, err
 }
+
+const (
+	// oauth2ExpireTimeRange is the time range before the real access token
+	// expiration at which the access token is considered expired
+	oauth2ExpireTimeRange time.Duration = 5 * time.Minute
+)
+
+func IsOauth2AccessTokenExpired(expiresAt time.Time) bool {
+	if expiresAt.IsZero() {
+		return false
+	}
+	return expiresAt.Add(-oauth2ExpireTimeRange).Before(time.Now())
+}
+
+// LinkedAccountNeedsReauthError returns the error reported when the linked
+// account tokens aren't valid anymore and the user has to re-authenticate
+// with the remote source
+func LinkedAccountNeedsReauthError(rs *cstypes.RemoteSource, la *cstypes.LinkedAccount) error {
+	return errors.Errorf("linked account %q of remote source %q needs re-authentication, login again with the remote source to re-link it", la.RemoteUserName, rs.Name)
+}
+
+// RefreshLinkedAccount refreshes the linked account oauth2 access token when
+// expired. It returns true when the linked account has been changed and must
+// be updated in the configstore.
+// If the remote source rejects the refresh token the linked account is marked
+// as needing re-authentication and a LinkedAccountNeedsReauthError is returned.
+func RefreshLinkedAccount(rs *cstypes.RemoteSource, la *cstypes.LinkedAccount) (bool, error) {
+	if rs.AuthType != cstypes.RemoteSourceAuthTypeOauth2 {
+		return false, nil
+	}
+	if !IsOauth2AccessTokenExpired(la.Oauth2AccessTokenExpiresAt) {
+		return false, nil
+	}
+
+	userSource, err := GetOauth2Source(rs, "")
+	if err != nil {
+		return false, err
+	}
+	token, err := userSource.RefreshOauth2Token(la.Oauth2RefreshToken)
+	if err != nil {
+		var rerr *oauth2.RetrieveError
+		if errors.As(err, &rerr) {
+			// the remote source token endpoint rejected the refresh token
+			la.NeedsReauth = true
+			return true, LinkedAccountNeedsReauthError(rs, la)
+		}
+		return false, errors.Errorf("failed to refresh oauth2 access token: %w", err)
+	}
+
+	changed := la.NeedsReauth || la.Oauth2AccessToken != token.AccessToken
+	la.Oauth2AccessToken = token.AccessToken
+	la.Oauth2RefreshToken = token.RefreshToken
+	la.Oauth2AccessTokenExpiresAt = token.Expiry
+	la.NeedsReauth = false
+
+	return changed, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// IDTokenKeyID returns the key id of an id tokens signing key. It's the
+// RFC 7638 JWK thumbprint of the public key so the runservice, signing the
+// tokens, and the gateway, publishing the keys, calculate the same id.
+func IDTokenKeyID(key *rsa.PublicKey) string {
+	n, e := RSAPublicKeyJWKParams(key)
+	// the thumbprint input has the required members in lexicographic order
+	thumbprint := sha256.Sum256([]byte(fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, e, n)))
+	return base64.RawURLEncoding.EncodeToString(thumbprint[:])
+}
+
+// RSAPublicKeyJWKParams returns the base64url encoded modulus and exponent of
+// a rsa public key as defined for the JWK "n" and "e" parameters.
+func RSAPublicKeyJWKParams(key *rsa.PublicKey) (string, string) {
+	n := base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	return n, e
+}
+
+// GenerateIDToken generates an id token with the provided claims signed with
+// RS256. The key id is set in the token header.
+func GenerateIDToken(key *rsa.PrivateKey, claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = IDTokenKeyID(&key.PublicKey)
+
+	return token.SignedString(key)
+}
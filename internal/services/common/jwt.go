@@ -61,9 +61,12 @@ func GenerateOauth2JWTToken(sd *TokenSigningData, remoteSourceName, requestType
 	})
 }
 
-func GenerateLoginJWTToken(sd *TokenSigningData, userID string) (string, error) {
+// GenerateLoginJWTToken generates the token of a user web session. It expires
+// after the provided duration.
+func GenerateLoginJWTToken(sd *TokenSigningData, userID, sessionID string, duration time.Duration) (string, error) {
 	return GenerateGenericJWTToken(sd, jwt.MapClaims{
 		"sub": userID,
-		"exp": time.Now().Add(sd.Duration).Unix(),
+		"sid": sessionID,
+		"exp": time.Now().Add(duration).Unix(),
 	})
 }
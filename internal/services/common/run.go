@@ -45,7 +45,7 @@ func WebHookEventToRunRefType(we types.WebhookEvent) types.RunRefType {
 		return types.RunRefTypeBranch
 	case types.WebhookEventTag:
 		return types.RunRefTypeTag
-	case types.WebhookEventPullRequest:
+	case types.WebhookEventPullRequest, types.WebhookEventPullRequestClosed:
 		return types.RunRefTypePullRequest
 	}
 
@@ -0,0 +1,77 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package common
+
+import (
+	"net/http"
+	"time"
+)
+
+// SessionConfig defines the user web sessions created at login and the cookie
+// used to store the session token
+type SessionConfig struct {
+	// IdleTimeout is the max time between two session requests. 0 disables it.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout is the max session lifetime
+	AbsoluteTimeout time.Duration
+
+	CookieName     string
+	CookieDomain   string
+	CookiePath     string
+	CookieSameSite http.SameSite
+	CookieSecure   bool
+	// CookieMaxAge is the cookie max age. When 0 the cookie expires with the
+	// session absolute timeout
+	CookieMaxAge time.Duration
+
+	// AllowedOrigins are the origins allowed to send state changing requests
+	// authenticated with the session cookie without the X-CSRF-Token header
+	AllowedOrigins []string
+}
+
+// Cookie returns the session cookie containing the provided session token
+func (s *SessionConfig) Cookie(token string) *http.Cookie {
+	maxAge := s.CookieMaxAge
+	if maxAge == 0 {
+		maxAge = s.AbsoluteTimeout
+	}
+
+	return &http.Cookie{
+		Name:     s.CookieName,
+		Value:    token,
+		Domain:   s.CookieDomain,
+		Path:     s.CookiePath,
+		MaxAge:   int(maxAge.Seconds()),
+		Expires:  time.Now().Add(maxAge),
+		Secure:   s.CookieSecure,
+		HttpOnly: true,
+		SameSite: s.CookieSameSite,
+	}
+}
+
+// ExpiredCookie returns a session cookie that removes the one saved by the
+// browser
+func (s *SessionConfig) ExpiredCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     s.CookieName,
+		Domain:   s.CookieDomain,
+		Path:     s.CookiePath,
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		Secure:   s.CookieSecure,
+		HttpOnly: true,
+		SameSite: s.CookieSameSite,
+	}
+}
@@ -16,10 +16,16 @@ package config
 
 import (
 	"io/ioutil"
+	"net"
+	"path"
+	"reflect"
+	"strings"
 	"time"
 
 	"agola.io/agola/internal/util"
+	"agola.io/agola/services/types"
 
+	"github.com/mitchellh/copystructure"
 	errors "golang.org/x/xerrors"
 	yaml "gopkg.in/yaml.v2"
 )
@@ -41,6 +47,23 @@ type Config struct {
 	Executor     Executor     `yaml:"executor"`
 	Configstore  Configstore  `yaml:"configstore"`
 	Gitserver    Gitserver    `yaml:"gitserver"`
+
+	Tracing Tracing `yaml:"tracing"`
+}
+
+// Tracing configures the export of the OpenTelemetry traces
+type Tracing struct {
+	// Endpoint is the OTLP/HTTP collector base url i.e. http://localhost:4318
+	// Spans are sent to the "/v1/traces" path. If empty tracing is disabled.
+	Endpoint string `yaml:"endpoint"`
+
+	// ServiceName is the service name reported in the exported spans.
+	// Defaults to "agola"
+	ServiceName string `yaml:"serviceName"`
+
+	// SamplingRatio is the ratio (from 0 to 1) of the new traces that are
+	// sampled. Defaults to 1 (all traces)
+	SamplingRatio float64 `yaml:"samplingRatio"`
 }
 
 type Gateway struct {
@@ -53,36 +76,140 @@ type Gateway struct {
 	// This is used for generating the redirect_url in oauth2 redirects
 	WebExposedURL string `yaml:"webExposedURL"`
 
+	// BasePath is the path prefix under which the gateway is exposed, i.e.
+	// /agola when exposed at https://myagola.example.com/agola/ behind a
+	// reverse proxy. The gateway routes and the generated urls (webhooks,
+	// oauth2 callbacks, web links) will include it. It's appended to the
+	// exposed urls when not already part of them.
+	BasePath string `yaml:"basePath"`
+
 	RunserviceURL  string `yaml:"runserviceURL"`
 	ConfigstoreURL string `yaml:"configstoreURL"`
 	GitserverURL   string `yaml:"gitserverURL"`
 
+	// RunserviceTLS and ConfigstoreTLS are the tls configurations used to
+	// connect to the runservice and the configstore
+	RunserviceTLS  *ClientTLS `yaml:"runserviceTLS"`
+	ConfigstoreTLS *ClientTLS `yaml:"configstoreTLS"`
+
 	Web           Web           `yaml:"web"`
 	Etcd          Etcd          `yaml:"etcd"`
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
 
 	TokenSigning TokenSigning `yaml:"tokenSigning"`
 
+	// Session defines the user web sessions created at login
+	Session Session `yaml:"session"`
+
+	// RequestLimits defines the max size of the request bodies
+	RequestLimits RequestLimits `yaml:"requestLimits"`
+
 	AdminToken string `yaml:"adminToken"`
+
+	// MetricsListenAddress is an optional http listen address (i.e. an admin
+	// port not exposed to the users) where the prometheus metrics will be
+	// served. When empty the metrics are served by the main http server at
+	// the /metrics path.
+	MetricsListenAddress string `yaml:"metricsListenAddress"`
+
+	// IDTokenPublicKeyPaths are the paths to files containing the pem encoded
+	// public keys used to verify the tasks id tokens, signed with the
+	// runservice idToken private key. When defined the gateway publishes the
+	// OIDC discovery document and the keys. To rotate the signing key, first
+	// add the new public key, then change the runservice private key and
+	// remove the old public key after the idToken duration.
+	IDTokenPublicKeyPaths []string `yaml:"idTokenPublicKeyPaths"`
 }
 
 type Scheduler struct {
 	Debug bool `yaml:"debug"`
 
-	RunserviceURL string `yaml:"runserviceURL"`
+	RunserviceURL string     `yaml:"runserviceURL"`
+	RunserviceTLS *ClientTLS `yaml:"runserviceTLS"`
 }
 
 type Notification struct {
 	Debug bool `yaml:"debug"`
 
 	// WebExposedURL is the web interface exposed url i.e. https://myagola.example.com
-	// This is used for generating the redirect_url in oauth2 redirects
+	// This is used for generating the run links in the commit statuses. When
+	// the gateway is exposed under a base path it must include it (i.e.
+	// https://myagola.example.com/agola)
 	WebExposedURL string `yaml:"webExposedURL"`
 
 	RunserviceURL  string `yaml:"runserviceURL"`
 	ConfigstoreURL string `yaml:"configstoreURL"`
 
+	RunserviceTLS  *ClientTLS `yaml:"runserviceTLS"`
+	ConfigstoreTLS *ClientTLS `yaml:"configstoreTLS"`
+
 	Etcd Etcd `yaml:"etcd"`
+
+	// Notifiers are the targets where the run notifications are sent
+	Notifiers []Notifier `yaml:"notifiers"`
+	// Routes define which run events are sent to which notifiers. A run event
+	// is sent to the notifiers of all the matching routes. When no route is
+	// defined no notification is sent. The commit statuses are always updated.
+	Routes []NotificationRoute `yaml:"routes"`
+}
+
+type NotifierType string
+
+const (
+	// NotifierTypeWebhook sends the run event as json to the provided url
+	NotifierTypeWebhook NotifierType = "webhook"
+	// NotifierTypeSlack sends a message to a slack incoming webhook url
+	NotifierTypeSlack NotifierType = "slack"
+	// NotifierTypePagerDuty triggers a pagerduty event using the events api v2
+	NotifierTypePagerDuty NotifierType = "pagerduty"
+)
+
+type Notifier struct {
+	Name string       `yaml:"name"`
+	Type NotifierType `yaml:"type"`
+
+	// URL is the webhook or slack incoming webhook url
+	URL string `yaml:"url"`
+	// RoutingKey is the pagerduty integration key
+	RoutingKey string `yaml:"routingKey"`
+}
+
+type NotificationEventType string
+
+const (
+	NotificationEventTypeRunStarted NotificationEventType = "run_started"
+	NotificationEventTypeRunSuccess NotificationEventType = "run_success"
+	NotificationEventTypeRunFailed  NotificationEventType = "run_failed"
+	// NotificationEventTypeRunError is a run with setup errors or cancelled
+	NotificationEventTypeRunError NotificationEventType = "run_error"
+)
+
+func (t NotificationEventType) IsValid() bool {
+	switch t {
+	case NotificationEventTypeRunStarted, NotificationEventTypeRunSuccess, NotificationEventTypeRunFailed, NotificationEventTypeRunError:
+		return true
+	}
+	return false
+}
+
+// NotificationRoute sends the run events matching all the selectors to the
+// provided notifiers. An empty selector matches everything.
+type NotificationRoute struct {
+	// Events are the matched event types
+	Events []NotificationEventType `yaml:"events"`
+	// Projects are the matched project paths (i.e. org/myorg/myproject). Shell
+	// patterns are accepted (i.e. org/myorg/*)
+	Projects []string `yaml:"projects"`
+	// Branches are the matched branches. Shell patterns are accepted (i.e.
+	// release-*). Runs not on a branch (tags, pull requests) won't match when
+	// defined.
+	Branches []string `yaml:"branches"`
+	// Tags are the matched run tags. A run matches when it has at least one
+	// of them.
+	Tags []string `yaml:"tags"`
+
+	// Notifiers are the names of the notifiers to send the events to
+	Notifiers []string `yaml:"notifiers"`
 }
 
 type Runservice struct {
@@ -93,8 +220,76 @@ type Runservice struct {
 	Etcd          Etcd          `yaml:"etcd"`
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
 
+	// ExecutorsTLS is the tls configuration used to connect to the executors
+	// (to send the tasks and fetch their logs and archives)
+	ExecutorsTLS *ClientTLS `yaml:"executorsTLS"`
+
+	// LogsObjectStorage, ArchivesObjectStorage and CacheObjectStorage are
+	// optional dedicated object storages for the tasks logs, the workspace
+	// archives and the caches. When not defined objectStorage is used.
+	LogsObjectStorage     *ObjectStorage `yaml:"logsObjectStorage"`
+	ArchivesObjectStorage *ObjectStorage `yaml:"archivesObjectStorage"`
+	CacheObjectStorage    *ObjectStorage `yaml:"cacheObjectStorage"`
+
 	RunCacheExpireInterval     time.Duration `yaml:"runCacheExpireInterval"`
 	RunWorkspaceExpireInterval time.Duration `yaml:"runWorkspaceExpireInterval"`
+
+	// SchedulingPauseWindows are the recurring windows (i.e. for maintenance)
+	// when the scheduling of new runs and tasks is paused. The runs created
+	// during a window are queued and started when the window ends.
+	SchedulingPauseWindows []SchedulingPauseWindow `yaml:"schedulingPauseWindows"`
+
+	// SchedulerInterval is the interval between two runs scheduling passes.
+	SchedulerInterval time.Duration `yaml:"schedulerInterval"`
+	// SchedulerMaxBackoff is the max interval between two scheduling passes.
+	// When a pass fails to update some runs or tasks due to concurrent
+	// updates (i.e. by other runservice instances) the interval is doubled
+	// up to this value. 0 disables the backoff.
+	SchedulerMaxBackoff time.Duration `yaml:"schedulerMaxBackoff"`
+	// SchedulerJitter is the max fraction (between 0 and 1) of the interval
+	// randomly added to it to avoid multiple instances scheduling in lockstep.
+	SchedulerJitter float64 `yaml:"schedulerJitter"`
+
+	// ExecutorRestartPolicy defines what to do with the not finished tasks of
+	// an executor that restarted (detected by a new executor session): "fail"
+	// marks them as failed, "reschedule" executes them again.
+	ExecutorRestartPolicy ExecutorRestartPolicy `yaml:"executorRestartPolicy"`
+
+	// IDToken enables the generation of a short lived OIDC id token for every
+	// task, provided in the AGOLA_ID_TOKEN environment variable. The tasks
+	// could exchange it with a cloud provider for temporary credentials.
+	IDToken *IDToken `yaml:"idToken"`
+}
+
+type ExecutorRestartPolicy string
+
+const (
+	ExecutorRestartPolicyFail       ExecutorRestartPolicy = "fail"
+	ExecutorRestartPolicyReschedule ExecutorRestartPolicy = "reschedule"
+)
+
+type IDToken struct {
+	// Issuer is the tokens issuer. It must be the gateway apiExposedURL
+	// (including the base path) where the OIDC discovery document and the
+	// keys to verify the tokens are published (see the gateway
+	// idTokenPublicKeyPaths).
+	Issuer string `yaml:"issuer"`
+	// Audience is the tokens audience (defaults to the issuer)
+	Audience string `yaml:"audience"`
+	// Duration is the tokens duration (defaults to 1 hour)
+	Duration time.Duration `yaml:"duration"`
+	// path to a file containing a pem encoded rsa private key used to sign the tokens
+	PrivateKeyPath string `yaml:"privateKeyPath"`
+}
+
+// SchedulingPauseWindow is a daily window defined by its start and end times
+// in UTC (hh:mm format). When the end is before the start the window ends the
+// next day. Weekdays optionally restricts the window to the provided days of
+// the week (i.e. sunday) where the window starts.
+type SchedulingPauseWindow struct {
+	Start    string   `yaml:"start"`
+	End      string   `yaml:"end"`
+	Weekdays []string `yaml:"weekdays"`
 }
 
 type Executor struct {
@@ -102,18 +297,268 @@ type Executor struct {
 
 	DataDir string `yaml:"dataDir"`
 
-	RunserviceURL string `yaml:"runserviceURL"`
-	ToolboxPath   string `yaml:"toolboxPath"`
+	RunserviceURL string     `yaml:"runserviceURL"`
+	RunserviceTLS *ClientTLS `yaml:"runserviceTLS"`
+	ToolboxPath   string     `yaml:"toolboxPath"`
 
 	Web Web `yaml:"web"`
 
 	Driver Driver `yaml:"driver"`
 
 	Labels map[string]string `yaml:"labels"`
-	// ActiveTasksLimit is the max number of concurrent active tasks
+	// ActiveTasksLimit is the max number of concurrent active tasks. 0 means
+	// no limit (or only the cpu capacity limit when
+	// CPUOversubscriptionRatio is defined)
 	ActiveTasksLimit int `yaml:"active_tasks_limit"`
+	// CPUs are the host cpus available to the tasks. When 0 the cpus of the
+	// executor host are used (for the kubernetes driver they should be set to
+	// the cpus of the nodes running the tasks)
+	CPUs int `yaml:"cpus"`
+	// CPUOversubscriptionRatio, when greater than 0, limits the concurrent
+	// active tasks to CPUs * CPUOversubscriptionRatio (i.e. 1.5 allows 12 tasks
+	// on a 8 cpus host). If ActiveTasksLimit is also defined the lower limit
+	// is used
+	CPUOversubscriptionRatio float64 `yaml:"cpuOversubscriptionRatio"`
 
 	AllowPrivilegedContainers bool `yaml:"allowPrivilegedContainers"`
+
+	// GPUs are the gpus provided by the executor. Tasks requesting gpus will
+	// be scheduled only on executors providing them.
+	GPUs []ExecutorGPUs `yaml:"gpus"`
+
+	// RegistryMirrors are the registry mirrors used to pull the task
+	// containers images. Images of a registry with a defined mirror will be
+	// pulled through it.
+	RegistryMirrors []RegistryMirror `yaml:"registryMirrors"`
+
+	// Proxy defines the proxy env vars injected in the task containers
+	Proxy *Proxy `yaml:"proxy"`
+
+	// NetworkPolicies are the named network policies that could be applied to
+	// the task containers. The "untrusted" network policy, applied to untrusted
+	// runs, denies all the egress traffic when not defined.
+	NetworkPolicies []NetworkPolicy `yaml:"networkPolicies"`
+
+	// SecurityProfiles are the named security profiles that could be applied
+	// to the task containers. Tasks selecting a security profile not defined
+	// here will fail.
+	SecurityProfiles []SecurityProfile `yaml:"securityProfiles"`
+	// DefaultSecurityProfile is the name of the security profile applied to
+	// the tasks not selecting one. When empty the container runtime defaults
+	// are used.
+	DefaultSecurityProfile string `yaml:"defaultSecurityProfile"`
+
+	// MaxStepLogSize is the max size in bytes of a step log. When exceeded the
+	// log is truncated and the step output discarded. 0 means no limit. It
+	// could be overridden by the project.
+	MaxStepLogSize int64 `yaml:"maxStepLogSize"`
+	// FailStepOnLogSizeExceeded fails the step when its log exceeds the max
+	// log size
+	FailStepOnLogSizeExceeded bool `yaml:"failStepOnLogSizeExceeded"`
+
+	// MaxTmpFSSize is the max size in bytes of the task containers /dev/shm
+	// and tmpfs volumes. Bigger sizes, and tmpfs volumes without a size, are
+	// clamped to it. 0 means no limit.
+	MaxTmpFSSize int64 `yaml:"maxTmpFSSize"`
+
+	// DanglingResourcesCleanerInterval is the interval between two removals
+	// of the dangling resources (containers, volumes etc... left by a failed
+	// or interrupted task pod creation). 0 disables the removal.
+	DanglingResourcesCleanerInterval time.Duration `yaml:"danglingResourcesCleanerInterval"`
+	// DanglingResourcesGracePeriod is the min age of a dangling resource to be
+	// removed. It avoids removing the resources of a pod still being created.
+	DanglingResourcesGracePeriod time.Duration `yaml:"danglingResourcesGracePeriod"`
+
+	// ResourceUsageSamplingInterval is the interval between two samplings of
+	// the cpu and memory usage of the task main container. 0 disables the
+	// sampling.
+	ResourceUsageSamplingInterval time.Duration `yaml:"resourceUsageSamplingInterval"`
+
+	// LogForwarder defines a supplementary destination receiving the run steps
+	// output. The steps logs are still saved and served by agola.
+	LogForwarder *LogForwarder `yaml:"logForwarder"`
+
+	// DebugHoldTTL is how long the pod of a failed task of a run requesting
+	// the debug hold is kept running before being removed. 0 disables the
+	// debug hold.
+	DebugHoldTTL time.Duration `yaml:"debugHoldTTL"`
+
+	// DockerDaemon configures the docker daemons started for the tasks
+	// requesting a dedicated docker daemon. They run as privileged containers
+	// so they also require allowPrivilegedContainers.
+	DockerDaemon DockerDaemon `yaml:"dockerDaemon"`
+
+	// Buildkit, when defined, are the BuildKit daemons the projects tasks
+	// could use to build images reusing the layers cache across runs
+	Buildkit *Buildkit `yaml:"buildkit"`
+
+	// TaskLimits are the process limits applied to the task containers
+	TaskLimits TaskLimits `yaml:"taskLimits"`
+}
+
+// TaskLimits defines the default pids limit and ulimits of the task containers
+// and the max values the tasks could request.
+//
+// A task could always lower a limit. It could raise the pids limit up to
+// MaxPids and an ulimit only when defined in AllowedUlimits and up to its
+// values.
+//
+// The kubernetes driver doesn't support a per pod pids limit (use the kubelet
+// podPidsLimit) and the cri driver doesn't support a pids limit. Both apply the ulimits to the processes executed in the task
+// containers, so they cannot be raised above the container runtime hard
+// limits.
+type TaskLimits struct {
+	// Pids is the max number of processes of the task containers. 0 means no
+	// limit
+	Pids int64 `yaml:"pids"`
+	// MaxPids is the max pids limit a task could request. When 0 a task
+	// cannot raise the pids limit
+	MaxPids int64 `yaml:"maxPids"`
+	// Ulimits are the ulimits, keyed by name (i.e. nofile, nproc), applied to
+	// the task containers
+	Ulimits map[string]Ulimit `yaml:"ulimits"`
+	// AllowedUlimits are the ulimits a task could raise with their max
+	// values
+	AllowedUlimits map[string]Ulimit `yaml:"allowedUlimits"`
+}
+
+type Ulimit struct {
+	Soft int64 `yaml:"soft"`
+	Hard int64 `yaml:"hard"`
+}
+
+// DockerDaemon defines the docker in docker daemons dedicated to the tasks
+type DockerDaemon struct {
+	// Image is the docker daemon image used when the task doesn't define one
+	Image string `yaml:"image"`
+	// CacheMaxAge is the max age of a docker daemon cached storage. An older
+	// storage is removed and recreated empty. 0 means no max age.
+	CacheMaxAge time.Duration `yaml:"cacheMaxAge"`
+}
+
+// Buildkit defines the BuildKit daemons exported to the task main container
+// as BUILDKIT_HOST.
+//
+// Every daemon is dedicated to the listed projects: a task gets the daemon of
+// its project and no daemon when its project isn't listed. User direct runs
+// and untrusted runs tasks never get a daemon. Since the daemon local cache
+// and its cache repository are shared by all the tasks using the daemon, the
+// projects of a daemon should belong to the same tenant.
+//
+// The ref where the tasks should export and import the registry cache is
+// provided in AGOLA_BUILDKIT_CACHE_REF. Its tag is derived from the project id
+// and the daemon cacheRefKey so a project cannot guess the cache ref of the
+// other projects.
+//
+// The tcp daemons require client tls. The client certificate, its key and
+// the CA certificate are written to the task main container directory
+// provided in AGOLA_BUILDKIT_TLS_DIR (usable with buildctl --tlsdir).
+type Buildkit struct {
+	Daemons []BuildkitDaemon `yaml:"daemons"`
+}
+
+type BuildkitDaemon struct {
+	// Address is the buildkitd address (i.e. tcp://buildkitd:1234)
+	Address string `yaml:"address"`
+	// CacheRepository is the registry repository, without tag, where the
+	// tasks build caches are stored (i.e. registry.example.com/agola/cache)
+	CacheRepository string `yaml:"cacheRepository"`
+	// CacheRefKey is the secret key used to derive the projects cache ref
+	// tags
+	CacheRefKey string `yaml:"cacheRefKey"`
+	// TLS is the client tls configuration provided to the tasks. Required
+	// for tcp addresses
+	TLS *BuildkitTLS `yaml:"tls"`
+	// Projects are the ids of the projects whose tasks use this daemon
+	Projects []string `yaml:"projects"`
+}
+
+// BuildkitTLS defines the paths of the pem formatted files used by the tasks
+// to connect to a buildkit daemon
+type BuildkitTLS struct {
+	// CAFile is the CA certificate used to verify the daemon certificate
+	CAFile string `yaml:"caFile"`
+	// CertFile and KeyFile are the client certificate and key. They should
+	// be dedicated to the daemon projects.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+type LogForwarderFormat string
+
+const (
+	LogForwarderFormatJSON   LogForwarderFormat = "json"
+	LogForwarderFormatSyslog LogForwarderFormat = "syslog"
+)
+
+// LogForwarder sends every line of the run steps output, labeled with the run,
+// task and step, to a remote destination.
+//
+// The json format sends newline delimited json objects (i.e. to a fluentd tcp
+// or udp source with a json parser). The syslog format sends RFC 5424
+// messages (i.e. to a syslog daemon or to journald using the unixgram network
+// and the /dev/log address).
+type LogForwarder struct {
+	Format LogForwarderFormat `yaml:"format"`
+	// Network is one of tcp, udp, unix or unixgram
+	Network string `yaml:"network"`
+	Address string `yaml:"address"`
+	// Tag is the syslog app name or the json tag field. Defaults to "agola"
+	Tag string `yaml:"tag"`
+}
+
+// ExecutorGPUs defines the number of gpus of a specific type provided by the
+// executor
+type ExecutorGPUs struct {
+	Type  string `yaml:"type"`
+	Count int    `yaml:"count"`
+}
+
+// RegistryMirror defines a mirror for a docker registry
+type RegistryMirror struct {
+	// Registry is the mirrored registry (i.e. docker.io, quay.io)
+	Registry string `yaml:"registry"`
+	// Mirror is the mirror registry host (i.e. mirror.example.com:5000)
+	Mirror string `yaml:"mirror"`
+}
+
+// Proxy defines the proxy env vars (HTTP_PROXY, HTTPS_PROXY, NO_PROXY) that
+// will be injected in the task containers
+type Proxy struct {
+	HTTPProxy  string `yaml:"httpProxy"`
+	HTTPSProxy string `yaml:"httpsProxy"`
+	NoProxy    string `yaml:"noProxy"`
+}
+
+// NetworkPolicy restricts the egress traffic of the task containers to the
+// provided destinations. Connections to other destinations will be rejected.
+type NetworkPolicy struct {
+	Name   string              `yaml:"name"`
+	Egress []NetworkPolicyRule `yaml:"egress"`
+}
+
+type NetworkPolicyRule struct {
+	// CIDR is the allowed destination network (i.e. 10.0.0.0/8)
+	CIDR string `yaml:"cidr"`
+	// Ports are the allowed tcp and udp destination ports. All the ports are
+	// allowed when empty
+	Ports []int `yaml:"ports"`
+}
+
+// SecurityProfile defines the seccomp and apparmor profiles applied to the task
+// containers. The profiles are in the format "runtime/default", "unconfined"
+// or "localhost/<profile>". An empty profile keeps the container runtime
+// default.
+//
+// With the docker driver a localhost seccomp profile is the path of the
+// profile json file on the executor host and a localhost apparmor profile is
+// the name of a profile loaded on the docker host. With the kubernetes driver
+// they are passed as is to the pod (a localhost seccomp profile is relative to
+// the kubelet seccomp profiles dir).
+type SecurityProfile struct {
+	Name     string `yaml:"name"`
+	Seccomp  string `yaml:"seccomp"`
+	AppArmor string `yaml:"appArmor"`
 }
 
 type Configstore struct {
@@ -124,6 +569,24 @@ type Configstore struct {
 	Web           Web           `yaml:"web"`
 	Etcd          Etcd          `yaml:"etcd"`
 	ObjectStorage ObjectStorage `yaml:"objectStorage"`
+
+	// Storage defines where the configstore data is saved. Defaults to etcd
+	// and objectstorage
+	Storage ConfigstoreStorage `yaml:"storage"`
+}
+
+type ConfigstoreStorageType string
+
+const (
+	ConfigstoreStorageTypeEtcd ConfigstoreStorageType = "etcd"
+	ConfigstoreStorageTypeSQL  ConfigstoreStorageType = "sql"
+)
+
+type ConfigstoreStorage struct {
+	Type ConfigstoreStorageType `yaml:"type"`
+
+	// DB is the database used by the sql storage type
+	DB DB `yaml:"db"`
 }
 
 type Gitserver struct {
@@ -150,11 +613,32 @@ type Web struct {
 	// Server cert private key
 	// TODO(sgotti) support encrypted private keys (add a private key password config entry)
 	TLSKeyFile string `yaml:"tlsKeyFile"`
+	// TLSClientCAFile is the path to the pem formatted CA certificates used
+	// to verify the client certificates
+	TLSClientCAFile string `yaml:"tlsClientCAFile"`
+	// TLSRequireClientCert rejects the clients not providing a certificate
+	// signed by the client CAs (mutual tls)
+	TLSRequireClientCert bool `yaml:"tlsRequireClientCert"`
 
 	// CORS allowed origins
 	AllowedOrigins []string `yaml:"allowedOrigins"`
 }
 
+// ClientTLS is the tls configuration used to connect to another agola
+// component serving https. The client certificate and key are reloaded when
+// their files change.
+type ClientTLS struct {
+	// CAFile is the path to the pem formatted CA certificates used to verify
+	// the server certificate. When empty the system CAs are used.
+	CAFile string `yaml:"caFile"`
+	// CertFile and KeyFile are the paths to the pem formatted client
+	// certificate and key, provided to the servers requiring a client
+	// certificate
+	CertFile   string `yaml:"certFile"`
+	KeyFile    string `yaml:"keyFile"`
+	SkipVerify bool   `yaml:"skipVerify"`
+}
+
 type ObjectStorageType string
 
 const (
@@ -177,6 +661,20 @@ type ObjectStorage struct {
 	DisableTLS      bool   `yaml:"disableTLS"`
 }
 
+type DBType string
+
+const (
+	DBTypePostgres DBType = "postgres"
+	DBTypeSqlite3  DBType = "sqlite3"
+)
+
+type DB struct {
+	Type DBType `yaml:"type"`
+
+	// ConnString is the db connection string. For sqlite3 it's the db file path
+	ConnString string `yaml:"connString"`
+}
+
 type Etcd struct {
 	Endpoints string `yaml:"endpoints"`
 
@@ -192,6 +690,14 @@ type DriverType string
 const (
 	DriverTypeDocker DriverType = "docker"
 	DriverTypeK8s    DriverType = "kubernetes"
+	DriverTypeCRI    DriverType = "cri"
+)
+
+type WindowsIsolation string
+
+const (
+	WindowsIsolationProcess WindowsIsolation = "process"
+	WindowsIsolationHyperV  WindowsIsolation = "hyperv"
 )
 
 type Driver struct {
@@ -199,8 +705,25 @@ type Driver struct {
 
 	// docker fields
 
+	// NetworkPolicyImage is the image used to apply the network policies
+	// rules inside the pod network namespace. If it doesn't contain the
+	// iptables command it'll be installed using apk. Also used by the cri
+	// driver
+	NetworkPolicyImage string `yaml:"networkPolicyImage"`
+
+	// WindowsIsolation is the isolation technology used for windows containers
+	// when the docker daemon runs on a windows host: "process" or "hyperv".
+	// When empty the docker daemon default is used
+	WindowsIsolation WindowsIsolation `yaml:"windowsIsolation"`
+
 	// k8s fields
 
+	// cri fields
+
+	// CRIEndpoint is the container runtime CRI endpoint. Only unix sockets
+	// are supported (i.e. unix:///run/containerd/containerd.sock). When empty
+	// the containerd default socket is used
+	CRIEndpoint string `yaml:"criEndpoint"`
 }
 
 type TokenSigning struct {
@@ -216,19 +739,102 @@ type TokenSigning struct {
 	PublicKeyPath string `yaml:"publicKeyPath"`
 }
 
+type SessionCookieSameSite string
+
+const (
+	SessionCookieSameSiteDefault SessionCookieSameSite = ""
+	SessionCookieSameSiteLax     SessionCookieSameSite = "lax"
+	SessionCookieSameSiteStrict  SessionCookieSameSite = "strict"
+)
+
+type Session struct {
+	// IdleTimeout is the max time between two requests of a session. When
+	// exceeded the session is invalidated. 0 disables the idle timeout.
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+	// AbsoluteTimeout is the max session lifetime since login (defaults to
+	// the token signing duration)
+	AbsoluteTimeout time.Duration `yaml:"absoluteTimeout"`
+
+	Cookie SessionCookie `yaml:"cookie"`
+}
+
+// SessionCookie defines the cookie containing the session token set at login
+type SessionCookie struct {
+	// cookie name (defaults to "agola_session")
+	Name string `yaml:"name"`
+	// cookie domain. When empty the cookie is sent only to the gateway host
+	Domain string `yaml:"domain"`
+	// cookie path (defaults to the gateway basePath or "/")
+	Path string `yaml:"path"`
+	// cookie SameSite attribute: "lax", "strict" or empty to not set it
+	// (defaults to "lax")
+	SameSite SessionCookieSameSite `yaml:"sameSite"`
+	// Secure sends the cookie only over https (defaults to true). Set it to
+	// false only when the gateway is served over plain http
+	Secure bool `yaml:"secure"`
+	// MaxAge is the cookie max age. When 0 the cookie expires with the
+	// session absolute timeout
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// RequestLimits defines the max size in bytes of the gateway requests body by
+// endpoints class. Requests exceeding them are rejected with a 413 status code.
+type RequestLimits struct {
+	// APIMaxBodySize is the max body size of the api requests (defaults to
+	// 1MiB)
+	APIMaxBodySize int64 `yaml:"apiMaxBodySize"`
+	// WebhookMaxBodySize is the max body size of the git sources webhooks
+	// (defaults to 10MiB)
+	WebhookMaxBodySize int64 `yaml:"webhookMaxBodySize"`
+	// UploadMaxBodySize is the max body size of the uploads (the git pushes
+	// to the gitserver repositories, defaults to 256MiB)
+	UploadMaxBodySize int64 `yaml:"uploadMaxBodySize"`
+}
+
 var defaultConfig = Config{
 	ID: "agola",
 	Gateway: Gateway{
 		TokenSigning: TokenSigning{
 			Duration: 12 * time.Hour,
 		},
+		Session: Session{
+			Cookie: SessionCookie{
+				Name:     "agola_session",
+				SameSite: SessionCookieSameSiteLax,
+				Secure:   true,
+			},
+		},
+		RequestLimits: RequestLimits{
+			APIMaxBodySize:     1024 * 1024,
+			WebhookMaxBodySize: 10 * 1024 * 1024,
+			UploadMaxBodySize:  256 * 1024 * 1024,
+		},
 	},
 	Runservice: Runservice{
 		RunCacheExpireInterval:     7 * 24 * time.Hour,
 		RunWorkspaceExpireInterval: 7 * 24 * time.Hour,
+		SchedulerInterval:          2 * time.Second,
+		SchedulerMaxBackoff:        30 * time.Second,
+		SchedulerJitter:            0.2,
+		ExecutorRestartPolicy:      ExecutorRestartPolicyFail,
 	},
 	Executor: Executor{
-		ActiveTasksLimit: 2,
+		ActiveTasksLimit:                 2,
+		DanglingResourcesCleanerInterval: 5 * time.Minute,
+		DanglingResourcesGracePeriod:     30 * time.Minute,
+		ResourceUsageSamplingInterval:    10 * time.Second,
+		DockerDaemon: DockerDaemon{
+			Image: "docker:dind",
+		},
+	},
+	Configstore: Configstore{
+		Storage: ConfigstoreStorage{
+			Type: ConfigstoreStorageTypeEtcd,
+		},
+	},
+	Tracing: Tracing{
+		ServiceName:   "agola",
+		SamplingRatio: 1,
 	},
 }
 
@@ -238,12 +844,73 @@ func Parse(configFile string, componentsNames []string) (*Config, error) {
 		return nil, err
 	}
 
-	c := &defaultConfig
+	c := defaultConfig
 	if err := yaml.Unmarshal(configData, &c); err != nil {
 		return nil, err
 	}
 
-	return c, Validate(c, componentsNames)
+	return &c, Validate(&c, componentsNames)
+}
+
+// clearReloadableFields zeroes the config fields that can be reloaded without
+// restarting the services
+func clearReloadableFields(c *Config) {
+	c.Gateway.Debug = false
+	c.Scheduler.Debug = false
+	c.Notification.Debug = false
+	c.Notification.Notifiers = nil
+	c.Notification.Routes = nil
+	c.Runservice.Debug = false
+	c.Executor.Debug = false
+	c.Configstore.Debug = false
+	c.Gitserver.Debug = false
+}
+
+// RestartRequiredChanges returns the config sections of the enabled components
+// with changes that can't be applied by reloading the config (everything but
+// the debug options and the notification notifiers and routes).
+func RestartRequiredChanges(oldc, newc *Config, componentsNames []string) ([]string, error) {
+	oc, err := copystructure.Copy(oldc)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := copystructure.Copy(newc)
+	if err != nil {
+		return nil, err
+	}
+	o := oc.(*Config)
+	n := nc.(*Config)
+	clearReloadableFields(o)
+	clearReloadableFields(n)
+
+	sections := []struct {
+		name       string
+		component  string
+		oldSection interface{}
+		newSection interface{}
+	}{
+		{"id", "", o.ID, n.ID},
+		{"gateway", "gateway", o.Gateway, n.Gateway},
+		{"scheduler", "scheduler", o.Scheduler, n.Scheduler},
+		{"notification", "notification", o.Notification, n.Notification},
+		{"runservice", "runservice", o.Runservice, n.Runservice},
+		{"executor", "executor", o.Executor, n.Executor},
+		{"configstore", "configstore", o.Configstore, n.Configstore},
+		{"gitserver", "gitserver", o.Gitserver, n.Gitserver},
+		{"tracing", "", o.Tracing, n.Tracing},
+	}
+
+	changes := []string{}
+	for _, s := range sections {
+		if s.component != "" && !isComponentEnabled(componentsNames, s.component) {
+			continue
+		}
+		if !reflect.DeepEqual(s.oldSection, s.newSection) {
+			changes = append(changes, s.name)
+		}
+	}
+
+	return changes, nil
 }
 
 func validateWeb(w *Web) error {
@@ -251,6 +918,10 @@ func validateWeb(w *Web) error {
 		return errors.Errorf("listen address undefined")
 	}
 
+	return validateWebTLS(w)
+}
+
+func validateWebTLS(w *Web) error {
 	if w.TLS {
 		if w.TLSKeyFile == "" {
 			return errors.Errorf("no tls key file specified")
@@ -258,11 +929,83 @@ func validateWeb(w *Web) error {
 		if w.TLSCertFile == "" {
 			return errors.Errorf("no tls cert file specified")
 		}
+	} else if w.TLSClientCAFile != "" || w.TLSRequireClientCert {
+		return errors.Errorf("client certificates verification requires tls")
+	}
+	if w.TLSRequireClientCert && w.TLSClientCAFile == "" {
+		return errors.Errorf("no tls client CA file specified")
 	}
 
 	return nil
 }
 
+func validateClientTLS(c *ClientTLS) error {
+	if c == nil {
+		return nil
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.Errorf("client certificate and key files must be both specified")
+	}
+
+	return nil
+}
+
+func validateSession(s *Session) error {
+	if s.IdleTimeout < 0 {
+		return errors.Errorf("negative idle timeout")
+	}
+	if s.AbsoluteTimeout < 0 {
+		return errors.Errorf("negative absolute timeout")
+	}
+	if s.Cookie.Name == "" {
+		return errors.Errorf("cookie name undefined")
+	}
+	if s.Cookie.Path != "" && !strings.HasPrefix(s.Cookie.Path, "/") {
+		return errors.Errorf("cookie path %q must be an absolute path", s.Cookie.Path)
+	}
+	switch s.Cookie.SameSite {
+	case SessionCookieSameSiteDefault:
+	case SessionCookieSameSiteLax:
+	case SessionCookieSameSiteStrict:
+	default:
+		return errors.Errorf("unknown cookie sameSite %q", s.Cookie.SameSite)
+	}
+	if s.Cookie.MaxAge < 0 {
+		return errors.Errorf("negative cookie maxAge")
+	}
+
+	return nil
+}
+
+func validateRequestLimits(l *RequestLimits) error {
+	if l.APIMaxBodySize <= 0 {
+		return errors.Errorf("apiMaxBodySize must be greater than 0")
+	}
+	if l.WebhookMaxBodySize <= 0 {
+		return errors.Errorf("webhookMaxBodySize must be greater than 0")
+	}
+	if l.UploadMaxBodySize <= 0 {
+		return errors.Errorf("uploadMaxBodySize must be greater than 0")
+	}
+	return nil
+}
+
+func validateObjectStorage(ost *ObjectStorage) error {
+	switch ost.Type {
+	case ObjectStorageTypePosix:
+		if ost.Path == "" {
+			return errors.Errorf("path is empty")
+		}
+	case ObjectStorageTypeS3:
+		if ost.Bucket == "" {
+			return errors.Errorf("bucket is empty")
+		}
+	default:
+		return errors.Errorf("type %q unknown", ost.Type)
+	}
+	return nil
+}
+
 func Validate(c *Config, componentsNames []string) error {
 	// Global
 	if len(c.ID) > maxIDLength {
@@ -272,6 +1015,11 @@ func Validate(c *Config, componentsNames []string) error {
 		return errors.Errorf("invalid id")
 	}
 
+	// Tracing
+	if c.Tracing.SamplingRatio < 0 || c.Tracing.SamplingRatio > 1 {
+		return errors.Errorf("tracing samplingRatio must be between 0 and 1")
+	}
+
 	// Gateway
 	if isComponentEnabled(componentsNames, "gateway") {
 		if c.Gateway.APIExposedURL == "" {
@@ -280,6 +1028,11 @@ func Validate(c *Config, componentsNames []string) error {
 		if c.Gateway.WebExposedURL == "" {
 			return errors.Errorf("gateway webExposedURL is empty")
 		}
+		if c.Gateway.BasePath != "" {
+			if !strings.HasPrefix(c.Gateway.BasePath, "/") || strings.Trim(c.Gateway.BasePath, "/") == "" {
+				return errors.Errorf("gateway basePath %q must be an absolute path different from /", c.Gateway.BasePath)
+			}
+		}
 		if c.Gateway.ConfigstoreURL == "" {
 			return errors.Errorf("gateway configstoreURL is empty")
 		}
@@ -289,6 +1042,18 @@ func Validate(c *Config, componentsNames []string) error {
 		if err := validateWeb(&c.Gateway.Web); err != nil {
 			return errors.Errorf("gateway web configuration error: %w", err)
 		}
+		if err := validateClientTLS(c.Gateway.RunserviceTLS); err != nil {
+			return errors.Errorf("gateway runserviceTLS configuration error: %w", err)
+		}
+		if err := validateClientTLS(c.Gateway.ConfigstoreTLS); err != nil {
+			return errors.Errorf("gateway configstoreTLS configuration error: %w", err)
+		}
+		if err := validateSession(&c.Gateway.Session); err != nil {
+			return errors.Errorf("gateway session configuration error: %w", err)
+		}
+		if err := validateRequestLimits(&c.Gateway.RequestLimits); err != nil {
+			return errors.Errorf("gateway requestLimits configuration error: %w", err)
+		}
 	}
 
 	// Configstore
@@ -299,6 +1064,21 @@ func Validate(c *Config, componentsNames []string) error {
 		if err := validateWeb(&c.Configstore.Web); err != nil {
 			return errors.Errorf("configstore web configuration error: %w", err)
 		}
+		switch c.Configstore.Storage.Type {
+		case ConfigstoreStorageTypeEtcd:
+		case ConfigstoreStorageTypeSQL:
+			switch c.Configstore.Storage.DB.Type {
+			case DBTypePostgres:
+			case DBTypeSqlite3:
+			default:
+				return errors.Errorf("configstore storage db type %q unknown", c.Configstore.Storage.DB.Type)
+			}
+			if c.Configstore.Storage.DB.ConnString == "" {
+				return errors.Errorf("configstore storage db connString is empty")
+			}
+		default:
+			return errors.Errorf("configstore storage type %q unknown", c.Configstore.Storage.Type)
+		}
 	}
 
 	// Runservice
@@ -309,6 +1089,45 @@ func Validate(c *Config, componentsNames []string) error {
 		if err := validateWeb(&c.Runservice.Web); err != nil {
 			return errors.Errorf("runservice web configuration error: %w", err)
 		}
+		if err := validateClientTLS(c.Runservice.ExecutorsTLS); err != nil {
+			return errors.Errorf("runservice executorsTLS configuration error: %w", err)
+		}
+		dataObjectStorages := []struct {
+			name string
+			ost  *ObjectStorage
+		}{
+			{"logsObjectStorage", c.Runservice.LogsObjectStorage},
+			{"archivesObjectStorage", c.Runservice.ArchivesObjectStorage},
+			{"cacheObjectStorage", c.Runservice.CacheObjectStorage},
+		}
+		for _, d := range dataObjectStorages {
+			if d.ost == nil {
+				continue
+			}
+			if err := validateObjectStorage(d.ost); err != nil {
+				return errors.Errorf("runservice %s configuration error: %w", d.name, err)
+			}
+		}
+		if err := validateSchedulingPauseWindows(c.Runservice.SchedulingPauseWindows); err != nil {
+			return err
+		}
+		if c.Runservice.SchedulerInterval <= 0 {
+			return errors.Errorf("runservice schedulerInterval must be greater than 0")
+		}
+		if c.Runservice.SchedulerMaxBackoff < 0 {
+			return errors.Errorf("runservice schedulerMaxBackoff must be greater or equal than 0")
+		}
+		if c.Runservice.SchedulerJitter < 0 || c.Runservice.SchedulerJitter > 1 {
+			return errors.Errorf("runservice schedulerJitter must be between 0 and 1")
+		}
+		switch c.Runservice.ExecutorRestartPolicy {
+		case ExecutorRestartPolicyFail, ExecutorRestartPolicyReschedule:
+		default:
+			return errors.Errorf("runservice executorRestartPolicy must be %q or %q", ExecutorRestartPolicyFail, ExecutorRestartPolicyReschedule)
+		}
+		if err := validateIDToken(c.Runservice.IDToken); err != nil {
+			return err
+		}
 	}
 
 	// Executor
@@ -322,15 +1141,85 @@ func Validate(c *Config, componentsNames []string) error {
 		if c.Executor.RunserviceURL == "" {
 			return errors.Errorf("executor runserviceURL is empty")
 		}
+		if err := validateWebTLS(&c.Executor.Web); err != nil {
+			return errors.Errorf("executor web configuration error: %w", err)
+		}
+		if err := validateClientTLS(c.Executor.RunserviceTLS); err != nil {
+			return errors.Errorf("executor runserviceTLS configuration error: %w", err)
+		}
 		if c.Executor.Driver.Type == "" {
 			return errors.Errorf("executor driver type is empty")
 		}
 		switch c.Executor.Driver.Type {
 		case DriverTypeDocker:
 		case DriverTypeK8s:
+		case DriverTypeCRI:
 		default:
 			return errors.Errorf("executor driver type %q unknown", c.Executor.Driver.Type)
 		}
+		switch c.Executor.Driver.WindowsIsolation {
+		case "":
+		case WindowsIsolationProcess, WindowsIsolationHyperV:
+			if c.Executor.Driver.Type != DriverTypeDocker {
+				return errors.Errorf("executor driver windowsIsolation is supported only by the docker driver")
+			}
+		default:
+			return errors.Errorf("executor driver windowsIsolation %q unknown", c.Executor.Driver.WindowsIsolation)
+		}
+		if err := validateNetworkPolicies(c.Executor.NetworkPolicies); err != nil {
+			return err
+		}
+		if err := validateSecurityProfiles(c.Executor.SecurityProfiles, c.Executor.DefaultSecurityProfile); err != nil {
+			return err
+		}
+		if err := validateExecutorGPUs(c.Executor.GPUs); err != nil {
+			return err
+		}
+		if err := validateRegistryMirrors(c.Executor.RegistryMirrors); err != nil {
+			return err
+		}
+		if c.Executor.ActiveTasksLimit < 0 {
+			return errors.Errorf("executor active_tasks_limit must be greater or equal than 0")
+		}
+		if c.Executor.CPUs < 0 {
+			return errors.Errorf("executor cpus must be greater or equal than 0")
+		}
+		if c.Executor.CPUOversubscriptionRatio < 0 {
+			return errors.Errorf("executor cpuOversubscriptionRatio must be greater or equal than 0")
+		}
+		if c.Executor.MaxStepLogSize < 0 {
+			return errors.Errorf("executor maxStepLogSize must be greater or equal than 0")
+		}
+		if c.Executor.MaxTmpFSSize < 0 {
+			return errors.Errorf("executor maxTmpFSSize must be greater or equal than 0")
+		}
+		if c.Executor.DanglingResourcesCleanerInterval < 0 {
+			return errors.Errorf("executor danglingResourcesCleanerInterval must be greater or equal than 0")
+		}
+		if c.Executor.DanglingResourcesGracePeriod < 0 {
+			return errors.Errorf("executor danglingResourcesGracePeriod must be greater or equal than 0")
+		}
+		if c.Executor.ResourceUsageSamplingInterval < 0 {
+			return errors.Errorf("executor resourceUsageSamplingInterval must be greater or equal than 0")
+		}
+		if err := validateLogForwarder(c.Executor.LogForwarder); err != nil {
+			return err
+		}
+		if err := validateBuildkit(c.Executor.Buildkit); err != nil {
+			return err
+		}
+		if c.Executor.DebugHoldTTL < 0 {
+			return errors.Errorf("executor debugHoldTTL must be greater or equal than 0")
+		}
+		if c.Executor.DockerDaemon.Image == "" {
+			return errors.Errorf("executor dockerDaemon image is empty")
+		}
+		if c.Executor.DockerDaemon.CacheMaxAge < 0 {
+			return errors.Errorf("executor dockerDaemon cacheMaxAge must be greater or equal than 0")
+		}
+		if err := validateTaskLimits(&c.Executor.TaskLimits, c.Executor.Driver.Type); err != nil {
+			return err
+		}
 	}
 
 	// Scheduler
@@ -338,6 +1227,9 @@ func Validate(c *Config, componentsNames []string) error {
 		if c.Scheduler.RunserviceURL == "" {
 			return errors.Errorf("scheduler runserviceURL is empty")
 		}
+		if err := validateClientTLS(c.Scheduler.RunserviceTLS); err != nil {
+			return errors.Errorf("scheduler runserviceTLS configuration error: %w", err)
+		}
 	}
 
 	// Notification
@@ -351,6 +1243,15 @@ func Validate(c *Config, componentsNames []string) error {
 		if c.Notification.RunserviceURL == "" {
 			return errors.Errorf("notification runserviceURL is empty")
 		}
+		if err := validateClientTLS(c.Notification.RunserviceTLS); err != nil {
+			return errors.Errorf("notification runserviceTLS configuration error: %w", err)
+		}
+		if err := validateClientTLS(c.Notification.ConfigstoreTLS); err != nil {
+			return errors.Errorf("notification configstoreTLS configuration error: %w", err)
+		}
+		if err := validateNotifiers(c.Notification.Notifiers, c.Notification.Routes); err != nil {
+			return err
+		}
 	}
 
 	// Git server
@@ -369,3 +1270,283 @@ func isComponentEnabled(componentsNames []string, name string) bool {
 	}
 	return util.StringInSlice(componentsNames, name)
 }
+
+func validateNotifiers(notifiers []Notifier, routes []NotificationRoute) error {
+	names := map[string]struct{}{}
+	for _, n := range notifiers {
+		if n.Name == "" {
+			return errors.Errorf("notifier name is empty")
+		}
+		if _, ok := names[n.Name]; ok {
+			return errors.Errorf("notifier %q is duplicated", n.Name)
+		}
+		names[n.Name] = struct{}{}
+
+		switch n.Type {
+		case NotifierTypeWebhook, NotifierTypeSlack:
+			if n.URL == "" {
+				return errors.Errorf("notifier %q url is empty", n.Name)
+			}
+		case NotifierTypePagerDuty:
+			if n.RoutingKey == "" {
+				return errors.Errorf("notifier %q routingKey is empty", n.Name)
+			}
+		default:
+			return errors.Errorf("notifier %q type %q unknown", n.Name, n.Type)
+		}
+	}
+
+	for i, r := range routes {
+		if len(r.Notifiers) == 0 {
+			return errors.Errorf("notification route %d doesn't define any notifier", i)
+		}
+		for _, name := range r.Notifiers {
+			if _, ok := names[name]; !ok {
+				return errors.Errorf("notification route %d references undefined notifier %q", i, name)
+			}
+		}
+		for _, ev := range r.Events {
+			if !ev.IsValid() {
+				return errors.Errorf("notification route %d has a wrong event type %q", i, ev)
+			}
+		}
+		for _, patterns := range [][]string{r.Projects, r.Branches} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return errors.Errorf("notification route %d has a wrong pattern %q: %w", i, pattern, err)
+				}
+			}
+		}
+		for _, tag := range r.Tags {
+			if !util.ValidateTag(tag) {
+				return errors.Errorf("notification route %d has a wrong run tag %q", i, tag)
+			}
+		}
+	}
+	return nil
+}
+
+func validateExecutorGPUs(gpus []ExecutorGPUs) error {
+	seenTypes := map[string]struct{}{}
+	for _, g := range gpus {
+		if g.Count <= 0 {
+			return errors.Errorf("executor gpus %q count must be greater than 0", g.Type)
+		}
+		if _, ok := seenTypes[g.Type]; ok {
+			return errors.Errorf("executor gpus type %q is duplicated", g.Type)
+		}
+		seenTypes[g.Type] = struct{}{}
+	}
+	return nil
+}
+
+func validateRegistryMirrors(mirrors []RegistryMirror) error {
+	registries := map[string]struct{}{}
+	for _, m := range mirrors {
+		if m.Registry == "" {
+			return errors.Errorf("executor registry mirror registry is empty")
+		}
+		if m.Mirror == "" {
+			return errors.Errorf("executor registry mirror for registry %q is empty", m.Registry)
+		}
+		if strings.Contains(m.Mirror, "://") || strings.Contains(m.Mirror, "/") {
+			return errors.Errorf("executor registry mirror %q must be a registry host without scheme or path", m.Mirror)
+		}
+		if _, ok := registries[m.Registry]; ok {
+			return errors.Errorf("executor registry mirror for registry %q is duplicated", m.Registry)
+		}
+		registries[m.Registry] = struct{}{}
+	}
+	return nil
+}
+
+func validateLogForwarder(f *LogForwarder) error {
+	if f == nil {
+		return nil
+	}
+	switch f.Format {
+	case LogForwarderFormatJSON, LogForwarderFormatSyslog:
+	default:
+		return errors.Errorf("executor logForwarder format %q unknown", f.Format)
+	}
+	switch f.Network {
+	case "tcp", "udp", "unix", "unixgram":
+	default:
+		return errors.Errorf("executor logForwarder network %q unknown", f.Network)
+	}
+	if f.Address == "" {
+		return errors.Errorf("executor logForwarder address is empty")
+	}
+	return nil
+}
+
+func validateBuildkit(b *Buildkit) error {
+	if b == nil {
+		return nil
+	}
+	projects := map[string]struct{}{}
+	for _, d := range b.Daemons {
+		if !strings.HasPrefix(d.Address, "tcp://") && !strings.HasPrefix(d.Address, "unix://") {
+			return errors.Errorf("executor buildkit daemon address %q must be a tcp:// or unix:// address", d.Address)
+		}
+		if d.CacheRepository == "" {
+			return errors.Errorf("executor buildkit daemon %q cacheRepository is empty", d.Address)
+		}
+		if strings.Contains(d.CacheRepository, "://") || strings.Contains(d.CacheRepository, "@") || strings.Contains(path.Base(d.CacheRepository), ":") {
+			return errors.Errorf("executor buildkit daemon cacheRepository %q must be a repository without scheme or tag", d.CacheRepository)
+		}
+		if d.CacheRefKey == "" {
+			return errors.Errorf("executor buildkit daemon %q cacheRefKey is empty", d.Address)
+		}
+		if d.TLS == nil {
+			if strings.HasPrefix(d.Address, "tcp://") {
+				return errors.Errorf("executor buildkit daemon %q requires tls", d.Address)
+			}
+		} else if d.TLS.CAFile == "" || d.TLS.CertFile == "" || d.TLS.KeyFile == "" {
+			return errors.Errorf("executor buildkit daemon %q tls caFile, certFile and keyFile must be all specified", d.Address)
+		}
+		if len(d.Projects) == 0 {
+			return errors.Errorf("executor buildkit daemon %q projects are empty", d.Address)
+		}
+		for _, projectID := range d.Projects {
+			if _, ok := projects[projectID]; ok {
+				return errors.Errorf("executor buildkit project %q is assigned to multiple daemons", projectID)
+			}
+			projects[projectID] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func validateIDToken(t *IDToken) error {
+	if t == nil {
+		return nil
+	}
+	if t.Issuer == "" {
+		return errors.Errorf("runservice idToken issuer is empty")
+	}
+	if t.PrivateKeyPath == "" {
+		return errors.Errorf("runservice idToken privateKeyPath is empty")
+	}
+	if t.Duration < 0 {
+		return errors.Errorf("runservice idToken duration must be greater or equal than 0")
+	}
+	return nil
+}
+
+var weekdays = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+
+func validateSchedulingPauseWindows(windows []SchedulingPauseWindow) error {
+	for _, w := range windows {
+		start, err := time.Parse("15:04", w.Start)
+		if err != nil {
+			return errors.Errorf("runservice scheduling pause window wrong start time %q", w.Start)
+		}
+		end, err := time.Parse("15:04", w.End)
+		if err != nil {
+			return errors.Errorf("runservice scheduling pause window wrong end time %q", w.End)
+		}
+		if start.Equal(end) {
+			return errors.Errorf("runservice scheduling pause window start and end times must be different")
+		}
+		for _, weekday := range w.Weekdays {
+			if !util.StringInSlice(weekdays, strings.ToLower(weekday)) {
+				return errors.Errorf("runservice scheduling pause window wrong weekday %q", weekday)
+			}
+		}
+	}
+	return nil
+}
+
+func validateNetworkPolicies(networkPolicies []NetworkPolicy) error {
+	names := map[string]struct{}{}
+	for _, np := range networkPolicies {
+		if np.Name == "" {
+			return errors.Errorf("executor network policy name is empty")
+		}
+		if _, ok := names[np.Name]; ok {
+			return errors.Errorf("executor network policy %q is duplicated", np.Name)
+		}
+		names[np.Name] = struct{}{}
+
+		for _, rule := range np.Egress {
+			if _, _, err := net.ParseCIDR(rule.CIDR); err != nil {
+				return errors.Errorf("executor network policy %q has a wrong cidr %q: %w", np.Name, rule.CIDR, err)
+			}
+			for _, port := range rule.Ports {
+				if port < 1 || port > 65535 {
+					return errors.Errorf("executor network policy %q has a wrong port %d", np.Name, port)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func validateTaskLimits(tl *TaskLimits, driverType DriverType) error {
+	if tl.Pids < 0 {
+		return errors.Errorf("executor taskLimits pids must be greater or equal than 0")
+	}
+	if tl.MaxPids < 0 {
+		return errors.Errorf("executor taskLimits maxPids must be greater or equal than 0")
+	}
+	if tl.MaxPids > 0 && tl.Pids > tl.MaxPids {
+		return errors.Errorf("executor taskLimits pids must be less or equal than maxPids")
+	}
+	if (tl.Pids > 0 || tl.MaxPids > 0) && driverType == DriverTypeK8s {
+		return errors.Errorf("executor taskLimits pids isn't supported by the kubernetes driver, use the kubelet podPidsLimit")
+	}
+	if (tl.Pids > 0 || tl.MaxPids > 0) && driverType == DriverTypeCRI {
+		return errors.Errorf("executor taskLimits pids isn't supported by the cri driver")
+	}
+	for _, ulimits := range []map[string]Ulimit{tl.Ulimits, tl.AllowedUlimits} {
+		for name, ulimit := range ulimits {
+			if !types.IsValidUlimit(name) {
+				return errors.Errorf("executor taskLimits has an unknown ulimit %q", name)
+			}
+			if ulimit.Soft <= 0 || ulimit.Hard <= 0 {
+				return errors.Errorf("executor taskLimits ulimit %q values must be greater than 0", name)
+			}
+			if ulimit.Soft > ulimit.Hard {
+				return errors.Errorf("executor taskLimits ulimit %q soft value must be less or equal than the hard value", name)
+			}
+		}
+	}
+	return nil
+}
+
+func validateSecurityProfileValue(v string) bool {
+	switch {
+	case v == "", v == "runtime/default", v == "unconfined":
+		return true
+	case strings.HasPrefix(v, "localhost/") && len(v) > len("localhost/"):
+		return true
+	}
+	return false
+}
+
+func validateSecurityProfiles(securityProfiles []SecurityProfile, defaultSecurityProfile string) error {
+	names := map[string]struct{}{}
+	for _, sp := range securityProfiles {
+		if sp.Name == "" {
+			return errors.Errorf("executor security profile name is empty")
+		}
+		if _, ok := names[sp.Name]; ok {
+			return errors.Errorf("executor security profile %q is duplicated", sp.Name)
+		}
+		names[sp.Name] = struct{}{}
+
+		if !validateSecurityProfileValue(sp.Seccomp) {
+			return errors.Errorf("executor security profile %q has a wrong seccomp profile %q", sp.Name, sp.Seccomp)
+		}
+		if !validateSecurityProfileValue(sp.AppArmor) {
+			return errors.Errorf("executor security profile %q has a wrong apparmor profile %q", sp.Name, sp.AppArmor)
+		}
+	}
+	if defaultSecurityProfile != "" {
+		if _, ok := names[defaultSecurityProfile]; !ok {
+			return errors.Errorf("executor default security profile %q is not defined", defaultSecurityProfile)
+		}
+	}
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 
 	errors "golang.org/x/xerrors"
@@ -225,6 +226,883 @@ gitserver:
   dataDir:`,
 			err: errors.Errorf("git server dataDir is empty"),
 		},
+		{
+			name:     "test config for configstore with sql storage",
+			services: []string{"configstore"},
+			in: `
+configstore:
+  dataDir: /data/agola/configstore
+  web:
+    listenAddress: ":4002"
+  storage:
+    type: sql
+    db:
+      type: postgres
+      connString: "postgres://agola@localhost/agola"`,
+		},
+		{
+			name:     "test config for configstore with sql storage without db connString",
+			services: []string{"configstore"},
+			in: `
+configstore:
+  dataDir: /data/agola/configstore
+  web:
+    listenAddress: ":4002"
+  storage:
+    type: sql
+    db:
+      type: postgres`,
+			err: errors.Errorf("configstore storage db connString is empty"),
+		},
+		{
+			name:     "test config for configstore with wrong storage type",
+			services: []string{"configstore"},
+			in: `
+configstore:
+  dataDir: /data/agola/configstore
+  web:
+    listenAddress: ":4002"
+  storage:
+    type: wrongtype`,
+			err: errors.Errorf(`configstore storage type "wrongtype" unknown`),
+		},
+		{
+			name:     "test config for runservice with dedicated logs object storage",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  logsObjectStorage:
+    type: posix
+    path: /data/agola/runservice/logs`,
+		},
+		{
+			name:     "test config for runservice with wrong archives object storage type",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  archivesObjectStorage:
+    type: wrongtype`,
+			err: errors.Errorf(`runservice archivesObjectStorage configuration error: type "wrongtype" unknown`),
+		},
+		{
+			name:     "test config for runservice with scheduling pause windows",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  schedulingPauseWindows:
+    - start: "22:00"
+      end: "02:00"
+      weekdays:
+        - saturday
+        - Sunday`,
+		},
+		{
+			name:     "test config for runservice with scheduling pause window with wrong end time",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  schedulingPauseWindows:
+    - start: "22:00"
+      end: "25:00"`,
+			err: errors.Errorf(`runservice scheduling pause window wrong end time "25:00"`),
+		},
+		{
+			name:     "test config for runservice with scheduler backoff",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  schedulerInterval: 5s
+  schedulerMaxBackoff: 1m
+  schedulerJitter: 0.5`,
+		},
+		{
+			name:     "test config for runservice with wrong scheduler jitter",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  schedulerJitter: 1.5`,
+			err: errors.Errorf("runservice schedulerJitter must be between 0 and 1"),
+		},
+		{
+			name:     "test config for runservice with reschedule executor restart policy",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  executorRestartPolicy: reschedule`,
+		},
+		{
+			name:     "test config for runservice with wrong executor restart policy",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  executorRestartPolicy: retry`,
+			err: errors.Errorf(`runservice executorRestartPolicy must be "fail" or "reschedule"`),
+		},
+		{
+			name:     "test config for runservice with id token",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  idToken:
+    issuer: "https://myagola.example.com"
+    audience: "sts.amazonaws.com"
+    privateKeyPath: /etc/agola/idtoken.key`,
+		},
+		{
+			name:     "test config for runservice with id token without private key",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  idToken:
+    issuer: "https://myagola.example.com"`,
+			err: errors.Errorf("runservice idToken privateKeyPath is empty"),
+		},
+		{
+			name:     "test config for runservice with mutual tls",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+    tls: true
+    tlsCertFile: /certs/runservice.crt
+    tlsKeyFile: /certs/runservice.key
+    tlsClientCAFile: /certs/ca.crt
+    tlsRequireClientCert: true
+  executorsTLS:
+    caFile: /certs/ca.crt
+    certFile: /certs/runservice-client.crt
+    keyFile: /certs/runservice-client.key`,
+		},
+		{
+			name:     "test config for runservice requiring client certificates without client CA",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+    tls: true
+    tlsCertFile: /certs/runservice.crt
+    tlsKeyFile: /certs/runservice.key
+    tlsRequireClientCert: true`,
+			err: errors.Errorf("runservice web configuration error: no tls client CA file specified"),
+		},
+		{
+			name:     "test config for runservice executors tls with client certificate without key",
+			services: []string{"runservice"},
+			in: `
+runservice:
+  dataDir: /data/agola/runservice
+  web:
+    listenAddress: ":4000"
+  executorsTLS:
+    certFile: /certs/runservice-client.crt`,
+			err: errors.Errorf("runservice executorsTLS configuration error: client certificate and key files must be both specified"),
+		},
+		{
+			name:     "test config with tracing",
+			services: []string{"scheduler"},
+			in: `
+scheduler:
+  runserviceURL: "http://localhost:4000"
+
+tracing:
+  endpoint: "http://localhost:4318"
+  samplingRatio: 0.2`,
+		},
+		{
+			name:     "test config with wrong tracing sampling ratio",
+			services: []string{"scheduler"},
+			in: `
+scheduler:
+  runserviceURL: "http://localhost:4000"
+
+tracing:
+  endpoint: "http://localhost:4318"
+  samplingRatio: 2`,
+			err: errors.Errorf("tracing samplingRatio must be between 0 and 1"),
+		},
+		{
+			name:     "test config for executor with network policies",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  networkPolicies:
+    - name: mirror
+      egress:
+        - cidr: 10.0.0.0/24
+          ports: [53, 443]
+    - name: untrusted
+      egress:
+        - cidr: 10.0.0.1/32
+          ports: [443]`,
+		},
+		{
+			name:     "test config for executor with duplicated network policies",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  networkPolicies:
+    - name: mirror
+    - name: mirror`,
+			err: errors.Errorf(`executor network policy "mirror" is duplicated`),
+		},
+		{
+			name:     "test config for executor with network policy with wrong port",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  networkPolicies:
+    - name: mirror
+      egress:
+        - cidr: 10.0.0.0/24
+          ports: [0]`,
+			err: errors.Errorf(`executor network policy "mirror" has a wrong port 0`),
+		},
+		{
+			name:     "test config for executor with security profiles",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  securityProfiles:
+    - name: restricted
+      seccomp: runtime/default
+      appArmor: localhost/agola-restricted
+  defaultSecurityProfile: restricted`,
+		},
+		{
+			name:     "test config for executor with undefined default security profile",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  securityProfiles:
+    - name: restricted
+      seccomp: runtime/default
+  defaultSecurityProfile: strict`,
+			err: errors.Errorf(`executor default security profile "strict" is not defined`),
+		},
+		{
+			name:     "test config for executor with security profile with wrong seccomp profile",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  securityProfiles:
+    - name: restricted
+      seccomp: strict`,
+			err: errors.Errorf(`executor security profile "restricted" has a wrong seccomp profile "strict"`),
+		},
+		{
+			name:     "test config for executor with negative cpus",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  cpus: -1`,
+			err: errors.Errorf(`executor cpus must be greater or equal than 0`),
+		},
+		{
+			name:     "test config for executor with negative cpu oversubscription ratio",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  cpuOversubscriptionRatio: -1.5`,
+			err: errors.Errorf(`executor cpuOversubscriptionRatio must be greater or equal than 0`),
+		},
+		{
+			name:     "test config for executor with negative max step log size",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  maxStepLogSize: -1`,
+			err: errors.Errorf(`executor maxStepLogSize must be greater or equal than 0`),
+		},
+		{
+			name:     "test config for executor with negative dangling resources grace period",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  danglingResourcesGracePeriod: -1m`,
+			err: errors.Errorf(`executor danglingResourcesGracePeriod must be greater or equal than 0`),
+		},
+		{
+			name:     "test config for executor with negative resource usage sampling interval",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  resourceUsageSamplingInterval: -1s`,
+			err: errors.Errorf("executor resourceUsageSamplingInterval must be greater or equal than 0"),
+		},
+		{
+			name:     "test config for executor with negative debug hold ttl",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  debugHoldTTL: -1m`,
+			err: errors.Errorf("executor debugHoldTTL must be greater or equal than 0"),
+		},
+		{
+			name:     "test config for executor with negative docker daemon cache max age",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  dockerDaemon:
+    cacheMaxAge: -1h`,
+			err: errors.Errorf("executor dockerDaemon cacheMaxAge must be greater or equal than 0"),
+		},
+		{
+			name:     "test config for executor with task limits",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  taskLimits:
+    pids: 1024
+    maxPids: 4096
+    ulimits:
+      nofile:
+        soft: 1024
+        hard: 4096
+      nproc:
+        soft: 512
+        hard: 512
+    allowedUlimits:
+      nofile:
+        soft: 65536
+        hard: 65536`,
+		},
+		{
+			name:     "test config for executor with unknown task ulimit",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  taskLimits:
+    ulimits:
+      nofiles:
+        soft: 1024
+        hard: 4096`,
+			err: errors.Errorf(`executor taskLimits has an unknown ulimit "nofiles"`),
+		},
+		{
+			name:     "test config for executor with task ulimit soft value greater than hard value",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  taskLimits:
+    ulimits:
+      nofile:
+        soft: 4096
+        hard: 1024`,
+			err: errors.Errorf(`executor taskLimits ulimit "nofile" soft value must be less or equal than the hard value`),
+		},
+		{
+			name:     "test config for executor with task pids limit and kubernetes driver",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: kubernetes
+  taskLimits:
+    pids: 1024`,
+			err: errors.Errorf("executor taskLimits pids isn't supported by the kubernetes driver, use the kubelet podPidsLimit"),
+		},
+		{
+			name:     "test config for executor with task pids limit and cri driver",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: cri
+  taskLimits:
+    pids: 1024`,
+			err: errors.Errorf("executor taskLimits pids isn't supported by the cri driver"),
+		},
+		{
+			name:     "test config for executor with duplicated gpus type",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  gpus:
+    - type: tesla-t4
+      count: 2
+    - type: tesla-t4
+      count: 1`,
+			err: errors.Errorf(`executor gpus type "tesla-t4" is duplicated`),
+		},
+		{
+			name:     "test config for executor with duplicated registry mirror",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  registryMirrors:
+    - registry: docker.io
+      mirror: mirror.example.com
+    - registry: docker.io
+      mirror: mirror2.example.com`,
+			err: errors.Errorf(`executor registry mirror for registry "docker.io" is duplicated`),
+		},
+		{
+			name:     "test config for executor with registry mirror with scheme",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  registryMirrors:
+    - registry: docker.io
+      mirror: https://mirror.example.com`,
+			err: errors.Errorf(`executor registry mirror "https://mirror.example.com" must be a registry host without scheme or path`),
+		},
+		{
+			name:     "test config for executor with unknown windows isolation",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+    windowsIsolation: vm`,
+			err: errors.Errorf(`executor driver windowsIsolation "vm" unknown`),
+		},
+		{
+			name:     "test config for executor with unknown log forwarder format",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  logForwarder:
+    format: gelf
+    network: udp
+    address: "localhost:12201"`,
+			err: errors.Errorf(`executor logForwarder format "gelf" unknown`),
+		},
+		{
+			name:     "test config for executor with log forwarder without address",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  logForwarder:
+    format: syslog
+    network: unixgram`,
+			err: errors.Errorf(`executor logForwarder address is empty`),
+		},
+		{
+			name:     "test config for executor with buildkit http address",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  buildkit:
+    daemons:
+    - address: "http://buildkitd:1234"
+      cacheRepository: registry.example.com/agola/cache
+      projects:
+      - 6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10`,
+			err: errors.Errorf(`executor buildkit daemon address "http://buildkitd:1234" must be a tcp:// or unix:// address`),
+		},
+		{
+			name:     "test config for executor with buildkit tagged cache repository",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  buildkit:
+    daemons:
+    - address: "tcp://buildkitd:1234"
+      cacheRepository: registry.example.com:5000/agola/cache:latest
+      projects:
+      - 6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10`,
+			err: errors.Errorf(`executor buildkit daemon cacheRepository "registry.example.com:5000/agola/cache:latest" must be a repository without scheme or tag`),
+		},
+		{
+			name:     "test config for executor with buildkit daemon without cache ref key",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  buildkit:
+    daemons:
+    - address: "unix:///run/buildkit/buildkitd.sock"
+      cacheRepository: registry.example.com/agola/cache
+      projects:
+      - 6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10`,
+			err: errors.Errorf(`executor buildkit daemon "unix:///run/buildkit/buildkitd.sock" cacheRefKey is empty`),
+		},
+		{
+			name:     "test config for executor with buildkit tcp daemon without tls",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  buildkit:
+    daemons:
+    - address: "tcp://buildkitd:1234"
+      cacheRepository: registry.example.com/agola/cache
+      cacheRefKey: cachesecret
+      projects:
+      - 6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10`,
+			err: errors.Errorf(`executor buildkit daemon "tcp://buildkitd:1234" requires tls`),
+		},
+		{
+			name:     "test config for executor with buildkit daemon without tls client key",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  buildkit:
+    daemons:
+    - address: "tcp://buildkitd:1234"
+      cacheRepository: registry.example.com/agola/cache
+      cacheRefKey: cachesecret
+      tls:
+        caFile: /etc/agola/buildkit/ca.pem
+        certFile: /etc/agola/buildkit/cert.pem
+      projects:
+      - 6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10`,
+			err: errors.Errorf(`executor buildkit daemon "tcp://buildkitd:1234" tls caFile, certFile and keyFile must be all specified`),
+		},
+		{
+			name:     "test config for executor with buildkit daemon without projects",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  buildkit:
+    daemons:
+    - address: "tcp://buildkitd:1234"
+      cacheRepository: registry.example.com/agola/cache
+      cacheRefKey: cachesecret
+      tls:
+        caFile: /etc/agola/buildkit/ca.pem
+        certFile: /etc/agola/buildkit/cert.pem
+        keyFile: /etc/agola/buildkit/key.pem`,
+			err: errors.Errorf(`executor buildkit daemon "tcp://buildkitd:1234" projects are empty`),
+		},
+		{
+			name:     "test config for executor with buildkit project assigned to multiple daemons",
+			services: []string{"executor"},
+			in: `
+executor:
+  dataDir: /data/agola/executor
+  toolboxPath: ./bin
+  runserviceURL: "http://localhost:4000"
+  driver:
+    type: docker
+  buildkit:
+    daemons:
+    - address: "tcp://buildkitd01:1234"
+      cacheRepository: registry.example.com/tenant01/cache
+      cacheRefKey: cachesecret
+      tls:
+        caFile: /etc/agola/buildkit/ca.pem
+        certFile: /etc/agola/buildkit/cert.pem
+        keyFile: /etc/agola/buildkit/key.pem
+      projects:
+      - 6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10
+    - address: "tcp://buildkitd02:1234"
+      cacheRepository: registry.example.com/tenant02/cache
+      cacheRefKey: cachesecret
+      tls:
+        caFile: /etc/agola/buildkit/ca.pem
+        certFile: /etc/agola/buildkit/cert.pem
+        keyFile: /etc/agola/buildkit/key.pem
+      projects:
+      - 6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10`,
+			err: errors.Errorf(`executor buildkit project "6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10" is assigned to multiple daemons`),
+		},
+		{
+			name:     "test config for gateway with relative base path",
+			services: []string{"gateway"},
+			in: `
+gateway:
+  apiExposedURL: "http://localhost:8000"
+  webExposedURL: "http://localhost:8000"
+  basePath: agola
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  web:
+    listenAddress: ":8000"`,
+			err: errors.Errorf(`gateway basePath "agola" must be an absolute path different from /`),
+		},
+		{
+			name:     "test config for gateway with session settings",
+			services: []string{"gateway"},
+			in: `
+gateway:
+  apiExposedURL: "http://localhost:8000"
+  webExposedURL: "http://localhost:8000"
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  web:
+    listenAddress: ":8000"
+  session:
+    idleTimeout: 30m
+    absoluteTimeout: 8h
+    cookie:
+      domain: example.com
+      sameSite: strict
+      secure: true`,
+		},
+		{
+			name:     "test config for gateway with unknown session cookie sameSite",
+			services: []string{"gateway"},
+			in: `
+gateway:
+  apiExposedURL: "http://localhost:8000"
+  webExposedURL: "http://localhost:8000"
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  web:
+    listenAddress: ":8000"
+  session:
+    cookie:
+      sameSite: none`,
+			err: errors.Errorf(`gateway session configuration error: unknown cookie sameSite "none"`),
+		},
+		{
+			name:     "test config for gateway with request limits",
+			services: []string{"gateway"},
+			in: `
+gateway:
+  apiExposedURL: "http://localhost:8000"
+  webExposedURL: "http://localhost:8000"
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  web:
+    listenAddress: ":8000"
+  requestLimits:
+    apiMaxBodySize: 2097152
+    uploadMaxBodySize: 1073741824`,
+		},
+		{
+			name:     "test config for gateway with zero webhook max body size",
+			services: []string{"gateway"},
+			in: `
+gateway:
+  apiExposedURL: "http://localhost:8000"
+  webExposedURL: "http://localhost:8000"
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  web:
+    listenAddress: ":8000"
+  requestLimits:
+    webhookMaxBodySize: 0`,
+			err: errors.Errorf("gateway requestLimits configuration error: webhookMaxBodySize must be greater than 0"),
+		},
+		{
+			name:     "test config for notification with route referencing an undefined notifier",
+			services: []string{"notification"},
+			in: `
+notification:
+  webExposedURL: "http://localhost:8000"
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  notifiers:
+    - name: slack
+      type: slack
+      url: "https://hooks.slack.com/services/xxx"
+  routes:
+    - events: [ run_failed ]
+      notifiers: [ pagerduty ]`,
+			err: errors.Errorf(`notification route 0 references undefined notifier "pagerduty"`),
+		},
+		{
+			name:     "test config for notification with route with wrong event type",
+			services: []string{"notification"},
+			in: `
+notification:
+  webExposedURL: "http://localhost:8000"
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  notifiers:
+    - name: pagerduty
+      type: pagerduty
+      routingKey: key01
+  routes:
+    - events: [ run_broken ]
+      notifiers: [ pagerduty ]`,
+			err: errors.Errorf(`notification route 0 has a wrong event type "run_broken"`),
+		},
+		{
+			name:     "test config for notification with route with wrong run tag",
+			services: []string{"notification"},
+			in: `
+notification:
+  webExposedURL: "http://localhost:8000"
+  runserviceURL: "http://localhost:4000"
+  configstoreURL: "http://localhost:4002"
+  notifiers:
+    - name: pagerduty
+      type: pagerduty
+      routingKey: key01
+  routes:
+    - tags: [ release, "-nightly" ]
+      notifiers: [ pagerduty ]`,
+			err: errors.Errorf(`notification route 0 has a wrong run tag "-nightly"`),
+		},
 	}
 
 	for _, tt := range tests {
@@ -255,3 +1133,77 @@ gitserver:
 		})
 	}
 }
+
+func TestRestartRequiredChanges(t *testing.T) {
+	base := func() *Config {
+		c := &Config{
+			Gateway: Gateway{
+				Web: Web{ListenAddress: ":8000"},
+			},
+			Notification: Notification{
+				Notifiers: []Notifier{{Name: "notifier01", Type: NotifierTypeWebhook, URL: "http://example.com"}},
+				Routes:    []NotificationRoute{{Notifiers: []string{"notifier01"}}},
+			},
+		}
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		components []string
+		change     func(c *Config)
+		out        []string
+	}{
+		{
+			name:       "test no changes",
+			components: []string{"all-base"},
+			change:     func(c *Config) {},
+			out:        []string{},
+		},
+		{
+			name:       "test reloadable changes",
+			components: []string{"all-base"},
+			change: func(c *Config) {
+				c.Gateway.Debug = true
+				c.Notification.Debug = true
+				c.Notification.Notifiers = append(c.Notification.Notifiers, Notifier{Name: "notifier02", Type: NotifierTypeSlack, URL: "http://example.com"})
+				c.Notification.Routes = nil
+			},
+			out: []string{},
+		},
+		{
+			name:       "test listen address change",
+			components: []string{"all-base"},
+			change: func(c *Config) {
+				c.Gateway.Debug = true
+				c.Gateway.Web.ListenAddress = ":8080"
+			},
+			out: []string{"gateway"},
+		},
+		{
+			name:       "test change of a not enabled component",
+			components: []string{"notification"},
+			change: func(c *Config) {
+				c.Gateway.Web.ListenAddress = ":8080"
+				c.Tracing.Endpoint = "http://localhost:4318"
+			},
+			out: []string{"tracing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldc := base()
+			newc := base()
+			tt.change(newc)
+
+			out, err := RestartRequiredChanges(oldc, newc, tt.components)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(out, tt.out) {
+				t.Fatalf("expected changes %v, got %v", tt.out, out)
+			}
+		})
+	}
+}
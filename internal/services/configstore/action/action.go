@@ -15,6 +15,9 @@
 package action
 
 import (
+	"context"
+	"io"
+
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/etcd"
 	"agola.io/agola/internal/services/configstore/readdb"
@@ -22,15 +25,24 @@ import (
 	"go.uber.org/zap"
 )
 
+// DataManager is the storage where the actions write their changes. It's
+// implemented by the datamanager (etcd storage) and by the readdb when using
+// the sql storage.
+type DataManager interface {
+	WriteWal(ctx context.Context, actions []*datamanager.Action, cgt *datamanager.ChangeGroupsUpdateToken) (*datamanager.ChangeGroupsUpdateToken, error)
+	Export(ctx context.Context, w io.Writer) error
+	Import(ctx context.Context, r io.Reader) error
+}
+
 type ActionHandler struct {
 	log             *zap.SugaredLogger
 	readDB          *readdb.ReadDB
-	dm              *datamanager.DataManager
+	dm              DataManager
 	e               *etcd.Store
 	maintenanceMode bool
 }
 
-func NewActionHandler(logger *zap.Logger, readDB *readdb.ReadDB, dm *datamanager.DataManager, e *etcd.Store) *ActionHandler {
+func NewActionHandler(logger *zap.Logger, readDB *readdb.ReadDB, dm DataManager, e *etcd.Store) *ActionHandler {
 	return &ActionHandler{
 		log:             logger.Sugar(),
 		readDB:          readDB,
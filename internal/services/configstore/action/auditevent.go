@@ -0,0 +1,60 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/configstore/types"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+// CreateAuditEvent records an audit event. Audit events are never updated so
+// they don't use change groups.
+func (h *ActionHandler) CreateAuditEvent(ctx context.Context, auditEvent *types.AuditEvent) (*types.AuditEvent, error) {
+	if auditEvent.Action == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("auditevent action required"))
+	}
+	if auditEvent.ActorType == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("auditevent actor type required"))
+	}
+
+	auditEvent.ID = uuid.NewV4().String()
+	if auditEvent.Time.IsZero() {
+		auditEvent.Time = time.Now()
+	}
+
+	aej, err := json.Marshal(auditEvent)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal auditevent: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeAuditEvent),
+			ID:         auditEvent.ID,
+			Data:       aej,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, nil)
+	return auditEvent, err
+}
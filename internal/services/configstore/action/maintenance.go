@@ -18,14 +18,20 @@ import (
 	"context"
 	"io"
 
+	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/etcd"
 	"agola.io/agola/internal/services/configstore/common"
+	"agola.io/agola/internal/services/configstore/fsck"
 	"agola.io/agola/internal/util"
 
 	errors "golang.org/x/xerrors"
 )
 
 func (h *ActionHandler) MaintenanceMode(ctx context.Context, enable bool) error {
+	if h.e == nil {
+		return util.NewErrBadRequest(errors.Errorf("maintenance mode isn't available with the sql storage"))
+	}
+
 	resp, err := h.e.Get(ctx, common.EtcdMaintenanceKey, 0)
 	if err != nil && err != etcd.ErrKeyNotFound {
 		return err
@@ -66,8 +72,51 @@ func (h *ActionHandler) Export(ctx context.Context, w io.Writer) error {
 }
 
 func (h *ActionHandler) Import(ctx context.Context, r io.Reader) error {
-	if !h.maintenanceMode {
+	// with the sql storage the import is done in a single transaction so
+	// maintenance mode isn't required
+	if h.e != nil && !h.maintenanceMode {
 		return util.NewErrBadRequest(errors.Errorf("not in maintenance mode"))
 	}
 	return h.dm.Import(ctx, r)
 }
+
+// Fsck checks the configstore data consistency and, when repair is true,
+// repairs the problems that could be automatically repaired. The data is read
+// from an export so it's consistent with both the etcd and sql storages.
+func (h *ActionHandler) Fsck(ctx context.Context, repair bool) ([]*fsck.Problem, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(h.Export(ctx, pw))
+	}()
+
+	d, err := fsck.ReadExport(pr)
+	// unblock the export on read errors
+	pr.CloseWithError(err)
+	if err != nil {
+		return nil, errors.Errorf("failed to read data: %w", err)
+	}
+
+	problems, err := fsck.Check(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if !repair {
+		return problems, nil
+	}
+
+	actions := []*datamanager.Action{}
+	for _, p := range problems {
+		if p.Repairable() {
+			h.log.Infof("repairing %s", p)
+			actions = append(actions, p.Action)
+		}
+	}
+	if len(actions) > 0 {
+		if _, err := h.dm.WriteWal(ctx, actions, nil); err != nil {
+			return nil, errors.Errorf("failed to repair problems: %w", err)
+		}
+	}
+
+	return problems, nil
+}
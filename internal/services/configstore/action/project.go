@@ -18,6 +18,9 @@ import (
 	"context"
 	"encoding/json"
 	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
@@ -61,6 +64,70 @@ func (h *ActionHandler) ValidateProject(ctx context.Context, project *types.Proj
 			return util.NewErrBadRequest(errors.Errorf("empty remote repository path"))
 		}
 	}
+	if cr := project.ConfigRepository; cr != nil {
+		if cr.RemoteSourceID == "" {
+			return util.NewErrBadRequest(errors.Errorf("empty config repository remote source id"))
+		}
+		if cr.LinkedAccountID == "" {
+			return util.NewErrBadRequest(errors.Errorf("empty config repository linked account id"))
+		}
+		if cr.RepositoryPath == "" {
+			return util.NewErrBadRequest(errors.Errorf("empty config repository path"))
+		}
+		if cr.Branch == "" {
+			return util.NewErrBadRequest(errors.Errorf("empty config repository branch"))
+		}
+	}
+	if tp := project.TriggerPolicy; tp != nil {
+		if !types.IsValidTriggerBranchesPolicy(tp.Branches) {
+			return util.NewErrBadRequest(errors.Errorf("invalid project trigger policy branches %q", tp.Branches))
+		}
+	}
+	if err := validateProjectDeployEnvironments(project.DeployEnvironments); err != nil {
+		return util.NewErrBadRequest(err)
+	}
+	return nil
+}
+
+func validateProjectDeployEnvironments(des []*types.ProjectDeployEnvironment) error {
+	names := map[string]struct{}{}
+	for _, de := range des {
+		if de == nil {
+			return errors.Errorf("empty deploy environment")
+		}
+		if !util.ValidateName(de.Name) {
+			return errors.Errorf("invalid deploy environment name %q", de.Name)
+		}
+		if _, ok := names[de.Name]; ok {
+			return errors.Errorf("duplicate deploy environment %q", de.Name)
+		}
+		names[de.Name] = struct{}{}
+
+		if de.RequiredApprovals < 0 {
+			return errors.Errorf("deploy environment %q: required approvals must be greater or equal than 0", de.Name)
+		}
+		if de.RequiredApprovals > 0 && len(de.Approvers) > 0 && de.RequiredApprovals > len(de.Approvers) {
+			return errors.Errorf("deploy environment %q: required approvals (%d) are more than the approvers (%d)", de.Name, de.RequiredApprovals, len(de.Approvers))
+		}
+		for _, a := range de.Approvers {
+			if a == "" {
+				return errors.Errorf("deploy environment %q: empty approver", de.Name)
+			}
+		}
+		for _, b := range de.Branches {
+			if b == "" {
+				return errors.Errorf("deploy environment %q: empty branch", de.Name)
+			}
+			if len(b) > 2 && strings.HasPrefix(b, "/") && strings.HasSuffix(b, "/") {
+				if _, err := regexp.Compile(b[1 : len(b)-1]); err != nil {
+					return errors.Errorf("deploy environment %q: wrong branch regular expression %q: %w", de.Name, b, err)
+				}
+			}
+		}
+		if de.WaitTimer < 0 {
+			return errors.Errorf("deploy environment %q: wait timer must be greater or equal than 0", de.Name)
+		}
+	}
 	return nil
 }
 
@@ -99,6 +166,9 @@ func (h *ActionHandler) CreateProject(ctx context.Context, project *types.Projec
 		if group == nil {
 			return util.NewErrBadRequest(errors.Errorf("project group with id %q doesn't exist", project.Parent.ID))
 		}
+		if err := h.checkPrincipalGroupAccess(ctx, tx, group); err != nil {
+			return err
+		}
 		project.Parent.ID = group.ID
 
 		groupPath, err := h.readDB.GetProjectGroupPath(tx, group)
@@ -208,6 +278,9 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, req *UpdateProjectReq
 		if group == nil {
 			return util.NewErrBadRequest(errors.Errorf("project group with id %q doesn't exist", req.Project.Parent.ID))
 		}
+		if err := h.checkPrincipalGroupAccess(ctx, tx, group); err != nil {
+			return err
+		}
 		req.Project.Parent.ID = group.ID
 
 		groupPath, err := h.readDB.GetProjectGroupPath(tx, group)
@@ -339,3 +412,146 @@ func (h *ActionHandler) DeleteProject(ctx context.Context, projectRef string) er
 	_, err = h.dm.WriteWal(ctx, actions, cgt)
 	return err
 }
+
+// CreateProjectAPIKey creates a new project api key and returns it. Only the
+// key hash is saved so it cannot be retrieved later.
+func (h *ActionHandler) CreateProjectAPIKey(ctx context.Context, projectRef, apiKeyName string) (string, error) {
+	if projectRef == "" {
+		return "", util.NewErrBadRequest(errors.Errorf("project ref required"))
+	}
+	if apiKeyName == "" {
+		return "", util.NewErrBadRequest(errors.Errorf("api key name required"))
+	}
+	if !util.ValidateName(apiKeyName) {
+		return "", util.NewErrBadRequest(errors.Errorf("invalid api key name %q", apiKeyName))
+	}
+
+	var project *types.Project
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		project, err = h.readDB.GetProject(tx, projectRef)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrBadRequest(errors.Errorf("project %q doesn't exist", projectRef))
+		}
+
+		pp, err := h.readDB.GetProjectPath(tx, project)
+		if err != nil {
+			return err
+		}
+
+		// changegroup is the project path. Use "projectpath" prefix as it must
+		// cover both projects and projectgroups
+		cgNames := []string{util.EncodeSha256Hex("projectpath-" + pp)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if _, ok := project.APIKeys[apiKeyName]; ok {
+		return "", util.NewErrBadRequest(errors.Errorf("api key %q for project %q already exists", apiKeyName, projectRef))
+	}
+
+	if project.APIKeys == nil {
+		project.APIKeys = make(map[string]*types.ProjectAPIKey)
+	}
+
+	apiKey := types.ProjectAPIKeyPrefix + util.EncodeSha1Hex(uuid.NewV4().String())
+	project.APIKeys[apiKeyName] = &types.ProjectAPIKey{
+		Hash:         util.EncodeSha256Hex(apiKey),
+		CreationTime: util.TimeP(time.Now()),
+	}
+
+	pcj, err := json.Marshal(project)
+	if err != nil {
+		return "", errors.Errorf("failed to marshal project: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeProject),
+			ID:         project.ID,
+			Data:       pcj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return apiKey, err
+}
+
+func (h *ActionHandler) DeleteProjectAPIKey(ctx context.Context, projectRef, apiKeyName string) error {
+	if projectRef == "" {
+		return util.NewErrBadRequest(errors.Errorf("project ref required"))
+	}
+	if apiKeyName == "" {
+		return util.NewErrBadRequest(errors.Errorf("api key name required"))
+	}
+
+	var project *types.Project
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		project, err = h.readDB.GetProject(tx, projectRef)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrBadRequest(errors.Errorf("project %q doesn't exist", projectRef))
+		}
+
+		pp, err := h.readDB.GetProjectPath(tx, project)
+		if err != nil {
+			return err
+		}
+
+		// changegroup is the project path. Use "projectpath" prefix as it must
+		// cover both projects and projectgroups
+		cgNames := []string{util.EncodeSha256Hex("projectpath-" + pp)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := project.APIKeys[apiKeyName]; !ok {
+		return util.NewErrBadRequest(errors.Errorf("api key %q for project %q doesn't exist", apiKeyName, projectRef))
+	}
+
+	delete(project.APIKeys, apiKeyName)
+
+	pcj, err := json.Marshal(project)
+	if err != nil {
+		return errors.Errorf("failed to marshal project: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeProject),
+			ID:         project.ID,
+			Data:       pcj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
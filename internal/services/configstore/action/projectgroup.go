@@ -143,6 +143,9 @@ func (h *ActionHandler) CreateProjectGroup(ctx context.Context, projectGroup *ty
 		if parentProjectGroup == nil {
 			return util.NewErrBadRequest(errors.Errorf("project group with id %q doesn't exist", projectGroup.Parent.ID))
 		}
+		if err := h.checkPrincipalGroupAccess(ctx, tx, parentProjectGroup); err != nil {
+			return err
+		}
 		// TODO(sgotti) now we are doing a very ugly thing setting the request
 		// projectgroup parent ID that can be both an ID or a ref. Then we are fixing
 		// it to an ID here. Change the request format to avoid this.
@@ -249,6 +252,9 @@ func (h *ActionHandler) UpdateProjectGroup(ctx context.Context, req *UpdateProje
 			if group == nil {
 				return util.NewErrBadRequest(errors.Errorf("project group with id %q doesn't exist", req.ProjectGroup.Parent.ID))
 			}
+			if err := h.checkPrincipalGroupAccess(ctx, tx, group); err != nil {
+				return err
+			}
 			// TODO(sgotti) now we are doing a very ugly thing setting the request
 			// projectgroup parent ID that can be both an ID or a ref. Then we are fixing
 			// it to an ID here. Change the request format to avoid this.
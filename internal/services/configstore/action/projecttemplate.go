@@ -0,0 +1,241 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/configstore/types"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+var projectTemplateParameterNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func (h *ActionHandler) ValidateProjectTemplateSpec(ctx context.Context, spec *types.ProjectTemplateSpec) error {
+	if spec == nil {
+		return util.NewErrBadRequest(errors.Errorf("projecttemplate spec required"))
+	}
+	if spec.Visibility != "" && !types.IsValidVisibility(spec.Visibility) {
+		return util.NewErrBadRequest(errors.Errorf("invalid projecttemplate visibility %q", spec.Visibility))
+	}
+	if spec.MaxStepLogSize < 0 {
+		return util.NewErrBadRequest(errors.Errorf("invalid projecttemplate max step log size %d", spec.MaxStepLogSize))
+	}
+
+	parameters := map[string]struct{}{}
+	for _, p := range spec.Parameters {
+		if !projectTemplateParameterNameRegexp.MatchString(p.Name) {
+			return util.NewErrBadRequest(errors.Errorf("invalid projecttemplate parameter name %q", p.Name))
+		}
+		if _, ok := parameters[p.Name]; ok {
+			return util.NewErrBadRequest(errors.Errorf("projecttemplate parameter %q is duplicated", p.Name))
+		}
+		parameters[p.Name] = struct{}{}
+	}
+
+	variables := map[string]struct{}{}
+	for _, v := range spec.Variables {
+		if !util.ValidateName(v.Name) {
+			return util.NewErrBadRequest(errors.Errorf("invalid projecttemplate variable name %q", v.Name))
+		}
+		if _, ok := variables[v.Name]; ok {
+			return util.NewErrBadRequest(errors.Errorf("projecttemplate variable %q is duplicated", v.Name))
+		}
+		variables[v.Name] = struct{}{}
+		if len(v.Values) == 0 {
+			return util.NewErrBadRequest(errors.Errorf("projecttemplate variable %q values required", v.Name))
+		}
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) CreateProjectTemplate(ctx context.Context, name string, spec *types.ProjectTemplateSpec) (*types.ProjectTemplate, error) {
+	if name == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("projecttemplate name required"))
+	}
+	if !util.ValidateName(name) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid projecttemplate name %q", name))
+	}
+	if err := h.ValidateProjectTemplateSpec(ctx, spec); err != nil {
+		return nil, err
+	}
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+	// changegroup is the projecttemplate name
+	cgNames := []string{util.EncodeSha256Hex("projecttemplatename-" + name)}
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		// check duplicate projecttemplate name
+		pt, err := h.readDB.GetProjectTemplateByName(tx, name)
+		if err != nil {
+			return err
+		}
+		if pt != nil {
+			return util.NewErrBadRequest(errors.Errorf("projecttemplate %q already exists", pt.Name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	projectTemplate := &types.ProjectTemplate{
+		ID:   uuid.NewV4().String(),
+		Name: name,
+		Revisions: []*types.ProjectTemplateRevision{
+			{
+				Revision:            1,
+				CreatedAt:           time.Now(),
+				ProjectTemplateSpec: *spec,
+			},
+		},
+	}
+
+	ptj, err := json.Marshal(projectTemplate)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal projecttemplate: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeProjectTemplate),
+			ID:         projectTemplate.ID,
+			Data:       ptj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return projectTemplate, err
+}
+
+// UpdateProjectTemplate adds a new revision to the project template. The
+// previous revisions are kept unchanged.
+func (h *ActionHandler) UpdateProjectTemplate(ctx context.Context, projectTemplateRef string, spec *types.ProjectTemplateSpec) (*types.ProjectTemplate, error) {
+	if err := h.ValidateProjectTemplateSpec(ctx, spec); err != nil {
+		return nil, err
+	}
+
+	var projectTemplate *types.ProjectTemplate
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+
+		// check projecttemplate exists
+		projectTemplate, err = h.readDB.GetProjectTemplate(tx, projectTemplateRef)
+		if err != nil {
+			return err
+		}
+		if projectTemplate == nil {
+			return util.NewErrBadRequest(errors.Errorf("projecttemplate with ref %q doesn't exist", projectTemplateRef))
+		}
+
+		// changegroup is the projecttemplate id
+		cgNames := []string{util.EncodeSha256Hex("projecttemplateid-" + projectTemplate.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var revision int64 = 1
+	if latestRevision := projectTemplate.LatestRevision(); latestRevision != nil {
+		revision = latestRevision.Revision + 1
+	}
+	projectTemplate.Revisions = append(projectTemplate.Revisions, &types.ProjectTemplateRevision{
+		Revision:            revision,
+		CreatedAt:           time.Now(),
+		ProjectTemplateSpec: *spec,
+	})
+
+	ptj, err := json.Marshal(projectTemplate)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal projecttemplate: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeProjectTemplate),
+			ID:         projectTemplate.ID,
+			Data:       ptj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return projectTemplate, err
+}
+
+func (h *ActionHandler) DeleteProjectTemplate(ctx context.Context, projectTemplateRef string) error {
+	var projectTemplate *types.ProjectTemplate
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+
+		// check projecttemplate existance
+		projectTemplate, err = h.readDB.GetProjectTemplate(tx, projectTemplateRef)
+		if err != nil {
+			return err
+		}
+		if projectTemplate == nil {
+			return util.NewErrBadRequest(errors.Errorf("projecttemplate %q doesn't exist", projectTemplateRef))
+		}
+
+		// changegroup is the projecttemplate id
+		cgNames := []string{util.EncodeSha256Hex("projecttemplateid-" + projectTemplate.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypeDelete,
+			DataType:   string(types.ConfigTypeProjectTemplate),
+			ID:         projectTemplate.ID,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/configstore/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Principal is the identity on behalf of which a request is made. The objects
+// owned by an org or a user (project groups, projects, secrets and variables)
+// are accessible only by their owner principals: the org members or the user
+// itself. The other principals can only read the public objects.
+type Principal struct {
+	// UserID is the id of the user principal
+	UserID string
+	// ProjectID is the id of the project of a project api key. It can access
+	// only its project and the project objects (secrets and variables).
+	ProjectID string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context where the actions are executed on behalf of
+// the provided principal
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal of the context or nil when the
+// actions aren't restricted
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// CheckPrincipalAccess returns a forbidden error when the context principal
+// cannot access the object with the provided type and ref. The public objects
+// are readable by every principal but when private is true (i.e. the object
+// secrets and variables) only the owner principals can access them. Not
+// existing objects aren't reported as errors.
+func (h *ActionHandler) CheckPrincipalAccess(ctx context.Context, configType types.ConfigType, ref string, read, private bool) error {
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil
+	}
+
+	return h.readDB.Do(ctx, func(tx *db.Tx) error {
+		o, err := h.ownedObject(tx, configType, ref)
+		if err != nil {
+			return err
+		}
+		if o == nil {
+			return nil
+		}
+		if read && !private && o.visibility == types.VisibilityPublic {
+			return nil
+		}
+		return h.checkPrincipalOwner(tx, principal, o.ownerType, o.ownerID, o.projectID)
+	})
+}
+
+// IsPrincipalOwner reports if the context principal can access all the objects
+// owned by the provided org or user. A project api key principal is never the
+// owner of all the objects of its project owner.
+func (h *ActionHandler) IsPrincipalOwner(ctx context.Context, ownerType types.ConfigType, ownerID string) (bool, error) {
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		return true, nil
+	}
+
+	var isOwner bool
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		isOwner, err = h.isPrincipalOwner(tx, principal, ownerType, ownerID, "")
+		return err
+	})
+	return isOwner, err
+}
+
+// checkPrincipalGroupAccess checks that the context principal can write in the
+// provided project group (i.e. when used as the parent of a new project)
+func (h *ActionHandler) checkPrincipalGroupAccess(ctx context.Context, tx *db.Tx, group *types.ProjectGroup) error {
+	principal := PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil
+	}
+
+	ownerType, ownerID, err := h.readDB.GetProjectGroupOwnerID(tx, group)
+	if err != nil {
+		return err
+	}
+	return h.checkPrincipalOwner(tx, principal, ownerType, ownerID, "")
+}
+
+func (h *ActionHandler) checkPrincipalOwner(tx *db.Tx, principal *Principal, ownerType types.ConfigType, ownerID, projectID string) error {
+	isOwner, err := h.isPrincipalOwner(tx, principal, ownerType, ownerID, projectID)
+	if err != nil {
+		return err
+	}
+	if !isOwner {
+		return util.NewErrForbidden(errors.Errorf("access to %s %q objects denied", ownerType, ownerID))
+	}
+	return nil
+}
+
+// isPrincipalOwner reports if the principal can access the objects of the
+// provided org or user. projectID is the id of the accessed project, empty
+// when the accessed object isn't a project (or one of its secrets and
+// variables): a project api key principal can access only its project.
+func (h *ActionHandler) isPrincipalOwner(tx *db.Tx, principal *Principal, ownerType types.ConfigType, ownerID, projectID string) (bool, error) {
+	if principal.ProjectID != "" {
+		if projectID != principal.ProjectID {
+			return false, nil
+		}
+		project, err := h.readDB.GetProjectByID(tx, principal.ProjectID)
+		if err != nil {
+			return false, err
+		}
+		if project == nil {
+			return false, nil
+		}
+		projectOwnerType, projectOwnerID, err := h.readDB.GetProjectOwnerID(tx, project)
+		if err != nil {
+			return false, err
+		}
+		return projectOwnerType == ownerType && projectOwnerID == ownerID, nil
+	}
+
+	if principal.UserID == "" {
+		// anonymous principal
+		return false, nil
+	}
+
+	switch ownerType {
+	case types.ConfigTypeUser:
+		return ownerID == principal.UserID, nil
+	case types.ConfigTypeOrg:
+		orgMember, err := h.readDB.GetOrgMemberByOrgUserID(tx, ownerID, principal.UserID)
+		if err != nil {
+			return false, err
+		}
+		return orgMember != nil, nil
+	}
+
+	return false, nil
+}
+
+// ownedObject is an object owned by an org or a user
+type ownedObject struct {
+	ownerType types.ConfigType
+	ownerID   string
+	// visibility is the object global visibility
+	visibility types.Visibility
+	// projectID is the object id when it's a project
+	projectID string
+}
+
+// ownedObject returns the org or user owning the object with the provided type
+// and ref and its global visibility. It returns nil if the object doesn't
+// exist.
+func (h *ActionHandler) ownedObject(tx *db.Tx, configType types.ConfigType, ref string) (*ownedObject, error) {
+	switch configType {
+	case types.ConfigTypeOrg:
+		org, err := h.readDB.GetOrg(tx, ref)
+		if err != nil || org == nil {
+			return nil, err
+		}
+		return &ownedObject{ownerType: types.ConfigTypeOrg, ownerID: org.ID, visibility: org.Visibility}, nil
+
+	case types.ConfigTypeUser:
+		user, err := h.readDB.GetUser(tx, ref)
+		if err != nil || user == nil {
+			return nil, err
+		}
+		return &ownedObject{ownerType: types.ConfigTypeUser, ownerID: user.ID, visibility: types.VisibilityPublic}, nil
+
+	case types.ConfigTypeProjectGroup:
+		group, err := h.readDB.GetProjectGroup(tx, ref)
+		if err != nil || group == nil {
+			return nil, err
+		}
+		ownerType, ownerID, err := h.readDB.GetProjectGroupOwnerID(tx, group)
+		if err != nil {
+			return nil, err
+		}
+		visibility, err := h.readDB.GetGlobalVisibility(tx, group.Visibility, &group.Parent)
+		if err != nil {
+			return nil, err
+		}
+		return &ownedObject{ownerType: ownerType, ownerID: ownerID, visibility: visibility}, nil
+
+	case types.ConfigTypeProject:
+		project, err := h.readDB.GetProject(tx, ref)
+		if err != nil || project == nil {
+			return nil, err
+		}
+		ownerType, ownerID, err := h.readDB.GetProjectOwnerID(tx, project)
+		if err != nil {
+			return nil, err
+		}
+		visibility, err := h.readDB.GetGlobalVisibility(tx, project.Visibility, &project.Parent)
+		if err != nil {
+			return nil, err
+		}
+		return &ownedObject{ownerType: ownerType, ownerID: ownerID, visibility: visibility, projectID: project.ID}, nil
+	}
+
+	return nil, errors.Errorf("unsupported config type %q", configType)
+}
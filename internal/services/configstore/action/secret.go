@@ -17,6 +17,8 @@ package action
 import (
 	"context"
 	"encoding/json"
+	"reflect"
+	"time"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
@@ -118,6 +120,14 @@ func (h *ActionHandler) CreateSecret(ctx context.Context, secret *types.Secret)
 		}
 		secret.Parent.ID = parentID
 
+		policy, err := h.getParentSecretPolicy(tx, secret.Parent.Type, secret.Parent.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkSecretPolicy(policy, secret); err != nil {
+			return err
+		}
+
 		// check duplicate secret name
 		s, err := h.readDB.GetSecretByName(tx, secret.Parent.ID, secret.Name)
 		if err != nil {
@@ -133,7 +143,11 @@ func (h *ActionHandler) CreateSecret(ctx context.Context, secret *types.Secret)
 		return nil, err
 	}
 
+	h.warnKnownCredentials(secret)
+
 	secret.ID = uuid.NewV4().String()
+	secret.CreatedAt = time.Now()
+	secret.UpdatedAt = secret.CreatedAt
 
 	secretj, err := json.Marshal(secret)
 	if err != nil {
@@ -177,6 +191,14 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 		}
 		req.Secret.Parent.ID = parentID
 
+		policy, err := h.getParentSecretPolicy(tx, req.Secret.Parent.Type, req.Secret.Parent.ID)
+		if err != nil {
+			return err
+		}
+		if err := checkSecretPolicy(policy, req.Secret); err != nil {
+			return err
+		}
+
 		// check secret exists
 		curSecret, err = h.readDB.GetSecretByName(tx, req.Secret.Parent.ID, req.SecretName)
 		if err != nil {
@@ -197,8 +219,11 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 			}
 		}
 
-		// set/override ID that must be kept from the current secret
+		// set/override ID and creation time that must be kept from the current secret
 		req.Secret.ID = curSecret.ID
+		req.Secret.CreatedAt = curSecret.CreatedAt
+		req.Secret.UpdatedAt = time.Now()
+		req.Secret.Usages = curSecret.Usages
 
 		cgNames := []string{
 			util.EncodeSha256Hex("secretname-" + req.Secret.ID),
@@ -215,6 +240,8 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 		return nil, err
 	}
 
+	h.warnKnownCredentials(req.Secret)
+
 	secretj, err := json.Marshal(req.Secret)
 	if err != nil {
 		return nil, errors.Errorf("failed to marshal secret: %w", err)
@@ -278,3 +305,212 @@ func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType types.Confi
 	_, err = h.dm.WriteWal(ctx, actions, cgt)
 	return err
 }
+
+// UpdateSecretUsage records that the secret has been used by a run of the
+// provided project
+func (h *ActionHandler) UpdateSecretUsage(ctx context.Context, parentType types.ConfigType, parentRef, secretName, projectID string) error {
+	var secret *types.Secret
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		parentID, err := h.readDB.ResolveConfigID(tx, parentType, parentRef)
+		if err != nil {
+			return err
+		}
+
+		secret, err = h.readDB.GetSecretByName(tx, parentID, secretName)
+		if err != nil {
+			return err
+		}
+		if secret == nil {
+			return util.NewErrNotExist(errors.Errorf("secret with name %q doesn't exist", secretName))
+		}
+
+		project, err := h.readDB.GetProject(tx, projectID)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrBadRequest(errors.Errorf("project with id %q doesn't exist", projectID))
+		}
+
+		cgNames := []string{
+			util.EncodeSha256Hex("secretid-" + secret.ID),
+			util.EncodeSha256Hex("secretname-" + secret.Name),
+		}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if secret.Usages == nil {
+		secret.Usages = map[string]*types.ConfigUsage{}
+	}
+	secret.Usages[projectID] = &types.ConfigUsage{LastUsedTime: time.Now()}
+
+	secretj, err := json.Marshal(secret)
+	if err != nil {
+		return errors.Errorf("failed to marshal secret: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeSecret),
+			ID:         secret.ID,
+			Data:       secretj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
+
+type SetSecretsRequest struct {
+	ParentType types.ConfigType
+	ParentRef  string
+
+	Secrets []*types.Secret
+
+	// Prune removes the parent secrets not defined in Secrets
+	Prune bool
+}
+
+// SetSecrets creates or updates all the provided secrets and, when requested,
+// removes the other parent secrets in a single transaction.
+func (h *ActionHandler) SetSecrets(ctx context.Context, req *SetSecretsRequest) ([]*SetResult, error) {
+	names := map[string]struct{}{}
+	for _, secret := range req.Secrets {
+		if _, ok := names[secret.Name]; ok {
+			return nil, util.NewErrBadRequest(errors.Errorf("duplicate secret name %q", secret.Name))
+		}
+		names[secret.Name] = struct{}{}
+
+		secret.Parent.Type = req.ParentType
+		secret.Parent.ID = req.ParentRef
+		if err := h.ValidateSecret(ctx, secret); err != nil {
+			return nil, err
+		}
+	}
+
+	var curSecrets []*types.Secret
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		parentID, err := h.readDB.ResolveConfigID(tx, req.ParentType, req.ParentRef)
+		if err != nil {
+			return err
+		}
+		policy, err := h.getParentSecretPolicy(tx, req.ParentType, parentID)
+		if err != nil {
+			return err
+		}
+		for _, secret := range req.Secrets {
+			secret.Parent.ID = parentID
+			if err := checkSecretPolicy(policy, secret); err != nil {
+				return err
+			}
+		}
+
+		curSecrets, err = h.readDB.GetSecrets(tx, parentID)
+		if err != nil {
+			return err
+		}
+
+		cgNames := []string{}
+		for _, secret := range req.Secrets {
+			cgNames = append(cgNames, util.EncodeSha256Hex("secretname-"+secret.Name))
+		}
+		for _, secret := range curSecrets {
+			cgNames = append(cgNames, util.EncodeSha256Hex("secretid-"+secret.ID))
+		}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	curSecretsMap := map[string]*types.Secret{}
+	for _, secret := range curSecrets {
+		curSecretsMap[secret.Name] = secret
+	}
+
+	results := []*SetResult{}
+	actions := []*datamanager.Action{}
+	now := time.Now()
+	for _, secret := range req.Secrets {
+		result := SetResultTypeCreated
+		if curSecret, ok := curSecretsMap[secret.Name]; ok {
+			if secretDataEqual(curSecret, secret) {
+				results = append(results, &SetResult{Name: secret.Name, Result: SetResultTypeUnchanged})
+				continue
+			}
+			result = SetResultTypeUpdated
+			secret.ID = curSecret.ID
+			secret.CreatedAt = curSecret.CreatedAt
+			secret.Usages = curSecret.Usages
+		} else {
+			secret.ID = uuid.NewV4().String()
+			secret.CreatedAt = now
+		}
+		secret.UpdatedAt = now
+
+		h.warnKnownCredentials(secret)
+
+		secretj, err := json.Marshal(secret)
+		if err != nil {
+			return nil, errors.Errorf("failed to marshal secret: %w", err)
+		}
+		actions = append(actions, &datamanager.Action{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeSecret),
+			ID:         secret.ID,
+			Data:       secretj,
+		})
+		results = append(results, &SetResult{Name: secret.Name, Result: result})
+	}
+
+	if req.Prune {
+		for _, secret := range curSecrets {
+			if _, ok := names[secret.Name]; ok {
+				continue
+			}
+			actions = append(actions, &datamanager.Action{
+				ActionType: datamanager.ActionTypeDelete,
+				DataType:   string(types.ConfigTypeSecret),
+				ID:         secret.ID,
+			})
+			results = append(results, &SetResult{Name: secret.Name, Result: SetResultTypeDeleted})
+		}
+	}
+
+	if len(actions) == 0 {
+		return results, nil
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return results, err
+}
+
+// secretDataEqual reports if the two secrets have the same type and data
+func secretDataEqual(a, b *types.Secret) bool {
+	return a.Type == b.Type &&
+		reflect.DeepEqual(a.Data, b.Data) &&
+		a.SecretProviderID == b.SecretProviderID &&
+		a.Path == b.Path &&
+		a.ForkSafe == b.ForkSafe
+}
@@ -0,0 +1,211 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/configstore/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// awsAccessKeyIDRegexp matches values that look like an AWS access key id
+var awsAccessKeyIDRegexp = regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)
+
+func validateSecretPolicy(policy *types.SecretPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MinLength < 0 {
+		return util.NewErrBadRequest(errors.Errorf("invalid secret policy min length %d", policy.MinLength))
+	}
+	for _, p := range policy.ForbiddenPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return util.NewErrBadRequest(errors.Errorf("invalid secret policy forbidden pattern %q: %w", p, err))
+		}
+	}
+	for _, p := range policy.RequiredPrefixes {
+		if p == "" {
+			return util.NewErrBadRequest(errors.Errorf("empty secret policy required prefix"))
+		}
+	}
+	return nil
+}
+
+// SetOrgSecretPolicy sets the org secret policy. A nil policy removes it.
+// The policy is only enforced on the secrets created or updated after it has
+// been set.
+func (h *ActionHandler) SetOrgSecretPolicy(ctx context.Context, orgRef string, policy *types.SecretPolicy) (*types.Organization, error) {
+	if err := validateSecretPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	var org *types.Organization
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		org, err = h.readDB.GetOrg(tx, orgRef)
+		if err != nil {
+			return err
+		}
+		if org == nil {
+			return util.NewErrNotExist(errors.Errorf("org %q doesn't exist", orgRef))
+		}
+
+		// changegroup is the org id
+		cgNames := []string{util.EncodeSha256Hex("orgid-" + org.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	org.SecretPolicy = policy
+
+	orgj, err := json.Marshal(org)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal org: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeOrg),
+			ID:         org.ID,
+			Data:       orgj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return org, err
+}
+
+// getParentSecretPolicy returns the secret policy of the org owning the
+// provided secrets parent. It returns nil if the owner is a user or the org
+// doesn't define a secret policy.
+func (h *ActionHandler) getParentSecretPolicy(tx *db.Tx, parentType types.ConfigType, parentID string) (*types.SecretPolicy, error) {
+	var ownerType types.ConfigType
+	var ownerID string
+	switch parentType {
+	case types.ConfigTypeProject:
+		p, err := h.readDB.GetProjectByID(tx, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, util.NewErrNotExist(errors.Errorf("project with id %q doesn't exist", parentID))
+		}
+		ownerType, ownerID, err = h.readDB.GetProjectOwnerID(tx, p)
+		if err != nil {
+			return nil, err
+		}
+	case types.ConfigTypeProjectGroup:
+		pg, err := h.readDB.GetProjectGroupByID(tx, parentID)
+		if err != nil {
+			return nil, err
+		}
+		if pg == nil {
+			return nil, util.NewErrNotExist(errors.Errorf("project group with id %q doesn't exist", parentID))
+		}
+		ownerType, ownerID, err = h.readDB.GetProjectGroupOwnerID(tx, pg)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	if ownerType != types.ConfigTypeOrg {
+		return nil, nil
+	}
+	org, err := h.readDB.GetOrgByID(tx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	if org == nil {
+		return nil, nil
+	}
+	return org.SecretPolicy, nil
+}
+
+// checkSecretPolicy checks that all the internal secret values satisfy the
+// provided policy
+func checkSecretPolicy(policy *types.SecretPolicy, secret *types.Secret) error {
+	if policy == nil || secret.Type != types.SecretTypeInternal {
+		return nil
+	}
+
+	// check the keys in a stable order to always report the same error
+	keys := make([]string, 0, len(secret.Data))
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := secret.Data[k]
+		if len(v) < policy.MinLength {
+			return util.NewErrBadRequest(errors.Errorf("secret %q value %q is shorter than the %d characters required by the org secret policy", secret.Name, k, policy.MinLength))
+		}
+		for _, p := range policy.ForbiddenPatterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return errors.Errorf("invalid secret policy forbidden pattern %q: %w", p, err)
+			}
+			if re.MatchString(v) {
+				return util.NewErrBadRequest(errors.Errorf("secret %q value %q matches the pattern %q forbidden by the org secret policy", secret.Name, k, p))
+			}
+		}
+		if len(policy.RequiredPrefixes) > 0 {
+			hasPrefix := false
+			for _, p := range policy.RequiredPrefixes {
+				if strings.HasPrefix(v, p) {
+					hasPrefix = true
+					break
+				}
+			}
+			if !hasPrefix {
+				return util.NewErrBadRequest(errors.Errorf("secret %q value %q doesn't start with one of the prefixes %s required by the org secret policy", secret.Name, k, strings.Join(policy.RequiredPrefixes, ", ")))
+			}
+		}
+	}
+
+	return nil
+}
+
+// warnKnownCredentials logs a warning when a secret value looks like a well
+// known credential format (that was probably committed somewhere and should be
+// rotated). The secret value is never logged.
+func (h *ActionHandler) warnKnownCredentials(secret *types.Secret) {
+	for k, v := range secret.Data {
+		if awsAccessKeyIDRegexp.MatchString(v) {
+			h.log.Warnf("secret %q value %q of %s with id %q looks like an AWS access key id, if it has ever been committed it should be rotated", secret.Name, k, secret.Parent.Type, secret.Parent.ID)
+		}
+	}
+}
@@ -431,6 +431,7 @@ type UpdateUserLARequest struct {
 	Oauth2AccessToken          string
 	Oauth2RefreshToken         string
 	Oauth2AccessTokenExpiresAt time.Time
+	NeedsReauth                bool
 }
 
 func (h *ActionHandler) UpdateUserLA(ctx context.Context, req *UpdateUserLARequest) (*types.LinkedAccount, error) {
@@ -487,6 +488,7 @@ func (h *ActionHandler) UpdateUserLA(ctx context.Context, req *UpdateUserLAReque
 	la.Oauth2AccessToken = req.Oauth2AccessToken
 	la.Oauth2RefreshToken = req.Oauth2RefreshToken
 	la.Oauth2AccessTokenExpiresAt = req.Oauth2AccessTokenExpiresAt
+	la.NeedsReauth = req.NeedsReauth
 
 	userj, err := json.Marshal(user)
 	if err != nil {
@@ -553,6 +555,11 @@ func (h *ActionHandler) CreateUserToken(ctx context.Context, userRef, tokenName
 	token := util.EncodeSha1Hex(uuid.NewV4().String())
 	user.Tokens[tokenName] = token
 
+	if user.TokensInfo == nil {
+		user.TokensInfo = make(map[string]*types.UserTokenInfo)
+	}
+	user.TokensInfo[tokenName] = &types.UserTokenInfo{CreationTime: util.TimeP(time.Now())}
+
 	userj, err := json.Marshal(user)
 	if err != nil {
 		return "", errors.Errorf("failed to marshal user: %w", err)
@@ -612,6 +619,282 @@ func (h *ActionHandler) DeleteUserToken(ctx context.Context, userRef, tokenName
 	}
 
 	delete(user.Tokens, tokenName)
+	delete(user.TokensInfo, tokenName)
+
+	userj, err := json.Marshal(user)
+	if err != nil {
+		return errors.Errorf("failed to marshal user: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUser),
+			ID:         user.ID,
+			Data:       userj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
+
+// UpdateUserTokenLastUsed records the last time the user token has been used
+func (h *ActionHandler) UpdateUserTokenLastUsed(ctx context.Context, userRef, tokenName string, lastUsedTime time.Time) error {
+	if userRef == "" {
+		return util.NewErrBadRequest(errors.Errorf("user ref required"))
+	}
+	if tokenName == "" {
+		return util.NewErrBadRequest(errors.Errorf("token name required"))
+	}
+
+	var user *types.User
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		user, err = h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrBadRequest(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		// changegroup is the userid
+		cgNames := []string{util.EncodeSha256Hex("userid-" + user.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := user.Tokens[tokenName]; !ok {
+		return util.NewErrBadRequest(errors.Errorf("token %q for user %q doesn't exist", tokenName, userRef))
+	}
+
+	if user.TokensInfo == nil {
+		user.TokensInfo = make(map[string]*types.UserTokenInfo)
+	}
+	tokenInfo, ok := user.TokensInfo[tokenName]
+	if !ok {
+		tokenInfo = &types.UserTokenInfo{}
+		user.TokensInfo[tokenName] = tokenInfo
+	}
+	tokenInfo.LastUsedTime = &lastUsedTime
+
+	userj, err := json.Marshal(user)
+	if err != nil {
+		return errors.Errorf("failed to marshal user: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUser),
+			ID:         user.ID,
+			Data:       userj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
+
+// CreateUserSession creates a new web session for the user and returns its id.
+// Sessions already expired according to the provided timeouts are removed.
+func (h *ActionHandler) CreateUserSession(ctx context.Context, userRef string, idleTimeout, absoluteTimeout time.Duration) (string, error) {
+	if userRef == "" {
+		return "", util.NewErrBadRequest(errors.Errorf("user ref required"))
+	}
+	if idleTimeout < 0 {
+		return "", util.NewErrBadRequest(errors.Errorf("negative session idle timeout"))
+	}
+	if absoluteTimeout <= 0 {
+		return "", util.NewErrBadRequest(errors.Errorf("session absolute timeout must be greater than zero"))
+	}
+
+	var user *types.User
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		user, err = h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrBadRequest(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		// changegroup is the userid
+		cgNames := []string{util.EncodeSha256Hex("userid-" + user.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	for id, session := range user.Sessions {
+		if userSessionExpired(session, now, idleTimeout, absoluteTimeout) {
+			delete(user.Sessions, id)
+		}
+	}
+
+	if user.Sessions == nil {
+		user.Sessions = make(map[string]*types.UserSession)
+	}
+	sessionID := uuid.NewV4().String()
+	user.Sessions[sessionID] = &types.UserSession{
+		CreationTime:     &now,
+		LastActivityTime: &now,
+	}
+
+	userj, err := json.Marshal(user)
+	if err != nil {
+		return "", errors.Errorf("failed to marshal user: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUser),
+			ID:         user.ID,
+			Data:       userj,
+		},
+	}
+
+	if _, err := h.dm.WriteWal(ctx, actions, cgt); err != nil {
+		return "", err
+	}
+
+	return sessionID, nil
+}
+
+func userSessionExpired(session *types.UserSession, now time.Time, idleTimeout, absoluteTimeout time.Duration) bool {
+	if session.CreationTime == nil || now.Sub(*session.CreationTime) > absoluteTimeout {
+		return true
+	}
+	if idleTimeout > 0 && session.LastActivityTime != nil && now.Sub(*session.LastActivityTime) > idleTimeout {
+		return true
+	}
+	return false
+}
+
+// DeleteUserSession removes a user web session
+func (h *ActionHandler) DeleteUserSession(ctx context.Context, userRef, sessionID string) error {
+	if userRef == "" {
+		return util.NewErrBadRequest(errors.Errorf("user ref required"))
+	}
+	if sessionID == "" {
+		return util.NewErrBadRequest(errors.Errorf("session id required"))
+	}
+
+	var user *types.User
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		user, err = h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrBadRequest(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		// changegroup is the userid
+		cgNames := []string{util.EncodeSha256Hex("userid-" + user.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, ok := user.Sessions[sessionID]; !ok {
+		return util.NewErrNotExist(errors.Errorf("session %q for user %q doesn't exist", sessionID, userRef))
+	}
+
+	delete(user.Sessions, sessionID)
+
+	userj, err := json.Marshal(user)
+	if err != nil {
+		return errors.Errorf("failed to marshal user: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUser),
+			ID:         user.ID,
+			Data:       userj,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
+
+// UpdateUserSessionLastActivity records the last activity time of a user web session
+func (h *ActionHandler) UpdateUserSessionLastActivity(ctx context.Context, userRef, sessionID string, lastActivityTime time.Time) error {
+	if userRef == "" {
+		return util.NewErrBadRequest(errors.Errorf("user ref required"))
+	}
+	if sessionID == "" {
+		return util.NewErrBadRequest(errors.Errorf("session id required"))
+	}
+
+	var user *types.User
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		user, err = h.readDB.GetUser(tx, userRef)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return util.NewErrBadRequest(errors.Errorf("user %q doesn't exist", userRef))
+		}
+
+		// changegroup is the userid
+		cgNames := []string{util.EncodeSha256Hex("userid-" + user.ID)}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	session, ok := user.Sessions[sessionID]
+	if !ok {
+		return util.NewErrNotExist(errors.Errorf("session %q for user %q doesn't exist", sessionID, userRef))
+	}
+	session.LastActivityTime = &lastActivityTime
 
 	userj, err := json.Marshal(user)
 	if err != nil {
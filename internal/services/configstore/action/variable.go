@@ -17,6 +17,8 @@ package action
 import (
 	"context"
 	"encoding/json"
+	"reflect"
+	"time"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
@@ -173,8 +175,9 @@ func (h *ActionHandler) UpdateVariable(ctx context.Context, req *UpdateVariableR
 			}
 		}
 
-		// set/override ID that must be kept from the current variable
+		// set/override ID and usages that must be kept from the current variable
 		req.Variable.ID = curVariable.ID
+		req.Variable.Usages = curVariable.Usages
 
 		cgNames := []string{
 			util.EncodeSha256Hex("variablename-" + req.Variable.ID),
@@ -253,3 +256,190 @@ func (h *ActionHandler) DeleteVariable(ctx context.Context, parentType types.Con
 	_, err = h.dm.WriteWal(ctx, actions, cgt)
 	return err
 }
+
+// UpdateVariableUsage records that the variable has been used by a run of the
+// provided project
+func (h *ActionHandler) UpdateVariableUsage(ctx context.Context, parentType types.ConfigType, parentRef, variableName, projectID string) error {
+	var variable *types.Variable
+
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		parentID, err := h.readDB.ResolveConfigID(tx, parentType, parentRef)
+		if err != nil {
+			return err
+		}
+
+		variable, err = h.readDB.GetVariableByName(tx, parentID, variableName)
+		if err != nil {
+			return err
+		}
+		if variable == nil {
+			return util.NewErrNotExist(errors.Errorf("variable with name %q doesn't exist", variableName))
+		}
+
+		project, err := h.readDB.GetProject(tx, projectID)
+		if err != nil {
+			return err
+		}
+		if project == nil {
+			return util.NewErrBadRequest(errors.Errorf("project with id %q doesn't exist", projectID))
+		}
+
+		cgNames := []string{
+			util.EncodeSha256Hex("variableid-" + variable.ID),
+			util.EncodeSha256Hex("variablename-" + variable.Name),
+		}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if variable.Usages == nil {
+		variable.Usages = map[string]*types.ConfigUsage{}
+	}
+	variable.Usages[projectID] = &types.ConfigUsage{LastUsedTime: time.Now()}
+
+	variablej, err := json.Marshal(variable)
+	if err != nil {
+		return errors.Errorf("failed to marshal variable: %w", err)
+	}
+	actions := []*datamanager.Action{
+		{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeVariable),
+			ID:         variable.ID,
+			Data:       variablej,
+		},
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return err
+}
+
+type SetVariablesRequest struct {
+	ParentType types.ConfigType
+	ParentRef  string
+
+	Variables []*types.Variable
+
+	// Prune removes the parent variables not defined in Variables
+	Prune bool
+}
+
+// SetVariables creates or updates all the provided variables and, when
+// requested, removes the other parent variables in a single transaction.
+func (h *ActionHandler) SetVariables(ctx context.Context, req *SetVariablesRequest) ([]*SetResult, error) {
+	names := map[string]struct{}{}
+	for _, variable := range req.Variables {
+		if _, ok := names[variable.Name]; ok {
+			return nil, util.NewErrBadRequest(errors.Errorf("duplicate variable name %q", variable.Name))
+		}
+		names[variable.Name] = struct{}{}
+
+		variable.Parent.Type = req.ParentType
+		variable.Parent.ID = req.ParentRef
+		if err := h.ValidateVariable(ctx, variable); err != nil {
+			return nil, err
+		}
+	}
+
+	var curVariables []*types.Variable
+	var cgt *datamanager.ChangeGroupsUpdateToken
+
+	// must do all the checks in a single transaction to avoid concurrent changes
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		parentID, err := h.readDB.ResolveConfigID(tx, req.ParentType, req.ParentRef)
+		if err != nil {
+			return err
+		}
+		for _, variable := range req.Variables {
+			variable.Parent.ID = parentID
+		}
+
+		curVariables, err = h.readDB.GetVariables(tx, parentID)
+		if err != nil {
+			return err
+		}
+
+		cgNames := []string{}
+		for _, variable := range req.Variables {
+			cgNames = append(cgNames, util.EncodeSha256Hex("variablename-"+variable.Name))
+		}
+		for _, variable := range curVariables {
+			cgNames = append(cgNames, util.EncodeSha256Hex("variableid-"+variable.ID))
+		}
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, cgNames)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	curVariablesMap := map[string]*types.Variable{}
+	for _, variable := range curVariables {
+		curVariablesMap[variable.Name] = variable
+	}
+
+	results := []*SetResult{}
+	actions := []*datamanager.Action{}
+	for _, variable := range req.Variables {
+		result := SetResultTypeCreated
+		if curVariable, ok := curVariablesMap[variable.Name]; ok {
+			if reflect.DeepEqual(curVariable.Values, variable.Values) {
+				results = append(results, &SetResult{Name: variable.Name, Result: SetResultTypeUnchanged})
+				continue
+			}
+			result = SetResultTypeUpdated
+			variable.ID = curVariable.ID
+			variable.Usages = curVariable.Usages
+		} else {
+			variable.ID = uuid.NewV4().String()
+		}
+
+		variablej, err := json.Marshal(variable)
+		if err != nil {
+			return nil, errors.Errorf("failed to marshal variable: %w", err)
+		}
+		actions = append(actions, &datamanager.Action{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeVariable),
+			ID:         variable.ID,
+			Data:       variablej,
+		})
+		results = append(results, &SetResult{Name: variable.Name, Result: result})
+	}
+
+	if req.Prune {
+		for _, variable := range curVariables {
+			if _, ok := names[variable.Name]; ok {
+				continue
+			}
+			actions = append(actions, &datamanager.Action{
+				ActionType: datamanager.ActionTypeDelete,
+				DataType:   string(types.ConfigTypeVariable),
+				ID:         variable.ID,
+			})
+			results = append(results, &SetResult{Name: variable.Name, Result: SetResultTypeDeleted})
+		}
+	}
+
+	if len(actions) == 0 {
+		return results, nil
+	}
+
+	_, err = h.dm.WriteWal(ctx, actions, cgt)
+	return results, err
+}
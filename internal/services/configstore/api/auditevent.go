@@ -0,0 +1,144 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/configstore/readdb"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/configstore/types"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type CreateAuditEventHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateAuditEventHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateAuditEventHandler {
+	return &CreateAuditEventHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateAuditEventHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req *types.AuditEvent
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	auditEvent, err := h.ah.CreateAuditEvent(ctx, req)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, auditEvent); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+const (
+	DefaultAuditEventsLimit = 100
+	MaxAuditEventsLimit     = 1000
+)
+
+type AuditEventsHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewAuditEventsHandler(logger *zap.Logger, readDB *readdb.ReadDB) *AuditEventsHandler {
+	return &AuditEventsHandler{log: logger.Sugar(), readDB: readDB}
+}
+
+func parseQueryTime(query url.Values, name string) (*time.Time, error) {
+	s := query.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("cannot parse %s: %w", name, err))
+	}
+	return &t, nil
+}
+
+func (h *AuditEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limitS := query.Get("limit")
+	limit := DefaultAuditEventsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit == 0 || limit > MaxAuditEventsLimit {
+		limit = MaxAuditEventsLimit
+	}
+	asc := false
+	if _, ok := query["asc"]; ok {
+		asc = true
+	}
+
+	since, err := parseQueryTime(query, "since")
+	if httpError(w, err) {
+		return
+	}
+	until, err := parseQueryTime(query, "until")
+	if httpError(w, err) {
+		return
+	}
+
+	filter := &readdb.AuditEventsFilter{
+		Actor:    query.Get("actor"),
+		Action:   query.Get("action"),
+		Resource: query.Get("resource"),
+		Since:    since,
+		Until:    until,
+		Start:    query.Get("start"),
+		Limit:    limit,
+		Asc:      asc,
+	}
+
+	auditEvents, err := h.readDB.GetAuditEvents(ctx, filter)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, auditEvents); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
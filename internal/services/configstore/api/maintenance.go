@@ -19,6 +19,7 @@ import (
 
 	"agola.io/agola/internal/etcd"
 	"agola.io/agola/internal/services/configstore/action"
+	csapitypes "agola.io/agola/services/configstore/api/types"
 
 	"go.uber.org/zap"
 )
@@ -105,3 +106,41 @@ func (h *ImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+type FsckHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewFsckHandler(logger *zap.Logger, ah *action.ActionHandler) *FsckHandler {
+	return &FsckHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *FsckHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// GET only checks, POST also repairs
+	repair := r.Method == "POST"
+
+	problems, err := h.ah.Fsck(ctx, repair)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := &csapitypes.FsckResponse{Problems: make([]*csapitypes.FsckProblem, len(problems))}
+	for i, p := range problems {
+		res.Problems[i] = &csapitypes.FsckProblem{
+			ObjectType:  p.ObjectType,
+			ObjectID:    p.ObjectID,
+			Description: p.Description,
+			Repairable:  p.Repairable(),
+			Repaired:    repair && p.Repairable(),
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -129,11 +129,12 @@ const (
 
 type OrgsHandler struct {
 	log    *zap.SugaredLogger
+	ah     *action.ActionHandler
 	readDB *readdb.ReadDB
 }
 
-func NewOrgsHandler(logger *zap.Logger, readDB *readdb.ReadDB) *OrgsHandler {
-	return &OrgsHandler{log: logger.Sugar(), readDB: readDB}
+func NewOrgsHandler(logger *zap.Logger, ah *action.ActionHandler, readDB *readdb.ReadDB) *OrgsHandler {
+	return &OrgsHandler{log: logger.Sugar(), ah: ah, readDB: readDB}
 }
 
 func (h *OrgsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -175,6 +176,11 @@ func (h *OrgsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		httpError(w, err)
 		return
 	}
+	orgs, err = newPrincipalFilter(ctx, h.ah).orgs(orgs)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
 
 	if err := httpResponse(w, http.StatusOK, orgs); err != nil {
 		h.log.Errorf("err: %+v", err)
@@ -215,6 +221,39 @@ func (h *AddOrgMemberHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+type SetOrgSecretPolicyHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSetOrgSecretPolicyHandler(logger *zap.Logger, ah *action.ActionHandler) *SetOrgSecretPolicyHandler {
+	return &SetOrgSecretPolicyHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SetOrgSecretPolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	orgRef := vars["orgref"]
+
+	var req csapitypes.SetOrgSecretPolicyRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	org, err := h.ah.SetOrgSecretPolicy(ctx, orgRef, req.SecretPolicy)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, org); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type RemoveOrgMemberHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -30,6 +30,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
 )
 
 func projectResponse(ctx context.Context, readDB *readdb.ReadDB, project *types.Project) (*csapitypes.Project, error) {
@@ -56,7 +57,7 @@ func projectsResponse(ctx context.Context, readDB *readdb.ReadDB, projects []*ty
 			}
 
 			// calculate global visibility
-			visibility, err := getGlobalVisibility(readDB, tx, project.Visibility, &project.Parent)
+			visibility, err := readDB.GetGlobalVisibility(tx, project.Visibility, &project.Parent)
 			if err != nil {
 				return err
 			}
@@ -79,38 +80,6 @@ func projectsResponse(ctx context.Context, readDB *readdb.ReadDB, projects []*ty
 	return resProjects, err
 }
 
-func getGlobalVisibility(readDB *readdb.ReadDB, tx *db.Tx, curVisibility types.Visibility, parent *types.Parent) (types.Visibility, error) {
-	curParent := parent
-	if curVisibility == types.VisibilityPrivate {
-		return curVisibility, nil
-	}
-
-	for curParent.Type == types.ConfigTypeProjectGroup {
-		projectGroup, err := readDB.GetProjectGroupByID(tx, curParent.ID)
-		if err != nil {
-			return "", err
-		}
-		if projectGroup.Visibility == types.VisibilityPrivate {
-			return types.VisibilityPrivate, nil
-		}
-
-		curParent = &projectGroup.Parent
-	}
-
-	// check parent visibility
-	if curParent.Type == types.ConfigTypeOrg {
-		org, err := readDB.GetOrg(tx, curParent.ID)
-		if err != nil {
-			return "", err
-		}
-		if org.Visibility == types.VisibilityPrivate {
-			return types.VisibilityPrivate, nil
-		}
-	}
-
-	return curVisibility, nil
-}
-
 type ProjectHandler struct {
 	log    *zap.SugaredLogger
 	ah     *action.ActionHandler
@@ -260,6 +229,126 @@ func (h *DeleteProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+type ProjectsHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewProjectsHandler(logger *zap.Logger, readDB *readdb.ReadDB) *ProjectsHandler {
+	return &ProjectsHandler{log: logger.Sugar(), readDB: readDB}
+}
+
+func (h *ProjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	// only special queries, like get project by api key, are supported
+	queryType := query.Get("query_type")
+
+	var projects []*types.Project
+	switch queryType {
+	case "byapikey":
+		apiKey := query.Get("apikey")
+		var project *types.Project
+		err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+			var err error
+			project, err = h.readDB.GetProjectByAPIKeyHash(tx, util.EncodeSha256Hex(apiKey))
+			return err
+		})
+		if err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+		if project == nil {
+			httpError(w, util.NewErrNotExist(errors.Errorf("project with required api key doesn't exist")))
+			return
+		}
+		projects = []*types.Project{project}
+	default:
+		httpError(w, util.NewErrBadRequest(errors.Errorf("unsupported query type %q", queryType)))
+		return
+	}
+
+	resProjects, err := projectsResponse(ctx, h.readDB, projects)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, resProjects); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateProjectAPIKeyHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateProjectAPIKeyHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateProjectAPIKeyHandler {
+	return &CreateProjectAPIKeyHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateProjectAPIKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req csapitypes.CreateProjectAPIKeyRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	apiKey, err := h.ah.CreateProjectAPIKey(ctx, projectRef, req.APIKeyName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	resp := &csapitypes.CreateProjectAPIKeyResponse{
+		APIKey: apiKey,
+	}
+	if err := httpResponse(w, http.StatusCreated, resp); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteProjectAPIKeyHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteProjectAPIKeyHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteProjectAPIKeyHandler {
+	return &DeleteProjectAPIKeyHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteProjectAPIKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	apiKeyName := vars["apikeyname"]
+
+	err = h.ah.DeleteProjectAPIKey(ctx, projectRef, apiKeyName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 const (
 	DefaultProjectsLimit = 10
 	MaxProjectsLimit     = 20
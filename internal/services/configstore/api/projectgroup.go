@@ -56,7 +56,7 @@ func projectGroupsResponse(ctx context.Context, readDB *readdb.ReadDB, projectGr
 			}
 
 			// calculate global visibility
-			visibility, err := getGlobalVisibility(readDB, tx, projectGroup.Visibility, &projectGroup.Parent)
+			visibility, err := readDB.GetGlobalVisibility(tx, projectGroup.Visibility, &projectGroup.Parent)
 			if err != nil {
 				return err
 			}
@@ -147,6 +147,11 @@ func (h *ProjectGroupProjectsHandler) ServeHTTP(w http.ResponseWriter, r *http.R
 		h.log.Errorf("err: %+v", err)
 		return
 	}
+	resProjects, err = newPrincipalFilter(ctx, h.ah).projects(resProjects)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
 
 	if err := httpResponse(w, http.StatusOK, resProjects); err != nil {
 		h.log.Errorf("err: %+v", err)
@@ -183,6 +188,11 @@ func (h *ProjectGroupSubgroupsHandler) ServeHTTP(w http.ResponseWriter, r *http.
 		h.log.Errorf("err: %+v", err)
 		return
 	}
+	resProjectGroups, err = newPrincipalFilter(ctx, h.ah).projectGroups(resProjectGroups)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
 
 	if err := httpResponse(w, http.StatusOK, resProjectGroups); err != nil {
 		h.log.Errorf("err: %+v", err)
@@ -0,0 +1,210 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/configstore/readdb"
+	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	"agola.io/agola/services/configstore/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type ProjectTemplateHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewProjectTemplateHandler(logger *zap.Logger, readDB *readdb.ReadDB) *ProjectTemplateHandler {
+	return &ProjectTemplateHandler{log: logger.Sugar(), readDB: readDB}
+}
+
+func (h *ProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectTemplateRef := vars["projecttemplateref"]
+
+	var projectTemplate *types.ProjectTemplate
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		projectTemplate, err = h.readDB.GetProjectTemplate(tx, projectTemplateRef)
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if projectTemplate == nil {
+		httpError(w, util.NewErrNotExist(errors.Errorf("project template %q doesn't exist", projectTemplateRef)))
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, projectTemplate); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateProjectTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateProjectTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateProjectTemplateHandler {
+	return &CreateProjectTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req csapitypes.CreateProjectTemplateRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	projectTemplate, err := h.ah.CreateProjectTemplate(ctx, req.Name, req.Spec)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, projectTemplate); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateProjectTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateProjectTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateProjectTemplateHandler {
+	return &UpdateProjectTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	projectTemplateRef := vars["projecttemplateref"]
+
+	var req csapitypes.UpdateProjectTemplateRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	projectTemplate, err := h.ah.UpdateProjectTemplate(ctx, projectTemplateRef, req.Spec)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusCreated, projectTemplate); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteProjectTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteProjectTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteProjectTemplateHandler {
+	return &DeleteProjectTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	projectTemplateRef := vars["projecttemplateref"]
+
+	err := h.ah.DeleteProjectTemplate(ctx, projectTemplateRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+const (
+	DefaultProjectTemplatesLimit = 10
+	MaxProjectTemplatesLimit     = 20
+)
+
+type ProjectTemplatesHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewProjectTemplatesHandler(logger *zap.Logger, readDB *readdb.ReadDB) *ProjectTemplatesHandler {
+	return &ProjectTemplatesHandler{log: logger.Sugar(), readDB: readDB}
+}
+
+func (h *ProjectTemplatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limitS := query.Get("limit")
+	limit := DefaultProjectTemplatesLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit > MaxProjectTemplatesLimit {
+		limit = MaxProjectTemplatesLimit
+	}
+	asc := false
+	if _, ok := query["asc"]; ok {
+		asc = true
+	}
+
+	start := query.Get("start")
+
+	projectTemplates, err := h.readDB.GetProjectTemplates(ctx, start, limit, asc)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, projectTemplates); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
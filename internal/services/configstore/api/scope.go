@@ -0,0 +1,208 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	"agola.io/agola/services/configstore/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// scopedRouteVars are the route variables referencing the objects owned by an
+// org or a user
+var scopedRouteVars = []struct {
+	name       string
+	configType types.ConfigType
+}{
+	{name: "orgref", configType: types.ConfigTypeOrg},
+	{name: "projectgroupref", configType: types.ConfigTypeProjectGroup},
+	{name: "projectref", configType: types.ConfigTypeProject},
+}
+
+// unscopedRoutes are the routes that aren't available to the requests made
+// on behalf of a principal since they operate on all the orgs objects
+var unscopedRoutes = []string{
+	"/api/v1alpha/maintenance",
+	"/api/v1alpha/export",
+	"/api/v1alpha/import",
+}
+
+// PrincipalScopeHandler isolates the orgs and users objects: when a request is
+// made on behalf of a principal (csapitypes.PrincipalHeader) every org,
+// project group and project referenced by the route must be accessible by it.
+// The checks are independent from the ones done by the callers (i.e. the
+// gateway) and the principal is provided to the handlers and actions to
+// check the objects referenced in the request body and to filter the lists.
+type PrincipalScopeHandler struct {
+	log  *zap.SugaredLogger
+	ah   *action.ActionHandler
+	next http.Handler
+}
+
+func NewPrincipalScopeHandler(logger *zap.Logger, ah *action.ActionHandler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &PrincipalScopeHandler{
+			log:  logger.Sugar(),
+			ah:   ah,
+			next: h,
+		}
+	}
+}
+
+func (h *PrincipalScopeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	principalValue := r.Header.Get(csapitypes.PrincipalHeader)
+	if principalValue == "" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	userID, projectID, ok := csapitypes.ParsePrincipal(principalValue)
+	if !ok {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("wrong principal %q", principalValue)))
+		return
+	}
+	ctx = action.WithPrincipal(ctx, &action.Principal{UserID: userID, ProjectID: projectID})
+
+	var pathTemplate string
+	if route := mux.CurrentRoute(r); route != nil {
+		pathTemplate, _ = route.GetPathTemplate()
+	}
+	for _, p := range unscopedRoutes {
+		if strings.HasPrefix(pathTemplate, p) {
+			httpError(w, util.NewErrForbidden(errors.Errorf("operation not allowed to principal %q", principalValue)))
+			return
+		}
+	}
+
+	read := r.Method == http.MethodGet
+	// secrets and variables aren't readable also when their parent is public
+	private := strings.Contains(pathTemplate, "/secrets") || strings.Contains(pathTemplate, "/variables")
+
+	vars := mux.Vars(r)
+	for _, v := range scopedRouteVars {
+		ref, err := url.PathUnescape(vars[v.name])
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(err))
+			return
+		}
+		if ref == "" {
+			continue
+		}
+		if err := h.ah.CheckPrincipalAccess(ctx, v.configType, ref, read, private); err != nil {
+			h.log.Infof("principal %q access to %s %q denied: %v", principalValue, v.configType, ref, err)
+			httpError(w, err)
+			return
+		}
+	}
+
+	h.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// principalFilter reports which listed objects are accessible by the request
+// principal: the public ones and the ones of its owners. The owners checks are
+// cached since the listed objects usually have the same owner.
+type principalFilter struct {
+	ctx    context.Context
+	ah     *action.ActionHandler
+	owners map[string]bool
+}
+
+func newPrincipalFilter(ctx context.Context, ah *action.ActionHandler) *principalFilter {
+	return &principalFilter{ctx: ctx, ah: ah, owners: map[string]bool{}}
+}
+
+func (f *principalFilter) accessible(ownerType types.ConfigType, ownerID string, visibility types.Visibility) (bool, error) {
+	if visibility == types.VisibilityPublic {
+		return true, nil
+	}
+	key := string(ownerType) + "/" + ownerID
+	if isOwner, ok := f.owners[key]; ok {
+		return isOwner, nil
+	}
+	isOwner, err := f.ah.IsPrincipalOwner(f.ctx, ownerType, ownerID)
+	if err != nil {
+		return false, err
+	}
+	f.owners[key] = isOwner
+	return isOwner, nil
+}
+
+func (f *principalFilter) projects(projects []*csapitypes.Project) ([]*csapitypes.Project, error) {
+	principal := action.PrincipalFromContext(f.ctx)
+	if principal == nil {
+		return projects, nil
+	}
+	filtered := []*csapitypes.Project{}
+	for _, p := range projects {
+		// a project api key principal can access only its own project
+		if principal.ProjectID != "" && principal.ProjectID == p.ID {
+			filtered = append(filtered, p)
+			continue
+		}
+		ok, err := f.accessible(p.OwnerType, p.OwnerID, p.GlobalVisibility)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+func (f *principalFilter) projectGroups(projectGroups []*csapitypes.ProjectGroup) ([]*csapitypes.ProjectGroup, error) {
+	if action.PrincipalFromContext(f.ctx) == nil {
+		return projectGroups, nil
+	}
+	filtered := []*csapitypes.ProjectGroup{}
+	for _, pg := range projectGroups {
+		ok, err := f.accessible(pg.OwnerType, pg.OwnerID, pg.GlobalVisibility)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filtered = append(filtered, pg)
+		}
+	}
+	return filtered, nil
+}
+
+func (f *principalFilter) orgs(orgs []*types.Organization) ([]*types.Organization, error) {
+	if action.PrincipalFromContext(f.ctx) == nil {
+		return orgs, nil
+	}
+	filtered := []*types.Organization{}
+	for _, org := range orgs {
+		ok, err := f.accessible(types.ConfigTypeOrg, org.ID, org.Visibility)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filtered = append(filtered, org)
+		}
+	}
+	return filtered, nil
+}
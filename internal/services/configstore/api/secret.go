@@ -220,3 +220,89 @@ func (h *DeleteSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		h.log.Errorf("err: %+v", err)
 	}
 }
+
+type UpdateSecretUsageHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateSecretUsageHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateSecretUsageHandler {
+	return &UpdateSecretUsageHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateSecretUsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	secretName := vars["secretname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req csapitypes.UpdateSecretUsageRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err = h.ah.UpdateSecretUsage(ctx, parentType, parentRef, secretName, req.ProjectID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type SetSecretsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSetSecretsHandler(logger *zap.Logger, ah *action.ActionHandler) *SetSecretsHandler {
+	return &SetSecretsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SetSecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req csapitypes.SetSecretsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.SetSecretsRequest{
+		ParentType: parentType,
+		ParentRef:  parentRef,
+		Secrets:    req.Secrets,
+		Prune:      req.Prune,
+	}
+	results, err := h.ah.SetSecrets(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, setResultsResponse(results)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+func setResultsResponse(results []*action.SetResult) []*csapitypes.SetResult {
+	res := make([]*csapitypes.SetResult, len(results))
+	for i, r := range results {
+		res[i] = &csapitypes.SetResult{Name: r.Name, Result: string(r.Result)}
+	}
+	return res
+}
@@ -392,6 +392,7 @@ func (h *UpdateUserLAHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		Oauth2AccessToken:          req.Oauth2AccessToken,
 		Oauth2RefreshToken:         req.Oauth2RefreshToken,
 		Oauth2AccessTokenExpiresAt: req.Oauth2AccessTokenExpiresAt,
+		NeedsReauth:                req.NeedsReauth,
 	}
 	user, err := h.ah.UpdateUserLA(ctx, creq)
 	if httpError(w, err) {
@@ -464,6 +465,130 @@ func (h *DeleteUserTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+type UpdateUserTokenLastUsedHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateUserTokenLastUsedHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateUserTokenLastUsedHandler {
+	return &UpdateUserTokenLastUsedHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateUserTokenLastUsedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+	tokenName := vars["tokenname"]
+
+	var req csapitypes.UpdateUserTokenLastUsedRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err := h.ah.UpdateUserTokenLastUsed(ctx, userRef, tokenName, req.LastUsedTime)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateUserSessionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateUserSessionHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateUserSessionHandler {
+	return &CreateUserSessionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateUserSessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	var req csapitypes.CreateUserSessionRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	sessionID, err := h.ah.CreateUserSession(ctx, userRef, req.IdleTimeout, req.AbsoluteTimeout)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	resp := &csapitypes.CreateUserSessionResponse{
+		SessionID: sessionID,
+	}
+	if err := httpResponse(w, http.StatusCreated, resp); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteUserSessionHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteUserSessionHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteUserSessionHandler {
+	return &DeleteUserSessionHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteUserSessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+	sessionID := vars["sessionid"]
+
+	err := h.ah.DeleteUserSession(ctx, userRef, sessionID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateUserSessionLastActivityHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateUserSessionLastActivityHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateUserSessionLastActivityHandler {
+	return &UpdateUserSessionLastActivityHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateUserSessionLastActivityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+	sessionID := vars["sessionid"]
+
+	var req csapitypes.UpdateUserSessionLastActivityRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err := h.ah.UpdateUserSessionLastActivity(ctx, userRef, sessionID, req.LastActivityTime)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 func userOrgsResponse(userOrg *action.UserOrgsResponse) *csapitypes.UserOrgsResponse {
 	return &csapitypes.UserOrgsResponse{
 		Organization: userOrg.Organization,
@@ -491,9 +616,17 @@ func (h *UserOrgsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := make([]*csapitypes.UserOrgsResponse, len(userOrgs))
-	for i, userOrg := range userOrgs {
-		res[i] = userOrgsResponse(userOrg)
+	filter := newPrincipalFilter(ctx, h.ah)
+	res := []*csapitypes.UserOrgsResponse{}
+	for _, userOrg := range userOrgs {
+		ok, err := filter.accessible(types.ConfigTypeOrg, userOrg.Organization.ID, userOrg.Organization.Visibility)
+		if httpError(w, err) {
+			h.log.Errorf("err: %+v", err)
+			return
+		}
+		if ok {
+			res = append(res, userOrgsResponse(userOrg))
+		}
 	}
 
 	if err := httpResponse(w, http.StatusOK, res); err != nil {
@@ -193,3 +193,81 @@ func (h *DeleteVariableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		h.log.Errorf("err: %+v", err)
 	}
 }
+
+type UpdateVariableUsageHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateVariableUsageHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateVariableUsageHandler {
+	return &UpdateVariableUsageHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateVariableUsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	variableName := vars["variablename"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req csapitypes.UpdateVariableUsageRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	err = h.ah.UpdateVariableUsage(ctx, parentType, parentRef, variableName, req.ProjectID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type SetVariablesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSetVariablesHandler(logger *zap.Logger, ah *action.ActionHandler) *SetVariablesHandler {
+	return &SetVariablesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SetVariablesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req csapitypes.SetVariablesRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.SetVariablesRequest{
+		ParentType: parentType,
+		ParentRef:  parentRef,
+		Variables:  req.Variables,
+		Prune:      req.Prune,
+	}
+	results, err := h.ah.SetVariables(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, setResultsResponse(results)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -24,6 +24,7 @@ import (
 
 	scommon "agola.io/agola/internal/common"
 	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
 	"agola.io/agola/internal/etcd"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/objectstorage"
@@ -129,6 +130,23 @@ func NewConfigstore(ctx context.Context, l *zap.Logger, c *config.Configstore) (
 	}
 	log = logger.Sugar()
 
+	if c.Storage.Type == config.ConfigstoreStorageTypeSQL {
+		readDB, err := readdb.NewSQLReadDB(ctx, logger, db.Type(c.Storage.DB.Type), c.Storage.DB.ConnString)
+		if err != nil {
+			return nil, err
+		}
+
+		cs := &Configstore{
+			c:      c,
+			readDB: readDB,
+		}
+		// with the sql storage the readdb is the primary storage and directly
+		// writes the actions
+		cs.ah = action.NewActionHandler(logger, readDB, readDB, nil)
+
+		return cs, nil
+	}
+
 	ost, err := scommon.NewObjectStorage(&c.ObjectStorage)
 	if err != nil {
 		return nil, err
@@ -157,6 +175,8 @@ func NewConfigstore(ctx context.Context, l *zap.Logger, c *config.Configstore) (
 			string(types.ConfigTypeRemoteSource),
 			string(types.ConfigTypeSecret),
 			string(types.ConfigTypeVariable),
+			string(types.ConfigTypeProjectTemplate),
+			string(types.ConfigTypeAuditEvent),
 		},
 	}
 	dm, err := datamanager.NewDataManager(ctx, logger, dmConf)
@@ -180,6 +200,7 @@ func NewConfigstore(ctx context.Context, l *zap.Logger, c *config.Configstore) (
 func (s *Configstore) setupDefaultRouter() http.Handler {
 	maintenanceModeHandler := api.NewMaintenanceModeHandler(logger, s.ah, s.e)
 	exportHandler := api.NewExportHandler(logger, s.ah)
+	fsckHandler := api.NewFsckHandler(logger, s.ah)
 
 	projectGroupHandler := api.NewProjectGroupHandler(logger, s.ah, s.readDB)
 	projectGroupSubgroupsHandler := api.NewProjectGroupSubgroupsHandler(logger, s.ah, s.readDB)
@@ -192,16 +213,23 @@ func (s *Configstore) setupDefaultRouter() http.Handler {
 	createProjectHandler := api.NewCreateProjectHandler(logger, s.ah, s.readDB)
 	updateProjectHandler := api.NewUpdateProjectHandler(logger, s.ah, s.readDB)
 	deleteProjectHandler := api.NewDeleteProjectHandler(logger, s.ah)
+	projectsHandler := api.NewProjectsHandler(logger, s.readDB)
+	createProjectAPIKeyHandler := api.NewCreateProjectAPIKeyHandler(logger, s.ah)
+	deleteProjectAPIKeyHandler := api.NewDeleteProjectAPIKeyHandler(logger, s.ah)
 
 	secretsHandler := api.NewSecretsHandler(logger, s.ah, s.readDB)
 	createSecretHandler := api.NewCreateSecretHandler(logger, s.ah)
 	updateSecretHandler := api.NewUpdateSecretHandler(logger, s.ah)
 	deleteSecretHandler := api.NewDeleteSecretHandler(logger, s.ah)
+	setSecretsHandler := api.NewSetSecretsHandler(logger, s.ah)
+	updateSecretUsageHandler := api.NewUpdateSecretUsageHandler(logger, s.ah)
 
 	variablesHandler := api.NewVariablesHandler(logger, s.ah, s.readDB)
 	createVariableHandler := api.NewCreateVariableHandler(logger, s.ah)
 	updateVariableHandler := api.NewUpdateVariableHandler(logger, s.ah)
 	deleteVariableHandler := api.NewDeleteVariableHandler(logger, s.ah)
+	setVariablesHandler := api.NewSetVariablesHandler(logger, s.ah)
+	updateVariableUsageHandler := api.NewUpdateVariableUsageHandler(logger, s.ah)
 
 	userHandler := api.NewUserHandler(logger, s.readDB)
 	usersHandler := api.NewUsersHandler(logger, s.readDB)
@@ -215,17 +243,22 @@ func (s *Configstore) setupDefaultRouter() http.Handler {
 
 	createUserTokenHandler := api.NewCreateUserTokenHandler(logger, s.ah)
 	deleteUserTokenHandler := api.NewDeleteUserTokenHandler(logger, s.ah)
+	updateUserTokenLastUsedHandler := api.NewUpdateUserTokenLastUsedHandler(logger, s.ah)
+	createUserSessionHandler := api.NewCreateUserSessionHandler(logger, s.ah)
+	deleteUserSessionHandler := api.NewDeleteUserSessionHandler(logger, s.ah)
+	updateUserSessionLastActivityHandler := api.NewUpdateUserSessionLastActivityHandler(logger, s.ah)
 
 	userOrgsHandler := api.NewUserOrgsHandler(logger, s.ah)
 
 	orgHandler := api.NewOrgHandler(logger, s.readDB)
-	orgsHandler := api.NewOrgsHandler(logger, s.readDB)
+	orgsHandler := api.NewOrgsHandler(logger, s.ah, s.readDB)
 	createOrgHandler := api.NewCreateOrgHandler(logger, s.ah)
 	deleteOrgHandler := api.NewDeleteOrgHandler(logger, s.ah)
 
 	orgMembersHandler := api.NewOrgMembersHandler(logger, s.ah)
 	addOrgMemberHandler := api.NewAddOrgMemberHandler(logger, s.ah)
 	removeOrgMemberHandler := api.NewRemoveOrgMemberHandler(logger, s.ah)
+	setOrgSecretPolicyHandler := api.NewSetOrgSecretPolicyHandler(logger, s.ah)
 
 	remoteSourceHandler := api.NewRemoteSourceHandler(logger, s.readDB)
 	remoteSourcesHandler := api.NewRemoteSourcesHandler(logger, s.readDB)
@@ -233,8 +266,18 @@ func (s *Configstore) setupDefaultRouter() http.Handler {
 	updateRemoteSourceHandler := api.NewUpdateRemoteSourceHandler(logger, s.ah)
 	deleteRemoteSourceHandler := api.NewDeleteRemoteSourceHandler(logger, s.ah)
 
+	projectTemplateHandler := api.NewProjectTemplateHandler(logger, s.readDB)
+	projectTemplatesHandler := api.NewProjectTemplatesHandler(logger, s.readDB)
+	createProjectTemplateHandler := api.NewCreateProjectTemplateHandler(logger, s.ah)
+	updateProjectTemplateHandler := api.NewUpdateProjectTemplateHandler(logger, s.ah)
+	deleteProjectTemplateHandler := api.NewDeleteProjectTemplateHandler(logger, s.ah)
+
+	auditEventsHandler := api.NewAuditEventsHandler(logger, s.readDB)
+	createAuditEventHandler := api.NewCreateAuditEventHandler(logger, s.ah)
+
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
+	apirouter.Use(api.NewPrincipalScopeHandler(logger, s.ah))
 
 	apirouter.Handle("/projectgroups/{projectgroupref}", projectGroupHandler).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/subgroups", projectGroupSubgroupsHandler).Methods("GET")
@@ -247,24 +290,35 @@ func (s *Configstore) setupDefaultRouter() http.Handler {
 	apirouter.Handle("/projects", createProjectHandler).Methods("POST")
 	apirouter.Handle("/projects/{projectref}", updateProjectHandler).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}", deleteProjectHandler).Methods("DELETE")
+	apirouter.Handle("/projects", projectsHandler).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/apikeys", createProjectAPIKeyHandler).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/apikeys/{apikeyname}", deleteProjectAPIKeyHandler).Methods("DELETE")
 
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", secretsHandler).Methods("GET")
 	apirouter.Handle("/projects/{projectref}/secrets", secretsHandler).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", createSecretHandler).Methods("POST")
 	apirouter.Handle("/projects/{projectref}/secrets", createSecretHandler).Methods("POST")
+	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", setSecretsHandler).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/secrets", setSecretsHandler).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets/{secretname}", updateSecretHandler).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}/secrets/{secretname}", updateSecretHandler).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets/{secretname}", deleteSecretHandler).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/secrets/{secretname}", deleteSecretHandler).Methods("DELETE")
+	apirouter.Handle("/projectgroups/{projectgroupref}/secrets/{secretname}/usage", updateSecretUsageHandler).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/secrets/{secretname}/usage", updateSecretUsageHandler).Methods("PUT")
 
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables", variablesHandler).Methods("GET")
 	apirouter.Handle("/projects/{projectref}/variables", variablesHandler).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables", createVariableHandler).Methods("POST")
 	apirouter.Handle("/projects/{projectref}/variables", createVariableHandler).Methods("POST")
+	apirouter.Handle("/projectgroups/{projectgroupref}/variables", setVariablesHandler).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/variables", setVariablesHandler).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}", updateVariableHandler).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}/variables/{variablename}", updateVariableHandler).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}", deleteVariableHandler).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/variables/{variablename}", deleteVariableHandler).Methods("DELETE")
+	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}/usage", updateVariableUsageHandler).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/variables/{variablename}/usage", updateVariableUsageHandler).Methods("PUT")
 
 	apirouter.Handle("/users/{userref}", userHandler).Methods("GET")
 	apirouter.Handle("/users", usersHandler).Methods("GET")
@@ -277,6 +331,10 @@ func (s *Configstore) setupDefaultRouter() http.Handler {
 	apirouter.Handle("/users/{userref}/linkedaccounts/{laid}", updateUserLAHandler).Methods("PUT")
 	apirouter.Handle("/users/{userref}/tokens", createUserTokenHandler).Methods("POST")
 	apirouter.Handle("/users/{userref}/tokens/{tokenname}", deleteUserTokenHandler).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/tokens/{tokenname}/lastused", updateUserTokenLastUsedHandler).Methods("PUT")
+	apirouter.Handle("/users/{userref}/sessions", createUserSessionHandler).Methods("POST")
+	apirouter.Handle("/users/{userref}/sessions/{sessionid}", deleteUserSessionHandler).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/sessions/{sessionid}/lastactivity", updateUserSessionLastActivityHandler).Methods("PUT")
 
 	apirouter.Handle("/users/{userref}/orgs", userOrgsHandler).Methods("GET")
 
@@ -287,6 +345,7 @@ func (s *Configstore) setupDefaultRouter() http.Handler {
 	apirouter.Handle("/orgs/{orgref}/members", orgMembersHandler).Methods("GET")
 	apirouter.Handle("/orgs/{orgref}/members/{userref}", addOrgMemberHandler).Methods("PUT")
 	apirouter.Handle("/orgs/{orgref}/members/{userref}", removeOrgMemberHandler).Methods("DELETE")
+	apirouter.Handle("/orgs/{orgref}/secretpolicy", setOrgSecretPolicyHandler).Methods("PUT")
 
 	apirouter.Handle("/remotesources/{remotesourceref}", remoteSourceHandler).Methods("GET")
 	apirouter.Handle("/remotesources", remoteSourcesHandler).Methods("GET")
@@ -294,9 +353,24 @@ func (s *Configstore) setupDefaultRouter() http.Handler {
 	apirouter.Handle("/remotesources/{remotesourceref}", updateRemoteSourceHandler).Methods("PUT")
 	apirouter.Handle("/remotesources/{remotesourceref}", deleteRemoteSourceHandler).Methods("DELETE")
 
+	apirouter.Handle("/projecttemplates/{projecttemplateref}", projectTemplateHandler).Methods("GET")
+	apirouter.Handle("/projecttemplates", projectTemplatesHandler).Methods("GET")
+	apirouter.Handle("/projecttemplates", createProjectTemplateHandler).Methods("POST")
+	apirouter.Handle("/projecttemplates/{projecttemplateref}", updateProjectTemplateHandler).Methods("PUT")
+	apirouter.Handle("/projecttemplates/{projecttemplateref}", deleteProjectTemplateHandler).Methods("DELETE")
+
+	apirouter.Handle("/auditevents", auditEventsHandler).Methods("GET")
+	apirouter.Handle("/auditevents", createAuditEventHandler).Methods("POST")
+
 	apirouter.Handle("/maintenance", maintenanceModeHandler).Methods("PUT", "DELETE")
+	apirouter.Handle("/maintenance/fsck", fsckHandler).Methods("GET", "POST")
 
 	apirouter.Handle("/export", exportHandler).Methods("GET")
+	if s.c.Storage.Type == config.ConfigstoreStorageTypeSQL {
+		// with the sql storage import doesn't require maintenance mode
+		importHandler := api.NewImportHandler(logger, s.ah)
+		apirouter.Handle("/import", importHandler).Methods("POST")
+	}
 
 	mainrouter := mux.NewRouter()
 	mainrouter.PathPrefix("/").Handler(router)
@@ -311,6 +385,7 @@ func (s *Configstore) setupMaintenanceRouter() http.Handler {
 
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
+	apirouter.Use(api.NewPrincipalScopeHandler(logger, s.ah))
 
 	apirouter.Handle("/maintenance", maintenanceModeHandler).Methods("PUT", "DELETE")
 
@@ -323,6 +398,16 @@ func (s *Configstore) setupMaintenanceRouter() http.Handler {
 	return mainrouter
 }
 
+// Reload applies the configstore config changes that don't require a restart.
+// Currently only the log level.
+func (s *Configstore) Reload(c *config.Configstore) {
+	if c.Debug {
+		level.SetLevel(zapcore.DebugLevel)
+	} else {
+		level.SetLevel(zapcore.InfoLevel)
+	}
+}
+
 func (s *Configstore) Run(ctx context.Context) error {
 	for {
 		if err := s.run(ctx); err != nil {
@@ -340,14 +425,14 @@ func (s *Configstore) Run(ctx context.Context) error {
 }
 
 func (s *Configstore) run(ctx context.Context) error {
-	var tlsConfig *tls.Config
-	if s.c.Web.TLS {
-		var err error
-		tlsConfig, err = util.NewTLSConfig(s.c.Web.TLSCertFile, s.c.Web.TLSKeyFile, "", false)
-		if err != nil {
-			log.Errorf("err: %+v")
-			return err
-		}
+	tlsConfig, err := scommon.NewTLSServerConfig(&s.c.Web)
+	if err != nil {
+		log.Errorf("err: %+v", err)
+		return err
+	}
+
+	if s.c.Storage.Type == config.ConfigstoreStorageTypeSQL {
+		return s.runSQLStorage(ctx, tlsConfig)
 	}
 
 	resp, err := s.e.Get(ctx, common.EtcdMaintenanceKey, 0)
@@ -397,7 +482,7 @@ func (s *Configstore) run(ctx context.Context) error {
 
 	lerrCh := make(chan error, 1)
 	util.GoWait(&wg, func() {
-		lerrCh <- httpServer.ListenAndServe()
+		lerrCh <- scommon.ListenAndServe(&httpServer)
 	})
 	defer httpServer.Close()
 
@@ -422,3 +507,45 @@ func (s *Configstore) run(ctx context.Context) error {
 
 	return err
 }
+
+func (s *Configstore) runSQLStorage(ctx context.Context, tlsConfig *tls.Config) error {
+	ctx, cancel := context.WithCancel(ctx)
+	errCh := make(chan error, 100)
+	var wg sync.WaitGroup
+
+	mainrouter := s.setupDefaultRouter()
+
+	util.GoWait(&wg, func() { errCh <- s.readDB.Run(ctx) })
+
+	httpServer := http.Server{
+		Addr:      s.c.Web.ListenAddress,
+		Handler:   mainrouter,
+		TLSConfig: tlsConfig,
+	}
+
+	lerrCh := make(chan error, 1)
+	util.GoWait(&wg, func() {
+		lerrCh <- scommon.ListenAndServe(&httpServer)
+	})
+	defer httpServer.Close()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Infof("configstore run exiting")
+	case err = <-lerrCh:
+		if err != nil {
+			log.Errorf("http server listen error: %+v", err)
+		}
+	case err = <-errCh:
+		if err != nil {
+			log.Errorf("error: %+v", err)
+		}
+	}
+
+	cancel()
+	httpServer.Close()
+	wg.Wait()
+
+	return err
+}
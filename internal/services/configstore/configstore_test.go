@@ -20,9 +20,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"path"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -30,8 +33,11 @@ import (
 	"agola.io/agola/internal/db"
 	"agola.io/agola/internal/services/config"
 	"agola.io/agola/internal/services/configstore/action"
+	"agola.io/agola/internal/services/configstore/readdb"
 	"agola.io/agola/internal/testutil"
 	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	csclient "agola.io/agola/services/configstore/client"
 	"agola.io/agola/services/configstore/types"
 
 	"github.com/google/go-cmp/cmp"
@@ -547,6 +553,140 @@ func compareUsers(u1, u2 []*types.User) bool {
 	return reflect.DeepEqual(u1ids, u2ids)
 }
 
+func setupSQLConfigstore(ctx context.Context, t *testing.T, logger *zap.Logger, dir string) *Configstore {
+	listenAddress, port, err := testutil.GetFreePort(true, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	csDir, err := ioutil.TempDir(dir, "cs")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	csConfig := config.Configstore{
+		DataDir: csDir,
+		Storage: config.ConfigstoreStorage{
+			Type: config.ConfigstoreStorageTypeSQL,
+			DB: config.DB{
+				Type:       config.DBTypeSqlite3,
+				ConnString: path.Join(csDir, "db"),
+			},
+		},
+		Web: config.Web{
+			ListenAddress: net.JoinHostPort(listenAddress, port),
+		},
+	}
+
+	cs, err := NewConfigstore(ctx, logger, &csConfig)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	return cs
+}
+
+func TestSQLStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	cs1 := setupSQLConfigstore(ctx, t, logger.With(zap.String("name", "cs1")), dir)
+	cs2 := setupSQLConfigstore(ctx, t, logger.With(zap.String("name", "cs2")), dir)
+
+	for i := 0; i < 10; i++ {
+		if _, err := cs1.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: fmt.Sprintf("user%d", i)}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	t.Run("create duplicated user", func(t *testing.T) {
+		expectedErr := fmt.Sprintf("user with name %q already exists", "user01")
+		if _, err := cs1.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		_, err := cs1.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+		if err == nil {
+			t.Fatalf("expected error %v, got nil err", expectedErr)
+		}
+		if err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+	})
+
+	t.Run("export and import", func(t *testing.T) {
+		if _, err := cs1.ah.CreateProject(ctx, &types.Project{Name: "project01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: path.Join("user", "user0")}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		apiKey, err := cs1.ah.CreateProjectAPIKey(ctx, path.Join("user", "user0", "project01"), "apikey01")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// the api keys of the projects not in the imported data must be removed
+		if _, err := cs2.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "staleuser"}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := cs2.ah.CreateProject(ctx, &types.Project{Name: "staleproject", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: path.Join("user", "staleuser")}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := cs2.ah.CreateProjectAPIKey(ctx, path.Join("user", "staleuser", "staleproject"), "apikey01"); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		var export bytes.Buffer
+		if err := cs1.ah.Export(ctx, &export); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if err := cs2.ah.Import(ctx, &export); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		var project *types.Project
+		var apiKeysCount int
+		err = cs2.readDB.Do(ctx, func(tx *db.Tx) error {
+			var err error
+			project, err = cs2.readDB.GetProjectByAPIKeyHash(tx, util.EncodeSha256Hex(apiKey))
+			if err != nil {
+				return err
+			}
+			return tx.QueryRow("select count(*) from project_apikey").Scan(&apiKeysCount)
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if project == nil || project.Name != "project01" {
+			t.Fatalf("expected imported project api key")
+		}
+		if apiKeysCount != 1 {
+			t.Fatalf("expected 1 project api key, got %d", apiKeysCount)
+		}
+
+		users1, err := getUsers(ctx, cs1)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		users2, err := getUsers(ctx, cs2)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff(users1, users2); diff != "" {
+			t.Fatalf("users mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("maintenance mode not available", func(t *testing.T) {
+		if err := cs1.ah.MaintenanceMode(ctx, true); err == nil {
+			t.Fatalf("expected error, got nil err")
+		}
+	})
+}
+
 func TestUser(t *testing.T) {
 	dir, err := ioutil.TempDir("", "agola")
 	if err != nil {
@@ -613,6 +753,98 @@ func TestUser(t *testing.T) {
 			t.Fatalf("expected %d users, got %d", len(prevUsers)+1, len(users))
 		}
 	})
+	t.Run("user token info", func(t *testing.T) {
+		if _, err := cs.ah.CreateUserToken(ctx, "user01", "token01"); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// TODO(sgotti) change the sleep with a real check that user is in readdb
+		time.Sleep(2 * time.Second)
+
+		lastUsedTime := time.Now().UTC().Truncate(time.Second)
+		if err := cs.ah.UpdateUserTokenLastUsed(ctx, "user01", "token01", lastUsedTime); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		expectedErr := fmt.Sprintf("token %q for user %q doesn't exist", "token02", "user01")
+		err := cs.ah.UpdateUserTokenLastUsed(ctx, "user01", "token02", lastUsedTime)
+		if err == nil {
+			t.Fatalf("expected error %v, got nil err", expectedErr)
+		}
+		if err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		var user *types.User
+		err = cs.readDB.Do(ctx, func(tx *db.Tx) error {
+			var err error
+			user, err = cs.readDB.GetUser(tx, "user01")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		tokenInfo, ok := user.TokensInfo["token01"]
+		if !ok {
+			t.Fatalf("expected token info for token %q", "token01")
+		}
+		if tokenInfo.CreationTime == nil {
+			t.Fatalf("expected token creation time")
+		}
+		if tokenInfo.LastUsedTime == nil || !tokenInfo.LastUsedTime.Equal(lastUsedTime) {
+			t.Fatalf("expected token last used time %v, got %v", lastUsedTime, tokenInfo.LastUsedTime)
+		}
+	})
+	t.Run("user sessions", func(t *testing.T) {
+		sessionID, err := cs.ah.CreateUserSession(ctx, "user01", 0, 1*time.Hour)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// TODO(sgotti) change the sleep with a real check that user is in readdb
+		time.Sleep(2 * time.Second)
+
+		lastActivityTime := time.Now().UTC().Truncate(time.Second)
+		if err := cs.ah.UpdateUserSessionLastActivity(ctx, "user01", sessionID, lastActivityTime); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		var user *types.User
+		err = cs.readDB.Do(ctx, func(tx *db.Tx) error {
+			var err error
+			user, err = cs.readDB.GetUser(tx, "user01")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		session, ok := user.Sessions[sessionID]
+		if !ok {
+			t.Fatalf("expected session %q", sessionID)
+		}
+		if session.LastActivityTime == nil || !session.LastActivityTime.Equal(lastActivityTime) {
+			t.Fatalf("expected session last activity time %v, got %v", lastActivityTime, session.LastActivityTime)
+		}
+
+		if err := cs.ah.DeleteUserSession(ctx, "user01", sessionID); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		expectedErr := fmt.Sprintf("session %q for user %q doesn't exist", sessionID, "user01")
+		err = cs.ah.DeleteUserSession(ctx, "user01", sessionID)
+		if err == nil {
+			t.Fatalf("expected error %v, got nil err", expectedErr)
+		}
+		if err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+	})
 }
 
 func TestProjectGroupsAndProjectsCreate(t *testing.T) {
@@ -838,6 +1070,123 @@ func TestProjectUpdate(t *testing.T) {
 			t.Fatalf("unexpected err: %v", err)
 		}
 	})
+	t.Run("set project config repository without branch", func(t *testing.T) {
+		expectedErr := "empty config repository branch"
+		p01.ConfigRepository = &types.ProjectConfigRepository{RemoteSourceID: "rs01", LinkedAccountID: "la01", RepositoryPath: "org01/config"}
+		_, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: path.Join("user", user.Name, "project01"), Project: p01})
+		if err == nil || err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+	})
+	t.Run("set project config repository", func(t *testing.T) {
+		p01.ConfigRepository = &types.ProjectConfigRepository{RemoteSourceID: "rs01", LinkedAccountID: "la01", RepositoryPath: "org01/config", Branch: "master"}
+		p, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: path.Join("user", user.Name, "project01"), Project: p01})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff(p01.ConfigRepository, p.ConfigRepository); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("set project trigger policy with invalid branches policy", func(t *testing.T) {
+		expectedErr := `invalid project trigger policy branches "some"`
+		p01.TriggerPolicy = &types.ProjectTriggerPolicy{Branches: "some"}
+		_, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: path.Join("user", user.Name, "project01"), Project: p01})
+		if err == nil || err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+	})
+	t.Run("set project trigger policy", func(t *testing.T) {
+		p01.TriggerPolicy = &types.ProjectTriggerPolicy{Branches: types.TriggerBranchesPolicyDefault, Tags: true}
+		p, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: path.Join("user", user.Name, "project01"), Project: p01})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff(p01.TriggerPolicy, p.TriggerPolicy); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("set project deploy environments with duplicate name", func(t *testing.T) {
+		expectedErr := `duplicate deploy environment "production"`
+		p01.DeployEnvironments = []*types.ProjectDeployEnvironment{{Name: "production"}, {Name: "production"}}
+		_, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: path.Join("user", user.Name, "project01"), Project: p01})
+		if err == nil || err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+	})
+	t.Run("set project deploy environments with wrong branch regular expression", func(t *testing.T) {
+		expectedErr := `deploy environment "production": wrong branch regular expression "/release-(/": error parsing regexp: missing closing ): ` + "`release-(`"
+		p01.DeployEnvironments = []*types.ProjectDeployEnvironment{{Name: "production", Branches: []string{"/release-(/"}}}
+		_, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: path.Join("user", user.Name, "project01"), Project: p01})
+		if err == nil || err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+	})
+	t.Run("set project deploy environments", func(t *testing.T) {
+		p01.DeployEnvironments = []*types.ProjectDeployEnvironment{
+			{Name: "staging"},
+			{Name: "production", RequiredApprovals: 1, Approvers: []string{user.ID}, Branches: []string{"master", "/release-.*/"}, WaitTimer: 10 * time.Minute},
+		}
+		p, err := cs.ah.UpdateProject(ctx, &action.UpdateProjectRequest{ProjectRef: path.Join("user", user.Name, "project01"), Project: p01})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff(p01.DeployEnvironments, p.DeployEnvironments); diff != "" {
+			t.Error(diff)
+		}
+	})
+	t.Run("project api keys", func(t *testing.T) {
+		projectRef := path.Join("user", user.Name, "projectgroup01", "newproject02")
+		apiKey, err := cs.ah.CreateProjectAPIKey(ctx, projectRef, "apikey01")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if !strings.HasPrefix(apiKey, types.ProjectAPIKeyPrefix) {
+			t.Fatalf("expected api key with prefix %q, got %q", types.ProjectAPIKeyPrefix, apiKey)
+		}
+
+		// TODO(sgotti) change the sleep with a real check that project is in readdb
+		time.Sleep(2 * time.Second)
+
+		expectedErr := fmt.Sprintf("api key %q for project %q already exists", "apikey01", projectRef)
+		if _, err := cs.ah.CreateProjectAPIKey(ctx, projectRef, "apikey01"); err == nil || err.Error() != expectedErr {
+			t.Fatalf("expected err %v, got err: %v", expectedErr, err)
+		}
+
+		var p *types.Project
+		err = cs.readDB.Do(ctx, func(tx *db.Tx) error {
+			var err error
+			p, err = cs.readDB.GetProjectByAPIKeyHash(tx, util.EncodeSha256Hex(apiKey))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if p == nil || p.ID != p03.ID {
+			t.Fatalf("expected project %q for api key, got %v", p03.ID, p)
+		}
+		if p.APIKeys["apikey01"].Hash == apiKey {
+			t.Fatalf("expected api key saved hashed")
+		}
+
+		if err := cs.ah.DeleteProjectAPIKey(ctx, projectRef, "apikey01"); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		time.Sleep(2 * time.Second)
+
+		err = cs.readDB.Do(ctx, func(tx *db.Tx) error {
+			var err error
+			p, err = cs.readDB.GetProjectByAPIKeyHash(tx, util.EncodeSha256Hex(apiKey))
+			return err
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if p != nil {
+			t.Fatalf("expected no project for deleted api key")
+		}
+	})
 }
 
 func TestProjectGroupUpdate(t *testing.T) {
@@ -1184,7 +1533,7 @@ func TestProjectGroupDeleteDontSeeOldChildObjects(t *testing.T) {
 	}
 }
 
-func TestOrgMembers(t *testing.T) {
+func TestSetSecretsVariables(t *testing.T) {
 	dir, err := ioutil.TempDir("", "agola")
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
@@ -1198,58 +1547,381 @@ func TestOrgMembers(t *testing.T) {
 	defer shutdownEtcd(tetcd)
 
 	t.Logf("starting cs")
-	go func() { _ = cs.Run(ctx) }()
+	go func() {
+		_ = cs.Run(ctx)
+	}()
 
 	// TODO(sgotti) change the sleep with a real check that all is ready
 	time.Sleep(2 * time.Second)
 
-	user, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+	org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic})
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
-	org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic, CreatorUserID: user.ID})
+
+	// TODO(sgotti) change the sleep with a real check that user is in readdb
+	time.Sleep(2 * time.Second)
+
+	project, err := cs.ah.CreateProject(ctx, &types.Project{Name: "project01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: path.Join("org", org.Name)}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual})
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
 
-	// TODO(sgotti) change the sleep with a real check that all is ready
-	time.Sleep(2 * time.Second)
+	if _, err := cs.ah.CreateSecret(ctx, &types.Secret{Name: "secret01", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value01"}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := cs.ah.CreateSecret(ctx, &types.Secret{Name: "secret02", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value01"}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := cs.ah.CreateSecret(ctx, &types.Secret{Name: "secret03", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value01"}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := cs.ah.CreateVariable(ctx, &types.Variable{Name: "variable01", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Values: []types.VariableValue{{SecretName: "secret01", SecretVar: "var01"}}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := cs.ah.CreateVariable(ctx, &types.Variable{Name: "variable02", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Values: []types.VariableValue{{SecretName: "secret01", SecretVar: "var01"}}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
 
-	t.Run("test user org creator is org member with owner role", func(t *testing.T) {
-		expectedResponse := []*action.UserOrgsResponse{
-			{
-				Organization: org,
-				Role:         types.MemberRoleOwner,
+	t.Run("test set secrets with duplicate names", func(t *testing.T) {
+		expectedError := util.NewErrBadRequest(fmt.Errorf(`duplicate secret name "secret01"`))
+		_, err := cs.ah.SetSecrets(ctx, &action.SetSecretsRequest{
+			ParentType: types.ConfigTypeProject,
+			ParentRef:  project.ID,
+			Secrets: []*types.Secret{
+				{Name: "secret01", Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value01"}},
+				{Name: "secret01", Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value02"}},
 			},
+		})
+		if err == nil || err.Error() != expectedError.Error() {
+			t.Fatalf("expected err: %v, got err: %v", expectedError, err)
 		}
-		res, err := cs.ah.GetUserOrgs(ctx, user.ID)
+	})
+
+	t.Run("test set secrets with prune", func(t *testing.T) {
+		results, err := cs.ah.SetSecrets(ctx, &action.SetSecretsRequest{
+			ParentType: types.ConfigTypeProject,
+			ParentRef:  project.ID,
+			Secrets: []*types.Secret{
+				{Name: "secret01", Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value01"}},
+				{Name: "secret02", Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value02"}},
+				{Name: "secret04", Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value01"}},
+			},
+			Prune: true,
+		})
 		if err != nil {
 			t.Fatalf("unexpected err: %v", err)
 		}
-		if diff := cmp.Diff(res, expectedResponse); diff != "" {
+		expectedResults := []*action.SetResult{
+			{Name: "secret01", Result: action.SetResultTypeUnchanged},
+			{Name: "secret02", Result: action.SetResultTypeUpdated},
+			{Name: "secret04", Result: action.SetResultTypeCreated},
+			{Name: "secret03", Result: action.SetResultTypeDeleted},
+		}
+		if diff := cmp.Diff(expectedResults, results); diff != "" {
 			t.Error(diff)
 		}
-	})
 
-	orgs := []*types.Organization{}
-	for i := 0; i < 10; i++ {
-		org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: fmt.Sprintf("org%d", i), Visibility: types.VisibilityPublic, CreatorUserID: user.ID})
+		// TODO(sgotti) change the sleep with a real check that the secrets are in readdb
+		time.Sleep(2 * time.Second)
+
+		secrets, err := cs.ah.GetSecrets(ctx, types.ConfigTypeProject, project.ID, false)
 		if err != nil {
-			t.Fatalf("err: %v", err)
+			t.Fatalf("unexpected err: %v", err)
 		}
-		orgs = append(orgs, org)
-		time.Sleep(200 * time.Millisecond)
-	}
-
-	for i := 0; i < 5; i++ {
-		if err := cs.ah.DeleteOrg(ctx, fmt.Sprintf("org%d", i)); err != nil {
-			t.Fatalf("err: %v", err)
+		secretsData := map[string]map[string]string{}
+		for _, s := range secrets {
+			secretsData[s.Name] = s.Data
 		}
-	}
+		expectedSecretsData := map[string]map[string]string{
+			"secret01": {"var01": "value01"},
+			"secret02": {"var01": "value02"},
+			"secret04": {"var01": "value01"},
+		}
+		if diff := cmp.Diff(expectedSecretsData, secretsData); diff != "" {
+			t.Error(diff)
+		}
+	})
 
-	// delete some org and check that if also orgmembers aren't yet cleaned only the existing orgs are reported
-	t.Run("test only existing orgs are reported", func(t *testing.T) {
-		expectedResponse := []*action.UserOrgsResponse{
+	t.Run("test set variables without prune", func(t *testing.T) {
+		results, err := cs.ah.SetVariables(ctx, &action.SetVariablesRequest{
+			ParentType: types.ConfigTypeProject,
+			ParentRef:  project.ID,
+			Variables: []*types.Variable{
+				{Name: "variable01", Values: []types.VariableValue{{SecretName: "secret02", SecretVar: "var01"}}},
+				{Name: "variable03", Values: []types.VariableValue{{SecretName: "secret01", SecretVar: "var01"}}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		expectedResults := []*action.SetResult{
+			{Name: "variable01", Result: action.SetResultTypeUpdated},
+			{Name: "variable03", Result: action.SetResultTypeCreated},
+		}
+		if diff := cmp.Diff(expectedResults, results); diff != "" {
+			t.Error(diff)
+		}
+
+		// TODO(sgotti) change the sleep with a real check that the variables are in readdb
+		time.Sleep(2 * time.Second)
+
+		variables, err := cs.ah.GetVariables(ctx, types.ConfigTypeProject, project.ID, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		variableNames := []string{}
+		for _, v := range variables {
+			variableNames = append(variableNames, v.Name)
+		}
+		sort.Strings(variableNames)
+		if diff := cmp.Diff([]string{"variable01", "variable02", "variable03"}, variableNames); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("test usages are kept when updating secrets and variables", func(t *testing.T) {
+		if err := cs.ah.UpdateSecretUsage(ctx, types.ConfigTypeProject, project.ID, "secret01", project.ID); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if err := cs.ah.UpdateVariableUsage(ctx, types.ConfigTypeProject, project.ID, "variable02", project.ID); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// TODO(sgotti) change the sleep with a real check that the usages are in readdb
+		time.Sleep(2 * time.Second)
+
+		if _, err := cs.ah.SetSecrets(ctx, &action.SetSecretsRequest{
+			ParentType: types.ConfigTypeProject,
+			ParentRef:  project.ID,
+			Secrets: []*types.Secret{
+				{Name: "secret01", Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value03"}},
+			},
+		}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if _, err := cs.ah.UpdateVariable(ctx, &action.UpdateVariableRequest{
+			VariableName: "variable02",
+			Variable:     &types.Variable{Name: "variable02", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Values: []types.VariableValue{{SecretName: "secret02", SecretVar: "var01"}}},
+		}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// TODO(sgotti) change the sleep with a real check that the secrets are in readdb
+		time.Sleep(2 * time.Second)
+
+		secrets, err := cs.ah.GetSecrets(ctx, types.ConfigTypeProject, project.ID, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		for _, s := range secrets {
+			if _, ok := s.Usages[project.ID]; ok != (s.Name == "secret01") {
+				t.Errorf("unexpected usages for secret %q: %v", s.Name, s.Usages)
+			}
+		}
+
+		variables, err := cs.ah.GetVariables(ctx, types.ConfigTypeProject, project.ID, false)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		for _, v := range variables {
+			if _, ok := v.Usages[project.ID]; ok != (v.Name == "variable02") {
+				t.Errorf("unexpected usages for variable %q: %v", v.Name, v.Usages)
+			}
+		}
+	})
+
+	t.Run("test update usage of not existing project", func(t *testing.T) {
+		expectedError := util.NewErrBadRequest(fmt.Errorf(`project with id "notexistent" doesn't exist`))
+		err := cs.ah.UpdateSecretUsage(ctx, types.ConfigTypeProject, project.ID, "secret01", "notexistent")
+		if err == nil || err.Error() != expectedError.Error() {
+			t.Fatalf("expected err: %v, got err: %v", expectedError, err)
+		}
+	})
+}
+
+func TestSecretPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	cs, tetcd := setupConfigstore(ctx, t, logger, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	project, err := cs.ah.CreateProject(ctx, &types.Project{Name: "project01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: path.Join("org", org.Name)}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	t.Run("test set secret policy with invalid forbidden pattern", func(t *testing.T) {
+		expectedError := util.NewErrBadRequest(fmt.Errorf("invalid secret policy forbidden pattern \"(\": error parsing regexp: missing closing ): `(`"))
+		_, err := cs.ah.SetOrgSecretPolicy(ctx, org.Name, &types.SecretPolicy{ForbiddenPatterns: []string{"("}})
+		if err == nil || err.Error() != expectedError.Error() {
+			t.Fatalf("expected err: %v, got err: %v", expectedError, err)
+		}
+	})
+
+	if _, err := cs.ah.SetOrgSecretPolicy(ctx, org.Name, &types.SecretPolicy{MinLength: 8, ForbiddenPatterns: []string{"^(?i)password"}, RequiredPrefixes: []string{"sk_"}}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// TODO(sgotti) change the sleep with a real check that the org is updated in readdb
+	time.Sleep(2 * time.Second)
+
+	tests := []struct {
+		name          string
+		data          map[string]string
+		expectedError string
+	}{
+		{
+			name:          "test secret value shorter than min length",
+			data:          map[string]string{"var01": "sk_01"},
+			expectedError: `secret "secret01" value "var01" is shorter than the 8 characters required by the org secret policy`,
+		},
+		{
+			name:          "test secret value matching a forbidden pattern",
+			data:          map[string]string{"var01": "PASSWORD01"},
+			expectedError: `secret "secret01" value "var01" matches the pattern "^(?i)password" forbidden by the org secret policy`,
+		},
+		{
+			name:          "test secret value without a required prefix",
+			data:          map[string]string{"var01": "value0001"},
+			expectedError: `secret "secret01" value "var01" doesn't start with one of the prefixes sk_ required by the org secret policy`,
+		},
+		{
+			name: "test secret value satisfying the policy",
+			data: map[string]string{"var01": "sk_value0001"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cs.ah.CreateSecret(ctx, &types.Secret{Name: "secret01", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Type: types.SecretTypeInternal, Data: tt.data})
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Fatalf("expected err: %v, got err: %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+		})
+	}
+
+	t.Run("test set secrets not satisfying the policy", func(t *testing.T) {
+		expectedError := `secret "secret02" value "var01" is shorter than the 8 characters required by the org secret policy`
+		_, err := cs.ah.SetSecrets(ctx, &action.SetSecretsRequest{
+			ParentType: types.ConfigTypeProject,
+			ParentRef:  project.ID,
+			Secrets: []*types.Secret{
+				{Name: "secret02", Type: types.SecretTypeInternal, Data: map[string]string{"var01": "sk_"}},
+			},
+		})
+		if err == nil || err.Error() != expectedError {
+			t.Fatalf("expected err: %v, got err: %v", expectedError, err)
+		}
+	})
+
+	t.Run("test remove secret policy", func(t *testing.T) {
+		if _, err := cs.ah.SetOrgSecretPolicy(ctx, org.Name, nil); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		// TODO(sgotti) change the sleep with a real check that the org is updated in readdb
+		time.Sleep(2 * time.Second)
+
+		if _, err := cs.ah.CreateSecret(ctx, &types.Secret{Name: "secret02", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Type: types.SecretTypeInternal, Data: map[string]string{"var01": "value01"}}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	})
+}
+
+func TestOrgMembers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	cs, tetcd := setupConfigstore(ctx, t, logger, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	user, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic, CreatorUserID: user.ID})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	t.Run("test user org creator is org member with owner role", func(t *testing.T) {
+		expectedResponse := []*action.UserOrgsResponse{
+			{
+				Organization: org,
+				Role:         types.MemberRoleOwner,
+			},
+		}
+		res, err := cs.ah.GetUserOrgs(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if diff := cmp.Diff(res, expectedResponse); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	orgs := []*types.Organization{}
+	for i := 0; i < 10; i++ {
+		org, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: fmt.Sprintf("org%d", i), Visibility: types.VisibilityPublic, CreatorUserID: user.ID})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		orgs = append(orgs, org)
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := cs.ah.DeleteOrg(ctx, fmt.Sprintf("org%d", i)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// delete some org and check that if also orgmembers aren't yet cleaned only the existing orgs are reported
+	t.Run("test only existing orgs are reported", func(t *testing.T) {
+		expectedResponse := []*action.UserOrgsResponse{
 			{
 				Organization: org,
 				Role:         types.MemberRoleOwner,
@@ -1275,6 +1947,74 @@ func TestOrgMembers(t *testing.T) {
 
 }
 
+func TestFsck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	cs, tetcd := setupConfigstore(ctx, t, logger, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	user, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPublic, CreatorUserID: user.ID}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	problems, err := cs.ah.Fsck(ctx, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got: %v", problems)
+	}
+
+	// deleting an org leaves its members and root project group orphaned
+	if err := cs.ah.DeleteOrg(ctx, "org01"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	problems, err = cs.ah.Fsck(ctx, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	problemTypes := []types.ConfigType{}
+	for _, p := range problems {
+		if !p.Repairable() {
+			t.Errorf("expected problem %s to be repairable", p)
+		}
+		problemTypes = append(problemTypes, p.ObjectType)
+	}
+	if diff := cmp.Diff([]types.ConfigType{types.ConfigTypeOrgMember, types.ConfigTypeProjectGroup}, problemTypes); diff != "" {
+		t.Fatalf("problems mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := cs.ah.Fsck(ctx, true); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	problems, err = cs.ah.Fsck(ctx, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems after repair, got: %v", problems)
+	}
+}
+
 func TestRemoteSource(t *testing.T) {
 	dir, err := ioutil.TempDir("", "agola")
 	if err != nil {
@@ -1445,3 +2185,417 @@ func TestRemoteSource(t *testing.T) {
 		})
 	}
 }
+
+func TestProjectTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	spec := &types.ProjectTemplateSpec{
+		Parameters: []types.ProjectTemplateParameter{
+			{Name: "env", Default: "staging"},
+		},
+		Visibility:       types.VisibilityPrivate,
+		RemoteSourceName: "rs01",
+		Variables: []types.ProjectTemplateVariable{
+			{
+				Name:   "deploykey",
+				Values: []types.VariableValue{{SecretName: "deploy-${env}", SecretVar: "key"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		f    func(ctx context.Context, t *testing.T, cs *Configstore)
+	}{
+		{
+			name: "test create duplicate project template",
+			f: func(ctx context.Context, t *testing.T, cs *Configstore) {
+				if _, err := cs.ah.CreateProjectTemplate(ctx, "pt01", spec); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				expectedError := util.NewErrBadRequest(fmt.Errorf(`projecttemplate "pt01" already exists`))
+				_, err := cs.ah.CreateProjectTemplate(ctx, "pt01", spec)
+				if err.Error() != expectedError.Error() {
+					t.Fatalf("expected err: %v, got err: %v", expectedError.Error(), err.Error())
+				}
+			},
+		},
+		{
+			name: "test create project template with duplicated parameter",
+			f: func(ctx context.Context, t *testing.T, cs *Configstore) {
+				spec := &types.ProjectTemplateSpec{
+					Parameters: []types.ProjectTemplateParameter{{Name: "env"}, {Name: "env"}},
+				}
+				expectedError := util.NewErrBadRequest(fmt.Errorf(`projecttemplate parameter "env" is duplicated`))
+				_, err := cs.ah.CreateProjectTemplate(ctx, "pt01", spec)
+				if err.Error() != expectedError.Error() {
+					t.Fatalf("expected err: %v, got err: %v", expectedError.Error(), err.Error())
+				}
+			},
+		},
+		{
+			name: "test update project template adds a new revision",
+			f: func(ctx context.Context, t *testing.T, cs *Configstore) {
+				if _, err := cs.ah.CreateProjectTemplate(ctx, "pt01", spec); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				newSpec := *spec
+				newSpec.Visibility = types.VisibilityPublic
+				if _, err := cs.ah.UpdateProjectTemplate(ctx, "pt01", &newSpec); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				// TODO(sgotti) change the sleep with a real check that the project template is in readdb
+				time.Sleep(2 * time.Second)
+
+				var pt *types.ProjectTemplate
+				err := cs.readDB.Do(ctx, func(tx *db.Tx) error {
+					var err error
+					pt, err = cs.readDB.GetProjectTemplate(tx, "pt01")
+					return err
+				})
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if len(pt.Revisions) != 2 {
+					t.Fatalf("expected 2 revisions, got %d", len(pt.Revisions))
+				}
+				if pt.GetRevision(1).Visibility != types.VisibilityPrivate {
+					t.Fatalf("expected revision 1 visibility %q, got %q", types.VisibilityPrivate, pt.GetRevision(1).Visibility)
+				}
+				if pt.LatestRevision().Revision != 2 || pt.LatestRevision().Visibility != types.VisibilityPublic {
+					t.Fatalf("expected latest revision 2 with visibility %q, got revision %d with visibility %q", types.VisibilityPublic, pt.LatestRevision().Revision, pt.LatestRevision().Visibility)
+				}
+			},
+		},
+		{
+			name: "test delete project template",
+			f: func(ctx context.Context, t *testing.T, cs *Configstore) {
+				if _, err := cs.ah.CreateProjectTemplate(ctx, "pt01", spec); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if err := cs.ah.DeleteProjectTemplate(ctx, "pt01"); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				expectedError := util.NewErrBadRequest(fmt.Errorf(`projecttemplate "pt01" doesn't exist`))
+				err := cs.ah.DeleteProjectTemplate(ctx, "pt01")
+				if err.Error() != expectedError.Error() {
+					t.Fatalf("expected err: %v, got err: %v", expectedError.Error(), err.Error())
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir(dir, "agola")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			ctx := context.Background()
+
+			cs, tetcd := setupConfigstore(ctx, t, logger, dir)
+			defer shutdownEtcd(tetcd)
+
+			t.Logf("starting cs")
+			go func() { _ = cs.Run(ctx) }()
+
+			// TODO(sgotti) change the sleep with a real check that all is ready
+			time.Sleep(2 * time.Second)
+
+			tt.f(ctx, t, cs)
+		})
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	ctx := context.Background()
+
+	cs, tetcd := setupConfigstore(ctx, t, logger, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	now := time.Now().Truncate(time.Second)
+	events := []*types.AuditEvent{
+		{Time: now.Add(-4 * time.Hour), ActorName: "user01", Action: "POST /projects", Resource: "/projects"},
+		{Time: now.Add(-3 * time.Hour), ActorName: "user01", Action: "PUT /projects/{projectref}", Resource: "/projects/org01/project01"},
+		{Time: now.Add(-2 * time.Hour), ActorName: "user02", Action: "POST /projects/{projectref}/secrets", Resource: "/projects/org01/project01/secrets"},
+		{Time: now.Add(-1 * time.Hour), ActorName: "user02", Action: "PUT /projects/{projectref}", Resource: "/projects/org01/project010"},
+		{Time: now, ActorName: "user01", Action: "DELETE /orgs/{orgref}", Resource: "/orgs/org01"},
+	}
+	for _, e := range events {
+		e.ActorType = types.AuditEventActorTypeUser
+		if _, err := cs.ah.CreateAuditEvent(ctx, e); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	// TODO(sgotti) change the sleep with a real check that the audit events are in readdb
+	time.Sleep(2 * time.Second)
+
+	since := now.Add(-3 * time.Hour)
+	until := now
+	tests := []struct {
+		name     string
+		filter   *readdb.AuditEventsFilter
+		expected []*types.AuditEvent
+	}{
+		{
+			name:     "test all events newest first",
+			filter:   &readdb.AuditEventsFilter{},
+			expected: []*types.AuditEvent{events[4], events[3], events[2], events[1], events[0]},
+		},
+		{
+			name:     "test filter by actor",
+			filter:   &readdb.AuditEventsFilter{Actor: "user02", Asc: true},
+			expected: []*types.AuditEvent{events[2], events[3]},
+		},
+		{
+			name:     "test filter by action",
+			filter:   &readdb.AuditEventsFilter{Action: "PUT /projects/{projectref}"},
+			expected: []*types.AuditEvent{events[3], events[1]},
+		},
+		{
+			name:     "test filter by resource and sub resources",
+			filter:   &readdb.AuditEventsFilter{Resource: "/projects/org01/project01"},
+			expected: []*types.AuditEvent{events[2], events[1]},
+		},
+		{
+			name:     "test filter by time range",
+			filter:   &readdb.AuditEventsFilter{Since: &since, Until: &until},
+			expected: []*types.AuditEvent{events[3], events[2], events[1]},
+		},
+		{
+			name:     "test pagination",
+			filter:   &readdb.AuditEventsFilter{Actor: "user01", Start: events[4].ID, Limit: 1},
+			expected: []*types.AuditEvent{events[1]},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditEvents, err := cs.readDB.GetAuditEvents(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			ids := []string{}
+			for _, e := range auditEvents {
+				ids = append(ids, e.ID)
+			}
+			expectedIDs := []string{}
+			for _, e := range tt.expected {
+				expectedIDs = append(expectedIDs, e.ID)
+			}
+			if diff := cmp.Diff(expectedIDs, ids); diff != "" {
+				t.Fatalf("audit events mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPrincipalScope(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	cs, tetcd := setupConfigstore(ctx, t, logger, dir)
+	defer shutdownEtcd(tetcd)
+
+	t.Logf("starting cs")
+	go func() { _ = cs.Run(ctx) }()
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	user01, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user01"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	user02, err := cs.ah.CreateUser(ctx, &action.CreateUserRequest{UserName: "user02"})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// org01 is private and owned by user01, org02 is public and owned by user02
+	org01, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org01", Visibility: types.VisibilityPrivate, CreatorUserID: user01.ID})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := cs.ah.CreateOrg(ctx, &types.Organization{Name: "org02", Visibility: types.VisibilityPublic, CreatorUserID: user02.ID}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	projects := map[string]*types.Project{}
+	for _, p := range []struct {
+		org        string
+		name       string
+		visibility types.Visibility
+	}{
+		{org: "org01", name: "project01", visibility: types.VisibilityPublic},
+		{org: "org02", name: "project02", visibility: types.VisibilityPublic},
+		{org: "org02", name: "project03", visibility: types.VisibilityPrivate},
+		{org: "org01", name: "project05", visibility: types.VisibilityPrivate},
+	} {
+		project, err := cs.ah.CreateProject(ctx, &types.Project{Name: p.name, Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: path.Join("org", p.org)}, Visibility: p.visibility, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		projects[p.name] = project
+
+		if _, err := cs.ah.CreateSecret(ctx, &types.Secret{Name: "secret01", Parent: types.Parent{Type: types.ConfigTypeProject, ID: project.ID}, Type: types.SecretTypeInternal, Data: map[string]string{"secret01": "secretvar01"}}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	// TODO(sgotti) change the sleep with a real check that all is ready
+	time.Sleep(2 * time.Second)
+
+	csc := csclient.NewClient("http://" + cs.c.Web.ListenAddress)
+	user01Ctx := csclient.WithPrincipal(ctx, csapitypes.UserPrincipal(user01.ID))
+	user02Ctx := csclient.WithPrincipal(ctx, csapitypes.UserPrincipal(user02.ID))
+	anonymousCtx := csclient.WithPrincipal(ctx, csapitypes.PrincipalAnonymous)
+	project01Ctx := csclient.WithPrincipal(ctx, csapitypes.ProjectPrincipal(projects["project01"].ID))
+
+	expectStatus := func(t *testing.T, resp *http.Response, err error, status int) {
+		t.Helper()
+		if status == http.StatusOK {
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			return
+		}
+		if err == nil {
+			t.Fatalf("expected error with status %d, got no error", status)
+		}
+		if resp == nil || resp.StatusCode != status {
+			t.Fatalf("expected error with status %d, got err: %v", status, err)
+		}
+	}
+
+	t.Run("test org member can access the org objects", func(t *testing.T) {
+		_, resp, err := csc.GetProject(user01Ctx, projects["project01"].ID)
+		expectStatus(t, resp, err, http.StatusOK)
+		_, resp, err = csc.GetProjectSecrets(user01Ctx, projects["project01"].ID, true)
+		expectStatus(t, resp, err, http.StatusOK)
+	})
+
+	t.Run("test cross org access is denied", func(t *testing.T) {
+		_, resp, err := csc.GetProject(user02Ctx, projects["project01"].ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProject(user02Ctx, path.Join("org", "org01", "project01"))
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProjectSecrets(user02Ctx, projects["project01"].ID, true)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetOrg(user02Ctx, org01.ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProjectGroupProjects(user02Ctx, path.Join("org", "org01"))
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProject(anonymousCtx, projects["project01"].ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProject(project01Ctx, projects["project03"].ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+	})
+
+	t.Run("test cross org writes are denied", func(t *testing.T) {
+		_, resp, err := csc.CreateProject(user02Ctx, &types.Project{Name: "project04", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: path.Join("org", "org01")}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual})
+		expectStatus(t, resp, err, http.StatusForbidden)
+		resp, err = csc.DeleteProjectSecret(user02Ctx, projects["project01"].ID, "secret01")
+		expectStatus(t, resp, err, http.StatusForbidden)
+		resp, err = csc.DeleteProject(user02Ctx, projects["project01"].ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		resp, err = csc.DeleteOrg(user02Ctx, org01.ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		resp, err = csc.Export(user02Ctx)
+		expectStatus(t, resp, err, http.StatusForbidden)
+	})
+
+	t.Run("test public objects are readable but their secrets aren't", func(t *testing.T) {
+		_, resp, err := csc.GetProject(user01Ctx, projects["project02"].ID)
+		expectStatus(t, resp, err, http.StatusOK)
+		_, resp, err = csc.GetProject(anonymousCtx, projects["project02"].ID)
+		expectStatus(t, resp, err, http.StatusOK)
+		_, resp, err = csc.GetProjectSecrets(user01Ctx, projects["project02"].ID, true)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProject(user01Ctx, projects["project03"].ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+	})
+
+	t.Run("test lists report only the accessible objects", func(t *testing.T) {
+		orgs, _, err := csc.GetOrgs(user02Ctx, "", 0, true)
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		orgNames := []string{}
+		for _, org := range orgs {
+			orgNames = append(orgNames, org.Name)
+		}
+		if diff := cmp.Diff([]string{"org02"}, orgNames); diff != "" {
+			t.Error(diff)
+		}
+
+		groupProjects, _, err := csc.GetProjectGroupProjects(user01Ctx, path.Join("org", "org02"))
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		projectNames := []string{}
+		for _, p := range groupProjects {
+			projectNames = append(projectNames, p.Name)
+		}
+		if diff := cmp.Diff([]string{"project02"}, projectNames); diff != "" {
+			t.Error(diff)
+		}
+	})
+
+	t.Run("test requests without principal aren't restricted", func(t *testing.T) {
+		_, resp, err := csc.GetProjectSecrets(ctx, projects["project01"].ID, true)
+		expectStatus(t, resp, err, http.StatusOK)
+		_, resp, err = csc.GetProjectSecrets(ctx, projects["project03"].ID, true)
+		expectStatus(t, resp, err, http.StatusOK)
+	})
+
+	t.Run("test project api key principal can access its project objects", func(t *testing.T) {
+		_, resp, err := csc.GetProject(project01Ctx, projects["project01"].ID)
+		expectStatus(t, resp, err, http.StatusOK)
+		_, resp, err = csc.GetProjectSecrets(project01Ctx, projects["project01"].ID, true)
+		expectStatus(t, resp, err, http.StatusOK)
+	})
+
+	t.Run("test project api key principal cannot access the other objects of its owner", func(t *testing.T) {
+		_, resp, err := csc.GetProject(project01Ctx, projects["project05"].ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProjectSecrets(project01Ctx, projects["project05"].ID, true)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetOrg(project01Ctx, org01.ID)
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.GetProjectGroupProjects(project01Ctx, path.Join("org", "org01"))
+		expectStatus(t, resp, err, http.StatusForbidden)
+		_, resp, err = csc.CreateProject(project01Ctx, &types.Project{Name: "project06", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: path.Join("org", "org01")}, Visibility: types.VisibilityPublic, RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeManual})
+		expectStatus(t, resp, err, http.StatusForbidden)
+	})
+}
@@ -0,0 +1,382 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fsck checks the consistency of the configstore data, reporting the
+// objects with dangling references and the orphaned objects.
+package fsck
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/services/configstore/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Data contains all the configstore objects keyed by id
+type Data struct {
+	Users            map[string]*types.User
+	Orgs             map[string]*types.Organization
+	OrgMembers       map[string]*types.OrganizationMember
+	ProjectGroups    map[string]*types.ProjectGroup
+	Projects         map[string]*types.Project
+	RemoteSources    map[string]*types.RemoteSource
+	Secrets          map[string]*types.Secret
+	Variables        map[string]*types.Variable
+	ProjectTemplates map[string]*types.ProjectTemplate
+}
+
+func NewData() *Data {
+	return &Data{
+		Users:            map[string]*types.User{},
+		Orgs:             map[string]*types.Organization{},
+		OrgMembers:       map[string]*types.OrganizationMember{},
+		ProjectGroups:    map[string]*types.ProjectGroup{},
+		Projects:         map[string]*types.Project{},
+		RemoteSources:    map[string]*types.RemoteSource{},
+		Secrets:          map[string]*types.Secret{},
+		Variables:        map[string]*types.Variable{},
+		ProjectTemplates: map[string]*types.ProjectTemplate{},
+	}
+}
+
+// ReadExport reads the data from a configstore export
+func ReadExport(r io.Reader) (*Data, error) {
+	d := NewData()
+
+	dec := json.NewDecoder(r)
+	for {
+		var de *datamanager.DataEntry
+		err := dec.Decode(&de)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Errorf("failed to decode export entry: %w", err)
+		}
+
+		switch types.ConfigType(de.DataType) {
+		case types.ConfigTypeUser:
+			var user *types.User
+			err = json.Unmarshal(de.Data, &user)
+			d.Users[de.ID] = user
+		case types.ConfigTypeOrg:
+			var org *types.Organization
+			err = json.Unmarshal(de.Data, &org)
+			d.Orgs[de.ID] = org
+		case types.ConfigTypeOrgMember:
+			var orgMember *types.OrganizationMember
+			err = json.Unmarshal(de.Data, &orgMember)
+			d.OrgMembers[de.ID] = orgMember
+		case types.ConfigTypeProjectGroup:
+			var projectGroup *types.ProjectGroup
+			err = json.Unmarshal(de.Data, &projectGroup)
+			d.ProjectGroups[de.ID] = projectGroup
+		case types.ConfigTypeProject:
+			var project *types.Project
+			err = json.Unmarshal(de.Data, &project)
+			d.Projects[de.ID] = project
+		case types.ConfigTypeRemoteSource:
+			var remoteSource *types.RemoteSource
+			err = json.Unmarshal(de.Data, &remoteSource)
+			d.RemoteSources[de.ID] = remoteSource
+		case types.ConfigTypeSecret:
+			var secret *types.Secret
+			err = json.Unmarshal(de.Data, &secret)
+			d.Secrets[de.ID] = secret
+		case types.ConfigTypeVariable:
+			var variable *types.Variable
+			err = json.Unmarshal(de.Data, &variable)
+			d.Variables[de.ID] = variable
+		case types.ConfigTypeProjectTemplate:
+			var projectTemplate *types.ProjectTemplate
+			err = json.Unmarshal(de.Data, &projectTemplate)
+			d.ProjectTemplates[de.ID] = projectTemplate
+		default:
+			return nil, errors.Errorf("unknown data type %q for entry %q", de.DataType, de.ID)
+		}
+		if err != nil {
+			return nil, errors.Errorf("failed to unmarshal %s %q: %w", de.DataType, de.ID, err)
+		}
+	}
+
+	return d, nil
+}
+
+// Problem is a consistency problem of a configstore object
+type Problem struct {
+	ObjectType  types.ConfigType
+	ObjectID    string
+	Description string
+
+	// Action, when not nil, is the datamanager action that repairs the
+	// problem deleting the object or removing its dangling references
+	Action *datamanager.Action
+}
+
+// Repairable reports if the problem could be automatically repaired
+func (p *Problem) Repairable() bool {
+	return p.Action != nil
+}
+
+func (p *Problem) String() string {
+	return fmt.Sprintf("%s %q: %s", p.ObjectType, p.ObjectID, p.Description)
+}
+
+type checker struct {
+	d *Data
+
+	// linkedAccounts are the users linked accounts keyed by id
+	linkedAccounts map[string]*types.LinkedAccount
+
+	problems []*Problem
+}
+
+// Check checks the data consistency and returns the problems sorted by object
+// type and id. At most one problem is reported for every object.
+func Check(d *Data) ([]*Problem, error) {
+	c := &checker{
+		d:              d,
+		linkedAccounts: map[string]*types.LinkedAccount{},
+	}
+	for _, user := range d.Users {
+		for id, la := range user.LinkedAccounts {
+			c.linkedAccounts[id] = la
+		}
+	}
+
+	if err := c.checkUsers(); err != nil {
+		return nil, err
+	}
+	c.checkOrgs()
+	c.checkOrgMembers()
+	c.checkProjectGroups()
+	c.checkProjects()
+	c.checkSecrets()
+	c.checkVariables()
+
+	sort.Slice(c.problems, func(i, j int) bool {
+		if c.problems[i].ObjectType != c.problems[j].ObjectType {
+			return c.problems[i].ObjectType < c.problems[j].ObjectType
+		}
+		return c.problems[i].ObjectID < c.problems[j].ObjectID
+	})
+
+	return c.problems, nil
+}
+
+func (c *checker) addProblem(objectType types.ConfigType, id, description string, action *datamanager.Action) {
+	c.problems = append(c.problems, &Problem{
+		ObjectType:  objectType,
+		ObjectID:    id,
+		Description: description,
+		Action:      action,
+	})
+}
+
+func deleteAction(objectType types.ConfigType, id string) *datamanager.Action {
+	return &datamanager.Action{
+		ActionType: datamanager.ActionTypeDelete,
+		DataType:   string(objectType),
+		ID:         id,
+	}
+}
+
+// hasRootProjectGroup reports if a user or an organization has a root project
+// group
+func (c *checker) hasRootProjectGroup(parentType types.ConfigType, id string) bool {
+	for _, pg := range c.d.ProjectGroups {
+		if pg.Parent.Type == parentType && pg.Parent.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parentProblem returns the problem of an object parent or an empty string
+// when the parent exists and isn't orphaned
+func (c *checker) parentProblem(parent types.Parent) string {
+	if !c.parentExists(parent) {
+		return fmt.Sprintf("parent %s %q doesn't exist", parent.Type, parent.ID)
+	}
+	if !c.parentRooted(parent) {
+		return fmt.Sprintf("parent %s %q is orphaned", parent.Type, parent.ID)
+	}
+	return ""
+}
+
+func (c *checker) parentExists(parent types.Parent) bool {
+	var ok bool
+	switch parent.Type {
+	case types.ConfigTypeUser:
+		_, ok = c.d.Users[parent.ID]
+	case types.ConfigTypeOrg:
+		_, ok = c.d.Orgs[parent.ID]
+	case types.ConfigTypeProjectGroup:
+		_, ok = c.d.ProjectGroups[parent.ID]
+	case types.ConfigTypeProject:
+		_, ok = c.d.Projects[parent.ID]
+	}
+	return ok
+}
+
+// parentRooted reports if the parent hierarchy reaches an existing user or
+// organization
+func (c *checker) parentRooted(parent types.Parent) bool {
+	// visited avoids looping on a corrupted hierarchy
+	visited := map[types.Parent]struct{}{}
+
+	for {
+		if !c.parentExists(parent) {
+			return false
+		}
+		if _, ok := visited[parent]; ok {
+			return false
+		}
+		visited[parent] = struct{}{}
+
+		switch parent.Type {
+		case types.ConfigTypeUser, types.ConfigTypeOrg:
+			return true
+		case types.ConfigTypeProjectGroup:
+			parent = c.d.ProjectGroups[parent.ID].Parent
+		case types.ConfigTypeProject:
+			parent = c.d.Projects[parent.ID].Parent
+		}
+	}
+}
+
+func (c *checker) checkUsers() error {
+	for id, user := range c.d.Users {
+		if !c.hasRootProjectGroup(types.ConfigTypeUser, id) {
+			c.addProblem(types.ConfigTypeUser, id, "root project group doesn't exist", nil)
+			continue
+		}
+
+		danglingLinkedAccounts := []string{}
+		for laID, la := range user.LinkedAccounts {
+			if _, ok := c.d.RemoteSources[la.RemoteSourceID]; !ok {
+				danglingLinkedAccounts = append(danglingLinkedAccounts, laID)
+			}
+		}
+		if len(danglingLinkedAccounts) == 0 {
+			continue
+		}
+		sort.Strings(danglingLinkedAccounts)
+
+		// repair removing the dangling linked accounts
+		repairedUser := *user
+		repairedUser.LinkedAccounts = map[string]*types.LinkedAccount{}
+		for laID, la := range user.LinkedAccounts {
+			if _, ok := c.d.RemoteSources[la.RemoteSourceID]; ok {
+				repairedUser.LinkedAccounts[laID] = la
+			}
+		}
+		userj, err := json.Marshal(repairedUser)
+		if err != nil {
+			return errors.Errorf("failed to marshal user: %w", err)
+		}
+		action := &datamanager.Action{
+			ActionType: datamanager.ActionTypePut,
+			DataType:   string(types.ConfigTypeUser),
+			ID:         id,
+			Data:       userj,
+		}
+		c.addProblem(types.ConfigTypeUser, id, fmt.Sprintf("linked accounts %s reference remote sources that don't exist", strings.Join(danglingLinkedAccounts, ", ")), action)
+	}
+
+	return nil
+}
+
+func (c *checker) checkOrgs() {
+	for id := range c.d.Orgs {
+		if !c.hasRootProjectGroup(types.ConfigTypeOrg, id) {
+			c.addProblem(types.ConfigTypeOrg, id, "root project group doesn't exist", nil)
+		}
+	}
+}
+
+func (c *checker) checkOrgMembers() {
+	for id, orgMember := range c.d.OrgMembers {
+		if _, ok := c.d.Orgs[orgMember.OrganizationID]; !ok {
+			c.addProblem(types.ConfigTypeOrgMember, id, fmt.Sprintf("organization %q doesn't exist", orgMember.OrganizationID), deleteAction(types.ConfigTypeOrgMember, id))
+			continue
+		}
+		if _, ok := c.d.Users[orgMember.UserID]; !ok {
+			c.addProblem(types.ConfigTypeOrgMember, id, fmt.Sprintf("user %q doesn't exist", orgMember.UserID), deleteAction(types.ConfigTypeOrgMember, id))
+		}
+	}
+}
+
+func (c *checker) checkProjectGroups() {
+	for id, pg := range c.d.ProjectGroups {
+		if problem := c.parentProblem(pg.Parent); problem != "" {
+			c.addProblem(types.ConfigTypeProjectGroup, id, problem, deleteAction(types.ConfigTypeProjectGroup, id))
+		}
+	}
+}
+
+func (c *checker) checkProjects() {
+	for id, p := range c.d.Projects {
+		if problem := c.parentProblem(p.Parent); problem != "" {
+			c.addProblem(types.ConfigTypeProject, id, problem, deleteAction(types.ConfigTypeProject, id))
+			continue
+		}
+
+		// the dangling remote repository references cannot be repaired
+		// since the project won't work without them
+		problems := []string{}
+		if p.RemoteRepositoryConfigType == types.RemoteRepositoryConfigTypeRemoteSource {
+			problems = append(problems, c.remoteRepositoryProblems("", p.RemoteSourceID, p.LinkedAccountID)...)
+		}
+		if p.ConfigRepository != nil {
+			problems = append(problems, c.remoteRepositoryProblems("config repository ", p.ConfigRepository.RemoteSourceID, p.ConfigRepository.LinkedAccountID)...)
+		}
+		if len(problems) > 0 {
+			c.addProblem(types.ConfigTypeProject, id, strings.Join(problems, ", "), nil)
+		}
+	}
+}
+
+func (c *checker) remoteRepositoryProblems(prefix, remoteSourceID, linkedAccountID string) []string {
+	problems := []string{}
+	if _, ok := c.d.RemoteSources[remoteSourceID]; !ok {
+		problems = append(problems, fmt.Sprintf("%sremote source %q doesn't exist", prefix, remoteSourceID))
+	}
+	if _, ok := c.linkedAccounts[linkedAccountID]; !ok {
+		problems = append(problems, fmt.Sprintf("%slinked account %q doesn't exist", prefix, linkedAccountID))
+	}
+	return problems
+}
+
+func (c *checker) checkSecrets() {
+	for id, secret := range c.d.Secrets {
+		if problem := c.parentProblem(secret.Parent); problem != "" {
+			c.addProblem(types.ConfigTypeSecret, id, problem, deleteAction(types.ConfigTypeSecret, id))
+		}
+	}
+}
+
+func (c *checker) checkVariables() {
+	for id, variable := range c.d.Variables {
+		if problem := c.parentProblem(variable.Parent); problem != "" {
+			c.addProblem(types.ConfigTypeVariable, id, problem, deleteAction(types.ConfigTypeVariable, id))
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsck
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/services/configstore/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testData returns a consistent data set
+func testData() *Data {
+	d := NewData()
+
+	d.RemoteSources["rs01"] = &types.RemoteSource{ID: "rs01", Name: "rs01"}
+	d.Users["user01"] = &types.User{
+		ID:   "user01",
+		Name: "user01",
+		LinkedAccounts: map[string]*types.LinkedAccount{
+			"la01": {ID: "la01", RemoteSourceID: "rs01"},
+		},
+	}
+	d.Orgs["org01"] = &types.Organization{ID: "org01", Name: "org01"}
+	d.OrgMembers["member01"] = &types.OrganizationMember{ID: "member01", OrganizationID: "org01", UserID: "user01"}
+	d.ProjectGroups["userpg"] = &types.ProjectGroup{ID: "userpg", Parent: types.Parent{Type: types.ConfigTypeUser, ID: "user01"}}
+	d.ProjectGroups["orgpg"] = &types.ProjectGroup{ID: "orgpg", Parent: types.Parent{Type: types.ConfigTypeOrg, ID: "org01"}}
+	d.ProjectGroups["pg01"] = &types.ProjectGroup{ID: "pg01", Name: "pg01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: "orgpg"}}
+	d.Projects["project01"] = &types.Project{
+		ID:                         "project01",
+		Name:                       "project01",
+		Parent:                     types.Parent{Type: types.ConfigTypeProjectGroup, ID: "pg01"},
+		RemoteRepositoryConfigType: types.RemoteRepositoryConfigTypeRemoteSource,
+		RemoteSourceID:             "rs01",
+		LinkedAccountID:            "la01",
+	}
+	d.Secrets["secret01"] = &types.Secret{ID: "secret01", Name: "secret01", Parent: types.Parent{Type: types.ConfigTypeProject, ID: "project01"}}
+	d.Variables["variable01"] = &types.Variable{ID: "variable01", Name: "variable01", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: "pg01"}}
+
+	return d
+}
+
+type testProblem struct {
+	ObjectType  types.ConfigType
+	ObjectID    string
+	Description string
+	Repairable  bool
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(d *Data)
+		problems []testProblem
+	}{
+		{
+			name:   "consistent data",
+			change: func(d *Data) {},
+		},
+		{
+			name: "deleted remote source",
+			change: func(d *Data) {
+				delete(d.RemoteSources, "rs01")
+			},
+			problems: []testProblem{
+				{ObjectType: types.ConfigTypeProject, ObjectID: "project01", Description: `remote source "rs01" doesn't exist`},
+				{ObjectType: types.ConfigTypeUser, ObjectID: "user01", Description: "linked accounts la01 reference remote sources that don't exist", Repairable: true},
+			},
+		},
+		{
+			name: "deleted user",
+			change: func(d *Data) {
+				delete(d.Users, "user01")
+			},
+			problems: []testProblem{
+				{ObjectType: types.ConfigTypeOrgMember, ObjectID: "member01", Description: `user "user01" doesn't exist`, Repairable: true},
+				{ObjectType: types.ConfigTypeProject, ObjectID: "project01", Description: `linked account "la01" doesn't exist`},
+				{ObjectType: types.ConfigTypeProjectGroup, ObjectID: "userpg", Description: `parent user "user01" doesn't exist`, Repairable: true},
+			},
+		},
+		{
+			name: "deleted org root project group",
+			change: func(d *Data) {
+				delete(d.ProjectGroups, "orgpg")
+			},
+			problems: []testProblem{
+				{ObjectType: types.ConfigTypeOrg, ObjectID: "org01", Description: "root project group doesn't exist"},
+				{ObjectType: types.ConfigTypeProject, ObjectID: "project01", Description: `parent projectgroup "pg01" is orphaned`, Repairable: true},
+				{ObjectType: types.ConfigTypeProjectGroup, ObjectID: "pg01", Description: `parent projectgroup "orgpg" doesn't exist`, Repairable: true},
+				{ObjectType: types.ConfigTypeSecret, ObjectID: "secret01", Description: `parent project "project01" is orphaned`, Repairable: true},
+				{ObjectType: types.ConfigTypeVariable, ObjectID: "variable01", Description: `parent projectgroup "pg01" is orphaned`, Repairable: true},
+			},
+		},
+		{
+			name: "project groups loop",
+			change: func(d *Data) {
+				d.ProjectGroups["pg01"].Parent = types.Parent{Type: types.ConfigTypeProjectGroup, ID: "pg02"}
+				d.ProjectGroups["pg02"] = &types.ProjectGroup{ID: "pg02", Name: "pg02", Parent: types.Parent{Type: types.ConfigTypeProjectGroup, ID: "pg01"}}
+				delete(d.Projects, "project01")
+				delete(d.Secrets, "secret01")
+				delete(d.Variables, "variable01")
+			},
+			problems: []testProblem{
+				{ObjectType: types.ConfigTypeProjectGroup, ObjectID: "pg01", Description: `parent projectgroup "pg02" is orphaned`, Repairable: true},
+				{ObjectType: types.ConfigTypeProjectGroup, ObjectID: "pg02", Description: `parent projectgroup "pg01" is orphaned`, Repairable: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testData()
+			tt.change(d)
+
+			problems, err := Check(d)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			out := []testProblem{}
+			for _, p := range problems {
+				out = append(out, testProblem{
+					ObjectType:  p.ObjectType,
+					ObjectID:    p.ObjectID,
+					Description: p.Description,
+					Repairable:  p.Repairable(),
+				})
+			}
+			if tt.problems == nil {
+				tt.problems = []testProblem{}
+			}
+			if diff := cmp.Diff(tt.problems, out); diff != "" {
+				t.Errorf("problems mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckRepairLinkedAccounts(t *testing.T) {
+	d := testData()
+	d.Users["user01"].LinkedAccounts["la02"] = &types.LinkedAccount{ID: "la02", RemoteSourceID: "rs02"}
+
+	problems, err := Check(d)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(problems) != 1 {
+		t.Fatalf("expected 1 problem, got %d", len(problems))
+	}
+	action := problems[0].Action
+	if action.ActionType != datamanager.ActionTypePut {
+		t.Fatalf("expected put action, got %q", action.ActionType)
+	}
+
+	var user *types.User
+	if err := json.Unmarshal(action.Data, &user); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, ok := user.LinkedAccounts["la01"]; !ok {
+		t.Errorf("expected linked account la01 to be kept")
+	}
+	if _, ok := user.LinkedAccounts["la02"]; ok {
+		t.Errorf("expected linked account la02 to be removed")
+	}
+	// the checked data must not be changed
+	if _, ok := d.Users["user01"].LinkedAccounts["la02"]; !ok {
+		t.Errorf("expected data user linked account la02 to be kept")
+	}
+}
+
+func TestReadExport(t *testing.T) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, de := range []*datamanager.DataEntry{
+		{ID: "user01", DataType: string(types.ConfigTypeUser), Data: []byte(`{"id":"user01","name":"user01"}`)},
+		{ID: "orgpg", DataType: string(types.ConfigTypeProjectGroup), Data: []byte(`{"id":"orgpg","parent":{"type":"org","id":"org01"}}`)},
+	} {
+		if err := enc.Encode(de); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	d, err := ReadExport(&buf)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if d.Users["user01"].Name != "user01" {
+		t.Errorf("expected user user01, got %v", d.Users["user01"])
+	}
+	if d.ProjectGroups["orgpg"].Parent.ID != "org01" {
+		t.Errorf("expected project group orgpg with parent org01, got %v", d.ProjectGroups["orgpg"])
+	}
+
+	if _, err := ReadExport(bytes.NewBufferString(`{"id":"id01","data_type":"unknown","data":"e30="}`)); err == nil {
+		t.Errorf("expected error for unknown data type")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/configstore/types"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	auditeventInsert = sb.Insert("auditevent").Columns("id", "time", "actorid", "actorname", "action", "resource", "data")
+)
+
+// AuditEventsFilter defines the audit events to return. Empty fields aren't
+// used as filters.
+type AuditEventsFilter struct {
+	// Actor matches the actor id or name
+	Actor  string
+	Action string
+	// Resource matches the resource and all its sub resources
+	Resource string
+	Since    *time.Time
+	Until    *time.Time
+
+	// Start is the id of the audit event (excluded) to start from
+	Start string
+	Limit int
+	Asc   bool
+}
+
+func (r *ReadDB) insertAuditEvent(tx *db.Tx, data []byte) error {
+	auditEvent := types.AuditEvent{}
+	if err := json.Unmarshal(data, &auditEvent); err != nil {
+		return errors.Errorf("failed to unmarshal auditevent: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deleteAuditEvent(tx, auditEvent.ID); err != nil {
+		return err
+	}
+	q, args, err := auditeventInsert.Values(auditEvent.ID, auditEvent.Time.UnixNano(), auditEvent.ActorID, auditEvent.ActorName, auditEvent.Action, auditEvent.Resource, data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert auditevent: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deleteAuditEvent(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from auditevent where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete auditevent: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) getAuditEventTime(tx *db.Tx, id string) (*int64, error) {
+	q, args, err := sb.Select("time").From("auditevent").Where(sq.Eq{"id": id}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	var t int64
+	if err := tx.QueryRow(q, args...).Scan(&t); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Errorf("failed to scan rows: %w", err)
+	}
+	return &t, nil
+}
+
+func getAuditEventsFilteredQuery(filter *AuditEventsFilter, startTime *int64) sq.SelectBuilder {
+	s := sb.Select("id", "data").From("auditevent")
+	if filter.Asc {
+		s = s.OrderBy("time asc", "id asc")
+	} else {
+		s = s.OrderBy("time desc", "id desc")
+	}
+
+	if filter.Actor != "" {
+		s = s.Where(sq.Or{sq.Eq{"actorid": filter.Actor}, sq.Eq{"actorname": filter.Actor}})
+	}
+	if filter.Action != "" {
+		s = s.Where(sq.Eq{"action": filter.Action})
+	}
+	if filter.Resource != "" {
+		// match the resource and its sub resources using a range to keep
+		// using the index ("0" is the character following "/")
+		s = s.Where(sq.Or{
+			sq.Eq{"resource": filter.Resource},
+			sq.And{sq.GtOrEq{"resource": filter.Resource + "/"}, sq.Lt{"resource": filter.Resource + "0"}},
+		})
+	}
+	if filter.Since != nil {
+		s = s.Where(sq.GtOrEq{"time": filter.Since.UnixNano()})
+	}
+	if filter.Until != nil {
+		s = s.Where(sq.Lt{"time": filter.Until.UnixNano()})
+	}
+	if startTime != nil {
+		// events can have the same time so also compare their id
+		if filter.Asc {
+			s = s.Where(sq.Or{sq.Gt{"time": *startTime}, sq.And{sq.Eq{"time": *startTime}, sq.Gt{"id": filter.Start}}})
+		} else {
+			s = s.Where(sq.Or{sq.Lt{"time": *startTime}, sq.And{sq.Eq{"time": *startTime}, sq.Lt{"id": filter.Start}}})
+		}
+	}
+	if filter.Limit > 0 {
+		s = s.Limit(uint64(filter.Limit))
+	}
+
+	return s
+}
+
+func (r *ReadDB) GetAuditEvents(ctx context.Context, filter *AuditEventsFilter) ([]*types.AuditEvent, error) {
+	var auditEvents []*types.AuditEvent
+
+	err := r.rdb.Do(ctx, func(tx *db.Tx) error {
+		var startTime *int64
+		if filter.Start != "" {
+			var err error
+			startTime, err = r.getAuditEventTime(tx, filter.Start)
+			if err != nil {
+				return err
+			}
+			if startTime == nil {
+				return util.NewErrBadRequest(errors.Errorf("audit event %q doesn't exist", filter.Start))
+			}
+		}
+
+		q, args, err := getAuditEventsFilteredQuery(filter, startTime).ToSql()
+		r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+		if err != nil {
+			return errors.Errorf("failed to build query: %w", err)
+		}
+
+		rows, err := tx.Query(q, args...)
+		if err != nil {
+			return err
+		}
+
+		auditEvents, _, err = scanAuditEvents(rows)
+		return err
+	})
+	return auditEvents, err
+}
+
+func scanAuditEvent(rows *sql.Rows, additionalFields ...interface{}) (*types.AuditEvent, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	auditEvent := types.AuditEvent{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &auditEvent); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal auditevent: %w", err)
+		}
+	}
+
+	return &auditEvent, id, nil
+}
+
+func scanAuditEvents(rows *sql.Rows) ([]*types.AuditEvent, []string, error) {
+	auditEvents := []*types.AuditEvent{}
+	ids := []string{}
+	for rows.Next() {
+		e, id, err := scanAuditEvent(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		auditEvents = append(auditEvents, e)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return auditEvents, ids, nil
+}
@@ -30,6 +30,7 @@ var Stmts = []string{
 
 	"create table project (id uuid, name varchar, parentid varchar, parenttype varchar, data bytea, PRIMARY KEY (id))",
 	"create index project_name on project(name)",
+	"create table project_apikey (keyhash varchar, projectid uuid, PRIMARY KEY (keyhash))",
 
 	"create table user (id uuid, name varchar, data bytea, PRIMARY KEY (id))",
 	"create index user_name on user(name)",
@@ -44,7 +45,7 @@ var Stmts = []string{
 
 	"create table remotesource (id uuid, name varchar, data bytea, PRIMARY KEY (id))",
 
-	"create table linkedaccount_user (id uuid, remotesourceid uuid, userid uuid, remoteuserid uuid, PRIMARY KEY (id), FOREIGN KEY(userid) REFERENCES user(id))",
+	"create table linkedaccount_user (id uuid, remotesourceid uuid, userid uuid, remoteuserid varchar, PRIMARY KEY (id), FOREIGN KEY(userid) REFERENCES user(id))",
 
 	"create table linkedaccount_project (id uuid, projectid uuid, PRIMARY KEY (id), FOREIGN KEY(projectid) REFERENCES user(id))",
 
@@ -53,4 +54,16 @@ var Stmts = []string{
 
 	"create table variable (id uuid, name varchar, parentid varchar, parenttype varchar, data bytea, PRIMARY KEY (id))",
 	"create index variable_name on variable(name)",
+
+	"create table projecttemplate (id uuid, name varchar, data bytea, PRIMARY KEY (id))",
+	"create index projecttemplate_name on projecttemplate(name)",
+
+	// the time is saved as unix nanoseconds. Every filter has an index
+	// ordered by time to avoid scanning the whole audit log
+	"create table auditevent (id uuid, time bigint, actorid varchar, actorname varchar, action varchar, resource varchar, data bytea, PRIMARY KEY (id))",
+	"create index auditevent_time on auditevent(time, id)",
+	"create index auditevent_actorid on auditevent(actorid, time)",
+	"create index auditevent_actorname on auditevent(actorname, time)",
+	"create index auditevent_action on auditevent(action, time)",
+	"create index auditevent_resource on auditevent(resource, time)",
 }
@@ -32,6 +32,8 @@ import (
 var (
 	projectSelect = sb.Select("id", "data").From("project")
 	projectInsert = sb.Insert("project").Columns("id", "name", "parentid", "parenttype", "data")
+
+	projectAPIKeyInsert = sb.Insert("project_apikey").Columns("keyhash", "projectid")
 )
 
 func (r *ReadDB) insertProject(tx *db.Tx, data []byte) error {
@@ -51,6 +53,17 @@ func (r *ReadDB) insertProject(tx *db.Tx, data []byte) error {
 		return errors.Errorf("failed to insert project: %w", err)
 	}
 
+	// insert project api keys
+	for _, apiKey := range project.APIKeys {
+		q, args, err = projectAPIKeyInsert.Values(apiKey.Hash, project.ID).ToSql()
+		if err != nil {
+			return errors.Errorf("failed to build query: %w", err)
+		}
+		if _, err = tx.Exec(q, args...); err != nil {
+			return errors.Errorf("failed to insert project api key: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -59,6 +72,9 @@ func (r *ReadDB) deleteProject(tx *db.Tx, id string) error {
 	if _, err := tx.Exec("delete from project where id = $1", id); err != nil {
 		return errors.Errorf("failed to delete project: %w", err)
 	}
+	if _, err := tx.Exec("delete from project_apikey where projectid = $1", id); err != nil {
+		return errors.Errorf("failed to delete project api keys: %w", err)
+	}
 	return nil
 }
 
@@ -127,6 +143,31 @@ func (r *ReadDB) GetProjectByID(tx *db.Tx, projectID string) (*types.Project, er
 	return projects[0], nil
 }
 
+// GetProjectByAPIKeyHash returns the project owning the api key with the
+// provided hash
+func (r *ReadDB) GetProjectByAPIKeyHash(tx *db.Tx, keyHash string) (*types.Project, error) {
+	s := projectSelect
+	s = s.Join("project_apikey on project_apikey.projectid = project.id")
+	s = s.Where(sq.Eq{"project_apikey.keyhash": keyHash})
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	projects, _, err := fetchProjects(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(projects) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(projects) == 0 {
+		return nil, nil
+	}
+	return projects[0], nil
+}
+
 func (r *ReadDB) GetProjectByName(tx *db.Tx, parentID, name string) (*types.Project, error) {
 	q, args, err := projectSelect.Where(sq.Eq{"parentid": parentID, "name": name}).ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
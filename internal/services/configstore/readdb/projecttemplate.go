@@ -0,0 +1,206 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/configstore/common"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/configstore/types"
+
+	sq "github.com/Masterminds/squirrel"
+	errors "golang.org/x/xerrors"
+)
+
+var (
+	projecttemplateSelect = sb.Select("id", "data").From("projecttemplate")
+	projecttemplateInsert = sb.Insert("projecttemplate").Columns("id", "name", "data")
+)
+
+func (r *ReadDB) insertProjectTemplate(tx *db.Tx, data []byte) error {
+	projectTemplate := types.ProjectTemplate{}
+	if err := json.Unmarshal(data, &projectTemplate); err != nil {
+		return errors.Errorf("failed to unmarshal projecttemplate: %w", err)
+	}
+	// poor man insert or update...
+	if err := r.deleteProjectTemplate(tx, projectTemplate.ID); err != nil {
+		return err
+	}
+	q, args, err := projecttemplateInsert.Values(projectTemplate.ID, projectTemplate.Name, data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return errors.Errorf("failed to insert projecttemplate: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReadDB) deleteProjectTemplate(tx *db.Tx, id string) error {
+	// poor man insert or update...
+	if _, err := tx.Exec("delete from projecttemplate where id = $1", id); err != nil {
+		return errors.Errorf("failed to delete projecttemplate: %w", err)
+	}
+	return nil
+}
+
+func (r *ReadDB) GetProjectTemplate(tx *db.Tx, projectTemplateRef string) (*types.ProjectTemplate, error) {
+	refType, err := common.ParseNameRef(projectTemplateRef)
+	if err != nil {
+		return nil, err
+	}
+
+	var projectTemplate *types.ProjectTemplate
+	switch refType {
+	case common.RefTypeID:
+		projectTemplate, err = r.GetProjectTemplateByID(tx, projectTemplateRef)
+	case common.RefTypeName:
+		projectTemplate, err = r.GetProjectTemplateByName(tx, projectTemplateRef)
+	}
+	return projectTemplate, err
+}
+
+func (r *ReadDB) GetProjectTemplateByID(tx *db.Tx, projectTemplateID string) (*types.ProjectTemplate, error) {
+	q, args, err := projecttemplateSelect.Where(sq.Eq{"id": projectTemplateID}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	projectTemplates, _, err := fetchProjectTemplates(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(projectTemplates) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(projectTemplates) == 0 {
+		return nil, nil
+	}
+	return projectTemplates[0], nil
+}
+
+func (r *ReadDB) GetProjectTemplateByName(tx *db.Tx, name string) (*types.ProjectTemplate, error) {
+	q, args, err := projecttemplateSelect.Where(sq.Eq{"name": name}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	projectTemplates, _, err := fetchProjectTemplates(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(projectTemplates) > 1 {
+		return nil, errors.Errorf("too many rows returned")
+	}
+	if len(projectTemplates) == 0 {
+		return nil, nil
+	}
+	return projectTemplates[0], nil
+}
+
+func getProjectTemplatesFilteredQuery(startProjectTemplateName string, limit int, asc bool) sq.SelectBuilder {
+	fields := []string{"id", "data"}
+
+	s := sb.Select(fields...).From("projecttemplate as projecttemplate")
+	if asc {
+		s = s.OrderBy("projecttemplate.name asc")
+	} else {
+		s = s.OrderBy("projecttemplate.name desc")
+	}
+	if startProjectTemplateName != "" {
+		if asc {
+			s = s.Where(sq.Gt{"projecttemplate.name": startProjectTemplateName})
+		} else {
+			s = s.Where(sq.Lt{"projecttemplate.name": startProjectTemplateName})
+		}
+	}
+	if limit > 0 {
+		s = s.Limit(uint64(limit))
+	}
+
+	return s
+}
+
+func (r *ReadDB) GetProjectTemplates(ctx context.Context, startProjectTemplateName string, limit int, asc bool) ([]*types.ProjectTemplate, error) {
+	var projectTemplates []*types.ProjectTemplate
+
+	s := getProjectTemplatesFilteredQuery(startProjectTemplateName, limit, asc)
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	err = r.rdb.Do(ctx, func(tx *db.Tx) error {
+		rows, err := tx.Query(q, args...)
+		if err != nil {
+			return err
+		}
+
+		projectTemplates, _, err = scanProjectTemplates(rows)
+		return err
+	})
+	return projectTemplates, err
+}
+
+func fetchProjectTemplates(tx *db.Tx, q string, args ...interface{}) ([]*types.ProjectTemplate, []string, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	return scanProjectTemplates(rows)
+}
+
+func scanProjectTemplate(rows *sql.Rows, additionalFields ...interface{}) (*types.ProjectTemplate, string, error) {
+	var id string
+	var data []byte
+	if err := rows.Scan(&id, &data); err != nil {
+		return nil, "", errors.Errorf("failed to scan rows: %w", err)
+	}
+	projectTemplate := types.ProjectTemplate{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &projectTemplate); err != nil {
+			return nil, "", errors.Errorf("failed to unmarshal projecttemplate: %w", err)
+		}
+	}
+
+	return &projectTemplate, id, nil
+}
+
+func scanProjectTemplates(rows *sql.Rows) ([]*types.ProjectTemplate, []string, error) {
+	projectTemplates := []*types.ProjectTemplate{}
+	ids := []string{}
+	for rows.Next() {
+		p, id, err := scanProjectTemplate(rows)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		projectTemplates = append(projectTemplates, p)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return projectTemplates, ids, nil
+}
@@ -59,6 +59,10 @@ type ReadDB struct {
 	ost     *objectstorage.ObjStorage
 	dm      *datamanager.DataManager
 
+	// sqlStorage reports that the readdb is the primary data store (sql
+	// storage) and it's not synced from the datamanager
+	sqlStorage bool
+
 	Initialized bool
 	initLock    sync.Mutex
 }
@@ -79,6 +83,29 @@ func NewReadDB(ctx context.Context, logger *zap.Logger, dataDir string, e *etcd.
 	return readDB, nil
 }
 
+// NewSQLReadDB creates a readdb used as the configstore primary data store
+// with the sql storage. Data is directly written to it (see WriteWal) instead
+// of being synced from the datamanager.
+func NewSQLReadDB(ctx context.Context, logger *zap.Logger, dbType db.Type, dbConnString string) (*ReadDB, error) {
+	rdb, err := db.NewDB(dbType, dbConnString)
+	if err != nil {
+		return nil, err
+	}
+
+	// populate readdb
+	if err := rdb.Create(ctx, Stmts); err != nil {
+		return nil, err
+	}
+
+	readDB := &ReadDB{
+		log:        logger.Sugar(),
+		rdb:        rdb,
+		sqlStorage: true,
+	}
+
+	return readDB, nil
+}
+
 func (r *ReadDB) SetInitialized(initialized bool) {
 	r.initLock.Lock()
 	r.Initialized = initialized
@@ -387,6 +414,14 @@ func (r *ReadDB) SyncRDB(ctx context.Context) error {
 }
 
 func (r *ReadDB) Run(ctx context.Context) error {
+	if r.sqlStorage {
+		// nothing to sync
+		r.SetInitialized(true)
+		<-ctx.Done()
+		r.log.Infof("readdb exiting")
+		return nil
+	}
+
 	if r.rdb != nil {
 		r.rdb.Close()
 	}
@@ -664,6 +699,14 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 			if err := r.insertVariable(tx, action.Data); err != nil {
 				return err
 			}
+		case types.ConfigTypeProjectTemplate:
+			if err := r.insertProjectTemplate(tx, action.Data); err != nil {
+				return err
+			}
+		case types.ConfigTypeAuditEvent:
+			if err := r.insertAuditEvent(tx, action.Data); err != nil {
+				return err
+			}
 		}
 
 	case datamanager.ActionTypeDelete:
@@ -708,6 +751,16 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 			if err := r.deleteVariable(tx, action.ID); err != nil {
 				return err
 			}
+		case types.ConfigTypeProjectTemplate:
+			r.log.Debugf("deleting project template with id: %s", action.ID)
+			if err := r.deleteProjectTemplate(tx, action.ID); err != nil {
+				return err
+			}
+		case types.ConfigTypeAuditEvent:
+			r.log.Debugf("deleting audit event with id: %s", action.ID)
+			if err := r.deleteAuditEvent(tx, action.ID); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -101,3 +101,37 @@ func (r *ReadDB) GetPath(tx *db.Tx, configType types.ConfigType, id string) (str
 
 	return p, nil
 }
+
+// GetGlobalVisibility returns the visibility of an object calculated from its
+// visibility and the one of its parents: it's private if any parent is private
+func (r *ReadDB) GetGlobalVisibility(tx *db.Tx, curVisibility types.Visibility, parent *types.Parent) (types.Visibility, error) {
+	curParent := parent
+	if curVisibility == types.VisibilityPrivate {
+		return curVisibility, nil
+	}
+
+	for curParent.Type == types.ConfigTypeProjectGroup {
+		projectGroup, err := r.GetProjectGroupByID(tx, curParent.ID)
+		if err != nil {
+			return "", err
+		}
+		if projectGroup.Visibility == types.VisibilityPrivate {
+			return types.VisibilityPrivate, nil
+		}
+
+		curParent = &projectGroup.Parent
+	}
+
+	// check parent visibility
+	if curParent.Type == types.ConfigTypeOrg {
+		org, err := r.GetOrg(tx, curParent.ID)
+		if err != nil {
+			return "", err
+		}
+		if org.Visibility == types.VisibilityPrivate {
+			return types.VisibilityPrivate, nil
+		}
+	}
+
+	return curVisibility, nil
+}
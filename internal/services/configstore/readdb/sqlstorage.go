@@ -0,0 +1,212 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/services/configstore/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// sqlStorageDataTypes are the data types exported by the sql storage. They are
+// in the same order used by the configstore datamanager.
+var sqlStorageDataTypes = []types.ConfigType{
+	types.ConfigTypeUser,
+	types.ConfigTypeOrg,
+	types.ConfigTypeOrgMember,
+	types.ConfigTypeProjectGroup,
+	types.ConfigTypeProject,
+	types.ConfigTypeRemoteSource,
+	types.ConfigTypeSecret,
+	types.ConfigTypeVariable,
+	types.ConfigTypeProjectTemplate,
+	types.ConfigTypeAuditEvent,
+}
+
+// sqlStorageTables are all the tables containing data, in an order that
+// respects the foreign keys when deleting their contents
+var sqlStorageTables = []string{
+	"linkedaccount_user",
+	"linkedaccount_project",
+	"user_token",
+	"user",
+	"org",
+	"orgmember",
+	"projectgroup",
+	"project_apikey",
+	"project",
+	"remotesource",
+	"secret",
+	"variable",
+	"projecttemplate",
+	"auditevent",
+	"changegrouprevision",
+	"revision",
+}
+
+// WriteWal writes the actions directly to the db in a single transaction. It's
+// used with the sql storage in place of the datamanager WriteWal and provides
+// the same change groups optimistic locking: if a change group has been
+// updated after the provided change groups update token was generated it'll
+// return a datamanager.ErrConcurrency.
+func (r *ReadDB) WriteWal(ctx context.Context, actions []*datamanager.Action, cgt *datamanager.ChangeGroupsUpdateToken) (*datamanager.ChangeGroupsUpdateToken, error) {
+	if !r.sqlStorage {
+		return nil, errors.Errorf("readdb is not using the sql storage")
+	}
+	if len(actions) == 0 {
+		return nil, errors.Errorf("cannot write wal: actions is empty")
+	}
+
+	var ncgt *datamanager.ChangeGroupsUpdateToken
+	err := r.rdb.Do(ctx, func(tx *db.Tx) error {
+		revision, err := r.getRevision(tx)
+		if err != nil {
+			return err
+		}
+		newRevision := revision + 1
+
+		ncgt = &datamanager.ChangeGroupsUpdateToken{CurRevision: newRevision, ChangeGroupsRevisions: map[string]int64{}}
+
+		if cgt != nil {
+			cgNames := []string{}
+			for cgName := range cgt.ChangeGroupsRevisions {
+				cgNames = append(cgNames, cgName)
+			}
+			curcgt, err := r.GetChangeGroupsUpdateTokens(tx, cgNames)
+			if err != nil {
+				return err
+			}
+			for cgName, cgRev := range cgt.ChangeGroupsRevisions {
+				if curcgt.ChangeGroupsRevisions[cgName] != cgRev {
+					return datamanager.ErrConcurrency
+				}
+				if err := r.insertChangeGroupRevision(tx, cgName, newRevision); err != nil {
+					return err
+				}
+				ncgt.ChangeGroupsRevisions[cgName] = newRevision
+			}
+		}
+
+		for _, action := range actions {
+			if err := r.applyAction(tx, action); err != nil {
+				return err
+			}
+		}
+
+		// every write updates the revision so concurrent writes will conflict
+		// and only one of them will be committed
+		return r.insertRevision(tx, newRevision)
+	})
+	if err != nil {
+		if db.IsConcurrentUpdateError(err) {
+			return nil, datamanager.ErrConcurrency
+		}
+		return nil, err
+	}
+
+	return ncgt, nil
+}
+
+// Export exports all the data using the same format of the datamanager export
+func (r *ReadDB) Export(ctx context.Context, w io.Writer) error {
+	if !r.sqlStorage {
+		return errors.Errorf("readdb is not using the sql storage")
+	}
+
+	return r.rdb.Do(ctx, func(tx *db.Tx) error {
+		enc := json.NewEncoder(w)
+		for _, dataType := range sqlStorageDataTypes {
+			q, args, err := sb.Select("id", "data").From(string(dataType)).OrderBy("id").ToSql()
+			if err != nil {
+				return errors.Errorf("failed to build query: %w", err)
+			}
+			rows, err := tx.Query(q, args...)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var id string
+				var data []byte
+				if err := rows.Scan(&id, &data); err != nil {
+					rows.Close()
+					return errors.Errorf("failed to scan rows: %w", err)
+				}
+				de := &datamanager.DataEntry{
+					ID:       id,
+					DataType: string(dataType),
+					Data:     data,
+				}
+				if err := enc.Encode(de); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			if err := rows.Err(); err != nil {
+				rows.Close()
+				return err
+			}
+			rows.Close()
+		}
+		return nil
+	})
+}
+
+// Import replaces all the current data with the imported one. The import
+// format is the same of the datamanager export so it can be used to migrate
+// the data from the etcd storage to the sql storage.
+func (r *ReadDB) Import(ctx context.Context, rd io.Reader) error {
+	if !r.sqlStorage {
+		return errors.Errorf("readdb is not using the sql storage")
+	}
+
+	return r.rdb.Do(ctx, func(tx *db.Tx) error {
+		for _, table := range sqlStorageTables {
+			if _, err := tx.Exec("delete from " + table); err != nil {
+				return errors.Errorf("failed to delete table %q contents: %w", table, err)
+			}
+		}
+
+		dec := json.NewDecoder(rd)
+		for {
+			var de *datamanager.DataEntry
+
+			err := dec.Decode(&de)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return errors.Errorf("failed to decode import data: %w", err)
+			}
+
+			action := &datamanager.Action{
+				ActionType: datamanager.ActionTypePut,
+				DataType:   de.DataType,
+				ID:         de.ID,
+				Data:       de.Data,
+			}
+			if err := r.applyAction(tx, action); err != nil {
+				return err
+			}
+		}
+
+		return r.insertRevision(tx, 1)
+	})
+}
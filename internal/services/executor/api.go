@@ -96,22 +96,34 @@ func (h *logsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		follow = true
 	}
 
-	if err := h.readTaskLogs(taskID, setup, step, w, follow); err != nil {
+	var offset int64
+	if offsetStr := q.Get("offset"); offsetStr != "" {
+		var err error
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.readTaskLogs(taskID, setup, step, w, follow, offset); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
 
-func (h *logsHandler) readTaskLogs(taskID string, setup bool, step int, w http.ResponseWriter, follow bool) error {
+func (h *logsHandler) readTaskLogs(taskID string, setup bool, step int, w http.ResponseWriter, follow bool, offset int64) error {
 	var logPath string
 	if setup {
 		logPath = h.e.setupLogPath(taskID)
 	} else {
 		logPath = h.e.stepLogPath(taskID, step)
 	}
-	return h.readLogs(taskID, setup, step, logPath, w, follow)
+	return h.readLogs(taskID, setup, step, logPath, w, follow, offset)
 }
 
-func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath string, w http.ResponseWriter, follow bool) error {
+// readLogs sends the log starting from offset. An offset after the current end
+// of the log sends no data (or waits for new data when following).
+func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath string, w http.ResponseWriter, follow bool, offset int64) error {
 	f, err := os.Open(logPath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -123,6 +135,13 @@ func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath stri
 	}
 	defer f.Close()
 
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			return errors.Errorf("failed to seek in log file %q: %w", logPath, err)
+		}
+	}
+
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
@@ -134,7 +153,11 @@ func (h *logsHandler) readLogs(taskID string, setup bool, step int, logPath stri
 		if err != nil {
 			return err
 		}
-		w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		size := fi.Size() - offset
+		if size < 0 {
+			size = 0
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 	}
 
 	// write and flush the headers so the client will receive the response
@@ -249,3 +272,33 @@ func (h *archivesHandler) readArchive(taskID string, step int, w http.ResponseWr
 	_, err = io.Copy(w, br)
 	return err
 }
+
+type drainHandler struct {
+	log *zap.SugaredLogger
+	e   *Executor
+}
+
+func NewDrainHandler(logger *zap.Logger, e *Executor) *drainHandler {
+	return &drainHandler{
+		log: logger.Sugar(),
+		e:   e,
+	}
+}
+
+func (h *drainHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "PUT":
+		_, exit := r.URL.Query()["exit"]
+		h.e.setDraining(true, exit)
+		h.log.Infof("executor draining, exit when drained: %t", exit)
+	case "DELETE":
+		h.e.setDraining(false, false)
+		h.log.Infof("executor undrained")
+	}
+
+	// report the draining status now so the scheduler stops assigning tasks
+	// to the executor without waiting for the next status update
+	if err := h.e.sendExecutorStatus(r.Context()); err != nil {
+		h.log.Errorf("failed to send executor status: %+v", err)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"agola.io/agola/internal/services/executor/driver"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// pidFilesContainerDir is the main container dir containing the pid files
+	// of the background steps commands
+	pidFilesContainerDir = "/tmp"
+
+	// backgroundStepKillGracePeriod is the time to wait for a background step
+	// command to exit after being killed
+	backgroundStepKillGracePeriod = 10 * time.Second
+	// backgroundStepExitTimeout is the time to wait for a stopped background
+	// step to be reported as exited. The exec could be kept open by processes
+	// detached from the step process group.
+	backgroundStepExitTimeout = 30 * time.Second
+)
+
+// backgroundStep is a run step whose command is executed in background
+type backgroundStep struct {
+	index int
+	name  string
+
+	// done is closed when the step command exits
+	done     chan struct{}
+	exitCode int
+	err      error
+
+	// stopped reports that the step has been stopped by the executor. It's
+	// protected by the running task lock.
+	stopped bool
+}
+
+// backgroundStepPidPath returns the path of the file where the toolbox writes
+// the pid of a background step command. It contains the task id since a batch
+// pod executes multiple tasks.
+func backgroundStepPidPath(t *types.ExecutorTask, stepIndex int) string {
+	return path.Join(pidFilesContainerDir, fmt.Sprintf("agola-background-%s-%d.pid", t.ID, stepIndex))
+}
+
+// exited reports if the background step command exited
+func (bs *backgroundStep) exited() bool {
+	select {
+	case <-bs.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// failErr returns the error of a background step that failed. A stopped step,
+// or a step still running, isn't considered failed.
+func (bs *backgroundStep) failErr() error {
+	if !bs.exited() || bs.stopped {
+		return nil
+	}
+	if bs.err != nil {
+		return errors.Errorf("failed to execute background step %q: %w", bs.name, bs.err)
+	}
+	if bs.exitCode != 0 {
+		return errors.Errorf("background step %q failed with exitcode %d", bs.name, bs.exitCode)
+	}
+	return nil
+}
+
+// startBackgroundStep executes the run step command without waiting for it to
+// exit. The step status is updated when the command exits.
+func (e *Executor) startBackgroundStep(ctx context.Context, rt *runningTask, pod driver.Pod, s *types.RunStep, stepIndex int) *backgroundStep {
+	bs := &backgroundStep{
+		index: stepIndex,
+		name:  s.Name,
+		done:  make(chan struct{}),
+	}
+
+	go func() {
+		defer close(bs.done)
+
+		bs.exitCode, bs.err = e.doRunStep(ctx, s, rt.et, pod, stepIndex, e.stepLogPath(rt.et.ID, stepIndex))
+
+		rt.Lock()
+		defer rt.Unlock()
+
+		step := rt.et.Status.Steps[stepIndex]
+		step.EndTime = util.TimeP(time.Now())
+		switch {
+		case bs.stopped || rt.et.Spec.Stop:
+			step.Phase = types.ExecutorTaskPhaseStopped
+		case bs.err != nil || bs.exitCode != 0:
+			step.Phase = types.ExecutorTaskPhaseFailed
+		default:
+			step.Phase = types.ExecutorTaskPhaseSuccess
+		}
+		if bs.err == nil {
+			step.ExitStatus = util.IntP(bs.exitCode)
+		}
+
+		if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+	}()
+
+	return bs
+}
+
+// stopBackgroundStep stops the background step command, and its childs, with
+// the task stop signal, killing them if they don't exit before the task stop
+// grace period
+func (e *Executor) stopBackgroundStep(rt *runningTask, pod driver.Pod, bs *backgroundStep) {
+	if bs.exited() {
+		return
+	}
+
+	rt.Lock()
+	bs.stopped = true
+	rt.Unlock()
+
+	pidFile := backgroundStepPidPath(rt.et, bs.index)
+	signal, gracePeriod := taskStopSignal(rt.et)
+	exited, err := e.signalProcesses(rt.et, pod, signal, gracePeriod, pidFile)
+	if err != nil {
+		log.Errorf("failed to signal task %s background step %q: %+v", rt.et.ID, bs.name, err)
+	}
+	if !exited {
+		if _, err := e.signalProcesses(rt.et, pod, "SIGKILL", backgroundStepKillGracePeriod, pidFile); err != nil {
+			log.Errorf("failed to kill task %s background step %q: %+v", rt.et.ID, bs.name, err)
+		}
+	}
+
+	select {
+	case <-bs.done:
+	case <-time.After(backgroundStepExitTimeout):
+		log.Warnf("task %s background step %q didn't exit after being stopped", rt.et.ID, bs.name)
+	}
+}
+
+// stopBackgroundSteps stops all the background steps still running
+func (e *Executor) stopBackgroundSteps(rt *runningTask, pod driver.Pod, backgroundSteps []*backgroundStep) {
+	for _, bs := range backgroundSteps {
+		e.stopBackgroundStep(rt, pod, bs)
+	}
+}
+
+// doWaitBackgroundStep waits for the background steps to exit, or stops them,
+// and fails if one of them failed
+func (e *Executor) doWaitBackgroundStep(ctx context.Context, s *types.WaitBackgroundStep, rt *runningTask, pod driver.Pod, backgroundSteps []*backgroundStep, logPath string) (int, error) {
+	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
+		return -1, err
+	}
+	logf, err := os.Create(logPath)
+	if err != nil {
+		return -1, err
+	}
+	defer logf.Close()
+
+	steps := backgroundSteps
+	if len(s.Steps) > 0 {
+		steps = []*backgroundStep{}
+		for _, name := range s.Steps {
+			found := false
+			for _, bs := range backgroundSteps {
+				if bs.name == name {
+					steps = append(steps, bs)
+					found = true
+				}
+			}
+			// the step could have been skipped or not executed since a
+			// previous step failed
+			if !found {
+				_, _ = logf.WriteString(fmt.Sprintf("background step %q wasn't started\n", name))
+			}
+		}
+	}
+
+	for _, bs := range steps {
+		if s.Stop {
+			_, _ = logf.WriteString(fmt.Sprintf("stopping background step %q\n", bs.name))
+			e.stopBackgroundStep(rt, pod, bs)
+			continue
+		}
+
+		_, _ = logf.WriteString(fmt.Sprintf("waiting for background step %q to exit\n", bs.name))
+		select {
+		case <-bs.done:
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+
+	exitCode := 0
+	for _, bs := range steps {
+		if err := bs.failErr(); err != nil {
+			_, _ = logf.WriteString(fmt.Sprintf("%v\n", err))
+			exitCode = 1
+		}
+	}
+
+	return exitCode, nil
+}
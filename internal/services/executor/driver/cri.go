@@ -0,0 +1,1171 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/executor/registry"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/types"
+	errors "golang.org/x/xerrors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+	utilexec "k8s.io/utils/exec"
+)
+
+const (
+	defaultCRIEndpoint = "unix:///run/containerd/containerd.sock"
+
+	// criPodNamespace is the namespace of the pod sandboxes metadata
+	criPodNamespace = "agola"
+
+	// criInitVolumeDirKey is the pod sandbox annotation containing the pod
+	// init volume dir, required to execute the toolbox in the pods returned
+	// by GetPods
+	criInitVolumeDirKey = labelPrefix + "initvolumedir"
+
+	// criTaskIDFile is the file, inside a pod dir, containing the pod task id
+	criTaskIDFile = "taskid"
+
+	criConnectionTimeout = 10 * time.Second
+	// criStopTimeout is the time, in seconds, given to the pod containers to
+	// stop before being killed
+	criStopTimeout = 1
+	// criStatsInterval is the interval between the two container stats used
+	// to calculate the cpu usage
+	criStatsInterval = 1 * time.Second
+)
+
+// CRIDriver manages the pods using a CRI (kubernetes Container Runtime
+// Interface) compatible container runtime, like containerd, without a
+// docker daemon or a kubernetes api server. A pod is a CRI pod sandbox.
+//
+// The pods volumes are directories on the executor host bind mounted in the
+// containers, so the executor must run on the same host of the container
+// runtime.
+type CRIDriver struct {
+	log                *zap.SugaredLogger
+	runtimeClient      runtimeapi.RuntimeServiceClient
+	imageClient        runtimeapi.ImageServiceClient
+	toolboxPath        string
+	podsDir            string
+	networkPolicyImage string
+	executorID         string
+	arch               types.Arch
+}
+
+func NewCRIDriver(logger *zap.Logger, executorID, toolboxPath, dataDir, endpoint, networkPolicyImage string) (*CRIDriver, error) {
+	if endpoint == "" {
+		endpoint = defaultCRIEndpoint
+	}
+	addr, err := criEndpointAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// the connection is established lazily
+	conn, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", addr, timeout)
+	}))
+	if err != nil {
+		return nil, errors.Errorf("failed to connect to cri endpoint %q: %w", endpoint, err)
+	}
+
+	if networkPolicyImage == "" {
+		networkPolicyImage = defaultNetworkPolicyImage
+	}
+
+	return &CRIDriver{
+		log:                logger.Sugar(),
+		runtimeClient:      runtimeapi.NewRuntimeServiceClient(conn),
+		imageClient:        runtimeapi.NewImageServiceClient(conn),
+		toolboxPath:        toolboxPath,
+		podsDir:            filepath.Join(dataDir, "pods"),
+		networkPolicyImage: networkPolicyImage,
+		executorID:         executorID,
+		arch:               types.ArchFromString(runtime.GOARCH),
+	}, nil
+}
+
+// criEndpointAddress returns the socket path of a cri endpoint in the format
+// unix:///path/to/socket
+func criEndpointAddress(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Errorf("invalid cri endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "unix" || u.Path == "" {
+		return "", errors.Errorf("unsupported cri endpoint %q, only unix sockets are supported", endpoint)
+	}
+	return u.Path, nil
+}
+
+func (d *CRIDriver) Setup(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, criConnectionTimeout)
+	defer cancel()
+
+	version, err := d.runtimeClient.Version(ctx, &runtimeapi.VersionRequest{})
+	if err != nil {
+		return errors.Errorf("failed to get cri runtime version: %w", err)
+	}
+	d.log.Infof("using container runtime %s %s", version.RuntimeName, version.RuntimeVersion)
+
+	return os.MkdirAll(d.podsDir, 0700)
+}
+
+func (d *CRIDriver) OS(ctx context.Context) (types.OS, error) {
+	return types.OSLinux, nil
+}
+
+func (d *CRIDriver) Archs(ctx context.Context) ([]types.Arch, error) {
+	// the container runtime is on the executor host
+	return []types.Arch{d.arch}, nil
+}
+
+func (d *CRIDriver) ExecutorGroup(ctx context.Context) (string, error) {
+	// use the same group as the executor id
+	return d.executorID, nil
+}
+
+func (d *CRIDriver) GetExecutors(ctx context.Context) ([]string, error) {
+	return []string{d.executorID}, nil
+}
+
+func (d *CRIDriver) podDir(podID string) string {
+	return filepath.Join(d.podsDir, podID)
+}
+
+func (d *CRIDriver) podLabels(podConfig *PodConfig) map[string]string {
+	return map[string]string{
+		agolaLabelKey: agolaLabelValue,
+		executorIDKey: d.executorID,
+		podIDKey:      podConfig.ID,
+		taskIDKey:     podConfig.TaskID,
+	}
+}
+
+func (d *CRIDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Writer) (Pod, error) {
+	if len(podConfig.Containers) == 0 {
+		return nil, errors.Errorf("empty container config")
+	}
+
+	if types.OSOrDefault(podConfig.OS) != types.OSLinux {
+		return nil, errors.Errorf("pod os %q isn't supported by the cri driver", podConfig.OS)
+	}
+	if podConfig.GPUs != nil {
+		return nil, errors.Errorf("gpus aren't supported by the cri driver")
+	}
+	if podConfig.Limits != nil && podConfig.Limits.Pids > 0 {
+		return nil, errors.Errorf("pids limit isn't supported by the cri driver")
+	}
+	if err := checkIptablesNetworkPolicy(podConfig); err != nil {
+		return nil, err
+	}
+	privileged := podConfig.DockerDaemon != nil
+	for _, containers := range [][]*ContainerConfig{podConfig.Containers, podConfig.InitContainers} {
+		for _, c := range containers {
+			if c.ShmSize > 0 {
+				return nil, errors.Errorf("shm size isn't supported by the cri driver")
+			}
+			if c.Privileged {
+				privileged = true
+			}
+		}
+	}
+
+	podDir := d.podDir(podConfig.ID)
+	toolboxDir := filepath.Join(podDir, "toolbox")
+	logsDir := filepath.Join(podDir, "logs")
+	for _, dir := range []string{toolboxDir, logsDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(podDir, criTaskIDFile), []byte(podConfig.TaskID), 0600); err != nil {
+		return nil, err
+	}
+	if err := d.copyToolbox(toolboxDir); err != nil {
+		return nil, err
+	}
+	var sharedDir string
+	if len(podConfig.InitContainers) > 0 {
+		sharedDir = filepath.Join(podDir, "shared")
+		if err := os.MkdirAll(sharedDir, 0700); err != nil {
+			return nil, err
+		}
+		// the init containers and the main container could be executed with
+		// different users
+		if err := os.Chmod(sharedDir, 0777); err != nil {
+			return nil, err
+		}
+	}
+
+	// privileged containers are allowed only in a privileged sandbox
+	sandboxConfig := &runtimeapi.PodSandboxConfig{
+		Metadata: &runtimeapi.PodSandboxMetadata{
+			Name:      "agola-" + podConfig.ID,
+			Uid:       podConfig.ID,
+			Namespace: criPodNamespace,
+		},
+		Hostname:     podConfig.ID,
+		LogDirectory: logsDir,
+		Labels:       d.podLabels(podConfig),
+		Annotations:  map[string]string{criInitVolumeDirKey: podConfig.InitVolumeDir},
+		Linux: &runtimeapi.LinuxPodSandboxConfig{
+			SecurityContext: &runtimeapi.LinuxSandboxSecurityContext{
+				Privileged: privileged,
+			},
+		},
+	}
+	sandboxResp, err := d.runtimeClient.RunPodSandbox(ctx, &runtimeapi.RunPodSandboxRequest{Config: sandboxConfig})
+	if err != nil {
+		return nil, errors.Errorf("failed to create pod sandbox: %w", err)
+	}
+	sandboxID := sandboxResp.PodSandboxId
+
+	var ulimits []Ulimit
+	if podConfig.Limits != nil {
+		ulimits = podConfig.Limits.Ulimits
+	}
+	pod := &CRIPod{
+		id:            podConfig.ID,
+		sandboxID:     sandboxID,
+		executorID:    d.executorID,
+		taskID:        podConfig.TaskID,
+		containers:    []*CRIContainer{},
+		podDir:        podDir,
+		initVolumeDir: podConfig.InitVolumeDir,
+		ulimits:       ulimits,
+		runtimeClient: d.runtimeClient,
+	}
+
+	for cindex := range podConfig.Containers {
+		containerID, imagePullStats, err := d.createContainer(ctx, cindex, podConfig, sandboxID, sandboxConfig, toolboxDir, sharedDir, out)
+		if err != nil {
+			return nil, err
+		}
+		// keep the main container image pull stats
+		if cindex == 0 {
+			pod.imagePullStats = imagePullStats
+		}
+
+		if _, err := d.runtimeClient.StartContainer(ctx, &runtimeapi.StartContainerRequest{ContainerId: containerID}); err != nil {
+			return nil, err
+		}
+		pod.containers = append(pod.containers, &CRIContainer{Index: cindex, ID: containerID})
+
+		// apply the network policy to the pod network namespace before
+		// starting the other containers
+		if cindex == 0 && podConfig.NetworkPolicy != nil {
+			if err := d.applyNetworkPolicy(ctx, podConfig.NetworkPolicy, sandboxID, sandboxConfig, logsDir, out); err != nil {
+				return nil, errors.Errorf("failed to apply network policy %q: %w", podConfig.NetworkPolicy.Name, err)
+			}
+		}
+	}
+
+	if podConfig.DockerDaemon != nil {
+		index := len(podConfig.Containers)
+		containerID, err := d.startDockerDaemon(ctx, index, podConfig, sandboxID, sandboxConfig, podDir, out)
+		if err != nil {
+			return nil, errors.Errorf("failed to start docker daemon: %w", err)
+		}
+		pod.containers = append(pod.containers, &CRIContainer{Index: index, ID: containerID})
+		if err := d.waitDockerDaemon(ctx, containerID); err != nil {
+			return nil, err
+		}
+		_, _ = fmt.Fprintf(out, "Docker daemon ready\n")
+	}
+
+	// the main container is only running the toolbox sleeper, so the init
+	// containers are executed before anything is executed in the pod
+	for cindex := range podConfig.InitContainers {
+		if err := d.runInitContainer(ctx, cindex, podConfig, sandboxID, sandboxConfig, sharedDir, logsDir, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return pod, nil
+}
+
+// copyToolbox copies the toolbox executable in the pod toolbox dir, mounted in
+// the main container at the pod init volume dir
+func (d *CRIDriver) copyToolbox(toolboxDir string) error {
+	toolboxExecPath, err := toolboxExecPath(d.toolboxPath, types.OSLinux, d.arch)
+	if err != nil {
+		return errors.Errorf("failed to get toolbox path for os %q, arch %q: %w", types.OSLinux, d.arch, err)
+	}
+	src, err := os.Open(toolboxExecPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(filepath.Join(toolboxDir, toolboxPrefix), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+func (d *CRIDriver) fetchImage(ctx context.Context, image string, registryConfig *registry.DockerConfig, sandboxConfig *runtimeapi.PodSandboxConfig, out io.Writer) (*ImagePullStats, error) {
+	regName, err := registry.GetRegistry(image)
+	if err != nil {
+		return nil, err
+	}
+	var auth *runtimeapi.AuthConfig
+	if registryConfig != nil {
+		if regauth, ok := registryConfig.Auths[regName]; ok {
+			auth = &runtimeapi.AuthConfig{
+				Username:      regauth.Username,
+				Password:      regauth.Password,
+				Auth:          regauth.Auth,
+				ServerAddress: regName,
+			}
+		}
+	}
+
+	prevImage, err := d.imageStatus(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+
+	// like the docker driver always pull the image so we are sure only
+	// authorized users can fetch it, retrying only the transient errors
+	_, _ = fmt.Fprintf(out, "Pulling image %q\n", image)
+	var pullErr error
+	err = util.ExponentialBackoff(ctx, imagePullBackoff, func() (bool, error) {
+		_, pullErr = d.imageClient.PullImage(ctx, &runtimeapi.PullImageRequest{
+			Image:         &runtimeapi.ImageSpec{Image: image},
+			Auth:          auth,
+			SandboxConfig: sandboxConfig,
+		})
+		if pullErr == nil {
+			return true, nil
+		}
+		if isPermanentImagePullError(pullErr) {
+			return false, &ImagePullError{Image: image, Permanent: true, Err: pullErr}
+		}
+		_, _ = fmt.Fprintf(out, "Failed to pull image %q, retrying. Error: %s\n", image, pullErr)
+		return false, nil
+	})
+	if err != nil {
+		if errors.Is(err, util.ErrWaitTimeout) {
+			return nil, &ImagePullError{Image: image, Err: pullErr}
+		}
+		return nil, err
+	}
+
+	curImage, err := d.imageStatus(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	if curImage == nil {
+		return nil, errors.Errorf("image %q doesn't exist after being pulled", image)
+	}
+
+	stats := criImagePullStats(prevImage, curImage)
+	stats.Image = image
+	stats.Duration = time.Since(start)
+	_, _ = fmt.Fprintf(out, "Pulled image %q\n", image)
+
+	return stats, nil
+}
+
+// imageStatus returns the image or nil if it doesn't exist
+func (d *CRIDriver) imageStatus(ctx context.Context, image string) (*runtimeapi.Image, error) {
+	resp, err := d.imageClient.ImageStatus(ctx, &runtimeapi.ImageStatusRequest{Image: &runtimeapi.ImageSpec{Image: image}})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Image, nil
+}
+
+// criImagePullStats returns the image pull stats from the image before and
+// after the pull. The CRI api doesn't report the pulled layers, so the pull is
+// a cache hit when the image didn't change and the pulled bytes are the whole
+// image size otherwise.
+func criImagePullStats(prevImage, curImage *runtimeapi.Image) *ImagePullStats {
+	stats := &ImagePullStats{
+		CacheHit: prevImage != nil && prevImage.Id == curImage.Id,
+	}
+	if !stats.CacheHit {
+		stats.PulledBytes = int64(curImage.Size_)
+	}
+	for _, repoDigest := range curImage.RepoDigests {
+		if i := strings.LastIndex(repoDigest, "@"); i >= 0 {
+			stats.Digest = repoDigest[i+1:]
+			break
+		}
+	}
+	return stats
+}
+
+func (d *CRIDriver) createContainer(ctx context.Context, index int, podConfig *PodConfig, sandboxID string, sandboxConfig *runtimeapi.PodSandboxConfig, toolboxDir, sharedDir string, out io.Writer) (string, *ImagePullStats, error) {
+	containerConfig := podConfig.Containers[index]
+
+	imagePullStats, err := d.fetchImage(ctx, containerConfig.Image, podConfig.DockerConfig, sandboxConfig, out)
+	if err != nil {
+		return "", nil, err
+	}
+
+	labels := d.podLabels(podConfig)
+	labels[containerIndexKey] = strconv.Itoa(index)
+
+	securityContext, err := criSecurityContext(podConfig.SecurityProfile, containerConfig.Privileged, "")
+	if err != nil {
+		return "", nil, errors.Errorf("failed to apply security profile %q: %w", podConfig.SecurityProfile.Name, err)
+	}
+
+	mounts, err := criMounts(containerConfig.Volumes)
+	if err != nil {
+		return "", nil, err
+	}
+	if index == 0 {
+		// main container requires the initvolume containing the toolbox
+		mounts = append(mounts, &runtimeapi.Mount{ContainerPath: podConfig.InitVolumeDir, HostPath: toolboxDir, Readonly: true})
+		if sharedDir != "" {
+			mounts = append(mounts, &runtimeapi.Mount{ContainerPath: podConfig.SharedVolumeDir, HostPath: sharedDir})
+		}
+	}
+
+	name := fmt.Sprintf("container%d", index)
+	resp, err := d.runtimeClient.CreateContainer(ctx, &runtimeapi.CreateContainerRequest{
+		PodSandboxId: sandboxID,
+		Config: &runtimeapi.ContainerConfig{
+			Metadata:   &runtimeapi.ContainerMetadata{Name: name},
+			Image:      &runtimeapi.ImageSpec{Image: containerConfig.Image},
+			Command:    containerConfig.Cmd,
+			WorkingDir: containerConfig.WorkingDir,
+			Envs:       criEnvs(containerConfig.Env),
+			Mounts:     mounts,
+			Labels:     labels,
+			LogPath:    name + ".log",
+			Tty:        true,
+			Linux:      &runtimeapi.LinuxContainerConfig{SecurityContext: securityContext},
+		},
+		SandboxConfig: sandboxConfig,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return resp.ContainerId, imagePullStats, nil
+}
+
+// runInitContainer executes the pod init container with the provided index and
+// waits for it to finish, writing its output to out. It returns an error if the
+// init container exits with a non zero code.
+func (d *CRIDriver) runInitContainer(ctx context.Context, index int, podConfig *PodConfig, sandboxID string, sandboxConfig *runtimeapi.PodSandboxConfig, sharedDir, logsDir string, out io.Writer) error {
+	containerConfig := podConfig.InitContainers[index]
+
+	if _, err := d.fetchImage(ctx, containerConfig.Image, podConfig.DockerConfig, sandboxConfig, out); err != nil {
+		return err
+	}
+
+	// the init containers don't have the container index label since they
+	// aren't part of the running pod
+	labels := d.podLabels(podConfig)
+	labels[initContainerKey] = strconv.Itoa(index)
+
+	securityContext, err := criSecurityContext(podConfig.SecurityProfile, containerConfig.Privileged, containerConfig.User)
+	if err != nil {
+		return errors.Errorf("failed to apply security profile %q: %w", podConfig.SecurityProfile.Name, err)
+	}
+
+	mounts, err := criMounts(containerConfig.Volumes)
+	if err != nil {
+		return err
+	}
+	mounts = append(mounts, &runtimeapi.Mount{ContainerPath: podConfig.SharedVolumeDir, HostPath: sharedDir})
+
+	name := fmt.Sprintf("init%d", index)
+	_, _ = fmt.Fprintf(out, "Executing init container %d (image %q)\n", index, containerConfig.Image)
+	exitCode, err := d.runContainer(ctx, sandboxID, sandboxConfig, &runtimeapi.ContainerConfig{
+		Metadata:   &runtimeapi.ContainerMetadata{Name: name},
+		Image:      &runtimeapi.ImageSpec{Image: containerConfig.Image},
+		Command:    containerConfig.Cmd,
+		WorkingDir: containerConfig.WorkingDir,
+		Envs:       criEnvs(containerConfig.Env),
+		Mounts:     mounts,
+		Labels:     labels,
+		LogPath:    name + ".log",
+		Linux:      &runtimeapi.LinuxContainerConfig{SecurityContext: securityContext},
+	}, logsDir, out)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return errors.Errorf("init container %d (image %q) exited with code %d", index, containerConfig.Image, exitCode)
+	}
+
+	return nil
+}
+
+// runContainer creates and starts a container in the pod sandbox, waits for it
+// to exit and removes it. The container output is written to out.
+func (d *CRIDriver) runContainer(ctx context.Context, sandboxID string, sandboxConfig *runtimeapi.PodSandboxConfig, containerConfig *runtimeapi.ContainerConfig, logsDir string, out io.Writer) (int32, error) {
+	resp, err := d.runtimeClient.CreateContainer(ctx, &runtimeapi.CreateContainerRequest{
+		PodSandboxId:  sandboxID,
+		Config:        containerConfig,
+		SandboxConfig: sandboxConfig,
+	})
+	if err != nil {
+		return 0, err
+	}
+	containerID := resp.ContainerId
+	// ignore remove error
+	defer func() {
+		_, _ = d.runtimeClient.RemoveContainer(ctx, &runtimeapi.RemoveContainerRequest{ContainerId: containerID})
+	}()
+
+	if _, err := d.runtimeClient.StartContainer(ctx, &runtimeapi.StartContainerRequest{ContainerId: containerID}); err != nil {
+		return 0, err
+	}
+
+	exitCode, err := d.waitContainer(ctx, containerID)
+	if err != nil {
+		return 0, err
+	}
+
+	logPath := filepath.Join(logsDir, containerConfig.LogPath)
+	if f, err := os.Open(logPath); err == nil {
+		_ = copyCRILog(out, f)
+		f.Close()
+	}
+	_ = os.Remove(logPath)
+
+	return exitCode, nil
+}
+
+// waitContainer waits for the container to exit and returns its exit code
+func (d *CRIDriver) waitContainer(ctx context.Context, containerID string) (int32, error) {
+	for {
+		resp, err := d.runtimeClient.ContainerStatus(ctx, &runtimeapi.ContainerStatusRequest{ContainerId: containerID})
+		if err != nil {
+			return 0, err
+		}
+		if resp.Status.State == runtimeapi.ContainerState_CONTAINER_EXITED {
+			return resp.Status.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// copyCRILog copies to w the content of a container log in the CRI logging
+// format: "<timestamp> <stream> <tag> <content>" where the tag "P" reports a
+// partial line
+func copyCRILog(w io.Writer, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), " ", 4)
+		if len(fields) < 3 {
+			continue
+		}
+		var content string
+		if len(fields) == 4 {
+			content = fields[3]
+		}
+		if strings.Split(fields[2], ":")[0] != "P" {
+			content += "\n"
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// startDockerDaemon starts the pod docker daemon container, with the provided
+// container index, in the pod sandbox. Its storage is a pod dir so it's
+// removed with the pod (cached storages aren't supported).
+func (d *CRIDriver) startDockerDaemon(ctx context.Context, index int, podConfig *PodConfig, sandboxID string, sandboxConfig *runtimeapi.PodSandboxConfig, podDir string, out io.Writer) (string, error) {
+	dd := podConfig.DockerDaemon
+
+	if _, err := d.fetchImage(ctx, dd.Image, podConfig.DockerConfig, sandboxConfig, out); err != nil {
+		return "", err
+	}
+
+	storageDir := filepath.Join(podDir, "dockerdaemon")
+	if err := os.MkdirAll(storageDir, 0700); err != nil {
+		return "", err
+	}
+
+	labels := d.podLabels(podConfig)
+	labels[dockerDaemonKey] = "true"
+	labels[containerIndexKey] = strconv.Itoa(index)
+
+	resources := &runtimeapi.LinuxContainerResources{
+		MemoryLimitInBytes: dd.Memory,
+	}
+	if dd.CPU > 0 {
+		resources.CpuPeriod = 100000
+		resources.CpuQuota = int64(dd.CPU * 100000)
+	}
+
+	resp, err := d.runtimeClient.CreateContainer(ctx, &runtimeapi.CreateContainerRequest{
+		PodSandboxId: sandboxID,
+		Config: &runtimeapi.ContainerConfig{
+			Metadata: &runtimeapi.ContainerMetadata{Name: "dockerdaemon"},
+			Image:    &runtimeapi.ImageSpec{Image: dd.Image},
+			// an empty certs dir disables tls: the daemon listens on
+			// DockerDaemonHost, only reachable from the pod network namespace
+			Envs:    []*runtimeapi.KeyValue{{Key: "DOCKER_TLS_CERTDIR", Value: ""}},
+			Mounts:  []*runtimeapi.Mount{{ContainerPath: dockerDaemonStorageDir, HostPath: storageDir}},
+			Labels:  labels,
+			LogPath: "dockerdaemon.log",
+			Linux: &runtimeapi.LinuxContainerConfig{
+				Resources:       resources,
+				SecurityContext: &runtimeapi.LinuxContainerSecurityContext{Privileged: true},
+			},
+		},
+		SandboxConfig: sandboxConfig,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, _ = fmt.Fprintf(out, "Starting docker daemon (image %q)\n", dd.Image)
+	if _, err := d.runtimeClient.StartContainer(ctx, &runtimeapi.StartContainerRequest{ContainerId: resp.ContainerId}); err != nil {
+		return "", err
+	}
+
+	return resp.ContainerId, nil
+}
+
+// waitDockerDaemon waits for the docker daemon container to reply to the
+// docker info command
+func (d *CRIDriver) waitDockerDaemon(ctx context.Context, containerID string) error {
+	ctx, cancel := context.WithTimeout(ctx, dockerDaemonStartTimeout)
+	defer cancel()
+
+	for {
+		resp, err := d.runtimeClient.ContainerStatus(ctx, &runtimeapi.ContainerStatusRequest{ContainerId: containerID})
+		if err != nil {
+			return err
+		}
+		if resp.Status.State == runtimeapi.ContainerState_CONTAINER_EXITED {
+			return errors.Errorf("docker daemon exited with code %d", resp.Status.ExitCode)
+		}
+		execResp, err := d.runtimeClient.ExecSync(ctx, &runtimeapi.ExecSyncRequest{
+			ContainerId: containerID,
+			Cmd:         []string{"docker", "info"},
+			Timeout:     5,
+		})
+		if err == nil && execResp.ExitCode == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("docker daemon not ready: %w", ctx.Err())
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+// applyNetworkPolicy applies the network policy iptables rules inside the pod
+// network namespace using a temporary container with the NET_ADMIN capability.
+// The pod containers don't have this capability so they cannot change the
+// rules.
+func (d *CRIDriver) applyNetworkPolicy(ctx context.Context, np *NetworkPolicy, sandboxID string, sandboxConfig *runtimeapi.PodSandboxConfig, logsDir string, out io.Writer) error {
+	if _, err := d.fetchImage(ctx, d.networkPolicyImage, nil, sandboxConfig, out); err != nil {
+		return err
+	}
+
+	// the output is shown only on failure
+	var output strings.Builder
+	exitCode, err := d.runContainer(ctx, sandboxID, sandboxConfig, &runtimeapi.ContainerConfig{
+		Metadata: &runtimeapi.ContainerMetadata{Name: "networkpolicy"},
+		Image:    &runtimeapi.ImageSpec{Image: d.networkPolicyImage},
+		Command:  []string{"/bin/sh", "-c", genIptablesScript(np)},
+		LogPath:  "networkpolicy.log",
+		Linux: &runtimeapi.LinuxContainerConfig{
+			SecurityContext: &runtimeapi.LinuxContainerSecurityContext{
+				Capabilities: &runtimeapi.Capability{AddCapabilities: []string{"NET_ADMIN"}},
+			},
+		},
+	}, logsDir, &output)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		_, _ = io.WriteString(out, output.String())
+		return errors.Errorf("network policy container exited with code %d", exitCode)
+	}
+
+	return nil
+}
+
+// criSecurityContext returns the container security context applying the
+// security profile and the user. The CRI profiles have the same format of the
+// security profiles ones. Since an empty seccomp profile means unconfined for
+// the CRI api, the runtime default is used to keep the same behavior of the
+// docker driver.
+func criSecurityContext(sp *SecurityProfile, privileged bool, user string) (*runtimeapi.LinuxContainerSecurityContext, error) {
+	sc := &runtimeapi.LinuxContainerSecurityContext{
+		Privileged:         privileged,
+		SeccompProfilePath: SecurityProfileRuntimeDefault,
+	}
+
+	if sp != nil {
+		for _, profile := range []string{sp.Seccomp, sp.AppArmor} {
+			switch {
+			case profile == "", profile == SecurityProfileRuntimeDefault, profile == SecurityProfileUnconfined:
+			case strings.HasPrefix(profile, SecurityProfileLocalhostPrefix):
+			default:
+				return nil, errors.Errorf("unknown profile %q", profile)
+			}
+		}
+		if sp.Seccomp != "" {
+			sc.SeccompProfilePath = sp.Seccomp
+		}
+		sc.ApparmorProfile = sp.AppArmor
+	}
+
+	if user != "" {
+		if err := criSetUser(sc, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return sc, nil
+}
+
+// criSetUser sets the container user. The CRI api supports a numeric uid, with
+// an optional numeric gid, or a user name.
+func criSetUser(sc *runtimeapi.LinuxContainerSecurityContext, user string) error {
+	parts := strings.SplitN(user, ":", 2)
+	uid, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		if len(parts) > 1 {
+			return errors.Errorf("user %q isn't supported by the cri driver, a group can be provided only with a numeric uid", user)
+		}
+		sc.RunAsUsername = user
+		return nil
+	}
+	sc.RunAsUser = &runtimeapi.Int64Value{Value: uid}
+	if len(parts) > 1 {
+		gid, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return errors.Errorf("user %q isn't supported by the cri driver, a group can be provided only with a numeric gid", user)
+		}
+		sc.RunAsGroup = &runtimeapi.Int64Value{Value: gid}
+	}
+	return nil
+}
+
+// criMounts returns the container mounts for the container volumes. The only
+// volume type is tmpfs that isn't supported by the CRI api.
+func criMounts(volumes []Volume) ([]*runtimeapi.Mount, error) {
+	mounts := []*runtimeapi.Mount{}
+
+	for _, vol := range volumes {
+		if vol.TmpFS != nil {
+			return nil, errors.Errorf("tmpfs volumes aren't supported by the cri driver")
+		}
+		return nil, errors.Errorf("missing volume config")
+	}
+	return mounts, nil
+}
+
+func criEnvs(env map[string]string) []*runtimeapi.KeyValue {
+	envs := make([]*runtimeapi.KeyValue, 0, len(env))
+	for k, v := range env {
+		envs = append(envs, &runtimeapi.KeyValue{Key: k, Value: v})
+	}
+	return envs
+}
+
+func (d *CRIDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
+	filter := &runtimeapi.PodSandboxFilter{
+		LabelSelector: map[string]string{
+			agolaLabelKey: agolaLabelValue,
+			executorIDKey: d.executorID,
+		},
+	}
+	if !all {
+		filter.State = &runtimeapi.PodSandboxStateValue{State: runtimeapi.PodSandboxState_SANDBOX_READY}
+	}
+	resp, err := d.runtimeClient.ListPodSandbox(ctx, &runtimeapi.ListPodSandboxRequest{Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+
+	pods := []Pod{}
+	for _, sandbox := range resp.Items {
+		podID, ok := sandbox.Labels[podIDKey]
+		if !ok {
+			// skip sandbox
+			continue
+		}
+
+		containersResp, err := d.runtimeClient.ListContainers(ctx, &runtimeapi.ListContainersRequest{
+			Filter: &runtimeapi.ContainerFilter{PodSandboxId: sandbox.Id},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		pod := &CRIPod{
+			id:            podID,
+			sandboxID:     sandbox.Id,
+			executorID:    d.executorID,
+			taskID:        sandbox.Labels[taskIDKey],
+			containers:    []*CRIContainer{},
+			podDir:        d.podDir(podID),
+			initVolumeDir: sandbox.Annotations[criInitVolumeDirKey],
+			runtimeClient: d.runtimeClient,
+		}
+		for _, container := range containersResp.Containers {
+			cIndexStr, ok := container.Labels[containerIndexKey]
+			if !ok {
+				// ignore container
+				continue
+			}
+			cIndex, err := strconv.Atoi(cIndexStr)
+			if err != nil {
+				// ignore container
+				continue
+			}
+			pod.containers = append(pod.containers, &CRIContainer{Index: cIndex, ID: container.Id})
+		}
+		// put the containers in the right order based on their container index
+		sort.Slice(pod.containers, func(i, j int) bool { return pod.containers[i].Index < pod.containers[j].Index })
+
+		pods = append(pods, pod)
+	}
+
+	return pods, nil
+}
+
+// GetDanglingResources returns the pods dirs without a pod sandbox. The
+// containers are always part of a pod sandbox so they are removed with it.
+func (d *CRIDriver) GetDanglingResources(ctx context.Context) ([]Resource, error) {
+	pods, err := d.GetPods(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	podIDs := map[string]struct{}{}
+	for _, pod := range pods {
+		podIDs[pod.ID()] = struct{}{}
+	}
+
+	entries, err := ioutil.ReadDir(d.podsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// skip dirs of an existing pod
+		if _, ok := podIDs[entry.Name()]; ok {
+			continue
+		}
+
+		dir := filepath.Join(d.podsDir, entry.Name())
+		// a missing task id file means the pod creation was interrupted
+		// before writing it
+		taskID, _ := ioutil.ReadFile(filepath.Join(dir, criTaskIDFile))
+
+		resources = append(resources, &CRIResource{
+			id:           entry.Name(),
+			executorID:   d.executorID,
+			taskID:       string(taskID),
+			creationTime: entry.ModTime(),
+			dir:          dir,
+		})
+	}
+
+	return resources, nil
+}
+
+// CRIResource is a pod dir left on the executor host
+type CRIResource struct {
+	id           string
+	executorID   string
+	taskID       string
+	creationTime time.Time
+	dir          string
+}
+
+func (r *CRIResource) ID() string {
+	return r.id
+}
+
+func (r *CRIResource) Kind() ResourceKind {
+	return ResourceKindVolume
+}
+
+func (r *CRIResource) ExecutorID() string {
+	return r.executorID
+}
+
+func (r *CRIResource) TaskID() string {
+	return r.taskID
+}
+
+func (r *CRIResource) CreationTime() time.Time {
+	return r.creationTime
+}
+
+func (r *CRIResource) Remove(ctx context.Context) error {
+	return os.RemoveAll(r.dir)
+}
+
+type CRIPod struct {
+	id            string
+	sandboxID     string
+	executorID    string
+	taskID        string
+	containers    []*CRIContainer
+	podDir        string
+	initVolumeDir string
+	// ulimits are applied by the toolbox to the executed processes since the
+	// CRI api doesn't support container ulimits
+	ulimits []Ulimit
+
+	runtimeClient runtimeapi.RuntimeServiceClient
+
+	imagePullStats *ImagePullStats
+}
+
+type CRIContainer struct {
+	Index int
+	ID    string
+}
+
+func (p *CRIPod) ID() string {
+	return p.id
+}
+
+func (p *CRIPod) ExecutorID() string {
+	return p.executorID
+}
+
+func (p *CRIPod) TaskID() string {
+	return p.taskID
+}
+
+func (p *CRIPod) ImagePullStats() *ImagePullStats {
+	return p.imagePullStats
+}
+
+func (p *CRIPod) mainContainerID() (string, error) {
+	if len(p.containers) == 0 || p.containers[0].Index != 0 {
+		return "", errors.Errorf("pod %q doesn't have a main container", p.id)
+	}
+	return p.containers[0].ID, nil
+}
+
+func (p *CRIPod) Stop(ctx context.Context) error {
+	errs := []error{}
+	for _, container := range p.containers {
+		if _, err := p.runtimeClient.StopContainer(ctx, &runtimeapi.StopContainerRequest{ContainerId: container.ID, Timeout: criStopTimeout}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Errorf("stop errors: %v", errs)
+	}
+	return nil
+}
+
+func (p *CRIPod) Remove(ctx context.Context) error {
+	// the sandbox must be stopped before being removed
+	if _, err := p.runtimeClient.StopPodSandbox(ctx, &runtimeapi.StopPodSandboxRequest{PodSandboxId: p.sandboxID}); err != nil {
+		return err
+	}
+	if _, err := p.runtimeClient.RemovePodSandbox(ctx, &runtimeapi.RemovePodSandboxRequest{PodSandboxId: p.sandboxID}); err != nil {
+		return err
+	}
+	return os.RemoveAll(p.podDir)
+}
+
+func (p *CRIPod) Stats(ctx context.Context) (*PodStats, error) {
+	containerID, err := p.mainContainerID()
+	if err != nil {
+		return nil, err
+	}
+
+	// the cpu usage is calculated from two samples since the CRI api reports
+	// the cumulative cpu time
+	prev, err := p.runtimeClient.ContainerStats(ctx, &runtimeapi.ContainerStatsRequest{ContainerId: containerID})
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(criStatsInterval):
+	}
+	cur, err := p.runtimeClient.ContainerStats(ctx, &runtimeapi.ContainerStatsRequest{ContainerId: containerID})
+	if err != nil {
+		return nil, err
+	}
+
+	return criPodStats(prev.Stats, cur.Stats), nil
+}
+
+// criPodStats returns the pod stats from two samples of the container stats
+func criPodStats(prev, cur *runtimeapi.ContainerStats) *PodStats {
+	stats := &PodStats{}
+	if prev == nil || cur == nil {
+		return stats
+	}
+
+	if prev.Cpu != nil && cur.Cpu != nil && prev.Cpu.UsageCoreNanoSeconds != nil && cur.Cpu.UsageCoreNanoSeconds != nil {
+		cpuDelta := float64(cur.Cpu.UsageCoreNanoSeconds.Value) - float64(prev.Cpu.UsageCoreNanoSeconds.Value)
+		elapsed := cur.Cpu.Timestamp - prev.Cpu.Timestamp
+		if elapsed > 0 && cpuDelta > 0 {
+			stats.CPU = cpuDelta / float64(elapsed)
+		}
+	}
+	if cur.Memory != nil && cur.Memory.WorkingSetBytes != nil {
+		stats.Memory = int64(cur.Memory.WorkingSetBytes.Value)
+	}
+
+	return stats
+}
+
+type CRIContainerExec struct {
+	endCh chan error
+
+	stdin io.WriteCloser
+}
+
+func (p *CRIPod) Exec(ctx context.Context, execConfig *ExecConfig) (ContainerExec, error) {
+	containerID, err := p.mainContainerID()
+	if err != nil {
+		return nil, err
+	}
+
+	endCh := make(chan error)
+
+	// the CRI exec api doesn't let us define the workingdir, the environment
+	// and the user (the command is executed with the container user). Use a
+	// toolbox command that will set them up and then exec the real command.
+	envj, err := json.Marshal(execConfig.Env)
+	if err != nil {
+		return nil, err
+	}
+	cmd := []string{ToolboxContainerPath(types.OSLinux, p.initVolumeDir), "exec", "-e", string(envj), "-w", execConfig.WorkingDir}
+	for _, u := range p.ulimits {
+		cmd = append(cmd, "--ulimit", fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard))
+	}
+	cmd = append(cmd, "--")
+	cmd = append(cmd, execConfig.Cmd...)
+
+	resp, err := p.runtimeClient.Exec(ctx, &runtimeapi.ExecRequest{
+		ContainerId: containerID,
+		Cmd:         cmd,
+		Tty:         execConfig.Tty,
+		Stdin:       execConfig.AttachStdin,
+		Stdout:      execConfig.Stdout != nil,
+		Stderr:      execConfig.Stderr != nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(resp.Url)
+	if err != nil {
+		return nil, errors.Errorf("wrong cri exec url %q: %w", resp.Url, err)
+	}
+
+	// the CRI streaming server uses the same protocol of the kubernetes exec
+	// api
+	exec, err := remotecommand.NewSPDYExecutor(&restclient.Config{}, "POST", u)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+
+	var stdin io.Reader
+	if execConfig.AttachStdin {
+		stdin = reader
+	}
+
+	go func() {
+		err := exec.Stream(remotecommand.StreamOptions{
+			Stdin:  stdin,
+			Stdout: execConfig.Stdout,
+			Stderr: execConfig.Stderr,
+			Tty:    execConfig.Tty,
+		})
+		endCh <- err
+	}()
+
+	return &CRIContainerExec{
+		stdin: writer,
+		endCh: endCh,
+	}, nil
+}
+
+func (e *CRIContainerExec) Wait(ctx context.Context) (int, error) {
+	err := <-e.endCh
+
+	var exitCode int
+	if err != nil {
+		switch err := err.(type) {
+		case utilexec.ExitError:
+			exitCode = err.ExitStatus()
+		default:
+			return -1, err
+		}
+	}
+
+	return exitCode, nil
+}
+
+func (e *CRIContainerExec) Stdin() io.WriteCloser {
+	return e.stdin
+}
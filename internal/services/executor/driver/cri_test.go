@@ -0,0 +1,176 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package driver
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func TestCRIEndpointAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		out      string
+		err      bool
+	}{
+		{
+			name:     "test unix socket",
+			endpoint: "unix:///run/containerd/containerd.sock",
+			out:      "/run/containerd/containerd.sock",
+		},
+		{
+			name:     "test tcp endpoint",
+			endpoint: "tcp://localhost:1234",
+			err:      true,
+		},
+		{
+			name:     "test path without scheme",
+			endpoint: "/run/containerd/containerd.sock",
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := criEndpointAddress(tt.endpoint)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if out != tt.out {
+				t.Fatalf("expected address %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestCopyCRILog(t *testing.T) {
+	in := `2020-03-01T10:00:00.000000000Z stdout F line01
+2020-03-01T10:00:00.000000001Z stderr P part
+2020-03-01T10:00:00.000000002Z stderr F ial line02
+2020-03-01T10:00:00.000000003Z stdout F
+wrong line
+2020-03-01T10:00:00.000000004Z stdout F line with  spaces
+`
+	expected := "line01\npartial line02\n\nline with  spaces\n"
+
+	var out bytes.Buffer
+	if err := copyCRILog(&out, bytes.NewBufferString(in)); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if out.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestCRIImagePullStats(t *testing.T) {
+	tests := []struct {
+		name      string
+		prevImage *runtimeapi.Image
+		curImage  *runtimeapi.Image
+		out       *ImagePullStats
+	}{
+		{
+			name:      "test new image",
+			prevImage: nil,
+			curImage:  &runtimeapi.Image{Id: "sha256:aaaa", Size_: 1024, RepoDigests: []string{"busybox@sha256:bbbb"}},
+			out:       &ImagePullStats{PulledBytes: 1024, Digest: "sha256:bbbb"},
+		},
+		{
+			name:      "test image up to date",
+			prevImage: &runtimeapi.Image{Id: "sha256:aaaa", Size_: 1024},
+			curImage:  &runtimeapi.Image{Id: "sha256:aaaa", Size_: 1024, RepoDigests: []string{"busybox@sha256:bbbb"}},
+			out:       &ImagePullStats{CacheHit: true, Digest: "sha256:bbbb"},
+		},
+		{
+			name:      "test updated image",
+			prevImage: &runtimeapi.Image{Id: "sha256:aaaa", Size_: 1024},
+			curImage:  &runtimeapi.Image{Id: "sha256:cccc", Size_: 2048},
+			out:       &ImagePullStats{PulledBytes: 2048},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := criImagePullStats(tt.prevImage, tt.curImage)
+			if diff := cmp.Diff(tt.out, stats); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCRISetUser(t *testing.T) {
+	tests := []struct {
+		name string
+		user string
+		out  *runtimeapi.LinuxContainerSecurityContext
+		err  bool
+	}{
+		{
+			name: "test uid",
+			user: "1000",
+			out:  &runtimeapi.LinuxContainerSecurityContext{RunAsUser: &runtimeapi.Int64Value{Value: 1000}},
+		},
+		{
+			name: "test uid and gid",
+			user: "1000:100",
+			out:  &runtimeapi.LinuxContainerSecurityContext{RunAsUser: &runtimeapi.Int64Value{Value: 1000}, RunAsGroup: &runtimeapi.Int64Value{Value: 100}},
+		},
+		{
+			name: "test user name",
+			user: "nobody",
+			out:  &runtimeapi.LinuxContainerSecurityContext{RunAsUsername: "nobody"},
+		},
+		{
+			name: "test user name and group",
+			user: "nobody:nogroup",
+			err:  true,
+		},
+		{
+			name: "test uid and group name",
+			user: "1000:nogroup",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &runtimeapi.LinuxContainerSecurityContext{}
+			err := criSetUser(sc, tt.user)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, sc); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -17,19 +17,21 @@ package driver
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"path/filepath"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"agola.io/agola/internal/services/executor/registry"
+	"agola.io/agola/internal/util"
 	"agola.io/agola/services/types"
 	errors "golang.org/x/xerrors"
 
@@ -39,90 +41,186 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/pkg/stdcopy"
+	units "github.com/docker/go-units"
 	"go.uber.org/zap"
 )
 
+const (
+	defaultNetworkPolicyImage = "alpine:3.11"
+
+	// dockerDaemonStartTimeout is the max time waited for a pod docker daemon
+	// to be ready
+	dockerDaemonStartTimeout = 2 * time.Minute
+)
+
+// imagePullBackoff is the backoff used to retry the image pulls failed with a
+// transient error
+var imagePullBackoff = util.Backoff{
+	Steps:    4,
+	Duration: 2 * time.Second,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
+// permanentImagePullErrors are the (lowercase) messages of the image pull
+// errors that won't be fixed retrying the pull
+var permanentImagePullErrors = []string{
+	"manifest unknown",
+	"not found",
+	"repository does not exist",
+	"pull access denied",
+	"unauthorized",
+	"authentication required",
+	"denied",
+	"invalid reference format",
+}
+
 type DockerDriver struct {
-	log         *zap.SugaredLogger
-	client      *client.Client
-	toolboxPath string
-	executorID  string
-	arch        types.Arch
+	log                *zap.SugaredLogger
+	client             *client.Client
+	toolboxPath        string
+	networkPolicyImage string
+	windowsIsolation   string
+	executorID         string
+	arch               types.Arch
+	// os is the docker daemon os type, populated by Setup
+	os types.OS
+
+	// dockerDaemonCacheMutex avoids two pods using the same docker daemon
+	// cached storage
+	dockerDaemonCacheMutex sync.Mutex
 }
 
-func NewDockerDriver(logger *zap.Logger, executorID, toolboxPath string) (*DockerDriver, error) {
+func NewDockerDriver(logger *zap.Logger, executorID, toolboxPath, networkPolicyImage, windowsIsolation string) (*DockerDriver, error) {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithVersion("1.26"))
 	if err != nil {
 		return nil, err
 	}
 
+	if networkPolicyImage == "" {
+		networkPolicyImage = defaultNetworkPolicyImage
+	}
+
 	return &DockerDriver{
-		log:         logger.Sugar(),
-		client:      cli,
-		toolboxPath: toolboxPath,
-		executorID:  executorID,
-		arch:        types.ArchFromString(runtime.GOARCH),
+		log:                logger.Sugar(),
+		client:             cli,
+		toolboxPath:        toolboxPath,
+		networkPolicyImage: networkPolicyImage,
+		windowsIsolation:   windowsIsolation,
+		executorID:         executorID,
+		arch:               types.ArchFromString(runtime.GOARCH),
 	}, nil
 }
 
 func (d *DockerDriver) Setup(ctx context.Context) error {
-	return nil
-}
-
-func (d *DockerDriver) createToolboxVolume(ctx context.Context, podID string) (*dockertypes.Volume, error) {
-	reader, err := d.client.ImagePull(ctx, "busybox", dockertypes.ImagePullOptions{})
+	// the containers os is the docker daemon os type and not the executor os
+	// since the docker daemon could be remote
+	info, err := d.client.Info(ctx)
 	if err != nil {
-		return nil, err
+		return errors.Errorf("failed to get docker info: %w", err)
 	}
-	scanner := bufio.NewScanner(reader)
-	for scanner.Scan() {
-		d.log.Infof("create toolbox volume image pull output: %s", scanner.Text())
+	d.os = types.OS(info.OSType)
+	if !types.IsValidOS(d.os) {
+		return errors.Errorf("unsupported docker os type %q", info.OSType)
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
+
+	return nil
+}
+
+func (d *DockerDriver) createToolboxVolume(ctx context.Context, podConfig *PodConfig, out io.Writer) (*dockertypes.Volume, *ImagePullStats, error) {
+	helperImage := "busybox"
+	helperDir := "/tmp/agola"
+	// pull stats of the pod main container image when pulled here
+	var imagePullStats *ImagePullStats
+	if podConfig.OS == types.OSWindows {
+		// there's no busybox image for windows, use the pod main container image
+		// that will also be compatible with the host os version.
+		helperImage = podConfig.Containers[0].Image
+		helperDir = podConfig.InitVolumeDir
+		var err error
+		imagePullStats, err = d.fetchImage(ctx, helperImage, podConfig.DockerConfig, out)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		reader, err := d.client.ImagePull(ctx, helperImage, dockertypes.ImagePullOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		scanner := bufio.NewScanner(reader)
+		for scanner.Scan() {
+			d.log.Infof("create toolbox volume image pull output: %s", scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	labels := map[string]string{}
 	labels[agolaLabelKey] = agolaLabelValue
 	labels[executorIDKey] = d.executorID
-	labels[podIDKey] = podID
+	labels[podIDKey] = podConfig.ID
+	labels[taskIDKey] = podConfig.TaskID
 	toolboxVol, err := d.client.VolumeCreate(ctx, volume.VolumeCreateBody{Driver: "local", Labels: labels})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	resp, err := d.client.ContainerCreate(ctx, &container.Config{
+	// the helper container doesn't have the pod id label since it isn't part
+	// of the pod
+	helperLabels := map[string]string{}
+	helperLabels[agolaLabelKey] = agolaLabelValue
+	helperLabels[executorIDKey] = d.executorID
+	helperLabels[taskIDKey] = podConfig.TaskID
+	helperLabels[toolboxVolumeHelperKey] = "true"
+	helperContainerConfig := &container.Config{
 		Entrypoint: []string{"cat"},
-		Image:      "busybox",
+		Image:      helperImage,
 		Tty:        true,
-	}, &container.HostConfig{
-		Binds: []string{fmt.Sprintf("%s:%s", toolboxVol.Name, "/tmp/agola")},
-	}, nil, "")
+		Labels:     helperLabels,
+	}
+	helperHostConfig := &container.HostConfig{
+		Binds: []string{fmt.Sprintf("%s:%s", toolboxVol.Name, helperDir)},
+	}
+	if podConfig.OS == types.OSWindows {
+		// the image entrypoint is kept since the container won't be started
+		helperContainerConfig.Entrypoint = nil
+		helperHostConfig.Isolation = container.Isolation(d.windowsIsolation)
+	}
+	resp, err := d.client.ContainerCreate(ctx, helperContainerConfig, helperHostConfig, nil, "")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	containerID := resp.ID
 
-	if err := d.client.ContainerStart(ctx, containerID, dockertypes.ContainerStartOptions{}); err != nil {
-		return nil, err
+	// files can be copied to a created but not running windows container
+	// (copying to a running hyper-v isolated container isn't supported)
+	if podConfig.OS != types.OSWindows {
+		if err := d.client.ContainerStart(ctx, containerID, dockertypes.ContainerStartOptions{}); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	toolboxExecPath, err := toolboxExecPath(d.toolboxPath, d.arch)
+	toolboxExecPath, err := toolboxExecPath(d.toolboxPath, podConfig.OS, d.arch)
 	if err != nil {
-		return nil, errors.Errorf("failed to get toolbox path for arch %q: %w", d.arch, err)
+		return nil, nil, errors.Errorf("failed to get toolbox path for os %q, arch %q: %w", types.OSOrDefault(podConfig.OS), d.arch, err)
 	}
 	srcInfo, err := archive.CopyInfoSourcePath(toolboxExecPath, false)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	srcInfo.RebaseName = "agola-toolbox"
+	if podConfig.OS == types.OSWindows {
+		srcInfo.RebaseName = "agola-toolbox.exe"
+	}
 
 	srcArchive, err := archive.TarResource(srcInfo)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer srcArchive.Close()
 
@@ -131,14 +229,18 @@ func (d *DockerDriver) createToolboxVolume(ctx context.Context, podID string) (*
 		CopyUIDGID:                false,
 	}
 
-	if err := d.client.CopyToContainer(ctx, containerID, "/tmp/agola", srcArchive, options); err != nil {
-		return nil, err
+	if err := d.client.CopyToContainer(ctx, containerID, helperDir, srcArchive, options); err != nil {
+		return nil, nil, err
 	}
 
 	// ignore remove error
 	_ = d.client.ContainerRemove(ctx, containerID, dockertypes.ContainerRemoveOptions{Force: true})
 
-	return &toolboxVol, nil
+	return &toolboxVol, imagePullStats, nil
+}
+
+func (d *DockerDriver) OS(ctx context.Context) (types.OS, error) {
+	return types.OSOrDefault(d.os), nil
 }
 
 func (d *DockerDriver) Archs(ctx context.Context) ([]types.Arch, error) {
@@ -151,17 +253,56 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 		return nil, errors.Errorf("empty container config")
 	}
 
-	toolboxVol, err := d.createToolboxVolume(ctx, podConfig.ID)
+	if types.OSOrDefault(podConfig.OS) != types.OSOrDefault(d.os) {
+		return nil, errors.Errorf("pod os %q doesn't match the docker daemon os %q", types.OSOrDefault(podConfig.OS), types.OSOrDefault(d.os))
+	}
+	if podConfig.OS == types.OSWindows && podConfig.NetworkPolicy != nil {
+		return nil, errors.Errorf("network policies aren't supported with windows containers")
+	}
+	if err := checkIptablesNetworkPolicy(podConfig); err != nil {
+		return nil, err
+	}
+	if podConfig.OS == types.OSWindows && podConfig.SecurityProfile != nil {
+		return nil, errors.Errorf("security profiles aren't supported with windows containers")
+	}
+	if podConfig.OS == types.OSWindows && len(podConfig.InitContainers) > 0 {
+		return nil, errors.Errorf("init containers aren't supported with windows containers")
+	}
+	if podConfig.OS == types.OSWindows && podConfig.Limits != nil {
+		return nil, errors.Errorf("limits aren't supported with windows containers")
+	}
+
+	toolboxVol, imagePullStats, err := d.createToolboxVolume(ctx, podConfig, out)
 	if err != nil {
 		return nil, err
 	}
 
+	var sharedVol *dockertypes.Volume
+	if len(podConfig.InitContainers) > 0 {
+		vol, err := d.client.VolumeCreate(ctx, volume.VolumeCreateBody{Driver: "local", Labels: map[string]string{
+			agolaLabelKey:   agolaLabelValue,
+			executorIDKey:   d.executorID,
+			podIDKey:        podConfig.ID,
+			taskIDKey:       podConfig.TaskID,
+			sharedVolumeKey: "true",
+		}})
+		if err != nil {
+			return nil, err
+		}
+		sharedVol = &vol
+	}
+
 	var mainContainerID string
 	for cindex := range podConfig.Containers {
-		resp, err := d.createContainer(ctx, cindex, podConfig, mainContainerID, toolboxVol, out)
+		resp, containerImagePullStats, err := d.createContainer(ctx, cindex, podConfig, mainContainerID, toolboxVol, sharedVol, out)
 		if err != nil {
 			return nil, err
 		}
+		// keep the main container image pull stats. When already pulled to
+		// populate the toolbox volume the second pull is always a cache hit.
+		if cindex == 0 && imagePullStats == nil {
+			imagePullStats = containerImagePullStats
+		}
 
 		containerID := resp.ID
 		if cindex == 0 {
@@ -172,6 +313,36 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 		if err := d.client.ContainerStart(ctx, containerID, dockertypes.ContainerStartOptions{}); err != nil {
 			return nil, err
 		}
+
+		// apply the network policy to the pod network namespace (owned by the
+		// main container) before starting the other containers
+		if cindex == 0 && podConfig.NetworkPolicy != nil {
+			if err := d.applyNetworkPolicy(ctx, podConfig.NetworkPolicy, mainContainerID, out); err != nil {
+				return nil, errors.Errorf("failed to apply network policy %q: %w", podConfig.NetworkPolicy.Name, err)
+			}
+		}
+	}
+
+	var dockerDaemonVolumeName string
+	if podConfig.DockerDaemon != nil {
+		containerID, volumeName, err := d.startDockerDaemon(ctx, len(podConfig.Containers), podConfig, mainContainerID, out)
+		dockerDaemonVolumeName = volumeName
+		if err != nil {
+			return nil, errors.Errorf("failed to start docker daemon: %w", err)
+		}
+		if err := d.waitDockerDaemon(ctx, containerID); err != nil {
+			return nil, err
+		}
+		_, _ = fmt.Fprintf(out, "Docker daemon ready\n")
+	}
+
+	// the main container is only running the toolbox sleeper, so the init
+	// containers are executed before anything is executed in the pod. They
+	// share the main container network namespace and so its network policy.
+	for cindex := range podConfig.InitContainers {
+		if err := d.runInitContainer(ctx, cindex, podConfig, mainContainerID, sharedVol, out); err != nil {
+			return nil, err
+		}
 	}
 
 	searchLabels := map[string]string{}
@@ -201,7 +372,12 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 		executorID:        d.executorID,
 		containers:        []*DockerContainer{},
 		toolboxVolumeName: toolboxVol.Name,
+		sharedVolumeName:  sharedVolumeName(sharedVol),
+		os:                podConfig.OS,
 		initVolumeDir:     podConfig.InitVolumeDir,
+		imagePullStats:    imagePullStats,
+
+		dockerDaemonVolumeName: dockerDaemonVolumeName,
 	}
 
 	count := 0
@@ -238,10 +414,10 @@ func (d *DockerDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.
 	return pod, nil
 }
 
-func (d *DockerDriver) fetchImage(ctx context.Context, image string, registryConfig *registry.DockerConfig, out io.Writer) error {
+func (d *DockerDriver) fetchImage(ctx context.Context, image string, registryConfig *registry.DockerConfig, out io.Writer) (*ImagePullStats, error) {
 	regName, err := registry.GetRegistry(image)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var registryAuth registry.DockerConfigAuth
 	if registryConfig != nil {
@@ -251,26 +427,138 @@ func (d *DockerDriver) fetchImage(ctx context.Context, image string, registryCon
 	}
 	buf, err := json.Marshal(registryAuth)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	registryAuthEnc := base64.URLEncoding.EncodeToString(buf)
 
+	start := time.Now()
+
+	// retry only the transient errors (i.e. network errors), a typo in the
+	// image name must fail fast
+	var stats *ImagePullStats
+	var pullErr error
+	err = util.ExponentialBackoff(ctx, imagePullBackoff, func() (bool, error) {
+		stats, pullErr = d.pullImage(ctx, image, registryAuthEnc, out)
+		if pullErr == nil {
+			return true, nil
+		}
+		if isPermanentImagePullError(pullErr) {
+			return false, &ImagePullError{Image: image, Permanent: true, Err: pullErr}
+		}
+		_, _ = fmt.Fprintf(out, "Failed to pull image %q, retrying. Error: %s\n", image, pullErr)
+		return false, nil
+	})
+	if err != nil {
+		if errors.Is(err, util.ErrWaitTimeout) {
+			return nil, &ImagePullError{Image: image, Err: pullErr}
+		}
+		return nil, err
+	}
+	stats.Image = image
+	stats.Duration = time.Since(start)
+
+	return stats, nil
+}
+
+func (d *DockerDriver) pullImage(ctx context.Context, image, registryAuthEnc string, out io.Writer) (*ImagePullStats, error) {
 	// by default always try to pull the image so we are sure only authorized users can fetch them
 	// see https://kubernetes.io/docs/reference/access-authn-authz/admission-controllers/#alwayspullimages
 	reader, err := d.client.ImagePull(ctx, image, dockertypes.ImagePullOptions{RegistryAuth: registryAuthEnc})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	defer reader.Close()
+
+	return parseImagePullOutput(reader, out)
+}
+
+// isPermanentImagePullError reports if the image pull error won't be fixed
+// retrying the pull
+func isPermanentImagePullError(err error) bool {
+	if errdefs.IsNotFound(err) || errdefs.IsUnauthorized(err) || errdefs.IsForbidden(err) || errdefs.IsInvalidParameter(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range permanentImagePullErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
 	}
+	return false
+}
 
-	_, err = io.Copy(out, reader)
-	return err
+// imagePullMessage is a message of the docker image pull json output
+type imagePullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	Error          string `json:"error"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
 }
 
-func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig *PodConfig, maincontainerID string, toolboxVol *dockertypes.Volume, out io.Writer) (*container.ContainerCreateCreatedBody, error) {
+// parseImagePullOutput copies the docker image pull output to out while
+// collecting the pulled and cached layers and the image manifest digest. The
+// pulled bytes are the sum of the sizes of the downloaded layers. An error
+// reported in the output is returned as the pull error.
+func parseImagePullOutput(r io.Reader, out io.Writer) (*ImagePullStats, error) {
+	stats := &ImagePullStats{}
+	layersSize := map[string]int64{}
+	upToDate := false
+
+	tr := io.TeeReader(r, out)
+	dec := json.NewDecoder(tr)
+	for {
+		var m imagePullMessage
+		if err := dec.Decode(&m); err != nil {
+			if err == io.EOF {
+				break
+			}
+			// not a json stream, just copy the remaining output
+			if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+				return nil, err
+			}
+			return stats, nil
+		}
+
+		if m.Error != "" {
+			if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+				return nil, err
+			}
+			return nil, errors.New(m.Error)
+		}
+
+		switch {
+		case m.Status == "Downloading":
+			if m.ProgressDetail.Total > layersSize[m.ID] {
+				layersSize[m.ID] = m.ProgressDetail.Total
+			}
+		case m.Status == "Pull complete":
+			stats.PulledLayers++
+		case m.Status == "Already exists":
+			stats.CachedLayers++
+		case strings.HasPrefix(m.Status, "Status: Image is up to date"):
+			upToDate = true
+		case strings.HasPrefix(m.Status, "Digest: "):
+			stats.Digest = strings.TrimPrefix(m.Status, "Digest: ")
+		}
+	}
+
+	for _, size := range layersSize {
+		stats.PulledBytes += size
+	}
+	stats.CacheHit = upToDate || stats.PulledLayers == 0
+
+	return stats, nil
+}
+
+func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig *PodConfig, maincontainerID string, toolboxVol, sharedVol *dockertypes.Volume, out io.Writer) (*container.ContainerCreateCreatedBody, *ImagePullStats, error) {
 	containerConfig := podConfig.Containers[index]
 
-	if err := d.fetchImage(ctx, containerConfig.Image, podConfig.DockerConfig, out); err != nil {
-		return nil, err
+	imagePullStats, err := d.fetchImage(ctx, containerConfig.Image, podConfig.DockerConfig, out)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	labels := map[string]string{}
@@ -294,22 +582,61 @@ func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig
 		Labels:     containerLabels,
 	}
 
+	securityOpts, err := dockerSecurityOpts(podConfig.SecurityProfile)
+	if err != nil {
+		return nil, nil, errors.Errorf("failed to apply security profile %q: %w", podConfig.SecurityProfile.Name, err)
+	}
+
 	cliHostConfig := &container.HostConfig{
-		Privileged: containerConfig.Privileged,
+		Privileged:  containerConfig.Privileged,
+		SecurityOpt: securityOpts,
+		ShmSize:     containerConfig.ShmSize,
+	}
+	cliHostConfig.PidsLimit, cliHostConfig.Ulimits = dockerLimits(podConfig.Limits)
+	if podConfig.OS == types.OSWindows {
+		cliHostConfig.Isolation = container.Isolation(d.windowsIsolation)
 	}
 	if index == 0 {
 		// main container requires the initvolume containing the toolbox
 		// TODO(sgotti) migrate this to cliHostConfig.Mounts
 		cliHostConfig.Binds = []string{fmt.Sprintf("%s:%s", toolboxVol.Name, podConfig.InitVolumeDir)}
-		cliHostConfig.ReadonlyPaths = []string{fmt.Sprintf("%s:%s", toolboxVol.Name, podConfig.InitVolumeDir)}
+		// readonly paths aren't supported by windows containers
+		if podConfig.OS != types.OSWindows {
+			cliHostConfig.ReadonlyPaths = []string{fmt.Sprintf("%s:%s", toolboxVol.Name, podConfig.InitVolumeDir)}
+		}
+		if sharedVol != nil {
+			cliHostConfig.Binds = append(cliHostConfig.Binds, fmt.Sprintf("%s:%s", sharedVol.Name, podConfig.SharedVolumeDir))
+		}
+
+		// equivalent of the docker cli "--gpus" option. The gpu type cannot be
+		// selected so it's up to the executor to provide a single gpu type
+		if podConfig.GPUs != nil {
+			cliHostConfig.DeviceRequests = []container.DeviceRequest{
+				{
+					Count:        podConfig.GPUs.Count,
+					Capabilities: [][]string{{"gpu"}},
+				},
+			}
+		}
 	} else {
 		// attach other containers to maincontainer network
 		cliHostConfig.NetworkMode = container.NetworkMode(fmt.Sprintf("container:%s", maincontainerID))
 	}
 
+	mounts, err := dockerVolumeMounts(containerConfig.Volumes)
+	if err != nil {
+		return nil, nil, err
+	}
+	cliHostConfig.Mounts = mounts
+
+	resp, err := d.client.ContainerCreate(ctx, cliContainerConfig, cliHostConfig, nil, "")
+	return &resp, imagePullStats, err
+}
+
+func dockerVolumeMounts(volumes []Volume) ([]mount.Mount, error) {
 	var mounts []mount.Mount
 
-	for _, vol := range containerConfig.Volumes {
+	for _, vol := range volumes {
 		if vol.TmpFS != nil {
 			mounts = append(mounts, mount.Mount{
 				Type:   mount.TypeTmpfs,
@@ -322,12 +649,441 @@ func (d *DockerDriver) createContainer(ctx context.Context, index int, podConfig
 			return nil, errors.Errorf("missing volume config")
 		}
 	}
-	if mounts != nil {
-		cliHostConfig.Mounts = mounts
+	return mounts, nil
+}
+
+// runInitContainer executes the pod init container with the provided index and
+// waits for it to finish, writing its output to out. It returns an error if the
+// init container exits with a non zero code.
+func (d *DockerDriver) runInitContainer(ctx context.Context, index int, podConfig *PodConfig, maincontainerID string, sharedVol *dockertypes.Volume, out io.Writer) error {
+	containerConfig := podConfig.InitContainers[index]
+
+	if _, err := d.fetchImage(ctx, containerConfig.Image, podConfig.DockerConfig, out); err != nil {
+		return err
 	}
 
-	resp, err := d.client.ContainerCreate(ctx, cliContainerConfig, cliHostConfig, nil, "")
-	return &resp, err
+	// the init containers don't have the pod id label since they aren't part
+	// of the running pod
+	labels := map[string]string{}
+	labels[agolaLabelKey] = agolaLabelValue
+	labels[executorIDKey] = d.executorID
+	labels[taskIDKey] = podConfig.TaskID
+	labels[initContainerKey] = strconv.Itoa(index)
+
+	securityOpts, err := dockerSecurityOpts(podConfig.SecurityProfile)
+	if err != nil {
+		return errors.Errorf("failed to apply security profile %q: %w", podConfig.SecurityProfile.Name, err)
+	}
+
+	mounts, err := dockerVolumeMounts(containerConfig.Volumes)
+	if err != nil {
+		return err
+	}
+
+	hostConfig := &container.HostConfig{
+		Privileged:  containerConfig.Privileged,
+		SecurityOpt: securityOpts,
+		NetworkMode: container.NetworkMode(fmt.Sprintf("container:%s", maincontainerID)),
+		Binds:       []string{fmt.Sprintf("%s:%s", sharedVol.Name, podConfig.SharedVolumeDir)},
+		Mounts:      mounts,
+		ShmSize:     containerConfig.ShmSize,
+	}
+	hostConfig.PidsLimit, hostConfig.Ulimits = dockerLimits(podConfig.Limits)
+
+	resp, err := d.client.ContainerCreate(ctx, &container.Config{
+		Entrypoint: containerConfig.Cmd,
+		Env:        makeEnvSlice(containerConfig.Env),
+		WorkingDir: containerConfig.WorkingDir,
+		Image:      containerConfig.Image,
+		User:       containerConfig.User,
+		Labels:     labels,
+	}, hostConfig, nil, "")
+	if err != nil {
+		return err
+	}
+	containerID := resp.ID
+	// ignore remove error
+	defer func() {
+		_ = d.client.ContainerRemove(ctx, containerID, dockertypes.ContainerRemoveOptions{Force: true})
+	}()
+
+	_, _ = fmt.Fprintf(out, "Executing init container %d (image %q)\n", index, containerConfig.Image)
+	if err := d.client.ContainerStart(ctx, containerID, dockertypes.ContainerStartOptions{}); err != nil {
+		return err
+	}
+
+	var exitCode int64
+	waitCh, errCh := d.client.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case res := <-waitCh:
+		exitCode = res.StatusCode
+	case err := <-errCh:
+		return err
+	}
+
+	logs, err := d.client.ContainerLogs(ctx, containerID, dockertypes.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err == nil {
+		_, _ = stdcopy.StdCopy(out, out, logs)
+		logs.Close()
+	}
+
+	if exitCode != 0 {
+		return errors.Errorf("init container %d (image %q) exited with code %d", index, containerConfig.Image, exitCode)
+	}
+
+	return nil
+}
+
+// startDockerDaemon starts the pod docker daemon container, with the provided
+// container index, in the main container network namespace. It returns the
+// container id and, when not a cached storage, the name of its storage volume
+// that must be removed with the pod.
+func (d *DockerDriver) startDockerDaemon(ctx context.Context, index int, podConfig *PodConfig, maincontainerID string, out io.Writer) (string, string, error) {
+	dd := podConfig.DockerDaemon
+
+	if _, err := d.fetchImage(ctx, dd.Image, podConfig.DockerConfig, out); err != nil {
+		return "", "", err
+	}
+
+	labels := map[string]string{}
+	labels[agolaLabelKey] = agolaLabelValue
+	labels[executorIDKey] = d.executorID
+	labels[podIDKey] = podConfig.ID
+	labels[taskIDKey] = podConfig.TaskID
+	labels[dockerDaemonKey] = "true"
+
+	// keep the lock until the container mounting the cached storage is
+	// created so another pod will see it in use
+	d.dockerDaemonCacheMutex.Lock()
+	defer d.dockerDaemonCacheMutex.Unlock()
+
+	var cacheVolumeName string
+	if dd.CacheKey != "" {
+		var err error
+		cacheVolumeName, err = d.dockerDaemonCacheVolume(ctx, dd, out)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	var podVolumeName string
+	volumeName := cacheVolumeName
+	if volumeName == "" {
+		vol, err := d.client.VolumeCreate(ctx, volume.VolumeCreateBody{Driver: "local", Labels: labels})
+		if err != nil {
+			return "", "", err
+		}
+		podVolumeName = vol.Name
+		volumeName = vol.Name
+	}
+
+	containerLabels := map[string]string{}
+	for k, v := range labels {
+		containerLabels[k] = v
+	}
+	containerLabels[containerIndexKey] = strconv.Itoa(index)
+
+	resp, err := d.client.ContainerCreate(ctx, &container.Config{
+		Image: dd.Image,
+		// an empty certs dir disables tls: the daemon listens on
+		// DockerDaemonHost, only reachable from the pod network namespace
+		Env:    []string{"DOCKER_TLS_CERTDIR="},
+		Labels: containerLabels,
+		Healthcheck: &container.HealthConfig{
+			Test:     []string{"CMD", "docker", "info"},
+			Interval: 1 * time.Second,
+			Timeout:  5 * time.Second,
+		},
+	}, &container.HostConfig{
+		Privileged:  true,
+		NetworkMode: container.NetworkMode(fmt.Sprintf("container:%s", maincontainerID)),
+		Binds:       []string{fmt.Sprintf("%s:%s", volumeName, dockerDaemonStorageDir)},
+		Resources: container.Resources{
+			NanoCPUs: int64(dd.CPU * 1e9),
+			Memory:   dd.Memory,
+		},
+	}, nil, "")
+	if err != nil {
+		return "", podVolumeName, err
+	}
+
+	_, _ = fmt.Fprintf(out, "Starting docker daemon (image %q)\n", dd.Image)
+	if err := d.client.ContainerStart(ctx, resp.ID, dockertypes.ContainerStartOptions{}); err != nil {
+		return "", podVolumeName, err
+	}
+
+	return resp.ID, podVolumeName, nil
+}
+
+// dockerDaemonCacheVolume returns the docker daemon cached storage volume,
+// creating it when it doesn't exist or is older than the cache max age. It
+// returns an empty name when the volume is used by another container.
+func (d *DockerDriver) dockerDaemonCacheVolume(ctx context.Context, dd *DockerDaemon, out io.Writer) (string, error) {
+	name, hash := dockerDaemonCacheVolumeName(d.executorID, dd.CacheKey)
+
+	vol, err := d.client.VolumeInspect(ctx, name)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return "", err
+	}
+	if err == nil {
+		args := filters.NewArgs()
+		args.Add("volume", name)
+		containers, err := d.client.ContainerList(ctx, dockertypes.ContainerListOptions{Filters: args, All: true})
+		if err != nil {
+			return "", err
+		}
+		if len(containers) > 0 {
+			_, _ = fmt.Fprintf(out, "Docker daemon cache in use by another task, using an empty storage\n")
+			return "", nil
+		}
+
+		if !dockerDaemonCacheExpired(vol.CreatedAt, dd.CacheMaxAge, time.Now()) {
+			_, _ = fmt.Fprintf(out, "Reusing docker daemon cache\n")
+			return name, nil
+		}
+		_, _ = fmt.Fprintf(out, "Docker daemon cache expired, recreating it\n")
+		if err := d.client.VolumeRemove(ctx, name, false); err != nil {
+			return "", err
+		}
+	}
+
+	// the cached storage volume doesn't have the pod id label so it's not
+	// removed with the pod or as a dangling resource
+	if _, err := d.client.VolumeCreate(ctx, volume.VolumeCreateBody{Name: name, Driver: "local", Labels: map[string]string{
+		agolaLabelKey:        agolaLabelValue,
+		executorIDKey:        d.executorID,
+		dockerDaemonCacheKey: hash,
+	}}); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// dockerDaemonCacheVolumeName returns the name of the docker daemon cached
+// storage volume of the executor and the hash of the cache key
+func dockerDaemonCacheVolumeName(executorID, cacheKey string) (string, string) {
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(executorID+"/"+cacheKey)))
+	return "agola-dockerdaemon-" + hash[:32], hash
+}
+
+// dockerDaemonCacheExpired reports if a volume with the provided creation time
+// is older than maxAge. A volume with an unparsable creation time is never
+// expired.
+func dockerDaemonCacheExpired(createdAt string, maxAge time.Duration, now time.Time) bool {
+	if maxAge == 0 {
+		return false
+	}
+	creationTime, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return false
+	}
+	return now.Sub(creationTime) > maxAge
+}
+
+// waitDockerDaemon waits for the docker daemon container to be healthy
+func (d *DockerDriver) waitDockerDaemon(ctx context.Context, containerID string) error {
+	ctx, cancel := context.WithTimeout(ctx, dockerDaemonStartTimeout)
+	defer cancel()
+
+	for {
+		c, err := d.client.ContainerInspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+		if !c.State.Running {
+			return errors.Errorf("docker daemon exited with code %d", c.State.ExitCode)
+		}
+		if c.State.Health != nil && c.State.Health.Status == dockertypes.Healthy {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Errorf("docker daemon not ready: %w", ctx.Err())
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+func sharedVolumeName(vol *dockertypes.Volume) string {
+	if vol == nil {
+		return ""
+	}
+	return vol.Name
+}
+
+// dockerLimits returns the docker pids limit and ulimits. The processes started
+// with docker exec inherit the container ulimits.
+func dockerLimits(limits *Limits) (*int64, []*units.Ulimit) {
+	if limits == nil {
+		return nil, nil
+	}
+
+	var pidsLimit *int64
+	if limits.Pids > 0 {
+		pids := limits.Pids
+		pidsLimit = &pids
+	}
+	var ulimits []*units.Ulimit
+	for _, u := range limits.Ulimits {
+		ulimits = append(ulimits, &units.Ulimit{Name: u.Name, Soft: u.Soft, Hard: u.Hard})
+	}
+
+	return pidsLimit, ulimits
+}
+
+// dockerSecurityOpts returns the docker security options applying the security
+// profile. Since the docker api requires the seccomp profile content, a
+// localhost seccomp profile is read from the executor host.
+func dockerSecurityOpts(sp *SecurityProfile) ([]string, error) {
+	if sp == nil {
+		return nil, nil
+	}
+
+	var opts []string
+	switch {
+	case sp.Seccomp == "", sp.Seccomp == SecurityProfileRuntimeDefault:
+	case sp.Seccomp == SecurityProfileUnconfined:
+		opts = append(opts, "seccomp=unconfined")
+	case strings.HasPrefix(sp.Seccomp, SecurityProfileLocalhostPrefix):
+		profile, err := ioutil.ReadFile(strings.TrimPrefix(sp.Seccomp, SecurityProfileLocalhostPrefix))
+		if err != nil {
+			return nil, errors.Errorf("failed to read seccomp profile: %w", err)
+		}
+		opts = append(opts, "seccomp="+string(profile))
+	default:
+		return nil, errors.Errorf("unknown seccomp profile %q", sp.Seccomp)
+	}
+
+	switch {
+	case sp.AppArmor == "", sp.AppArmor == SecurityProfileRuntimeDefault:
+	case sp.AppArmor == SecurityProfileUnconfined:
+		opts = append(opts, "apparmor=unconfined")
+	case strings.HasPrefix(sp.AppArmor, SecurityProfileLocalhostPrefix):
+		opts = append(opts, "apparmor="+strings.TrimPrefix(sp.AppArmor, SecurityProfileLocalhostPrefix))
+	default:
+		return nil, errors.Errorf("unknown apparmor profile %q", sp.AppArmor)
+	}
+
+	return opts, nil
+}
+
+// applyNetworkPolicy applies the network policy iptables rules inside the
+// network namespace of the provided container using a temporary container with
+// the NET_ADMIN capability. The pod containers don't have this capability so
+// they cannot change the rules.
+func (d *DockerDriver) applyNetworkPolicy(ctx context.Context, np *NetworkPolicy, maincontainerID string, out io.Writer) error {
+	if _, err := d.fetchImage(ctx, d.networkPolicyImage, nil, out); err != nil {
+		return err
+	}
+
+	resp, err := d.client.ContainerCreate(ctx, &container.Config{
+		Entrypoint: []string{"/bin/sh", "-c", genIptablesScript(np)},
+		Image:      d.networkPolicyImage,
+	}, &container.HostConfig{
+		NetworkMode: container.NetworkMode(fmt.Sprintf("container:%s", maincontainerID)),
+		CapAdd:      []string{"NET_ADMIN"},
+	}, nil, "")
+	if err != nil {
+		return err
+	}
+	containerID := resp.ID
+	// ignore remove error
+	defer func() {
+		_ = d.client.ContainerRemove(ctx, containerID, dockertypes.ContainerRemoveOptions{Force: true})
+	}()
+
+	if err := d.client.ContainerStart(ctx, containerID, dockertypes.ContainerStartOptions{}); err != nil {
+		return err
+	}
+
+	var exitCode int64
+	waitCh, errCh := d.client.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+	select {
+	case res := <-waitCh:
+		exitCode = res.StatusCode
+	case err := <-errCh:
+		return err
+	}
+
+	if exitCode != 0 {
+		logs, err := d.client.ContainerLogs(ctx, containerID, dockertypes.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+		if err == nil {
+			_, _ = stdcopy.StdCopy(out, out, logs)
+			logs.Close()
+		}
+		return errors.Errorf("network policy container exited with code %d", exitCode)
+	}
+
+	return nil
+}
+
+// checkIptablesNetworkPolicy checks that the pod containers cannot bypass a
+// network policy enforced by iptables rules inside the pod network namespace.
+// Privileged containers, and the docker daemon that is always privileged, have
+// the NET_ADMIN capability and could remove the rules or start containers in
+// other network namespaces.
+func checkIptablesNetworkPolicy(podConfig *PodConfig) error {
+	if podConfig.NetworkPolicy == nil {
+		return nil
+	}
+	if podConfig.DockerDaemon != nil {
+		return errors.Errorf("docker daemon isn't supported with network policy %q", podConfig.NetworkPolicy.Name)
+	}
+	for _, containers := range [][]*ContainerConfig{podConfig.Containers, podConfig.InitContainers} {
+		for _, c := range containers {
+			if c.Privileged {
+				return errors.Errorf("privileged containers aren't supported with network policy %q", podConfig.NetworkPolicy.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// genIptablesScript generates a shell script that rejects all the egress
+// traffic not matching the network policy rules. The iptables command is
+// installed if missing.
+func genIptablesScript(np *NetworkPolicy) string {
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	b.WriteString("command -v iptables >/dev/null 2>&1 || apk add --no-cache iptables >/dev/null\n")
+
+	for _, cmd := range []string{"iptables", "ip6tables"} {
+		ipv6 := cmd == "ip6tables"
+		if ipv6 {
+			// ipv6 could be disabled in the network namespace
+			b.WriteString("if ip6tables -L OUTPUT >/dev/null 2>&1; then\n")
+		}
+		fmt.Fprintf(&b, "%s -A OUTPUT -o lo -j ACCEPT\n", cmd)
+		fmt.Fprintf(&b, "%s -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT\n", cmd)
+		for _, rule := range np.Egress {
+			if isIPv6CIDR(rule.CIDR) != ipv6 {
+				continue
+			}
+			if len(rule.Ports) == 0 {
+				fmt.Fprintf(&b, "%s -A OUTPUT -d %s -j ACCEPT\n", cmd, rule.CIDR)
+				continue
+			}
+			for _, port := range rule.Ports {
+				for _, proto := range []string{"tcp", "udp"} {
+					fmt.Fprintf(&b, "%s -A OUTPUT -d %s -p %s --dport %d -j ACCEPT\n", cmd, rule.CIDR, proto, port)
+				}
+			}
+		}
+		// reject instead of drop so the connections fail fast
+		fmt.Fprintf(&b, "%s -A OUTPUT -p tcp -j REJECT --reject-with tcp-reset\n", cmd)
+		fmt.Fprintf(&b, "%s -A OUTPUT -j REJECT\n", cmd)
+		if ipv6 {
+			b.WriteString("fi\n")
+		}
+	}
+
+	return b.String()
+}
+
+func isIPv6CIDR(cidr string) bool {
+	return strings.Contains(cidr, ":")
 }
 
 func (d *DockerDriver) ExecutorGroup(ctx context.Context) (string, error) {
@@ -395,14 +1151,20 @@ func (d *DockerDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
 		if !ok {
 			// remove pod since some of its containers don't have the right labels
 			delete(podsMap, podID)
+			continue
 		}
 		cIndex, err := strconv.Atoi(cIndexStr)
 		if err != nil {
 			// remove pod since some of its containers don't have the right labels
 			delete(podsMap, podID)
+			continue
 		}
 
-		pod := podsMap[podID]
+		pod, ok := podsMap[podID]
+		if !ok {
+			// pod removed since some of its containers don't have the right labels
+			continue
+		}
 		dContainer := &DockerContainer{
 			Index:     cIndex,
 			Container: container,
@@ -442,6 +1204,14 @@ func (d *DockerDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
 			continue
 		}
 
+		if _, ok := vol.Labels[sharedVolumeKey]; ok {
+			pod.sharedVolumeName = vol.Name
+			continue
+		}
+		if _, ok := vol.Labels[dockerDaemonKey]; ok {
+			pod.dockerDaemonVolumeName = vol.Name
+			continue
+		}
 		pod.toolboxVolumeName = vol.Name
 	}
 
@@ -454,15 +1224,154 @@ func (d *DockerDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
 	return pods, nil
 }
 
+func (d *DockerDriver) GetDanglingResources(ctx context.Context) ([]Resource, error) {
+	pods, err := d.GetPods(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	podIDs := map[string]struct{}{}
+	for _, pod := range pods {
+		podIDs[pod.ID()] = struct{}{}
+	}
+
+	args := filters.NewArgs()
+
+	containers, err := d.client.ContainerList(ctx,
+		dockertypes.ContainerListOptions{
+			Filters: args,
+			All:     true,
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, err := d.client.VolumeList(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, container := range containers {
+		executorID, ok := container.Labels[executorIDKey]
+		if !ok || executorID != d.executorID {
+			// skip container
+			continue
+		}
+		_, isHelper := container.Labels[toolboxVolumeHelperKey]
+		_, isInitContainer := container.Labels[initContainerKey]
+		podID, hasPodID := container.Labels[podIDKey]
+		if !isHelper && !isInitContainer && !hasPodID {
+			// skip container
+			continue
+		}
+		// skip containers of an existing pod
+		if _, ok := podIDs[podID]; hasPodID && ok {
+			continue
+		}
+
+		resources = append(resources, &DockerResource{
+			id:           container.ID,
+			kind:         ResourceKindContainer,
+			executorID:   executorID,
+			taskID:       container.Labels[taskIDKey],
+			creationTime: time.Unix(container.Created, 0),
+			client:       d.client,
+		})
+	}
+
+	for _, vol := range volumes.Volumes {
+		executorID, ok := vol.Labels[executorIDKey]
+		if !ok || executorID != d.executorID {
+			// skip vol
+			continue
+		}
+		podID, ok := vol.Labels[podIDKey]
+		if !ok {
+			// skip vol
+			continue
+		}
+		// skip volumes of an existing pod
+		if _, ok := podIDs[podID]; ok {
+			continue
+		}
+
+		// an unparsable creation time is considered as now so the volume won't
+		// be removed until its task is running
+		creationTime, err := time.Parse(time.RFC3339, vol.CreatedAt)
+		if err != nil {
+			creationTime = time.Now()
+		}
+
+		resources = append(resources, &DockerResource{
+			id:           vol.Name,
+			kind:         ResourceKindVolume,
+			executorID:   executorID,
+			taskID:       vol.Labels[taskIDKey],
+			creationTime: creationTime,
+			client:       d.client,
+		})
+	}
+
+	return resources, nil
+}
+
+type DockerResource struct {
+	id           string
+	kind         ResourceKind
+	executorID   string
+	taskID       string
+	creationTime time.Time
+	client       *client.Client
+}
+
+func (dr *DockerResource) ID() string {
+	return dr.id
+}
+
+func (dr *DockerResource) Kind() ResourceKind {
+	return dr.kind
+}
+
+func (dr *DockerResource) ExecutorID() string {
+	return dr.executorID
+}
+
+func (dr *DockerResource) TaskID() string {
+	return dr.taskID
+}
+
+func (dr *DockerResource) CreationTime() time.Time {
+	return dr.creationTime
+}
+
+func (dr *DockerResource) Remove(ctx context.Context) error {
+	switch dr.kind {
+	case ResourceKindContainer:
+		return dr.client.ContainerRemove(ctx, dr.id, dockertypes.ContainerRemoveOptions{Force: true})
+	case ResourceKindVolume:
+		return dr.client.VolumeRemove(ctx, dr.id, true)
+	default:
+		return errors.Errorf("unknown resource kind %q", dr.kind)
+	}
+}
+
 type DockerPod struct {
 	id                string
 	client            *client.Client
 	labels            map[string]string
 	containers        []*DockerContainer
 	toolboxVolumeName string
+	sharedVolumeName  string
 	executorID        string
 
+	// dockerDaemonVolumeName is the docker daemon storage volume removed with
+	// the pod. It's empty when the docker daemon uses a cached storage.
+	dockerDaemonVolumeName string
+
+	os            types.OS
 	initVolumeDir string
+
+	imagePullStats *ImagePullStats
 }
 
 type DockerContainer struct {
@@ -502,6 +1411,54 @@ func (dp *DockerPod) Stop(ctx context.Context) error {
 	return nil
 }
 
+func (dp *DockerPod) ImagePullStats() *ImagePullStats {
+	return dp.imagePullStats
+}
+
+func (dp *DockerPod) Stats(ctx context.Context) (*PodStats, error) {
+	// without streaming the daemon waits for two samples and reports the
+	// previous cpu stats used to calculate the cpu usage
+	resp, err := dp.client.ContainerStats(ctx, dp.containers[0].ID, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var s dockertypes.StatsJSON
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, err
+	}
+
+	stats := &PodStats{}
+
+	cpuDelta := float64(s.CPUStats.CPUUsage.TotalUsage) - float64(s.PreCPUStats.CPUUsage.TotalUsage)
+	if dp.os == types.OSWindows {
+		// windows reports the cpu usage in 100's of nanoseconds
+		cpuDelta *= 100
+	}
+	if elapsed := s.Read.Sub(s.PreRead); !s.PreRead.IsZero() && elapsed > 0 && cpuDelta > 0 {
+		stats.CPU = cpuDelta / float64(elapsed.Nanoseconds())
+	}
+
+	if dp.os == types.OSWindows {
+		stats.Memory = int64(s.MemoryStats.PrivateWorkingSet)
+	} else {
+		// like the docker cli, don't report the inactive page cache (cgroup v1
+		// and v2 keys)
+		memory := s.MemoryStats.Usage
+		inactive, ok := s.MemoryStats.Stats["total_inactive_file"]
+		if !ok {
+			inactive = s.MemoryStats.Stats["inactive_file"]
+		}
+		if inactive < memory {
+			memory -= inactive
+		}
+		stats.Memory = int64(memory)
+	}
+
+	return stats, nil
+}
+
 func (dp *DockerPod) Remove(ctx context.Context) error {
 	errs := []error{}
 	for _, container := range dp.containers {
@@ -514,6 +1471,16 @@ func (dp *DockerPod) Remove(ctx context.Context) error {
 			errs = append(errs, err)
 		}
 	}
+	if dp.sharedVolumeName != "" {
+		if err := dp.client.VolumeRemove(ctx, dp.sharedVolumeName, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if dp.dockerDaemonVolumeName != "" {
+		if err := dp.client.VolumeRemove(ctx, dp.dockerDaemonVolumeName, true); err != nil {
+			errs = append(errs, err)
+		}
+	}
 	if len(errs) != 0 {
 		return errors.Errorf("remove errors: %v", errs)
 	}
@@ -554,7 +1521,7 @@ func (dp *DockerPod) Exec(ctx context.Context, execConfig *ExecConfig) (Containe
 		return nil, err
 	}
 
-	cmd := []string{filepath.Join(dp.initVolumeDir, "agola-toolbox"), "exec", "-e", string(envj), "-w", execConfig.WorkingDir, "--"}
+	cmd := []string{ToolboxContainerPath(dp.os, dp.initVolumeDir), "exec", "-e", string(envj), "-w", execConfig.WorkingDir, "--"}
 	cmd = append(cmd, execConfig.Cmd...)
 
 	dockerExecConfig := dockertypes.ExecConfig{
@@ -17,8 +17,10 @@ package driver
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -42,7 +44,7 @@ func TestDockerPod(t *testing.T) {
 
 	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
 
-	d, err := NewDockerDriver(logger, "executorid01", toolboxPath)
+	d, err := NewDockerDriver(logger, "executorid01", toolboxPath, "", "")
 	if err != nil {
 		t.Fatalf("unexpected err: %v", err)
 	}
@@ -535,3 +537,362 @@ func TestDockerPod(t *testing.T) {
 		}
 	})
 }
+
+func TestGenIptablesScript(t *testing.T) {
+	tests := []struct {
+		name string
+		np   *NetworkPolicy
+		out  string
+	}{
+		{
+			name: "test deny all",
+			np:   &NetworkPolicy{Name: "untrusted"},
+			out: `set -e
+command -v iptables >/dev/null 2>&1 || apk add --no-cache iptables >/dev/null
+iptables -A OUTPUT -o lo -j ACCEPT
+iptables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+iptables -A OUTPUT -p tcp -j REJECT --reject-with tcp-reset
+iptables -A OUTPUT -j REJECT
+if ip6tables -L OUTPUT >/dev/null 2>&1; then
+ip6tables -A OUTPUT -o lo -j ACCEPT
+ip6tables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+ip6tables -A OUTPUT -p tcp -j REJECT --reject-with tcp-reset
+ip6tables -A OUTPUT -j REJECT
+fi
+`,
+		},
+		{
+			name: "test egress rules",
+			np: &NetworkPolicy{
+				Name: "mirror",
+				Egress: []NetworkPolicyRule{
+					{CIDR: "10.0.0.0/24", Ports: []int{443}},
+					{CIDR: "fd00::/64"},
+				},
+			},
+			out: `set -e
+command -v iptables >/dev/null 2>&1 || apk add --no-cache iptables >/dev/null
+iptables -A OUTPUT -o lo -j ACCEPT
+iptables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+iptables -A OUTPUT -d 10.0.0.0/24 -p tcp --dport 443 -j ACCEPT
+iptables -A OUTPUT -d 10.0.0.0/24 -p udp --dport 443 -j ACCEPT
+iptables -A OUTPUT -p tcp -j REJECT --reject-with tcp-reset
+iptables -A OUTPUT -j REJECT
+if ip6tables -L OUTPUT >/dev/null 2>&1; then
+ip6tables -A OUTPUT -o lo -j ACCEPT
+ip6tables -A OUTPUT -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
+ip6tables -A OUTPUT -d fd00::/64 -j ACCEPT
+ip6tables -A OUTPUT -p tcp -j REJECT --reject-with tcp-reset
+ip6tables -A OUTPUT -j REJECT
+fi
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := genIptablesScript(tt.np)
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestCheckIptablesNetworkPolicy(t *testing.T) {
+	np := &NetworkPolicy{Name: "untrusted"}
+
+	tests := []struct {
+		name      string
+		podConfig *PodConfig
+		err       string
+	}{
+		{
+			name: "test no network policy with privileged container and docker daemon",
+			podConfig: &PodConfig{
+				Containers:   []*ContainerConfig{{Image: "busybox", Privileged: true}},
+				DockerDaemon: &DockerDaemon{Image: "docker:dind"},
+			},
+		},
+		{
+			name: "test network policy",
+			podConfig: &PodConfig{
+				NetworkPolicy: np,
+				Containers:    []*ContainerConfig{{Image: "busybox"}, {Image: "postgres"}},
+			},
+		},
+		{
+			name: "test network policy with privileged container",
+			podConfig: &PodConfig{
+				NetworkPolicy: np,
+				Containers:    []*ContainerConfig{{Image: "busybox"}, {Image: "postgres", Privileged: true}},
+			},
+			err: `privileged containers aren't supported with network policy "untrusted"`,
+		},
+		{
+			name: "test network policy with privileged init container",
+			podConfig: &PodConfig{
+				NetworkPolicy:  np,
+				InitContainers: []*ContainerConfig{{Image: "busybox", Privileged: true}},
+				Containers:     []*ContainerConfig{{Image: "busybox"}},
+			},
+			err: `privileged containers aren't supported with network policy "untrusted"`,
+		},
+		{
+			name: "test network policy with docker daemon",
+			podConfig: &PodConfig{
+				NetworkPolicy: np,
+				Containers:    []*ContainerConfig{{Image: "busybox"}},
+				DockerDaemon:  &DockerDaemon{Image: "docker:dind"},
+			},
+			err: `docker daemon isn't supported with network policy "untrusted"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkIptablesNetworkPolicy(tt.podConfig)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected err %q, got nil", tt.err)
+			}
+			if err.Error() != tt.err {
+				t.Fatalf("expected err %q, got %q", tt.err, err.Error())
+			}
+		})
+	}
+}
+
+func TestDockerSecurityOpts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	seccompProfile := `{"defaultAction":"SCMP_ACT_ERRNO"}`
+	seccompProfilePath := filepath.Join(dir, "seccomp.json")
+	if err := ioutil.WriteFile(seccompProfilePath, []byte(seccompProfile), 0644); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		sp   *SecurityProfile
+		out  []string
+		err  bool
+	}{
+		{
+			name: "test no security profile",
+		},
+		{
+			name: "test runtime default profiles",
+			sp:   &SecurityProfile{Name: "default", Seccomp: "runtime/default", AppArmor: "runtime/default"},
+		},
+		{
+			name: "test unconfined profiles",
+			sp:   &SecurityProfile{Name: "unconfined", Seccomp: "unconfined", AppArmor: "unconfined"},
+			out:  []string{"seccomp=unconfined", "apparmor=unconfined"},
+		},
+		{
+			name: "test localhost profiles",
+			sp:   &SecurityProfile{Name: "hardened", Seccomp: "localhost/" + seccompProfilePath, AppArmor: "localhost/agola-hardened"},
+			out:  []string{"seccomp=" + seccompProfile, "apparmor=agola-hardened"},
+		},
+		{
+			name: "test not existing localhost seccomp profile",
+			sp:   &SecurityProfile{Name: "hardened", Seccomp: "localhost/" + filepath.Join(dir, "notexisting.json")},
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := dockerSecurityOpts(tt.sp)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestParseImagePullOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  *ImagePullStats
+		err  string
+	}{
+		{
+			name: "test image up to date",
+			in: `{"status":"Pulling from library/busybox","id":"latest"}
+{"status":"Digest: sha256:aaaa"}
+{"status":"Status: Image is up to date for busybox:latest"}
+`,
+			out: &ImagePullStats{CacheHit: true, Digest: "sha256:aaaa"},
+		},
+		{
+			name: "test image with cached and downloaded layers",
+			in: `{"status":"Pulling from library/golang","id":"latest"}
+{"status":"Already exists","progressDetail":{},"id":"layer01"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"layer02"}
+{"status":"Pulling fs layer","progressDetail":{},"id":"layer03"}
+{"status":"Downloading","progressDetail":{"current":512,"total":1024},"progress":"[====>  ]","id":"layer02"}
+{"status":"Downloading","progressDetail":{"current":1024,"total":1024},"progress":"[======>]","id":"layer02"}
+{"status":"Downloading","progressDetail":{"current":100,"total":2048},"progress":"[>      ]","id":"layer03"}
+{"status":"Download complete","progressDetail":{},"id":"layer02"}
+{"status":"Download complete","progressDetail":{},"id":"layer03"}
+{"status":"Extracting","progressDetail":{"current":1024,"total":1024},"id":"layer02"}
+{"status":"Pull complete","progressDetail":{},"id":"layer02"}
+{"status":"Pull complete","progressDetail":{},"id":"layer03"}
+{"status":"Digest: sha256:bbbb"}
+{"status":"Status: Downloaded newer image for golang:latest"}
+`,
+			out: &ImagePullStats{PulledBytes: 3072, PulledLayers: 2, CachedLayers: 1, Digest: "sha256:bbbb"},
+		},
+		{
+			name: "test not json output",
+			in:   "not a json output",
+			out:  &ImagePullStats{},
+		},
+		{
+			name: "test pull error",
+			in: `{"status":"Pulling from library/busybox","id":"latest"}
+{"errorDetail":{"message":"manifest for busybox:lates not found: manifest unknown"},"error":"manifest for busybox:lates not found: manifest unknown"}
+`,
+			err: "manifest for busybox:lates not found: manifest unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			stats, err := parseImagePullOutput(bytes.NewBufferString(tt.in), &out)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected err %q, got err: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, stats); diff != "" {
+				t.Error(diff)
+			}
+			if out.String() != tt.in {
+				t.Errorf("expected output %q, got %q", tt.in, out.String())
+			}
+		})
+	}
+}
+
+func TestIsPermanentImagePullError(t *testing.T) {
+	tests := []struct {
+		err       error
+		permanent bool
+	}{
+		{
+			err:       errors.New("Error response from daemon: manifest for busybox:lates not found: manifest unknown: manifest unknown"),
+			permanent: true,
+		},
+		{
+			err:       errors.New("Error response from daemon: pull access denied for privateimage, repository does not exist or may require 'docker login'"),
+			permanent: true,
+		},
+		{
+			err:       errors.New("Error response from daemon: invalid reference format"),
+			permanent: true,
+		},
+		{
+			err:       errors.New("Error response from daemon: Get https://registry-1.docker.io/v2/: net/http: TLS handshake timeout"),
+			permanent: false,
+		},
+		{
+			err:       errors.New("read tcp 10.0.0.1:55306->10.0.0.2:443: read: connection reset by peer"),
+			permanent: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if permanent := isPermanentImagePullError(tt.err); permanent != tt.permanent {
+				t.Errorf("expected permanent %t, got %t", tt.permanent, permanent)
+			}
+		})
+	}
+}
+
+func TestDockerDaemonCacheVolumeName(t *testing.T) {
+	name1, hash1 := dockerDaemonCacheVolumeName("executor01", "project01")
+	name2, _ := dockerDaemonCacheVolumeName("executor01", "project01")
+	name3, _ := dockerDaemonCacheVolumeName("executor02", "project01")
+	name4, _ := dockerDaemonCacheVolumeName("executor01", "project02")
+
+	if name1 != name2 {
+		t.Errorf("expected the same volume name for the same cache key, got %q and %q", name1, name2)
+	}
+	if name1 == name3 || name1 == name4 {
+		t.Errorf("expected different volume names for different executors or cache keys")
+	}
+	if len(hash1) != 64 {
+		t.Errorf("expected a sha256 hex hash, got %q", hash1)
+	}
+}
+
+func TestDockerDaemonCacheExpired(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		createdAt string
+		maxAge    time.Duration
+		expired   bool
+	}{
+		{
+			name:      "no max age",
+			createdAt: "2019-01-01T12:00:00Z",
+			expired:   false,
+		},
+		{
+			name:      "younger than max age",
+			createdAt: "2020-01-01T11:00:00Z",
+			maxAge:    2 * time.Hour,
+			expired:   false,
+		},
+		{
+			name:      "older than max age",
+			createdAt: "2020-01-01T09:00:00Z",
+			maxAge:    2 * time.Hour,
+			expired:   true,
+		},
+		{
+			name:      "unparsable creation time",
+			createdAt: "",
+			maxAge:    2 * time.Hour,
+			expired:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if expired := dockerDaemonCacheExpired(tt.createdAt, tt.maxAge, now); expired != tt.expired {
+				t.Errorf("expected expired %t, got %t", tt.expired, expired)
+			}
+		})
+	}
+}
@@ -19,7 +19,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/executor/registry"
 	"agola.io/agola/services/types"
@@ -38,8 +41,33 @@ const (
 	taskIDKey     = labelPrefix + "taskid"
 
 	containerIndexKey = labelPrefix + "containerindex"
+
+	// toolboxVolumeHelperKey marks the temporary container used to populate
+	// the pod toolbox volume
+	toolboxVolumeHelperKey = labelPrefix + "toolboxvolumehelper"
+
+	// initContainerKey marks the pod init containers and contains their index
+	initContainerKey = labelPrefix + "initcontainer"
+	// sharedVolumeKey marks the volume shared by the pod init containers and
+	// main container
+	sharedVolumeKey = labelPrefix + "sharedvolume"
+
+	// dockerDaemonKey marks the pod docker daemon container and its storage
+	// volume
+	dockerDaemonKey = labelPrefix + "dockerdaemon"
+	// dockerDaemonCacheKey marks a docker daemon storage volume kept between
+	// pods and contains the hash of its cache key
+	dockerDaemonCacheKey = labelPrefix + "dockerdaemoncache"
 )
 
+// DockerDaemonHost is the DOCKER_HOST of the pod docker daemon, listening on
+// the pod network namespace
+const DockerDaemonHost = "tcp://localhost:2375"
+
+// dockerDaemonStorageDir is the docker daemon container dir where its storage
+// volume is mounted
+const dockerDaemonStorageDir = "/var/lib/docker"
+
 // Driver is a generic interface around the pod concept (a group of "containers"
 // sharing, at least, the same network namespace)
 // It's just tailored aroun the need of an executor and should be quite generic
@@ -54,6 +82,36 @@ type Driver interface {
 	ExecutorGroup(ctx context.Context) (string, error)
 	GetExecutors(ctx context.Context) ([]string, error)
 	Archs(ctx context.Context) ([]types.Arch, error)
+	// OS returns the os of the containers executed by the driver
+	OS(ctx context.Context) (types.OS, error)
+	// GetDanglingResources returns the resources created for a pod (like
+	// containers, volumes, secrets) that aren't part of an existing pod, i.e.
+	// leftovers of a pod creation that failed or was interrupted.
+	GetDanglingResources(ctx context.Context) ([]Resource, error)
+}
+
+type ResourceKind string
+
+const (
+	ResourceKindContainer     ResourceKind = "container"
+	ResourceKindVolume        ResourceKind = "volume"
+	ResourceKindSecret        ResourceKind = "secret"
+	ResourceKindNetworkPolicy ResourceKind = "networkpolicy"
+)
+
+type Resource interface {
+	// ID returns the resource id
+	ID() string
+	// Kind returns the resource kind
+	Kind() ResourceKind
+	// ExecutorID return the resource owner executor id
+	ExecutorID() string
+	// TaskID return the resource task id
+	TaskID() string
+	// CreationTime returns the resource creation time
+	CreationTime() time.Time
+	// Remove removes the resource
+	Remove(ctx context.Context) error
 }
 
 type Pod interface {
@@ -69,6 +127,55 @@ type Pod interface {
 	Remove(ctx context.Context) error
 	// Exec executes a command inside the first container in the Pod
 	Exec(ctx context.Context, execConfig *ExecConfig) (ContainerExec, error)
+	// Stats returns the current resource usage of the first container in the
+	// Pod
+	Stats(ctx context.Context) (*PodStats, error)
+	// ImagePullStats returns the pull stats of the first container image in
+	// the Pod or nil when not available
+	ImagePullStats() *ImagePullStats
+}
+
+// ImagePullStats reports the pull of a container image
+type ImagePullStats struct {
+	Image string
+	// CacheHit is true when no layer was downloaded
+	CacheHit bool
+	// PulledBytes is the size of the downloaded layers
+	PulledBytes  int64
+	PulledLayers int
+	CachedLayers int
+	Duration     time.Duration
+	// Digest is the digest of the pulled image manifest (i.e. sha256:...),
+	// it's the exact image used also when pulling by tag
+	Digest string
+}
+
+// ImagePullError is an image pull failure. Permanent errors (i.e. the image
+// doesn't exist or the registry denied the access) aren't retried since they
+// won't be fixed by pulling again.
+type ImagePullError struct {
+	Image     string
+	Permanent bool
+	Err       error
+}
+
+func (e *ImagePullError) Error() string {
+	if e.Permanent {
+		return fmt.Sprintf("failed to pull image %q: %v", e.Image, e.Err)
+	}
+	return fmt.Sprintf("failed to pull image %q after retrying: %v", e.Image, e.Err)
+}
+
+func (e *ImagePullError) Unwrap() error {
+	return e.Err
+}
+
+// PodStats is the resource usage of the pod main container
+type PodStats struct {
+	// CPU is the cpu usage in cores
+	CPU float64
+	// Memory is the memory usage in bytes
+	Memory int64
 }
 
 type ContainerExec interface {
@@ -80,10 +187,104 @@ type PodConfig struct {
 	ID         string
 	TaskID     string
 	Containers []*ContainerConfig
+	OS         types.OS
 	Arch       types.Arch
 	// The container dir where the init volume will be mounted
 	InitVolumeDir string
 	DockerConfig  *registry.DockerConfig
+	// NetworkPolicy, when defined, restricts the egress traffic of all the pod
+	// containers
+	NetworkPolicy *NetworkPolicy
+	// SecurityProfile, when defined, is applied to all the pod containers
+	SecurityProfile *SecurityProfile
+	// GPUs, when defined, are the gpus assigned to the pod main container
+	GPUs *GPUs
+	// InitContainers are executed sequentially, before executing anything in
+	// the pod main container. The pod creation fails if one of them fails.
+	InitContainers []*ContainerConfig
+	// SharedVolumeDir is the container dir where the volume shared by the
+	// init containers and the main container is mounted. It's required when
+	// init containers are defined.
+	SharedVolumeDir string
+	// DockerDaemon, when defined, is a docker daemon dedicated to the pod
+	DockerDaemon *DockerDaemon
+	// Limits, when defined, are the process limits applied to the pod
+	// containers and init containers (not to the docker daemon)
+	Limits *Limits
+}
+
+// Limits defines the max number of processes and the ulimits of a container.
+// Drivers not supporting a pids limit ignore Pids. The k8s driver, since
+// kubernetes doesn't support container ulimits, applies the ulimits only to
+// the processes executed in the main container.
+type Limits struct {
+	// Pids is the max number of processes. 0 means no limit
+	Pids int64
+	// Ulimits are sorted by name
+	Ulimits []Ulimit
+}
+
+// Ulimit is a process resource limit (one of types.ValidUlimits)
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// DockerDaemon defines a privileged docker in docker container, sharing the
+// pod network namespace and listening on DockerDaemonHost. Its storage is
+// removed with the pod unless CacheKey is defined: in this case it's reused by
+// the next pods with the same cache key when not used by another pod.
+// Drivers not supporting cached storages ignore CacheKey.
+type DockerDaemon struct {
+	Image string
+	// CPU is the max number of cpus. 0 means no limit
+	CPU float64
+	// Memory is the max memory in bytes. 0 means no limit
+	Memory int64
+
+	CacheKey string
+	// CacheMaxAge is the max age of a cached storage before being recreated.
+	// 0 means no max age.
+	CacheMaxAge time.Duration
+}
+
+// GPUs defines the number of gpus of the provided type (any type when empty)
+// to assign to a container
+type GPUs struct {
+	Count int
+	Type  string
+}
+
+// NetworkPolicy permits only the egress traffic matching one of its rules.
+// Connections to other destinations are rejected. A network policy without
+// rules denies all the egress traffic.
+type NetworkPolicy struct {
+	Name   string
+	Egress []NetworkPolicyRule
+}
+
+type NetworkPolicyRule struct {
+	CIDR string
+	// Ports are the allowed tcp and udp ports. All the ports are allowed when
+	// empty
+	Ports []int
+}
+
+const (
+	SecurityProfileRuntimeDefault  = "runtime/default"
+	SecurityProfileUnconfined      = "unconfined"
+	SecurityProfileLocalhostPrefix = "localhost/"
+)
+
+// SecurityProfile defines the seccomp and apparmor profiles of the pod
+// containers. The profiles are in the format "runtime/default", "unconfined"
+// or "localhost/<profile>". An empty profile keeps the container runtime
+// default.
+type SecurityProfile struct {
+	Name     string
+	Seccomp  string
+	AppArmor string
 }
 
 type ContainerConfig struct {
@@ -94,6 +295,10 @@ type ContainerConfig struct {
 	User       string
 	Privileged bool
 	Volumes    []Volume
+	// ShmSize is the size in bytes of the container /dev/shm. 0 means the
+	// container runtime default. With kubernetes it's a memory backed
+	// emptyDir volume mounted at /dev/shm.
+	ShmSize int64
 }
 
 type Volume struct {
@@ -117,11 +322,25 @@ type ExecConfig struct {
 	Tty         bool
 }
 
-func toolboxExecPath(toolboxDir string, arch types.Arch) (string, error) {
-	toolboxPath := filepath.Join(toolboxDir, fmt.Sprintf("%s-linux-%s", toolboxPrefix, arch))
+func toolboxExecPath(toolboxDir string, podOS types.OS, arch types.Arch) (string, error) {
+	toolboxName := fmt.Sprintf("%s-%s-%s", toolboxPrefix, types.OSOrDefault(podOS), arch)
+	if podOS == types.OSWindows {
+		toolboxName += ".exe"
+	}
+	toolboxPath := filepath.Join(toolboxDir, toolboxName)
 	_, err := os.Stat(toolboxPath)
 	if err != nil {
 		return "", err
 	}
 	return toolboxPath, nil
 }
+
+// ToolboxContainerPath returns the toolbox path inside a container of the
+// provided os where the init volume is mounted at initVolumeDir. The path uses
+// the container os separator regardless of the executor os.
+func ToolboxContainerPath(podOS types.OS, initVolumeDir string) string {
+	if podOS == types.OSWindows {
+		return strings.TrimSuffix(initVolumeDir, `\`) + `\` + toolboxPrefix + ".exe"
+	}
+	return path.Join(initVolumeDir, toolboxPrefix)
+}
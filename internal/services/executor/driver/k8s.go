@@ -20,7 +20,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -34,10 +33,12 @@ import (
 	"go.uber.org/zap"
 	errors "golang.org/x/xerrors"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	apilabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
@@ -53,6 +54,9 @@ import (
 
 const (
 	mainContainerName = "maincontainer"
+	// dockerDaemonContainerName is the name of the pod docker daemon
+	// container
+	dockerDaemonContainerName = "dockerdaemon"
 
 	configMapName       = "agola-executors-group"
 	executorLeasePrefix = "agola-executor-"
@@ -67,6 +71,23 @@ const (
 	informerResyncInterval     = 10 * time.Second
 
 	k8sLabelArchBeta = "beta.kubernetes.io/arch"
+
+	// k8sGPUResourceName is the extended resource exposed by the nvidia
+	// device plugin
+	k8sGPUResourceName corev1.ResourceName = "nvidia.com/gpu"
+	// k8sLabelGPUProduct is the node label, set by the nvidia gpu feature
+	// discovery, reporting the gpu product
+	k8sLabelGPUProduct = "nvidia.com/gpu.product"
+
+	// k8sSeccompPodAnnotation and k8sAppArmorContainerAnnotationPrefix are
+	// the annotations used to set the pod seccomp profile and the containers
+	// apparmor profiles
+	k8sSeccompPodAnnotation              = "seccomp.security.alpha.kubernetes.io/pod"
+	k8sAppArmorContainerAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io/"
+
+	// k8sMaxImagePullFailures is the number of transient image pull failures
+	// tolerated before failing the pod creation
+	k8sMaxImagePullFailures = 3
 )
 
 type K8sDriver struct {
@@ -93,6 +114,8 @@ type K8sPod struct {
 	restconfig    *restclient.Config
 	client        *kubernetes.Clientset
 	initVolumeDir string
+	// ulimits are applied by the toolbox to the executed processes
+	ulimits []Ulimit
 }
 
 func NewK8sDriver(logger *zap.Logger, executorID, toolboxPath string) (*K8sDriver, error) {
@@ -249,6 +272,11 @@ func (d *K8sDriver) Setup(ctx context.Context) error {
 	return nil
 }
 
+func (d *K8sDriver) OS(ctx context.Context) (types.OS, error) {
+	// only linux nodes are supported
+	return types.OSLinux, nil
+}
+
 func (d *K8sDriver) Archs(ctx context.Context) ([]types.Arch, error) {
 	// TODO(sgotti) use go client listers instead of querying every time
 	nodes, err := d.nodeLister.List(apilabels.SelectorFromSet(nil))
@@ -311,6 +339,9 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 	if len(podConfig.Containers) == 0 {
 		return nil, errors.Errorf("empty container config")
 	}
+	if types.OSOrDefault(podConfig.OS) != types.OSLinux {
+		return nil, errors.Errorf("unsupported pod os %q", podConfig.OS)
+	}
 
 	secretClient := d.client.CoreV1().Secrets(d.namespace)
 	podClient := d.client.CoreV1().Pods(d.namespace)
@@ -347,6 +378,15 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		return nil, err
 	}
 
+	// create the network policy before the pod so the pod containers will never
+	// run without it
+	if podConfig.NetworkPolicy != nil {
+		networkPolicyClient := d.client.NetworkingV1().NetworkPolicies(d.namespace)
+		if _, err := networkPolicyClient.Create(genK8sNetworkPolicy(name, labels, podConfig)); err != nil {
+			return nil, errors.Errorf("failed to create network policy %q: %w", podConfig.NetworkPolicy.Name, err)
+		}
+	}
+
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: d.namespace,
@@ -385,6 +425,52 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		},
 	}
 
+	if len(podConfig.InitContainers) > 0 {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "agolasharedvolume",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	// define the init containers executed after the agola init container
+	for cIndex, containerConfig := range podConfig.InitContainers {
+		c := corev1.Container{
+			Name:            fmt.Sprintf("init%d", cIndex),
+			Image:           containerConfig.Image,
+			Command:         containerConfig.Cmd,
+			Env:             genEnvVars(containerConfig.Env),
+			WorkingDir:      containerConfig.WorkingDir,
+			ImagePullPolicy: corev1.PullAlways,
+			SecurityContext: &corev1.SecurityContext{
+				Privileged: &containerConfig.Privileged,
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      "agolasharedvolume",
+					MountPath: podConfig.SharedVolumeDir,
+				},
+			},
+		}
+
+		for vIndex, cVol := range containerConfig.Volumes {
+			vol, volMount, err := genK8sTmpFSVolume(fmt.Sprintf("initvolume-%d-%d", cIndex, vIndex), cVol)
+			if err != nil {
+				return nil, err
+			}
+			pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+			c.VolumeMounts = append(c.VolumeMounts, volMount)
+		}
+		if containerConfig.ShmSize > 0 {
+			vol, volMount := genK8sShmVolume(fmt.Sprintf("initshm-%d", cIndex), containerConfig.ShmSize)
+			pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+			c.VolumeMounts = append(c.VolumeMounts, volMount)
+		}
+
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers, c)
+	}
+
 	// define containers
 	for cIndex, containerConfig := range podConfig.Containers {
 		var containerName string
@@ -416,47 +502,80 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 					ReadOnly:  true,
 				},
 			}
+			if len(podConfig.InitContainers) > 0 {
+				c.VolumeMounts = append(c.VolumeMounts, corev1.VolumeMount{
+					Name:      "agolasharedvolume",
+					MountPath: podConfig.SharedVolumeDir,
+				})
+			}
+
+			if podConfig.GPUs != nil {
+				c.Resources.Limits = corev1.ResourceList{
+					k8sGPUResourceName: *resource.NewQuantity(int64(podConfig.GPUs.Count), resource.DecimalSI),
+				}
+			}
 		}
 
 		for vIndex, cVol := range containerConfig.Volumes {
-			var vol corev1.Volume
-			var volMount corev1.VolumeMount
-			if cVol.TmpFS != nil {
-				name := fmt.Sprintf("volume-%d-%d", cIndex, vIndex)
-				var sizeLimit *resource.Quantity
-				if cVol.TmpFS.Size != 0 {
-					sizeLimit = resource.NewQuantity(cVol.TmpFS.Size, resource.BinarySI)
-				}
-				vol = corev1.Volume{
-					Name: name,
-					VolumeSource: corev1.VolumeSource{
-						EmptyDir: &corev1.EmptyDirVolumeSource{
-							Medium:    corev1.StorageMediumMemory,
-							SizeLimit: sizeLimit,
-						},
-					},
-				}
-				volMount = corev1.VolumeMount{
-					Name:      name,
-					MountPath: cVol.Path,
-				}
-			} else {
-				return nil, errors.Errorf("missing volume config")
+			vol, volMount, err := genK8sTmpFSVolume(fmt.Sprintf("volume-%d-%d", cIndex, vIndex), cVol)
+			if err != nil {
+				return nil, err
 			}
 
 			pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
 			c.VolumeMounts = append(c.VolumeMounts, volMount)
 		}
+		if containerConfig.ShmSize > 0 {
+			vol, volMount := genK8sShmVolume(fmt.Sprintf("shm-%d", cIndex), containerConfig.ShmSize)
+			pod.Spec.Volumes = append(pod.Spec.Volumes, vol)
+			c.VolumeMounts = append(c.VolumeMounts, volMount)
+		}
 
 		pod.Spec.Containers = append(pod.Spec.Containers, c)
 	}
 
-	if podConfig.Arch != "" {
-		pod.Spec.NodeSelector = map[string]string{
-			d.k8sLabelArch: string(podConfig.Arch),
+	// apply the security profile using the pod annotations
+	if sp := podConfig.SecurityProfile; sp != nil {
+		pod.Annotations = map[string]string{}
+		if sp.Seccomp != "" {
+			pod.Annotations[k8sSeccompPodAnnotation] = sp.Seccomp
+		}
+		if sp.AppArmor != "" {
+			for _, c := range pod.Spec.Containers {
+				pod.Annotations[k8sAppArmorContainerAnnotationPrefix+c.Name] = sp.AppArmor
+			}
+			// skip the agola init container
+			for _, c := range pod.Spec.InitContainers[1:] {
+				pod.Annotations[k8sAppArmorContainerAnnotationPrefix+c.Name] = sp.AppArmor
+			}
 		}
 	}
 
+	// the docker daemon is added after applying the security profile since it
+	// must be executed without restrictions
+	if podConfig.DockerDaemon != nil {
+		if podConfig.DockerDaemon.CacheKey != "" {
+			fmt.Fprintf(out, "docker daemon cache isn't supported, using an empty storage\n")
+		}
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "agoladockerdaemonvolume",
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		})
+		pod.Spec.Containers = append(pod.Spec.Containers, genK8sDockerDaemonContainer(podConfig.DockerDaemon, "agoladockerdaemonvolume"))
+	}
+
+	if podConfig.Arch != "" || (podConfig.GPUs != nil && podConfig.GPUs.Type != "") {
+		pod.Spec.NodeSelector = map[string]string{}
+	}
+	if podConfig.Arch != "" {
+		pod.Spec.NodeSelector[d.k8sLabelArch] = string(podConfig.Arch)
+	}
+	if podConfig.GPUs != nil && podConfig.GPUs.Type != "" {
+		pod.Spec.NodeSelector[k8sLabelGPUProduct] = podConfig.GPUs.Type
+	}
+
 	pod, err = podClient.Create(pod)
 	if err != nil {
 		return nil, err
@@ -469,11 +588,17 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		return nil, err
 	}
 
+	ipw := newK8sImagePullWatcher()
+
 	// wait for init container to be ready
 	for event := range watcher.ResultChan() {
 		switch event.Type {
 		case watch.Modified:
 			pod := event.Object.(*corev1.Pod)
+			if err := ipw.check(pod, out); err != nil {
+				watcher.Stop()
+				return nil, err
+			}
 			if len(pod.Status.InitContainerStatuses) > 0 {
 				if pod.Status.InitContainerStatuses[0].State.Running != nil {
 					watcher.Stop()
@@ -532,7 +657,7 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 	}
 
 	// copy the toolbox for the pod arch
-	toolboxExecPath, err := toolboxExecPath(d.toolboxPath, arch)
+	toolboxExecPath, err := toolboxExecPath(d.toolboxPath, types.OSLinux, arch)
 	if err != nil {
 		return nil, errors.Errorf("failed to get toolbox path for arch %q: %w", arch, err)
 	}
@@ -618,8 +743,18 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		switch event.Type {
 		case watch.Modified:
 			pod := event.Object.(*corev1.Pod)
+			if err := ipw.check(pod, out); err != nil {
+				watcher.Stop()
+				return nil, err
+			}
+			if err := checkK8sInitContainers(pod); err != nil {
+				watcher.Stop()
+				return nil, err
+			}
 			if len(pod.Status.ContainerStatuses) > 0 {
-				if pod.Status.ContainerStatuses[0].State.Running != nil {
+				// also wait for the docker daemon to be ready to accept
+				// connections
+				if pod.Status.ContainerStatuses[0].State.Running != nil && (podConfig.DockerDaemon == nil || k8sContainerReady(pod, dockerDaemonContainerName)) {
 					watcher.Stop()
 				}
 			}
@@ -628,6 +763,11 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		}
 	}
 
+	var ulimits []Ulimit
+	if podConfig.Limits != nil {
+		ulimits = podConfig.Limits.Ulimits
+	}
+
 	return &K8sPod{
 		id:        pod.Name,
 		namespace: pod.Namespace,
@@ -635,9 +775,198 @@ func (d *K8sDriver) NewPod(ctx context.Context, podConfig *PodConfig, out io.Wri
 		restconfig:    d.restconfig,
 		client:        d.client,
 		initVolumeDir: podConfig.InitVolumeDir,
+		ulimits:       ulimits,
 	}, nil
 }
 
+// genK8sDockerDaemonContainer returns the privileged docker daemon container
+// using the volume with the provided name as its storage
+func genK8sDockerDaemonContainer(dd *DockerDaemon, volumeName string) corev1.Container {
+	c := corev1.Container{
+		Name:  dockerDaemonContainerName,
+		Image: dd.Image,
+		// an empty certs dir disables tls: the daemon listens on
+		// DockerDaemonHost, only reachable from the pod network namespace
+		Env:             []corev1.EnvVar{{Name: "DOCKER_TLS_CERTDIR", Value: ""}},
+		ImagePullPolicy: corev1.PullAlways,
+		SecurityContext: &corev1.SecurityContext{
+			Privileged: util.BoolP(true),
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      volumeName,
+				MountPath: dockerDaemonStorageDir,
+			},
+		},
+		ReadinessProbe: &corev1.Probe{
+			Handler: corev1.Handler{
+				Exec: &corev1.ExecAction{Command: []string{"docker", "info"}},
+			},
+			PeriodSeconds:  1,
+			TimeoutSeconds: 5,
+		},
+	}
+	if dd.CPU > 0 || dd.Memory > 0 {
+		c.Resources.Limits = corev1.ResourceList{}
+	}
+	if dd.CPU > 0 {
+		c.Resources.Limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(dd.CPU*1000), resource.DecimalSI)
+	}
+	if dd.Memory > 0 {
+		c.Resources.Limits[corev1.ResourceMemory] = *resource.NewQuantity(dd.Memory, resource.BinarySI)
+	}
+
+	return c
+}
+
+// k8sContainerReady reports if the pod container with the provided name is
+// ready
+func k8sContainerReady(pod *corev1.Pod, name string) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == name {
+			return cs.Ready
+		}
+	}
+	return false
+}
+
+// k8sImagePullWatcher detects the pod containers image pull failures reported
+// by the kubelet. The kubelet retries the failed pulls forever, so the pod
+// creation fails at the first permanent pull error or after
+// k8sMaxImagePullFailures transient ones.
+type k8sImagePullWatcher struct {
+	lastReasons map[string]string
+	failures    map[string]int
+}
+
+func newK8sImagePullWatcher() *k8sImagePullWatcher {
+	return &k8sImagePullWatcher{
+		lastReasons: map[string]string{},
+		failures:    map[string]int{},
+	}
+}
+
+func (w *k8sImagePullWatcher) check(pod *corev1.Pod, out io.Writer) error {
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		var reason, message string
+		if cs.State.Waiting != nil {
+			reason = cs.State.Waiting.Reason
+			message = cs.State.Waiting.Message
+		}
+		lastReason := w.lastReasons[cs.Name]
+		w.lastReasons[cs.Name] = reason
+
+		switch reason {
+		case "InvalidImageName":
+			return &ImagePullError{Image: cs.Image, Permanent: true, Err: errors.New(message)}
+		case "ErrImagePull":
+			err := errors.New(message)
+			if isPermanentImagePullError(err) {
+				return &ImagePullError{Image: cs.Image, Permanent: true, Err: err}
+			}
+			// the kubelet alternates ErrImagePull and ImagePullBackOff, count
+			// every new failure once
+			if lastReason == reason {
+				continue
+			}
+			w.failures[cs.Name]++
+			if w.failures[cs.Name] > k8sMaxImagePullFailures {
+				return &ImagePullError{Image: cs.Image, Err: err}
+			}
+			fmt.Fprintf(out, "Failed to pull image %q, retrying. Error: %s\n", cs.Image, message)
+		}
+	}
+	return nil
+}
+
+// checkK8sInitContainers returns an error if one of the pod init containers
+// failed. Since the pod restart policy is the default one, the kubelet restarts
+// the failed init containers, so also their last termination state is checked.
+func checkK8sInitContainers(pod *corev1.Pod) error {
+	for _, cs := range pod.Status.InitContainerStatuses {
+		if cs.Name == "initcontainer" {
+			continue
+		}
+		for _, t := range []*corev1.ContainerStateTerminated{cs.State.Terminated, cs.LastTerminationState.Terminated} {
+			if t != nil && t.ExitCode != 0 {
+				return errors.Errorf("init container %q (image %q) exited with code %d", cs.Name, cs.Image, t.ExitCode)
+			}
+		}
+	}
+	return nil
+}
+
+func genK8sTmpFSVolume(name string, cVol Volume) (corev1.Volume, corev1.VolumeMount, error) {
+	if cVol.TmpFS == nil {
+		return corev1.Volume{}, corev1.VolumeMount{}, errors.Errorf("missing volume config")
+	}
+
+	var sizeLimit *resource.Quantity
+	if cVol.TmpFS.Size != 0 {
+		sizeLimit = resource.NewQuantity(cVol.TmpFS.Size, resource.BinarySI)
+	}
+	vol := corev1.Volume{
+		Name: name,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				Medium:    corev1.StorageMediumMemory,
+				SizeLimit: sizeLimit,
+			},
+		},
+	}
+	volMount := corev1.VolumeMount{
+		Name:      name,
+		MountPath: cVol.Path,
+	}
+	return vol, volMount, nil
+}
+
+// genK8sShmVolume generates the memory backed volume, mounted at /dev/shm,
+// replacing the container runtime default /dev/shm since kubernetes doesn't
+// provide a way to set its size
+func genK8sShmVolume(name string, size int64) (corev1.Volume, corev1.VolumeMount) {
+	// the volume is always a tmpfs so the error cannot happen
+	vol, volMount, _ := genK8sTmpFSVolume(name, Volume{Path: "/dev/shm", TmpFS: &VolumeTmpFS{Size: size}})
+	return vol, volMount
+}
+
+// genK8sNetworkPolicy generates a k8s network policy, selecting only the pod
+// with the provided pod id, that permits only the egress traffic matching the
+// network policy rules
+func genK8sNetworkPolicy(name string, labels map[string]string, podConfig *PodConfig) *networkingv1.NetworkPolicy {
+	egress := []networkingv1.NetworkPolicyEgressRule{}
+	for _, rule := range podConfig.NetworkPolicy.Egress {
+		egressRule := networkingv1.NetworkPolicyEgressRule{
+			To: []networkingv1.NetworkPolicyPeer{
+				{IPBlock: &networkingv1.IPBlock{CIDR: rule.CIDR}},
+			},
+		}
+		for _, port := range rule.Ports {
+			for _, proto := range []corev1.Protocol{corev1.ProtocolTCP, corev1.ProtocolUDP} {
+				proto := proto
+				port := intstr.FromInt(port)
+				egressRule.Ports = append(egressRule.Ports, networkingv1.NetworkPolicyPort{Protocol: &proto, Port: &port})
+			}
+		}
+		egress = append(egress, egressRule)
+	}
+
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{
+				MatchLabels: map[string]string{podIDKey: podConfig.ID},
+			},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress:      egress,
+		},
+	}
+}
+
 func (d *K8sDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
 	// get all pods for the executor group, also the ones managed by other executors in the same executor group
 	labels := map[string]string{executorsGroupIDKey: d.executorsGroupID}
@@ -668,6 +997,109 @@ func (d *K8sDriver) GetPods(ctx context.Context, all bool) ([]Pod, error) {
 	return pods, nil
 }
 
+func (d *K8sDriver) GetDanglingResources(ctx context.Context) ([]Resource, error) {
+	// get all the resources for the executor group, also the ones managed by other executors in the same executor group
+	labels := map[string]string{executorsGroupIDKey: d.executorsGroupID}
+	selector := apilabels.SelectorFromSet(labels)
+
+	k8sPods, err := d.podLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+	// the pod, its secret and network policy have the same name
+	podNames := map[string]struct{}{}
+	for _, k8sPod := range k8sPods {
+		podNames[k8sPod.Name] = struct{}{}
+	}
+
+	secretClient := d.client.CoreV1().Secrets(d.namespace)
+	secrets, err := secretClient.List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	networkPolicyClient := d.client.NetworkingV1().NetworkPolicies(d.namespace)
+	networkPolicies, err := networkPolicyClient.List(metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []Resource{}
+	for _, secret := range secrets.Items {
+		if _, ok := podNames[secret.Name]; ok {
+			continue
+		}
+		resources = append(resources, &K8sResource{
+			id:           secret.Name,
+			kind:         ResourceKindSecret,
+			namespace:    secret.Namespace,
+			labels:       secret.Labels,
+			creationTime: secret.CreationTimestamp.Time,
+			client:       d.client,
+		})
+	}
+	for _, networkPolicy := range networkPolicies.Items {
+		if _, ok := podNames[networkPolicy.Name]; ok {
+			continue
+		}
+		resources = append(resources, &K8sResource{
+			id:           networkPolicy.Name,
+			kind:         ResourceKindNetworkPolicy,
+			namespace:    networkPolicy.Namespace,
+			labels:       networkPolicy.Labels,
+			creationTime: networkPolicy.CreationTimestamp.Time,
+			client:       d.client,
+		})
+	}
+
+	return resources, nil
+}
+
+type K8sResource struct {
+	id           string
+	kind         ResourceKind
+	namespace    string
+	labels       map[string]string
+	creationTime time.Time
+	client       *kubernetes.Clientset
+}
+
+func (r *K8sResource) ID() string {
+	return r.id
+}
+
+func (r *K8sResource) Kind() ResourceKind {
+	return r.kind
+}
+
+func (r *K8sResource) ExecutorID() string {
+	return r.labels[executorIDKey]
+}
+
+func (r *K8sResource) TaskID() string {
+	return r.labels[taskIDKey]
+}
+
+func (r *K8sResource) CreationTime() time.Time {
+	return r.creationTime
+}
+
+func (r *K8sResource) Remove(ctx context.Context) error {
+	var err error
+	switch r.kind {
+	case ResourceKindSecret:
+		err = r.client.CoreV1().Secrets(r.namespace).Delete(r.id, &metav1.DeleteOptions{})
+	case ResourceKindNetworkPolicy:
+		err = r.client.NetworkingV1().NetworkPolicies(r.namespace).Delete(r.id, &metav1.DeleteOptions{})
+	default:
+		return errors.Errorf("unknown resource kind %q", r.kind)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
 func (p *K8sPod) ID() string {
 	return p.id
 }
@@ -690,6 +1122,11 @@ func (p *K8sPod) Stop(ctx context.Context) error {
 	if err := podClient.Delete(p.id, &metav1.DeleteOptions{GracePeriodSeconds: &d}); err != nil {
 		return err
 	}
+	// the network policy exists only if required by the pod config
+	networkPolicyClient := p.client.NetworkingV1().NetworkPolicies(p.namespace)
+	if err := networkPolicyClient.Delete(p.id, &metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
 	return nil
 }
 
@@ -697,6 +1134,55 @@ func (p *K8sPod) Remove(ctx context.Context) error {
 	return p.Stop(ctx)
 }
 
+// k8sPodMetrics is the subset of the metrics api pod metrics used to get the
+// pod containers resource usage
+type k8sPodMetrics struct {
+	Containers []struct {
+		Name  string              `json:"name"`
+		Usage corev1.ResourceList `json:"usage"`
+	} `json:"containers"`
+}
+
+// ImagePullStats returns nil since the images are pulled by the kubelet that
+// doesn't report the pull details
+func (p *K8sPod) ImagePullStats() *ImagePullStats {
+	return nil
+}
+
+// Stats returns the main container resource usage reported by the metrics api
+// (it requires a metrics server, like metrics-server, installed in the cluster)
+func (p *K8sPod) Stats(ctx context.Context) (*PodStats, error) {
+	data, err := p.client.Discovery().RESTClient().
+		Get().
+		Context(ctx).
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", p.namespace, "pods", p.id).
+		DoRaw()
+	if err != nil {
+		return nil, errors.Errorf("failed to get pod metrics: %w", err)
+	}
+
+	var metrics k8sPodMetrics
+	if err := json.Unmarshal(data, &metrics); err != nil {
+		return nil, errors.Errorf("failed to unmarshal pod metrics: %w", err)
+	}
+
+	for _, c := range metrics.Containers {
+		if c.Name != mainContainerName {
+			continue
+		}
+		stats := &PodStats{}
+		if cpu, ok := c.Usage[corev1.ResourceCPU]; ok {
+			stats.CPU = float64(cpu.MilliValue()) / 1000
+		}
+		if memory, ok := c.Usage[corev1.ResourceMemory]; ok {
+			stats.Memory = memory.Value()
+		}
+		return stats, nil
+	}
+
+	return nil, errors.Errorf("no metrics for pod %q main container", p.id)
+}
+
 type K8sContainerExec struct {
 	endCh chan error
 
@@ -717,7 +1203,11 @@ func (p *K8sPod) Exec(ctx context.Context, execConfig *ExecConfig) (ContainerExe
 	if err != nil {
 		return nil, err
 	}
-	cmd := []string{filepath.Join(p.initVolumeDir, "agola-toolbox"), "exec", "-e", string(envj), "-w", execConfig.WorkingDir, "--"}
+	cmd := []string{ToolboxContainerPath(types.OSLinux, p.initVolumeDir), "exec", "-e", string(envj), "-w", execConfig.WorkingDir}
+	for _, u := range p.ulimits {
+		cmd = append(cmd, "--ulimit", fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard))
+	}
+	cmd = append(cmd, "--")
 	cmd = append(cmd, execConfig.Cmd...)
 
 	req := coreclient.RESTClient().
@@ -17,6 +17,9 @@ package executor
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -25,23 +28,32 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"agola.io/agola/internal/common"
 	slog "agola.io/agola/internal/log"
+	"agola.io/agola/internal/reports"
 	"agola.io/agola/internal/services/config"
 	"agola.io/agola/internal/services/executor/driver"
 	"agola.io/agola/internal/services/executor/registry"
+	"agola.io/agola/internal/taskoutputs"
+	"agola.io/agola/internal/tracing"
 	"agola.io/agola/internal/util"
 	rsclient "agola.io/agola/services/runservice/client"
 	"agola.io/agola/services/runservice/types"
+	ctypes "agola.io/agola/services/types"
 	uuid "github.com/satori/go.uuid"
 
 	"github.com/gorilla/mux"
 	sockaddr "github.com/hashicorp/go-sockaddr"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	errors "golang.org/x/xerrors"
@@ -54,12 +66,77 @@ var log = logger.Sugar()
 const (
 	defaultShell = "/bin/sh -e"
 
+	defaultStopSignal = "SIGTERM"
+	// defaultStopGracePeriod is the grace period used when the task defines
+	// only the stop signal
+	defaultStopGracePeriod = 10 * time.Second
+
 	toolboxContainerDir = "/mnt/agola"
+	// windows containers don't have a /mnt dir and require a drive letter
+	toolboxWindowsContainerDir = `C:\agola`
+
+	// sharedContainerDir is where the volume shared by the task init
+	// containers and main container is mounted
+	sharedContainerDir = "/agola/shared"
+	// filesContainerDir is where the memory backed volume containing the task
+	// files is mounted in the main container
+	filesContainerDir = "/agola/files"
+	// buildkitTLSContainerDir is where the memory backed volume containing
+	// the buildkit daemon client tls files is mounted in the main container
+	buildkitTLSContainerDir = "/agola/buildkit"
+
+	// outputsContainerDir is the main container dir containing the task
+	// outputs files
+	outputsContainerDir = "/tmp"
+	// windows containers don't have a /tmp dir
+	outputsWindowsContainerDir = `C:\Windows\Temp`
+
+	// batchPodIdleTimeout is the time a batch task pod is kept waiting for the
+	// next task of the same batch
+	batchPodIdleTimeout = 1 * time.Minute
 )
 
-var (
-	toolboxContainerPath = filepath.Join(toolboxContainerDir, "/agola-toolbox")
-)
+// taskToolboxDir returns the container dir where the toolbox volume is mounted
+// for the task containers os
+func taskToolboxDir(t *types.ExecutorTask) string {
+	if t.Spec.OS == ctypes.OSWindows {
+		return toolboxWindowsContainerDir
+	}
+	return toolboxContainerDir
+}
+
+func taskToolboxPath(t *types.ExecutorTask) string {
+	return driver.ToolboxContainerPath(t.Spec.OS, taskToolboxDir(t))
+}
+
+// taskOutputsPath returns the path of the file where the task steps write the
+// task outputs. It contains the task id since a batch pod executes multiple
+// tasks.
+func taskOutputsPath(t *types.ExecutorTask) string {
+	if t.Spec.OS == ctypes.OSWindows {
+		return outputsWindowsContainerDir + `\agola-outputs-` + t.ID
+	}
+	return path.Join(outputsContainerDir, "agola-outputs-"+t.ID)
+}
+
+// shellScriptSuffix returns the step command file suffix required by the shell
+// to execute it. Windows shells choose how to execute a file from its
+// extension.
+func shellScriptSuffix(shell string) string {
+	args := strings.Fields(shell)
+	if len(args) == 0 {
+		return ""
+	}
+	name := strings.ToLower(path.Base(strings.Replace(args[0], `\`, "/", -1)))
+	name = strings.TrimSuffix(name, ".exe")
+	switch name {
+	case "powershell", "pwsh":
+		return ".ps1"
+	case "cmd":
+		return ".cmd"
+	}
+	return ""
+}
 
 func (e *Executor) getAllPods(ctx context.Context, all bool) ([]driver.Pod, error) {
 	return e.driver.GetPods(ctx, all)
@@ -75,8 +152,11 @@ func stepUser(t *types.ExecutorTask) string {
 	return user
 }
 
-func (e *Executor) createFile(ctx context.Context, pod driver.Pod, command, user string, outf io.Writer) (string, error) {
-	cmd := []string{toolboxContainerPath, "createfile"}
+func (e *Executor) createFile(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, command, user, suffix string, outf io.Writer) (string, error) {
+	cmd := []string{taskToolboxPath(t), "createfile"}
+	if suffix != "" {
+		cmd = append(cmd, "--suffix", suffix)
+	}
 
 	var buf bytes.Buffer
 	execConfig := &driver.ExecConfig{
@@ -109,7 +189,63 @@ func (e *Executor) createFile(ctx context.Context, pod driver.Pod, command, user
 	return buf.String(), nil
 }
 
-func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, error) {
+// stepLogWriter writes the step output to the step log up to maxSize bytes.
+// When exceeded it writes a truncation notice and discards the remaining
+// output, so the step log (and its live stream) stops growing. The output is
+// discarded instead of returning an error to not block the step process.
+type stepLogWriter struct {
+	sync.Mutex
+	w        io.Writer
+	maxSize  int64
+	size     int64
+	exceeded bool
+}
+
+func newStepLogWriter(w io.Writer, maxSize int64) *stepLogWriter {
+	return &stepLogWriter{w: w, maxSize: maxSize}
+}
+
+func (l *stepLogWriter) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.exceeded {
+		return len(p), nil
+	}
+	if l.maxSize <= 0 || l.size+int64(len(p)) <= l.maxSize {
+		n, err := l.w.Write(p)
+		l.size += int64(n)
+		return n, err
+	}
+
+	n, err := l.w.Write(p[:l.maxSize-l.size])
+	l.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	l.exceeded = true
+	if _, err := fmt.Fprintf(l.w, "\nStep log truncated since it exceeded the max size of %d bytes. The remaining output will be discarded.\n", l.maxSize); err != nil {
+		return n, err
+	}
+	return len(p), nil
+}
+
+func (l *stepLogWriter) Exceeded() bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.exceeded
+}
+
+// maxStepLogSize returns the task max step log size, the executor default is
+// used when not overridden by the task
+func (e *Executor) maxStepLogSize(t *types.ExecutorTask) int64 {
+	if t.Spec.MaxStepLogSize > 0 {
+		return t.Spec.MaxStepLogSize
+	}
+	return e.c.MaxStepLogSize
+}
+
+func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.ExecutorTask, pod driver.Pod, stepIndex int, logPath string) (int, error) {
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
 		return -1, err
 	}
@@ -119,6 +255,16 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 	}
 	defer outf.Close()
 
+	var out io.Writer = outf
+	if e.logForwarder != nil {
+		fw := e.logForwarder.stepWriter(t, stepIndex, s.Name)
+		defer fw.Close()
+		out = io.MultiWriter(outf, fw)
+	}
+
+	maxLogSize := e.maxStepLogSize(t)
+	logw := newStepLogWriter(out, maxLogSize)
+
 	// TODO(sgotti) this line is used only for old runconfig versions that don't
 	// set a task default shell in the runconfig
 	shell := defaultShell
@@ -130,18 +276,32 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 	}
 
 	var cmd []string
-	if s.Command != "" {
-		filename, err := e.createFile(ctx, pod, s.Command, stepUser(t), outf)
+	switch {
+	case s.Script != "":
+		// the toolbox will execute the script with its shebang interpreter or
+		// with the shell
+		cmd = []string{taskToolboxPath(t), "script", "--shell", shell, "--", s.Script}
+	case len(s.CommandArgs) > 0:
+		// exec form, execute the command as is without wrapping it in a shell
+		cmd = s.CommandArgs
+	case s.Command != "":
+		filename, err := e.createFile(ctx, t, pod, s.Command, stepUser(t), shellScriptSuffix(shell), outf)
 		if err != nil {
 			return -1, errors.Errorf("create file err: %v", err)
 		}
 
 		args := strings.Split(shell, " ")
 		cmd = append(args, filename)
-	} else {
+	default:
 		cmd = strings.Split(shell, " ")
 	}
 
+	if s.Background {
+		// the toolbox writes the command pid, so it could be stopped later, and
+		// makes it a process group leader to also stop its childs
+		cmd = append([]string{taskToolboxPath(t), "exec", "--pid-file", backgroundStepPidPath(t, stepIndex), "--"}, cmd...)
+	}
+
 	// override task working dir with runstep working dir if provided
 	workingDir := t.Spec.WorkingDir
 	if s.WorkingDir != "" {
@@ -156,6 +316,7 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 	for envName, envValue := range s.Environment {
 		environment[envName] = envValue
 	}
+	environment[taskoutputs.EnvVar] = taskOutputsPath(t)
 
 	workingDir, err = e.expandDir(ctx, t, pod, outf, workingDir)
 	if err != nil {
@@ -169,8 +330,8 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 		WorkingDir:  workingDir,
 		User:        stepUser(t),
 		AttachStdin: true,
-		Stdout:      outf,
-		Stderr:      outf,
+		Stdout:      logw,
+		Stderr:      logw,
 		Tty:         *s.Tty,
 	}
 
@@ -184,34 +345,38 @@ func (e *Executor) doRunStep(ctx context.Context, s *types.RunStep, t *types.Exe
 		return -1, err
 	}
 
+	if exitCode == 0 && logw.Exceeded() && e.c.FailStepOnLogSizeExceeded {
+		return -1, errors.Errorf("step log exceeded the max size of %d bytes", maxLogSize)
+	}
+
 	return exitCode, nil
 }
 
-func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWorkspaceStep, t *types.ExecutorTask, pod driver.Pod, logPath string, archivePath string) (int, error) {
-	cmd := []string{toolboxContainerPath, "archive"}
+func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWorkspaceStep, t *types.ExecutorTask, pod driver.Pod, logPath string, archivePath string) (int, int64, error) {
+	cmd := []string{taskToolboxPath(t), "archive"}
 
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
+		return -1, 0, err
 	}
 	logf, err := os.Create(logPath)
 	if err != nil {
-		return -1, err
+		return -1, 0, err
 	}
 	defer logf.Close()
 
 	if err := os.MkdirAll(filepath.Dir(archivePath), 0770); err != nil {
-		return -1, err
+		return -1, 0, err
 	}
 	archivef, err := os.Create(archivePath)
 	if err != nil {
-		return -1, err
+		return -1, 0, err
 	}
 	defer archivef.Close()
 
 	workingDir, err := e.expandDir(ctx, t, pod, logf, t.Spec.WorkingDir)
 	if err != nil {
 		_, _ = logf.WriteString(fmt.Sprintf("failed to expand working dir %q. Error: %s\n", t.Spec.WorkingDir, err))
-		return -1, err
+		return -1, 0, err
 	}
 
 	execConfig := &driver.ExecConfig{
@@ -226,7 +391,7 @@ func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWor
 
 	ce, err := pod.Exec(ctx, execConfig)
 	if err != nil {
-		return -1, err
+		return -1, 0, err
 	}
 
 	type ArchiveInfo struct {
@@ -263,15 +428,224 @@ func (e *Executor) doSaveToWorkspaceStep(ctx context.Context, s *types.SaveToWor
 
 	exitCode, err := ce.Wait(ctx)
 	if err != nil {
-		return -1, err
+		return -1, 0, err
 	}
 
-	return exitCode, nil
+	fi, err := archivef.Stat()
+	if err != nil {
+		return -1, 0, err
+	}
+	workspaceArchiveSize.Observe(float64(fi.Size()))
+
+	return exitCode, fi.Size(), nil
+}
+
+// maxReportArchiveSize is the max size of the archive containing the files of
+// a task report
+const maxReportArchiveSize = 10 * 1024 * 1024
+
+// collectTaskReports archives the report files of every task report and
+// parses them into a report summary. A failure collecting a report is recorded
+// in its summary and doesn't fail the task.
+func (e *Executor) collectTaskReports(ctx context.Context, t *types.ExecutorTask, pod driver.Pod) []*types.ReportSummary {
+	summaries := make([]*types.ReportSummary, 0, len(t.Spec.Reports))
+	for _, report := range t.Spec.Reports {
+		summary, err := e.collectTaskReport(ctx, t, pod, report)
+		if err != nil {
+			summary = &types.ReportSummary{
+				Format: report.Format,
+				Path:   report.Path,
+				Error:  err.Error(),
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries
+}
+
+func (e *Executor) collectTaskReport(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, report *types.Report) (*types.ReportSummary, error) {
+	cmd := []string{taskToolboxPath(t), "archive"}
+
+	stdout := util.NewLimitedBuffer(maxReportArchiveSize)
+	stderr := util.NewLimitedBuffer(64 * 1024)
+
+	workingDir, err := e.expandDir(ctx, t, pod, stderr, t.Spec.WorkingDir)
+	if err != nil {
+		return nil, errors.Errorf("failed to expand working dir %q: %w", t.Spec.WorkingDir, err)
+	}
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		Env:         t.Spec.Environment,
+		WorkingDir:  workingDir,
+		User:        stepUser(t),
+		AttachStdin: true,
+		Stdout:      stdout,
+		Stderr:      stderr,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	type ArchiveInfo struct {
+		SourceDir string
+		DestDir   string
+		Paths     []string
+	}
+	type Archive struct {
+		ArchiveInfos []*ArchiveInfo
+		OutFile      string
+	}
+
+	a := &Archive{
+		OutFile: "", // use stdout
+		ArchiveInfos: []*ArchiveInfo{
+			{
+				SourceDir: workingDir,
+				DestDir:   "",
+				Paths:     []string{report.Path},
+			},
+		},
+	}
+
+	stdin := ce.Stdin()
+	enc := json.NewEncoder(stdin)
+
+	go func() {
+		_ = enc.Encode(a)
+		stdin.Close()
+	}()
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, errors.Errorf("archive ended with exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	return reports.ParseArchive(report, stdout), nil
+}
+
+// collectTaskOutputs reads and parses the task outputs file written by the
+// task steps
+func (e *Executor) collectTaskOutputs(ctx context.Context, t *types.ExecutorTask, pod driver.Pod) (map[string]string, error) {
+	cmd := []string{taskToolboxPath(t), "readfile", "--max-size", strconv.Itoa(taskoutputs.MaxSize), taskOutputsPath(t)}
+
+	stdout := util.NewLimitedBuffer(taskoutputs.MaxSize)
+	stderr := util.NewLimitedBuffer(64 * 1024)
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		User:        stepUser(t),
+		AttachStdin: true,
+		Stdout:      stdout,
+		Stderr:      stderr,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, errors.Errorf("readfile ended with exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+
+	outputs, err := taskoutputs.Parse(stdout.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) == 0 {
+		return nil, nil
+	}
+	return outputs, nil
+}
+
+// pidsEventsPaths are the cgroup v2 and v1 files reporting the number of
+// processes creations rejected by the pids limit
+var pidsEventsPaths = []string{"/sys/fs/cgroup/pids.events", "/sys/fs/cgroup/pids/pids.events"}
+
+// pidsMaxEvents returns the number of processes creations rejected by the pids
+// limit of the pod main container
+func (e *Executor) pidsMaxEvents(ctx context.Context, t *types.ExecutorTask, pod driver.Pod) (int64, error) {
+	for _, p := range pidsEventsPaths {
+		cmd := []string{taskToolboxPath(t), "readfile", "--max-size", "4096", p}
+
+		stdout := util.NewLimitedBuffer(4096)
+		stderr := util.NewLimitedBuffer(4096)
+
+		execConfig := &driver.ExecConfig{
+			Cmd:         cmd,
+			User:        stepUser(t),
+			AttachStdin: true,
+			Stdout:      stdout,
+			Stderr:      stderr,
+		}
+
+		ce, err := pod.Exec(ctx, execConfig)
+		if err != nil {
+			return 0, err
+		}
+		exitCode, err := ce.Wait(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if exitCode != 0 {
+			return 0, errors.Errorf("readfile ended with exit code %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+		}
+
+		// a missing file is returned empty
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "max" {
+				return strconv.ParseInt(fields[1], 10, 64)
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+// checkPidsLimit reports if the task processes creations have been rejected by
+// the pids limit since the last check. In this case the reason is also written
+// to the step log.
+func (e *Executor) checkPidsLimit(ctx context.Context, rt *runningTask, pod driver.Pod, logPath string) bool {
+	if rt.pidsLimit == 0 {
+		return false
+	}
+
+	n, err := e.pidsMaxEvents(ctx, rt.et, pod)
+	if err != nil {
+		log.Warnf("failed to read pids limit events: %+v", err)
+		return false
+	}
+	if n <= rt.pidsMaxEvents {
+		return false
+	}
+	rt.pidsMaxEvents = n
+
+	outf, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		log.Errorf("failed to open step log: %+v", err)
+		return true
+	}
+	defer outf.Close()
+	_, _ = outf.WriteString(fmt.Sprintf("\nThe task reached its pids limit of %d processes: new processes couldn't be created.\n", rt.pidsLimit))
+
+	return true
 }
 
 func (e *Executor) expandDir(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, dir string) (string, error) {
 	args := []string{dir}
-	cmd := append([]string{toolboxContainerPath, "expanddir"}, args...)
+	cmd := append([]string{taskToolboxPath(t), "expanddir"}, args...)
 
 	// limit the template answer to max 1MiB
 	stdout := &bytes.Buffer{}
@@ -301,9 +675,14 @@ func (e *Executor) expandDir(ctx context.Context, t *types.ExecutorTask, pod dri
 	return stdout.String(), nil
 }
 
-func (e *Executor) mkdir(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, dir string) error {
+// mkdir creates the dir. When clean is true the dir, if existing, is removed
+// before creating it.
+func (e *Executor) mkdir(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, dir string, clean bool) error {
 	args := []string{dir}
-	cmd := append([]string{toolboxContainerPath, "mkdir"}, args...)
+	if clean {
+		args = append([]string{"--clean"}, args...)
+	}
+	cmd := append([]string{taskToolboxPath(t), "mkdir"}, args...)
 
 	execConfig := &driver.ExecConfig{
 		Cmd:         cmd,
@@ -330,8 +709,44 @@ func (e *Executor) mkdir(ctx context.Context, t *types.ExecutorTask, pod driver.
 	return nil
 }
 
+// writeFile writes the task file content to filename, inside the task files
+// volume, and links it at the task file path. The content is passed via stdin
+// so it won't be reported in the logs.
+func (e *Executor) writeFile(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, f *types.TaskFile, filename string) error {
+	cmd := []string{taskToolboxPath(t), "writefile", "--mode", strconv.FormatUint(uint64(f.Mode.Perm()), 8), "--link", f.Path, filename}
+
+	execConfig := &driver.ExecConfig{
+		Cmd:         cmd,
+		User:        stepUser(t),
+		AttachStdin: true,
+		Stdout:      logf,
+		Stderr:      logf,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return err
+	}
+
+	stdin := ce.Stdin()
+	go func() {
+		_, _ = io.WriteString(stdin, f.Content)
+		stdin.Close()
+	}()
+
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return errors.Errorf("writefile ended with exit code %d", exitCode)
+	}
+
+	return nil
+}
+
 func (e *Executor) template(ctx context.Context, t *types.ExecutorTask, pod driver.Pod, logf io.Writer, key string) (string, error) {
-	cmd := []string{toolboxContainerPath, "template"}
+	cmd := []string{taskToolboxPath(t), "template"}
 
 	// limit the template answer to max 1MiB
 	stdout := util.NewLimitedBuffer(1024 * 1024)
@@ -382,7 +797,7 @@ func (e *Executor) unarchive(ctx context.Context, t *types.ExecutorTask, source
 	if removeDestDir {
 		args = append(args, "--remove-destdir")
 	}
-	cmd := append([]string{toolboxContainerPath, "unarchive"}, args...)
+	cmd := append([]string{taskToolboxPath(t), "unarchive"}, args...)
 
 	workingDir, err := e.expandDir(ctx, t, pod, logf, t.Spec.WorkingDir)
 	if err != nil {
@@ -451,15 +866,15 @@ func (e *Executor) doRestoreWorkspaceStep(ctx context.Context, s *types.RestoreW
 	return 0, nil
 }
 
-func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string, archivePath string) (int, error) {
-	cmd := []string{toolboxContainerPath, "archive"}
+func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string, archivePath string) (int, *types.StepCache, error) {
+	cmd := []string{taskToolboxPath(t), "archive"}
 
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	logf, err := os.Create(logPath)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	defer logf.Close()
 
@@ -468,7 +883,7 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 	// calculate key from template
 	userKey, err := e.template(ctx, t, pod, logf, s.Key)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	fmt.Fprintf(logf, "cache key %q\n", userKey)
 
@@ -485,28 +900,31 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 		} else {
 			// TODO(sgotti) retry before giving up
 			fmt.Fprintf(logf, "error checking for cache key %q: %v\n", userKey, err)
-			return -1, err
+			return -1, nil, err
 		}
 	}
+	cache := &types.StepCache{Type: types.StepCacheTypeSave, Key: userKey}
 	if !save {
 		fmt.Fprintf(logf, "cache for key %q already exists\n", userKey)
-		return 0, nil
+		cache.Hit = true
+		cacheOperationsCounter.WithLabelValues(string(cache.Type), "hit").Inc()
+		return 0, cache, nil
 	}
 
 	fmt.Fprintf(logf, "archiving cache with key %q\n", userKey)
 	if err := os.MkdirAll(filepath.Dir(archivePath), 0770); err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	archivef, err := os.Create(archivePath)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	defer archivef.Close()
 
 	workingDir, err := e.expandDir(ctx, t, pod, logf, t.Spec.WorkingDir)
 	if err != nil {
 		_, _ = io.WriteString(logf, fmt.Sprintf("failed to expand working dir %q. Error: %s\n", t.Spec.WorkingDir, err))
-		return -1, err
+		return -1, nil, err
 	}
 
 	execConfig := &driver.ExecConfig{
@@ -521,7 +939,7 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 
 	ce, err := pod.Exec(ctx, execConfig)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 
 	type ArchiveInfo struct {
@@ -558,49 +976,57 @@ func (e *Executor) doSaveCacheStep(ctx context.Context, s *types.SaveCacheStep,
 
 	exitCode, err := ce.Wait(ctx)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 
 	if exitCode != 0 {
-		return exitCode, errors.Errorf("save cache archiving command ended with exit code %d", exitCode)
+		return exitCode, nil, errors.Errorf("save cache archiving command ended with exit code %d", exitCode)
 	}
 
 	f, err := os.Open(archivePath)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	fi, err := f.Stat()
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 
 	// send cache archive to scheduler
 	if resp, err := e.runserviceClient.PutCache(ctx, key, fi.Size(), f); err != nil {
 		if resp != nil && resp.StatusCode == http.StatusNotModified {
-			return exitCode, nil
+			// the cache has been concurrently saved by another task
+			cache.Hit = true
+			cacheOperationsCounter.WithLabelValues(string(cache.Type), "hit").Inc()
+			return exitCode, cache, nil
 		}
-		return -1, err
+		return -1, nil, err
 	}
+	cache.Size = fi.Size()
+	cacheOperationsCounter.WithLabelValues(string(cache.Type), "miss").Inc()
+	cacheBytesCounter.WithLabelValues(string(cache.Type)).Add(float64(cache.Size))
 
-	return exitCode, nil
+	return exitCode, cache, nil
 }
 
-func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, error) {
+func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCacheStep, t *types.ExecutorTask, pod driver.Pod, logPath string) (int, *types.StepCache, error) {
 	if err := os.MkdirAll(filepath.Dir(logPath), 0770); err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	logf, err := os.Create(logPath)
 	if err != nil {
-		return -1, err
+		return -1, nil, err
 	}
 	defer logf.Close()
 
+	cache := &types.StepCache{Type: types.StepCacheTypeRestore}
+
 	fmt.Fprintf(logf, "restoring cache: %s\n", util.Dump(s))
 	for _, key := range s.Keys {
 		// calculate key from template
 		userKey, err := e.template(ctx, t, pod, logf, key)
 		if err != nil {
-			return -1, err
+			return -1, nil, err
 		}
 		fmt.Fprintf(logf, "cache key %q\n", userKey)
 
@@ -616,21 +1042,45 @@ func (e *Executor) doRestoreCacheStep(ctx context.Context, s *types.RestoreCache
 			}
 			// TODO(sgotti) retry before giving up
 			fmt.Fprintf(logf, "error reading cache: %v\n", err)
-			return -1, err
+			return -1, nil, err
 		}
 		fmt.Fprintf(logf, "restoring cache with key %q\n", userKey)
 		cachef := resp.Body
-		if err := e.unarchive(ctx, t, cachef, pod, logf, s.DestDir, false, false); err != nil {
+		cr := &countingReader{r: cachef}
+		if err := e.unarchive(ctx, t, cr, pod, logf, s.DestDir, false, false); err != nil {
 			cachef.Close()
-			return -1, err
+			return -1, nil, err
 		}
 		cachef.Close()
 
+		cache.Key = userKey
+		cache.Hit = true
+		cache.Size = cr.n
+
 		// stop here
 		break
 	}
 
-	return 0, nil
+	if cache.Hit {
+		cacheOperationsCounter.WithLabelValues(string(cache.Type), "hit").Inc()
+		cacheBytesCounter.WithLabelValues(string(cache.Type)).Add(float64(cache.Size))
+	} else {
+		cacheOperationsCounter.WithLabelValues(string(cache.Type), "miss").Inc()
+	}
+
+	return 0, cache, nil
+}
+
+// countingReader counts the bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 func (e *Executor) executorIDPath() string {
@@ -668,11 +1118,16 @@ func (e *Executor) sendExecutorStatus(ctx context.Context) error {
 	}
 
 	activeTasks := e.runningTasks.len()
+	draining, _ := e.isDraining()
 
 	archs, err := e.driver.Archs(ctx)
 	if err != nil {
 		return err
 	}
+	driverOS, err := e.driver.OS(ctx)
+	if err != nil {
+		return err
+	}
 
 	executorGroup, err := e.driver.ExecutorGroup(ctx)
 	if err != nil {
@@ -700,14 +1155,29 @@ func (e *Executor) sendExecutorStatus(ctx context.Context) error {
 		siblingsExecutors = append(siblingsExecutors, executorID)
 	}
 
+	var utilization float64
+	if e.activeTasksLimit > 0 {
+		utilization = float64(activeTasks) / float64(e.activeTasksLimit)
+	}
+
+	gpus := []*types.ExecutorGPUs{}
+	for _, g := range e.c.GPUs {
+		gpus = append(gpus, &types.ExecutorGPUs{Type: g.Type, Count: g.Count})
+	}
+
 	executor := &types.Executor{
 		ID:                        e.id,
+		SessionID:                 e.sessionID,
+		OS:                        driverOS,
 		Archs:                     archs,
 		AllowPrivilegedContainers: e.c.AllowPrivilegedContainers,
+		GPUs:                      gpus,
 		ListenURL:                 e.listenURL,
 		Labels:                    labels,
-		ActiveTasksLimit:          e.c.ActiveTasksLimit,
+		ActiveTasksLimit:          e.activeTasksLimit,
 		ActiveTasks:               activeTasks,
+		Utilization:               utilization,
+		Draining:                  draining,
 		Dynamic:                   e.dynamic,
 		ExecutorGroup:             executorGroup,
 		SiblingsExecutors:         siblingsExecutors,
@@ -718,32 +1188,192 @@ func (e *Executor) sendExecutorStatus(ctx context.Context) error {
 	return err
 }
 
-func (e *Executor) sendExecutorTaskStatus(ctx context.Context, et *types.ExecutorTask) error {
-	log.Debugf("send executor task: %s. status: %s", et.ID, et.Status.Phase)
-	_, err := e.runserviceClient.SendExecutorTaskStatus(ctx, e.id, et)
-	return err
+// activeTasksLimit returns the max number of concurrent active tasks: the
+// lower between the configured limit and the cpu capacity considering the
+// oversubscription ratio. 0 means no limit.
+func activeTasksLimit(c *config.Executor) int {
+	limit := c.ActiveTasksLimit
+	if c.CPUOversubscriptionRatio > 0 {
+		cpus := c.CPUs
+		if cpus == 0 {
+			cpus = runtime.NumCPU()
+		}
+		capacity := int(float64(cpus) * c.CPUOversubscriptionRatio)
+		if capacity < 1 {
+			capacity = 1
+		}
+		if limit == 0 || capacity < limit {
+			limit = capacity
+		}
+	}
+	return limit
 }
 
-func (e *Executor) executeTask(rt *runningTask) {
-	// * save in local state that we have a running task
-	// * start the pod
-	// * then update the executortask status to in-progress
-	// if something fails pod will be cleaned up by the pod cleaner goroutine
-	// In this way we are sure that the pod cleaner will only remove pod that don't
-	// have an in progress running task
-
-	rt.Lock()
-	ctx := rt.ctx
-
-	// wait for context to be done and then stop the pod if running
-	go func() {
-		<-ctx.Done()
-		if rt.pod != nil {
-			if err := rt.pod.Stop(context.Background()); err != nil {
-				log.Errorf("error stopping the pod: %+v", err)
-			}
+// providesGPUs reports if the executor provides at least the requested number
+// of gpus of the requested type
+func (e *Executor) providesGPUs(gpus *types.GPUs) bool {
+	for _, g := range e.c.GPUs {
+		if g.Type == gpus.Type && g.Count >= gpus.Count {
+			return true
 		}
-	}()
+	}
+	return false
+}
+
+// registryMirrors returns the configured registry mirrors as a map of
+// registry names to mirror hosts
+func (e *Executor) registryMirrors() map[string]string {
+	mirrors := map[string]string{}
+	for _, m := range e.c.RegistryMirrors {
+		mirrors[m.Registry] = m.Mirror
+	}
+	return mirrors
+}
+
+// proxyEnv returns the proxy env vars to inject in the task containers. Both
+// the upper case and lower case variants are set since tools differ in the
+// one they consider.
+func (e *Executor) proxyEnv() map[string]string {
+	env := map[string]string{}
+	if e.c.Proxy == nil {
+		return env
+	}
+	if e.c.Proxy.HTTPProxy != "" {
+		env["HTTP_PROXY"] = e.c.Proxy.HTTPProxy
+		env["http_proxy"] = e.c.Proxy.HTTPProxy
+	}
+	if e.c.Proxy.HTTPSProxy != "" {
+		env["HTTPS_PROXY"] = e.c.Proxy.HTTPSProxy
+		env["https_proxy"] = e.c.Proxy.HTTPSProxy
+	}
+	if e.c.Proxy.NoProxy != "" {
+		env["NO_PROXY"] = e.c.Proxy.NoProxy
+		env["no_proxy"] = e.c.Proxy.NoProxy
+	}
+	return env
+}
+
+// dockerDaemonCacheKey returns the key of the task docker daemon cached
+// storage. It's shared by the tasks with the same cache prefix (the project or
+// the cache group). The untrusted runs tasks get their own storage so they
+// cannot poison the images and the build cache used by the trusted runs.
+func dockerDaemonCacheKey(et *types.ExecutorTask) string {
+	if et.Spec.Untrusted {
+		return "untrusted:" + et.Spec.CachePrefix
+	}
+	return et.Spec.CachePrefix
+}
+
+// buildkitDaemon returns the buildkit daemon dedicated to the task project.
+// User direct runs tasks, tasks of projects without a daemon and untrusted
+// runs tasks don't get one, since they could read or poison the daemon cache
+// of other projects.
+func (e *Executor) buildkitDaemon(et *types.ExecutorTask) *config.BuildkitDaemon {
+	if e.c.Buildkit == nil || et.Spec.ProjectID == "" || et.Spec.Untrusted {
+		return nil
+	}
+	for i, d := range e.c.Buildkit.Daemons {
+		if util.StringInSlice(d.Projects, et.Spec.ProjectID) {
+			return &e.c.Buildkit.Daemons[i]
+		}
+	}
+	return nil
+}
+
+// buildkitCacheRefTag returns the tag of a project cache ref. It's the hmac of
+// the project id so it cannot be guessed without the daemon cache ref key.
+func buildkitCacheRefTag(key, projectID string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	_, _ = mac.Write([]byte(projectID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// buildkitEnv returns the env vars to inject in the task main container to use
+// the buildkit daemon dedicated to the task project.
+func (e *Executor) buildkitEnv(et *types.ExecutorTask) map[string]string {
+	env := map[string]string{}
+	d := e.buildkitDaemon(et)
+	if d == nil {
+		return env
+	}
+	env["BUILDKIT_HOST"] = d.Address
+	env["AGOLA_BUILDKIT_CACHE_REF"] = d.CacheRepository + ":" + buildkitCacheRefTag(d.CacheRefKey, et.Spec.ProjectID)
+	if d.TLS != nil {
+		env["AGOLA_BUILDKIT_TLS_DIR"] = buildkitTLSContainerDir
+	}
+	return env
+}
+
+// buildkitTLSFiles reads the buildkit daemon client tls files. They're read at
+// every task start so they could be rotated without restarting the executor.
+// The file names are the ones expected by buildctl --tlsdir.
+func buildkitTLSFiles(d *config.BuildkitDaemon) ([]*types.TaskFile, error) {
+	if d == nil || d.TLS == nil {
+		return nil, nil
+	}
+	files := []*types.TaskFile{}
+	for _, f := range []struct{ name, path string }{
+		{"ca.pem", d.TLS.CAFile},
+		{"cert.pem", d.TLS.CertFile},
+		{"key.pem", d.TLS.KeyFile},
+	} {
+		data, err := ioutil.ReadFile(f.path)
+		if err != nil {
+			return nil, errors.Errorf("failed to read buildkit tls file %q: %w", f.path, err)
+		}
+		files = append(files, &types.TaskFile{Path: path.Join(buildkitTLSContainerDir, f.name), Content: string(data), Mode: 0600})
+	}
+	return files, nil
+}
+
+func (e *Executor) sendExecutorTaskStatus(ctx context.Context, et *types.ExecutorTask) error {
+	log.Debugf("send executor task: %s. status: %s", et.ID, et.Status.Phase)
+	_, err := e.runserviceClient.SendExecutorTaskStatus(ctx, e.id, et)
+	return err
+}
+
+func (e *Executor) executeTask(rt *runningTask) {
+	// * save in local state that we have a running task
+	// * start the pod
+	// * then update the executortask status to in-progress
+	// if something fails pod will be cleaned up by the pod cleaner goroutine
+	// In this way we are sure that the pod cleaner will only remove pod that don't
+	// have an in progress running task
+
+	rt.Lock()
+	ctx := rt.ctx
+
+	// add the task spans to the run trace
+	ctx = tracing.ContextWithTraceParent(ctx, rt.et.Spec.TraceParent)
+	ctx, span := tracing.StartSpan(ctx, "executor.execute_task")
+	span.SetAttribute("agola.run_id", rt.et.Spec.RunID)
+	span.SetAttribute("agola.task_id", rt.et.ID)
+	span.SetAttribute("agola.task_name", rt.et.Spec.TaskName)
+	span.SetAttribute("agola.executor_id", e.id)
+	defer span.End()
+
+	// wait for context to be done and then stop the pod if running. If the
+	// context is done before the steps have finished the task has been
+	// stopped and its processes are stopped gracefully.
+	stepsDoneCh := make(chan struct{})
+	stopResultCh := make(chan types.TaskStopResult, 1)
+	go func() {
+		var stopResult types.TaskStopResult
+		select {
+		case <-ctx.Done():
+			if rt.pod != nil {
+				stopResult = e.stopTaskPod(rt.et, rt.pod)
+			}
+		case <-stepsDoneCh:
+			<-ctx.Done()
+			if rt.pod != nil {
+				if err := rt.pod.Stop(context.Background()); err != nil {
+					log.Errorf("error stopping the pod: %+v", err)
+				}
+			}
+		}
+		stopResultCh <- stopResult
+	}()
 
 	defer func() {
 		rt.Lock()
@@ -763,6 +1393,8 @@ func (e *Executor) executeTask(rt *runningTask) {
 
 	if err := e.setupTask(ctx, rt); err != nil {
 		log.Errorf("err: %+v", err)
+		span.SetError(err)
+		et.Status.FailError = err.Error()
 		et.Status.Phase = types.ExecutorTaskPhaseFailed
 		et.Status.EndTime = util.TimeP(time.Now())
 		et.Status.SetupStep.Phase = types.ExecutorTaskPhaseFailed
@@ -770,6 +1402,7 @@ func (e *Executor) executeTask(rt *runningTask) {
 		if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
 			log.Errorf("err: %+v", err)
 		}
+		close(stepsDoneCh)
 		rt.Unlock()
 		return
 	}
@@ -782,18 +1415,66 @@ func (e *Executor) executeTask(rt *runningTask) {
 
 	rt.Unlock()
 
+	// sample the resource usage while executing the steps
+	samplerCtx, samplerCancel := context.WithCancel(ctx)
+	if e.c.ResourceUsageSamplingInterval > 0 {
+		go e.resourceUsageSampler(samplerCtx, rt)
+	}
+
 	_, err := e.executeTaskSteps(ctx, rt, rt.pod)
+	samplerCancel()
+
+	// the outputs are used by the dependent tasks so they're collected only
+	// when the task succeeds. Invalid outputs fail the task.
+	var outputs map[string]string
+	var outputsErr error
+	if err == nil && ctx.Err() == nil {
+		outputs, outputsErr = e.collectTaskOutputs(ctx, et, rt.pod)
+		if outputsErr != nil {
+			err = errors.Errorf("failed to collect task outputs: %w", outputsErr)
+		}
+	}
+
+	if ctx.Err() == nil {
+		close(stepsDoneCh)
+	}
+
+	var reportSummaries []*types.ReportSummary
+	if len(et.Spec.Reports) > 0 {
+		reportSummaries = e.collectTaskReports(ctx, et, rt.pod)
+	}
+
+	// keep the pod of the failed task running to let the users debug it
+	if err != nil && ctx.Err() == nil && et.Spec.DebugHold && e.c.DebugHoldTTL > 0 {
+		e.debugHold(ctx, rt)
+	}
 
 	rt.Lock()
+	et.Status.Reports = reportSummaries
+	et.Status.Outputs = outputs
+	if outputsErr != nil {
+		et.Status.FailError = err.Error()
+	}
+	et.Status.DebugHold = nil
 	if err != nil {
 		log.Errorf("err: %+v", err)
+		span.SetError(err)
 		if rt.et.Spec.Stop {
 			et.Status.Phase = types.ExecutorTaskPhaseStopped
+			// wait for the task processes to be stopped
+			et.Status.StopResult = <-stopResultCh
 		} else {
 			et.Status.Phase = types.ExecutorTaskPhaseFailed
 		}
 	} else {
 		et.Status.Phase = types.ExecutorTaskPhaseSuccess
+
+		// keep the pod, instead of stopping it, to execute the next tasks of
+		// the same batch
+		if et.Spec.BatchID != "" && !rt.et.Spec.Stop && ctx.Err() == nil {
+			e.batchPods.put(et.Spec.BatchID, rt.pod)
+			rt.pod = nil
+		}
 	}
 
 	et.Status.EndTime = util.TimeP(time.Now())
@@ -804,6 +1485,207 @@ func (e *Executor) executeTask(rt *runningTask) {
 	rt.Unlock()
 }
 
+// debugHold keeps the pod of a failed task running for the configured debug
+// hold ttl or until the task is stopped. The task status reports the pod
+// during the hold.
+func (e *Executor) debugHold(ctx context.Context, rt *runningTask) {
+	rt.Lock()
+	et := rt.et
+	until := time.Now().Add(e.c.DebugHoldTTL)
+	et.Status.DebugHold = &types.TaskDebugHold{
+		ExecutorID: e.id,
+		PodID:      rt.pod.ID(),
+		Until:      until,
+	}
+	log.Infof("holding pod %q of failed task %s until %s", rt.pod.ID(), et.ID, until)
+	if err := e.sendExecutorTaskStatus(ctx, et); err != nil {
+		log.Errorf("err: %+v", err)
+	}
+	// don't keep the lock while waiting or the task couldn't be stopped
+	rt.Unlock()
+
+	timer := time.NewTimer(e.c.DebugHoldTTL)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// stopTaskPod stops the pod of a stopped task. When the task defines a stop
+// signal or a stop grace period, its processes are signaled and the pod is
+// stopped when they have exited or after the grace period. It reports if the
+// task processes exited gracefully or were killed.
+func (e *Executor) stopTaskPod(et *types.ExecutorTask, pod driver.Pod) types.TaskStopResult {
+	stopResult := types.TaskStopResultKilled
+	if et.Spec.StopSignal != "" || et.Spec.StopGracePeriod > 0 {
+		exited, err := e.signalTaskProcesses(et, pod)
+		if err != nil {
+			log.Errorf("failed to signal task %s processes: %+v", et.ID, err)
+		}
+		if exited {
+			stopResult = types.TaskStopResultGraceful
+		}
+	}
+
+	if err := pod.Stop(context.Background()); err != nil {
+		log.Errorf("error stopping the pod: %+v", err)
+	}
+
+	return stopResult
+}
+
+// taskStopSignal returns the task stop signal and grace period
+func taskStopSignal(et *types.ExecutorTask) (string, time.Duration) {
+	signal := et.Spec.StopSignal
+	if signal == "" {
+		signal = defaultStopSignal
+	}
+	gracePeriod := et.Spec.StopGracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = defaultStopGracePeriod
+	}
+	return signal, gracePeriod
+}
+
+// signalTaskProcesses sends the task stop signal to the task processes and
+// reports if they exited before the grace period
+func (e *Executor) signalTaskProcesses(et *types.ExecutorTask, pod driver.Pod) (bool, error) {
+	signal, gracePeriod := taskStopSignal(et)
+	return e.signalProcesses(et, pod, signal, gracePeriod, "")
+}
+
+// signalProcesses sends the signal to the task processes, or only to the
+// process group of the process in pidFile when provided, and reports if they
+// exited before the grace period
+func (e *Executor) signalProcesses(et *types.ExecutorTask, pod driver.Pod, signal string, gracePeriod time.Duration, pidFile string) (bool, error) {
+	// the toolbox waits for the processes for the grace period, give it some
+	// more time to report
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod+30*time.Second)
+	defer cancel()
+
+	cmd := []string{taskToolboxPath(et), "signal", "--signal", signal, "--grace-period", gracePeriod.String()}
+	if pidFile != "" {
+		cmd = append(cmd, "--pid-file", pidFile)
+	}
+
+	var stderr bytes.Buffer
+	execConfig := &driver.ExecConfig{
+		Cmd:    cmd,
+		User:   stepUser(et),
+		Stderr: &stderr,
+	}
+
+	ce, err := pod.Exec(ctx, execConfig)
+	if err != nil {
+		return false, err
+	}
+	exitCode, err := ce.Wait(ctx)
+	if err != nil {
+		return false, err
+	}
+	if exitCode != 0 {
+		log.Infof("task %s processes didn't exit after signal %s (exit code: %d): %s", et.ID, signal, exitCode, stderr.String())
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// resourceUsageSampler periodically samples the resource usage of the task
+// main container and updates the task and running step resource usage
+func (e *Executor) resourceUsageSampler(ctx context.Context, rt *runningTask) {
+	for {
+		sleepCh := time.NewTimer(e.c.ResourceUsageSamplingInterval).C
+		select {
+		case <-ctx.Done():
+			return
+		case <-sleepCh:
+		}
+
+		stats, err := rt.pod.Stats(ctx)
+		if err != nil {
+			// this could happen when the pod is stopping or the stats aren't
+			// available (i.e. no k8s metrics server), so don't flood the logs
+			log.Debugf("failed to get pod %q stats: %v", rt.pod.ID(), err)
+			continue
+		}
+
+		rt.Lock()
+		et := rt.et
+		if et.Status.ResourceUsage == nil {
+			et.Status.ResourceUsage = &types.ResourceUsage{}
+		}
+		et.Status.ResourceUsage.AddSample(stats.CPU, stats.Memory)
+		for _, s := range et.Status.Steps {
+			if s.Phase != types.ExecutorTaskPhaseRunning {
+				continue
+			}
+			if s.ResourceUsage == nil {
+				s.ResourceUsage = &types.ResourceUsage{}
+			}
+			s.ResourceUsage.AddSample(stats.CPU, stats.Memory)
+		}
+		rt.Unlock()
+	}
+}
+
+// genContainerConfig generates the driver container config of a task container
+func genContainerConfig(c *types.Container, image string, cmd []string, proxyEnv map[string]string) *driver.ContainerConfig {
+	// inject the proxy env vars without overriding the ones defined by the task
+	env := map[string]string{}
+	for envName, envValue := range proxyEnv {
+		env[envName] = envValue
+	}
+	for envName, envValue := range c.Environment {
+		env[envName] = envValue
+	}
+
+	containerConfig := &driver.ContainerConfig{
+		Image:      image,
+		Cmd:        cmd,
+		Env:        env,
+		User:       c.User,
+		Privileged: c.Privileged,
+		Volumes:    make([]driver.Volume, len(c.Volumes)),
+		ShmSize:    c.ShmSize,
+	}
+
+	for vIndex, cVol := range c.Volumes {
+		containerConfig.Volumes[vIndex] = driver.Volume{
+			Path: cVol.Path,
+		}
+		if cVol.TmpFS != nil {
+			containerConfig.Volumes[vIndex].TmpFS = &driver.VolumeTmpFS{
+				Size: cVol.TmpFS.Size,
+			}
+		}
+	}
+
+	return containerConfig
+}
+
+// clampTmpFSSizes limits the container /dev/shm and tmpfs volumes sizes to the
+// executor max size. The tmpfs volumes without a size (that could use up to
+// half of the host memory) are also limited.
+func clampTmpFSSizes(c *driver.ContainerConfig, maxSize int64, out io.Writer) {
+	if c.ShmSize > maxSize {
+		_, _ = fmt.Fprintf(out, "Container shm size of %d bytes exceeds the executor max size, clamped to %d bytes.\n", c.ShmSize, maxSize)
+		c.ShmSize = maxSize
+	}
+	for i, vol := range c.Volumes {
+		if vol.TmpFS == nil {
+			continue
+		}
+		if vol.TmpFS.Size > maxSize {
+			_, _ = fmt.Fprintf(out, "Volume %q size of %d bytes exceeds the executor max size, clamped to %d bytes.\n", vol.Path, vol.TmpFS.Size, maxSize)
+		}
+		if vol.TmpFS.Size == 0 || vol.TmpFS.Size > maxSize {
+			c.Volumes[i].TmpFS = &driver.VolumeTmpFS{Size: maxSize}
+		}
+	}
+}
+
 func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 	et := rt.et
 	if err := os.RemoveAll(e.taskPath(et.ID)); err != nil {
@@ -823,9 +1705,10 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 	}
 	defer outf.Close()
 
-	// error out if privileged containers are required but not allowed
-	requiresPrivilegedContainers := false
-	for _, c := range et.Spec.Containers {
+	// error out if privileged containers are required but not allowed. The
+	// docker daemon is executed in a privileged container.
+	requiresPrivilegedContainers := et.Spec.DockerDaemon != nil
+	for _, c := range append(append([]*types.Container{}, et.Spec.Containers...), et.Spec.InitContainers...) {
 		if c.Privileged {
 			requiresPrivilegedContainers = true
 			break
@@ -836,77 +1719,463 @@ func (e *Executor) setupTask(ctx context.Context, rt *runningTask) error {
 		return errors.Errorf("executor doesn't allow executing privileged containers")
 	}
 
+	// error out if the assigned gpus aren't provided by this executor
+	if et.Spec.GPUs != nil && !e.providesGPUs(et.Spec.GPUs) {
+		_, _ = outf.WriteString("Executor doesn't provide the requested gpus.\n")
+		return errors.Errorf("executor doesn't provide %d gpus of type %q", et.Spec.GPUs.Count, et.Spec.GPUs.Type)
+	}
+
+	networkPolicy, err := e.networkPolicy(et.Spec.NetworkPolicy)
+	if err != nil {
+		_, _ = outf.WriteString(fmt.Sprintf("Cannot apply network policy. Error: %s\n", err))
+		return err
+	}
+
+	securityProfile, err := e.securityProfile(et.Spec.SecurityProfile)
+	if err != nil {
+		_, _ = outf.WriteString(fmt.Sprintf("Cannot apply security profile. Error: %s\n", err))
+		return err
+	}
+
+	limits, err := e.taskLimits(et.Spec.Limits)
+	if err != nil {
+		_, _ = outf.WriteString(fmt.Sprintf("Cannot apply task limits. Error: %s\n", err))
+		return err
+	}
+	if limits != nil {
+		rt.pidsLimit = limits.Pids
+	}
+
+	if et.Spec.BatchID != "" {
+		if pod := e.batchPods.take(et.Spec.BatchID); pod != nil {
+			if err := e.setupBatchPod(ctx, et, pod, outf); err == nil {
+				rt.pod = pod
+				return nil
+			}
+			// don't fail the task, just start a new pod
+			_, _ = outf.WriteString("Starting a new pod.\n")
+			if err := pod.Remove(ctx); err != nil {
+				log.Errorf("failed to remove batch pod %s: %+v", pod.ID(), err)
+			}
+		}
+	}
+
 	log.Debugf("starting pod")
 
-	dockerConfig, err := registry.GenDockerConfig(et.Spec.DockerRegistriesAuth, []string{et.Spec.Containers[0].Image})
+	// rewrite the containers images to pull them through the registry mirrors
+	mirrors := e.registryMirrors()
+	images := make([]string, len(et.Spec.Containers))
+	for i, c := range et.Spec.Containers {
+		image, err := registry.MirrorImage(mirrors, c.Image)
+		if err != nil {
+			_, _ = outf.WriteString(fmt.Sprintf("Cannot parse image %q. Error: %s\n", c.Image, err))
+			return err
+		}
+		images[i] = image
+	}
+	initImages := make([]string, len(et.Spec.InitContainers))
+	for i, c := range et.Spec.InitContainers {
+		image, err := registry.MirrorImage(mirrors, c.Image)
+		if err != nil {
+			_, _ = outf.WriteString(fmt.Sprintf("Cannot parse image %q. Error: %s\n", c.Image, err))
+			return err
+		}
+		initImages[i] = image
+	}
+	// the auths are resolved for the images registries before the mirror
+	// rewrite, the docker config also contains them for the mirrors hosts
+	authImages := []string{et.Spec.Containers[0].Image}
+	for _, c := range et.Spec.InitContainers {
+		authImages = append(authImages, c.Image)
+	}
+	var dockerDaemonImage string
+	if et.Spec.DockerDaemon != nil {
+		image := et.Spec.DockerDaemon.Image
+		if image == "" {
+			image = e.c.DockerDaemon.Image
+		}
+		dockerDaemonImage, err = registry.MirrorImage(mirrors, image)
+		if err != nil {
+			_, _ = outf.WriteString(fmt.Sprintf("Cannot parse image %q. Error: %s\n", image, err))
+			return err
+		}
+		authImages = append(authImages, image)
+	}
+
+	dockerConfig, err := registry.GenDockerConfig(et.Spec.DockerRegistriesAuth, mirrors, authImages)
 	if err != nil {
 		return err
 	}
 
+	buildkitFiles, err := buildkitTLSFiles(e.buildkitDaemon(et))
+	if err != nil {
+		_, _ = outf.WriteString(fmt.Sprintf("Cannot read buildkit tls files. Error: %s\n", err))
+		return err
+	}
+
+	proxyEnv := e.proxyEnv()
+
 	podConfig := &driver.PodConfig{
 		// generate a random pod id (don't use task id for future ability to restart
 		// tasks failed to start and don't clash with existing pods)
-		ID:            uuid.NewV4().String(),
-		TaskID:        et.ID,
-		Arch:          et.Spec.Arch,
-		InitVolumeDir: toolboxContainerDir,
-		DockerConfig:  dockerConfig,
-		Containers:    make([]*driver.ContainerConfig, len(et.Spec.Containers)),
+		ID:              uuid.NewV4().String(),
+		TaskID:          et.ID,
+		Arch:            et.Spec.Arch,
+		OS:              et.Spec.OS,
+		InitVolumeDir:   taskToolboxDir(et),
+		DockerConfig:    dockerConfig,
+		NetworkPolicy:   networkPolicy,
+		SecurityProfile: securityProfile,
+		Limits:          limits,
+		Containers:      make([]*driver.ContainerConfig, len(et.Spec.Containers)),
+	}
+	if et.Spec.GPUs != nil {
+		podConfig.GPUs = &driver.GPUs{
+			Count: et.Spec.GPUs.Count,
+			Type:  et.Spec.GPUs.Type,
+		}
+	}
+	if et.Spec.DockerDaemon != nil {
+		podConfig.DockerDaemon = &driver.DockerDaemon{
+			Image:  dockerDaemonImage,
+			CPU:    et.Spec.DockerDaemon.CPU,
+			Memory: et.Spec.DockerDaemon.Memory,
+		}
+		if et.Spec.DockerDaemon.Cache {
+			podConfig.DockerDaemon.CacheKey = dockerDaemonCacheKey(et)
+			podConfig.DockerDaemon.CacheMaxAge = e.c.DockerDaemon.CacheMaxAge
+		}
 	}
 	for i, c := range et.Spec.Containers {
 		var cmd []string
 		if i == 0 {
-			cmd = []string{toolboxContainerPath, "sleeper"}
+			cmd = []string{taskToolboxPath(et), "sleeper"}
 		}
 		if c.Entrypoint != "" {
 			cmd = strings.Split(c.Entrypoint, " ")
 		}
-
-		containerConfig := &driver.ContainerConfig{
-			Image:      c.Image,
-			Cmd:        cmd,
-			Env:        c.Environment,
-			User:       c.User,
-			Privileged: c.Privileged,
-			Volumes:    make([]driver.Volume, len(c.Volumes)),
+		if len(c.EntrypointArgs) > 0 {
+			cmd = c.EntrypointArgs
 		}
 
-		for vIndex, cVol := range c.Volumes {
-			containerConfig.Volumes[vIndex] = driver.Volume{
-				Path: cVol.Path,
-			}
-			if cVol.TmpFS != nil {
-				containerConfig.Volumes[vIndex].TmpFS = &driver.VolumeTmpFS{
-					Size: cVol.TmpFS.Size,
-				}
+		containerConfig := genContainerConfig(c, images[i], cmd, proxyEnv)
+		if i == 0 && len(et.Spec.InitContainers) > 0 {
+			containerConfig.Env["AGOLA_SHARED_DIR"] = sharedContainerDir
+		}
+		if i == 0 && et.Spec.DockerDaemon != nil {
+			containerConfig.Env["DOCKER_HOST"] = driver.DockerDaemonHost
+		}
+		if i == 0 {
+			for k, v := range e.buildkitEnv(et) {
+				containerConfig.Env[k] = v
 			}
 		}
+		if i == 0 && len(et.Spec.Files) > 0 {
+			// keep the task files, that usually contain secrets, only in
+			// memory. They're removed with the pod.
+			containerConfig.Volumes = append(containerConfig.Volumes, driver.Volume{
+				Path:  filesContainerDir,
+				TmpFS: &driver.VolumeTmpFS{},
+			})
+		}
+		if i == 0 && len(buildkitFiles) > 0 {
+			containerConfig.Volumes = append(containerConfig.Volumes, driver.Volume{
+				Path:  buildkitTLSContainerDir,
+				TmpFS: &driver.VolumeTmpFS{},
+			})
+		}
 
 		podConfig.Containers[i] = containerConfig
 	}
+	if len(et.Spec.InitContainers) > 0 {
+		podConfig.SharedVolumeDir = sharedContainerDir
+		podConfig.InitContainers = make([]*driver.ContainerConfig, len(et.Spec.InitContainers))
+		for i, c := range et.Spec.InitContainers {
+			var cmd []string
+			if c.Entrypoint != "" {
+				cmd = strings.Split(c.Entrypoint, " ")
+			}
+			if len(c.EntrypointArgs) > 0 {
+				cmd = c.EntrypointArgs
+			}
+
+			containerConfig := genContainerConfig(c, initImages[i], cmd, proxyEnv)
+			containerConfig.Env["AGOLA_SHARED_DIR"] = sharedContainerDir
+
+			podConfig.InitContainers[i] = containerConfig
+		}
+	}
+	if e.c.MaxTmpFSSize > 0 {
+		for _, c := range append(append([]*driver.ContainerConfig{}, podConfig.Containers...), podConfig.InitContainers...) {
+			clampTmpFSSizes(c, e.c.MaxTmpFSSize, outf)
+		}
+	}
 
 	_, _ = outf.WriteString("Starting pod.\n")
+	_, span := tracing.StartSpan(ctx, "executor.container_startup")
+	span.SetAttribute("agola.image", et.Spec.Containers[0].Image)
 	pod, err := e.driver.NewPod(ctx, podConfig, outf)
+	span.SetError(err)
+	span.End()
 	if err != nil {
 		_, _ = outf.WriteString(fmt.Sprintf("Pod failed to start. Error: %s\n", err))
 		return err
 	}
 	_, _ = outf.WriteString("Pod started.\n")
 
+	if s := pod.ImagePullStats(); s != nil {
+		et.Status.ImagePull = &types.ImagePull{
+			Image:        s.Image,
+			CacheHit:     s.CacheHit,
+			PulledBytes:  s.PulledBytes,
+			PulledLayers: s.PulledLayers,
+			CachedLayers: s.CachedLayers,
+			Duration:     s.Duration,
+			Digest:       s.Digest,
+		}
+		recordImagePull(s)
+	}
+
 	if et.Spec.WorkingDir != "" {
 		_, _ = outf.WriteString(fmt.Sprintf("Creating working dir %q.\n", et.Spec.WorkingDir))
-		if err := e.mkdir(ctx, et, pod, outf, et.Spec.WorkingDir); err != nil {
+		if err := e.mkdir(ctx, et, pod, outf, et.Spec.WorkingDir, false); err != nil {
 			_, _ = outf.WriteString(fmt.Sprintf("Failed to create working dir %q. Error: %s\n", et.Spec.WorkingDir, err))
 			return err
 		}
 	}
 
+	for i, f := range et.Spec.Files {
+		_, _ = outf.WriteString(fmt.Sprintf("Writing file %q.\n", f.Path))
+		if err := e.writeFile(ctx, et, pod, outf, f, path.Join(filesContainerDir, strconv.Itoa(i))); err != nil {
+			_, _ = outf.WriteString(fmt.Sprintf("Failed to write file %q. Error: %s\n", f.Path, err))
+			return err
+		}
+	}
+
+	if len(buildkitFiles) > 0 {
+		_, _ = outf.WriteString("Writing buildkit tls files.\n")
+	}
+	for _, f := range buildkitFiles {
+		if err := e.writeFile(ctx, et, pod, outf, &types.TaskFile{Content: f.Content, Mode: f.Mode}, f.Path); err != nil {
+			_, _ = outf.WriteString(fmt.Sprintf("Failed to write buildkit tls file %q. Error: %s\n", f.Path, err))
+			return err
+		}
+	}
+
 	rt.pod = pod
 	return nil
 }
 
+// setupBatchPod prepares the pod of a previous task of the same batch to
+// execute the task. The working dir is recreated to not see the files of the
+// previous task.
+func (e *Executor) setupBatchPod(ctx context.Context, et *types.ExecutorTask, pod driver.Pod, outf io.Writer) error {
+	_, _ = io.WriteString(outf, fmt.Sprintf("Reusing pod %s of a previous task of the same batch.\n", pod.ID()))
+
+	if et.Spec.WorkingDir != "" {
+		_, _ = io.WriteString(outf, fmt.Sprintf("Recreating working dir %q.\n", et.Spec.WorkingDir))
+		if err := e.mkdir(ctx, et, pod, outf, et.Spec.WorkingDir, true); err != nil {
+			_, _ = io.WriteString(outf, fmt.Sprintf("Failed to recreate working dir %q. Error: %s\n", et.Spec.WorkingDir, err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordImagePull updates the image pull metrics
+func recordImagePull(s *driver.ImagePullStats) {
+	cache := "miss"
+	if s.CacheHit {
+		cache = "hit"
+	}
+	imagePullsCounter.WithLabelValues(s.Image, cache).Inc()
+	imagePulledBytesCounter.WithLabelValues(s.Image).Add(float64(s.PulledBytes))
+	imagePullDuration.WithLabelValues(cache).Observe(s.Duration.Seconds())
+}
+
+// networkPolicy returns the driver network policy matching the provided network
+// policy name or nil if no network policy is required. The untrusted network
+// policy, when not defined, denies all the egress traffic.
+func (e *Executor) networkPolicy(name string) (*driver.NetworkPolicy, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	for _, np := range e.c.NetworkPolicies {
+		if np.Name != name {
+			continue
+		}
+		dnp := &driver.NetworkPolicy{Name: np.Name}
+		for _, rule := range np.Egress {
+			dnp.Egress = append(dnp.Egress, driver.NetworkPolicyRule{CIDR: rule.CIDR, Ports: rule.Ports})
+		}
+		return dnp, nil
+	}
+
+	if name == types.NetworkPolicyUntrusted {
+		return &driver.NetworkPolicy{Name: name}, nil
+	}
+
+	return nil, errors.Errorf("network policy %q not defined", name)
+}
+
+// securityProfile returns the driver security profile matching the provided
+// security profile name or, when empty, the executor default one. Only the
+// security profiles defined by the executor can be selected.
+func (e *Executor) securityProfile(name string) (*driver.SecurityProfile, error) {
+	if name == "" {
+		name = e.c.DefaultSecurityProfile
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	for _, sp := range e.c.SecurityProfiles {
+		if sp.Name != name {
+			continue
+		}
+		return &driver.SecurityProfile{
+			Name:     sp.Name,
+			Seccomp:  sp.Seccomp,
+			AppArmor: sp.AppArmor,
+		}, nil
+	}
+
+	return nil, errors.Errorf("security profile %q not allowed by the executor", name)
+}
+
+// taskLimits returns the driver limits merging the executor default limits
+// with the ones requested by the task. A task could always lower a default
+// limit, while raising it must be allowed by the executor.
+func (e *Executor) taskLimits(tl *types.TaskLimits) (*driver.Limits, error) {
+	cl := e.c.TaskLimits
+
+	pids := cl.Pids
+	ulimits := map[string]config.Ulimit{}
+	for name, u := range cl.Ulimits {
+		ulimits[name] = u
+	}
+
+	if tl != nil {
+		if tl.Pids > 0 {
+			lower := cl.Pids > 0 && tl.Pids <= cl.Pids
+			if !lower && (cl.MaxPids == 0 || tl.Pids > cl.MaxPids) {
+				return nil, errors.Errorf("pids limit %d exceeds the executor max pids limit %d", tl.Pids, cl.MaxPids)
+			}
+			pids = tl.Pids
+		}
+		for name, u := range tl.Ulimits {
+			d, ok := cl.Ulimits[name]
+			lower := ok && u.Soft <= d.Soft && u.Hard <= d.Hard
+			if !lower {
+				a, ok := cl.AllowedUlimits[name]
+				if !ok {
+					return nil, errors.Errorf("ulimit %q cannot be raised", name)
+				}
+				if u.Soft > a.Soft || u.Hard > a.Hard {
+					return nil, errors.Errorf("ulimit %q (soft: %d, hard: %d) exceeds the executor max values (soft: %d, hard: %d)", name, u.Soft, u.Hard, a.Soft, a.Hard)
+				}
+			}
+			ulimits[name] = config.Ulimit{Soft: u.Soft, Hard: u.Hard}
+		}
+	}
+
+	if pids == 0 && len(ulimits) == 0 {
+		return nil, nil
+	}
+
+	limits := &driver.Limits{Pids: pids}
+	for name, u := range ulimits {
+		limits.Ulimits = append(limits.Ulimits, driver.Ulimit{Name: name, Soft: u.Soft, Hard: u.Hard})
+	}
+	sort.Slice(limits.Ulimits, func(i, j int) bool { return limits.Ulimits[i].Name < limits.Ulimits[j].Name })
+
+	return limits, nil
+}
+
+// stepAlwaysRun reports if the step must be executed also when a previous step
+// failed
+func stepAlwaysRun(step interface{}) bool {
+	switch s := step.(type) {
+	case *types.RunStep:
+		return s.AlwaysRun
+	case *types.SaveToWorkspaceStep:
+		return s.AlwaysRun
+	case *types.RestoreWorkspaceStep:
+		return s.AlwaysRun
+	case *types.SaveCacheStep:
+		return s.AlwaysRun
+	case *types.RestoreCacheStep:
+		return s.AlwaysRun
+	case *types.WaitBackgroundStep:
+		return s.AlwaysRun
+	}
+	return false
+}
+
+// stepSkip reports if the step must not be executed since its when conditions
+// don't match
+func stepSkip(step interface{}) bool {
+	switch s := step.(type) {
+	case *types.RunStep:
+		return s.Skip
+	case *types.SaveToWorkspaceStep:
+		return s.Skip
+	case *types.RestoreWorkspaceStep:
+		return s.Skip
+	case *types.SaveCacheStep:
+		return s.Skip
+	case *types.RestoreCacheStep:
+		return s.Skip
+	case *types.WaitBackgroundStep:
+		return s.Skip
+	}
+	return false
+}
+
+// executeTaskSteps executes the task steps. When a step fails the next steps
+// are not executed, except the ones that must always run. Skipped steps are
+// never executed. It returns the index and the error of the first failed step.
 func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod driver.Pod) (int, error) {
+	failedStep := 0
+	var failedErr error
+
+	backgroundSteps := []*backgroundStep{}
+
+	// read the current pids limit events since a batch pod could have been
+	// used by previous tasks
+	if rt.pidsLimit > 0 {
+		n, err := e.pidsMaxEvents(ctx, rt.et, pod)
+		if err != nil {
+			log.Warnf("failed to read pids limit events: %+v", err)
+		}
+		rt.pidsMaxEvents = n
+	}
+
 	for i, step := range rt.et.Spec.Steps {
+		if stepSkip(step) {
+			rt.Lock()
+			if rt.et.Status.Steps[i].Phase != types.ExecutorTaskPhaseSkipped {
+				rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseSkipped
+				if err := e.sendExecutorTaskStatus(ctx, rt.et); err != nil {
+					log.Errorf("err: %+v", err)
+				}
+			}
+			rt.Unlock()
+			continue
+		}
+
+		if failedErr != nil {
+			// don't execute any step if the task has been stopped
+			if ctx.Err() != nil {
+				break
+			}
+			if !stepAlwaysRun(step) {
+				continue
+			}
+		}
+
 		rt.Lock()
 		rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseRunning
 		rt.et.Status.Steps[i].StartTime = util.TimeP(time.Now())
@@ -915,21 +2184,37 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 		}
 		rt.Unlock()
 
+		_, span := tracing.StartSpan(ctx, "executor.step")
+		span.SetAttribute("agola.step_number", strconv.Itoa(i))
+
 		var err error
 		var exitCode int
 		var stepName string
+		var cache *types.StepCache
+		var archiveSize int64
+		var pidsLimitReached bool
 
 		switch s := step.(type) {
 		case *types.RunStep:
 			log.Debugf("run step: %s", util.Dump(s))
 			stepName = s.Name
-			exitCode, err = e.doRunStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+			if s.Background {
+				// the step status will be updated when its command exits
+				backgroundSteps = append(backgroundSteps, e.startBackgroundStep(ctx, rt, pod, s, i))
+				span.SetAttribute("agola.step_name", stepName)
+				span.End()
+				continue
+			}
+			exitCode, err = e.doRunStep(ctx, s, rt.et, pod, i, e.stepLogPath(rt.et.ID, i))
+			if err == nil && exitCode != 0 {
+				pidsLimitReached = e.checkPidsLimit(ctx, rt, pod, e.stepLogPath(rt.et.ID, i))
+			}
 
 		case *types.SaveToWorkspaceStep:
 			log.Debugf("save to workspace step: %s", util.Dump(s))
 			stepName = s.Name
 			archivePath := e.archivePath(rt.et.ID, i)
-			exitCode, err = e.doSaveToWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
+			exitCode, archiveSize, err = e.doSaveToWorkspaceStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
 
 		case *types.RestoreWorkspaceStep:
 			log.Debugf("restore workspace step: %s", util.Dump(s))
@@ -940,21 +2225,35 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 			log.Debugf("save cache step: %s", util.Dump(s))
 			stepName = s.Name
 			archivePath := e.archivePath(rt.et.ID, i)
-			exitCode, err = e.doSaveCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
+			exitCode, cache, err = e.doSaveCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i), archivePath)
 
 		case *types.RestoreCacheStep:
 			log.Debugf("restore cache step: %s", util.Dump(s))
 			stepName = s.Name
-			exitCode, err = e.doRestoreCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+			exitCode, cache, err = e.doRestoreCacheStep(ctx, s, rt.et, pod, e.stepLogPath(rt.et.ID, i))
+
+		case *types.WaitBackgroundStep:
+			log.Debugf("wait background step: %s", util.Dump(s))
+			stepName = s.Name
+			exitCode, err = e.doWaitBackgroundStep(ctx, s, rt, pod, backgroundSteps, e.stepLogPath(rt.et.ID, i))
 
 		default:
-			return i, errors.Errorf("unknown step type: %s", util.Dump(s))
+			err := errors.Errorf("unknown step type: %s", util.Dump(s))
+			span.SetError(err)
+			span.End()
+			e.stopBackgroundSteps(rt, pod, backgroundSteps)
+			if failedErr != nil {
+				return failedStep, failedErr
+			}
+			return i, err
 		}
 
 		var serr error
 
 		rt.Lock()
 		rt.et.Status.Steps[i].EndTime = util.TimeP(time.Now())
+		rt.et.Status.Steps[i].Cache = cache
+		rt.et.Status.Steps[i].ArchiveSize = archiveSize
 
 		rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseSuccess
 
@@ -972,7 +2271,11 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 				rt.et.Status.Steps[i].Phase = types.ExecutorTaskPhaseFailed
 			}
 			rt.et.Status.Steps[i].ExitStatus = util.IntP(exitCode)
-			serr = errors.Errorf("step %q failed with exitcode %d", stepName, exitCode)
+			if pidsLimitReached {
+				serr = errors.Errorf("step %q failed with exitcode %d: the task reached its pids limit of %d processes", stepName, exitCode, rt.pidsLimit)
+			} else {
+				serr = errors.Errorf("step %q failed with exitcode %d", stepName, exitCode)
+			}
 		} else if exitCode == 0 {
 			rt.et.Status.Steps[i].ExitStatus = util.IntP(exitCode)
 		}
@@ -982,12 +2285,27 @@ func (e *Executor) executeTaskSteps(ctx context.Context, rt *runningTask, pod dr
 		}
 		rt.Unlock()
 
-		if serr != nil {
-			return i, serr
+		span.SetAttribute("agola.step_name", stepName)
+		span.SetError(serr)
+		span.End()
+
+		if serr != nil && failedErr == nil {
+			failedStep = i
+			failedErr = serr
 		}
 	}
 
-	return 0, nil
+	// stop the background steps still running, a background step that
+	// exited with an error fails the task
+	e.stopBackgroundSteps(rt, pod, backgroundSteps)
+	for _, bs := range backgroundSteps {
+		if err := bs.failErr(); err != nil && failedErr == nil {
+			failedStep = bs.index
+			failedErr = err
+		}
+	}
+
+	return failedStep, failedErr
 }
 
 func (e *Executor) podsCleanerLoop(ctx context.Context) {
@@ -1019,13 +2337,25 @@ func (e *Executor) podsCleaner(ctx context.Context) error {
 	// always add ourself to executors
 	executors = append(executors, e.id)
 
+	// remove the batch pods not reused by another task of the same batch
+	for _, pod := range e.batchPods.expired(time.Now()) {
+		log.Infof("removing idle batch pod %s", pod.ID())
+		if err := pod.Remove(ctx); err == nil {
+			cleanedResourcesCounter.WithLabelValues("pod").Inc()
+		}
+	}
+
 	for _, pod := range pods {
 		taskID := pod.TaskID()
-		// clean our owned pods
+		// clean our owned pods. The batch pods are owned by the task that
+		// created them.
 		if pod.ExecutorID() == e.id {
 			if _, ok := e.runningTasks.get(taskID); !ok {
 				log.Infof("removing pod %s for not running task: %s", pod.ID(), taskID)
-				_ = pod.Remove(ctx)
+				e.batchPods.remove(pod.ID())
+				if err := pod.Remove(ctx); err == nil {
+					cleanedResourcesCounter.WithLabelValues("pod").Inc()
+				}
 			}
 		}
 
@@ -1039,8 +2369,70 @@ func (e *Executor) podsCleaner(ctx context.Context) error {
 		}
 		if !owned {
 			log.Infof("removing pod %s since it's not owned by any active executor", pod.ID())
-			_ = pod.Remove(ctx)
+			if err := pod.Remove(ctx); err == nil {
+				cleanedResourcesCounter.WithLabelValues("pod").Inc()
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *Executor) danglingResourcesCleanerLoop(ctx context.Context) {
+	if e.c.DanglingResourcesCleanerInterval == 0 {
+		return
+	}
+
+	for {
+		log.Debugf("danglingResourcesCleaner")
+
+		if err := e.danglingResourcesCleaner(ctx); err != nil {
+			log.Errorf("err: %+v", err)
+		}
+
+		sleepCh := time.NewTimer(e.c.DanglingResourcesCleanerInterval).C
+		select {
+		case <-ctx.Done():
+			return
+		case <-sleepCh:
+		}
+	}
+}
+
+// danglingResourcesCleaner removes the resources left by a failed or
+// interrupted task pod creation. The resources of a running task or younger
+// than the grace period are never removed since their pod could be still in
+// creation.
+func (e *Executor) danglingResourcesCleaner(ctx context.Context) error {
+	resources, err := e.driver.GetDanglingResources(ctx)
+	if err != nil {
+		return err
+	}
+	executors, err := e.driver.GetExecutors(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range resources {
+		if r.ExecutorID() == e.id {
+			if _, ok := e.runningTasks.get(r.TaskID()); ok {
+				continue
+			}
+		} else if util.StringInSlice(executors, r.ExecutorID()) {
+			// the resource will be removed by its active owner executor
+			continue
+		}
+
+		if time.Since(r.CreationTime()) < e.c.DanglingResourcesGracePeriod {
+			continue
+		}
+
+		log.Infof("removing dangling %s %s of task %s", r.Kind(), r.ID(), r.TaskID())
+		if err := r.Remove(ctx); err != nil {
+			log.Errorf("failed to remove dangling %s %s: %+v", r.Kind(), r.ID(), err)
+			continue
 		}
+		cleanedResourcesCounter.WithLabelValues(string(r.Kind())).Inc()
 	}
 
 	return nil
@@ -1099,6 +2491,30 @@ func (e *Executor) executorTasksStatusSenderLoop(ctx context.Context) {
 	}
 }
 
+// drainWatcherLoop closes drainedCh when the executor is draining, must exit
+// when drained and has no more running tasks
+func (e *Executor) drainWatcherLoop(ctx context.Context, drainedCh chan struct{}) {
+	for {
+		log.Debugf("drainWatcherLoop")
+
+		if draining, exit := e.isDraining(); draining && exit && e.runningTasks.len() == 0 {
+			// send a last executor status to report the executor as draining
+			if err := e.sendExecutorStatus(ctx); err != nil {
+				log.Errorf("err: %+v", err)
+			}
+			close(drainedCh)
+			return
+		}
+
+		sleepCh := time.NewTimer(2 * time.Second).C
+		select {
+		case <-ctx.Done():
+			return
+		case <-sleepCh:
+		}
+	}
+}
+
 func (e *Executor) tasksUpdaterLoop(ctx context.Context) {
 	for {
 		log.Debugf("tasksUpdater")
@@ -1202,10 +2618,17 @@ func (e *Executor) taskUpdater(ctx context.Context, et *types.ExecutorTask) {
 	}
 
 	if !et.Spec.Stop && et.Status.Phase == types.ExecutorTaskPhaseNotStarted {
+		// don't start new tasks while draining. A task assigned before the
+		// runservice received the draining status will be started when
+		// undrained or handled by the runservice when the executor restarts
+		if draining, _ := e.isDraining(); draining {
+			log.Infof("executor draining, not starting executor task %s", et.ID)
+			return
+		}
 		activeTasks := e.runningTasks.len()
 		// don't start task if we have reached the active tasks limit (they will be retried
 		// on next taskUpdater calls)
-		if activeTasks > e.c.ActiveTasksLimit {
+		if e.activeTasksLimit > 0 && activeTasks >= e.activeTasksLimit {
 			return
 		}
 		rtCtx, rtCancel := context.WithCancel(ctx)
@@ -1288,6 +2711,12 @@ type runningTask struct {
 
 	et  *types.ExecutorTask
 	pod driver.Pod
+
+	// pidsLimit is the task pids limit, 0 when not limited
+	pidsLimit int64
+	// pidsMaxEvents is the last read number of the task processes creations
+	// rejected by the pids limit
+	pidsMaxEvents int64
 }
 
 func (r *runningTasks) get(rtID string) (*runningTask, bool) {
@@ -1329,6 +2758,61 @@ func (r *runningTasks) ids() []string {
 	return ids
 }
 
+// batchPods are the idle pods of the finished batch tasks that could execute
+// the next tasks of the same batch
+type batchPods struct {
+	// pods are keyed by pod id
+	pods map[string]*batchPod
+	m    sync.Mutex
+}
+
+type batchPod struct {
+	pod       driver.Pod
+	batchID   string
+	idleSince time.Time
+}
+
+func (b *batchPods) put(batchID string, pod driver.Pod) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.pods[pod.ID()] = &batchPod{pod: pod, batchID: batchID, idleSince: time.Now()}
+}
+
+// take returns, removing it, an idle pod of the batch. It returns nil if there
+// are no idle pods of the batch
+func (b *batchPods) take(batchID string) driver.Pod {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for podID, bp := range b.pods {
+		if bp.batchID == batchID {
+			delete(b.pods, podID)
+			return bp.pod
+		}
+	}
+	return nil
+}
+
+func (b *batchPods) remove(podID string) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	delete(b.pods, podID)
+}
+
+// expired returns, removing them, the pods idle for more than
+// batchPodIdleTimeout
+func (b *batchPods) expired(now time.Time) []driver.Pod {
+	b.m.Lock()
+	defer b.m.Unlock()
+	pods := []driver.Pod{}
+	for podID, bp := range b.pods {
+		if now.Sub(bp.idleSince) > batchPodIdleTimeout {
+			delete(b.pods, podID)
+			pods = append(pods, bp.pod)
+		}
+	}
+	return pods
+}
+
 func (e *Executor) handleTasks(ctx context.Context, c <-chan *types.ExecutorTask) {
 	for et := range c {
 		e.taskUpdater(ctx, et)
@@ -1354,11 +2838,35 @@ type Executor struct {
 	c                *config.Executor
 	runserviceClient *rsclient.Client
 	id               string
+	sessionID        string
+	activeTasksLimit int
 	runningTasks     *runningTasks
+	batchPods        *batchPods
 	driver           driver.Driver
+	logForwarder     *logForwarder
 	listenAddress    string
 	listenURL        string
 	dynamic          bool
+
+	// draining reports that the executor doesn't want to receive new tasks. If
+	// drainExit is true the executor will exit when all the running tasks are
+	// completed
+	drainMutex sync.Mutex
+	draining   bool
+	drainExit  bool
+}
+
+func (e *Executor) setDraining(draining, exit bool) {
+	e.drainMutex.Lock()
+	defer e.drainMutex.Unlock()
+	e.draining = draining
+	e.drainExit = exit
+}
+
+func (e *Executor) isDraining() (bool, bool) {
+	e.drainMutex.Lock()
+	defer e.drainMutex.Unlock()
+	return e.draining, e.drainExit
 }
 
 func NewExecutor(ctx context.Context, l *zap.Logger, c *config.Executor) (*Executor, error) {
@@ -1376,12 +2884,22 @@ func NewExecutor(ctx context.Context, l *zap.Logger, c *config.Executor) (*Execu
 		return nil, errors.Errorf("cannot determine \"agola-toolbox\" absolute path: %w", err)
 	}
 
+	runserviceHTTPClient, err := common.NewHTTPClient(c.RunserviceTLS)
+	if err != nil {
+		return nil, errors.Errorf("failed to create runservice http client: %w", err)
+	}
+	runserviceClient := rsclient.NewClient(c.RunserviceURL)
+	runserviceClient.SetHTTPClient(runserviceHTTPClient)
+
 	e := &Executor{
 		c:                c,
-		runserviceClient: rsclient.NewClient(c.RunserviceURL),
+		runserviceClient: runserviceClient,
 		runningTasks: &runningTasks{
 			tasks: make(map[string]*runningTask),
 		},
+		batchPods: &batchPods{
+			pods: make(map[string]*batchPod),
+		},
 	}
 
 	if err := os.MkdirAll(e.tasksDir(), 0770); err != nil {
@@ -1400,6 +2918,12 @@ func NewExecutor(ctx context.Context, l *zap.Logger, c *config.Executor) (*Execu
 	}
 
 	e.id = id
+	e.sessionID = uuid.NewV4().String()
+	e.activeTasksLimit = activeTasksLimit(c)
+
+	if c.LogForwarder != nil {
+		e.logForwarder = newLogForwarder(c.LogForwarder, e.id)
+	}
 
 	// TODO(sgotti) now the first available private ip will be used and the executor will bind to the wildcard address
 	// improve this to let the user define the bind and the advertize address
@@ -1426,7 +2950,7 @@ func NewExecutor(ctx context.Context, l *zap.Logger, c *config.Executor) (*Execu
 	var d driver.Driver
 	switch c.Driver.Type {
 	case config.DriverTypeDocker:
-		d, err = driver.NewDockerDriver(logger, e.id, e.c.ToolboxPath)
+		d, err = driver.NewDockerDriver(logger, e.id, e.c.ToolboxPath, e.c.Driver.NetworkPolicyImage, string(e.c.Driver.WindowsIsolation))
 		if err != nil {
 			return nil, errors.Errorf("failed to create docker driver: %w", err)
 		}
@@ -1436,6 +2960,11 @@ func NewExecutor(ctx context.Context, l *zap.Logger, c *config.Executor) (*Execu
 			return nil, errors.Errorf("failed to create kubernetes driver: %w", err)
 		}
 		e.dynamic = true
+	case config.DriverTypeCRI:
+		d, err = driver.NewCRIDriver(logger, e.id, c.ToolboxPath, filepath.Join(c.DataDir, "cri"), c.Driver.CRIEndpoint, c.Driver.NetworkPolicyImage)
+		if err != nil {
+			return nil, errors.Errorf("failed to create cri driver: %w", err)
+		}
 	default:
 		return nil, errors.Errorf("unknown driver type %q", c.Driver.Type)
 	}
@@ -1444,6 +2973,16 @@ func NewExecutor(ctx context.Context, l *zap.Logger, c *config.Executor) (*Execu
 	return e, nil
 }
 
+// Reload applies the executor config changes that don't require a restart.
+// Currently only the log level.
+func (e *Executor) Reload(c *config.Executor) {
+	if c.Debug {
+		level.SetLevel(zapcore.DebugLevel)
+	} else {
+		level.SetLevel(zapcore.InfoLevel)
+	}
+}
+
 func (e *Executor) Run(ctx context.Context) error {
 	if err := e.driver.Setup(ctx); err != nil {
 		return err
@@ -1453,6 +2992,7 @@ func (e *Executor) Run(ctx context.Context) error {
 	schedulerHandler := NewTaskSubmissionHandler(ch)
 	logsHandler := NewLogsHandler(logger, e)
 	archivesHandler := NewArchivesHandler(e)
+	drainHandler := NewDrainHandler(logger, e)
 
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter()
@@ -1460,28 +3000,47 @@ func (e *Executor) Run(ctx context.Context) error {
 	apirouter.Handle("/executor", schedulerHandler).Methods("POST")
 	apirouter.Handle("/executor/logs", logsHandler).Methods("GET")
 	apirouter.Handle("/executor/archives", archivesHandler).Methods("GET")
+	apirouter.Handle("/executor/drain", drainHandler).Methods("PUT", "DELETE")
+
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	drainedCh := make(chan struct{})
 
 	go e.executorStatusSenderLoop(ctx)
 	go e.executorTasksStatusSenderLoop(ctx)
 	go e.podsCleanerLoop(ctx)
+	go e.danglingResourcesCleanerLoop(ctx)
 	go e.tasksUpdaterLoop(ctx)
+	if e.logForwarder != nil {
+		go e.logForwarder.run(ctx)
+	}
 	go e.tasksDataCleanerLoop(ctx)
+	go e.drainWatcherLoop(ctx, drainedCh)
 
 	go e.handleTasks(ctx, ch)
 
+	tlsConfig, err := common.NewTLSServerConfig(&e.c.Web)
+	if err != nil {
+		return err
+	}
+
 	httpServer := http.Server{
-		Addr:    e.listenAddress,
-		Handler: apirouter,
+		Addr:      e.listenAddress,
+		Handler:   router,
+		TLSConfig: tlsConfig,
 	}
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		lerrCh <- common.ListenAndServe(&httpServer)
 	}()
 
 	select {
 	case <-ctx.Done():
 		log.Infof("runservice executor exiting")
 		httpServer.Close()
+	case <-drainedCh:
+		log.Infof("runservice executor drained, exiting")
+		httpServer.Close()
 	case err := <-lerrCh:
 		if err != nil {
 			log.Errorf("http server listen error: %v", err)
@@ -0,0 +1,344 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDockerDaemonCacheKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		cachePrefix string
+		untrusted   bool
+		out         string
+	}{
+		{
+			name:        "test trusted run",
+			cachePrefix: "project01",
+			out:         "project01",
+		},
+		{
+			name:        "test untrusted run",
+			cachePrefix: "project01",
+			untrusted:   true,
+			out:         "untrusted:project01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			et := &types.ExecutorTask{
+				Spec: types.ExecutorTaskSpec{
+					ExecutorTaskSpecData: &types.ExecutorTaskSpecData{
+						CachePrefix: tt.cachePrefix,
+						Untrusted:   tt.untrusted,
+					},
+				},
+			}
+
+			out := dockerDaemonCacheKey(et)
+			if out != tt.out {
+				t.Fatalf("expected cache key %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestBuildkitEnv(t *testing.T) {
+	project01 := "6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10"
+	project02 := "0f1e2d3c-4b5a-4968-8776-5a4b3c2d1e0f"
+	project03 := "b1f0c7a2-33d4-4e5f-8a9b-0c1d2e3f4a5b"
+
+	buildkit := &config.Buildkit{
+		Daemons: []config.BuildkitDaemon{
+			{
+				Address:         "tcp://buildkitd01:1234",
+				CacheRepository: "registry.example.com/tenant01/cache",
+				CacheRefKey:     "cachesecret01",
+				TLS:             &config.BuildkitTLS{CAFile: "ca.pem", CertFile: "cert.pem", KeyFile: "key.pem"},
+				Projects:        []string{project01},
+			},
+			{
+				Address:         "unix:///run/buildkit/buildkitd.sock",
+				CacheRepository: "registry.example.com/tenant02/cache",
+				CacheRefKey:     "cachesecret02",
+				Projects:        []string{project02},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		buildkit      *config.Buildkit
+		projectID     string
+		cachePrefix   string
+		untrusted     bool
+		networkPolicy string
+		out           map[string]string
+	}{
+		{
+			name:        "test no buildkit",
+			projectID:   project01,
+			cachePrefix: project01,
+			out:         map[string]string{},
+		},
+		{
+			name:        "test project daemon",
+			buildkit:    buildkit,
+			projectID:   project01,
+			cachePrefix: project01,
+			out: map[string]string{
+				"BUILDKIT_HOST":            "tcp://buildkitd01:1234",
+				"AGOLA_BUILDKIT_CACHE_REF": "registry.example.com/tenant01/cache:" + buildkitCacheRefTag("cachesecret01", project01),
+				"AGOLA_BUILDKIT_TLS_DIR":   "/agola/buildkit",
+			},
+		},
+		{
+			name:        "test other project daemon",
+			buildkit:    buildkit,
+			projectID:   project02,
+			cachePrefix: project02,
+			out: map[string]string{
+				"BUILDKIT_HOST":            "unix:///run/buildkit/buildkitd.sock",
+				"AGOLA_BUILDKIT_CACHE_REF": "registry.example.com/tenant02/cache:" + buildkitCacheRefTag("cachesecret02", project02),
+			},
+		},
+		{
+			name:        "test project without a daemon",
+			buildkit:    buildkit,
+			projectID:   project03,
+			cachePrefix: project03,
+			out:         map[string]string{},
+		},
+		{
+			name:        "test untrusted run",
+			buildkit:    buildkit,
+			projectID:   project01,
+			cachePrefix: project01,
+			untrusted:   true,
+			out:         map[string]string{},
+		},
+		{
+			// the untrusted runs are detected by the run untrusted flag and
+			// not by their network policy that could be changed
+			name:          "test untrusted run without untrusted network policy",
+			buildkit:      buildkit,
+			projectID:     project01,
+			cachePrefix:   project01,
+			untrusted:     true,
+			networkPolicy: "default",
+			out:           map[string]string{},
+		},
+		{
+			// a user direct run cache group is never a project daemon scope,
+			// also when it matches a project id
+			name:        "test user direct run",
+			buildkit:    buildkit,
+			cachePrefix: project01,
+			out:         map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Executor{c: &config.Executor{Buildkit: tt.buildkit}}
+			et := &types.ExecutorTask{
+				Spec: types.ExecutorTaskSpec{
+					ExecutorTaskSpecData: &types.ExecutorTaskSpecData{
+						ProjectID:     tt.projectID,
+						CachePrefix:   tt.cachePrefix,
+						Untrusted:     tt.untrusted,
+						NetworkPolicy: tt.networkPolicy,
+					},
+				},
+			}
+
+			out := e.buildkitEnv(et)
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestBuildkitCacheRefTag(t *testing.T) {
+	project01 := "6e3d8f8a-8b3f-4a8c-9f5e-2f3b1c7d9a10"
+	project02 := "0f1e2d3c-4b5a-4968-8776-5a4b3c2d1e0f"
+
+	tag := buildkitCacheRefTag("cachesecret", project01)
+	if tag != buildkitCacheRefTag("cachesecret", project01) {
+		t.Fatalf("expected a stable cache ref tag")
+	}
+	if strings.Contains(tag, project01) {
+		t.Fatalf("cache ref tag %q contains the project id", tag)
+	}
+	if tag == buildkitCacheRefTag("cachesecret", project02) {
+		t.Fatalf("expected different cache ref tags for different projects")
+	}
+	if tag == buildkitCacheRefTag("othersecret", project01) {
+		t.Fatalf("expected different cache ref tags for different keys")
+	}
+}
+
+func TestBuildkitTLSFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"ca", "cert", "key"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name+" data"), 0600); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	d := &config.BuildkitDaemon{
+		Address: "tcp://buildkitd01:1234",
+		TLS: &config.BuildkitTLS{
+			CAFile:   filepath.Join(dir, "ca"),
+			CertFile: filepath.Join(dir, "cert"),
+			KeyFile:  filepath.Join(dir, "key"),
+		},
+	}
+
+	files, err := buildkitTLSFiles(d)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	expected := []*types.TaskFile{
+		{Path: "/agola/buildkit/ca.pem", Content: "ca data", Mode: 0600},
+		{Path: "/agola/buildkit/cert.pem", Content: "cert data", Mode: 0600},
+		{Path: "/agola/buildkit/key.pem", Content: "key data", Mode: 0600},
+	}
+	if diff := cmp.Diff(expected, files); diff != "" {
+		t.Error(diff)
+	}
+
+	d.TLS.KeyFile = filepath.Join(dir, "missing")
+	if _, err := buildkitTLSFiles(d); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
+
+func TestTaskUpdaterDraining(t *testing.T) {
+	e := &Executor{
+		id: "executor01",
+		runningTasks: &runningTasks{
+			tasks: make(map[string]*runningTask),
+		},
+	}
+	e.setDraining(true, false)
+
+	et := &types.ExecutorTask{
+		ID: "task01",
+		Spec: types.ExecutorTaskSpec{
+			ExecutorID:           "executor01",
+			ExecutorTaskSpecData: &types.ExecutorTaskSpecData{},
+		},
+		Status: types.ExecutorTaskStatus{
+			Phase: types.ExecutorTaskPhaseNotStarted,
+		},
+	}
+
+	e.taskUpdater(context.Background(), et)
+
+	if _, ok := e.runningTasks.get(et.ID); ok {
+		t.Fatalf("expected executor task %q not started while draining", et.ID)
+	}
+	if et.Status.Phase != types.ExecutorTaskPhaseNotStarted {
+		t.Fatalf("expected executor task phase %q, got %q", types.ExecutorTaskPhaseNotStarted, et.Status.Phase)
+	}
+}
+
+func TestStepLogWriter(t *testing.T) {
+	const notice = "\nStep log truncated since it exceeded the max size of 10 bytes. The remaining output will be discarded.\n"
+
+	tests := []struct {
+		name     string
+		maxSize  int64
+		writes   []string
+		out      string
+		exceeded bool
+	}{
+		{
+			name:    "test no limit",
+			maxSize: 0,
+			writes:  []string{"0123456789", "0123456789"},
+			out:     "01234567890123456789",
+		},
+		{
+			name:    "test under limit",
+			maxSize: 10,
+			writes:  []string{"01234", "5678"},
+			out:     "012345678",
+		},
+		{
+			name:    "test exactly at limit",
+			maxSize: 10,
+			writes:  []string{"01234", "56789"},
+			out:     "0123456789",
+		},
+		{
+			name:     "test one byte over limit",
+			maxSize:  10,
+			writes:   []string{"01234", "567890"},
+			out:      "0123456789" + notice,
+			exceeded: true,
+		},
+		{
+			name:     "test writes after limit are discarded",
+			maxSize:  10,
+			writes:   []string{"0123456789", "0", "0123456789"},
+			out:      "0123456789" + notice,
+			exceeded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := newStepLogWriter(&buf, tt.maxSize)
+			for _, s := range tt.writes {
+				n, err := w.Write([]byte(s))
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				// the full write must be reported to not block the step process
+				if n != len(s) {
+					t.Fatalf("expected %d written bytes, got %d", len(s), n)
+				}
+			}
+			if diff := cmp.Diff(tt.out, buf.String()); diff != "" {
+				t.Error(diff)
+			}
+			if w.Exceeded() != tt.exceeded {
+				t.Fatalf("expected exceeded %t, got %t", tt.exceeded, w.Exceeded())
+			}
+		})
+	}
+}
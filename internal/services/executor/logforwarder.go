@@ -0,0 +1,235 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/services/runservice/types"
+)
+
+const (
+	logForwarderQueueSize     = 4096
+	logForwarderDialTimeout   = 5 * time.Second
+	logForwarderRetryInterval = 10 * time.Second
+	// logForwarderMaxLineSize is the max size of a forwarded line, longer
+	// lines are split
+	logForwarderMaxLineSize = 16 * 1024
+
+	defaultLogForwarderTag = "agola"
+
+	// syslog priority user.info
+	syslogPriority = 14
+	// syslogSDID is the RFC 5424 structured data id containing the labels
+	syslogSDID = "agola@32473"
+)
+
+// logForwarder forwards the steps output lines to the configured destination.
+// The lines are queued and sent asynchronously, when the queue is full or the
+// destination isn't reachable they are dropped so the steps execution is never
+// slowed down by the forwarding.
+type logForwarder struct {
+	c          *config.LogForwarder
+	tag        string
+	hostname   string
+	executorID string
+
+	ch chan []byte
+}
+
+func newLogForwarder(c *config.LogForwarder, executorID string) *logForwarder {
+	tag := c.Tag
+	if tag == "" {
+		tag = defaultLogForwarderTag
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+
+	return &logForwarder{
+		c:          c,
+		tag:        tag,
+		hostname:   hostname,
+		executorID: executorID,
+		ch:         make(chan []byte, logForwarderQueueSize),
+	}
+}
+
+func (f *logForwarder) run(ctx context.Context) {
+	var conn net.Conn
+	var lastDialErrTime time.Time
+	dropped := 0
+
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		var msg []byte
+		select {
+		case <-ctx.Done():
+			return
+		case msg = <-f.ch:
+		}
+
+		if conn == nil {
+			if time.Since(lastDialErrTime) < logForwarderRetryInterval {
+				dropped++
+				continue
+			}
+			var err error
+			conn, err = net.DialTimeout(f.c.Network, f.c.Address, logForwarderDialTimeout)
+			if err != nil {
+				log.Warnf("failed to connect to log forwarder destination %q: %v", f.c.Address, err)
+				lastDialErrTime = time.Now()
+				conn = nil
+				dropped++
+				continue
+			}
+			if dropped > 0 {
+				log.Warnf("dropped %d lines not sent to log forwarder destination %q", dropped, f.c.Address)
+				dropped = 0
+			}
+		}
+
+		if _, err := conn.Write(msg); err != nil {
+			log.Warnf("failed to send to log forwarder destination %q: %v", f.c.Address, err)
+			conn.Close()
+			conn = nil
+			dropped++
+		}
+	}
+}
+
+func (f *logForwarder) send(msg []byte) {
+	select {
+	case f.ch <- msg:
+	default:
+		// queue full, drop the line
+	}
+}
+
+func (f *logForwarder) formatLine(t *types.ExecutorTask, step int, stepName string, now time.Time, line string) ([]byte, error) {
+	switch f.c.Format {
+	case config.LogForwarderFormatJSON:
+		m := map[string]interface{}{
+			"time":        now.Format(time.RFC3339Nano),
+			"tag":         f.tag,
+			"host":        f.hostname,
+			"executor_id": f.executorID,
+			"run_id":      t.Spec.RunID,
+			"task_id":     t.ID,
+			"task_name":   t.Spec.TaskName,
+			"step":        step,
+			"step_name":   stepName,
+			"message":     line,
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+
+	case config.LogForwarderFormatSyslog:
+		sd := fmt.Sprintf("[%s executor_id=\"%s\" run_id=\"%s\" task_id=\"%s\" task_name=\"%s\" step=\"%d\" step_name=\"%s\"]",
+			syslogSDID,
+			syslogEscapeParam(f.executorID),
+			syslogEscapeParam(t.Spec.RunID),
+			syslogEscapeParam(t.ID),
+			syslogEscapeParam(t.Spec.TaskName),
+			step,
+			syslogEscapeParam(stepName),
+		)
+		return []byte(fmt.Sprintf("<%d>1 %s %s %s - - %s %s\n", syslogPriority, now.Format(time.RFC3339Nano), f.hostname, f.tag, sd, line)), nil
+	}
+
+	return nil, fmt.Errorf("unknown log forwarder format %q", f.c.Format)
+}
+
+var syslogParamReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func syslogEscapeParam(s string) string {
+	return syslogParamReplacer.Replace(s)
+}
+
+// stepWriter returns a writer that forwards every line written by the step
+func (f *logForwarder) stepWriter(t *types.ExecutorTask, step int, stepName string) *logForwarderWriter {
+	return &logForwarderWriter{f: f, t: t, step: step, stepName: stepName}
+}
+
+type logForwarderWriter struct {
+	f        *logForwarder
+	t        *types.ExecutorTask
+	step     int
+	stepName string
+
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *logForwarderWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf.Write(p)
+	for {
+		b := w.buf.Bytes()
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			if len(b) >= logForwarderMaxLineSize {
+				w.forward(string(w.buf.Next(logForwarderMaxLineSize)))
+				continue
+			}
+			break
+		}
+		line := w.buf.Next(i + 1)
+		w.forward(strings.TrimRight(string(line), "\r\n"))
+	}
+
+	return len(p), nil
+}
+
+// Close forwards the remaining partial line
+func (w *logForwarderWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		w.forward(w.buf.String())
+		w.buf.Reset()
+	}
+	return nil
+}
+
+func (w *logForwarderWriter) forward(line string) {
+	msg, err := w.f.formatLine(w.t, w.step, w.stepName, time.Now(), line)
+	if err != nil {
+		log.Warnf("failed to format forwarded log line: %v", err)
+		return
+	}
+	w.f.send(msg)
+}
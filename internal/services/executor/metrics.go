@@ -0,0 +1,92 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cleanedResourcesCounter counts the removed task pods and dangling resources
+// left by failed or interrupted tasks
+var cleanedResourcesCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "agola_executor_cleaned_resources_total",
+		Help: "Total number of removed leftover task pods and resources.",
+	},
+	[]string{"kind"},
+)
+
+// imagePullsCounter counts the task main container image pulls. The cache
+// label is "hit" when no layer was downloaded.
+var imagePullsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "agola_executor_image_pulls_total",
+		Help: "Total number of task image pulls.",
+	},
+	[]string{"image", "cache"},
+)
+
+var imagePulledBytesCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "agola_executor_image_pulled_bytes_total",
+		Help: "Total size in bytes of the downloaded task image layers.",
+	},
+	[]string{"image"},
+)
+
+var imagePullDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "agola_executor_image_pull_duration_seconds",
+		Help:    "Duration of the task image pulls.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	},
+	[]string{"cache"},
+)
+
+// cacheOperationsCounter counts the restore_cache and save_cache steps. For a
+// save operation the result is "hit" when the cache already existed.
+var cacheOperationsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "agola_executor_cache_operations_total",
+		Help: "Total number of task cache restores and saves.",
+	},
+	[]string{"operation", "result"},
+)
+
+var cacheBytesCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "agola_executor_cache_bytes_total",
+		Help: "Total size in bytes of the restored and saved task caches.",
+	},
+	[]string{"operation"},
+)
+
+var workspaceArchiveSize = prometheus.NewHistogram(
+	prometheus.HistogramOpts{
+		Name:    "agola_executor_workspace_archive_size_bytes",
+		Help:    "Size of the task workspace archives.",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 12),
+	},
+)
+
+func init() {
+	prometheus.MustRegister(cleanedResourcesCounter)
+	prometheus.MustRegister(imagePullsCounter)
+	prometheus.MustRegister(imagePulledBytesCounter)
+	prometheus.MustRegister(imagePullDuration)
+	prometheus.MustRegister(cacheOperationsCounter)
+	prometheus.MustRegister(cacheBytesCounter)
+	prometheus.MustRegister(workspaceArchiveSize)
+}
@@ -113,7 +113,12 @@ func ResolveAuth(auths map[string]types.DockerRegistryAuth, regname string) (str
 	return "", "", nil
 }
 
-func GenDockerConfig(auths map[string]types.DockerRegistryAuth, images []string) (*DockerConfig, error) {
+// GenDockerConfig generates the docker config with the auths of the provided
+// images registries. images are the images names before being rewritten by
+// MirrorImage. When an image registry has a mirror, the config also contains
+// the auth for the mirror host: the auth defined for the mirror host or, if
+// not defined, the auth of the image registry.
+func GenDockerConfig(auths map[string]types.DockerRegistryAuth, mirrors map[string]string, images []string) (*DockerConfig, error) {
 	dockerConfig := &DockerConfig{Auths: make(map[string]DockerConfigAuth)}
 	for _, image := range images {
 		ref, err := name.ParseReference(image, name.WeakValidation)
@@ -122,18 +127,85 @@ func GenDockerConfig(auths map[string]types.DockerRegistryAuth, images []string)
 		}
 		regName := ref.Context().RegistryStr()
 
-		if _, ok := dockerConfig.Auths[regName]; ok {
-			continue
+		if _, ok := dockerConfig.Auths[regName]; !ok {
+			username, password, err := ResolveAuth(auths, regName)
+			if err != nil {
+				return nil, errors.Errorf("failed to resolve auth: %w", err)
+			}
+			dockerConfig.Auths[regName] = genDockerConfigAuth(username, password)
 		}
 
-		username, password, err := ResolveAuth(auths, regName)
+		mirror, err := registryMirror(mirrors, regName)
+		if err != nil {
+			return nil, err
+		}
+		if mirror == "" {
+			continue
+		}
+		if _, ok := dockerConfig.Auths[mirror]; ok {
+			continue
+		}
+		username, password, err := ResolveAuth(auths, mirror)
 		if err != nil {
 			return nil, errors.Errorf("failed to resolve auth: %w", err)
 		}
-		delimited := fmt.Sprintf("%s:%s", username, password)
-		auth := base64.StdEncoding.EncodeToString([]byte(delimited))
-		dockerConfig.Auths[regName] = DockerConfigAuth{Username: username, Password: password, Auth: auth}
+		if username == "" && password == "" {
+			dockerConfig.Auths[mirror] = dockerConfig.Auths[regName]
+			continue
+		}
+		dockerConfig.Auths[mirror] = genDockerConfigAuth(username, password)
 	}
 
 	return dockerConfig, nil
 }
+
+func genDockerConfigAuth(username, password string) DockerConfigAuth {
+	delimited := fmt.Sprintf("%s:%s", username, password)
+	auth := base64.StdEncoding.EncodeToString([]byte(delimited))
+	return DockerConfigAuth{Username: username, Password: password, Auth: auth}
+}
+
+// MirrorImage returns the image name rewritten to be pulled through the mirror
+// defined for its registry. mirrors is a map of registry names to mirror
+// hosts. If no mirror is defined for the image registry the image is returned
+// unchanged.
+func MirrorImage(mirrors map[string]string, image string) (string, error) {
+	if len(mirrors) == 0 {
+		return image, nil
+	}
+
+	ref, err := name.ParseReference(image, name.WeakValidation)
+	if err != nil {
+		return "", err
+	}
+
+	mirror, err := registryMirror(mirrors, ref.Context().RegistryStr())
+	if err != nil {
+		return "", err
+	}
+	if mirror == "" {
+		return image, nil
+	}
+
+	separator := ":"
+	if _, ok := ref.(name.Digest); ok {
+		separator = "@"
+	}
+	return fmt.Sprintf("%s/%s%s%s", mirror, ref.Context().RepositoryStr(), separator, ref.Identifier()), nil
+}
+
+// registryMirror returns the mirror host defined for the provided registry
+// name or an empty string if no mirror is defined
+func registryMirror(mirrors map[string]string, regName string) (string, error) {
+	for registry, mirror := range mirrors {
+		reg, err := name.NewRegistry(registry, name.WeakValidation)
+		if err != nil {
+			return "", errors.Errorf("wrong registry %q: %w", registry, err)
+		}
+		if reg.RegistryStr() == regName {
+			return mirror, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"testing"
+
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenDockerConfig(t *testing.T) {
+	registryAuth := DockerConfigAuth{Username: "user01", Password: "password01", Auth: "dXNlcjAxOnBhc3N3b3JkMDE="}
+	mirrorAuth := DockerConfigAuth{Username: "mirroruser", Password: "mirrorpassword", Auth: "bWlycm9ydXNlcjptaXJyb3JwYXNzd29yZA=="}
+	emptyAuth := DockerConfigAuth{Auth: "Og=="}
+
+	tests := []struct {
+		name    string
+		auths   map[string]types.DockerRegistryAuth
+		mirrors map[string]string
+		images  []string
+		out     *DockerConfig
+	}{
+		{
+			name: "test private image",
+			auths: map[string]types.DockerRegistryAuth{
+				"registry.example.com": {Type: types.DockerRegistryAuthTypeBasic, Username: "user01", Password: "password01"},
+			},
+			images: []string{"registry.example.com/private/image:latest"},
+			out: &DockerConfig{Auths: map[string]DockerConfigAuth{
+				"registry.example.com": registryAuth,
+			}},
+		},
+		{
+			name: "test mirrored private image",
+			auths: map[string]types.DockerRegistryAuth{
+				"registry.example.com": {Type: types.DockerRegistryAuthTypeBasic, Username: "user01", Password: "password01"},
+			},
+			mirrors: map[string]string{"registry.example.com": "mirror.example.com"},
+			images:  []string{"registry.example.com/private/image:latest"},
+			out: &DockerConfig{Auths: map[string]DockerConfigAuth{
+				"registry.example.com": registryAuth,
+				"mirror.example.com":   registryAuth,
+			}},
+		},
+		{
+			name: "test mirrored private image with mirror auth",
+			auths: map[string]types.DockerRegistryAuth{
+				"registry.example.com":       {Type: types.DockerRegistryAuthTypeBasic, Username: "user01", Password: "password01"},
+				"https://mirror.example.com": {Type: types.DockerRegistryAuthTypeBasic, Username: "mirroruser", Password: "mirrorpassword"},
+			},
+			mirrors: map[string]string{"registry.example.com": "mirror.example.com"},
+			images:  []string{"registry.example.com/private/image:latest"},
+			out: &DockerConfig{Auths: map[string]DockerConfigAuth{
+				"registry.example.com": registryAuth,
+				"mirror.example.com":   mirrorAuth,
+			}},
+		},
+		{
+			name: "test mirrored docker hub image and not mirrored private image",
+			auths: map[string]types.DockerRegistryAuth{
+				"registry.example.com": {Type: types.DockerRegistryAuthTypeBasic, Username: "user01", Password: "password01"},
+			},
+			mirrors: map[string]string{"docker.io": "mirror.example.com"},
+			images:  []string{"busybox", "registry.example.com/private/image:latest"},
+			out: &DockerConfig{Auths: map[string]DockerConfigAuth{
+				"index.docker.io":      emptyAuth,
+				"mirror.example.com":   emptyAuth,
+				"registry.example.com": registryAuth,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := GenDockerConfig(tt.auths, tt.mirrors, tt.images)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -28,22 +28,27 @@ import (
 type ActionHandler struct {
 	log               *zap.SugaredLogger
 	sd                *common.TokenSigningData
+	session           *common.SessionConfig
 	configstoreClient *csclient.Client
 	runserviceClient  *rsclient.Client
 	agolaID           string
 	apiExposedURL     string
 	webExposedURL     string
+
+	runEvents *runEventsBroker
 }
 
-func NewActionHandler(logger *zap.Logger, sd *common.TokenSigningData, configstoreClient *csclient.Client, runserviceClient *rsclient.Client, agolaID, apiExposedURL, webExposedURL string) *ActionHandler {
+func NewActionHandler(logger *zap.Logger, sd *common.TokenSigningData, session *common.SessionConfig, configstoreClient *csclient.Client, runserviceClient *rsclient.Client, agolaID, apiExposedURL, webExposedURL string) *ActionHandler {
 	return &ActionHandler{
 		log:               logger.Sugar(),
 		sd:                sd,
+		session:           session,
 		configstoreClient: configstoreClient,
 		runserviceClient:  runserviceClient,
 		agolaID:           agolaID,
 		apiExposedURL:     apiExposedURL,
 		webExposedURL:     webExposedURL,
+		runEvents:         newRunEventsBroker(),
 	}
 }
 
@@ -58,6 +63,8 @@ func ErrFromRemote(resp *http.Response, err error) error {
 			return util.NewErrBadRequest(err)
 		case http.StatusNotFound:
 			return util.NewErrNotExist(err)
+		case http.StatusForbidden:
+			return util.NewErrForbidden(err)
 		}
 	}
 
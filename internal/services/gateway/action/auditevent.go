@@ -0,0 +1,49 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+type GetAuditEventsRequest struct {
+	Actor    string
+	Action   string
+	Resource string
+	Since    *time.Time
+	Until    *time.Time
+
+	Start string
+	Limit int
+	Asc   bool
+}
+
+func (h *ActionHandler) GetAuditEvents(ctx context.Context, req *GetAuditEventsRequest) ([]*cstypes.AuditEvent, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	auditEvents, resp, err := h.configstoreClient.GetAuditEvents(ctx, req.Actor, req.Action, req.Resource, req.Since, req.Until, req.Start, req.Limit, req.Asc)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return auditEvents, nil
+}
@@ -31,6 +31,26 @@ func (h *ActionHandler) CurrentUserID(ctx context.Context) string {
 	return userIDVal.(string)
 }
 
+// CurrentSessionID returns the id of the web session used to authenticate the
+// request. It's empty when authenticated with a user or admin token.
+func (h *ActionHandler) CurrentSessionID(ctx context.Context) string {
+	sessionIDVal := ctx.Value("sessionid")
+	if sessionIDVal == nil {
+		return ""
+	}
+	return sessionIDVal.(string)
+}
+
+// CurrentProjectID returns the id of the project when the request is
+// authenticated with a project api key
+func (h *ActionHandler) CurrentProjectID(ctx context.Context) string {
+	projectIDVal := ctx.Value("projectid")
+	if projectIDVal == nil {
+		return ""
+	}
+	return projectIDVal.(string)
+}
+
 func (h *ActionHandler) IsUserLogged(ctx context.Context) bool {
 	return ctx.Value("userid") != nil
 }
@@ -187,6 +207,11 @@ func (h *ActionHandler) CanGetRun(ctx context.Context, runGroup string) (bool, e
 		ownerType = p.OwnerType
 		ownerID = p.OwnerID
 		visibility = p.GlobalVisibility
+
+		// project api keys can get only their project runs
+		if h.CurrentProjectID(ctx) == p.ID {
+			return true, nil
+		}
 	case common.GroupTypeUser:
 		// user direct runs
 		ownerType = cstypes.ConfigTypeUser
@@ -20,25 +20,42 @@ import (
 	"path"
 
 	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
 	rstypes "agola.io/agola/services/runservice/types"
 )
 
-// GetBadge return a badge for a project branch
+type Badge struct {
+	SVG string
+	// Public reports that the badge is of a public project and could be
+	// cached by shared caches
+	Public bool
+}
+
+// GetBadge return a badge for a project branch. The badge of a project the
+// user cannot access is always reported as unknown to not disclose its
+// existence and status.
 // TODO(sgotti) also handle tags and PRs
-func (h *ActionHandler) GetBadge(ctx context.Context, projectRef, branch string) (string, error) {
-	project, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+func (h *ActionHandler) GetBadge(ctx context.Context, projectRef, branch string) (*Badge, error) {
+	project, err := h.GetProject(ctx, projectRef)
 	if err != nil {
-		return "", ErrFromRemote(resp, err)
+		// report a not existing project like a private one to not leak its
+		// existence
+		if util.IsForbidden(err) || util.IsNotExist(err) {
+			return &Badge{SVG: badgeUnknown}, nil
+		}
+		return nil, err
 	}
+	public := project.GlobalVisibility == cstypes.VisibilityPublic
 
 	// if branch is empty we get the latest run for every branch.
 	group := path.Join("/", string(common.GroupTypeProject), project.ID, string(common.GroupTypeBranch), url.PathEscape(branch))
 	runResp, resp, err := h.runserviceClient.GetGroupLastRun(ctx, group, nil)
 	if err != nil {
-		return "", ErrFromRemote(resp, err)
+		return nil, ErrFromRemote(resp, err)
 	}
 	if len(runResp.Runs) == 0 {
-		return badgeUnknown, nil
+		return &Badge{SVG: badgeUnknown, Public: public}, nil
 	}
 	run := runResp.Runs[0]
 
@@ -61,9 +78,11 @@ func (h *ActionHandler) GetBadge(ctx context.Context, projectRef, branch string)
 		badge = badgeFailed
 	case rstypes.RunResultStopped:
 		badge = badgeFailed
+	case rstypes.RunResultSkipped:
+		badge = badgeUnknown
 	}
 
-	return badge, nil
+	return &Badge{SVG: badge, Public: public}, nil
 }
 
 // svg images generated from shields.io
@@ -0,0 +1,107 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+	rsclient "agola.io/agola/services/runservice/client"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	"go.uber.org/zap"
+)
+
+func TestGetBadge(t *testing.T) {
+	p := func(id string, visibility cstypes.Visibility) *csapitypes.Project {
+		return &csapitypes.Project{Project: &cstypes.Project{ID: id}, OwnerType: cstypes.ConfigTypeUser, OwnerID: "user01", GlobalVisibility: visibility}
+	}
+	projects := map[string]*csapitypes.Project{
+		"/api/v1alpha/projects/publicproject":  p("publicproject", cstypes.VisibilityPublic),
+		"/api/v1alpha/projects/privateproject": p("privateproject", cstypes.VisibilityPrivate),
+	}
+	cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project, ok := projects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "project doesn't exist"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(project)
+	}))
+	defer cs.Close()
+
+	// every project has a successful last run
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&rsapitypes.GetRunsResponse{
+			Runs: []*rstypes.Run{{ID: "run01", Phase: rstypes.RunPhaseFinished, Result: rstypes.RunResultSuccess}},
+		})
+	}))
+	defer rs.Close()
+
+	tests := []struct {
+		name       string
+		projectRef string
+		userID     string
+		out        *Badge
+	}{
+		{
+			name:       "test public project",
+			projectRef: "publicproject",
+			out:        &Badge{SVG: badgeSuccess, Public: true},
+		},
+		{
+			name:       "test private project",
+			projectRef: "privateproject",
+			out:        &Badge{SVG: badgeUnknown},
+		},
+		{
+			name:       "test private project with project member",
+			projectRef: "privateproject",
+			userID:     "user01",
+			out:        &Badge{SVG: badgeSuccess},
+		},
+		{
+			name:       "test missing project",
+			projectRef: "missingproject",
+			out:        &Badge{SVG: badgeUnknown},
+		},
+	}
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, csclient.NewClient(cs.URL), rsclient.NewClient(rs.URL), "", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.userID != "" {
+				ctx = context.WithValue(ctx, "userid", tt.userID)
+			}
+
+			badge, err := h.GetBadge(ctx, tt.projectRef, "")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if *badge != *tt.out {
+				t.Fatalf("expected badge %s (public: %t), got %s (public: %t)", tt.out.SVG, tt.out.Public, badge.SVG, badge.Public)
+			}
+		})
+	}
+}
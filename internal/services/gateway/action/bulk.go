@@ -0,0 +1,278 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// bulkOperationInterval is the minimum interval between two operations
+	// executed by a bulk request. It avoids overloading the runservice and the
+	// git sources when fanning out an operation to many projects.
+	bulkOperationInterval = 100 * time.Millisecond
+
+	bulkRunsFetchLimit = 40
+)
+
+// BulkOperationItem reports the result of an operation on a single item of a
+// bulk request. A bulk request doesn't stop at the first error, every item
+// reports its own error. It only stops when the request context is done: the
+// first not executed item reports the context error.
+type BulkOperationItem struct {
+	ProjectID   string
+	ProjectPath string
+	// RunID is the run of a run action
+	RunID string
+	// RunIDs are the runs created on the project
+	RunIDs []string
+	Err    error
+}
+
+type BulkOperationResponse struct {
+	Items []*BulkOperationItem
+}
+
+// bulkThrottle limits the rate of the operations executed by a bulk request
+type bulkThrottle struct {
+	ticker *time.Ticker
+	first  bool
+}
+
+func newBulkThrottle() *bulkThrottle {
+	return &bulkThrottle{ticker: time.NewTicker(bulkOperationInterval), first: true}
+}
+
+func (t *bulkThrottle) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if t.first {
+		t.first = false
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.ticker.C:
+		return nil
+	}
+}
+
+func (t *bulkThrottle) stop() {
+	t.ticker.Stop()
+}
+
+// bulkProjectGroupProjects returns all the projects inside the provided
+// project group and all its subgroups
+func (h *ActionHandler) bulkProjectGroupProjects(ctx context.Context, projectGroupRef string) ([]*csapitypes.Project, error) {
+	pg, resp, err := h.configstoreClient.GetProjectGroup(ctx, projectGroupRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project group %q: %w", projectGroupRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, pg.OwnerType, pg.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	projects := []*csapitypes.Project{}
+	pgIDs := []string{pg.ID}
+	for len(pgIDs) > 0 {
+		pgID := pgIDs[0]
+		pgIDs = pgIDs[1:]
+
+		pgProjects, resp, err := h.configstoreClient.GetProjectGroupProjects(ctx, pgID)
+		if err != nil {
+			return nil, errors.Errorf("failed to get project group %q projects: %w", pgID, ErrFromRemote(resp, err))
+		}
+		projects = append(projects, pgProjects...)
+
+		subgroups, resp, err := h.configstoreClient.GetProjectGroupSubgroups(ctx, pgID)
+		if err != nil {
+			return nil, errors.Errorf("failed to get project group %q subgroups: %w", pgID, ErrFromRemote(resp, err))
+		}
+		for _, sg := range subgroups {
+			pgIDs = append(pgIDs, sg.ID)
+		}
+	}
+
+	return projects, nil
+}
+
+// bulkProjectActiveRuns returns the queued and running runs of a project
+// having all the provided tags
+func (h *ActionHandler) bulkProjectActiveRuns(ctx context.Context, projectID string, tags []string) ([]*rstypes.Run, error) {
+	group := common.GenRunGroup(common.GroupTypeProject, projectID, "", "")
+	phaseFilter := []string{string(rstypes.RunPhaseQueued), string(rstypes.RunPhaseRunning)}
+
+	runs := []*rstypes.Run{}
+	start := ""
+	for {
+		runsResp, resp, err := h.runserviceClient.GetRuns(ctx, phaseFilter, nil, tags, []string{group}, false, nil, start, bulkRunsFetchLimit, true)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+		runs = append(runs, runsResp.Runs...)
+		if len(runsResp.Runs) < bulkRunsFetchLimit {
+			break
+		}
+		start = runsResp.Runs[len(runsResp.Runs)-1].ID
+	}
+
+	return runs, nil
+}
+
+type BulkRunActionsRequest struct {
+	ProjectGroupRef string
+	ActionType      RunActionType
+	// Tags, when defined, select only the runs having all the provided tags
+	Tags []string
+}
+
+// BulkRunActions executes a run action on all the active runs of all the
+// projects inside a project group (and its subgroups), optionally selected by
+// their tags.
+//
+// The cancel action cancels the queued runs and stops the running ones, the
+// stop action only stops the running runs.
+func (h *ActionHandler) BulkRunActions(ctx context.Context, req *BulkRunActionsRequest) (*BulkOperationResponse, error) {
+	switch req.ActionType {
+	case RunActionTypeCancel:
+	case RunActionTypeStop:
+	default:
+		return nil, util.NewErrBadRequest(errors.Errorf("wrong bulk run action type %q", req.ActionType))
+	}
+
+	projects, err := h.bulkProjectGroupProjects(ctx, req.ProjectGroupRef)
+	if err != nil {
+		return nil, err
+	}
+
+	throttle := newBulkThrottle()
+	defer throttle.stop()
+
+	res := &BulkOperationResponse{Items: []*BulkOperationItem{}}
+	for _, p := range projects {
+		runs, err := h.bulkProjectActiveRuns(ctx, p.ID, req.Tags)
+		if err != nil {
+			res.Items = append(res.Items, &BulkOperationItem{
+				ProjectID:   p.ID,
+				ProjectPath: p.Path,
+				Err:         errors.Errorf("failed to get project runs: %w", err),
+			})
+			continue
+		}
+
+		for _, run := range runs {
+			actionType := req.ActionType
+			if run.Phase == rstypes.RunPhaseRunning {
+				actionType = RunActionTypeStop
+			} else if actionType == RunActionTypeStop {
+				continue
+			}
+			// already stopping
+			if run.Stop {
+				continue
+			}
+
+			if err := throttle.wait(ctx); err != nil {
+				res.Items = append(res.Items, &BulkOperationItem{
+					ProjectID:   p.ID,
+					ProjectPath: p.Path,
+					RunID:       run.ID,
+					Err:         err,
+				})
+				return res, nil
+			}
+
+			_, err := h.RunAction(ctx, &RunActionsRequest{RunID: run.ID, ActionType: actionType})
+			res.Items = append(res.Items, &BulkOperationItem{
+				ProjectID:   p.ID,
+				ProjectPath: p.Path,
+				RunID:       run.ID,
+				Err:         err,
+			})
+		}
+	}
+
+	return res, nil
+}
+
+type BulkCreateRunsRequest struct {
+	ProjectGroupRef string
+	Branch          string
+	Tag             string
+	Ref             string
+	// RunSelectors are the names or labels of the runs, defined in the
+	// projects run config, to create. When empty all the runs are created.
+	RunSelectors []string
+	// RunTags are added to the tags defined in the run config
+	RunTags []string
+}
+
+// bulkCreateRunFunc creates the runs of a project returning their ids
+type bulkCreateRunFunc func(ctx context.Context, projectID string) ([]string, error)
+
+// BulkCreateRuns creates the runs on all the projects inside a project group
+// (and its subgroups).
+func (h *ActionHandler) BulkCreateRuns(ctx context.Context, req *BulkCreateRunsRequest) (*BulkOperationResponse, error) {
+	return h.bulkCreateRuns(ctx, req, func(ctx context.Context, projectID string) ([]string, error) {
+		return h.ProjectCreateRun(ctx, projectID, req.Branch, req.Tag, req.Ref, "", "", req.RunSelectors, req.RunTags)
+	})
+}
+
+func (h *ActionHandler) bulkCreateRuns(ctx context.Context, req *BulkCreateRunsRequest, createRun bulkCreateRunFunc) (*BulkOperationResponse, error) {
+	projects, err := h.bulkProjectGroupProjects(ctx, req.ProjectGroupRef)
+	if err != nil {
+		return nil, err
+	}
+
+	throttle := newBulkThrottle()
+	defer throttle.stop()
+
+	res := &BulkOperationResponse{Items: []*BulkOperationItem{}}
+	for _, p := range projects {
+		if err := throttle.wait(ctx); err != nil {
+			res.Items = append(res.Items, &BulkOperationItem{
+				ProjectID:   p.ID,
+				ProjectPath: p.Path,
+				Err:         err,
+			})
+			return res, nil
+		}
+
+		runIDs, err := createRun(ctx, p.ID)
+		res.Items = append(res.Items, &BulkOperationItem{
+			ProjectID:   p.ID,
+			ProjectPath: p.Path,
+			RunIDs:      runIDs,
+			Err:         err,
+		})
+	}
+
+	return res, nil
+}
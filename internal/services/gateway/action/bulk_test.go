@@ -0,0 +1,268 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"agola.io/agola/internal/services/common"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+	rsclient "agola.io/agola/services/runservice/client"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// bulkTestConfigstore returns a fake configstore with the org01 root project
+// group containing project01 and the subgroup projectgroup01 containing
+// project02
+func bulkTestConfigstore(t *testing.T) *httptest.Server {
+	pg := func(id, path string) *csapitypes.ProjectGroup {
+		return &csapitypes.ProjectGroup{ProjectGroup: &cstypes.ProjectGroup{ID: id}, OwnerType: cstypes.ConfigTypeOrg, OwnerID: "org01", Path: path}
+	}
+	p := func(id, path string) *csapitypes.Project {
+		return &csapitypes.Project{Project: &cstypes.Project{ID: id}, OwnerType: cstypes.ConfigTypeOrg, OwnerID: "org01", Path: path}
+	}
+	responses := map[string]interface{}{
+		"/api/v1alpha/projectgroups/org%2Forg01":    pg("pg01", "org/org01"),
+		"/api/v1alpha/projectgroups/pg01/projects":  []*csapitypes.Project{p("project01", "org/org01/project01")},
+		"/api/v1alpha/projectgroups/pg01/subgroups": []*csapitypes.ProjectGroup{pg("pg02", "org/org01/projectgroup01")},
+		"/api/v1alpha/projectgroups/pg02/projects":  []*csapitypes.Project{p("project02", "org/org01/projectgroup01/project02")},
+		"/api/v1alpha/projectgroups/pg02/subgroups": []*csapitypes.ProjectGroup{},
+		"/api/v1alpha/projects/project01":           p("project01", "org/org01/project01"),
+		"/api/v1alpha/projects/project02":           p("project02", "org/org01/projectgroup01/project02"),
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			t.Errorf("unexpected configstore request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(res)
+	}))
+}
+
+func TestBulkRunActions(t *testing.T) {
+	cs := bulkTestConfigstore(t)
+	defer cs.Close()
+
+	runs := map[string]*rstypes.Run{
+		"run01": {ID: "run01", Group: common.GenRunGroup(common.GroupTypeProject, "project01", "", ""), Phase: rstypes.RunPhaseQueued, Tags: []string{"nightly"}},
+		"run02": {ID: "run02", Group: common.GenRunGroup(common.GroupTypeProject, "project01", "", ""), Phase: rstypes.RunPhaseRunning, Tags: []string{"nightly"}},
+		"run03": {ID: "run03", Group: common.GenRunGroup(common.GroupTypeProject, "project02", "", ""), Phase: rstypes.RunPhaseQueued, Tags: []string{"nightly", "release"}},
+		"run04": {ID: "run04", Group: common.GenRunGroup(common.GroupTypeProject, "project02", "", ""), Phase: rstypes.RunPhaseRunning},
+		"run05": {ID: "run05", Group: common.GenRunGroup(common.GroupTypeProject, "project02", "", ""), Phase: rstypes.RunPhaseRunning, Tags: []string{"nightly"}, Stop: true},
+	}
+
+	// fake runservice filtering the runs by group and tags and recording the
+	// run actions
+	var m sync.Mutex
+	actions := map[string]rsapitypes.RunActionType{}
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api/v1alpha")
+		switch {
+		case r.Method == "GET" && path == "/runs":
+			q := r.URL.Query()
+			res := &rsapitypes.GetRunsResponse{Runs: []*rstypes.Run{}}
+			ids := []string{}
+			for id := range runs {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+		RUNS:
+			for _, id := range ids {
+				run := runs[id]
+				if run.Group != q.Get("group") {
+					continue
+				}
+				for _, tag := range q["tag"] {
+					found := false
+					for _, rtag := range run.Tags {
+						if rtag == tag {
+							found = true
+						}
+					}
+					if !found {
+						continue RUNS
+					}
+				}
+				res.Runs = append(res.Runs, run)
+			}
+			_ = json.NewEncoder(w).Encode(res)
+		case r.Method == "GET" && strings.HasPrefix(path, "/runs/"):
+			run := runs[strings.TrimPrefix(path, "/runs/")]
+			_ = json.NewEncoder(w).Encode(&rsapitypes.RunResponse{Run: run, RunConfig: &rstypes.RunConfig{ID: run.ID, Group: run.Group}})
+		case r.Method == "PUT" && strings.HasSuffix(path, "/actions"):
+			var req rsapitypes.RunActionsRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+			m.Lock()
+			actions[strings.TrimSuffix(strings.TrimPrefix(path, "/runs/"), "/actions")] = req.ActionType
+			m.Unlock()
+		default:
+			t.Errorf("unexpected runservice request %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer rs.Close()
+
+	tests := []struct {
+		name       string
+		actionType RunActionType
+		tags       []string
+		items      []*BulkOperationItem
+		actions    map[string]rsapitypes.RunActionType
+	}{
+		{
+			name:       "test cancel all runs",
+			actionType: RunActionTypeCancel,
+			items: []*BulkOperationItem{
+				{ProjectID: "project01", ProjectPath: "org/org01/project01", RunID: "run01"},
+				{ProjectID: "project01", ProjectPath: "org/org01/project01", RunID: "run02"},
+				{ProjectID: "project02", ProjectPath: "org/org01/projectgroup01/project02", RunID: "run03"},
+				{ProjectID: "project02", ProjectPath: "org/org01/projectgroup01/project02", RunID: "run04"},
+			},
+			actions: map[string]rsapitypes.RunActionType{
+				"run01": rsapitypes.RunActionTypeChangePhase,
+				"run02": rsapitypes.RunActionTypeStop,
+				"run03": rsapitypes.RunActionTypeChangePhase,
+				"run04": rsapitypes.RunActionTypeStop,
+			},
+		},
+		{
+			name:       "test cancel runs with tag",
+			actionType: RunActionTypeCancel,
+			tags:       []string{"nightly"},
+			items: []*BulkOperationItem{
+				{ProjectID: "project01", ProjectPath: "org/org01/project01", RunID: "run01"},
+				{ProjectID: "project01", ProjectPath: "org/org01/project01", RunID: "run02"},
+				{ProjectID: "project02", ProjectPath: "org/org01/projectgroup01/project02", RunID: "run03"},
+			},
+			actions: map[string]rsapitypes.RunActionType{
+				"run01": rsapitypes.RunActionTypeChangePhase,
+				"run02": rsapitypes.RunActionTypeStop,
+				"run03": rsapitypes.RunActionTypeChangePhase,
+			},
+		},
+		{
+			name:       "test stop runs with multiple tags",
+			actionType: RunActionTypeStop,
+			tags:       []string{"nightly", "release"},
+			items:      []*BulkOperationItem{},
+			actions:    map[string]rsapitypes.RunActionType{},
+		},
+	}
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, csclient.NewClient(cs.URL), rsclient.NewClient(rs.URL), "", "", "")
+	ctx := context.WithValue(context.Background(), "admin", true)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions = map[string]rsapitypes.RunActionType{}
+
+			res, err := h.BulkRunActions(ctx, &BulkRunActionsRequest{ProjectGroupRef: "org/org01", ActionType: tt.actionType, Tags: tt.tags})
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.items, res.Items); diff != "" {
+				t.Error(diff)
+			}
+			if diff := cmp.Diff(tt.actions, actions); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestBulkCreateRuns(t *testing.T) {
+	cs := bulkTestConfigstore(t)
+	defer cs.Close()
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, csclient.NewClient(cs.URL), nil, "", "", "")
+	ctx := context.WithValue(context.Background(), "admin", true)
+
+	createRun := func(ctx context.Context, projectID string) ([]string, error) {
+		if projectID == "project02" {
+			return nil, errors.Errorf("no runs selected")
+		}
+		return []string{"run01", "run02"}, nil
+	}
+
+	res, err := h.bulkCreateRuns(ctx, &BulkCreateRunsRequest{ProjectGroupRef: "org/org01", Branch: "master"}, createRun)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if len(res.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(res.Items))
+	}
+	if diff := cmp.Diff(&BulkOperationItem{ProjectID: "project01", ProjectPath: "org/org01/project01", RunIDs: []string{"run01", "run02"}}, res.Items[0]); diff != "" {
+		t.Error(diff)
+	}
+	item := res.Items[1]
+	if item.ProjectID != "project02" || len(item.RunIDs) != 0 || item.Err == nil || item.Err.Error() != "no runs selected" {
+		t.Fatalf("unexpected item for project02: %+v", item)
+	}
+}
+
+func TestBulkCreateRunsContextDone(t *testing.T) {
+	cs := bulkTestConfigstore(t)
+	defer cs.Close()
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, csclient.NewClient(cs.URL), nil, "", "", "")
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "admin", true))
+	defer cancel()
+
+	// the request context is done after the first project runs creation
+	createRun := func(ctx context.Context, projectID string) ([]string, error) {
+		if projectID == "project02" {
+			t.Fatalf("unexpected run creation on project02")
+		}
+		cancel()
+		return []string{"run01"}, nil
+	}
+
+	res, err := h.bulkCreateRuns(ctx, &BulkCreateRunsRequest{ProjectGroupRef: "org/org01", Branch: "master"}, createRun)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// the already executed items are reported
+	if len(res.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(res.Items))
+	}
+	if diff := cmp.Diff(&BulkOperationItem{ProjectID: "project01", ProjectPath: "org/org01/project01", RunIDs: []string{"run01"}}, res.Items[0]); diff != "" {
+		t.Error(diff)
+	}
+	item := res.Items[1]
+	if item.ProjectID != "project02" || !errors.Is(item.Err, context.Canceled) {
+		t.Fatalf("unexpected item for project02: %+v", item)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// configUsageUpdateInterval is the minimum interval between two updates
+	// of the usage of a secret or variable by the same project
+	configUsageUpdateInterval = 1 * time.Hour
+
+	// configUsageRecentInterval is the interval in which a secret or
+	// variable usage is considered recent. Deletions requested with
+	// failIfUsed are refused when the item has recent usages.
+	configUsageRecentInterval = 7 * 24 * time.Hour
+)
+
+// ConfigUsage reports when a project run last used a secret or variable
+type ConfigUsage struct {
+	ProjectID    string
+	ProjectPath  string
+	LastUsedTime time.Time
+}
+
+func (h *ActionHandler) GetSecretUsages(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string) ([]*ConfigUsage, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, parentType, parentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	return h.getSecretUsages(ctx, parentType, parentRef, name)
+}
+
+func (h *ActionHandler) getSecretUsages(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string) ([]*ConfigUsage, error) {
+	cssecrets, err := h.GetSecrets(ctx, &GetSecretsRequest{ParentType: parentType, ParentRef: parentRef})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range cssecrets {
+		if s.Name == name {
+			return h.configUsages(ctx, s.Usages)
+		}
+	}
+
+	return nil, util.NewErrNotExist(errors.Errorf("secret with name %q doesn't exist", name))
+}
+
+func (h *ActionHandler) GetVariableUsages(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string) ([]*ConfigUsage, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, parentType, parentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	return h.getVariableUsages(ctx, parentType, parentRef, name)
+}
+
+func (h *ActionHandler) getVariableUsages(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string) ([]*ConfigUsage, error) {
+	csvariables, _, err := h.GetVariables(ctx, &GetVariablesRequest{ParentType: parentType, ParentRef: parentRef})
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range csvariables {
+		if v.Name == name {
+			return h.configUsages(ctx, v.Usages)
+		}
+	}
+
+	return nil, util.NewErrNotExist(errors.Errorf("variable with name %q doesn't exist", name))
+}
+
+// configUsages returns the usages sorted from the most recent one. Usages of
+// removed projects are skipped.
+func (h *ActionHandler) configUsages(ctx context.Context, csusages map[string]*cstypes.ConfigUsage) ([]*ConfigUsage, error) {
+	usages := []*ConfigUsage{}
+	for projectID, u := range csusages {
+		project, resp, err := h.configstoreClient.GetProject(ctx, projectID)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				continue
+			}
+			return nil, errors.Errorf("failed to get project %q: %w", projectID, ErrFromRemote(resp, err))
+		}
+		usages = append(usages, &ConfigUsage{
+			ProjectID:    projectID,
+			ProjectPath:  project.Path,
+			LastUsedTime: u.LastUsedTime,
+		})
+	}
+
+	sort.Slice(usages, func(i, j int) bool { return usages[i].LastUsedTime.After(usages[j].LastUsedTime) })
+
+	return usages, nil
+}
+
+// checkConfigRecentlyUsed returns an error listing the projects that recently
+// used the item
+func checkConfigRecentlyUsed(kind, name string, usages []*ConfigUsage) error {
+	projectPaths := []string{}
+	for _, u := range usages {
+		if time.Since(u.LastUsedTime) <= configUsageRecentInterval {
+			projectPaths = append(projectPaths, u.ProjectPath)
+		}
+	}
+	if len(projectPaths) > 0 {
+		return util.NewErrBadRequest(errors.Errorf("%s %q has been used by recent runs of projects: %s", kind, name, strings.Join(projectPaths, ", ")))
+	}
+
+	return nil
+}
+
+func configUsageNeedsUpdate(usages map[string]*cstypes.ConfigUsage, projectID string) bool {
+	usage, ok := usages[projectID]
+	if !ok {
+		return true
+	}
+	return time.Since(usage.LastUsedTime) > configUsageUpdateInterval
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// Fsck checks the configstore data consistency and, when repair is true,
+// repairs the problems that could be automatically repaired
+func (h *ActionHandler) Fsck(ctx context.Context, repair bool) (*csapitypes.FsckResponse, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	res, resp, err := h.configstoreClient.Fsck(ctx, repair)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return res, nil
+}
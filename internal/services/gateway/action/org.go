@@ -173,6 +173,29 @@ func (h *ActionHandler) AddOrgMember(ctx context.Context, orgRef, userRef string
 	}, nil
 }
 
+// SetOrgSecretPolicy sets the org secret policy. A nil policy removes it.
+func (h *ActionHandler) SetOrgSecretPolicy(ctx context.Context, orgRef string, policy *cstypes.SecretPolicy) (*cstypes.Organization, error) {
+	org, resp, err := h.configstoreClient.GetOrg(ctx, orgRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	isOrgOwner, err := h.IsOrgOwner(ctx, org.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isOrgOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	org, resp, err = h.configstoreClient.SetOrgSecretPolicy(ctx, org.ID, policy)
+	if err != nil {
+		return nil, errors.Errorf("failed to set organization secret policy: %w", ErrFromRemote(resp, err))
+	}
+
+	return org, nil
+}
+
 func (h *ActionHandler) RemoveOrgMember(ctx context.Context, orgRef, userRef string) error {
 	org, resp, err := h.configstoreClient.GetOrg(ctx, orgRef)
 	if err != nil {
@@ -0,0 +1,100 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/config"
+	"agola.io/agola/internal/services/common"
+	itypes "agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// GetProjectPreviewEnvironments returns the active pull request preview
+// environments of a project
+func (h *ActionHandler) GetProjectPreviewEnvironments(ctx context.Context, projectRef string) ([]*rstypes.PreviewEnvironment, error) {
+	project, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	group := common.GenRunGroup(common.GroupTypeProject, project.ID, "", "")
+	canGetRun, err := h.CanGetRun(ctx, group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	envsResp, resp, err := h.runserviceClient.GetPreviewEnvironments(ctx, group)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return envsResp.PreviewEnvironments, nil
+}
+
+// activePreviewEnvironments returns the names of the active preview
+// environments of a run group
+func (h *ActionHandler) activePreviewEnvironments(ctx context.Context, group string) (map[string]struct{}, error) {
+	envsResp, resp, err := h.runserviceClient.GetPreviewEnvironments(ctx, group)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	envs := map[string]struct{}{}
+	for _, env := range envsResp.PreviewEnvironments {
+		// only the environments of this exact group since the runservice
+		// also returns the ones of its subgroups
+		if env.Group == group {
+			envs[env.Name] = struct{}{}
+		}
+	}
+	return envs, nil
+}
+
+// previewEnvironmentRunAllowed reports if a run must be created based on the
+// preview environment it manages. When the pull request is closed only the
+// runs tearing down an active preview environment are created, while teardown
+// runs are never created for other events.
+func previewEnvironmentRunAllowed(run *config.Run, req *CreateRunRequest, activeEnvs map[string]struct{}) bool {
+	teardown := run.PreviewEnvironment != nil && run.PreviewEnvironment.Teardown
+	if !req.PullRequestClosed {
+		return !teardown
+	}
+	if !teardown {
+		return false
+	}
+	_, active := activeEnvs[run.PreviewEnvironment.Name]
+	return active
+}
+
+// genRunPreviewEnvironment returns the preview environment managed by a run.
+// Preview environments are keyed by pull request so they're ignored for the
+// runs of other ref types.
+func genRunPreviewEnvironment(run *config.Run, req *CreateRunRequest) *rstypes.RunPreviewEnvironment {
+	if run.PreviewEnvironment == nil || req.RefType != itypes.RunRefTypePullRequest {
+		return nil
+	}
+	return &rstypes.RunPreviewEnvironment{
+		Name:     run.PreviewEnvironment.Name,
+		Teardown: run.PreviewEnvironment.Teardown,
+	}
+}
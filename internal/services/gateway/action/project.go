@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"time"
 
 	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/types"
@@ -27,9 +28,16 @@ import (
 	csapitypes "agola.io/agola/services/configstore/api/types"
 	cstypes "agola.io/agola/services/configstore/types"
 
+	uuid "github.com/satori/go.uuid"
 	errors "golang.org/x/xerrors"
 )
 
+const (
+	// webhookSecretRotationGracePeriod is the time the previous webhook secret
+	// is still accepted after a webhook secret rotation
+	webhookSecretRotationGracePeriod = 10 * time.Minute
+)
+
 func (h *ActionHandler) GetProject(ctx context.Context, projectRef string) (*csapitypes.Project, error) {
 	project, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
 	if err != nil {
@@ -58,6 +66,12 @@ type CreateProjectRequest struct {
 	RepoPath            string
 	SkipSSHHostKeyCheck bool
 	PassVarsToForkedPR  bool
+	NetworkPolicy       string
+	SecurityProfile     string
+
+	UntrustedRunsNeedApproval bool
+	ConfigFromBaseBranch      bool
+	MaxStepLogSize            int64
 }
 
 func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectRequest) (*csapitypes.Project, error) {
@@ -95,6 +109,9 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 	if req.RepoPath == "" {
 		return nil, util.NewErrBadRequest(errors.Errorf("empty remote repo path"))
 	}
+	if req.MaxStepLogSize < 0 {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid max step log size %d", req.MaxStepLogSize))
+	}
 
 	projectPath := path.Join(pg.Path, req.Name)
 	_, resp, err = h.configstoreClient.GetProject(ctx, projectPath)
@@ -152,6 +169,11 @@ func (h *ActionHandler) CreateProject(ctx context.Context, req *CreateProjectReq
 		SkipSSHHostKeyCheck:        req.SkipSSHHostKeyCheck,
 		SSHPrivateKey:              string(privateKey),
 		PassVarsToForkedPR:         req.PassVarsToForkedPR,
+		NetworkPolicy:              req.NetworkPolicy,
+		SecurityProfile:            req.SecurityProfile,
+		UntrustedRunsNeedApproval:  req.UntrustedRunsNeedApproval,
+		ConfigFromBaseBranch:       req.ConfigFromBaseBranch,
+		MaxStepLogSize:             req.MaxStepLogSize,
 	}
 
 	h.log.Infof("creating project")
@@ -187,6 +209,14 @@ type UpdateProjectRequest struct {
 
 	Visibility         *cstypes.Visibility
 	PassVarsToForkedPR *bool
+	NetworkPolicy      *string
+	SecurityProfile    *string
+
+	UntrustedRunsNeedApproval *bool
+	ConfigFromBaseBranch      *bool
+	MaxStepLogSize            *int64
+	WebhookRunSelectors       *[]string
+	RequiredRuns              *[]string
 }
 
 func (h *ActionHandler) UpdateProject(ctx context.Context, projectRef string, req *UpdateProjectRequest) (*csapitypes.Project, error) {
@@ -215,6 +245,40 @@ func (h *ActionHandler) UpdateProject(ctx context.Context, projectRef string, re
 	if req.PassVarsToForkedPR != nil {
 		p.PassVarsToForkedPR = *req.PassVarsToForkedPR
 	}
+	if req.NetworkPolicy != nil {
+		p.NetworkPolicy = *req.NetworkPolicy
+	}
+	if req.SecurityProfile != nil {
+		p.SecurityProfile = *req.SecurityProfile
+	}
+	if req.UntrustedRunsNeedApproval != nil {
+		p.UntrustedRunsNeedApproval = *req.UntrustedRunsNeedApproval
+	}
+	if req.ConfigFromBaseBranch != nil {
+		p.ConfigFromBaseBranch = *req.ConfigFromBaseBranch
+	}
+	if req.MaxStepLogSize != nil {
+		if *req.MaxStepLogSize < 0 {
+			return nil, util.NewErrBadRequest(errors.Errorf("invalid max step log size %d", *req.MaxStepLogSize))
+		}
+		p.MaxStepLogSize = *req.MaxStepLogSize
+	}
+	if req.WebhookRunSelectors != nil {
+		for _, s := range *req.WebhookRunSelectors {
+			if s == "" {
+				return nil, util.NewErrBadRequest(errors.Errorf("empty webhook run selector"))
+			}
+		}
+		p.WebhookRunSelectors = *req.WebhookRunSelectors
+	}
+	if req.RequiredRuns != nil {
+		for _, n := range *req.RequiredRuns {
+			if n == "" {
+				return nil, util.NewErrBadRequest(errors.Errorf("empty required run name"))
+			}
+		}
+		p.RequiredRuns = *req.RequiredRuns
+	}
 
 	h.log.Infof("updating project")
 	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
@@ -285,6 +349,260 @@ func (h *ActionHandler) ProjectUpdateRepoLinkedAccount(ctx context.Context, proj
 	return rp, nil
 }
 
+type SetProjectConfigRepositoryRequest struct {
+	RemoteSourceName string
+	RepoPath         string
+	Branch           string
+}
+
+// ProjectSetConfigRepository sets the repository from where the project run
+// config is read. The config repository is accessed using the current user
+// linked account of the provided remote source.
+func (h *ActionHandler) ProjectSetConfigRepository(ctx context.Context, projectRef string, req *SetProjectConfigRepositoryRequest) (*csapitypes.Project, error) {
+	if req.RemoteSourceName == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty remote source name"))
+	}
+	if req.RepoPath == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty config repository path"))
+	}
+	if req.Branch == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty config repository branch"))
+	}
+
+	curUserID := h.CurrentUserID(ctx)
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, curUserID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user %q: %w", curUserID, ErrFromRemote(resp, err))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, req.RemoteSourceName)
+	if err != nil {
+		return nil, errors.Errorf("failed to get remote source %q: %w", req.RemoteSourceName, ErrFromRemote(resp, err))
+	}
+	var la *cstypes.LinkedAccount
+	for _, v := range user.LinkedAccounts {
+		if v.RemoteSourceID == rs.ID {
+			la = v
+			break
+		}
+	}
+	if la == nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("user doesn't have a linked account for remote source %q", rs.Name))
+	}
+
+	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+	if err != nil {
+		return nil, errors.Errorf("failed to create gitsource client: %w", err)
+	}
+
+	// check user has access to the config repository branch
+	if _, err := gitSource.GetRef(req.RepoPath, gitSource.BranchRef(req.Branch)); err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("failed to get config repository %q branch %q: %w", req.RepoPath, req.Branch, err))
+	}
+
+	p.ConfigRepository = &cstypes.ProjectConfigRepository{
+		RemoteSourceID:  rs.ID,
+		LinkedAccountID: la.ID,
+		RepositoryPath:  req.RepoPath,
+		Branch:          req.Branch,
+	}
+
+	h.log.Infof("updating project")
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	return rp, nil
+}
+
+// ProjectRemoveConfigRepository removes the project config repository so the
+// run config is read again from the project repository.
+func (h *ActionHandler) ProjectRemoveConfigRepository(ctx context.Context, projectRef string) (*csapitypes.Project, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	p.ConfigRepository = nil
+
+	h.log.Infof("updating project")
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	return rp, nil
+}
+
+type SetProjectTriggerPolicyRequest struct {
+	Branches     cstypes.TriggerBranchesPolicy
+	Tags         bool
+	PullRequests bool
+}
+
+// ProjectSetTriggerPolicy sets which webhook events create the project runs
+func (h *ActionHandler) ProjectSetTriggerPolicy(ctx context.Context, projectRef string, req *SetProjectTriggerPolicyRequest) (*csapitypes.Project, error) {
+	if !cstypes.IsValidTriggerBranchesPolicy(req.Branches) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid trigger policy branches %q", req.Branches))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	p.TriggerPolicy = &cstypes.ProjectTriggerPolicy{
+		Branches:     req.Branches,
+		Tags:         req.Tags,
+		PullRequests: req.PullRequests,
+	}
+
+	h.log.Infof("updating project")
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	return rp, nil
+}
+
+type SetProjectDeployEnvironmentRequest struct {
+	Name              string
+	RequiredApprovals int
+	// Approvers are the refs (id or name) of the users allowed to approve the
+	// tasks
+	Approvers []string
+	Branches  []string
+	WaitTimer time.Duration
+}
+
+// ProjectSetDeployEnvironment creates or replaces a project deploy environment
+func (h *ActionHandler) ProjectSetDeployEnvironment(ctx context.Context, projectRef string, req *SetProjectDeployEnvironmentRequest) (*csapitypes.Project, error) {
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid deploy environment name %q", req.Name))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	approvers := []string{}
+	for _, userRef := range req.Approvers {
+		user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
+		if err != nil {
+			return nil, errors.Errorf("failed to get user %q: %w", userRef, ErrFromRemote(resp, err))
+		}
+		approvers = append(approvers, user.ID)
+	}
+
+	de := &cstypes.ProjectDeployEnvironment{
+		Name:              req.Name,
+		RequiredApprovals: req.RequiredApprovals,
+		Approvers:         approvers,
+		Branches:          req.Branches,
+		WaitTimer:         req.WaitTimer,
+	}
+
+	replaced := false
+	for i, cde := range p.DeployEnvironments {
+		if cde.Name == req.Name {
+			p.DeployEnvironments[i] = de
+			replaced = true
+		}
+	}
+	if !replaced {
+		p.DeployEnvironments = append(p.DeployEnvironments, de)
+	}
+
+	h.log.Infof("updating project")
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	return rp, nil
+}
+
+// ProjectDeleteDeployEnvironment removes a project deploy environment. The
+// new runs with tasks targeting it will report a setup error.
+func (h *ActionHandler) ProjectDeleteDeployEnvironment(ctx context.Context, projectRef, name string) error {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	if p.DeployEnvironment(name) == nil {
+		return util.NewErrNotExist(errors.Errorf("project deploy environment %q doesn't exist", name))
+	}
+	des := []*cstypes.ProjectDeployEnvironment{}
+	for _, de := range p.DeployEnvironments {
+		if de.Name != name {
+			des = append(des, de)
+		}
+	}
+	p.DeployEnvironments = des
+
+	h.log.Infof("updating project")
+	if _, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project); err != nil {
+		return errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project %s updated, ID: %s", p.Name, p.ID)
+
+	return nil
+}
+
 func (h *ActionHandler) setupGitSourceRepo(ctx context.Context, rs *cstypes.RemoteSource, user *cstypes.User, la *cstypes.LinkedAccount, project *csapitypes.Project) error {
 	gitsource, err := h.GetGitSource(ctx, rs, user.Name, la)
 	if err != nil {
@@ -386,6 +704,112 @@ func (h *ActionHandler) ReconfigProject(ctx context.Context, projectRef string)
 	return h.setupGitSourceRepo(ctx, rs, user, la, p)
 }
 
+// RotateProjectWebhookSecret generates a new project webhook secret and
+// reinstalls the repository webhook with it. The previous webhook secret is
+// still accepted for webhookSecretRotationGracePeriod to not reject the
+// webhooks delivered during the rotation.
+func (h *ActionHandler) RotateProjectWebhookSecret(ctx context.Context, projectRef string) error {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	user, rs, la, err := h.getRemoteRepoAccessData(ctx, p.LinkedAccountID)
+	if err != nil {
+		return errors.Errorf("failed to get remote repo access data: %w", err)
+	}
+
+	// save the new webhook secret before reinstalling the webhook so the
+	// webhooks signed with the new secret will be accepted
+	oldProject := *p.Project
+	p.PreviousWebhookSecret = p.WebhookSecret
+	p.PreviousWebhookSecretExpiration = util.TimeP(time.Now().Add(webhookSecretRotationGracePeriod))
+	p.WebhookSecret = util.EncodeSha1Hex(uuid.NewV4().String())
+
+	h.log.Infof("updating project webhook secret")
+	rp, resp, err := h.configstoreClient.UpdateProject(ctx, p.ID, p.Project)
+	if err != nil {
+		return errors.Errorf("failed to update project: %w", ErrFromRemote(resp, err))
+	}
+
+	if serr := h.setupGitSourceRepo(ctx, rs, user, la, rp); serr != nil {
+		// restore the old webhook secret since the webhook could still use it
+		h.log.Errorf("failed to setup git source repo, restoring the previous webhook secret: %+v", serr)
+		if _, resp, err := h.configstoreClient.UpdateProject(ctx, rp.ID, &oldProject); err != nil {
+			h.log.Errorf("failed to restore project webhook secret: %+v", ErrFromRemote(resp, err))
+		}
+		return errors.Errorf("failed to setup git source repo: %w", serr)
+	}
+
+	return nil
+}
+
+type CreateProjectAPIKeyRequest struct {
+	ProjectRef string
+	APIKeyName string
+}
+
+// CreateProjectAPIKey creates a project api key authorized only for the
+// project operations and returns it
+func (h *ActionHandler) CreateProjectAPIKey(ctx context.Context, req *CreateProjectAPIKeyRequest) (string, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, req.ProjectRef)
+	if err != nil {
+		return "", errors.Errorf("failed to get project %q: %w", req.ProjectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return "", errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return "", util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	h.log.Infof("creating project api key")
+	creq := &csapitypes.CreateProjectAPIKeyRequest{
+		APIKeyName: req.APIKeyName,
+	}
+	res, resp, err := h.configstoreClient.CreateProjectAPIKey(ctx, p.ID, creq)
+	if err != nil {
+		return "", errors.Errorf("failed to create project api key: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("api key %q for project %q created", req.APIKeyName, req.ProjectRef)
+
+	return res.APIKey, nil
+}
+
+func (h *ActionHandler) DeleteProjectAPIKey(ctx context.Context, projectRef, apiKeyName string) error {
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
+	if err != nil {
+		return errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isProjectOwner {
+		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	h.log.Infof("deleting project api key")
+	resp, err = h.configstoreClient.DeleteProjectAPIKey(ctx, p.ID, apiKeyName)
+	if err != nil {
+		return errors.Errorf("failed to delete project api key: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("api key %q for project %q deleted", apiKeyName, projectRef)
+
+	return nil
+}
+
 func (h *ActionHandler) DeleteProject(ctx context.Context, projectRef string) error {
 	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
 	if err != nil {
@@ -427,30 +851,66 @@ func (h *ActionHandler) DeleteProject(ctx context.Context, projectRef string) er
 	return nil
 }
 
-func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch, tag, refName, commitSHA string) error {
-	curUserID := h.CurrentUserID(ctx)
-
-	user, resp, err := h.configstoreClient.GetUser(ctx, curUserID)
+// ProjectCreateRun creates the project runs. executorID, when defined, pins the
+// runs to the provided executor. runTags are added to the tags defined in the
+// run config.
+func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch, tag, refName, commitSHA, executorID string, runSelectors, runTags []string) ([]string, error) {
+	req, err := h.genProjectRunRequest(ctx, projectRef, branch, tag, refName, commitSHA)
 	if err != nil {
-		return errors.Errorf("failed to get user %q: %w", curUserID, ErrFromRemote(resp, err))
+		return nil, err
 	}
+	req.ExecutorID = executorID
+	req.RunSelectors = runSelectors
+	req.RunTags = runTags
 
+	return h.CreateRuns(ctx, req)
+}
+
+// genProjectRunRequest generates the request to create the runs of a project
+// at the provided ref (branch, tag or ref) and commit
+func (h *ActionHandler) genProjectRunRequest(ctx context.Context, projectRef, branch, tag, refName, commitSHA string) (*CreateRunRequest, error) {
 	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
 	if err != nil {
-		return errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	if curProjectID := h.CurrentProjectID(ctx); curProjectID != "" {
+		// project api keys aren't bound to a user so use the project linked
+		// account to access the repository
+		if curProjectID != p.ID {
+			return nil, util.NewErrForbidden(errors.Errorf("api key not authorized"))
+		}
+		user, rs, la, err := h.getRemoteRepoAccessData(ctx, p.LinkedAccountID)
+		if err != nil {
+			return nil, errors.Errorf("failed to get remote repo access data: %w", err)
+		}
+
+		gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+		if err != nil {
+			return nil, errors.Errorf("failed to create gitsource client: %w", err)
+		}
+
+		return h.genProjectRefRunRequest(p, rs, gitSource, branch, tag, refName, commitSHA)
+	}
+
+	curUserID := h.CurrentUserID(ctx)
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, curUserID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user %q: %w", curUserID, ErrFromRemote(resp, err))
 	}
 
 	isProjectOwner, err := h.IsProjectOwner(ctx, p.OwnerType, p.OwnerID)
 	if err != nil {
-		return errors.Errorf("failed to determine ownership: %w", err)
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
 	}
 	if !isProjectOwner {
-		return util.NewErrForbidden(errors.Errorf("user not authorized"))
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
 	rs, resp, err := h.configstoreClient.GetRemoteSource(ctx, p.RemoteSourceID)
 	if err != nil {
-		return errors.Errorf("failed to get remote source %q: %w", p.RemoteSourceID, ErrFromRemote(resp, err))
+		return nil, errors.Errorf("failed to get remote source %q: %w", p.RemoteSourceID, ErrFromRemote(resp, err))
 	}
 	var la *cstypes.LinkedAccount
 	for _, v := range user.LinkedAccounts {
@@ -460,18 +920,24 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		}
 	}
 	if la == nil {
-		return util.NewErrBadRequest(errors.Errorf("user doesn't have a linked account for remote source %q", rs.Name))
+		return nil, util.NewErrBadRequest(errors.Errorf("user doesn't have a linked account for remote source %q", rs.Name))
 	}
 
 	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
 	if err != nil {
-		return errors.Errorf("failed to create gitsource client: %w", err)
+		return nil, errors.Errorf("failed to create gitsource client: %w", err)
 	}
 
+	return h.genProjectRefRunRequest(p, rs, gitSource, branch, tag, refName, commitSHA)
+}
+
+// genProjectRefRunRequest generates the request to create the runs of a
+// project at the provided ref using the provided git source client
+func (h *ActionHandler) genProjectRefRunRequest(p *csapitypes.Project, rs *cstypes.RemoteSource, gitSource gitsource.GitSource, branch, tag, refName, commitSHA string) (*CreateRunRequest, error) {
 	// check user has access to the repository
 	repoInfo, err := gitSource.GetRepoInfo(p.RepositoryPath)
 	if err != nil {
-		return errors.Errorf("failed to get repository info from gitsource: %w", err)
+		return nil, errors.Errorf("failed to get repository info from gitsource: %w", err)
 	}
 
 	set := 0
@@ -485,10 +951,10 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		set++
 	}
 	if set == 0 {
-		return util.NewErrBadRequest(errors.Errorf("one of branch, tag or ref is required"))
+		return nil, util.NewErrBadRequest(errors.Errorf("one of branch, tag or ref is required"))
 	}
 	if set > 1 {
-		return util.NewErrBadRequest(errors.Errorf("only one of branch, tag or ref can be provided"))
+		return nil, util.NewErrBadRequest(errors.Errorf("only one of branch, tag or ref can be provided"))
 	}
 
 	var refType types.RunRefType
@@ -507,11 +973,11 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 
 	gitRefType, name, err := gitSource.RefType(refName)
 	if err != nil {
-		return util.NewErrBadRequest(errors.Errorf("failed to get refType for ref %q: %w", refName, err))
+		return nil, util.NewErrBadRequest(errors.Errorf("failed to get refType for ref %q: %w", refName, err))
 	}
 	ref, err := gitSource.GetRef(p.RepositoryPath, refName)
 	if err != nil {
-		return errors.Errorf("failed to get ref information from git source for ref %q: %w", refName, err)
+		return nil, errors.Errorf("failed to get ref information from git source for ref %q: %w", refName, err)
 	}
 	refCommitSHA = ref.CommitSHA
 	switch gitRefType {
@@ -521,7 +987,7 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		tag = name
 		// TODO(sgotti) implement manual run creation on a pull request if really needed
 	default:
-		return errors.Errorf("unsupported ref %q for manual run creation", refName)
+		return nil, errors.Errorf("unsupported ref %q for manual run creation", refName)
 	}
 
 	// TODO(sgotti) check that the provided ref contains the provided commitSHA
@@ -533,7 +999,7 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 
 	commit, err := gitSource.GetCommit(p.RepositoryPath, commitSHA)
 	if err != nil {
-		return errors.Errorf("failed to get commit information from git source for commit sha %q: %w", commitSHA, err)
+		return nil, errors.Errorf("failed to get commit information from git source for commit sha %q: %w", commitSHA, err)
 	}
 
 	// use the commit full sha since the user could have provided a short commit sha
@@ -567,6 +1033,9 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		GitSource:           gitSource,
 		CommitSHA:           commitSHA,
 		Message:             message,
+		CommitMessage:       commit.Message,
+		CommitAuthorName:    commit.AuthorName,
+		CommitAuthorEmail:   commit.AuthorEmail,
 		Branch:              branch,
 		Tag:                 tag,
 		PullRequestID:       "",
@@ -582,7 +1051,7 @@ func (h *ActionHandler) ProjectCreateRun(ctx context.Context, projectRef, branch
 		PullRequestLink: "",
 	}
 
-	return h.CreateRuns(ctx, req)
+	return req, nil
 }
 
 func (h *ActionHandler) getRemoteRepoAccessData(ctx context.Context, linkedAccountID string) (*cstypes.User, *cstypes.RemoteSource, *cstypes.LinkedAccount, error) {
@@ -0,0 +1,348 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	cstypes "agola.io/agola/services/configstore/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// projectTemplateParameterRegexp matches the parameters references (in the
+// format ${parametername}) inside the project template variables values
+var projectTemplateParameterRegexp = regexp.MustCompile(`\$\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// projectTemplateVisibleTimeout is the max time to wait for a project created
+// from a template to be available in the configstore before creating its
+// variables
+const projectTemplateVisibleTimeout = 10 * time.Second
+
+func (h *ActionHandler) GetProjectTemplate(ctx context.Context, projectTemplateRef string) (*cstypes.ProjectTemplate, error) {
+	projectTemplate, resp, err := h.configstoreClient.GetProjectTemplate(ctx, projectTemplateRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return projectTemplate, nil
+}
+
+type GetProjectTemplatesRequest struct {
+	Start string
+	Limit int
+	Asc   bool
+}
+
+func (h *ActionHandler) GetProjectTemplates(ctx context.Context, req *GetProjectTemplatesRequest) ([]*cstypes.ProjectTemplate, error) {
+	projectTemplates, resp, err := h.configstoreClient.GetProjectTemplates(ctx, req.Start, req.Limit, req.Asc)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	return projectTemplates, nil
+}
+
+// validateProjectTemplateSpec checks that all the parameters referenced by the
+// variables values are defined
+func validateProjectTemplateSpec(spec *cstypes.ProjectTemplateSpec) error {
+	parameters := map[string]struct{}{}
+	for _, p := range spec.Parameters {
+		parameters[p.Name] = struct{}{}
+	}
+
+	for _, v := range spec.Variables {
+		for _, value := range v.Values {
+			for _, s := range []string{value.SecretName, value.SecretVar} {
+				for _, m := range projectTemplateParameterRegexp.FindAllStringSubmatch(s, -1) {
+					if _, ok := parameters[m[1]]; !ok {
+						return util.NewErrBadRequest(errors.Errorf("variable %q references undefined parameter %q", v.Name, m[1]))
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) CreateProjectTemplate(ctx context.Context, name string, spec *cstypes.ProjectTemplateSpec) (*cstypes.ProjectTemplate, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	if !util.ValidateName(name) {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid project template name %q", name))
+	}
+	if err := validateProjectTemplateSpec(spec); err != nil {
+		return nil, err
+	}
+
+	creq := &csapitypes.CreateProjectTemplateRequest{
+		Name: name,
+		Spec: spec,
+	}
+
+	h.log.Infof("creating project template")
+	projectTemplate, resp, err := h.configstoreClient.CreateProjectTemplate(ctx, creq)
+	if err != nil {
+		return nil, errors.Errorf("failed to create project template: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project template %s created, ID: %s", projectTemplate.Name, projectTemplate.ID)
+
+	return projectTemplate, nil
+}
+
+func (h *ActionHandler) UpdateProjectTemplate(ctx context.Context, projectTemplateRef string, spec *cstypes.ProjectTemplateSpec) (*cstypes.ProjectTemplate, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	if err := validateProjectTemplateSpec(spec); err != nil {
+		return nil, err
+	}
+
+	ureq := &csapitypes.UpdateProjectTemplateRequest{
+		Spec: spec,
+	}
+
+	h.log.Infof("updating project template")
+	projectTemplate, resp, err := h.configstoreClient.UpdateProjectTemplate(ctx, projectTemplateRef, ureq)
+	if err != nil {
+		return nil, errors.Errorf("failed to update project template: %w", ErrFromRemote(resp, err))
+	}
+	h.log.Infof("project template %s updated, revision: %d", projectTemplate.Name, projectTemplate.LatestRevision().Revision)
+
+	return projectTemplate, nil
+}
+
+func (h *ActionHandler) DeleteProjectTemplate(ctx context.Context, projectTemplateRef string) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	resp, err := h.configstoreClient.DeleteProjectTemplate(ctx, projectTemplateRef)
+	if err != nil {
+		return errors.Errorf("failed to delete project template: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
+
+// resolveProjectTemplateParameters returns the parameters values using the
+// provided ones and the parameters defaults. It errors out when a required
+// parameter isn't provided or when an unknown parameter is provided.
+func resolveProjectTemplateParameters(spec *cstypes.ProjectTemplateSpec, values map[string]string) (map[string]string, error) {
+	parameters := map[string]string{}
+	missing := []string{}
+	for _, p := range spec.Parameters {
+		v, ok := values[p.Name]
+		if !ok {
+			if p.Default == "" {
+				missing = append(missing, p.Name)
+				continue
+			}
+			v = p.Default
+		}
+		parameters[p.Name] = v
+	}
+	if len(missing) > 0 {
+		return nil, util.NewErrBadRequest(errors.Errorf("missing required parameters: %s", strings.Join(missing, ", ")))
+	}
+
+	unknown := []string{}
+	for name := range values {
+		if _, ok := parameters[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, util.NewErrBadRequest(errors.Errorf("unknown parameters: %s", strings.Join(unknown, ", ")))
+	}
+
+	return parameters, nil
+}
+
+func expandProjectTemplateParameters(s string, parameters map[string]string) string {
+	return projectTemplateParameterRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		return parameters[projectTemplateParameterRegexp.FindStringSubmatch(m)[1]]
+	})
+}
+
+type CreateProjectFromTemplateRequest struct {
+	ProjectTemplateRef string
+	// Revision is the project template revision to use. 0 means the latest
+	// revision.
+	Revision int64
+
+	Name      string
+	ParentRef string
+	RepoPath  string
+	// RemoteSourceName overrides the project template remote source name
+	RemoteSourceName string
+
+	Parameters map[string]string
+}
+
+// CreateProjectFromTemplate creates a new project with the settings and the
+// variables defined by a project template revision. The template values are
+// copied so next template updates won't change the project.
+// If the project variables cannot be created the project is deleted so a
+// failed creation can be retried.
+func (h *ActionHandler) CreateProjectFromTemplate(ctx context.Context, req *CreateProjectFromTemplateRequest) (*csapitypes.Project, error) {
+	projectTemplate, resp, err := h.configstoreClient.GetProjectTemplate(ctx, req.ProjectTemplateRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project template %q: %w", req.ProjectTemplateRef, ErrFromRemote(resp, err))
+	}
+
+	revision := projectTemplate.LatestRevision()
+	if req.Revision != 0 {
+		revision = projectTemplate.GetRevision(req.Revision)
+	}
+	if revision == nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("project template %q revision %d doesn't exist", projectTemplate.Name, req.Revision))
+	}
+	spec := revision.ProjectTemplateSpec
+
+	parameters, err := resolveProjectTemplateParameters(&spec, req.Parameters)
+	if err != nil {
+		return nil, err
+	}
+	// validate the variables before creating the project
+	variables, err := genProjectTemplateVariables(&spec, parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	visibility := spec.Visibility
+	if visibility == "" {
+		visibility = cstypes.VisibilityPublic
+	}
+	remoteSourceName := spec.RemoteSourceName
+	if req.RemoteSourceName != "" {
+		remoteSourceName = req.RemoteSourceName
+	}
+
+	creq := &CreateProjectRequest{
+		Name:                      req.Name,
+		ParentRef:                 req.ParentRef,
+		Visibility:                visibility,
+		RemoteSourceName:          remoteSourceName,
+		RepoPath:                  req.RepoPath,
+		SkipSSHHostKeyCheck:       spec.SkipSSHHostKeyCheck,
+		PassVarsToForkedPR:        spec.PassVarsToForkedPR,
+		NetworkPolicy:             spec.NetworkPolicy,
+		UntrustedRunsNeedApproval: spec.UntrustedRunsNeedApproval,
+		MaxStepLogSize:            spec.MaxStepLogSize,
+	}
+
+	h.log.Infof("creating project %q from template %q revision %d", req.Name, projectTemplate.Name, revision.Revision)
+	project, err := h.CreateProject(ctx, creq)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(variables) == 0 {
+		return project, nil
+	}
+
+	if err := h.createProjectTemplateVariables(ctx, project.ID, variables); err != nil {
+		h.log.Infof("deleting project %q since its variables creation failed", project.Path)
+		if derr := h.DeleteProject(ctx, project.ID); derr != nil {
+			h.log.Errorf("failed to delete project %q: %+v", project.Path, derr)
+			return nil, errors.Errorf("project %q created but failed to create its variables (%v) and to delete it: %w", project.Path, err, derr)
+		}
+		return nil, err
+	}
+
+	return project, nil
+}
+
+// genProjectTemplateVariables generates the project variables expanding the
+// template parameters. It errors out when a variable isn't valid so it can be
+// called before creating the project.
+func genProjectTemplateVariables(spec *cstypes.ProjectTemplateSpec, parameters map[string]string) ([]*CreateVariableRequest, error) {
+	variables := make([]*CreateVariableRequest, 0, len(spec.Variables))
+	for _, v := range spec.Variables {
+		if !util.ValidateName(v.Name) {
+			return nil, util.NewErrBadRequest(errors.Errorf("invalid variable name %q", v.Name))
+		}
+		if len(v.Values) == 0 {
+			return nil, util.NewErrBadRequest(errors.Errorf("variable %q: empty variable values", v.Name))
+		}
+
+		values := make([]cstypes.VariableValue, len(v.Values))
+		for i, value := range v.Values {
+			values[i] = cstypes.VariableValue{
+				SecretName: expandProjectTemplateParameters(value.SecretName, parameters),
+				SecretVar:  expandProjectTemplateParameters(value.SecretVar, parameters),
+				When:       value.When,
+			}
+			if values[i].SecretName == "" || values[i].SecretVar == "" {
+				return nil, util.NewErrBadRequest(errors.Errorf("variable %q: empty secret name or secret var", v.Name))
+			}
+		}
+		variables = append(variables, &CreateVariableRequest{
+			Name:       v.Name,
+			ParentType: cstypes.ConfigTypeProject,
+			Values:     values,
+		})
+	}
+
+	return variables, nil
+}
+
+func (h *ActionHandler) createProjectTemplateVariables(ctx context.Context, projectID string, variables []*CreateVariableRequest) error {
+	if err := h.waitProjectVisible(ctx, projectID); err != nil {
+		return err
+	}
+
+	for _, vreq := range variables {
+		vreq.ParentRef = projectID
+		if _, _, err := h.CreateVariable(ctx, vreq); err != nil {
+			return errors.Errorf("failed to create variable %q: %w", vreq.Name, err)
+		}
+	}
+	return nil
+}
+
+// waitProjectVisible waits for a just created project to be available in the
+// configstore
+func (h *ActionHandler) waitProjectVisible(ctx context.Context, projectID string) error {
+	timeout := time.NewTimer(projectTemplateVisibleTimeout)
+	defer timeout.Stop()
+	for {
+		_, resp, err := h.configstoreClient.GetProject(ctx, projectID)
+		if err == nil {
+			return nil
+		}
+		if resp == nil || resp.StatusCode != http.StatusNotFound {
+			return errors.Errorf("failed to get project %q: %w", projectID, ErrFromRemote(resp, err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return errors.Errorf("project %q not available after %s", projectID, projectTemplateVisibleTimeout)
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
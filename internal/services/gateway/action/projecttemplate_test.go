@@ -0,0 +1,87 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"testing"
+
+	cstypes "agola.io/agola/services/configstore/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenProjectTemplateVariables(t *testing.T) {
+	parameters := map[string]string{"env": "prod"}
+
+	tests := []struct {
+		name      string
+		variables []cstypes.ProjectTemplateVariable
+		out       []*CreateVariableRequest
+		err       bool
+	}{
+		{
+			name: "test expanded parameters",
+			variables: []cstypes.ProjectTemplateVariable{
+				{Name: "var01", Values: []cstypes.VariableValue{{SecretName: "secret-${env}", SecretVar: "password"}}},
+			},
+			out: []*CreateVariableRequest{
+				{
+					Name:       "var01",
+					ParentType: cstypes.ConfigTypeProject,
+					Values:     []cstypes.VariableValue{{SecretName: "secret-prod", SecretVar: "password"}},
+				},
+			},
+		},
+		{
+			name: "test invalid variable name",
+			variables: []cstypes.ProjectTemplateVariable{
+				{Name: "var 01", Values: []cstypes.VariableValue{{SecretName: "secret", SecretVar: "password"}}},
+			},
+			err: true,
+		},
+		{
+			name: "test empty variable values",
+			variables: []cstypes.ProjectTemplateVariable{
+				{Name: "var01"},
+			},
+			err: true,
+		},
+		{
+			name: "test empty expanded secret name",
+			variables: []cstypes.ProjectTemplateVariable{
+				{Name: "var01", Values: []cstypes.VariableValue{{SecretName: "${missing}", SecretVar: "password"}}},
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := genProjectTemplateVariables(&cstypes.ProjectTemplateSpec{Variables: tt.variables}, parameters)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil err")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"sort"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/util"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// requiredChecksRunsFetchLimit is the number of project runs fetched at
+	// every request when looking for the runs of a commit
+	requiredChecksRunsFetchLimit = 100
+	// requiredChecksMaxRuns is the max number of the latest project runs
+	// inspected when looking for the runs of a commit
+	requiredChecksMaxRuns = 1000
+)
+
+type RequiredCheckStatus string
+
+const (
+	// RequiredCheckStatusSuccess reports that the required run successfully
+	// finished
+	RequiredCheckStatusSuccess RequiredCheckStatus = "success"
+	// RequiredCheckStatusPending reports that the required run is queued or
+	// running or, when reported by a single check, that there's no run yet
+	RequiredCheckStatusPending RequiredCheckStatus = "pending"
+	// RequiredCheckStatusFailure reports that the required run failed, was
+	// stopped, was cancelled or had setup errors
+	RequiredCheckStatusFailure RequiredCheckStatus = "failure"
+	// RequiredCheckStatusMissing reports that there's no run for the commit
+	// with the required name
+	RequiredCheckStatusMissing RequiredCheckStatus = "missing"
+)
+
+type RequiredCheck struct {
+	RunName string
+	Status  RequiredCheckStatus
+	// Run is the latest run of the commit with the required name. It's nil
+	// when the check is missing.
+	Run *rstypes.Run
+}
+
+type RequiredChecks struct {
+	CommitSHA string
+	// Status is the aggregate status of the required checks: success when
+	// all the required runs succeeded, failure when one of them didn't
+	// succeed, pending otherwise
+	Status RequiredCheckStatus
+	Checks []*RequiredCheck
+}
+
+// GetProjectRequiredChecks returns the status of the required runs of the
+// project for the provided commit sha. Only the latest run, for every required
+// run name, is considered, so a restarted run replaces the previous one.
+//
+// When the project doesn't define its required runs, all the runs created for
+// the commit are required and the status is pending when there're no runs.
+func (h *ActionHandler) GetProjectRequiredChecks(ctx context.Context, projectRef, commitSHA string) (*RequiredChecks, error) {
+	if commitSHA == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty commit sha"))
+	}
+
+	project, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	group := common.GenRunGroup(common.GroupTypeProject, project.ID, "", "")
+	canGetRun, err := h.CanGetRun(ctx, group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	runs, err := h.commitLatestRuns(ctx, group, commitSHA, project.RequiredRuns)
+	if err != nil {
+		return nil, err
+	}
+
+	runNames := project.RequiredRuns
+	if len(runNames) == 0 {
+		for _, run := range runs {
+			runNames = append(runNames, run.Name)
+		}
+		sort.Strings(runNames)
+	}
+
+	res := &RequiredChecks{
+		CommitSHA: commitSHA,
+		Checks:    []*RequiredCheck{},
+	}
+	for _, runName := range runNames {
+		check := &RequiredCheck{
+			RunName: runName,
+			Status:  RequiredCheckStatusMissing,
+		}
+		if run, ok := runs[runName]; ok {
+			check.Run = run
+			check.Status = requiredCheckStatus(run)
+		}
+		res.Checks = append(res.Checks, check)
+	}
+	res.Status = aggregateRequiredChecksStatus(res.Checks)
+
+	return res, nil
+}
+
+// commitLatestRuns returns the latest runs, keyed by run name, created for the
+// provided commit sha inside the run group. When runNames is not empty it
+// stops when all the runs with these names are found.
+func (h *ActionHandler) commitLatestRuns(ctx context.Context, group, commitSHA string, runNames []string) (map[string]*rstypes.Run, error) {
+	runs := map[string]*rstypes.Run{}
+	fetched := 0
+	start := ""
+	for fetched < requiredChecksMaxRuns {
+		runsResp, resp, err := h.runserviceClient.GetRuns(ctx, nil, nil, nil, []string{group}, false, nil, start, requiredChecksRunsFetchLimit, false)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+		for _, run := range runsResp.Runs {
+			if run.Annotations[AnnotationCommitSHA] != commitSHA {
+				continue
+			}
+			// runs are returned from the newest so keep the first one
+			if _, ok := runs[run.Name]; !ok {
+				runs[run.Name] = run
+			}
+		}
+		if len(runNames) > 0 && allRunsFound(runs, runNames) {
+			break
+		}
+		if len(runsResp.Runs) < requiredChecksRunsFetchLimit {
+			break
+		}
+		fetched += len(runsResp.Runs)
+		start = runsResp.Runs[len(runsResp.Runs)-1].ID
+	}
+
+	return runs, nil
+}
+
+func allRunsFound(runs map[string]*rstypes.Run, runNames []string) bool {
+	for _, runName := range runNames {
+		if _, ok := runs[runName]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func requiredCheckStatus(run *rstypes.Run) RequiredCheckStatus {
+	switch run.Result {
+	case rstypes.RunResultSuccess:
+		return RequiredCheckStatusSuccess
+	case rstypes.RunResultFailed, rstypes.RunResultStopped:
+		return RequiredCheckStatusFailure
+	}
+	switch run.Phase {
+	case rstypes.RunPhaseSetupError, rstypes.RunPhaseCancelled:
+		return RequiredCheckStatusFailure
+	}
+	return RequiredCheckStatusPending
+}
+
+func aggregateRequiredChecksStatus(checks []*RequiredCheck) RequiredCheckStatus {
+	if len(checks) == 0 {
+		return RequiredCheckStatusPending
+	}
+	status := RequiredCheckStatusSuccess
+	for _, check := range checks {
+		switch check.Status {
+		case RequiredCheckStatusFailure:
+			return RequiredCheckStatusFailure
+		case RequiredCheckStatusPending, RequiredCheckStatusMissing:
+			status = RequiredCheckStatusPending
+		}
+	}
+	return status
+}
@@ -15,18 +15,25 @@
 package action
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"path"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/config"
 	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/runconfig"
 	"agola.io/agola/internal/services/common"
 	itypes "agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/tracing"
 	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
 	cstypes "agola.io/agola/services/configstore/types"
 	rsapitypes "agola.io/agola/services/runservice/api/types"
 	rstypes "agola.io/agola/services/runservice/types"
@@ -65,17 +72,74 @@ const (
 	AnnotationTagLink         = "tag_link"
 	AnnotationPullRequestID   = "pull_request_id"
 	AnnotationPullRequestLink = "pull_request_link"
+
+	// AnnotationConfigBaseBranch is set on pull request runs whose run config
+	// is read from the pull request base branch
+	AnnotationConfigBaseBranch = "config_base_branch"
+	// AnnotationConfigDiverged reports that the pull request changes the run
+	// config, so its changes aren't used by the run
+	AnnotationConfigDiverged = "config_diverged"
 )
 
 var (
 	SkipRunMessage = regexp.MustCompile(`.*\[ci skip\].*`)
+
+	// errNoConfigFile is returned when none of the run config files could be
+	// fetched from the repository
+	errNoConfigFile = errors.New("no config file found")
 )
 
-func (h *ActionHandler) GetRun(ctx context.Context, runID string) (*rsapitypes.RunResponse, error) {
-	runResp, resp, err := h.runserviceClient.GetRun(ctx, runID, nil)
+// ParseRunRef parses a run ref. A run ref is a run id or a project ref
+// followed by the project run number (i.e. org/myorg/myproject#142). If the
+// run ref is a run id an empty project ref is returned.
+func ParseRunRef(runRef string) (string, uint64, error) {
+	i := strings.LastIndex(runRef, "#")
+	if i < 0 {
+		return "", 0, nil
+	}
+	projectRef := runRef[:i]
+	if projectRef == "" {
+		return "", 0, util.NewErrBadRequest(errors.Errorf("wrong run ref %q: empty project ref", runRef))
+	}
+	counter, err := strconv.ParseUint(runRef[i+1:], 10, 64)
+	if err != nil || counter == 0 {
+		return "", 0, util.NewErrBadRequest(errors.Errorf("wrong run ref %q: wrong run number %q", runRef, runRef[i+1:]))
+	}
+	return projectRef, counter, nil
+}
+
+// getRunByRef fetches a run from the runservice using a run id or a project
+// run number ref
+func (h *ActionHandler) getRunByRef(ctx context.Context, runRef string) (*rsapitypes.RunResponse, error) {
+	projectRef, counter, err := ParseRunRef(runRef)
+	if err != nil {
+		return nil, err
+	}
+	if projectRef == "" {
+		runResp, resp, err := h.runserviceClient.GetRun(ctx, runRef, nil)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+		return runResp, nil
+	}
+
+	project, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+	group := common.GenRunGroup(common.GroupTypeProject, project.ID, "", "")
+	runResp, resp, err := h.runserviceClient.GetRunByCounter(ctx, group, counter, nil)
 	if err != nil {
 		return nil, ErrFromRemote(resp, err)
 	}
+	return runResp, nil
+}
+
+func (h *ActionHandler) GetRun(ctx context.Context, runRef string) (*rsapitypes.RunResponse, error) {
+	runResp, err := h.getRunByRef(ctx, runRef)
+	if err != nil {
+		return nil, err
+	}
 	canGetRun, err := h.CanGetRun(ctx, runResp.RunConfig.Group)
 	if err != nil {
 		return nil, errors.Errorf("failed to determine permissions: %w", err)
@@ -90,6 +154,8 @@ func (h *ActionHandler) GetRun(ctx context.Context, runID string) (*rsapitypes.R
 type GetRunsRequest struct {
 	PhaseFilter  []string
 	ResultFilter []string
+	// TagFilter returns only the runs with all the provided tags
+	TagFilter    []string
 	Group        string
 	LastRun      bool
 	ChangeGroups []string
@@ -108,7 +174,7 @@ func (h *ActionHandler) GetRuns(ctx context.Context, req *GetRunsRequest) (*rsap
 	}
 
 	groups := []string{req.Group}
-	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, req.PhaseFilter, req.ResultFilter, groups, req.LastRun, req.ChangeGroups, req.StartRunID, req.Limit, req.Asc)
+	runsResp, resp, err := h.runserviceClient.GetRuns(ctx, req.PhaseFilter, req.ResultFilter, req.TagFilter, groups, req.LastRun, req.ChangeGroups, req.StartRunID, req.Limit, req.Asc)
 	if err != nil {
 		return nil, ErrFromRemote(resp, err)
 	}
@@ -116,12 +182,129 @@ func (h *ActionHandler) GetRuns(ctx context.Context, req *GetRunsRequest) (*rsap
 	return runsResp, nil
 }
 
+type GetRunStatsRequest struct {
+	Group      string
+	Start      *time.Time
+	End        *time.Time
+	Bucket     string
+	BySubgroup bool
+}
+
+func (h *ActionHandler) GetRunStats(ctx context.Context, req *GetRunStatsRequest) ([]*rstypes.RunStats, error) {
+	canGetRun, err := h.CanGetRun(ctx, req.Group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	statsResp, resp, err := h.runserviceClient.GetRunStats(ctx, req.Group, req.Start, req.End, req.Bucket, req.BySubgroup)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return statsResp.Stats, nil
+}
+
+type ExportRunsRequest struct {
+	Group     string
+	Start     *time.Time
+	End       *time.Time
+	Watermark string
+}
+
+// ExportRuns returns the runservice response streaming the finished runs of
+// the provided group. The caller must close the response body.
+func (h *ActionHandler) ExportRuns(ctx context.Context, req *ExportRunsRequest) (*http.Response, error) {
+	canGetRun, err := h.CanGetRun(ctx, req.Group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canGetRun {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	resp, err := h.runserviceClient.ExportRuns(ctx, req.Group, req.Start, req.End, req.Watermark)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return resp, nil
+}
+
+// GetRunConfigDiff returns the differences between the run configs of two
+// runs. The user must be able to get both runs.
+func (h *ActionHandler) GetRunConfigDiff(ctx context.Context, runID, otherRunID string) (*rsapitypes.RunConfigDiffResponse, error) {
+	diffResp, resp, err := h.runserviceClient.GetRunConfigDiff(ctx, runID, otherRunID)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	for _, group := range []string{diffResp.RunGroup, diffResp.OtherRunGroup} {
+		canGetRun, err := h.CanGetRun(ctx, group)
+		if err != nil {
+			return nil, errors.Errorf("failed to determine permissions: %w", err)
+		}
+		if !canGetRun {
+			return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+		}
+	}
+
+	return diffResp, nil
+}
+
+// GetRunProvenance returns the signed provenance of a successful run. Since
+// it's signed with the id tokens key it's available only to the users that
+// can do run actions, not to everyone able to read the run.
+func (h *ActionHandler) GetRunProvenance(ctx context.Context, runRef string) (*rsapitypes.RunProvenanceResponse, error) {
+	runResp, err := h.GetRun(ctx, runRef)
+	if err != nil {
+		return nil, err
+	}
+	canDoRunActions, err := h.CanDoRunActions(ctx, runResp.RunConfig.Group)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine permissions: %w", err)
+	}
+	if !canDoRunActions {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	provenanceResp, resp, err := h.runserviceClient.GetRunProvenance(ctx, runResp.Run.ID)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return provenanceResp, nil
+}
+
+// GetRunTaskEnvironment returns the environment of a run task. The values that
+// could contain secrets are always redacted by the runservice.
+func (h *ActionHandler) GetRunTaskEnvironment(ctx context.Context, runRef, taskID string) (*rsapitypes.RunTaskEnvironmentResponse, error) {
+	runResp, err := h.GetRun(ctx, runRef)
+	if err != nil {
+		return nil, err
+	}
+
+	envResp, resp, err := h.runserviceClient.GetRunTaskEnvironment(ctx, runResp.Run.ID, taskID)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return envResp, nil
+}
+
 type GetLogsRequest struct {
 	RunID  string
 	TaskID string
 	Setup  bool
 	Step   int
 	Follow bool
+	// Offset is the log offset to start from
+	Offset int64
+	// Range is the http Range header value used to request part of a stored
+	// log
+	Range string
 }
 
 func (h *ActionHandler) GetLogs(ctx context.Context, req *GetLogsRequest) (*http.Response, error) {
@@ -137,8 +320,16 @@ func (h *ActionHandler) GetLogs(ctx context.Context, req *GetLogsRequest) (*http
 		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
-	resp, err = h.runserviceClient.GetLogs(ctx, req.RunID, req.TaskID, req.Setup, req.Step, req.Follow)
+	header := http.Header{}
+	if req.Range != "" {
+		header.Set("Range", req.Range)
+	}
+	resp, err = h.runserviceClient.GetLogs(ctx, req.RunID, req.TaskID, req.Setup, req.Step, req.Follow, req.Offset, header)
 	if err != nil {
+		// let the caller report the unsatisfiable range
+		if resp != nil && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			return resp, nil
+		}
 		return nil, ErrFromRemote(resp, err)
 	}
 
@@ -179,6 +370,7 @@ const (
 	RunActionTypeRestart RunActionType = "restart"
 	RunActionTypeCancel  RunActionType = "cancel"
 	RunActionTypeStop    RunActionType = "stop"
+	RunActionTypeSetTags RunActionType = "settags"
 )
 
 type RunActionsRequest struct {
@@ -187,13 +379,26 @@ type RunActionsRequest struct {
 
 	// Restart
 	FromStart bool
+	// FromTask is the name of the task from which the run is restarted
+	// reusing the results of the other successful tasks
+	FromTask string
+	// Environment are the environment variables overridden in the restarted
+	// run
+	Environment map[string]string
+	// DebugHold keeps the pods of the failed tasks of the restarted run
+	// running to debug them
+	DebugHold bool
+
+	// SetTags
+	Tags []string
 }
 
 func (h *ActionHandler) RunAction(ctx context.Context, req *RunActionsRequest) (*rsapitypes.RunResponse, error) {
-	runResp, resp, err := h.runserviceClient.GetRun(ctx, req.RunID, nil)
+	runResp, err := h.getRunByRef(ctx, req.RunID)
 	if err != nil {
-		return nil, ErrFromRemote(resp, err)
+		return nil, err
 	}
+	runID := runResp.Run.ID
 	canGetRun, err := h.CanDoRunActions(ctx, runResp.RunConfig.Group)
 	if err != nil {
 		return nil, errors.Errorf("failed to determine permissions: %w", err)
@@ -204,11 +409,28 @@ func (h *ActionHandler) RunAction(ctx context.Context, req *RunActionsRequest) (
 
 	switch req.ActionType {
 	case RunActionTypeRestart:
+		if req.FromStart && req.FromTask != "" {
+			return nil, util.NewErrBadRequest(errors.Errorf("from start and from task are mutually exclusive"))
+		}
+		if req.DebugHold {
+			// only admins and the user who triggered the run can keep its
+			// pods running
+			if !h.IsUserAdmin(ctx) && !isRunTriggeredBy(runResp.Run, h.CurrentUserID(ctx)) {
+				return nil, util.NewErrForbidden(errors.Errorf("only admins and the run author can request a debug hold"))
+			}
+		}
+
 		rsreq := &rsapitypes.RunCreateRequest{
-			RunID:     req.RunID,
-			FromStart: req.FromStart,
+			RunID:       runID,
+			FromStart:   req.FromStart,
+			FromTask:    req.FromTask,
+			Environment: req.Environment,
+			DebugHold:   req.DebugHold,
+			TriggerType: string(itypes.RunCreationTriggerTypeRestart),
+			TriggeredBy: h.CurrentUserID(ctx),
 		}
 
+		var resp *http.Response
 		runResp, resp, err = h.runserviceClient.CreateRun(ctx, rsreq)
 		if err != nil {
 			return nil, ErrFromRemote(resp, err)
@@ -220,7 +442,7 @@ func (h *ActionHandler) RunAction(ctx context.Context, req *RunActionsRequest) (
 			Phase:      rstypes.RunPhaseCancelled,
 		}
 
-		resp, err = h.runserviceClient.RunActions(ctx, req.RunID, rsreq)
+		resp, err := h.runserviceClient.RunActions(ctx, runID, rsreq)
 		if err != nil {
 			return nil, ErrFromRemote(resp, err)
 		}
@@ -230,7 +452,18 @@ func (h *ActionHandler) RunAction(ctx context.Context, req *RunActionsRequest) (
 			ActionType: rsapitypes.RunActionTypeStop,
 		}
 
-		resp, err = h.runserviceClient.RunActions(ctx, req.RunID, rsreq)
+		resp, err := h.runserviceClient.RunActions(ctx, runID, rsreq)
+		if err != nil {
+			return nil, ErrFromRemote(resp, err)
+		}
+
+	case RunActionTypeSetTags:
+		rsreq := &rsapitypes.RunActionsRequest{
+			ActionType: rsapitypes.RunActionTypeSetTags,
+			Tags:       req.Tags,
+		}
+
+		resp, err := h.runserviceClient.RunActions(ctx, runID, rsreq)
 		if err != nil {
 			return nil, ErrFromRemote(resp, err)
 		}
@@ -242,6 +475,13 @@ func (h *ActionHandler) RunAction(ctx context.Context, req *RunActionsRequest) (
 	return runResp, nil
 }
 
+func isRunTriggeredBy(r *rstypes.Run, userID string) bool {
+	if userID == "" || r.Trigger == nil {
+		return false
+	}
+	return r.Trigger.TriggeredBy == userID
+}
+
 type RunTaskActionType string
 
 const (
@@ -256,10 +496,11 @@ type RunTaskActionsRequest struct {
 }
 
 func (h *ActionHandler) RunTaskAction(ctx context.Context, req *RunTaskActionsRequest) error {
-	runResp, resp, err := h.runserviceClient.GetRun(ctx, req.RunID, nil)
+	runResp, err := h.getRunByRef(ctx, req.RunID)
 	if err != nil {
-		return ErrFromRemote(resp, err)
+		return err
 	}
+	runID := runResp.Run.ID
 	canDoRunAction, err := h.CanDoRunActions(ctx, runResp.RunConfig.Group)
 	if err != nil {
 		return errors.Errorf("failed to determine permissions: %w", err)
@@ -291,6 +532,12 @@ func (h *ActionHandler) RunTaskAction(ctx context.Context, req *RunTaskActionsRe
 			}
 		}
 
+		if rct, ok := runResp.RunConfig.Tasks[req.TaskID]; ok && rct.DeployEnvironment != nil {
+			if !rct.DeployEnvironment.IsApprover(curUserID) {
+				return util.NewErrForbidden(errors.Errorf("user not allowed to approve tasks targeting deploy environment %q", rct.DeployEnvironment.Name))
+			}
+		}
+
 		for _, approver := range approvers {
 			if approver == curUserID {
 				return util.NewErrBadRequest(errors.Errorf("user %q alredy approved the task", approver))
@@ -311,7 +558,7 @@ func (h *ActionHandler) RunTaskAction(ctx context.Context, req *RunTaskActionsRe
 			ChangeGroupsUpdateToken: runResp.ChangeGroupsUpdateToken,
 		}
 
-		resp, err := h.runserviceClient.RunTaskActions(ctx, req.RunID, req.TaskID, rsreq)
+		resp, err := h.runserviceClient.RunTaskActions(ctx, runID, req.TaskID, rsreq)
 		if err != nil {
 			return ErrFromRemote(resp, err)
 		}
@@ -328,17 +575,27 @@ type CreateRunRequest struct {
 	RefType            itypes.RunRefType
 	RunCreationTrigger itypes.RunCreationTriggerType
 
-	Project             *cstypes.Project
-	User                *cstypes.User
-	RepoPath            string
-	GitSource           gitsource.GitSource
-	CommitSHA           string
-	Message             string
-	Branch              string
-	Tag                 string
-	Ref                 string
-	PullRequestID       string
-	PRFromSameRepo      bool
+	// WebhookDeliveryID is the id of the webhook delivery creating the runs.
+	// Replayed reports that the delivery is being replayed.
+	WebhookDeliveryID string
+	Replayed          bool
+
+	Project        *cstypes.Project
+	User           *cstypes.User
+	RepoPath       string
+	GitSource      gitsource.GitSource
+	CommitSHA      string
+	Message        string
+	Branch         string
+	Tag            string
+	Ref            string
+	PullRequestID  string
+	PRFromSameRepo bool
+	// PRAuthor is the git source identifier of the pull request author
+	PRAuthor string
+	// PRBaseBranch is the pull request target branch. When empty the
+	// repository default branch is used
+	PRBaseBranch        string
 	SSHPrivKey          string
 	SSHHostKey          string
 	SkipSSHHostKeyCheck bool
@@ -356,21 +613,85 @@ type CreateRunRequest struct {
 	// commit compare link
 	CompareLink string
 
+	// commit metadata. When not provided it's fetched from the git source
+	CommitMessage     string
+	CommitAuthorName  string
+	CommitAuthorEmail string
+
 	// fields only used with user direct runs
 	UserRunRepoUUID string
 	Variables       map[string]string
+
+	// ExecutorID pins the run tasks to the provided executor. Only admins can
+	// set it.
+	ExecutorID string
+
+	// RunSelectors are the names or labels of the runs, defined in the run
+	// config, to create. When empty all the runs are created.
+	RunSelectors []string
+
+	// PullRequestClosed reports that the pull request has been closed. Only
+	// the runs tearing down its active preview environments are created.
+	PullRequestClosed bool
+
+	// fields only used with runs triggered by other runs
+	// DependsOn are the ids of the upstream runs that must succeed before the
+	// created runs can start
+	DependsOn []string
+	// TriggerChain contains the keys (project id and ref) of all the upstream
+	// runs and it's used to detect trigger cycles
+	TriggerChain []string
+	// TriggeredBy, when set, overrides the run trigger author
+	TriggeredBy string
+
+	// RunTags are added to the tags defined in the run config
+	RunTags []string
 }
 
-func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) error {
+// CreateRuns creates a run for every run defined in the run config and returns
+// the created runs ids
+func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) ([]string, error) {
+	ctx, span := tracing.StartSpan(ctx, "gateway.create_runs")
+	defer span.End()
+	span.SetAttribute("agola.run_creation_trigger", string(req.RunCreationTrigger))
+	span.SetAttribute("agola.commit_sha", req.CommitSHA)
+
+	runIDs, err := h.createRuns(ctx, req)
+	span.SetError(err)
+	return runIDs, err
+}
+
+func (h *ActionHandler) createRuns(ctx context.Context, req *CreateRunRequest) ([]string, error) {
 	setupErrors := []string{}
 
 	if req.CommitSHA == "" {
-		return util.NewErrBadRequest(errors.Errorf("empty commit SHA"))
+		return nil, util.NewErrBadRequest(errors.Errorf("empty commit SHA"))
 	}
 	if req.Message == "" {
-		return util.NewErrBadRequest(errors.Errorf("empty message"))
+		return nil, util.NewErrBadRequest(errors.Errorf("empty message"))
+	}
+	// pinning runs to an executor is a debugging aid that could be used to
+	// starve the other runs, so it's restricted to admins
+	if req.ExecutorID != "" && !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("only admins can pin a run to an executor"))
 	}
 
+	if req.RunType == itypes.RunTypeProject && req.RunCreationTrigger == itypes.RunCreationTriggerTypeWebhook {
+		allowed, err := h.triggerPolicyAllowsRuns(req)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			h.log.Infof("skipping runs creation since not allowed by the project %q trigger policy", req.Project.ID)
+			return []string{}, nil
+		}
+	}
+
+	if req.CommitAuthorName == "" && req.CommitAuthorEmail == "" {
+		h.fetchCommitMetadata(req)
+	}
+	commitMessage := commitMessageSummary(req.CommitMessage)
+
 	var baseGroupType common.GroupType
 	var baseGroupID string
 	var groupType common.GroupType
@@ -398,9 +719,22 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 
 	runGroup := common.GenRunGroup(baseGroupType, baseGroupID, groupType, group)
 
+	var activePreviewEnvs map[string]struct{}
+	if req.PullRequestClosed {
+		var err error
+		activePreviewEnvs, err = h.activePreviewEnvironments(ctx, runGroup)
+		if err != nil {
+			return nil, err
+		}
+		if len(activePreviewEnvs) == 0 {
+			h.log.Debugf("skipping runs creation since the closed pull request doesn't have active preview environments")
+			return []string{}, nil
+		}
+	}
+
 	gitURL, err := util.ParseGitURL(req.CloneURL)
 	if err != nil {
-		return errors.Errorf("failed to parse clone url: %w", err)
+		return nil, errors.Errorf("failed to parse clone url: %w", err)
 	}
 	gitHost := gitURL.Hostname()
 	gitPort := gitURL.Port()
@@ -428,14 +762,17 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 		env["AGOLA_SKIPSSHHOSTKEYCHECK"] = "1"
 	}
 
+	untrusted := h.isUntrustedRun(req)
+
 	var variables map[string]string
 	if req.RunType == itypes.RunTypeProject {
-		if req.RefType != itypes.RunRefTypePullRequest || req.PRFromSameRepo || req.Project.PassVarsToForkedPR {
-			var err error
-			variables, err = h.genRunVariables(ctx, req)
-			if err != nil {
-				return err
-			}
+		// untrusted runs only get the variables referencing fork safe secrets
+		// unless the project passes all the variables to forked PRs
+		forkSafeOnly := untrusted && !req.Project.PassVarsToForkedPR
+		var err error
+		variables, err = h.genRunVariables(ctx, req, forkSafeOnly)
+		if err != nil {
+			return nil, err
 		}
 	} else {
 		variables = req.Variables
@@ -473,39 +810,77 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 		annotations[AnnotationPullRequestLink] = req.PullRequestLink
 	}
 
+	// the run trigger is the webhook sender or the user that manually created
+	// the run
+	triggeredBy := req.WebhookSender
+	if req.RunCreationTrigger != itypes.RunCreationTriggerTypeWebhook {
+		triggeredBy = h.CurrentUserID(ctx)
+	}
+	if req.TriggeredBy != "" {
+		triggeredBy = req.TriggeredBy
+	}
+
 	// Since user belong to the same group (the user uuid) we needed another way to differentiate the cache. We'll use the user uuid + the user run repo uuid
 	var cacheGroup string
 	if req.RunType == itypes.RunTypeUser {
 		cacheGroup = req.User.ID + "-" + req.UserRunRepoUUID
 	}
 
-	data, filename, err := h.fetchConfigFiles(ctx, req.GitSource, req.RepoPath, req.CommitSHA)
-	if err != nil {
-		return util.NewErrInternal(errors.Errorf("failed to fetch config file: %w", err))
-	}
-	h.log.Debug("data: %s", data)
+	// createNoRunsRun creates a run, without tasks, reporting why the event
+	// didn't create any run so it's visible in the runs list
+	createNoRunsRun := func(reason string) ([]string, error) {
+		createRunReq := &rsapitypes.RunCreateRequest{
+			RunConfigTasks:    nil,
+			Group:             runGroup,
+			NoRunsReason:      reason,
+			Name:              rstypes.RunNoRunsName,
+			StaticEnvironment: env,
+			Annotations:       annotations,
+			CommitSHA:         req.CommitSHA,
+			CommitAuthorName:  req.CommitAuthorName,
+			CommitAuthorEmail: req.CommitAuthorEmail,
+			CommitMessage:     commitMessage,
+			TriggerType:       string(req.RunCreationTrigger),
+			TriggeredBy:       triggeredBy,
+			Untrusted:         untrusted,
+			Tags:              req.RunTags,
+		}
 
-	var configFormat config.ConfigFormat
-	switch path.Ext(filename) {
-	case ".jsonnet":
-		configFormat = config.ConfigFormatJsonnet
-	case ".json":
-		fallthrough
-	case ".yml":
-		configFormat = config.ConfigFormatJSON
+		rsresp, _, err := h.runserviceClient.CreateRun(ctx, createRunReq)
+		if err != nil {
+			h.log.Errorf("failed to create run: %+v", err)
+			return nil, err
+		}
+		return []string{rsresp.Run.ID}, nil
+	}
+	// the runs triggered by an upstream run and the runs tearing down the
+	// preview environments of a closed pull request are optional so they
+	// don't report that no run was created
+	reportNoRuns := len(req.DependsOn) == 0 && !req.PullRequestClosed
 
+	data, configFormat, err := h.fetchConfig(ctx, req)
+	if err != nil {
+		if !errors.Is(err, errNoConfigFile) {
+			return nil, err
+		}
+		if !reportNoRuns {
+			return nil, util.NewErrInternal(err)
+		}
+		h.log.Infof("no config file found for commit %q: %v", req.CommitSHA, err)
+		return createNoRunsRun(fmt.Sprintf("no config file found, expected one of %s", strings.Join(configFilePaths(), ", ")))
 	}
 
-	configContext := &config.ConfigContext{
-		RefType:       req.RefType,
-		Ref:           req.Ref,
-		Branch:        req.Branch,
-		Tag:           req.Tag,
-		PullRequestID: req.PullRequestID,
-		CommitSHA:     req.CommitSHA,
+	// report when the pull request changes the run config since the run will
+	// use the base branch one
+	if configFromBaseBranch(req) {
+		annotations[AnnotationConfigBaseBranch] = req.PRBaseBranch
+		if h.headConfigDiverged(req, data) {
+			h.log.Infof("pull request %q changes the run config, using the one of base branch %q", req.PullRequestID, req.PRBaseBranch)
+			annotations[AnnotationConfigDiverged] = "true"
+		}
 	}
 
-	config, err := config.ParseConfig([]byte(data), configFormat, configContext)
+	config, err := config.ParseConfig([]byte(data), configFormat, genConfigContext(req))
 	if err != nil {
 		h.log.Errorf("failed to parse config: %+v", err)
 
@@ -519,54 +894,542 @@ func (h *ActionHandler) CreateRuns(ctx context.Context, req *CreateRunRequest) e
 			Name:              rstypes.RunGenericSetupErrorName,
 			StaticEnvironment: env,
 			Annotations:       annotations,
+			CommitSHA:         req.CommitSHA,
+			CommitAuthorName:  req.CommitAuthorName,
+			CommitAuthorEmail: req.CommitAuthorEmail,
+			CommitMessage:     commitMessage,
+			TriggerType:       string(req.RunCreationTrigger),
+			TriggeredBy:       triggeredBy,
+			Untrusted:         untrusted,
+			WebhookDeliveryID: req.WebhookDeliveryID,
+			Replayed:          req.Replayed,
+			DependsOn:         req.DependsOn,
+			Tags:              req.RunTags,
 		}
 
-		if _, _, err := h.runserviceClient.CreateRun(ctx, createRunReq); err != nil {
+		rsresp, _, err := h.runserviceClient.CreateRun(ctx, createRunReq)
+		if err != nil {
 			h.log.Errorf("failed to create run: %+v", err)
-			return err
+			return nil, err
 		}
-		return nil
+		return []string{rsresp.Run.ID}, nil
 	}
 
+	runIDs := []string{}
+	// created runs ids keyed by run name
+	createdRuns := map[string]string{}
+	// why the runs weren't created
+	skipReasons := []string{}
+
 	for _, run := range config.Runs {
 		if SkipRunMessage.MatchString(req.Message) {
 			h.log.Debugf("skipping run since special commit message")
+			skipReasons = append(skipReasons, fmt.Sprintf("run %q: commit message contains the skip run marker", run.Name))
+			continue
+		}
+
+		if !run.Selected(req.RunSelectors) {
+			h.log.Debugf("skipping run %q since it doesn't match the run selectors", run.Name)
+			skipReasons = append(skipReasons, fmt.Sprintf("run %q: run doesn't match the run selectors", run.Name))
+			continue
+		}
+
+		if !previewEnvironmentRunAllowed(run, req, activePreviewEnvs) {
+			h.log.Debugf("skipping run %q since its preview environment isn't managed by this event", run.Name)
 			continue
 		}
 
 		if match := types.MatchWhen(run.When.ToWhen(), req.RefType, req.Branch, req.Tag, req.Ref); !match {
 			h.log.Debugf("skipping run since when condition doesn't match")
+			skipReasons = append(skipReasons, fmt.Sprintf("run %q: run when conditions don't match", run.Name))
 			continue
 		}
 
+		dependsOn := append([]string{}, req.DependsOn...)
+		missingDep := ""
+		for _, d := range run.Depends {
+			runID, ok := createdRuns[d]
+			if !ok {
+				missingDep = d
+				break
+			}
+			dependsOn = append(dependsOn, runID)
+		}
+		if missingDep != "" {
+			h.log.Debugf("skipping run %q since the run %q it depends on hasn't been created", run.Name, missingDep)
+			skipReasons = append(skipReasons, fmt.Sprintf("run %q: the run %q it depends on hasn't been created", run.Name, missingDep))
+			continue
+		}
+
+		runSetupErrors := setupErrors
+		triggeredRunReqs, err := h.genTriggeredRunRequests(ctx, req, run, untrusted, triggeredBy)
+		if err != nil {
+			h.log.Errorf("failed to generate triggered runs: %+v", err)
+			runSetupErrors = append(runSetupErrors, err.Error())
+		}
+
 		rcts := runconfig.GenRunConfigTasks(util.DefaultUUIDGenerator{}, config, run.Name, variables, req.RefType, req.Branch, req.Tag, req.Ref)
+		if err := setRunConfigTasks(rcts, req, untrusted); err != nil {
+			runSetupErrors = append(runSetupErrors, err.Error())
+		}
 
 		createRunReq := &rsapitypes.RunCreateRequest{
-			RunConfigTasks:    rcts,
-			Group:             runGroup,
-			SetupErrors:       setupErrors,
-			Name:              run.Name,
-			StaticEnvironment: env,
-			Annotations:       annotations,
-			CacheGroup:        cacheGroup,
+			RunConfigTasks:     rcts,
+			Group:              runGroup,
+			SetupErrors:        runSetupErrors,
+			Name:               run.Name,
+			StaticEnvironment:  env,
+			Annotations:        annotations,
+			CacheGroup:         cacheGroup,
+			CommitSHA:          req.CommitSHA,
+			CommitAuthorName:   req.CommitAuthorName,
+			CommitAuthorEmail:  req.CommitAuthorEmail,
+			CommitMessage:      commitMessage,
+			TriggerType:        string(req.RunCreationTrigger),
+			TriggeredBy:        triggeredBy,
+			Untrusted:          untrusted,
+			WebhookDeliveryID:  req.WebhookDeliveryID,
+			Replayed:           req.Replayed,
+			ExecutorID:         req.ExecutorID,
+			DependsOn:          dependsOn,
+			Tags:               append(append([]string{}, run.Tags...), req.RunTags...),
+			PreviewEnvironment: genRunPreviewEnvironment(run, req),
 		}
 
-		if _, _, err := h.runserviceClient.CreateRun(ctx, createRunReq); err != nil {
+		rsresp, _, err := h.runserviceClient.CreateRun(ctx, createRunReq)
+		if err != nil {
 			h.log.Errorf("failed to create run: %+v", err)
-			return err
+			return nil, err
+		}
+		runIDs = append(runIDs, rsresp.Run.ID)
+		createdRuns[run.Name] = rsresp.Run.ID
+
+		for _, treq := range triggeredRunReqs {
+			treq.DependsOn = []string{rsresp.Run.ID}
+			triggeredRunIDs, err := h.CreateRuns(ctx, treq)
+			if err != nil {
+				// the upstream run has already been created so just log the
+				// error, the run will be visible without its downstream runs
+				h.log.Errorf("failed to create runs of project %q triggered by run %q: %+v", treq.Project.ID, rsresp.Run.ID, err)
+				continue
+			}
+			runIDs = append(runIDs, triggeredRunIDs...)
+		}
+	}
+
+	if len(runIDs) == 0 && reportNoRuns {
+		if len(config.Runs) == 0 {
+			return createNoRunsRun("the config doesn't define any run")
+		}
+		return createNoRunsRun(fmt.Sprintf("no run matched the event: %s", strings.Join(skipReasons, "; ")))
+	}
+
+	return runIDs, nil
+}
+
+// triggerPolicyAllowsRuns reports if the project trigger policy allows creating
+// the runs of a webhook event
+func (h *ActionHandler) triggerPolicyAllowsRuns(req *CreateRunRequest) (bool, error) {
+	tp := req.Project.EffectiveTriggerPolicy()
+
+	switch req.RefType {
+	case itypes.RunRefTypeBranch:
+		switch tp.Branches {
+		case cstypes.TriggerBranchesPolicyNone:
+			return false, nil
+		case cstypes.TriggerBranchesPolicyDefault:
+			repoInfo, err := req.GitSource.GetRepoInfo(req.RepoPath)
+			if err != nil {
+				return false, errors.Errorf("failed to get repository %q info: %w", req.RepoPath, err)
+			}
+			if repoInfo.DefaultBranch == "" {
+				// not all the git sources report the default branch, don't
+				// silently stop building the project
+				h.log.Warnf("cannot determine the default branch of repository %q, creating runs for branch %q", req.RepoPath, req.Branch)
+				return true, nil
+			}
+			return req.Branch == repoInfo.DefaultBranch, nil
+		}
+	case itypes.RunRefTypeTag:
+		return tp.Tags, nil
+	case itypes.RunRefTypePullRequest:
+		return tp.PullRequests, nil
+	}
+
+	return true, nil
+}
+
+// genTriggeredRunRequests generates the requests to create the runs of the
+// projects triggered by the provided run
+func (h *ActionHandler) genTriggeredRunRequests(ctx context.Context, req *CreateRunRequest, run *config.Run, untrusted bool, triggeredBy string) ([]*CreateRunRequest, error) {
+	if len(run.Triggers) == 0 {
+		return nil, nil
+	}
+	if req.RunType != itypes.RunTypeProject {
+		return nil, errors.Errorf("run %q: run triggers are supported only by project runs", run.Name)
+	}
+	if untrusted {
+		return nil, errors.Errorf("run %q: run triggers aren't allowed in untrusted runs", run.Name)
+	}
+
+	// get the project with its owner
+	up, resp, err := h.configstoreClient.GetProject(ctx, req.Project.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", req.Project.ID, ErrFromRemote(resp, err))
+	}
+
+	chain := append(append([]string{}, req.TriggerChain...), runTriggerChainKey(req.Project.ID, req.Ref))
+
+	treqs := []*CreateRunRequest{}
+	for _, trigger := range run.Triggers {
+		treq, err := h.genTriggeredRunRequest(ctx, up, trigger, chain)
+		if err != nil {
+			return nil, errors.Errorf("run %q: trigger for project %q branch %q: %w", run.Name, trigger.Project, trigger.Branch, err)
 		}
+		treq.RunCreationTrigger = itypes.RunCreationTriggerTypeRun
+		treq.TriggerChain = chain
+		treq.TriggeredBy = triggeredBy
+		treqs = append(treqs, treq)
+	}
+
+	return treqs, nil
+}
+
+func (h *ActionHandler) genTriggeredRunRequest(ctx context.Context, upstreamProject *csapitypes.Project, trigger *config.RunProjectTrigger, chain []string) (*CreateRunRequest, error) {
+	p, resp, err := h.configstoreClient.GetProject(ctx, trigger.Project)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", trigger.Project, ErrFromRemote(resp, err))
+	}
+
+	// a run can only trigger the runs of projects with the same owner
+	if p.OwnerType != upstreamProject.OwnerType || p.OwnerID != upstreamProject.OwnerID {
+		return nil, errors.Errorf("project %q has a different owner", trigger.Project)
 	}
 
+	user, rs, la, err := h.getRemoteRepoAccessData(ctx, p.LinkedAccountID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get remote repo access data: %w", err)
+	}
+
+	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+	if err != nil {
+		return nil, errors.Errorf("failed to create gitsource client: %w", err)
+	}
+
+	treq, err := h.genProjectRefRunRequest(p, rs, gitSource, trigger.Branch, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	key := runTriggerChainKey(p.ID, treq.Ref)
+	for _, k := range chain {
+		if k == key {
+			return nil, errors.Errorf("run trigger cycle detected")
+		}
+	}
+
+	return treq, nil
+}
+
+func runTriggerChainKey(projectID, ref string) string {
+	return projectID + " " + ref
+}
+
+// fetchCommitMetadata fills the commit metadata not provided by the run
+// creator (i.e. pull request and tag webhooks don't report the commit author)
+// fetching it from the git source. The commit metadata is only informative, so
+// failures are just logged.
+func (h *ActionHandler) fetchCommitMetadata(req *CreateRunRequest) {
+	if req.GitSource == nil {
+		return
+	}
+	commit, err := req.GitSource.GetCommit(req.RepoPath, req.CommitSHA)
+	if err != nil {
+		h.log.Warnf("failed to get commit %q information from git source: %v", req.CommitSHA, err)
+		return
+	}
+	// some git sources don't provide commit information
+	if commit == nil {
+		return
+	}
+	req.CommitAuthorName = commit.AuthorName
+	req.CommitAuthorEmail = commit.AuthorEmail
+	if req.CommitMessage == "" {
+		req.CommitMessage = commit.Message
+	}
+}
+
+// commitMessageSummary returns the first line of the commit message
+func commitMessageSummary(message string) string {
+	return strings.TrimSpace(strings.SplitN(strings.TrimSpace(message), "\n", 2)[0])
+}
+
+// isUntrustedRun reports if the run is untrusted. A run is untrusted when
+// triggered by a pull request from a forked repository whose author isn't a
+// collaborator of the project repository.
+func (h *ActionHandler) isUntrustedRun(req *CreateRunRequest) bool {
+	if req.RunType != itypes.RunTypeProject || req.RefType != itypes.RunRefTypePullRequest || req.PRFromSameRepo {
+		return false
+	}
+	if req.PRAuthor == "" {
+		return true
+	}
+
+	isCollaborator, err := req.GitSource.IsCollaborator(req.RepoPath, req.PRAuthor)
+	if err != nil {
+		// consider the run untrusted if we cannot check the pr author
+		h.log.Errorf("failed to check if pull request author %q is a collaborator of repository %q: %+v", req.PRAuthor, req.RepoPath, err)
+		return true
+	}
+	return !isCollaborator
+}
+
+// setRunConfigTasks applies to the run tasks generated from the run config the
+// project settings and the untrusted runs restrictions. It's used both when
+// creating and when previewing the runs so they'll always match.
+func setRunConfigTasks(rcts map[string]*rstypes.RunConfigTask, req *CreateRunRequest, untrusted bool) error {
+	setRunConfigTasksNetworkPolicy(rcts, req, untrusted)
+	setRunConfigTasksSecurityProfile(rcts, req, untrusted)
+	setRunConfigTasksMaxStepLogSize(rcts, req)
+	if untrusted && req.Project.UntrustedRunsNeedApproval {
+		setRunConfigTasksNeedApproval(rcts)
+	}
+	return setRunConfigTasksDeployEnvironments(rcts, req)
+}
+
+// setRunConfigTasksNetworkPolicy sets the network policy of the run tasks.
+// Untrusted runs always get the untrusted network policy since their run
+// config cannot be trusted. The project network policy is used when not
+// defined by the run config.
+func setRunConfigTasksNetworkPolicy(rcts map[string]*rstypes.RunConfigTask, req *CreateRunRequest, untrusted bool) {
+	for _, rct := range rcts {
+		switch {
+		case untrusted:
+			rct.NetworkPolicy = rstypes.NetworkPolicyUntrusted
+		case rct.NetworkPolicy == "" && req.RunType == itypes.RunTypeProject:
+			rct.NetworkPolicy = req.Project.NetworkPolicy
+		}
+	}
+}
+
+// setRunConfigTasksSecurityProfile sets the security profile of the run tasks.
+// The project security profile is used when not defined by the run config.
+// Untrusted runs cannot select it since their run config cannot be trusted, so
+// they get the project one (or the executor default).
+func setRunConfigTasksSecurityProfile(rcts map[string]*rstypes.RunConfigTask, req *CreateRunRequest, untrusted bool) {
+	for _, rct := range rcts {
+		if untrusted {
+			rct.SecurityProfile = ""
+		}
+		if rct.SecurityProfile == "" && req.RunType == itypes.RunTypeProject {
+			rct.SecurityProfile = req.Project.SecurityProfile
+		}
+	}
+}
+
+// setRunConfigTasksMaxStepLogSize sets the project max step log size, if
+// defined, to the run tasks
+func setRunConfigTasksMaxStepLogSize(rcts map[string]*rstypes.RunConfigTask, req *CreateRunRequest) {
+	if req.RunType != itypes.RunTypeProject || req.Project.MaxStepLogSize <= 0 {
+		return
+	}
+	for _, rct := range rcts {
+		rct.MaxStepLogSize = req.Project.MaxStepLogSize
+	}
+}
+
+// setRunConfigTasksNeedApproval requires an approval for all the run root
+// tasks so no task will be executed before the run is approved
+func setRunConfigTasksNeedApproval(rcts map[string]*rstypes.RunConfigTask) {
+	for _, rct := range rcts {
+		if len(rct.Depends) == 0 {
+			rct.NeedsApproval = true
+		}
+	}
+}
+
+// setRunConfigTasksDeployEnvironments sets the protection rules of the tasks
+// targeting a project deploy environment. It returns an error when a task
+// targets a not existing deploy environment or one where the run branch isn't
+// allowed to deploy.
+func setRunConfigTasksDeployEnvironments(rcts map[string]*rstypes.RunConfigTask, req *CreateRunRequest) error {
+	for _, rct := range rcts {
+		// skipped tasks won't be executed
+		if rct.DeployEnvironment == nil || rct.Skip {
+			continue
+		}
+		name := rct.DeployEnvironment.Name
+		if req.RunType != itypes.RunTypeProject {
+			return errors.Errorf("task %q: deploy environments are available only in project runs", rct.Name)
+		}
+		de := req.Project.DeployEnvironment(name)
+		if de == nil {
+			return errors.Errorf("task %q: project deploy environment %q doesn't exist", rct.Name, name)
+		}
+		branch := ""
+		if req.RefType == itypes.RunRefTypeBranch {
+			branch = req.Branch
+		}
+		if !de.BranchAllowed(branch) {
+			return errors.Errorf("task %q: ref %q isn't allowed to deploy to environment %q", rct.Name, req.Ref, name)
+		}
+
+		rct.DeployEnvironment = &rstypes.RunConfigTaskDeployEnvironment{
+			Name:              de.Name,
+			RequiredApprovals: de.RequiredApprovals,
+			Approvers:         de.Approvers,
+			WaitTimer:         de.WaitTimer,
+		}
+		if de.RequiredApprovals > 0 {
+			rct.NeedsApproval = true
+		}
+	}
 	return nil
 }
 
+// fetchConfig fetches the config file at the request commit and returns its
+// content and format
+func (h *ActionHandler) fetchConfig(ctx context.Context, req *CreateRunRequest) ([]byte, config.ConfigFormat, error) {
+	gitSource, repoPath, _, commitSHA, err := h.runConfigRepository(ctx, req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, filename, err := h.fetchConfigFiles(ctx, gitSource, repoPath, commitSHA)
+	if err != nil {
+		return nil, 0, errors.Errorf("failed to fetch config file: %w", err)
+	}
+	h.log.Debug("data: %s", data)
+
+	var configFormat config.ConfigFormat
+	switch path.Ext(filename) {
+	case ".jsonnet":
+		configFormat = config.ConfigFormatJsonnet
+	case ".json":
+		fallthrough
+	case ".yml":
+		configFormat = config.ConfigFormatJSON
+
+	}
+
+	return data, configFormat, nil
+}
+
+// runConfigRepository returns the git source, the repository path, the ref and
+// the commit from where the run config is read. It's the run commit of the
+// project repository unless the project defines a config repository, in this
+// case it's the current head of the config repository branch, or the project
+// reads the pull requests run config from their base branch, in this case
+// it's the current head of the base branch.
+func (h *ActionHandler) runConfigRepository(ctx context.Context, req *CreateRunRequest) (gitsource.GitSource, string, string, string, error) {
+	if configFromBaseBranch(req) {
+		return h.runConfigBaseBranch(req)
+	}
+	if req.RunType != itypes.RunTypeProject || req.Project.ConfigRepository == nil {
+		return req.GitSource, req.RepoPath, req.Ref, req.CommitSHA, nil
+	}
+
+	cr := req.Project.ConfigRepository
+	user, rs, la, err := h.getRemoteRepoAccessData(ctx, cr.LinkedAccountID)
+	if err != nil {
+		return nil, "", "", "", util.NewErrInternal(errors.Errorf("failed to get config repository access data: %w", err))
+	}
+	if rs.ID != cr.RemoteSourceID {
+		return nil, "", "", "", util.NewErrInternal(errors.Errorf("config repository linked account %q isn't of remote source %q", cr.LinkedAccountID, cr.RemoteSourceID))
+	}
+
+	gitSource, err := h.GetGitSource(ctx, rs, user.Name, la)
+	if err != nil {
+		return nil, "", "", "", util.NewErrInternal(errors.Errorf("failed to create config repository gitsource client: %w", err))
+	}
+
+	ref := gitSource.BranchRef(cr.Branch)
+	gitRef, err := gitSource.GetRef(cr.RepositoryPath, ref)
+	if err != nil {
+		return nil, "", "", "", util.NewErrInternal(errors.Errorf("failed to get config repository %q ref %q: %w", cr.RepositoryPath, ref, err))
+	}
+
+	return gitSource, cr.RepositoryPath, ref, gitRef.CommitSHA, nil
+}
+
+// configFromBaseBranch reports if the run config of the pull request run must
+// be read from the pull request base branch instead of its head commit, so
+// the pull request cannot change the pipeline executed on it. A config
+// repository takes precedence since it's already outside the pull request
+// control.
+func configFromBaseBranch(req *CreateRunRequest) bool {
+	return req.RunType == itypes.RunTypeProject && req.RefType == itypes.RunRefTypePullRequest && req.Project.ConfigFromBaseBranch && req.Project.ConfigRepository == nil
+}
+
+// runConfigBaseBranch returns the git source, the repository path, the ref and
+// the commit of the current head of the pull request base branch. When the
+// base branch isn't known the repository default branch is used and set in
+// the request.
+func (h *ActionHandler) runConfigBaseBranch(req *CreateRunRequest) (gitsource.GitSource, string, string, string, error) {
+	if req.PRBaseBranch == "" {
+		repoInfo, err := req.GitSource.GetRepoInfo(req.RepoPath)
+		if err != nil {
+			return nil, "", "", "", util.NewErrInternal(errors.Errorf("failed to get repository %q info: %w", req.RepoPath, err))
+		}
+		// never fall back to the pull request config
+		if repoInfo.DefaultBranch == "" {
+			return nil, "", "", "", util.NewErrInternal(errors.Errorf("cannot determine the base branch of pull request %q", req.PullRequestID))
+		}
+		req.PRBaseBranch = repoInfo.DefaultBranch
+	}
+
+	ref := req.GitSource.BranchRef(req.PRBaseBranch)
+	gitRef, err := req.GitSource.GetRef(req.RepoPath, ref)
+	if err != nil {
+		return nil, "", "", "", util.NewErrInternal(errors.Errorf("failed to get repository %q ref %q: %w", req.RepoPath, ref, err))
+	}
+
+	return req.GitSource, req.RepoPath, ref, gitRef.CommitSHA, nil
+}
+
+// headConfigDiverged reports if the config file at the pull request head
+// commit differs from the provided base branch one. A missing config file is
+// considered a difference.
+func (h *ActionHandler) headConfigDiverged(req *CreateRunRequest, baseData []byte) bool {
+	for _, filename := range configFilePaths() {
+		data, err := req.GitSource.GetFile(req.RepoPath, req.CommitSHA, filename)
+		if err != nil {
+			h.log.Debugf("config file %q not available at commit %q: %v", filename, req.CommitSHA, err)
+			continue
+		}
+		return !bytes.Equal(data, baseData)
+	}
+	return true
+}
+
+func genConfigContext(req *CreateRunRequest) *config.ConfigContext {
+	return &config.ConfigContext{
+		RefType:       req.RefType,
+		Ref:           req.Ref,
+		Branch:        req.Branch,
+		Tag:           req.Tag,
+		PullRequestID: req.PullRequestID,
+		CommitSHA:     req.CommitSHA,
+	}
+}
+
+// configFilePaths returns the repository paths of the config files in
+// priority order. The first existing one is used.
+func configFilePaths() []string {
+	return []string{
+		path.Join(agolaDefaultConfigDir, agolaDefaultJsonnetConfigFile),
+		path.Join(agolaDefaultConfigDir, agolaDefaultJsonConfigFile),
+		path.Join(agolaDefaultConfigDir, agolaDefaultYamlConfigFile),
+	}
+}
+
 func (h *ActionHandler) fetchConfigFiles(ctx context.Context, gitSource gitsource.GitSource, repopath, commitSHA string) ([]byte, string, error) {
 	var data []byte
 	var filename string
 	err := util.ExponentialBackoff(ctx, util.FetchFileBackoff, func() (bool, error) {
-		for _, filename = range []string{agolaDefaultJsonnetConfigFile, agolaDefaultJsonConfigFile, agolaDefaultYamlConfigFile} {
+		for _, filename = range configFilePaths() {
 			var err error
-			data, err = gitSource.GetFile(repopath, commitSHA, path.Join(agolaDefaultConfigDir, filename))
+			data, err = gitSource.GetFile(repopath, commitSHA, filename)
 			if err == nil {
 				return true, nil
 			}
@@ -575,12 +1438,15 @@ func (h *ActionHandler) fetchConfigFiles(ctx context.Context, gitSource gitsourc
 		return false, nil
 	})
 	if err != nil {
-		return nil, "", err
+		return nil, "", errors.Errorf("none of %s: %w", strings.Join(configFilePaths(), ", "), errNoConfigFile)
 	}
 	return data, filename, nil
 }
 
-func (h *ActionHandler) genRunVariables(ctx context.Context, req *CreateRunRequest) (map[string]string, error) {
+// genRunVariables generates the run variables from the project variables. When
+// forkSafeOnly is true only the variables referencing fork safe secrets are
+// provided.
+func (h *ActionHandler) genRunVariables(ctx context.Context, req *CreateRunRequest, forkSafeOnly bool) (map[string]string, error) {
 	variables := map[string]string{}
 
 	// get project variables
@@ -597,6 +1463,9 @@ func (h *ActionHandler) genRunVariables(ctx context.Context, req *CreateRunReque
 	if err != nil {
 		return nil, errors.Errorf("failed to get project secrets: %w", err)
 	}
+
+	usedVariables := []*csapitypes.Variable{}
+	usedSecrets := map[string]*csapitypes.Secret{}
 	for _, pvar := range pvars {
 		// find the value match
 		var varval cstypes.VariableValue
@@ -607,15 +1476,60 @@ func (h *ActionHandler) genRunVariables(ctx context.Context, req *CreateRunReque
 			}
 			// get the secret value referenced by the variable, it must be a secret at the same level or a lower level
 			secret := common.GetVarValueMatchingSecret(varval, pvar.ParentPath, secrets)
-			if secret != nil {
+			if secret != nil && (!forkSafeOnly || secret.ForkSafe) {
 				varValue, ok := secret.Data[varval.SecretVar]
 				if ok {
 					variables[pvar.Name] = varValue
+					usedVariables = append(usedVariables, pvar)
+					usedSecrets[secret.ID] = secret
 				}
 			}
 			break
 		}
 	}
 
+	h.updateConfigUsages(ctx, req.Project.ID, usedVariables, usedSecrets)
+
 	return variables, nil
 }
+
+// updateConfigUsages records that the provided variables and secrets have
+// been used by a run of the project. To avoid a configstore write for every
+// run the usage is updated only when older than configUsageUpdateInterval.
+// Errors are only logged since they mustn't block run creation.
+func (h *ActionHandler) updateConfigUsages(ctx context.Context, projectID string, variables []*csapitypes.Variable, secrets map[string]*csapitypes.Secret) {
+	for _, v := range variables {
+		if !configUsageNeedsUpdate(v.Usages, projectID) {
+			continue
+		}
+		req := &csapitypes.UpdateVariableUsageRequest{ProjectID: projectID}
+		var resp *http.Response
+		var err error
+		switch v.Parent.Type {
+		case cstypes.ConfigTypeProjectGroup:
+			resp, err = h.configstoreClient.UpdateProjectGroupVariableUsage(ctx, v.Parent.ID, v.Name, req)
+		case cstypes.ConfigTypeProject:
+			resp, err = h.configstoreClient.UpdateProjectVariableUsage(ctx, v.Parent.ID, v.Name, req)
+		}
+		if err != nil {
+			h.log.Errorf("failed to update variable %q usage: %+v", v.Name, ErrFromRemote(resp, err))
+		}
+	}
+	for _, s := range secrets {
+		if !configUsageNeedsUpdate(s.Usages, projectID) {
+			continue
+		}
+		req := &csapitypes.UpdateSecretUsageRequest{ProjectID: projectID}
+		var resp *http.Response
+		var err error
+		switch s.Parent.Type {
+		case cstypes.ConfigTypeProjectGroup:
+			resp, err = h.configstoreClient.UpdateProjectGroupSecretUsage(ctx, s.Parent.ID, s.Name, req)
+		case cstypes.ConfigTypeProject:
+			resp, err = h.configstoreClient.UpdateProjectSecretUsage(ctx, s.Parent.ID, s.Name, req)
+		}
+		if err != nil {
+			h.log.Errorf("failed to update secret %q usage: %+v", s.Name, ErrFromRemote(resp, err))
+		}
+	}
+}
@@ -0,0 +1,625 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gitsource "agola.io/agola/internal/gitsources"
+	itypes "agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+	rsclient "agola.io/agola/services/runservice/client"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+// fakeGitSource is a git source reporting the provided collaborators. Only
+// IsCollaborator is implemented.
+type fakeGitSource struct {
+	gitsource.GitSource
+
+	collaborators []string
+	err           error
+}
+
+func (s *fakeGitSource) IsCollaborator(repopath, user string) (bool, error) {
+	if s.err != nil {
+		return false, s.err
+	}
+	return util.StringInSlice(s.collaborators, user), nil
+}
+
+// fakeRepoGitSource is a git source of a single repository with the provided
+// branches heads and files at every commit
+type fakeRepoGitSource struct {
+	gitsource.GitSource
+
+	defaultBranch string
+	// branches maps the branches names to their head commit
+	branches map[string]string
+	// files maps the commits to their files contents
+	files map[string]map[string]string
+}
+
+func (s *fakeRepoGitSource) GetRepoInfo(repopath string) (*gitsource.RepoInfo, error) {
+	return &gitsource.RepoInfo{Path: repopath, DefaultBranch: s.defaultBranch}, nil
+}
+
+func (s *fakeRepoGitSource) BranchRef(branch string) string {
+	return "refs/heads/" + branch
+}
+
+func (s *fakeRepoGitSource) GetRef(repopath, ref string) (*gitsource.Ref, error) {
+	commitSHA, ok := s.branches[strings.TrimPrefix(ref, "refs/heads/")]
+	if !ok {
+		return nil, errors.Errorf("ref %q doesn't exist", ref)
+	}
+	return &gitsource.Ref{Ref: ref, CommitSHA: commitSHA}, nil
+}
+
+func (s *fakeRepoGitSource) GetFile(repopath, commit, file string) ([]byte, error) {
+	data, ok := s.files[commit][file]
+	if !ok {
+		return nil, errors.Errorf("file %q doesn't exist at commit %q", file, commit)
+	}
+	return []byte(data), nil
+}
+
+func TestIsUntrustedRun(t *testing.T) {
+	gs := &fakeGitSource{collaborators: []string{"collaborator01"}}
+
+	tests := []struct {
+		name string
+		req  *CreateRunRequest
+		out  bool
+	}{
+		{
+			name: "test branch run",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypeBranch, GitSource: gs},
+			out:  false,
+		},
+		{
+			name: "test user direct run",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeUser, RefType: itypes.RunRefTypePullRequest, PRAuthor: "user01", GitSource: gs},
+			out:  false,
+		},
+		{
+			name: "test same repo pull request from not collaborator",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, PRFromSameRepo: true, PRAuthor: "user01", GitSource: gs},
+			out:  false,
+		},
+		{
+			name: "test fork pull request from collaborator",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, PRAuthor: "collaborator01", GitSource: gs},
+			out:  false,
+		},
+		{
+			name: "test fork pull request from not collaborator",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, PRAuthor: "user01", GitSource: gs},
+			out:  true,
+		},
+		{
+			name: "test fork pull request without author",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, GitSource: gs},
+			out:  true,
+		},
+		{
+			name: "test fork pull request with collaborator check error",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, PRAuthor: "collaborator01", GitSource: &fakeGitSource{collaborators: []string{"collaborator01"}, err: errors.Errorf("api error")}},
+			out:  true,
+		},
+	}
+
+	h := &ActionHandler{log: zap.NewNop().Sugar()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := h.isUntrustedRun(tt.req); out != tt.out {
+				t.Fatalf("expected untrusted %t, got %t", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestGenRunVariables(t *testing.T) {
+	projectID := "ba2e1bf5-95b8-4d32-a2b1-cb0f2bc31c15"
+	parentPath := "org/org01/project01"
+
+	secrets := []*csapitypes.Secret{
+		{
+			Secret: &cstypes.Secret{
+				ID:     "secret01",
+				Name:   "secret01",
+				Parent: cstypes.Parent{Type: cstypes.ConfigTypeProject, ID: projectID},
+				Type:   cstypes.SecretTypeInternal,
+				Data:   map[string]string{"token": "secrettoken"},
+			},
+			ParentPath: parentPath,
+		},
+		{
+			Secret: &cstypes.Secret{
+				ID:       "secret02",
+				Name:     "secret02",
+				Parent:   cstypes.Parent{Type: cstypes.ConfigTypeProject, ID: projectID},
+				Type:     cstypes.SecretTypeInternal,
+				Data:     map[string]string{"token": "forksafetoken"},
+				ForkSafe: true,
+			},
+			ParentPath: parentPath,
+		},
+	}
+	variables := []*csapitypes.Variable{
+		{
+			Variable: &cstypes.Variable{
+				ID:     "variable01",
+				Name:   "TOKEN",
+				Parent: cstypes.Parent{Type: cstypes.ConfigTypeProject, ID: projectID},
+				Values: []cstypes.VariableValue{{SecretName: "secret01", SecretVar: "token"}},
+			},
+			ParentPath: parentPath,
+		},
+		{
+			Variable: &cstypes.Variable{
+				ID:     "variable02",
+				Name:   "FORKSAFE_TOKEN",
+				Parent: cstypes.Parent{Type: cstypes.ConfigTypeProject, ID: projectID},
+				Values: []cstypes.VariableValue{{SecretName: "secret02", SecretVar: "token"}},
+			},
+			ParentPath: parentPath,
+		},
+	}
+
+	// fake configstore returning the project variables and secrets and
+	// accepting the usages updates
+	cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1alpha/projects/" + projectID + "/variables":
+			_ = json.NewEncoder(w).Encode(variables)
+		case "/api/v1alpha/projects/" + projectID + "/secrets":
+			_ = json.NewEncoder(w).Encode(secrets)
+		default:
+			_, _ = w.Write([]byte("{}"))
+		}
+	}))
+	defer cs.Close()
+
+	tests := []struct {
+		name         string
+		forkSafeOnly bool
+		out          map[string]string
+	}{
+		{
+			name: "test all variables",
+			out: map[string]string{
+				"TOKEN":          "secrettoken",
+				"FORKSAFE_TOKEN": "forksafetoken",
+			},
+		},
+		{
+			name:         "test fork safe only variables",
+			forkSafeOnly: true,
+			out: map[string]string{
+				"FORKSAFE_TOKEN": "forksafetoken",
+			},
+		},
+	}
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, csclient.NewClient(cs.URL), nil, "", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &CreateRunRequest{
+				RunType: itypes.RunTypeProject,
+				RefType: itypes.RunRefTypePullRequest,
+				Project: &cstypes.Project{ID: projectID},
+			}
+			out, err := h.genRunVariables(context.Background(), req, tt.forkSafeOnly)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSetRunConfigTasksNeedApproval(t *testing.T) {
+	rcts := map[string]*rstypes.RunConfigTask{
+		"task01": {Name: "task01"},
+		"task02": {Name: "task02", Depends: map[string]*rstypes.RunConfigTaskDepend{"task01": {TaskID: "task01"}}},
+		"task03": {Name: "task03", NeedsApproval: true, Depends: map[string]*rstypes.RunConfigTaskDepend{"task01": {TaskID: "task01"}}},
+		"task04": {Name: "task04"},
+	}
+
+	setRunConfigTasksNeedApproval(rcts)
+
+	out := map[string]bool{}
+	for id, rct := range rcts {
+		out[id] = rct.NeedsApproval
+	}
+	expected := map[string]bool{
+		"task01": true,
+		"task02": false,
+		"task03": true,
+		"task04": true,
+	}
+	if diff := cmp.Diff(expected, out); diff != "" {
+		t.Error(diff)
+	}
+}
+
+func TestSetRunConfigTasksNetworkPolicy(t *testing.T) {
+	project := &cstypes.Project{NetworkPolicy: "projectpolicy"}
+
+	tests := []struct {
+		name      string
+		req       *CreateRunRequest
+		untrusted bool
+		out       map[string]string
+	}{
+		{
+			name: "test trusted project run",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, Project: project},
+			out: map[string]string{
+				"task01": "projectpolicy",
+				"task02": "taskpolicy",
+			},
+		},
+		{
+			name:      "test untrusted project run",
+			req:       &CreateRunRequest{RunType: itypes.RunTypeProject, Project: project},
+			untrusted: true,
+			out: map[string]string{
+				"task01": rstypes.NetworkPolicyUntrusted,
+				"task02": rstypes.NetworkPolicyUntrusted,
+			},
+		},
+		{
+			name: "test user direct run",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeUser},
+			out: map[string]string{
+				"task01": "",
+				"task02": "taskpolicy",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcts := map[string]*rstypes.RunConfigTask{
+				"task01": {Name: "task01"},
+				"task02": {Name: "task02", NetworkPolicy: "taskpolicy"},
+			}
+
+			setRunConfigTasksNetworkPolicy(rcts, tt.req, tt.untrusted)
+
+			out := map[string]string{}
+			for id, rct := range rcts {
+				out[id] = rct.NetworkPolicy
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestSetRunConfigTasks(t *testing.T) {
+	project := &cstypes.Project{
+		NetworkPolicy:             "projectpolicy",
+		MaxStepLogSize:            1024,
+		UntrustedRunsNeedApproval: true,
+	}
+	req := &CreateRunRequest{RunType: itypes.RunTypeProject, Project: project}
+
+	rcts := map[string]*rstypes.RunConfigTask{
+		"task01": {Name: "task01"},
+		"task02": {Name: "task02", Depends: map[string]*rstypes.RunConfigTaskDepend{"task01": {TaskID: "task01"}}},
+	}
+
+	if err := setRunConfigTasks(rcts, req, true); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	for id, rct := range rcts {
+		if rct.MaxStepLogSize != project.MaxStepLogSize {
+			t.Errorf("task %q: expected max step log size %d, got %d", id, project.MaxStepLogSize, rct.MaxStepLogSize)
+		}
+		if rct.NetworkPolicy != rstypes.NetworkPolicyUntrusted {
+			t.Errorf("task %q: expected network policy %q, got %q", id, rstypes.NetworkPolicyUntrusted, rct.NetworkPolicy)
+		}
+	}
+	if !rcts["task01"].NeedsApproval {
+		t.Errorf("expected root task needing approval")
+	}
+	if rcts["task02"].NeedsApproval {
+		t.Errorf("expected child task not needing approval")
+	}
+}
+
+func TestConfigFromBaseBranch(t *testing.T) {
+	project := &cstypes.Project{ConfigFromBaseBranch: true}
+
+	tests := []struct {
+		name string
+		req  *CreateRunRequest
+		out  bool
+	}{
+		{
+			name: "test pull request run",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, Project: project},
+			out:  true,
+		},
+		{
+			name: "test branch run",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypeBranch, Project: project},
+		},
+		{
+			name: "test pull request run with project option disabled",
+			req:  &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, Project: &cstypes.Project{}},
+		},
+		{
+			name: "test pull request run with config repository",
+			req: &CreateRunRequest{RunType: itypes.RunTypeProject, RefType: itypes.RunRefTypePullRequest, Project: &cstypes.Project{
+				ConfigFromBaseBranch: true,
+				ConfigRepository:     &cstypes.ProjectConfigRepository{},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := configFromBaseBranch(tt.req); out != tt.out {
+				t.Fatalf("expected %t, got %t", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestRunConfigBaseBranch(t *testing.T) {
+	gs := &fakeRepoGitSource{
+		defaultBranch: "master",
+		branches: map[string]string{
+			"master":  "mastercommit",
+			"release": "releasecommit",
+		},
+	}
+
+	tests := []struct {
+		name         string
+		gitSource    *fakeRepoGitSource
+		prBaseBranch string
+		ref          string
+		commitSHA    string
+		baseBranch   string
+		err          bool
+	}{
+		{
+			name:         "test pull request base branch",
+			gitSource:    gs,
+			prBaseBranch: "release",
+			ref:          "refs/heads/release",
+			commitSHA:    "releasecommit",
+			baseBranch:   "release",
+		},
+		{
+			name:       "test default branch fallback",
+			gitSource:  gs,
+			ref:        "refs/heads/master",
+			commitSHA:  "mastercommit",
+			baseBranch: "master",
+		},
+		{
+			name:         "test unknown base branch",
+			gitSource:    gs,
+			prBaseBranch: "unknown",
+			err:          true,
+		},
+		{
+			name:      "test no default branch",
+			gitSource: &fakeRepoGitSource{branches: gs.branches},
+			err:       true,
+		},
+	}
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, nil, nil, "", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &CreateRunRequest{
+				GitSource:     tt.gitSource,
+				RepoPath:      "org/repo",
+				PullRequestID: "1",
+				PRBaseBranch:  tt.prBaseBranch,
+				CommitSHA:     "prheadcommit",
+			}
+
+			_, repoPath, ref, commitSHA, err := h.runConfigBaseBranch(req)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil err")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if repoPath != req.RepoPath {
+				t.Fatalf("expected repo path %q, got %q", req.RepoPath, repoPath)
+			}
+			if ref != tt.ref {
+				t.Fatalf("expected ref %q, got %q", tt.ref, ref)
+			}
+			if commitSHA != tt.commitSHA {
+				t.Fatalf("expected commit %q, got %q", tt.commitSHA, commitSHA)
+			}
+			if req.PRBaseBranch != tt.baseBranch {
+				t.Fatalf("expected request base branch %q, got %q", tt.baseBranch, req.PRBaseBranch)
+			}
+		})
+	}
+}
+
+func TestFetchConfigFromBaseBranch(t *testing.T) {
+	configFile := configFilePaths()[0]
+	gs := &fakeRepoGitSource{
+		branches: map[string]string{"master": "mastercommit"},
+		files: map[string]map[string]string{
+			"mastercommit": {configFile: "baseconfig"},
+			"prheadcommit": {configFile: "headconfig"},
+		},
+	}
+	req := &CreateRunRequest{
+		RunType:       itypes.RunTypeProject,
+		RefType:       itypes.RunRefTypePullRequest,
+		Project:       &cstypes.Project{ConfigFromBaseBranch: true},
+		GitSource:     gs,
+		RepoPath:      "org/repo",
+		PullRequestID: "1",
+		PRBaseBranch:  "master",
+		CommitSHA:     "prheadcommit",
+	}
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, nil, nil, "", "", "")
+	data, _, err := h.fetchConfig(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// the pull request head config must be ignored
+	if string(data) != "baseconfig" {
+		t.Fatalf("expected base branch config, got %q", data)
+	}
+}
+
+func TestHeadConfigDiverged(t *testing.T) {
+	configFiles := configFilePaths()
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		diverged bool
+	}{
+		{
+			name:  "test same config",
+			files: map[string]string{configFiles[0]: "baseconfig"},
+		},
+		{
+			name:     "test changed config",
+			files:    map[string]string{configFiles[0]: "headconfig"},
+			diverged: true,
+		},
+		{
+			name:     "test higher priority config file added",
+			files:    map[string]string{configFiles[0]: "headconfig", configFiles[1]: "baseconfig"},
+			diverged: true,
+		},
+		{
+			name:     "test removed config",
+			files:    map[string]string{},
+			diverged: true,
+		},
+	}
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, nil, nil, "", "", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &CreateRunRequest{
+				GitSource: &fakeRepoGitSource{files: map[string]map[string]string{"prheadcommit": tt.files}},
+				RepoPath:  "org/repo",
+				CommitSHA: "prheadcommit",
+			}
+			if diverged := h.headConfigDiverged(req, []byte("baseconfig")); diverged != tt.diverged {
+				t.Fatalf("expected diverged %t, got %t", tt.diverged, diverged)
+			}
+		})
+	}
+}
+
+func TestGetRunProvenance(t *testing.T) {
+	cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&csapitypes.Project{Project: &cstypes.Project{ID: "project01"}, OwnerType: cstypes.ConfigTypeUser, OwnerID: "user01", GlobalVisibility: cstypes.VisibilityPublic})
+	}))
+	defer cs.Close()
+
+	rs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1alpha/runs/run01":
+			_ = json.NewEncoder(w).Encode(&rsapitypes.RunResponse{
+				Run:       &rstypes.Run{ID: "run01"},
+				RunConfig: &rstypes.RunConfig{ID: "run01", Group: "/project/project01"},
+			})
+		case "/api/v1alpha/runs/run01/provenance":
+			_ = json.NewEncoder(w).Encode(&rsapitypes.RunProvenanceResponse{PayloadType: "application/vnd.in-toto+json"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer rs.Close()
+
+	h := NewActionHandler(zap.NewNop(), nil, nil, csclient.NewClient(cs.URL), rsclient.NewClient(rs.URL), "", "", "")
+
+	tests := []struct {
+		name   string
+		userID string
+		err    bool
+	}{
+		{
+			name:   "test project owner",
+			userID: "user01",
+		},
+		{
+			name:   "test user able to only read the run of a public project",
+			userID: "user02",
+			err:    true,
+		},
+		{
+			name: "test anonymous user",
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.userID != "" {
+				ctx = context.WithValue(ctx, "userid", tt.userID)
+			}
+
+			provenance, err := h.GetRunProvenance(ctx, "run01")
+			if tt.err {
+				if !util.IsForbidden(err) {
+					t.Fatalf("expected forbidden error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if provenance.PayloadType != "application/vnd.in-toto+json" {
+				t.Fatalf("unexpected provenance payload type %q", provenance.PayloadType)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+)
+
+// RunConfigSource reports from where the run config used to create the runs
+// at a specific ref is read. The run config is read from the project
+// repository at the run commit, so the config file of the provided ref is
+// used, not the one of the repository default branch. When the project
+// defines a config repository the run config is read from the head of the
+// config repository branch.
+type RunConfigSource struct {
+	RepositoryPath string
+	CommitSHA      string
+	Branch         string
+	Tag            string
+	Ref            string
+
+	// ConfigRepository reports that the run config is read from the project
+	// config repository
+	ConfigRepository     bool
+	ConfigRepositoryPath string
+	ConfigRef            string
+	ConfigCommitSHA      string
+
+	// ConfigPath is the repository path of the config file that will be used.
+	// It's empty when no config file exists at the commit.
+	ConfigPath string
+	// CandidatePaths are the config file paths looked up in priority order
+	CandidatePaths []string
+}
+
+// ProjectRunConfigSource reports from where the run config of the project
+// runs created at the provided ref (and commit) is read without evaluating
+// it.
+func (h *ActionHandler) ProjectRunConfigSource(ctx context.Context, projectRef, branch, tag, refName, commitSHA string) (*RunConfigSource, error) {
+	req, err := h.genProjectRunRequest(ctx, projectRef, branch, tag, refName, commitSHA)
+	if err != nil {
+		return nil, err
+	}
+
+	gitSource, configRepoPath, configRef, configCommitSHA, err := h.runConfigRepository(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RunConfigSource{
+		RepositoryPath:       req.RepoPath,
+		CommitSHA:            req.CommitSHA,
+		Branch:               req.Branch,
+		Tag:                  req.Tag,
+		Ref:                  req.Ref,
+		ConfigRepository:     req.Project.ConfigRepository != nil,
+		ConfigRepositoryPath: configRepoPath,
+		ConfigRef:            configRef,
+		ConfigCommitSHA:      configCommitSHA,
+		CandidatePaths:       configFilePaths(),
+	}
+
+	for _, p := range res.CandidatePaths {
+		if _, err := gitSource.GetFile(configRepoPath, configCommitSHA, p); err != nil {
+			h.log.Debugf("config file %q not available at commit %q: %v", p, configCommitSHA, err)
+			continue
+		}
+		res.ConfigPath = p
+		break
+	}
+
+	return res, nil
+}
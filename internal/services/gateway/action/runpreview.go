@@ -0,0 +1,127 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/config"
+	"agola.io/agola/internal/runconfig"
+	"agola.io/agola/internal/util"
+	rstypes "agola.io/agola/services/runservice/types"
+	"agola.io/agola/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// RunPreview is the resolved structure of the runs that would be created at a
+// specific commit
+type RunPreview struct {
+	CommitSHA string
+	Branch    string
+	Tag       string
+	Ref       string
+
+	Runs []*RunPreviewRun
+}
+
+type RunPreviewRun struct {
+	Name string
+
+	// Skip reports that the run won't be created. SkipReason reports why.
+	Skip       bool
+	SkipReason string
+
+	SetupErrors []string
+
+	Tasks map[string]*rstypes.RunConfigTask
+}
+
+func (h *ActionHandler) ProjectPreviewRun(ctx context.Context, projectRef, branch, tag, refName, commitSHA string) (*RunPreview, error) {
+	req, err := h.genProjectRunRequest(ctx, projectRef, branch, tag, refName, commitSHA)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.PreviewRuns(ctx, req)
+}
+
+// PreviewRuns evaluates the run config like CreateRuns but, instead of creating
+// the runs, it returns their resolved structure. The variables aren't
+// generated to not expose the secrets referenced by them.
+func (h *ActionHandler) PreviewRuns(ctx context.Context, req *CreateRunRequest) (*RunPreview, error) {
+	data, configFormat, err := h.fetchConfig(ctx, req)
+	if err != nil {
+		if errors.Is(err, errNoConfigFile) {
+			return nil, util.NewErrInternal(err)
+		}
+		return nil, err
+	}
+
+	res := &RunPreview{
+		CommitSHA: req.CommitSHA,
+		Branch:    req.Branch,
+		Tag:       req.Tag,
+		Ref:       req.Ref,
+		Runs:      []*RunPreviewRun{},
+	}
+
+	c, err := config.ParseConfig(data, configFormat, genConfigContext(req))
+	if err != nil {
+		// like CreateRuns report a generic run with the setup error
+		res.Runs = append(res.Runs, &RunPreviewRun{
+			Name:        rstypes.RunGenericSetupErrorName,
+			SetupErrors: []string{err.Error()},
+		})
+		return res, nil
+	}
+
+	untrusted := h.isUntrustedRun(req)
+
+	for _, run := range c.Runs {
+		rp := &RunPreviewRun{
+			Name:        run.Name,
+			SetupErrors: []string{},
+		}
+		res.Runs = append(res.Runs, rp)
+
+		if SkipRunMessage.MatchString(req.Message) {
+			rp.Skip = true
+			rp.SkipReason = "commit message contains the skip run marker"
+			continue
+		}
+		if match := types.MatchWhen(run.When.ToWhen(), req.RefType, req.Branch, req.Tag, req.Ref); !match {
+			rp.Skip = true
+			rp.SkipReason = "run when conditions don't match"
+			continue
+		}
+
+		rcts := runconfig.GenRunConfigTasks(util.DefaultUUIDGenerator{}, c, run.Name, map[string]string{}, req.RefType, req.Branch, req.Tag, req.Ref)
+		if err := setRunConfigTasks(rcts, req, untrusted); err != nil {
+			rp.SetupErrors = append(rp.SetupErrors, err.Error())
+		}
+
+		// do the same checks done by the runservice at run creation
+		if err := runconfig.CheckRunConfigTasks(rcts); err != nil {
+			rp.SetupErrors = append(rp.SetupErrors, err.Error())
+		} else if err := runconfig.GenTasksLevels(rcts); err != nil {
+			rp.SetupErrors = append(rp.SetupErrors, err.Error())
+		}
+
+		rp.Tasks = rcts
+	}
+
+	return res, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// runWatchRefreshInterval is the interval between two fetches of a watched
+	// run. Task status transitions don't generate run events, so a running run
+	// is also periodically refreshed.
+	runWatchRefreshInterval = 5 * time.Second
+
+	runEventsReconnectInterval = 2 * time.Second
+)
+
+// runEventsBroker notifies the run watchers of the received run events
+type runEventsBroker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+}
+
+func newRunEventsBroker() *runEventsBroker {
+	return &runEventsBroker{subscribers: map[string]map[chan struct{}]struct{}{}}
+}
+
+func (b *runEventsBroker) subscribe(runID string) (<-chan struct{}, func()) {
+	// buffered so a notification is kept while the subscriber is busy
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[runID]; !ok {
+		b.subscribers[runID] = map[chan struct{}]struct{}{}
+	}
+	b.subscribers[runID][ch] = struct{}{}
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[runID], ch)
+		if len(b.subscribers[runID]) == 0 {
+			delete(b.subscribers, runID)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+func (b *runEventsBroker) notify(runID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[runID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// HandleRunEvents consumes the runservice run events stream notifying the run
+// watchers. It reconnects to the stream until the context is done.
+func (h *ActionHandler) HandleRunEvents(ctx context.Context) {
+	for {
+		if err := h.handleRunEvents(ctx); err != nil {
+			h.log.Errorf("failed to handle run events: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(runEventsReconnectInterval):
+		}
+	}
+}
+
+func (h *ActionHandler) handleRunEvents(ctx context.Context) error {
+	resp, err := h.runserviceClient.GetRunEvents(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("http status code: %d", resp.StatusCode)
+	}
+
+	br := bufio.NewReader(resp.Body)
+	stop := false
+
+	var buf bytes.Buffer
+	for {
+		if stop {
+			return nil
+		}
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			if len(line) == 0 {
+				return nil
+			}
+			stop = true
+		}
+		switch {
+		case bytes.HasPrefix(line, []byte("data: ")):
+			buf.Write(line[6:])
+		case bytes.Equal(line, []byte("\n")):
+			data := buf.Bytes()
+			buf.Reset()
+
+			var ev *rstypes.RunEvent
+			if err := json.Unmarshal(data, &ev); err != nil {
+				return err
+			}
+			h.runEvents.notify(ev.RunID)
+
+		default:
+			return errors.Errorf("wrong data")
+		}
+	}
+}
+
+// WatchRun calls the provided function with the current run and then every
+// time the run is refreshed until the run is finished, the context is done or
+// the function returns an error.
+// The run ref is resolved like in GetRun so it can also be a project run number
+// ref.
+//
+// The run is refreshed when a run event for it is received and periodically
+// while it's not finished.
+func (h *ActionHandler) WatchRun(ctx context.Context, runRef string, f func(*rsapitypes.RunResponse) error) error {
+	// resolve the run ref and check the permissions
+	runResp, err := h.GetRun(ctx, runRef)
+	if err != nil {
+		return err
+	}
+	runID := runResp.Run.ID
+
+	// subscribe and then fetch again the run to not lose any event
+	evCh, unsubscribe := h.runEvents.subscribe(runID)
+	defer unsubscribe()
+
+	runResp, resp, err := h.runserviceClient.GetRun(ctx, runID, nil)
+	if err != nil {
+		return ErrFromRemote(resp, err)
+	}
+	if err := f(runResp); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(runWatchRefreshInterval)
+	defer ticker.Stop()
+
+	for !runResp.Run.Phase.IsFinished() {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-evCh:
+		case <-ticker.C:
+		}
+
+		runResp, resp, err = h.runserviceClient.GetRun(ctx, runID, nil)
+		if err != nil {
+			return ErrFromRemote(resp, err)
+		}
+		if err := f(runResp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/util"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+func (h *ActionHandler) GetSchedulingStatus(ctx context.Context) (*rsapitypes.SchedulingStatusResponse, error) {
+	status, resp, err := h.runserviceClient.GetSchedulingStatus(ctx)
+	if err != nil {
+		return nil, ErrFromRemote(resp, err)
+	}
+
+	return status, nil
+}
+
+func (h *ActionHandler) PauseScheduling(ctx context.Context, reason string) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	req := &rsapitypes.SchedulingPauseRequest{
+		Reason: reason,
+	}
+	resp, err := h.runserviceClient.PauseScheduling(ctx, req)
+	if err != nil {
+		return ErrFromRemote(resp, err)
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) ResumeScheduling(ctx context.Context) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	resp, err := h.runserviceClient.ResumeScheduling(ctx)
+	if err != nil {
+		return ErrFromRemote(resp, err)
+	}
+
+	return nil
+}
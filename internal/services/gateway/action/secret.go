@@ -17,6 +17,8 @@ package action
 import (
 	"context"
 	"net/http"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/util"
@@ -56,6 +58,104 @@ func (h *ActionHandler) GetSecrets(ctx context.Context, req *GetSecretsRequest)
 	return cssecrets, nil
 }
 
+type SecretScope string
+
+const (
+	SecretScopeProject      SecretScope = "project"
+	SecretScopeProjectGroup SecretScope = "projectgroup"
+	SecretScopeOrg          SecretScope = "org"
+	SecretScopeUser         SecretScope = "user"
+)
+
+// SecretAudit contains the secret metadata used for auditing. It doesn't
+// contain the secret data.
+type SecretAudit struct {
+	ID         string
+	Name       string
+	Type       cstypes.SecretType
+	ParentPath string
+	Scope      SecretScope
+
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UpdaterUserID   string
+	UpdaterUserName string
+}
+
+// GetSecretsAudit returns the metadata of all the secrets defined in the
+// parent and in all its parent project groups (including the overridden ones).
+// The secrets data is never returned, also to the admin user.
+func (h *ActionHandler) GetSecretsAudit(ctx context.Context, parentType cstypes.ConfigType, parentRef string) ([]*SecretAudit, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, parentType, parentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	cssecrets, err := h.GetSecrets(ctx, &GetSecretsRequest{ParentType: parentType, ParentRef: parentRef, Tree: true})
+	if err != nil {
+		return nil, err
+	}
+
+	userNames := map[string]string{}
+	secrets := make([]*SecretAudit, len(cssecrets))
+	for i, s := range cssecrets {
+		sa := &SecretAudit{
+			ID:            s.ID,
+			Name:          s.Name,
+			Type:          s.Type,
+			ParentPath:    s.ParentPath,
+			Scope:         secretScope(s),
+			CreatedAt:     s.CreatedAt,
+			UpdatedAt:     s.UpdatedAt,
+			UpdaterUserID: s.UpdaterUserID,
+		}
+
+		if s.UpdaterUserID != "" {
+			userName, ok := userNames[s.UpdaterUserID]
+			if !ok {
+				user, resp, err := h.configstoreClient.GetUser(ctx, s.UpdaterUserID)
+				if err != nil {
+					// the user could have been removed
+					if resp == nil || resp.StatusCode != http.StatusNotFound {
+						return nil, errors.Errorf("failed to get user %q: %w", s.UpdaterUserID, ErrFromRemote(resp, err))
+					}
+				} else {
+					userName = user.Name
+				}
+				userNames[s.UpdaterUserID] = userName
+			}
+			sa.UpdaterUserName = userName
+		}
+
+		secrets[i] = sa
+	}
+
+	return secrets, nil
+}
+
+// secretScope returns where a secret is defined. Secrets defined in the root
+// project group of an organization or user have org or user scope.
+func secretScope(s *csapitypes.Secret) SecretScope {
+	if s.Parent.Type == cstypes.ConfigTypeProject {
+		return SecretScopeProject
+	}
+
+	pathParts := strings.Split(s.ParentPath, "/")
+	if len(pathParts) == 2 {
+		switch cstypes.ConfigType(pathParts[0]) {
+		case cstypes.ConfigTypeOrg:
+			return SecretScopeOrg
+		case cstypes.ConfigTypeUser:
+			return SecretScopeUser
+		}
+	}
+
+	return SecretScopeProjectGroup
+}
+
 type CreateSecretRequest struct {
 	Name string
 
@@ -70,6 +170,8 @@ type CreateSecretRequest struct {
 	// external secret
 	SecretProviderID string
 	Path             string
+
+	ForkSafe bool
 }
 
 func (h *ActionHandler) CreateSecret(ctx context.Context, req *CreateSecretRequest) (*csapitypes.Secret, error) {
@@ -86,9 +188,11 @@ func (h *ActionHandler) CreateSecret(ctx context.Context, req *CreateSecretReque
 	}
 
 	s := &cstypes.Secret{
-		Name: req.Name,
-		Type: req.Type,
-		Data: req.Data,
+		Name:          req.Name,
+		Type:          req.Type,
+		Data:          req.Data,
+		ForkSafe:      req.ForkSafe,
+		UpdaterUserID: h.CurrentUserID(ctx),
 	}
 
 	var resp *http.Response
@@ -125,6 +229,8 @@ type UpdateSecretRequest struct {
 	// external secret
 	SecretProviderID string
 	Path             string
+
+	ForkSafe bool
 }
 
 func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretRequest) (*csapitypes.Secret, error) {
@@ -141,9 +247,11 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 	}
 
 	s := &cstypes.Secret{
-		Name: req.Name,
-		Type: req.Type,
-		Data: req.Data,
+		Name:          req.Name,
+		Type:          req.Type,
+		Data:          req.Data,
+		ForkSafe:      req.ForkSafe,
+		UpdaterUserID: h.CurrentUserID(ctx),
 	}
 
 	var resp *http.Response
@@ -164,7 +272,9 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 	return rs, nil
 }
 
-func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string) error {
+// DeleteSecret deletes the secret. When failIfUsed is true the deletion is
+// refused if the secret has been used by recent project runs.
+func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string, failIfUsed bool) error {
 	isVariableOwner, err := h.IsVariableOwner(ctx, parentType, parentRef)
 	if err != nil {
 		return errors.Errorf("failed to determine ownership: %w", err)
@@ -173,6 +283,16 @@ func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType cstypes.Con
 		return util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
+	if failIfUsed {
+		usages, err := h.getSecretUsages(ctx, parentType, parentRef, name)
+		if err != nil {
+			return err
+		}
+		if err := checkConfigRecentlyUsed("secret", name, usages); err != nil {
+			return err
+		}
+	}
+
 	var resp *http.Response
 	switch parentType {
 	case cstypes.ConfigTypeProjectGroup:
@@ -187,3 +307,58 @@ func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType cstypes.Con
 	}
 	return nil
 }
+
+type SetSecretsRequest struct {
+	ParentType cstypes.ConfigType
+	ParentRef  string
+
+	Secrets []*CreateSecretRequest
+
+	Prune bool
+}
+
+func (h *ActionHandler) SetSecrets(ctx context.Context, req *SetSecretsRequest) ([]*csapitypes.SetResult, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, req.ParentType, req.ParentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	userID := h.CurrentUserID(ctx)
+	secrets := make([]*cstypes.Secret, len(req.Secrets))
+	for i, s := range req.Secrets {
+		if !util.ValidateName(s.Name) {
+			return nil, util.NewErrBadRequest(errors.Errorf("invalid secret name %q", s.Name))
+		}
+		secrets[i] = &cstypes.Secret{
+			Name:          s.Name,
+			Type:          s.Type,
+			Data:          s.Data,
+			ForkSafe:      s.ForkSafe,
+			UpdaterUserID: userID,
+		}
+	}
+
+	csreq := &csapitypes.SetSecretsRequest{
+		Secrets: secrets,
+		Prune:   req.Prune,
+	}
+
+	var resp *http.Response
+	var results []*csapitypes.SetResult
+	switch req.ParentType {
+	case cstypes.ConfigTypeProjectGroup:
+		h.log.Infof("setting project group secrets")
+		results, resp, err = h.configstoreClient.SetProjectGroupSecrets(ctx, req.ParentRef, csreq)
+	case cstypes.ConfigTypeProject:
+		h.log.Infof("setting project secrets")
+		results, resp, err = h.configstoreClient.SetProjectSecrets(ctx, req.ParentRef, csreq)
+	}
+	if err != nil {
+		return nil, errors.Errorf("failed to set secrets: %w", ErrFromRemote(resp, err))
+	}
+
+	return results, nil
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,17 +35,6 @@ import (
 	errors "golang.org/x/xerrors"
 )
 
-const (
-	expireTimeRange time.Duration = 5 * time.Minute
-)
-
-func isAccessTokenExpired(expiresAt time.Time) bool {
-	if expiresAt.IsZero() {
-		return false
-	}
-	return expiresAt.Add(-expireTimeRange).Before(time.Now())
-}
-
 func (h *ActionHandler) GetUser(ctx context.Context, userRef string) (*cstypes.User, error) {
 	if !h.IsUserLoggedOrAdmin(ctx) {
 		return nil, errors.Errorf("user not logged in")
@@ -241,6 +231,7 @@ func (h *ActionHandler) UpdateUserLA(ctx context.Context, userRef string, la *cs
 		Oauth2AccessToken:          la.Oauth2AccessToken,
 		Oauth2RefreshToken:         la.Oauth2RefreshToken,
 		Oauth2AccessTokenExpiresAt: la.Oauth2AccessTokenExpiresAt,
+		NeedsReauth:                la.NeedsReauth,
 	}
 
 	h.log.Infof("updating user %q linked account", userRef)
@@ -254,31 +245,22 @@ func (h *ActionHandler) UpdateUserLA(ctx context.Context, userRef string, la *cs
 }
 
 // RefreshLinkedAccount refreshed the linked account oauth2 access token and update linked account in the configstore
+// When the remote source rejects the refresh token the linked account is marked
+// as needing re-authentication and a forbidden error is returned.
 func (h *ActionHandler) RefreshLinkedAccount(ctx context.Context, rs *cstypes.RemoteSource, userName string, la *cstypes.LinkedAccount) (*cstypes.LinkedAccount, error) {
-	switch rs.AuthType {
-	case cstypes.RemoteSourceAuthTypeOauth2:
-		// refresh access token if expired
-		if isAccessTokenExpired(la.Oauth2AccessTokenExpiresAt) {
-			userSource, err := common.GetOauth2Source(rs, "")
-			if err != nil {
-				return nil, err
-			}
-			token, err := userSource.RefreshOauth2Token(la.Oauth2RefreshToken)
-			if err != nil {
-				return nil, err
-			}
-
-			if la.Oauth2AccessToken != token.AccessToken {
-				la.Oauth2AccessToken = token.AccessToken
-				la.Oauth2RefreshToken = token.RefreshToken
-				la.Oauth2AccessTokenExpiresAt = token.Expiry
-
-				if err := h.UpdateUserLA(ctx, userName, la); err != nil {
-					return nil, errors.Errorf("failed to update linked account: %w", err)
-				}
-			}
+	changed, rerr := common.RefreshLinkedAccount(rs, la)
+	if changed {
+		if err := h.UpdateUserLA(ctx, userName, la); err != nil {
+			return nil, errors.Errorf("failed to update linked account: %w", err)
 		}
 	}
+	if rerr != nil {
+		if la.NeedsReauth {
+			h.log.Warnf("user %q: %v", userName, rerr)
+			return nil, util.NewErrForbidden(rerr)
+		}
+		return nil, rerr
+	}
 	return la, nil
 }
 
@@ -413,13 +395,18 @@ func (h *ActionHandler) LoginUser(ctx context.Context, req *LoginUserRequest) (*
 	}
 
 	// Update oauth tokens if they have changed since the getuserinfo request may have updated them
+	// Also clear the needs re-authentication state since the user just
+	// authenticated with the remote source
 	if la.Oauth2AccessToken != req.Oauth2AccessToken ||
 		la.Oauth2RefreshToken != req.Oauth2RefreshToken ||
-		la.UserAccessToken != req.UserAccessToken {
+		la.UserAccessToken != req.UserAccessToken ||
+		la.NeedsReauth {
 
 		la.Oauth2AccessToken = req.Oauth2AccessToken
 		la.Oauth2RefreshToken = req.Oauth2RefreshToken
+		la.Oauth2AccessTokenExpiresAt = req.Oauth2AccessTokenExpiresAt
 		la.UserAccessToken = req.UserAccessToken
+		la.NeedsReauth = false
 
 		creq := &csapitypes.UpdateUserLARequest{
 			RemoteUserID:               la.RemoteUserID,
@@ -438,8 +425,16 @@ func (h *ActionHandler) LoginUser(ctx context.Context, req *LoginUserRequest) (*
 		h.log.Infof("linked account %q for user %q updated", la.ID, user.Name)
 	}
 
+	sresp, resp, err := h.configstoreClient.CreateUserSession(ctx, user.ID, &csapitypes.CreateUserSessionRequest{
+		IdleTimeout:     h.session.IdleTimeout,
+		AbsoluteTimeout: h.session.AbsoluteTimeout,
+	})
+	if err != nil {
+		return nil, errors.Errorf("failed to create user session: %w", ErrFromRemote(resp, err))
+	}
+
 	// generate jwt token
-	token, err := common.GenerateLoginJWTToken(h.sd, user.ID)
+	token, err := common.GenerateLoginJWTToken(h.sd, user.ID, sresp.SessionID, h.session.AbsoluteTimeout)
 	if err != nil {
 		return nil, err
 	}
@@ -449,6 +444,21 @@ func (h *ActionHandler) LoginUser(ctx context.Context, req *LoginUserRequest) (*
 	}, nil
 }
 
+// Logout invalidates the web session used to authenticate the request
+func (h *ActionHandler) Logout(ctx context.Context) error {
+	userID := h.CurrentUserID(ctx)
+	sessionID := h.CurrentSessionID(ctx)
+	if userID == "" || sessionID == "" {
+		return util.NewErrBadRequest(errors.Errorf("request not authenticated with a user session"))
+	}
+
+	resp, err := h.configstoreClient.DeleteUserSession(ctx, userID, sessionID)
+	if err != nil {
+		return errors.Errorf("failed to delete user session: %w", ErrFromRemote(resp, err))
+	}
+	return nil
+}
+
 type AuthorizeRequest struct {
 	RemoteSourceName           string
 	UserAccessToken            string
@@ -794,7 +804,7 @@ func (h *ActionHandler) DeleteUserToken(ctx context.Context, userRef, tokenName
 		return errors.Errorf("user not logged in")
 	}
 
-	isAdmin := !h.IsUserAdmin(ctx)
+	isAdmin := h.IsUserAdmin(ctx)
 	curUserID := h.CurrentUserID(ctx)
 
 	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
@@ -802,7 +812,7 @@ func (h *ActionHandler) DeleteUserToken(ctx context.Context, userRef, tokenName
 		return errors.Errorf("failed to get user %q: %w", userRef, ErrFromRemote(resp, err))
 	}
 
-	// only admin or the same logged user can create a token
+	// only admin or the same logged user can delete a token
 	if !isAdmin && user.ID != curUserID {
 		return util.NewErrBadRequest(errors.Errorf("logged in user cannot delete token for another user"))
 	}
@@ -814,6 +824,46 @@ func (h *ActionHandler) DeleteUserToken(ctx context.Context, userRef, tokenName
 	return nil
 }
 
+type UserToken struct {
+	Name         string
+	CreationTime *time.Time
+	LastUsedTime *time.Time
+}
+
+// GetUserTokens returns the user tokens metadata sorted by name. The tokens
+// values are never returned.
+func (h *ActionHandler) GetUserTokens(ctx context.Context, userRef string) ([]*UserToken, error) {
+	if !h.IsUserLoggedOrAdmin(ctx) {
+		return nil, errors.Errorf("user not logged in")
+	}
+
+	isAdmin := h.IsUserAdmin(ctx)
+	curUserID := h.CurrentUserID(ctx)
+
+	user, resp, err := h.configstoreClient.GetUser(ctx, userRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get user %q: %w", userRef, ErrFromRemote(resp, err))
+	}
+
+	// only admin or the same logged user can list the tokens
+	if !isAdmin && user.ID != curUserID {
+		return nil, util.NewErrForbidden(errors.Errorf("logged in user cannot list tokens of another user"))
+	}
+
+	tokens := make([]*UserToken, 0, len(user.Tokens))
+	for tokenName := range user.Tokens {
+		token := &UserToken{Name: tokenName}
+		if tokenInfo, ok := user.TokensInfo[tokenName]; ok {
+			token.CreationTime = tokenInfo.CreationTime
+			token.LastUsedTime = tokenInfo.LastUsedTime
+		}
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+
+	return tokens, nil
+}
+
 type UserCreateRunRequest struct {
 	RepoUUID  string
 	RepoPath  string
@@ -825,6 +875,7 @@ type UserCreateRunRequest struct {
 
 	PullRequestRefRegexes []string
 	Variables             map[string]string
+	RunTags               []string
 }
 
 func (h *ActionHandler) UserCreateRun(ctx context.Context, req *UserCreateRunRequest) error {
@@ -943,7 +994,9 @@ func (h *ActionHandler) UserCreateRun(ctx context.Context, req *UserCreateRunReq
 
 		UserRunRepoUUID: req.RepoUUID,
 		Variables:       req.Variables,
+		RunTags:         req.RunTags,
 	}
 
-	return h.CreateRuns(ctx, creq)
+	_, err = h.CreateRuns(ctx, creq)
+	return err
 }
@@ -214,7 +214,9 @@ func (h *ActionHandler) UpdateVariable(ctx context.Context, req *UpdateVariableR
 	return rv, cssecrets, nil
 }
 
-func (h *ActionHandler) DeleteVariable(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string) error {
+// DeleteVariable deletes the variable. When failIfUsed is true the deletion is
+// refused if the variable has been used by recent project runs.
+func (h *ActionHandler) DeleteVariable(ctx context.Context, parentType cstypes.ConfigType, parentRef, name string, failIfUsed bool) error {
 	isVariableOwner, err := h.IsVariableOwner(ctx, parentType, parentRef)
 	if err != nil {
 		return errors.Errorf("failed to determine ownership: %w", err)
@@ -223,6 +225,16 @@ func (h *ActionHandler) DeleteVariable(ctx context.Context, parentType cstypes.C
 		return util.NewErrForbidden(errors.Errorf("user not authorized"))
 	}
 
+	if failIfUsed {
+		usages, err := h.getVariableUsages(ctx, parentType, parentRef, name)
+		if err != nil {
+			return err
+		}
+		if err := checkConfigRecentlyUsed("variable", name, usages); err != nil {
+			return err
+		}
+	}
+
 	var resp *http.Response
 	switch parentType {
 	case cstypes.ConfigTypeProjectGroup:
@@ -237,3 +249,57 @@ func (h *ActionHandler) DeleteVariable(ctx context.Context, parentType cstypes.C
 	}
 	return nil
 }
+
+type SetVariablesRequest struct {
+	ParentType cstypes.ConfigType
+	ParentRef  string
+
+	Variables []*CreateVariableRequest
+
+	Prune bool
+}
+
+func (h *ActionHandler) SetVariables(ctx context.Context, req *SetVariablesRequest) ([]*csapitypes.SetResult, error) {
+	isVariableOwner, err := h.IsVariableOwner(ctx, req.ParentType, req.ParentRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to determine ownership: %w", err)
+	}
+	if !isVariableOwner {
+		return nil, util.NewErrForbidden(errors.Errorf("user not authorized"))
+	}
+
+	variables := make([]*cstypes.Variable, len(req.Variables))
+	for i, v := range req.Variables {
+		if !util.ValidateName(v.Name) {
+			return nil, util.NewErrBadRequest(errors.Errorf("invalid variable name %q", v.Name))
+		}
+		if len(v.Values) == 0 {
+			return nil, util.NewErrBadRequest(errors.Errorf("empty variable %q values", v.Name))
+		}
+		variables[i] = &cstypes.Variable{
+			Name:   v.Name,
+			Values: v.Values,
+		}
+	}
+
+	csreq := &csapitypes.SetVariablesRequest{
+		Variables: variables,
+		Prune:     req.Prune,
+	}
+
+	var resp *http.Response
+	var results []*csapitypes.SetResult
+	switch req.ParentType {
+	case cstypes.ConfigTypeProjectGroup:
+		h.log.Infof("setting project group variables")
+		results, resp, err = h.configstoreClient.SetProjectGroupVariables(ctx, req.ParentRef, csreq)
+	case cstypes.ConfigTypeProject:
+		h.log.Infof("setting project variables")
+		results, resp, err = h.configstoreClient.SetProjectVariables(ctx, req.ParentRef, csreq)
+	}
+	if err != nil {
+		return nil, errors.Errorf("failed to set variables: %w", ErrFromRemote(resp, err))
+	}
+
+	return results, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/util"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// GetProjectWebhookDeliveries returns the last recorded webhook deliveries of
+// a project, newest first. Deliveries contain the raw webhook headers and
+// payload so they're only available to admins
+func (h *ActionHandler) GetProjectWebhookDeliveries(ctx context.Context, projectRef string, limit int) ([]*rstypes.WebhookDelivery, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	deliveries, resp, err := h.runserviceClient.GetWebhookDeliveries(ctx, p.ID, limit)
+	if err != nil {
+		return nil, errors.Errorf("failed to get webhook deliveries: %w", ErrFromRemote(resp, err))
+	}
+
+	return deliveries, nil
+}
+
+func (h *ActionHandler) GetProjectWebhookDelivery(ctx context.Context, projectRef, deliveryID string) (*rstypes.WebhookDelivery, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewErrForbidden(errors.Errorf("user not admin"))
+	}
+
+	p, resp, err := h.configstoreClient.GetProject(ctx, projectRef)
+	if err != nil {
+		return nil, errors.Errorf("failed to get project %q: %w", projectRef, ErrFromRemote(resp, err))
+	}
+
+	delivery, resp, err := h.runserviceClient.GetWebhookDelivery(ctx, p.ID, deliveryID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get webhook delivery %q: %w", deliveryID, ErrFromRemote(resp, err))
+	}
+
+	return delivery, nil
+}
@@ -21,47 +21,60 @@ import (
 
 	util "agola.io/agola/internal/util"
 	cstypes "agola.io/agola/services/configstore/types"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
 
 	"github.com/gorilla/mux"
 	errors "golang.org/x/xerrors"
 )
 
-type ErrorResponse struct {
-	Message string `json:"message"`
-}
-
-func ErrorResponseFromError(err error) *ErrorResponse {
+// ErrorResponseFromError returns the api error response of err. Only the
+// messages of the errors of the known types are reported, the other errors are
+// reported as a generic internal error to not leak the real error.
+func ErrorResponseFromError(err error) *gwapitypes.ErrorResponse {
 	var aerr error
+	var code gwapitypes.ErrorCode
 	// use inner errors if of these types
 	switch {
 	case util.IsBadRequest(err):
 		var cerr *util.ErrBadRequest
 		errors.As(err, &cerr)
 		aerr = cerr
+		code = gwapitypes.ErrorCodeBadRequest
 	case util.IsNotExist(err):
 		var cerr *util.ErrNotExist
 		errors.As(err, &cerr)
 		aerr = cerr
+		code = gwapitypes.ErrorCodeNotFound
 	case util.IsForbidden(err):
 		var cerr *util.ErrForbidden
 		errors.As(err, &cerr)
 		aerr = cerr
+		code = gwapitypes.ErrorCodeForbidden
 	case util.IsUnauthorized(err):
 		var cerr *util.ErrUnauthorized
 		errors.As(err, &cerr)
 		aerr = cerr
+		code = gwapitypes.ErrorCodeUnauthorized
 	case util.IsInternal(err):
 		var cerr *util.ErrInternal
 		errors.As(err, &cerr)
 		aerr = cerr
+		code = gwapitypes.ErrorCodeInternal
 	}
 
-	if aerr != nil {
-		return &ErrorResponse{Message: aerr.Error()}
+	if aerr == nil {
+		// on generic error return an generic message to not leak the real error
+		return &gwapitypes.ErrorResponse{Code: gwapitypes.ErrorCodeInternal, Message: "internal server error"}
 	}
 
-	// on generic error return an generic message to not leak the real error
-	return &ErrorResponse{Message: "internal server error"}
+	res := &gwapitypes.ErrorResponse{Code: code, Message: aerr.Error()}
+	var errs *util.Errors
+	if errors.As(aerr, &errs) {
+		for _, e := range errs.Errs {
+			res.Details = append(res.Details, e.Error())
+		}
+	}
+	return res
 }
 
 func httpError(w http.ResponseWriter, err error) bool {
@@ -70,32 +83,19 @@ func httpError(w http.ResponseWriter, err error) bool {
 	}
 
 	response := ErrorResponseFromError(err)
+	writeErrorResponse(w, gwapitypes.ErrorCodeStatus(response.Code), response)
+	return true
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, response *gwapitypes.ErrorResponse) {
 	resj, merr := json.Marshal(response)
 	if merr != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		return true
+		return
 	}
-	switch {
-	case util.IsBadRequest(err):
-		w.WriteHeader(http.StatusBadRequest)
-		_, _ = w.Write(resj)
-	case util.IsNotExist(err):
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = w.Write(resj)
-	case util.IsForbidden(err):
-		w.WriteHeader(http.StatusForbidden)
-		_, _ = w.Write(resj)
-	case util.IsUnauthorized(err):
-		w.WriteHeader(http.StatusUnauthorized)
-		_, _ = w.Write(resj)
-	case util.IsInternal(err):
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write(resj)
-	default:
-		w.WriteHeader(http.StatusInternalServerError)
-		_, _ = w.Write(resj)
-	}
-	return true
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(resj)
 }
 
 func httpResponse(w http.ResponseWriter, code int, res interface{}) error {
@@ -119,21 +119,13 @@ func httpResponse(w http.ResponseWriter, code int, res interface{}) error {
 func httpErrorFromRemote(w http.ResponseWriter, resp *http.Response, err error) bool {
 	if err != nil {
 		// on generic error return an generic message to not leak the real error
-		response := &ErrorResponse{Message: "internal server error"}
-		if resp != nil {
-			response = &ErrorResponse{Message: err.Error()}
-		}
-		resj, merr := json.Marshal(response)
-		if merr != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return true
-		}
+		status := http.StatusInternalServerError
+		response := &gwapitypes.ErrorResponse{Code: gwapitypes.ErrorCodeInternal, Message: "internal server error"}
 		if resp != nil {
-			w.WriteHeader(resp.StatusCode)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+			status = resp.StatusCode
+			response = &gwapitypes.ErrorResponse{Code: gwapitypes.ErrorCodeFromStatus(resp.StatusCode), Message: err.Error()}
 		}
-		_, _ = w.Write(resj)
+		writeErrorResponse(w, status, response)
 		return true
 	}
 	return false
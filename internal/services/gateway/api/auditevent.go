@@ -0,0 +1,117 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+func createAuditEventResponse(e *cstypes.AuditEvent) *gwapitypes.AuditEventResponse {
+	return &gwapitypes.AuditEventResponse{
+		ID:         e.ID,
+		Time:       e.Time,
+		ActorType:  string(e.ActorType),
+		ActorID:    e.ActorID,
+		ActorName:  e.ActorName,
+		Action:     e.Action,
+		Resource:   e.Resource,
+		StatusCode: e.StatusCode,
+	}
+}
+
+func parseQueryTime(q url.Values, name string) (*time.Time, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("cannot parse %s: %w", name, err))
+	}
+	return &t, nil
+}
+
+type AuditEventsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewAuditEventsHandler(logger *zap.Logger, ah *action.ActionHandler) *AuditEventsHandler {
+	return &AuditEventsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *AuditEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	req := &action.GetAuditEventsRequest{
+		Actor:    q.Get("actor"),
+		Action:   q.Get("action"),
+		Resource: q.Get("resource"),
+		Start:    q.Get("start"),
+	}
+
+	if limitS := q.Get("limit"); limitS != "" {
+		var err error
+		req.Limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if req.Limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if _, ok := q["asc"]; ok {
+		req.Asc = true
+	}
+
+	var err error
+	req.Since, err = parseQueryTime(q, "since")
+	if httpError(w, err) {
+		return
+	}
+	req.Until, err = parseQueryTime(q, "until")
+	if httpError(w, err) {
+		return
+	}
+
+	auditEvents, err := h.ah.GetAuditEvents(ctx, req)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*gwapitypes.AuditEventResponse, len(auditEvents))
+	for i, e := range auditEvents {
+		res[i] = createAuditEventResponse(e)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
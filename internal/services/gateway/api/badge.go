@@ -15,8 +15,12 @@
 package api
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/util"
@@ -24,6 +28,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// badgeMaxAge is the time a public project badge could be cached
+const badgeMaxAge = 60 * time.Second
+
 type BadgeHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -51,11 +58,18 @@ func (h *BadgeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// TODO(sgotti) return some caching headers
+	// the badges of public projects could be cached by shared caches (i.e.
+	// the image proxies used by the git sources to show the README images)
+	// for a short time while the other ones must be revalidated at every
+	// request. The ETag lets clients revalidate them without refetching the
+	// badge when the run status didn't change.
 	w.Header().Set("Content-Type", "image/svg+xml")
-	w.Header().Set("Cache-Control", "no-cache")
-
-	if _, err := w.Write([]byte(badge)); err != nil {
-		h.log.Errorf("err: %+v", err)
+	if badge.Public {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(badgeMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
 	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(badge.SVG))))
+
+	http.ServeContent(w, r, "", time.Time{}, strings.NewReader(badge.SVG))
 }
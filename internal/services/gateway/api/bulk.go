@@ -0,0 +1,140 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func createBulkOperationResponse(r *action.BulkOperationResponse) *gwapitypes.BulkOperationResponse {
+	res := &gwapitypes.BulkOperationResponse{
+		Items: make([]*gwapitypes.BulkOperationItemResponse, len(r.Items)),
+	}
+	for i, item := range r.Items {
+		ritem := &gwapitypes.BulkOperationItemResponse{
+			ProjectID:   item.ProjectID,
+			ProjectPath: item.ProjectPath,
+			RunID:       item.RunID,
+			RunIDs:      item.RunIDs,
+		}
+		if item.Err != nil {
+			ritem.Error = ErrorResponseFromError(item.Err).Message
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+		res.Items[i] = ritem
+	}
+
+	return res
+}
+
+type BulkRunActionsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewBulkRunActionsHandler(logger *zap.Logger, ah *action.ActionHandler) *BulkRunActionsHandler {
+	return &BulkRunActionsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *BulkRunActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req gwapitypes.BulkRunActionsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.BulkRunActionsRequest{
+		ProjectGroupRef: projectGroupRef,
+		ActionType:      action.RunActionType(req.ActionType),
+		Tags:            req.Tags,
+	}
+
+	ares, err := h.ah.BulkRunActions(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createBulkOperationResponse(ares)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type BulkCreateRunsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewBulkCreateRunsHandler(logger *zap.Logger, ah *action.ActionHandler) *BulkCreateRunsHandler {
+	return &BulkCreateRunsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *BulkCreateRunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectGroupRef, err := url.PathUnescape(vars["projectgroupref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req gwapitypes.BulkCreateRunsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.BulkCreateRunsRequest{
+		ProjectGroupRef: projectGroupRef,
+		Branch:          req.Branch,
+		Tag:             req.Tag,
+		Ref:             req.Ref,
+		RunSelectors:    req.RunSelectors,
+		RunTags:         req.RunTags,
+	}
+
+	ares, err := h.ah.BulkCreateRuns(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createBulkOperationResponse(ares)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
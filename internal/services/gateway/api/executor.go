@@ -0,0 +1,115 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// executorNotAliveInterval is the interval after which an executor that
+// didn't send its status is considered not alive. It's the same interval used
+// by the runservice scheduler.
+const executorNotAliveInterval = 60 * time.Second
+
+func createExecutorResponse(e *rstypes.Executor) *gwapitypes.ExecutorResponse {
+	res := &gwapitypes.ExecutorResponse{
+		ID:                        e.ID,
+		ListenURL:                 e.ListenURL,
+		OS:                        string(e.OS),
+		Archs:                     make([]string, len(e.Archs)),
+		Labels:                    e.Labels,
+		AllowPrivilegedContainers: e.AllowPrivilegedContainers,
+		GPUs:                      make([]*gwapitypes.ExecutorGPUsResponse, len(e.GPUs)),
+		ActiveTasksLimit:          e.ActiveTasksLimit,
+		ActiveTasks:               e.ActiveTasks,
+		Utilization:               e.Utilization,
+		Draining:                  e.Draining,
+		Dynamic:                   e.Dynamic,
+		ExecutorGroup:             e.ExecutorGroup,
+		Alive:                     time.Since(e.LastStatusUpdateTime) <= executorNotAliveInterval,
+	}
+	for i, a := range e.Archs {
+		res.Archs[i] = string(a)
+	}
+	for i, g := range e.GPUs {
+		res.GPUs[i] = &gwapitypes.ExecutorGPUsResponse{Type: g.Type, Count: g.Count}
+	}
+	if !e.LastStatusUpdateTime.IsZero() {
+		res.LastStatusUpdateTime = util.TimeP(e.LastStatusUpdateTime)
+	}
+	return res
+}
+
+type ExecutorsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewExecutorsHandler(logger *zap.Logger, ah *action.ActionHandler) *ExecutorsHandler {
+	return &ExecutorsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ExecutorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	executors, err := h.ah.GetExecutors(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*gwapitypes.ExecutorResponse, len(executors))
+	for i, e := range executors {
+		res[i] = createExecutorResponse(e)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteExecutorHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteExecutorHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteExecutorHandler {
+	return &DeleteExecutorHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteExecutorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	executorID := vars["executorid"]
+
+	err := h.ah.DeleteExecutor(ctx, executorID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/services/gateway/action"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+
+	"go.uber.org/zap"
+)
+
+func createFsckResponse(r *csapitypes.FsckResponse) *gwapitypes.FsckResponse {
+	res := &gwapitypes.FsckResponse{Problems: make([]*gwapitypes.FsckProblem, len(r.Problems))}
+	for i, p := range r.Problems {
+		res.Problems[i] = &gwapitypes.FsckProblem{
+			ObjectType:  string(p.ObjectType),
+			ObjectID:    p.ObjectID,
+			Description: p.Description,
+			Repairable:  p.Repairable,
+			Repaired:    p.Repaired,
+		}
+	}
+	return res
+}
+
+type FsckHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewFsckHandler(logger *zap.Logger, ah *action.ActionHandler) *FsckHandler {
+	return &FsckHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *FsckHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// GET only checks, POST also repairs
+	repair := r.Method == "POST"
+
+	fsckResponse, err := h.ah.Fsck(ctx, repair)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createFsckResponse(fsckResponse)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -17,6 +17,7 @@ package api
 import (
 	"net/http"
 
+	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/util"
 	gwapitypes "agola.io/agola/services/gateway/api/types"
@@ -25,12 +26,13 @@ import (
 )
 
 type OAuth2CallbackHandler struct {
-	log *zap.SugaredLogger
-	ah  *action.ActionHandler
+	log     *zap.SugaredLogger
+	ah      *action.ActionHandler
+	session *common.SessionConfig
 }
 
-func NewOAuth2CallbackHandler(logger *zap.Logger, ah *action.ActionHandler) *OAuth2CallbackHandler {
-	return &OAuth2CallbackHandler{log: logger.Sugar(), ah: ah}
+func NewOAuth2CallbackHandler(logger *zap.Logger, ah *action.ActionHandler, session *common.SessionConfig) *OAuth2CallbackHandler {
+	return &OAuth2CallbackHandler{log: logger.Sugar(), ah: ah, session: session}
 }
 
 func (h *OAuth2CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -62,6 +64,7 @@ func (h *OAuth2CallbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 
 	case action.RemoteSourceRequestTypeLoginUser:
 		authresp := cresp.Response.(*action.LoginUserResponse)
+		http.SetCookie(w, h.session.Cookie(authresp.Token))
 		response = &gwapitypes.LoginUserResponse{
 			Token: authresp.Token,
 			User:  createUserResponse(authresp.User),
@@ -0,0 +1,131 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/rsa"
+	"net/http"
+	"sync"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/util"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// OIDCDiscoveryPath and OIDCKeysPath are the paths, relative to the
+	// issuer, of the OIDC discovery document and keys
+	OIDCDiscoveryPath = "/.well-known/openid-configuration"
+	OIDCKeysPath      = "/.well-known/jwks.json"
+)
+
+// idTokenClaims are the claims of the tasks id tokens generated by the
+// runservice
+var idTokenClaims = []string{
+	"iss", "aud", "sub", "iat", "nbf", "exp", "jti",
+	"run_id", "run_counter", "run_group", "task_id", "task_name",
+	"project_id", "run_type", "ref_type", "ref", "branch", "tag", "pull_request_id", "commit_sha",
+	"trigger", "triggered_by",
+}
+
+// IDTokenPublicKeys are the published keys to verify the tasks id tokens. They
+// could be changed at any time to rotate the runservice signing key.
+type IDTokenPublicKeys struct {
+	keys []*rsa.PublicKey
+	m    sync.RWMutex
+}
+
+func (k *IDTokenPublicKeys) Set(keys []*rsa.PublicKey) {
+	k.m.Lock()
+	defer k.m.Unlock()
+	k.keys = keys
+}
+
+func (k *IDTokenPublicKeys) Get() []*rsa.PublicKey {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	return k.keys
+}
+
+// OIDCDiscoveryHandler serves the OIDC discovery document of the tasks id
+// tokens issuer
+type OIDCDiscoveryHandler struct {
+	log    *zap.SugaredLogger
+	issuer string
+	keys   *IDTokenPublicKeys
+}
+
+func NewOIDCDiscoveryHandler(logger *zap.Logger, issuer string, keys *IDTokenPublicKeys) *OIDCDiscoveryHandler {
+	return &OIDCDiscoveryHandler{log: logger.Sugar(), issuer: issuer, keys: keys}
+}
+
+func (h *OIDCDiscoveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(h.keys.Get()) == 0 {
+		httpError(w, util.NewErrNotExist(errors.Errorf("id tokens not enabled")))
+		return
+	}
+
+	res := &gwapitypes.OIDCDiscoveryResponse{
+		Issuer:                           h.issuer,
+		JWKSURI:                          h.issuer + OIDCKeysPath,
+		ResponseTypesSupported:           []string{"id_token"},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		ClaimsSupported:                  idTokenClaims,
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+// OIDCKeysHandler serves the JWKS with the keys to verify the tasks id tokens.
+// The key id is the one set by the runservice in the tokens header.
+type OIDCKeysHandler struct {
+	log  *zap.SugaredLogger
+	keys *IDTokenPublicKeys
+}
+
+func NewOIDCKeysHandler(logger *zap.Logger, keys *IDTokenPublicKeys) *OIDCKeysHandler {
+	return &OIDCKeysHandler{log: logger.Sugar(), keys: keys}
+}
+
+func (h *OIDCKeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	keys := h.keys.Get()
+	if len(keys) == 0 {
+		httpError(w, util.NewErrNotExist(errors.Errorf("id tokens not enabled")))
+		return
+	}
+
+	res := &gwapitypes.JWKSResponse{Keys: make([]*gwapitypes.JWKResponse, len(keys))}
+	for i, key := range keys {
+		n, e := common.RSAPublicKeyJWKParams(key)
+		res.Keys[i] = &gwapitypes.JWKResponse{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: "RS256",
+			Kid: common.IDTokenKeyID(key),
+			N:   n,
+			E:   e,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
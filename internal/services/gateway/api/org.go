@@ -129,6 +129,13 @@ func createOrgResponse(o *cstypes.Organization) *gwapitypes.OrgResponse {
 		Name:       o.Name,
 		Visibility: gwapitypes.Visibility(o.Visibility),
 	}
+	if o.SecretPolicy != nil {
+		org.SecretPolicy = &gwapitypes.SecretPolicy{
+			MinLength:         o.SecretPolicy.MinLength,
+			ForbiddenPatterns: o.SecretPolicy.ForbiddenPatterns,
+			RequiredPrefixes:  o.SecretPolicy.RequiredPrefixes,
+		}
+	}
 	return org
 }
 
@@ -274,6 +281,49 @@ func (h *AddOrgMemberHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+type SetOrgSecretPolicyHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSetOrgSecretPolicyHandler(logger *zap.Logger, ah *action.ActionHandler) *SetOrgSecretPolicyHandler {
+	return &SetOrgSecretPolicyHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SetOrgSecretPolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	vars := mux.Vars(r)
+	orgRef := vars["orgref"]
+
+	var req gwapitypes.SetOrgSecretPolicyRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var policy *cstypes.SecretPolicy
+	if req.SecretPolicy != nil {
+		policy = &cstypes.SecretPolicy{
+			MinLength:         req.SecretPolicy.MinLength,
+			ForbiddenPatterns: req.SecretPolicy.ForbiddenPatterns,
+			RequiredPrefixes:  req.SecretPolicy.RequiredPrefixes,
+		}
+	}
+
+	org, err := h.ah.SetOrgSecretPolicy(ctx, orgRef, policy)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createOrgResponse(org)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type RemoveOrgMemberHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -18,12 +18,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/url"
+	"path"
+	"sort"
 
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/util"
 	csapitypes "agola.io/agola/services/configstore/api/types"
 	cstypes "agola.io/agola/services/configstore/types"
 	gwapitypes "agola.io/agola/services/gateway/api/types"
+	rstypes "agola.io/agola/services/runservice/types"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -56,6 +59,12 @@ func (h *CreateProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		RemoteSourceName:    req.RemoteSourceName,
 		SkipSSHHostKeyCheck: req.SkipSSHHostKeyCheck,
 		PassVarsToForkedPR:  req.PassVarsToForkedPR,
+		NetworkPolicy:       req.NetworkPolicy,
+		SecurityProfile:     req.SecurityProfile,
+
+		UntrustedRunsNeedApproval: req.UntrustedRunsNeedApproval,
+		ConfigFromBaseBranch:      req.ConfigFromBaseBranch,
+		MaxStepLogSize:            req.MaxStepLogSize,
 	}
 
 	project, err := h.ah.CreateProject(ctx, areq)
@@ -106,6 +115,14 @@ func (h *UpdateProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		ParentRef:          req.ParentRef,
 		Visibility:         visibility,
 		PassVarsToForkedPR: req.PassVarsToForkedPR,
+		NetworkPolicy:      req.NetworkPolicy,
+		SecurityProfile:    req.SecurityProfile,
+
+		UntrustedRunsNeedApproval: req.UntrustedRunsNeedApproval,
+		ConfigFromBaseBranch:      req.ConfigFromBaseBranch,
+		MaxStepLogSize:            req.MaxStepLogSize,
+		WebhookRunSelectors:       req.WebhookRunSelectors,
+		RequiredRuns:              req.RequiredRuns,
 	}
 	project, err := h.ah.UpdateProject(ctx, projectRef, areq)
 	if httpError(w, err) {
@@ -146,6 +163,106 @@ func (h *ProjectReconfigHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+type ProjectRotateWebhookSecretHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRotateWebhookSecretHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRotateWebhookSecretHandler {
+	return &ProjectRotateWebhookSecretHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRotateWebhookSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	if err := h.ah.RotateProjectWebhookSecret(ctx, projectRef); err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateProjectAPIKeyHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateProjectAPIKeyHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateProjectAPIKeyHandler {
+	return &CreateProjectAPIKeyHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateProjectAPIKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req gwapitypes.CreateProjectAPIKeyRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.CreateProjectAPIKeyRequest{
+		ProjectRef: projectRef,
+		APIKeyName: req.APIKeyName,
+	}
+	apiKey, err := h.ah.CreateProjectAPIKey(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	resp := &gwapitypes.CreateProjectAPIKeyResponse{
+		APIKey: apiKey,
+	}
+	if err := httpResponse(w, http.StatusCreated, resp); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteProjectAPIKeyHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteProjectAPIKeyHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteProjectAPIKeyHandler {
+	return &DeleteProjectAPIKeyHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteProjectAPIKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	apiKeyName := vars["apikeyname"]
+
+	err = h.ah.DeleteProjectAPIKey(ctx, projectRef, apiKeyName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type ProjectUpdateRepoLinkedAccountHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -176,6 +293,194 @@ func (h *ProjectUpdateRepoLinkedAccountHandler) ServeHTTP(w http.ResponseWriter,
 	}
 }
 
+type ProjectSetConfigRepositoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectSetConfigRepositoryHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectSetConfigRepositoryHandler {
+	return &ProjectSetConfigRepositoryHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectSetConfigRepositoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req gwapitypes.SetProjectConfigRepositoryRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.SetProjectConfigRepositoryRequest{
+		RemoteSourceName: req.RemoteSourceName,
+		RepoPath:         req.RepoPath,
+		Branch:           req.Branch,
+	}
+	project, err := h.ah.ProjectSetConfigRepository(ctx, projectRef, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectRemoveConfigRepositoryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRemoveConfigRepositoryHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRemoveConfigRepositoryHandler {
+	return &ProjectRemoveConfigRepositoryHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRemoveConfigRepositoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	project, err := h.ah.ProjectRemoveConfigRepository(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectSetTriggerPolicyHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectSetTriggerPolicyHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectSetTriggerPolicyHandler {
+	return &ProjectSetTriggerPolicyHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectSetTriggerPolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var req gwapitypes.SetProjectTriggerPolicyRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.SetProjectTriggerPolicyRequest{
+		Branches:     cstypes.TriggerBranchesPolicy(req.Branches),
+		Tags:         req.Tags,
+		PullRequests: req.PullRequests,
+	}
+	project, err := h.ah.ProjectSetTriggerPolicy(ctx, projectRef, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectSetDeployEnvironmentHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectSetDeployEnvironmentHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectSetDeployEnvironmentHandler {
+	return &ProjectSetDeployEnvironmentHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectSetDeployEnvironmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	name := vars["deployenvironmentname"]
+
+	var req gwapitypes.SetProjectDeployEnvironmentRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.SetProjectDeployEnvironmentRequest{
+		Name:              name,
+		RequiredApprovals: req.RequiredApprovals,
+		Approvers:         req.Approvers,
+		Branches:          req.Branches,
+		WaitTimer:         req.WaitTimer,
+	}
+	project, err := h.ah.ProjectSetDeployEnvironment(ctx, projectRef, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectDeleteDeployEnvironmentHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectDeleteDeployEnvironmentHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectDeleteDeployEnvironmentHandler {
+	return &ProjectDeleteDeployEnvironmentHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectDeleteDeployEnvironmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	name := vars["deployenvironmentname"]
+
+	err = h.ah.ProjectDeleteDeployEnvironment(ctx, projectRef, name)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type DeleteProjectHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -235,6 +540,99 @@ func (h *ProjectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type ProjectPreviewEnvironmentsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectPreviewEnvironmentsHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectPreviewEnvironmentsHandler {
+	return &ProjectPreviewEnvironmentsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectPreviewEnvironmentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	envs, err := h.ah.GetProjectPreviewEnvironments(ctx, projectRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*gwapitypes.PreviewEnvironmentResponse, len(envs))
+	for i, env := range envs {
+		// the environment group is the pull request run group
+		// (/project/$projectid/pr/$prid)
+		prID, err := url.PathUnescape(path.Base(env.Group))
+		if err != nil {
+			prID = path.Base(env.Group)
+		}
+		res[i] = &gwapitypes.PreviewEnvironmentResponse{
+			Name:          env.Name,
+			PullRequestID: prID,
+			RunID:         env.RunID,
+			CreationTime:  env.CreationTime,
+			UpdateTime:    env.UpdateTime,
+		}
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectRequiredChecksHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRequiredChecksHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRequiredChecksHandler {
+	return &ProjectRequiredChecksHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRequiredChecksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	commitSHA := vars["commitsha"]
+
+	checks, err := h.ah.GetProjectRequiredChecks(ctx, projectRef, commitSHA)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &gwapitypes.RequiredChecksResponse{
+		CommitSHA: checks.CommitSHA,
+		Status:    string(checks.Status),
+		Checks:    make([]*gwapitypes.RequiredCheckResponse, len(checks.Checks)),
+	}
+	for i, check := range checks.Checks {
+		c := &gwapitypes.RequiredCheckResponse{
+			RunName: check.RunName,
+			Status:  string(check.Status),
+		}
+		if check.Run != nil {
+			c.RunID = check.Run.ID
+			c.RunCounter = check.Run.Counter
+			c.RunPhase = string(check.Run.Phase)
+			c.RunResult = string(check.Run.Result)
+		}
+		res.Checks[i] = c
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 func createProjectResponse(r *csapitypes.Project) *gwapitypes.ProjectResponse {
 	res := &gwapitypes.ProjectResponse{
 		ID:                 r.ID,
@@ -244,7 +642,40 @@ func createProjectResponse(r *csapitypes.Project) *gwapitypes.ProjectResponse {
 		Visibility:         gwapitypes.Visibility(r.Visibility),
 		GlobalVisibility:   string(r.GlobalVisibility),
 		PassVarsToForkedPR: r.PassVarsToForkedPR,
+		NetworkPolicy:      r.NetworkPolicy,
+		SecurityProfile:    r.SecurityProfile,
+
+		UntrustedRunsNeedApproval: r.UntrustedRunsNeedApproval,
+		ConfigFromBaseBranch:      r.ConfigFromBaseBranch,
+		MaxStepLogSize:            r.MaxStepLogSize,
+		WebhookRunSelectors:       r.WebhookRunSelectors,
+		RequiredRuns:              r.RequiredRuns,
+	}
+	if r.ConfigRepository != nil {
+		res.ConfigRepository = &gwapitypes.ProjectConfigRepositoryResponse{
+			RepositoryPath: r.ConfigRepository.RepositoryPath,
+			Branch:         r.ConfigRepository.Branch,
+		}
+	}
+	tp := r.EffectiveTriggerPolicy()
+	res.TriggerPolicy = &gwapitypes.ProjectTriggerPolicy{
+		Branches:     string(tp.Branches),
+		Tags:         tp.Tags,
+		PullRequests: tp.PullRequests,
+	}
+	for _, de := range r.DeployEnvironments {
+		res.DeployEnvironments = append(res.DeployEnvironments, &gwapitypes.ProjectDeployEnvironment{
+			Name:              de.Name,
+			RequiredApprovals: de.RequiredApprovals,
+			Approvers:         de.Approvers,
+			Branches:          de.Branches,
+			WaitTimer:         de.WaitTimer,
+		})
+	}
+	for apiKeyName := range r.APIKeys {
+		res.APIKeys = append(res.APIKeys, apiKeyName)
 	}
+	sort.Strings(res.APIKeys)
 
 	return res
 }
@@ -274,13 +705,187 @@ func (h *ProjectCreateRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = h.ah.ProjectCreateRun(ctx, projectRef, req.Branch, req.Tag, req.Ref, req.CommitSHA)
+	runIDs, err := h.ah.ProjectCreateRun(ctx, projectRef, req.Branch, req.Tag, req.Ref, req.CommitSHA, req.ExecutorID, req.RunSelectors, req.RunTags)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &gwapitypes.ProjectCreateRunResponse{RunIDs: runIDs}
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectPreviewRunHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectPreviewRunHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectPreviewRunHandler {
+	return &ProjectPreviewRunHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectPreviewRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	query := r.URL.Query()
+	branch := query.Get("branch")
+	tag := query.Get("tag")
+	ref := query.Get("ref")
+	commitSHA := query.Get("commit_sha")
+
+	preview, err := h.ah.ProjectPreviewRun(ctx, projectRef, branch, tag, ref, commitSHA)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createRunPreviewResponse(preview)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectRunConfigSourceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectRunConfigSourceHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectRunConfigSourceHandler {
+	return &ProjectRunConfigSourceHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectRunConfigSourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	query := r.URL.Query()
+	branch := query.Get("branch")
+	tag := query.Get("tag")
+	ref := query.Get("ref")
+	commitSHA := query.Get("commit_sha")
+
+	cs, err := h.ah.ProjectRunConfigSource(ctx, projectRef, branch, tag, ref, commitSHA)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
 	}
 
-	if err := httpResponse(w, http.StatusCreated, nil); err != nil {
+	res := &gwapitypes.RunConfigSourceResponse{
+		RepositoryPath: cs.RepositoryPath,
+		CommitSHA:      cs.CommitSHA,
+		Branch:         cs.Branch,
+		Tag:            cs.Tag,
+		Ref:            cs.Ref,
+
+		ConfigRepository:     cs.ConfigRepository,
+		ConfigRepositoryPath: cs.ConfigRepositoryPath,
+		ConfigRef:            cs.ConfigRef,
+		ConfigCommitSHA:      cs.ConfigCommitSHA,
+
+		ConfigPath:     cs.ConfigPath,
+		CandidatePaths: cs.CandidatePaths,
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
 }
+
+func createRunPreviewResponse(p *action.RunPreview) *gwapitypes.RunPreviewResponse {
+	res := &gwapitypes.RunPreviewResponse{
+		CommitSHA: p.CommitSHA,
+		Branch:    p.Branch,
+		Tag:       p.Tag,
+		Ref:       p.Ref,
+		Runs:      make([]*gwapitypes.RunPreviewRunResponse, len(p.Runs)),
+	}
+
+	for i, run := range p.Runs {
+		rr := &gwapitypes.RunPreviewRunResponse{
+			Name:        run.Name,
+			Skip:        run.Skip,
+			SkipReason:  run.SkipReason,
+			SetupErrors: run.SetupErrors,
+			Tasks:       make(map[string]*gwapitypes.RunPreviewTaskResponse),
+		}
+		for id, rct := range run.Tasks {
+			rr.Tasks[id] = createRunPreviewTaskResponse(rct)
+		}
+		res.Runs[i] = rr
+	}
+
+	return res
+}
+
+func createRunPreviewTaskResponse(rct *rstypes.RunConfigTask) *gwapitypes.RunPreviewTaskResponse {
+	t := &gwapitypes.RunPreviewTaskResponse{
+		ID:              rct.ID,
+		Name:            rct.Name,
+		Level:           rct.Level,
+		Depends:         rct.Depends,
+		Skip:            rct.Skip,
+		IgnoreFailure:   rct.IgnoreFailure,
+		NeedsApproval:   rct.NeedsApproval,
+		Always:          rct.Always,
+		NetworkPolicy:   rct.NetworkPolicy,
+		SecurityProfile: rct.SecurityProfile,
+		Arch:            string(rct.Runtime.Arch),
+		Images:          make([]string, len(rct.Runtime.Containers)),
+		Steps:           make([]*gwapitypes.RunPreviewTaskStepResponse, len(rct.Steps)),
+	}
+
+	for i, c := range rct.Runtime.Containers {
+		t.Images[i] = c.Image
+	}
+
+	for i, step := range rct.Steps {
+		s := &gwapitypes.RunPreviewTaskStepResponse{}
+		switch step := step.(type) {
+		case *rstypes.RunStep:
+			s.Type = "run"
+			s.Name = step.Name
+			s.Skip = step.Skip
+			s.AlwaysRun = step.AlwaysRun
+		case *rstypes.SaveToWorkspaceStep:
+			s.Type = "save_to_workspace"
+			s.Name = "save to workspace"
+			s.Skip = step.Skip
+			s.AlwaysRun = step.AlwaysRun
+		case *rstypes.RestoreWorkspaceStep:
+			s.Type = "restore_workspace"
+			s.Name = "restore workspace"
+			s.Skip = step.Skip
+			s.AlwaysRun = step.AlwaysRun
+		case *rstypes.SaveCacheStep:
+			s.Type = "save_cache"
+			s.Name = "save cache"
+			s.Skip = step.Skip
+			s.AlwaysRun = step.AlwaysRun
+		case *rstypes.RestoreCacheStep:
+			s.Type = "restore_cache"
+			s.Name = "restore cache"
+			s.Skip = step.Skip
+			s.AlwaysRun = step.AlwaysRun
+		case *rstypes.WaitBackgroundStep:
+			s.Type = "wait_background"
+			s.Name = step.Name
+			s.Skip = step.Skip
+			s.AlwaysRun = step.AlwaysRun
+		}
+		t.Steps[i] = s
+	}
+
+	return t
+}
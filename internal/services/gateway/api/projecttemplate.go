@@ -0,0 +1,325 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	"go.uber.org/zap"
+
+	"github.com/gorilla/mux"
+	errors "golang.org/x/xerrors"
+)
+
+func fromApiProjectTemplateSpec(s *gwapitypes.ProjectTemplateSpec) *cstypes.ProjectTemplateSpec {
+	spec := &cstypes.ProjectTemplateSpec{
+		Parameters:                make([]cstypes.ProjectTemplateParameter, len(s.Parameters)),
+		Visibility:                cstypes.Visibility(s.Visibility),
+		RemoteSourceName:          s.RemoteSourceName,
+		SkipSSHHostKeyCheck:       s.SkipSSHHostKeyCheck,
+		PassVarsToForkedPR:        s.PassVarsToForkedPR,
+		NetworkPolicy:             s.NetworkPolicy,
+		UntrustedRunsNeedApproval: s.UntrustedRunsNeedApproval,
+		MaxStepLogSize:            s.MaxStepLogSize,
+		Variables:                 make([]cstypes.ProjectTemplateVariable, len(s.Variables)),
+	}
+	for i, p := range s.Parameters {
+		spec.Parameters[i] = cstypes.ProjectTemplateParameter{
+			Name:        p.Name,
+			Description: p.Description,
+			Default:     p.Default,
+		}
+	}
+	for i, v := range s.Variables {
+		spec.Variables[i] = cstypes.ProjectTemplateVariable{
+			Name:   v.Name,
+			Values: fromApiVariableValues(v.Values),
+		}
+	}
+	return spec
+}
+
+func createProjectTemplateSpecResponse(s *cstypes.ProjectTemplateSpec) gwapitypes.ProjectTemplateSpec {
+	spec := gwapitypes.ProjectTemplateSpec{
+		Parameters:                make([]gwapitypes.ProjectTemplateParameter, len(s.Parameters)),
+		Visibility:                gwapitypes.Visibility(s.Visibility),
+		RemoteSourceName:          s.RemoteSourceName,
+		SkipSSHHostKeyCheck:       s.SkipSSHHostKeyCheck,
+		PassVarsToForkedPR:        s.PassVarsToForkedPR,
+		NetworkPolicy:             s.NetworkPolicy,
+		UntrustedRunsNeedApproval: s.UntrustedRunsNeedApproval,
+		MaxStepLogSize:            s.MaxStepLogSize,
+		Variables:                 make([]gwapitypes.ProjectTemplateVariable, len(s.Variables)),
+	}
+	for i, p := range s.Parameters {
+		spec.Parameters[i] = gwapitypes.ProjectTemplateParameter{
+			Name:        p.Name,
+			Description: p.Description,
+			Default:     p.Default,
+		}
+	}
+	for i, v := range s.Variables {
+		values := make([]gwapitypes.VariableValueRequest, len(v.Values))
+		for j, value := range v.Values {
+			values[j] = gwapitypes.VariableValueRequest{
+				SecretName: value.SecretName,
+				SecretVar:  value.SecretVar,
+				When:       value.When,
+			}
+		}
+		spec.Variables[i] = gwapitypes.ProjectTemplateVariable{
+			Name:   v.Name,
+			Values: values,
+		}
+	}
+	return spec
+}
+
+func createProjectTemplateResponse(pt *cstypes.ProjectTemplate) *gwapitypes.ProjectTemplateResponse {
+	res := &gwapitypes.ProjectTemplateResponse{
+		ID:        pt.ID,
+		Name:      pt.Name,
+		Revisions: make([]*gwapitypes.ProjectTemplateRevisionResponse, len(pt.Revisions)),
+	}
+	for i, r := range pt.Revisions {
+		res.Revisions[i] = &gwapitypes.ProjectTemplateRevisionResponse{
+			Revision:  r.Revision,
+			CreatedAt: r.CreatedAt,
+			Spec:      createProjectTemplateSpecResponse(&r.ProjectTemplateSpec),
+		}
+	}
+	return res
+}
+
+type ProjectTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectTemplateHandler {
+	return &ProjectTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectTemplateRef := vars["projecttemplateref"]
+
+	pt, err := h.ah.GetProjectTemplate(ctx, projectTemplateRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectTemplateResponse(pt)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type ProjectTemplatesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectTemplatesHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectTemplatesHandler {
+	return &ProjectTemplatesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectTemplatesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	limitS := query.Get("limit")
+	limit := DefaultRunsLimit
+	if limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+	if limit > MaxRunsLimit {
+		limit = MaxRunsLimit
+	}
+	asc := false
+	if _, ok := query["asc"]; ok {
+		asc = true
+	}
+
+	start := query.Get("start")
+
+	areq := &action.GetProjectTemplatesRequest{
+		Start: start,
+		Limit: limit,
+		Asc:   asc,
+	}
+	csProjectTemplates, err := h.ah.GetProjectTemplates(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	projectTemplates := make([]*gwapitypes.ProjectTemplateResponse, len(csProjectTemplates))
+	for i, pt := range csProjectTemplates {
+		projectTemplates[i] = createProjectTemplateResponse(pt)
+	}
+
+	if err := httpResponse(w, http.StatusOK, projectTemplates); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateProjectTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateProjectTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateProjectTemplateHandler {
+	return &CreateProjectTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req gwapitypes.CreateProjectTemplateRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	pt, err := h.ah.CreateProjectTemplate(ctx, req.Name, fromApiProjectTemplateSpec(&req.Spec))
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectTemplateResponse(pt)
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type UpdateProjectTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUpdateProjectTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *UpdateProjectTemplateHandler {
+	return &UpdateProjectTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UpdateProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectTemplateRef := vars["projecttemplateref"]
+
+	var req gwapitypes.UpdateProjectTemplateRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	pt, err := h.ah.UpdateProjectTemplate(ctx, projectTemplateRef, fromApiProjectTemplateSpec(&req.Spec))
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectTemplateResponse(pt)
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type DeleteProjectTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewDeleteProjectTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *DeleteProjectTemplateHandler {
+	return &DeleteProjectTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *DeleteProjectTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectTemplateRef := vars["projecttemplateref"]
+
+	err := h.ah.DeleteProjectTemplate(ctx, projectTemplateRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type CreateProjectFromTemplateHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewCreateProjectFromTemplateHandler(logger *zap.Logger, ah *action.ActionHandler) *CreateProjectFromTemplateHandler {
+	return &CreateProjectFromTemplateHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *CreateProjectFromTemplateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectTemplateRef := vars["projecttemplateref"]
+
+	var req gwapitypes.CreateProjectFromTemplateRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	areq := &action.CreateProjectFromTemplateRequest{
+		ProjectTemplateRef: projectTemplateRef,
+		Revision:           req.Revision,
+		Name:               req.Name,
+		ParentRef:          req.ParentRef,
+		RepoPath:           req.RepoPath,
+		RemoteSourceName:   req.RemoteSourceName,
+		Parameters:         req.Parameters,
+	}
+	project, err := h.ah.CreateProjectFromTemplate(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createProjectResponse(project)
+	if err := httpResponse(w, http.StatusCreated, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -18,7 +18,10 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/util"
@@ -36,17 +39,25 @@ func createRunResponse(r *rstypes.Run, rc *rstypes.RunConfig) *gwapitypes.RunRes
 		Counter:     r.Counter,
 		Name:        r.Name,
 		Annotations: r.Annotations,
+		Tags:        r.Tags,
 		Phase:       r.Phase,
 		Result:      r.Result,
 		Stopping:    r.Stop,
 		SetupErrors: rc.SetupErrors,
 
+		NoRunsReason: rc.NoRunsReason,
+
+		DependsOn:    r.DependsOn,
+		CancelReason: r.CancelReason,
+
 		Tasks:                make(map[string]*gwapitypes.RunResponseTask),
 		TasksWaitingApproval: r.TasksWaitingApproval(),
 
 		EnqueueTime: r.EnqueueTime,
 		StartTime:   r.StartTime,
 		EndTime:     r.EndTime,
+
+		Trigger: createRunTriggerResponse(r.Trigger),
 	}
 
 	run.CanRestartFromScratch, _ = r.CanRestartFromScratch()
@@ -73,6 +84,10 @@ func createRunResponseTask(r *rstypes.Run, rt *rstypes.RunTask, rct *rstypes.Run
 		Approved:            rt.Approved,
 		ApprovalAnnotations: rt.Annotations,
 
+		WaitingExecutorReason: rt.WaitingExecutorReason,
+
+		Reports: createRunTaskResponseReports(rt.Reports),
+
 		Level:   rct.Level,
 		Depends: rct.Depends,
 	}
@@ -80,6 +95,87 @@ func createRunResponseTask(r *rstypes.Run, rt *rstypes.RunTask, rct *rstypes.Run
 	return t
 }
 
+func createRunTaskResponseReports(summaries []*rstypes.ReportSummary) []*gwapitypes.RunTaskResponseReport {
+	if len(summaries) == 0 {
+		return nil
+	}
+	reports := make([]*gwapitypes.RunTaskResponseReport, len(summaries))
+	for i, s := range summaries {
+		reports[i] = &gwapitypes.RunTaskResponseReport{
+			Format:   s.Format,
+			Path:     s.Path,
+			Tests:    s.Tests,
+			Failures: s.Failures,
+			Errors:   s.Errors,
+			Skipped:  s.Skipped,
+			Coverage: s.Coverage,
+			Error:    s.Error,
+		}
+	}
+
+	return reports
+}
+
+func createRunTaskResponseResourceUsage(u *rstypes.ResourceUsage) *gwapitypes.RunTaskResponseResourceUsage {
+	if u == nil {
+		return nil
+	}
+	return &gwapitypes.RunTaskResponseResourceUsage{
+		CPUPeak:       u.CPUPeak,
+		CPUAverage:    u.CPUAverage,
+		MemoryPeak:    u.MemoryPeak,
+		MemoryAverage: u.MemoryAverage,
+	}
+}
+
+func createRunTaskResponseImagePull(p *rstypes.ImagePull) *gwapitypes.RunTaskResponseImagePull {
+	if p == nil {
+		return nil
+	}
+	return &gwapitypes.RunTaskResponseImagePull{
+		Image:        p.Image,
+		CacheHit:     p.CacheHit,
+		PulledBytes:  p.PulledBytes,
+		PulledLayers: p.PulledLayers,
+		CachedLayers: p.CachedLayers,
+		Duration:     p.Duration,
+		Digest:       p.Digest,
+	}
+}
+
+func createRunTaskResponseStepCache(c *rstypes.StepCache) *gwapitypes.RunTaskResponseStepCache {
+	if c == nil {
+		return nil
+	}
+	return &gwapitypes.RunTaskResponseStepCache{
+		Key:  c.Key,
+		Hit:  c.Hit,
+		Size: c.Size,
+	}
+}
+
+func createRunTaskResponseCacheUsage(rt *rstypes.RunTask) *gwapitypes.RunTaskResponseCacheUsage {
+	u := rt.CacheUsage()
+	return &gwapitypes.RunTaskResponseCacheUsage{
+		RestoreHits:   u.RestoreHits,
+		RestoreMisses: u.RestoreMisses,
+		RestoredBytes: u.RestoredBytes,
+		SavedBytes:    u.SavedBytes,
+		ArchivesSize:  u.ArchivesSize,
+	}
+}
+
+func createRunTaskResponseDebugHold(h *rstypes.TaskDebugHold) *gwapitypes.RunTaskResponseDebugHold {
+	if h == nil {
+		return nil
+	}
+	return &gwapitypes.RunTaskResponseDebugHold{
+		ExecutorID: h.ExecutorID,
+		PodID:      h.PodID,
+		Until:      h.Until,
+	}
+}
+
 func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *gwapitypes.RunTaskResponse {
 	t := &gwapitypes.RunTaskResponse{
 		ID:     rt.ID,
@@ -90,6 +186,24 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *gwa
 		Approved:            rt.Approved,
 		ApprovalAnnotations: rt.Annotations,
 
+		WaitingExecutorReason: rt.WaitingExecutorReason,
+
+		FailError: rt.FailError,
+
+		Reports: createRunTaskResponseReports(rt.Reports),
+
+		Outputs: rt.Outputs,
+
+		ResourceUsage: createRunTaskResponseResourceUsage(rt.ResourceUsage),
+
+		StopResult: rt.StopResult,
+
+		ImagePull: createRunTaskResponseImagePull(rt.ImagePull),
+
+		CacheUsage: createRunTaskResponseCacheUsage(rt),
+
+		DebugHold: createRunTaskResponseDebugHold(rt.DebugHold),
+
 		Steps: make([]*gwapitypes.RunTaskResponseStep, len(rt.Steps)),
 
 		StartTime: rt.StartTime,
@@ -105,9 +219,12 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *gwa
 
 	for i := 0; i < len(t.Steps); i++ {
 		s := &gwapitypes.RunTaskResponseStep{
-			Phase:     rt.Steps[i].Phase,
-			StartTime: rt.Steps[i].StartTime,
-			EndTime:   rt.Steps[i].EndTime,
+			Phase:         rt.Steps[i].Phase,
+			ResourceUsage: createRunTaskResponseResourceUsage(rt.Steps[i].ResourceUsage),
+			Cache:         createRunTaskResponseStepCache(rt.Steps[i].Cache),
+			ArchiveSize:   rt.Steps[i].ArchiveSize,
+			StartTime:     rt.Steps[i].StartTime,
+			EndTime:       rt.Steps[i].EndTime,
 		}
 		rcts := rct.Steps[i]
 		rts := rt.Steps[i]
@@ -122,12 +239,19 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *gwa
 			s.Name = rcts.Name
 			s.Command = rcts.Command
 
-			shell := rcts.Shell
-			if shell == "" {
-				shell = rct.Shell
+			if len(rcts.CommandArgs) > 0 {
+				// exec form commands aren't executed by a shell
+				s.Command = strings.Join(rcts.CommandArgs, " ")
+				s.CommandArgs = rcts.CommandArgs
+			} else {
+				shell := rcts.Shell
+				if shell == "" {
+					shell = rct.Shell
+				}
+				s.Shell = shell
 			}
-			s.Shell = shell
 
+			s.Background = rcts.Background
 			s.ExitStatus = rts.ExitStatus
 		case *rstypes.SaveToWorkspaceStep:
 			s.Type = "save_to_workspace"
@@ -141,6 +265,10 @@ func createRunTaskResponse(rt *rstypes.RunTask, rct *rstypes.RunConfigTask) *gwa
 		case *rstypes.RestoreCacheStep:
 			s.Type = "restore_cache"
 			s.Name = "restore cache"
+		case *rstypes.WaitBackgroundStep:
+			s.Type = "wait_background"
+			s.Name = rcts.Name
+			s.ExitStatus = rts.ExitStatus
 		}
 
 		t.Steps[i] = s
@@ -161,7 +289,11 @@ func NewRunHandler(logger *zap.Logger, ah *action.ActionHandler) *RunHandler {
 func (h *RunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
-	runID := vars["runid"]
+	runID, err := url.PathUnescape(vars["runid"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
 
 	runResp, err := h.ah.GetRun(ctx, runID)
 	if httpError(w, err) {
@@ -170,6 +302,18 @@ func (h *RunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := createRunResponse(runResp.Run, runResp.RunConfig)
+	if !runResp.Run.Phase.IsFinished() {
+		// just log the error since it's only informative
+		if status, err := h.ah.GetSchedulingStatus(ctx); err != nil {
+			h.log.Errorf("failed to get scheduling status: %+v", err)
+		} else {
+			res.SchedulingPaused = status.Paused
+		}
+	}
+	if qs := runResp.QueueStatus; qs != nil {
+		res.QueuePosition = qs.Position
+		res.QueueEstimatedStartTime = qs.EstimatedStartTime
+	}
 	if err := httpResponse(w, http.StatusOK, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
@@ -187,7 +331,11 @@ func NewRuntaskHandler(logger *zap.Logger, ah *action.ActionHandler) *RuntaskHan
 func (h *RuntaskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
-	runID := vars["runid"]
+	runID, err := url.PathUnescape(vars["runid"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
 	taskID := vars["taskid"]
 
 	runResp, err := h.ah.GetRun(ctx, runID)
@@ -223,6 +371,7 @@ func createRunsResponse(r *rstypes.Run) *gwapitypes.RunsResponse {
 		Counter:     r.Counter,
 		Name:        r.Name,
 		Annotations: r.Annotations,
+		Tags:        r.Tags,
 		Phase:       r.Phase,
 		Result:      r.Result,
 
@@ -231,11 +380,35 @@ func createRunsResponse(r *rstypes.Run) *gwapitypes.RunsResponse {
 		EnqueueTime: r.EnqueueTime,
 		StartTime:   r.StartTime,
 		EndTime:     r.EndTime,
+
+		Trigger: createRunTriggerResponse(r.Trigger),
 	}
 
 	return run
 }
 
+func createRunTriggerResponse(t *rstypes.RunTrigger) *gwapitypes.RunTriggerResponse {
+	if t == nil {
+		return nil
+	}
+
+	return &gwapitypes.RunTriggerResponse{
+		Type:        t.Type,
+		TriggeredBy: t.TriggeredBy,
+		CommitSHA:   t.CommitSHA,
+		Untrusted:   t.Untrusted,
+		ParentRunID: t.ParentRunID,
+		RootRunID:   t.RootRunID,
+		Attempt:     t.Attempt,
+
+		EnvironmentOverrides: t.EnvironmentOverrides,
+
+		CommitAuthorName:  t.CommitAuthorName,
+		CommitAuthorEmail: t.CommitAuthorEmail,
+		CommitMessage:     t.CommitMessage,
+	}
+}
+
 type RunsHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -260,6 +433,7 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	phaseFilter := q["phase"]
 	resultFilter := q["result"]
+	tagFilter := q["tag"]
 	changeGroups := q["changegroup"]
 	_, lastRun := q["lastrun"]
 
@@ -290,6 +464,7 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	areq := &action.GetRunsRequest{
 		PhaseFilter:  phaseFilter,
 		ResultFilter: resultFilter,
+		TagFilter:    tagFilter,
 		Group:        group,
 		LastRun:      lastRun,
 		ChangeGroups: changeGroups,
@@ -312,6 +487,204 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type RunStatsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunStatsHandler(logger *zap.Logger, ah *action.ActionHandler) *RunStatsHandler {
+	return &RunStatsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	q := r.URL.Query()
+
+	group := q.Get("group")
+	if group == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("no group specified")))
+		return
+	}
+
+	var start, end *time.Time
+	if startS := q.Get("start"); startS != "" {
+		t, err := time.Parse(time.RFC3339, startS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse start time: %w", err)))
+			return
+		}
+		start = &t
+	}
+	if endS := q.Get("end"); endS != "" {
+		t, err := time.Parse(time.RFC3339, endS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse end time: %w", err)))
+			return
+		}
+		end = &t
+	}
+	_, bySubgroup := q["bysubgroup"]
+
+	areq := &action.GetRunStatsRequest{
+		Group:      group,
+		Start:      start,
+		End:        end,
+		Bucket:     q.Get("bucket"),
+		BySubgroup: bySubgroup,
+	}
+	stats, err := h.ah.GetRunStats(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*gwapitypes.RunStatsResponse, len(stats))
+	for i, s := range stats {
+		res[i] = &gwapitypes.RunStatsResponse{
+			Group:          s.Group,
+			BucketStart:    s.BucketStart,
+			RunCount:       s.RunCount,
+			SuccessCount:   s.SuccessCount,
+			FailedCount:    s.FailedCount,
+			StoppedCount:   s.StoppedCount,
+			SuccessRate:    s.SuccessRate(),
+			MedianDuration: s.MedianDuration.Seconds(),
+
+			CacheRestoreHits:   s.CacheRestoreHits,
+			CacheRestoreMisses: s.CacheRestoreMisses,
+			CacheHitRate:       s.CacheHitRate(),
+			CacheRestoredBytes: s.CacheRestoredBytes,
+			CacheSavedBytes:    s.CacheSavedBytes,
+		}
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunConfigDiffHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunConfigDiffHandler(logger *zap.Logger, ah *action.ActionHandler) *RunConfigDiffHandler {
+	return &RunConfigDiffHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunConfigDiffHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+	otherRunID := vars["otherrunid"]
+
+	diff, err := h.ah.GetRunConfigDiff(ctx, runID, otherRunID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &gwapitypes.RunConfigDiffResponse{
+		RunID:         diff.RunID,
+		OtherRunID:    diff.OtherRunID,
+		ChangedFields: diff.ChangedFields,
+		AddedTasks:    diff.AddedTasks,
+		RemovedTasks:  diff.RemovedTasks,
+		ChangedTasks:  diff.ChangedTasks,
+		Diff:          diff.Diff,
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+// RunProvenanceHandler returns the signed SLSA provenance of a run as a DSSE
+// envelope. It's signed with the tasks id tokens signing key so it could be
+// verified using the keys published at the OIDC keys endpoint.
+type RunProvenanceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunProvenanceHandler(logger *zap.Logger, ah *action.ActionHandler) *RunProvenanceHandler {
+	return &RunProvenanceHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunProvenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID, err := url.PathUnescape(vars["runid"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	provenance, err := h.ah.GetRunProvenance(ctx, runID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &gwapitypes.RunProvenanceResponse{
+		PayloadType: provenance.PayloadType,
+		Payload:     provenance.Payload,
+		Signatures:  make([]*gwapitypes.RunProvenanceSignature, len(provenance.Signatures)),
+	}
+	for i, s := range provenance.Signatures {
+		res.Signatures[i] = &gwapitypes.RunProvenanceSignature{
+			KeyID: s.KeyID,
+			Sig:   s.Sig,
+		}
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunTaskEnvironmentHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunTaskEnvironmentHandler(logger *zap.Logger, ah *action.ActionHandler) *RunTaskEnvironmentHandler {
+	return &RunTaskEnvironmentHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunTaskEnvironmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID, err := url.PathUnescape(vars["runid"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	taskID := vars["taskid"]
+
+	env, err := h.ah.GetRunTaskEnvironment(ctx, runID, taskID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := &gwapitypes.RunTaskEnvironmentResponse{
+		RunID:       env.RunID,
+		TaskID:      env.TaskID,
+		TaskName:    env.TaskName,
+		Environment: env.Environment,
+		Steps:       make([]*gwapitypes.RunTaskStepEnvironmentResponse, len(env.Steps)),
+	}
+	for i, s := range env.Steps {
+		res.Steps[i] = &gwapitypes.RunTaskStepEnvironmentResponse{
+			Step:        s.Step,
+			Name:        s.Name,
+			Environment: s.Environment,
+		}
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type RunActionsHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -324,7 +697,11 @@ func NewRunActionsHandler(logger *zap.Logger, ah *action.ActionHandler) *RunActi
 func (h *RunActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
-	runID := vars["runid"]
+	runID, err := url.PathUnescape(vars["runid"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
 
 	var req gwapitypes.RunActionsRequest
 	d := json.NewDecoder(r.Body)
@@ -334,9 +711,13 @@ func (h *RunActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	areq := &action.RunActionsRequest{
-		RunID:      runID,
-		ActionType: action.RunActionType(req.ActionType),
-		FromStart:  req.FromStart,
+		RunID:       runID,
+		ActionType:  action.RunActionType(req.ActionType),
+		FromStart:   req.FromStart,
+		FromTask:    req.FromTask,
+		Environment: req.Environment,
+		DebugHold:   req.DebugHold,
+		Tags:        req.Tags,
 	}
 
 	runResp, err := h.ah.RunAction(ctx, areq)
@@ -363,7 +744,11 @@ func NewRunTaskActionsHandler(logger *zap.Logger, ah *action.ActionHandler) *Run
 func (h *RunTaskActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	vars := mux.Vars(r)
-	runID := vars["runid"]
+	runID, err := url.PathUnescape(vars["runid"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
 	taskID := vars["taskid"]
 
 	var req gwapitypes.RunTaskActionsRequest
@@ -379,7 +764,7 @@ func (h *RunTaskActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		ActionType: action.RunTaskActionType(req.ActionType),
 	}
 
-	err := h.ah.RunTaskAction(ctx, areq)
+	err = h.ah.RunTaskAction(ctx, areq)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
@@ -399,20 +784,29 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	q := r.URL.Query()
+	vars := mux.Vars(r)
 
 	runID := q.Get("runID")
+	taskID := q.Get("taskID")
+	_, setup := q["setup"]
+	stepStr := q.Get("step")
+	// the log could be also referenced by the stable path
+	// /runs/{runid}/tasks/{taskid}/logs/{setup,steps/{step}}
+	if vars["runid"] != "" {
+		runID = vars["runid"]
+		taskID = vars["taskid"]
+		stepStr = vars["step"]
+		setup = stepStr == ""
+	}
 	if runID == "" {
 		httpError(w, util.NewErrBadRequest(errors.Errorf("empty run id")))
 		return
 	}
-	taskID := q.Get("taskID")
 	if taskID == "" {
 		httpError(w, util.NewErrBadRequest(errors.Errorf("empty task id")))
 		return
 	}
 
-	_, setup := q["setup"]
-	stepStr := q.Get("step")
 	if !setup && stepStr == "" {
 		httpError(w, util.NewErrBadRequest(errors.Errorf("no setup or step number provided")))
 		return
@@ -437,12 +831,28 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		follow = true
 	}
 
+	var offset int64
+	if offsetStr := q.Get("offset"); offsetStr != "" {
+		var err error
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse offset: %w", err)))
+			return
+		}
+		if offset < 0 {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("offset must be greater or equal than 0")))
+			return
+		}
+	}
+
 	areq := &action.GetLogsRequest{
 		RunID:  runID,
 		TaskID: taskID,
 		Setup:  setup,
 		Step:   step,
 		Follow: follow,
+		Offset: offset,
+		Range:  r.Header.Get("Range"),
 	}
 
 	resp, err := h.ah.GetLogs(ctx, areq)
@@ -451,11 +861,22 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// forward the headers describing the returned (part of the) log
+	for _, k := range []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"} {
+		if v := resp.Header.Get(k); v != "" {
+			w.Header().Set(k, v)
+		}
+	}
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
 	// write and flush the headers so the client will receive the response
 	// header also if there're currently no lines to send
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(resp.StatusCode)
 	var flusher http.Flusher
 	if fl, ok := w.(http.Flusher); ok {
 		flusher = fl
@@ -0,0 +1,41 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// RunConfigSchemaHandler serves the json schema of the run config, useful to
+// validate the run config files with external tools
+type RunConfigSchemaHandler struct {
+	log    *zap.SugaredLogger
+	schema *config.JSONSchema
+}
+
+func NewRunConfigSchemaHandler(logger *zap.Logger) *RunConfigSchemaHandler {
+	// the schema is generated from the config types so it never changes
+	return &RunConfigSchemaHandler{log: logger.Sugar(), schema: config.Schema()}
+}
+
+func (h *RunConfigSchemaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := httpResponse(w, http.StatusOK, h.schema); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+func createRunExportRecord(r *rsapitypes.RunExportRecord) *gwapitypes.RunExportRecord {
+	record := &gwapitypes.RunExportRecord{
+		ID:              r.ID,
+		Name:            r.Name,
+		Group:           r.Group,
+		Counter:         r.Counter,
+		Result:          string(r.Result),
+		Annotations:     r.Annotations,
+		TriggerType:     r.TriggerType,
+		TriggeredBy:     r.TriggeredBy,
+		CommitSHA:       r.CommitSHA,
+		Attempt:         r.Attempt,
+		EnqueueTime:     r.EnqueueTime,
+		StartTime:       r.StartTime,
+		EndTime:         r.EndTime,
+		QueueDurationMs: r.QueueDurationMs,
+		DurationMs:      r.DurationMs,
+		Tasks:           make([]*gwapitypes.RunExportTask, len(r.Tasks)),
+		Watermark:       r.Watermark,
+	}
+	if groupType, groupID, err := common.GroupTypeIDFromRunGroup(r.Group); err == nil && groupType == common.GroupTypeProject {
+		record.ProjectID = groupID
+	}
+	for i, t := range r.Tasks {
+		record.Tasks[i] = &gwapitypes.RunExportTask{
+			ID:         t.ID,
+			Name:       t.Name,
+			Status:     string(t.Status),
+			StartTime:  t.StartTime,
+			EndTime:    t.EndTime,
+			DurationMs: t.DurationMs,
+		}
+	}
+	return record
+}
+
+type RunsExportHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunsExportHandler(logger *zap.Logger, ah *action.ActionHandler) *RunsExportHandler {
+	return &RunsExportHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *RunsExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	q := r.URL.Query()
+
+	group := q.Get("group")
+	if group == "" {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("no group specified")))
+		return
+	}
+
+	var start, end *time.Time
+	if startS := q.Get("start"); startS != "" {
+		t, err := time.Parse(time.RFC3339, startS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse start time: %w", err)))
+			return
+		}
+		start = &t
+	}
+	if endS := q.Get("end"); endS != "" {
+		t, err := time.Parse(time.RFC3339, endS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse end time: %w", err)))
+			return
+		}
+		end = &t
+	}
+
+	areq := &action.ExportRunsRequest{
+		Group:     group,
+		Start:     start,
+		End:       end,
+		Watermark: q.Get("watermark"),
+	}
+	resp, err := h.ah.ExportRuns(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	dec := json.NewDecoder(resp.Body)
+	enc := json.NewEncoder(w)
+	for {
+		var record *rsapitypes.RunExportRecord
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			return
+		}
+		if err == nil {
+			err = enc.Encode(createRunExportRecord(record))
+		}
+		if err != nil {
+			h.log.Errorf("err: %+v", err)
+			// since we already answered with a 200 we cannot return another error code
+			// So abort the connection and the client will detect the missing ending chunk
+			// and consider this an error
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
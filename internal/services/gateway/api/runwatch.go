@@ -0,0 +1,254 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	runWatchWriteTimeout = 10 * time.Second
+	runWatchPongTimeout  = 60 * time.Second
+	// runWatchPingInterval must be less than runWatchPongTimeout
+	runWatchPingInterval = 30 * time.Second
+)
+
+// RunWatchHandler pushes the run and its tasks status transitions to a
+// websocket client. An initial snapshot of the whole run is sent on connection
+// so clients can just reconnect and replace their state on connection errors.
+// The websocket is closed when the run is finished.
+//
+// Clients not able to use websockets can keep polling the run endpoint.
+type RunWatchHandler struct {
+	log      *zap.SugaredLogger
+	ah       *action.ActionHandler
+	upgrader *websocket.Upgrader
+}
+
+func NewRunWatchHandler(logger *zap.Logger, ah *action.ActionHandler, allowedOrigins []string) *RunWatchHandler {
+	return &RunWatchHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+		upgrader: &websocket.Upgrader{
+			CheckOrigin: runWatchCheckOrigin(allowedOrigins),
+		},
+	}
+}
+
+// runWatchCheckOrigin accepts requests without an origin, from the same host
+// or from one of the allowed origins (the same allowed for cors requests)
+func runWatchCheckOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+		if strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, o := range allowedOrigins {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (h *RunWatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the request context isn't canceled when the client disconnects from an
+	// hijacked connection, it's canceled by the websocket read loop
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	vars := mux.Vars(r)
+	runRef, err := url.PathUnescape(vars["runid"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	var conn *websocket.Conn
+	var upgradeFailed bool
+	var prevRun *gwapitypes.RunResponse
+
+	err = h.ah.WatchRun(ctx, runRef, func(runResp *rsapitypes.RunResponse) error {
+		run := createRunResponse(runResp.Run, runResp.RunConfig)
+
+		// upgrade the connection only after the first run fetch, so errors
+		// like a not existing run or a forbidden access are reported as
+		// http errors
+		if conn == nil {
+			var err error
+			conn, err = h.upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				// the upgrader already replied with an http error
+				upgradeFailed = true
+				return err
+			}
+			go h.readLoop(conn, cancel)
+			go h.pingLoop(ctx, conn)
+		}
+
+		for _, ev := range runWatchEvents(prevRun, run) {
+			if err := conn.SetWriteDeadline(time.Now().Add(runWatchWriteTimeout)); err != nil {
+				return err
+			}
+			if err := conn.WriteJSON(ev); err != nil {
+				return err
+			}
+		}
+		prevRun = run
+
+		return nil
+	})
+
+	if conn == nil {
+		if upgradeFailed {
+			h.log.Infof("failed to upgrade connection: %v", err)
+			return
+		}
+		if httpError(w, err) {
+			h.log.Errorf("err: %+v", err)
+		}
+		return
+	}
+	defer conn.Close()
+
+	closeCode := websocket.CloseNormalClosure
+	closeText := ""
+	if err != nil && ctx.Err() == nil {
+		h.log.Errorf("err: %+v", err)
+		closeCode = websocket.CloseInternalServerErr
+		closeText = "internal server error"
+	}
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(closeCode, closeText), time.Now().Add(runWatchWriteTimeout))
+}
+
+// readLoop reads the client messages to handle the control messages and
+// cancels the watch when the connection is closed or a pong isn't received in
+// time
+func (h *RunWatchHandler) readLoop(conn *websocket.Conn, cancel context.CancelFunc) {
+	defer cancel()
+
+	_ = conn.SetReadDeadline(time.Now().Add(runWatchPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(runWatchPongTimeout))
+	})
+	for {
+		// messages from the client are ignored
+		if _, _, err := conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+func (h *RunWatchHandler) pingLoop(ctx context.Context, conn *websocket.Conn) {
+	ticker := time.NewTicker(runWatchPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(runWatchWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// runWatchEvents returns the events describing the changes between the
+// previous and the current run. When there's no previous run a snapshot event
+// is returned.
+func runWatchEvents(prevRun, run *gwapitypes.RunResponse) []*gwapitypes.RunWatchEvent {
+	if prevRun == nil {
+		return []*gwapitypes.RunWatchEvent{
+			{
+				Type:  gwapitypes.RunWatchEventTypeSnapshot,
+				RunID: run.ID,
+				Run:   run,
+			},
+		}
+	}
+
+	events := []*gwapitypes.RunWatchEvent{}
+
+	// sort the tasks to send their events in a stable order
+	taskIDs := make([]string, 0, len(run.Tasks))
+	for id := range run.Tasks {
+		taskIDs = append(taskIDs, id)
+	}
+	sort.Strings(taskIDs)
+
+	for _, id := range taskIDs {
+		task := run.Tasks[id]
+		if reflect.DeepEqual(prevRun.Tasks[id], task) {
+			continue
+		}
+		events = append(events, &gwapitypes.RunWatchEvent{
+			Type:  gwapitypes.RunWatchEventTypeTaskStatus,
+			RunID: run.ID,
+			Task:  task,
+		})
+	}
+
+	// send the run status after the tasks status since a run status change
+	// is usually caused by the tasks status changes
+	prevRunStatus := createRunWatchRunStatus(prevRun)
+	runStatus := createRunWatchRunStatus(run)
+	if !reflect.DeepEqual(prevRunStatus, runStatus) {
+		events = append(events, &gwapitypes.RunWatchEvent{
+			Type:      gwapitypes.RunWatchEventTypeRunStatus,
+			RunID:     run.ID,
+			RunStatus: runStatus,
+		})
+	}
+
+	return events
+}
+
+func createRunWatchRunStatus(run *gwapitypes.RunResponse) *gwapitypes.RunWatchRunStatus {
+	return &gwapitypes.RunWatchRunStatus{
+		Phase:                     run.Phase,
+		Result:                    run.Result,
+		SetupErrors:               run.SetupErrors,
+		Stopping:                  run.Stopping,
+		TasksWaitingApproval:      run.TasksWaitingApproval,
+		StartTime:                 run.StartTime,
+		EndTime:                   run.EndTime,
+		CanRestartFromScratch:     run.CanRestartFromScratch,
+		CanRestartFromFailedTasks: run.CanRestartFromFailedTasks,
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	"go.uber.org/zap"
+)
+
+func createSchedulingStatusResponse(s *rsapitypes.SchedulingStatusResponse) *gwapitypes.SchedulingStatusResponse {
+	status := &gwapitypes.SchedulingStatusResponse{
+		Paused: s.Paused,
+		Window: s.Window,
+	}
+	if s.Pause != nil {
+		pausedAt := s.Pause.PausedAt
+		status.Reason = s.Pause.Reason
+		status.PausedAt = &pausedAt
+	}
+	return status
+}
+
+type SchedulingStatusHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSchedulingStatusHandler(logger *zap.Logger, ah *action.ActionHandler) *SchedulingStatusHandler {
+	return &SchedulingStatusHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SchedulingStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	status, err := h.ah.GetSchedulingStatus(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := createSchedulingStatusResponse(status)
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type SchedulingPauseHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSchedulingPauseHandler(logger *zap.Logger, ah *action.ActionHandler) *SchedulingPauseHandler {
+	return &SchedulingPauseHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SchedulingPauseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var err error
+	switch r.Method {
+	case "PUT":
+		var req gwapitypes.SchedulingPauseRequest
+		d := json.NewDecoder(r.Body)
+		if err := d.Decode(&req); err != nil {
+			httpError(w, util.NewErrBadRequest(err))
+			return
+		}
+		err = h.ah.PauseScheduling(ctx, req.Reason)
+	case "DELETE":
+		err = h.ah.ResumeScheduling(ctx)
+	}
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
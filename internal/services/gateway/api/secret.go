@@ -33,6 +33,7 @@ func createSecretResponse(s *csapitypes.Secret) *gwapitypes.SecretResponse {
 		ID:         s.ID,
 		Name:       s.Name,
 		ParentPath: s.ParentPath,
+		ForkSafe:   s.ForkSafe,
 	}
 }
 
@@ -79,6 +80,103 @@ func (h *SecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func createSecretAuditResponse(s *action.SecretAudit) *gwapitypes.SecretAuditResponse {
+	sa := &gwapitypes.SecretAuditResponse{
+		ID:              s.ID,
+		Name:            s.Name,
+		Type:            gwapitypes.SecretType(s.Type),
+		ParentPath:      s.ParentPath,
+		Scope:           string(s.Scope),
+		UpdaterUserID:   s.UpdaterUserID,
+		UpdaterUserName: s.UpdaterUserName,
+	}
+	// secrets created before these fields were introduced have zero times
+	if !s.CreatedAt.IsZero() {
+		sa.CreatedAt = util.TimeP(s.CreatedAt)
+	}
+	if !s.UpdatedAt.IsZero() {
+		sa.UpdatedAt = util.TimeP(s.UpdatedAt)
+	}
+	return sa
+}
+
+type SecretsAuditHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSecretsAuditHandler(logger *zap.Logger, ah *action.ActionHandler) *SecretsAuditHandler {
+	return &SecretsAuditHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SecretsAuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	assecrets, err := h.ah.GetSecretsAudit(ctx, parentType, parentRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	secrets := make([]*gwapitypes.SecretAuditResponse, len(assecrets))
+	for i, s := range assecrets {
+		secrets[i] = createSecretAuditResponse(s)
+	}
+
+	if err := httpResponse(w, http.StatusOK, secrets); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+func createConfigUsagesResponse(usages []*action.ConfigUsage) []*gwapitypes.ConfigUsageResponse {
+	res := make([]*gwapitypes.ConfigUsageResponse, len(usages))
+	for i, u := range usages {
+		res[i] = &gwapitypes.ConfigUsageResponse{
+			ProjectID:    u.ProjectID,
+			ProjectPath:  u.ProjectPath,
+			LastUsedTime: util.TimeP(u.LastUsedTime),
+		}
+	}
+	return res
+}
+
+type SecretUsagesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSecretUsagesHandler(logger *zap.Logger, ah *action.ActionHandler) *SecretUsagesHandler {
+	return &SecretUsagesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SecretUsagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	secretName := vars["secretname"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	usages, err := h.ah.GetSecretUsages(ctx, parentType, parentRef, secretName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createConfigUsagesResponse(usages)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type CreateSecretHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -110,6 +208,7 @@ func (h *CreateSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		Data:             req.Data,
 		SecretProviderID: req.SecretProviderID,
 		Path:             req.Path,
+		ForkSafe:         req.ForkSafe,
 	}
 	cssecret, err := h.ah.CreateSecret(ctx, areq)
 	if httpError(w, err) {
@@ -159,6 +258,7 @@ func (h *UpdateSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		Data:             req.Data,
 		SecretProviderID: req.SecretProviderID,
 		Path:             req.Path,
+		ForkSafe:         req.ForkSafe,
 	}
 	cssecret, err := h.ah.UpdateSecret(ctx, areq)
 	if httpError(w, err) {
@@ -191,7 +291,9 @@ func (h *DeleteSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = h.ah.DeleteSecret(ctx, parentType, parentRef, secretName)
+	_, failIfUsed := r.URL.Query()["failifused"]
+
+	err = h.ah.DeleteSecret(ctx, parentType, parentRef, secretName, failIfUsed)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
@@ -201,3 +303,65 @@ func (h *DeleteSecretHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		h.log.Errorf("err: %+v", err)
 	}
 }
+
+type SetSecretsHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSetSecretsHandler(logger *zap.Logger, ah *action.ActionHandler) *SetSecretsHandler {
+	return &SetSecretsHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SetSecretsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req gwapitypes.SetSecretsRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	secrets := make([]*action.CreateSecretRequest, len(req.Secrets))
+	for i, s := range req.Secrets {
+		secrets[i] = &action.CreateSecretRequest{
+			Name:             s.Name,
+			ParentType:       parentType,
+			ParentRef:        parentRef,
+			Type:             cstypes.SecretType(s.Type),
+			Data:             s.Data,
+			SecretProviderID: s.SecretProviderID,
+			Path:             s.Path,
+			ForkSafe:         s.ForkSafe,
+		}
+	}
+	areq := &action.SetSecretsRequest{
+		ParentType: parentType,
+		ParentRef:  parentRef,
+		Secrets:    secrets,
+		Prune:      req.Prune,
+	}
+	results, err := h.ah.SetSecrets(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createSetResultsResponse(results)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+func createSetResultsResponse(results []*csapitypes.SetResult) []*gwapitypes.SetResultResponse {
+	res := make([]*gwapitypes.SetResultResponse, len(results))
+	for i, r := range results {
+		res[i] = &gwapitypes.SetResultResponse{Name: r.Name, Result: r.Result}
+	}
+	return res
+}
@@ -21,6 +21,7 @@ import (
 	"sort"
 	"strconv"
 
+	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/util"
 	cstypes "agola.io/agola/services/configstore/types"
@@ -166,6 +167,7 @@ func createUserResponse(u *cstypes.User) *gwapitypes.UserResponse {
 			RemoteSourceID:      la.RemoteSourceID,
 			RemoteUserName:      la.RemoteUserName,
 			RemoteUserAvatarURL: la.RemoteUserAvatarURL,
+			NeedsReauth:         la.NeedsReauth,
 		})
 	}
 
@@ -361,6 +363,40 @@ func (h *CreateUserTokenHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+type UserTokensHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewUserTokensHandler(logger *zap.Logger, ah *action.ActionHandler) *UserTokensHandler {
+	return &UserTokensHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *UserTokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	userRef := vars["userref"]
+
+	tokens, err := h.ah.GetUserTokens(ctx, userRef)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*gwapitypes.UserTokenResponse, len(tokens))
+	for i, t := range tokens {
+		res[i] = &gwapitypes.UserTokenResponse{
+			Name:         t.Name,
+			CreationTime: t.CreationTime,
+			LastUsedTime: t.LastUsedTime,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type DeleteUserTokenHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -497,12 +533,13 @@ func (h *AuthorizeHandler) authorize(ctx context.Context, req *gwapitypes.LoginU
 }
 
 type LoginUserHandler struct {
-	log *zap.SugaredLogger
-	ah  *action.ActionHandler
+	log     *zap.SugaredLogger
+	ah      *action.ActionHandler
+	session *common.SessionConfig
 }
 
-func NewLoginUserHandler(logger *zap.Logger, ah *action.ActionHandler) *LoginUserHandler {
-	return &LoginUserHandler{log: logger.Sugar(), ah: ah}
+func NewLoginUserHandler(logger *zap.Logger, ah *action.ActionHandler, session *common.SessionConfig) *LoginUserHandler {
+	return &LoginUserHandler{log: logger.Sugar(), ah: ah, session: session}
 }
 
 func (h *LoginUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -521,6 +558,10 @@ func (h *LoginUserHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if res.Token != "" {
+		http.SetCookie(w, h.session.Cookie(res.Token))
+	}
+
 	if err := httpResponse(w, http.StatusCreated, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
@@ -550,6 +591,32 @@ func (h *LoginUserHandler) loginUser(ctx context.Context, req *gwapitypes.LoginU
 	return resp, nil
 }
 
+type LogoutHandler struct {
+	log     *zap.SugaredLogger
+	ah      *action.ActionHandler
+	session *common.SessionConfig
+}
+
+func NewLogoutHandler(logger *zap.Logger, ah *action.ActionHandler, session *common.SessionConfig) *LogoutHandler {
+	return &LogoutHandler{log: logger.Sugar(), ah: ah, session: session}
+}
+
+func (h *LogoutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	err := h.ah.Logout(ctx)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	http.SetCookie(w, h.session.ExpiredCookie())
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type UserCreateRunHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -579,6 +646,7 @@ func (h *UserCreateRunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		Message:               req.Message,
 		PullRequestRefRegexes: req.PullRequestRefRegexes,
 		Variables:             req.Variables,
+		RunTags:               req.RunTags,
 	}
 	err := h.ah.UserCreateRun(ctx, creq)
 	if httpError(w, err) {
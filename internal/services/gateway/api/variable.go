@@ -96,6 +96,37 @@ func (h *VariableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type VariableUsagesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewVariableUsagesHandler(logger *zap.Logger, ah *action.ActionHandler) *VariableUsagesHandler {
+	return &VariableUsagesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *VariableUsagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	variableName := vars["variablename"]
+
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	usages, err := h.ah.GetVariableUsages(ctx, parentType, parentRef, variableName)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createConfigUsagesResponse(usages)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type CreateVariableHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -204,7 +235,9 @@ func (h *DeleteVariableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = h.ah.DeleteVariable(ctx, parentType, parentRef, variableName)
+	_, failIfUsed := r.URL.Query()["failifused"]
+
+	err = h.ah.DeleteVariable(ctx, parentType, parentRef, variableName, failIfUsed)
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
@@ -226,3 +259,53 @@ func fromApiVariableValues(apivalues []gwapitypes.VariableValueRequest) []cstype
 	}
 	return values
 }
+
+type SetVariablesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSetVariablesHandler(logger *zap.Logger, ah *action.ActionHandler) *SetVariablesHandler {
+	return &SetVariablesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SetVariablesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	parentType, parentRef, err := GetConfigTypeRef(r)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	var req gwapitypes.SetVariablesRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&req); err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	variables := make([]*action.CreateVariableRequest, len(req.Variables))
+	for i, v := range req.Variables {
+		variables[i] = &action.CreateVariableRequest{
+			Name:       v.Name,
+			ParentType: parentType,
+			ParentRef:  parentRef,
+			Values:     fromApiVariableValues(v.Values),
+		}
+	}
+	areq := &action.SetVariablesRequest{
+		ParentType: parentType,
+		ParentRef:  parentRef,
+		Variables:  variables,
+		Prune:      req.Prune,
+	}
+	results, err := h.ah.SetVariables(ctx, areq)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, createSetResultsResponse(results)); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
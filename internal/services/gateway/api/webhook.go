@@ -15,15 +15,24 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"io/ioutil"
 	"net/http"
+	"time"
 
+	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/tracing"
 	"agola.io/agola/internal/util"
 	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
 	rsclient "agola.io/agola/services/runservice/client"
+	rstypes "agola.io/agola/services/runservice/types"
 
+	uuid "github.com/satori/go.uuid"
 	"go.uber.org/zap"
 	errors "golang.org/x/xerrors"
 )
@@ -47,7 +56,30 @@ func NewWebhooksHandler(logger *zap.Logger, ah *action.ActionHandler, configstor
 }
 
 func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	err := h.handleWebhook(r)
+	ctx, span := tracing.StartSpan(r.Context(), "gateway.webhook")
+	span.SetAttribute("agola.project_id", r.URL.Query().Get("projectid"))
+	defer span.End()
+
+	// keep the body to record it in the webhook delivery log
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("failed to read webhook body: %w", err)))
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	wd := &webhookDelivery{ID: uuid.NewV4().String()}
+	ctx = context.WithValue(ctx, webhookDeliveryKey{}, wd)
+
+	err = h.handleWebhook(r.WithContext(ctx))
+	span.SetError(err)
+
+	// only record verified deliveries so unauthenticated requests cannot fill
+	// or evict the project delivery log
+	if wd.verified {
+		h.recordWebhookDelivery(ctx, wd, r, body, err)
+	}
+
 	if httpError(w, err) {
 		h.log.Errorf("err: %+v", err)
 		return
@@ -58,9 +90,56 @@ func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (h *webhooksHandler) recordWebhookDelivery(ctx context.Context, wd *webhookDelivery, r *http.Request, body []byte, herr error) {
+	delivery := &rstypes.WebhookDelivery{
+		ID:         wd.ID,
+		ProjectID:  wd.projectID,
+		ReceivedAt: time.Now(),
+		Event:      webhookEvent(r.Header),
+		Header:     r.Header,
+		Payload:    body,
+		Status:     rstypes.WebhookDeliveryStatusSuccess,
+	}
+	if herr != nil {
+		delivery.Status = rstypes.WebhookDeliveryStatusFailed
+		delivery.Error = herr.Error()
+	}
+	if _, _, err := h.runserviceClient.CreateWebhookDelivery(ctx, delivery); err != nil {
+		h.log.Errorf("failed to record webhook delivery %q: %+v", wd.ID, err)
+	}
+}
+
+// webhookEvent returns the event type reported by the git source in the
+// webhook headers
+func webhookEvent(header http.Header) string {
+	for _, k := range []string{"X-Gitea-Event", "X-Github-Event", "X-Gitlab-Event", "X-Event-Key"} {
+		if v := header.Get(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+type webhookDeliveryKey struct{}
+
+// webhookDelivery is saved in the request context and tracks the webhook
+// delivery that originated the runs
+type webhookDelivery struct {
+	ID       string
+	Replayed bool
+
+	projectID string
+	verified  bool
+}
+
 func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 	ctx := r.Context()
 
+	wd, _ := ctx.Value(webhookDeliveryKey{}).(*webhookDelivery)
+	if wd == nil {
+		wd = &webhookDelivery{}
+	}
+
 	projectID := r.URL.Query().Get("projectid")
 	if projectID == "" {
 		return util.NewErrBadRequest(errors.Errorf("bad webhook url %q. Missing projectid", r.URL))
@@ -100,10 +179,13 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 		skipSSHHostKeyCheck = project.SkipSSHHostKeyCheck
 	}
 
-	webhookData, err := gitSource.ParseWebhook(r, project.WebhookSecret)
+	webhookData, err := parseWebhook(gitSource, r, project)
 	if err != nil {
 		return util.NewErrBadRequest(errors.Errorf("failed to parse webhook: %w", err))
 	}
+	wd.projectID = project.ID
+	wd.verified = true
+
 	// skip nil webhook data
 	// TODO(sgotti) report the reason of the skip
 	if webhookData == nil {
@@ -117,6 +199,8 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 		RunType:            types.RunTypeProject,
 		RefType:            common.WebHookEventToRunRefType(webhookData.Event),
 		RunCreationTrigger: types.RunCreationTriggerTypeWebhook,
+		WebhookDeliveryID:  wd.ID,
+		Replayed:           wd.Replayed,
 
 		Project:             project,
 		User:                nil,
@@ -124,10 +208,15 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 		GitSource:           gitSource,
 		CommitSHA:           webhookData.CommitSHA,
 		Message:             webhookData.Message,
+		CommitMessage:       webhookData.CommitMessage,
+		CommitAuthorName:    webhookData.CommitAuthorName,
+		CommitAuthorEmail:   webhookData.CommitAuthorEmail,
 		Branch:              webhookData.Branch,
 		Tag:                 webhookData.Tag,
 		PullRequestID:       webhookData.PullRequestID,
 		PRFromSameRepo:      webhookData.PRFromSameRepo,
+		PRAuthor:            webhookData.PRAuthor,
+		PRBaseBranch:        webhookData.PRBaseBranch,
 		Ref:                 webhookData.Ref,
 		SSHPrivKey:          sshPrivKey,
 		SSHHostKey:          sshHostKey,
@@ -139,10 +228,42 @@ func (h *webhooksHandler) handleWebhook(r *http.Request) error {
 		TagLink:         webhookData.TagLink,
 		PullRequestLink: webhookData.PullRequestLink,
 		CompareLink:     webhookData.CompareLink,
+
+		RunSelectors: project.WebhookRunSelectors,
+
+		PullRequestClosed: webhookData.Event == types.WebhookEventPullRequestClosed,
 	}
-	if err := h.ah.CreateRuns(ctx, req); err != nil {
+	if _, err := h.ah.CreateRuns(ctx, req); err != nil {
 		return util.NewErrInternal(errors.Errorf("failed to create run: %w", err))
 	}
 
 	return nil
 }
+
+// parseWebhook parses the webhook verifying it with the project webhook secret
+// or, during a webhook secret rotation, with the previous webhook secret
+func parseWebhook(gitSource gitsource.GitSource, r *http.Request, project *cstypes.Project) (*types.WebhookData, error) {
+	if project.PreviousWebhookSecret == "" || project.PreviousWebhookSecretExpiration == nil || time.Now().After(*project.PreviousWebhookSecretExpiration) {
+		return gitSource.ParseWebhook(r, project.WebhookSecret)
+	}
+
+	// keep the body since it's consumed when parsing the webhook
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	webhookData, err := gitSource.ParseWebhook(r, project.WebhookSecret)
+	if err == nil {
+		return webhookData, nil
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	webhookData, perr := gitSource.ParseWebhook(r, project.PreviousWebhookSecret)
+	if perr != nil {
+		// report the error with the current webhook secret
+		return nil, err
+	}
+	return webhookData, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+func createWebhookDeliveryResponse(d *rstypes.WebhookDelivery) *gwapitypes.WebhookDeliveryResponse {
+	return &gwapitypes.WebhookDeliveryResponse{
+		ID:         d.ID,
+		ReceivedAt: d.ReceivedAt,
+		Event:      d.Event,
+		Status:     string(d.Status),
+		Error:      d.Error,
+	}
+}
+
+type ProjectWebhookDeliveriesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewProjectWebhookDeliveriesHandler(logger *zap.Logger, ah *action.ActionHandler) *ProjectWebhookDeliveriesHandler {
+	return &ProjectWebhookDeliveriesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *ProjectWebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+
+	limit := 0
+	if limitS := r.URL.Query().Get("limit"); limitS != "" {
+		limit, err = strconv.Atoi(limitS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse limit: %w", err)))
+			return
+		}
+	}
+	if limit < 0 {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("limit must be greater or equal than 0")))
+		return
+	}
+
+	deliveries, err := h.ah.GetProjectWebhookDeliveries(ctx, projectRef, limit)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	res := make([]*gwapitypes.WebhookDeliveryResponse, len(deliveries))
+	for i, d := range deliveries {
+		res[i] = createWebhookDeliveryResponse(d)
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+// ProjectWebhookDeliveryReplayHandler handles a recorded webhook delivery
+// again. The delivery is verified with the project webhook secret like a new
+// one and the created runs are marked as replayed.
+type ProjectWebhookDeliveryReplayHandler struct {
+	log             *zap.SugaredLogger
+	ah              *action.ActionHandler
+	webhooksHandler *webhooksHandler
+}
+
+func NewProjectWebhookDeliveryReplayHandler(logger *zap.Logger, ah *action.ActionHandler, webhooksHandler *webhooksHandler) *ProjectWebhookDeliveryReplayHandler {
+	return &ProjectWebhookDeliveryReplayHandler{log: logger.Sugar(), ah: ah, webhooksHandler: webhooksHandler}
+}
+
+func (h *ProjectWebhookDeliveryReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef, err := url.PathUnescape(vars["projectref"])
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(err))
+		return
+	}
+	deliveryID := vars["deliveryid"]
+
+	d, err := h.ah.GetProjectWebhookDelivery(ctx, projectRef, deliveryID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	u := url.URL{Path: "/webhooks", RawQuery: url.Values{"projectid": []string{d.ProjectID}}.Encode()}
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(d.Payload))
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+	for k, v := range d.Header {
+		req.Header[k] = v
+	}
+
+	// keep the original delivery id so the replayed runs can be related to it
+	ctx = context.WithValue(ctx, webhookDeliveryKey{}, &webhookDelivery{ID: d.ID, Replayed: true})
+
+	err = h.webhooksHandler.handleWebhook(req.WithContext(ctx))
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
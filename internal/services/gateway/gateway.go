@@ -16,9 +16,12 @@ package gateway
 
 import (
 	"context"
-	"crypto/tls"
+	"crypto/rsa"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	scommon "agola.io/agola/internal/common"
 	slog "agola.io/agola/internal/log"
@@ -28,13 +31,13 @@ import (
 	"agola.io/agola/internal/services/gateway/action"
 	"agola.io/agola/internal/services/gateway/api"
 	"agola.io/agola/internal/services/gateway/handlers"
-	"agola.io/agola/internal/util"
 	csclient "agola.io/agola/services/configstore/client"
 	rsclient "agola.io/agola/services/runservice/client"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	ghandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	errors "golang.org/x/xerrors"
@@ -44,10 +47,6 @@ var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
 var logger = slog.New(level)
 var log = logger.Sugar()
 
-const (
-	maxRequestSize = 1024 * 1024
-)
-
 type Gateway struct {
 	c *config.Gateway
 
@@ -56,6 +55,65 @@ type Gateway struct {
 	configstoreClient *csclient.Client
 	ah                *action.ActionHandler
 	sd                *common.TokenSigningData
+	session           *common.SessionConfig
+
+	idTokenPublicKeys *api.IDTokenPublicKeys
+
+	// basePath and the exposed urls including it
+	basePath      string
+	apiExposedURL string
+	webExposedURL string
+}
+
+// exposedURLWithBasePath appends the base path to the exposed url when not
+// already part of it
+func exposedURLWithBasePath(exposedURL, basePath string) string {
+	exposedURL = strings.TrimSuffix(exposedURL, "/")
+	if basePath == "" || strings.HasSuffix(exposedURL, basePath) {
+		return exposedURL
+	}
+	return exposedURL + basePath
+}
+
+// urlOrigin returns the origin (scheme and host) of the url
+func urlOrigin(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// newSessionConfig creates the session config. The session absolute timeout
+// defaults to the token duration and the cookie path to the base path.
+func newSessionConfig(c *config.Session, tokenDuration time.Duration, basePath string) (*common.SessionConfig, error) {
+	s := &common.SessionConfig{
+		IdleTimeout:     c.IdleTimeout,
+		AbsoluteTimeout: c.AbsoluteTimeout,
+		CookieName:      c.Cookie.Name,
+		CookieDomain:    c.Cookie.Domain,
+		CookiePath:      c.Cookie.Path,
+		CookieSecure:    c.Cookie.Secure,
+		CookieMaxAge:    c.Cookie.MaxAge,
+	}
+	if s.AbsoluteTimeout == 0 {
+		s.AbsoluteTimeout = tokenDuration
+	}
+	if s.CookiePath == "" {
+		s.CookiePath = basePath + "/"
+	}
+
+	switch c.Cookie.SameSite {
+	case config.SessionCookieSameSiteDefault:
+	case config.SessionCookieSameSiteLax:
+		s.CookieSameSite = http.SameSiteLaxMode
+	case config.SessionCookieSameSiteStrict:
+		s.CookieSameSite = http.SameSiteStrictMode
+	default:
+		return nil, errors.Errorf("unknown session cookie sameSite %q", c.Cookie.SameSite)
+	}
+
+	return s, nil
 }
 
 func NewGateway(ctx context.Context, l *zap.Logger, gc *config.Config) (*Gateway, error) {
@@ -126,10 +184,44 @@ func NewGateway(ctx context.Context, l *zap.Logger, gc *config.Config) (*Gateway
 		return nil, err
 	}
 
+	configstoreHTTPClient, err := scommon.NewHTTPClient(c.ConfigstoreTLS)
+	if err != nil {
+		return nil, errors.Errorf("failed to create configstore http client: %w", err)
+	}
 	configstoreClient := csclient.NewClient(c.ConfigstoreURL)
+	configstoreClient.SetHTTPClient(configstoreHTTPClient)
+	runserviceHTTPClient, err := scommon.NewHTTPClient(c.RunserviceTLS)
+	if err != nil {
+		return nil, errors.Errorf("failed to create runservice http client: %w", err)
+	}
 	runserviceClient := rsclient.NewClient(c.RunserviceURL)
+	runserviceClient.SetHTTPClient(runserviceHTTPClient)
 
-	ah := action.NewActionHandler(logger, sd, configstoreClient, runserviceClient, gc.ID, c.APIExposedURL, c.WebExposedURL)
+	basePath := strings.TrimSuffix(c.BasePath, "/")
+	apiExposedURL := exposedURLWithBasePath(c.APIExposedURL, basePath)
+	webExposedURL := exposedURLWithBasePath(c.WebExposedURL, basePath)
+
+	session, err := newSessionConfig(&c.Session, c.TokenSigning.Duration, basePath)
+	if err != nil {
+		return nil, err
+	}
+	// the web ui and the cors allowed origins can send state changing
+	// requests authenticated with the session cookie
+	for _, u := range []string{c.WebExposedURL, c.APIExposedURL} {
+		if origin := urlOrigin(u); origin != "" {
+			session.AllowedOrigins = append(session.AllowedOrigins, origin)
+		}
+	}
+	session.AllowedOrigins = append(session.AllowedOrigins, c.Web.AllowedOrigins...)
+
+	keys, err := readIDTokenPublicKeys(c.IDTokenPublicKeyPaths)
+	if err != nil {
+		return nil, err
+	}
+	idTokenPublicKeys := &api.IDTokenPublicKeys{}
+	idTokenPublicKeys.Set(keys)
+
+	ah := action.NewActionHandler(logger, sd, session, configstoreClient, runserviceClient, gc.ID, apiExposedURL, webExposedURL)
 
 	return &Gateway{
 		c:                 c,
@@ -138,9 +230,48 @@ func NewGateway(ctx context.Context, l *zap.Logger, gc *config.Config) (*Gateway
 		configstoreClient: configstoreClient,
 		ah:                ah,
 		sd:                sd,
+		session:           session,
+		idTokenPublicKeys: idTokenPublicKeys,
+		basePath:          basePath,
+		apiExposedURL:     apiExposedURL,
+		webExposedURL:     webExposedURL,
 	}, nil
 }
 
+// readIDTokenPublicKeys reads the pem encoded public keys used to verify the
+// tasks id tokens
+func readIDTokenPublicKeys(paths []string) ([]*rsa.PublicKey, error) {
+	keys := make([]*rsa.PublicKey, len(paths))
+	for i, p := range paths {
+		publicKeyData, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, errors.Errorf("error reading id token public key %q: %w", p, err)
+		}
+		keys[i], err = jwt.ParseRSAPublicKeyFromPEM(publicKeyData)
+		if err != nil {
+			return nil, errors.Errorf("error parsing id token public key %q: %w", p, err)
+		}
+	}
+	return keys, nil
+}
+
+// Reload applies the gateway config changes that don't require a restart.
+// Currently the log level and the id token public keys (to rotate them).
+func (g *Gateway) Reload(gc *config.Config) {
+	if gc.Gateway.Debug {
+		level.SetLevel(zapcore.DebugLevel)
+	} else {
+		level.SetLevel(zapcore.InfoLevel)
+	}
+
+	keys, err := readIDTokenPublicKeys(gc.Gateway.IDTokenPublicKeyPaths)
+	if err != nil {
+		log.Errorf("failed to reload id token public keys, keeping the current ones: %+v", err)
+		return
+	}
+	g.idTokenPublicKeys.Set(keys)
+}
+
 func (g *Gateway) Run(ctx context.Context) error {
 	// noop coors handler
 	corsHandler := func(h http.Handler) http.Handler {
@@ -154,11 +285,13 @@ func (g *Gateway) Run(ctx context.Context) error {
 		corsHandler = ghandlers.CORS(corsAllowedMethodsOptions, corsAllowedHeadersOptions, corsAllowedOriginsOptions)
 	}
 
-	webhooksHandler := api.NewWebhooksHandler(logger, g.ah, g.configstoreClient, g.runserviceClient, g.c.APIExposedURL)
+	webhooksHandler := api.NewWebhooksHandler(logger, g.ah, g.configstoreClient, g.runserviceClient, g.apiExposedURL)
 
 	projectGroupHandler := api.NewProjectGroupHandler(logger, g.ah)
 	projectGroupSubgroupsHandler := api.NewProjectGroupSubgroupsHandler(logger, g.ah)
 	projectGroupProjectsHandler := api.NewProjectGroupProjectsHandler(logger, g.ah)
+	bulkRunActionsHandler := api.NewBulkRunActionsHandler(logger, g.ah)
+	bulkCreateRunsHandler := api.NewBulkCreateRunsHandler(logger, g.ah)
 	createProjectGroupHandler := api.NewCreateProjectGroupHandler(logger, g.ah)
 	updateProjectGroupHandler := api.NewUpdateProjectGroupHandler(logger, g.ah)
 	deleteProjectGroupHandler := api.NewDeleteProjectGroupHandler(logger, g.ah)
@@ -168,18 +301,37 @@ func (g *Gateway) Run(ctx context.Context) error {
 	updateProjectHandler := api.NewUpdateProjectHandler(logger, g.ah)
 	deleteProjectHandler := api.NewDeleteProjectHandler(logger, g.ah)
 	projectReconfigHandler := api.NewProjectReconfigHandler(logger, g.ah)
+	projectRotateWebhookSecretHandler := api.NewProjectRotateWebhookSecretHandler(logger, g.ah)
+	createProjectAPIKeyHandler := api.NewCreateProjectAPIKeyHandler(logger, g.ah)
+	deleteProjectAPIKeyHandler := api.NewDeleteProjectAPIKeyHandler(logger, g.ah)
 	projectUpdateRepoLinkedAccountHandler := api.NewProjectUpdateRepoLinkedAccountHandler(logger, g.ah)
+	projectSetConfigRepositoryHandler := api.NewProjectSetConfigRepositoryHandler(logger, g.ah)
+	projectRemoveConfigRepositoryHandler := api.NewProjectRemoveConfigRepositoryHandler(logger, g.ah)
+	projectSetTriggerPolicyHandler := api.NewProjectSetTriggerPolicyHandler(logger, g.ah)
+	projectSetDeployEnvironmentHandler := api.NewProjectSetDeployEnvironmentHandler(logger, g.ah)
+	projectDeleteDeployEnvironmentHandler := api.NewProjectDeleteDeployEnvironmentHandler(logger, g.ah)
+	projectPreviewEnvironmentsHandler := api.NewProjectPreviewEnvironmentsHandler(logger, g.ah)
+	projectRequiredChecksHandler := api.NewProjectRequiredChecksHandler(logger, g.ah)
 	projectCreateRunHandler := api.NewProjectCreateRunHandler(logger, g.ah)
+	projectPreviewRunHandler := api.NewProjectPreviewRunHandler(logger, g.ah)
+	projectWebhookDeliveriesHandler := api.NewProjectWebhookDeliveriesHandler(logger, g.ah)
+	projectWebhookDeliveryReplayHandler := api.NewProjectWebhookDeliveryReplayHandler(logger, g.ah, webhooksHandler)
+	projectRunConfigSourceHandler := api.NewProjectRunConfigSourceHandler(logger, g.ah)
 
 	secretHandler := api.NewSecretHandler(logger, g.ah)
+	secretsAuditHandler := api.NewSecretsAuditHandler(logger, g.ah)
 	createSecretHandler := api.NewCreateSecretHandler(logger, g.ah)
 	updateSecretHandler := api.NewUpdateSecretHandler(logger, g.ah)
 	deleteSecretHandler := api.NewDeleteSecretHandler(logger, g.ah)
+	setSecretsHandler := api.NewSetSecretsHandler(logger, g.ah)
+	secretUsagesHandler := api.NewSecretUsagesHandler(logger, g.ah)
 
 	variableHandler := api.NewVariableHandler(logger, g.ah)
 	createVariableHandler := api.NewCreateVariableHandler(logger, g.ah)
 	updateVariableHandler := api.NewUpdateVariableHandler(logger, g.ah)
 	deleteVariableHandler := api.NewDeleteVariableHandler(logger, g.ah)
+	setVariablesHandler := api.NewSetVariablesHandler(logger, g.ah)
+	variableUsagesHandler := api.NewVariableUsagesHandler(logger, g.ah)
 
 	currentUserHandler := api.NewCurrentUserHandler(logger, g.ah)
 	userHandler := api.NewUserHandler(logger, g.ah)
@@ -191,6 +343,7 @@ func (g *Gateway) Run(ctx context.Context) error {
 	createUserLAHandler := api.NewCreateUserLAHandler(logger, g.ah)
 	deleteUserLAHandler := api.NewDeleteUserLAHandler(logger, g.ah)
 	createUserTokenHandler := api.NewCreateUserTokenHandler(logger, g.ah)
+	userTokensHandler := api.NewUserTokensHandler(logger, g.ah)
 	deleteUserTokenHandler := api.NewDeleteUserTokenHandler(logger, g.ah)
 
 	remoteSourceHandler := api.NewRemoteSourceHandler(logger, g.ah)
@@ -199,6 +352,13 @@ func (g *Gateway) Run(ctx context.Context) error {
 	remoteSourcesHandler := api.NewRemoteSourcesHandler(logger, g.ah)
 	deleteRemoteSourceHandler := api.NewDeleteRemoteSourceHandler(logger, g.ah)
 
+	projectTemplateHandler := api.NewProjectTemplateHandler(logger, g.ah)
+	projectTemplatesHandler := api.NewProjectTemplatesHandler(logger, g.ah)
+	createProjectTemplateHandler := api.NewCreateProjectTemplateHandler(logger, g.ah)
+	updateProjectTemplateHandler := api.NewUpdateProjectTemplateHandler(logger, g.ah)
+	deleteProjectTemplateHandler := api.NewDeleteProjectTemplateHandler(logger, g.ah)
+	createProjectFromTemplateHandler := api.NewCreateProjectFromTemplateHandler(logger, g.ah)
+
 	orgHandler := api.NewOrgHandler(logger, g.ah)
 	orgsHandler := api.NewOrgsHandler(logger, g.ah)
 	createOrgHandler := api.NewCreateOrgHandler(logger, g.ah)
@@ -207,10 +367,17 @@ func (g *Gateway) Run(ctx context.Context) error {
 	orgMembersHandler := api.NewOrgMembersHandler(logger, g.ah)
 	addOrgMemberHandler := api.NewAddOrgMemberHandler(logger, g.ah)
 	removeOrgMemberHandler := api.NewRemoveOrgMemberHandler(logger, g.ah)
+	setOrgSecretPolicyHandler := api.NewSetOrgSecretPolicyHandler(logger, g.ah)
 
 	runHandler := api.NewRunHandler(logger, g.ah)
 	runsHandler := api.NewRunsHandler(logger, g.ah)
+	runStatsHandler := api.NewRunStatsHandler(logger, g.ah)
+	runsExportHandler := api.NewRunsExportHandler(logger, g.ah)
+	runWatchHandler := api.NewRunWatchHandler(logger, g.ah, g.c.Web.AllowedOrigins)
+	runConfigDiffHandler := api.NewRunConfigDiffHandler(logger, g.ah)
+	runProvenanceHandler := api.NewRunProvenanceHandler(logger, g.ah)
 	runtaskHandler := api.NewRuntaskHandler(logger, g.ah)
+	runTaskEnvironmentHandler := api.NewRunTaskEnvironmentHandler(logger, g.ah)
 	runActionsHandler := api.NewRunActionsHandler(logger, g.ah)
 	runTaskActionsHandler := api.NewRunTaskActionsHandler(logger, g.ah)
 
@@ -223,23 +390,40 @@ func (g *Gateway) Run(ctx context.Context) error {
 
 	versionHandler := api.NewVersionHandler(logger, g.ah)
 
+	runConfigSchemaHandler := api.NewRunConfigSchemaHandler(logger)
+
+	schedulingStatusHandler := api.NewSchedulingStatusHandler(logger, g.ah)
+	auditEventsHandler := api.NewAuditEventsHandler(logger, g.ah)
+	schedulingPauseHandler := api.NewSchedulingPauseHandler(logger, g.ah)
+
+	fsckHandler := api.NewFsckHandler(logger, g.ah)
+
+	executorsHandler := api.NewExecutorsHandler(logger, g.ah)
+	deleteExecutorHandler := api.NewDeleteExecutorHandler(logger, g.ah)
+
 	reposHandler := api.NewReposHandler(logger, g.c.GitserverURL)
 
-	loginUserHandler := api.NewLoginUserHandler(logger, g.ah)
+	loginUserHandler := api.NewLoginUserHandler(logger, g.ah, g.session)
+	logoutHandler := api.NewLogoutHandler(logger, g.ah, g.session)
 	authorizeHandler := api.NewAuthorizeHandler(logger, g.ah)
 	registerHandler := api.NewRegisterUserHandler(logger, g.ah)
-	oauth2callbackHandler := api.NewOAuth2CallbackHandler(logger, g.ah)
+	oauth2callbackHandler := api.NewOAuth2CallbackHandler(logger, g.ah, g.session)
 
 	router := mux.NewRouter()
 	reposRouter := mux.NewRouter()
 
 	apirouter := mux.NewRouter().PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
 
-	authForcedHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, true)
-	authOptionalHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, false)
+	authHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, g.session, true)
+	auditHandler := handlers.NewAuditHandler(logger, g.configstoreClient)
+	// authenticated requests are recorded in the audit log
+	authForcedHandler := func(h http.Handler) http.Handler { return authHandler(auditHandler(h)) }
+	authOptionalHandler := handlers.NewAuthHandler(logger, g.configstoreClient, g.c.AdminToken, g.sd, g.session, false)
 
 	router.PathPrefix("/api/v1alpha").Handler(apirouter)
 
+	apirouter.Use(handlers.NewMetricsHandler)
+
 	apirouter.Handle("/logs", authOptionalHandler(logsHandler)).Methods("GET")
 	apirouter.Handle("/logs", authForcedHandler(logsDeleteHandler)).Methods("DELETE")
 
@@ -250,32 +434,58 @@ func (g *Gateway) Run(ctx context.Context) error {
 	apirouter.Handle("/projectgroups", authForcedHandler(createProjectGroupHandler)).Methods("POST")
 	apirouter.Handle("/projectgroups/{projectgroupref}", authForcedHandler(updateProjectGroupHandler)).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}", authForcedHandler(deleteProjectGroupHandler)).Methods("DELETE")
+	apirouter.Handle("/projectgroups/{projectgroupref}/runs/actions", authForcedHandler(bulkRunActionsHandler)).Methods("PUT")
+	apirouter.Handle("/projectgroups/{projectgroupref}/createruns", authForcedHandler(bulkCreateRunsHandler)).Methods("POST")
 
 	apirouter.Handle("/projects/{projectref}", authOptionalHandler(projectHandler)).Methods("GET")
 	apirouter.Handle("/projects", authForcedHandler(createProjectHandler)).Methods("POST")
 	apirouter.Handle("/projects/{projectref}", authForcedHandler(updateProjectHandler)).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}", authForcedHandler(deleteProjectHandler)).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/reconfig", authForcedHandler(projectReconfigHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/rotatewebhooksecret", authForcedHandler(projectRotateWebhookSecretHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/apikeys", authForcedHandler(createProjectAPIKeyHandler)).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/apikeys/{apikeyname}", authForcedHandler(deleteProjectAPIKeyHandler)).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/updaterepolinkedaccount", authForcedHandler(projectUpdateRepoLinkedAccountHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/configrepository", authForcedHandler(projectSetConfigRepositoryHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/configrepository", authForcedHandler(projectRemoveConfigRepositoryHandler)).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/triggerpolicy", authForcedHandler(projectSetTriggerPolicyHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/deployenvironments/{deployenvironmentname}", authForcedHandler(projectSetDeployEnvironmentHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/deployenvironments/{deployenvironmentname}", authForcedHandler(projectDeleteDeployEnvironmentHandler)).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/previewenvironments", authOptionalHandler(projectPreviewEnvironmentsHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/commits/{commitsha}/requiredchecks", authOptionalHandler(projectRequiredChecksHandler)).Methods("GET")
 	apirouter.Handle("/projects/{projectref}/createrun", authForcedHandler(projectCreateRunHandler)).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/runpreview", authForcedHandler(projectPreviewRunHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/webhookdeliveries", authForcedHandler(projectWebhookDeliveriesHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/webhookdeliveries/{deliveryid}/replay", authForcedHandler(projectWebhookDeliveryReplayHandler)).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/runconfigsource", authForcedHandler(projectRunConfigSourceHandler)).Methods("GET")
 
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", authForcedHandler(secretHandler)).Methods("GET")
 	apirouter.Handle("/projects/{projectref}/secrets", authForcedHandler(secretHandler)).Methods("GET")
+	apirouter.Handle("/projectgroups/{projectgroupref}/secretsaudit", authForcedHandler(secretsAuditHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/secretsaudit", authForcedHandler(secretsAuditHandler)).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", authForcedHandler(createSecretHandler)).Methods("POST")
 	apirouter.Handle("/projects/{projectref}/secrets", authForcedHandler(createSecretHandler)).Methods("POST")
+	apirouter.Handle("/projectgroups/{projectgroupref}/secrets", authForcedHandler(setSecretsHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/secrets", authForcedHandler(setSecretsHandler)).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets/{secretname}", authForcedHandler(updateSecretHandler)).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}/secrets/{secretname}", authForcedHandler(updateSecretHandler)).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/secrets/{secretname}", authForcedHandler(deleteSecretHandler)).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/secrets/{secretname}", authForcedHandler(deleteSecretHandler)).Methods("DELETE")
+	apirouter.Handle("/projectgroups/{projectgroupref}/secrets/{secretname}/usages", authForcedHandler(secretUsagesHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/secrets/{secretname}/usages", authForcedHandler(secretUsagesHandler)).Methods("GET")
 
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables", authForcedHandler(variableHandler)).Methods("GET")
 	apirouter.Handle("/projects/{projectref}/variables", authForcedHandler(variableHandler)).Methods("GET")
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables", authForcedHandler(createVariableHandler)).Methods("POST")
 	apirouter.Handle("/projects/{projectref}/variables", authForcedHandler(createVariableHandler)).Methods("POST")
+	apirouter.Handle("/projectgroups/{projectgroupref}/variables", authForcedHandler(setVariablesHandler)).Methods("PUT")
+	apirouter.Handle("/projects/{projectref}/variables", authForcedHandler(setVariablesHandler)).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}", authForcedHandler(updateVariableHandler)).Methods("PUT")
 	apirouter.Handle("/projects/{projectref}/variables/{variablename}", authForcedHandler(updateVariableHandler)).Methods("PUT")
 	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}", authForcedHandler(deleteVariableHandler)).Methods("DELETE")
 	apirouter.Handle("/projects/{projectref}/variables/{variablename}", authForcedHandler(deleteVariableHandler)).Methods("DELETE")
+	apirouter.Handle("/projectgroups/{projectgroupref}/variables/{variablename}/usages", authForcedHandler(variableUsagesHandler)).Methods("GET")
+	apirouter.Handle("/projects/{projectref}/variables/{variablename}/usages", authForcedHandler(variableUsagesHandler)).Methods("GET")
 
 	apirouter.Handle("/user", authForcedHandler(currentUserHandler)).Methods("GET")
 	apirouter.Handle("/users/{userref}", authForcedHandler(userHandler)).Methods("GET")
@@ -286,6 +496,7 @@ func (g *Gateway) Run(ctx context.Context) error {
 
 	apirouter.Handle("/users/{userref}/linkedaccounts", authForcedHandler(createUserLAHandler)).Methods("POST")
 	apirouter.Handle("/users/{userref}/linkedaccounts/{laid}", authForcedHandler(deleteUserLAHandler)).Methods("DELETE")
+	apirouter.Handle("/users/{userref}/tokens", authForcedHandler(userTokensHandler)).Methods("GET")
 	apirouter.Handle("/users/{userref}/tokens", authForcedHandler(createUserTokenHandler)).Methods("POST")
 	apirouter.Handle("/users/{userref}/tokens/{tokenname}", authForcedHandler(deleteUserTokenHandler)).Methods("DELETE")
 
@@ -295,6 +506,13 @@ func (g *Gateway) Run(ctx context.Context) error {
 	apirouter.Handle("/remotesources", authOptionalHandler(remoteSourcesHandler)).Methods("GET")
 	apirouter.Handle("/remotesources/{remotesourceref}", authForcedHandler(deleteRemoteSourceHandler)).Methods("DELETE")
 
+	apirouter.Handle("/projecttemplates/{projecttemplateref}", authForcedHandler(projectTemplateHandler)).Methods("GET")
+	apirouter.Handle("/projecttemplates", authForcedHandler(projectTemplatesHandler)).Methods("GET")
+	apirouter.Handle("/projecttemplates", authForcedHandler(createProjectTemplateHandler)).Methods("POST")
+	apirouter.Handle("/projecttemplates/{projecttemplateref}", authForcedHandler(updateProjectTemplateHandler)).Methods("PUT")
+	apirouter.Handle("/projecttemplates/{projecttemplateref}", authForcedHandler(deleteProjectTemplateHandler)).Methods("DELETE")
+	apirouter.Handle("/projecttemplates/{projecttemplateref}/projects", authForcedHandler(createProjectFromTemplateHandler)).Methods("POST")
+
 	apirouter.Handle("/orgs/{orgref}", authForcedHandler(orgHandler)).Methods("GET")
 	apirouter.Handle("/orgs", authForcedHandler(orgsHandler)).Methods("GET")
 	apirouter.Handle("/orgs", authForcedHandler(createOrgHandler)).Methods("POST")
@@ -302,20 +520,41 @@ func (g *Gateway) Run(ctx context.Context) error {
 	apirouter.Handle("/orgs/{orgref}/members", authForcedHandler(orgMembersHandler)).Methods("GET")
 	apirouter.Handle("/orgs/{orgref}/members/{userref}", authForcedHandler(addOrgMemberHandler)).Methods("PUT")
 	apirouter.Handle("/orgs/{orgref}/members/{userref}", authForcedHandler(removeOrgMemberHandler)).Methods("DELETE")
+	apirouter.Handle("/orgs/{orgref}/secretpolicy", authForcedHandler(setOrgSecretPolicyHandler)).Methods("PUT")
 
+	apirouter.Handle("/runs/stats", authOptionalHandler(runStatsHandler)).Methods("GET")
+	apirouter.Handle("/runs/export", authOptionalHandler(runsExportHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}", authOptionalHandler(runHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/actions", authForcedHandler(runActionsHandler)).Methods("PUT")
+	apirouter.Handle("/runs/{runid}/watch", authOptionalHandler(runWatchHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/configdiff/{otherrunid}", authOptionalHandler(runConfigDiffHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/provenance", authForcedHandler(runProvenanceHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}", authOptionalHandler(runtaskHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/environment", authOptionalHandler(runTaskEnvironmentHandler)).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}/actions", authForcedHandler(runTaskActionsHandler)).Methods("PUT")
-	apirouter.Handle("/runs", authForcedHandler(runsHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/logs/setup", authOptionalHandler(logsHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/logs/steps/{step}", authOptionalHandler(logsHandler)).Methods("GET")
+	apirouter.Handle("/runs", authOptionalHandler(runsHandler)).Methods("GET")
 
 	apirouter.Handle("/user/remoterepos/{remotesourceref}", authForcedHandler(userRemoteReposHandler)).Methods("GET")
 
-	apirouter.Handle("/badges/{projectref}", badgeHandler).Methods("GET")
+	apirouter.Handle("/badges/{projectref}", authOptionalHandler(badgeHandler)).Methods("GET")
 
 	apirouter.Handle("/version", versionHandler).Methods("GET")
 
+	apirouter.Handle("/runconfigschema", runConfigSchemaHandler).Methods("GET")
+
+	apirouter.Handle("/scheduling", authOptionalHandler(schedulingStatusHandler)).Methods("GET")
+	apirouter.Handle("/scheduling/pause", authForcedHandler(schedulingPauseHandler)).Methods("PUT", "DELETE")
+
+	apirouter.Handle("/auditevents", authForcedHandler(auditEventsHandler)).Methods("GET")
+	apirouter.Handle("/maintenance/fsck", authForcedHandler(fsckHandler)).Methods("GET", "POST")
+
+	apirouter.Handle("/executors", authForcedHandler(executorsHandler)).Methods("GET")
+	apirouter.Handle("/executors/{executorid}", authForcedHandler(deleteExecutorHandler)).Methods("DELETE")
+
 	apirouter.Handle("/auth/login", loginUserHandler).Methods("POST")
+	apirouter.Handle("/auth/logout", authForcedHandler(logoutHandler)).Methods("POST")
 	apirouter.Handle("/auth/authorize", authorizeHandler).Methods("POST")
 	apirouter.Handle("/auth/register", registerHandler).Methods("POST")
 	apirouter.Handle("/auth/oauth2/callback", oauth2callbackHandler).Methods("GET")
@@ -323,40 +562,70 @@ func (g *Gateway) Run(ctx context.Context) error {
 	// TODO(sgotti) add auth to these requests
 	reposRouter.Handle("/repos/{rest:.*}", reposHandler).Methods("GET", "POST")
 
-	router.Handle("/webhooks", webhooksHandler).Methods("POST")
-	router.PathPrefix("/").HandlerFunc(handlers.NewWebBundleHandlerFunc(g.c.APIExposedURL))
+	router.Handle("/webhooks", handlers.NewMetricsHandler(webhooksHandler)).Methods("POST")
+	if g.c.MetricsListenAddress == "" {
+		router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	}
+	router.Handle(api.OIDCDiscoveryPath, api.NewOIDCDiscoveryHandler(logger, g.apiExposedURL, g.idTokenPublicKeys)).Methods("GET")
+	router.Handle(api.OIDCKeysPath, api.NewOIDCKeysHandler(logger, g.idTokenPublicKeys)).Methods("GET")
+	router.PathPrefix("/").HandlerFunc(handlers.NewWebBundleHandlerFunc(g.apiExposedURL, g.basePath))
 
-	maxBytesHandler := handlers.NewMaxBytesHandler(router, maxRequestSize)
+	requestLimits := g.c.RequestLimits
 
 	mainrouter := mux.NewRouter()
-	mainrouter.PathPrefix("/repos/").Handler(corsHandler(reposRouter))
-	mainrouter.PathPrefix("/").Handler(corsHandler(maxBytesHandler))
+	mainrouter.PathPrefix("/repos/").Handler(corsHandler(handlers.NewMaxBytesHandler(reposRouter, requestLimits.UploadMaxBodySize)))
+	mainrouter.Path("/webhooks").Handler(corsHandler(handlers.NewMaxBytesHandler(router, requestLimits.WebhookMaxBodySize)))
+	mainrouter.PathPrefix("/").Handler(corsHandler(handlers.NewMaxBytesHandler(router, requestLimits.APIMaxBodySize)))
+
+	var handler http.Handler = mainrouter
+	if g.basePath != "" {
+		// serve only the requests under the base path, removing it from the
+		// request path before routing
+		baseRouter := mux.NewRouter()
+		baseRouter.Path(g.basePath).Handler(http.RedirectHandler(g.basePath+"/", http.StatusMovedPermanently))
+		baseRouter.PathPrefix(g.basePath + "/").Handler(http.StripPrefix(g.basePath, mainrouter))
+		handler = baseRouter
+	}
 
-	var tlsConfig *tls.Config
-	if g.c.Web.TLS {
-		var err error
-		tlsConfig, err = util.NewTLSConfig(g.c.Web.TLSCertFile, g.c.Web.TLSKeyFile, "", false)
-		if err != nil {
-			log.Errorf("err: %+v")
-			return err
-		}
+	tlsConfig, err := scommon.NewTLSServerConfig(&g.c.Web)
+	if err != nil {
+		log.Errorf("err: %+v", err)
+		return err
 	}
 
 	httpServer := http.Server{
 		Addr:      g.c.Web.ListenAddress,
-		Handler:   mainrouter,
+		Handler:   handler,
 		TLSConfig: tlsConfig,
 	}
 
+	go g.ah.HandleRunEvents(ctx)
+
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		lerrCh <- scommon.ListenAndServe(&httpServer)
 	}()
 
+	var metricsServer *http.Server
+	if g.c.MetricsListenAddress != "" {
+		metricsRouter := mux.NewRouter()
+		metricsRouter.Handle("/metrics", promhttp.Handler()).Methods("GET")
+		metricsServer = &http.Server{
+			Addr:    g.c.MetricsListenAddress,
+			Handler: metricsRouter,
+		}
+		go func() {
+			lerrCh <- metricsServer.ListenAndServe()
+		}()
+	}
+
 	select {
 	case <-ctx.Done():
 		log.Infof("configstore exiting")
 		httpServer.Close()
+		if metricsServer != nil {
+			metricsServer.Close()
+		}
 	case err := <-lerrCh:
 		if err != nil {
 			log.Errorf("http server listen error: %v", err)
@@ -0,0 +1,113 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+const apiPathPrefix = "/api/v1alpha"
+
+// AuditHandler records an audit event for every request changing something
+// (all the methods other than GET and HEAD). It must be called after the
+// AuthHandler to know the request actor.
+type AuditHandler struct {
+	log  *zap.SugaredLogger
+	next http.Handler
+
+	configstoreClient *csclient.Client
+}
+
+func NewAuditHandler(logger *zap.Logger, configstoreClient *csclient.Client) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &AuditHandler{
+			log:               logger.Sugar(),
+			next:              h,
+			configstoreClient: configstoreClient,
+		}
+	}
+}
+
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	sw := &statusResponseWriter{ResponseWriter: w}
+	h.next.ServeHTTP(sw, r)
+
+	auditEvent := genAuditEvent(r, sw.status)
+	if _, _, err := h.configstoreClient.CreateAuditEvent(r.Context(), auditEvent); err != nil {
+		h.log.Errorf("failed to record audit event for %s %s: %+v", r.Method, r.URL.Path, err)
+	}
+}
+
+func genAuditEvent(r *http.Request, status int) *cstypes.AuditEvent {
+	ctx := r.Context()
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	route := "unknown"
+	if cr := mux.CurrentRoute(r); cr != nil {
+		if tpl, err := cr.GetPathTemplate(); err == nil {
+			route = trimAPIPathPrefix(tpl)
+		}
+	}
+
+	auditEvent := &cstypes.AuditEvent{
+		Time:       time.Now(),
+		Action:     r.Method + " " + route,
+		Resource:   trimAPIPathPrefix(r.URL.Path),
+		StatusCode: status,
+	}
+
+	userID, _ := ctx.Value("userid").(string)
+	userName, _ := ctx.Value("username").(string)
+	projectID, _ := ctx.Value("projectid").(string)
+	switch {
+	case userID != "":
+		auditEvent.ActorType = cstypes.AuditEventActorTypeUser
+		auditEvent.ActorID = userID
+		auditEvent.ActorName = userName
+	case projectID != "":
+		auditEvent.ActorType = cstypes.AuditEventActorTypeProjectAPIKey
+		auditEvent.ActorID = projectID
+	default:
+		auditEvent.ActorType = cstypes.AuditEventActorTypeAdmin
+		auditEvent.ActorName = "admin"
+	}
+
+	return auditEvent
+}
+
+// trimAPIPathPrefix removes the api path prefix (and the gateway base path
+// before it) from the path
+func trimAPIPathPrefix(p string) string {
+	if i := strings.Index(p, apiPathPrefix); i >= 0 {
+		return p[i+len(apiPathPrefix):]
+	}
+	return p
+}
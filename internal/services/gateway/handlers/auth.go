@@ -16,18 +16,33 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"agola.io/agola/internal/services/common"
+	csapitypes "agola.io/agola/services/configstore/api/types"
 	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
+	gwapitypes "agola.io/agola/services/gateway/api/types"
 
 	jwt "github.com/dgrijalva/jwt-go"
 	jwtrequest "github.com/dgrijalva/jwt-go/request"
+	"github.com/gorilla/mux"
 	"go.uber.org/zap"
 	errors "golang.org/x/xerrors"
 )
 
+// tokenLastUsedUpdateInterval is the min interval between two updates of a
+// user token last used time
+const tokenLastUsedUpdateInterval = 10 * time.Minute
+
+// sessionLastActivityUpdateInterval is the max interval between two updates
+// of a user session last activity time
+const sessionLastActivityUpdateInterval = 1 * time.Minute
+
 type AuthHandler struct {
 	log  *zap.SugaredLogger
 	next http.Handler
@@ -35,12 +50,17 @@ type AuthHandler struct {
 	configstoreClient *csclient.Client
 	adminToken        string
 
-	sd *common.TokenSigningData
+	sd      *common.TokenSigningData
+	session *common.SessionConfig
+
+	// loginTokenExtractor extracts the login token from the Authorization
+	// header or from the session cookie
+	loginTokenExtractor jwtrequest.Extractor
 
 	required bool
 }
 
-func NewAuthHandler(logger *zap.Logger, configstoreClient *csclient.Client, adminToken string, sd *common.TokenSigningData, required bool) func(http.Handler) http.Handler {
+func NewAuthHandler(logger *zap.Logger, configstoreClient *csclient.Client, adminToken string, sd *common.TokenSigningData, session *common.SessionConfig, required bool) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
 		return &AuthHandler{
 			log:               logger.Sugar(),
@@ -48,7 +68,12 @@ func NewAuthHandler(logger *zap.Logger, configstoreClient *csclient.Client, admi
 			configstoreClient: configstoreClient,
 			adminToken:        adminToken,
 			sd:                sd,
-			required:          required,
+			session:           session,
+			loginTokenExtractor: jwtrequest.MultiExtractor{
+				BearerTokenExtractor,
+				cookieTokenExtractor(session.CookieName),
+			},
+			required: required,
 		}
 	}
 }
@@ -57,6 +82,34 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
 	tokenString, _ := TokenExtractor.ExtractToken(r)
+	if strings.HasPrefix(tokenString, cstypes.ProjectAPIKeyPrefix) {
+		project, resp, err := h.configstoreClient.GetProjectByAPIKey(ctx, tokenString)
+		if err != nil {
+			if resp != nil && resp.StatusCode == http.StatusNotFound {
+				authFailuresCounter.WithLabelValues(authFailureReasonInvalidToken).Inc()
+				authError(w, http.StatusUnauthorized)
+				return
+			}
+			authError(w, http.StatusInternalServerError)
+			return
+		}
+
+		// project api keys can only call the allowed project routes
+		if !isProjectAPIKeyRequestAllowed(r, project) {
+			authFailuresCounter.WithLabelValues(authFailureReasonForbiddenRoute).Inc()
+			authError(w, http.StatusForbidden)
+			return
+		}
+
+		// project api keys aren't bound to a user. Pass the project id to
+		// handlers via context so they can authorize only the project
+		// operations
+		ctx = context.WithValue(ctx, "projectid", project.ID)
+		ctx = csclient.WithPrincipal(ctx, csapitypes.ProjectPrincipal(project.ID))
+
+		h.next.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
 	if h.adminToken != "" && tokenString != "" {
 		if tokenString == h.adminToken {
 			ctx = context.WithValue(ctx, "admin", true)
@@ -65,14 +118,17 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		} else {
 			user, resp, err := h.configstoreClient.GetUserByToken(ctx, tokenString)
 			if err != nil && resp.StatusCode == http.StatusNotFound {
-				http.Error(w, "", http.StatusUnauthorized)
+				authFailuresCounter.WithLabelValues(authFailureReasonInvalidToken).Inc()
+				authError(w, http.StatusUnauthorized)
 				return
 			}
 			if err != nil {
-				http.Error(w, "", http.StatusInternalServerError)
+				authError(w, http.StatusInternalServerError)
 				return
 			}
 
+			h.updateTokenLastUsed(ctx, user, tokenString)
+
 			// pass userid to handlers via context
 			ctx = context.WithValue(ctx, "userid", user.ID)
 			ctx = context.WithValue(ctx, "username", user.Name)
@@ -80,15 +136,22 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if user.Admin {
 				ctx = context.WithValue(ctx, "admin", true)
 			}
+			ctx = withUserPrincipal(ctx, user)
 
 			h.next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 	}
 
-	tokenString, _ = BearerTokenExtractor.ExtractToken(r)
+	tokenString, _ = h.loginTokenExtractor.ExtractToken(r)
 	if tokenString != "" {
-		token, err := jwtrequest.ParseFromRequest(r, jwtrequest.AuthorizationHeaderExtractor, func(token *jwt.Token) (interface{}, error) {
+		if bearerToken, _ := BearerTokenExtractor.ExtractToken(r); bearerToken == "" && !h.isCookieAuthAllowed(r) {
+			authFailuresCounter.WithLabelValues(authFailureReasonCSRF).Inc()
+			authError(w, http.StatusForbidden)
+			return
+		}
+
+		token, err := jwtrequest.ParseFromRequest(r, h.loginTokenExtractor, func(token *jwt.Token) (interface{}, error) {
 			sd := h.sd
 			if token.Method != sd.Method {
 				return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -106,11 +169,13 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		})
 		if err != nil {
 			h.log.Errorf("err: %+v", err)
-			http.Error(w, "", http.StatusUnauthorized)
+			authFailuresCounter.WithLabelValues(authFailureReasonInvalidToken).Inc()
+			authError(w, http.StatusUnauthorized)
 			return
 		}
 		if !token.Valid {
-			http.Error(w, "", http.StatusUnauthorized)
+			authFailuresCounter.WithLabelValues(authFailureReasonInvalidToken).Inc()
+			authError(w, http.StatusUnauthorized)
 			return
 		}
 		// Set username in the request context
@@ -120,13 +185,25 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		user, resp, err := h.configstoreClient.GetUser(ctx, userID)
 		if err != nil {
 			if resp != nil && resp.StatusCode == http.StatusNotFound {
-				http.Error(w, "", http.StatusUnauthorized)
+				authFailuresCounter.WithLabelValues(authFailureReasonUnknownUser).Inc()
+				authError(w, http.StatusUnauthorized)
 				return
 			}
-			http.Error(w, "", http.StatusInternalServerError)
+			authError(w, http.StatusInternalServerError)
 			return
 		}
 
+		// tokens generated before the introduction of the sessions don't
+		// have a session id and are only bound to their expiration
+		if sessionID, ok := claims["sid"].(string); ok {
+			if !h.checkSession(ctx, user, sessionID) {
+				authFailuresCounter.WithLabelValues(authFailureReasonExpiredSession).Inc()
+				authError(w, http.StatusUnauthorized)
+				return
+			}
+			ctx = context.WithValue(ctx, "sessionid", sessionID)
+		}
+
 		// pass userid and username to handlers via context
 		ctx = context.WithValue(ctx, "userid", user.ID)
 		ctx = context.WithValue(ctx, "username", user.Name)
@@ -134,19 +211,106 @@ func (h *AuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if user.Admin {
 			ctx = context.WithValue(ctx, "admin", true)
 		}
+		ctx = withUserPrincipal(ctx, user)
 
 		h.next.ServeHTTP(w, r.WithContext(ctx))
 		return
 	}
 
 	if h.required {
-		http.Error(w, "", http.StatusUnauthorized)
+		authFailuresCounter.WithLabelValues(authFailureReasonMissingToken).Inc()
+		authError(w, http.StatusUnauthorized)
 		return
 	}
 
+	ctx = csclient.WithPrincipal(ctx, csapitypes.PrincipalAnonymous)
+
 	h.next.ServeHTTP(w, r.WithContext(ctx))
 }
 
+// withUserPrincipal makes the configstore requests done while serving the
+// request on behalf of the user, so the configstore will deny the access to
+// the objects of the orgs the user isn't member of. Admins aren't restricted.
+func withUserPrincipal(ctx context.Context, user *cstypes.User) context.Context {
+	if user.Admin {
+		return ctx
+	}
+	return csclient.WithPrincipal(ctx, csapitypes.UserPrincipal(user.ID))
+}
+
+// updateTokenLastUsed records the token last used time. To avoid writing the
+// user at every request the last used time is updated only when older than
+// tokenLastUsedUpdateInterval. Errors are only logged since they shouldn't
+// block the request.
+func (h *AuthHandler) updateTokenLastUsed(ctx context.Context, user *cstypes.User, tokenString string) {
+	for tokenName, tokenValue := range user.Tokens {
+		if tokenValue != tokenString {
+			continue
+		}
+
+		now := time.Now()
+		if tokenInfo, ok := user.TokensInfo[tokenName]; ok && tokenInfo.LastUsedTime != nil {
+			if now.Sub(*tokenInfo.LastUsedTime) < tokenLastUsedUpdateInterval {
+				return
+			}
+		}
+
+		req := &csapitypes.UpdateUserTokenLastUsedRequest{LastUsedTime: now}
+		if _, err := h.configstoreClient.UpdateUserTokenLastUsed(ctx, user.ID, tokenName, req); err != nil {
+			h.log.Errorf("failed to update user %q token %q last used time: %+v", user.Name, tokenName, err)
+		}
+		return
+	}
+}
+
+// checkSession reports if the user session is still valid. Sessions exceeding
+// the idle timeout are removed. The session last activity time is updated at
+// most every sessionLastActivityUpdateInterval (or a tenth of the idle timeout
+// when lower) to avoid writing the user at every request.
+func (h *AuthHandler) checkSession(ctx context.Context, user *cstypes.User, sessionID string) bool {
+	session, ok := user.Sessions[sessionID]
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	if session.LastActivityTime == nil {
+		return true
+	}
+	idle := now.Sub(*session.LastActivityTime)
+
+	if h.session.IdleTimeout > 0 && idle > h.session.IdleTimeout {
+		if _, err := h.configstoreClient.DeleteUserSession(ctx, user.ID, sessionID); err != nil {
+			h.log.Errorf("failed to delete user %q expired session: %+v", user.Name, err)
+		}
+		return false
+	}
+
+	updateInterval := sessionLastActivityUpdateInterval
+	if h.session.IdleTimeout > 0 && h.session.IdleTimeout/10 < updateInterval {
+		updateInterval = h.session.IdleTimeout / 10
+	}
+	if idle >= updateInterval {
+		req := &csapitypes.UpdateUserSessionLastActivityRequest{LastActivityTime: now}
+		if _, err := h.configstoreClient.UpdateUserSessionLastActivity(ctx, user.ID, sessionID, req); err != nil {
+			h.log.Errorf("failed to update user %q session last activity time: %+v", user.Name, err)
+		}
+	}
+
+	return true
+}
+
+// cookieTokenExtractor extracts a token from the named cookie
+type cookieTokenExtractor string
+
+func (e cookieTokenExtractor) ExtractToken(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(string(e))
+	if err != nil || cookie.Value == "" {
+		return "", jwtrequest.ErrNoTokenInRequest
+	}
+	return cookie.Value, nil
+}
+
 func stripPrefixFromTokenString(prefix string) func(tok string) (string, error) {
 	return func(tok string) (string, error) {
 		pl := len(prefix)
@@ -169,7 +333,8 @@ var TokenExtractor = &jwtrequest.PostExtractionFilter{
 }
 
 // BearerTokenExtractor extracts a bearer token in format "bearer THETOKEN" from
-// Authorization header
+// Authorization header or from the access_token argument (used by clients, like
+// browser websockets, that cannot set the Authorization header)
 // Uses PostExtractionFilter to strip "Bearer " prefix from header
 var BearerTokenExtractor = &jwtrequest.PostExtractionFilter{
 	Extractor: jwtrequest.MultiExtractor{
@@ -178,3 +343,90 @@ var BearerTokenExtractor = &jwtrequest.PostExtractionFilter{
 	},
 	Filter: stripPrefixFromTokenString("bearer"),
 }
+
+// authError writes an api error response with only the status text as message
+// to not leak the reason of the authentication failure
+// isCookieAuthAllowed reports if the session cookie can authenticate the
+// request. Browsers send the cookie also with the cross site requests so, to
+// protect from cross site request forgery, the state changing requests must
+// provide the X-CSRF-Token header (cross site requests cannot set it without a
+// cors preflight accepted by the gateway) or come from an allowed origin.
+func (h *AuthHandler) isCookieAuthAllowed(r *http.Request) bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+
+	if r.Header.Get("X-CSRF-Token") != "" {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	for _, o := range h.session.AllowedOrigins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectAPIKeyRoutes are the routes, as "METHOD /route/template", allowed to
+// the project api keys: creating the project runs and reading their status.
+// Every other request authenticated with a project api key is forbidden.
+var projectAPIKeyRoutes = map[string]struct{}{
+	"POST /projects/{projectref}/createrun":                         {},
+	"GET /projects/{projectref}/runpreview":                         {},
+	"GET /projects/{projectref}/runconfigsource":                    {},
+	"GET /projects/{projectref}/commits/{commitsha}/requiredchecks": {},
+	"GET /runs":                                          {},
+	"GET /runs/{runid}":                                  {},
+	"GET /runs/{runid}/watch":                            {},
+	"GET /runs/{runid}/tasks/{taskid}":                   {},
+	"GET /runs/{runid}/tasks/{taskid}/logs/setup":        {},
+	"GET /runs/{runid}/tasks/{taskid}/logs/steps/{step}": {},
+	"GET /logs":                                          {},
+}
+
+// isProjectAPIKeyRequestAllowed reports if the request route is allowed to
+// project api keys. Routes with a project ref must reference the api key
+// project. The runs routes are further authorized by the handlers using the
+// project id saved in the context.
+func isProjectAPIKeyRequestAllowed(r *http.Request, project *csapitypes.Project) bool {
+	cr := mux.CurrentRoute(r)
+	if cr == nil {
+		return false
+	}
+	tpl, err := cr.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	if _, ok := projectAPIKeyRoutes[r.Method+" "+trimAPIPathPrefix(tpl)]; !ok {
+		return false
+	}
+
+	if projectRefVar, ok := mux.Vars(r)["projectref"]; ok {
+		projectRef, err := url.PathUnescape(projectRefVar)
+		if err != nil {
+			return false
+		}
+		if projectRef != project.ID && projectRef != project.Path {
+			return false
+		}
+	}
+
+	return true
+}
+
+func authError(w http.ResponseWriter, status int) {
+	resj, err := json.Marshal(&gwapitypes.ErrorResponse{Code: gwapitypes.ErrorCodeFromStatus(status), Message: http.StatusText(status)})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(resj)
+}
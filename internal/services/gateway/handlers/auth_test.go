@@ -0,0 +1,287 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/services/common"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+func TestProjectAPIKeyAuth(t *testing.T) {
+	apiKey := cstypes.ProjectAPIKeyPrefix + "key01"
+	project := &csapitypes.Project{
+		Project: &cstypes.Project{ID: "c6b6ef4e-5ad1-4b0f-94ed-6c4e8c3f0e4a", Name: "project01"},
+		Path:    "org/org01/project01",
+	}
+
+	// fake configstore resolving only the project api key
+	cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1alpha/projects" || r.URL.Query().Get("apikey") != apiKey {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]*csapitypes.Project{project})
+	}))
+	defer cs.Close()
+
+	authForcedHandler := NewAuthHandler(zap.NewNop(), csclient.NewClient(cs.URL), "", &common.TokenSigningData{}, &common.SessionConfig{CookieName: "agola_session"}, true)
+	authOptionalHandler := NewAuthHandler(zap.NewNop(), csclient.NewClient(cs.URL), "", &common.TokenSigningData{}, &common.SessionConfig{CookieName: "agola_session"}, false)
+
+	var gotProjectID string
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotProjectID, _ = r.Context().Value("projectid").(string)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	router := mux.NewRouter()
+	apirouter := mux.NewRouter().PathPrefix("/api/v1alpha").Subrouter().UseEncodedPath()
+	router.PathPrefix("/api/v1alpha").Handler(apirouter)
+	apirouter.Handle("/projects/{projectref}", authForcedHandler(okHandler)).Methods("DELETE")
+	apirouter.Handle("/projects/{projectref}/createrun", authForcedHandler(okHandler)).Methods("POST")
+	apirouter.Handle("/projects/{projectref}/secrets", authForcedHandler(okHandler)).Methods("GET")
+	apirouter.Handle("/orgs/{orgref}", authOptionalHandler(okHandler)).Methods("GET")
+	apirouter.Handle("/orgs/{orgref}/members/{userref}", authForcedHandler(okHandler)).Methods("PUT")
+	apirouter.Handle("/user", authForcedHandler(okHandler)).Methods("GET")
+	apirouter.Handle("/user/createrun", authForcedHandler(okHandler)).Methods("POST")
+	apirouter.Handle("/runs/{runid}", authOptionalHandler(okHandler)).Methods("GET")
+	apirouter.Handle("/runs/{runid}/actions", authForcedHandler(okHandler)).Methods("PUT")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		apiKey string
+		status int
+	}{
+		{
+			name:   "test create run of the api key project by path",
+			method: "POST",
+			path:   "/api/v1alpha/projects/org%2Forg01%2Fproject01/createrun",
+			status: http.StatusOK,
+		},
+		{
+			name:   "test create run of the api key project by id",
+			method: "POST",
+			path:   "/api/v1alpha/projects/" + project.ID + "/createrun",
+			status: http.StatusOK,
+		},
+		{
+			name:   "test get run",
+			method: "GET",
+			path:   "/api/v1alpha/runs/run01",
+			status: http.StatusOK,
+		},
+		{
+			name:   "test create run of another project",
+			method: "POST",
+			path:   "/api/v1alpha/projects/org%2Forg01%2Fproject02/createrun",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test delete the api key project",
+			method: "DELETE",
+			path:   "/api/v1alpha/projects/org%2Forg01%2Fproject01",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test get the api key project secrets",
+			method: "GET",
+			path:   "/api/v1alpha/projects/org%2Forg01%2Fproject01/secrets",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test get org",
+			method: "GET",
+			path:   "/api/v1alpha/orgs/org01",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test add org member",
+			method: "PUT",
+			path:   "/api/v1alpha/orgs/org01/members/user01",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test get user",
+			method: "GET",
+			path:   "/api/v1alpha/user",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test create user direct run",
+			method: "POST",
+			path:   "/api/v1alpha/user/createrun",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test run actions",
+			method: "PUT",
+			path:   "/api/v1alpha/runs/run01/actions",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test invalid api key",
+			method: "POST",
+			path:   "/api/v1alpha/projects/org%2Forg01%2Fproject01/createrun",
+			apiKey: cstypes.ProjectAPIKeyPrefix + "invalid",
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotProjectID = ""
+
+			key := apiKey
+			if tt.apiKey != "" {
+				key = tt.apiKey
+			}
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Authorization", "token "+key)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status == http.StatusOK && gotProjectID != project.ID {
+				t.Fatalf("expected project id %q in context, got %q", project.ID, gotProjectID)
+			}
+			if tt.status != http.StatusOK && gotProjectID != "" {
+				t.Fatalf("handler called for a forbidden request")
+			}
+		})
+	}
+}
+
+func TestSessionCookieCSRF(t *testing.T) {
+	user := &cstypes.User{ID: "0ba2ef63-6c3b-4e5e-9a59-3a4b2d6c1f20", Name: "user01"}
+
+	// fake configstore returning the user
+	cs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1alpha/users/"+user.ID {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(user)
+	}))
+	defer cs.Close()
+
+	sd := &common.TokenSigningData{Method: jwt.SigningMethodHS256, Key: []byte("key")}
+	session := &common.SessionConfig{CookieName: "agola_session", AllowedOrigins: []string{"https://agola.example.com"}}
+	token, err := common.GenerateGenericJWTToken(sd, jwt.MapClaims{"sub": user.ID, "exp": time.Now().Add(1 * time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	authForcedHandler := NewAuthHandler(zap.NewNop(), csclient.NewClient(cs.URL), "", sd, session, true)
+
+	var gotUserID string
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUserID, _ = r.Context().Value("userid").(string)
+		w.WriteHeader(http.StatusOK)
+	})
+	h := authForcedHandler(okHandler)
+
+	tests := []struct {
+		name   string
+		method string
+		header http.Header
+		cookie bool
+		status int
+	}{
+		{
+			name:   "test get with session cookie",
+			method: "GET",
+			cookie: true,
+			status: http.StatusOK,
+		},
+		{
+			name:   "test post with session cookie without csrf header or origin",
+			method: "POST",
+			cookie: true,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test post with session cookie from another origin",
+			method: "POST",
+			header: http.Header{"Origin": []string{"https://evil.example.com"}},
+			cookie: true,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "test delete with session cookie from an allowed origin",
+			method: "DELETE",
+			header: http.Header{"Origin": []string{"https://agola.example.com"}},
+			cookie: true,
+			status: http.StatusOK,
+		},
+		{
+			name:   "test put with session cookie and csrf header",
+			method: "PUT",
+			header: http.Header{"X-Csrf-Token": []string{"1"}},
+			cookie: true,
+			status: http.StatusOK,
+		},
+		{
+			name:   "test post with bearer token",
+			method: "POST",
+			header: http.Header{"Authorization": []string{"Bearer " + token}},
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotUserID = ""
+
+			r := httptest.NewRequest(tt.method, "/api/v1alpha/projects", nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			if tt.cookie {
+				r.AddCookie(session.Cookie(token))
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if tt.status == http.StatusOK && gotUserID != user.ID {
+				t.Fatalf("expected user id %q in context, got %q", user.ID, gotUserID)
+			}
+			if tt.status != http.StatusOK && gotUserID != "" {
+				t.Fatalf("handler called for a forbidden request")
+			}
+		})
+	}
+}
@@ -14,8 +14,21 @@
 
 package handlers
 
-import "net/http"
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
 
+var errRequestBodyTooLarge = errors.New("request body too large")
+
+// maxBytesHandler limits the size of the request body. Requests with a body
+// bigger than the limit are rejected with a 413 status code: before calling
+// the handler when the declared content length exceeds the limit, otherwise
+// when the handler reads more than the limit (so the body is never fully
+// buffered).
 type maxBytesHandler struct {
 	h http.Handler
 	n int64
@@ -30,9 +43,82 @@ func NewMaxBytesHandler(h http.Handler, n int64) *maxBytesHandler {
 
 func (h *maxBytesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.ContentLength > h.n {
-		http.Error(w, "request too large", http.StatusExpectationFailed)
+		http.Error(w, errRequestBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
 		return
 	}
-	r.Body = http.MaxBytesReader(w, r.Body, h.n)
-	h.h.ServeHTTP(w, r)
+	body := &maxBytesReader{rc: r.Body, n: h.n}
+	r.Body = body
+	h.h.ServeHTTP(&maxBytesResponseWriter{ResponseWriter: w, body: body}, r)
+}
+
+// maxBytesReader returns an error when reading more than n bytes
+type maxBytesReader struct {
+	rc       io.ReadCloser
+	n        int64
+	exceeded bool
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.exceeded {
+		return 0, errRequestBodyTooLarge
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// read one more byte to detect when the limit is exceeded
+	if int64(len(p)) > r.n+1 {
+		p = p[:r.n+1]
+	}
+	n, err := r.rc.Read(p)
+	if int64(n) <= r.n {
+		r.n -= int64(n)
+		return n, err
+	}
+	n = int(r.n)
+	r.n = 0
+	r.exceeded = true
+	return n, errRequestBodyTooLarge
+}
+
+func (r *maxBytesReader) Close() error {
+	return r.rc.Close()
+}
+
+// maxBytesResponseWriter replaces the status code of the response with 413
+// when the handler read a request body bigger than the limit
+type maxBytesResponseWriter struct {
+	http.ResponseWriter
+	body        *maxBytesReader
+	wroteHeader bool
+}
+
+func (w *maxBytesResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader && w.body.exceeded {
+		code = http.StatusRequestEntityTooLarge
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *maxBytesResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush is needed by the handlers streaming their response
+func (w *maxBytesResponseWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// Hijack is needed by the handlers upgrading the connection to a websocket
+func (w *maxBytesResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	return hj.Hijack()
 }
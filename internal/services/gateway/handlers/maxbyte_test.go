@@ -0,0 +1,195 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBytesHandler(t *testing.T) {
+	// readHandler reads the full body and reports the read error with a 400
+	// status code
+	readHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write(data)
+	})
+	// earlyWriteHandler writes the response status before reading the body
+	earlyWriteHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = ioutil.ReadAll(r.Body)
+	})
+
+	tests := []struct {
+		name string
+		h    http.Handler
+		body string
+		// unknownLength simulates a chunked request without a declared
+		// content length
+		unknownLength bool
+		status        int
+		out           string
+		notCalled     bool
+	}{
+		{
+			name:   "test body under limit",
+			h:      readHandler,
+			body:   "012345678",
+			status: http.StatusOK,
+			out:    "012345678",
+		},
+		{
+			name:   "test body at limit",
+			h:      readHandler,
+			body:   "0123456789",
+			status: http.StatusOK,
+			out:    "0123456789",
+		},
+		{
+			name:          "test body at limit without content length",
+			h:             readHandler,
+			body:          "0123456789",
+			unknownLength: true,
+			status:        http.StatusOK,
+			out:           "0123456789",
+		},
+		{
+			name:      "test declared content length over limit",
+			h:         readHandler,
+			body:      "01234567890",
+			status:    http.StatusRequestEntityTooLarge,
+			notCalled: true,
+		},
+		{
+			name:          "test body over limit without content length",
+			h:             readHandler,
+			body:          "01234567890",
+			unknownLength: true,
+			status:        http.StatusRequestEntityTooLarge,
+		},
+		{
+			// the status already written by the handler cannot be changed
+			name:          "test body over limit after the handler wrote the status",
+			h:             earlyWriteHandler,
+			body:          "01234567890",
+			unknownLength: true,
+			status:        http.StatusAccepted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				tt.h.ServeHTTP(w, r)
+			})
+
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if tt.unknownLength {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			NewMaxBytesHandler(h, 10).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("expected status %d, got %d", tt.status, w.Code)
+			}
+			if called == tt.notCalled {
+				t.Fatalf("expected handler called: %t, got: %t", !tt.notCalled, called)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.out {
+				t.Fatalf("expected body %q, got %q", tt.out, w.Body.String())
+			}
+		})
+	}
+}
+
+// hijackRecorder is a response recorder supporting hijacking
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+
+	hijacked bool
+}
+
+func (w *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	c1, c2 := net.Pipe()
+	c2.Close()
+	return c1, bufio.NewReadWriter(bufio.NewReader(c1), bufio.NewWriter(c1)), nil
+}
+
+func TestMaxBytesHandlerFlush(t *testing.T) {
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fl, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatalf("expected response writer implementing http.Flusher")
+		}
+		_, _ = w.Write([]byte("data"))
+		fl.Flush()
+	})
+
+	w := httptest.NewRecorder()
+	NewMaxBytesHandler(h, 10).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if !w.Flushed {
+		t.Fatalf("expected flushed response")
+	}
+}
+
+func TestMaxBytesHandlerHijack(t *testing.T) {
+	var hijackErr error
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatalf("expected response writer implementing http.Hijacker")
+		}
+		var c net.Conn
+		c, _, hijackErr = hj.Hijack()
+		if c != nil {
+			c.Close()
+		}
+	})
+
+	t.Run("test hijack supported", func(t *testing.T) {
+		w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+		NewMaxBytesHandler(h, 10).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if hijackErr != nil {
+			t.Fatalf("unexpected err: %v", hijackErr)
+		}
+		if !w.hijacked {
+			t.Fatalf("expected hijacked connection")
+		}
+	})
+
+	t.Run("test hijack not supported", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		NewMaxBytesHandler(h, 10).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		if hijackErr == nil {
+			t.Fatalf("expected error, got nil")
+		}
+	})
+}
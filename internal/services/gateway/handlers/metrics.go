@@ -0,0 +1,117 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// the route label is the route path template (not the raw request path)
+	// to keep the labels cardinality bounded
+	httpRequestsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "agola_gateway_http_requests_total",
+			Help: "Total number of gateway http requests by route, method and status code.",
+		},
+		[]string{"route", "method", "code"},
+	)
+	httpRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "agola_gateway_http_request_duration_seconds",
+			Help:    "Gateway http requests latency by route and method.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "method"},
+	)
+	authFailuresCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "agola_gateway_auth_failures_total",
+			Help: "Total number of gateway requests rejected since not authenticated.",
+		},
+		[]string{"reason"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(httpRequestsCounter)
+	prometheus.MustRegister(httpRequestDuration)
+	prometheus.MustRegister(authFailuresCounter)
+}
+
+const (
+	authFailureReasonMissingToken   = "missing_token"
+	authFailureReasonInvalidToken   = "invalid_token"
+	authFailureReasonUnknownUser    = "unknown_user"
+	authFailureReasonExpiredSession = "expired_session"
+	authFailureReasonForbiddenRoute = "forbidden_route"
+	authFailureReasonCSRF           = "csrf"
+)
+
+// statusResponseWriter records the response status code
+type statusResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush is needed by the handlers streaming their response
+func (w *statusResponseWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// NewMetricsHandler is a mux middleware recording the requests count and
+// latency of the matched route.
+func NewMetricsHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+
+		sw := &statusResponseWriter{ResponseWriter: w}
+		start := time.Now()
+		h.ServeHTTP(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequestsCounter.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -32,12 +32,15 @@ const configTplText = `
 const CONFIG = {
   API_URL: '{{.ApiURL}}',
   API_BASE_PATH: '{{.ApiBasePath}}',
+  BASE_PATH: '{{.BasePath}}',
 }
 
 window.CONFIG = CONFIG
 `
 
-func NewWebBundleHandlerFunc(gatewayURL string) func(w http.ResponseWriter, r *http.Request) {
+// NewWebBundleHandlerFunc serves the webapp. basePath is the path prefix under
+// which the gateway is exposed, already removed from the request path.
+func NewWebBundleHandlerFunc(gatewayURL, basePath string) func(w http.ResponseWriter, r *http.Request) {
 	var buf bytes.Buffer
 	configTpl, err := template.New("config").Parse(configTplText)
 	if err != nil {
@@ -47,9 +50,11 @@ func NewWebBundleHandlerFunc(gatewayURL string) func(w http.ResponseWriter, r *h
 	configTplData := struct {
 		ApiURL      string
 		ApiBasePath string
+		BasePath    string
 	}{
 		gatewayURL,
 		"/api/v1alpha",
+		basePath,
 	}
 	if err := configTpl.Execute(&buf, configTplData); err != nil {
 		panic(err)
@@ -16,17 +16,16 @@ package gitserver
 
 import (
 	"context"
-	"crypto/tls"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
+	"agola.io/agola/internal/common"
 	handlers "agola.io/agola/internal/git-handler"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/services/config"
-	"agola.io/agola/internal/util"
 
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
@@ -144,6 +143,16 @@ func NewGitserver(ctx context.Context, l *zap.Logger, c *config.Gitserver) (*Git
 	}, nil
 }
 
+// Reload applies the git server config changes that don't require a restart.
+// Currently only the log level.
+func (s *Gitserver) Reload(c *config.Gitserver) {
+	if c.Debug {
+		level.SetLevel(zapcore.DebugLevel)
+	} else {
+		level.SetLevel(zapcore.InfoLevel)
+	}
+}
+
 func (s *Gitserver) Run(ctx context.Context) error {
 	gitSmartHandler := handlers.NewGitSmartHandler(logger, s.c.DataDir, true, repoAbsPath, nil)
 	fetchFileHandler := handlers.NewFetchFileHandler(logger, s.c.DataDir, repoAbsPath)
@@ -154,14 +163,10 @@ func (s *Gitserver) Run(ctx context.Context) error {
 	router.MatcherFunc(Matcher(handlers.ReceivePackRegExp)).Handler(gitSmartHandler)
 	router.MatcherFunc(Matcher(handlers.FetchFileRegExp)).Handler(fetchFileHandler)
 
-	var tlsConfig *tls.Config
-	if s.c.Web.TLS {
-		var err error
-		tlsConfig, err = util.NewTLSConfig(s.c.Web.TLSCertFile, s.c.Web.TLSKeyFile, "", false)
-		if err != nil {
-			log.Errorf("err: %+v")
-			return err
-		}
+	tlsConfig, err := common.NewTLSServerConfig(&s.c.Web)
+	if err != nil {
+		log.Errorf("err: %+v", err)
+		return err
 	}
 
 	httpServer := http.Server{
@@ -172,7 +177,7 @@ func (s *Gitserver) Run(ctx context.Context) error {
 
 	lerrCh := make(chan error)
 	go func() {
-		lerrCh <- httpServer.ListenAndServe()
+		lerrCh <- common.ListenAndServe(&httpServer)
 	}()
 
 	select {
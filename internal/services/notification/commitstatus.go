@@ -22,6 +22,7 @@ import (
 	gitsource "agola.io/agola/internal/gitsources"
 	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/gateway/action"
+	csapitypes "agola.io/agola/services/configstore/api/types"
 	rstypes "agola.io/agola/services/runservice/types"
 
 	errors "golang.org/x/xerrors"
@@ -85,7 +86,25 @@ func (n *NotificationService) updateCommitStatus(ctx context.Context, ev *rstype
 		return errors.Errorf("failed to get remote source %q: %w", la.RemoteSourceID, err)
 	}
 
-	// TODO(sgotti) handle refreshing oauth2 tokens
+	changed, rerr := common.RefreshLinkedAccount(rs, la)
+	if changed {
+		creq := &csapitypes.UpdateUserLARequest{
+			RemoteUserID:               la.RemoteUserID,
+			RemoteUserName:             la.RemoteUserName,
+			UserAccessToken:            la.UserAccessToken,
+			Oauth2AccessToken:          la.Oauth2AccessToken,
+			Oauth2RefreshToken:         la.Oauth2RefreshToken,
+			Oauth2AccessTokenExpiresAt: la.Oauth2AccessTokenExpiresAt,
+			NeedsReauth:                la.NeedsReauth,
+		}
+		if _, _, err := n.configstoreClient.UpdateUserLA(ctx, user.ID, la.ID, creq); err != nil {
+			return errors.Errorf("failed to update linked account %q of user %q: %w", la.ID, user.Name, err)
+		}
+	}
+	if rerr != nil {
+		return errors.Errorf("failed to refresh linked account %q of user %q: %w", la.ID, user.Name, rerr)
+	}
+
 	gitSource, err := common.GetGitSource(rs, la)
 	if err != nil {
 		return errors.Errorf("failed to create gitea client: %w", err)
@@ -16,6 +16,8 @@ package notification
 
 import (
 	"context"
+	"net/http"
+	"sync"
 
 	"agola.io/agola/internal/common"
 	"agola.io/agola/internal/etcd"
@@ -26,6 +28,7 @@ import (
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	errors "golang.org/x/xerrors"
 )
 
 var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
@@ -40,6 +43,12 @@ type NotificationService struct {
 
 	runserviceClient  *rsclient.Client
 	configstoreClient *csclient.Client
+
+	// routingMutex protects the notifiers and routes that can be changed by
+	// a config reload
+	routingMutex sync.RWMutex
+	notifiers    map[string]notifier
+	routes       []config.NotificationRoute
 }
 
 func NewNotificationService(ctx context.Context, l *zap.Logger, gc *config.Config) (*NotificationService, error) {
@@ -58,8 +67,18 @@ func NewNotificationService(ctx context.Context, l *zap.Logger, gc *config.Confi
 		return nil, err
 	}
 
+	configstoreHTTPClient, err := common.NewHTTPClient(c.ConfigstoreTLS)
+	if err != nil {
+		return nil, errors.Errorf("failed to create configstore http client: %w", err)
+	}
 	configstoreClient := csclient.NewClient(c.ConfigstoreURL)
+	configstoreClient.SetHTTPClient(configstoreHTTPClient)
+	runserviceHTTPClient, err := common.NewHTTPClient(c.RunserviceTLS)
+	if err != nil {
+		return nil, errors.Errorf("failed to create runservice http client: %w", err)
+	}
 	runserviceClient := rsclient.NewClient(c.RunserviceURL)
+	runserviceClient.SetHTTPClient(runserviceHTTPClient)
 
 	return &NotificationService{
 		gc:                gc,
@@ -67,9 +86,46 @@ func NewNotificationService(ctx context.Context, l *zap.Logger, gc *config.Confi
 		e:                 e,
 		runserviceClient:  runserviceClient,
 		configstoreClient: configstoreClient,
+		notifiers:         newNotifiers(c.Notifiers),
+		routes:            c.Routes,
 	}, nil
 }
 
+func newNotifiers(ncs []config.Notifier) map[string]notifier {
+	notifiersClient := &http.Client{Timeout: notifierRequestTimeout}
+	notifiers := map[string]notifier{}
+	for _, nc := range ncs {
+		notifiers[nc.Name] = newNotifier(nc, notifiersClient)
+	}
+	return notifiers
+}
+
+// Reload applies the notification config changes that don't require a
+// restart: the log level and the notifiers and routes.
+func (n *NotificationService) Reload(gc *config.Config) {
+	c := &gc.Notification
+
+	if c.Debug {
+		level.SetLevel(zapcore.DebugLevel)
+	} else {
+		level.SetLevel(zapcore.InfoLevel)
+	}
+
+	notifiers := newNotifiers(c.Notifiers)
+
+	n.routingMutex.Lock()
+	defer n.routingMutex.Unlock()
+	n.notifiers = notifiers
+	n.routes = c.Routes
+}
+
+// routing returns the current notifiers and routes
+func (n *NotificationService) routing() (map[string]notifier, []config.NotificationRoute) {
+	n.routingMutex.RLock()
+	defer n.routingMutex.RUnlock()
+	return n.notifiers, n.routes
+}
+
 func (n *NotificationService) Run(ctx context.Context) error {
 	go n.runEventsHandlerLoop(ctx)
 
@@ -0,0 +1,192 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/config"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	notifierRequestTimeout = 10 * time.Second
+
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// runNotification is the run event sent to the notifiers
+type runNotification struct {
+	EventType config.NotificationEventType `json:"event_type"`
+
+	RunID      string            `json:"run_id"`
+	RunName    string            `json:"run_name"`
+	RunCounter uint64            `json:"run_counter"`
+	Phase      rstypes.RunPhase  `json:"phase"`
+	Result     rstypes.RunResult `json:"result"`
+	RunURL     string            `json:"run_url"`
+
+	ProjectID   string `json:"project_id"`
+	ProjectPath string `json:"project_path"`
+
+	Branch    string `json:"branch,omitempty"`
+	Tag       string `json:"tag,omitempty"`
+	Ref       string `json:"ref"`
+	CommitSHA string `json:"commit_sha"`
+
+	// Tags are the run tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+func (rn *runNotification) summary() string {
+	var status string
+	switch rn.EventType {
+	case config.NotificationEventTypeRunStarted:
+		status = "started"
+	case config.NotificationEventTypeRunSuccess:
+		status = "finished successfully"
+	case config.NotificationEventTypeRunFailed:
+		status = "failed"
+	case config.NotificationEventTypeRunError:
+		status = "encountered an error"
+	}
+	return fmt.Sprintf("Run %s #%d of project %s (%s) %s", rn.RunName, rn.RunCounter, rn.ProjectPath, rn.Ref, status)
+}
+
+type notifier interface {
+	Notify(ctx context.Context, rn *runNotification) error
+}
+
+func newNotifier(c config.Notifier, client *http.Client) notifier {
+	switch c.Type {
+	case config.NotifierTypeWebhook:
+		return &webhookNotifier{client: client, url: c.URL}
+	case config.NotifierTypeSlack:
+		return &slackNotifier{client: client, url: c.URL}
+	case config.NotifierTypePagerDuty:
+		return &pagerDutyNotifier{client: client, url: pagerDutyEventsURL, routingKey: c.RoutingKey}
+	}
+	return nil
+}
+
+// webhookNotifier sends the run notification as json
+type webhookNotifier struct {
+	client *http.Client
+	url    string
+}
+
+func (w *webhookNotifier) Notify(ctx context.Context, rn *runNotification) error {
+	return postJSON(ctx, w.client, w.url, rn)
+}
+
+// slackNotifier sends a message to a slack incoming webhook
+type slackNotifier struct {
+	client *http.Client
+	url    string
+}
+
+type slackMessage struct {
+	Text string `json:"text"`
+}
+
+func (s *slackNotifier) Notify(ctx context.Context, rn *runNotification) error {
+	msg := &slackMessage{
+		Text: fmt.Sprintf("%s: <%s|open run>", rn.summary(), rn.RunURL),
+	}
+	return postJSON(ctx, s.client, s.url, msg)
+}
+
+// pagerDutyNotifier triggers a pagerduty event using the events api v2
+type pagerDutyNotifier struct {
+	client     *http.Client
+	url        string
+	routingKey string
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+	Links       []pagerDutyLink  `json:"links"`
+}
+
+type pagerDutyPayload struct {
+	Summary  string `json:"summary"`
+	Source   string `json:"source"`
+	Severity string `json:"severity"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+func (p *pagerDutyNotifier) Notify(ctx context.Context, rn *runNotification) error {
+	severity := "info"
+	if rn.EventType == config.NotificationEventTypeRunFailed || rn.EventType == config.NotificationEventTypeRunError {
+		severity = "error"
+	}
+
+	ev := &pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		// use the same dedup key for all the events of the same run
+		DedupKey: rn.RunID,
+		Payload: pagerDutyPayload{
+			Summary:  rn.summary(),
+			Source:   rn.ProjectPath,
+			Severity: severity,
+		},
+		Links: []pagerDutyLink{{Href: rn.RunURL, Text: "Run"}},
+	}
+	return postJSON(ctx, p.client, p.url, ev)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// drain the body to reuse the connection
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("received http status: %d", resp.StatusCode)
+	}
+	return nil
+}
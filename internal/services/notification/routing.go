@@ -0,0 +1,179 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"context"
+	"path"
+
+	"agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/config"
+	"agola.io/agola/internal/services/gateway/action"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// runEventType returns the notification event type of a run event. It returns
+// an empty string for the run events that aren't notified
+func runEventType(ev *rstypes.RunEvent) config.NotificationEventType {
+	switch {
+	case ev.Phase == rstypes.RunPhaseSetupError, ev.Phase == rstypes.RunPhaseCancelled:
+		return config.NotificationEventTypeRunError
+	case ev.Phase == rstypes.RunPhaseRunning && ev.Result == rstypes.RunResultUnknown:
+		return config.NotificationEventTypeRunStarted
+	case ev.Phase == rstypes.RunPhaseFinished:
+		switch ev.Result {
+		case rstypes.RunResultSuccess:
+			return config.NotificationEventTypeRunSuccess
+		case rstypes.RunResultStopped, rstypes.RunResultFailed:
+			return config.NotificationEventTypeRunFailed
+		}
+	}
+	return ""
+}
+
+// routeNotifiers returns the names, without duplicates, of the notifiers of
+// all the routes matching the provided event type, project path, branch and run
+// tags
+func routeNotifiers(routes []config.NotificationRoute, eventType config.NotificationEventType, projectPath, branch string, tags []string) []string {
+	notifiers := []string{}
+	seen := map[string]struct{}{}
+
+	for _, r := range routes {
+		if len(r.Events) > 0 && !matchEventType(r.Events, eventType) {
+			continue
+		}
+		if len(r.Projects) > 0 && !matchPatterns(r.Projects, projectPath) {
+			continue
+		}
+		if len(r.Branches) > 0 && (branch == "" || !matchPatterns(r.Branches, branch)) {
+			continue
+		}
+		if len(r.Tags) > 0 && !matchTags(r.Tags, tags) {
+			continue
+		}
+
+		for _, name := range r.Notifiers {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			notifiers = append(notifiers, name)
+		}
+	}
+
+	return notifiers
+}
+
+func matchEventType(eventTypes []config.NotificationEventType, eventType config.NotificationEventType) bool {
+	for _, et := range eventTypes {
+		if et == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTags(routeTags, tags []string) bool {
+	for _, rt := range routeTags {
+		for _, t := range tags {
+			if rt == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchPatterns(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		// the patterns are already validated
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sendRunNotifications sends the run event to the notifiers of the matching
+// routes
+func (n *NotificationService) sendRunNotifications(ctx context.Context, ev *rstypes.RunEvent) error {
+	notifiers, routes := n.routing()
+	if len(routes) == 0 {
+		return nil
+	}
+
+	eventType := runEventType(ev)
+	if eventType == "" {
+		return nil
+	}
+
+	run, _, err := n.runserviceClient.GetRun(ctx, ev.RunID, nil)
+	if err != nil {
+		return err
+	}
+	groupType, groupID, err := common.GroupTypeIDFromRunGroup(run.RunConfig.Group)
+	if err != nil {
+		return err
+	}
+
+	// ignore user direct runs
+	if groupType == common.GroupTypeUser {
+		return nil
+	}
+
+	project, _, err := n.configstoreClient.GetProject(ctx, groupID)
+	if err != nil {
+		return errors.Errorf("failed to get project %s: %w", groupID, err)
+	}
+
+	branch := run.Run.Annotations[action.AnnotationBranch]
+
+	notifierNames := routeNotifiers(routes, eventType, project.Path, branch, run.Run.Tags)
+	if len(notifierNames) == 0 {
+		return nil
+	}
+
+	runURL, err := webRunURL(n.c.WebExposedURL, project.ID, run.Run.ID)
+	if err != nil {
+		return errors.Errorf("failed to generate run url: %w", err)
+	}
+
+	rn := &runNotification{
+		EventType:   eventType,
+		RunID:       run.Run.ID,
+		RunName:     run.RunConfig.Name,
+		RunCounter:  run.Run.Counter,
+		Phase:       ev.Phase,
+		Result:      ev.Result,
+		RunURL:      runURL,
+		ProjectID:   project.ID,
+		ProjectPath: project.Path,
+		Branch:      branch,
+		Tag:         run.Run.Annotations[action.AnnotationTag],
+		Ref:         run.Run.Annotations[action.AnnotationRef],
+		CommitSHA:   run.Run.Annotations[action.AnnotationCommitSHA],
+		Tags:        run.Run.Tags,
+	}
+
+	for _, name := range notifierNames {
+		if err := notifiers[name].Notify(ctx, rn); err != nil {
+			log.Infof("failed to send run %q notification to notifier %q: %v", run.Run.ID, name, err)
+		}
+	}
+
+	return nil
+}
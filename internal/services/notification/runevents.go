@@ -113,6 +113,9 @@ func (n *NotificationService) runEventsHandler(ctx context.Context) error {
 			if err := n.updateCommitStatus(ctx, ev); err != nil {
 				log.Infof("failed to update commit status: %v", err)
 			}
+			if err := n.sendRunNotifications(ctx, ev); err != nil {
+				log.Infof("failed to send run notifications: %v", err)
+			}
 
 		default:
 			return errors.Errorf("wrong data")
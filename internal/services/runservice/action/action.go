@@ -18,6 +18,10 @@ import (
 	"context"
 	"fmt"
 	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"agola.io/agola/internal/datamanager"
@@ -29,9 +33,11 @@ import (
 	"agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/readdb"
 	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/tracing"
 	"agola.io/agola/internal/util"
 	"agola.io/agola/services/runservice/types"
 
+	"go.etcd.io/etcd/clientv3/concurrency"
 	"go.uber.org/zap"
 	errors "golang.org/x/xerrors"
 )
@@ -41,8 +47,18 @@ type ActionHandler struct {
 	e               *etcd.Store
 	readDB          *readdb.ReadDB
 	ost             *objectstorage.ObjStorage
+	archivesOST     *objectstorage.ObjStorage
 	dm              *datamanager.DataManager
 	maintenanceMode bool
+
+	schedulingPauseWindows []*SchedulingPauseWindow
+
+	idTokenSigner      *IDTokenSigner
+	idTokenSignerMutex sync.RWMutex
+
+	// rescheduleRestartedExecutorTasks reports if the not finished tasks of a
+	// restarted executor are rescheduled instead of failed
+	rescheduleRestartedExecutorTasks bool
 }
 
 func NewActionHandler(logger *zap.Logger, e *etcd.Store, readDB *readdb.ReadDB, ost *objectstorage.ObjStorage, dm *datamanager.DataManager) *ActionHandler {
@@ -51,6 +67,7 @@ func NewActionHandler(logger *zap.Logger, e *etcd.Store, readDB *readdb.ReadDB,
 		e:               e,
 		readDB:          readDB,
 		ost:             ost,
+		archivesOST:     ost,
 		dm:              dm,
 		maintenanceMode: false,
 	}
@@ -60,6 +77,16 @@ func (h *ActionHandler) SetMaintenanceMode(maintenanceMode bool) {
 	h.maintenanceMode = maintenanceMode
 }
 
+func (h *ActionHandler) SetRescheduleRestartedExecutorTasks(reschedule bool) {
+	h.rescheduleRestartedExecutorTasks = reschedule
+}
+
+// SetArchivesObjectStorage sets the object storage of the tasks workspace
+// archives when different from the default one
+func (h *ActionHandler) SetArchivesObjectStorage(ost *objectstorage.ObjStorage) {
+	h.archivesOST = ost
+}
+
 type RunChangePhaseRequest struct {
 	RunID                   string
 	Phase                   types.RunPhase
@@ -84,6 +111,20 @@ func (h *ActionHandler) ChangeRunPhase(ctx context.Context, req *RunChangePhaseR
 		if r.Phase != types.RunPhaseQueued {
 			return errors.Errorf("run %q is not queued but in %q phase", r.ID, r.Phase)
 		}
+		deps, err := h.GetRunDependenciesStatus(ctx, r)
+		if err != nil {
+			return err
+		}
+		if !deps.Satisfied {
+			return util.NewErrBadRequest(errors.Errorf("run %q is waiting on its upstream runs", r.ID))
+		}
+		activeRuns, err := store.GetRuns(ctx, h.e)
+		if err != nil {
+			return err
+		}
+		if olderRun := olderQueuedGroupRun(activeRuns, r); olderRun != nil {
+			return util.NewErrBadRequest(errors.Errorf("run %q cannot be started before the older queued run %q of group %q", r.ID, olderRun.ID, r.Group))
+		}
 		r.ChangePhase(types.RunPhaseRunning)
 		runEvent, err = common.NewRunEvent(ctx, h.e, r.ID, r.Phase, r.Result)
 		if err != nil {
@@ -107,6 +148,30 @@ func (h *ActionHandler) ChangeRunPhase(ctx context.Context, req *RunChangePhaseR
 	return err
 }
 
+// olderQueuedGroupRun returns the oldest queued run of the same group of the
+// provided run created before it. It returns nil if there's none.
+//
+// The runs of a group are started in creation (run id) order: a run can be
+// started only when there're no older queued runs in its group. Since runs of
+// the same group are created holding the run group lock (see CreateRun), when
+// a run exists all the older runs of its group already exist, so checking the
+// active runs is enough to guarantee the ordering.
+func olderQueuedGroupRun(activeRuns []*types.Run, r *types.Run) *types.Run {
+	var olderRun *types.Run
+	for _, ar := range activeRuns {
+		if ar.Group != r.Group || ar.Phase != types.RunPhaseQueued {
+			continue
+		}
+		if ar.ID >= r.ID {
+			continue
+		}
+		if olderRun == nil || ar.ID < olderRun.ID {
+			olderRun = ar
+		}
+	}
+	return olderRun
+}
+
 type RunStopRequest struct {
 	RunID                   string
 	ChangeGroupsUpdateToken string
@@ -139,36 +204,145 @@ type RunCreateRequest struct {
 	SetupErrors       []string
 	StaticEnvironment map[string]string
 	CacheGroup        string
+	CommitSHA         string
+	CommitAuthorName  string
+	CommitAuthorEmail string
+	CommitMessage     string
+	Untrusted         bool
+	WebhookDeliveryID string
+	Replayed          bool
+	// DependsOn are the ids of the upstream runs that must successfully
+	// finish before the run is started
+	DependsOn []string
+	// Tags are the run tags
+	Tags []string
+	// NoRunsReason creates a run, without tasks, only reporting why an event
+	// didn't create any run
+	NoRunsReason string
 
 	// existing run fields
-	RunID      string
-	FromStart  bool
+	RunID     string
+	FromStart bool
+	// FromTask is the name of the task from which the run is restarted. The
+	// task and all its childs are recreated while the other successful tasks
+	// are reused
+	FromTask   string
 	ResetTasks []string
 
 	// common fields
 	Environment map[string]string
 	Annotations map[string]string
+	TriggerType string
+	TriggeredBy string
+	// ExecutorID pins the run tasks to the provided executor
+	ExecutorID string
+	// DebugHold keeps the pods of the failed tasks running to debug them
+	DebugHold bool
+	// PreviewEnvironment is the pull request preview environment deployed or
+	// torn down by a new run
+	PreviewEnvironment *types.RunPreviewEnvironment
 
 	ChangeGroupsUpdateToken string
 }
 
 func (h *ActionHandler) CreateRun(ctx context.Context, req *RunCreateRequest) (*types.RunBundle, error) {
+	ctx, span := tracing.StartSpan(ctx, "runservice.create_run")
+	defer span.End()
+
 	runcgt, err := types.UnmarshalChangeGroupsUpdateToken(req.ChangeGroupsUpdateToken)
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
 
+	if req.ExecutorID != "" {
+		if err := h.checkPinnedExecutor(ctx, req.ExecutorID); err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+	}
+
+	group := req.Group
+	var run *types.Run
+	if req.RunID != "" {
+		run, err = store.GetRunEtcdOrOST(ctx, h.e, h.dm, req.RunID)
+		if err != nil {
+			span.SetError(err)
+			return nil, err
+		}
+		if run == nil {
+			err := util.NewErrBadRequest(errors.Errorf("run %q doesn't exist", req.RunID))
+			span.SetError(err)
+			return nil, err
+		}
+		group = run.Group
+	}
+
+	// hold the run group lock from the run id generation until the run is
+	// saved, so runs of the same group are saved in run id order and can be
+	// started in creation order
+	unlock, err := h.lockRunGroup(ctx, group)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	defer unlock()
+
 	var rb *types.RunBundle
 	if req.RunID == "" {
 		rb, err = h.newRun(ctx, req)
 	} else {
-		rb, err = h.recreateRun(ctx, req)
+		rb, err = h.recreateRun(ctx, req, run)
 	}
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
 
-	return rb, h.saveRun(ctx, rb, runcgt)
+	// save the run creation span context so the spans of the run scheduling
+	// and execution will be part of the same trace
+	rb.Run.TraceParent = tracing.TraceParentFromContext(ctx)
+	span.SetAttribute("agola.run_id", rb.Run.ID)
+
+	err = h.saveRun(ctx, rb, runcgt)
+	span.SetError(err)
+	return rb, err
+}
+
+// lockRunGroup acquires the run group lock. The returned function releases
+// it.
+func (h *ActionHandler) lockRunGroup(ctx context.Context, group string) (func(), error) {
+	session, err := concurrency.NewSession(h.e.Client(), concurrency.WithTTL(5), concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	m := etcd.NewMutex(session, common.EtcdRunGroupLockKey(group))
+	if err := m.Lock(ctx); err != nil {
+		session.Close()
+		return nil, errors.Errorf("failed to lock run group %q: %w", group, err)
+	}
+
+	return func() {
+		_ = m.Unlock(ctx)
+		session.Close()
+	}, nil
+}
+
+// checkPinnedExecutor checks that the executor where a run should be pinned
+// exists and isn't draining
+func (h *ActionHandler) checkPinnedExecutor(ctx context.Context, executorID string) error {
+	executor, err := store.GetExecutor(ctx, h.e, executorID)
+	if err != nil {
+		if err == etcd.ErrKeyNotFound {
+			return util.NewErrBadRequest(errors.Errorf("executor %q doesn't exist", executorID))
+		}
+		return err
+	}
+	if executor.Draining {
+		return util.NewErrBadRequest(errors.Errorf("executor %q is draining", executorID))
+	}
+	return nil
 }
 
 func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*types.RunBundle, error) {
@@ -181,8 +355,26 @@ func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*typ
 	if !path.IsAbs(req.Group) {
 		return nil, util.NewErrBadRequest(errors.Errorf("run group %q must be an absolute path", req.Group))
 	}
-	if req.RunConfigTasks == nil && len(setupErrors) == 0 {
-		return nil, util.NewErrBadRequest(errors.Errorf("empty run config tasks and setup errors"))
+	if req.RunConfigTasks == nil && len(setupErrors) == 0 && req.NoRunsReason == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty run config tasks, setup errors and no runs reason"))
+	}
+	if req.PreviewEnvironment != nil && req.PreviewEnvironment.Name == "" {
+		return nil, util.NewErrBadRequest(errors.Errorf("empty preview environment name"))
+	}
+	tags, err := normalizeRunTags(req.Tags)
+	if err != nil {
+		return nil, err
+	}
+	// a run can only depend on already existing runs so the run dependencies
+	// cannot contain cycles
+	for _, upstreamRunID := range req.DependsOn {
+		upstreamRun, err := store.GetRunEtcdOrOST(ctx, h.e, h.dm, upstreamRunID)
+		if err != nil {
+			return nil, err
+		}
+		if upstreamRun == nil {
+			return nil, util.NewErrBadRequest(errors.Errorf("upstream run %q doesn't exist", upstreamRunID))
+		}
 	}
 
 	// generate a new run sequence that will be the same for the run and runconfig
@@ -210,14 +402,31 @@ func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*typ
 		Name:              req.Name,
 		Group:             req.Group,
 		SetupErrors:       setupErrors,
+		NoRunsReason:      req.NoRunsReason,
 		Tasks:             rcts,
 		StaticEnvironment: req.StaticEnvironment,
 		Environment:       req.Environment,
 		Annotations:       req.Annotations,
 		CacheGroup:        req.CacheGroup,
+		ExecutorID:        req.ExecutorID,
+		DebugHold:         req.DebugHold,
 	}
 
 	run := genRun(rc)
+	run.DependsOn = req.DependsOn
+	run.PreviewEnvironment = req.PreviewEnvironment
+	run.Tags = tags
+	run.Trigger = &types.RunTrigger{
+		Type:              req.TriggerType,
+		TriggeredBy:       req.TriggeredBy,
+		CommitSHA:         req.CommitSHA,
+		CommitAuthorName:  req.CommitAuthorName,
+		CommitAuthorEmail: req.CommitAuthorEmail,
+		CommitMessage:     req.CommitMessage,
+		Untrusted:         req.Untrusted,
+		WebhookDeliveryID: req.WebhookDeliveryID,
+		Replayed:          req.Replayed,
+	}
 	h.log.Debugf("created run: %s", util.Dump(run))
 
 	return &types.RunBundle{
@@ -226,7 +435,7 @@ func (h *ActionHandler) newRun(ctx context.Context, req *RunCreateRequest) (*typ
 	}, nil
 }
 
-func (h *ActionHandler) recreateRun(ctx context.Context, req *RunCreateRequest) (*types.RunBundle, error) {
+func (h *ActionHandler) recreateRun(ctx context.Context, req *RunCreateRequest, run *types.Run) (*types.RunBundle, error) {
 	// generate a new run sequence that will be the same for the run and runconfig
 	seq, err := sequence.IncSequence(ctx, h.e, common.EtcdRunSequenceKey)
 	if err != nil {
@@ -241,22 +450,39 @@ func (h *ActionHandler) recreateRun(ctx context.Context, req *RunCreateRequest)
 		return nil, util.NewErrBadRequest(errors.Errorf("runconfig %q doesn't exist: %w", req.RunID, err))
 	}
 
-	run, err := store.GetRunEtcdOrOST(ctx, h.e, h.dm, req.RunID)
-	if err != nil {
+	h.log.Debugf("rc: %s", util.Dump(rc))
+	h.log.Debugf("run: %s", util.Dump(run))
+
+	if err := validateEnvironmentOverrides(req.Environment); err != nil {
 		return nil, err
 	}
-	if run == nil {
-		return nil, util.NewErrBadRequest(errors.Errorf("run %q doesn't exist: %w", req.RunID, err))
-	}
 
-	h.log.Debugf("rc: %s", util.Dump(rc))
-	h.log.Debugf("run: %s", util.Dump(run))
+	// keep the ids of the tasks of the existing run to detect the recreated ones
+	runTasksIDs := map[string]struct{}{}
+	for rtID := range run.Tasks {
+		runTasksIDs[rtID] = struct{}{}
+	}
 
-	if req.FromStart {
+	switch {
+	case req.FromTask != "":
+		var fromTask *types.RunConfigTask
+		for _, rct := range rc.Tasks {
+			if rct.Name == req.FromTask {
+				fromTask = rct
+				break
+			}
+		}
+		if fromTask == nil {
+			return nil, util.NewErrBadRequest(errors.Errorf("run %q doesn't have a task named %q", run.ID, req.FromTask))
+		}
+		if canRestart, reason := run.CanRestartFromTask(fromTask.ID); !canRestart {
+			return nil, util.NewErrBadRequest(errors.Errorf("run cannot be restarted: %s", reason))
+		}
+	case req.FromStart:
 		if canRestart, reason := run.CanRestartFromScratch(); !canRestart {
 			return nil, util.NewErrBadRequest(errors.Errorf("run cannot be restarted: %s", reason))
 		}
-	} else {
+	default:
 		if canRestart, reason := run.CanRestartFromFailedTasks(); !canRestart {
 			return nil, util.NewErrBadRequest(errors.Errorf("run cannot be restarted: %s", reason))
 		}
@@ -264,17 +490,132 @@ func (h *ActionHandler) recreateRun(ctx context.Context, req *RunCreateRequest)
 
 	rb := recreateRun(util.DefaultUUIDGenerator{}, run, rc, id, req)
 
+	if req.FromTask != "" {
+		if err := h.checkReusedTasksArchives(rb, runTasksIDs); err != nil {
+			return nil, err
+		}
+	}
+
 	h.log.Debugf("created rc from existing rc: %s", util.Dump(rb.Rc))
 	h.log.Debugf("created run from existing run: %s", util.Dump(rb.Run))
 
 	return rb, nil
 }
 
+// checkReusedTasksArchives checks that the workspace archives of the reused
+// tasks, parents of a recreated task, still exist since they could have been
+// removed by the workspace cleaner.
+func (h *ActionHandler) checkReusedTasksArchives(rb *types.RunBundle, reusedTasksIDs map[string]struct{}) error {
+	checked := map[string]struct{}{}
+	for _, rct := range rb.Rc.Tasks {
+		if _, ok := reusedTasksIDs[rct.ID]; ok {
+			continue
+		}
+		for _, parent := range runconfig.GetAllParents(rb.Rc.Tasks, rct) {
+			if _, ok := reusedTasksIDs[parent.ID]; !ok {
+				continue
+			}
+			if _, ok := checked[parent.ID]; ok {
+				continue
+			}
+			checked[parent.ID] = struct{}{}
+
+			rt, ok := rb.Run.Tasks[parent.ID]
+			if !ok {
+				continue
+			}
+			for _, step := range rt.WorkspaceArchives {
+				if _, err := h.archivesOST.Stat(store.OSTRunTaskArchivePath(rt.ID, step)); err != nil {
+					if objectstorage.IsNotExist(err) {
+						return util.NewErrBadRequest(errors.Errorf("workspace archive of task %q step %d doesn't exist anymore, restart the run from an earlier task or from start", parent.Name, step))
+					}
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+var envVarNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validateEnvironmentOverrides checks the environment variables overridden
+// when recreating a run. The AGOLA_ variables are reserved since they describe
+// the run provenance.
+func validateEnvironmentOverrides(env map[string]string) error {
+	for name := range env {
+		if !envVarNameRegexp.MatchString(name) {
+			return util.NewErrBadRequest(errors.Errorf("invalid environment variable name %q", name))
+		}
+		if strings.HasPrefix(name, "AGOLA_") {
+			return util.NewErrBadRequest(errors.Errorf("environment variable %q cannot be overridden", name))
+		}
+	}
+	return nil
+}
+
+// environmentOverrides returns the sorted names of the environment variables
+// overridden in the run restart lineage
+func environmentOverrides(parentTrigger *types.RunTrigger, env map[string]string) []string {
+	names := map[string]struct{}{}
+	if parentTrigger != nil {
+		for _, name := range parentTrigger.EnvironmentOverrides {
+			names[name] = struct{}{}
+		}
+	}
+	for name := range env {
+		names[name] = struct{}{}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	overrides := make([]string, 0, len(names))
+	for name := range names {
+		overrides = append(overrides, name)
+	}
+	sort.Strings(overrides)
+	return overrides
+}
+
 func recreateRun(uuid util.UUIDGenerator, run *types.Run, rc *types.RunConfig, newID string, req *RunCreateRequest) *types.RunBundle {
 	// update the run config ID
 	rc.ID = newID
-	// update the run config Environment
-	rc.Environment = req.Environment
+	// apply the environment overrides on top of the run config Environment
+	if len(req.Environment) > 0 {
+		if rc.Environment == nil {
+			rc.Environment = map[string]string{}
+		}
+		for k, v := range req.Environment {
+			rc.Environment[k] = v
+		}
+	}
+	// the executor pinning and the debug hold aren't inherited from the
+	// recreated run
+	rc.ExecutorID = req.ExecutorID
+	rc.DebugHold = req.DebugHold
+
+	// update the run trigger and lineage
+	trigger := &types.RunTrigger{
+		Type:        req.TriggerType,
+		TriggeredBy: req.TriggeredBy,
+		ParentRunID: run.ID,
+		RootRunID:   run.ID,
+		Attempt:     1,
+	}
+	if run.Trigger != nil {
+		trigger.CommitSHA = run.Trigger.CommitSHA
+		trigger.CommitAuthorName = run.Trigger.CommitAuthorName
+		trigger.CommitAuthorEmail = run.Trigger.CommitAuthorEmail
+		trigger.CommitMessage = run.Trigger.CommitMessage
+		trigger.Untrusted = run.Trigger.Untrusted
+		if run.Trigger.RootRunID != "" {
+			trigger.RootRunID = run.Trigger.RootRunID
+		}
+		trigger.Attempt = run.Trigger.Attempt + 1
+	}
+	trigger.EnvironmentOverrides = environmentOverrides(run.Trigger, req.Environment)
+	run.Trigger = trigger
 
 	// update the run ID
 	run.ID = newID
@@ -288,17 +629,21 @@ func recreateRun(uuid util.UUIDGenerator, run *types.Run, rc *types.RunConfig, n
 	run.EnqueueTime = nil
 	run.StartTime = nil
 	run.EndTime = nil
+	// a recreated run is explicitly requested so it doesn't wait on the
+	// upstream runs of the original run
+	run.DependsOn = nil
+	run.CancelReason = ""
 
 	// TODO(sgotti) handle reset tasks
 	// currently we only restart a run resetting al failed tasks
 	recreatedRCTasks := map[string]struct{}{}
 
 	for _, rt := range run.Tasks {
-		if req.FromStart || rt.Status != types.RunTaskStatusSuccess {
-			rct, ok := rc.Tasks[rt.ID]
-			if !ok {
-				panic(fmt.Errorf("no runconfig task %q", rt.ID))
-			}
+		rct, ok := rc.Tasks[rt.ID]
+		if !ok {
+			panic(fmt.Errorf("no runconfig task %q", rt.ID))
+		}
+		if req.FromStart || rt.Status != types.RunTaskStatusSuccess || (req.FromTask != "" && rct.Name == req.FromTask) {
 			// change rct id
 			rct.ID = uuid.New(rct.Name).String()
 
@@ -413,6 +758,15 @@ func (h *ActionHandler) saveRun(ctx context.Context, rb *types.RunBundle, runcgt
 	}
 	actions = append(actions, rca)
 
+	// register or remove the preview environment managed by the run
+	if run.PreviewEnvironment != nil {
+		pea, err := h.previewEnvironmentAction(ctx, run)
+		if err != nil {
+			return err
+		}
+		actions = append(actions, pea)
+	}
+
 	if _, err = h.dm.WriteWal(ctx, actions, cgt); err != nil {
 		return err
 	}
@@ -447,9 +801,18 @@ func genRunTask(rct *types.RunConfigTask) *types.RunTask {
 			Phase:    types.ExecutorTaskPhaseNotStarted,
 			LogPhase: types.RunTaskFetchPhaseNotStarted,
 		}
+		// skipped steps don't have logs to fetch
+		if common.IsStepSkipped(rct.Steps[i]) {
+			s.Phase = types.ExecutorTaskPhaseSkipped
+			s.LogPhase = types.RunTaskFetchPhaseFinished
+		}
 		rt.Steps[i] = s
 	}
 	for i, ps := range rct.Steps {
+		// skipped steps won't create a workspace archive
+		if common.IsStepSkipped(ps) {
+			continue
+		}
 		switch ps.(type) {
 		case *types.SaveToWorkspaceStep:
 			rt.WorkspaceArchives = append(rt.WorkspaceArchives, i)
@@ -478,6 +841,11 @@ func genRun(rc *types.RunConfig) *types.Run {
 		r.Phase = types.RunPhaseSetupError
 		return r
 	}
+	if rc.NoRunsReason != "" {
+		r.ChangePhase(types.RunPhaseFinished)
+		r.Result = types.RunResultSkipped
+		return r
+	}
 
 	for _, rct := range rc.Tasks {
 		rt := genRunTask(rct)
@@ -517,8 +885,10 @@ func (h *ActionHandler) RunTaskSetAnnotations(ctx context.Context, req *RunTaskS
 }
 
 type RunTaskApproveRequest struct {
-	RunID                   string
-	TaskID                  string
+	RunID  string
+	TaskID string
+	// Approvers are the users that approved the task
+	Approvers               []string
 	ChangeGroupsUpdateToken string
 }
 
@@ -546,6 +916,22 @@ func (h *ActionHandler) ApproveRunTask(ctx context.Context, req *RunTaskApproveR
 		return util.NewErrBadRequest(errors.Errorf("run %q, task %q is already approved", r.ID, req.TaskID))
 	}
 
+	rc, err := store.OSTGetRunConfig(h.dm, r.ID)
+	if err != nil {
+		return errors.Errorf("cannot get run config %q: %w", r.ID, err)
+	}
+	rct, ok := rc.Tasks[req.TaskID]
+	if !ok {
+		return util.NewErrBadRequest(errors.Errorf("run config %q doesn't have task %q", r.ID, req.TaskID))
+	}
+	// enforce the deploy environment protection rules
+	if de := rct.DeployEnvironment; de != nil {
+		approvers := de.ValidApprovers(req.Approvers)
+		if len(approvers) < de.RequiredApprovals {
+			return util.NewErrBadRequest(errors.Errorf("run %q, task %q targeting deploy environment %q requires %d approvals, got %d", r.ID, req.TaskID, de.Name, de.RequiredApprovals, len(approvers)))
+		}
+	}
+
 	task.WaitingApproval = false
 	task.Approved = true
 
@@ -554,6 +940,16 @@ func (h *ActionHandler) ApproveRunTask(ctx context.Context, req *RunTaskApproveR
 }
 
 func (h *ActionHandler) DeleteExecutor(ctx context.Context, executorID string) error {
+	executor, err := store.GetExecutor(ctx, h.e, executorID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return err
+	}
+	if executor == nil {
+		return util.NewErrNotExist(errors.Errorf("executor %q doesn't exist", executorID))
+	}
+
+	// the not finished executor tasks of the removed executor will be marked
+	// as failed by the executor tasks cleaner
 	if err := store.DeleteExecutor(ctx, h.e, executorID); err != nil {
 		return err
 	}
@@ -561,6 +957,86 @@ func (h *ActionHandler) DeleteExecutor(ctx context.Context, executorID string) e
 	return nil
 }
 
+// HandleExecutorRestart fails or reschedules the not finished executor tasks
+// assigned to a previous session of the executor. They will never be
+// completed since the restarted executor lost their state.
+func (h *ActionHandler) HandleExecutorRestart(ctx context.Context, executorID string) error {
+	ets, err := store.GetExecutorTasksForExecutor(ctx, h.e, executorID)
+	if err != nil {
+		return err
+	}
+
+	for _, et := range ets {
+		if et.Status.Phase.IsFinished() {
+			continue
+		}
+		// stopped tasks won't be executed also if rescheduled
+		if h.rescheduleRestartedExecutorTasks && !et.Spec.Stop {
+			if err := h.rescheduleExecutorTask(ctx, et); err != nil {
+				h.log.Errorf("failed to reschedule executor task %q: %+v", et.ID, err)
+			}
+			continue
+		}
+		if err := h.failExecutorTask(ctx, et, "executor restarted"); err != nil {
+			h.log.Errorf("failed to fail executor task %q: %+v", et.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (h *ActionHandler) failExecutorTask(ctx context.Context, et *types.ExecutorTask, failError string) error {
+	h.log.Infof("marking executor task %q as failed: %s", et.ID, failError)
+
+	et.Status.FailError = failError
+	et.Status.Phase = types.ExecutorTaskPhaseFailed
+	et.Status.EndTime = util.TimeP(time.Now())
+	for _, s := range et.Status.Steps {
+		if s.Phase == types.ExecutorTaskPhaseRunning {
+			s.Phase = types.ExecutorTaskPhaseFailed
+			s.EndTime = util.TimeP(time.Now())
+		}
+	}
+	_, err := store.AtomicPutExecutorTask(ctx, h.e, et)
+	return err
+}
+
+// rescheduleExecutorTask resets the run task to not started and removes the
+// executor task so the scheduler will submit it again
+func (h *ActionHandler) rescheduleExecutorTask(ctx context.Context, et *types.ExecutorTask) error {
+	h.log.Infof("rescheduling executor task %q", et.ID)
+
+	r, _, err := store.GetRun(ctx, h.e, et.Spec.RunID)
+	if err != nil {
+		return err
+	}
+	if r.Phase.IsFinished() {
+		return h.failExecutorTask(ctx, et, "executor restarted")
+	}
+	rt, ok := r.Tasks[et.ID]
+	if !ok {
+		return errors.Errorf("no such run task with id %s for run %s", et.ID, r.ID)
+	}
+	rc, err := store.OSTGetRunConfig(h.dm, r.ID)
+	if err != nil {
+		return errors.Errorf("cannot get run config %q: %w", r.ID, err)
+	}
+
+	nrt := genRunTask(rc.Tasks[rt.ID])
+	nrt.Annotations = rt.Annotations
+	nrt.WaitingApproval = rt.WaitingApproval
+	nrt.Approved = rt.Approved
+	nrt.WaitTimerEndTime = rt.WaitTimerEndTime
+	r.Tasks[rt.ID] = nrt
+
+	// update the run before removing the executor task, if the removal fails
+	// the executor task status will be applied again to the run task
+	if _, err := store.AtomicPutRun(ctx, h.e, r, nil, nil); err != nil {
+		return err
+	}
+	return store.DeleteExecutorTask(ctx, h.e, et.ID)
+}
+
 func (h *ActionHandler) getRunCounter(ctx context.Context, group string) (uint64, *datamanager.ChangeGroupsUpdateToken, error) {
 	// use the first group dir after the root
 	pl := util.PathList(group)
@@ -609,7 +1085,10 @@ func (h *ActionHandler) GetExecutorTask(ctx context.Context, etID string) (*type
 	}
 
 	// generate ExecutorTaskSpecData
-	et.Spec.ExecutorTaskSpecData = common.GenExecutorTaskSpecData(r, rt, rc)
+	et.Spec.ExecutorTaskSpecData, err = h.GenExecutorTaskSpecData(r, rt, rc)
+	if err != nil {
+		return nil, err
+	}
 
 	return et, nil
 }
@@ -635,7 +1114,10 @@ func (h *ActionHandler) GetExecutorTasks(ctx context.Context, executorID string)
 		}
 
 		// generate ExecutorTaskSpecData
-		et.Spec.ExecutorTaskSpecData = common.GenExecutorTaskSpecData(r, rt, rc)
+		et.Spec.ExecutorTaskSpecData, err = h.GenExecutorTaskSpecData(r, rt, rc)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return ets, nil
@@ -15,11 +15,24 @@
 package action
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/testutil"
 	"agola.io/agola/internal/util"
 	"agola.io/agola/services/runservice/types"
+
 	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
 )
 
 func TestRecreateRun(t *testing.T) {
@@ -170,6 +183,13 @@ func TestRecreateRun(t *testing.T) {
 	// generated by action.genRun()
 	run := genRun(rc)
 	outrun := genRun(outrc)
+	outrun.Trigger = &types.RunTrigger{
+		Type:        "restart",
+		TriggeredBy: "user01",
+		ParentRunID: inuuid("old"),
+		RootRunID:   inuuid("old"),
+		Attempt:     1,
+	}
 
 	tests := []struct {
 		name  string
@@ -185,7 +205,7 @@ func TestRecreateRun(t *testing.T) {
 			r:     run.DeepCopy(),
 			outrc: outrc.DeepCopy(),
 			outr:  outrun.DeepCopy(),
-			req:   &RunCreateRequest{FromStart: true},
+			req:   &RunCreateRequest{FromStart: true, TriggerType: "restart", TriggeredBy: "user01"},
 		},
 		{
 			name:  "test recreate run from failed tasks with all not start tasks",
@@ -193,7 +213,7 @@ func TestRecreateRun(t *testing.T) {
 			r:     run.DeepCopy(),
 			outrc: outrc.DeepCopy(),
 			outr:  outrun.DeepCopy(),
-			req:   &RunCreateRequest{FromStart: false},
+			req:   &RunCreateRequest{FromStart: false, TriggerType: "restart", TriggeredBy: "user01"},
 		},
 		{
 			name: "test recreate run from start tasks with task01 failed and child task02 successful (should recreate all tasks)",
@@ -209,7 +229,7 @@ func TestRecreateRun(t *testing.T) {
 			}(),
 			outrc: outrc.DeepCopy(),
 			outr:  outrun.DeepCopy(),
-			req:   &RunCreateRequest{FromStart: true},
+			req:   &RunCreateRequest{FromStart: true, TriggerType: "restart", TriggeredBy: "user01"},
 		},
 		{
 			name: "test recreate run from failed tasks with task01 failed and child task02 successful (should recreate task01 and task02)",
@@ -256,10 +276,165 @@ func TestRecreateRun(t *testing.T) {
 				nrun.Tasks[inuuid("task03")].Status = types.RunTaskStatusSuccess
 				nrun.Tasks[inuuid("task04")].Status = types.RunTaskStatusSuccess
 				nrun.Tasks[inuuid("task05")].Status = types.RunTaskStatusSuccess
+				nrun.Trigger = outrun.Trigger
 
 				return nrun
 			}(),
-			req: &RunCreateRequest{FromStart: false},
+			req: &RunCreateRequest{FromStart: false, TriggerType: "restart", TriggeredBy: "user01"},
+		},
+		{
+			name: "test recreate run from task03 with all tasks successful (should recreate task03 and its child task05)",
+			rc:   rc.DeepCopy(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				for _, rt := range run.Tasks {
+					rt.Status = types.RunTaskStatusSuccess
+				}
+				return run
+			}(),
+			// task03 and task05 recreated
+			outrc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				outrc := outrc.DeepCopy()
+
+				nrc := rc.DeepCopy()
+				nrc.ID = outuuid("new")
+				nrc.Tasks = map[string]*types.RunConfigTask{
+					inuuid("task01"):  rc.Tasks[inuuid("task01")],
+					inuuid("task02"):  rc.Tasks[inuuid("task02")],
+					outuuid("task03"): outrc.Tasks[outuuid("task03")],
+					inuuid("task04"):  rc.Tasks[inuuid("task04")],
+					outuuid("task05"): outrc.Tasks[outuuid("task05")],
+				}
+				nrc.Tasks[outuuid("task05")].Depends = map[string]*types.RunConfigTaskDepend{
+					outuuid("task03"): &types.RunConfigTaskDepend{TaskID: outuuid("task03"), Conditions: []types.RunConfigTaskDependCondition{types.RunConfigTaskDependConditionOnSuccess}},
+					inuuid("task04"):  &types.RunConfigTaskDepend{TaskID: inuuid("task04"), Conditions: []types.RunConfigTaskDependCondition{types.RunConfigTaskDependConditionOnSuccess}},
+				}
+				return nrc
+			}(),
+			// task03 and task05 recreated and status reset to NotStarted
+			outr: func() *types.Run {
+				run := run.DeepCopy()
+				outrun := outrun.DeepCopy()
+				nrun := run.DeepCopy()
+				nrun.ID = outuuid("new")
+				nrun.Tasks = map[string]*types.RunTask{
+					inuuid("task01"):  run.Tasks[inuuid("task01")],
+					inuuid("task02"):  run.Tasks[inuuid("task02")],
+					outuuid("task03"): outrun.Tasks[outuuid("task03")],
+					inuuid("task04"):  run.Tasks[inuuid("task04")],
+					outuuid("task05"): outrun.Tasks[outuuid("task05")],
+				}
+
+				nrun.Tasks[inuuid("task01")].Status = types.RunTaskStatusSuccess
+				nrun.Tasks[inuuid("task02")].Status = types.RunTaskStatusSuccess
+				nrun.Tasks[inuuid("task04")].Status = types.RunTaskStatusSuccess
+				nrun.Trigger = outrun.Trigger
+
+				return nrun
+			}(),
+			req: &RunCreateRequest{FromTask: "task03", TriggerType: "restart", TriggeredBy: "user01"},
+		},
+		{
+			name: "test recreate run from start of an already restarted run",
+			rc:   rc.DeepCopy(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Trigger = &types.RunTrigger{
+					Type:             "restart",
+					TriggeredBy:      "user01",
+					CommitSHA:        "commitsha01",
+					CommitAuthorName: "author01",
+					CommitMessage:    "commit message",
+					ParentRunID:      inuuid("root"),
+					RootRunID:        inuuid("root"),
+					Attempt:          1,
+				}
+				return run
+			}(),
+			outrc: outrc.DeepCopy(),
+			outr: func() *types.Run {
+				outrun := outrun.DeepCopy()
+				outrun.Trigger = &types.RunTrigger{
+					Type:             "restart",
+					TriggeredBy:      "user02",
+					CommitSHA:        "commitsha01",
+					CommitAuthorName: "author01",
+					CommitMessage:    "commit message",
+					ParentRunID:      inuuid("old"),
+					RootRunID:        inuuid("root"),
+					Attempt:          2,
+				}
+				return outrun
+			}(),
+			req: &RunCreateRequest{FromStart: true, TriggerType: "restart", TriggeredBy: "user02"},
+		},
+		{
+			name: "test recreate run from start of an untrusted run",
+			rc:   rc.DeepCopy(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Trigger = &types.RunTrigger{
+					Type:        "webhook",
+					TriggeredBy: "user01",
+					CommitSHA:   "commitsha01",
+					Untrusted:   true,
+				}
+				return run
+			}(),
+			outrc: outrc.DeepCopy(),
+			outr: func() *types.Run {
+				outrun := outrun.DeepCopy()
+				outrun.Trigger = &types.RunTrigger{
+					Type:        "restart",
+					TriggeredBy: "user02",
+					CommitSHA:   "commitsha01",
+					Untrusted:   true,
+					ParentRunID: inuuid("old"),
+					RootRunID:   inuuid("old"),
+					Attempt:     1,
+				}
+				return outrun
+			}(),
+			req: &RunCreateRequest{FromStart: true, TriggerType: "restart", TriggeredBy: "user02"},
+		},
+		{
+			name: "test recreate run from start with environment overrides",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				rc.Environment = map[string]string{"REGION": "us-east-1", "TARGET": "prod"}
+				return rc
+			}(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Trigger = &types.RunTrigger{
+					Type:                 "restart",
+					TriggeredBy:          "user01",
+					ParentRunID:          inuuid("root"),
+					RootRunID:            inuuid("root"),
+					Attempt:              1,
+					EnvironmentOverrides: []string{"TARGET"},
+				}
+				return run
+			}(),
+			outrc: func() *types.RunConfig {
+				outrc := outrc.DeepCopy()
+				outrc.Environment = map[string]string{"REGION": "eu-west-1", "TARGET": "prod"}
+				return outrc
+			}(),
+			outr: func() *types.Run {
+				outrun := outrun.DeepCopy()
+				outrun.Trigger = &types.RunTrigger{
+					Type:                 "restart",
+					TriggeredBy:          "user02",
+					ParentRunID:          inuuid("old"),
+					RootRunID:            inuuid("root"),
+					Attempt:              2,
+					EnvironmentOverrides: []string{"REGION", "TARGET"},
+				}
+				return outrun
+			}(),
+			req: &RunCreateRequest{FromStart: true, TriggerType: "restart", TriggeredBy: "user02", Environment: map[string]string{"REGION": "eu-west-1"}},
 		},
 	}
 
@@ -277,3 +452,292 @@ func TestRecreateRun(t *testing.T) {
 		})
 	}
 }
+
+func TestGenNoRunsRun(t *testing.T) {
+	rc := &types.RunConfig{
+		ID:           "01",
+		Name:         types.RunNoRunsName,
+		Group:        "/project/projectid01/branch/master",
+		NoRunsReason: "the config doesn't define any run",
+	}
+
+	run := genRun(rc)
+	if run.Phase != types.RunPhaseFinished {
+		t.Fatalf("expected phase %q, got %q", types.RunPhaseFinished, run.Phase)
+	}
+	if run.Result != types.RunResultSkipped {
+		t.Fatalf("expected result %q, got %q", types.RunResultSkipped, run.Result)
+	}
+	if run.EndTime == nil {
+		t.Fatalf("expected end time to be set")
+	}
+	if len(run.Tasks) != 0 {
+		t.Fatalf("expected no tasks, got %d", len(run.Tasks))
+	}
+	if ok, _ := run.CanRestartFromScratch(); ok {
+		t.Fatalf("expected run to not be restartable")
+	}
+}
+
+func TestOlderQueuedGroupRun(t *testing.T) {
+	group := "/project/projectid01/branch/master"
+	otherGroup := "/project/projectid01/branch/other"
+
+	activeRuns := []*types.Run{
+		{ID: "01", Group: group, Phase: types.RunPhaseRunning},
+		{ID: "02", Group: otherGroup, Phase: types.RunPhaseQueued},
+		{ID: "04", Group: group, Phase: types.RunPhaseQueued},
+		{ID: "03", Group: group, Phase: types.RunPhaseQueued},
+		{ID: "05", Group: group, Phase: types.RunPhaseQueued},
+	}
+
+	tests := []struct {
+		name       string
+		run        *types.Run
+		olderRunID string
+	}{
+		{
+			name: "test oldest queued run",
+			run:  activeRuns[3],
+		},
+		{
+			name:       "test queued run after an older queued run",
+			run:        activeRuns[2],
+			olderRunID: "03",
+		},
+		{
+			name:       "test queued run after many older queued runs",
+			run:        activeRuns[4],
+			olderRunID: "03",
+		},
+		{
+			name:       "test older queued run in another group",
+			run:        &types.Run{ID: "06", Group: otherGroup, Phase: types.RunPhaseQueued},
+			olderRunID: "02",
+		},
+		{
+			name: "test no queued runs in group",
+			run:  &types.Run{ID: "07", Group: "/project/projectid02/branch/master", Phase: types.RunPhaseQueued},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var olderRunID string
+			if olderRun := olderQueuedGroupRun(activeRuns, tt.run); olderRun != nil {
+				olderRunID = olderRun.ID
+			}
+			if olderRunID != tt.olderRunID {
+				t.Fatalf("expected older queued run %q, got %q", tt.olderRunID, olderRunID)
+			}
+		})
+	}
+}
+
+func TestHandleExecutorRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+
+	tetcd, err := testutil.NewTestEmbeddedEtcd(t, logger, dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.Start(); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := tetcd.WaitUp(30 * time.Second); err != nil {
+		t.Fatalf("error waiting on etcd up: %v", err)
+	}
+	defer func() { _ = tetcd.Kill() }()
+	e := tetcd.TestEtcd.Store
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := objectstorage.NewPosix(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	dm, err := datamanager.NewDataManager(ctx, logger, &datamanager.DataManagerConfig{
+		BasePath:  "rundata",
+		E:         e,
+		OST:       objectstorage.NewObjStorage(s, "/"),
+		DataTypes: []string{string(common.DataTypeRun), string(common.DataTypeRunConfig), string(common.DataTypeRunCounter)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	dmReadyCh := make(chan struct{})
+	go func() { _ = dm.Run(ctx, dmReadyCh) }()
+	<-dmReadyCh
+
+	rc := &types.RunConfig{
+		ID: "run01",
+		Tasks: map[string]*types.RunConfigTask{
+			"task01": {ID: "task01", Name: "task01"},
+			"task02": {ID: "task02", Name: "task02"},
+			"task03": {ID: "task03", Name: "task03"},
+		},
+	}
+	action, err := store.OSTSaveRunConfigAction(rc)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if _, err := dm.WriteWal(ctx, []*datamanager.Action{action}, nil); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	// wait for the run config to be readable
+	if err := testutil.Wait(30*time.Second, func() (bool, error) {
+		_, err := store.OSTGetRunConfig(dm, rc.ID)
+		return err == nil, nil
+	}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	et := func(id, executorID, runID string, phase types.ExecutorTaskPhase, stop bool) *types.ExecutorTask {
+		return &types.ExecutorTask{
+			ID:     id,
+			Spec:   types.ExecutorTaskSpec{ExecutorID: executorID, RunID: runID, Stop: stop},
+			Status: types.ExecutorTaskStatus{Phase: phase},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		reschedule bool
+		// phases are the expected executor tasks phases, an empty phase means
+		// that the executor task was removed
+		phases map[string]types.ExecutorTaskPhase
+		// runTaskStatuses are the expected run01 tasks statuses
+		runTaskStatuses map[string]types.RunTaskStatus
+	}{
+		{
+			name: "test fail tasks",
+			phases: map[string]types.ExecutorTaskPhase{
+				"task01": types.ExecutorTaskPhaseFailed,
+				"task02": types.ExecutorTaskPhaseFailed,
+				"task03": types.ExecutorTaskPhaseSuccess,
+				"task04": types.ExecutorTaskPhaseFailed,
+				"task05": types.ExecutorTaskPhaseRunning,
+			},
+			runTaskStatuses: map[string]types.RunTaskStatus{
+				"task01": types.RunTaskStatusRunning,
+				"task02": types.RunTaskStatusRunning,
+				"task03": types.RunTaskStatusSuccess,
+			},
+		},
+		{
+			name:       "test reschedule tasks",
+			reschedule: true,
+			phases: map[string]types.ExecutorTaskPhase{
+				// rescheduled
+				"task01": "",
+				// stopped tasks are failed
+				"task02": types.ExecutorTaskPhaseFailed,
+				"task03": types.ExecutorTaskPhaseSuccess,
+				// tasks of finished runs are failed
+				"task04": types.ExecutorTaskPhaseFailed,
+				"task05": types.ExecutorTaskPhaseRunning,
+			},
+			runTaskStatuses: map[string]types.RunTaskStatus{
+				"task01": types.RunTaskStatusNotStarted,
+				"task02": types.RunTaskStatusRunning,
+				"task03": types.RunTaskStatusSuccess,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := []*types.Run{
+				{
+					ID:    "run01",
+					Phase: types.RunPhaseRunning,
+					Tasks: map[string]*types.RunTask{
+						"task01": {ID: "task01", Status: types.RunTaskStatusRunning},
+						"task02": {ID: "task02", Status: types.RunTaskStatusRunning},
+						"task03": {ID: "task03", Status: types.RunTaskStatusSuccess},
+					},
+				},
+				{
+					ID:    "run02",
+					Phase: types.RunPhaseFinished,
+					Tasks: map[string]*types.RunTask{
+						"task04": {ID: "task04", Status: types.RunTaskStatusRunning},
+					},
+				},
+				{
+					ID:    "run03",
+					Phase: types.RunPhaseRunning,
+					Tasks: map[string]*types.RunTask{
+						"task05": {ID: "task05", Status: types.RunTaskStatusRunning},
+					},
+				},
+			}
+			ets := []*types.ExecutorTask{
+				et("task01", "executor01", "run01", types.ExecutorTaskPhaseRunning, false),
+				et("task02", "executor01", "run01", types.ExecutorTaskPhaseRunning, true),
+				et("task03", "executor01", "run01", types.ExecutorTaskPhaseSuccess, false),
+				et("task04", "executor01", "run02", types.ExecutorTaskPhaseRunning, false),
+				// task of another executor
+				et("task05", "executor02", "run03", types.ExecutorTaskPhaseRunning, false),
+			}
+			for _, r := range runs {
+				if err := store.DeleteRun(ctx, e, r.ID); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if _, err := store.AtomicPutRun(ctx, e, r, nil, nil); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+			for _, et := range ets {
+				if err := store.DeleteExecutorTask(ctx, e, et.ID); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if _, err := store.AtomicPutExecutorTask(ctx, e, et); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			h := NewActionHandler(logger, e, nil, nil, dm)
+			h.SetRescheduleRestartedExecutorTasks(tt.reschedule)
+
+			if err := h.HandleExecutorRestart(ctx, "executor01"); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			phases := map[string]types.ExecutorTaskPhase{}
+			for _, et := range ets {
+				cet, err := store.GetExecutorTask(ctx, e, et.ID)
+				if err != nil && err != etcd.ErrKeyNotFound {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				if cet == nil {
+					phases[et.ID] = ""
+					continue
+				}
+				phases[et.ID] = cet.Status.Phase
+			}
+			if diff := cmp.Diff(tt.phases, phases); diff != "" {
+				t.Error(diff)
+			}
+
+			r, _, err := store.GetRun(ctx, e, "run01")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			runTaskStatuses := map[string]types.RunTaskStatus{}
+			for id, rt := range r.Tasks {
+				runTaskStatuses[id] = rt.Status
+			}
+			if diff := cmp.Diff(tt.runTaskStatuses, runTaskStatuses); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
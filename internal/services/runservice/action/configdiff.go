@@ -0,0 +1,426 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/ghodss/yaml"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	redactedValue        = "<redacted>"
+	redactedChangedValue = "<redacted, changed>"
+
+	// runConfigDiffContextLines is the number of unchanged lines shown around
+	// a change in the textual diff
+	runConfigDiffContextLines = 3
+)
+
+// staticSecretEnvironment are the run static environment variables that
+// contain secrets (like the ssh private key used to clone the repository)
+var staticSecretEnvironment = []string{"AGOLA_SSHPRIVKEY"}
+
+type RunConfigDiff struct {
+	RunID         string
+	RunGroup      string
+	OtherRunID    string
+	OtherRunGroup string
+	ChangedFields []string
+	AddedTasks    []string
+	RemovedTasks  []string
+	ChangedTasks  []string
+	Diff          string
+}
+
+// GetRunConfigDiff returns the differences between the run configs of two
+// runs.
+func (h *ActionHandler) GetRunConfigDiff(ctx context.Context, runID, otherRunID string) (*RunConfigDiff, error) {
+	var run, otherRun *types.Run
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		run, err = h.readDB.GetRun(tx, runID)
+		if err != nil {
+			return err
+		}
+		otherRun, err = h.readDB.GetRun(tx, otherRunID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, util.NewErrNotExist(errors.Errorf("run %q doesn't exist", runID))
+	}
+	if otherRun == nil {
+		return nil, util.NewErrNotExist(errors.Errorf("run %q doesn't exist", otherRunID))
+	}
+
+	rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get run config %q: %w", run.ID, err)
+	}
+	otherRc, err := store.OSTGetRunConfig(h.dm, otherRun.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get run config %q: %w", otherRun.ID, err)
+	}
+
+	diff, err := diffRunConfigs(rc, otherRc)
+	if err != nil {
+		return nil, err
+	}
+	diff.RunID = run.ID
+	diff.RunGroup = run.Group
+	diff.OtherRunID = otherRun.ID
+	diff.OtherRunGroup = otherRun.Group
+
+	return diff, nil
+}
+
+// diffRunConfig is a run config normalized to be compared with the run
+// config of another run: the tasks (and their dependencies) are referenced by
+// name since the task ids are different in every run and the values that
+// could contain secrets are redacted.
+type diffRunConfig struct {
+	Name              string                          `json:"name,omitempty"`
+	Group             string                          `json:"group,omitempty"`
+	SetupErrors       []string                        `json:"setup_errors,omitempty"`
+	Annotations       map[string]string               `json:"annotations,omitempty"`
+	StaticEnvironment map[string]string               `json:"static_environment,omitempty"`
+	Environment       map[string]string               `json:"environment,omitempty"`
+	CacheGroup        string                          `json:"cache_group,omitempty"`
+	Tasks             map[string]*types.RunConfigTask `json:"tasks,omitempty"`
+}
+
+func newDiffRunConfig(rc *types.RunConfig) *diffRunConfig {
+	rc = rc.DeepCopy()
+
+	drc := &diffRunConfig{
+		Name:              rc.Name,
+		Group:             rc.Group,
+		SetupErrors:       rc.SetupErrors,
+		Annotations:       rc.Annotations,
+		StaticEnvironment: rc.StaticEnvironment,
+		Environment:       rc.Environment,
+		CacheGroup:        rc.CacheGroup,
+		Tasks:             map[string]*types.RunConfigTask{},
+	}
+	for _, rct := range rc.Tasks {
+		depends := map[string]*types.RunConfigTaskDepend{}
+		for _, d := range rct.Depends {
+			name := d.TaskID
+			if dt, ok := rc.Tasks[d.TaskID]; ok {
+				name = dt.Name
+			}
+			depends[name] = &types.RunConfigTaskDepend{TaskID: name, Conditions: d.Conditions}
+		}
+		rct.Depends = depends
+		rct.ID = ""
+		drc.Tasks[rct.Name] = rct
+	}
+
+	return drc
+}
+
+// redactEnv replaces the environment values. When a value is different in the
+// other environment it's marked as changed so the diff will report it.
+func redactEnv(env, otherEnv map[string]string) {
+	for k, v := range otherEnv {
+		if ov, ok := env[k]; ok && ov != v {
+			otherEnv[k] = redactedChangedValue
+		} else {
+			otherEnv[k] = redactedValue
+		}
+	}
+	for k := range env {
+		env[k] = redactedValue
+	}
+}
+
+// redactStaticEnv replaces the run static environment values that contain
+// secrets
+func redactStaticEnv(env, otherEnv map[string]string) {
+	secretEnv := map[string]string{}
+	otherSecretEnv := map[string]string{}
+	for _, k := range staticSecretEnvironment {
+		if v, ok := env[k]; ok {
+			secretEnv[k] = v
+		}
+		if v, ok := otherEnv[k]; ok {
+			otherSecretEnv[k] = v
+		}
+	}
+	redactEnv(secretEnv, otherSecretEnv)
+	for k, v := range secretEnv {
+		env[k] = v
+	}
+	for k, v := range otherSecretEnv {
+		otherEnv[k] = v
+	}
+}
+
+func redactDockerRegistriesAuth(auths, otherAuths map[string]types.DockerRegistryAuth) {
+	for k, a := range otherAuths {
+		ov, ok := auths[k]
+		changed := ok && (ov.Username != a.Username || ov.Password != a.Password || ov.Auth != a.Auth)
+		for _, s := range []*string{&a.Username, &a.Password, &a.Auth} {
+			if *s == "" {
+				continue
+			}
+			*s = redactedValue
+			if changed {
+				*s = redactedChangedValue
+			}
+		}
+		otherAuths[k] = a
+	}
+	for k, a := range auths {
+		for _, s := range []*string{&a.Username, &a.Password, &a.Auth} {
+			if *s != "" {
+				*s = redactedValue
+			}
+		}
+		auths[k] = a
+	}
+}
+
+// redactFiles replaces the task files content. When a file content is
+// different in the other task files it's marked as changed.
+func redactFiles(files, otherFiles []*types.TaskFile) {
+	contents := map[string]string{}
+	for _, f := range files {
+		contents[f.Path] = f.Content
+	}
+	for _, f := range otherFiles {
+		if c, ok := contents[f.Path]; ok && c != f.Content {
+			f.Content = redactedChangedValue
+		} else {
+			f.Content = redactedValue
+		}
+	}
+	for _, f := range files {
+		f.Content = redactedValue
+	}
+}
+
+func redactDiffRunConfigs(drc, otherDrc *diffRunConfig) {
+	redactEnv(drc.Environment, otherDrc.Environment)
+	redactStaticEnv(drc.StaticEnvironment, otherDrc.StaticEnvironment)
+
+	// redact the tasks not existing in the other run config
+	for name, rct := range drc.Tasks {
+		if _, ok := otherDrc.Tasks[name]; !ok {
+			redactRunConfigTask(rct, &types.RunConfigTask{})
+		}
+	}
+	for name, orct := range otherDrc.Tasks {
+		rct, ok := drc.Tasks[name]
+		if !ok {
+			rct = &types.RunConfigTask{}
+		}
+		redactRunConfigTask(rct, orct)
+	}
+}
+
+func redactRunConfigTask(rct, orct *types.RunConfigTask) {
+	redactEnv(rct.Environment, orct.Environment)
+	redactDockerRegistriesAuth(rct.DockerRegistriesAuth, orct.DockerRegistriesAuth)
+	redactFiles(rct.Files, orct.Files)
+
+	var containers, otherContainers []*types.Container
+	if rct.Runtime != nil {
+		containers = rct.Runtime.Containers
+	}
+	if orct.Runtime != nil {
+		otherContainers = orct.Runtime.Containers
+	}
+	for i, c := range containers {
+		otherEnv := map[string]string{}
+		if i < len(otherContainers) {
+			otherEnv = otherContainers[i].Environment
+		}
+		redactEnv(c.Environment, otherEnv)
+	}
+	for i := len(containers); i < len(otherContainers); i++ {
+		redactEnv(map[string]string{}, otherContainers[i].Environment)
+	}
+}
+
+func diffRunConfigs(rc, otherRc *types.RunConfig) (*RunConfigDiff, error) {
+	drc := newDiffRunConfig(rc)
+	otherDrc := newDiffRunConfig(otherRc)
+	redactDiffRunConfigs(drc, otherDrc)
+
+	diff := &RunConfigDiff{
+		ChangedFields: []string{},
+		AddedTasks:    []string{},
+		RemovedTasks:  []string{},
+		ChangedTasks:  []string{},
+	}
+
+	fields := []struct {
+		name       string
+		value      interface{}
+		otherValue interface{}
+	}{
+		{"name", drc.Name, otherDrc.Name},
+		{"group", drc.Group, otherDrc.Group},
+		{"setup_errors", drc.SetupErrors, otherDrc.SetupErrors},
+		{"annotations", drc.Annotations, otherDrc.Annotations},
+		{"static_environment", drc.StaticEnvironment, otherDrc.StaticEnvironment},
+		{"environment", drc.Environment, otherDrc.Environment},
+		{"cache_group", drc.CacheGroup, otherDrc.CacheGroup},
+	}
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.value, f.otherValue) {
+			diff.ChangedFields = append(diff.ChangedFields, f.name)
+		}
+	}
+
+	for name, rct := range drc.Tasks {
+		orct, ok := otherDrc.Tasks[name]
+		if !ok {
+			diff.RemovedTasks = append(diff.RemovedTasks, name)
+			continue
+		}
+		if !reflect.DeepEqual(rct, orct) {
+			diff.ChangedTasks = append(diff.ChangedTasks, name)
+		}
+	}
+	for name := range otherDrc.Tasks {
+		if _, ok := drc.Tasks[name]; !ok {
+			diff.AddedTasks = append(diff.AddedTasks, name)
+		}
+	}
+	sort.Strings(diff.RemovedTasks)
+	sort.Strings(diff.ChangedTasks)
+	sort.Strings(diff.AddedTasks)
+
+	a, err := yaml.Marshal(drc)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal run config: %w", err)
+	}
+	b, err := yaml.Marshal(otherDrc)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal run config: %w", err)
+	}
+	diff.Diff = unifiedDiff(string(a), string(b), runConfigDiffContextLines)
+
+	return diff, nil
+}
+
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string
+}
+
+// unifiedDiff returns a line based unified diff of the provided texts. It
+// returns an empty string when the texts are equal.
+func unifiedDiff(a, b string, contextLines int) string {
+	dmp := diffmatchpatch.New()
+	ca, cb, lines := dmp.DiffLinesToChars(a, b)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(ca, cb, false), lines)
+
+	dlines := []diffLine{}
+	for _, d := range diffs {
+		for _, l := range strings.SplitAfter(d.Text, "\n") {
+			if l == "" {
+				continue
+			}
+			dlines = append(dlines, diffLine{op: d.Type, text: strings.TrimSuffix(l, "\n")})
+		}
+	}
+
+	var sb strings.Builder
+	// aLine and bLine are the current line numbers (starting from 1) in a and b
+	aLine, bLine := 1, 1
+	for i := 0; i < len(dlines); {
+		if dlines[i].op == diffmatchpatch.DiffEqual {
+			i++
+			aLine++
+			bLine++
+			continue
+		}
+
+		// find the hunk boundaries: the hunk ends when there're more than
+		// 2*contextLines equal lines between two changes
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(dlines); j++ {
+			if dlines[j].op != diffmatchpatch.DiffEqual {
+				end = j
+				continue
+			}
+			if j-end > 2*contextLines {
+				break
+			}
+		}
+		end += contextLines
+		if end >= len(dlines) {
+			end = len(dlines) - 1
+		}
+
+		hunkALine, hunkBLine := aLine-(i-start), bLine-(i-start)
+		aCount, bCount := 0, 0
+		var hsb strings.Builder
+		for j := start; j <= end; j++ {
+			l := dlines[j]
+			switch l.op {
+			case diffmatchpatch.DiffEqual:
+				aCount++
+				bCount++
+				hsb.WriteString(" " + l.text + "\n")
+			case diffmatchpatch.DiffDelete:
+				aCount++
+				hsb.WriteString("-" + l.text + "\n")
+			case diffmatchpatch.DiffInsert:
+				bCount++
+				hsb.WriteString("+" + l.text + "\n")
+			}
+		}
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", hunkALine, aCount, hunkBLine, bCount))
+		sb.WriteString(hsb.String())
+
+		// advance the line numbers to the end of the hunk
+		for j := i; j <= end; j++ {
+			switch dlines[j].op {
+			case diffmatchpatch.DiffEqual:
+				aLine++
+				bLine++
+			case diffmatchpatch.DiffDelete:
+				aLine++
+			case diffmatchpatch.DiffInsert:
+				bLine++
+			}
+		}
+		i = end + 1
+	}
+
+	return sb.String()
+}
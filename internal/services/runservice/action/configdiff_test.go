@@ -0,0 +1,184 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"strings"
+	"testing"
+
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffRunConfigs(t *testing.T) {
+	genRunConfig := func(prefix string) *types.RunConfig {
+		return &types.RunConfig{
+			ID:          prefix + "run",
+			Name:        "run01",
+			Group:       "/project/project01/branch/master",
+			Environment: map[string]string{"SECRET01": "secretvalue01"},
+			StaticEnvironment: map[string]string{
+				"AGOLA_GIT_REF":    "refs/heads/master",
+				"AGOLA_SSHPRIVKEY": "secretvalue03",
+			},
+			Tasks: map[string]*types.RunConfigTask{
+				prefix + "task01": &types.RunConfigTask{
+					ID:      prefix + "task01",
+					Name:    "task01",
+					Depends: map[string]*types.RunConfigTaskDepend{},
+					Runtime: &types.Runtime{Type: types.RuntimeType("pod"),
+						Containers: []*types.Container{{Image: "image01"}},
+					},
+					Environment: map[string]string{"ENV01": "value01"},
+					Steps:       types.Steps{},
+				},
+				prefix + "task02": &types.RunConfigTask{
+					ID:   prefix + "task02",
+					Name: "task02",
+					Depends: map[string]*types.RunConfigTaskDepend{
+						prefix + "task01": &types.RunConfigTaskDepend{TaskID: prefix + "task01", Conditions: []types.RunConfigTaskDependCondition{types.RunConfigTaskDependConditionOnSuccess}},
+					},
+					Runtime: &types.Runtime{Type: types.RuntimeType("pod"),
+						Containers: []*types.Container{{Image: "image01"}},
+					},
+					Environment: map[string]string{},
+					Steps:       types.Steps{},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		rc           *types.RunConfig
+		otherRc      *types.RunConfig
+		out          *RunConfigDiff
+		diffContains []string
+	}{
+		{
+			name:    "test equal run configs with different task ids",
+			rc:      genRunConfig("a"),
+			otherRc: genRunConfig("b"),
+			out: &RunConfigDiff{
+				ChangedFields: []string{},
+				AddedTasks:    []string{},
+				RemovedTasks:  []string{},
+				ChangedTasks:  []string{},
+			},
+		},
+		{
+			name: "test changed task image and redacted environment",
+			rc:   genRunConfig("a"),
+			otherRc: func() *types.RunConfig {
+				rc := genRunConfig("b")
+				rc.Environment["SECRET01"] = "secretvalue02"
+				rc.Tasks["btask01"].Runtime.Containers[0].Image = "image02"
+				rc.Tasks["btask01"].Environment["ENV01"] = "value02"
+				return rc
+			}(),
+			out: &RunConfigDiff{
+				ChangedFields: []string{"environment"},
+				AddedTasks:    []string{},
+				RemovedTasks:  []string{},
+				ChangedTasks:  []string{"task01"},
+			},
+			diffContains: []string{"-        image: image01", "+        image: image02", "+  SECRET01: <redacted, changed>", "+      ENV01: <redacted, changed>"},
+		},
+		{
+			name: "test added and removed tasks",
+			rc:   genRunConfig("a"),
+			otherRc: func() *types.RunConfig {
+				rc := genRunConfig("b")
+				rc.Tasks["btask03"] = rc.Tasks["btask02"]
+				rc.Tasks["btask03"].Name = "task03"
+				rc.Tasks["btask03"].ID = "btask03"
+				delete(rc.Tasks, "btask02")
+				return rc
+			}(),
+			out: &RunConfigDiff{
+				ChangedFields: []string{},
+				AddedTasks:    []string{"task03"},
+				RemovedTasks:  []string{"task02"},
+				ChangedTasks:  []string{},
+			},
+			diffContains: []string{"-  task02:", "+  task03:"},
+		},
+		{
+			name: "test changed static environment with redacted ssh private key",
+			rc:   genRunConfig("a"),
+			otherRc: func() *types.RunConfig {
+				rc := genRunConfig("b")
+				rc.StaticEnvironment["AGOLA_GIT_REF"] = "refs/heads/devel"
+				rc.StaticEnvironment["AGOLA_SSHPRIVKEY"] = "secretvalue04"
+				return rc
+			}(),
+			out: &RunConfigDiff{
+				ChangedFields: []string{"static_environment"},
+				AddedTasks:    []string{},
+				RemovedTasks:  []string{},
+				ChangedTasks:  []string{},
+			},
+			diffContains: []string{"-  AGOLA_GIT_REF: refs/heads/master", "+  AGOLA_GIT_REF: refs/heads/devel", "+  AGOLA_SSHPRIVKEY: <redacted, changed>"},
+		},
+		{
+			name: "test changed task file with redacted content",
+			rc: func() *types.RunConfig {
+				rc := genRunConfig("a")
+				rc.Tasks["atask01"].Files = []*types.TaskFile{{Path: "/root/.kube/config", Content: "secretvalue05", Mode: 0600}}
+				return rc
+			}(),
+			otherRc: func() *types.RunConfig {
+				rc := genRunConfig("b")
+				rc.Tasks["btask01"].Files = []*types.TaskFile{{Path: "/root/.kube/config", Content: "secretvalue06", Mode: 0600}}
+				return rc
+			}(),
+			out: &RunConfigDiff{
+				ChangedFields: []string{},
+				AddedTasks:    []string{},
+				RemovedTasks:  []string{},
+				ChangedTasks:  []string{"task01"},
+			},
+			diffContains: []string{"+    - content: <redacted, changed>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := diffRunConfigs(tt.rc, tt.otherRc)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			textDiff := out.Diff
+			out.Diff = ""
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+			if len(tt.diffContains) == 0 && textDiff != "" {
+				t.Errorf("expected empty diff, got:\n%s", textDiff)
+			}
+			for _, s := range tt.diffContains {
+				if !strings.Contains(textDiff, s+"\n") {
+					t.Errorf("expected diff to contain %q, got:\n%s", s, textDiff)
+				}
+			}
+			for _, s := range []string{"secretvalue", "value01", "value02"} {
+				if strings.Contains(textDiff, s) {
+					t.Errorf("diff contains not redacted value %q:\n%s", s, textDiff)
+				}
+			}
+		})
+	}
+}
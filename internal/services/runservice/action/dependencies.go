@@ -0,0 +1,66 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// RunDependenciesStatus reports the status of the upstream runs of a run
+type RunDependenciesStatus struct {
+	// Satisfied is true when all the upstream runs successfully finished
+	Satisfied bool
+	// FailedRun is an upstream run finished without success. When set the
+	// run will never be started.
+	FailedRun *types.Run
+}
+
+// GetRunDependenciesStatus returns the status of the upstream runs of the
+// provided run
+func (h *ActionHandler) GetRunDependenciesStatus(ctx context.Context, r *types.Run) (*RunDependenciesStatus, error) {
+	upstreamRuns := make([]*types.Run, 0, len(r.DependsOn))
+	for _, upstreamRunID := range r.DependsOn {
+		upstreamRun, err := store.GetRunEtcdOrOST(ctx, h.e, h.dm, upstreamRunID)
+		if err != nil {
+			return nil, err
+		}
+		if upstreamRun == nil {
+			return nil, errors.Errorf("upstream run %q of run %q doesn't exist", upstreamRunID, r.ID)
+		}
+		upstreamRuns = append(upstreamRuns, upstreamRun)
+	}
+
+	return runDependenciesStatus(upstreamRuns), nil
+}
+
+func runDependenciesStatus(upstreamRuns []*types.Run) *RunDependenciesStatus {
+	s := &RunDependenciesStatus{Satisfied: true}
+	for _, upstreamRun := range upstreamRuns {
+		if upstreamRun.Phase == types.RunPhaseFinished && upstreamRun.Result == types.RunResultSuccess {
+			continue
+		}
+		s.Satisfied = false
+		// setup error and cancelled runs or runs finished without success
+		if upstreamRun.Phase.IsFinished() && s.FailedRun == nil {
+			s.FailedRun = upstreamRun
+		}
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"testing"
+
+	"agola.io/agola/services/runservice/types"
+)
+
+func TestRunDependenciesStatus(t *testing.T) {
+	successRun := &types.Run{ID: "1", Phase: types.RunPhaseFinished, Result: types.RunResultSuccess}
+	runningRun := &types.Run{ID: "2", Phase: types.RunPhaseRunning, Result: types.RunResultUnknown}
+	failedRun := &types.Run{ID: "3", Phase: types.RunPhaseFinished, Result: types.RunResultFailed}
+	cancelledRun := &types.Run{ID: "4", Phase: types.RunPhaseCancelled, Result: types.RunResultUnknown}
+
+	tests := []struct {
+		name         string
+		upstreamRuns []*types.Run
+		satisfied    bool
+		failedRunID  string
+	}{
+		{
+			name:      "test no upstream runs",
+			satisfied: true,
+		},
+		{
+			name:         "test successful upstream runs",
+			upstreamRuns: []*types.Run{successRun},
+			satisfied:    true,
+		},
+		{
+			name:         "test running upstream run",
+			upstreamRuns: []*types.Run{successRun, runningRun},
+		},
+		{
+			name:         "test failed upstream run",
+			upstreamRuns: []*types.Run{runningRun, failedRun},
+			failedRunID:  "3",
+		},
+		{
+			name:         "test cancelled upstream run",
+			upstreamRuns: []*types.Run{successRun, cancelledRun},
+			failedRunID:  "4",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := runDependenciesStatus(tt.upstreamRuns)
+			if s.Satisfied != tt.satisfied {
+				t.Fatalf("expected satisfied %t, got %t", tt.satisfied, s.Satisfied)
+			}
+			var failedRunID string
+			if s.FailedRun != nil {
+				failedRunID = s.FailedRun.ID
+			}
+			if failedRunID != tt.failedRunID {
+				t.Fatalf("expected failed run %q, got %q", tt.failedRunID, failedRunID)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	secretEnvironmentValue = "[secret]"
+)
+
+type RunTaskEnvironment struct {
+	RunID    string
+	TaskID   string
+	TaskName string
+	// Environment is the environment of the task main container
+	Environment map[string]string
+	// Steps are the environment variables defined by the run steps
+	// overriding the task environment
+	Steps []*RunTaskStepEnvironment
+}
+
+type RunTaskStepEnvironment struct {
+	Step        int
+	Name        string
+	Environment map[string]string
+}
+
+// GetRunTaskEnvironment returns the environment computed for a run task. The
+// values of the environment variables taken from a variable (or that could
+// contain secrets) are always redacted.
+func (h *ActionHandler) GetRunTaskEnvironment(ctx context.Context, runID, taskID string) (*RunTaskEnvironment, error) {
+	var run *types.Run
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		run, err = h.readDB.GetRun(tx, runID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, util.NewErrNotExist(errors.Errorf("run %q doesn't exist", runID))
+	}
+
+	rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get run config %q: %w", run.ID, err)
+	}
+	rct, ok := rc.Tasks[taskID]
+	if !ok {
+		return nil, util.NewErrNotExist(errors.Errorf("run %q doesn't have task %q", run.ID, taskID))
+	}
+
+	env := genRunTaskEnvironment(rc, rct)
+	env.RunID = run.ID
+
+	return env, nil
+}
+
+// redactedEnv is an environment that tracks which values are secrets
+type redactedEnv struct {
+	env     map[string]string
+	secrets map[string]struct{}
+}
+
+func newRedactedEnv() *redactedEnv {
+	return &redactedEnv{env: map[string]string{}, secrets: map[string]struct{}{}}
+}
+
+// merge sets the provided environment variables. When allSecret is true all
+// the values are secrets, otherwise only the ones in secretNames.
+func (e *redactedEnv) merge(env map[string]string, secretNames []string, allSecret bool) {
+	secrets := map[string]struct{}{}
+	for _, name := range secretNames {
+		secrets[name] = struct{}{}
+	}
+	for k, v := range env {
+		e.env[k] = v
+		_, secret := secrets[k]
+		if allSecret || secret {
+			e.secrets[k] = struct{}{}
+		} else {
+			delete(e.secrets, k)
+		}
+	}
+}
+
+func (e *redactedEnv) redacted() map[string]string {
+	env := map[string]string{}
+	for k, v := range e.env {
+		if _, ok := e.secrets[k]; ok {
+			v = secretEnvironmentValue
+		}
+		env[k] = v
+	}
+	return env
+}
+
+// genRunTaskEnvironment generates the task environment with the same
+// precedence used when executing it: the main container environment is
+// overridden by the task environment, the run static environment and the run
+// environment. The environment variables injected by the executor (like the
+// proxy ones) aren't known and not reported.
+func genRunTaskEnvironment(rc *types.RunConfig, rct *types.RunConfigTask) *RunTaskEnvironment {
+	// consider all the values as secrets if we don't know which ones are taken
+	// from a variable
+	untracked := !rct.SecretEnvironmentTracked
+
+	env := newRedactedEnv()
+	if rct.Runtime != nil && len(rct.Runtime.Containers) > 0 {
+		c := rct.Runtime.Containers[0]
+		env.merge(c.Environment, c.SecretEnvironment, untracked)
+	}
+	env.merge(rct.Environment, rct.SecretEnvironment, untracked)
+	env.merge(rc.StaticEnvironment, staticSecretEnvironment, false)
+	// the run environment is user provided and could contain secrets
+	env.merge(rc.Environment, nil, true)
+
+	res := &RunTaskEnvironment{
+		TaskID:      rct.ID,
+		TaskName:    rct.Name,
+		Environment: env.redacted(),
+		Steps:       []*RunTaskStepEnvironment{},
+	}
+
+	for i, s := range rct.Steps {
+		rs, ok := s.(*types.RunStep)
+		if !ok || len(rs.Environment) == 0 {
+			continue
+		}
+		senv := newRedactedEnv()
+		senv.merge(rs.Environment, rs.SecretEnvironment, untracked)
+		res.Steps = append(res.Steps, &RunTaskStepEnvironment{
+			Step:        i,
+			Name:        rs.Name,
+			Environment: senv.redacted(),
+		})
+	}
+
+	return res
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"testing"
+
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenRunTaskEnvironment(t *testing.T) {
+	genRunConfig := func(tracked bool) *types.RunConfig {
+		return &types.RunConfig{
+			ID:                "run01",
+			StaticEnvironment: map[string]string{"AGOLA_GIT_REF": "refs/heads/master", "AGOLA_SSHPRIVKEY": "sshprivkey", "STATIC01": "staticvalue01"},
+			Environment:       map[string]string{"RUNENV01": "runvalue01"},
+			Tasks: map[string]*types.RunConfigTask{
+				"task01": &types.RunConfigTask{
+					ID:   "task01",
+					Name: "task01",
+					Runtime: &types.Runtime{Type: types.RuntimeType("pod"),
+						Containers: []*types.Container{
+							{
+								Image:             "image01",
+								Environment:       map[string]string{"CENV01": "cvalue01", "CSECRET01": "csecretvalue01", "STATIC01": "cvalue02"},
+								SecretEnvironment: []string{"CSECRET01"},
+							},
+						},
+					},
+					Environment:              map[string]string{"ENV01": "value01", "SECRET01": "secretvalue01", "CSECRET01": "value02"},
+					SecretEnvironment:        []string{"SECRET01"},
+					SecretEnvironmentTracked: tracked,
+					Steps: types.Steps{
+						&types.RestoreWorkspaceStep{BaseStep: types.BaseStep{Type: "restore_workspace"}, DestDir: "."},
+						&types.RunStep{
+							BaseStep:          types.BaseStep{Type: "run", Name: "step01"},
+							Command:           "make",
+							Environment:       map[string]string{"SENV01": "svalue01", "SSECRET01": "ssecretvalue01"},
+							SecretEnvironment: []string{"SSECRET01"},
+						},
+						&types.RunStep{
+							BaseStep: types.BaseStep{Type: "run", Name: "step02"},
+							Command:  "make test",
+						},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		rc   *types.RunConfig
+		out  *RunTaskEnvironment
+	}{
+		{
+			name: "test redacted environment",
+			rc:   genRunConfig(true),
+			out: &RunTaskEnvironment{
+				TaskID:   "task01",
+				TaskName: "task01",
+				Environment: map[string]string{
+					"AGOLA_GIT_REF":    "refs/heads/master",
+					"AGOLA_SSHPRIVKEY": "[secret]",
+					"CENV01":           "cvalue01",
+					"CSECRET01":        "value02",
+					"ENV01":            "value01",
+					"RUNENV01":         "[secret]",
+					"SECRET01":         "[secret]",
+					"STATIC01":         "staticvalue01",
+				},
+				Steps: []*RunTaskStepEnvironment{
+					{
+						Step:        1,
+						Name:        "step01",
+						Environment: map[string]string{"SENV01": "svalue01", "SSECRET01": "[secret]"},
+					},
+				},
+			},
+		},
+		{
+			name: "test untracked secrets are all redacted",
+			rc:   genRunConfig(false),
+			out: &RunTaskEnvironment{
+				TaskID:   "task01",
+				TaskName: "task01",
+				Environment: map[string]string{
+					"AGOLA_GIT_REF":    "refs/heads/master",
+					"AGOLA_SSHPRIVKEY": "[secret]",
+					"CENV01":           "[secret]",
+					"CSECRET01":        "[secret]",
+					"ENV01":            "[secret]",
+					"RUNENV01":         "[secret]",
+					"SECRET01":         "[secret]",
+					"STATIC01":         "staticvalue01",
+				},
+				Steps: []*RunTaskStepEnvironment{
+					{
+						Step:        1,
+						Name:        "step01",
+						Environment: map[string]string{"SENV01": "[secret]", "SSECRET01": "[secret]"},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := genRunTaskEnvironment(tt.rc, tt.rc.Tasks["task01"])
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"crypto/rsa"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	scommon "agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// IDTokenEnvVar is the task environment variable containing the task id
+	// token
+	IDTokenEnvVar = "AGOLA_ID_TOKEN"
+
+	defaultIDTokenDuration = 1 * time.Hour
+)
+
+// idTokenAnnotationClaims maps the run annotations, set by the gateway, added
+// to the id token claims to the claim names
+var idTokenAnnotationClaims = map[string]string{
+	"projectid":            "project_id",
+	"run_type":             "run_type",
+	"ref_type":             "ref_type",
+	"ref":                  "ref",
+	"branch":               "branch",
+	"tag":                  "tag",
+	"pull_request_id":      "pull_request_id",
+	"commit_sha":           "commit_sha",
+	"run_creation_trigger": "trigger",
+}
+
+// IDTokenSigner generates the OIDC id tokens provided to the tasks. A task
+// could exchange it with a cloud provider trusting the issuer for temporary
+// credentials.
+type IDTokenSigner struct {
+	issuer   string
+	audience string
+	duration time.Duration
+	key      *rsa.PrivateKey
+}
+
+// NewIDTokenSigner creates an id token signer using the provided pem encoded
+// rsa private key. The audience defaults to the issuer.
+func NewIDTokenSigner(issuer, audience string, duration time.Duration, privateKeyData []byte) (*IDTokenSigner, error) {
+	if issuer == "" {
+		return nil, errors.Errorf("empty id token issuer")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(privateKeyData)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse id token private key: %w", err)
+	}
+	if audience == "" {
+		audience = issuer
+	}
+	if duration == 0 {
+		duration = defaultIDTokenDuration
+	}
+
+	return &IDTokenSigner{
+		issuer:   issuer,
+		audience: audience,
+		duration: duration,
+		key:      key,
+	}, nil
+}
+
+// idTokenSubject returns the id token subject of a run. It's generated from
+// the run group (i.e. /project/{projectid}/branch/master becomes
+// project:{projectid}:branch:master) so the cloud providers trust policies
+// could restrict the access by project and ref.
+func idTokenSubject(group string) string {
+	pl := util.PathList(group)
+	for i, p := range pl {
+		// the group ref name is path escaped
+		if up, err := url.PathUnescape(p); err == nil {
+			pl[i] = up
+		}
+	}
+	return strings.Join(pl, ":")
+}
+
+// GenerateTaskIDToken generates the id token of a run task.
+func (s *IDTokenSigner) GenerateTaskIDToken(r *types.Run, rt *types.RunTask, rct *types.RunConfigTask) (string, error) {
+	now := time.Now()
+
+	claims := jwt.MapClaims{
+		"iss":         s.issuer,
+		"aud":         s.audience,
+		"sub":         idTokenSubject(r.Group),
+		"iat":         now.Unix(),
+		"nbf":         now.Unix(),
+		"exp":         now.Add(s.duration).Unix(),
+		"jti":         uuid.NewV4().String(),
+		"run_id":      r.ID,
+		"run_counter": strconv.FormatUint(r.Counter, 10),
+		"run_group":   r.Group,
+		"task_id":     rt.ID,
+		"task_name":   rct.Name,
+	}
+	for annotation, claim := range idTokenAnnotationClaims {
+		if v, ok := r.Annotations[annotation]; ok && v != "" {
+			claims[claim] = v
+		}
+	}
+	if r.Trigger != nil {
+		if r.Trigger.Type != "" {
+			claims["trigger"] = r.Trigger.Type
+		}
+		if r.Trigger.TriggeredBy != "" {
+			claims["triggered_by"] = r.Trigger.TriggeredBy
+		}
+	}
+
+	return scommon.GenerateIDToken(s.key, claims)
+}
+
+// SetIDTokenSigner sets the signer of the tasks id tokens. It could be called
+// at any time to rotate the signing key. A nil signer disables the id tokens.
+func (h *ActionHandler) SetIDTokenSigner(s *IDTokenSigner) {
+	h.idTokenSignerMutex.Lock()
+	defer h.idTokenSignerMutex.Unlock()
+	h.idTokenSigner = s
+}
+
+func (h *ActionHandler) getIDTokenSigner() *IDTokenSigner {
+	h.idTokenSignerMutex.RLock()
+	defer h.idTokenSignerMutex.RUnlock()
+	return h.idTokenSigner
+}
+
+// GenExecutorTaskSpecData generates the executor task spec data of a run task.
+// When an id token signer is defined a new task id token is added to the task
+// environment. Untrusted runs never receive an id token since it could be
+// exchanged for the project cloud credentials.
+func (h *ActionHandler) GenExecutorTaskSpecData(r *types.Run, rt *types.RunTask, rc *types.RunConfig) (*types.ExecutorTaskSpecData, error) {
+	data := common.GenExecutorTaskSpecData(r, rt, rc)
+
+	idTokenSigner := h.getIDTokenSigner()
+	if idTokenSigner == nil {
+		return data, nil
+	}
+	if r.Trigger != nil && r.Trigger.Untrusted {
+		return data, nil
+	}
+
+	token, err := idTokenSigner.GenerateTaskIDToken(r, rt, rc.Tasks[rt.ID])
+	if err != nil {
+		return nil, errors.Errorf("failed to generate task %q id token: %w", rt.ID, err)
+	}
+	// don't change the run config task environment
+	environment := make(map[string]string, len(data.Environment)+1)
+	for k, v := range data.Environment {
+		environment[k] = v
+	}
+	environment[IDTokenEnvVar] = token
+	data.Environment = environment
+
+	return data, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	scommon "agola.io/agola/internal/services/common"
+	"agola.io/agola/services/runservice/types"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestIDTokenSubject(t *testing.T) {
+	tests := []struct {
+		group string
+		out   string
+	}{
+		{
+			group: "/project/projectid01/branch/master",
+			out:   "project:projectid01:branch:master",
+		},
+		{
+			group: "/project/projectid01/branch/feature%2Fbranch01",
+			out:   "project:projectid01:branch:feature/branch01",
+		},
+		{
+			group: "/project/projectid01/pr/1",
+			out:   "project:projectid01:pr:1",
+		},
+		{
+			group: "/user/userid01/branch/master",
+			out:   "user:userid01:branch:master",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			out := idTokenSubject(tt.group)
+			if out != tt.out {
+				t.Fatalf("wrong subject, expected %q, got: %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestGenerateTaskIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	keyData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	s, err := NewIDTokenSigner("https://agola.example.com", "", 0, keyData)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	r := &types.Run{
+		ID:      "run01",
+		Counter: 3,
+		Group:   "/project/projectid01/branch/master",
+		Annotations: map[string]string{
+			"projectid": "projectid01",
+			"branch":    "master",
+			"message":   "commit message",
+		},
+		Trigger: &types.RunTrigger{
+			Type:        "webhook",
+			TriggeredBy: "user01",
+		},
+	}
+	rt := &types.RunTask{ID: "task01"}
+	rct := &types.RunConfigTask{ID: "task01", Name: "build"}
+
+	token, err := s.GenerateTaskIDToken(r, rt, rct)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	claims := jwt.MapClaims{}
+	pt, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if kid := token.Header["kid"]; kid != scommon.IDTokenKeyID(&key.PublicKey) {
+			t.Fatalf("wrong token kid %q", kid)
+		}
+		return &key.PublicKey, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if pt.Method != jwt.SigningMethodRS256 {
+		t.Fatalf("wrong signing method %q", pt.Method.Alg())
+	}
+
+	expectedClaims := map[string]string{
+		"iss":          "https://agola.example.com",
+		"aud":          "https://agola.example.com",
+		"sub":          "project:projectid01:branch:master",
+		"run_id":       "run01",
+		"run_counter":  "3",
+		"task_id":      "task01",
+		"task_name":    "build",
+		"project_id":   "projectid01",
+		"branch":       "master",
+		"trigger":      "webhook",
+		"triggered_by": "user01",
+	}
+	for k, v := range expectedClaims {
+		if claims[k] != v {
+			t.Errorf("wrong claim %q, expected %q, got: %v", k, v, claims[k])
+		}
+	}
+	if _, ok := claims["message"]; ok {
+		t.Errorf("unexpected claim %q", "message")
+	}
+}
+
+func TestGenExecutorTaskSpecDataIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	keyData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	s, err := NewIDTokenSigner("https://agola.example.com", "", 0, keyData)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	h := &ActionHandler{}
+	h.SetIDTokenSigner(s)
+
+	rc := &types.RunConfig{
+		Tasks: map[string]*types.RunConfigTask{
+			"task01": {ID: "task01", Name: "build", Runtime: &types.Runtime{Containers: []*types.Container{{Image: "busybox"}}}},
+		},
+	}
+	rt := &types.RunTask{ID: "task01"}
+
+	tests := []struct {
+		name    string
+		trigger *types.RunTrigger
+		idToken bool
+	}{
+		{
+			name:    "test trusted run",
+			idToken: true,
+		},
+		{
+			name:    "test trusted run with trigger",
+			trigger: &types.RunTrigger{Type: "webhook"},
+			idToken: true,
+		},
+		{
+			name:    "test untrusted run",
+			trigger: &types.RunTrigger{Type: "webhook", Untrusted: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &types.Run{
+				ID:      "run01",
+				Group:   "/project/projectid01/pr/1",
+				Trigger: tt.trigger,
+				Tasks:   map[string]*types.RunTask{"task01": rt},
+			}
+
+			data, err := h.GenExecutorTaskSpecData(r, rt, rc)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			_, ok := data.Environment[IDTokenEnvVar]
+			if ok != tt.idToken {
+				t.Fatalf("expected id token in the task environment: %t, got: %t", tt.idToken, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/services/runservice/types"
+)
+
+// previewEnvironmentAction returns the datamanager action that registers the
+// preview environment deployed by the run or, for teardown runs, removes it
+func (h *ActionHandler) previewEnvironmentAction(ctx context.Context, run *types.Run) (*datamanager.Action, error) {
+	id := store.PreviewEnvironmentID(run.Group, run.PreviewEnvironment.Name)
+	if run.PreviewEnvironment.Teardown {
+		return store.OSTDeletePreviewEnvironmentAction(id), nil
+	}
+
+	var env *types.PreviewEnvironment
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		env, err = h.readDB.GetPreviewEnvironmentOST(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if env == nil {
+		env = &types.PreviewEnvironment{
+			ID:           id,
+			Name:         run.PreviewEnvironment.Name,
+			Group:        run.Group,
+			CreationTime: now,
+		}
+	}
+	env.RunID = run.ID
+	env.UpdateTime = now
+
+	return store.OSTSavePreviewEnvironmentAction(env)
+}
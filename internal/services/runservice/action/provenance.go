@@ -0,0 +1,333 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/db"
+	scommon "agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// ProvenancePayloadType is the DSSE payload type of the run provenance
+	// in-toto statement
+	ProvenancePayloadType = "application/vnd.in-toto+json"
+
+	inTotoStatementType         = "https://in-toto.io/Statement/v0.1"
+	slsaProvenancePredicateType = "https://slsa.dev/provenance/v0.2"
+	agolaRunBuildType           = "https://agola.io/run/v1"
+
+	// ProvenanceSubjectOutputPrefix is the prefix of the task outputs
+	// reporting an artifact built by the run in the name@algorithm:hex format
+	// (i.e. provenance_subject_app=myapp.tar.gz@sha256:...)
+	ProvenanceSubjectOutputPrefix = "provenance_subject"
+)
+
+// provenanceDigestRegexp matches a digest in the algorithm:hex format
+var provenanceDigestRegexp = regexp.MustCompile(`^(sha256|sha512):([a-f0-9]+)$`)
+
+type provenanceStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []*provenanceSubject `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     *slsaProvenance      `json:"predicate"`
+}
+
+type provenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type slsaProvenance struct {
+	Builder    slsaBuilder     `json:"builder"`
+	BuildType  string          `json:"buildType"`
+	Invocation slsaInvocation  `json:"invocation"`
+	Metadata   slsaMetadata    `json:"metadata"`
+	Materials  []*slsaMaterial `json:"materials"`
+}
+
+type slsaBuilder struct {
+	ID string `json:"id"`
+}
+
+type slsaInvocation struct {
+	ConfigSource slsaConfigSource `json:"configSource"`
+}
+
+type slsaConfigSource struct {
+	URI        string            `json:"uri,omitempty"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
+
+type slsaMetadata struct {
+	BuildInvocationID string     `json:"buildInvocationId"`
+	BuildStartedOn    *time.Time `json:"buildStartedOn,omitempty"`
+	BuildFinishedOn   *time.Time `json:"buildFinishedOn,omitempty"`
+	Reproducible      bool       `json:"reproducible"`
+}
+
+type slsaMaterial struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// RunProvenance is a DSSE envelope containing the signed in-toto statement
+// with the SLSA provenance of a run.
+type RunProvenance struct {
+	PayloadType string
+	Payload     []byte
+	KeyID       string
+	Signature   []byte
+}
+
+// parseProvenanceSubject parses a provenance subject provided as
+// name@algorithm:hex (i.e. myapp.tar.gz@sha256:...)
+func parseProvenanceSubject(s string) (*provenanceSubject, error) {
+	i := strings.LastIndex(s, "@")
+	if i <= 0 {
+		return nil, errors.Errorf("wrong subject %q, it must be in the name@algorithm:digest format", s)
+	}
+	name, digest := s[:i], s[i+1:]
+	m := provenanceDigestRegexp.FindStringSubmatch(digest)
+	if m == nil {
+		return nil, errors.Errorf("wrong subject %q digest %q", s, digest)
+	}
+
+	return &provenanceSubject{Name: name, Digest: map[string]string{m[1]: m[2]}}, nil
+}
+
+// runProvenanceSubjects returns the artifacts built by the run as reported by
+// the outputs, with the ProvenanceSubjectOutputPrefix prefix, of its
+// successful tasks. The subjects are never provided by the provenance requester
+// so only artifacts recorded by the run itself are signed.
+func runProvenanceSubjects(r *types.Run) ([]*provenanceSubject, error) {
+	taskIDs := make([]string, 0, len(r.Tasks))
+	for id := range r.Tasks {
+		taskIDs = append(taskIDs, id)
+	}
+	sort.Strings(taskIDs)
+
+	subjects := []*provenanceSubject{}
+	seen := map[string]struct{}{}
+	for _, id := range taskIDs {
+		rt := r.Tasks[id]
+		if rt.Status != types.RunTaskStatusSuccess {
+			continue
+		}
+		names := make([]string, 0, len(rt.Outputs))
+		for name := range rt.Outputs {
+			if strings.HasPrefix(name, ProvenanceSubjectOutputPrefix) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := rt.Outputs[name]
+			if _, ok := seen[value]; ok {
+				continue
+			}
+			seen[value] = struct{}{}
+
+			ps, err := parseProvenanceSubject(value)
+			if err != nil {
+				return nil, errors.Errorf("task %q output %q: %w", rt.ID, name, err)
+			}
+			subjects = append(subjects, ps)
+		}
+	}
+
+	return subjects, nil
+}
+
+// runProvenanceMaterials returns the run source commit and the images of the
+// containers of the executed run tasks. The main container image includes the
+// digest reported by the executor when it pulled it (the executors not
+// reporting the image pull, like the kubernetes one, don't record it).
+func runProvenanceMaterials(r *types.Run, rc *types.RunConfig) []*slsaMaterial {
+	materials := []*slsaMaterial{}
+
+	if repoURL := rc.StaticEnvironment["AGOLA_REPOSITORY_URL"]; repoURL != "" {
+		m := &slsaMaterial{URI: "git+" + repoURL}
+		if commitSHA := rc.StaticEnvironment["AGOLA_GIT_COMMITSHA"]; commitSHA != "" {
+			m.Digest = map[string]string{"sha1": commitSHA}
+		}
+		materials = append(materials, m)
+	}
+
+	// an image tag could have been resolved to different digests by different
+	// tasks. An image without a digest is reported only when there's no other
+	// material for it with a digest.
+	digested := map[string]*slsaMaterial{}
+	undigested := map[string]bool{}
+	for _, rt := range r.Tasks {
+		if rt.Skip {
+			continue
+		}
+		rct, ok := rc.Tasks[rt.ID]
+		if !ok || rct.Runtime == nil {
+			continue
+		}
+		for i, c := range rct.Runtime.Containers {
+			uri := "docker://" + c.Image
+			if i == 0 && rt.ImagePull != nil && rt.ImagePull.Image == c.Image {
+				if m := provenanceDigestRegexp.FindStringSubmatch(rt.ImagePull.Digest); m != nil {
+					digested[uri+"@"+rt.ImagePull.Digest] = &slsaMaterial{URI: uri, Digest: map[string]string{m[1]: m[2]}}
+					continue
+				}
+			}
+			undigested[uri] = true
+		}
+	}
+	images := map[string]*slsaMaterial{}
+	for k, m := range digested {
+		images[k] = m
+		delete(undigested, m.URI)
+	}
+	for uri := range undigested {
+		images[uri] = &slsaMaterial{URI: uri}
+	}
+	keys := make([]string, 0, len(images))
+	for k := range images {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		materials = append(materials, images[k])
+	}
+
+	return materials
+}
+
+// runProvenanceStatement generates the in-toto statement, with a SLSA
+// provenance predicate, of a run. The builder id is the id tokens issuer.
+func runProvenanceStatement(builderID string, r *types.Run, rc *types.RunConfig, subjects []*provenanceSubject) *provenanceStatement {
+	configSource := slsaConfigSource{EntryPoint: rc.Name}
+	if repoURL := rc.StaticEnvironment["AGOLA_REPOSITORY_URL"]; repoURL != "" {
+		configSource.URI = "git+" + repoURL
+		if ref := rc.StaticEnvironment["AGOLA_GIT_REF"]; ref != "" {
+			configSource.URI += "@" + ref
+		}
+	}
+	if commitSHA := rc.StaticEnvironment["AGOLA_GIT_COMMITSHA"]; commitSHA != "" {
+		configSource.Digest = map[string]string{"sha1": commitSHA}
+	}
+
+	if subjects == nil {
+		subjects = []*provenanceSubject{}
+	}
+
+	return &provenanceStatement{
+		Type:          inTotoStatementType,
+		Subject:       subjects,
+		PredicateType: slsaProvenancePredicateType,
+		Predicate: &slsaProvenance{
+			Builder:    slsaBuilder{ID: builderID},
+			BuildType:  agolaRunBuildType,
+			Invocation: slsaInvocation{ConfigSource: configSource},
+			Metadata: slsaMetadata{
+				BuildInvocationID: r.ID,
+				BuildStartedOn:    r.StartTime,
+				BuildFinishedOn:   r.EndTime,
+			},
+			Materials: runProvenanceMaterials(r, rc),
+		},
+	}
+}
+
+// dssePAE returns the DSSE pre-authentication encoding of a payload, it's the
+// signed message
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// signProvenance signs the provenance payload with the id tokens signing key
+// (RSASSA-PKCS1-v1_5 using SHA-256). The key id is the same set in the id
+// tokens header so the signature could be verified using the keys published
+// by the gateway.
+func (s *IDTokenSigner) signProvenance(payload []byte) (*RunProvenance, error) {
+	hash := sha256.Sum256(dssePAE(ProvenancePayloadType, payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, errors.Errorf("failed to sign provenance: %w", err)
+	}
+
+	return &RunProvenance{
+		PayloadType: ProvenancePayloadType,
+		Payload:     payload,
+		KeyID:       scommon.IDTokenKeyID(&s.key.PublicKey),
+		Signature:   sig,
+	}, nil
+}
+
+// GetRunProvenance returns the signed SLSA provenance of a successful run. The
+// subjects are the artifacts reported by the run tasks outputs.
+func (h *ActionHandler) GetRunProvenance(ctx context.Context, runID string) (*RunProvenance, error) {
+	idTokenSigner := h.getIDTokenSigner()
+	if idTokenSigner == nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("run provenance not enabled, it requires the id tokens signing key"))
+	}
+
+	var run *types.Run
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		run, err = h.readDB.GetRun(tx, runID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, util.NewErrNotExist(errors.Errorf("run %q doesn't exist", runID))
+	}
+	// only successful runs are attested
+	if run.Phase != types.RunPhaseFinished || run.Result != types.RunResultSuccess {
+		return nil, util.NewErrBadRequest(errors.Errorf("run %q didn't finish successfully", runID))
+	}
+
+	subjects, err := runProvenanceSubjects(run)
+	if err != nil {
+		return nil, util.NewErrBadRequest(err)
+	}
+
+	rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get run config %q: %w", run.ID, err)
+	}
+
+	statement := runProvenanceStatement(idTokenSigner.issuer, run, rc, subjects)
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return nil, errors.Errorf("failed to marshal provenance statement: %w", err)
+	}
+
+	return idTokenSigner.signProvenance(payload)
+}
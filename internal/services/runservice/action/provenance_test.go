@@ -0,0 +1,199 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	scommon "agola.io/agola/internal/services/common"
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseProvenanceSubject(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *provenanceSubject
+		err bool
+	}{
+		{
+			in:  "myapp.tar.gz@sha256:0123abcd",
+			out: &provenanceSubject{Name: "myapp.tar.gz", Digest: map[string]string{"sha256": "0123abcd"}},
+		},
+		{
+			in:  "registry.example.com/myapp@sha512:0123abcd",
+			out: &provenanceSubject{Name: "registry.example.com/myapp", Digest: map[string]string{"sha512": "0123abcd"}},
+		},
+		{
+			in:  "myapp.tar.gz",
+			err: true,
+		},
+		{
+			in:  "@sha256:0123abcd",
+			err: true,
+		},
+		{
+			in:  "myapp.tar.gz@md5:0123abcd",
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out, err := parseProvenanceSubject(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("subject mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunProvenanceMaterials(t *testing.T) {
+	rc := &types.RunConfig{
+		StaticEnvironment: map[string]string{
+			"AGOLA_REPOSITORY_URL": "https://git.example.com/org01/repo01.git",
+			"AGOLA_GIT_COMMITSHA":  "0123456789abcdef",
+		},
+		Tasks: map[string]*types.RunConfigTask{
+			"task01": {ID: "task01", Runtime: &types.Runtime{Containers: []*types.Container{{Image: "golang:1.12"}, {Image: "postgres:11"}}}},
+			"task02": {ID: "task02", Runtime: &types.Runtime{Containers: []*types.Container{{Image: "golang:1.12"}}}},
+			"task03": {ID: "task03", Runtime: &types.Runtime{Containers: []*types.Container{{Image: "alpine:3.10"}}}},
+			"task04": {ID: "task04", Runtime: &types.Runtime{Containers: []*types.Container{{Image: "busybox"}}}},
+		},
+	}
+	r := &types.Run{
+		Tasks: map[string]*types.RunTask{
+			"task01": {ID: "task01", ImagePull: &types.ImagePull{Image: "golang:1.12", Digest: "sha256:aaaa"}},
+			"task02": {ID: "task02"},
+			// image pull not reported (i.e. by the kubernetes executor)
+			"task03": {ID: "task03"},
+			"task04": {ID: "task04", Skip: true},
+		},
+	}
+
+	expected := []*slsaMaterial{
+		{URI: "git+https://git.example.com/org01/repo01.git", Digest: map[string]string{"sha1": "0123456789abcdef"}},
+		{URI: "docker://alpine:3.10"},
+		{URI: "docker://golang:1.12", Digest: map[string]string{"sha256": "aaaa"}},
+		{URI: "docker://postgres:11"},
+	}
+
+	materials := runProvenanceMaterials(r, rc)
+	if diff := cmp.Diff(expected, materials); diff != "" {
+		t.Fatalf("materials mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunProvenanceSubjects(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks map[string]*types.RunTask
+		out   []*provenanceSubject
+		err   bool
+	}{
+		{
+			name: "test no subjects",
+			tasks: map[string]*types.RunTask{
+				"task01": {ID: "task01", Status: types.RunTaskStatusSuccess, Outputs: map[string]string{"version": "1.0.0"}},
+			},
+			out: []*provenanceSubject{},
+		},
+		{
+			name: "test subjects from successful tasks outputs",
+			tasks: map[string]*types.RunTask{
+				"task02": {ID: "task02", Status: types.RunTaskStatusSuccess, Outputs: map[string]string{
+					"provenance_subject_b": "b.tar.gz@sha256:bbbb",
+					"provenance_subject_a": "a.tar.gz@sha256:aaaa",
+				}},
+				// duplicated subject
+				"task01": {ID: "task01", Status: types.RunTaskStatusSuccess, Outputs: map[string]string{"provenance_subject": "b.tar.gz@sha256:bbbb"}},
+				"task03": {ID: "task03", Status: types.RunTaskStatusSkipped, Outputs: map[string]string{"provenance_subject": "c.tar.gz@sha256:cccc"}},
+				"task04": {ID: "task04", Status: types.RunTaskStatusFailed, Outputs: map[string]string{"provenance_subject": "d.tar.gz@sha256:dddd"}},
+			},
+			out: []*provenanceSubject{
+				{Name: "b.tar.gz", Digest: map[string]string{"sha256": "bbbb"}},
+				{Name: "a.tar.gz", Digest: map[string]string{"sha256": "aaaa"}},
+			},
+		},
+		{
+			name: "test wrong subject output",
+			tasks: map[string]*types.RunTask{
+				"task01": {ID: "task01", Status: types.RunTaskStatusSuccess, Outputs: map[string]string{"provenance_subject": "a.tar.gz"}},
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := runProvenanceSubjects(&types.Run{Tasks: tt.tasks})
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("subjects mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSignProvenance(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	keyData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	s, err := NewIDTokenSigner("https://agola.example.com", "", 0, keyData)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	payload := []byte(`{"_type":"https://in-toto.io/Statement/v0.1"}`)
+	p, err := s.signProvenance(payload)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if p.KeyID != scommon.IDTokenKeyID(&key.PublicKey) {
+		t.Fatalf("wrong key id %q", p.KeyID)
+	}
+	hash := sha256.Sum256([]byte("DSSEv1 28 application/vnd.in-toto+json 45 " + string(payload)))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hash[:], p.Signature); err != nil {
+		t.Fatalf("failed to verify provenance signature: %v", err)
+	}
+}
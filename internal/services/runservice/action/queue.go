@@ -0,0 +1,138 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/services/runservice/types"
+)
+
+const (
+	// queueStatusPageSize is the number of queued runs fetched at every
+	// iteration when computing a run queue position
+	queueStatusPageSize = 100
+	// queueStatusEstimationRuns is the number of last finished runs of the
+	// same group used to estimate the run duration
+	queueStatusEstimationRuns = 10
+)
+
+// RunQueueStatus reports the position of a queued run in its run group queue.
+//
+// Runs in the same group are started one at a time in enqueue order (there's
+// no run priority) so the queued runs before it and the currently running runs
+// must complete before the run can start.
+type RunQueueStatus struct {
+	// Position is the run position in the group queue (1 means that the run
+	// is the next one that will be started)
+	Position int
+	// RunningRuns is the number of group runs currently running
+	RunningRuns int
+	// EstimatedStartTime is an estimation of the run start time based on the
+	// duration of the last finished group runs. It's nil when there isn't
+	// enough data to compute it or when the scheduling is paused.
+	EstimatedStartTime *time.Time
+}
+
+// GetRunQueueStatus returns the queue status of the provided run. It returns
+// nil if the run isn't queued.
+func (h *ActionHandler) GetRunQueueStatus(ctx context.Context, run *types.Run) (*RunQueueStatus, error) {
+	if run.Phase != types.RunPhaseQueued {
+		return nil, nil
+	}
+
+	groups := []string{run.Group}
+
+	var queuedAhead int
+	var runningRuns []*types.Run
+	var finishedRuns []*types.Run
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		startRunID := run.ID
+		for {
+			runs, err := h.readDB.GetRuns(tx, groups, false, []types.RunPhase{types.RunPhaseQueued}, nil, nil, startRunID, queueStatusPageSize, types.SortOrderDesc)
+			if err != nil {
+				return err
+			}
+			queuedAhead += len(runs)
+			if len(runs) < queueStatusPageSize {
+				break
+			}
+			startRunID = runs[len(runs)-1].ID
+		}
+
+		var err error
+		runningRuns, err = h.readDB.GetRuns(tx, groups, false, []types.RunPhase{types.RunPhaseRunning}, nil, nil, "", queueStatusPageSize, types.SortOrderAsc)
+		if err != nil {
+			return err
+		}
+		finishedRuns, err = h.readDB.GetRuns(tx, groups, false, []types.RunPhase{types.RunPhaseFinished}, nil, nil, "", queueStatusEstimationRuns, types.SortOrderDesc)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &RunQueueStatus{
+		Position:    queuedAhead + 1,
+		RunningRuns: len(runningRuns),
+	}
+
+	schedulingStatus, err := h.GetSchedulingStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !schedulingStatus.Paused {
+		status.EstimatedStartTime = estimateRunStartTime(time.Now(), runningRuns, queuedAhead, finishedRuns)
+	}
+
+	return status, nil
+}
+
+// estimateRunStartTime estimates when a queued run will start using the
+// average duration of the provided finished runs. It returns nil when there're
+// no finished runs usable for the estimation.
+func estimateRunStartTime(now time.Time, runningRuns []*types.Run, queuedAhead int, finishedRuns []*types.Run) *time.Time {
+	var total time.Duration
+	var count int
+	for _, r := range finishedRuns {
+		if r.StartTime == nil || r.EndTime == nil {
+			continue
+		}
+		total += r.EndTime.Sub(*r.StartTime)
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+	avg := total / time.Duration(count)
+
+	wait := time.Duration(queuedAhead) * avg
+	for _, r := range runningRuns {
+		remaining := avg
+		if r.StartTime != nil {
+			remaining -= now.Sub(*r.StartTime)
+		}
+		// the run is taking longer than the average, consider it as
+		// completing now
+		if remaining > 0 {
+			wait += remaining
+		}
+	}
+
+	t := now.Add(wait)
+	return &t
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"testing"
+	"time"
+
+	"agola.io/agola/services/runservice/types"
+)
+
+func TestEstimateRunStartTime(t *testing.T) {
+	now := time.Date(2019, 7, 6, 12, 0, 0, 0, time.UTC)
+
+	run := func(start, end time.Duration, finished bool) *types.Run {
+		r := &types.Run{}
+		st := now.Add(start)
+		r.StartTime = &st
+		if finished {
+			et := now.Add(end)
+			r.EndTime = &et
+		}
+		return r
+	}
+
+	tests := []struct {
+		name         string
+		runningRuns  []*types.Run
+		queuedAhead  int
+		finishedRuns []*types.Run
+		expected     *time.Duration
+	}{
+		{
+			name:        "test no finished runs",
+			queuedAhead: 2,
+		},
+		{
+			name:         "test first in queue without running runs",
+			finishedRuns: []*types.Run{run(-2*time.Hour, -2*time.Hour+10*time.Minute, true)},
+			expected:     durationPtr(0),
+		},
+		{
+			name:        "test queued runs ahead",
+			queuedAhead: 2,
+			finishedRuns: []*types.Run{
+				run(-2*time.Hour, -2*time.Hour+10*time.Minute, true),
+				run(-1*time.Hour, -1*time.Hour+20*time.Minute, true),
+			},
+			expected: durationPtr(30 * time.Minute),
+		},
+		{
+			name:         "test running run",
+			queuedAhead:  1,
+			runningRuns:  []*types.Run{run(-4*time.Minute, 0, false)},
+			finishedRuns: []*types.Run{run(-2*time.Hour, -2*time.Hour+10*time.Minute, true)},
+			expected:     durationPtr(16 * time.Minute),
+		},
+		{
+			name:         "test running run taking longer than average",
+			runningRuns:  []*types.Run{run(-30*time.Minute, 0, false)},
+			finishedRuns: []*types.Run{run(-2*time.Hour, -2*time.Hour+10*time.Minute, true)},
+			expected:     durationPtr(0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := estimateRunStartTime(now, tt.runningRuns, tt.queuedAhead, tt.finishedRuns)
+			if tt.expected == nil {
+				if st != nil {
+					t.Fatalf("expected no estimation, got: %v", st)
+				}
+				return
+			}
+			if st == nil {
+				t.Fatalf("expected estimation, got none")
+			}
+			if !st.Equal(now.Add(*tt.expected)) {
+				t.Fatalf("expected start time %v, got: %v", now.Add(*tt.expected), st)
+			}
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
@@ -0,0 +1,193 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/services/runservice/common"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// SchedulingPauseWindow is a recurring daily window when the scheduling is
+// paused
+type SchedulingPauseWindow struct {
+	// Start and End are the offsets from the UTC midnight
+	Start time.Duration
+	End   time.Duration
+	// Weekdays are the days of the week where the window starts. Empty means
+	// every day
+	Weekdays []time.Weekday
+}
+
+func NewSchedulingPauseWindow(start, end string, weekdays []string) (*SchedulingPauseWindow, error) {
+	st, err := time.Parse("15:04", start)
+	if err != nil {
+		return nil, errors.Errorf("wrong start time %q: %w", start, err)
+	}
+	et, err := time.Parse("15:04", end)
+	if err != nil {
+		return nil, errors.Errorf("wrong end time %q: %w", end, err)
+	}
+	w := &SchedulingPauseWindow{
+		Start: time.Duration(st.Hour())*time.Hour + time.Duration(st.Minute())*time.Minute,
+		End:   time.Duration(et.Hour())*time.Hour + time.Duration(et.Minute())*time.Minute,
+	}
+	for _, wd := range weekdays {
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(d.String(), wd) {
+				w.Weekdays = append(w.Weekdays, d)
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("wrong weekday %q", wd)
+		}
+	}
+	return w, nil
+}
+
+func (w *SchedulingPauseWindow) startsOn(d time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, wd := range w.Weekdays {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports if the window is active at the provided time
+func (w *SchedulingPauseWindow) Active(t time.Time) bool {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	offset := t.Sub(midnight)
+
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End && w.startsOn(t.Weekday())
+	}
+
+	// the window ends the next day
+	if offset >= w.Start && w.startsOn(t.Weekday()) {
+		return true
+	}
+	return offset < w.End && w.startsOn(midnight.AddDate(0, 0, -1).Weekday())
+}
+
+func (w *SchedulingPauseWindow) String() string {
+	s := fmt.Sprintf("%02d:%02d-%02d:%02d UTC", int(w.Start.Hours()), int(w.Start.Minutes())%60, int(w.End.Hours()), int(w.End.Minutes())%60)
+	if len(w.Weekdays) > 0 {
+		days := make([]string, len(w.Weekdays))
+		for i, d := range w.Weekdays {
+			days[i] = strings.ToLower(d.String())
+		}
+		s += " (" + strings.Join(days, ", ") + ")"
+	}
+	return s
+}
+
+func (h *ActionHandler) SetSchedulingPauseWindows(windows []*SchedulingPauseWindow) {
+	h.schedulingPauseWindows = windows
+}
+
+type SchedulingStatus struct {
+	Paused bool
+	// Pause is the pause requested using the api
+	Pause *types.SchedulingPause
+	// Window is the currently active pause window
+	Window *SchedulingPauseWindow
+}
+
+func (h *ActionHandler) GetSchedulingStatus(ctx context.Context) (*SchedulingStatus, error) {
+	status := &SchedulingStatus{}
+
+	resp, err := h.e.Get(ctx, common.EtcdSchedulingPauseKey, 0)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return nil, err
+	}
+	if err == nil {
+		var pause *types.SchedulingPause
+		if err := json.Unmarshal(resp.Kvs[0].Value, &pause); err != nil {
+			return nil, err
+		}
+		status.Paused = true
+		status.Pause = pause
+	}
+
+	now := time.Now()
+	for _, w := range h.schedulingPauseWindows {
+		if w.Active(now) {
+			status.Paused = true
+			status.Window = w
+			break
+		}
+	}
+
+	return status, nil
+}
+
+// PauseScheduling pauses the scheduling until ResumeScheduling is called. The
+// configured pause windows aren't affected.
+func (h *ActionHandler) PauseScheduling(ctx context.Context, reason string) (*types.SchedulingPause, error) {
+	pause := &types.SchedulingPause{
+		Reason:   reason,
+		PausedAt: time.Now(),
+	}
+	pausej, err := json.Marshal(pause)
+	if err != nil {
+		return nil, err
+	}
+
+	txResp, err := h.e.AtomicPut(ctx, common.EtcdSchedulingPauseKey, pausej, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !txResp.Succeeded {
+		return nil, util.NewErrBadRequest(errors.Errorf("scheduling already paused"))
+	}
+
+	return pause, nil
+}
+
+func (h *ActionHandler) ResumeScheduling(ctx context.Context) error {
+	resp, err := h.e.Get(ctx, common.EtcdSchedulingPauseKey, 0)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return err
+	}
+	if err == etcd.ErrKeyNotFound {
+		return util.NewErrBadRequest(errors.Errorf("scheduling not paused"))
+	}
+
+	txResp, err := h.e.AtomicDelete(ctx, common.EtcdSchedulingPauseKey, resp.Kvs[0].ModRevision)
+	if err != nil {
+		return err
+	}
+	if !txResp.Succeeded {
+		return errors.Errorf("failed to delete scheduling pause key due to concurrent update")
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulingPauseWindowActive(t *testing.T) {
+	// 2019-07-06 is a saturday
+	saturday := func(hour, min int) time.Time {
+		return time.Date(2019, 7, 6, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		weekdays []string
+		t        time.Time
+		active   bool
+	}{
+		{
+			name:   "test time inside window",
+			start:  "02:00",
+			end:    "04:00",
+			t:      saturday(3, 0),
+			active: true,
+		},
+		{
+			name:   "test time at window end",
+			start:  "02:00",
+			end:    "04:00",
+			t:      saturday(4, 0),
+			active: false,
+		},
+		{
+			name:   "test time inside window ending the next day",
+			start:  "22:00",
+			end:    "02:00",
+			t:      saturday(23, 30),
+			active: true,
+		},
+		{
+			name:   "test time after midnight inside window ending the next day",
+			start:  "22:00",
+			end:    "02:00",
+			t:      saturday(1, 0),
+			active: true,
+		},
+		{
+			name:   "test time outside window ending the next day",
+			start:  "22:00",
+			end:    "02:00",
+			t:      saturday(12, 0),
+			active: false,
+		},
+		{
+			name:     "test time inside window on a different weekday",
+			start:    "02:00",
+			end:      "04:00",
+			weekdays: []string{"sunday"},
+			t:        saturday(3, 0),
+			active:   false,
+		},
+		{
+			name:     "test time after midnight inside window started the previous weekday",
+			start:    "22:00",
+			end:      "02:00",
+			weekdays: []string{"Friday"},
+			t:        saturday(1, 0),
+			active:   true,
+		},
+		{
+			name:     "test time after midnight inside window not started the previous weekday",
+			start:    "22:00",
+			end:      "02:00",
+			weekdays: []string{"saturday"},
+			t:        saturday(1, 0),
+			active:   false,
+		},
+		{
+			name:   "test time in another timezone",
+			start:  "02:00",
+			end:    "04:00",
+			t:      saturday(3, 0).In(time.FixedZone("test", 5*60*60)),
+			active: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewSchedulingPauseWindow(tt.start, tt.end, tt.weekdays)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if active := w.Active(tt.t); active != tt.active {
+				t.Fatalf("got active: %t, want active: %t", active, tt.active)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"sort"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/etcd"
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+// maxRunTags is the max number of tags of a run
+const maxRunTags = 20
+
+// normalizeRunTags validates the run tags and returns them sorted and without
+// duplicates
+func normalizeRunTags(tags []string) ([]string, error) {
+	seen := map[string]struct{}{}
+	ntags := []string{}
+	for _, tag := range tags {
+		if !util.ValidateTag(tag) {
+			return nil, util.NewErrBadRequest(errors.Errorf("invalid run tag %q", tag))
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		ntags = append(ntags, tag)
+	}
+	if len(ntags) > maxRunTags {
+		return nil, util.NewErrBadRequest(errors.Errorf("a run cannot have more than %d tags", maxRunTags))
+	}
+	if len(ntags) == 0 {
+		return nil, nil
+	}
+	sort.Strings(ntags)
+
+	return ntags, nil
+}
+
+type RunSetTagsRequest struct {
+	RunID                   string
+	Tags                    []string
+	ChangeGroupsUpdateToken string
+}
+
+// SetRunTags replaces the run tags. Since the tags are only used to filter the
+// runs they could also be changed on archived runs.
+func (h *ActionHandler) SetRunTags(ctx context.Context, req *RunSetTagsRequest) error {
+	tags, err := normalizeRunTags(req.Tags)
+	if err != nil {
+		return err
+	}
+
+	cgt, err := types.UnmarshalChangeGroupsUpdateToken(req.ChangeGroupsUpdateToken)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := store.GetRun(ctx, h.e, req.RunID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		return err
+	}
+	inEtcd := r != nil
+	if inEtcd {
+		r.Tags = tags
+		if _, err := store.AtomicPutRun(ctx, h.e, r, nil, cgt); err != nil {
+			return err
+		}
+		// an archived run could be already saved in the objectstorage
+		// before being removed from etcd, so also update it there
+		if !r.Archived {
+			return nil
+		}
+	}
+
+	r, err = store.OSTGetRun(h.dm, req.RunID)
+	if err != nil {
+		if objectstorage.IsNotExist(err) {
+			if inEtcd {
+				return nil
+			}
+			return util.NewErrNotExist(errors.Errorf("run %q doesn't exist", req.RunID))
+		}
+		return err
+	}
+	r.Tags = tags
+
+	ra, err := store.OSTSaveRunAction(r)
+	if err != nil {
+		return err
+	}
+	_, err = h.dm.WriteWal(ctx, []*datamanager.Action{ra}, nil)
+	return err
+}
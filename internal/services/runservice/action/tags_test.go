@@ -0,0 +1,85 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNormalizeRunTags(t *testing.T) {
+	manyTags := []string{}
+	for i := 0; i <= maxRunTags; i++ {
+		manyTags = append(manyTags, fmt.Sprintf("tag%d", i))
+	}
+
+	tests := []struct {
+		name string
+		tags []string
+		out  []string
+		err  bool
+	}{
+		{
+			name: "no tags",
+			tags: nil,
+			out:  nil,
+		},
+		{
+			name: "tags are sorted and deduplicated",
+			tags: []string{"release", "hotfix", "release"},
+			out:  []string{"hotfix", "release"},
+		},
+		{
+			name: "invalid tag",
+			tags: []string{"release", "hot fix"},
+			err:  true,
+		},
+		{
+			name: "too many tags",
+			tags: manyTags,
+			err:  true,
+		},
+		{
+			name: "duplicated tags don't count for the max number of tags",
+			tags: append(append([]string{}, manyTags[:maxRunTags]...), manyTags[0]),
+			out: func() []string {
+				out := append([]string{}, manyTags[:maxRunTags]...)
+				sort.Strings(out)
+				return out
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := normalizeRunTags(tt.tags)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Fatalf("tags mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	uuid "github.com/satori/go.uuid"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// WebhookDeliveriesLimit is the max number of webhook deliveries kept for
+	// every project. The older ones are removed.
+	WebhookDeliveriesLimit = 100
+)
+
+func validateWebhookDeliveryKey(projectID, deliveryID string) error {
+	// the ids are used as object storage paths
+	if _, err := uuid.FromString(projectID); err != nil {
+		return util.NewErrBadRequest(errors.Errorf("invalid project id %q", projectID))
+	}
+	if _, err := uuid.FromString(deliveryID); err != nil {
+		return util.NewErrBadRequest(errors.Errorf("invalid webhook delivery id %q", deliveryID))
+	}
+	return nil
+}
+
+// CreateWebhookDelivery saves the webhook delivery and removes the project
+// deliveries exceeding WebhookDeliveriesLimit
+func (h *ActionHandler) CreateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) (*types.WebhookDelivery, error) {
+	if err := validateWebhookDeliveryKey(d.ProjectID, d.ID); err != nil {
+		return nil, err
+	}
+	if d.ReceivedAt.IsZero() {
+		d.ReceivedAt = time.Now()
+	}
+
+	dj, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.ost.WriteObject(store.OSTWebhookDeliveryPath(d.ProjectID, d.ID), bytes.NewReader(dj), int64(len(dj)), true); err != nil {
+		return nil, errors.Errorf("failed to write webhook delivery: %w", err)
+	}
+
+	if err := h.pruneWebhookDeliveries(d.ProjectID); err != nil {
+		h.log.Errorf("failed to prune project %q webhook deliveries: %+v", d.ProjectID, err)
+	}
+
+	return d, nil
+}
+
+// webhookDeliveriesObjects returns the project webhook deliveries objects
+// ordered from the newest to the oldest
+func (h *ActionHandler) webhookDeliveriesObjects(projectID string) ([]objectstorage.ObjectInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	objects := []objectstorage.ObjectInfo{}
+	for object := range h.ost.List(store.OSTWebhookDeliveriesDir(projectID)+"/", "", false, doneCh) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].LastModified.After(objects[j].LastModified) })
+
+	return objects, nil
+}
+
+func (h *ActionHandler) pruneWebhookDeliveries(projectID string) error {
+	objects, err := h.webhookDeliveriesObjects(projectID)
+	if err != nil {
+		return err
+	}
+	if len(objects) <= WebhookDeliveriesLimit {
+		return nil
+	}
+	for _, object := range objects[WebhookDeliveriesLimit:] {
+		if err := h.ost.DeleteObject(object.Path); err != nil && !objectstorage.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *ActionHandler) readWebhookDelivery(p string) (*types.WebhookDelivery, error) {
+	f, err := h.ost.ReadObject(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var d *types.WebhookDelivery
+	if err := json.NewDecoder(f).Decode(&d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// GetWebhookDeliveries returns the latest project webhook deliveries, from the
+// newest to the oldest
+func (h *ActionHandler) GetWebhookDeliveries(ctx context.Context, projectID string, limit int) ([]*types.WebhookDelivery, error) {
+	if _, err := uuid.FromString(projectID); err != nil {
+		return nil, util.NewErrBadRequest(errors.Errorf("invalid project id %q", projectID))
+	}
+
+	objects, err := h.webhookDeliveriesObjects(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(objects) > limit {
+		objects = objects[:limit]
+	}
+
+	deliveries := []*types.WebhookDelivery{}
+	for _, object := range objects {
+		d, err := h.readWebhookDelivery(object.Path)
+		if err != nil {
+			// the delivery could have been pruned in the meantime
+			if objectstorage.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+func (h *ActionHandler) GetWebhookDelivery(ctx context.Context, projectID, deliveryID string) (*types.WebhookDelivery, error) {
+	if err := validateWebhookDeliveryKey(projectID, deliveryID); err != nil {
+		return nil, err
+	}
+
+	d, err := h.readWebhookDelivery(store.OSTWebhookDeliveryPath(projectID, deliveryID))
+	if err != nil {
+		if objectstorage.IsNotExist(err) {
+			return nil, util.NewErrNotExist(errors.Errorf("webhook delivery %q doesn't exist", deliveryID))
+		}
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"agola.io/agola/internal/objectstorage"
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+)
+
+func TestWebhookDeliveries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := objectstorage.NewPosix(dir)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	h := &ActionHandler{log: zap.NewNop().Sugar(), ost: objectstorage.NewObjStorage(s, "/")}
+	ctx := context.Background()
+
+	projectID := uuid.NewV4().String()
+	var first *types.WebhookDelivery
+	for i := 0; i < WebhookDeliveriesLimit+5; i++ {
+		d, err := h.CreateWebhookDelivery(ctx, &types.WebhookDelivery{
+			ID:        uuid.NewV4().String(),
+			ProjectID: projectID,
+			Event:     "push",
+			Payload:   []byte(`{"ref":"refs/heads/master"}`),
+			Status:    types.WebhookDeliveryStatusSuccess,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		if first == nil {
+			first = d
+		}
+	}
+
+	deliveries, err := h.GetWebhookDeliveries(ctx, projectID, 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(deliveries) != WebhookDeliveriesLimit {
+		t.Fatalf("expected %d deliveries, got %d", WebhookDeliveriesLimit, len(deliveries))
+	}
+
+	deliveries, err = h.GetWebhookDeliveries(ctx, projectID, 10)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if len(deliveries) != 10 {
+		t.Fatalf("expected %d deliveries, got %d", 10, len(deliveries))
+	}
+
+	d, err := h.GetWebhookDelivery(ctx, projectID, deliveries[0].ID)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if string(d.Payload) != `{"ref":"refs/heads/master"}` {
+		t.Fatalf("unexpected payload %q", d.Payload)
+	}
+
+	// other projects deliveries aren't visible
+	if _, err := h.GetWebhookDelivery(ctx, uuid.NewV4().String(), deliveries[0].ID); !util.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got: %v", err)
+	}
+
+	if _, err := h.GetWebhookDelivery(ctx, projectID, "../"+first.ID); !util.IsBadRequest(err) {
+		t.Fatalf("expected bad request error, got: %v", err)
+	}
+}
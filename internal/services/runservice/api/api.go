@@ -21,6 +21,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"agola.io/agola/internal/datamanager"
 	"agola.io/agola/internal/db"
@@ -30,6 +31,7 @@ import (
 	"agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/readdb"
 	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/tracing"
 	"agola.io/agola/internal/util"
 	rsapitypes "agola.io/agola/services/runservice/api/types"
 	"agola.io/agola/services/runservice/types"
@@ -137,14 +139,18 @@ type LogsHandler struct {
 	e   *etcd.Store
 	ost *objectstorage.ObjStorage
 	dm  *datamanager.DataManager
+	// executorClient is the http client used to fetch the logs from the
+	// executors
+	executorClient *http.Client
 }
 
-func NewLogsHandler(logger *zap.Logger, e *etcd.Store, ost *objectstorage.ObjStorage, dm *datamanager.DataManager) *LogsHandler {
+func NewLogsHandler(logger *zap.Logger, e *etcd.Store, ost *objectstorage.ObjStorage, dm *datamanager.DataManager, executorClient *http.Client) *LogsHandler {
 	return &LogsHandler{
-		log: logger.Sugar(),
-		e:   e,
-		ost: ost,
-		dm:  dm,
+		log:            logger.Sugar(),
+		e:              e,
+		ost:            ost,
+		dm:             dm,
+		executorClient: executorClient,
 	}
 }
 
@@ -190,7 +196,17 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		follow = true
 	}
 
-	if err, sendError := h.readTaskLogs(ctx, runID, taskID, setup, step, w, follow); err != nil {
+	var offset int64
+	if offsetStr := q.Get("offset"); offsetStr != "" {
+		var err error
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err, sendError := h.readTaskLogs(ctx, runID, taskID, setup, step, r, w, follow, offset); err != nil {
 		h.log.Errorf("err: %+v", err)
 		if sendError {
 			switch {
@@ -203,7 +219,7 @@ func (h *LogsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, setup bool, step int, w http.ResponseWriter, follow bool) (error, bool) {
+func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, setup bool, step int, hr *http.Request, w http.ResponseWriter, follow bool, offset int64) (error, bool) {
 	r, err := store.GetRunEtcdOrOST(ctx, h.e, h.dm, runID)
 	if err != nil {
 		return err, true
@@ -220,14 +236,26 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 		return util.NewErrNotExist(errors.Errorf("no such step for task %s in run %s", taskID, runID)), true
 	}
 
+	logPhase := task.Steps[step].LogPhase
+	if setup {
+		logPhase = task.SetupStep.LogPhase
+	}
+
 	// if the log has been already fetched use it, otherwise fetch it from the executor
-	if task.Steps[step].LogPhase == types.RunTaskFetchPhaseFinished {
+	if logPhase == types.RunTaskFetchPhaseFinished {
 		var logPath string
 		if setup {
 			logPath = store.OSTRunTaskSetupLogPath(task.ID)
 		} else {
 			logPath = store.OSTRunTaskStepLogPath(task.ID, step)
 		}
+		oi, err := h.ost.Stat(logPath)
+		if err != nil {
+			if objectstorage.IsNotExist(err) {
+				return util.NewErrNotExist(err), true
+			}
+			return err, true
+		}
 		f, err := h.ost.ReadObject(logPath)
 		if err != nil {
 			if objectstorage.IsNotExist(err) {
@@ -236,7 +264,11 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 			return err, true
 		}
 		defer f.Close()
-		return sendLogs(w, f), false
+
+		// the stored log won't change, serve it handling the range requests
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeContent(w, hr, "", oi.LastModified, &offsetReadSeeker{rs: f, offset: offset})
+		return nil, false
 	}
 
 	et, err := store.GetExecutorTask(ctx, h.e, task.ID)
@@ -263,7 +295,10 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 	if follow {
 		url += "&follow"
 	}
-	req, err := http.Get(url)
+	if offset > 0 {
+		url += fmt.Sprintf("&offset=%d", offset)
+	}
+	req, err := h.executorClient.Get(url)
 	if err != nil {
 		return err, true
 	}
@@ -279,6 +314,9 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 	// header also if there're currently no lines to send
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
+	if !follow && req.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+	}
 	w.WriteHeader(http.StatusOK)
 	var flusher http.Flusher
 	if fl, ok := w.(http.Flusher); ok {
@@ -291,6 +329,37 @@ func (h *LogsHandler) readTaskLogs(ctx context.Context, runID, taskID string, se
 	return sendLogs(w, req.Body), false
 }
 
+// offsetReadSeeker exposes the part of rs starting at offset. An offset after
+// the end of rs is handled as an empty content.
+type offsetReadSeeker struct {
+	rs     io.ReadSeeker
+	offset int64
+}
+
+func (o *offsetReadSeeker) Read(p []byte) (int, error) {
+	return o.rs.Read(p)
+}
+
+func (o *offsetReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		offset += o.offset
+	case io.SeekEnd:
+		size, err := o.rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if size < o.offset {
+			o.offset = size
+		}
+	}
+	pos, err := o.rs.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	return pos - o.offset, nil
+}
+
 func sendLogs(w http.ResponseWriter, r io.Reader) error {
 	buf := make([]byte, 406)
 
@@ -468,14 +537,16 @@ type RunHandler struct {
 	e      *etcd.Store
 	dm     *datamanager.DataManager
 	readDB *readdb.ReadDB
+	ah     *action.ActionHandler
 }
 
-func NewRunHandler(logger *zap.Logger, e *etcd.Store, dm *datamanager.DataManager, readDB *readdb.ReadDB) *RunHandler {
+func NewRunHandler(logger *zap.Logger, e *etcd.Store, dm *datamanager.DataManager, readDB *readdb.ReadDB, ah *action.ActionHandler) *RunHandler {
 	return &RunHandler{
 		log:    logger.Sugar(),
 		e:      e,
 		dm:     dm,
 		readDB: readDB,
+		ah:     ah,
 	}
 }
 
@@ -528,6 +599,95 @@ func (h *RunHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ChangeGroupsUpdateToken: cgts,
 	}
 
+	// just log the error since the queue status is only informative
+	queueStatus, err := h.ah.GetRunQueueStatus(ctx, run)
+	if err != nil {
+		h.log.Errorf("failed to get run queue status: %+v", err)
+	}
+	if queueStatus != nil {
+		res.QueueStatus = &rsapitypes.RunQueueStatus{
+			Position:           queueStatus.Position,
+			RunningRuns:        queueStatus.RunningRuns,
+			EstimatedStartTime: queueStatus.EstimatedStartTime,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type RunByCounterHandler struct {
+	log    *zap.SugaredLogger
+	dm     *datamanager.DataManager
+	readDB *readdb.ReadDB
+}
+
+func NewRunByCounterHandler(logger *zap.Logger, dm *datamanager.DataManager, readDB *readdb.ReadDB) *RunByCounterHandler {
+	return &RunByCounterHandler{
+		log:    logger.Sugar(),
+		dm:     dm,
+		readDB: readDB,
+	}
+}
+
+func (h *RunByCounterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	group := query.Get("group")
+	if group == "" || !strings.HasPrefix(group, "/") {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("wrong group %q", group)))
+		return
+	}
+	counter, err := strconv.ParseUint(query.Get("counter"), 10, 64)
+	if err != nil {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse counter: %w", err)))
+		return
+	}
+	changeGroups := query["changegroup"]
+
+	var run *types.Run
+	var cgt *types.ChangeGroupsUpdateToken
+
+	err = h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		run, err = h.readDB.GetRunByCounter(tx, group, counter)
+		if err != nil {
+			h.log.Errorf("err: %+v", err)
+			return err
+		}
+
+		cgt, err = h.readDB.GetChangeGroupsUpdateTokens(tx, changeGroups)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if run == nil {
+		httpError(w, util.NewErrNotExist(errors.Errorf("run with counter %d in group %q doesn't exist", counter, group)))
+		return
+	}
+
+	cgts, err := types.MarshalChangeGroupsUpdateToken(cgt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res := &rsapitypes.RunResponse{
+		Run:                     run,
+		RunConfig:               rc,
+		ChangeGroupsUpdateToken: cgts,
+	}
+
 	if err := httpResponse(w, http.StatusOK, res); err != nil {
 		h.log.Errorf("err: %+v", err)
 	}
@@ -555,6 +715,7 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query()
 	phaseFilter := types.RunPhaseFromStringSlice(query["phase"])
 	resultFilter := types.RunResultFromStringSlice(query["result"])
+	tagFilter := query["tag"]
 
 	changeGroups := query["changegroup"]
 	groups := query["group"]
@@ -589,7 +750,7 @@ func (h *RunsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
 		var err error
-		runs, err = h.readDB.GetRuns(tx, groups, lastRun, phaseFilter, resultFilter, start, limit, sortOrder)
+		runs, err = h.readDB.GetRuns(tx, groups, lastRun, phaseFilter, resultFilter, tagFilter, start, limit, sortOrder)
 		if err != nil {
 			h.log.Errorf("err: %+v", err)
 			return err
@@ -631,7 +792,7 @@ func NewRunCreateHandler(logger *zap.Logger, ah *action.ActionHandler) *RunCreat
 }
 
 func (h *RunCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx := tracing.Extract(r.Context(), r.Header)
 
 	var req rsapitypes.RunCreateRequest
 	d := json.NewDecoder(r.Body)
@@ -641,19 +802,35 @@ func (h *RunCreateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	creq := &action.RunCreateRequest{
-		RunConfigTasks:    req.RunConfigTasks,
-		Name:              req.Name,
-		Group:             req.Group,
-		SetupErrors:       req.SetupErrors,
-		StaticEnvironment: req.StaticEnvironment,
-		CacheGroup:        req.CacheGroup,
+		RunConfigTasks:     req.RunConfigTasks,
+		Name:               req.Name,
+		Group:              req.Group,
+		SetupErrors:        req.SetupErrors,
+		NoRunsReason:       req.NoRunsReason,
+		StaticEnvironment:  req.StaticEnvironment,
+		CacheGroup:         req.CacheGroup,
+		CommitSHA:          req.CommitSHA,
+		CommitAuthorName:   req.CommitAuthorName,
+		CommitAuthorEmail:  req.CommitAuthorEmail,
+		CommitMessage:      req.CommitMessage,
+		Untrusted:          req.Untrusted,
+		WebhookDeliveryID:  req.WebhookDeliveryID,
+		Replayed:           req.Replayed,
+		DependsOn:          req.DependsOn,
+		Tags:               req.Tags,
+		PreviewEnvironment: req.PreviewEnvironment,
 
 		RunID:      req.RunID,
 		FromStart:  req.FromStart,
+		FromTask:   req.FromTask,
 		ResetTasks: req.ResetTasks,
 
 		Environment:             req.Environment,
 		Annotations:             req.Annotations,
+		TriggerType:             req.TriggerType,
+		TriggeredBy:             req.TriggeredBy,
+		ExecutorID:              req.ExecutorID,
+		DebugHold:               req.DebugHold,
 		ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
 	}
 	rb, err := h.ah.CreateRun(ctx, creq)
@@ -719,6 +896,17 @@ func (h *RunActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			httpError(w, err)
 			return
 		}
+	case rsapitypes.RunActionTypeSetTags:
+		creq := &action.RunSetTagsRequest{
+			RunID:                   runID,
+			Tags:                    req.Tags,
+			ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
+		}
+		if err := h.ah.SetRunTags(ctx, creq); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
 	default:
 		http.Error(w, "", http.StatusBadRequest)
 		return
@@ -768,6 +956,7 @@ func (h *RunTaskActionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		creq := &action.RunTaskApproveRequest{
 			RunID:                   runID,
 			TaskID:                  taskID,
+			Approvers:               req.Approvers,
 			ChangeGroupsUpdateToken: req.ChangeGroupsUpdateToken,
 		}
 		if err := h.ah.ApproveRunTask(ctx, creq); err != nil {
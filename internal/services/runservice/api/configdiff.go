@@ -0,0 +1,67 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type RunConfigDiffHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunConfigDiffHandler(logger *zap.Logger, ah *action.ActionHandler) *RunConfigDiffHandler {
+	return &RunConfigDiffHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *RunConfigDiffHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+	otherRunID := vars["otherrunid"]
+
+	diff, err := h.ah.GetRunConfigDiff(ctx, runID, otherRunID)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := &rsapitypes.RunConfigDiffResponse{
+		RunID:         diff.RunID,
+		RunGroup:      diff.RunGroup,
+		OtherRunID:    diff.OtherRunID,
+		OtherRunGroup: diff.OtherRunGroup,
+		ChangedFields: diff.ChangedFields,
+		AddedTasks:    diff.AddedTasks,
+		RemovedTasks:  diff.RemovedTasks,
+		ChangedTasks:  diff.ChangedTasks,
+		Diff:          diff.Diff,
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
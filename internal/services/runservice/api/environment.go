@@ -0,0 +1,70 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+type RunTaskEnvironmentHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunTaskEnvironmentHandler(logger *zap.Logger, ah *action.ActionHandler) *RunTaskEnvironmentHandler {
+	return &RunTaskEnvironmentHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *RunTaskEnvironmentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+	taskID := vars["taskid"]
+
+	env, err := h.ah.GetRunTaskEnvironment(ctx, runID, taskID)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := &rsapitypes.RunTaskEnvironmentResponse{
+		RunID:       env.RunID,
+		TaskID:      env.TaskID,
+		TaskName:    env.TaskName,
+		Environment: env.Environment,
+		Steps:       make([]*rsapitypes.RunTaskStepEnvironmentResponse, len(env.Steps)),
+	}
+	for i, s := range env.Steps {
+		res.Steps[i] = &rsapitypes.RunTaskStepEnvironmentResponse{
+			Step:        s.Step,
+			Name:        s.Name,
+			Environment: s.Environment,
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -62,17 +62,40 @@ func (h *ExecutorStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 	// set last status update time
 	executor.LastStatusUpdateTime = time.Now()
 
+	prevExecutor, err := store.GetExecutor(ctx, h.e, executor.ID)
+	if err != nil && err != etcd.ErrKeyNotFound {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
 	if _, err := store.PutExecutor(ctx, h.e, executor); err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
 
+	// the executor was restarted, handle the tasks of its previous session
+	// without waiting for the restarted executor to report them
+	if executorRestarted(prevExecutor, executor) {
+		h.log.Infof("executor %q restarted", executor.ID)
+		if err := h.ah.HandleExecutorRestart(ctx, executor.ID); err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	if err := h.deleteStaleExecutors(ctx, executor); err != nil {
 		http.Error(w, "", http.StatusInternalServerError)
 		return
 	}
 }
 
+// executorRestarted reports if the executor session changed since its previous
+// status update. Executors not reporting a session id (i.e. older executors)
+// are never considered restarted.
+func executorRestarted(prevExecutor, executor *types.Executor) bool {
+	return prevExecutor != nil && prevExecutor.SessionID != "" && prevExecutor.SessionID != executor.SessionID
+}
+
 func (h *ExecutorStatusHandler) deleteStaleExecutors(ctx context.Context, curExecutor *types.Executor) error {
 	executors, err := store.GetExecutors(ctx, h.e)
 	if err != nil {
@@ -168,6 +191,30 @@ func (h *ExecutorTaskHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+type ExecutorsHandler struct {
+	log *zap.SugaredLogger
+	e   *etcd.Store
+}
+
+func NewExecutorsHandler(logger *zap.Logger, e *etcd.Store) *ExecutorsHandler {
+	return &ExecutorsHandler{log: logger.Sugar(), e: e}
+}
+
+func (h *ExecutorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	executors, err := store.GetExecutors(ctx, h.e)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, executors); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
 type ExecutorTasksHandler struct {
 	log *zap.SugaredLogger
 	ah  *action.ActionHandler
@@ -449,8 +496,12 @@ func (h *ExecutorDeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if err := h.ah.DeleteExecutor(ctx, executorID); err != nil {
-		http.Error(w, "", http.StatusInternalServerError)
+	err := h.ah.DeleteExecutor(ctx, executorID)
+	if httpError(w, err) {
+		h.log.Errorf("err: %+v", err)
 		return
 	}
+	if err := httpResponse(w, http.StatusNoContent, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
 }
@@ -0,0 +1,59 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"testing"
+
+	"agola.io/agola/services/runservice/types"
+)
+
+func TestExecutorRestarted(t *testing.T) {
+	tests := []struct {
+		name         string
+		prevExecutor *types.Executor
+		executor     *types.Executor
+		restarted    bool
+	}{
+		{
+			name:     "test new executor",
+			executor: &types.Executor{ID: "executor01", SessionID: "session01"},
+		},
+		{
+			name:         "test same session",
+			prevExecutor: &types.Executor{ID: "executor01", SessionID: "session01"},
+			executor:     &types.Executor{ID: "executor01", SessionID: "session01"},
+		},
+		{
+			name:         "test changed session",
+			prevExecutor: &types.Executor{ID: "executor01", SessionID: "session01"},
+			executor:     &types.Executor{ID: "executor01", SessionID: "session02"},
+			restarted:    true,
+		},
+		{
+			name:         "test previous executor without session",
+			prevExecutor: &types.Executor{ID: "executor01"},
+			executor:     &types.Executor{ID: "executor01", SessionID: "session01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if restarted := executorRestarted(tt.prevExecutor, tt.executor); restarted != tt.restarted {
+				t.Fatalf("expected restarted %t, got %t", tt.restarted, restarted)
+			}
+		})
+	}
+}
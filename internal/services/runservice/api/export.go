@@ -0,0 +1,198 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/datamanager"
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/readdb"
+	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/util"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+	"agola.io/agola/services/runservice/types"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// runsExportPageSize is the number of runs fetched from the readdb in a
+	// single transaction while streaming the export
+	runsExportPageSize = 100
+)
+
+// RunsExportHandler streams the finished runs of a group as newline delimited
+// json records ordered by end time. Only the runs already archived in the
+// objectstorage are exported.
+type RunsExportHandler struct {
+	log    *zap.SugaredLogger
+	dm     *datamanager.DataManager
+	readDB *readdb.ReadDB
+}
+
+func NewRunsExportHandler(logger *zap.Logger, dm *datamanager.DataManager, readDB *readdb.ReadDB) *RunsExportHandler {
+	return &RunsExportHandler{
+		log:    logger.Sugar(),
+		dm:     dm,
+		readDB: readDB,
+	}
+}
+
+func (h *RunsExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	group := query.Get("group")
+	if group == "" {
+		group = "/"
+	}
+	if !strings.HasPrefix(group, "/") {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("wrong group %q", group)))
+		return
+	}
+
+	end := time.Now()
+	if endS := query.Get("end"); endS != "" {
+		var err error
+		end, err = time.Parse(time.RFC3339, endS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse end time: %w", err)))
+			return
+		}
+	}
+	var start time.Time
+	if startS := query.Get("start"); startS != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, startS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse start time: %w", err)))
+			return
+		}
+	}
+	if !start.Before(end) {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("start time must be before end time")))
+		return
+	}
+
+	var watermark *readdb.RunExportWatermark
+	if watermarkS := query.Get("watermark"); watermarkS != "" {
+		var err error
+		watermark, err = readdb.ParseRunExportWatermark(watermarkS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(err))
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	enc := json.NewEncoder(w)
+	for {
+		var runs []*types.Run
+		err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+			var err error
+			runs, err = h.readDB.GetRunsExportOST(tx, group, start, end, watermark, runsExportPageSize)
+			return err
+		})
+		if err == nil {
+			for _, run := range runs {
+				var record *rsapitypes.RunExportRecord
+				record, err = h.runExportRecord(run)
+				if err != nil {
+					break
+				}
+				if err = enc.Encode(record); err != nil {
+					break
+				}
+				watermark = &readdb.RunExportWatermark{EndTime: run.EndTime.Unix(), RunID: run.ID}
+			}
+		}
+		if err != nil {
+			h.log.Errorf("err: %+v", err)
+			// since we already answered with a 200 we cannot return another error code
+			// So abort the connection and the client will detect the missing ending chunk
+			// and consider this an error
+			//
+			// this is the way to force close a request without logging the panic
+			panic(http.ErrAbortHandler)
+		}
+		if len(runs) < runsExportPageSize {
+			return
+		}
+	}
+}
+
+func (h *RunsExportHandler) runExportRecord(run *types.Run) (*rsapitypes.RunExportRecord, error) {
+	rc, err := store.OSTGetRunConfig(h.dm, run.ID)
+	if err != nil {
+		return nil, errors.Errorf("failed to get run config %q: %w", run.ID, err)
+	}
+
+	record := &rsapitypes.RunExportRecord{
+		ID:          run.ID,
+		Name:        run.Name,
+		Group:       run.Group,
+		Counter:     run.Counter,
+		Result:      run.Result,
+		Annotations: run.Annotations,
+		EnqueueTime: run.EnqueueTime,
+		StartTime:   run.StartTime,
+		EndTime:     run.EndTime,
+		DurationMs:  durationMs(run.StartTime, run.EndTime),
+		Tasks:       []*rsapitypes.RunExportTask{},
+		Watermark:   (&readdb.RunExportWatermark{EndTime: run.EndTime.Unix(), RunID: run.ID}).String(),
+	}
+	if run.StartTime != nil {
+		record.QueueDurationMs = durationMs(run.EnqueueTime, run.StartTime)
+	}
+	if run.Trigger != nil {
+		record.TriggerType = run.Trigger.Type
+		record.TriggeredBy = run.Trigger.TriggeredBy
+		record.CommitSHA = run.Trigger.CommitSHA
+		record.Attempt = run.Trigger.Attempt
+	}
+
+	for _, rt := range run.Tasks {
+		task := &rsapitypes.RunExportTask{
+			ID:         rt.ID,
+			Status:     rt.Status,
+			StartTime:  rt.StartTime,
+			EndTime:    rt.EndTime,
+			DurationMs: durationMs(rt.StartTime, rt.EndTime),
+		}
+		if rct, ok := rc.Tasks[rt.ID]; ok {
+			task.Name = rct.Name
+		}
+		record.Tasks = append(record.Tasks, task)
+	}
+	sort.Slice(record.Tasks, func(i, j int) bool { return record.Tasks[i].Name < record.Tasks[j].Name })
+
+	return record, nil
+}
+
+// durationMs returns the duration in milliseconds between start and end or 0
+// if one of them is missing
+func durationMs(start, end *time.Time) int64 {
+	if start == nil || end == nil {
+		return 0
+	}
+	return int64(end.Sub(*start) / time.Millisecond)
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/readdb"
+	"agola.io/agola/internal/util"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+	"agola.io/agola/services/runservice/types"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type PreviewEnvironmentsHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewPreviewEnvironmentsHandler(logger *zap.Logger, readDB *readdb.ReadDB) *PreviewEnvironmentsHandler {
+	return &PreviewEnvironmentsHandler{
+		log:    logger.Sugar(),
+		readDB: readDB,
+	}
+}
+
+func (h *PreviewEnvironmentsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	group := query.Get("group")
+	if group == "" || !strings.HasPrefix(group, "/") {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("wrong group %q", group)))
+		return
+	}
+
+	var envs []*types.PreviewEnvironment
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		envs, err = h.readDB.GetPreviewEnvironmentsOST(tx, group)
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := &rsapitypes.GetPreviewEnvironmentsResponse{
+		PreviewEnvironments: envs,
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+)
+
+// RunProvenanceHandler returns the signed SLSA provenance of a run as a DSSE
+// envelope
+type RunProvenanceHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewRunProvenanceHandler(logger *zap.Logger, ah *action.ActionHandler) *RunProvenanceHandler {
+	return &RunProvenanceHandler{
+		log: logger.Sugar(),
+		ah:  ah,
+	}
+}
+
+func (h *RunProvenanceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	runID := vars["runid"]
+
+	provenance, err := h.ah.GetRunProvenance(ctx, runID)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := &rsapitypes.RunProvenanceResponse{
+		PayloadType: provenance.PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(provenance.Payload),
+		Signatures: []*rsapitypes.RunProvenanceSignature{
+			{
+				KeyID: provenance.KeyID,
+				Sig:   base64.StdEncoding.EncodeToString(provenance.Signature),
+			},
+		},
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
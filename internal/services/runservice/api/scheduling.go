@@ -0,0 +1,97 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"agola.io/agola/internal/services/runservice/action"
+	"agola.io/agola/internal/util"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+
+	"go.uber.org/zap"
+)
+
+type SchedulingStatusHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSchedulingStatusHandler(logger *zap.Logger, ah *action.ActionHandler) *SchedulingStatusHandler {
+	return &SchedulingStatusHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SchedulingStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	status, err := h.ah.GetSchedulingStatus(ctx)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := &rsapitypes.SchedulingStatusResponse{
+		Paused: status.Paused,
+		Pause:  status.Pause,
+	}
+	if status.Window != nil {
+		res.Window = status.Window.String()
+	}
+
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type SchedulingPauseHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewSchedulingPauseHandler(logger *zap.Logger, ah *action.ActionHandler) *SchedulingPauseHandler {
+	return &SchedulingPauseHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *SchedulingPauseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case "PUT":
+		var req rsapitypes.SchedulingPauseRequest
+		d := json.NewDecoder(r.Body)
+		if err := d.Decode(&req); err != nil {
+			httpError(w, util.NewErrBadRequest(err))
+			return
+		}
+
+		if _, err := h.ah.PauseScheduling(ctx, req.Reason); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+	case "DELETE":
+		if err := h.ah.ResumeScheduling(ctx); err != nil {
+			h.log.Errorf("err: %+v", err)
+			httpError(w, err)
+			return
+		}
+	}
+
+	if err := httpResponse(w, http.StatusOK, nil); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
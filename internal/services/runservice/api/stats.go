@@ -0,0 +1,108 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"agola.io/agola/internal/db"
+	"agola.io/agola/internal/services/runservice/readdb"
+	"agola.io/agola/internal/util"
+	rsapitypes "agola.io/agola/services/runservice/api/types"
+	"agola.io/agola/services/runservice/types"
+
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// DefaultRunStatsWindow is the run statistics time window when no start
+	// time is provided
+	DefaultRunStatsWindow = 30 * 24 * time.Hour
+)
+
+type RunStatsHandler struct {
+	log    *zap.SugaredLogger
+	readDB *readdb.ReadDB
+}
+
+func NewRunStatsHandler(logger *zap.Logger, readDB *readdb.ReadDB) *RunStatsHandler {
+	return &RunStatsHandler{
+		log:    logger.Sugar(),
+		readDB: readDB,
+	}
+}
+
+func (h *RunStatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	group := query.Get("group")
+	if group == "" || !strings.HasPrefix(group, "/") {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("wrong group %q", group)))
+		return
+	}
+
+	bucket := types.RunStatsBucket(query.Get("bucket"))
+	if !bucket.IsValid() {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("wrong bucket %q", bucket)))
+		return
+	}
+	_, bySubgroup := query["bysubgroup"]
+
+	end := time.Now()
+	if endS := query.Get("end"); endS != "" {
+		var err error
+		end, err = time.Parse(time.RFC3339, endS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse end time: %w", err)))
+			return
+		}
+	}
+	start := end.Add(-DefaultRunStatsWindow)
+	if startS := query.Get("start"); startS != "" {
+		var err error
+		start, err = time.Parse(time.RFC3339, startS)
+		if err != nil {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("cannot parse start time: %w", err)))
+			return
+		}
+	}
+	if !start.Before(end) {
+		httpError(w, util.NewErrBadRequest(errors.Errorf("start time must be before end time")))
+		return
+	}
+
+	var stats []*types.RunStats
+	err := h.readDB.Do(ctx, func(tx *db.Tx) error {
+		var err error
+		stats, err = h.readDB.GetRunStatsOST(tx, group, start, end, bucket, bySubgroup)
+		return err
+	})
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	res := &rsapitypes.GetRunStatsResponse{
+		Stats: stats,
+	}
+	if err := httpResponse(w, http.StatusOK, res); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
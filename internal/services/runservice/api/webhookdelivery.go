@@ -0,0 +1,106 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"agola.io/agola/internal/services/runservice/action"
+	"agola.io/agola/internal/util"
+	rstypes "agola.io/agola/services/runservice/types"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+type WebhookDeliveriesHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewWebhookDeliveriesHandler(logger *zap.Logger, ah *action.ActionHandler) *WebhookDeliveriesHandler {
+	return &WebhookDeliveriesHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *WebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectID := mux.Vars(r)["projectid"]
+
+	limit := 0
+	if limitS := r.URL.Query().Get("limit"); limitS != "" {
+		var err error
+		limit, err = strconv.Atoi(limitS)
+		if err != nil || limit < 0 {
+			httpError(w, util.NewErrBadRequest(errors.Errorf("invalid limit %q", limitS)))
+			return
+		}
+	}
+
+	deliveries, err := h.ah.GetWebhookDeliveries(ctx, projectID, limit)
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, deliveries); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
+
+type WebhookDeliveryHandler struct {
+	log *zap.SugaredLogger
+	ah  *action.ActionHandler
+}
+
+func NewWebhookDeliveryHandler(logger *zap.Logger, ah *action.ActionHandler) *WebhookDeliveryHandler {
+	return &WebhookDeliveryHandler{log: logger.Sugar(), ah: ah}
+}
+
+func (h *WebhookDeliveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectID := vars["projectid"]
+	deliveryID := vars["deliveryid"]
+
+	var delivery *rstypes.WebhookDelivery
+	var err error
+	switch r.Method {
+	case "GET":
+		delivery, err = h.ah.GetWebhookDelivery(ctx, projectID, deliveryID)
+	case "PUT":
+		var req *rstypes.WebhookDelivery
+		d := json.NewDecoder(r.Body)
+		if err := d.Decode(&req); err != nil {
+			httpError(w, util.NewErrBadRequest(err))
+			return
+		}
+		req.ProjectID = projectID
+		req.ID = deliveryID
+		delivery, err = h.ah.CreateWebhookDelivery(ctx, req)
+	}
+	if err != nil {
+		h.log.Errorf("err: %+v", err)
+		httpError(w, err)
+		return
+	}
+
+	if err := httpResponse(w, http.StatusOK, delivery); err != nil {
+		h.log.Errorf("err: %+v", err)
+	}
+}
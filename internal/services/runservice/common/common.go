@@ -15,11 +15,14 @@
 package common
 
 import (
+	"encoding/json"
 	"fmt"
 	"path"
 	"sort"
 
 	"agola.io/agola/internal/runconfig"
+	scommon "agola.io/agola/internal/services/common"
+	"agola.io/agola/internal/taskoutputs"
 	"agola.io/agola/internal/util"
 	"agola.io/agola/services/runservice/types"
 )
@@ -44,6 +47,8 @@ var (
 
 	EtcdPingKey = path.Join(EtcdSchedulerBaseDir, "ping")
 
+	EtcdSchedulingPauseKey = path.Join(EtcdSchedulerBaseDir, "schedulingpause")
+
 	EtcdLocksDir = path.Join(EtcdSchedulerBaseDir, "locks")
 
 	EtcdCompactChangeGroupsLockKey = path.Join(EtcdLocksDir, "compactchangegroups")
@@ -60,6 +65,9 @@ func EtcdTaskKey(taskID string) string     { return path.Join(EtcdTasksDir, task
 func EtcdTaskFetcherLockKey(taskID string) string {
 	return path.Join(EtcdLocksDir, "taskfetcher", taskID)
 }
+func EtcdRunGroupLockKey(group string) string {
+	return path.Join(EtcdLocksDir, "rungroups", util.EncodeSha256Hex(group))
+}
 
 const (
 	EtcdChangeGroupMinRevisionRange = 100
@@ -79,6 +87,8 @@ const (
 	DataTypeRun        DataType = "run"
 	DataTypeRunConfig  DataType = "runconfig"
 	DataTypeRunCounter DataType = "runcounter"
+
+	DataTypePreviewEnvironment DataType = "previewenvironment"
 )
 
 func OSTSubGroupsAndGroupTypes(group string) []string {
@@ -150,6 +160,55 @@ func mergeEnv(dest, src map[string]string) {
 	}
 }
 
+// expandEnvOutputs returns a copy of the environment with the tasks outputs
+// references replaced by their values
+func expandEnvOutputs(env map[string]string, outputs map[string]map[string]string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	newEnv := make(map[string]string, len(env))
+	for k, v := range env {
+		newEnv[k] = taskoutputs.Expand(v, outputs)
+	}
+	return newEnv
+}
+
+// expandStepsOutputs returns the steps with the tasks outputs references in
+// the run steps commands and environment replaced by their values. The run
+// steps are copied to not modify the run config steps.
+func expandStepsOutputs(steps types.Steps, outputs map[string]map[string]string) types.Steps {
+	newSteps := make(types.Steps, len(steps))
+	for i, step := range steps {
+		rs, ok := step.(*types.RunStep)
+		if !ok {
+			newSteps[i] = step
+			continue
+		}
+
+		nrs := *rs
+		nrs.Command = taskoutputs.Expand(rs.Command, outputs)
+		if rs.CommandArgs != nil {
+			nrs.CommandArgs = make([]string, len(rs.CommandArgs))
+			for j, arg := range rs.CommandArgs {
+				nrs.CommandArgs[j] = taskoutputs.Expand(arg, outputs)
+			}
+		}
+		nrs.Environment = expandEnvOutputs(rs.Environment, outputs)
+		newSteps[i] = &nrs
+	}
+	return newSteps
+}
+
+// runProjectID returns the id of the run project or an empty string when not a
+// project run
+func runProjectID(r *types.Run) string {
+	groupType, groupID, err := scommon.GroupTypeIDFromRunGroup(r.Group)
+	if err != nil || groupType != scommon.GroupTypeProject {
+		return ""
+	}
+	return groupID
+}
+
 func GenExecutorTaskSpecData(r *types.Run, rt *types.RunTask, rc *types.RunConfig) *types.ExecutorTaskSpecData {
 	rct := rc.Tasks[rt.ID]
 
@@ -161,6 +220,18 @@ func GenExecutorTaskSpecData(r *types.Run, rt *types.RunTask, rc *types.RunConfi
 	// run config Environment variables ovverride every other environment variable
 	mergeEnv(environment, rc.Environment)
 
+	rctAllParents := runconfig.GetAllParents(rc.Tasks, rct)
+
+	// resolve the references to the parent tasks outputs
+	outputs := map[string]map[string]string{}
+	for _, rctParent := range rctAllParents {
+		if prt, ok := r.Tasks[rctParent.ID]; ok {
+			outputs[rctParent.Name] = prt.Outputs
+		}
+	}
+	environment = expandEnvOutputs(environment, outputs)
+	steps := expandStepsOutputs(rct.Steps, outputs)
+
 	cachePrefix := OSTRootGroup(r.Group)
 	if rc.CacheGroup != "" {
 		cachePrefix = rc.CacheGroup
@@ -171,22 +242,34 @@ func GenExecutorTaskSpecData(r *types.Run, rt *types.RunTask, rc *types.RunConfi
 		// there's already an executorTask scheduled for that run task and we can get
 		// at most once task execution
 		TaskName:             rct.Name,
+		OS:                   rct.Runtime.OS,
 		Arch:                 rct.Runtime.Arch,
 		Containers:           rct.Runtime.Containers,
+		InitContainers:       rct.Runtime.InitContainers,
+		DockerDaemon:         rct.Runtime.Docker,
+		Limits:               rct.Runtime.Limits,
 		Environment:          environment,
 		WorkingDir:           rct.WorkingDir,
 		Shell:                rct.Shell,
 		User:                 rct.User,
-		Steps:                rct.Steps,
+		Steps:                steps,
 		CachePrefix:          cachePrefix,
+		ProjectID:            runProjectID(r),
+		Untrusted:            r.Trigger != nil && r.Trigger.Untrusted,
 		DockerRegistriesAuth: rct.DockerRegistriesAuth,
+		NetworkPolicy:        rct.NetworkPolicy,
+		SecurityProfile:      rct.SecurityProfile,
+		MaxStepLogSize:       rct.MaxStepLogSize,
+		Reports:              rct.Reports,
+		StopSignal:           rct.StopSignal,
+		StopGracePeriod:      rct.StopGracePeriod,
+		Files:                rct.Files,
 	}
 
 	// calculate workspace operations
 	// TODO(sgotti) right now we don't support duplicated files. So it's not currently possibile to overwrite a file in a upper layer.
 	// this simplifies the workspaces extractions since they could be extracted in any order. We make them ordered just for reproducibility
 	wsops := []types.WorkspaceOperation{}
-	rctAllParents := runconfig.GetAllParents(rc.Tasks, rct)
 
 	// sort parents by level and name just for reproducibility
 	sort.Sort(parentsByLevelName(rctAllParents))
@@ -212,8 +295,9 @@ func GenExecutorTask(r *types.Run, rt *types.RunTask, rc *types.RunConfig, execu
 		// at most once task execution
 		ID: rt.ID,
 		Spec: types.ExecutorTaskSpec{
-			ExecutorID: executor.ID,
-			RunID:      r.ID,
+			ExecutorID:  executor.ID,
+			RunID:       r.ID,
+			TraceParent: r.TraceParent,
 			// ExecutorTaskSpecData is not saved in etcd to avoid exceeding the max etcd value
 			// size but is generated everytime the executor task is sent to the executor
 		},
@@ -223,11 +307,70 @@ func GenExecutorTask(r *types.Run, rt *types.RunTask, rc *types.RunConfig, execu
 		},
 	}
 
+	if rct.Runtime.GPUs != nil {
+		et.Spec.GPUs = &types.GPUs{
+			Count: rct.Runtime.GPUs.Count,
+			Type:  rct.Runtime.GPUs.Type,
+		}
+	}
+
+	et.Spec.BatchID = TaskBatchID(r, rct)
+	et.Spec.DebugHold = rc.DebugHold
+
 	for i := range et.Status.Steps {
 		et.Status.Steps[i] = &types.ExecutorTaskStepStatus{
 			Phase: types.ExecutorTaskPhaseNotStarted,
 		}
+		if IsStepSkipped(rct.Steps[i]) {
+			et.Status.Steps[i].Phase = types.ExecutorTaskPhaseSkipped
+		}
 	}
 
 	return et
 }
+
+// TaskBatchID returns the batch id of a batch task. The batch tasks of the same
+// run requiring the same pod (same runtime, network policy and security
+// profile) have the same batch id. It's empty for not batch tasks.
+func TaskBatchID(r *types.Run, rct *types.RunConfigTask) string {
+	if !rct.Batch {
+		return ""
+	}
+
+	podSpec := struct {
+		Runtime         *types.Runtime
+		NetworkPolicy   string
+		SecurityProfile string
+	}{
+		Runtime:         rct.Runtime,
+		NetworkPolicy:   rct.NetworkPolicy,
+		SecurityProfile: rct.SecurityProfile,
+	}
+	podSpecj, err := json.Marshal(podSpec)
+	if err != nil {
+		// don't batch the task
+		return ""
+	}
+
+	return util.EncodeSha256Hex(r.ID + "-" + string(podSpecj))
+}
+
+// IsStepSkipped reports if the step won't be executed since its when
+// conditions don't match
+func IsStepSkipped(step interface{}) bool {
+	switch s := step.(type) {
+	case *types.RunStep:
+		return s.Skip
+	case *types.SaveToWorkspaceStep:
+		return s.Skip
+	case *types.RestoreWorkspaceStep:
+		return s.Skip
+	case *types.SaveCacheStep:
+		return s.Skip
+	case *types.RestoreCacheStep:
+		return s.Skip
+	case *types.WaitBackgroundStep:
+		return s.Skip
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var schedulerPassesCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "agola_runservice_scheduler_passes_total",
+		Help: "Total number of runs scheduling passes.",
+	},
+)
+
+// schedulerConflictsCounter counts the runs not scheduled since concurrently
+// updated (i.e. by another runservice instance)
+var schedulerConflictsCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "agola_runservice_scheduler_conflicts_total",
+		Help: "Total number of runs scheduling failed due to concurrent updates.",
+	},
+)
+
+var schedulerIntervalGauge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Name: "agola_runservice_scheduler_interval_seconds",
+		Help: "Current interval, without jitter, between two runs scheduling passes.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(schedulerPassesCounter)
+	prometheus.MustRegister(schedulerConflictsCounter)
+	prometheus.MustRegister(schedulerIntervalGauge)
+}
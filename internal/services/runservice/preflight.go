@@ -0,0 +1,184 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"path"
+	"regexp"
+	"time"
+
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+	ctypes "agola.io/agola/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	maxImageNameLength = 255
+)
+
+var (
+	// image reference grammar, see github.com/docker/distribution/reference
+	imageDomainComponent = `(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])`
+	imageDomain          = imageDomainComponent + `(?:\.` + imageDomainComponent + `)*(?::[0-9]+)?`
+	imageNameComponent   = `[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*`
+	imageName            = `(?:` + imageDomain + `/)?` + imageNameComponent + `(?:/` + imageNameComponent + `)*`
+	imageTag             = `[\w][\w.-]{0,127}`
+	imageDigest          = `[A-Za-z][A-Za-z0-9]*(?:[-_+.][A-Za-z][A-Za-z0-9]*)*:[0-9a-fA-F]{32,}`
+
+	imageReferenceRegexp = regexp.MustCompile(`^(` + imageName + `)(?::` + imageTag + `)?(?:@` + imageDigest + `)?$`)
+)
+
+// validImageReference reports if image is a syntactically valid image
+// reference
+func validImageReference(image string) bool {
+	m := imageReferenceRegexp.FindStringSubmatch(image)
+	if m == nil {
+		return false
+	}
+	return len(m[1]) <= maxImageNameLength
+}
+
+// preflightCheckTask validates the task runtime before scheduling it, to
+// detect the errors that would only be reported by the executor when
+// executing the task. Since the task will be executed by an executor with the
+// same os of the task runtime, the runtime is also checked against the
+// features supported by the os containers.
+func preflightCheckTask(rct *types.RunConfigTask) error {
+	errs := &util.Errors{}
+
+	r := rct.Runtime
+	if r == nil {
+		errs.Append(errors.Errorf("task runtime isn't defined"))
+		return errs
+	}
+	windows := ctypes.OSOrDefault(r.OS) == ctypes.OSWindows
+
+	if len(r.Containers) == 0 {
+		errs.Append(errors.Errorf("task runtime doesn't define any container"))
+	}
+
+	checkContainer := func(kind string, i int, c *types.Container) {
+		if c.Image == "" {
+			errs.Append(errors.Errorf("%s %d: image is empty", kind, i))
+		} else if !validImageReference(c.Image) {
+			errs.Append(errors.Errorf("%s %d: invalid image reference %q", kind, i, c.Image))
+		}
+		if c.ShmSize < 0 {
+			errs.Append(errors.Errorf("%s %d: negative shm size %d", kind, i, c.ShmSize))
+		}
+		if windows && c.ShmSize != 0 {
+			errs.Append(errors.Errorf("%s %d: shm size isn't supported with windows containers", kind, i))
+		}
+		if windows && c.Privileged {
+			errs.Append(errors.Errorf("%s %d: privileged containers aren't supported with windows containers", kind, i))
+		}
+
+		paths := map[string]struct{}{}
+		for _, vol := range c.Volumes {
+			if !path.IsAbs(vol.Path) {
+				errs.Append(errors.Errorf("%s %d: volume path %q must be absolute", kind, i, vol.Path))
+				continue
+			}
+			p := path.Clean(vol.Path)
+			if _, ok := paths[p]; ok {
+				errs.Append(errors.Errorf("%s %d: conflicting volumes with path %q", kind, i, p))
+			}
+			paths[p] = struct{}{}
+			if p == "/dev/shm" && c.ShmSize != 0 {
+				errs.Append(errors.Errorf("%s %d: volume %q conflicts with the container shm size", kind, i, p))
+			}
+			if vol.TmpFS == nil {
+				errs.Append(errors.Errorf("%s %d: volume %q doesn't define a volume type", kind, i, p))
+				continue
+			}
+			if vol.TmpFS.Size < 0 {
+				errs.Append(errors.Errorf("%s %d: volume %q has a negative tmpfs size %d", kind, i, p, vol.TmpFS.Size))
+			}
+			if windows {
+				errs.Append(errors.Errorf("%s %d: tmpfs volumes aren't supported with windows containers", kind, i))
+			}
+		}
+	}
+	for i, c := range r.Containers {
+		checkContainer("container", i, c)
+	}
+	for i, c := range r.InitContainers {
+		checkContainer("init container", i, c)
+	}
+
+	if r.Docker != nil {
+		if r.Docker.Image != "" && !validImageReference(r.Docker.Image) {
+			errs.Append(errors.Errorf("docker daemon: invalid image reference %q", r.Docker.Image))
+		}
+		if r.Docker.CPU < 0 {
+			errs.Append(errors.Errorf("docker daemon: negative cpu %v", r.Docker.CPU))
+		}
+		if r.Docker.Memory < 0 {
+			errs.Append(errors.Errorf("docker daemon: negative memory %d", r.Docker.Memory))
+		}
+	}
+	if r.GPUs != nil {
+		if r.GPUs.Count <= 0 {
+			errs.Append(errors.Errorf("gpus count must be greater than 0"))
+		}
+		if windows {
+			errs.Append(errors.Errorf("gpus aren't supported with windows containers"))
+		}
+	}
+	if r.Limits != nil {
+		if r.Limits.Pids < 0 {
+			errs.Append(errors.Errorf("negative pids limit %d", r.Limits.Pids))
+		}
+		for name, ulimit := range r.Limits.Ulimits {
+			if !ctypes.IsValidUlimit(name) {
+				errs.Append(errors.Errorf("unknown ulimit %q", name))
+				continue
+			}
+			if ulimit.Soft <= 0 || ulimit.Hard <= 0 {
+				errs.Append(errors.Errorf("ulimit %q values must be greater than 0", name))
+			} else if ulimit.Soft > ulimit.Hard {
+				errs.Append(errors.Errorf("ulimit %q soft value is greater than the hard value", name))
+			}
+		}
+	}
+
+	if errs.IsErr() {
+		return errs
+	}
+	return nil
+}
+
+// failRunTaskPreflight marks the run task, not yet submitted to an executor,
+// as failed since it didn't pass the preflight validation. Since the task
+// won't be executed there're no logs and archives to fetch.
+func failRunTaskPreflight(rt *types.RunTask, err error) {
+	now := util.TimeP(time.Now())
+
+	rt.Status = types.RunTaskStatusFailed
+	rt.FailError = "task preflight validation failed: " + err.Error()
+	rt.WaitingExecutorReason = ""
+	rt.StartTime = now
+	rt.EndTime = now
+
+	rt.SetupStep.LogPhase = types.RunTaskFetchPhaseFinished
+	for _, s := range rt.Steps {
+		s.LogPhase = types.RunTaskFetchPhaseFinished
+	}
+	for i := range rt.WorkspaceArchivesPhase {
+		rt.WorkspaceArchivesPhase[i] = types.RunTaskFetchPhaseFinished
+	}
+}
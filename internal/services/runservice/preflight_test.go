@@ -0,0 +1,218 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runservice
+
+import (
+	"testing"
+
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+	ctypes "agola.io/agola/services/types"
+
+	errors "golang.org/x/xerrors"
+)
+
+func TestValidImageReference(t *testing.T) {
+	tests := []struct {
+		image string
+		valid bool
+	}{
+		{image: "busybox", valid: true},
+		{image: "library/busybox:1.31", valid: true},
+		{image: "registry.example.com:5000/team/app:v1.0.0-rc1", valid: true},
+		{image: "alpine@sha256:ddba4d27a7ffc3f86dd6c2f92041af252a1f23a8e742c90e6e1297bfa1bc0c45", valid: true},
+		{image: "alpine:3.11@sha256:ddba4d27a7ffc3f86dd6c2f92041af252a1f23a8e742c90e6e1297bfa1bc0c45", valid: true},
+		{image: "Busybox"},
+		{image: "busybox:"},
+		{image: "busybox:-latest"},
+		{image: "busybox latest"},
+		{image: "alpine@sha256:abc"},
+		{image: "registry.example.com/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if valid := validImageReference(tt.image); valid != tt.valid {
+				t.Fatalf("expected valid %t, got %t", tt.valid, valid)
+			}
+		})
+	}
+}
+
+func TestPreflightCheckTask(t *testing.T) {
+	tests := []struct {
+		name    string
+		runtime *types.Runtime
+		err     error
+	}{
+		{
+			name: "test valid runtime",
+			runtime: &types.Runtime{
+				Containers: []*types.Container{
+					{
+						Image:   "golang:1.13",
+						ShmSize: 1024,
+						Volumes: []types.Volume{
+							{Path: "/mnt/tmpfs", TmpFS: &types.VolumeTmpFS{Size: 1024}},
+						},
+					},
+				},
+				Limits: &types.TaskLimits{
+					Pids:    100,
+					Ulimits: map[string]types.Ulimit{"nofile": {Soft: 1024, Hard: 2048}},
+				},
+			},
+		},
+		{
+			name: "test invalid image references",
+			runtime: &types.Runtime{
+				Containers: []*types.Container{
+					{Image: "Golang:1.13"},
+				},
+				InitContainers: []*types.Container{
+					{},
+				},
+				Docker: &types.DockerDaemon{Image: "docker:dind:latest"},
+			},
+			err: &util.Errors{
+				Errs: []error{
+					errors.Errorf(`container 0: invalid image reference "Golang:1.13"`),
+					errors.Errorf("init container 0: image is empty"),
+					errors.Errorf(`docker daemon: invalid image reference "docker:dind:latest"`),
+				},
+			},
+		},
+		{
+			name: "test conflicting mount paths",
+			runtime: &types.Runtime{
+				Containers: []*types.Container{
+					{
+						Image:   "golang:1.13",
+						ShmSize: 1024,
+						Volumes: []types.Volume{
+							{Path: "/mnt/tmpfs", TmpFS: &types.VolumeTmpFS{}},
+							{Path: "/mnt/tmpfs/", TmpFS: &types.VolumeTmpFS{}},
+							{Path: "/dev/shm", TmpFS: &types.VolumeTmpFS{}},
+							{Path: "relative", TmpFS: &types.VolumeTmpFS{}},
+						},
+					},
+				},
+			},
+			err: &util.Errors{
+				Errs: []error{
+					errors.Errorf(`container 0: conflicting volumes with path "/mnt/tmpfs"`),
+					errors.Errorf(`container 0: volume "/dev/shm" conflicts with the container shm size`),
+					errors.Errorf(`container 0: volume path "relative" must be absolute`),
+				},
+			},
+		},
+		{
+			name: "test negative resource values",
+			runtime: &types.Runtime{
+				Containers: []*types.Container{
+					{
+						Image:   "golang:1.13",
+						ShmSize: -1,
+						Volumes: []types.Volume{
+							{Path: "/mnt/tmpfs", TmpFS: &types.VolumeTmpFS{Size: -1}},
+						},
+					},
+				},
+				Docker: &types.DockerDaemon{CPU: -1, Memory: -1},
+				Limits: &types.TaskLimits{
+					Pids:    -1,
+					Ulimits: map[string]types.Ulimit{"nofile": {Soft: -1, Hard: 2048}},
+				},
+			},
+			err: &util.Errors{
+				Errs: []error{
+					errors.Errorf("container 0: negative shm size -1"),
+					errors.Errorf(`container 0: volume "/mnt/tmpfs" has a negative tmpfs size -1`),
+					errors.Errorf("docker daemon: negative cpu -1"),
+					errors.Errorf("docker daemon: negative memory -1"),
+					errors.Errorf("negative pids limit -1"),
+					errors.Errorf(`ulimit "nofile" values must be greater than 0`),
+				},
+			},
+		},
+		{
+			name: "test features not supported by windows containers",
+			runtime: &types.Runtime{
+				OS: ctypes.OSWindows,
+				Containers: []*types.Container{
+					{
+						Image:      "mcr.microsoft.com/windows/servercore:ltsc2019",
+						Privileged: true,
+						Volumes: []types.Volume{
+							{Path: "/mnt/tmpfs", TmpFS: &types.VolumeTmpFS{}},
+						},
+					},
+				},
+				GPUs: &types.GPUs{Count: 1},
+			},
+			err: &util.Errors{
+				Errs: []error{
+					errors.Errorf("container 0: privileged containers aren't supported with windows containers"),
+					errors.Errorf("container 0: tmpfs volumes aren't supported with windows containers"),
+					errors.Errorf("gpus aren't supported with windows containers"),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := preflightCheckTask(&types.RunConfigTask{Runtime: tt.runtime})
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error %v, got nil error", tt.err)
+			}
+			if errs, ok := tt.err.(*util.Errors); !ok || !errs.Equal(err) {
+				t.Fatalf("expected error %v, got error: %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestFailRunTaskPreflight(t *testing.T) {
+	rt := &types.RunTask{
+		ID:                     "task01",
+		Status:                 types.RunTaskStatusNotStarted,
+		WaitingExecutorReason:  "no executors available",
+		Steps:                  []*types.RunTaskStep{{}, {}},
+		WorkspaceArchives:      []int{1},
+		WorkspaceArchivesPhase: []types.RunTaskFetchPhase{types.RunTaskFetchPhaseNotStarted},
+	}
+
+	failRunTaskPreflight(rt, errors.Errorf("container 0: image is empty"))
+
+	if rt.Status != types.RunTaskStatusFailed {
+		t.Fatalf("expected status %q, got %q", types.RunTaskStatusFailed, rt.Status)
+	}
+	if rt.FailError != "task preflight validation failed: container 0: image is empty" {
+		t.Fatalf("unexpected fail error %q", rt.FailError)
+	}
+	if rt.WaitingExecutorReason != "" {
+		t.Fatalf("expected empty waiting executor reason, got %q", rt.WaitingExecutorReason)
+	}
+	if !rt.LogsFetchFinished() || !rt.ArchivesFetchFinished() {
+		t.Fatalf("expected logs and archives fetch phases finished")
+	}
+}
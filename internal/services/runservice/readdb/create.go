@@ -18,10 +18,13 @@ var Stmts = []string{
 	// last processed etcd event revision
 	"create table revision (revision bigint, PRIMARY KEY(revision))",
 
-	"create table run (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+	"create table run (id varchar, grouppath varchar, phase varchar, result varchar, counter bigint, PRIMARY KEY (id, grouppath, phase))",
 
 	"create table rundata (id varchar, data bytea, PRIMARY KEY (id))",
 
+	"create table runtag (id varchar, tag varchar, PRIMARY KEY (id, tag))",
+	"create index runtag_tag on runtag (tag)",
+
 	"create table runevent (sequence varchar, data bytea, PRIMARY KEY (sequence))",
 
 	// changegrouprevision stores the current revision of the changegroup for optimistic locking
@@ -35,9 +38,21 @@ var Stmts = []string{
 
 	"create table changegrouprevision_ost (id varchar, revision varchar, PRIMARY KEY (id, revision))",
 
-	"create table run_ost (id varchar, grouppath varchar, phase varchar, result varchar, PRIMARY KEY (id, grouppath, phase))",
+	"create table run_ost (id varchar, grouppath varchar, phase varchar, result varchar, counter bigint, PRIMARY KEY (id, grouppath, phase))",
 
 	"create table rundata_ost (id varchar, data bytea, PRIMARY KEY (id))",
 
+	"create table runtag_ost (id varchar, tag varchar, PRIMARY KEY (id, tag))",
+	"create index runtag_ost_tag on runtag_ost (tag)",
+
 	"create table runcounter_ost (groupid varchar, counter bigint, PRIMARY KEY (groupid))",
+
+	// runstat_ost is a narrow index of the finished runs used to compute the
+	// run statistics without decoding the runs data. endtime is in unix
+	// seconds, duration in milliseconds. The cache columns are the sums of the
+	// run tasks cache usage.
+	"create table runstat_ost (id varchar, grouppath varchar, result varchar, endtime bigint, duration bigint, cacherestorehits bigint, cacherestoremisses bigint, cacherestoredbytes bigint, cachesavedbytes bigint, PRIMARY KEY (id))",
+	"create index runstat_ost_endtime on runstat_ost (endtime)",
+
+	"create table previewenvironment_ost (id varchar, grouppath varchar, data bytea, PRIMARY KEY (id))",
 }
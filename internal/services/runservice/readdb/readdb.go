@@ -24,6 +24,7 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -59,10 +60,12 @@ var (
 	revisionInsert = sb.Insert("revision").Columns("revision")
 
 	//runSelect = sb.Select("id", "grouppath", "phase", "result").From("run")
-	runInsert = sb.Insert("run").Columns("id", "grouppath", "phase", "result")
+	runInsert = sb.Insert("run").Columns("id", "grouppath", "phase", "result", "counter")
 
 	rundataInsert = sb.Insert("rundata").Columns("id", "data")
 
+	runtagInsert = sb.Insert("runtag").Columns("id", "tag")
+
 	//runeventSelect = sb.Select("data").From("runevent")
 	runeventInsert = sb.Insert("runevent").Columns("sequence", "data")
 
@@ -74,10 +77,12 @@ var (
 	revisionOSTInsert = sb.Insert("revision_ost").Columns("revision")
 
 	//runOSTSelect = sb.Select("id", "grouppath", "phase", "result").From("run_ost")
-	runOSTInsert = sb.Insert("run_ost").Columns("id", "grouppath", "phase", "result")
+	runOSTInsert = sb.Insert("run_ost").Columns("id", "grouppath", "phase", "result", "counter")
 
 	rundataOSTInsert = sb.Insert("rundata_ost").Columns("id", "data")
 
+	runtagOSTInsert = sb.Insert("runtag_ost").Columns("id", "tag")
+
 	committedwalsequenceOSTSelect = sb.Select("seq").From("committedwalsequence_ost")
 	committedwalsequenceOSTInsert = sb.Insert("committedwalsequence_ost").Columns("seq")
 
@@ -86,6 +91,12 @@ var (
 
 	runcounterOSTSelect = sb.Select("groupid", "counter").From("runcounter_ost")
 	runcounterOSTInsert = sb.Insert("runcounter_ost").Columns("groupid", "counter")
+
+	runstatOSTSelect = sb.Select("grouppath", "result", "endtime", "duration", "cacherestorehits", "cacherestoremisses", "cacherestoredbytes", "cachesavedbytes").From("runstat_ost")
+	runstatOSTInsert = sb.Insert("runstat_ost").Columns("id", "grouppath", "result", "endtime", "duration", "cacherestorehits", "cacherestoremisses", "cacherestoredbytes", "cachesavedbytes")
+
+	previewenvironmentOSTSelect = sb.Select("data").From("previewenvironment_ost")
+	previewenvironmentOSTInsert = sb.Insert("previewenvironment_ost").Columns("id", "grouppath", "data")
 )
 
 type ReadDB struct {
@@ -359,7 +370,7 @@ func (r *ReadDB) handleEvents(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		lastRuns, err = r.GetActiveRuns(tx, nil, true, nil, nil, "", 1, types.SortOrderDesc)
+		lastRuns, err = r.GetActiveRuns(tx, nil, true, nil, nil, nil, "", 1, types.SortOrderDesc)
 		return err
 	})
 	if err != nil {
@@ -465,6 +476,9 @@ func (r *ReadDB) handleRunEvent(tx *db.Tx, ev *etcdclientv3.Event, wresp *etcdcl
 		if _, err := tx.Exec("delete from run where id = $1", runID); err != nil {
 			return errors.Errorf("failed to delete run: %w", err)
 		}
+		if _, err := tx.Exec("delete from runtag where id = $1", runID); err != nil {
+			return errors.Errorf("failed to delete run tags: %w", err)
+		}
 
 		// Run has been deleted from etcd, this means that it was stored in the objectstorage
 		// TODO(sgotti) this is here just to avoid a window where the run is not in
@@ -914,12 +928,24 @@ func (r *ReadDB) applyAction(tx *db.Tx, action *datamanager.Action) error {
 			if err := r.insertRunCounterOST(tx, action.ID, runCounter); err != nil {
 				return err
 			}
+		case string(common.DataTypePreviewEnvironment):
+			var env *types.PreviewEnvironment
+			if err := json.Unmarshal(action.Data, &env); err != nil {
+				return err
+			}
+			if err := r.insertPreviewEnvironmentOST(tx, env, action.Data); err != nil {
+				return err
+			}
 		}
 
 	case datamanager.ActionTypeDelete:
 		switch action.DataType {
 		case string(common.DataTypeRun):
 		case string(common.DataTypeRunCounter):
+		case string(common.DataTypePreviewEnvironment):
+			if _, err := tx.Exec("delete from previewenvironment_ost where id = $1", action.ID); err != nil {
+				return errors.Errorf("failed to delete preview environment: %w", err)
+			}
 		}
 	}
 
@@ -1011,7 +1037,7 @@ func insertRun(tx *db.Tx, run *types.Run, data []byte) error {
 	if _, err := tx.Exec("delete from run where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete run: %w", err)
 	}
-	q, args, err := runInsert.Values(run.ID, groupPath, run.Phase, run.Result).ToSql()
+	q, args, err := runInsert.Values(run.ID, groupPath, run.Phase, run.Result, run.Counter).ToSql()
 	if err != nil {
 		return errors.Errorf("failed to build query: %w", err)
 	}
@@ -1031,6 +1057,24 @@ func insertRun(tx *db.Tx, run *types.Run, data []byte) error {
 		return err
 	}
 
+	return insertRunTags(tx, "runtag", runtagInsert, run)
+}
+
+// insertRunTags replaces the run tags in the provided tags table
+func insertRunTags(tx *db.Tx, table string, insert sq.InsertBuilder, run *types.Run) error {
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec(fmt.Sprintf("delete from %s where id = $1", table), run.ID); err != nil {
+		return errors.Errorf("failed to delete run tags: %w", err)
+	}
+	for _, tag := range run.Tags {
+		q, args, err := insert.Values(run.ID, tag).ToSql()
+		if err != nil {
+			return errors.Errorf("failed to build query: %w", err)
+		}
+		if _, err = tx.Exec(q, args...); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -1045,7 +1089,7 @@ func (r *ReadDB) insertRunOST(tx *db.Tx, run *types.Run, data []byte) error {
 	if _, err := tx.Exec("delete from run_ost where id = $1", run.ID); err != nil {
 		return errors.Errorf("failed to delete run objectstorage: %w", err)
 	}
-	q, args, err := runOSTInsert.Values(run.ID, groupPath, run.Phase, run.Result).ToSql()
+	q, args, err := runOSTInsert.Values(run.ID, groupPath, run.Phase, run.Result, run.Counter).ToSql()
 	if err != nil {
 		return errors.Errorf("failed to build query: %w", err)
 	}
@@ -1065,6 +1109,43 @@ func (r *ReadDB) insertRunOST(tx *db.Tx, run *types.Run, data []byte) error {
 		return err
 	}
 
+	if err := insertRunTags(tx, "runtag_ost", runtagOSTInsert, run); err != nil {
+		return err
+	}
+
+	return r.insertRunStatOST(tx, run, groupPath)
+}
+
+// insertRunStatOST updates the run statistics index. Only finished runs are
+// indexed.
+func (r *ReadDB) insertRunStatOST(tx *db.Tx, run *types.Run, groupPath string) error {
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from runstat_ost where id = $1", run.ID); err != nil {
+		return errors.Errorf("failed to delete run stat: %w", err)
+	}
+	if run.Phase != types.RunPhaseFinished || run.EndTime == nil {
+		return nil
+	}
+
+	var duration time.Duration
+	if run.StartTime != nil {
+		duration = run.EndTime.Sub(*run.StartTime)
+	}
+	var cache types.TaskCacheUsage
+	for _, rt := range run.Tasks {
+		u := rt.CacheUsage()
+		cache.RestoreHits += u.RestoreHits
+		cache.RestoreMisses += u.RestoreMisses
+		cache.RestoredBytes += u.RestoredBytes
+		cache.SavedBytes += u.SavedBytes
+	}
+	q, args, err := runstatOSTInsert.Values(run.ID, groupPath, run.Result, run.EndTime.Unix(), int64(duration/time.Millisecond), cache.RestoreHits, cache.RestoreMisses, cache.RestoredBytes, cache.SavedBytes).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1137,11 +1218,11 @@ func (r *ReadDB) GetChangeGroupsUpdateTokens(tx *db.Tx, groups []string) (*types
 	return &types.ChangeGroupsUpdateToken{CurRevision: revision, ChangeGroupsRevisions: changeGroupsRevisions}, nil
 }
 
-func (r *ReadDB) GetActiveRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	return r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+func (r *ReadDB) GetActiveRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, tagFilter []string, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
+	return r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, tagFilter, startRunID, limit, sortOrder)
 }
 
-func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*types.Run, error) {
+func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, tagFilter []string, startRunID string, limit int, sortOrder types.SortOrder) ([]*types.Run, error) {
 	useObjectStorage := false
 	for _, phase := range phaseFilter {
 		if phase == types.RunPhaseFinished || phase == types.RunPhaseCancelled {
@@ -1152,7 +1233,7 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 		useObjectStorage = true
 	}
 
-	runDataRDB, err := r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+	runDataRDB, err := r.getRunsFilteredActive(tx, groups, lastRun, phaseFilter, resultFilter, tagFilter, startRunID, limit, sortOrder)
 	if err != nil {
 		return nil, err
 	}
@@ -1165,7 +1246,7 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 
 	if useObjectStorage {
 		// skip if the phase requested is not finished
-		runDataOST, err := r.GetRunsFilteredOST(tx, groups, lastRun, phaseFilter, resultFilter, startRunID, limit, sortOrder)
+		runDataOST, err := r.GetRunsFilteredOST(tx, groups, lastRun, phaseFilter, resultFilter, tagFilter, startRunID, limit, sortOrder)
 		if err != nil {
 			return nil, err
 		}
@@ -1231,9 +1312,10 @@ func (r *ReadDB) GetRuns(tx *db.Tx, groups []string, lastRun bool, phaseFilter [
 	return aruns, nil
 }
 
-func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter []types.RunResult, groups []string, lastRun bool, startRunID string, limit int, sortOrder types.SortOrder, objectstorage bool) sq.SelectBuilder {
+func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter []types.RunResult, tagFilter []string, groups []string, lastRun bool, startRunID string, limit int, sortOrder types.SortOrder, objectstorage bool) sq.SelectBuilder {
 	runt := "run"
 	rundatat := "rundata"
+	runtagt := "runtag"
 	fields := []string{"run.id", "run.grouppath", "run.phase", "rundata.data"}
 	if len(groups) > 0 && lastRun {
 		fields = []string{"max(run.id)", "run.grouppath", "run.phase", "rundata.data"}
@@ -1241,6 +1323,7 @@ func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter
 	if objectstorage {
 		runt = "run_ost"
 		rundatat = "rundata_ost"
+		runtagt = "runtag_ost"
 	}
 
 	r.log.Debugf("runt: %s", runt)
@@ -1257,6 +1340,10 @@ func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter
 	if len(resultFilter) > 0 {
 		s = s.Where(sq.Eq{"result": resultFilter})
 	}
+	// the runs must have all the provided tags
+	for _, tag := range tagFilter {
+		s = s.Where(sq.Expr(fmt.Sprintf("run.id in (select id from %s where tag = ?)", runtagt), tag))
+	}
 	if startRunID != "" {
 		if lastRun {
 			switch sortOrder {
@@ -1298,8 +1385,8 @@ func (r *ReadDB) getRunsFilteredQuery(phaseFilter []types.RunPhase, resultFilter
 	return s
 }
 
-func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, groups, lastRun, startRunID, limit, sortOrder, false)
+func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, tagFilter []string, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
+	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, tagFilter, groups, lastRun, startRunID, limit, sortOrder, false)
 
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
@@ -1310,8 +1397,8 @@ func (r *ReadDB) getRunsFilteredActive(tx *db.Tx, groups []string, lastRun bool,
 	return fetchRuns(tx, q, args...)
 }
 
-func (r *ReadDB) GetRunsFilteredOST(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
-	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, groups, lastRun, startRunID, limit, sortOrder, true)
+func (r *ReadDB) GetRunsFilteredOST(tx *db.Tx, groups []string, lastRun bool, phaseFilter []types.RunPhase, resultFilter []types.RunResult, tagFilter []string, startRunID string, limit int, sortOrder types.SortOrder) ([]*RunData, error) {
+	s := r.getRunsFilteredQuery(phaseFilter, resultFilter, tagFilter, groups, lastRun, startRunID, limit, sortOrder, true)
 
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
@@ -1335,9 +1422,49 @@ func (r *ReadDB) GetRun(tx *db.Tx, runID string) (*types.Run, error) {
 	return r.getRun(tx, runID, true)
 }
 
+// GetRunByCounter returns the run of the provided base group (i.e.
+// /project/projectid) with the provided counter.
+func (r *ReadDB) GetRunByCounter(tx *db.Tx, group string, counter uint64) (*types.Run, error) {
+	run, err := r.getRunByCounter(tx, group, counter, false)
+	if err != nil {
+		return nil, err
+	}
+	if run != nil {
+		return run, nil
+	}
+
+	// try to fetch from ost
+	return r.getRunByCounter(tx, group, counter, true)
+}
+
+func (r *ReadDB) getRunByCounter(tx *db.Tx, group string, counter uint64, ost bool) (*types.Run, error) {
+	runt := "run"
+	rundatat := "rundata"
+	if ost {
+		runt = "run_ost"
+		rundatat = "rundata_ost"
+	}
+
+	// add ending slash to distinguish between final group (i.e project/projectid/branch/feature and project/projectid/branch/feature02)
+	if !strings.HasSuffix(group, "/") {
+		group += "/"
+	}
+
+	s := sb.Select("run.id", "run.grouppath", "run.phase", "rundata.data").From(runt + " as run")
+	s = s.Where(sq.Like{"run.grouppath": group + "%"}).Where(sq.Eq{"run.counter": counter})
+	s = s.Join(fmt.Sprintf("%s as rundata on rundata.id = run.id", rundatat))
+
+	return r.fetchRun(tx, s, ost)
+}
+
 func (r *ReadDB) getRun(tx *db.Tx, runID string, ost bool) (*types.Run, error) {
 	s := r.getRunQuery(runID, ost)
 
+	return r.fetchRun(tx, s, ost)
+}
+
+func (r *ReadDB) fetchRun(tx *db.Tx, s sq.SelectBuilder, ost bool) (*types.Run, error) {
+
 	q, args, err := s.ToSql()
 	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
 	if err != nil {
@@ -1362,7 +1489,7 @@ func (r *ReadDB) getRun(tx *db.Tx, runID string, ost bool) (*types.Run, error) {
 			return nil, errors.Errorf("nil active run data. This should never happen")
 		}
 		// get run from objectstorage
-		run, err = store.OSTGetRun(r.dm, runID)
+		run, err = store.OSTGetRun(r.dm, runsData[0].ID)
 		if err != nil {
 			return nil, err
 		}
@@ -1647,3 +1774,304 @@ func scanRunCounters(rows *sql.Rows) ([]*types.RunCounter, error) {
 	}
 	return runCounters, nil
 }
+
+func (r *ReadDB) insertPreviewEnvironmentOST(tx *db.Tx, env *types.PreviewEnvironment, data []byte) error {
+	// add ending slash to distinguish between final group (i.e project/projectid/pr/1 and project/projectid/pr/10)
+	groupPath := env.Group
+	if !strings.HasSuffix(groupPath, "/") {
+		groupPath += "/"
+	}
+
+	// poor man insert or update that works because transaction isolation level is serializable
+	if _, err := tx.Exec("delete from previewenvironment_ost where id = $1", env.ID); err != nil {
+		return errors.Errorf("failed to delete preview environment: %w", err)
+	}
+	q, args, err := previewenvironmentOSTInsert.Values(env.ID, groupPath, data).ToSql()
+	if err != nil {
+		return errors.Errorf("failed to build query: %w", err)
+	}
+	if _, err = tx.Exec(q, args...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *ReadDB) GetPreviewEnvironmentOST(tx *db.Tx, id string) (*types.PreviewEnvironment, error) {
+	q, args, err := previewenvironmentOSTSelect.Where(sq.Eq{"id": id}).ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	envs, err := fetchPreviewEnvironments(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(envs) == 0 {
+		return nil, nil
+	}
+	return envs[0], nil
+}
+
+// GetPreviewEnvironmentsOST returns the active preview environments of the
+// run groups inside the provided group
+func (r *ReadDB) GetPreviewEnvironmentsOST(tx *db.Tx, group string) ([]*types.PreviewEnvironment, error) {
+	// add ending slash to distinguish between final group (i.e project/projectid/pr/1 and project/projectid/pr/10)
+	groupPath := group
+	if !strings.HasSuffix(groupPath, "/") {
+		groupPath += "/"
+	}
+
+	s := previewenvironmentOSTSelect.Where(sq.Like{"grouppath": groupPath + "%"}).OrderBy("grouppath asc", "id asc")
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	return fetchPreviewEnvironments(tx, q, args...)
+}
+
+func fetchPreviewEnvironments(tx *db.Tx, q string, args ...interface{}) ([]*types.PreviewEnvironment, error) {
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	envs := []*types.PreviewEnvironment{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+		var env *types.PreviewEnvironment
+		if err := json.Unmarshal(data, &env); err != nil {
+			return nil, errors.Errorf("failed to unmarshal preview environment: %w", err)
+		}
+		envs = append(envs, env)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return envs, nil
+}
+
+type runStat struct {
+	group    string
+	result   types.RunResult
+	endTime  time.Time
+	duration time.Duration
+	cache    types.TaskCacheUsage
+}
+
+// GetRunStatsOST returns the statistics of the finished runs of the provided
+// group ended in the [start, end) time window, aggregated by time bucket. When
+// bySubgroup is true the statistics are also aggregated by the run groups
+// inside the provided group (i.e. by branch).
+func (r *ReadDB) GetRunStatsOST(tx *db.Tx, group string, start, end time.Time, bucket types.RunStatsBucket, bySubgroup bool) ([]*types.RunStats, error) {
+	// add ending slash to distinguish between final group (i.e project/projectid/branch/feature and project/projectid/branch/feature02)
+	groupPath := group
+	if !strings.HasSuffix(groupPath, "/") {
+		groupPath += "/"
+	}
+
+	s := runstatOSTSelect.Where(sq.Like{"grouppath": groupPath + "%"})
+	s = s.Where(sq.GtOrEq{"endtime": start.Unix()})
+	s = s.Where(sq.Lt{"endtime": end.Unix()})
+
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := tx.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runStats := []*runStat{}
+	for rows.Next() {
+		var rs runStat
+		var endTime, duration int64
+		if err := rows.Scan(&rs.group, &rs.result, &endTime, &duration, &rs.cache.RestoreHits, &rs.cache.RestoreMisses, &rs.cache.RestoredBytes, &rs.cache.SavedBytes); err != nil {
+			return nil, errors.Errorf("failed to scan rows: %w", err)
+		}
+		rs.group = strings.TrimSuffix(rs.group, "/")
+		rs.endTime = time.Unix(endTime, 0).UTC()
+		rs.duration = time.Duration(duration) * time.Millisecond
+		if !bySubgroup {
+			rs.group = group
+		}
+		runStats = append(runStats, &rs)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return aggregateRunStats(runStats, bucket), nil
+}
+
+// runStatsBucketStart returns the start time of the bucket containing t
+func runStatsBucketStart(t time.Time, bucket types.RunStatsBucket) time.Time {
+	switch bucket {
+	case types.RunStatsBucketHour:
+		return t.Truncate(time.Hour)
+	case types.RunStatsBucketDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case types.RunStatsBucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		// go weekdays start on sunday
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return time.Time{}
+}
+
+// aggregateRunStats aggregates the runs statistics by group and time bucket.
+// The returned statistics are ordered by group and bucket start time.
+func aggregateRunStats(runStats []*runStat, bucket types.RunStatsBucket) []*types.RunStats {
+	type statsKey struct {
+		group       string
+		bucketStart time.Time
+	}
+
+	stats := map[statsKey]*types.RunStats{}
+	durations := map[statsKey][]time.Duration{}
+	for _, rs := range runStats {
+		// the runs only reporting that no run was created aren't real runs
+		if rs.result == types.RunResultSkipped {
+			continue
+		}
+		key := statsKey{group: rs.group, bucketStart: runStatsBucketStart(rs.endTime, bucket)}
+		s, ok := stats[key]
+		if !ok {
+			s = &types.RunStats{Group: rs.group}
+			if bucket != types.RunStatsBucketNone {
+				s.BucketStart = util.TimeP(key.bucketStart)
+			}
+			stats[key] = s
+		}
+
+		s.RunCount++
+		switch rs.result {
+		case types.RunResultSuccess:
+			s.SuccessCount++
+		case types.RunResultFailed:
+			s.FailedCount++
+		case types.RunResultStopped:
+			s.StoppedCount++
+		}
+		durations[key] = append(durations[key], rs.duration)
+
+		s.CacheRestoreHits += uint64(rs.cache.RestoreHits)
+		s.CacheRestoreMisses += uint64(rs.cache.RestoreMisses)
+		s.CacheRestoredBytes += rs.cache.RestoredBytes
+		s.CacheSavedBytes += rs.cache.SavedBytes
+	}
+
+	keys := make([]statsKey, 0, len(stats))
+	for key, s := range stats {
+		d := durations[key]
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		if len(d)%2 == 1 {
+			s.MedianDuration = d[len(d)/2]
+		} else {
+			s.MedianDuration = (d[len(d)/2-1] + d[len(d)/2]) / 2
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].bucketStart.Before(keys[j].bucketStart)
+	})
+
+	res := make([]*types.RunStats, len(keys))
+	for i, key := range keys {
+		res[i] = stats[key]
+	}
+	return res
+}
+
+// RunExportWatermark is the position of the last exported run. Runs are
+// exported ordered by end time and id so the next export restarts from the run
+// following the watermark.
+type RunExportWatermark struct {
+	// EndTime is the unix end time of the run
+	EndTime int64
+	RunID   string
+}
+
+func (w *RunExportWatermark) String() string {
+	return fmt.Sprintf("%d:%s", w.EndTime, w.RunID)
+}
+
+// ParseRunExportWatermark parses a watermark in the "endtime:runid" format
+func ParseRunExportWatermark(s string) (*RunExportWatermark, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, errors.Errorf("wrong watermark %q", s)
+	}
+	endTime, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("wrong watermark %q: %w", s, err)
+	}
+	return &RunExportWatermark{EndTime: endTime, RunID: parts[1]}, nil
+}
+
+// GetRunsExportOST returns at most limit finished runs of the provided group
+// ended in the [start, end) time window and following the provided watermark,
+// ordered by end time and id.
+func (r *ReadDB) GetRunsExportOST(tx *db.Tx, group string, start, end time.Time, watermark *RunExportWatermark, limit int) ([]*types.Run, error) {
+	// add ending slash to distinguish between final group (i.e project/projectid/branch/feature and project/projectid/branch/feature02)
+	groupPath := group
+	if !strings.HasSuffix(groupPath, "/") {
+		groupPath += "/"
+	}
+
+	s := sb.Select("run.id", "run.grouppath", "run.phase", "rundata.data").From("runstat_ost as runstat")
+	s = s.Join("run_ost as run on run.id = runstat.id")
+	s = s.Join("rundata_ost as rundata on rundata.id = runstat.id")
+	s = s.Where(sq.Like{"runstat.grouppath": groupPath + "%"})
+	s = s.Where(sq.GtOrEq{"runstat.endtime": start.Unix()})
+	s = s.Where(sq.Lt{"runstat.endtime": end.Unix()})
+	if watermark != nil {
+		s = s.Where(sq.Or{
+			sq.Gt{"runstat.endtime": watermark.EndTime},
+			sq.And{sq.Eq{"runstat.endtime": watermark.EndTime}, sq.Gt{"runstat.id": watermark.RunID}},
+		})
+	}
+	s = s.OrderBy("runstat.endtime asc", "runstat.id asc")
+	if limit > 0 {
+		s = s.Limit(uint64(limit))
+	}
+
+	q, args, err := s.ToSql()
+	r.log.Debugf("q: %s, args: %s", q, util.Dump(args))
+	if err != nil {
+		return nil, errors.Errorf("failed to build query: %w", err)
+	}
+
+	runsData, err := fetchRuns(tx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]*types.Run, len(runsData))
+	for i, rd := range runsData {
+		run := rd.Run
+		if run == nil {
+			// get run from objectstorage
+			run, err = store.OSTGetRun(r.dm, rd.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		runs[i] = run
+	}
+
+	return runs, nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package readdb
+
+import (
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/util"
+	"agola.io/agola/services/runservice/types"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAggregateRunStats(t *testing.T) {
+	// wednesday
+	day := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	runStats := []*runStat{
+		{group: "/project/01/branch/master", result: types.RunResultSuccess, endTime: day.Add(1 * time.Hour), duration: 10 * time.Second, cache: types.TaskCacheUsage{RestoreHits: 2, RestoredBytes: 100}},
+		{group: "/project/01/branch/master", result: types.RunResultFailed, endTime: day.Add(2 * time.Hour), duration: 30 * time.Second, cache: types.TaskCacheUsage{RestoreMisses: 1, SavedBytes: 50}},
+		{group: "/project/01/branch/master", result: types.RunResultSuccess, endTime: day.Add(26 * time.Hour), duration: 20 * time.Second},
+		{group: "/project/01/branch/feature", result: types.RunResultStopped, endTime: day.Add(1 * time.Hour), duration: 5 * time.Second},
+	}
+
+	tests := []struct {
+		name   string
+		bucket types.RunStatsBucket
+		out    []*types.RunStats
+	}{
+		{
+			name:   "test no bucket",
+			bucket: types.RunStatsBucketNone,
+			out: []*types.RunStats{
+				{Group: "/project/01/branch/feature", RunCount: 1, StoppedCount: 1, MedianDuration: 5 * time.Second},
+				{Group: "/project/01/branch/master", RunCount: 3, SuccessCount: 2, FailedCount: 1, MedianDuration: 20 * time.Second, CacheRestoreHits: 2, CacheRestoreMisses: 1, CacheRestoredBytes: 100, CacheSavedBytes: 50},
+			},
+		},
+		{
+			name:   "test day bucket",
+			bucket: types.RunStatsBucketDay,
+			out: []*types.RunStats{
+				{Group: "/project/01/branch/feature", BucketStart: util.TimeP(day), RunCount: 1, StoppedCount: 1, MedianDuration: 5 * time.Second},
+				{Group: "/project/01/branch/master", BucketStart: util.TimeP(day), RunCount: 2, SuccessCount: 1, FailedCount: 1, MedianDuration: 20 * time.Second, CacheRestoreHits: 2, CacheRestoreMisses: 1, CacheRestoredBytes: 100, CacheSavedBytes: 50},
+				{Group: "/project/01/branch/master", BucketStart: util.TimeP(day.AddDate(0, 0, 1)), RunCount: 1, SuccessCount: 1, MedianDuration: 20 * time.Second},
+			},
+		},
+		{
+			name:   "test week bucket",
+			bucket: types.RunStatsBucketWeek,
+			out: []*types.RunStats{
+				{Group: "/project/01/branch/feature", BucketStart: util.TimeP(day.AddDate(0, 0, -2)), RunCount: 1, StoppedCount: 1, MedianDuration: 5 * time.Second},
+				{Group: "/project/01/branch/master", BucketStart: util.TimeP(day.AddDate(0, 0, -2)), RunCount: 3, SuccessCount: 2, FailedCount: 1, MedianDuration: 20 * time.Second, CacheRestoreHits: 2, CacheRestoreMisses: 1, CacheRestoredBytes: 100, CacheSavedBytes: 50},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := aggregateRunStats(runStats, tt.bucket)
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Errorf("run stats mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseRunExportWatermark(t *testing.T) {
+	tests := []struct {
+		in  string
+		out *RunExportWatermark
+		err bool
+	}{
+		{in: "1579046400:0123456789", out: &RunExportWatermark{EndTime: 1579046400, RunID: "0123456789"}},
+		{in: "1579046400", err: true},
+		{in: "1579046400:", err: true},
+		{in: "abc:0123456789", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out, err := ParseRunExportWatermark(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Errorf("watermark mismatch (-want +got):\n%s", diff)
+			}
+			if out.String() != tt.in {
+				t.Errorf("expected watermark string %q, got %q", tt.in, out.String())
+			}
+		})
+	}
+}
@@ -16,7 +16,7 @@ package runservice
 
 import (
 	"context"
-	"crypto/tls"
+	"io/ioutil"
 	"net/http"
 	"path/filepath"
 	"sync"
@@ -36,10 +36,12 @@ import (
 	"agola.io/agola/services/runservice/types"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	etcdclientv3 "go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/mvcc/mvccpb"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	errors "golang.org/x/xerrors"
 )
 
 var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
@@ -141,10 +143,16 @@ type Runservice struct {
 	c               *config.Runservice
 	e               *etcd.Store
 	ost             *objectstorage.ObjStorage
+	logsOST         *objectstorage.ObjStorage
+	archivesOST     *objectstorage.ObjStorage
+	cacheOST        *objectstorage.ObjStorage
 	dm              *datamanager.DataManager
 	readDB          *readdb.ReadDB
 	ah              *action.ActionHandler
 	maintenanceMode bool
+
+	// executorClient is the http client used to connect to the executors
+	executorClient *http.Client
 }
 
 func NewRunservice(ctx context.Context, l *zap.Logger, c *config.Runservice) (*Runservice, error) {
@@ -160,15 +168,36 @@ func NewRunservice(ctx context.Context, l *zap.Logger, c *config.Runservice) (*R
 	if err != nil {
 		return nil, err
 	}
+	// the logs, archives and cache can be saved in dedicated object storages
+	logsOST, err := newDataObjectStorage(c.LogsObjectStorage, ost)
+	if err != nil {
+		return nil, err
+	}
+	archivesOST, err := newDataObjectStorage(c.ArchivesObjectStorage, ost)
+	if err != nil {
+		return nil, err
+	}
+	cacheOST, err := newDataObjectStorage(c.CacheObjectStorage, ost)
+	if err != nil {
+		return nil, err
+	}
 	e, err := scommon.NewEtcd(&c.Etcd, logger, "runservice")
 	if err != nil {
 		return nil, err
 	}
+	executorClient, err := scommon.NewHTTPClient(c.ExecutorsTLS)
+	if err != nil {
+		return nil, errors.Errorf("failed to create executors http client: %w", err)
+	}
 
 	s := &Runservice{
-		c:   c,
-		e:   e,
-		ost: ost,
+		c:              c,
+		e:              e,
+		ost:            ost,
+		logsOST:        logsOST,
+		archivesOST:    archivesOST,
+		cacheOST:       cacheOST,
+		executorClient: executorClient,
 	}
 
 	dmConf := &datamanager.DataManagerConfig{
@@ -179,6 +208,7 @@ func NewRunservice(ctx context.Context, l *zap.Logger, c *config.Runservice) (*R
 			string(common.DataTypeRun),
 			string(common.DataTypeRunConfig),
 			string(common.DataTypeRunCounter),
+			string(common.DataTypePreviewEnvironment),
 		},
 	}
 	dm, err := datamanager.NewDataManager(ctx, logger, dmConf)
@@ -196,9 +226,49 @@ func NewRunservice(ctx context.Context, l *zap.Logger, c *config.Runservice) (*R
 	ah := action.NewActionHandler(logger, e, readDB, ost, dm)
 	s.ah = ah
 
+	schedulingPauseWindows := make([]*action.SchedulingPauseWindow, len(c.SchedulingPauseWindows))
+	for i, cw := range c.SchedulingPauseWindows {
+		w, err := action.NewSchedulingPauseWindow(cw.Start, cw.End, cw.Weekdays)
+		if err != nil {
+			return nil, errors.Errorf("wrong scheduling pause window: %w", err)
+		}
+		schedulingPauseWindows[i] = w
+	}
+	ah.SetSchedulingPauseWindows(schedulingPauseWindows)
+
+	idTokenSigner, err := newIDTokenSigner(c.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	ah.SetIDTokenSigner(idTokenSigner)
+	ah.SetRescheduleRestartedExecutorTasks(c.ExecutorRestartPolicy == config.ExecutorRestartPolicyReschedule)
+	ah.SetArchivesObjectStorage(archivesOST)
+
 	return s, nil
 }
 
+// newIDTokenSigner returns the tasks id tokens signer defined by c or nil when
+// not defined
+func newIDTokenSigner(c *config.IDToken) (*action.IDTokenSigner, error) {
+	if c == nil {
+		return nil, nil
+	}
+	privateKeyData, err := ioutil.ReadFile(c.PrivateKeyPath)
+	if err != nil {
+		return nil, errors.Errorf("failed to read id token private key: %w", err)
+	}
+	return action.NewIDTokenSigner(c.Issuer, c.Audience, c.Duration, privateKeyData)
+}
+
+// newDataObjectStorage returns the object storage defined by c or the default
+// one when not defined
+func newDataObjectStorage(c *config.ObjectStorage, defaultOST *objectstorage.ObjStorage) (*objectstorage.ObjStorage, error) {
+	if c == nil {
+		return defaultOST, nil
+	}
+	return scommon.NewObjectStorage(c)
+}
+
 func (s *Runservice) InitEtcd(ctx context.Context) error {
 	// Create changegroup min revision if it doesn't exists
 	cmp := []etcdclientv3.Cmp{}
@@ -216,6 +286,8 @@ func (s *Runservice) InitEtcd(ctx context.Context) error {
 
 func (s *Runservice) setupDefaultRouter(etCh chan *types.ExecutorTask) http.Handler {
 	maintenanceModeHandler := api.NewMaintenanceModeHandler(logger, s.ah, s.e)
+	schedulingStatusHandler := api.NewSchedulingStatusHandler(logger, s.ah)
+	schedulingPauseHandler := api.NewSchedulingPauseHandler(logger, s.ah)
 	exportHandler := api.NewExportHandler(logger, s.ah)
 
 	// executor dedicated api, only calls from executor should happen on these handlers
@@ -223,25 +295,37 @@ func (s *Runservice) setupDefaultRouter(etCh chan *types.ExecutorTask) http.Hand
 	executorTaskStatusHandler := api.NewExecutorTaskStatusHandler(s.e, etCh)
 	executorTaskHandler := api.NewExecutorTaskHandler(logger, s.ah)
 	executorTasksHandler := api.NewExecutorTasksHandler(logger, s.ah)
-	archivesHandler := api.NewArchivesHandler(logger, s.ost)
-	cacheHandler := api.NewCacheHandler(logger, s.ost)
-	cacheCreateHandler := api.NewCacheCreateHandler(logger, s.ost)
+	archivesHandler := api.NewArchivesHandler(logger, s.archivesOST)
+	cacheHandler := api.NewCacheHandler(logger, s.cacheOST)
+	cacheCreateHandler := api.NewCacheCreateHandler(logger, s.cacheOST)
 
 	// api from clients
 	executorDeleteHandler := api.NewExecutorDeleteHandler(logger, s.ah)
+	executorsHandler := api.NewExecutorsHandler(logger, s.e)
 
-	logsHandler := api.NewLogsHandler(logger, s.e, s.ost, s.dm)
-	logsDeleteHandler := api.NewLogsDeleteHandler(logger, s.e, s.ost, s.dm)
+	logsHandler := api.NewLogsHandler(logger, s.e, s.logsOST, s.dm, s.executorClient)
+	logsDeleteHandler := api.NewLogsDeleteHandler(logger, s.e, s.logsOST, s.dm)
 
-	runHandler := api.NewRunHandler(logger, s.e, s.dm, s.readDB)
+	runHandler := api.NewRunHandler(logger, s.e, s.dm, s.readDB, s.ah)
 	runTaskActionsHandler := api.NewRunTaskActionsHandler(logger, s.ah)
 	runsHandler := api.NewRunsHandler(logger, s.readDB)
+	runByCounterHandler := api.NewRunByCounterHandler(logger, s.dm, s.readDB)
+	runStatsHandler := api.NewRunStatsHandler(logger, s.readDB)
+	runsExportHandler := api.NewRunsExportHandler(logger, s.dm, s.readDB)
+	runConfigDiffHandler := api.NewRunConfigDiffHandler(logger, s.ah)
+	runProvenanceHandler := api.NewRunProvenanceHandler(logger, s.ah)
+	runTaskEnvironmentHandler := api.NewRunTaskEnvironmentHandler(logger, s.ah)
 	runActionsHandler := api.NewRunActionsHandler(logger, s.ah)
 	runCreateHandler := api.NewRunCreateHandler(logger, s.ah)
 	runEventsHandler := api.NewRunEventsHandler(logger, s.e, s.ost, s.dm)
 
+	previewEnvironmentsHandler := api.NewPreviewEnvironmentsHandler(logger, s.readDB)
+
 	changeGroupsUpdateTokensHandler := api.NewChangeGroupsUpdateTokensHandler(logger, s.readDB)
 
+	webhookDeliveriesHandler := api.NewWebhookDeliveriesHandler(logger, s.ah)
+	webhookDeliveryHandler := api.NewWebhookDeliveryHandler(logger, s.ah)
+
 	router := mux.NewRouter()
 	apirouter := router.PathPrefix("/api/v1alpha").Subrouter()
 
@@ -257,23 +341,40 @@ func (s *Runservice) setupDefaultRouter(etCh chan *types.ExecutorTask) http.Hand
 	apirouter.Handle("/executor/caches/{key}", cacheHandler).Methods("HEAD")
 	apirouter.Handle("/executor/caches/{key}", cacheHandler).Methods("GET")
 	apirouter.Handle("/executor/caches/{key}", cacheCreateHandler).Methods("POST")
+	apirouter.Handle("/executors", executorsHandler).Methods("GET")
 
 	apirouter.Handle("/logs", logsHandler).Methods("GET")
 	apirouter.Handle("/logs", logsDeleteHandler).Methods("DELETE")
 
 	apirouter.Handle("/runs/events", runEventsHandler).Methods("GET")
+	apirouter.Handle("/runs/stats", runStatsHandler).Methods("GET")
+	apirouter.Handle("/runs/export", runsExportHandler).Methods("GET")
+	apirouter.Handle("/runs/bycounter", runByCounterHandler).Methods("GET")
 	apirouter.Handle("/runs/{runid}", runHandler).Methods("GET")
 	apirouter.Handle("/runs/{runid}/actions", runActionsHandler).Methods("PUT")
+	apirouter.Handle("/runs/{runid}/configdiff/{otherrunid}", runConfigDiffHandler).Methods("GET")
+	apirouter.Handle("/runs/{runid}/provenance", runProvenanceHandler).Methods("GET")
+	apirouter.Handle("/runs/{runid}/tasks/{taskid}/environment", runTaskEnvironmentHandler).Methods("GET")
 	apirouter.Handle("/runs/{runid}/tasks/{taskid}/actions", runTaskActionsHandler).Methods("PUT")
 	apirouter.Handle("/runs", runsHandler).Methods("GET")
 	apirouter.Handle("/runs", runCreateHandler).Methods("POST")
 
+	apirouter.Handle("/previewenvironments", previewEnvironmentsHandler).Methods("GET")
+
 	apirouter.Handle("/changegroups", changeGroupsUpdateTokensHandler).Methods("GET")
 
+	apirouter.Handle("/webhookdeliveries/{projectid}", webhookDeliveriesHandler).Methods("GET")
+	apirouter.Handle("/webhookdeliveries/{projectid}/{deliveryid}", webhookDeliveryHandler).Methods("GET", "PUT")
+
 	apirouter.Handle("/maintenance", maintenanceModeHandler).Methods("PUT", "DELETE")
 
+	apirouter.Handle("/scheduling", schedulingStatusHandler).Methods("GET")
+	apirouter.Handle("/scheduling/pause", schedulingPauseHandler).Methods("PUT", "DELETE")
+
 	apirouter.Handle("/export", exportHandler).Methods("GET")
 
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
 	mainrouter := mux.NewRouter()
 	mainrouter.PathPrefix("/").Handler(router)
 
@@ -302,6 +403,23 @@ func (s *Runservice) setupMaintenanceRouter() http.Handler {
 	return mainrouter
 }
 
+// Reload applies the runservice config changes that don't require a restart.
+// Currently the log level and the id token signing key (to rotate it).
+func (s *Runservice) Reload(c *config.Runservice) {
+	if c.Debug {
+		level.SetLevel(zapcore.DebugLevel)
+	} else {
+		level.SetLevel(zapcore.InfoLevel)
+	}
+
+	idTokenSigner, err := newIDTokenSigner(c.IDToken)
+	if err != nil {
+		log.Errorf("failed to reload id token signer, keeping the current one: %+v", err)
+		return
+	}
+	s.ah.SetIDTokenSigner(idTokenSigner)
+}
+
 func (s *Runservice) Run(ctx context.Context) error {
 	for {
 		if err := s.run(ctx); err != nil {
@@ -319,14 +437,10 @@ func (s *Runservice) Run(ctx context.Context) error {
 }
 
 func (s *Runservice) run(ctx context.Context) error {
-	var tlsConfig *tls.Config
-	if s.c.Web.TLS {
-		var err error
-		tlsConfig, err = util.NewTLSConfig(s.c.Web.TLSCertFile, s.c.Web.TLSKeyFile, "", false)
-		if err != nil {
-			log.Errorf("err: %+v")
-			return err
-		}
+	tlsConfig, err := scommon.NewTLSServerConfig(&s.c.Web)
+	if err != nil {
+		log.Errorf("err: %+v", err)
+		return err
 	}
 
 	resp, err := s.e.Get(ctx, common.EtcdMaintenanceKey, 0)
@@ -403,7 +517,7 @@ func (s *Runservice) run(ctx context.Context) error {
 
 	lerrCh := make(chan error, 1)
 	util.GoWait(&wg, func() {
-		lerrCh <- httpServer.ListenAndServe()
+		lerrCh <- scommon.ListenAndServe(&httpServer)
 	})
 
 	select {
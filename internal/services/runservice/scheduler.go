@@ -19,6 +19,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"net/http"
 	"strconv"
 	"time"
@@ -29,8 +30,10 @@ import (
 	"agola.io/agola/internal/runconfig"
 	"agola.io/agola/internal/services/runservice/common"
 	"agola.io/agola/internal/services/runservice/store"
+	"agola.io/agola/internal/tracing"
 	"agola.io/agola/internal/util"
 	"agola.io/agola/services/runservice/types"
+	ctypes "agola.io/agola/services/types"
 
 	etcdclientv3 "go.etcd.io/etcd/clientv3"
 	"go.etcd.io/etcd/clientv3/concurrency"
@@ -42,10 +45,16 @@ const (
 	workspaceCleanerInterval = 1 * 24 * time.Hour
 
 	defaultExecutorNotAliveInterval = 60 * time.Second
+
+	defaultSchedulerInterval = 2 * time.Second
 )
 
 func taskMatchesParentDependCondition(ctx context.Context, rt *types.RunTask, r *types.Run, rc *types.RunConfig) bool {
 	rct := rc.Tasks[rt.ID]
+	// always tasks are executed whatever the parents result
+	if rct.Always {
+		return true
+	}
 	parents := runconfig.GetParents(rc.Tasks, rct)
 
 	matchedNum := 0
@@ -85,8 +94,12 @@ func advanceRunTasks(ctx context.Context, curRun *types.Run, rc *types.RunConfig
 	newRun := curRun.DeepCopy()
 
 	if newRun.Stop {
-		// if the run is set to stop, skip all not running tasks
+		// if the run is set to stop, skip all not running tasks but the always
+		// tasks
 		for _, rt := range newRun.Tasks {
+			if rc.Tasks[rt.ID].Always {
+				continue
+			}
 			isScheduled := false
 			for _, et := range scheduledExecutorTasks {
 				if rt.ID == et.ID {
@@ -118,7 +131,7 @@ func advanceRunTasks(ctx context.Context, curRun *types.Run, rc *types.RunConfig
 		}
 
 		// cancel task if the run has a result set and is not yet scheduled
-		if curRun.Result.IsSet() {
+		if curRun.Result.IsSet() && !rct.Always {
 			isScheduled := false
 			for _, et := range scheduledExecutorTasks {
 				if rt.ID == et.ID {
@@ -176,6 +189,14 @@ func advanceRunTasks(ctx context.Context, curRun *types.Run, rc *types.RunConfig
 			if rct.NeedsApproval && !rt.WaitingApproval && !rt.Approved {
 				rt.WaitingApproval = true
 			}
+
+			// start the deploy environment wait timer when the task could
+			// be executed
+			if de := rct.DeployEnvironment; de != nil && de.WaitTimer > 0 && rt.WaitTimerEndTime == nil {
+				if !rct.NeedsApproval || rt.Approved {
+					rt.WaitTimerEndTime = util.TimeP(time.Now().Add(de.WaitTimer))
+				}
+			}
 		}
 	}
 
@@ -216,9 +237,16 @@ func getTasksToRun(ctx context.Context, r *types.Run, rc *types.RunConfig) ([]*t
 			}
 
 			// Run only if approved (when needs approval)
-			if !rct.NeedsApproval || (rct.NeedsApproval && rt.Approved) {
-				tasksToRun = append(tasksToRun, rt)
+			if rct.NeedsApproval && !rt.Approved {
+				continue
+			}
+			// Run only when the deploy environment wait timer is expired
+			if de := rct.DeployEnvironment; de != nil && de.WaitTimer > 0 {
+				if rt.WaitTimerEndTime == nil || time.Now().Before(*rt.WaitTimerEndTime) {
+					continue
+				}
 			}
+			tasksToRun = append(tasksToRun, rt)
 		}
 	}
 
@@ -228,19 +256,66 @@ func getTasksToRun(ctx context.Context, r *types.Run, rc *types.RunConfig) ([]*t
 func (s *Runservice) submitRunTasks(ctx context.Context, r *types.Run, rc *types.RunConfig, tasks []*types.RunTask) error {
 	log.Debugf("tasksToRun: %s", util.Dump(tasks))
 
+	// report in the run tasks why they are waiting for an executor
+	runChanged := false
+	defer func() {
+		if !runChanged {
+			return
+		}
+		if _, err := store.AtomicPutRun(ctx, s.e, r, nil, nil); err != nil {
+			log.Errorf("failed to update run %q tasks waiting reason: %+v", r.ID, err)
+		}
+	}()
+
 	for _, rt := range tasks {
 		rct := rc.Tasks[rt.ID]
 
-		executor, err := s.chooseExecutor(ctx, rct)
-		if err != nil {
-			return err
+		// fail early the tasks that the executor would fail to execute
+		if err := preflightCheckTask(rct); err != nil {
+			log.Warnf("run %q task %q preflight validation failed: %v", r.ID, rct.Name, err)
+			failRunTaskPreflight(rt, err)
+			runChanged = true
+			continue
+		}
+
+		var executor *types.Executor
+		var gpuType, reason string
+		if rc.ExecutorID == "" && rct.Batch {
+			// prefer the executor of a previous task of the same batch since
+			// it could execute the task in the same pod
+			batchExecutorID, err := s.batchExecutorID(ctx, r, rc, rct)
+			if err != nil {
+				return err
+			}
+			if batchExecutorID != "" {
+				executor, gpuType, _, err = s.chooseExecutor(ctx, batchExecutorID, rct)
+				if err != nil {
+					return err
+				}
+			}
 		}
 		if executor == nil {
-			log.Warnf("cannot choose an executor")
-			return nil
+			var err error
+			executor, gpuType, reason, err = s.chooseExecutor(ctx, rc.ExecutorID, rct)
+			if err != nil {
+				return err
+			}
+		}
+		if rt.WaitingExecutorReason != reason {
+			rt.WaitingExecutorReason = reason
+			runChanged = true
+		}
+		if executor == nil {
+			// don't stop scheduling the other tasks since they could be executed
+			// by other executors (i.e. with a different arch)
+			log.Warnf("cannot choose an executor for run %q task %q: %s", r.ID, rct.Name, reason)
+			continue
 		}
 
 		et := common.GenExecutorTask(r, rt, rc, executor)
+		if et.Spec.GPUs != nil {
+			et.Spec.GPUs.Type = gpuType
+		}
 		log.Debugf("et: %s", util.Dump(et))
 
 		// check that the executorTask wasn't already scheduled
@@ -259,43 +334,150 @@ func (s *Runservice) submitRunTasks(ctx context.Context, r *types.Run, rc *types
 		if err := s.sendExecutorTask(ctx, et); err != nil {
 			return err
 		}
+
+		traceTaskSchedulingWait(ctx, r, rt, rct, executor)
 	}
 
 	return nil
 }
 
+// batchExecutorID returns the executor id of the last successfully finished
+// task of the same batch of the provided task
+func (s *Runservice) batchExecutorID(ctx context.Context, r *types.Run, rc *types.RunConfig, rct *types.RunConfigTask) (string, error) {
+	batchID := common.TaskBatchID(r, rct)
+	if batchID == "" {
+		return "", nil
+	}
+
+	var lastEndTime time.Time
+	executorID := ""
+	for _, brt := range r.Tasks {
+		if brt.ID == rct.ID || brt.Status != types.RunTaskStatusSuccess || brt.EndTime == nil {
+			continue
+		}
+		brct, ok := rc.Tasks[brt.ID]
+		if !ok || common.TaskBatchID(r, brct) != batchID {
+			continue
+		}
+		if !brt.EndTime.After(lastEndTime) {
+			continue
+		}
+		et, err := store.GetExecutorTask(ctx, s.e, brt.ID)
+		if err != nil {
+			if err == etcd.ErrKeyNotFound {
+				continue
+			}
+			return "", err
+		}
+		lastEndTime = *brt.EndTime
+		executorID = et.Spec.ExecutorID
+	}
+
+	return executorID, nil
+}
+
+// traceTaskSchedulingWait records a span covering the time between when the
+// task was ready to be executed (the run started or all its parents
+// finished) and when it was sent to the executor
+func traceTaskSchedulingWait(ctx context.Context, r *types.Run, rt *types.RunTask, rct *types.RunConfigTask, executor *types.Executor) {
+	if r.TraceParent == "" || r.StartTime == nil {
+		return
+	}
+
+	readyTime := *r.StartTime
+	for parentID := range rct.Depends {
+		prt, ok := r.Tasks[parentID]
+		if !ok || prt.EndTime == nil {
+			continue
+		}
+		if prt.EndTime.After(readyTime) {
+			readyTime = *prt.EndTime
+		}
+	}
+
+	ctx = tracing.ContextWithTraceParent(ctx, r.TraceParent)
+	_, span := tracing.StartSpanWithTime(ctx, "runservice.task_scheduling_wait", readyTime)
+	span.SetAttribute("agola.run_id", r.ID)
+	span.SetAttribute("agola.task_id", rt.ID)
+	span.SetAttribute("agola.task_name", rct.Name)
+	span.SetAttribute("agola.executor_id", executor.ID)
+	span.End()
+}
+
 // chooseExecutor chooses the executor to schedule the task on. Now it's a very simple/dumb selection
-// TODO(sgotti) improve this to use executor statistic, labels (arch type) etc...
-func (s *Runservice) chooseExecutor(ctx context.Context, rct *types.RunConfigTask) (*types.Executor, error) {
+// TODO(sgotti) improve this to use executor statistic, labels etc...
+func (s *Runservice) chooseExecutor(ctx context.Context, pinnedExecutorID string, rct *types.RunConfigTask) (*types.Executor, string, string, error) {
 	executors, err := store.GetExecutors(ctx, s.e)
 	if err != nil {
-		return nil, err
+		return nil, "", "", err
 	}
 	// TODO(sgotti) find a way to avoid retrieving this for every chooseExecutor
 	// invocation (i.e. use an etcd watcher to keep this value updated)
 	executorTasksCount, err := store.GetExecutorTasksCountByExecutor(ctx, s.e)
 	if err != nil {
-		return nil, err
+		return nil, "", "", err
 	}
-	return chooseExecutor(executors, executorTasksCount, rct), nil
+	var executorGPUsCount map[string]map[string]int
+	if rct.Runtime.GPUs != nil {
+		executorGPUsCount, err = store.GetExecutorTasksGPUsByExecutor(ctx, s.e)
+		if err != nil {
+			return nil, "", "", err
+		}
+	}
+	e, gpuType, reason := chooseExecutor(executors, executorTasksCount, executorGPUsCount, pinnedExecutorID, rct)
+	return e, gpuType, reason, nil
 }
 
-func chooseExecutor(executors []*types.Executor, executorTasksCount map[string]int, rct *types.RunConfigTask) *types.Executor {
-	requiresPrivilegedContainers := false
-	for _, c := range rct.Runtime.Containers {
+// chooseExecutor returns the executor to schedule the task on and, when the
+// task requests gpus, the gpu type to assign. When no executor can be chosen
+// it returns the reason. When pinnedExecutorID is defined only the executor
+// with this id will be considered.
+func chooseExecutor(executors []*types.Executor, executorTasksCount map[string]int, executorGPUsCount map[string]map[string]int, pinnedExecutorID string, rct *types.RunConfigTask) (*types.Executor, string, string) {
+	// the docker daemon is executed in a privileged container
+	requiresPrivilegedContainers := rct.Runtime.Docker != nil
+	for _, c := range append(append([]*types.Container{}, rct.Runtime.Containers...), rct.Runtime.InitContainers...) {
 		if c.Privileged {
 			requiresPrivilegedContainers = true
 			break
 		}
 	}
 
+	// the reason is the one of the last check passed by any executor
+	reasons := []string{
+		"no active executors",
+		fmt.Sprintf("no active executors supporting os %q", ctypes.OSOrDefault(rct.Runtime.OS)),
+		fmt.Sprintf("no active executors supporting arch %q", rct.Runtime.Arch),
+		"no active executors allowing privileged containers",
+		"no active executors providing the requested gpus",
+		"all the executors reached their active tasks limit",
+		"all the executors providing the requested gpus have them in use",
+	}
+	checksPassed := 0
+
+	if pinnedExecutorID != "" {
+		reasons[0] = fmt.Sprintf("pinned executor %q doesn't exist or isn't active", pinnedExecutorID)
+		var pinnedExecutors []*types.Executor
+		for _, e := range executors {
+			if e.ID == pinnedExecutorID {
+				pinnedExecutors = append(pinnedExecutors, e)
+			}
+		}
+		executors = pinnedExecutors
+	}
+
 	for _, e := range executors {
 		if e.LastStatusUpdateTime.Add(defaultExecutorNotAliveInterval).Before(time.Now()) {
 			continue
 		}
 
-		// skip executor provileged containers are required but not allowed
-		if requiresPrivilegedContainers && !e.AllowPrivilegedContainers {
+		// skip draining executors
+		if e.Draining {
+			continue
+		}
+
+		// the executor os must match the task os (linux when not defined)
+		if ctypes.OSOrDefault(e.OS) != ctypes.OSOrDefault(rct.Runtime.OS) {
+			checksPassed = maxInt(checksPassed, 1)
 			continue
 		}
 
@@ -308,10 +490,23 @@ func chooseExecutor(executors []*types.Executor, executorTasksCount map[string]i
 				}
 			}
 			if !hasArch {
+				checksPassed = maxInt(checksPassed, 2)
 				continue
 			}
 		}
 
+		// skip executor provileged containers are required but not allowed
+		if requiresPrivilegedContainers && !e.AllowPrivilegedContainers {
+			checksPassed = maxInt(checksPassed, 3)
+			continue
+		}
+
+		// skip executors not providing the requested gpus
+		if rct.Runtime.GPUs != nil && !executorProvidesGPUs(e, rct.Runtime.GPUs) {
+			checksPassed = maxInt(checksPassed, 4)
+			continue
+		}
+
 		if e.ActiveTasksLimit != 0 {
 			// will be 0 when executorTasksCount[e.ID] doesn't exist
 			activeTasks := executorTasksCount[e.ID]
@@ -321,14 +516,61 @@ func chooseExecutor(executors []*types.Executor, executorTasksCount map[string]i
 			// calculate the active tasks by the max between the current scheduled
 			// tasks in the store and the executor reported tasks
 			if activeTasks >= e.ActiveTasksLimit {
+				checksPassed = maxInt(checksPassed, 5)
 				continue
 			}
 		}
 
-		return e
+		gpuType := ""
+		if rct.Runtime.GPUs != nil {
+			var ok bool
+			gpuType, ok = executorFreeGPUType(e, executorGPUsCount[e.ID], rct.Runtime.GPUs)
+			if !ok {
+				checksPassed = maxInt(checksPassed, 6)
+				continue
+			}
+		}
+
+		return e, gpuType, ""
 	}
 
-	return nil
+	return nil, "", reasons[checksPassed]
+}
+
+// executorProvidesGPUs reports if the executor provides enough gpus of the
+// requested type (any type if not specified), regardless of their usage
+func executorProvidesGPUs(e *types.Executor, gpus *types.GPUs) bool {
+	for _, eg := range e.GPUs {
+		if gpus.Type != "" && eg.Type != gpus.Type {
+			continue
+		}
+		if eg.Count >= gpus.Count {
+			return true
+		}
+	}
+	return false
+}
+
+// executorFreeGPUType returns the first executor gpu type matching the
+// requested gpus and with enough gpus not used by other executor tasks
+func executorFreeGPUType(e *types.Executor, usedGPUs map[string]int, gpus *types.GPUs) (string, bool) {
+	for _, eg := range e.GPUs {
+		if gpus.Type != "" && eg.Type != gpus.Type {
+			continue
+		}
+		// will be 0 when usedGPUs[eg.Type] doesn't exist
+		if eg.Count-usedGPUs[eg.Type] >= gpus.Count {
+			return eg.Type, true
+		}
+	}
+	return "", false
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
 }
 
 // sendExecutorTask sends executor task to executor, if this fails the executor
@@ -360,14 +602,17 @@ func (s *Runservice) sendExecutorTask(ctx context.Context, et *types.ExecutorTas
 	et = et.DeepCopy()
 
 	// generate ExecutorTaskSpecData
-	et.Spec.ExecutorTaskSpecData = common.GenExecutorTaskSpecData(r, rt, rc)
+	et.Spec.ExecutorTaskSpecData, err = s.ah.GenExecutorTaskSpecData(r, rt, rc)
+	if err != nil {
+		return err
+	}
 
 	etj, err := json.Marshal(et)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.Post(executor.ListenURL+"/api/v1alpha/executor", "", bytes.NewReader(etj))
+	req, err := s.executorClient.Post(executor.ListenURL+"/api/v1alpha/executor", "", bytes.NewReader(etj))
 	if err != nil {
 		return err
 	}
@@ -458,6 +703,10 @@ func (s *Runservice) compactChangeGroups(ctx context.Context) error {
 func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.RunConfig) error {
 	log.Debugf("r: %s", util.Dump(r))
 
+	if r.Phase == types.RunPhaseQueued && len(r.DependsOn) > 0 {
+		return s.checkRunDependencies(ctx, r)
+	}
+
 	prevPhase := r.Phase
 	prevResult := r.Result
 
@@ -489,9 +738,12 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 		return err
 	}
 
-	// if the run is set to stop, stop all active tasks
+	// if the run is set to stop, stop all active tasks but the always tasks
 	if r.Stop {
 		for _, et := range scheduledExecutorTasks {
+			if rct, ok := rc.Tasks[et.ID]; ok && rct.Always {
+				continue
+			}
 			et.Spec.Stop = true
 			if _, err := store.AtomicPutExecutorTask(ctx, s.e, et); err != nil {
 				return err
@@ -513,6 +765,17 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 			return err
 		}
 
+		// don't submit new tasks while the scheduling is paused, the already
+		// submitted ones will continue their execution
+		schedulingStatus, err := s.ah.GetSchedulingStatus(ctx)
+		if err != nil {
+			return err
+		}
+		if schedulingStatus.Paused {
+			log.Debugf("scheduling paused, not submitting new tasks for run %q", r.ID)
+			return nil
+		}
+
 		tasksToRun, err := getTasksToRun(ctx, r, rc)
 		if err != nil {
 			return err
@@ -524,6 +787,30 @@ func (s *Runservice) scheduleRun(ctx context.Context, r *types.Run, rc *types.Ru
 	return nil
 }
 
+// checkRunDependencies cancels a queued run when one of its upstream runs
+// finished without success. Since the cancelled run is finished, the
+// cancellation is then propagated to its downstream runs.
+func (s *Runservice) checkRunDependencies(ctx context.Context, r *types.Run) error {
+	deps, err := s.ah.GetRunDependenciesStatus(ctx, r)
+	if err != nil {
+		return err
+	}
+	if deps.FailedRun == nil {
+		return nil
+	}
+
+	log.Infof("cancelling run %q since upstream run %q finished without success", r.ID, deps.FailedRun.ID)
+	r.CancelReason = fmt.Sprintf("upstream run %q finished with phase %q and result %q", deps.FailedRun.ID, deps.FailedRun.Phase, deps.FailedRun.Result)
+	r.ChangePhase(types.RunPhaseCancelled)
+
+	runEvent, err := common.NewRunEvent(ctx, s.e, r.ID, r.Phase, r.Result)
+	if err != nil {
+		return err
+	}
+	_, err = store.AtomicPutRun(ctx, s.e, r, runEvent, nil)
+	return err
+}
+
 // advanceRun updates the run result and phase. It must be the unique function that
 // should update them.
 func advanceRun(ctx context.Context, r *types.Run, rc *types.RunConfig, scheduledExecutorTasks []*types.ExecutorTask) error {
@@ -539,7 +826,8 @@ func advanceRun(ctx context.Context, r *types.Run, rc *types.RunConfig, schedule
 				return errors.Errorf("no such run config task with id %s for run config %s", rt.ID, rc.ID)
 			}
 			if rt.Status == types.RunTaskStatusFailed {
-				if !rct.IgnoreFailure {
+				// always tasks failures don't change the run result
+				if !rct.IgnoreFailure && !rct.Always {
 					log.Debugf("marking run %q as failed is task %q is failed", r.ID, rt.ID)
 					r.Result = types.RunResultFailed
 					break
@@ -702,8 +990,19 @@ func (s *Runservice) updateRunTaskStatus(ctx context.Context, et *types.Executor
 		rt.Steps[i].ExitStatus = s.ExitStatus
 		rt.Steps[i].StartTime = s.StartTime
 		rt.Steps[i].EndTime = s.EndTime
+		rt.Steps[i].ResourceUsage = s.ResourceUsage
+		rt.Steps[i].Cache = s.Cache
+		rt.Steps[i].ArchiveSize = s.ArchiveSize
 	}
 
+	rt.Reports = et.Status.Reports
+	rt.Outputs = et.Status.Outputs
+	rt.ResourceUsage = et.Status.ResourceUsage
+	rt.StopResult = et.Status.StopResult
+	rt.ImagePull = et.Status.ImagePull
+	rt.FailError = et.Status.FailError
+	rt.DebugHold = et.Status.DebugHold
+
 	return nil
 }
 
@@ -876,8 +1175,8 @@ func (s *Runservice) runTasksUpdater(ctx context.Context) error {
 	return nil
 }
 
-func (s *Runservice) OSTFileExists(path string) (bool, error) {
-	_, err := s.ost.Stat(path)
+func ostFileExists(ost *objectstorage.ObjStorage, path string) (bool, error) {
+	_, err := ost.Stat(path)
 	if err != nil && !objectstorage.IsNotExist(err) {
 		return false, err
 	}
@@ -910,7 +1209,7 @@ func (s *Runservice) fetchLog(ctx context.Context, rt *types.RunTask, setup bool
 	} else {
 		logPath = store.OSTRunTaskStepLogPath(rt.ID, stepnum)
 	}
-	ok, err := s.OSTFileExists(logPath)
+	ok, err := ostFileExists(s.logsOST, logPath)
 	if err != nil {
 		return err
 	}
@@ -924,7 +1223,7 @@ func (s *Runservice) fetchLog(ctx context.Context, rt *types.RunTask, setup bool
 	} else {
 		u = fmt.Sprintf(executor.ListenURL+"/api/v1alpha/executor/logs?taskid=%s&step=%d", rt.ID, stepnum)
 	}
-	r, err := http.Get(u)
+	r, err := s.executorClient.Get(u)
 	if err != nil {
 		return err
 	}
@@ -947,7 +1246,7 @@ func (s *Runservice) fetchLog(ctx context.Context, rt *types.RunTask, setup bool
 		}
 	}
 
-	return s.ost.WriteObject(logPath, r.Body, size, false)
+	return s.logsOST.WriteObject(logPath, r.Body, size, false)
 }
 
 func (s *Runservice) finishSetupLogPhase(ctx context.Context, runID, runTaskID string) error {
@@ -1068,7 +1367,7 @@ func (s *Runservice) fetchArchive(ctx context.Context, rt *types.RunTask, stepnu
 	}
 
 	path := store.OSTRunTaskArchivePath(rt.ID, stepnum)
-	ok, err := s.OSTFileExists(path)
+	ok, err := ostFileExists(s.archivesOST, path)
 	if err != nil {
 		return err
 	}
@@ -1078,7 +1377,7 @@ func (s *Runservice) fetchArchive(ctx context.Context, rt *types.RunTask, stepnu
 
 	u := fmt.Sprintf(executor.ListenURL+"/api/v1alpha/executor/archives?taskid=%s&step=%d", rt.ID, stepnum)
 	log.Debugf("fetchArchive: %s", u)
-	r, err := http.Get(u)
+	r, err := s.executorClient.Get(u)
 	if err != nil {
 		return err
 	}
@@ -1101,7 +1400,7 @@ func (s *Runservice) fetchArchive(ctx context.Context, rt *types.RunTask, stepnu
 		}
 	}
 
-	return s.ost.WriteObject(path, r.Body, size, false)
+	return s.archivesOST.WriteObject(path, r.Body, size, false)
 }
 
 func (s *Runservice) fetchTaskArchives(ctx context.Context, runID string, rt *types.RunTask) {
@@ -1180,22 +1479,22 @@ func (s *Runservice) taskFetcher(ctx context.Context, r *types.Run, rt *types.Ru
 
 	// write related logs runID
 	runIDPath := store.OSTRunTaskLogsRunPath(rt.ID, r.ID)
-	exists, err := s.OSTFileExists(runIDPath)
+	exists, err := ostFileExists(s.logsOST, runIDPath)
 	if err != nil {
 		log.Errorf("err: %+v", err)
 	} else if !exists {
-		if err := s.ost.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
+		if err := s.logsOST.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
 			log.Errorf("err: %+v", err)
 		}
 	}
 
 	// write related archives runID
 	runIDPath = store.OSTRunTaskArchivesRunPath(rt.ID, r.ID)
-	exists, err = s.OSTFileExists(runIDPath)
+	exists, err = ostFileExists(s.archivesOST, runIDPath)
 	if err != nil {
 		log.Errorf("err: %+v", err)
 	} else if !exists {
-		if err := s.ost.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
+		if err := s.archivesOST.WriteObject(runIDPath, bytes.NewReader([]byte{}), 0, false); err != nil {
 			log.Errorf("err: %+v", err)
 		}
 	}
@@ -1216,14 +1515,28 @@ func (s *Runservice) taskFetcher(ctx context.Context, r *types.Run, rt *types.Ru
 }
 
 func (s *Runservice) runsSchedulerLoop(ctx context.Context) {
+	baseInterval := s.c.SchedulerInterval
+	if baseInterval <= 0 {
+		baseInterval = defaultSchedulerInterval
+	}
+	interval := baseInterval
 	for {
 		log.Debugf("runsSchedulerLoop")
 
-		if err := s.runsScheduler(ctx); err != nil {
+		conflicts, err := s.runsScheduler(ctx)
+		if err != nil {
 			log.Errorf("err: %+v", err)
 		}
+		schedulerPassesCounter.Inc()
+		schedulerConflictsCounter.Add(float64(conflicts))
 
-		sleepCh := time.NewTimer(2 * time.Second).C
+		interval = schedulerBackoff(interval, baseInterval, s.c.SchedulerMaxBackoff, conflicts > 0)
+		if conflicts > 0 {
+			log.Debugf("%d runs scheduling conflicts, next scheduling pass in %s", conflicts, interval)
+		}
+		schedulerIntervalGauge.Set(interval.Seconds())
+
+		sleepCh := time.NewTimer(addJitter(interval, s.c.SchedulerJitter)).C
 		select {
 		case <-ctx.Done():
 			return
@@ -1232,19 +1545,53 @@ func (s *Runservice) runsSchedulerLoop(ctx context.Context) {
 	}
 }
 
-func (s *Runservice) runsScheduler(ctx context.Context) error {
+// runsScheduler schedules all the runs and returns the number of runs not
+// scheduled due to concurrent updates
+func (s *Runservice) runsScheduler(ctx context.Context) (int, error) {
 	log.Debugf("runsScheduler")
 	runs, err := store.GetRuns(ctx, s.e)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	conflicts := 0
 	for _, r := range runs {
 		if err := s.runScheduler(ctx, r); err != nil {
+			if isConcurrentUpdateError(err) {
+				conflicts++
+				log.Debugf("run %q concurrently updated: %v", r.ID, err)
+				continue
+			}
 			log.Errorf("err: %+v", err)
 		}
 	}
 
-	return nil
+	return conflicts, nil
+}
+
+func isConcurrentUpdateError(err error) bool {
+	return errors.Is(err, etcd.ErrKeyModified) || errors.Is(err, store.ErrRunModified)
+}
+
+// schedulerBackoff returns the interval before the next scheduling pass. When
+// the last pass had conflicts the current interval is doubled up to
+// maxBackoff, otherwise the base interval is restored.
+func schedulerBackoff(cur, base, maxBackoff time.Duration, conflicts bool) time.Duration {
+	if !conflicts || maxBackoff <= base {
+		return base
+	}
+	next := cur * 2
+	if next > maxBackoff {
+		next = maxBackoff
+	}
+	return next
+}
+
+// addJitter adds to d a random duration up to d * jitter
+func addJitter(d time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return d
+	}
+	return d + time.Duration(rand.Float64()*jitter*float64(d))
 }
 
 func (s *Runservice) runScheduler(ctx context.Context, r *types.Run) error {
@@ -1394,12 +1741,12 @@ func (s *Runservice) cacheCleaner(ctx context.Context, cacheExpireInterval time.
 
 	doneCh := make(chan struct{})
 	defer close(doneCh)
-	for object := range s.ost.List(store.OSTCacheDir()+"/", "", true, doneCh) {
+	for object := range s.cacheOST.List(store.OSTCacheDir()+"/", "", true, doneCh) {
 		if object.Err != nil {
 			return object.Err
 		}
 		if object.LastModified.Add(cacheExpireInterval).Before(time.Now()) {
-			if err := s.ost.DeleteObject(object.Path); err != nil {
+			if err := s.cacheOST.DeleteObject(object.Path); err != nil {
 				if !objectstorage.IsNotExist(err) {
 					log.Warnf("failed to delete cache object %q: %v", object.Path, err)
 				}
@@ -1446,12 +1793,12 @@ func (s *Runservice) workspaceCleaner(ctx context.Context, workspaceExpireInterv
 
 	doneCh := make(chan struct{})
 	defer close(doneCh)
-	for object := range s.ost.List(store.OSTArchivesBaseDir()+"/", "", true, doneCh) {
+	for object := range s.archivesOST.List(store.OSTArchivesBaseDir()+"/", "", true, doneCh) {
 		if object.Err != nil {
 			return object.Err
 		}
 		if object.LastModified.Add(workspaceExpireInterval).Before(time.Now()) {
-			if err := s.ost.DeleteObject(object.Path); err != nil {
+			if err := s.archivesOST.DeleteObject(object.Path); err != nil {
 				if !objectstorage.IsNotExist(err) {
 					log.Warnf("failed to delete workspace object %q: %v", object.Path, err)
 				}
@@ -20,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"agola.io/agola/internal/util"
 	"agola.io/agola/services/runservice/types"
 	ctypes "agola.io/agola/services/types"
 	"github.com/google/go-cmp/cmp"
@@ -385,6 +386,63 @@ func TestAdvanceRunTasks(t *testing.T) {
 				return run
 			}(),
 		},
+		{
+			name: "don't skip always tasks when run is set to stop",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				rc.Tasks["task05"].Always = true
+				rc.Tasks["task05"].Depends["task03"].Conditions = nil
+				rc.Tasks["task05"].Depends["task04"].Conditions = nil
+				return rc
+			}(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Tasks["task01"].Status = types.RunTaskStatusRunning
+				run.Tasks["task04"].Status = types.RunTaskStatusSuccess
+				run.Tasks["task03"].Status = types.RunTaskStatusCancelled
+				run.Stop = true
+				return run
+			}(),
+			scheduledExecutorTasks: []*types.ExecutorTask{
+				&types.ExecutorTask{ID: "task01"},
+			},
+			out: func() *types.Run {
+				run := run.DeepCopy()
+				run.Stop = true
+				run.Tasks["task01"].Status = types.RunTaskStatusRunning
+				run.Tasks["task02"].Status = types.RunTaskStatusSkipped
+				run.Tasks["task03"].Status = types.RunTaskStatusCancelled
+				run.Tasks["task04"].Status = types.RunTaskStatusSuccess
+				run.Tasks["task05"].Status = types.RunTaskStatusNotStarted
+				return run
+			}(),
+		},
+		{
+			name: "don't skip always tasks when parents are failed",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				rc.Tasks["task05"].Always = true
+				rc.Tasks["task05"].Depends["task03"].Conditions = nil
+				rc.Tasks["task05"].Depends["task04"].Conditions = nil
+				return rc
+			}(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Result = types.RunResultFailed
+				run.Tasks["task03"].Status = types.RunTaskStatusFailed
+				run.Tasks["task04"].Status = types.RunTaskStatusSuccess
+				return run
+			}(),
+			out: func() *types.Run {
+				run := run.DeepCopy()
+				run.Result = types.RunResultFailed
+				run.Tasks["task01"].Status = types.RunTaskStatusCancelled
+				run.Tasks["task03"].Status = types.RunTaskStatusFailed
+				run.Tasks["task04"].Status = types.RunTaskStatusSuccess
+				run.Tasks["task05"].Status = types.RunTaskStatusNotStarted
+				return run
+			}(),
+		},
 	}
 
 	for _, tt := range tests {
@@ -546,6 +604,44 @@ func TestGetTasksToRun(t *testing.T) {
 			}(),
 			out: []string{"task01", "task03", "task04"},
 		},
+		{
+			name: "test don't run if deploy environment wait timer not started",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				rc.Tasks["task01"].DeployEnvironment = &types.RunConfigTaskDeployEnvironment{Name: "production", WaitTimer: 10 * time.Minute}
+				return rc
+			}(),
+			r:   run.DeepCopy(),
+			out: []string{"task03", "task04"},
+		},
+		{
+			name: "test don't run if deploy environment wait timer not expired",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				rc.Tasks["task01"].DeployEnvironment = &types.RunConfigTaskDeployEnvironment{Name: "production", WaitTimer: 10 * time.Minute}
+				return rc
+			}(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Tasks["task01"].WaitTimerEndTime = util.TimeP(time.Now().Add(5 * time.Minute))
+				return run
+			}(),
+			out: []string{"task03", "task04"},
+		},
+		{
+			name: "test run if deploy environment wait timer expired",
+			rc: func() *types.RunConfig {
+				rc := rc.DeepCopy()
+				rc.Tasks["task01"].DeployEnvironment = &types.RunConfigTaskDeployEnvironment{Name: "production", WaitTimer: 10 * time.Minute}
+				return rc
+			}(),
+			r: func() *types.Run {
+				run := run.DeepCopy()
+				run.Tasks["task01"].WaitTimerEndTime = util.TimeP(time.Now().Add(-time.Minute))
+				return run
+			}(),
+			out: []string{"task01", "task03", "task04"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -592,6 +688,13 @@ func TestChooseExecutor(t *testing.T) {
 		return e
 	}()
 
+	executorDraining := func() *types.Executor {
+		e := executorOK.DeepCopy()
+		e.ID = "executorDraining"
+		e.Draining = true
+		return e
+	}()
+
 	executorOKMultipleArchs := func() *types.Executor {
 		e := executorOK.DeepCopy()
 		e.ID = "executorOKMultipleArchs"
@@ -599,6 +702,13 @@ func TestChooseExecutor(t *testing.T) {
 		return e
 	}()
 
+	executorOKWindows := func() *types.Executor {
+		e := executorOK.DeepCopy()
+		e.ID = "executorOKWindows"
+		e.OS = ctypes.OSWindows
+		return e
+	}()
+
 	executorOKAllowsPriviledContainers := func() *types.Executor {
 		e := executorOK.DeepCopy()
 		e.ID = "executorOKAllowsPrivilegedContainers"
@@ -606,6 +716,13 @@ func TestChooseExecutor(t *testing.T) {
 		return e
 	}()
 
+	executorOKWithGPUs := func() *types.Executor {
+		e := executorOK.DeepCopy()
+		e.ID = "executorOKWithGPUs"
+		e.GPUs = []*types.ExecutorGPUs{{Type: "tesla-t4", Count: 2}}
+		return e
+	}()
+
 	// Only primary and the required variables for this test are set
 	rct := &types.RunConfigTask{
 		ID:   "task01",
@@ -615,6 +732,15 @@ func TestChooseExecutor(t *testing.T) {
 		},
 	}
 
+	rctWindows := &types.RunConfigTask{
+		ID:   "task01",
+		Name: "task01",
+		Runtime: &types.Runtime{Type: types.RuntimeType("pod"),
+			OS:   ctypes.OSWindows,
+			Arch: ctypes.ArchAMD64,
+		},
+	}
+
 	rctWithPrivilegedContainers := &types.RunConfigTask{
 		ID:   "task01",
 		Name: "task01",
@@ -628,11 +754,35 @@ func TestChooseExecutor(t *testing.T) {
 		},
 	}
 
+	rctWithDockerDaemon := &types.RunConfigTask{
+		ID:   "task01",
+		Name: "task01",
+		Runtime: &types.Runtime{Type: types.RuntimeType("pod"),
+			Arch:   ctypes.ArchAMD64,
+			Docker: &types.DockerDaemon{},
+		},
+	}
+
+	rctWithGPUs := func(count int, gpuType string) *types.RunConfigTask {
+		return &types.RunConfigTask{
+			ID:   "task01",
+			Name: "task01",
+			Runtime: &types.Runtime{Type: types.RuntimeType("pod"),
+				Arch: ctypes.ArchAMD64,
+				GPUs: &types.GPUs{Count: count, Type: gpuType},
+			},
+		}
+	}
+
 	tests := []struct {
-		name      string
-		executors []*types.Executor
-		rct       *types.RunConfigTask
-		out       *types.Executor
+		name              string
+		executors         []*types.Executor
+		executorGPUsCount map[string]map[string]int
+		pinnedExecutorID  string
+		rct               *types.RunConfigTask
+		out               *types.Executor
+		gpuType           string
+		reason            string
 	}{
 		{
 			name:      "test single executor ok",
@@ -645,14 +795,29 @@ func TestChooseExecutor(t *testing.T) {
 			name:      "test single executor without free task slots",
 			executors: []*types.Executor{executorNoFreeTaskSlots},
 			// Only primary and the required variables for this test are set
-			rct: rct,
-			out: nil,
+			rct:    rct,
+			out:    nil,
+			reason: "all the executors reached their active tasks limit",
 		},
 		{
 			name:      "test single executor not alive",
 			executors: []*types.Executor{executorNotAlive},
 			rct:       rct,
 			out:       nil,
+			reason:    "no active executors",
+		},
+		{
+			name:      "test single executor draining",
+			executors: []*types.Executor{executorDraining},
+			rct:       rct,
+			out:       nil,
+			reason:    "no active executors",
+		},
+		{
+			name:      "test multiple executors with one draining",
+			executors: []*types.Executor{executorDraining, executorOK},
+			rct:       rct,
+			out:       executorOK,
 		},
 		{
 			name: "test single executor with different arch",
@@ -661,8 +826,41 @@ func TestChooseExecutor(t *testing.T) {
 				e.Archs = []ctypes.Arch{ctypes.ArchARM64}
 				return []*types.Executor{e}
 			}(),
-			rct: rct,
-			out: nil,
+			rct:    rct,
+			out:    nil,
+			reason: `no active executors supporting arch "amd64"`,
+		},
+		{
+			name: "test multiple executors with different archs and no free task slots on the executor with the required arch",
+			executors: func() []*types.Executor {
+				e := executorOK.DeepCopy()
+				e.ID = "executorARM64"
+				e.Archs = []ctypes.Arch{ctypes.ArchARM64}
+				return []*types.Executor{e, executorNoFreeTaskSlots}
+			}(),
+			rct:    rct,
+			out:    nil,
+			reason: "all the executors reached their active tasks limit",
+		},
+		{
+			name:      "test single windows executor and linux task",
+			executors: []*types.Executor{executorOKWindows},
+			rct:       rct,
+			out:       nil,
+			reason:    `no active executors supporting os "linux"`,
+		},
+		{
+			name:      "test single linux executor and windows task",
+			executors: []*types.Executor{executorOK},
+			rct:       rctWindows,
+			out:       nil,
+			reason:    `no active executors supporting os "windows"`,
+		},
+		{
+			name:      "test multiple executors and one matches the task required os",
+			executors: []*types.Executor{executorOK, executorOKWindows},
+			rct:       rctWindows,
+			out:       executorOKWindows,
 		},
 		{
 			name:      "test single executor with multiple archs and one matches the task required arch",
@@ -675,6 +873,7 @@ func TestChooseExecutor(t *testing.T) {
 			executors: []*types.Executor{executorOK},
 			rct:       rctWithPrivilegedContainers,
 			out:       nil,
+			reason:    "no active executors allowing privileged containers",
 		},
 		{
 			name:      "test single executor with allowed privileged container and privileged containers are required",
@@ -682,11 +881,83 @@ func TestChooseExecutor(t *testing.T) {
 			rct:       rctWithPrivilegedContainers,
 			out:       executorOKAllowsPriviledContainers,
 		},
+		{
+			name:      "test single executor without allowed privileged container but a docker daemon is required",
+			executors: []*types.Executor{executorOK},
+			rct:       rctWithDockerDaemon,
+			out:       nil,
+			reason:    "no active executors allowing privileged containers",
+		},
+		{
+			name:      "test single executor without gpus but gpus are required",
+			executors: []*types.Executor{executorOK},
+			rct:       rctWithGPUs(1, ""),
+			out:       nil,
+			reason:    "no active executors providing the requested gpus",
+		},
+		{
+			name:      "test multiple executors and one provides the required gpus",
+			executors: []*types.Executor{executorOK, executorOKWithGPUs},
+			rct:       rctWithGPUs(1, ""),
+			out:       executorOKWithGPUs,
+			gpuType:   "tesla-t4",
+		},
+		{
+			name:      "test single executor providing gpus of a different type",
+			executors: []*types.Executor{executorOKWithGPUs},
+			rct:       rctWithGPUs(1, "tesla-v100"),
+			out:       nil,
+			reason:    "no active executors providing the requested gpus",
+		},
+		{
+			name:      "test single executor providing less gpus than required",
+			executors: []*types.Executor{executorOKWithGPUs},
+			rct:       rctWithGPUs(3, "tesla-t4"),
+			out:       nil,
+			reason:    "no active executors providing the requested gpus",
+		},
+		{
+			name:              "test single executor with the required gpus in use",
+			executors:         []*types.Executor{executorOKWithGPUs},
+			executorGPUsCount: map[string]map[string]int{"executorOKWithGPUs": {"tesla-t4": 1}},
+			rct:               rctWithGPUs(2, "tesla-t4"),
+			out:               nil,
+			reason:            "all the executors providing the requested gpus have them in use",
+		},
+		{
+			name:             "test pinned executor",
+			executors:        []*types.Executor{executorOK, executorOKMultipleArchs},
+			pinnedExecutorID: "executorOKMultipleArchs",
+			rct:              rct,
+			out:              executorOKMultipleArchs,
+		},
+		{
+			name:             "test pinned executor not existing",
+			executors:        []*types.Executor{executorOK},
+			pinnedExecutorID: "executorNotExisting",
+			rct:              rct,
+			out:              nil,
+			reason:           `pinned executor "executorNotExisting" doesn't exist or isn't active`,
+		},
+		{
+			name:             "test pinned executor not alive",
+			executors:        []*types.Executor{executorOK, executorNotAlive},
+			pinnedExecutorID: "executorNotAlive",
+			rct:              rct,
+			out:              nil,
+			reason:           `pinned executor "executorNotAlive" doesn't exist or isn't active`,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			e := chooseExecutor(tt.executors, map[string]int{}, tt.rct)
+			e, gpuType, reason := chooseExecutor(tt.executors, map[string]int{}, tt.executorGPUsCount, tt.pinnedExecutorID, tt.rct)
+			if reason != tt.reason {
+				t.Fatalf("expected reason %q, got %q", tt.reason, reason)
+			}
+			if gpuType != tt.gpuType {
+				t.Fatalf("expected gpu type %q, got %q", tt.gpuType, gpuType)
+			}
 			if e == nil && tt.out == nil {
 				return
 			}
@@ -702,3 +973,52 @@ func TestChooseExecutor(t *testing.T) {
 		})
 	}
 }
+
+func TestSchedulerBackoff(t *testing.T) {
+	base := 2 * time.Second
+	maxBackoff := 10 * time.Second
+
+	tests := []struct {
+		name       string
+		cur        time.Duration
+		maxBackoff time.Duration
+		conflicts  bool
+		out        time.Duration
+	}{
+		{
+			name:       "test no conflicts",
+			cur:        8 * time.Second,
+			maxBackoff: maxBackoff,
+			out:        base,
+		},
+		{
+			name:       "test conflicts doubles interval",
+			cur:        base,
+			maxBackoff: maxBackoff,
+			conflicts:  true,
+			out:        4 * time.Second,
+		},
+		{
+			name:       "test conflicts interval limited to max backoff",
+			cur:        8 * time.Second,
+			maxBackoff: maxBackoff,
+			conflicts:  true,
+			out:        maxBackoff,
+		},
+		{
+			name:      "test conflicts with backoff disabled",
+			cur:       base,
+			conflicts: true,
+			out:       base,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := schedulerBackoff(tt.cur, base, tt.maxBackoff, tt.conflicts)
+			if out != tt.out {
+				t.Fatalf("wrong interval, expected %s, got: %s", tt.out, out)
+			}
+		})
+	}
+}
@@ -37,6 +37,10 @@ const (
 	MaxChangegroupNameLength = 256
 )
 
+// ErrRunModified is returned when a run wasn't updated since it was
+// concurrently modified
+var ErrRunModified = errors.New("run modified")
+
 func OSTUpdateRunCounterAction(ctx context.Context, c uint64, group string) (*datamanager.Action, error) {
 	// use the first group dir after the root
 	pl := util.PathList(group)
@@ -83,6 +87,14 @@ func OSTRunTaskLogsRunPath(rtID, runID string) string {
 	return path.Join(OSTRunTaskLogsRunsDir(rtID), runID)
 }
 
+func OSTWebhookDeliveriesDir(projectID string) string {
+	return path.Join("webhookdeliveries", projectID)
+}
+
+func OSTWebhookDeliveryPath(projectID, deliveryID string) string {
+	return path.Join(OSTWebhookDeliveriesDir(projectID), deliveryID)
+}
+
 func OSTArchivesBaseDir() string {
 	return "workspacearchives"
 }
@@ -163,6 +175,36 @@ func OSTSaveRunConfigAction(rc *types.RunConfig) (*datamanager.Action, error) {
 	return action, nil
 }
 
+// PreviewEnvironmentID returns the id of the preview environment with the
+// provided name of a run group
+func PreviewEnvironmentID(group, name string) string {
+	return util.EncodeSha256Hex(path.Join(group, name))
+}
+
+func OSTSavePreviewEnvironmentAction(env *types.PreviewEnvironment) (*datamanager.Action, error) {
+	envj, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+
+	action := &datamanager.Action{
+		ActionType: datamanager.ActionTypePut,
+		DataType:   string(common.DataTypePreviewEnvironment),
+		ID:         env.ID,
+		Data:       envj,
+	}
+
+	return action, nil
+}
+
+func OSTDeletePreviewEnvironmentAction(id string) *datamanager.Action {
+	return &datamanager.Action{
+		ActionType: datamanager.ActionTypeDelete,
+		DataType:   string(common.DataTypePreviewEnvironment),
+		ID:         id,
+	}
+}
+
 func OSTGetRun(dm *datamanager.DataManager, runID string) (*types.Run, error) {
 	rf, _, err := dm.ReadObject(string(common.DataTypeRun), runID, nil)
 	if err != nil {
@@ -319,6 +361,34 @@ func GetExecutorTasksCountByExecutor(ctx context.Context, e *etcd.Store) (map[st
 	return count, nil
 }
 
+// GetExecutorTasksGPUsByExecutor returns, for every executor, the number of
+// gpus assigned to its executor tasks grouped by gpu type
+func GetExecutorTasksGPUsByExecutor(ctx context.Context, e *etcd.Store) (map[string]map[string]int, error) {
+	// TODO(sgotti) use paged List
+	resp, err := e.List(ctx, common.EtcdTasksDir, "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	gpus := map[string]map[string]int{}
+
+	for _, kv := range resp.Kvs {
+		var et *types.ExecutorTask
+		if err := json.Unmarshal(kv.Value, &et); err != nil {
+			return nil, err
+		}
+		if et.Spec.GPUs == nil {
+			continue
+		}
+		if _, ok := gpus[et.Spec.ExecutorID]; !ok {
+			gpus[et.Spec.ExecutorID] = map[string]int{}
+		}
+		gpus[et.Spec.ExecutorID][et.Spec.GPUs.Type] += et.Spec.GPUs.Count
+	}
+
+	return gpus, nil
+}
+
 func GetExecutorTasksForExecutor(ctx context.Context, e *etcd.Store, executorID string) ([]*types.ExecutorTask, error) {
 	// TODO(sgotti) use paged List
 	resp, err := e.List(ctx, common.EtcdTasksDir, "", 0)
@@ -426,7 +496,7 @@ func AtomicPutRun(ctx context.Context, e *etcd.Store, r *types.Run, runEvent *ty
 	if err != etcd.ErrKeyNotFound {
 		if curRun.Revision != r.Revision {
 			// fast fail path if the run was already updated
-			return nil, errors.Errorf("run modified")
+			return nil, ErrRunModified
 		}
 		if reflect.DeepEqual(curRun, r) {
 			return curRun, nil
@@ -487,7 +557,7 @@ func AtomicPutRun(ctx context.Context, e *etcd.Store, r *types.Run, runEvent *ty
 		if hasOptimisticLocking {
 			return nil, errors.Errorf("optimistic locking failed")
 		}
-		return nil, errors.Errorf("run modified")
+		return nil, ErrRunModified
 	}
 
 	r.Revision = tresp.Responses[0].GetResponsePut().Header.Revision
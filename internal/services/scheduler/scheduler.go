@@ -20,12 +20,14 @@ import (
 	"fmt"
 	"time"
 
+	scommon "agola.io/agola/internal/common"
 	slog "agola.io/agola/internal/log"
 	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/config"
 	"agola.io/agola/internal/util"
 	rsapitypes "agola.io/agola/services/runservice/api/types"
 	rsclient "agola.io/agola/services/runservice/client"
+	rstypes "agola.io/agola/services/runservice/types"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -52,6 +54,16 @@ func (s *Scheduler) scheduleLoop(ctx context.Context) {
 }
 
 func (s *Scheduler) schedule(ctx context.Context) error {
+	// while the scheduling is paused keep the runs queued
+	schedulingStatus, _, err := s.runserviceClient.GetSchedulingStatus(ctx)
+	if err != nil {
+		return errors.Errorf("failed to get scheduling status: %w", err)
+	}
+	if schedulingStatus.Paused {
+		log.Debugf("scheduling paused, not starting queued runs")
+		return nil
+	}
+
 	// create a list of project and users with queued runs
 	groups := map[string]struct{}{}
 
@@ -94,6 +106,19 @@ func (s *Scheduler) scheduleRun(ctx context.Context, groupID string) error {
 
 	run := queuedRunsResponse.Runs[0]
 
+	// the run will be started by a next iteration when its upstream runs
+	// successfully finish (or cancelled by the runservice if they fail)
+	if len(run.DependsOn) > 0 {
+		waiting, err := s.runWaitingUpstream(ctx, run.DependsOn)
+		if err != nil {
+			return errors.Errorf("failed to get run %q upstream runs: %w", run.ID, err)
+		}
+		if waiting {
+			log.Debugf("run %s waiting on upstream runs", run.ID)
+			return nil
+		}
+	}
+
 	changegroup := util.EncodeSha256Hex(fmt.Sprintf("changegroup-%s", groupID))
 	runningRunsResponse, _, err := s.runserviceClient.GetGroupRunningRuns(ctx, groupID, 1, []string{changegroup})
 	if err != nil {
@@ -110,6 +135,22 @@ func (s *Scheduler) scheduleRun(ctx context.Context, groupID string) error {
 	return nil
 }
 
+// runWaitingUpstream reports if one of the upstream runs isn't successfully
+// finished
+func (s *Scheduler) runWaitingUpstream(ctx context.Context, upstreamRunIDs []string) (bool, error) {
+	for _, upstreamRunID := range upstreamRunIDs {
+		runResponse, _, err := s.runserviceClient.GetRun(ctx, upstreamRunID, nil)
+		if err != nil {
+			return false, err
+		}
+		r := runResponse.Run
+		if r.Phase != rstypes.RunPhaseFinished || r.Result != rstypes.RunResultSuccess {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func (s *Scheduler) approveLoop(ctx context.Context) {
 	for {
 		if err := s.approve(ctx); err != nil {
@@ -177,10 +218,19 @@ func (s *Scheduler) approveRunTasks(ctx context.Context, runID string) error {
 		if err := json.Unmarshal([]byte(approversAnnotation), &approvers); err != nil {
 			return errors.Errorf("failed to unmarshal run task approvers annotation: %w", err)
 		}
-		// TODO(sgotti) change when we introduce a config the set the minimum number of required approvers
-		if len(approvers) > 0 {
+		// a task targeting a deploy environment requires its number of
+		// approvals from its allowed approvers
+		requiredApprovals := 1
+		if rct, ok := runResp.RunConfig.Tasks[rt.ID]; ok && rct.DeployEnvironment != nil {
+			approvers = rct.DeployEnvironment.ValidApprovers(approvers)
+			if rct.DeployEnvironment.RequiredApprovals > requiredApprovals {
+				requiredApprovals = rct.DeployEnvironment.RequiredApprovals
+			}
+		}
+		if len(approvers) >= requiredApprovals {
 			rsreq := &rsapitypes.RunTaskActionsRequest{
 				ActionType:              rsapitypes.RunTaskActionTypeApprove,
+				Approvers:               approvers,
 				ChangeGroupsUpdateToken: runResp.ChangeGroupsUpdateToken,
 			}
 			if _, err := s.runserviceClient.RunTaskActions(ctx, run.ID, rt.ID, rsreq); err != nil {
@@ -206,12 +256,29 @@ func NewScheduler(ctx context.Context, l *zap.Logger, c *config.Scheduler) (*Sch
 	}
 	log = logger.Sugar()
 
+	runserviceHTTPClient, err := scommon.NewHTTPClient(c.RunserviceTLS)
+	if err != nil {
+		return nil, errors.Errorf("failed to create runservice http client: %w", err)
+	}
+	runserviceClient := rsclient.NewClient(c.RunserviceURL)
+	runserviceClient.SetHTTPClient(runserviceHTTPClient)
+
 	return &Scheduler{
 		c:                c,
-		runserviceClient: rsclient.NewClient(c.RunserviceURL),
+		runserviceClient: runserviceClient,
 	}, nil
 }
 
+// Reload applies the scheduler config changes that don't require a restart.
+// Currently only the log level.
+func (s *Scheduler) Reload(c *config.Scheduler) {
+	if c.Debug {
+		level.SetLevel(zapcore.DebugLevel)
+	} else {
+		level.SetLevel(zapcore.InfoLevel)
+	}
+}
+
 func (s *Scheduler) Run(ctx context.Context) error {
 	go s.scheduleLoop(ctx)
 	go s.approveLoop(ctx)
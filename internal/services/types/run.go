@@ -34,4 +34,6 @@ type RunCreationTriggerType string
 const (
 	RunCreationTriggerTypeWebhook RunCreationTriggerType = "webhook"
 	RunCreationTriggerTypeManual  RunCreationTriggerType = "manual"
+	RunCreationTriggerTypeRestart RunCreationTriggerType = "restart"
+	RunCreationTriggerTypeRun     RunCreationTriggerType = "run"
 )
@@ -20,6 +20,9 @@ const (
 	WebhookEventPush        WebhookEvent = "push"
 	WebhookEventTag         WebhookEvent = "tag"
 	WebhookEventPullRequest WebhookEvent = "pull_request"
+	// WebhookEventPullRequestClosed is sent when a pull request is closed or
+	// merged
+	WebhookEventPullRequestClosed WebhookEvent = "pull_request_closed"
 )
 
 type WebhookData struct {
@@ -34,6 +37,11 @@ type WebhookData struct {
 	Sender      string `json:"sender,omitempty"`
 	Avatar      string `json:"avatar,omitempty"`
 
+	// commit metadata, provided only when reported by the webhook payload
+	CommitMessage     string `json:"commit_message,omitempty"`
+	CommitAuthorName  string `json:"commit_author_name,omitempty"`
+	CommitAuthorEmail string `json:"commit_author_email,omitempty"`
+
 	Branch     string `json:"branch,omitempty"`
 	BranchLink string `json:"branch_link,omitempty"`
 
@@ -44,6 +52,11 @@ type WebhookData struct {
 	PullRequestID   string `json:"pull_request_id,omitempty"`
 	PullRequestLink string `json:"link,omitempty"` // Link to pull request
 	PRFromSameRepo  bool   `json:"pr_from_same_repo,omitempty"`
+	// PRAuthor is the git source identifier (username or id) of the pull
+	// request author
+	PRAuthor string `json:"pr_author,omitempty"`
+	// PRBaseBranch is the pull request target branch
+	PRBaseBranch string `json:"pr_base_branch,omitempty"`
 
 	Repo WebhookDataRepo `json:"repo,omitempty"`
 }
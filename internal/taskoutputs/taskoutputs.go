@@ -0,0 +1,121 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package taskoutputs handles the task outputs: named string values set by a
+// task steps and referenced by its dependent tasks as
+// ${tasks.<taskname>.outputs.<name>}.
+package taskoutputs
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+	"unicode"
+
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// EnvVar is the environment variable containing the path of the file
+	// where the steps write the task outputs, one "name=value" per line
+	EnvVar = "AGOLA_OUTPUTS"
+
+	// MaxSize is the max size of the task outputs file
+	MaxSize = 16 * 1024
+	// MaxOutputs is the max number of task outputs
+	MaxOutputs = 64
+)
+
+var (
+	nameRegexp      = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+	referenceRegexp = regexp.MustCompile(`\$\{tasks\.([^.}]+)\.outputs\.([a-zA-Z_][a-zA-Z0-9_-]*)\}`)
+)
+
+// Reference is a reference to an output of a task
+type Reference struct {
+	TaskName string
+	Name     string
+}
+
+// Parse parses the task outputs file content. Every line is a "name=value"
+// output, empty lines and lines starting with "#" are ignored. When the same
+// output is set multiple times the last value is kept. Non printable
+// characters are removed from the values.
+func Parse(data []byte) (map[string]string, error) {
+	if len(data) > MaxSize {
+		return nil, errors.Errorf("outputs size exceeds the max size of %d bytes", MaxSize)
+	}
+
+	outputs := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		l := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(l) == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(l, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("line %d: expected name=value", line)
+		}
+		name := strings.TrimSpace(parts[0])
+		if !nameRegexp.MatchString(name) {
+			return nil, errors.Errorf("line %d: invalid output name %q", line, name)
+		}
+		outputs[name] = sanitize(parts[1])
+
+		if len(outputs) > MaxOutputs {
+			return nil, errors.Errorf("more than %d outputs", MaxOutputs)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return outputs, nil
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// References returns the task outputs referenced in s
+func References(s string) []Reference {
+	var refs []Reference
+	for _, m := range referenceRegexp.FindAllStringSubmatch(s, -1) {
+		refs = append(refs, Reference{TaskName: m[1], Name: m[2]})
+	}
+	return refs
+}
+
+// Expand replaces the task outputs references in s with their value. outputs
+// are the outputs of every task by task name. A reference to an output not
+// set is replaced with an empty string.
+func Expand(s string, outputs map[string]map[string]string) string {
+	if !strings.Contains(s, "${tasks.") {
+		return s
+	}
+	return referenceRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		m := referenceRegexp.FindStringSubmatch(ref)
+		return outputs[m[1]][m[2]]
+	})
+}
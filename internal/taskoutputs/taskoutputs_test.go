@@ -0,0 +1,135 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package taskoutputs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		out     map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			in:   "",
+			out:  map[string]string{},
+		},
+		{
+			name: "outputs",
+			in:   "tag=v1.0.0\n\n# comment\ndigest = sha256:abcd\r\nempty=\nurl=http://example.com/?a=b\n",
+			out: map[string]string{
+				"tag":    "v1.0.0",
+				"digest": " sha256:abcd",
+				"empty":  "",
+				"url":    "http://example.com/?a=b",
+			},
+		},
+		{
+			name: "last value wins",
+			in:   "tag=v1\ntag=v2\n",
+			out:  map[string]string{"tag": "v2"},
+		},
+		{
+			name: "non printable characters are removed",
+			in:   "tag=v1\x1b[31m\x00\tred\n",
+			out:  map[string]string{"tag": "v1[31m\tred"},
+		},
+		{
+			name:    "missing value",
+			in:      "tag\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid name",
+			in:      "my.tag=v1\n",
+			wantErr: true,
+		},
+		{
+			name:    "too big",
+			in:      "tag=" + strings.Repeat("a", MaxSize),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Parse([]byte(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if diff := cmp.Diff(tt.out, out); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	outputs := map[string]map[string]string{
+		"build": {"tag": "v1.0.0"},
+		"test":  {"report-url": "http://example.com"},
+	}
+
+	tests := []struct {
+		in   string
+		out  string
+		refs []Reference
+	}{
+		{
+			in:  "docker push image:${tasks.build.outputs.tag}",
+			out: "docker push image:v1.0.0",
+			refs: []Reference{
+				{TaskName: "build", Name: "tag"},
+			},
+		},
+		{
+			in:  "${tasks.build.outputs.tag} ${tasks.test.outputs.report-url} ${tasks.build.outputs.missing}",
+			out: "v1.0.0 http://example.com ",
+			refs: []Reference{
+				{TaskName: "build", Name: "tag"},
+				{TaskName: "test", Name: "report-url"},
+				{TaskName: "build", Name: "missing"},
+			},
+		},
+		{
+			in:  "echo ${HOME} $tasks ${tasks.build}",
+			out: "echo ${HOME} $tasks ${tasks.build}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if out := Expand(tt.in, outputs); out != tt.out {
+				t.Errorf("expected %q, got %q", tt.out, out)
+			}
+			if diff := cmp.Diff(tt.refs, References(tt.in)); diff != "" {
+				t.Error(diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	exporterTimeout = 10 * time.Second
+
+	otlpTracesPath = "/v1/traces"
+
+	// OTLP status code error
+	otlpStatusCodeError = 2
+)
+
+// exporter is an sdktrace.SpanExporter that sends the spans to an OTLP/HTTP
+// collector using the OTLP JSON encoding.
+//
+// The upstream OTLP exporters aren't used since they require a grpc version
+// incompatible with the one required by the etcd client.
+type exporter struct {
+	url    string
+	client *http.Client
+}
+
+func newExporter(endpoint string) (*exporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Errorf("failed to parse tracing endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("wrong tracing endpoint %q: unsupported scheme %q", endpoint, u.Scheme)
+	}
+	u.Path = path.Join(u.Path, otlpTracesPath)
+
+	return &exporter{
+		url:    u.String(),
+		client: &http.Client{Timeout: exporterTimeout},
+	}, nil
+}
+
+func (e *exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(genOTLPRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return errors.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("failed to export spans: received http status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *exporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []*otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []*otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func genOTLPKeyValues(attrs []attribute.KeyValue) []*otlpKeyValue {
+	kvs := make([]*otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v otlpAnyValue
+		switch a.Value.Type() {
+		case attribute.BOOL:
+			b := a.Value.AsBool()
+			v.BoolValue = &b
+		case attribute.INT64:
+			i := strconv.FormatInt(a.Value.AsInt64(), 10)
+			v.IntValue = &i
+		case attribute.FLOAT64:
+			f := a.Value.AsFloat64()
+			v.DoubleValue = &f
+		default:
+			s := a.Value.Emit()
+			v.StringValue = &s
+		}
+		kvs = append(kvs, &otlpKeyValue{Key: string(a.Key), Value: v})
+	}
+	return kvs
+}
+
+func genOTLPRequest(spans []sdktrace.ReadOnlySpan) *otlpTracesRequest {
+	// all the spans come from the same tracer provider and share the same
+	// resource
+	rs := &otlpResourceSpans{}
+	if res := spans[0].Resource(); res != nil {
+		rs.Resource.Attributes = genOTLPKeyValues(res.Attributes())
+	}
+
+	scopes := map[string]*otlpScopeSpans{}
+	for _, s := range spans {
+		lib := s.InstrumentationLibrary()
+		ss, ok := scopes[lib.Name]
+		if !ok {
+			ss = &otlpScopeSpans{Scope: otlpScope{Name: lib.Name, Version: lib.Version}}
+			scopes[lib.Name] = ss
+			rs.ScopeSpans = append(rs.ScopeSpans, ss)
+		}
+
+		sc := s.SpanContext()
+		ospan := &otlpSpan{
+			TraceID:           sc.TraceID().String(),
+			SpanID:            sc.SpanID().String(),
+			Name:              s.Name(),
+			Kind:              int(s.SpanKind()),
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime().UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime().UnixNano(), 10),
+			Attributes:        genOTLPKeyValues(s.Attributes()),
+		}
+		if parent := s.Parent(); parent.HasSpanID() {
+			ospan.ParentSpanID = parent.SpanID().String()
+		}
+		if status := s.Status(); status.Code == codes.Error {
+			ospan.Status = &otlpStatus{Code: otlpStatusCodeError, Message: status.Description}
+		}
+
+		ss.Spans = append(ss.Spans, ospan)
+	}
+
+	return &otlpTracesRequest{
+		ResourceSpans: []*otlpResourceSpans{rs},
+	}
+}
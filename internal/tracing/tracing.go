@@ -0,0 +1,158 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing configures the OpenTelemetry SDK tracer provider and
+// provides small helpers to create spans.
+//
+// Spans are propagated inside a process using the context and between
+// services using the W3C trace context "traceparent" header. Sampled spans are
+// exported to an OTLP/HTTP collector.
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"agola.io/agola/internal/services/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	errors "golang.org/x/xerrors"
+)
+
+const (
+	// TraceParentHeader is the W3C trace context header
+	TraceParentHeader = "traceparent"
+
+	instrumentationName = "agola.io/agola"
+)
+
+var propagator = propagation.TraceContext{}
+
+// ContextWithTraceParent returns a context containing the remote span context
+// defined by the provided W3C traceparent. If the traceparent is empty or
+// invalid the context is returned unchanged.
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+	header := http.Header{}
+	header.Set(TraceParentHeader, traceParent)
+	return Extract(ctx, header)
+}
+
+// TraceParentFromContext returns the W3C traceparent of the span context
+// inside the context or an empty string if there isn't one.
+func TraceParentFromContext(ctx context.Context) string {
+	header := http.Header{}
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+	return header.Get(TraceParentHeader)
+}
+
+// Extract returns a context containing the remote span context defined by the
+// traceparent header
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Span is a traced operation
+type Span struct {
+	span trace.Span
+}
+
+// SetAttribute sets a span attribute
+func (s *Span) SetAttribute(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+// SetError marks the span as failed with the provided error. A nil error
+// is ignored.
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span
+func (s *Span) End() {
+	s.span.End()
+}
+
+// Setup configures the global tracer provider. If the tracing endpoint isn't
+// defined tracing is disabled and all the spans are no-op.
+// The tracer provider is shut down, exporting the pending spans, when the
+// context is done.
+func Setup(ctx context.Context, logger *zap.Logger, c *config.Tracing) error {
+	if c.Endpoint == "" {
+		return nil
+	}
+	if c.SamplingRatio < 0 || c.SamplingRatio > 1 {
+		return errors.Errorf("wrong sampling ratio %f", c.SamplingRatio)
+	}
+
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = "agola"
+	}
+
+	ex, err := newExporter(c.Endpoint)
+	if err != nil {
+		return err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(ex),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SamplingRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+
+	log := logger.Sugar()
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Warnf("tracing error: %+v", err)
+	}))
+	otel.SetTracerProvider(tp)
+
+	go func() {
+		<-ctx.Done()
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Warnf("failed to shutdown tracer provider: %+v", err)
+		}
+	}()
+
+	return nil
+}
+
+// StartSpan starts a new span child of the span context inside the context (if
+// any) and returns a context containing the new span.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	return StartSpanWithTime(ctx, name, time.Now())
+}
+
+// StartSpanWithTime is like StartSpan but with a custom start time. It's used
+// to create spans for operations started before they could be traced (i.e.
+// the time a task waited to be scheduled).
+func StartSpanWithTime(ctx context.Context, name string, startTime time.Time) (context.Context, *Span) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, trace.WithTimestamp(startTime))
+	return ctx, &Span{span: span}
+}
@@ -0,0 +1,146 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"agola.io/agola/internal/services/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestTraceParent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			name: "sampled",
+			in:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			out:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			name: "not sampled",
+			in:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			out:  "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		{
+			name: "empty",
+		},
+		{
+			name: "wrong version",
+			in:   "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			name: "zero trace id",
+			in:   "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		},
+		{
+			name: "short span id",
+			in:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := ContextWithTraceParent(context.Background(), tt.in)
+			out := TraceParentFromContext(ctx)
+			if out != tt.out {
+				t.Fatalf("expected traceparent %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	reqCh := make(chan *otlpTracesRequest, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != otlpTracesPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var req *otlpTracesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reqCh <- req
+	}))
+	defer ts.Close()
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// no tracer provider: spans are no-op
+	nctx, span := StartSpan(ctx, "noop")
+	span.SetAttribute("key", "value")
+	span.End()
+	if TraceParentFromContext(nctx) != "" {
+		t.Fatalf("expected empty traceparent")
+	}
+
+	if err := Setup(ctx, logger, &config.Tracing{Endpoint: ts.URL, SamplingRatio: 1}); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	pctx, parent := StartSpan(ctx, "parent")
+
+	// simulate a remote service
+	rctx := ContextWithTraceParent(context.Background(), TraceParentFromContext(pctx))
+	_, child := StartSpan(rctx, "child")
+	child.SetAttribute("key", "value")
+	child.End()
+	parent.End()
+
+	// flush the spans
+	cancel()
+
+	select {
+	case req := <-reqCh:
+		spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+		if len(spans) != 2 {
+			t.Fatalf("expected 2 spans, got %d", len(spans))
+		}
+		if spans[0].Name != "child" || spans[1].Name != "parent" {
+			t.Fatalf("unexpected spans order: %q, %q", spans[0].Name, spans[1].Name)
+		}
+		if spans[0].TraceID != spans[1].TraceID {
+			t.Fatalf("expected same trace id, got %q, %q", spans[0].TraceID, spans[1].TraceID)
+		}
+		if spans[0].ParentSpanID != spans[1].SpanID {
+			t.Fatalf("expected parent span id %q, got %q", spans[1].SpanID, spans[0].ParentSpanID)
+		}
+		if spans[1].ParentSpanID != "" {
+			t.Fatalf("expected empty parent span id, got %q", spans[1].ParentSpanID)
+		}
+		attrs := spans[0].Attributes
+		if len(attrs) != 1 || attrs[0].Key != "key" || attrs[0].Value.StringValue == nil || *attrs[0].Value.StringValue != "value" {
+			t.Fatalf("unexpected child span attributes: %v", attrs)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for exported spans")
+	}
+}
@@ -19,6 +19,9 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
+	"os"
+	"sync"
+	"time"
 )
 
 func NewTLSConfig(certFile, keyFile, caFile string, insecureSkipVerify bool) (*tls.Config, error) {
@@ -26,25 +29,10 @@ func NewTLSConfig(certFile, keyFile, caFile string, insecureSkipVerify bool) (*t
 
 	// Populate root CA certs
 	if caFile != "" {
-		pemBytes, err := ioutil.ReadFile(caFile)
+		roots, err := readCertPool(caFile)
 		if err != nil {
 			return nil, err
 		}
-		roots := x509.NewCertPool()
-
-		for {
-			var block *pem.Block
-			block, pemBytes = pem.Decode(pemBytes)
-			if block == nil {
-				break
-			}
-			cert, err := x509.ParseCertificate(block.Bytes)
-			if err != nil {
-				return nil, err
-			}
-			roots.AddCert(cert)
-		}
-
 		tlsConfig.RootCAs = roots
 	}
 
@@ -62,3 +50,139 @@ func NewTLSConfig(certFile, keyFile, caFile string, insecureSkipVerify bool) (*t
 
 	return &tlsConfig, nil
 }
+
+// NewTLSServerConfig returns the tls config of an https server. The key pair
+// is reloaded when its files change (i.e. when the certificate is rotated).
+// When clientCAFile is defined the client certificates are verified and, if
+// requireClientCert is true, required.
+func NewTLSServerConfig(certFile, keyFile, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	kp, err := newKeyPairReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return kp.keyPair()
+		},
+	}
+
+	if clientCAFile != "" {
+		clientCAs, err := readCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// NewTLSClientConfig returns the tls config of an https client. The optional
+// client key pair is reloaded when its files change.
+func NewTLSClientConfig(certFile, keyFile, caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if caFile != "" {
+		roots, err := readCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if certFile != "" && keyFile != "" {
+		kp, err := newKeyPairReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return kp.keyPair()
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func readCertPool(caFile string) (*x509.CertPool, error) {
+	pemBytes, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(cert)
+	}
+
+	return pool, nil
+}
+
+// keyPairReloader loads a tls key pair and reloads it when the certificate or
+// the key file modification time changes
+type keyPairReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func newKeyPairReloader(certFile, keyFile string) (*keyPairReloader, error) {
+	r := &keyPairReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.keyPair(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *keyPairReloader) keyPair() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var modTimes [2]time.Time
+	for i, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			// keep using the current key pair while the files are replaced
+			if r.cert != nil {
+				return r.cert, nil
+			}
+			return nil, err
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	if r.cert != nil && modTimes == r.modTimes {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		// the certificate and the key could be temporarily mismatched when
+		// they aren't replaced at the same time
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, err
+	}
+	r.cert = &cert
+	r.modTimes = modTimes
+
+	return r.cert, nil
+}
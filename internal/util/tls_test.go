@@ -0,0 +1,110 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestKeyPair(t *testing.T, certFile, keyFile, cn string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, modTime, modTime); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+}
+
+func keyPairCN(t *testing.T, r *keyPairReloader) string {
+	cert, err := r.keyPair()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	return c.Subject.CommonName
+}
+
+func TestKeyPairReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agola")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	now := time.Now()
+
+	writeTestKeyPair(t, certFile, keyFile, "cert01", now.Add(-time.Minute))
+	r, err := newKeyPairReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if cn := keyPairCN(t, r); cn != "cert01" {
+		t.Fatalf("expected cert01 certificate, got %q", cn)
+	}
+
+	// rotate the certificate
+	writeTestKeyPair(t, certFile, keyFile, "cert02", now)
+	if cn := keyPairCN(t, r); cn != "cert02" {
+		t.Fatalf("expected cert02 certificate, got %q", cn)
+	}
+
+	// keep the current key pair when the files are missing
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if cn := keyPairCN(t, r); cn != "cert02" {
+		t.Fatalf("expected cert02 certificate, got %q", cn)
+	}
+}
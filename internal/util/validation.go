@@ -23,6 +23,11 @@ import (
 
 var nameRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9]*([-]?[a-zA-Z0-9]+)+$`)
 
+var tagRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9._-]*[a-zA-Z0-9])?$`)
+
+// MaxTagLength is the max length of a tag
+const MaxTagLength = 64
+
 var (
 	ErrValidation = errors.New("validation error")
 )
@@ -35,3 +40,12 @@ func ValidateName(s string) bool {
 	}
 	return nameRegexp.MatchString(s)
 }
+
+// ValidateTag reports if s is a valid tag: alphanumeric characters, dots,
+// underscores and dashes, starting and ending with an alphanumeric character
+func ValidateTag(s string) bool {
+	if len(s) > MaxTagLength {
+		return false
+	}
+	return tagRegexp.MatchString(s)
+}
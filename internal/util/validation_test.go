@@ -14,7 +14,10 @@
 
 package util
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 var (
 	goodNames = []string{
@@ -65,3 +68,37 @@ func TestValidateName(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateTag(t *testing.T) {
+	goodTags := []string{
+		"a",
+		"1",
+		"release",
+		"hotfix-1",
+		"v1.2.3",
+		"nightly_build",
+		strings.Repeat("a", MaxTagLength),
+	}
+	badTags := []string{
+		"",
+		"-release",
+		"release-",
+		".release",
+		"release.",
+		"foo bar",
+		"foo/bar",
+		"foo#bar",
+		strings.Repeat("a", MaxTagLength+1),
+	}
+
+	for _, tag := range goodTags {
+		if !ValidateTag(tag) {
+			t.Errorf("expect valid tag for %q", tag)
+		}
+	}
+	for _, tag := range badTags {
+		if ValidateTag(tag) {
+			t.Errorf("expect invalid tag for %q", tag)
+		}
+	}
+}
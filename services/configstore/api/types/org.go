@@ -22,6 +22,11 @@ type AddOrgMemberRequest struct {
 	Role cstypes.MemberRole
 }
 
+type SetOrgSecretPolicyRequest struct {
+	// SecretPolicy is the new org secret policy. A nil policy removes it.
+	SecretPolicy *cstypes.SecretPolicy
+}
+
 type OrgMemberResponse struct {
 	User *cstypes.User
 	Role cstypes.MemberRole
@@ -0,0 +1,59 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "strings"
+
+const (
+	// PrincipalHeader is the header reporting the principal on behalf of
+	// which a request is made. When provided the configstore denies the access
+	// to the objects of the orgs and users not accessible by the principal.
+	// Requests without it (i.e. from the agola services) aren't restricted.
+	PrincipalHeader = "X-Agola-Principal"
+
+	// PrincipalAnonymous is the principal of not authenticated requests. It
+	// can only read the public objects.
+	PrincipalAnonymous = "anonymous"
+
+	principalUserPrefix    = "user/"
+	principalProjectPrefix = "project/"
+)
+
+// UserPrincipal returns the principal of the user with the provided id
+func UserPrincipal(userID string) string {
+	return principalUserPrefix + userID
+}
+
+// ProjectPrincipal returns the principal of a project api key. It can access
+// only its project and the project objects.
+func ProjectPrincipal(projectID string) string {
+	return principalProjectPrefix + projectID
+}
+
+// ParsePrincipal returns the user id or the project id of the provided
+// principal. Both are empty for the anonymous principal.
+func ParsePrincipal(principal string) (userID, projectID string, ok bool) {
+	switch {
+	case principal == PrincipalAnonymous:
+		return "", "", true
+	case strings.HasPrefix(principal, principalUserPrefix):
+		userID = strings.TrimPrefix(principal, principalUserPrefix)
+		return userID, "", userID != ""
+	case strings.HasPrefix(principal, principalProjectPrefix):
+		projectID = strings.TrimPrefix(principal, principalProjectPrefix)
+		return "", projectID, projectID != ""
+	}
+	return "", "", false
+}
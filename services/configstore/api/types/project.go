@@ -29,3 +29,11 @@ type Project struct {
 	ParentPath       string
 	GlobalVisibility cstypes.Visibility
 }
+
+type CreateProjectAPIKeyRequest struct {
+	APIKeyName string `json:"api_key_name"`
+}
+
+type CreateProjectAPIKeyResponse struct {
+	APIKey string `json:"api_key"`
+}
@@ -25,3 +25,12 @@ type Secret struct {
 	// dynamic data
 	ParentPath string
 }
+
+type SetSecretsRequest struct {
+	Secrets []*cstypes.Secret
+	Prune   bool
+}
+
+type UpdateSecretUsageRequest struct {
+	ProjectID string
+}
@@ -47,6 +47,7 @@ type UpdateUserLARequest struct {
 	Oauth2AccessToken          string    `json:"oauth2_access_token"`
 	Oauth2RefreshToken         string    `json:"oauth2_refresh_token"`
 	Oauth2AccessTokenExpiresAt time.Time `json:"oauth_2_access_token_expires_at"`
+	NeedsReauth                bool      `json:"needs_reauth"`
 }
 
 type CreateUserTokenRequest struct {
@@ -57,6 +58,23 @@ type CreateUserTokenResponse struct {
 	Token string `json:"token"`
 }
 
+type UpdateUserTokenLastUsedRequest struct {
+	LastUsedTime time.Time `json:"last_used_time"`
+}
+
+type CreateUserSessionRequest struct {
+	IdleTimeout     time.Duration `json:"idle_timeout"`
+	AbsoluteTimeout time.Duration `json:"absolute_timeout"`
+}
+
+type CreateUserSessionResponse struct {
+	SessionID string `json:"session_id"`
+}
+
+type UpdateUserSessionLastActivityRequest struct {
+	LastActivityTime time.Time `json:"last_activity_time"`
+}
+
 type UserOrgsResponse struct {
 	Organization *cstypes.Organization
 	Role         cstypes.MemberRole
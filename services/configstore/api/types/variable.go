@@ -25,3 +25,12 @@ type Variable struct {
 	// dynamic data
 	ParentPath string
 }
+
+type SetVariablesRequest struct {
+	Variables []*cstypes.Variable
+	Prune     bool
+}
+
+type UpdateVariableUsageRequest struct {
+	ProjectID string
+}
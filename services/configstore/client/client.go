@@ -25,6 +25,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	csapitypes "agola.io/agola/services/configstore/api/types"
 	"agola.io/agola/services/configstore/types"
@@ -53,6 +54,14 @@ func (c *Client) SetHTTPClient(client *http.Client) {
 	c.client = client
 }
 
+type principalKey struct{}
+
+// WithPrincipal returns a context that makes the client requests done with it
+// on behalf of the provided principal (see csapitypes.PrincipalHeader)
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
 func (c *Client) doRequest(ctx context.Context, method, path string, query url.Values, header http.Header, ibody io.Reader) (*http.Response, error) {
 	u, err := url.Parse(c.url + "/api/v1alpha" + path)
 	if err != nil {
@@ -68,6 +77,9 @@ func (c *Client) doRequest(ctx context.Context, method, path string, query url.V
 	for k, v := range header {
 		req.Header[k] = v
 	}
+	if principal, ok := ctx.Value(principalKey{}).(string); ok {
+		req.Header.Set(csapitypes.PrincipalHeader, principal)
+	}
 
 	return c.client.Do(req)
 }
@@ -157,6 +169,34 @@ func (c *Client) GetProject(ctx context.Context, projectRef string) (*csapitypes
 	return project, resp, err
 }
 
+func (c *Client) GetProjectByAPIKey(ctx context.Context, apiKey string) (*csapitypes.Project, *http.Response, error) {
+	q := url.Values{}
+	q.Add("query_type", "byapikey")
+	q.Add("apikey", apiKey)
+
+	projects := []*csapitypes.Project{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/projects", q, jsonContent, nil, &projects)
+	if err != nil {
+		return nil, resp, err
+	}
+	return projects[0], resp, err
+}
+
+func (c *Client) CreateProjectAPIKey(ctx context.Context, projectRef string, req *csapitypes.CreateProjectAPIKeyRequest) (*csapitypes.CreateProjectAPIKeyResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aresp := new(csapitypes.CreateProjectAPIKeyResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projects/%s/apikeys", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), aresp)
+	return aresp, resp, err
+}
+
+func (c *Client) DeleteProjectAPIKey(ctx context.Context, projectRef, apiKeyName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/apikeys/%s", url.PathEscape(projectRef), apiKeyName), nil, jsonContent, nil)
+}
+
 func (c *Client) CreateProject(ctx context.Context, project *cstypes.Project) (*csapitypes.Project, *http.Response, error) {
 	pj, err := json.Marshal(project)
 	if err != nil {
@@ -257,6 +297,42 @@ func (c *Client) DeleteProjectSecret(ctx context.Context, projectRef, secretName
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/secrets/%s", url.PathEscape(projectRef), secretName), nil, jsonContent, nil)
 }
 
+func (c *Client) SetProjectGroupSecrets(ctx context.Context, projectGroupRef string, req *csapitypes.SetSecretsRequest) ([]*csapitypes.SetResult, *http.Response, error) {
+	return c.setSecrets(ctx, fmt.Sprintf("/projectgroups/%s/secrets", url.PathEscape(projectGroupRef)), req)
+}
+
+func (c *Client) SetProjectSecrets(ctx context.Context, projectRef string, req *csapitypes.SetSecretsRequest) ([]*csapitypes.SetResult, *http.Response, error) {
+	return c.setSecrets(ctx, fmt.Sprintf("/projects/%s/secrets", url.PathEscape(projectRef)), req)
+}
+
+func (c *Client) setSecrets(ctx context.Context, path string, req *csapitypes.SetSecretsRequest) ([]*csapitypes.SetResult, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []*csapitypes.SetResult{}
+	resp, err := c.getParsedResponse(ctx, "PUT", path, nil, jsonContent, bytes.NewReader(reqj), &results)
+	return results, resp, err
+}
+
+func (c *Client) UpdateProjectGroupSecretUsage(ctx context.Context, projectGroupRef, secretName string, req *csapitypes.UpdateSecretUsageRequest) (*http.Response, error) {
+	return c.updateSecretUsage(ctx, fmt.Sprintf("/projectgroups/%s/secrets/%s/usage", url.PathEscape(projectGroupRef), secretName), req)
+}
+
+func (c *Client) UpdateProjectSecretUsage(ctx context.Context, projectRef, secretName string, req *csapitypes.UpdateSecretUsageRequest) (*http.Response, error) {
+	return c.updateSecretUsage(ctx, fmt.Sprintf("/projects/%s/secrets/%s/usage", url.PathEscape(projectRef), secretName), req)
+}
+
+func (c *Client) updateSecretUsage(ctx context.Context, path string, req *csapitypes.UpdateSecretUsageRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", path, nil, jsonContent, bytes.NewReader(reqj))
+}
+
 func (c *Client) GetProjectGroupVariables(ctx context.Context, projectGroupRef string, tree bool) ([]*csapitypes.Variable, *http.Response, error) {
 	q := url.Values{}
 	if tree {
@@ -331,6 +407,42 @@ func (c *Client) DeleteProjectVariable(ctx context.Context, projectRef, variable
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/variables/%s", url.PathEscape(projectRef), variableName), nil, jsonContent, nil)
 }
 
+func (c *Client) SetProjectGroupVariables(ctx context.Context, projectGroupRef string, req *csapitypes.SetVariablesRequest) ([]*csapitypes.SetResult, *http.Response, error) {
+	return c.setVariables(ctx, fmt.Sprintf("/projectgroups/%s/variables", url.PathEscape(projectGroupRef)), req)
+}
+
+func (c *Client) SetProjectVariables(ctx context.Context, projectRef string, req *csapitypes.SetVariablesRequest) ([]*csapitypes.SetResult, *http.Response, error) {
+	return c.setVariables(ctx, fmt.Sprintf("/projects/%s/variables", url.PathEscape(projectRef)), req)
+}
+
+func (c *Client) setVariables(ctx context.Context, path string, req *csapitypes.SetVariablesRequest) ([]*csapitypes.SetResult, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []*csapitypes.SetResult{}
+	resp, err := c.getParsedResponse(ctx, "PUT", path, nil, jsonContent, bytes.NewReader(reqj), &results)
+	return results, resp, err
+}
+
+func (c *Client) UpdateProjectGroupVariableUsage(ctx context.Context, projectGroupRef, variableName string, req *csapitypes.UpdateVariableUsageRequest) (*http.Response, error) {
+	return c.updateVariableUsage(ctx, fmt.Sprintf("/projectgroups/%s/variables/%s/usage", url.PathEscape(projectGroupRef), variableName), req)
+}
+
+func (c *Client) UpdateProjectVariableUsage(ctx context.Context, projectRef, variableName string, req *csapitypes.UpdateVariableUsageRequest) (*http.Response, error) {
+	return c.updateVariableUsage(ctx, fmt.Sprintf("/projects/%s/variables/%s/usage", url.PathEscape(projectRef), variableName), req)
+}
+
+func (c *Client) updateVariableUsage(ctx context.Context, path string, req *csapitypes.UpdateVariableUsageRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", path, nil, jsonContent, bytes.NewReader(reqj))
+}
+
 func (c *Client) GetUser(ctx context.Context, userRef string) (*cstypes.User, *http.Response, error) {
 	user := new(types.User)
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s", userRef), nil, jsonContent, nil, user)
@@ -461,6 +573,39 @@ func (c *Client) DeleteUserToken(ctx context.Context, userRef, tokenName string)
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/tokens/%s", userRef, tokenName), nil, jsonContent, nil)
 }
 
+func (c *Client) UpdateUserTokenLastUsed(ctx context.Context, userRef, tokenName string, req *csapitypes.UpdateUserTokenLastUsedRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/users/%s/tokens/%s/lastused", userRef, tokenName), nil, jsonContent, bytes.NewReader(reqj))
+}
+
+func (c *Client) CreateUserSession(ctx context.Context, userRef string, req *csapitypes.CreateUserSessionRequest) (*csapitypes.CreateUserSessionResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sresp := new(csapitypes.CreateUserSessionResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/users/%s/sessions", userRef), nil, jsonContent, bytes.NewReader(reqj), sresp)
+	return sresp, resp, err
+}
+
+func (c *Client) DeleteUserSession(ctx context.Context, userRef, sessionID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/sessions/%s", userRef, sessionID), nil, jsonContent, nil)
+}
+
+func (c *Client) UpdateUserSessionLastActivity(ctx context.Context, userRef, sessionID string, req *csapitypes.UpdateUserSessionLastActivityRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/users/%s/sessions/%s/lastactivity", userRef, sessionID), nil, jsonContent, bytes.NewReader(reqj))
+}
+
 func (c *Client) GetUserOrgs(ctx context.Context, userRef string) ([]*csapitypes.UserOrgsResponse, *http.Response, error) {
 	userOrgs := []*csapitypes.UserOrgsResponse{}
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s/orgs", userRef), nil, jsonContent, nil, &userOrgs)
@@ -516,6 +661,98 @@ func (c *Client) DeleteRemoteSource(ctx context.Context, rsRef string) (*http.Re
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/remotesources/%s", rsRef), nil, jsonContent, nil)
 }
 
+func (c *Client) GetProjectTemplate(ctx context.Context, projectTemplateRef string) (*cstypes.ProjectTemplate, *http.Response, error) {
+	pt := new(cstypes.ProjectTemplate)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projecttemplates/%s", projectTemplateRef), nil, jsonContent, nil, pt)
+	return pt, resp, err
+}
+
+func (c *Client) GetProjectTemplates(ctx context.Context, start string, limit int, asc bool) ([]*cstypes.ProjectTemplate, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	if asc {
+		q.Add("asc", "")
+	}
+
+	pts := []*cstypes.ProjectTemplate{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/projecttemplates", q, jsonContent, nil, &pts)
+	return pts, resp, err
+}
+
+func (c *Client) CreateProjectTemplate(ctx context.Context, req *csapitypes.CreateProjectTemplateRequest) (*cstypes.ProjectTemplate, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pt := new(cstypes.ProjectTemplate)
+	resp, err := c.getParsedResponse(ctx, "POST", "/projecttemplates", nil, jsonContent, bytes.NewReader(reqj), pt)
+	return pt, resp, err
+}
+
+func (c *Client) UpdateProjectTemplate(ctx context.Context, projectTemplateRef string, req *csapitypes.UpdateProjectTemplateRequest) (*cstypes.ProjectTemplate, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pt := new(cstypes.ProjectTemplate)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projecttemplates/%s", url.PathEscape(projectTemplateRef)), nil, jsonContent, bytes.NewReader(reqj), pt)
+	return pt, resp, err
+}
+
+func (c *Client) DeleteProjectTemplate(ctx context.Context, projectTemplateRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projecttemplates/%s", projectTemplateRef), nil, jsonContent, nil)
+}
+
+func (c *Client) CreateAuditEvent(ctx context.Context, auditEvent *cstypes.AuditEvent) (*cstypes.AuditEvent, *http.Response, error) {
+	aej, err := json.Marshal(auditEvent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	auditEvent = new(cstypes.AuditEvent)
+	resp, err := c.getParsedResponse(ctx, "POST", "/auditevents", nil, jsonContent, bytes.NewReader(aej), auditEvent)
+	return auditEvent, resp, err
+}
+
+func (c *Client) GetAuditEvents(ctx context.Context, actor, action, resource string, since, until *time.Time, start string, limit int, asc bool) ([]*cstypes.AuditEvent, *http.Response, error) {
+	q := url.Values{}
+	if actor != "" {
+		q.Add("actor", actor)
+	}
+	if action != "" {
+		q.Add("action", action)
+	}
+	if resource != "" {
+		q.Add("resource", resource)
+	}
+	if since != nil {
+		q.Add("since", since.Format(time.RFC3339))
+	}
+	if until != nil {
+		q.Add("until", until.Format(time.RFC3339))
+	}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	if asc {
+		q.Add("asc", "")
+	}
+
+	auditEvents := []*cstypes.AuditEvent{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/auditevents", q, jsonContent, nil, &auditEvents)
+	return auditEvents, resp, err
+}
+
 func (c *Client) CreateOrg(ctx context.Context, org *cstypes.Organization) (*types.Organization, *http.Response, error) {
 	oj, err := json.Marshal(org)
 	if err != nil {
@@ -545,6 +782,20 @@ func (c *Client) AddOrgMember(ctx context.Context, orgRef, userRef string, role
 	return orgmember, resp, err
 }
 
+func (c *Client) SetOrgSecretPolicy(ctx context.Context, orgRef string, policy *cstypes.SecretPolicy) (*cstypes.Organization, *http.Response, error) {
+	req := &csapitypes.SetOrgSecretPolicyRequest{
+		SecretPolicy: policy,
+	}
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	org := new(cstypes.Organization)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/orgs/%s/secretpolicy", orgRef), nil, jsonContent, bytes.NewReader(reqj), org)
+	return org, resp, err
+}
+
 func (c *Client) RemoveOrgMember(ctx context.Context, orgRef, userRef string) (*http.Response, error) {
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/orgs/%s/members/%s", orgRef, userRef), nil, jsonContent, nil)
 }
@@ -577,3 +828,30 @@ func (c *Client) GetOrgMembers(ctx context.Context, orgRef string) ([]*csapitype
 	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/orgs/%s/members", orgRef), nil, jsonContent, nil, &orgMembers)
 	return orgMembers, resp, err
 }
+
+// Export returns the configstore data export. The caller must close the
+// response body.
+func (c *Client) Export(ctx context.Context) (*http.Response, error) {
+	return c.getResponse(ctx, "GET", "/export", nil, nil, nil)
+}
+
+// Fsck checks the configstore data consistency and, when repair is true,
+// repairs the problems that could be automatically repaired
+func (c *Client) Fsck(ctx context.Context, repair bool) (*csapitypes.FsckResponse, *http.Response, error) {
+	method := "GET"
+	if repair {
+		method = "POST"
+	}
+	res := new(csapitypes.FsckResponse)
+	resp, err := c.getParsedResponse(ctx, method, "/maintenance/fsck", nil, jsonContent, nil, res)
+	return res, resp, err
+}
+
+func (c *Client) Import(ctx context.Context, r io.Reader) (*http.Response, error) {
+	resp, err := c.getResponse(ctx, "POST", "/import", nil, nil, r)
+	if err != nil {
+		return resp, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
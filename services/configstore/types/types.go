@@ -17,6 +17,8 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"agola.io/agola/services/types"
@@ -36,6 +38,9 @@ const (
 	ConfigTypeRemoteSource ConfigType = "remotesource"
 	ConfigTypeSecret       ConfigType = "secret"
 	ConfigTypeVariable     ConfigType = "variable"
+
+	ConfigTypeProjectTemplate ConfigType = "projecttemplate"
+	ConfigTypeAuditEvent      ConfigType = "auditevent"
 )
 
 type Visibility string
@@ -96,11 +101,28 @@ type User struct {
 	Password string `json:"password,omitempty"`
 
 	Tokens map[string]string `json:"tokens,omitempty"`
+	// TokensInfo contains the tokens metadata keyed by token name
+	TokensInfo map[string]*UserTokenInfo `json:"tokens_info,omitempty"`
+
+	// Sessions contains the user web sessions keyed by session id
+	Sessions map[string]*UserSession `json:"sessions,omitempty"`
 
 	// Admin defines if the user is a global admin
 	Admin bool `json:"admin,omitempty"`
 }
 
+// UserTokenInfo contains the metadata of a user token
+type UserTokenInfo struct {
+	CreationTime *time.Time `json:"creation_time,omitempty"`
+	LastUsedTime *time.Time `json:"last_used_time,omitempty"`
+}
+
+// UserSession contains the metadata of a user web session
+type UserSession struct {
+	CreationTime     *time.Time `json:"creation_time,omitempty"`
+	LastActivityTime *time.Time `json:"last_activity_time,omitempty"`
+}
+
 type Organization struct {
 	// The type version. Increase when a breaking change is done. Usually not
 	// needed when adding fields.
@@ -116,6 +138,23 @@ type Organization struct {
 	// if the org was created by using the admin user or the user has been removed.
 	CreatorUserID string    `json:"creator_user_id,omitempty"`
 	CreatedAt     time.Time `json:"created_at,omitempty"`
+
+	// SecretPolicy is the policy enforced on the values of the secrets of all
+	// the org projects and project groups
+	SecretPolicy *SecretPolicy `json:"secret_policy,omitempty"`
+}
+
+// SecretPolicy defines the rules that every internal secret value must
+// satisfy
+type SecretPolicy struct {
+	// MinLength is the minimum secret value length
+	MinLength int `json:"min_length,omitempty"`
+	// ForbiddenPatterns are regular expressions that the secret values must
+	// not match (i.e. values that look like non secrets)
+	ForbiddenPatterns []string `json:"forbidden_patterns,omitempty"`
+	// RequiredPrefixes, when defined, requires the secret values to start with
+	// one of them
+	RequiredPrefixes []string `json:"required_prefixes,omitempty"`
 }
 
 type OrganizationMember struct {
@@ -144,9 +183,10 @@ type ProjectGroup struct {
 type RemoteSourceType string
 
 const (
-	RemoteSourceTypeGitea  RemoteSourceType = "gitea"
-	RemoteSourceTypeGithub RemoteSourceType = "github"
-	RemoteSourceTypeGitlab RemoteSourceType = "gitlab"
+	RemoteSourceTypeGitea     RemoteSourceType = "gitea"
+	RemoteSourceTypeGithub    RemoteSourceType = "github"
+	RemoteSourceTypeGitlab    RemoteSourceType = "gitlab"
+	RemoteSourceTypeBitbucket RemoteSourceType = "bitbucket"
 )
 
 type RemoteSourceAuthType string
@@ -205,6 +245,8 @@ func (rs *RemoteSource) UnmarshalJSON(b []byte) error {
 func SourceSupportedAuthTypes(rsType RemoteSourceType) []RemoteSourceAuthType {
 	switch rsType {
 	case RemoteSourceTypeGitea:
+		fallthrough
+	case RemoteSourceTypeBitbucket:
 		return []RemoteSourceAuthType{RemoteSourceAuthTypeOauth2, RemoteSourceAuthTypePassword}
 	case RemoteSourceTypeGithub:
 		fallthrough
@@ -244,6 +286,10 @@ type LinkedAccount struct {
 	Oauth2AccessToken          string    `json:"oauth2_access_token,omitempty"`
 	Oauth2RefreshToken         string    `json:"oauth2_refresh_token,omitempty"`
 	Oauth2AccessTokenExpiresAt time.Time `json:"oauth_2_access_token_expires_at,omitempty"`
+
+	// NeedsReauth is set when the remote source rejected the oauth2 refresh
+	// token. The user has to re-authenticate with the remote source.
+	NeedsReauth bool `json:"needs_reauth,omitempty"`
 }
 
 // RemoteRepositoryConfigType defines how a remote repository is configured and
@@ -300,6 +346,10 @@ type Project struct {
 	// do this but gitlab can and github has an hidden api to do this)
 	RepositoryPath string `json:"repository_path,omitempty"`
 
+	// ConfigRepository, when defined, is the repository from where the run
+	// config is read instead of the project repository
+	ConfigRepository *ProjectConfigRepository `json:"config_repository,omitempty"`
+
 	SSHPrivateKey string `json:"ssh_private_key,omitempty"` // PEM Encoded private key
 
 	SkipSSHHostKeyCheck bool `json:"skip_ssh_host_key_check,omitempty"`
@@ -307,8 +357,79 @@ type Project struct {
 	// Webhooksecret is the secret passed to git sources that support a
 	// secret/token for signing or verifying the webhook payload
 	WebhookSecret string `json:"webhook_secret,omitempty"`
+	// PreviousWebhookSecret is the webhook secret replaced by the last webhook
+	// secret rotation. It's still accepted until
+	// PreviousWebhookSecretExpiration to not reject the webhooks delivered
+	// during the rotation.
+	PreviousWebhookSecret           string     `json:"previous_webhook_secret,omitempty"`
+	PreviousWebhookSecretExpiration *time.Time `json:"previous_webhook_secret_expiration,omitempty"`
 
 	PassVarsToForkedPR bool `json:"pass_vars_to_forked_pr,omitempty"`
+
+	// NetworkPolicy is the name of the executor network policy applied to the
+	// project runs tasks when not defined by the run config
+	NetworkPolicy string `json:"network_policy,omitempty"`
+
+	// SecurityProfile is the name of the executor security profile applied to
+	// the project runs tasks when not defined by the run config
+	SecurityProfile string `json:"security_profile,omitempty"`
+
+	// UntrustedRunsNeedApproval requires an approval before executing the
+	// tasks of untrusted runs (like pull requests from forked repositories of
+	// not collaborators)
+	UntrustedRunsNeedApproval bool `json:"untrusted_runs_need_approval,omitempty"`
+
+	// ConfigFromBaseBranch reads the run config of the pull requests runs from
+	// the current head of the pull request base branch instead of the pull
+	// request head commit, so a pull request cannot change the pipeline (and
+	// the required checks) executed on its code
+	ConfigFromBaseBranch bool `json:"config_from_base_branch,omitempty"`
+
+	// MaxStepLogSize overrides the executor max log size of the project runs
+	// steps for projects with a legitimate large output. 0 means use the
+	// executor default.
+	MaxStepLogSize int64 `json:"max_step_log_size,omitempty"`
+
+	// WebhookRunSelectors are the names or labels of the runs, defined in the
+	// run config, created by the project webhook. When empty all the runs are
+	// created.
+	WebhookRunSelectors []string `json:"webhook_run_selectors,omitempty"`
+
+	// RequiredRuns are the names of the runs, defined in the run config, that
+	// must successfully finish on a commit to consider its required checks
+	// passed. When empty all the runs created for the commit are required.
+	RequiredRuns []string `json:"required_runs,omitempty"`
+
+	// TriggerPolicy defines which webhook events create runs. When nil the
+	// DefaultProjectTriggerPolicy is used.
+	TriggerPolicy *ProjectTriggerPolicy `json:"trigger_policy,omitempty"`
+
+	// DeployEnvironments are the environments (i.e. staging, production)
+	// targeted by the run tasks with their protection rules
+	DeployEnvironments []*ProjectDeployEnvironment `json:"deploy_environments,omitempty"`
+
+	// APIKeys contains the project api keys keyed by api key name
+	APIKeys map[string]*ProjectAPIKey `json:"api_keys,omitempty"`
+}
+
+// DeployEnvironment returns the project deploy environment with the provided
+// name or nil if not defined
+func (p *Project) DeployEnvironment(name string) *ProjectDeployEnvironment {
+	for _, de := range p.DeployEnvironments {
+		if de.Name == name {
+			return de
+		}
+	}
+	return nil
+}
+
+// EffectiveTriggerPolicy returns the project trigger policy or the default one
+// when not set
+func (p *Project) EffectiveTriggerPolicy() *ProjectTriggerPolicy {
+	if p.TriggerPolicy == nil {
+		return DefaultProjectTriggerPolicy()
+	}
+	return p.TriggerPolicy
 }
 
 type SecretType string
@@ -326,6 +447,123 @@ const (
 	SecretProviderVault SecretProviderType = "vault"
 )
 
+type TriggerBranchesPolicy string
+
+const (
+	// TriggerBranchesPolicyAll creates runs on push to any branch
+	TriggerBranchesPolicyAll TriggerBranchesPolicy = "all"
+	// TriggerBranchesPolicyDefault creates runs only on push to the
+	// repository default branch
+	TriggerBranchesPolicyDefault TriggerBranchesPolicy = "default"
+	// TriggerBranchesPolicyNone doesn't create runs on push to branches
+	TriggerBranchesPolicyNone TriggerBranchesPolicy = "none"
+)
+
+func IsValidTriggerBranchesPolicy(p TriggerBranchesPolicy) bool {
+	switch p {
+	case TriggerBranchesPolicyAll:
+	case TriggerBranchesPolicyDefault:
+	case TriggerBranchesPolicyNone:
+	default:
+		return false
+	}
+	return true
+}
+
+// ProjectTriggerPolicy defines which webhook events create the project runs
+type ProjectTriggerPolicy struct {
+	Branches     TriggerBranchesPolicy `json:"branches,omitempty"`
+	Tags         bool                  `json:"tags,omitempty"`
+	PullRequests bool                  `json:"pull_requests,omitempty"`
+}
+
+// DefaultProjectTriggerPolicy creates runs for every webhook event
+func DefaultProjectTriggerPolicy() *ProjectTriggerPolicy {
+	return &ProjectTriggerPolicy{
+		Branches:     TriggerBranchesPolicyAll,
+		Tags:         true,
+		PullRequests: true,
+	}
+}
+
+// ProjectDeployEnvironment is a deploy environment targeted by the run tasks.
+// A task targeting it must satisfy its protection rules before being executed.
+type ProjectDeployEnvironment struct {
+	Name string `json:"name,omitempty"`
+
+	// RequiredApprovals is the number of distinct users that must approve the
+	// task before it's executed. 0 means no approval required.
+	RequiredApprovals int `json:"required_approvals,omitempty"`
+
+	// Approvers are the ids of the users allowed to approve the task. When
+	// empty every user allowed to do run actions could approve it.
+	Approvers []string `json:"approvers,omitempty"`
+
+	// Branches are the names, or regular expressions delimited by slashes, of
+	// the branches allowed to deploy to the environment. When empty all the
+	// refs (branches, tags, pull requests) are allowed.
+	Branches []string `json:"branches,omitempty"`
+
+	// WaitTimer is the time to wait, once the task could be executed (and
+	// has been approved), before executing it
+	WaitTimer time.Duration `json:"wait_timer,omitempty"`
+}
+
+// BranchAllowed reports if the provided branch could deploy to the
+// environment. An empty branch (the ref isn't a branch) is allowed only when
+// the environment doesn't restrict the branches.
+func (e *ProjectDeployEnvironment) BranchAllowed(branch string) bool {
+	if len(e.Branches) == 0 {
+		return true
+	}
+	if branch == "" {
+		return false
+	}
+	for _, b := range e.Branches {
+		if len(b) > 2 && strings.HasPrefix(b, "/") && strings.HasSuffix(b, "/") {
+			re, err := regexp.Compile(b[1 : len(b)-1])
+			if err != nil {
+				continue
+			}
+			if re.MatchString(branch) {
+				return true
+			}
+			continue
+		}
+		if b == branch {
+			return true
+		}
+	}
+	return false
+}
+
+// ProjectAPIKeyPrefix is the prefix of the project api keys. It's used to
+// distinguish them from the user tokens.
+const ProjectAPIKeyPrefix = "agolapk_"
+
+// ProjectAPIKey is an api key authorized only for the project operations. Only
+// the key hash is saved.
+type ProjectAPIKey struct {
+	Hash         string     `json:"hash,omitempty"`
+	CreationTime *time.Time `json:"creation_time,omitempty"`
+}
+
+// ProjectConfigRepository is a repository, different from the project one,
+// from where the project run config is read. This way who can change the
+// project repository cannot change the run config.
+type ProjectConfigRepository struct {
+	// RemoteSourceID and LinkedAccountID are used to access the config
+	// repository and could be different from the project ones
+	RemoteSourceID  string `json:"remote_source_id,omitempty"`
+	LinkedAccountID string `json:"linked_account_id,omitempty"`
+
+	RepositoryPath string `json:"repository_path,omitempty"`
+
+	// Branch is the config repository branch from where the run config is
+	// read
+	Branch string `json:"branch,omitempty"`
+}
+
 type Secret struct {
 	ID   string `json:"id,omitempty"`
 	Name string `json:"name,omitempty"`
@@ -340,6 +578,22 @@ type Secret struct {
 	// external secret
 	SecretProviderID string `json:"secret_provider_id,omitempty"`
 	Path             string `json:"path,omitempty"`
+
+	// ForkSafe marks the secret as safe to be provided to untrusted runs (like
+	// pull requests from forked repositories of not collaborators)
+	ForkSafe bool `json:"fork_safe,omitempty"`
+
+	// CreatedAt and UpdatedAt are zero for the secrets created before they
+	// were recorded
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// UpdaterUserID is the user id that created or last updated the secret. It
+	// could be empty if the secret was changed by using the admin user or the
+	// user has been removed.
+	UpdaterUserID string `json:"updater_user_id,omitempty"`
+
+	// Usages are the projects whose runs used the secret, keyed by project id
+	Usages map[string]*ConfigUsage `json:"usages,omitempty"`
 }
 
 type Variable struct {
@@ -349,6 +603,16 @@ type Variable struct {
 	Parent Parent `json:"parent,omitempty"`
 
 	Values []VariableValue `json:"values,omitempty"`
+
+	// Usages are the projects whose runs used the variable, keyed by project
+	// id
+	Usages map[string]*ConfigUsage `json:"usages,omitempty"`
+}
+
+// ConfigUsage records when a secret or variable was last resolved for a run
+// of a project
+type ConfigUsage struct {
+	LastUsedTime time.Time `json:"last_used_time,omitempty"`
 }
 
 type VariableValue struct {
@@ -357,3 +621,98 @@ type VariableValue struct {
 
 	When *types.When `json:"when,omitempty"`
 }
+
+// ProjectTemplate defines the settings applied to the projects created from
+// it. Every update adds a new revision, the projects are created from a
+// specific revision so updating a template doesn't change the projects
+// already created from it.
+type ProjectTemplate struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	Revisions []*ProjectTemplateRevision `json:"revisions,omitempty"`
+}
+
+// LatestRevision returns the latest template revision
+func (t *ProjectTemplate) LatestRevision() *ProjectTemplateRevision {
+	if len(t.Revisions) == 0 {
+		return nil
+	}
+	return t.Revisions[len(t.Revisions)-1]
+}
+
+// GetRevision returns the template revision with the provided number or nil
+// if it doesn't exist
+func (t *ProjectTemplate) GetRevision(revision int64) *ProjectTemplateRevision {
+	for _, r := range t.Revisions {
+		if r.Revision == revision {
+			return r
+		}
+	}
+	return nil
+}
+
+type ProjectTemplateRevision struct {
+	Revision  int64     `json:"revision,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+
+	ProjectTemplateSpec
+}
+
+type ProjectTemplateSpec struct {
+	// Parameters are the per project values provided when creating a project
+	// from the template. They can be referenced in the variables values as
+	// ${parametername}
+	Parameters []ProjectTemplateParameter `json:"parameters,omitempty"`
+
+	Visibility                Visibility `json:"visibility,omitempty"`
+	RemoteSourceName          string     `json:"remote_source_name,omitempty"`
+	SkipSSHHostKeyCheck       bool       `json:"skip_ssh_host_key_check,omitempty"`
+	PassVarsToForkedPR        bool       `json:"pass_vars_to_forked_pr,omitempty"`
+	NetworkPolicy             string     `json:"network_policy,omitempty"`
+	UntrustedRunsNeedApproval bool       `json:"untrusted_runs_need_approval,omitempty"`
+	MaxStepLogSize            int64      `json:"max_step_log_size,omitempty"`
+
+	Variables []ProjectTemplateVariable `json:"variables,omitempty"`
+}
+
+type ProjectTemplateParameter struct {
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Default is the value used when not provided. Parameters without a
+	// default value are required.
+	Default string `json:"default,omitempty"`
+}
+
+type ProjectTemplateVariable struct {
+	Name   string          `json:"name,omitempty"`
+	Values []VariableValue `json:"values,omitempty"`
+}
+
+type AuditEventActorType string
+
+const (
+	AuditEventActorTypeUser          AuditEventActorType = "user"
+	AuditEventActorTypeAdmin         AuditEventActorType = "admin"
+	AuditEventActorTypeProjectAPIKey AuditEventActorType = "projectapikey"
+)
+
+// AuditEvent records a change requested to the gateway api
+type AuditEvent struct {
+	ID   string    `json:"id,omitempty"`
+	Time time.Time `json:"time"`
+
+	ActorType AuditEventActorType `json:"actor_type,omitempty"`
+	// ActorID is the user id or, for project api keys, the project id
+	ActorID   string `json:"actor_id,omitempty"`
+	ActorName string `json:"actor_name,omitempty"`
+
+	// Action is the request method and the api route path template (i.e.
+	// "PUT /projects/{projectref}")
+	Action string `json:"action,omitempty"`
+	// Resource is the api path of the changed resource (i.e.
+	// "/projects/org01/project01")
+	Resource string `json:"resource,omitempty"`
+	// StatusCode is the http status code of the response
+	StatusCode int `json:"status_code,omitempty"`
+}
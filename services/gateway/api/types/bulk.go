@@ -0,0 +1,48 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+type BulkRunActionsRequest struct {
+	ActionType RunActionType `json:"action_type"`
+	// Tags, when defined, select only the runs having all the provided tags
+	Tags []string `json:"tags,omitempty"`
+}
+
+type BulkCreateRunsRequest struct {
+	Branch string `json:"branch,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	Ref    string `json:"ref,omitempty"`
+	// RunSelectors are the names or labels of the runs to create. When empty
+	// all the runs are created.
+	RunSelectors []string `json:"run_selectors,omitempty"`
+	// RunTags are added to the tags defined in the run config
+	RunTags []string `json:"run_tags,omitempty"`
+}
+
+type BulkOperationItemResponse struct {
+	ProjectID   string `json:"project_id"`
+	ProjectPath string `json:"project_path"`
+	// RunID is the run of a run action
+	RunID string `json:"run_id,omitempty"`
+	// RunIDs are the runs created on the project
+	RunIDs []string `json:"run_ids,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+type BulkOperationResponse struct {
+	Items     []*BulkOperationItemResponse `json:"items"`
+	Succeeded int                          `json:"succeeded"`
+	Failed    int                          `json:"failed"`
+}
@@ -0,0 +1,25 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "time"
+
+// ConfigUsageResponse reports when a project run last used a secret or
+// variable
+type ConfigUsageResponse struct {
+	ProjectID    string     `json:"project_id"`
+	ProjectPath  string     `json:"project_path"`
+	LastUsedTime *time.Time `json:"last_used_time"`
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "net/http"
+
+// ErrorCode is a stable machine readable code of an api error
+type ErrorCode string
+
+const (
+	ErrorCodeBadRequest   ErrorCode = "bad_request"
+	ErrorCodeNotFound     ErrorCode = "not_found"
+	ErrorCodeForbidden    ErrorCode = "forbidden"
+	ErrorCodeUnauthorized ErrorCode = "unauthorized"
+	ErrorCodeInternal     ErrorCode = "internal"
+)
+
+// ErrorResponse is the body of all the api error responses
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// Details, when available, are the single errors (i.e. all the
+	// validation errors of a run config)
+	Details []string `json:"details,omitempty"`
+}
+
+// ErrorCodeFromStatus returns the error code matching an http status code
+func ErrorCodeFromStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeBadRequest
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusForbidden:
+		return ErrorCodeForbidden
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// ErrorCodeStatus returns the http status code of an error code
+func ErrorCodeStatus(code ErrorCode) int {
+	switch code {
+	case ErrorCodeBadRequest:
+		return http.StatusBadRequest
+	case ErrorCodeNotFound:
+		return http.StatusNotFound
+	case ErrorCodeForbidden:
+		return http.StatusForbidden
+	case ErrorCodeUnauthorized:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"time"
+)
+
+type ExecutorResponse struct {
+	ID        string   `json:"id"`
+	ListenURL string   `json:"listen_url"`
+	OS        string   `json:"os"`
+	Archs     []string `json:"archs"`
+
+	Labels                    map[string]string       `json:"labels"`
+	AllowPrivilegedContainers bool                    `json:"allow_privileged_containers"`
+	GPUs                      []*ExecutorGPUsResponse `json:"gpus"`
+
+	ActiveTasksLimit int     `json:"active_tasks_limit"`
+	ActiveTasks      int     `json:"active_tasks"`
+	Utilization      float64 `json:"utilization"`
+	Draining         bool    `json:"draining"`
+	Dynamic          bool    `json:"dynamic"`
+	ExecutorGroup    string  `json:"executor_group"`
+
+	LastStatusUpdateTime *time.Time `json:"last_status_update_time"`
+	// Alive reports if the executor recently sent its status. Tasks aren't
+	// scheduled on not alive executors
+	Alive bool `json:"alive"`
+}
+
+type ExecutorGPUsResponse struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
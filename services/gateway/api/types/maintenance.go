@@ -0,0 +1,30 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// FsckProblem is a consistency problem of a configstore object
+type FsckProblem struct {
+	ObjectType  string `json:"object_type"`
+	ObjectID    string `json:"object_id"`
+	Description string `json:"description"`
+	// Repairable reports if the problem could be automatically repaired
+	// deleting the object or removing its dangling references
+	Repairable bool `json:"repairable"`
+	Repaired   bool `json:"repaired"`
+}
+
+type FsckResponse struct {
+	Problems []*FsckProblem `json:"problems"`
+}
@@ -27,9 +27,23 @@ type CreateOrgRequest struct {
 }
 
 type OrgResponse struct {
-	ID         string     `json:"id"`
-	Name       string     `json:"name"`
-	Visibility Visibility `json:"visibility,omitempty"`
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Visibility   Visibility    `json:"visibility,omitempty"`
+	SecretPolicy *SecretPolicy `json:"secret_policy,omitempty"`
+}
+
+// SecretPolicy defines the rules enforced on the values of the secrets of all
+// the org projects and project groups
+type SecretPolicy struct {
+	MinLength         int      `json:"min_length,omitempty"`
+	ForbiddenPatterns []string `json:"forbidden_patterns,omitempty"`
+	RequiredPrefixes  []string `json:"required_prefixes,omitempty"`
+}
+
+type SetOrgSecretPolicyRequest struct {
+	// SecretPolicy is the new org secret policy. A nil policy removes it.
+	SecretPolicy *SecretPolicy `json:"secret_policy"`
 }
 
 type OrgMembersResponse struct {
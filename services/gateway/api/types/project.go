@@ -14,6 +14,10 @@
 
 package types
 
+import (
+	"time"
+)
+
 type CreateProjectRequest struct {
 	Name                string     `json:"name,omitempty"`
 	ParentRef           string     `json:"parent_ref,omitempty"`
@@ -22,6 +26,12 @@ type CreateProjectRequest struct {
 	RemoteSourceName    string     `json:"remote_source_name,omitempty"`
 	SkipSSHHostKeyCheck bool       `json:"skip_ssh_host_key_check,omitempty"`
 	PassVarsToForkedPR  bool       `json:"pass_vars_to_forked_pr,omitempty"`
+	NetworkPolicy       string     `json:"network_policy,omitempty"`
+	SecurityProfile     string     `json:"security_profile,omitempty"`
+
+	UntrustedRunsNeedApproval bool  `json:"untrusted_runs_need_approval,omitempty"`
+	ConfigFromBaseBranch      bool  `json:"config_from_base_branch,omitempty"`
+	MaxStepLogSize            int64 `json:"max_step_log_size,omitempty"`
 }
 
 type UpdateProjectRequest struct {
@@ -29,6 +39,15 @@ type UpdateProjectRequest struct {
 	ParentRef          *string     `json:"parent_ref,omitempty"`
 	Visibility         *Visibility `json:"visibility,omitempty"`
 	PassVarsToForkedPR *bool       `json:"pass_vars_to_forked_pr,omitempty"`
+	NetworkPolicy      *string     `json:"network_policy,omitempty"`
+	SecurityProfile    *string     `json:"security_profile,omitempty"`
+
+	UntrustedRunsNeedApproval *bool  `json:"untrusted_runs_need_approval,omitempty"`
+	ConfigFromBaseBranch      *bool  `json:"config_from_base_branch,omitempty"`
+	MaxStepLogSize            *int64 `json:"max_step_log_size,omitempty"`
+
+	WebhookRunSelectors *[]string `json:"webhook_run_selectors,omitempty"`
+	RequiredRuns        *[]string `json:"required_runs,omitempty"`
 }
 
 type ProjectResponse struct {
@@ -39,6 +58,92 @@ type ProjectResponse struct {
 	Visibility         Visibility `json:"visibility,omitempty"`
 	GlobalVisibility   string     `json:"global_visibility,omitempty"`
 	PassVarsToForkedPR bool       `json:"pass_vars_to_forked_pr,omitempty"`
+	NetworkPolicy      string     `json:"network_policy,omitempty"`
+	SecurityProfile    string     `json:"security_profile,omitempty"`
+
+	UntrustedRunsNeedApproval bool  `json:"untrusted_runs_need_approval,omitempty"`
+	MaxStepLogSize            int64 `json:"max_step_log_size,omitempty"`
+
+	// ConfigFromBaseBranch reports that the pull requests runs read the run
+	// config from their base branch
+	ConfigFromBaseBranch bool `json:"config_from_base_branch,omitempty"`
+
+	// WebhookRunSelectors are the names or labels of the runs created by the
+	// project webhook
+	WebhookRunSelectors []string `json:"webhook_run_selectors,omitempty"`
+
+	// RequiredRuns are the names of the runs that must successfully finish on
+	// a commit to consider its required checks passed
+	RequiredRuns []string `json:"required_runs,omitempty"`
+
+	// ConfigRepository is the repository from where the run config is read
+	// instead of the project repository
+	ConfigRepository *ProjectConfigRepositoryResponse `json:"config_repository,omitempty"`
+
+	// TriggerPolicy is the effective project trigger policy
+	TriggerPolicy *ProjectTriggerPolicy `json:"trigger_policy,omitempty"`
+
+	// DeployEnvironments are the project deploy environments
+	DeployEnvironments []*ProjectDeployEnvironment `json:"deploy_environments,omitempty"`
+
+	// APIKeys are the names of the project api keys
+	APIKeys []string `json:"api_keys,omitempty"`
+}
+
+// ProjectTriggerPolicy defines which webhook events create the project runs.
+// Branches is one of "all", "default" (only the repository default branch)
+// or "none".
+type ProjectTriggerPolicy struct {
+	Branches     string `json:"branches"`
+	Tags         bool   `json:"tags"`
+	PullRequests bool   `json:"pull_requests"`
+}
+
+type SetProjectTriggerPolicyRequest struct {
+	Branches     string `json:"branches"`
+	Tags         bool   `json:"tags"`
+	PullRequests bool   `json:"pull_requests"`
+}
+
+// ProjectDeployEnvironment is a deploy environment targeted by the run tasks
+// with its protection rules
+type ProjectDeployEnvironment struct {
+	Name              string `json:"name"`
+	RequiredApprovals int    `json:"required_approvals"`
+	// Approvers are the ids of the users allowed to approve the tasks
+	Approvers []string      `json:"approvers"`
+	Branches  []string      `json:"branches"`
+	WaitTimer time.Duration `json:"wait_timer"`
+}
+
+type SetProjectDeployEnvironmentRequest struct {
+	RequiredApprovals int `json:"required_approvals"`
+	// Approvers are the refs (id or name) of the users allowed to approve the
+	// tasks
+	Approvers []string `json:"approvers"`
+	// Branches are the names, or regular expressions delimited by slashes, of
+	// the branches allowed to deploy to the environment
+	Branches  []string      `json:"branches"`
+	WaitTimer time.Duration `json:"wait_timer"`
+}
+
+type ProjectConfigRepositoryResponse struct {
+	RepositoryPath string `json:"repository_path"`
+	Branch         string `json:"branch"`
+}
+
+type SetProjectConfigRepositoryRequest struct {
+	RemoteSourceName string `json:"remote_source_name"`
+	RepoPath         string `json:"repo_path"`
+	Branch           string `json:"branch"`
+}
+
+type CreateProjectAPIKeyRequest struct {
+	APIKeyName string `json:"api_key_name"`
+}
+
+type CreateProjectAPIKeyResponse struct {
+	APIKey string `json:"api_key"`
 }
 
 type ProjectCreateRunRequest struct {
@@ -46,4 +151,47 @@ type ProjectCreateRunRequest struct {
 	Tag       string `json:"tag,omitempty"`
 	Ref       string `json:"ref,omitempty"`
 	CommitSHA string `json:"commit_sha,omitempty"`
+
+	// ExecutorID pins the run tasks to the provided executor (admin only)
+	ExecutorID string `json:"executor_id,omitempty"`
+
+	// RunSelectors are the names or labels of the runs to create. When empty
+	// all the runs are created.
+	RunSelectors []string `json:"run_selectors,omitempty"`
+
+	// RunTags are added to the tags defined in the run config
+	RunTags []string `json:"run_tags,omitempty"`
+}
+
+type ProjectCreateRunResponse struct {
+	RunIDs []string `json:"run_ids"`
+}
+
+// RequiredChecksResponse reports the status of the project required runs for
+// a commit. Status is the aggregate status (success, pending or failure).
+type RequiredChecksResponse struct {
+	CommitSHA string                   `json:"commit_sha"`
+	Status    string                   `json:"status"`
+	Checks    []*RequiredCheckResponse `json:"checks"`
+}
+
+// RequiredCheckResponse is the status (success, pending, failure or missing)
+// of a required run. The run fields are empty when the run is missing.
+type RequiredCheckResponse struct {
+	RunName    string `json:"run_name"`
+	Status     string `json:"status"`
+	RunID      string `json:"run_id,omitempty"`
+	RunCounter uint64 `json:"run_counter,omitempty"`
+	RunPhase   string `json:"run_phase,omitempty"`
+	RunResult  string `json:"run_result,omitempty"`
+}
+
+// PreviewEnvironmentResponse is an active pull request preview environment
+type PreviewEnvironmentResponse struct {
+	Name          string `json:"name"`
+	PullRequestID string `json:"pull_request_id"`
+	// RunID is the id of the last run that deployed the environment
+	RunID        string    `json:"run_id"`
+	CreationTime time.Time `json:"creation_time"`
+	UpdateTime   time.Time `json:"update_time"`
 }
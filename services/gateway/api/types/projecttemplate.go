@@ -0,0 +1,78 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"time"
+)
+
+type ProjectTemplateParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default,omitempty"`
+}
+
+type ProjectTemplateVariable struct {
+	Name   string                 `json:"name"`
+	Values []VariableValueRequest `json:"values"`
+}
+
+type ProjectTemplateSpec struct {
+	Parameters []ProjectTemplateParameter `json:"parameters,omitempty"`
+
+	Visibility                Visibility `json:"visibility,omitempty"`
+	RemoteSourceName          string     `json:"remote_source_name,omitempty"`
+	SkipSSHHostKeyCheck       bool       `json:"skip_ssh_host_key_check,omitempty"`
+	PassVarsToForkedPR        bool       `json:"pass_vars_to_forked_pr,omitempty"`
+	NetworkPolicy             string     `json:"network_policy,omitempty"`
+	UntrustedRunsNeedApproval bool       `json:"untrusted_runs_need_approval,omitempty"`
+	MaxStepLogSize            int64      `json:"max_step_log_size,omitempty"`
+
+	Variables []ProjectTemplateVariable `json:"variables,omitempty"`
+}
+
+type CreateProjectTemplateRequest struct {
+	Name string              `json:"name"`
+	Spec ProjectTemplateSpec `json:"spec"`
+}
+
+type UpdateProjectTemplateRequest struct {
+	Spec ProjectTemplateSpec `json:"spec"`
+}
+
+type ProjectTemplateRevisionResponse struct {
+	Revision  int64               `json:"revision"`
+	CreatedAt time.Time           `json:"created_at"`
+	Spec      ProjectTemplateSpec `json:"spec"`
+}
+
+type ProjectTemplateResponse struct {
+	ID        string                             `json:"id"`
+	Name      string                             `json:"name"`
+	Revisions []*ProjectTemplateRevisionResponse `json:"revisions"`
+}
+
+type CreateProjectFromTemplateRequest struct {
+	// Revision is the project template revision to use. 0 means the latest
+	// revision.
+	Revision int64 `json:"revision,omitempty"`
+
+	Name             string `json:"name"`
+	ParentRef        string `json:"parent_ref"`
+	RepoPath         string `json:"repo_path"`
+	RemoteSourceName string `json:"remote_source_name,omitempty"`
+
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
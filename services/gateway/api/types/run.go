@@ -25,6 +25,7 @@ type RunsResponse struct {
 	Counter     uint64            `json:"counter"`
 	Name        string            `json:"name"`
 	Annotations map[string]string `json:"annotations"`
+	Tags        []string          `json:"tags,omitempty"`
 	Phase       rstypes.RunPhase  `json:"phase"`
 	Result      rstypes.RunResult `json:"result"`
 
@@ -33,6 +34,82 @@ type RunsResponse struct {
 	EnqueueTime *time.Time `json:"enqueue_time"`
 	StartTime   *time.Time `json:"start_time"`
 	EndTime     *time.Time `json:"end_time"`
+
+	Trigger *RunTriggerResponse `json:"trigger"`
+}
+
+type RunStatsResponse struct {
+	Group       string     `json:"group"`
+	BucketStart *time.Time `json:"bucket_start"`
+
+	RunCount     uint64  `json:"run_count"`
+	SuccessCount uint64  `json:"success_count"`
+	FailedCount  uint64  `json:"failed_count"`
+	StoppedCount uint64  `json:"stopped_count"`
+	SuccessRate  float64 `json:"success_rate"`
+	// MedianDuration is the median run duration in seconds
+	MedianDuration float64 `json:"median_duration"`
+
+	CacheRestoreHits   uint64  `json:"cache_restore_hits"`
+	CacheRestoreMisses uint64  `json:"cache_restore_misses"`
+	CacheHitRate       float64 `json:"cache_hit_rate"`
+	CacheRestoredBytes int64   `json:"cache_restored_bytes"`
+	CacheSavedBytes    int64   `json:"cache_saved_bytes"`
+}
+
+// RunExportRecord is a finished run record streamed by the runs export api as
+// newline delimited json
+type RunExportRecord struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Group       string            `json:"group"`
+	ProjectID   string            `json:"project_id"`
+	Counter     uint64            `json:"counter"`
+	Result      string            `json:"result"`
+	Annotations map[string]string `json:"annotations"`
+	TriggerType string            `json:"trigger_type"`
+	TriggeredBy string            `json:"triggered_by"`
+	CommitSHA   string            `json:"commit_sha"`
+	Attempt     uint64            `json:"attempt"`
+
+	EnqueueTime *time.Time `json:"enqueue_time"`
+	StartTime   *time.Time `json:"start_time"`
+	EndTime     *time.Time `json:"end_time"`
+	// QueueDurationMs is the time in milliseconds between the run enqueue and start
+	QueueDurationMs int64 `json:"queue_duration_ms"`
+	// DurationMs is the run duration in milliseconds
+	DurationMs int64 `json:"duration_ms"`
+
+	Tasks []*RunExportTask `json:"tasks"`
+
+	// Watermark is the watermark to provide to continue the export after this
+	// run
+	Watermark string `json:"watermark"`
+}
+
+type RunExportTask struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	StartTime  *time.Time `json:"start_time"`
+	EndTime    *time.Time `json:"end_time"`
+	DurationMs int64      `json:"duration_ms"`
+}
+
+type RunTriggerResponse struct {
+	Type        string `json:"type"`
+	TriggeredBy string `json:"triggered_by"`
+	CommitSHA   string `json:"commit_sha"`
+	Untrusted   bool   `json:"untrusted"`
+	ParentRunID string `json:"parent_run_id"`
+	RootRunID   string `json:"root_run_id"`
+	Attempt     uint64 `json:"attempt"`
+
+	EnvironmentOverrides []string `json:"environment_overrides"`
+
+	CommitAuthorName  string `json:"commit_author_name"`
+	CommitAuthorEmail string `json:"commit_author_email"`
+	CommitMessage     string `json:"commit_message"`
 }
 
 type RunResponse struct {
@@ -40,11 +117,22 @@ type RunResponse struct {
 	Counter     uint64            `json:"counter"`
 	Name        string            `json:"name"`
 	Annotations map[string]string `json:"annotations"`
+	Tags        []string          `json:"tags,omitempty"`
 	Phase       rstypes.RunPhase  `json:"phase"`
 	Result      rstypes.RunResult `json:"result"`
 	SetupErrors []string          `json:"setup_errors"`
 	Stopping    bool              `json:"stopping"`
 
+	// NoRunsReason reports, for a run with a skipped result, why the event
+	// didn't create any run
+	NoRunsReason string `json:"no_runs_reason,omitempty"`
+
+	// DependsOn are the ids of the upstream runs this run depends on
+	DependsOn []string `json:"depends_on,omitempty"`
+	// CancelReason reports why the run has been cancelled (i.e. a failed
+	// upstream run)
+	CancelReason string `json:"cancel_reason,omitempty"`
+
 	Tasks                map[string]*RunResponseTask `json:"tasks"`
 	TasksWaitingApproval []string                    `json:"tasks_waiting_approval"`
 
@@ -52,8 +140,19 @@ type RunResponse struct {
 	StartTime   *time.Time `json:"start_time"`
 	EndTime     *time.Time `json:"end_time"`
 
+	Trigger *RunTriggerResponse `json:"trigger"`
+
 	CanRestartFromScratch     bool `json:"can_restart_from_scratch"`
 	CanRestartFromFailedTasks bool `json:"can_restart_from_failed_tasks"`
+
+	// SchedulingPaused reports that the run isn't progressing since the
+	// scheduling is paused. Only reported for not finished runs.
+	SchedulingPaused bool `json:"scheduling_paused,omitempty"`
+
+	// QueuePosition is the run position in its group queue (runs in the same
+	// group are started one at a time). Only reported for queued runs.
+	QueuePosition           int        `json:"queue_position,omitempty"`
+	QueueEstimatedStartTime *time.Time `json:"queue_estimated_start_time,omitempty"`
 }
 
 type RunResponseTask struct {
@@ -67,6 +166,10 @@ type RunResponseTask struct {
 	Approved            bool              `json:"approved"`
 	ApprovalAnnotations map[string]string `json:"approval_annotations"`
 
+	WaitingExecutorReason string `json:"waiting_executor_reason"`
+
+	Reports []*RunTaskResponseReport `json:"reports,omitempty"`
+
 	StartTime *time.Time `json:"start_time"`
 	EndTime   *time.Time `json:"end_time"`
 }
@@ -80,9 +183,32 @@ type RunTaskResponse struct {
 	Approved            bool              `json:"approved"`
 	ApprovalAnnotations map[string]string `json:"approval_annotations"`
 
+	WaitingExecutorReason string `json:"waiting_executor_reason"`
+
+	// FailError reports why the task failed outside of its steps (i.e. the
+	// task image pull failed)
+	FailError string `json:"fail_error,omitempty"`
+
 	SetupStep *RunTaskResponseSetupStep `json:"setup_step"`
 	Steps     []*RunTaskResponseStep    `json:"steps"`
 
+	Reports []*RunTaskResponseReport `json:"reports,omitempty"`
+
+	// Outputs are the task outputs available to its dependent tasks
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	ResourceUsage *RunTaskResponseResourceUsage `json:"resource_usage,omitempty"`
+
+	// StopResult reports if the processes of a stopped task exited gracefully
+	// or were killed
+	StopResult rstypes.TaskStopResult `json:"stop_result,omitempty"`
+
+	ImagePull *RunTaskResponseImagePull `json:"image_pull,omitempty"`
+
+	CacheUsage *RunTaskResponseCacheUsage `json:"cache_usage,omitempty"`
+
+	DebugHold *RunTaskResponseDebugHold `json:"debug_hold,omitempty"`
+
 	StartTime *time.Time `json:"start_time"`
 	EndTime   *time.Time `json:"end_time"`
 }
@@ -102,20 +228,250 @@ type RunTaskResponseStep struct {
 	Command string                    `json:"command"`
 	Shell   string                    `json:"shell"`
 
+	CommandArgs []string `json:"command_args,omitempty"`
+	// Background reports that the run step command is executed in background
+	Background bool `json:"background,omitempty"`
+
 	ExitStatus *int `json:"exit_status"`
 
+	ResourceUsage *RunTaskResponseResourceUsage `json:"resource_usage,omitempty"`
+
+	// Cache reports the cache usage of a restore_cache or save_cache step
+	Cache *RunTaskResponseStepCache `json:"cache,omitempty"`
+	// ArchiveSize is the size in bytes of the archive of a save_to_workspace
+	// step
+	ArchiveSize int64 `json:"archive_size,omitempty"`
+
 	StartTime *time.Time `json:"start_time"`
 	EndTime   *time.Time `json:"end_time"`
 
 	LogArchived bool `json:"log_archived"`
 }
 
+type RunTaskResponseStepCache struct {
+	Key  string `json:"key"`
+	Hit  bool   `json:"hit"`
+	Size int64  `json:"size"`
+}
+
+// RunTaskResponseCacheUsage is the cache and workspace archives usage of the
+// task steps
+type RunTaskResponseCacheUsage struct {
+	RestoreHits   int   `json:"restore_hits"`
+	RestoreMisses int   `json:"restore_misses"`
+	RestoredBytes int64 `json:"restored_bytes"`
+	SavedBytes    int64 `json:"saved_bytes"`
+	ArchivesSize  int64 `json:"archives_size"`
+}
+
+// RunTaskResponseResourceUsage is the cpu (in cores) and memory (in bytes)
+// usage of the task main container sampled by the executor
+type RunTaskResponseResourceUsage struct {
+	CPUPeak       float64 `json:"cpu_peak"`
+	CPUAverage    float64 `json:"cpu_average"`
+	MemoryPeak    int64   `json:"memory_peak"`
+	MemoryAverage int64   `json:"memory_average"`
+}
+
+// RunTaskResponseImagePull reports the pull of the task main container image
+// done by the executor
+type RunTaskResponseImagePull struct {
+	Image        string        `json:"image"`
+	CacheHit     bool          `json:"cache_hit"`
+	PulledBytes  int64         `json:"pulled_bytes"`
+	PulledLayers int           `json:"pulled_layers"`
+	CachedLayers int           `json:"cached_layers"`
+	Duration     time.Duration `json:"duration"`
+	Digest       string        `json:"digest"`
+}
+
+// RunTaskResponseDebugHold reports the pod of a failed task kept running by
+// the executor until the provided time
+type RunTaskResponseDebugHold struct {
+	ExecutorID string    `json:"executor_id"`
+	PodID      string    `json:"pod_id"`
+	Until      time.Time `json:"until"`
+}
+
+type RunTaskResponseReport struct {
+	Format rstypes.ReportFormat `json:"format"`
+	Path   string               `json:"path"`
+
+	Tests    int `json:"tests"`
+	Failures int `json:"failures"`
+	Errors   int `json:"errors"`
+	Skipped  int `json:"skipped"`
+
+	Coverage *float64 `json:"coverage,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// RunConfigDiffResponse reports the differences between the run configs of
+// two runs. The values that could contain secrets are redacted.
+type RunConfigDiffResponse struct {
+	RunID      string `json:"run_id"`
+	OtherRunID string `json:"other_run_id"`
+
+	// ChangedFields are the changed run config fields (tasks excluded)
+	ChangedFields []string `json:"changed_fields"`
+	AddedTasks    []string `json:"added_tasks"`
+	RemovedTasks  []string `json:"removed_tasks"`
+	ChangedTasks  []string `json:"changed_tasks"`
+
+	// Diff is the unified diff of the run configs. Empty when they're equal
+	Diff string `json:"diff"`
+}
+
+// RunProvenanceResponse is a DSSE envelope containing the base64 encoded in-toto
+// statement, with a SLSA provenance predicate, of a run. The field names are
+// the ones defined by the DSSE specification.
+type RunProvenanceResponse struct {
+	PayloadType string                    `json:"payloadType"`
+	Payload     string                    `json:"payload"`
+	Signatures  []*RunProvenanceSignature `json:"signatures"`
+}
+
+type RunProvenanceSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// RunTaskEnvironmentResponse reports the environment of a run task. The values
+// taken from variables (or that could contain secrets) are reported as
+// "[secret]".
+type RunTaskEnvironmentResponse struct {
+	RunID       string            `json:"run_id"`
+	TaskID      string            `json:"task_id"`
+	TaskName    string            `json:"task_name"`
+	Environment map[string]string `json:"environment"`
+	// Steps are the environment variables defined by the run steps that
+	// override the task environment
+	Steps []*RunTaskStepEnvironmentResponse `json:"steps"`
+}
+
+type RunTaskStepEnvironmentResponse struct {
+	Step        int               `json:"step"`
+	Name        string            `json:"name"`
+	Environment map[string]string `json:"environment"`
+}
+
+// RunPreviewResponse is the resolved structure of the runs that would be
+// created at the provided commit
+type RunPreviewResponse struct {
+	CommitSHA string `json:"commit_sha"`
+	Branch    string `json:"branch,omitempty"`
+	Tag       string `json:"tag,omitempty"`
+	Ref       string `json:"ref"`
+
+	Runs []*RunPreviewRunResponse `json:"runs"`
+}
+
+// RunConfigSourceResponse reports from where the run config used to create the
+// runs at the provided ref is read
+type RunConfigSourceResponse struct {
+	RepositoryPath string `json:"repository_path"`
+	CommitSHA      string `json:"commit_sha"`
+	Branch         string `json:"branch,omitempty"`
+	Tag            string `json:"tag,omitempty"`
+	Ref            string `json:"ref"`
+
+	// ConfigRepository reports that the run config is read from the project
+	// config repository
+	ConfigRepository     bool   `json:"config_repository"`
+	ConfigRepositoryPath string `json:"config_repository_path"`
+	ConfigRef            string `json:"config_ref"`
+	ConfigCommitSHA      string `json:"config_commit_sha"`
+
+	// ConfigPath is empty when no config file exists at the config commit
+	ConfigPath     string   `json:"config_path"`
+	CandidatePaths []string `json:"candidate_paths"`
+}
+
+type RunPreviewRunResponse struct {
+	Name string `json:"name"`
+
+	// Skip reports that the run won't be created
+	Skip       bool   `json:"skip"`
+	SkipReason string `json:"skip_reason,omitempty"`
+
+	SetupErrors []string `json:"setup_errors"`
+
+	Tasks map[string]*RunPreviewTaskResponse `json:"tasks"`
+}
+
+type RunPreviewTaskResponse struct {
+	ID      string                                  `json:"id"`
+	Name    string                                  `json:"name"`
+	Level   int                                     `json:"level"`
+	Depends map[string]*rstypes.RunConfigTaskDepend `json:"depends"`
+
+	// Skip reports that the task when conditions don't match
+	Skip            bool   `json:"skip"`
+	IgnoreFailure   bool   `json:"ignore_failure"`
+	NeedsApproval   bool   `json:"needs_approval"`
+	Always          bool   `json:"always"`
+	NetworkPolicy   string `json:"network_policy,omitempty"`
+	SecurityProfile string `json:"security_profile,omitempty"`
+
+	Arch   string   `json:"arch,omitempty"`
+	Images []string `json:"images"`
+
+	Steps []*RunPreviewTaskStepResponse `json:"steps"`
+}
+
+type RunPreviewTaskStepResponse struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	// Skip reports that the step when conditions don't match
+	Skip      bool `json:"skip"`
+	AlwaysRun bool `json:"always_run"`
+}
+
+type RunWatchEventType string
+
+const (
+	// RunWatchEventTypeSnapshot is the first event sent and contains the whole run
+	RunWatchEventTypeSnapshot RunWatchEventType = "snapshot"
+	// RunWatchEventTypeRunStatus is sent when the run status changes
+	RunWatchEventTypeRunStatus RunWatchEventType = "run_status"
+	// RunWatchEventTypeTaskStatus is sent when a run task status changes
+	RunWatchEventTypeTaskStatus RunWatchEventType = "task_status"
+)
+
+// RunWatchEvent is an event sent by the run watch websocket
+type RunWatchEvent struct {
+	Type  RunWatchEventType `json:"type"`
+	RunID string            `json:"run_id"`
+
+	Run       *RunResponse       `json:"run,omitempty"`
+	RunStatus *RunWatchRunStatus `json:"run_status,omitempty"`
+	Task      *RunResponseTask   `json:"task,omitempty"`
+}
+
+type RunWatchRunStatus struct {
+	Phase       rstypes.RunPhase  `json:"phase"`
+	Result      rstypes.RunResult `json:"result"`
+	SetupErrors []string          `json:"setup_errors"`
+	Stopping    bool              `json:"stopping"`
+
+	TasksWaitingApproval []string `json:"tasks_waiting_approval"`
+
+	StartTime *time.Time `json:"start_time"`
+	EndTime   *time.Time `json:"end_time"`
+
+	CanRestartFromScratch     bool `json:"can_restart_from_scratch"`
+	CanRestartFromFailedTasks bool `json:"can_restart_from_failed_tasks"`
+}
+
 type RunActionType string
 
 const (
 	RunActionTypeRestart RunActionType = "restart"
 	RunActionTypeCancel  RunActionType = "cancel"
 	RunActionTypeStop    RunActionType = "stop"
+	RunActionTypeSetTags RunActionType = "settags"
 )
 
 type RunActionsRequest struct {
@@ -123,6 +479,20 @@ type RunActionsRequest struct {
 
 	// Restart
 	FromStart bool `json:"from_start"`
+	// FromTask is the name of the task from which the run is restarted. The
+	// task and its childs are executed again while the other successful tasks
+	// results are reused
+	FromTask string `json:"from_task,omitempty"`
+	// Environment are the environment variables overridden in the restarted
+	// run
+	Environment map[string]string `json:"environment,omitempty"`
+	// DebugHold keeps the pods of the failed tasks of the restarted run
+	// running to debug them. Only admins and the run author can request it.
+	DebugHold bool `json:"debug_hold,omitempty"`
+
+	// SetTags
+	// Tags replace the run tags
+	Tags []string `json:"tags,omitempty"`
 }
 
 type RunTaskActionType string
@@ -14,6 +14,8 @@
 
 package types
 
+import "time"
+
 type SecretType string
 
 const (
@@ -25,6 +27,23 @@ type SecretResponse struct {
 	ID         string `json:"id"`
 	Name       string `json:"name"`
 	ParentPath string `json:"parent_path"`
+	ForkSafe   bool   `json:"fork_safe"`
+}
+
+// SecretAuditResponse contains the secret metadata used for auditing. It
+// never contains the secret data.
+type SecretAuditResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Type       SecretType `json:"type"`
+	ParentPath string     `json:"parent_path"`
+	// Scope is where the secret is defined: project, projectgroup, org or user
+	Scope string `json:"scope"`
+
+	CreatedAt       *time.Time `json:"created_at"`
+	UpdatedAt       *time.Time `json:"updated_at"`
+	UpdaterUserID   string     `json:"updater_user_id"`
+	UpdaterUserName string     `json:"updater_user_name"`
 }
 
 type CreateSecretRequest struct {
@@ -38,6 +57,8 @@ type CreateSecretRequest struct {
 	// external secret
 	SecretProviderID string `json:"secret_provider_id,omitempty"`
 	Path             string `json:"path,omitempty"`
+
+	ForkSafe bool `json:"fork_safe,omitempty"`
 }
 
 type UpdateSecretRequest struct {
@@ -51,4 +72,13 @@ type UpdateSecretRequest struct {
 	// external secret
 	SecretProviderID string `json:"secret_provider_id,omitempty"`
 	Path             string `json:"path,omitempty"`
+
+	ForkSafe bool `json:"fork_safe,omitempty"`
+}
+
+type SetSecretsRequest struct {
+	Secrets []*CreateSecretRequest `json:"secrets,omitempty"`
+
+	// Prune removes the secrets not defined in Secrets
+	Prune bool `json:"prune,omitempty"`
 }
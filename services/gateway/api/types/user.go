@@ -14,6 +14,10 @@
 
 package types
 
+import (
+	"time"
+)
+
 type LinkedAccount struct {
 	ID string `json:"id,omitempty"`
 
@@ -40,6 +44,7 @@ type LinkedAccountResponse struct {
 	RemoteSourceID      string `json:"remote_source_id"`
 	RemoteUserName      string `json:"remote_user_name"`
 	RemoteUserAvatarURL string `json:"remote_user_avatar_url"`
+	NeedsReauth         bool   `json:"needs_reauth"`
 }
 
 type CreateUserLARequest struct {
@@ -61,6 +66,12 @@ type CreateUserTokenResponse struct {
 	Token string `json:"token"`
 }
 
+type UserTokenResponse struct {
+	Name         string     `json:"name"`
+	CreationTime *time.Time `json:"creation_time"`
+	LastUsedTime *time.Time `json:"last_used_time"`
+}
+
 type RegisterUserRequest struct {
 	CreateUserRequest
 	CreateUserLARequest
@@ -105,4 +116,7 @@ type UserCreateRunRequest struct {
 
 	PullRequestRefRegexes []string          `json:"pull_request_ref_regexes,omitempty"`
 	Variables             map[string]string `json:"variables,omitempty"`
+
+	// RunTags are added to the tags defined in the run config
+	RunTags []string `json:"run_tags,omitempty"`
 }
@@ -51,3 +51,10 @@ type UpdateVariableRequest struct {
 
 	Values []VariableValueRequest `json:"values,omitempty"`
 }
+
+type SetVariablesRequest struct {
+	Variables []*CreateVariableRequest `json:"variables,omitempty"`
+
+	// Prune removes the variables not defined in Variables
+	Prune bool `json:"prune,omitempty"`
+}
@@ -26,6 +26,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	gwapitypes "agola.io/agola/services/gateway/api/types"
 
@@ -88,16 +89,45 @@ func (c *Client) getResponse(ctx context.Context, method, path string, query url
 			return resp, err
 		}
 
-		errMap := make(map[string]interface{})
-		if err = json.Unmarshal(data, &errMap); err != nil {
-			return resp, fmt.Errorf("unknown api error (code: %d): %s", resp.StatusCode, string(data))
-		}
-		return resp, errors.New(errMap["message"].(string))
+		return resp, parseAPIError(resp.StatusCode, data)
 	}
 
 	return resp, nil
 }
 
+// APIError is the error returned when the gateway api returns an error
+// response. Use errors.As to get it and check its Code.
+type APIError struct {
+	StatusCode int
+	gwapitypes.ErrorResponse
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// IsAPIErrorCode reports if err is an api error with the provided code
+func IsAPIErrorCode(err error, code gwapitypes.ErrorCode) bool {
+	var aerr *APIError
+	if !errors.As(err, &aerr) {
+		return false
+	}
+	return aerr.Code == code
+}
+
+func parseAPIError(statusCode int, data []byte) *APIError {
+	aerr := &APIError{StatusCode: statusCode}
+	if err := json.Unmarshal(data, &aerr.ErrorResponse); err != nil || aerr.Message == "" {
+		aerr.Message = fmt.Sprintf("unknown api error (code: %d): %s", statusCode, string(data))
+	}
+	// responses without a code (i.e. from older gateways) get the one
+	// matching their status code
+	if aerr.Code == "" {
+		aerr.Code = gwapitypes.ErrorCodeFromStatus(statusCode)
+	}
+	return aerr
+}
+
 func (c *Client) getParsedResponse(ctx context.Context, method, path string, query url.Values, header http.Header, ibody io.Reader, obj interface{}) (*http.Response, error) {
 	resp, err := c.getResponse(ctx, method, path, query, header, ibody)
 	if err != nil {
@@ -193,6 +223,17 @@ func (c *Client) CreateProjectGroupSecret(ctx context.Context, projectGroupRef s
 	return secret, resp, err
 }
 
+func (c *Client) SetProjectGroupSecrets(ctx context.Context, projectGroupRef string, req *gwapitypes.SetSecretsRequest) ([]*gwapitypes.SetResultResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []*gwapitypes.SetResultResponse{}
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "secrets"), nil, jsonContent, bytes.NewReader(reqj), &results)
+	return results, resp, err
+}
+
 func (c *Client) UpdateProjectGroupSecret(ctx context.Context, projectGroupRef, secretName string, req *gwapitypes.UpdateSecretRequest) (*gwapitypes.SecretResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -204,8 +245,18 @@ func (c *Client) UpdateProjectGroupSecret(ctx context.Context, projectGroupRef,
 	return secret, resp, err
 }
 
-func (c *Client) DeleteProjectGroupSecret(ctx context.Context, projectGroupRef, secretName string) (*http.Response, error) {
-	return c.getResponse(ctx, "DELETE", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "secrets", secretName), nil, jsonContent, nil)
+func (c *Client) DeleteProjectGroupSecret(ctx context.Context, projectGroupRef, secretName string, failIfUsed bool) (*http.Response, error) {
+	q := url.Values{}
+	if failIfUsed {
+		q.Add("failifused", "")
+	}
+	return c.getResponse(ctx, "DELETE", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "secrets", secretName), q, jsonContent, nil)
+}
+
+func (c *Client) GetProjectGroupSecretUsages(ctx context.Context, projectGroupRef, secretName string) ([]*gwapitypes.ConfigUsageResponse, *http.Response, error) {
+	usages := []*gwapitypes.ConfigUsageResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "secrets", secretName, "usages"), nil, jsonContent, nil, &usages)
+	return usages, resp, err
 }
 
 func (c *Client) GetProjectGroupSecrets(ctx context.Context, projectRef string, tree, removeoverridden bool) ([]*gwapitypes.SecretResponse, *http.Response, error) {
@@ -232,6 +283,17 @@ func (c *Client) CreateProjectSecret(ctx context.Context, projectRef string, req
 	return secret, resp, err
 }
 
+func (c *Client) SetProjectSecrets(ctx context.Context, projectRef string, req *gwapitypes.SetSecretsRequest) ([]*gwapitypes.SetResultResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []*gwapitypes.SetResultResponse{}
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projects", url.PathEscape(projectRef), "secrets"), nil, jsonContent, bytes.NewReader(reqj), &results)
+	return results, resp, err
+}
+
 func (c *Client) UpdateProjectSecret(ctx context.Context, projectRef, secretName string, req *gwapitypes.UpdateSecretRequest) (*gwapitypes.SecretResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -243,8 +305,18 @@ func (c *Client) UpdateProjectSecret(ctx context.Context, projectRef, secretName
 	return secret, resp, err
 }
 
-func (c *Client) DeleteProjectSecret(ctx context.Context, projectRef, secretName string) (*http.Response, error) {
-	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "secrets", secretName), nil, jsonContent, nil)
+func (c *Client) DeleteProjectSecret(ctx context.Context, projectRef, secretName string, failIfUsed bool) (*http.Response, error) {
+	q := url.Values{}
+	if failIfUsed {
+		q.Add("failifused", "")
+	}
+	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "secrets", secretName), q, jsonContent, nil)
+}
+
+func (c *Client) GetProjectSecretUsages(ctx context.Context, projectRef, secretName string) ([]*gwapitypes.ConfigUsageResponse, *http.Response, error) {
+	usages := []*gwapitypes.ConfigUsageResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "secrets", secretName, "usages"), nil, jsonContent, nil, &usages)
+	return usages, resp, err
 }
 
 func (c *Client) GetProjectSecrets(ctx context.Context, projectRef string, tree, removeoverridden bool) ([]*gwapitypes.SecretResponse, *http.Response, error) {
@@ -260,6 +332,18 @@ func (c *Client) GetProjectSecrets(ctx context.Context, projectRef string, tree,
 	return secrets, resp, err
 }
 
+func (c *Client) GetProjectSecretsAudit(ctx context.Context, projectRef string) ([]*gwapitypes.SecretAuditResponse, *http.Response, error) {
+	secrets := []*gwapitypes.SecretAuditResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/secretsaudit", url.PathEscape(projectRef)), nil, jsonContent, nil, &secrets)
+	return secrets, resp, err
+}
+
+func (c *Client) GetProjectGroupSecretsAudit(ctx context.Context, projectGroupRef string) ([]*gwapitypes.SecretAuditResponse, *http.Response, error) {
+	secrets := []*gwapitypes.SecretAuditResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projectgroups/%s/secretsaudit", url.PathEscape(projectGroupRef)), nil, jsonContent, nil, &secrets)
+	return secrets, resp, err
+}
+
 func (c *Client) CreateProjectGroupVariable(ctx context.Context, projectGroupRef string, req *gwapitypes.CreateVariableRequest) (*gwapitypes.VariableResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -271,6 +355,17 @@ func (c *Client) CreateProjectGroupVariable(ctx context.Context, projectGroupRef
 	return variable, resp, err
 }
 
+func (c *Client) SetProjectGroupVariables(ctx context.Context, projectGroupRef string, req *gwapitypes.SetVariablesRequest) ([]*gwapitypes.SetResultResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []*gwapitypes.SetResultResponse{}
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "variables"), nil, jsonContent, bytes.NewReader(reqj), &results)
+	return results, resp, err
+}
+
 func (c *Client) UpdateProjectGroupVariable(ctx context.Context, projectGroupRef, variableName string, req *gwapitypes.UpdateVariableRequest) (*gwapitypes.VariableResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -282,8 +377,18 @@ func (c *Client) UpdateProjectGroupVariable(ctx context.Context, projectGroupRef
 	return variable, resp, err
 }
 
-func (c *Client) DeleteProjectGroupVariable(ctx context.Context, projectGroupRef, variableName string) (*http.Response, error) {
-	return c.getResponse(ctx, "DELETE", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "variables", variableName), nil, jsonContent, nil)
+func (c *Client) DeleteProjectGroupVariable(ctx context.Context, projectGroupRef, variableName string, failIfUsed bool) (*http.Response, error) {
+	q := url.Values{}
+	if failIfUsed {
+		q.Add("failifused", "")
+	}
+	return c.getResponse(ctx, "DELETE", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "variables", variableName), q, jsonContent, nil)
+}
+
+func (c *Client) GetProjectGroupVariableUsages(ctx context.Context, projectGroupRef, variableName string) ([]*gwapitypes.ConfigUsageResponse, *http.Response, error) {
+	usages := []*gwapitypes.ConfigUsageResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projectgroups", url.PathEscape(projectGroupRef), "variables", variableName, "usages"), nil, jsonContent, nil, &usages)
+	return usages, resp, err
 }
 
 func (c *Client) GetProjectGroupVariables(ctx context.Context, projectRef string, tree, removeoverridden bool) ([]*gwapitypes.VariableResponse, *http.Response, error) {
@@ -310,6 +415,17 @@ func (c *Client) CreateProjectVariable(ctx context.Context, projectRef string, r
 	return variable, resp, err
 }
 
+func (c *Client) SetProjectVariables(ctx context.Context, projectRef string, req *gwapitypes.SetVariablesRequest) ([]*gwapitypes.SetResultResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := []*gwapitypes.SetResultResponse{}
+	resp, err := c.getParsedResponse(ctx, "PUT", path.Join("/projects", url.PathEscape(projectRef), "variables"), nil, jsonContent, bytes.NewReader(reqj), &results)
+	return results, resp, err
+}
+
 func (c *Client) UpdateProjectVariable(ctx context.Context, projectRef, variableName string, req *gwapitypes.UpdateVariableRequest) (*gwapitypes.VariableResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -321,8 +437,18 @@ func (c *Client) UpdateProjectVariable(ctx context.Context, projectRef, variable
 	return variable, resp, err
 }
 
-func (c *Client) DeleteProjectVariable(ctx context.Context, projectRef, variableName string) (*http.Response, error) {
-	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "variables", variableName), nil, jsonContent, nil)
+func (c *Client) DeleteProjectVariable(ctx context.Context, projectRef, variableName string, failIfUsed bool) (*http.Response, error) {
+	q := url.Values{}
+	if failIfUsed {
+		q.Add("failifused", "")
+	}
+	return c.getResponse(ctx, "DELETE", path.Join("/projects", url.PathEscape(projectRef), "variables", variableName), q, jsonContent, nil)
+}
+
+func (c *Client) GetProjectVariableUsages(ctx context.Context, projectRef, variableName string) ([]*gwapitypes.ConfigUsageResponse, *http.Response, error) {
+	usages := []*gwapitypes.ConfigUsageResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", path.Join("/projects", url.PathEscape(projectRef), "variables", variableName, "usages"), nil, jsonContent, nil, &usages)
+	return usages, resp, err
 }
 
 func (c *Client) GetProjectVariables(ctx context.Context, projectRef string, tree, removeoverridden bool) ([]*gwapitypes.VariableResponse, *http.Response, error) {
@@ -342,19 +468,152 @@ func (c *Client) DeleteProject(ctx context.Context, projectRef string) (*http.Re
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s", url.PathEscape(projectRef)), nil, jsonContent, nil)
 }
 
-func (c *Client) ProjectCreateRun(ctx context.Context, projectRef string, req *gwapitypes.ProjectCreateRunRequest) (*http.Response, error) {
+func (c *Client) ProjectCreateRun(ctx context.Context, projectRef string, req *gwapitypes.ProjectCreateRunRequest) (*gwapitypes.ProjectCreateRunResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return c.getResponse(ctx, "POST", fmt.Sprintf("/projects/%s/createrun", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj))
+	res := new(gwapitypes.ProjectCreateRunResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projects/%s/createrun", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
+func (c *Client) ProjectPreviewRun(ctx context.Context, projectRef, branch, tag, ref, commitSHA string) (*gwapitypes.RunPreviewResponse, *http.Response, error) {
+	q := url.Values{}
+	if branch != "" {
+		q.Add("branch", branch)
+	}
+	if tag != "" {
+		q.Add("tag", tag)
+	}
+	if ref != "" {
+		q.Add("ref", ref)
+	}
+	if commitSHA != "" {
+		q.Add("commit_sha", commitSHA)
+	}
+
+	res := new(gwapitypes.RunPreviewResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/runpreview", url.PathEscape(projectRef)), q, jsonContent, nil, res)
+	return res, resp, err
+}
+
+func (c *Client) ProjectRunConfigSource(ctx context.Context, projectRef, branch, tag, ref, commitSHA string) (*gwapitypes.RunConfigSourceResponse, *http.Response, error) {
+	q := url.Values{}
+	if branch != "" {
+		q.Add("branch", branch)
+	}
+	if tag != "" {
+		q.Add("tag", tag)
+	}
+	if ref != "" {
+		q.Add("ref", ref)
+	}
+	if commitSHA != "" {
+		q.Add("commit_sha", commitSHA)
+	}
+
+	res := new(gwapitypes.RunConfigSourceResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/runconfigsource", url.PathEscape(projectRef)), q, jsonContent, nil, res)
+	return res, resp, err
 }
 
 func (c *Client) ReconfigProject(ctx context.Context, projectRef string) (*http.Response, error) {
 	return c.getResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/reconfig", url.PathEscape(projectRef)), nil, jsonContent, nil)
 }
 
+func (c *Client) SetProjectConfigRepository(ctx context.Context, projectRef string, req *gwapitypes.SetProjectConfigRepositoryRequest) (*gwapitypes.ProjectResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project := new(gwapitypes.ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/configrepository", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), project)
+	return project, resp, err
+}
+
+func (c *Client) RemoveProjectConfigRepository(ctx context.Context, projectRef string) (*gwapitypes.ProjectResponse, *http.Response, error) {
+	project := new(gwapitypes.ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/configrepository", url.PathEscape(projectRef)), nil, jsonContent, nil, project)
+	return project, resp, err
+}
+
+func (c *Client) SetProjectTriggerPolicy(ctx context.Context, projectRef string, req *gwapitypes.SetProjectTriggerPolicyRequest) (*gwapitypes.ProjectResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project := new(gwapitypes.ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/triggerpolicy", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), project)
+	return project, resp, err
+}
+
+func (c *Client) SetProjectDeployEnvironment(ctx context.Context, projectRef, name string, req *gwapitypes.SetProjectDeployEnvironmentRequest) (*gwapitypes.ProjectResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project := new(gwapitypes.ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/deployenvironments/%s", url.PathEscape(projectRef), name), nil, jsonContent, bytes.NewReader(reqj), project)
+	return project, resp, err
+}
+
+func (c *Client) DeleteProjectDeployEnvironment(ctx context.Context, projectRef, name string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/deployenvironments/%s", url.PathEscape(projectRef), name), nil, jsonContent, nil)
+}
+
+func (c *Client) GetProjectPreviewEnvironments(ctx context.Context, projectRef string) ([]*gwapitypes.PreviewEnvironmentResponse, *http.Response, error) {
+	envs := []*gwapitypes.PreviewEnvironmentResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/previewenvironments", url.PathEscape(projectRef)), nil, jsonContent, nil, &envs)
+	return envs, resp, err
+}
+
+// GetProjectRequiredChecks returns the status of the project required runs for
+// the provided commit sha
+func (c *Client) GetProjectRequiredChecks(ctx context.Context, projectRef, commitSHA string) (*gwapitypes.RequiredChecksResponse, *http.Response, error) {
+	res := new(gwapitypes.RequiredChecksResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/commits/%s/requiredchecks", url.PathEscape(projectRef), url.PathEscape(commitSHA)), nil, jsonContent, nil, res)
+	return res, resp, err
+}
+
+func (c *Client) RotateProjectWebhookSecret(ctx context.Context, projectRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "PUT", fmt.Sprintf("/projects/%s/rotatewebhooksecret", url.PathEscape(projectRef)), nil, jsonContent, nil)
+}
+
+func (c *Client) GetProjectWebhookDeliveries(ctx context.Context, projectRef string, limit int) ([]*gwapitypes.WebhookDeliveryResponse, *http.Response, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	deliveries := []*gwapitypes.WebhookDeliveryResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projects/%s/webhookdeliveries", url.PathEscape(projectRef)), q, jsonContent, nil, &deliveries)
+	return deliveries, resp, err
+}
+
+func (c *Client) ReplayProjectWebhookDelivery(ctx context.Context, projectRef, deliveryID string) (*http.Response, error) {
+	return c.getResponse(ctx, "POST", fmt.Sprintf("/projects/%s/webhookdeliveries/%s/replay", url.PathEscape(projectRef), deliveryID), nil, jsonContent, nil)
+}
+
+func (c *Client) CreateProjectAPIKey(ctx context.Context, projectRef string, req *gwapitypes.CreateProjectAPIKeyRequest) (*gwapitypes.CreateProjectAPIKeyResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	aresp := new(gwapitypes.CreateProjectAPIKeyResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projects/%s/apikeys", url.PathEscape(projectRef)), nil, jsonContent, bytes.NewReader(reqj), aresp)
+	return aresp, resp, err
+}
+
+func (c *Client) DeleteProjectAPIKey(ctx context.Context, projectRef, apiKeyName string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projects/%s/apikeys/%s", url.PathEscape(projectRef), apiKeyName), nil, jsonContent, nil)
+}
+
 func (c *Client) GetCurrentUser(ctx context.Context) (*gwapitypes.UserResponse, *http.Response, error) {
 	user := new(gwapitypes.UserResponse)
 	resp, err := c.getParsedResponse(ctx, "GET", "/user", nil, jsonContent, nil, user)
@@ -445,23 +704,68 @@ func (c *Client) CreateUserToken(ctx context.Context, userRef string, req *gwapi
 	return tresp, resp, err
 }
 
+func (c *Client) GetUserTokens(ctx context.Context, userRef string) ([]*gwapitypes.UserTokenResponse, *http.Response, error) {
+	tokens := []*gwapitypes.UserTokenResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/users/%s/tokens", userRef), nil, jsonContent, nil, &tokens)
+	return tokens, resp, err
+}
+
 func (c *Client) DeleteUserToken(ctx context.Context, userRef, tokenName string) (*http.Response, error) {
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/users/%s/tokens/%s", userRef, tokenName), nil, jsonContent, nil)
 }
 
 func (c *Client) GetRun(ctx context.Context, runID string) (*gwapitypes.RunResponse, *http.Response, error) {
 	run := new(gwapitypes.RunResponse)
-	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s", runID), nil, jsonContent, nil, run)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s", url.PathEscape(runID)), nil, jsonContent, nil, run)
 	return run, resp, err
 }
 
 func (c *Client) GetRunTask(ctx context.Context, runID, taskID string) (*gwapitypes.RunTaskResponse, *http.Response, error) {
 	task := new(gwapitypes.RunTaskResponse)
-	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/tasks/%s", runID, taskID), nil, jsonContent, nil, task)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/tasks/%s", url.PathEscape(runID), taskID), nil, jsonContent, nil, task)
 	return task, resp, err
 }
 
-func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups, runGroups []string, start string, limit int, asc bool) ([]*gwapitypes.RunsResponse, *http.Response, error) {
+func (c *Client) GetRunTaskEnvironment(ctx context.Context, runID, taskID string) (*gwapitypes.RunTaskEnvironmentResponse, *http.Response, error) {
+	env := new(gwapitypes.RunTaskEnvironmentResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/tasks/%s/environment", url.PathEscape(runID), taskID), nil, jsonContent, nil, env)
+	return env, resp, err
+}
+
+func (c *Client) RunActions(ctx context.Context, runID string, req *gwapitypes.RunActionsRequest) (*gwapitypes.RunResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	run := new(gwapitypes.RunResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/runs/%s/actions", url.PathEscape(runID)), nil, jsonContent, bytes.NewReader(reqj), run)
+	return run, resp, err
+}
+
+func (c *Client) BulkRunActions(ctx context.Context, projectGroupRef string, req *gwapitypes.BulkRunActionsRequest) (*gwapitypes.BulkOperationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(gwapitypes.BulkOperationResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projectgroups/%s/runs/actions", url.PathEscape(projectGroupRef)), nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
+func (c *Client) BulkCreateRuns(ctx context.Context, projectGroupRef string, req *gwapitypes.BulkCreateRunsRequest) (*gwapitypes.BulkOperationResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(gwapitypes.BulkOperationResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projectgroups/%s/createruns", url.PathEscape(projectGroupRef)), nil, jsonContent, bytes.NewReader(reqj), res)
+	return res, resp, err
+}
+
+func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, tagFilter, groups, runGroups []string, start string, limit int, asc bool) ([]*gwapitypes.RunsResponse, *http.Response, error) {
 	q := url.Values{}
 	for _, phase := range phaseFilter {
 		q.Add("phase", phase)
@@ -469,6 +773,9 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups,
 	for _, result := range resultFilter {
 		q.Add("result", result)
 	}
+	for _, tag := range tagFilter {
+		q.Add("tag", tag)
+	}
 	for _, group := range groups {
 		q.Add("group", group)
 	}
@@ -490,6 +797,58 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups,
 	return getRunsResponse, resp, err
 }
 
+func (c *Client) GetRunStats(ctx context.Context, group string, start, end *time.Time, bucket string, bySubgroup bool) ([]*gwapitypes.RunStatsResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if start != nil {
+		q.Add("start", start.Format(time.RFC3339))
+	}
+	if end != nil {
+		q.Add("end", end.Format(time.RFC3339))
+	}
+	if bucket != "" {
+		q.Add("bucket", bucket)
+	}
+	if bySubgroup {
+		q.Add("bysubgroup", "")
+	}
+
+	runStats := []*gwapitypes.RunStatsResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/runs/stats", q, jsonContent, nil, &runStats)
+	return runStats, resp, err
+}
+
+func (c *Client) GetRunConfigDiff(ctx context.Context, runID, otherRunID string) (*gwapitypes.RunConfigDiffResponse, *http.Response, error) {
+	diff := new(gwapitypes.RunConfigDiffResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/configdiff/%s", runID, otherRunID), nil, jsonContent, nil, diff)
+	return diff, resp, err
+}
+
+// GetRunProvenance returns the signed provenance of a successful run
+func (c *Client) GetRunProvenance(ctx context.Context, runRef string) (*gwapitypes.RunProvenanceResponse, *http.Response, error) {
+	provenance := new(gwapitypes.RunProvenanceResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/provenance", url.PathEscape(runRef)), nil, jsonContent, nil, provenance)
+	return provenance, resp, err
+}
+
+// ExportRuns returns the response streaming the finished runs of the provided
+// group as newline delimited json records. The caller must close the response
+// body.
+func (c *Client) ExportRuns(ctx context.Context, group string, start, end *time.Time, watermark string) (*http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if start != nil {
+		q.Add("start", start.Format(time.RFC3339))
+	}
+	if end != nil {
+		q.Add("end", end.Format(time.RFC3339))
+	}
+	if watermark != "" {
+		q.Add("watermark", watermark)
+	}
+	return c.getResponse(ctx, "GET", "/runs/export", q, nil, nil)
+}
+
 func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool, step int, follow bool) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("runID", runID)
@@ -567,6 +926,66 @@ func (c *Client) DeleteRemoteSource(ctx context.Context, rsRef string) (*http.Re
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/remotesources/%s", rsRef), nil, jsonContent, nil)
 }
 
+func (c *Client) GetProjectTemplate(ctx context.Context, projectTemplateRef string) (*gwapitypes.ProjectTemplateResponse, *http.Response, error) {
+	pt := new(gwapitypes.ProjectTemplateResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/projecttemplates/%s", projectTemplateRef), nil, jsonContent, nil, pt)
+	return pt, resp, err
+}
+
+func (c *Client) GetProjectTemplates(ctx context.Context, start string, limit int, asc bool) ([]*gwapitypes.ProjectTemplateResponse, *http.Response, error) {
+	q := url.Values{}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	if asc {
+		q.Add("asc", "")
+	}
+
+	pts := []*gwapitypes.ProjectTemplateResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/projecttemplates", q, jsonContent, nil, &pts)
+	return pts, resp, err
+}
+
+func (c *Client) CreateProjectTemplate(ctx context.Context, req *gwapitypes.CreateProjectTemplateRequest) (*gwapitypes.ProjectTemplateResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pt := new(gwapitypes.ProjectTemplateResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", "/projecttemplates", nil, jsonContent, bytes.NewReader(reqj), pt)
+	return pt, resp, err
+}
+
+func (c *Client) UpdateProjectTemplate(ctx context.Context, projectTemplateRef string, req *gwapitypes.UpdateProjectTemplateRequest) (*gwapitypes.ProjectTemplateResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pt := new(gwapitypes.ProjectTemplateResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/projecttemplates/%s", projectTemplateRef), nil, jsonContent, bytes.NewReader(reqj), pt)
+	return pt, resp, err
+}
+
+func (c *Client) DeleteProjectTemplate(ctx context.Context, projectTemplateRef string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/projecttemplates/%s", projectTemplateRef), nil, jsonContent, nil)
+}
+
+func (c *Client) CreateProjectFromTemplate(ctx context.Context, projectTemplateRef string, req *gwapitypes.CreateProjectFromTemplateRequest) (*gwapitypes.ProjectResponse, *http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	project := new(gwapitypes.ProjectResponse)
+	resp, err := c.getParsedResponse(ctx, "POST", fmt.Sprintf("/projecttemplates/%s/projects", projectTemplateRef), nil, jsonContent, bytes.NewReader(reqj), project)
+	return project, resp, err
+}
+
 func (c *Client) CreateOrg(ctx context.Context, req *gwapitypes.CreateOrgRequest) (*gwapitypes.OrgResponse, *http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -596,6 +1015,20 @@ func (c *Client) AddOrgMember(ctx context.Context, orgRef, userRef string, role
 	return res, resp, err
 }
 
+func (c *Client) SetOrgSecretPolicy(ctx context.Context, orgRef string, policy *gwapitypes.SecretPolicy) (*gwapitypes.OrgResponse, *http.Response, error) {
+	req := &gwapitypes.SetOrgSecretPolicyRequest{
+		SecretPolicy: policy,
+	}
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	org := new(gwapitypes.OrgResponse)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/orgs/%s/secretpolicy", orgRef), nil, jsonContent, bytes.NewReader(reqj), org)
+	return org, resp, err
+}
+
 func (c *Client) RemoveOrgMember(ctx context.Context, orgRef, userRef string) (*http.Response, error) {
 	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/orgs/%s/members/%s", orgRef, userRef), nil, jsonContent, nil)
 }
@@ -606,8 +1039,87 @@ func (c *Client) GetOrgMembers(ctx context.Context, orgRef string) (*gwapitypes.
 	return res, resp, err
 }
 
+func (c *Client) GetSchedulingStatus(ctx context.Context) (*gwapitypes.SchedulingStatusResponse, *http.Response, error) {
+	status := new(gwapitypes.SchedulingStatusResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/scheduling", nil, jsonContent, nil, status)
+	return status, resp, err
+}
+
+func (c *Client) PauseScheduling(ctx context.Context, req *gwapitypes.SchedulingPauseRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.getResponse(ctx, "PUT", "/scheduling/pause", nil, jsonContent, bytes.NewReader(reqj))
+}
+
+func (c *Client) ResumeScheduling(ctx context.Context) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", "/scheduling/pause", nil, jsonContent, nil)
+}
+
+// Fsck checks the configstore data consistency and, when repair is true,
+// repairs the problems that could be automatically repaired
+func (c *Client) Fsck(ctx context.Context, repair bool) (*gwapitypes.FsckResponse, *http.Response, error) {
+	method := "GET"
+	if repair {
+		method = "POST"
+	}
+	res := new(gwapitypes.FsckResponse)
+	resp, err := c.getParsedResponse(ctx, method, "/maintenance/fsck", nil, jsonContent, nil, res)
+	return res, resp, err
+}
+
+func (c *Client) GetExecutors(ctx context.Context) ([]*gwapitypes.ExecutorResponse, *http.Response, error) {
+	executors := []*gwapitypes.ExecutorResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/executors", nil, jsonContent, nil, &executors)
+	return executors, resp, err
+}
+
+func (c *Client) DeleteExecutor(ctx context.Context, executorID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", path.Join("/executors", executorID), nil, jsonContent, nil)
+}
+
 func (c *Client) GetVersion(ctx context.Context) (*gwapitypes.VersionResponse, *http.Response, error) {
 	res := &gwapitypes.VersionResponse{}
 	resp, err := c.getParsedResponse(ctx, "GET", "/version", nil, jsonContent, nil, &res)
 	return res, resp, err
 }
+
+func (c *Client) GetAuditEvents(ctx context.Context, actor, action, resource string, since, until *time.Time, start string, limit int, asc bool) ([]*gwapitypes.AuditEventResponse, *http.Response, error) {
+	q := url.Values{}
+	if actor != "" {
+		q.Add("actor", actor)
+	}
+	if action != "" {
+		q.Add("action", action)
+	}
+	if resource != "" {
+		q.Add("resource", resource)
+	}
+	if since != nil {
+		q.Add("since", since.Format(time.RFC3339))
+	}
+	if until != nil {
+		q.Add("until", until.Format(time.RFC3339))
+	}
+	if start != "" {
+		q.Add("start", start)
+	}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+	if asc {
+		q.Add("asc", "")
+	}
+
+	auditEvents := []*gwapitypes.AuditEventResponse{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/auditevents", q, jsonContent, nil, &auditEvents)
+	return auditEvents, resp, err
+}
+
+// GetRunConfigSchema returns the json schema of the run config
+func (c *Client) GetRunConfigSchema(ctx context.Context) (json.RawMessage, *http.Response, error) {
+	var schema json.RawMessage
+	resp, err := c.getParsedResponse(ctx, "GET", "/runconfigschema", nil, jsonContent, nil, &schema)
+	return schema, resp, err
+}
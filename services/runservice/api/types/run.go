@@ -15,6 +15,8 @@
 package types
 
 import (
+	"time"
+
 	rstypes "agola.io/agola/services/runservice/types"
 )
 
@@ -22,6 +24,15 @@ type RunResponse struct {
 	Run                     *rstypes.Run       `json:"run"`
 	RunConfig               *rstypes.RunConfig `json:"run_config"`
 	ChangeGroupsUpdateToken string             `json:"change_groups_update_tokens"`
+
+	// QueueStatus is reported only for queued runs
+	QueueStatus *RunQueueStatus `json:"queue_status,omitempty"`
+}
+
+type RunQueueStatus struct {
+	Position           int        `json:"position"`
+	RunningRuns        int        `json:"running_runs"`
+	EstimatedStartTime *time.Time `json:"estimated_start_time,omitempty"`
 }
 
 type GetRunsResponse struct {
@@ -29,23 +40,143 @@ type GetRunsResponse struct {
 	ChangeGroupsUpdateToken string         `json:"change_groups_update_tokens"`
 }
 
+type GetRunStatsResponse struct {
+	Stats []*rstypes.RunStats `json:"stats"`
+}
+
+// RunExportRecord is a finished run record streamed by the runs export api as
+// newline delimited json
+type RunExportRecord struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Group       string            `json:"group"`
+	Counter     uint64            `json:"counter"`
+	Result      rstypes.RunResult `json:"result"`
+	Annotations map[string]string `json:"annotations"`
+	TriggerType string            `json:"trigger_type"`
+	TriggeredBy string            `json:"triggered_by"`
+	CommitSHA   string            `json:"commit_sha"`
+	Attempt     uint64            `json:"attempt"`
+
+	EnqueueTime *time.Time `json:"enqueue_time"`
+	StartTime   *time.Time `json:"start_time"`
+	EndTime     *time.Time `json:"end_time"`
+	// QueueDurationMs is the time in milliseconds between the run enqueue and start
+	QueueDurationMs int64 `json:"queue_duration_ms"`
+	// DurationMs is the run duration in milliseconds
+	DurationMs int64 `json:"duration_ms"`
+
+	Tasks []*RunExportTask `json:"tasks"`
+
+	// Watermark is the watermark to provide to continue the export after this
+	// run
+	Watermark string `json:"watermark"`
+}
+
+type RunExportTask struct {
+	ID         string                `json:"id"`
+	Name       string                `json:"name"`
+	Status     rstypes.RunTaskStatus `json:"status"`
+	StartTime  *time.Time            `json:"start_time"`
+	EndTime    *time.Time            `json:"end_time"`
+	DurationMs int64                 `json:"duration_ms"`
+}
+
+type GetPreviewEnvironmentsResponse struct {
+	PreviewEnvironments []*rstypes.PreviewEnvironment `json:"preview_environments"`
+}
+
+// RunConfigDiffResponse reports the differences between the run configs of
+// two runs. The values that could contain secrets are redacted.
+type RunConfigDiffResponse struct {
+	RunID         string `json:"run_id"`
+	RunGroup      string `json:"run_group"`
+	OtherRunID    string `json:"other_run_id"`
+	OtherRunGroup string `json:"other_run_group"`
+
+	// ChangedFields are the changed run config fields (tasks excluded)
+	ChangedFields []string `json:"changed_fields"`
+	AddedTasks    []string `json:"added_tasks"`
+	RemovedTasks  []string `json:"removed_tasks"`
+	ChangedTasks  []string `json:"changed_tasks"`
+
+	// Diff is the unified diff of the run configs. Empty when they're equal
+	Diff string `json:"diff"`
+}
+
+// RunProvenanceResponse is a DSSE envelope containing the base64 encoded in-toto
+// statement, with a SLSA provenance predicate, of a run. The field names are
+// the ones defined by the DSSE specification.
+type RunProvenanceResponse struct {
+	PayloadType string                    `json:"payloadType"`
+	Payload     string                    `json:"payload"`
+	Signatures  []*RunProvenanceSignature `json:"signatures"`
+}
+
+type RunProvenanceSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// RunTaskEnvironmentResponse reports the environment of a run task. The values
+// taken from variables (or that could contain secrets) are redacted.
+type RunTaskEnvironmentResponse struct {
+	RunID       string                            `json:"run_id"`
+	TaskID      string                            `json:"task_id"`
+	TaskName    string                            `json:"task_name"`
+	Environment map[string]string                 `json:"environment"`
+	Steps       []*RunTaskStepEnvironmentResponse `json:"steps"`
+}
+
+type RunTaskStepEnvironmentResponse struct {
+	Step        int               `json:"step"`
+	Name        string            `json:"name"`
+	Environment map[string]string `json:"environment"`
+}
+
 type RunCreateRequest struct {
 	// new run fields
 	RunConfigTasks    map[string]*rstypes.RunConfigTask `json:"run_config_tasks"`
 	Name              string                            `json:"name"`
 	Group             string                            `json:"group"`
 	SetupErrors       []string                          `json:"setup_errors"`
+	NoRunsReason      string                            `json:"no_runs_reason,omitempty"`
 	StaticEnvironment map[string]string                 `json:"static_environment"`
 	CacheGroup        string                            `json:"cache_group"`
+	CommitSHA         string                            `json:"commit_sha"`
+	CommitAuthorName  string                            `json:"commit_author_name"`
+	CommitAuthorEmail string                            `json:"commit_author_email"`
+	CommitMessage     string                            `json:"commit_message"`
+	Untrusted         bool                              `json:"untrusted"`
+	// WebhookDeliveryID is the id of the webhook delivery that triggered the
+	// run and Replayed reports that it's a replay of the delivery
+	WebhookDeliveryID string `json:"webhook_delivery_id,omitempty"`
+	Replayed          bool   `json:"replayed,omitempty"`
+	// DependsOn are the ids of the upstream runs that must successfully
+	// finish before the run is started
+	DependsOn []string `json:"depends_on"`
+	// Tags are the run tags
+	Tags []string `json:"tags,omitempty"`
+	// PreviewEnvironment is the pull request preview environment deployed or
+	// torn down by the run
+	PreviewEnvironment *rstypes.RunPreviewEnvironment `json:"preview_environment,omitempty"`
 
 	// existing run fields
-	RunID      string   `json:"run_id"`
-	FromStart  bool     `json:"from_start"`
+	RunID     string `json:"run_id"`
+	FromStart bool   `json:"from_start"`
+	// FromTask is the name of the task from which the run is restarted
+	FromTask   string   `json:"from_task,omitempty"`
 	ResetTasks []string `json:"reset_tasks"`
 
 	// common fields
 	Environment map[string]string `json:"environment"`
 	Annotations map[string]string `json:"annotations"`
+	TriggerType string            `json:"trigger_type"`
+	TriggeredBy string            `json:"triggered_by"`
+	// ExecutorID pins the run tasks to the provided executor
+	ExecutorID string `json:"executor_id,omitempty"`
+	// DebugHold keeps the pods of the failed tasks running to debug them
+	DebugHold bool `json:"debug_hold,omitempty"`
 
 	ChangeGroupsUpdateToken string `json:"changeup_update_tokens"`
 }
@@ -55,13 +186,18 @@ type RunActionType string
 const (
 	RunActionTypeChangePhase RunActionType = "changephase"
 	RunActionTypeStop        RunActionType = "stop"
+	RunActionTypeSetTags     RunActionType = "settags"
 )
 
 type RunActionsRequest struct {
 	ActionType RunActionType `json:"action_type"`
 
-	Phase                   rstypes.RunPhase `json:"phase"`
-	ChangeGroupsUpdateToken string           `json:"change_groups_update_tokens"`
+	Phase rstypes.RunPhase `json:"phase"`
+
+	// set tags fields
+	Tags []string `json:"tags,omitempty"`
+
+	ChangeGroupsUpdateToken string `json:"change_groups_update_tokens"`
 }
 
 type RunTaskActionType string
@@ -77,6 +213,11 @@ type RunTaskActionsRequest struct {
 	// set Annotations fields
 	Annotations map[string]string `json:"annotations,omitempty"`
 
+	// approve fields
+	// Approvers are the ids of the users that approved the task. They're
+	// checked against the task deploy environment protection rules.
+	Approvers []string `json:"approvers,omitempty"`
+
 	// global fields
 	ChangeGroupsUpdateToken string `json:"change_groups_update_tokens"`
 }
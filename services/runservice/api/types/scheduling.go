@@ -0,0 +1,33 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	rstypes "agola.io/agola/services/runservice/types"
+)
+
+type SchedulingStatusResponse struct {
+	// Paused reports if the scheduling is paused. While paused the new runs are
+	// queued and no new tasks are submitted to the executors
+	Paused bool `json:"paused"`
+	// Pause is the pause requested using the api
+	Pause *rstypes.SchedulingPause `json:"pause,omitempty"`
+	// Window is the configured pause window currently active
+	Window string `json:"window,omitempty"`
+}
+
+type SchedulingPauseRequest struct {
+	Reason string `json:"reason"`
+}
@@ -25,9 +25,12 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	rsapitypes "agola.io/agola/services/runservice/api/types"
 	rstypes "agola.io/agola/services/runservice/types"
+
+	"go.opentelemetry.io/otel/propagation"
 	errors "golang.org/x/xerrors"
 )
 
@@ -66,6 +69,8 @@ func (c *Client) doRequest(ctx context.Context, method, path string, query url.V
 	for k, v := range header {
 		req.Header[k] = v
 	}
+	// propagate the trace context to the runservice
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	if contentLength >= 0 {
 		req.ContentLength = contentLength
@@ -117,6 +122,16 @@ func (c *Client) SendExecutorStatus(ctx context.Context, executor *rstypes.Execu
 	return c.getResponse(ctx, "POST", fmt.Sprintf("/executor/%s", executor.ID), nil, -1, jsonContent, bytes.NewReader(executorj))
 }
 
+func (c *Client) GetExecutors(ctx context.Context) ([]*rstypes.Executor, *http.Response, error) {
+	executors := []*rstypes.Executor{}
+	resp, err := c.getParsedResponse(ctx, "GET", "/executors", nil, jsonContent, nil, &executors)
+	return executors, resp, err
+}
+
+func (c *Client) DeleteExecutor(ctx context.Context, executorID string) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", fmt.Sprintf("/executor/%s", executorID), nil, -1, jsonContent, nil)
+}
+
 func (c *Client) SendExecutorTaskStatus(ctx context.Context, executorID string, et *rstypes.ExecutorTask) (*http.Response, error) {
 	etj, err := json.Marshal(et)
 	if err != nil {
@@ -165,7 +180,7 @@ func (c *Client) PutCache(ctx context.Context, key string, size int64, r io.Read
 	return c.getResponse(ctx, "POST", fmt.Sprintf("/executor/caches/%s", url.PathEscape(key)), nil, size, nil, r)
 }
 
-func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups []string, lastRun bool, changeGroups []string, start string, limit int, asc bool) (*rsapitypes.GetRunsResponse, *http.Response, error) {
+func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, tagFilter, groups []string, lastRun bool, changeGroups []string, start string, limit int, asc bool) (*rsapitypes.GetRunsResponse, *http.Response, error) {
 	q := url.Values{}
 	for _, phase := range phaseFilter {
 		q.Add("phase", phase)
@@ -173,6 +188,9 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups
 	for _, result := range resultFilter {
 		q.Add("result", result)
 	}
+	for _, tag := range tagFilter {
+		q.Add("tag", tag)
+	}
 	for _, group := range groups {
 		q.Add("group", group)
 	}
@@ -197,28 +215,98 @@ func (c *Client) GetRuns(ctx context.Context, phaseFilter, resultFilter, groups
 	return getRunsResponse, resp, err
 }
 
+func (c *Client) GetRunStats(ctx context.Context, group string, start, end *time.Time, bucket string, bySubgroup bool) (*rsapitypes.GetRunStatsResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if start != nil {
+		q.Add("start", start.Format(time.RFC3339))
+	}
+	if end != nil {
+		q.Add("end", end.Format(time.RFC3339))
+	}
+	if bucket != "" {
+		q.Add("bucket", bucket)
+	}
+	if bySubgroup {
+		q.Add("bysubgroup", "")
+	}
+
+	getRunStatsResponse := new(rsapitypes.GetRunStatsResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/runs/stats", q, jsonContent, nil, getRunStatsResponse)
+	return getRunStatsResponse, resp, err
+}
+
+// ExportRuns returns the response streaming the finished runs of the provided
+// group as newline delimited json records. The caller must close the response
+// body.
+func (c *Client) ExportRuns(ctx context.Context, group string, start, end *time.Time, watermark string) (*http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	if start != nil {
+		q.Add("start", start.Format(time.RFC3339))
+	}
+	if end != nil {
+		q.Add("end", end.Format(time.RFC3339))
+	}
+	if watermark != "" {
+		q.Add("watermark", watermark)
+	}
+
+	return c.getResponse(ctx, "GET", "/runs/export", q, -1, nil, nil)
+}
+
+// GetPreviewEnvironments returns the active preview environments of the run
+// groups inside the provided group
+func (c *Client) GetPreviewEnvironments(ctx context.Context, group string) (*rsapitypes.GetPreviewEnvironmentsResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+
+	getPreviewEnvironmentsResponse := new(rsapitypes.GetPreviewEnvironmentsResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/previewenvironments", q, jsonContent, nil, getPreviewEnvironmentsResponse)
+	return getPreviewEnvironmentsResponse, resp, err
+}
+
+func (c *Client) GetRunTaskEnvironment(ctx context.Context, runID, taskID string) (*rsapitypes.RunTaskEnvironmentResponse, *http.Response, error) {
+	runTaskEnvironmentResponse := new(rsapitypes.RunTaskEnvironmentResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/tasks/%s/environment", runID, taskID), nil, jsonContent, nil, runTaskEnvironmentResponse)
+	return runTaskEnvironmentResponse, resp, err
+}
+
+func (c *Client) GetRunConfigDiff(ctx context.Context, runID, otherRunID string) (*rsapitypes.RunConfigDiffResponse, *http.Response, error) {
+	runConfigDiffResponse := new(rsapitypes.RunConfigDiffResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/configdiff/%s", runID, otherRunID), nil, jsonContent, nil, runConfigDiffResponse)
+	return runConfigDiffResponse, resp, err
+}
+
+// GetRunProvenance returns the signed provenance of a successful run
+func (c *Client) GetRunProvenance(ctx context.Context, runID string) (*rsapitypes.RunProvenanceResponse, *http.Response, error) {
+	runProvenanceResponse := new(rsapitypes.RunProvenanceResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/runs/%s/provenance", runID), nil, jsonContent, nil, runProvenanceResponse)
+	return runProvenanceResponse, resp, err
+}
+
 func (c *Client) GetQueuedRuns(ctx context.Context, start string, limit int, changeGroups []string) (*rsapitypes.GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{}, false, changeGroups, start, limit, true)
+	return c.GetRuns(ctx, []string{"queued"}, nil, nil, []string{}, false, changeGroups, start, limit, true)
 }
 
 func (c *Client) GetRunningRuns(ctx context.Context, start string, limit int, changeGroups []string) (*rsapitypes.GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"running"}, nil, []string{}, false, changeGroups, start, limit, true)
+	return c.GetRuns(ctx, []string{"running"}, nil, nil, []string{}, false, changeGroups, start, limit, true)
 }
 
 func (c *Client) GetGroupQueuedRuns(ctx context.Context, group string, limit int, changeGroups []string) (*rsapitypes.GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, "", limit, false)
+	return c.GetRuns(ctx, []string{"queued"}, nil, nil, []string{group}, false, changeGroups, "", limit, false)
 }
 
 func (c *Client) GetGroupRunningRuns(ctx context.Context, group string, limit int, changeGroups []string) (*rsapitypes.GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"running"}, nil, []string{group}, false, changeGroups, "", limit, false)
+	return c.GetRuns(ctx, []string{"running"}, nil, nil, []string{group}, false, changeGroups, "", limit, false)
 }
 
 func (c *Client) GetGroupFirstQueuedRuns(ctx context.Context, group string, changeGroups []string) (*rsapitypes.GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, []string{"queued"}, nil, []string{group}, false, changeGroups, "", 1, true)
+	return c.GetRuns(ctx, []string{"queued"}, nil, nil, []string{group}, false, changeGroups, "", 1, true)
 }
 
 func (c *Client) GetGroupLastRun(ctx context.Context, group string, changeGroups []string) (*rsapitypes.GetRunsResponse, *http.Response, error) {
-	return c.GetRuns(ctx, nil, nil, []string{group}, false, changeGroups, "", 1, false)
+	return c.GetRuns(ctx, nil, nil, nil, []string{group}, false, changeGroups, "", 1, false)
 }
 
 func (c *Client) CreateRun(ctx context.Context, req *rsapitypes.RunCreateRequest) (*rsapitypes.RunResponse, *http.Response, error) {
@@ -250,6 +338,52 @@ func (c *Client) StartRun(ctx context.Context, runID string, changeGroupsUpdateT
 	return c.RunActions(ctx, runID, req)
 }
 
+func (c *Client) CreateWebhookDelivery(ctx context.Context, delivery *rstypes.WebhookDelivery) (*rstypes.WebhookDelivery, *http.Response, error) {
+	deliveryj, err := json.Marshal(delivery)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := new(rstypes.WebhookDelivery)
+	resp, err := c.getParsedResponse(ctx, "PUT", fmt.Sprintf("/webhookdeliveries/%s/%s", delivery.ProjectID, delivery.ID), nil, jsonContent, bytes.NewReader(deliveryj), res)
+	return res, resp, err
+}
+
+func (c *Client) GetWebhookDeliveries(ctx context.Context, projectID string, limit int) ([]*rstypes.WebhookDelivery, *http.Response, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Add("limit", strconv.Itoa(limit))
+	}
+
+	deliveries := []*rstypes.WebhookDelivery{}
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/webhookdeliveries/%s", projectID), q, jsonContent, nil, &deliveries)
+	return deliveries, resp, err
+}
+
+func (c *Client) GetWebhookDelivery(ctx context.Context, projectID, deliveryID string) (*rstypes.WebhookDelivery, *http.Response, error) {
+	delivery := new(rstypes.WebhookDelivery)
+	resp, err := c.getParsedResponse(ctx, "GET", fmt.Sprintf("/webhookdeliveries/%s/%s", projectID, deliveryID), nil, jsonContent, nil, delivery)
+	return delivery, resp, err
+}
+
+func (c *Client) GetSchedulingStatus(ctx context.Context) (*rsapitypes.SchedulingStatusResponse, *http.Response, error) {
+	status := new(rsapitypes.SchedulingStatusResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/scheduling", nil, jsonContent, nil, status)
+	return status, resp, err
+}
+
+func (c *Client) PauseScheduling(ctx context.Context, req *rsapitypes.SchedulingPauseRequest) (*http.Response, error) {
+	reqj, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.getResponse(ctx, "PUT", "/scheduling/pause", nil, -1, jsonContent, bytes.NewReader(reqj))
+}
+
+func (c *Client) ResumeScheduling(ctx context.Context) (*http.Response, error) {
+	return c.getResponse(ctx, "DELETE", "/scheduling/pause", nil, -1, jsonContent, nil)
+}
+
 func (c *Client) RunTaskActions(ctx context.Context, runID, taskID string, req *rsapitypes.RunTaskActionsRequest) (*http.Response, error) {
 	reqj, err := json.Marshal(req)
 	if err != nil {
@@ -288,7 +422,22 @@ func (c *Client) GetRun(ctx context.Context, runID string, changeGroups []string
 	return runResponse, resp, err
 }
 
-func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool, step int, follow bool) (*http.Response, error) {
+func (c *Client) GetRunByCounter(ctx context.Context, group string, counter uint64, changeGroups []string) (*rsapitypes.RunResponse, *http.Response, error) {
+	q := url.Values{}
+	q.Add("group", group)
+	q.Add("counter", strconv.FormatUint(counter, 10))
+	for _, changeGroup := range changeGroups {
+		q.Add("changegroup", changeGroup)
+	}
+
+	runResponse := new(rsapitypes.RunResponse)
+	resp, err := c.getParsedResponse(ctx, "GET", "/runs/bycounter", q, jsonContent, nil, runResponse)
+	return runResponse, resp, err
+}
+
+// GetLogs returns the task log starting from offset. The provided header is
+// sent with the request (i.e. to request a Range of a stored log).
+func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool, step int, follow bool, offset int64, header http.Header) (*http.Response, error) {
 	q := url.Values{}
 	q.Add("runid", runID)
 	q.Add("taskid", taskID)
@@ -300,8 +449,11 @@ func (c *Client) GetLogs(ctx context.Context, runID, taskID string, setup bool,
 	if follow {
 		q.Add("follow", "")
 	}
+	if offset > 0 {
+		q.Add("offset", strconv.FormatInt(offset, 10))
+	}
 
-	return c.getResponse(ctx, "GET", "/logs", q, -1, nil, nil)
+	return c.getResponse(ctx, "GET", "/logs", q, -1, header, nil)
 }
 
 func (c *Client) DeleteLogs(ctx context.Context, runID, taskID string, setup bool, step int) (*http.Response, error) {
@@ -18,6 +18,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"agola.io/agola/services/types"
@@ -28,6 +29,16 @@ import (
 
 const (
 	RunGenericSetupErrorName = "Setup Error"
+	// RunNoRunsName is the name of the run reporting that an event didn't
+	// create any run
+	RunNoRunsName = "No Runs"
+)
+
+const (
+	// NetworkPolicyUntrusted is the network policy applied to untrusted runs
+	// (like pull requests from forked repositories). When not defined by the
+	// executor configuration it denies all the egress traffic.
+	NetworkPolicyUntrusted = "untrusted"
 )
 
 type SortOrder int
@@ -47,6 +58,87 @@ type RunCounter struct {
 	Counter uint64
 }
 
+// PreviewEnvironment is an active pull request preview environment. It's
+// registered by the runs deploying it and removed by the run tearing it down
+// when the pull request is closed.
+type PreviewEnvironment struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+
+	// Group is the run group of the pull request (i.e.
+	// /project/$projectid/pr/$prid)
+	Group string `json:"group,omitempty"`
+
+	// RunID is the id of the last run that deployed the environment
+	RunID string `json:"run_id,omitempty"`
+
+	CreationTime time.Time `json:"creation_time,omitempty"`
+	UpdateTime   time.Time `json:"update_time,omitempty"`
+}
+
+// RunStatsBucket is the time bucket used to aggregate the run statistics
+type RunStatsBucket string
+
+const (
+	// RunStatsBucketNone aggregates all the runs in the time window in a single bucket
+	RunStatsBucketNone RunStatsBucket = ""
+	RunStatsBucketHour RunStatsBucket = "hour"
+	RunStatsBucketDay  RunStatsBucket = "day"
+	// RunStatsBucketWeek buckets start on monday
+	RunStatsBucketWeek RunStatsBucket = "week"
+)
+
+func (b RunStatsBucket) IsValid() bool {
+	switch b {
+	case RunStatsBucketNone, RunStatsBucketHour, RunStatsBucketDay, RunStatsBucketWeek:
+		return true
+	}
+	return false
+}
+
+// RunStats are the aggregated statistics of the finished runs of a run group
+// ended inside a time bucket
+type RunStats struct {
+	// Group is the run group of the aggregated runs
+	Group string `json:"group,omitempty"`
+	// BucketStart is the start time of the time bucket. It's nil when the runs
+	// aren't aggregated by time bucket.
+	BucketStart *time.Time `json:"bucket_start,omitempty"`
+
+	RunCount     uint64 `json:"run_count"`
+	SuccessCount uint64 `json:"success_count"`
+	FailedCount  uint64 `json:"failed_count"`
+	StoppedCount uint64 `json:"stopped_count"`
+
+	// MedianDuration is the median of the runs durations
+	MedianDuration time.Duration `json:"median_duration"`
+
+	// CacheRestoreHits and CacheRestoreMisses are the number of restore_cache
+	// steps of the runs tasks that restored or didn't find a cache
+	CacheRestoreHits   uint64 `json:"cache_restore_hits"`
+	CacheRestoreMisses uint64 `json:"cache_restore_misses"`
+	CacheRestoredBytes int64  `json:"cache_restored_bytes"`
+	CacheSavedBytes    int64  `json:"cache_saved_bytes"`
+}
+
+// CacheHitRate returns the ratio of the restore_cache steps that restored a
+// cache
+func (s *RunStats) CacheHitRate() float64 {
+	n := s.CacheRestoreHits + s.CacheRestoreMisses
+	if n == 0 {
+		return 0
+	}
+	return float64(s.CacheRestoreHits) / float64(n)
+}
+
+// SuccessRate returns the ratio of the successful runs
+func (s *RunStats) SuccessRate() float64 {
+	if s.RunCount == 0 {
+		return 0
+	}
+	return float64(s.SuccessCount) / float64(s.RunCount)
+}
+
 type RunPhase string
 
 const (
@@ -64,6 +156,9 @@ const (
 	RunResultStopped RunResult = "stopped"
 	RunResultSuccess RunResult = "success"
 	RunResultFailed  RunResult = "failed"
+	// RunResultSkipped is the result of a run, without tasks, only reporting
+	// why an event didn't create any run
+	RunResultSkipped RunResult = "skipped"
 )
 
 func (s RunPhase) IsFinished() bool {
@@ -107,6 +202,10 @@ type Run struct {
 	// Annotations contain custom run annotations
 	Annotations map[string]string `json:"annotations,omitempty"`
 
+	// Tags are the sorted run labels (i.e. release, nightly) used to filter
+	// the runs
+	Tags []string `json:"tags,omitempty"`
+
 	// Phase represent the current run status. A run could be running but already
 	// marked as failed due to some tasks failed. The run will be marked as finished
 	// only then all the executor tasks are known to be really ended. This permits
@@ -127,10 +226,82 @@ type Run struct {
 
 	Archived bool `json:"archived,omitempty"`
 
+	// Trigger contains the run provenance
+	Trigger *RunTrigger `json:"trigger,omitempty"`
+
+	// DependsOn are the ids of the upstream runs (also of other groups) that
+	// must successfully finish before the run is started. When one of them
+	// finishes without success the run is cancelled.
+	DependsOn []string `json:"depends_on,omitempty"`
+
+	// CancelReason reports why the run was cancelled by the runservice
+	CancelReason string `json:"cancel_reason,omitempty"`
+
+	// TraceParent is the W3C traceparent of the run creation span. It's used to
+	// add the run scheduling and execution spans to the same trace.
+	TraceParent string `json:"trace_parent,omitempty"`
+
+	// PreviewEnvironment is the pull request preview environment deployed or
+	// torn down by the run
+	PreviewEnvironment *RunPreviewEnvironment `json:"preview_environment,omitempty"`
+
 	// internal values not saved
 	Revision int64 `json:"-"`
 }
 
+// RunPreviewEnvironment defines the pull request preview environment managed
+// by a run
+type RunPreviewEnvironment struct {
+	Name string `json:"name,omitempty"`
+	// Teardown reports that the run tears down the environment instead of
+	// deploying it
+	Teardown bool `json:"teardown,omitempty"`
+}
+
+// RunTrigger contains who or what triggered a run and, for restarted runs, the
+// run lineage
+type RunTrigger struct {
+	// Type is the trigger type provided by the run creator (i.e. webhook,
+	// manual, restart)
+	Type string `json:"type,omitempty"`
+
+	// TriggeredBy is who or what triggered the run (i.e. a user id or a webhook
+	// sender)
+	TriggeredBy string `json:"triggered_by,omitempty"`
+
+	// CommitSHA is the commit sha of the original run
+	CommitSHA string `json:"commit_sha,omitempty"`
+	// CommitAuthorName and CommitAuthorEmail are the commit author reported
+	// by the git source
+	CommitAuthorName  string `json:"commit_author_name,omitempty"`
+	CommitAuthorEmail string `json:"commit_author_email,omitempty"`
+	// CommitMessage is the first line of the commit message
+	CommitMessage string `json:"commit_message,omitempty"`
+
+	// Untrusted reports if the run was triggered by an untrusted source (i.e.
+	// a pull request from a forked repository of a not collaborator). It's
+	// kept on restart.
+	Untrusted bool `json:"untrusted,omitempty"`
+
+	// ParentRunID is the id of the run this run was restarted from
+	ParentRunID string `json:"parent_run_id,omitempty"`
+	// RootRunID is the id of the first run of the restart lineage
+	RootRunID string `json:"root_run_id,omitempty"`
+	// Attempt is the number of restarts since the root run. It's 0 for a newly
+	// created run.
+	Attempt uint64 `json:"attempt,omitempty"`
+
+	// WebhookDeliveryID is the id of the webhook delivery that triggered the
+	// run
+	WebhookDeliveryID string `json:"webhook_delivery_id,omitempty"`
+	// Replayed reports that the run was created by replaying the webhook
+	// delivery
+	Replayed bool `json:"replayed,omitempty"`
+	// EnvironmentOverrides are the names of the environment variables
+	// overridden when restarting this run or a run of its restart lineage
+	EnvironmentOverrides []string `json:"environment_overrides,omitempty"`
+}
+
 func (r *Run) DeepCopy() *Run {
 	nr, err := copystructure.Copy(r)
 	if err != nil {
@@ -164,6 +335,9 @@ func (r *Run) CanRestartFromScratch() (bool, string) {
 	if r.Phase == RunPhaseSetupError {
 		return false, fmt.Sprintf("run has setup errors")
 	}
+	if r.Result == RunResultSkipped {
+		return false, fmt.Sprintf("run has no tasks")
+	}
 	// can restart only if the run phase is finished or cancelled
 	if !r.Phase.IsFinished() {
 		return false, fmt.Sprintf("run is not finished, phase: %q", r.Phase)
@@ -176,6 +350,9 @@ func (r *Run) CanRestartFromFailedTasks() (bool, string) {
 	if r.Phase == RunPhaseSetupError {
 		return false, fmt.Sprintf("run has setup errors")
 	}
+	if r.Result == RunResultSkipped {
+		return false, fmt.Sprintf("run has no tasks")
+	}
 	// can restart only if the run phase is finished or cancelled
 	if !r.Phase.IsFinished() {
 		return false, fmt.Sprintf("run is not finished, phase: %q", r.Phase)
@@ -195,6 +372,34 @@ func (r *Run) CanRestartFromFailedTasks() (bool, string) {
 	return true, ""
 }
 
+// CanRestartFromTask reports if the run can be restarted from the task with
+// the provided id
+func (r *Run) CanRestartFromTask(taskID string) (bool, string) {
+	if r.Phase == RunPhaseSetupError {
+		return false, fmt.Sprintf("run has setup errors")
+	}
+	if r.Result == RunResultSkipped {
+		return false, fmt.Sprintf("run has no tasks")
+	}
+	// can restart only if the run phase is finished or cancelled
+	if !r.Phase.IsFinished() {
+		return false, fmt.Sprintf("run is not finished, phase: %q", r.Phase)
+	}
+	if _, ok := r.Tasks[taskID]; !ok {
+		return false, fmt.Sprintf("run %q doesn't have task %q", r.ID, taskID)
+	}
+	// can restart only if the successful tasks, that could be reused, are
+	// fully archived
+	for _, rt := range r.Tasks {
+		if rt.Status == RunTaskStatusSuccess {
+			if !rt.LogsFetchFinished() || !rt.ArchivesFetchFinished() {
+				return false, fmt.Sprintf("run %q task %q not fully archived", r.ID, rt.ID)
+			}
+		}
+	}
+	return true, ""
+}
+
 type RunTaskStatus string
 
 const (
@@ -238,6 +443,18 @@ type RunTask struct {
 	WaitingApproval bool `json:"waiting_approval,omitempty"`
 	Approved        bool `json:"approved,omitempty"`
 
+	// WaitTimerEndTime is the time after which the task, targeting a deploy
+	// environment with a wait timer, could be executed
+	WaitTimerEndTime *time.Time `json:"wait_timer_end_time,omitempty"`
+
+	// WaitingExecutorReason reports why the task, ready to be executed, is
+	// waiting for an executor (i.e. no executors supporting the task arch)
+	WaitingExecutorReason string `json:"waiting_executor_reason,omitempty"`
+
+	// FailError reports why the task failed outside of its steps (i.e. the
+	// task image pull failed)
+	FailError string `json:"fail_error,omitempty"`
+
 	SetupStep RunTaskStep    `json:"setup_step,omitempty"`
 	Steps     []*RunTaskStep `json:"steps,omitempty"`
 
@@ -245,6 +462,25 @@ type RunTask struct {
 	WorkspaceArchives      []int               `json:"workspace_archives,omitempty"`
 	WorkspaceArchivesPhase []RunTaskFetchPhase `json:"workspace_archives_phase,omitempty"`
 
+	// Reports are the summaries of the task reports
+	Reports []*ReportSummary `json:"reports,omitempty"`
+
+	// Outputs are the task outputs set by the task steps
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// ResourceUsage is the resource usage of the task main container
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+
+	// StopResult reports how the task processes terminated when the task was
+	// stopped
+	StopResult TaskStopResult `json:"stop_result,omitempty"`
+
+	// ImagePull reports the pull of the task main container image
+	ImagePull *ImagePull `json:"image_pull,omitempty"`
+
+	// DebugHold reports where the pod of the failed task is kept running
+	DebugHold *TaskDebugHold `json:"debug_hold,omitempty"`
+
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
 }
@@ -279,10 +515,53 @@ type RunTaskStep struct {
 
 	ExitStatus *int `json:"exit_status"`
 
+	// ResourceUsage is the resource usage sampled during the step execution
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+
+	// Cache reports the cache usage of a restore_cache or save_cache step
+	Cache *StepCache `json:"cache,omitempty"`
+	// ArchiveSize is the size in bytes of the archive of a save_to_workspace
+	// step
+	ArchiveSize int64 `json:"archive_size,omitempty"`
+
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
 }
 
+// CacheUsage returns the cache and workspace archives usage of the task steps
+func (rt *RunTask) CacheUsage() *TaskCacheUsage {
+	u := &TaskCacheUsage{}
+	for _, s := range rt.Steps {
+		u.ArchivesSize += s.ArchiveSize
+		if s.Cache == nil {
+			continue
+		}
+		switch s.Cache.Type {
+		case StepCacheTypeRestore:
+			if s.Cache.Hit {
+				u.RestoreHits++
+				u.RestoredBytes += s.Cache.Size
+			} else {
+				u.RestoreMisses++
+			}
+		case StepCacheTypeSave:
+			if !s.Cache.Hit {
+				u.SavedBytes += s.Cache.Size
+			}
+		}
+	}
+	return u
+}
+
+// TaskCacheUsage is the cache and workspace archives usage of a task
+type TaskCacheUsage struct {
+	RestoreHits   int   `json:"restore_hits"`
+	RestoreMisses int   `json:"restore_misses"`
+	RestoredBytes int64 `json:"restored_bytes"`
+	SavedBytes    int64 `json:"saved_bytes"`
+	ArchivesSize  int64 `json:"archives_size"`
+}
+
 // RunConfig
 
 // RunConfig is the run configuration.
@@ -302,6 +581,10 @@ type RunConfig struct {
 	// A list of setup errors when the run is in phase setuperror
 	SetupErrors []string `json:"setup_errors,omitempty"`
 
+	// NoRunsReason, when defined, reports why an event didn't create any run.
+	// The run doesn't have tasks and it's created with a skipped result.
+	NoRunsReason string `json:"no_runs_reason,omitempty"`
+
 	// Annotations contain custom run annotations
 	// Note: Annotations are currently both saved in a Run and in RunConfig to
 	// easily return them without loading RunConfig from the lts
@@ -320,6 +603,15 @@ type RunConfig struct {
 
 	// CacheGroup is the cache group where the run caches belongs
 	CacheGroup string `json:"cache_group,omitempty"`
+
+	// ExecutorID, when defined, is the executor where all the run tasks will
+	// be scheduled bypassing the executor selection. Used for debugging
+	// executor specific issues.
+	ExecutorID string `json:"executor_id,omitempty"`
+
+	// DebugHold asks the executors to keep the pod of a failed task running
+	// for a while to let the users debug it
+	DebugHold bool `json:"debug_hold,omitempty"`
 }
 
 func (rc *RunConfig) DeepCopy() *RunConfig {
@@ -345,6 +637,143 @@ type RunConfigTask struct {
 	NeedsApproval        bool                            `json:"needs_approval,omitempty"`
 	Skip                 bool                            `json:"skip,omitempty"`
 	DockerRegistriesAuth map[string]DockerRegistryAuth   `json:"docker_registries_auth"`
+	// NetworkPolicy is the name of the executor network policy applied to the
+	// task containers. Empty means no restriction.
+	NetworkPolicy string `json:"network_policy,omitempty"`
+	// SecurityProfile is the name of the executor security profile applied to
+	// the task containers. Empty means the executor default security profile.
+	SecurityProfile string `json:"security_profile,omitempty"`
+	// MaxStepLogSize overrides the executor max log size of every task step.
+	// 0 means use the executor default.
+	MaxStepLogSize int64 `json:"max_step_log_size,omitempty"`
+	// Reports are the task reports parsed at the end of the task
+	Reports []*Report `json:"reports,omitempty"`
+	// StopSignal is the signal sent to the task processes when the task is
+	// stopped. Empty means SIGTERM.
+	StopSignal string `json:"stop_signal,omitempty"`
+	// StopGracePeriod is the time given to the task processes to exit after
+	// the stop signal before being killed
+	StopGracePeriod time.Duration `json:"stop_grace_period,omitempty"`
+	// SecretEnvironment are the names of the task environment variables
+	// whose value is taken from a variable
+	SecretEnvironment []string `json:"secret_environment,omitempty"`
+	// SecretEnvironmentTracked reports that the names of the environment
+	// variables whose value is taken from a variable are recorded in the task,
+	// its containers and steps. It's false for tasks generated by older
+	// versions.
+	SecretEnvironmentTracked bool `json:"secret_environment_tracked,omitempty"`
+	// Files are written in the task main container before executing the
+	// steps
+	Files []*TaskFile `json:"files,omitempty"`
+	// Batch reports that the task could be executed in the pod of a previous
+	// task of the same batch
+	Batch bool `json:"batch,omitempty"`
+	// Always reports that the task is executed when its parents are finished
+	// whatever their result, also when the run is stopped. Its failure
+	// doesn't fail the run.
+	Always bool `json:"always,omitempty"`
+	// DeployEnvironment is the deploy environment targeted by the task with
+	// its protection rules
+	DeployEnvironment *RunConfigTaskDeployEnvironment `json:"deploy_environment,omitempty"`
+}
+
+// RunConfigTaskDeployEnvironment is the deploy environment targeted by a task.
+// The protection rules are taken from the project deploy environment at run
+// creation.
+type RunConfigTaskDeployEnvironment struct {
+	Name string `json:"name,omitempty"`
+	// RequiredApprovals is the number of distinct users that must approve the
+	// task
+	RequiredApprovals int `json:"required_approvals,omitempty"`
+	// Approvers are the ids of the users allowed to approve the task. Empty
+	// means any user.
+	Approvers []string `json:"approvers,omitempty"`
+	// WaitTimer is the time to wait before executing the task once it could
+	// be executed
+	WaitTimer time.Duration `json:"wait_timer,omitempty"`
+}
+
+// ValidApprovers returns the distinct provided approvers allowed to approve a
+// task targeting the deploy environment
+func (e *RunConfigTaskDeployEnvironment) ValidApprovers(approvers []string) []string {
+	valid := []string{}
+	seen := map[string]struct{}{}
+	for _, a := range approvers {
+		if _, ok := seen[a]; ok {
+			continue
+		}
+		seen[a] = struct{}{}
+		if !e.IsApprover(a) {
+			continue
+		}
+		valid = append(valid, a)
+	}
+	return valid
+}
+
+// IsApprover reports if the provided user could approve a task targeting the
+// deploy environment
+func (e *RunConfigTaskDeployEnvironment) IsApprover(userID string) bool {
+	if len(e.Approvers) == 0 {
+		return true
+	}
+	for _, a := range e.Approvers {
+		if a == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskFile is a file written in the task main container. Its content could
+// contain secrets.
+type TaskFile struct {
+	Path    string      `json:"path,omitempty"`
+	Content string      `json:"content,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+}
+
+type ReportFormat string
+
+const (
+	ReportFormatJUnit     ReportFormat = "junit"
+	ReportFormatCobertura ReportFormat = "cobertura"
+)
+
+func (f ReportFormat) IsValid() bool {
+	switch f {
+	case ReportFormatJUnit, ReportFormatCobertura:
+		return true
+	}
+	return false
+}
+
+// Report is a task report file (i.e. test results, coverage) parsed to
+// produce a ReportSummary
+type Report struct {
+	Format ReportFormat `json:"format,omitempty"`
+	// Path is the report file path pattern relative to the task working dir.
+	// All the matching files will be parsed.
+	Path string `json:"path,omitempty"`
+}
+
+// ReportSummary is the summary of a task report
+type ReportSummary struct {
+	Format ReportFormat `json:"format,omitempty"`
+	Path   string       `json:"path,omitempty"`
+
+	// test reports summary
+	Tests    int `json:"tests,omitempty"`
+	Failures int `json:"failures,omitempty"`
+	Errors   int `json:"errors,omitempty"`
+	Skipped  int `json:"skipped,omitempty"`
+
+	// Coverage is the coverage percentage of coverage reports
+	Coverage *float64 `json:"coverage,omitempty"`
+
+	// Error is the report parsing error. A report parsing error doesn't fail
+	// the task
+	Error string `json:"error,omitempty"`
 }
 
 func (rct *RunConfigTask) DeepCopy() *RunConfigTask {
@@ -396,8 +825,45 @@ type DockerRegistryAuth struct {
 
 type Runtime struct {
 	Type       RuntimeType  `json:"type,omitempty"`
+	OS         types.OS     `json:"os,omitempty"`
 	Arch       types.Arch   `json:"arch,omitempty"`
 	Containers []*Container `json:"containers,omitempty"`
+	GPUs       *GPUs        `json:"gpus,omitempty"`
+	// InitContainers are executed sequentially before the main container
+	InitContainers []*Container `json:"init_containers,omitempty"`
+	// Docker, when defined, is a docker daemon dedicated to the task
+	Docker *DockerDaemon `json:"docker,omitempty"`
+	// Limits, when defined, overrides the executor default task limits
+	Limits *TaskLimits `json:"limits,omitempty"`
+}
+
+// TaskLimits defines the max number of processes (0 means the executor
+// default) and the ulimits, keyed by name, of the task containers
+type TaskLimits struct {
+	Pids    int64             `json:"pids,omitempty"`
+	Ulimits map[string]Ulimit `json:"ulimits,omitempty"`
+}
+
+type Ulimit struct {
+	Soft int64 `json:"soft,omitempty"`
+	Hard int64 `json:"hard,omitempty"`
+}
+
+// DockerDaemon defines a docker daemon dedicated to a task. CPU (in cpu units)
+// and Memory (in bytes) aren't limited when 0. When Cache is true the daemon
+// storage is reused by the next tasks with the same cache prefix and trust
+// (untrusted runs never share it with trusted runs).
+type DockerDaemon struct {
+	Image  string  `json:"image,omitempty"`
+	CPU    float64 `json:"cpu,omitempty"`
+	Memory int64   `json:"memory,omitempty"`
+	Cache  bool    `json:"cache,omitempty"`
+}
+
+// GPUs defines the requested gpus. An empty Type means any gpu type
+type GPUs struct {
+	Count int    `json:"count,omitempty"`
+	Type  string `json:"type,omitempty"`
 }
 
 type Step interface{}
@@ -407,15 +873,34 @@ type Steps []Step
 type BaseStep struct {
 	Type string `json:"type,omitempty"`
 	Name string `json:"name,omitempty"`
+
+	// AlwaysRun reports that the step must be executed also if a previous step
+	// failed (used for the run after steps)
+	AlwaysRun bool `json:"always_run,omitempty"`
+
+	// Skip reports that the step won't be executed since its when conditions
+	// don't match
+	Skip bool `json:"skip,omitempty"`
 }
 
 type RunStep struct {
 	BaseStep
-	Command     string            `json:"command,omitempty"`
+	Command string `json:"command,omitempty"`
+	// CommandArgs, when defined, are executed as is (exec form) without a shell
+	CommandArgs []string `json:"command_args,omitempty"`
+	// Script is the path of a script file, relative to the working dir, to
+	// execute in place of the command
+	Script      string            `json:"script,omitempty"`
 	Environment map[string]string `json:"environment,omitempty"`
 	WorkingDir  string            `json:"working_dir,omitempty"`
 	Shell       string            `json:"shell,omitempty"`
 	Tty         *bool             `json:"tty,omitempty"`
+	// SecretEnvironment are the names of the step environment variables
+	// whose value is taken from a variable
+	SecretEnvironment []string `json:"secret_environment,omitempty"`
+	// Background, when true, starts the command without waiting for it to
+	// exit
+	Background bool `json:"background,omitempty"`
 }
 
 type SaveContent struct {
@@ -446,6 +931,15 @@ type RestoreCacheStep struct {
 	DestDir string   `json:"dest_dir,omitempty"`
 }
 
+// WaitBackgroundStep waits for the background run steps to exit or, when Stop
+// is true, stops them. When Steps is empty all the background steps started
+// before are used.
+type WaitBackgroundStep struct {
+	BaseStep
+	Steps []string `json:"steps,omitempty"`
+	Stop  bool     `json:"stop,omitempty"`
+}
+
 type ExecutorTaskPhase string
 
 const (
@@ -455,10 +949,12 @@ const (
 	ExecutorTaskPhaseStopped    ExecutorTaskPhase = "stopped"
 	ExecutorTaskPhaseSuccess    ExecutorTaskPhase = "success"
 	ExecutorTaskPhaseFailed     ExecutorTaskPhase = "failed"
+	// ExecutorTaskPhaseSkipped is only used for task steps
+	ExecutorTaskPhaseSkipped ExecutorTaskPhase = "skipped"
 )
 
 func (s ExecutorTaskPhase) IsFinished() bool {
-	return s == ExecutorTaskPhaseCancelled || s == ExecutorTaskPhaseStopped || s == ExecutorTaskPhaseSuccess || s == ExecutorTaskPhaseFailed
+	return s == ExecutorTaskPhaseCancelled || s == ExecutorTaskPhaseStopped || s == ExecutorTaskPhaseSuccess || s == ExecutorTaskPhaseFailed || s == ExecutorTaskPhaseSkipped
 }
 
 type ExecutorTask struct {
@@ -487,6 +983,22 @@ type ExecutorTaskSpec struct {
 	// Stop is used to signal from the scheduler when the task must be stopped
 	Stop bool `json:"stop,omitempty"`
 
+	// TraceParent is the W3C traceparent of the run creation span, the
+	// executor task execution spans are its children
+	TraceParent string `json:"trace_parent,omitempty"`
+
+	// GPUs are the gpus assigned to the task. Type is the gpu type provided by
+	// the chosen executor
+	GPUs *GPUs `json:"gpus,omitempty"`
+
+	// BatchID is the id of the batch of the task. The executor could execute
+	// the task in the pod of a previous task with the same batch id.
+	BatchID string `json:"batch_id,omitempty"`
+
+	// DebugHold asks the executor to keep the task pod running when the task
+	// fails
+	DebugHold bool `json:"debug_hold,omitempty"`
+
 	*ExecutorTaskSpecData
 }
 
@@ -495,6 +1007,7 @@ type ExecutorTaskSpec struct {
 // are generated everytime they are sent to the executor
 type ExecutorTaskSpecData struct {
 	TaskName    string            `json:"task_name,omitempty"`
+	OS          types.OS          `json:"os,omitempty"`
 	Arch        types.Arch        `json:"arch,omitempty"`
 	Containers  []*Container      `json:"containers,omitempty"`
 	Environment map[string]string `json:"environment,omitempty"`
@@ -503,14 +1016,41 @@ type ExecutorTaskSpecData struct {
 	User        string            `json:"user,omitempty"`
 	Privileged  bool              `json:"privileged"`
 
+	// InitContainers are executed sequentially before the main container
+	InitContainers []*Container `json:"init_containers,omitempty"`
+
+	DockerDaemon *DockerDaemon `json:"docker_daemon,omitempty"`
+
+	Limits *TaskLimits `json:"limits,omitempty"`
+
 	WorkspaceOperations []WorkspaceOperation `json:"workspace_operations,omitempty"`
 
 	DockerRegistriesAuth map[string]DockerRegistryAuth `json:"docker_registries_auth"`
 
+	NetworkPolicy string `json:"network_policy,omitempty"`
+
+	SecurityProfile string `json:"security_profile,omitempty"`
+
+	MaxStepLogSize int64 `json:"max_step_log_size,omitempty"`
+
+	StopSignal      string        `json:"stop_signal,omitempty"`
+	StopGracePeriod time.Duration `json:"stop_grace_period,omitempty"`
+
+	Reports []*Report `json:"reports,omitempty"`
+
+	Files []*TaskFile `json:"files,omitempty"`
+
 	// Cache prefix to use when asking for a cache key. To isolate caches between
 	// groups (projects)
 	CachePrefix string `json:"cache_prefix,omitempty"`
 
+	// ProjectID is the id of the project of the run. Empty for user direct
+	// runs
+	ProjectID string `json:"project_id,omitempty"`
+
+	// Untrusted reports that the run was triggered by an untrusted source
+	Untrusted bool `json:"untrusted,omitempty"`
+
 	Steps Steps `json:"steps,omitempty"`
 }
 
@@ -525,10 +1065,61 @@ type ExecutorTaskStatus struct {
 	SetupStep ExecutorTaskStepStatus    `json:"setup_step,omitempty"`
 	Steps     []*ExecutorTaskStepStatus `json:"steps,omitempty"`
 
+	Reports []*ReportSummary `json:"reports,omitempty"`
+
+	// Outputs are the task outputs set by the task steps
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// ResourceUsage is the resource usage of the task main container
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+
+	// StopResult reports how the task processes terminated when the task was
+	// stopped
+	StopResult TaskStopResult `json:"stop_result,omitempty"`
+
+	// ImagePull reports the pull of the task main container image
+	ImagePull *ImagePull `json:"image_pull,omitempty"`
+
+	// DebugHold is set while the pod of the failed task is kept running
+	DebugHold *TaskDebugHold `json:"debug_hold,omitempty"`
+
 	StartTime *time.Time `json:"start_time,omitempty"`
 	EndTime   *time.Time `json:"end_time,omitempty"`
 }
 
+// TaskDebugHold reports the pod of a failed task kept running by the executor
+// to debug it (i.e. executing a shell inside its main container)
+type TaskDebugHold struct {
+	ExecutorID string `json:"executor_id,omitempty"`
+	PodID      string `json:"pod_id,omitempty"`
+	// Until is when the pod will be stopped. Stopping the run stops it
+	// before.
+	Until time.Time `json:"until,omitempty"`
+}
+
+// TaskStopResult reports if the processes of a stopped task exited after the
+// stop signal or were killed
+type TaskStopResult string
+
+const (
+	TaskStopResultGraceful TaskStopResult = "graceful"
+	TaskStopResultKilled   TaskStopResult = "killed"
+)
+
+// ImagePull reports the pull of a container image done by the executor
+type ImagePull struct {
+	Image string `json:"image,omitempty"`
+	// CacheHit is true when the image layers were all already available
+	CacheHit bool `json:"cache_hit,omitempty"`
+	// PulledBytes is the size of the downloaded layers
+	PulledBytes  int64         `json:"pulled_bytes,omitempty"`
+	PulledLayers int           `json:"pulled_layers,omitempty"`
+	CachedLayers int           `json:"cached_layers,omitempty"`
+	Duration     time.Duration `json:"duration,omitempty"`
+	// Digest is the digest of the pulled image manifest
+	Digest string `json:"digest,omitempty"`
+}
+
 type ExecutorTaskStepStatus struct {
 	Phase ExecutorTaskPhase `json:"phase,omitempty"`
 
@@ -536,6 +1127,62 @@ type ExecutorTaskStepStatus struct {
 	EndTime   *time.Time `json:"end_time,omitempty"`
 
 	ExitStatus *int `json:"exit_status,omitempty"`
+
+	// ResourceUsage is the resource usage of the task main container sampled
+	// during the step execution
+	ResourceUsage *ResourceUsage `json:"resource_usage,omitempty"`
+
+	// Cache reports the cache usage of a restore_cache or save_cache step
+	Cache *StepCache `json:"cache,omitempty"`
+	// ArchiveSize is the size in bytes of the archive of a save_to_workspace
+	// step
+	ArchiveSize int64 `json:"archive_size,omitempty"`
+}
+
+type StepCacheType string
+
+const (
+	StepCacheTypeRestore StepCacheType = "restore"
+	StepCacheTypeSave    StepCacheType = "save"
+)
+
+// StepCache reports the cache usage of a restore_cache or save_cache step
+type StepCache struct {
+	Type StepCacheType `json:"type,omitempty"`
+	// Key is the restored or saved cache key (without the cache prefix). For
+	// a restore cache step missing all the keys it's empty.
+	Key string `json:"key,omitempty"`
+	// Hit reports, for a restore cache step, if a cache was restored and, for
+	// a save cache step, if the cache already existed and wasn't saved again
+	Hit bool `json:"hit,omitempty"`
+	// Size is the size in bytes of the restored or saved cache archive
+	Size int64 `json:"size,omitempty"`
+}
+
+// ResourceUsage reports the cpu and memory usage sampled during an execution
+type ResourceUsage struct {
+	// CPUPeak and CPUAverage are in cpu cores
+	CPUPeak    float64 `json:"cpu_peak,omitempty"`
+	CPUAverage float64 `json:"cpu_average,omitempty"`
+	// MemoryPeak and MemoryAverage are in bytes
+	MemoryPeak    int64 `json:"memory_peak,omitempty"`
+	MemoryAverage int64 `json:"memory_average,omitempty"`
+
+	Samples int `json:"samples,omitempty"`
+}
+
+// AddSample updates the resource usage peaks and averages with a new sample
+func (u *ResourceUsage) AddSample(cpu float64, memory int64) {
+	n := float64(u.Samples)
+	u.CPUAverage = (u.CPUAverage*n + cpu) / (n + 1)
+	u.MemoryAverage = int64((float64(u.MemoryAverage)*n + float64(memory)) / (n + 1))
+	if cpu > u.CPUPeak {
+		u.CPUPeak = cpu
+	}
+	if memory > u.MemoryPeak {
+		u.MemoryPeak = memory
+	}
+	u.Samples++
 }
 
 type Container struct {
@@ -544,7 +1191,16 @@ type Container struct {
 	User        string            `json:"user,omitempty"`
 	Privileged  bool              `json:"privileged"`
 	Entrypoint  string            `json:"entrypoint"`
-	Volumes     []Volume          `json:"volumes"`
+	// EntrypointArgs, when defined, override Entrypoint and are passed as is
+	// to the container runtime
+	EntrypointArgs []string `json:"entrypoint_args,omitempty"`
+	Volumes        []Volume `json:"volumes"`
+	// SecretEnvironment are the names of the container environment variables
+	// whose value is taken from a variable
+	SecretEnvironment []string `json:"secret_environment,omitempty"`
+	// ShmSize is the size in bytes of the container /dev/shm. 0 means the
+	// container runtime default
+	ShmSize int64 `json:"shm_size,omitempty"`
 }
 
 type Volume struct {
@@ -611,6 +1267,12 @@ func (et *Steps) UnmarshalJSON(b []byte) error {
 				return err
 			}
 			steps[i] = &s
+		case "wait_background":
+			var s WaitBackgroundStep
+			if err := json.Unmarshal(step, &s); err != nil {
+				return err
+			}
+			steps[i] = &s
 		}
 	}
 
@@ -650,19 +1312,50 @@ func UnmarshalChangeGroupsUpdateToken(s string) (*ChangeGroupsUpdateToken, error
 	return t, nil
 }
 
+// SchedulingPause is a scheduling pause requested using the api. While paused
+// no new runs are started and no new tasks are submitted to the executors.
+type SchedulingPause struct {
+	Reason   string    `json:"reason,omitempty"`
+	PausedAt time.Time `json:"paused_at,omitempty"`
+}
+
+type ExecutorGPUs struct {
+	Type  string `json:"type,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
 type Executor struct {
 	// ID is the Executor unique id
 	ID        string `json:"id,omitempty"`
 	ListenURL string `json:"listenURL,omitempty"`
 
+	// SessionID is randomly generated at every executor start. A different
+	// session id reports that the executor was restarted
+	SessionID string `json:"session_id,omitempty"`
+
+	// OS is the os of the containers run by the executor. Empty means linux
+	OS    types.OS     `json:"os,omitempty"`
 	Archs []types.Arch `json:"archs,omitempty"`
 
 	Labels map[string]string `json:"labels,omitempty"`
 
 	AllowPrivilegedContainers bool `json:"allow_privileged_containers,omitempty"`
 
+	// GPUs are the gpus provided by the executor
+	GPUs []*ExecutorGPUs `json:"gpus,omitempty"`
+
+	// ActiveTasksLimit is the executor capacity: the max number of concurrent
+	// active tasks. 0 means no limit
 	ActiveTasksLimit int `json:"active_tasks_limit,omitempty"`
 	ActiveTasks      int `json:"active_tasks,omitempty"`
+	// Utilization is the ratio between the active tasks and the active tasks
+	// limit. 0 when there's no limit
+	Utilization float64 `json:"utilization,omitempty"`
+
+	// Draining reports that the executor is draining: no new tasks will be
+	// assigned to it while the already assigned ones will continue their
+	// execution
+	Draining bool `json:"draining,omitempty"`
 
 	// Dynamic represents an executor that can be automatically removed since it's
 	// part of a group of executors managing the same resources (i.e. a k8s
@@ -689,6 +1382,31 @@ func (e *Executor) DeepCopy() *Executor {
 	return ne.(*Executor)
 }
 
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusSuccess WebhookDeliveryStatus = "success"
+	WebhookDeliveryStatusFailed  WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is a webhook received by the gateway for a project. It
+// contains the original request headers and payload so it can be replayed.
+type WebhookDelivery struct {
+	ID        string `json:"id,omitempty"`
+	ProjectID string `json:"project_id,omitempty"`
+
+	ReceivedAt time.Time `json:"received_at,omitempty"`
+	// Event is the git source event type reported by the request headers
+	Event string `json:"event,omitempty"`
+
+	Header  map[string][]string `json:"header,omitempty"`
+	Payload []byte              `json:"payload,omitempty"`
+
+	// Status is the delivery processing result and Error its error
+	Status WebhookDeliveryStatus `json:"status,omitempty"`
+	Error  string                `json:"error,omitempty"`
+}
+
 type RunEvent struct {
 	Sequence string
 	RunID    string
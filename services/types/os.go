@@ -0,0 +1,41 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+type OS string
+
+const (
+	OSLinux   OS = "linux"
+	OSWindows OS = "windows"
+)
+
+var ValidOSs = []OS{OSLinux, OSWindows}
+
+func IsValidOS(os OS) bool {
+	for _, vos := range ValidOSs {
+		if os == vos {
+			return true
+		}
+	}
+	return false
+}
+
+// OSOrDefault returns the provided os or linux when empty
+func OSOrDefault(os OS) OS {
+	if os == "" {
+		return OSLinux
+	}
+	return os
+}
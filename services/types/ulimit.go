@@ -0,0 +1,28 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// ValidUlimits are the names of the ulimits that could be applied to the task
+// containers
+var ValidUlimits = []string{"core", "fsize", "memlock", "nofile", "nproc", "stack"}
+
+func IsValidUlimit(name string) bool {
+	for _, vu := range ValidUlimits {
+		if name == vu {
+			return true
+		}
+	}
+	return false
+}
@@ -804,7 +804,7 @@ func TestPush(t *testing.T) {
 			push(t, tt.config, giteaRepo.CloneURL, giteaToken, tt.message, false)
 
 			_ = testutil.Wait(30*time.Second, func() (bool, error) {
-				runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
+				runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
 				if err != nil {
 					return false, nil
 				}
@@ -820,7 +820,7 @@ func TestPush(t *testing.T) {
 				return true, nil
 			})
 
-			runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
+			runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}
@@ -990,7 +990,7 @@ func TestDirectRun(t *testing.T) {
 			directRun(t, dir, config, c.Gateway.APIExposedURL, token, tt.args...)
 
 			_ = testutil.Wait(30*time.Second, func() (bool, error) {
-				runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+				runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 				if err != nil {
 					return false, nil
 				}
@@ -1007,7 +1007,7 @@ func TestDirectRun(t *testing.T) {
 				return true, nil
 			})
 
-			runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+			runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}
@@ -1144,7 +1144,7 @@ func TestDirectRunVariables(t *testing.T) {
 
 			// TODO(sgotti) add an util to wait for a run phase
 			_ = testutil.Wait(30*time.Second, func() (bool, error) {
-				runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+				runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 				if err != nil {
 					return false, nil
 				}
@@ -1161,7 +1161,7 @@ func TestDirectRunVariables(t *testing.T) {
 				return true, nil
 			})
 
-			runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+			runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}
@@ -1314,7 +1314,7 @@ func TestDirectRunLogs(t *testing.T) {
 			directRun(t, dir, config, c.Gateway.APIExposedURL, token)
 
 			_ = testutil.Wait(30*time.Second, func() (bool, error) {
-				runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+				runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 				if err != nil {
 					return false, nil
 				}
@@ -1331,7 +1331,7 @@ func TestDirectRunLogs(t *testing.T) {
 				return true, nil
 			})
 
-			runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+			runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}
@@ -1619,7 +1619,7 @@ func TestPullRequest(t *testing.T) {
 				}
 			}
 			_ = testutil.Wait(30*time.Second, func() (bool, error) {
-				runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
+				runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
 				if err != nil {
 					return false, nil
 				}
@@ -1635,7 +1635,7 @@ func TestPullRequest(t *testing.T) {
 				return true, nil
 			})
 
-			runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
+			runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/project", project.ID)}, nil, "", 0, false)
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}
@@ -1789,7 +1789,7 @@ function(ctx) {
 
 			// TODO(sgotti) add an util to wait for a run phase
 			_ = testutil.Wait(30*time.Second, func() (bool, error) {
-				runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+				runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 				if err != nil {
 					return false, nil
 				}
@@ -1806,7 +1806,7 @@ function(ctx) {
 				return true, nil
 			})
 
-			runs, _, err := gwClient.GetRuns(ctx, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
+			runs, _, err := gwClient.GetRuns(ctx, nil, nil, nil, []string{path.Join("/user", user.ID)}, nil, "", 0, false)
 			if err != nil {
 				t.Fatalf("unexpected err: %v", err)
 			}